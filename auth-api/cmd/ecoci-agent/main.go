@@ -0,0 +1,90 @@
+// Command ecoci-agent measures the CI jobs of self-hosted runners on Kubernetes. It runs as a
+// DaemonSet with the host's /sys and /proc mounted under /host, splits the energy of its node
+// (RAPL, or Kepler with --kepler-url) between the runner pods by CPU time, and submits a run
+// for every runner pod that completes.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/ecoci/auth-api/internal/agent"
+	"github.com/ecoci/auth-api/internal/client"
+	"github.com/ecoci/auth-api/internal/energy"
+	"github.com/ecoci/auth-api/internal/version"
+)
+
+// envOrDefault returns the environment variable key, or defaultValue when it is unset
+func envOrDefault(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func main() {
+	log.SetFlags(log.LstdFlags | log.LUTC)
+	log.SetPrefix("ecoci-agent: ")
+
+	node := flag.String("node", os.Getenv("NODE_NAME"), "Name of the node the agent runs on (default $NODE_NAME)")
+	selector := flag.String("selector", envOrDefault("ECOCI_AGENT_SELECTOR", agent.DefaultSelector), "Label selector of the runner pods (default $ECOCI_AGENT_SELECTOR)")
+	interval := flag.Duration("interval", 10*time.Second, "Time between samples")
+	hostRoot := flag.String("host-root", "/host", "Directory the host's /sys and /proc are mounted in")
+	keplerURL := flag.String("kepler-url", os.Getenv("ECOCI_KEPLER_URL"), "Kepler metrics URL to read the node energy from instead of RAPL (default $ECOCI_KEPLER_URL)")
+	region := flag.String("region", os.Getenv("ECOCI_REGION"), "Cloud region of the node (default $ECOCI_REGION, else resolved from the instance metadata)")
+	intensity := flag.Float64("intensity", 0, "Carbon intensity of the grid in g CO2e/kWh (default by region)")
+	repo := flag.String("repo", os.Getenv("ECOCI_REPOSITORY"), "Repository of runner pods without the "+agent.AnnotationRepository+" annotation (default $ECOCI_REPOSITORY)")
+	apiURL := flag.String("api-url", envOrDefault("ECOCI_API_URL", client.DefaultBaseURL), "URL of the EcoCI API (default $ECOCI_API_URL)")
+	token := flag.String("token", os.Getenv("ECOCI_TOKEN"), "API token (default $ECOCI_TOKEN)")
+	spool := flag.String("spool", envOrDefault("ECOCI_SPOOL", "/var/lib/ecoci-agent/spool.jsonl"), "File queueing runs while the API is unreachable; empty to disable (default $ECOCI_SPOOL)")
+	flag.Parse()
+
+	if *node == "" {
+		log.Fatal("--node is required; set NODE_NAME from spec.nodeName in the DaemonSet")
+	}
+	if *token == "" {
+		log.Fatal("an API token is required in ECOCI_TOKEN or --token")
+	}
+
+	kube, err := agent.InCluster()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var power agent.PowerSource
+	if *keplerURL != "" {
+		power = agent.NewKeplerPower(*keplerURL)
+	} else if power, err = agent.NewRAPLPower(filepath.Join(*hostRoot, "sys/class/powercap")); err != nil {
+		log.Fatalf("Failed to read RAPL counters, set --kepler-url on nodes without RAPL: %v", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if *region == "" {
+		*region = energy.NewRegionResolver().Resolve(ctx)
+	}
+	gramsPerKWh, _ := energy.CarbonIntensity(*region)
+	if *intensity > 0 {
+		gramsPerKWh = *intensity
+	}
+
+	a := agent.New(agent.Config{
+		Node:            *node,
+		Selector:        *selector,
+		CgroupRoot:      filepath.Join(*hostRoot, "sys/fs/cgroup"),
+		ProcRoot:        filepath.Join(*hostRoot, "proc"),
+		Region:          *region,
+		CarbonIntensity: gramsPerKWh,
+		Repository:      *repo,
+	}, kube, power, client.NewSpool(client.New(*apiURL, *token), *spool))
+
+	log.Printf("Starting ecoci-agent %s on node %s: %s power, region %q at %g g CO2e/kWh", version.Get().Version, *node, power.Method(), *region, gramsPerKWh)
+	a.Run(ctx, *interval)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ecoci/auth-api/internal/client"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// runBudgetCheck prints the budgets of a repository and exits with status 1 when one is
+// exceeded, so a pipeline step can enforce them
+func runBudgetCheck(args []string) {
+	flags := flag.NewFlagSet("budget-check", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: ecoci budget-check [flags]")
+		flags.PrintDefaults()
+	}
+	repo := flags.String("repo", os.Getenv("GITHUB_REPOSITORY"), "Full name of the repository, such as octocat/hello-world (default $GITHUB_REPOSITORY)")
+	warnOnly := flags.Bool("warn-only", false, "Report exceeded budgets without failing")
+	apiURL := flags.String("api-url", envOrDefault("ECOCI_API_URL", client.DefaultBaseURL), "URL of the EcoCI API (default $ECOCI_API_URL)")
+	token := flags.String("token", os.Getenv("ECOCI_TOKEN"), "API token (default $ECOCI_TOKEN)")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *repo == "" {
+		log.Fatal("--repo is required outside GitHub Actions")
+	}
+	if *token == "" {
+		log.Fatal("an API token is required: set ECOCI_TOKEN or --token")
+	}
+
+	ctx := context.Background()
+	api := client.New(*apiURL, *token)
+	repository, err := api.Repository(ctx, *repo)
+	if err != nil {
+		log.Fatal(err)
+	}
+	check, err := api.BudgetCheck(ctx, repository.ID)
+	if err != nil {
+		log.Fatalf("Failed to check budgets: %v", err)
+	}
+
+	if check.Status == service.BudgetStatusNone {
+		fmt.Printf("%s has no CO2 budgets\n", *repo)
+		return
+	}
+	// GitHub Actions shows workflow commands as annotations of the run
+	annotate := os.Getenv("GITHUB_ACTIONS") == "true"
+	for _, budget := range check.Budgets {
+		line := fmt.Sprintf("%sly budget of %s: %s used (%.0f%%), %s forecast by %s, %s",
+			budget.Period, *repo, formatCO2(budget.ActualCO2Kg), budget.ActualCO2Kg / *budget.BudgetCO2Kg * 100,
+			formatCO2(budget.ForecastCO2Kg), budget.End.AddDate(0, 0, -1).Format(time.DateOnly), budgetLimit(budget))
+		switch {
+		case annotate && budget.BudgetStatus == service.BudgetStatusExceeded && !*warnOnly:
+			fmt.Println("::error title=CO2 budget exceeded::" + line)
+		case annotate && budget.BudgetStatus != service.BudgetStatusOnTrack:
+			fmt.Println("::warning title=CO2 budget::" + line)
+		default:
+			fmt.Println(line)
+		}
+	}
+
+	if check.Exceeded {
+		if *warnOnly {
+			fmt.Fprintln(os.Stderr, "ecoci: CO2 budget exceeded (--warn-only)")
+			return
+		}
+		fmt.Fprintln(os.Stderr, "ecoci: CO2 budget exceeded")
+		os.Exit(1)
+	}
+}
+
+// budgetLimit describes the status of a budget with its limit
+func budgetLimit(budget service.PeriodForecast) string {
+	switch budget.BudgetStatus {
+	case service.BudgetStatusExceeded:
+		return "exceeding its limit of " + formatCO2(*budget.BudgetCO2Kg)
+	case service.BudgetStatusAtRisk:
+		return "at risk of exceeding its limit of " + formatCO2(*budget.BudgetCO2Kg)
+	default:
+		return "within its limit of " + formatCO2(*budget.BudgetCO2Kg)
+	}
+}
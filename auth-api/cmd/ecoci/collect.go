@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/ecoci/auth-api/internal/energy"
+)
+
+const collectUsage = `Usage: ecoci collect <start|stop> [flags]
+
+Measures the energy of a CI job between "ecoci collect start", the first step of the job, and
+"ecoci collect stop", its last step, which submits the run. The energy is read from the RAPL
+counters of the runner, or estimated from the CPU time of its cgroup where RAPL is unavailable.
+`
+
+// samplerInterval is how often the background sampler reads the RAPL counters, often enough
+// that a counter cannot wrap around twice in between
+const samplerInterval = 30 * time.Second
+
+// defaultStatePath is where the collect steps share the measurement of the job: RUNNER_TEMP
+// is per job on GitHub Actions runners
+func defaultStatePath() string {
+	return filepath.Join(envOrDefault("RUNNER_TEMP", os.TempDir()), "ecoci-collect.json")
+}
+
+// carbonFlags are the flags converting energy to CO2
+type carbonFlags struct {
+	region    *string
+	intensity *float64
+}
+
+// addCarbonFlags registers the carbon flags on flags
+func addCarbonFlags(flags *flag.FlagSet) *carbonFlags {
+	return &carbonFlags{
+		region:    flags.String("region", os.Getenv("ECOCI_REGION"), "Cloud region of the runner (default $ECOCI_REGION, else resolved from the instance metadata)"),
+		intensity: flags.Float64("intensity", 0, "Carbon intensity of the grid in g CO2e/kWh (default by region)"),
+	}
+}
+
+// co2 returns the CO2 in kg of energy in kWh, resolving the region if it is not set, and adds
+// the region and carbon intensity to metadata
+func (f *carbonFlags) co2(energyKWh float64, metadata map[string]interface{}) float64 {
+	region := *f.region
+	if region == "" {
+		region = energy.NewRegionResolver().Resolve(context.Background())
+	}
+	gramsPerKWh, _ := energy.CarbonIntensity(region)
+	if *f.intensity > 0 {
+		gramsPerKWh = *f.intensity
+	}
+
+	metadata["carbon_intensity"] = gramsPerKWh
+	if region != "" {
+		metadata["region"] = region
+	}
+	return energyKWh * gramsPerKWh / 1000
+}
+
+// runCollect measures the energy of a CI job
+func runCollect(args []string) {
+	if len(args) < 1 {
+		fmt.Fprint(os.Stderr, collectUsage)
+		os.Exit(2)
+	}
+
+	switch args[0] {
+	case "start":
+		runCollectStart(args[1:])
+	case "stop":
+		runCollectStop(args[1:])
+	case "sample":
+		runCollectSample(args[1:])
+	case "help", "-h", "-help", "--help":
+		fmt.Print(collectUsage)
+	default:
+		fmt.Fprintf(os.Stderr, "ecoci: unknown collect command %q\n\n%s", args[0], collectUsage)
+		os.Exit(2)
+	}
+}
+
+// runCollectStart takes the first reading of the job and starts the background sampler for
+// RAPL counters
+func runCollectStart(args []string) {
+	flags := flag.NewFlagSet("collect start", flag.ExitOnError)
+	statePath := flags.String("state", defaultStatePath(), "File the measurement of the job is kept in")
+	flags.Parse(args)
+
+	meter, err := energy.Detect("/")
+	if err != nil {
+		log.Fatalf("Failed to find an energy meter: %v", err)
+	}
+	reading, err := meter.Read()
+	if err != nil {
+		log.Fatal(err)
+	}
+	session := energy.NewSession(meter.Method(), reading, runtime.NumCPU())
+
+	// Cumulative CPU time needs no sampling in between; RAPL counters wrap around
+	if meter.Method() == energy.MethodRAPL {
+		pid, err := startSampler(*statePath)
+		if err != nil {
+			log.Fatalf("Failed to start the sampler: %v", err)
+		}
+		session.SamplerPID = pid
+	}
+	if err := session.Save(*statePath); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Measuring energy with %s\n", meter.Method())
+}
+
+// startSampler starts "ecoci collect sample" in the background. It outlives this step: the
+// runner only kills the processes a job leaves behind once the job completes.
+func startSampler(statePath string) (int, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	cmd := exec.Command(executable, "collect", "sample", "--state", statePath)
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+	pid := cmd.Process.Pid
+	return pid, cmd.Process.Release()
+}
+
+// runCollectSample accumulates the RAPL counters into the measurement until it is killed by
+// "ecoci collect stop"
+func runCollectSample(args []string) {
+	flags := flag.NewFlagSet("collect sample", flag.ExitOnError)
+	statePath := flags.String("state", defaultStatePath(), "File the measurement of the job is kept in")
+	interval := flags.Duration("interval", samplerInterval, "Time between readings")
+	flags.Parse(args)
+
+	meter, err := energy.NewRAPL("/sys/class/powercap")
+	if err != nil {
+		log.Fatal(err)
+	}
+	for range time.Tick(*interval) {
+		session, err := energy.LoadSession(*statePath)
+		if errors.Is(err, os.ErrNotExist) {
+			return
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		reading, err := meter.Read()
+		if err != nil {
+			log.Fatal(err)
+		}
+		session.Add(reading)
+		if err := session.Save(*statePath); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// runCollectStop takes the last reading of the job and submits its run
+func runCollectStop(args []string) {
+	flags := flag.NewFlagSet("collect stop", flag.ExitOnError)
+	statePath := flags.String("state", defaultStatePath(), "File the measurement of the job is kept in")
+	carbon := addCarbonFlags(flags)
+	run := addRunFlags(flags)
+	flags.Parse(args)
+
+	session, err := energy.LoadSession(*statePath)
+	if err != nil {
+		log.Fatalf("No measurement to stop, run \"ecoci collect start\" first: %v", err)
+	}
+	if session.SamplerPID != 0 {
+		if process, err := os.FindProcess(session.SamplerPID); err == nil {
+			process.Kill()
+		}
+	}
+
+	var meter energy.Meter
+	if session.Method == energy.MethodRAPL {
+		meter, err = energy.NewRAPL("/sys/class/powercap")
+	} else {
+		meter, err = energy.NewCgroupCPU("/")
+	}
+	if err != nil {
+		log.Fatalf("Failed to read the %s meter: %v", session.Method, err)
+	}
+	reading, err := meter.Read()
+	if err != nil {
+		log.Fatal(err)
+	}
+	session.Add(reading)
+	os.Remove(*statePath)
+
+	energyKWh := session.EnergyKWh()
+	measured := map[string]interface{}{"measurement_method": session.Method}
+	co2 := carbon.co2(energyKWh, measured)
+	if session.Method == energy.MethodCgroupCPU {
+		measured["cpu_seconds"] = (session.Last.CPUTime - session.StartCPUTime).Seconds()
+	}
+
+	run.submit(run.request(energyKWh, co2, session.Duration().Seconds(), measured))
+}
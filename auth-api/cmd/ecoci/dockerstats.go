@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ecoci/auth-api/internal/energy"
+)
+
+// containerState is the part of the state of a container that docker inspect reports
+type containerState struct {
+	Running    bool      `json:"Running"`
+	StartedAt  time.Time `json:"StartedAt"`
+	FinishedAt time.Time `json:"FinishedAt"`
+}
+
+// inspectContainer returns the state of a container, or nil if it does not exist
+func inspectContainer(container string) (*containerState, error) {
+	out, err := exec.Command("docker", "inspect", "--type", "container", "--format", "{{json .State}}", container).Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && bytes.Contains(bytes.ToLower(exitErr.Stderr), []byte("no such")) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("docker inspect failed: %w", err)
+	}
+	var state containerState
+	if err := json.Unmarshal(out, &state); err != nil {
+		return nil, fmt.Errorf("invalid docker inspect output: %w", err)
+	}
+	return &state, nil
+}
+
+// sampleContainer reads the current usage of a running container
+func sampleContainer(container string) (energy.DockerSample, error) {
+	out, err := exec.Command("docker", "stats", "--no-stream", "--format", "{{json .}}", container).Output()
+	if err != nil {
+		return energy.DockerSample{}, fmt.Errorf("docker stats failed: %w", err)
+	}
+	return energy.ParseDockerStats(bytes.TrimSpace(out))
+}
+
+// profileNames lists the hardware profiles for the usage text
+func profileNames() string {
+	names := make([]string, 0, len(energy.Profiles))
+	for name := range energy.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// runDockerStats estimates the energy of a build container from docker stats over its
+// lifetime and submits the run when it stops
+func runDockerStats(args []string) {
+	flags := flag.NewFlagSet("docker-stats", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: ecoci docker-stats [flags] <container>")
+		flags.PrintDefaults()
+	}
+	interval := flags.Duration("interval", 5*time.Second, "Time between samples")
+	wait := flags.Duration("wait", time.Minute, "How long to wait for the container to start")
+	profileName := flags.String("profile", energy.DefaultProfile, "Hardware profile of the host: "+profileNames())
+	carbon := addCarbonFlags(flags)
+	run := addRunFlags(flags)
+	// Flags may follow the container too
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	container := flags.Arg(0)
+	flags.Parse(flags.Args()[1:])
+	if flags.NArg() > 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	profile, ok := energy.Profiles[*profileName]
+	if !ok {
+		log.Fatalf("unknown --profile %q, expected one of %s", *profileName, profileNames())
+	}
+
+	// Wait for the container to start, so the command can be started before the build
+	deadline := time.Now().Add(*wait)
+	state, err := inspectContainer(container)
+	for err == nil && (state == nil || (!state.Running && state.StartedAt.IsZero())) {
+		if time.Now().After(deadline) {
+			log.Fatalf("container %s did not start within %s", container, *wait)
+		}
+		time.Sleep(time.Second)
+		state, err = inspectContainer(container)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Energy is the mean power of the samples over the lifetime of the container
+	started := time.Now()
+	var watts, cpus, peakMemory float64
+	samples := 0
+	for state != nil && state.Running {
+		if sample, err := sampleContainer(container); err == nil {
+			watts += profile.ContainerWatts(sample.CPUs, sample.MemoryBytes/1e9)
+			cpus += sample.CPUs
+			peakMemory = max(peakMemory, sample.MemoryBytes)
+			samples++
+		}
+		time.Sleep(*interval)
+		if state, err = inspectContainer(container); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if samples == 0 {
+		log.Fatalf("container %s stopped before it could be sampled", container)
+	}
+
+	// The container's timestamps are more precise, unless it was removed on exit
+	duration := time.Since(started).Seconds()
+	if state != nil && state.FinishedAt.After(state.StartedAt) {
+		duration = state.FinishedAt.Sub(state.StartedAt).Seconds()
+	}
+	joules := watts / float64(samples) * duration
+	cpuSeconds := cpus / float64(samples) * duration
+
+	energyKWh := joules / 3.6e6
+	measured := map[string]interface{}{
+		"measurement_method": "docker_stats",
+		"hardware_profile":   *profileName,
+		"container":          container,
+		"cpu_seconds":        cpuSeconds,
+		"peak_memory_bytes":  peakMemory,
+	}
+	co2 := carbon.co2(energyKWh, measured)
+	run.submit(run.request(energyKWh, co2, duration, measured))
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ecoci/auth-api/internal/energy"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// gpuSamplerInterval is how often the power draw of the GPUs is read; it is held until the
+// next reading, so it must be short against the phases of a job
+const gpuSamplerInterval = 2 * time.Second
+
+// readGPUs reads the power draw of the GPUs with nvidia-smi
+func readGPUs() ([]energy.GPUReading, error) {
+	output, err := exec.Command("nvidia-smi", energy.NvidiaSMIArgs...).Output()
+	if err != nil {
+		return nil, err
+	}
+	return energy.ParseNvidiaSMI(output)
+}
+
+// gpuSampler accumulates the power draw of the GPUs while a command runs
+type gpuSampler struct {
+	mu      sync.Mutex
+	session *energy.GPUSession
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// startGPU starts sampling the GPUs, or returns nil where nvidia-smi reports none
+func startGPU() *gpuSampler {
+	readings, err := readGPUs()
+	if err != nil || len(readings) == 0 {
+		return nil
+	}
+	s := &gpuSampler{session: energy.NewGPUSession(time.Now(), readings), done: make(chan struct{})}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(gpuSamplerInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+				s.sample()
+			}
+		}
+	}()
+	return s
+}
+
+func (s *gpuSampler) sample() {
+	readings, err := readGPUs()
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.session.Add(time.Now(), readings)
+}
+
+// stop takes the last reading and returns the energy of the GPUs
+func (s *gpuSampler) stop() *gpuEnergy {
+	close(s.done)
+	s.wg.Wait()
+	s.sample()
+	measured := &gpuEnergy{}
+	for _, device := range s.session.Devices() {
+		measured.devices = append(measured.devices, service.GPUDeviceRequest{Index: device.Index, Model: device.Model, EnergyKWh: device.EnergyKWh()})
+		measured.kwh += device.EnergyKWh()
+	}
+	return measured
+}
+
+// gpuEnergy is the energy of the GPUs of a run, measured per device or estimated for count
+// GPUs of a model
+type gpuEnergy struct {
+	devices []service.GPUDeviceRequest
+	model   string
+	count   int
+	kwh     float64
+}
+
+// apply sets the GPU energy of req
+func (g *gpuEnergy) apply(req *service.RunCreateRequest) {
+	if len(g.devices) > 0 {
+		req.GPUs = g.devices
+		return
+	}
+	req.GPUEnergyKWh, req.GPUModel, req.GPUCount = &g.kwh, &g.model, &g.count
+}
+
+// String describes the GPU energy for the measurement summary
+func (g *gpuEnergy) String() string {
+	if len(g.devices) > 0 {
+		return fmt.Sprintf("%.3g Wh (%d GPUs, nvidia-smi)", g.kwh*1000, len(g.devices))
+	}
+	return fmt.Sprintf("%.3g Wh (%d x %s, estimated)", g.kwh*1000, g.count, g.model)
+}
+
+// gpuFlags estimate the energy of GPUs whose power draw cannot be read
+type gpuFlags struct {
+	model       *string
+	count       *int
+	utilization *float64
+}
+
+// addGPUFlags registers the GPU flags on flags
+func addGPUFlags(flags *flag.FlagSet) *gpuFlags {
+	return &gpuFlags{
+		model:       flags.String("gpu-model", "", "Model of the GPUs to estimate energy for where nvidia-smi is unavailable: "+gpuModelNames()),
+		count:       flags.Int("gpu-count", 1, "Number of GPUs of --gpu-model"),
+		utilization: flags.Float64("gpu-utilization", 1, "Average utilization of the GPUs from 0 to 1, scaling their board power"),
+	}
+}
+
+// gpuModelNames lists the GPU profiles for the usage text
+func gpuModelNames() string {
+	names := make([]string, 0, len(energy.GPUProfiles))
+	for name := range energy.GPUProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// estimate returns the energy of the GPUs of the flags over the duration, or nil without
+// --gpu-model
+func (f *gpuFlags) estimate(duration time.Duration) *gpuEnergy {
+	if *f.model == "" {
+		return nil
+	}
+	if *f.count < 1 || *f.utilization < 0 || *f.utilization > 1 {
+		log.Fatal("--gpu-count must be positive and --gpu-utilization between 0 and 1")
+	}
+	kwh, err := energy.GPUKWh(*f.model, *f.count, *f.utilization, duration)
+	if err != nil {
+		log.Fatalf("%v, expected one of %s", err, gpuModelNames())
+	}
+	return &gpuEnergy{model: *f.model, count: *f.count, kwh: kwh}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// imageBuildFlags describe the container image a run built
+type imageBuildFlags struct {
+	image        *string
+	layersBuilt  *int
+	layersCached *int
+	sizeBytes    *int64
+	pushBytes    *int64
+}
+
+// addImageBuildFlags registers the image build flags on flags
+func addImageBuildFlags(flags *flag.FlagSet) *imageBuildFlags {
+	return &imageBuildFlags{
+		image:        flags.String("image", "", "Name of the container image the run built"),
+		layersBuilt:  flags.Int("layers-built", -1, "Image layers the run built, making it an image-build run (default not an image build)"),
+		layersCached: flags.Int("layers-cached", -1, "Image layers the run took from the build cache (default not an image build)"),
+		sizeBytes:    flags.Int64("image-size-bytes", -1, "Size of the built image in bytes (default not reported)"),
+		pushBytes:    flags.Int64("push-bytes", -1, "Bytes the run pushed to the registry (default not reported)"),
+	}
+}
+
+// request returns the image build of the flags, or nil when no layers were given
+func (f *imageBuildFlags) request() *service.ImageBuildRequest {
+	if *f.layersBuilt < 0 && *f.layersCached < 0 {
+		if *f.image != "" || *f.sizeBytes >= 0 || *f.pushBytes >= 0 {
+			log.Fatal("--image, --image-size-bytes and --push-bytes require --layers-built or --layers-cached")
+		}
+		return nil
+	}
+
+	req := &service.ImageBuildRequest{LayersBuilt: max(*f.layersBuilt, 0), LayersCached: max(*f.layersCached, 0)}
+	if *f.image != "" {
+		req.Image = f.image
+	}
+	if *f.sizeBytes >= 0 {
+		req.ImageSizeBytes = f.sizeBytes
+	}
+	if *f.pushBytes >= 0 {
+		req.PushBytes = f.pushBytes
+	}
+	return req
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ecoci/auth-api/internal/client"
+)
+
+// importSources are the content types of the files of each import source; .json files are
+// always sent as JSON
+var importSources = map[string]string{
+	"codecarbon":             "text/csv",
+	"cloud-carbon-footprint": "text/csv",
+	"green-metrics-tool":     "application/json",
+	"ecoci":                  "application/json",
+}
+
+// importSourceNames lists the import sources for the usage text
+func importSourceNames() string {
+	names := make([]string, 0, len(importSources))
+	for name := range importSources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// runImport uploads the file of another measurement tool, whose rows become runs
+func runImport(args []string) {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: ecoci import <source> [flags] <file>\n\nSources: %s\n\n", importSourceNames())
+		flags.PrintDefaults()
+	}
+	repo := flags.String("repo", "", "Full name of the repository of every run, such as octocat/hello-world (default from the file, or <user>/cloud for cloud estimates)")
+	apiURL := flags.String("api-url", envOrDefault("ECOCI_API_URL", client.DefaultBaseURL), "URL of the EcoCI API (default $ECOCI_API_URL)")
+	token := flags.String("token", os.Getenv("ECOCI_TOKEN"), "API token (default $ECOCI_TOKEN)")
+	if len(args) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	source := args[0]
+	contentType, ok := importSources[source]
+	if !ok {
+		log.Fatalf("unknown import source %q, expected one of %s", source, importSourceNames())
+	}
+	// Flags may follow the file too
+	flags.Parse(args[1:])
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	path := flags.Arg(0)
+	flags.Parse(flags.Args()[1:])
+	if flags.NArg() > 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *token == "" {
+		log.Fatal("an API token is required: set ECOCI_TOKEN or --token")
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		contentType = "application/json"
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	query := url.Values{}
+	if *repo != "" {
+		query.Set("repository", *repo)
+	}
+	result, err := client.New(*apiURL, *token).Import(context.Background(), source, query, contentType, file)
+	var apiErr *client.Error
+	if errors.As(err, &apiErr) {
+		// List the lines to fix
+		if lineErrors, ok := apiErr.Problem.Extensions["errors"].([]interface{}); ok {
+			for _, lineErr := range lineErrors {
+				if lineErr, ok := lineErr.(map[string]interface{}); ok {
+					fmt.Fprintf(os.Stderr, "%s:%v: %v\n", path, lineErr["line"], lineErr["message"])
+				}
+			}
+		}
+	}
+	if err != nil {
+		log.Fatalf("Failed to import %s: %v", path, err)
+	}
+	fmt.Printf("Imported %d runs into %s (%d already imported)\n", result.Imported, strings.Join(result.Repositories, ", "), result.Skipped)
+}
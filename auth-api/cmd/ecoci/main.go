@@ -0,0 +1,67 @@
+// Command ecoci submits the carbon footprint of CI runs to EcoCI. It works in any CI system:
+//
+//	ecoci submit --energy 0.145 --co2 0.087 --duration 120.5 --repo octocat/hello-world
+//
+// or measures the job itself with "ecoci collect start" as its first step and "ecoci collect
+// stop" as its last.
+//
+// In GitHub Actions the repository, commit, branch and workflow are read from the GITHUB_*
+// variables. The API token is read from ECOCI_TOKEN and the API URL from ECOCI_API_URL.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/ecoci/auth-api/internal/version"
+)
+
+const usage = `Usage: ecoci <command> [flags]
+
+Commands:
+  submit        Submit the energy and CO2 measurement of a CI run
+  collect       Measure the energy of a CI job and submit it
+  docker-stats  Estimate the energy of a build container and submit it
+  measure       Run a command and measure its time and energy
+  import        Import the measurements of other tools, such as codecarbon
+  report        Summarize the CO2 of a repository over a period
+  budget-check  Fail when a CO2 budget of a repository is exceeded
+  version       Print the version of ecoci
+
+Run "ecoci <command> -h" for the flags of a command.
+`
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("ecoci: ")
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "submit":
+		runSubmit(os.Args[2:])
+	case "collect":
+		runCollect(os.Args[2:])
+	case "docker-stats":
+		runDockerStats(os.Args[2:])
+	case "measure":
+		runMeasure(os.Args[2:])
+	case "import":
+		runImport(os.Args[2:])
+	case "report":
+		runReport(os.Args[2:])
+	case "budget-check":
+		runBudgetCheck(os.Args[2:])
+	case "version":
+		fmt.Println("ecoci", version.Get().Version)
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "ecoci: unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+}
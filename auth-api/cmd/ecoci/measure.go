@@ -0,0 +1,214 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ecoci/auth-api/internal/energy"
+)
+
+// methodCPUTime is the measurement method of commands estimated from their CPU time
+const methodCPUTime = "cpu_time"
+
+// raplSampler accumulates the RAPL counters while a command runs
+type raplSampler struct {
+	meter   *energy.RAPL
+	mu      sync.Mutex
+	session *energy.Session
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// startRAPL starts sampling the RAPL counters, or returns nil where they cannot be read
+func startRAPL() *raplSampler {
+	meter, err := energy.NewRAPL("/sys/class/powercap")
+	if err != nil {
+		return nil
+	}
+	reading, err := meter.Read()
+	if err != nil {
+		return nil
+	}
+	s := &raplSampler{meter: meter, session: energy.NewSession(energy.MethodRAPL, reading, 0), done: make(chan struct{})}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(samplerInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+				s.sample()
+			}
+		}
+	}()
+	return s
+}
+
+func (s *raplSampler) sample() {
+	reading, err := s.meter.Read()
+	if err != nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.session.Add(reading)
+}
+
+// stop takes the last reading and returns the energy in kWh
+func (s *raplSampler) stop() float64 {
+	close(s.done)
+	s.wg.Wait()
+	s.sample()
+	return s.session.EnergyKWh()
+}
+
+// commandUsage is what was measured of a finished command
+type commandUsage struct {
+	command  string
+	exitCode int
+	cpuTime  time.Duration
+	// raplKWh is the energy read from the RAPL counters, nil where they cannot be read
+	raplKWh *float64
+}
+
+// energy returns the energy of the command in kWh and the metadata of its run. Without RAPL
+// readings the energy is estimated from the CPU time with the hardware profile profileName.
+func (u commandUsage) energy(profileName string, profile energy.Profile) (float64, map[string]interface{}) {
+	measured := map[string]interface{}{
+		"command":     u.command,
+		"exit_code":   u.exitCode,
+		"cpu_seconds": u.cpuTime.Seconds(),
+	}
+	if u.raplKWh != nil {
+		measured["measurement_method"] = energy.MethodRAPL
+		return *u.raplKWh, measured
+	}
+	// As for containers, the CPU time runs at the maximum power of a vCPU
+	measured["measurement_method"] = methodCPUTime
+	measured["hardware_profile"] = profileName
+	return u.cpuTime.Seconds() * profile.MaxWattsPerCPU / 3.6e6, measured
+}
+
+// exitCode returns the exit code of a finished command. Commands killed by a signal exit with
+// 128 plus the signal number, as in shells.
+func exitCode(state *os.ProcessState) int {
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return state.ExitCode()
+}
+
+// runMeasure runs a command, measures it and prints a summary, optionally submitting it
+func runMeasure(args []string) {
+	flags := flag.NewFlagSet("measure", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: ecoci measure [flags] -- <command> [args...]")
+		flags.PrintDefaults()
+	}
+	upload := flags.Bool("upload", false, "Submit the measurement as a run")
+	profileName := flags.String("profile", energy.DefaultProfile, "Hardware profile to estimate energy with where RAPL is unavailable: "+profileNames())
+	gpu := addGPUFlags(flags)
+	carbon := addCarbonFlags(flags)
+	run := addRunFlags(flags)
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	profile, ok := energy.Profiles[*profileName]
+	if !ok {
+		log.Fatalf("unknown --profile %q, expected one of %s", *profileName, profileNames())
+	}
+
+	cmd := exec.Command(flags.Arg(0), flags.Args()[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	// Interrupts go to the command, whose exit ends the measurement
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	rapl := startRAPL()
+	gpus := startGPU()
+	started := time.Now()
+	if err := cmd.Start(); err != nil {
+		log.Fatalf("Failed to run %s: %v", flags.Arg(0), err)
+	}
+	go func() {
+		for sig := range signals {
+			cmd.Process.Signal(sig)
+		}
+	}()
+	err := cmd.Wait()
+	wall := time.Since(started)
+
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		log.Fatalf("Failed to run %s: %v", flags.Arg(0), err)
+	}
+	user, system := cmd.ProcessState.UserTime(), cmd.ProcessState.SystemTime()
+	usage := commandUsage{
+		command:  strings.Join(flags.Args(), " "),
+		exitCode: exitCode(cmd.ProcessState),
+		cpuTime:  user + system,
+	}
+	if rapl != nil {
+		kwh := rapl.stop()
+		usage.raplKWh = &kwh
+	}
+	energyKWh, measured := usage.energy(*profileName, profile)
+	// RAPL and CPU time leave out the GPUs, whose energy is added
+	var gpuUsage *gpuEnergy
+	if gpus != nil {
+		gpuUsage = gpus.stop()
+	} else {
+		gpuUsage = gpu.estimate(wall)
+	}
+	gpuSummary := "none"
+	if gpuUsage != nil {
+		energyKWh += gpuUsage.kwh
+		gpuSummary = gpuUsage.String()
+	}
+	co2 := carbon.co2(energyKWh, measured)
+
+	method := measured["measurement_method"].(string)
+	if method == methodCPUTime {
+		method += ", " + *profileName + " profile"
+	}
+	region, _ := measured["region"].(string)
+	if region == "" {
+		region = "unknown region"
+	}
+	fmt.Fprintf(os.Stderr, `
+ecoci measure: %s
+  Exit code:  %d
+  Wall time:  %s
+  CPU time:   %s (user %s, system %s)
+  Energy:     %.3g Wh (%s)
+  GPU energy: %s
+  CO2:        %.3g g (%s, %g g CO2e/kWh)
+`, usage.command, usage.exitCode, wall.Round(time.Millisecond), usage.cpuTime.Round(time.Millisecond),
+		user.Round(time.Millisecond), system.Round(time.Millisecond), energyKWh*1000, method, gpuSummary, co2*1000,
+		region, measured["carbon_intensity"])
+
+	if *upload {
+		req := run.request(energyKWh, co2, wall.Seconds(), measured)
+		if gpuUsage != nil {
+			gpuUsage.apply(&req)
+		}
+		run.submit(req)
+	}
+	os.Exit(usage.exitCode)
+}
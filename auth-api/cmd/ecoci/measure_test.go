@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ecoci/auth-api/internal/energy"
+)
+
+func TestCommandUsageEnergy(t *testing.T) {
+	profile := energy.Profiles["gcp"]
+
+	t.Run("RAPL readings", func(t *testing.T) {
+		kwh := 0.002
+		usage := commandUsage{command: "make test", exitCode: 1, cpuTime: 90 * time.Second, raplKWh: &kwh}
+
+		energyKWh, measured := usage.energy("gcp", profile)
+		assert.Equal(t, 0.002, energyKWh)
+		assert.Equal(t, map[string]interface{}{
+			"command":            "make test",
+			"exit_code":          1,
+			"cpu_seconds":        90.0,
+			"measurement_method": energy.MethodRAPL,
+		}, measured)
+	})
+
+	t.Run("CPU time without RAPL", func(t *testing.T) {
+		usage := commandUsage{command: "make test", cpuTime: 90 * time.Second}
+
+		energyKWh, measured := usage.energy("gcp", profile)
+		assert.InDelta(t, 90*4.26/3.6e6, energyKWh, 1e-12)
+		assert.Equal(t, map[string]interface{}{
+			"command":            "make test",
+			"exit_code":          0,
+			"cpu_seconds":        90.0,
+			"measurement_method": methodCPUTime,
+			"hardware_profile":   "gcp",
+		}, measured)
+	})
+}
+
+func TestExitCode(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	run := func(script string) int {
+		cmd := exec.Command("sh", "-c", script)
+		err := cmd.Run()
+		var exitErr *exec.ExitError
+		require.ErrorAs(t, err, &exitErr)
+		return exitCode(cmd.ProcessState)
+	}
+
+	assert.Equal(t, 3, run("exit 3"))
+	// SIGTERM is signal 15
+	assert.Equal(t, 143, run("kill -TERM $$"))
+}
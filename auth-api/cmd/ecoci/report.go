@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ecoci/auth-api/internal/client"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// sparkBars are the bars of a sparkline, from lowest to highest
+var sparkBars = []rune("▁▂▃▄▅▆▇█")
+
+// report is the summary of a repository over a period
+type report struct {
+	repo      string
+	period    string
+	interval  string
+	stats     *client.RepositoryStats
+	series    []float64
+	workflows []service.WorkflowStats
+}
+
+// parsePeriod parses a period such as 30d, 4w or 12h
+func parsePeriod(period string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if count, ok := strings.CutSuffix(period, suffix); ok {
+			n, err := strconv.Atoi(count)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid period %q", period)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+	duration, err := time.ParseDuration(period)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("invalid period %q, expected a number of days or weeks such as 30d or 4w", period)
+	}
+	return duration, nil
+}
+
+// sparkInterval returns the time series interval of a period, keeping the sparkline short
+func sparkInterval(period time.Duration) string {
+	switch {
+	case period <= 90*24*time.Hour:
+		return "day"
+	case period <= 2*365*24*time.Hour:
+		return "week"
+	default:
+		return "month"
+	}
+}
+
+// fillSeries returns the sums of the buckets of interval between from and to, with zeros for
+// the buckets without runs
+func fillSeries(points []service.TimeSeriesPoint, interval string, from, to time.Time) []float64 {
+	sums := map[time.Time]float64{}
+	for _, point := range points {
+		sums[point.BucketStart.UTC()] = point.Sum
+	}
+	var series []float64
+	for bucket := service.TruncateToInterval(from, interval); !bucket.After(to); {
+		series = append(series, sums[bucket])
+		switch interval {
+		case "week":
+			bucket = bucket.AddDate(0, 0, 7)
+		case "month":
+			bucket = bucket.AddDate(0, 1, 0)
+		default:
+			bucket = bucket.AddDate(0, 0, 1)
+		}
+	}
+	return series
+}
+
+// sparkline renders values as bars scaled to their maximum
+func sparkline(values []float64) string {
+	var maximum float64
+	for _, value := range values {
+		maximum = max(maximum, value)
+	}
+	var line strings.Builder
+	for _, value := range values {
+		bar := 0
+		if maximum > 0 {
+			bar = int(value / maximum * float64(len(sparkBars)-1))
+		}
+		line.WriteRune(sparkBars[bar])
+	}
+	return line.String()
+}
+
+// formatCO2 formats a mass of CO2 in g, kg or t
+func formatCO2(kg float64) string {
+	switch {
+	case kg >= 1000:
+		return fmt.Sprintf("%.2f t", kg/1000)
+	case kg >= 1:
+		return fmt.Sprintf("%.2f kg", kg)
+	default:
+		return fmt.Sprintf("%.1f g", kg*1000)
+	}
+}
+
+// formatEnergy formats energy in Wh or kWh
+func formatEnergy(kWh float64) string {
+	if kWh >= 1 {
+		return fmt.Sprintf("%.2f kWh", kWh)
+	}
+	return fmt.Sprintf("%.1f Wh", kWh*1000)
+}
+
+// formatDuration formats seconds as a duration rounded to the second
+func formatDuration(seconds float64) string {
+	return (time.Duration(seconds * float64(time.Second))).Round(time.Second).String()
+}
+
+// change formats the change of a metric from the previous period
+func (r *report) change(metric string) string {
+	if r.stats.Comparison == nil {
+		return ""
+	}
+	change, ok := r.stats.Comparison.Changes[metric]
+	if !ok || change.Percent == nil {
+		return "n/a"
+	}
+	return fmt.Sprintf("%+.1f%%", *change.Percent)
+}
+
+// metrics are the rows of the summary: name, total and change
+func (r *report) metrics() [][3]string {
+	summary := r.stats.Summary
+	rows := [][3]string{
+		{"CO2", formatCO2(summary.TotalCO2Kg), r.change("co2_kg")},
+		{"Energy", formatEnergy(summary.TotalEnergyKWh), r.change("energy_kwh")},
+		{"Runs", strconv.FormatInt(summary.RunCount, 10), r.change("run_count")},
+		{"Build time", formatDuration(summary.TotalDurationS), r.change("duration_s")},
+	}
+	if summary.Percentiles != nil && summary.RunCount > 0 {
+		rows = append(rows, [3]string{"CO2 per run", fmt.Sprintf("p50 %s, p90 %s", formatCO2(summary.Percentiles.CO2Kg.P50), formatCO2(summary.Percentiles.CO2Kg.P90)), ""})
+	}
+	return rows
+}
+
+// workflowRows are the rows of the workflow table
+func (r *report) workflowRows() [][]string {
+	rows := make([][]string, 0, len(r.workflows))
+	for _, workflow := range r.workflows {
+		name := "(none)"
+		if workflow.WorkflowName != nil {
+			name = *workflow.WorkflowName
+		}
+		rows = append(rows, []string{
+			name,
+			strconv.FormatInt(workflow.RunCount, 10),
+			formatCO2(workflow.TotalCO2Kg),
+			formatCO2(workflow.AvgCO2Kg),
+			formatCO2(workflow.Percentiles.CO2Kg.P90),
+			formatDuration(workflow.AvgDurationS),
+		})
+	}
+	return rows
+}
+
+var workflowHeader = []string{"Workflow", "Runs", "CO2", "Avg CO2", "p90 CO2", "Avg duration"}
+
+// renderText writes the report for a terminal
+func (r *report) renderText(w io.Writer) {
+	summary := r.stats.Summary
+	fmt.Fprintf(w, "%s, last %s (%s to %s)\n\n", r.repo, r.period, summary.From.Format(time.DateOnly), summary.To.Format(time.DateOnly))
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, row := range r.metrics() {
+		fmt.Fprintf(table, "  %s\t%s\t%s\n", row[0], row[1], row[2])
+	}
+	table.Flush()
+	fmt.Fprintf(w, "\n  CO2 per %s  %s\n", r.interval, sparkline(r.series))
+
+	if len(r.workflows) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintf(table, "  %s\n", strings.ToUpper(strings.Join(workflowHeader, "\t")))
+		for _, row := range r.workflowRows() {
+			fmt.Fprintf(table, "  %s\n", strings.Join(row, "\t"))
+		}
+		table.Flush()
+	}
+}
+
+// renderMarkdown writes the report as markdown for issues and pull requests
+func (r *report) renderMarkdown(w io.Writer) {
+	summary := r.stats.Summary
+	fmt.Fprintf(w, "### EcoCI report: %s\n\n", r.repo)
+	fmt.Fprintf(w, "Last %s, %s to %s, compared with the %s before.\n\n", r.period, summary.From.Format(time.DateOnly), summary.To.Format(time.DateOnly), r.period)
+	fmt.Fprintln(w, "| Metric | Total | Change |")
+	fmt.Fprintln(w, "| --- | ---: | ---: |")
+	for _, row := range r.metrics() {
+		fmt.Fprintf(w, "| %s | %s | %s |\n", row[0], row[1], row[2])
+	}
+	fmt.Fprintf(w, "\nCO2 per %s: `%s`\n", r.interval, sparkline(r.series))
+
+	if len(r.workflows) > 0 {
+		fmt.Fprintf(w, "\n| %s |\n", strings.Join(workflowHeader, " | "))
+		fmt.Fprintln(w, "| --- | ---: | ---: | ---: | ---: | ---: |")
+		for _, row := range r.workflowRows() {
+			// Pipes in workflow names would end the cell
+			row[0] = strings.ReplaceAll(row[0], "|", `\|`)
+			fmt.Fprintf(w, "| %s |\n", strings.Join(row, " | "))
+		}
+	}
+}
+
+// runReport prints the CO2, energy and workflows of a repository over a period
+func runReport(args []string) {
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: ecoci report [flags]")
+		flags.PrintDefaults()
+	}
+	repo := flags.String("repo", os.Getenv("GITHUB_REPOSITORY"), "Full name of the repository, such as octocat/hello-world (default $GITHUB_REPOSITORY)")
+	periodFlag := flags.String("period", "30d", "Period to report, in days or weeks such as 30d or 4w")
+	markdown := flags.Bool("markdown", false, "Print markdown for pasting into issues and pull requests")
+	apiURL := flags.String("api-url", envOrDefault("ECOCI_API_URL", client.DefaultBaseURL), "URL of the EcoCI API (default $ECOCI_API_URL)")
+	token := flags.String("token", os.Getenv("ECOCI_TOKEN"), "API token (default $ECOCI_TOKEN)")
+	flags.Parse(args)
+	if flags.NArg() > 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *repo == "" {
+		log.Fatal("--repo is required outside GitHub Actions")
+	}
+	if *token == "" {
+		log.Fatal("an API token is required: set ECOCI_TOKEN or --token")
+	}
+	period, err := parsePeriod(*periodFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx := context.Background()
+	api := client.New(*apiURL, *token)
+	repository, err := api.Repository(ctx, *repo)
+	if err != nil {
+		log.Fatal(err)
+	}
+	to := time.Now()
+	from := to.Add(-period)
+
+	r := &report{repo: *repo, period: *periodFlag, interval: sparkInterval(period)}
+	if r.stats, err = api.RepositoryStats(ctx, repository.ID, from, to); err != nil {
+		log.Fatalf("Failed to fetch statistics: %v", err)
+	}
+	points, err := api.TimeSeries(ctx, repository.ID, "co2_kg", r.interval, from, to)
+	if err != nil {
+		log.Fatalf("Failed to fetch time series: %v", err)
+	}
+	r.series = fillSeries(points, r.interval, from, to)
+	if r.workflows, err = api.WorkflowStats(ctx, repository.ID, from, to); err != nil {
+		log.Fatalf("Failed to fetch workflow statistics: %v", err)
+	}
+
+	if *markdown {
+		r.renderMarkdown(os.Stdout)
+	} else {
+		r.renderText(os.Stdout)
+	}
+}
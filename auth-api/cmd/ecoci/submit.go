@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/ci"
+	"github.com/ecoci/auth-api/internal/client"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// metadataFlag collects repeated key=value flags. Values that parse as numbers or booleans are
+// submitted as such.
+type metadataFlag map[string]interface{}
+
+func (m metadataFlag) String() string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+func (m metadataFlag) Set(value string) error {
+	key, raw, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("expected key=value")
+	}
+	if number, err := strconv.ParseFloat(raw, 64); err == nil {
+		m[key] = number
+	} else if boolean, err := strconv.ParseBool(raw); err == nil {
+		m[key] = boolean
+	} else {
+		m[key] = raw
+	}
+	return nil
+}
+
+// envOrDefault returns the environment variable key, or defaultValue when it is unset
+func envOrDefault(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// runFlags are the flags describing the CI run that measurements are submitted for
+type runFlags struct {
+	repo     *string
+	repoURL  *string
+	private  *bool
+	commit   *string
+	branch   *string
+	tag      *string
+	env      *string
+	workflow *string
+	group    *string
+	network  *int64
+	junit    *string
+	image    *imageBuildFlags
+	metadata metadataFlag
+	apiURL   *string
+	token    *string
+	spool    *string
+	dryRun   *bool
+}
+
+// addRunFlags registers the run flags on flags
+func addRunFlags(flags *flag.FlagSet) *runFlags {
+	f := &runFlags{metadata: metadataFlag{}}
+	f.repo = flags.String("repo", "", "Full name of the repository, such as octocat/hello-world (default $GITHUB_REPOSITORY)")
+	f.repoURL = flags.String("repo-url", "", "URL of the repository (default https://github.com/<repo>)")
+	f.private = flags.Bool("private", false, "Whether the repository is private")
+	f.commit = flags.String("commit", "", "Commit SHA of the run (default $GITHUB_SHA)")
+	f.branch = flags.String("branch", "", "Branch of the run (default from $GITHUB_HEAD_REF or $GITHUB_REF)")
+	f.tag = flags.String("tag", "", "Git tag or release the run belongs to (default from $GITHUB_REF on tag pushes)")
+	f.env = flags.String("environment", os.Getenv("ECOCI_ENVIRONMENT"), "Environment of the run: ci, staging or production-deploy (default $ECOCI_ENVIRONMENT, else ci)")
+	f.workflow = flags.String("workflow", "", "Workflow name of the run (default $GITHUB_WORKFLOW)")
+	f.group = flags.String("workflow-run-group", "", "Execution of the workflow the run belongs to, shared by the jobs of a matrix build (default from $GITHUB_RUN_ID and $GITHUB_RUN_ATTEMPT)")
+	f.network = flags.Int64("network-bytes", -1, "Data the run transferred in bytes, such as artifact uploads and image pulls (default not reported)")
+	f.image = addImageBuildFlags(flags)
+	f.junit = flags.String("junit", "", "JUnit XML report of the run, whose test suites its energy and CO2 are apportioned across")
+	flags.Var(f.metadata, "metadata", "Additional run metadata as key=value; repeatable")
+	f.apiURL = flags.String("api-url", envOrDefault("ECOCI_API_URL", client.DefaultBaseURL), "URL of the EcoCI API (default $ECOCI_API_URL)")
+	f.token = flags.String("token", os.Getenv("ECOCI_TOKEN"), "API token (default $ECOCI_TOKEN)")
+	f.spool = flags.String("spool", envOrDefault("ECOCI_SPOOL", client.DefaultSpoolPath()), "File queueing runs while the API is unreachable, submitted by the next invocation; empty to disable (default $ECOCI_SPOOL)")
+	f.dryRun = flags.Bool("dry-run", false, "Print the run instead of submitting it")
+	return f
+}
+
+// request builds the run of a measurement, completing the flags from the environment of the
+// CI system. measured is the metadata of the measurement itself; --metadata overrides it.
+func (f *runFlags) request(energy, co2, duration float64, measured map[string]interface{}) service.RunCreateRequest {
+	req := service.RunCreateRequest{
+		EnergyKWh: energy,
+		CO2Kg:     co2,
+		DurationS: duration,
+		Metadata:  map[string]interface{}{},
+	}
+
+	// Flags take precedence over the environment of the CI system
+	fullName, htmlURL, sha, branchName, tag, workflowName, group := *f.repo, *f.repoURL, *f.commit, *f.branch, *f.tag, *f.workflow, *f.group
+	if env := ci.Detect(os.Getenv); env != nil {
+		if fullName == "" {
+			fullName = env.Repository
+		}
+		if htmlURL == "" && fullName == env.Repository {
+			htmlURL = env.RepositoryURL
+		}
+		if sha == "" {
+			sha = env.CommitSHA
+		}
+		if branchName == "" {
+			branchName = env.Branch
+		}
+		if tag == "" {
+			tag = env.Tag
+		}
+		if workflowName == "" {
+			workflowName = env.Workflow
+		}
+		if group == "" {
+			group = env.WorkflowRunGroup
+		}
+		for key, value := range env.Metadata {
+			req.Metadata[key] = value
+		}
+	}
+	for key, value := range measured {
+		req.Metadata[key] = value
+	}
+	for key, value := range f.metadata {
+		req.Metadata[key] = value
+	}
+
+	owner, name, ok := strings.Cut(fullName, "/")
+	if fullName == "" {
+		log.Fatal("--repo is required outside of GitHub Actions")
+	}
+	if !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+		log.Fatalf("--repo must be owner/name, got %q", fullName)
+	}
+	if htmlURL == "" {
+		htmlURL = "https://github.com/" + fullName
+	}
+	req.Repository = service.RepositoryCreateRequest{
+		Name:     name,
+		FullName: fullName,
+		HTMLURL:  htmlURL,
+		Private:  *f.private,
+	}
+	if sha != "" {
+		req.GitCommitSHA = &sha
+	}
+	if branchName != "" {
+		req.BranchName = &branchName
+	}
+	if tag != "" {
+		req.GitTag = &tag
+	}
+	req.Environment = *f.env
+	if workflowName != "" {
+		req.WorkflowName = &workflowName
+	}
+	if group != "" {
+		req.WorkflowRunGroup = &group
+	}
+	if *f.network >= 0 {
+		req.NetworkBytes = f.network
+	}
+	req.ImageBuild = f.image.request()
+	if len(req.Metadata) == 0 {
+		req.Metadata = nil
+	}
+	return req
+}
+
+// submit submits the run, or prints it with --dry-run
+func (f *runFlags) submit(req service.RunCreateRequest) {
+	if *f.dryRun {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(req); err != nil {
+			log.Fatalf("Failed to encode run: %v", err)
+		}
+		return
+	}
+
+	if *f.token == "" {
+		log.Fatal("an API token is required in ECOCI_TOKEN or --token")
+	}
+	ctx := context.Background()
+	api := client.New(*f.apiURL, *f.token)
+	spool := client.NewSpool(api, *f.spool)
+	flushed, err := spool.Flush(ctx)
+	if err != nil {
+		log.Printf("Failed to submit queued runs: %v", err)
+	} else {
+		for _, rejected := range flushed.Rejected {
+			log.Printf("Dropped queued %v", rejected)
+		}
+		if flushed.Submitted > 0 {
+			fmt.Printf("Submitted %d queued runs, %d still queued\n", flushed.Submitted, flushed.Pending)
+		} else if flushed.Pending > 0 {
+			fmt.Printf("%d queued runs waiting for retry\n", flushed.Pending)
+		}
+	}
+
+	run, err := spool.CreateRun(ctx, &req)
+	if errors.Is(err, client.ErrSpooled) {
+		// An unreachable API does not fail the pipeline
+		log.Printf("Queued run for %s in %s, the next invocation submits it: %v", req.Repository.FullName, *f.spool, err)
+		if *f.junit != "" {
+			log.Printf("Skipped test report %s of the queued run", *f.junit)
+		}
+		return
+	}
+	if err != nil {
+		log.Fatalf("Failed to submit run: %v", err)
+	}
+	fmt.Printf("Submitted run %s for %s: %g kWh, %g kg CO2\n", run.ID, req.Repository.FullName, run.EnergyKWh, run.CO2Kg)
+	if *f.junit != "" {
+		f.uploadTestReport(ctx, api, run.ID)
+	}
+}
+
+// uploadTestReport attaches the --junit report to a submitted run. The run is kept when the
+// report cannot be uploaded, so failures are only logged.
+func (f *runFlags) uploadTestReport(ctx context.Context, api *client.Client, runID uuid.UUID) {
+	report, err := os.Open(*f.junit)
+	if err != nil {
+		log.Printf("Failed to read test report: %v", err)
+		return
+	}
+	defer report.Close()
+
+	suites, err := api.UploadTestReport(ctx, runID, report)
+	if err != nil {
+		log.Printf("Failed to upload test report: %v", err)
+		return
+	}
+	if len(suites) > 0 {
+		fmt.Printf("Uploaded %d test suites, the most CO2 from %s: %g kg\n", len(suites), suites[0].Name, suites[0].CO2Kg)
+	}
+}
+
+// runSubmit submits the measurement of a CI run, completing the flags from the environment of
+// the CI system
+func runSubmit(args []string) {
+	flags := flag.NewFlagSet("submit", flag.ExitOnError)
+	energy := flags.Float64("energy", 0, "Energy consumed by the run in kWh (required)")
+	co2 := flags.Float64("co2", 0, "CO2 emitted by the run in kg (required)")
+	duration := flags.Float64("duration", 0, "Duration of the run in seconds (required)")
+	run := addRunFlags(flags)
+	flags.Parse(args)
+
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for _, name := range []string{"energy", "co2", "duration"} {
+		if !set[name] {
+			log.Fatalf("submit requires --%s", name)
+		}
+	}
+	if *energy < 0 || *co2 < 0 || *duration < 0 {
+		log.Fatal("--energy, --co2 and --duration must be non-negative")
+	}
+
+	run.submit(run.request(*energy, *co2, *duration, nil))
+}
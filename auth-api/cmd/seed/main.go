@@ -0,0 +1,75 @@
+// Command seed fills a development database with demo users, repositories and a history of
+// CI runs, so the frontend and demos have data without real pipelines.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ecoci/auth-api/internal/auth"
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/seed"
+)
+
+func main() {
+	defaults := seed.DefaultOptions()
+	databaseURL := flag.String("database", os.Getenv("DATABASE_URL"), "PostgreSQL connection string (default $DATABASE_URL)")
+	users := flag.Int("users", defaults.Users, "Number of demo users")
+	repos := flag.Int("repos", defaults.ReposPerUser, "Number of repositories per user")
+	runsPerDay := flag.Float64("runs-per-day", defaults.RunsPerDay, "Average number of runs per repository on a weekday")
+	days := flag.Int("days", defaults.Days, "Days of run history")
+	randomSeed := flag.Int64("seed", defaults.Seed, "Random seed; the same seed generates the same data")
+	reset := flag.Bool("reset", false, "Remove previously seeded data first")
+	flag.Parse()
+
+	if *databaseURL == "" {
+		log.Fatal("DATABASE_URL or -database is required")
+	}
+
+	if err := db.Migrate(*databaseURL); err != nil {
+		log.Fatalf("Failed to run database migrations: %v", err)
+	}
+	database, err := db.Connect(*databaseURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	ctx := context.Background()
+	if *reset {
+		if err := seed.Reset(ctx, database); err != nil {
+			log.Fatalf("Failed to remove seed data: %v", err)
+		}
+		log.Println("Removed previously seeded data")
+	}
+
+	started := time.Now()
+	summary, err := seed.Seed(ctx, database, seed.Options{
+		Users:        *users,
+		ReposPerUser: *repos,
+		RunsPerDay:   *runsPerDay,
+		Days:         *days,
+		Seed:         *randomSeed,
+	}, time.Now().UTC())
+	if errors.Is(err, seed.ErrAlreadySeeded) {
+		log.Fatal("The database already holds seed data; run with -reset to replace it")
+	}
+	if err != nil {
+		log.Fatalf("Failed to seed database: %v", err)
+	}
+	log.Printf("Seeded %d users, %d repositories and %d runs in %s",
+		len(summary.Users), summary.Repositories, summary.Runs, time.Since(started).Round(time.Millisecond))
+
+	// Demo users cannot sign in with GitHub, so print a session token for the first one
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		user := summary.Users[0]
+		token, err := auth.NewJWTManager(secret, 24*time.Hour).GenerateToken(user.ID, user.GitHubUsername)
+		if err != nil {
+			log.Fatalf("Failed to generate token: %v", err)
+		}
+		log.Printf("Sign in as %s with the cookie ecoci_token=%s (valid for 24h)", user.GitHubUsername, token)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+
+	"github.com/ecoci/auth-api/internal/bigquery"
+)
+
+// runBigQueryBackfill creates the BigQuery tables and exports the runs and rollups of a
+// period, such as the history from before the export was configured
+func runBigQueryBackfill(args []string) {
+	flags := flag.NewFlagSet("bigquery-backfill", flag.ExitOnError)
+	configFile := flags.String("config", "", "YAML or TOML configuration file; environment variables take precedence (default $CONFIG_FILE)")
+	from := flags.String("from", "", "First day to export, as YYYY-MM-DD (default: the first run)")
+	to := flags.String("to", "", "Day to stop before, as YYYY-MM-DD (default: today)")
+	flags.Parse(args)
+
+	cfg, database := openDatabase(*configFile)
+	if cfg.BigQueryProject == "" {
+		log.Fatal("bigquery-backfill requires BIGQUERY_PROJECT and BIGQUERY_DATASET")
+	}
+
+	// Today's rollups are incomplete; the nightly export writes them once the day is over
+	start := time.Time{}
+	end := time.Now().UTC().Truncate(24 * time.Hour)
+	var err error
+	if *from != "" {
+		if start, err = time.Parse("2006-01-02", *from); err != nil {
+			log.Fatalf("Invalid -from: %v", err)
+		}
+	}
+	if *to != "" {
+		if end, err = time.Parse("2006-01-02", *to); err != nil {
+			log.Fatalf("Invalid -to: %v", err)
+		}
+	}
+	if !start.Before(end) {
+		log.Fatal("-from must be before -to")
+	}
+
+	client, err := bigquery.NewClient(cfg.BigQueryAPIURL, cfg.BigQueryProject, cfg.BigQueryDataset, cfg.BigQueryCredentialsFile)
+	if err != nil {
+		log.Fatalf("Failed to configure BigQuery: %v", err)
+	}
+	exporter := bigquery.NewExporter(database, client)
+
+	ctx := context.Background()
+	changed, err := exporter.EnsureTables(ctx)
+	if err != nil {
+		log.Fatalf("Failed to prepare BigQuery tables: %v", err)
+	}
+	for _, table := range changed {
+		log.Printf("Created or updated %s.%s", cfg.BigQueryDataset, table)
+	}
+
+	runs, rollups, err := exporter.Backfill(ctx, start, end)
+	if err != nil {
+		log.Fatalf("Failed to backfill BigQuery after %d runs: %v", runs, err)
+	}
+	log.Printf("Exported %d runs and %d rollups to %s.%s", runs, rollups, cfg.BigQueryProject, cfg.BigQueryDataset)
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
 	"os"
+	"time"
 
 	"github.com/ecoci/auth-api/internal/api"
 	"github.com/ecoci/auth-api/internal/config"
 	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/tracing"
 )
 
 // @title EcoCI Auth API
@@ -22,7 +26,7 @@ import (
 // @license.url https://opensource.org/licenses/MIT
 
 // @host localhost:8080
-// @BasePath /
+// @BasePath /api/v1
 // @schemes http https
 
 // @securityDefinitions.apikey CookieAuth
@@ -30,18 +34,71 @@ import (
 // @name ecoci_token
 // @description JWT token stored in HttpOnly cookie
 
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description The same JWT as an API token, sent as "Bearer <token>" by CI integrations
+
 func main() {
+	// Administrative subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "backup":
+			runBackup(os.Args[2:])
+			return
+		case "restore":
+			runRestore(os.Args[2:])
+			return
+		case "bigquery-backfill":
+			runBigQueryBackfill(os.Args[2:])
+			return
+		}
+	}
+
+	configFile := flag.String("config", "", "YAML or TOML configuration file; environment variables take precedence (default $CONFIG_FILE)")
+	printConfig := flag.Bool("print-config", false, "Print the effective configuration with secrets redacted and exit")
+	flag.Parse()
+
 	// Load configuration
-	cfg, err := config.Load()
+	cfg, err := config.Load(*configFile)
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	if *printConfig {
+		if err := cfg.WriteYAML(os.Stdout); err != nil {
+			log.Fatalf("Failed to print configuration: %v", err)
+		}
+		return
+	}
+
+	// Resolve secret references from the secrets backend
+	secretStore, err := loadSecrets(context.Background(), cfg)
+	if err != nil {
+		log.Fatalf("Failed to load secrets: %v", err)
+	}
+
+	// Initialize tracing
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg)
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Printf("Warning: failed to flush traces: %v", err)
+		}
+	}()
+
 	// Initialize database connection
-	database, err := db.Connect(cfg.DatabaseURL)
+	database, credentials, err := connectDatabase(cfg)
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
+	if err := database.Use(tracing.GORMPlugin()); err != nil {
+		log.Fatalf("Failed to trace database queries: %v", err)
+	}
 
 	// Run database migrations
 	if err := db.Migrate(cfg.DatabaseURL); err != nil {
@@ -54,14 +111,15 @@ func main() {
 		log.Fatalf("Failed to create API server: %v", err)
 	}
 
-	// Start server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	if secretStore != nil {
+		if err := watchSecrets(context.Background(), secretStore, cfg, server, credentials); err != nil {
+			log.Fatalf("Failed to watch secrets: %v", err)
+		}
 	}
 
-	log.Printf("Starting EcoCI Auth API server on port %s", port)
-	if err := server.Start(":" + port); err != nil {
+	// Start server
+	log.Printf("Starting EcoCI Auth API server on port %s", cfg.Port)
+	if err := server.Start(":" + cfg.Port); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
\ No newline at end of file
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+
+	"github.com/ecoci/auth-api/internal/api"
+	"github.com/ecoci/auth-api/internal/config"
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/secrets"
+	"gorm.io/gorm"
+)
+
+// loadSecrets resolves the secret references of cfg from the secrets backend into the JWT
+// secret, the OAuth client secret and the credentials of the database URL. It returns nil
+// when no secrets backend is configured.
+func loadSecrets(ctx context.Context, cfg *config.Config) (*secrets.Store, error) {
+	if cfg.SecretsBackend == "" {
+		return nil, nil
+	}
+
+	provider, err := secrets.NewProvider(ctx, cfg.SecretsBackend)
+	if err != nil {
+		return nil, err
+	}
+	store := secrets.NewStore(provider)
+
+	if cfg.JWTSecretRef != "" {
+		if cfg.JWTSecret, err = store.Get(ctx, cfg.JWTSecretRef); err != nil {
+			return nil, fmt.Errorf("JWT_SECRET_REF: %w", err)
+		}
+	}
+	if cfg.GitHubClientSecretRef != "" {
+		if cfg.GitHubClientSecret, err = store.Get(ctx, cfg.GitHubClientSecretRef); err != nil {
+			return nil, fmt.Errorf("GITHUB_CLIENT_SECRET_REF: %w", err)
+		}
+	}
+	if cfg.DatabaseCredentialsRef != "" {
+		username, password, err := databaseCredentials(ctx, store, cfg.DatabaseCredentialsRef)
+		if err != nil {
+			return nil, fmt.Errorf("DATABASE_CREDENTIALS_REF: %w", err)
+		}
+		if cfg.DatabaseURL, err = db.WithCredentials(cfg.DatabaseURL, username, password); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Printf("Loaded secrets from %s", cfg.SecretsBackend)
+	return store, nil
+}
+
+// databaseCredentials reads the username and password of the secret at path
+func databaseCredentials(ctx context.Context, store *secrets.Store, path string) (string, string, error) {
+	username, err := store.Get(ctx, path+"#username")
+	if err != nil {
+		return "", "", err
+	}
+	password, err := store.Get(ctx, path+"#password")
+	if err != nil {
+		return "", "", err
+	}
+	return username, password, nil
+}
+
+// connectDatabase connects to the database. With credentials from the secrets backend, new
+// connections log in with the current credentials so rotated passwords take effect.
+func connectDatabase(cfg *config.Config) (*gorm.DB, *db.Credentials, error) {
+	if cfg.DatabaseCredentialsRef == "" {
+		database, err := db.Connect(cfg.DatabaseURL)
+		return database, nil, err
+	}
+
+	parsed, err := url.Parse(cfg.DatabaseURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid database URL: %w", err)
+	}
+	password, _ := parsed.User.Password()
+	credentials := db.NewCredentials(parsed.User.Username(), password)
+	database, err := db.ConnectWithCredentials(cfg.DatabaseURL, credentials)
+	return database, credentials, err
+}
+
+// watchSecrets applies rotated secrets to the server and the database connections, and
+// re-reads the secrets every SECRETS_REFRESH_INTERVAL
+func watchSecrets(ctx context.Context, store *secrets.Store, cfg *config.Config, server *api.Server, credentials *db.Credentials) error {
+	if cfg.JWTSecretRef != "" {
+		if err := store.WatchKey(cfg.JWTSecretRef, server.RotateJWTSecret); err != nil {
+			return err
+		}
+	}
+	if cfg.GitHubClientSecretRef != "" {
+		if err := store.WatchKey(cfg.GitHubClientSecretRef, server.RotateOAuthClientSecret); err != nil {
+			return err
+		}
+	}
+	if cfg.DatabaseCredentialsRef != "" {
+		store.Watch(cfg.DatabaseCredentialsRef, func(values map[string]string) {
+			if values["username"] == "" || values["password"] == "" {
+				log.Printf("Warning: ignoring rotated database credentials without username and password")
+				return
+			}
+			credentials.Set(values["username"], values["password"])
+		})
+	}
+
+	go store.Run(ctx, cfg.SecretsRefreshInterval)
+	return nil
+}
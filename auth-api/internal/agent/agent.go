@@ -0,0 +1,315 @@
+// Package agent measures the CI jobs of self-hosted runners on Kubernetes. Running on every
+// node, it splits the energy of the node between the runner pods by their share of the node's
+// CPU time and submits a run for every runner pod when it completes, so each job of an
+// ephemeral runner becomes one run.
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ecoci/auth-api/internal/client"
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/energy"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// DefaultSelector selects the ephemeral runner pods of the Actions Runner Controller
+const DefaultSelector = "actions-ephemeral-runner=True"
+
+// Pod annotations describing the run of a runner pod. Set them in the pod template of the
+// runner scale set; the repository falls back to Config.Repository.
+const (
+	AnnotationRepository = "ecoci.dev/repository"
+	AnnotationCommit     = "ecoci.dev/commit"
+	AnnotationBranch     = "ecoci.dev/branch"
+	AnnotationWorkflow   = "ecoci.dev/workflow"
+)
+
+// Submitter submits runs; *client.Client and *client.Spool implement it
+type Submitter interface {
+	CreateRun(ctx context.Context, req *service.RunCreateRequest) (*db.Run, error)
+}
+
+// Flusher is implemented by submitters that queue runs while the API is unreachable, such as
+// *client.Spool. The agent flushes them every interval.
+type Flusher interface {
+	Flush(ctx context.Context) (*client.FlushResult, error)
+}
+
+// Config configures an agent
+type Config struct {
+	// Node is the name of the node the agent runs on
+	Node string
+	// Selector is the label selector of the runner pods
+	Selector string
+	// CgroupRoot is the cgroup filesystem of the host, such as /host/sys/fs/cgroup
+	CgroupRoot string
+	// ProcRoot is the proc filesystem of the host, such as /host/proc
+	ProcRoot string
+	// Region is the cloud region of the node, reported with runs
+	Region string
+	// CarbonIntensity of the grid in g CO2e/kWh
+	CarbonIntensity float64
+	// Repository is the full name of the repository of pods without AnnotationRepository
+	Repository string
+}
+
+// podRun is the measurement of a runner pod
+type podRun struct {
+	pod     Pod
+	cgroup  string
+	started time.Time
+	lastCPU time.Duration
+	cpuTime time.Duration
+	joules  float64
+}
+
+// Agent attributes the energy of a node to its runner pods
+type Agent struct {
+	cfg   Config
+	kube  *Kube
+	power PowerSource
+	runs  Submitter
+
+	sampled    bool
+	lastJoules float64
+	lastCPU    time.Duration
+	pods       map[string]*podRun
+}
+
+// New returns an agent reading the pods from kube and the node energy from power
+func New(cfg Config, kube *Kube, power PowerSource, runs Submitter) *Agent {
+	return &Agent{cfg: cfg, kube: kube, power: power, runs: runs, pods: map[string]*podRun{}}
+}
+
+// Run samples the node every interval until ctx is cancelled
+func (a *Agent) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := a.Sample(ctx, time.Now().UTC()); err != nil {
+			log.Printf("Failed to sample node %s: %v", a.cfg.Node, err)
+		}
+		if flusher, ok := a.runs.(Flusher); ok {
+			a.flush(ctx, flusher)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sample attributes the node energy since the previous sample to the running runner pods by
+// their share of the busy CPU time of the node, and submits the runs of the pods that
+// completed. The energy of the last interval of a pod is lost with its cgroup, so the interval
+// should be short compared to the jobs.
+func (a *Agent) Sample(ctx context.Context, now time.Time) error {
+	joules, err := a.power.Joules(ctx)
+	if err != nil {
+		return err
+	}
+	nodeCPU, err := NodeCPUTime(a.cfg.ProcRoot)
+	if err != nil {
+		return fmt.Errorf("failed to read node CPU time: %w", err)
+	}
+	pods, err := a.kube.ListPods(ctx, a.cfg.Node, a.cfg.Selector)
+	if err != nil {
+		return err
+	}
+
+	// A counter that went backwards was reset; the interval is not attributed
+	energyDelta := joules - a.lastJoules
+	cpuDelta := nodeCPU - a.lastCPU
+	attribute := a.sampled && energyDelta > 0 && cpuDelta > 0
+	a.sampled, a.lastJoules, a.lastCPU = true, joules, nodeCPU
+
+	listed := make(map[string]bool, len(pods))
+	for _, pod := range pods {
+		uid := pod.Metadata.UID
+		listed[uid] = true
+		run, tracked := a.pods[uid]
+		if pod.Status.Phase != PodRunning {
+			if tracked {
+				a.finish(ctx, run, now)
+			}
+			continue
+		}
+
+		if !tracked {
+			cgroup, err := findPodCgroup(a.cfg.CgroupRoot, uid)
+			if err != nil {
+				log.Printf("Failed to find cgroup of pod %s/%s: %v", pod.Metadata.Namespace, pod.Metadata.Name, err)
+				continue
+			}
+			run = &podRun{pod: pod, cgroup: cgroup, started: now}
+			if pod.Status.StartTime != nil {
+				run.started = *pod.Status.StartTime
+			}
+			if run.lastCPU, err = energy.CgroupCPUTime(cgroup); err != nil {
+				log.Printf("Failed to read CPU time of pod %s/%s: %v", pod.Metadata.Namespace, pod.Metadata.Name, err)
+				continue
+			}
+			// Energy is attributed from the first sample of a pod on, which follows its start
+			// within an interval
+			run.cpuTime = run.lastCPU
+			a.pods[uid] = run
+			continue
+		}
+
+		run.pod = pod
+		cpu, err := energy.CgroupCPUTime(run.cgroup)
+		if err != nil {
+			// The pod is terminating; it completes with the next listing
+			continue
+		}
+		podDelta := cpu - run.lastCPU
+		run.lastCPU = cpu
+		if podDelta <= 0 {
+			continue
+		}
+		run.cpuTime += podDelta
+		if attribute {
+			run.joules += energyDelta * min(float64(podDelta)/float64(cpuDelta), 1)
+		}
+	}
+
+	// Deleted pods completed between two samples
+	for uid, run := range a.pods {
+		if !listed[uid] {
+			a.finish(ctx, run, now)
+		}
+	}
+	return nil
+}
+
+// finish stops measuring a pod and submits its run
+func (a *Agent) finish(ctx context.Context, run *podRun, now time.Time) {
+	delete(a.pods, run.pod.Metadata.UID)
+
+	req, err := a.request(run, now)
+	if err != nil {
+		log.Printf("Skipping pod %s/%s: %v", run.pod.Metadata.Namespace, run.pod.Metadata.Name, err)
+		return
+	}
+	created, err := a.runs.CreateRun(ctx, req)
+	if errors.Is(err, client.ErrSpooled) {
+		log.Printf("Queued run of pod %s/%s: %v", run.pod.Metadata.Namespace, run.pod.Metadata.Name, err)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to submit run of pod %s/%s: %v", run.pod.Metadata.Namespace, run.pod.Metadata.Name, err)
+		return
+	}
+	log.Printf("Submitted run %s of pod %s/%s: %g kWh, %g kg CO2", created.ID, run.pod.Metadata.Namespace, run.pod.Metadata.Name, created.EnergyKWh, created.CO2Kg)
+}
+
+// flush submits the queued runs that are due
+func (a *Agent) flush(ctx context.Context, flusher Flusher) {
+	result, err := flusher.Flush(ctx)
+	if err != nil {
+		log.Printf("Failed to submit queued runs: %v", err)
+		return
+	}
+	for _, rejected := range result.Rejected {
+		log.Printf("Dropped queued %v", rejected)
+	}
+	if result.Submitted > 0 {
+		log.Printf("Submitted %d queued runs, %d still queued", result.Submitted, result.Pending)
+	}
+}
+
+// request builds the run of a completed pod from its annotations
+func (a *Agent) request(run *podRun, now time.Time) (*service.RunCreateRequest, error) {
+	annotations := run.pod.Metadata.Annotations
+	fullName := annotations[AnnotationRepository]
+	if fullName == "" {
+		fullName = a.cfg.Repository
+	}
+	if fullName == "" {
+		return nil, fmt.Errorf("no %s annotation", AnnotationRepository)
+	}
+	owner, name, ok := strings.Cut(fullName, "/")
+	if !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("repository must be owner/name, got %q", fullName)
+	}
+
+	energyKWh := run.joules / 3.6e6
+	req := &service.RunCreateRequest{
+		Repository: service.RepositoryCreateRequest{
+			Name:     name,
+			FullName: fullName,
+			HTMLURL:  "https://github.com/" + fullName,
+		},
+		EnergyKWh: energyKWh,
+		CO2Kg:     energyKWh * a.cfg.CarbonIntensity / 1000,
+		DurationS: now.Sub(run.started).Seconds(),
+		Metadata: map[string]interface{}{
+			"measurement_method": a.power.Method(),
+			"carbon_intensity":   a.cfg.CarbonIntensity,
+			"cpu_seconds":        run.cpuTime.Seconds(),
+			"k8s_node":           a.cfg.Node,
+			"k8s_namespace":      run.pod.Metadata.Namespace,
+			"k8s_pod":            run.pod.Metadata.Name,
+		},
+	}
+	if a.cfg.Region != "" {
+		req.Metadata["region"] = a.cfg.Region
+	}
+	if commit := annotations[AnnotationCommit]; commit != "" {
+		req.GitCommitSHA = &commit
+	}
+	if branch := annotations[AnnotationBranch]; branch != "" {
+		req.BranchName = &branch
+	}
+	if workflow := annotations[AnnotationWorkflow]; workflow != "" {
+		req.WorkflowName = &workflow
+	}
+	return req, nil
+}
+
+// findPodCgroup finds the cgroup directory of a pod under the host cgroup root. The kubelet
+// names it pod<uid> with the cgroupfs driver and kubepods-<qos>-pod<uid>.slice, with the
+// dashes of the UID replaced, with the systemd driver; on cgroup v1 it is under the cpuacct
+// hierarchy.
+func findPodCgroup(root, uid string) (string, error) {
+	names := []string{"pod" + uid, "pod" + strings.ReplaceAll(uid, "-", "_")}
+	for _, hierarchy := range []string{root, filepath.Join(root, "cpu,cpuacct"), filepath.Join(root, "cpuacct")} {
+		var found string
+		filepath.WalkDir(hierarchy, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || !entry.IsDir() {
+				return nil
+			}
+			rel, _ := filepath.Rel(hierarchy, path)
+			// Pods are at most kubepods/<qos>/<pod> deep; containers are below them
+			if depth := strings.Count(rel, string(filepath.Separator)); depth > 2 {
+				return filepath.SkipDir
+			}
+			if rel != "." && !strings.HasPrefix(rel, "kubepods") {
+				return filepath.SkipDir
+			}
+			base := filepath.Base(path)
+			for _, name := range names {
+				if strings.HasSuffix(strings.TrimSuffix(base, ".slice"), name) {
+					found = path
+					return filepath.SkipAll
+				}
+			}
+			return nil
+		})
+		if found != "" {
+			return found, nil
+		}
+	}
+	return "", fmt.Errorf("no cgroup for pod %s", uid)
+}
@@ -0,0 +1,200 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+type fakePower struct{ joules float64 }
+
+func (p *fakePower) Method() string { return PowerRAPL }
+
+func (p *fakePower) Joules(ctx context.Context) (float64, error) { return p.joules, nil }
+
+type fakeRuns struct{ requests []*service.RunCreateRequest }
+
+func (r *fakeRuns) CreateRun(ctx context.Context, req *service.RunCreateRequest) (*db.Run, error) {
+	r.requests = append(r.requests, req)
+	return &db.Run{ID: uuid.New(), EnergyKWh: req.EnergyKWh, CO2Kg: req.CO2Kg}, nil
+}
+
+// fakeKube serves the pods of a node like the Kubernetes API
+type fakeKube struct {
+	mu   sync.Mutex
+	pods []Pod
+}
+
+func (k *fakeKube) set(pods ...Pod) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.pods = pods
+}
+
+func (k *fakeKube) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer test-token" || r.URL.Path != "/api/v1/pods" ||
+		r.URL.Query().Get("fieldSelector") != "spec.nodeName=node-1" || r.URL.Query().Get("labelSelector") != DefaultSelector {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	json.NewEncoder(w).Encode(map[string]interface{}{"kind": "PodList", "items": k.pods})
+}
+
+func testPod(name, uid, phase string, annotations map[string]string) Pod {
+	var pod Pod
+	pod.Metadata.Name = name
+	pod.Metadata.Namespace = "arc-runners"
+	pod.Metadata.UID = uid
+	pod.Metadata.Annotations = annotations
+	pod.Spec.NodeName = "node-1"
+	pod.Status.Phase = phase
+	return pod
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func TestAgent(t *testing.T) {
+	host := t.TempDir()
+	cgroupRoot, procRoot := filepath.Join(host, "sys/fs/cgroup"), filepath.Join(host, "proc")
+	// The systemd cgroup driver on cgroup v2 and the cgroupfs driver
+	cgroupA := filepath.Join(cgroupRoot, "kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod6f1c1f3e_0d1b_4c2e_9a49_3c8e2b7a1d10.slice")
+	cgroupB := filepath.Join(cgroupRoot, "kubepods/besteffort/pod2b0d4c8a-7e3f-4a51-b6d2-9f0e1c3a5b77")
+	setCPU := func(nodeTicks int, podA, podB time.Duration) {
+		writeFile(t, filepath.Join(procRoot, "stat"), "cpu  "+strings.Join([]string{strconv.Itoa(nodeTicks), "0", "0", "99999", "500", "0", "0", "0", "0", "0"}, " ")+"\ncpu0 1 2 3 4\n")
+		writeFile(t, filepath.Join(cgroupA, "cpu.stat"), "usage_usec "+strconv.Itoa(int(podA.Microseconds()))+"\n")
+		writeFile(t, filepath.Join(cgroupB, "cpu.stat"), "usage_usec "+strconv.Itoa(int(podB.Microseconds()))+"\n")
+	}
+
+	kube := &fakeKube{}
+	server := httptest.NewServer(kube)
+	defer server.Close()
+	tokenFile := filepath.Join(host, "token")
+	writeFile(t, tokenFile, "test-token\n")
+
+	power := &fakePower{}
+	runs := &fakeRuns{}
+	agent := New(Config{
+		Node:            "node-1",
+		Selector:        DefaultSelector,
+		CgroupRoot:      cgroupRoot,
+		ProcRoot:        procRoot,
+		Region:          "westeurope",
+		CarbonIntensity: 328,
+		Repository:      "acme/runners",
+	}, NewKube(server.URL, tokenFile, server.Client()), power, runs)
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	podA := testPod("runner-a", "6f1c1f3e-0d1b-4c2e-9a49-3c8e2b7a1d10", PodRunning, map[string]string{
+		AnnotationRepository: "octocat/hello-world",
+		AnnotationBranch:     "main",
+	})
+	podB := testPod("runner-b", "2b0d4c8a-7e3f-4a51-b6d2-9f0e1c3a5b77", PodRunning, nil)
+
+	// The first sample starts measuring the pods
+	kube.set(podA, podB)
+	power.joules = 100
+	setCPU(1000, time.Second, 0)
+	require.NoError(t, agent.Sample(context.Background(), start))
+	assert.Len(t, agent.pods, 2)
+
+	// 4 s of node CPU time: pod A used half, pod B a quarter of the 200 J
+	power.joules = 300
+	setCPU(1400, 3*time.Second, time.Second)
+	require.NoError(t, agent.Sample(context.Background(), start.Add(10*time.Second)))
+	assert.InDelta(t, 100.0, agent.pods[podA.Metadata.UID].joules, 1e-9)
+	assert.InDelta(t, 50.0, agent.pods[podB.Metadata.UID].joules, 1e-9)
+	assert.Empty(t, runs.requests)
+
+	// Pod A succeeded and pod B was deleted
+	podA.Status.Phase = PodSucceeded
+	kube.set(podA)
+	power.joules = 400
+	setCPU(1500, 3*time.Second, time.Second)
+	require.NoError(t, agent.Sample(context.Background(), start.Add(20*time.Second)))
+	assert.Empty(t, agent.pods)
+	require.Len(t, runs.requests, 2)
+
+	byRepo := map[string]*service.RunCreateRequest{}
+	for _, req := range runs.requests {
+		byRepo[req.Repository.FullName] = req
+	}
+	runA := byRepo["octocat/hello-world"]
+	require.NotNil(t, runA)
+	assert.InDelta(t, 100.0/3.6e6, runA.EnergyKWh, 1e-12)
+	assert.InDelta(t, 100.0/3.6e6*328/1000, runA.CO2Kg, 1e-12)
+	assert.Equal(t, 20.0, runA.DurationS)
+	require.NotNil(t, runA.BranchName)
+	assert.Equal(t, "main", *runA.BranchName)
+	assert.Equal(t, map[string]interface{}{
+		"measurement_method": PowerRAPL,
+		"carbon_intensity":   328.0,
+		"cpu_seconds":        3.0,
+		"k8s_node":           "node-1",
+		"k8s_namespace":      "arc-runners",
+		"k8s_pod":            "runner-a",
+		"region":             "westeurope",
+	}, runA.Metadata)
+
+	runB := byRepo["acme/runners"]
+	require.NotNil(t, runB)
+	assert.InDelta(t, 50.0/3.6e6, runB.EnergyKWh, 1e-12)
+	assert.Equal(t, "https://github.com/acme/runners", runB.Repository.HTMLURL)
+
+	t.Run("API errors", func(t *testing.T) {
+		denied := New(Config{Node: "node-1", ProcRoot: procRoot}, NewKube(server.URL, "", server.Client()), power, runs)
+		err := denied.Sample(context.Background(), start)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "403")
+	})
+}
+
+func TestFindPodCgroup(t *testing.T) {
+	root := t.TempDir()
+	pod := filepath.Join(root, "cpu,cpuacct/kubepods/burstable/pod2b0d4c8a-7e3f-4a51-b6d2-9f0e1c3a5b77")
+	require.NoError(t, os.MkdirAll(filepath.Join(pod, "3c1e9f"), 0o755))
+
+	found, err := findPodCgroup(root, "2b0d4c8a-7e3f-4a51-b6d2-9f0e1c3a5b77")
+	require.NoError(t, err)
+	assert.Equal(t, pod, found)
+
+	_, err = findPodCgroup(root, "6f1c1f3e-0d1b-4c2e-9a49-3c8e2b7a1d10")
+	assert.Error(t, err)
+}
+
+func TestSumMetrics(t *testing.T) {
+	metrics := `# HELP kepler_node_package_joules_total Aggregated RAPL value in package (socket) in joules
+# TYPE kepler_node_package_joules_total counter
+kepler_node_package_joules_total{instance="node-1",mode="dynamic",package="0",source="rapl-sysfs"} 1200.5
+kepler_node_package_joules_total{instance="node-1",mode="idle",package="0",source="rapl-sysfs"} 800
+kepler_node_dram_joules_total{instance="node-1",mode="dynamic"} 100 1704110400000
+kepler_node_package_joules_total_extra 5
+kepler_container_joules_total{pod_name="runner-a"} 999
+`
+	total, err := sumMetrics(strings.NewReader(metrics), keplerMetrics)
+	require.NoError(t, err)
+	assert.Equal(t, 2100.5, total)
+
+	_, err = sumMetrics(strings.NewReader("up 1\n"), keplerMetrics)
+	assert.Error(t, err)
+}
@@ -0,0 +1,118 @@
+package agent
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// serviceAccountDir holds the credentials Kubernetes mounts into pods
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// Pod phases
+const (
+	PodRunning   = "Running"
+	PodSucceeded = "Succeeded"
+	PodFailed    = "Failed"
+)
+
+// Pod is the part of a Kubernetes pod the agent reads
+type Pod struct {
+	Metadata struct {
+		Name        string            `json:"name"`
+		Namespace   string            `json:"namespace"`
+		UID         string            `json:"uid"`
+		Labels      map[string]string `json:"labels"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"metadata"`
+	Spec struct {
+		NodeName string `json:"nodeName"`
+	} `json:"spec"`
+	Status struct {
+		Phase     string     `json:"phase"`
+		StartTime *time.Time `json:"startTime"`
+	} `json:"status"`
+}
+
+// Kube lists pods from the Kubernetes API. It reads the token for every request, since bound
+// service account tokens are rotated.
+type Kube struct {
+	baseURL   string
+	tokenFile string
+	client    *http.Client
+}
+
+// NewKube returns a client of the API server at baseURL authenticating with the bearer token
+// in tokenFile; an empty tokenFile sends no token
+func NewKube(baseURL, tokenFile string, client *http.Client) *Kube {
+	return &Kube{baseURL: strings.TrimRight(baseURL, "/"), tokenFile: tokenFile, client: client}
+}
+
+// InCluster returns a client of the API server of the cluster the agent runs in, with the
+// credentials of the pod's service account
+func InCluster() (*Kube, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a Kubernetes cluster: KUBERNETES_SERVICE_HOST is not set")
+	}
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cluster CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("invalid cluster CA in %s/ca.crt", serviceAccountDir)
+	}
+	client := &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}},
+	}
+	return NewKube("https://"+net.JoinHostPort(host, port), serviceAccountDir+"/token", client), nil
+}
+
+// ListPods returns the pods scheduled on node that match the label selector
+func (k *Kube) ListPods(ctx context.Context, node, selector string) ([]Pod, error) {
+	query := url.Values{}
+	query.Set("fieldSelector", "spec.nodeName="+node)
+	if selector != "" {
+		query.Set("labelSelector", selector)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.baseURL+"/api/v1/pods?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if k.tokenFile != "" {
+		token, err := os.ReadFile(k.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read service account token: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("failed to list pods: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var list struct {
+		Items []Pod `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to decode pods: %w", err)
+	}
+	return list.Items, nil
+}
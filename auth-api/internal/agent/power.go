@@ -0,0 +1,176 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ecoci/auth-api/internal/energy"
+)
+
+// Power sources of the node
+const (
+	PowerRAPL   = "rapl"
+	PowerKepler = "kepler"
+)
+
+// keplerMetrics are the Kepler counters of the energy of the node, summed
+var keplerMetrics = []string{"kepler_node_package_joules_total", "kepler_node_dram_joules_total"}
+
+// PowerSource reads the cumulative energy of the node in joules. The counter may reset, such
+// as when Kepler restarts.
+type PowerSource interface {
+	// Method is the measurement method reported with runs, PowerRAPL or PowerKepler
+	Method() string
+	Joules(ctx context.Context) (float64, error)
+}
+
+// RAPLPower reads the node energy from the RAPL counters of the host, accumulating them across
+// wraparounds
+type RAPLPower struct {
+	meter   *energy.RAPL
+	session *energy.Session
+}
+
+// NewRAPLPower returns the RAPL power source of the host powercap directory
+func NewRAPLPower(powercap string) (*RAPLPower, error) {
+	meter, err := energy.NewRAPL(powercap)
+	if err != nil {
+		return nil, err
+	}
+	return &RAPLPower{meter: meter}, nil
+}
+
+// Method returns PowerRAPL
+func (p *RAPLPower) Method() string {
+	return PowerRAPL
+}
+
+// Joules returns the energy since the first reading
+func (p *RAPLPower) Joules(ctx context.Context) (float64, error) {
+	reading, err := p.meter.Read()
+	if err != nil {
+		return 0, err
+	}
+	if p.session == nil {
+		p.session = energy.NewSession(energy.MethodRAPL, reading, 0)
+	} else {
+		p.session.Add(reading)
+	}
+	return p.session.Joules, nil
+}
+
+// KeplerPower reads the node energy from the Prometheus metrics of the Kepler exporter on the
+// node
+type KeplerPower struct {
+	url    string
+	client *http.Client
+}
+
+// NewKeplerPower returns the power source of the Kepler metrics endpoint at url, such as
+// http://$(NODE_IP):9102/metrics
+func NewKeplerPower(url string) *KeplerPower {
+	return &KeplerPower{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Method returns PowerKepler
+func (p *KeplerPower) Method() string {
+	return PowerKepler
+}
+
+// Joules returns the sum of the Kepler node energy counters
+func (p *KeplerPower) Joules(ctx context.Context) (float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to scrape Kepler: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("failed to scrape Kepler: %s", resp.Status)
+	}
+	return sumMetrics(resp.Body, keplerMetrics)
+}
+
+// sumMetrics sums the samples of the named metrics in the Prometheus text format
+func sumMetrics(r io.Reader, names []string) (float64, error) {
+	var total float64
+	found := false
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		for _, name := range names {
+			rest, ok := strings.CutPrefix(line, name)
+			if !ok || rest == "" || (rest[0] != '{' && rest[0] != ' ') {
+				continue
+			}
+			// The value follows the labels; a timestamp may follow the value
+			if rest[0] == '{' {
+				rest = rest[strings.LastIndex(rest, "}")+1:]
+			}
+			fields := strings.Fields(rest)
+			if len(fields) == 0 {
+				continue
+			}
+			value, err := strconv.ParseFloat(fields[0], 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid sample %q: %w", line, err)
+			}
+			total += value
+			found = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read metrics: %w", err)
+	}
+	if !found {
+		return 0, fmt.Errorf("no %s in Kepler metrics", strings.Join(names, " or "))
+	}
+	return total, nil
+}
+
+// NodeCPUTime returns the busy CPU time of all CPUs of the host from the cpu line of
+// /proc/stat under procRoot, counted in USER_HZ (100 per second on Linux)
+func NodeCPUTime(procRoot string) (time.Duration, error) {
+	file, err := os.Open(filepath.Join(procRoot, "stat"))
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || fields[0] != "cpu" {
+			continue
+		}
+		var busy uint64
+		for i, field := range fields[1:] {
+			// idle and iowait; guest time is included in user time already
+			if i == 3 || i == 4 || i >= 8 {
+				continue
+			}
+			ticks, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid /proc/stat: %w", err)
+			}
+			busy += ticks
+		}
+		return time.Duration(busy) * 10 * time.Millisecond, nil
+	}
+	return 0, fmt.Errorf("no cpu line in /proc/stat")
+}
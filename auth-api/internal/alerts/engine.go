@@ -0,0 +1,121 @@
+// Package alerts evaluates user-defined alert rules in the background and delivers the
+// breached ones by email or through the chat integrations of organizations
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/mail"
+	"github.com/ecoci/auth-api/internal/notify"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// EvaluationInterval is how often the alert evaluation job runs
+const EvaluationInterval = 5 * time.Minute
+
+// Engine evaluates alert rules and delivers the breached ones
+type Engine struct {
+	alerts        *service.AlertService
+	notifications *service.NotificationService
+	users         *service.UserService
+	mailer        *mail.Mailer
+}
+
+// NewEngine creates a new alert engine
+func NewEngine(alerts *service.AlertService, notifications *service.NotificationService, users *service.UserService, mailer *mail.Mailer) *Engine {
+	return &Engine{
+		alerts:        alerts,
+		notifications: notifications,
+		users:         users,
+		mailer:        mailer,
+	}
+}
+
+// EvaluateAll evaluates every enabled rule at now and delivers the breached rules that are
+// not in their cooldown. It returns the number of triggered rules; a failing rule is logged
+// and does not stop the others.
+func (e *Engine) EvaluateAll(ctx context.Context, now time.Time) (int, error) {
+	rules, err := e.alerts.ListEnabledRules()
+	if err != nil {
+		return 0, err
+	}
+
+	triggered := 0
+	for i := range rules {
+		if err := ctx.Err(); err != nil {
+			return triggered, err
+		}
+
+		rule := &rules[i]
+		fired, err := e.evaluate(ctx, rule, now)
+		if err != nil {
+			log.Printf("Failed to evaluate alert rule %s: %v", rule.ID, err)
+			continue
+		}
+		if fired {
+			triggered++
+		}
+	}
+	return triggered, nil
+}
+
+// evaluate evaluates one rule and delivers it when breached outside its cooldown
+func (e *Engine) evaluate(ctx context.Context, rule *db.AlertRule, now time.Time) (bool, error) {
+	evaluation, err := e.alerts.Evaluate(rule, now)
+	if err != nil {
+		return false, err
+	}
+
+	fire := evaluation.Breached && !service.InCooldown(rule, now)
+	if fire {
+		if err := e.deliver(ctx, rule, evaluation); err != nil {
+			// Recorded without triggering, so delivery is retried on the next evaluation
+			fire = false
+			log.Printf("Failed to deliver alert rule %s: %v", rule.ID, err)
+		}
+	}
+
+	return fire, e.alerts.RecordEvaluation(rule, evaluation, fire)
+}
+
+// deliver sends the alert of a breached rule to its channel
+func (e *Engine) deliver(ctx context.Context, rule *db.AlertRule, evaluation *service.AlertEvaluation) error {
+	target, err := e.alerts.Target(rule)
+	if err != nil {
+		return err
+	}
+	msg := notify.AlertRuleMessage(rule, target, evaluation)
+
+	if rule.Channel == service.AlertChannelEmail {
+		owner, err := e.users.GetUserByID(rule.UserID)
+		if err != nil {
+			return err
+		}
+		e.mailer.SendAlert(owner, msg)
+		return nil
+	}
+
+	if target.OrganizationID == nil {
+		return fmt.Errorf("%s alerts require an organization integration", rule.Channel)
+	}
+	integration, err := e.notifications.GetIntegration(*target.OrganizationID, rule.Channel)
+	if err != nil {
+		return err
+	}
+	notifier, err := notify.NewNotifier(*integration)
+	if err != nil {
+		return err
+	}
+
+	channel := ""
+	if rule.Destination != nil {
+		channel = *rule.Destination
+	} else if integration.DefaultChannel != nil {
+		channel = *integration.DefaultChannel
+	}
+	return notifier.Send(ctx, channel, msg)
+}
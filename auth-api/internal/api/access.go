@@ -0,0 +1,175 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/problem"
+)
+
+// The helpers below resolve the caller and the resource a request targets. On failure they
+// write the error response themselves and return false, so handlers can simply return.
+
+// currentUserID returns the authenticated user's ID from the request context
+func currentUserID(c *gin.Context) (uuid.UUID, bool) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		problem.Respond(c, http.StatusUnauthorized, "MISSING_USER_ID", "User ID not found in context")
+		return uuid.Nil, false
+	}
+	return userID.(uuid.UUID), true
+}
+
+// requireVisibleRepository parses the repo_id path parameter and ensures the current user
+// may see the repository; private repositories they cannot access are reported as not found
+func (s *Server) requireVisibleRepository(c *gin.Context) (*db.Repository, bool) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return nil, false
+	}
+
+	repoID, err := uuid.Parse(c.Param("repo_id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_REPO_ID", "Invalid repository ID")
+		return nil, false
+	}
+
+	repo, err := s.repoService.GetRepositoryByID(repoID)
+	if err != nil {
+		problem.Respond(c, http.StatusNotFound, "REPOSITORY_NOT_FOUND", "Repository not found")
+		return nil, false
+	}
+
+	visible, err := s.repoService.CanViewRepository(repoID, userID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "REPOSITORY_ACCESS_CHECK_FAILED", "Failed to check repository access")
+		return nil, false
+	}
+	if !visible {
+		problem.Respond(c, http.StatusNotFound, "REPOSITORY_NOT_FOUND", "Repository not found")
+		return nil, false
+	}
+
+	return repo, true
+}
+
+// requireRepositoryOwner is like requireVisibleRepository but additionally requires the
+// current user to own the repository
+func (s *Server) requireRepositoryOwner(c *gin.Context) (*db.Repository, bool) {
+	repo, ok := s.requireVisibleRepository(c)
+	if !ok {
+		return nil, false
+	}
+
+	userID, _ := currentUserID(c)
+	if repo.OwnerID != userID {
+		problem.Respond(c, http.StatusForbidden, "NOT_REPOSITORY_OWNER", "Only the repository owner can perform this action")
+		return nil, false
+	}
+
+	return repo, true
+}
+
+// requireOrganizationMember resolves the org path parameter (a GitHub login) and ensures the
+// current user is a member; organizations the user does not belong to are reported as not found
+func (s *Server) requireOrganizationMember(c *gin.Context) (*db.Organization, bool) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return nil, false
+	}
+
+	org, err := s.orgService.GetOrganizationByLogin(c.Param("org"))
+	if err != nil {
+		problem.Respond(c, http.StatusNotFound, "ORGANIZATION_NOT_FOUND", "Organization not found")
+		return nil, false
+	}
+
+	member, err := s.orgService.IsMember(org.ID, userID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "ORGANIZATION_ACCESS_CHECK_FAILED", "Failed to check organization membership")
+		return nil, false
+	}
+	if !member {
+		problem.Respond(c, http.StatusNotFound, "ORGANIZATION_NOT_FOUND", "Organization not found")
+		return nil, false
+	}
+
+	return org, true
+}
+
+// requireOrganizationAdmin resolves the org path parameter like requireOrganizationMember and
+// ensures the current user is an admin of the organization on GitHub
+func (s *Server) requireOrganizationAdmin(c *gin.Context) (*db.Organization, bool) {
+	org, ok := s.requireOrganizationMember(c)
+	if !ok {
+		return nil, false
+	}
+
+	userID, _ := currentUserID(c)
+	admin, err := s.orgService.IsAdmin(org.ID, userID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "ORGANIZATION_ACCESS_CHECK_FAILED", "Failed to check organization role")
+		return nil, false
+	}
+	if !admin {
+		problem.Respond(c, http.StatusForbidden, "NOT_ORGANIZATION_ADMIN", "Only organization admins can perform this action")
+		return nil, false
+	}
+
+	return org, true
+}
+
+// requireSubmittedRun resolves the run_id path parameter like requireVisibleRun and ensures the
+// current user submitted the run or owns its repository, so others who can see the run cannot
+// change it
+func (s *Server) requireSubmittedRun(c *gin.Context) (*db.Run, bool) {
+	run, ok := s.requireVisibleRun(c)
+	if !ok {
+		return nil, false
+	}
+
+	userID, _ := currentUserID(c)
+	if run.UserID != userID && (run.Repository == nil || run.Repository.OwnerID != userID) {
+		problem.Respond(c, http.StatusForbidden, "NOT_RUN_SUBMITTER", "Only the user who submitted the run or the repository owner can perform this action")
+		return nil, false
+	}
+
+	return run, true
+}
+
+// requireVisibleRun parses the run_id path parameter and ensures the current user submitted
+// the run or may see its repository; runs they cannot see are reported as not found
+func (s *Server) requireVisibleRun(c *gin.Context) (*db.Run, bool) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return nil, false
+	}
+	runID, ok := parseRunID(c)
+	if !ok {
+		return nil, false
+	}
+
+	run, err := s.runService.GetRunByID(runID)
+	if err != nil {
+		problem.Respond(c, http.StatusNotFound, "RUN_NOT_FOUND", "Run not found")
+		return nil, false
+	}
+	if run.UserID == userID {
+		return run, true
+	}
+
+	visible, err := s.repoService.CanViewRepository(run.RepositoryID, userID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "REPOSITORY_ACCESS_CHECK_FAILED", "Failed to check repository access")
+		return nil, false
+	}
+	if !visible {
+		problem.Respond(c, http.StatusNotFound, "RUN_NOT_FOUND", "Run not found")
+		return nil, false
+	}
+
+	return run, true
+}
@@ -0,0 +1,382 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/cache"
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// UpdateUserRequest represents the account state an administrator can change
+type UpdateUserRequest struct {
+	Role      *string `json:"role,omitempty" binding:"omitempty,oneof=user admin" example:"admin"`
+	Suspended *bool   `json:"suspended,omitempty"`
+	// Plan is a plan of RATE_LIMIT_PLANS, or empty for the default plan
+	Plan *string `json:"plan,omitempty" example:"pro"`
+}
+
+// TransferRepositoryRequest names the new owner of a repository
+type TransferRepositoryRequest struct {
+	// Owner is the GitHub username of the new owner, who must have signed in to EcoCI
+	Owner string `json:"owner" binding:"required" example:"octocat"`
+	// KeepPreviousOwner keeps the previous owner on as a collaborator
+	KeepPreviousOwner bool `json:"keep_previous_owner"`
+}
+
+// requireOtherUser parses the user_id path parameter and ensures it names an existing user
+// other than the current administrator, who cannot demote, suspend or delete themselves
+func (s *Server) requireOtherUser(c *gin.Context) (*db.User, bool) {
+	adminID, ok := currentUserID(c)
+	if !ok {
+		return nil, false
+	}
+
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_USER_ID", "Invalid user ID")
+		return nil, false
+	}
+
+	user, err := s.userService.GetUserByID(userID)
+	if err != nil {
+		problem.Respond(c, http.StatusNotFound, "USER_NOT_FOUND", "User not found")
+		return nil, false
+	}
+
+	if user.ID == adminID {
+		problem.Respond(c, http.StatusBadRequest, "CANNOT_MODIFY_SELF", "Administrators cannot change their own account")
+		return nil, false
+	}
+
+	return user, true
+}
+
+// List users handler
+// @Summary List users
+// @Description Search the user accounts of the platform with the number of runs each submitted and whether they are suspended, newest first unless sorted otherwise (admin only)
+// @Tags admin
+// @Security CookieAuth
+// @Produce json
+// @Param q query string false "Match GitHub username, name or email"
+// @Param role query string false "Filter by role" Enums(user,admin)
+// @Param suspended query bool false "Only suspended (true) or active (false) users"
+// @Param sort query string false "Sort field" Enums(created_at,github_username,github_email,run_count) default(created_at)
+// @Param order query string false "Sort order" Enums(asc,desc) default(desc)
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Router /admin/users [get]
+func (s *Server) handleAdminListUsers(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	offset := (page - 1) * limit
+
+	sortBy := c.DefaultQuery("sort", "created_at")
+	order := c.DefaultQuery("order", "desc")
+	if !service.IsValidUserSort(sortBy) {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_SORT", "Invalid sort, must be one of created_at, github_username, github_email, run_count")
+		return
+	}
+	if order != "asc" && order != "desc" {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_ORDER", "Invalid order, must be one of asc, desc")
+		return
+	}
+
+	filter := service.UserFilter{Query: c.Query("q")}
+	if role := c.Query("role"); role != "" {
+		if role != db.RoleUser && role != db.RoleAdmin {
+			problem.Respond(c, http.StatusBadRequest, "INVALID_ROLE", "Invalid role parameter, expected user or admin")
+			return
+		}
+		filter.Role = role
+	}
+	if suspendedParam := c.Query("suspended"); suspendedParam != "" {
+		suspended, err := strconv.ParseBool(suspendedParam)
+		if err != nil {
+			problem.Respond(c, http.StatusBadRequest, "INVALID_SUSPENDED_FILTER", "Invalid suspended parameter, expected true or false")
+			return
+		}
+		filter.Suspended = &suspended
+	}
+
+	users, total, err := s.userService.ListUsers(filter, sortBy, order, limit, offset)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "USERS_FETCH_FAILED", "Failed to list users")
+		return
+	}
+
+	totalPages := (total + int64(limit) - 1) / int64(limit)
+
+	c.JSON(http.StatusOK, gin.H{
+		"users": users,
+		"pagination": gin.H{
+			"page":     page,
+			"limit":    limit,
+			"total":    total,
+			"pages":    totalPages,
+			"has_next": int64(page) < totalPages,
+			"has_prev": page > 1,
+		},
+	})
+}
+
+// Update user handler
+// @Summary Update user account
+// @Description Change the role or rate limit plan of a user, or suspend and reinstate them (admin only). Suspended users cannot sign in and their sessions stop working immediately. Administrators cannot change their own account.
+// @Tags admin
+// @Security CookieAuth
+// @Accept json
+// @Produce json
+// @Param user_id path string true "User UUID"
+// @Param account body UpdateUserRequest true "Account state"
+// @Success 200 {object} db.User
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /admin/users/{user_id} [patch]
+func (s *Server) handleAdminUpdateUser(c *gin.Context) {
+	user, ok := s.requireOtherUser(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body", err.Error())
+		return
+	}
+
+	if req.Plan != nil && *req.Plan != "" {
+		if _, ok := s.cfg.RateLimitPlans[*req.Plan]; !ok {
+			problem.Respond(c, http.StatusBadRequest, "INVALID_PLAN", "Unknown plan")
+			return
+		}
+	}
+
+	updated, err := s.userService.UpdateAccount(user.ID, service.AccountUpdate{
+		Role:      req.Role,
+		Suspended: req.Suspended,
+		Plan:      req.Plan,
+	}, time.Now())
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "USER_UPDATE_FAILED", "Failed to update user")
+		return
+	}
+
+	s.recordAudit(c, auditUser("user.update", user.ID, service.AuditDiff(
+		accountAuditFields(user),
+		accountAuditFields(updated),
+	)))
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// accountAuditFields returns the audited account state of a user
+func accountAuditFields(user *db.User) map[string]interface{} {
+	fields := map[string]interface{}{
+		"role":      user.Role,
+		"suspended": user.SuspendedAt != nil,
+		"plan":      nil,
+	}
+	if user.Plan != nil {
+		fields["plan"] = *user.Plan
+	}
+	return fields
+}
+
+// Delete user handler
+// @Summary Delete user account
+// @Description Delete a user with their repositories and runs (admin only). The account can be restored within the restore window. Administrators cannot delete their own account.
+// @Tags admin
+// @Security CookieAuth
+// @Produce json
+// @Param user_id path string true "User UUID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /admin/users/{user_id} [delete]
+func (s *Server) handleAdminDeleteUser(c *gin.Context) {
+	user, ok := s.requireOtherUser(c)
+	if !ok {
+		return
+	}
+
+	// Remember the repositories whose statistics change before they are gone
+	repoIDs, err := s.userService.ListRepositoryIDs(user.ID)
+	if err == nil {
+		err = s.userService.DeleteUser(user.ID)
+	}
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "USER_DELETION_FAILED", "Failed to delete user")
+		return
+	}
+
+	statsScopes := []string{cache.UserScope(user.ID.String())}
+	for _, repoID := range repoIDs {
+		statsScopes = append(statsScopes, cache.RepositoryScope(repoID.String()))
+	}
+	s.invalidateCaches(c.Request.Context(), map[string][]string{
+		cache.GroupRepositories: {cache.ScopeAll},
+		cache.GroupLeaderboard:  {cache.ScopeAll},
+		cache.GroupStats:        statsScopes,
+	})
+	s.recordAudit(c, auditUser("user.delete", user.ID, nil))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "User deleted",
+	})
+}
+
+// Restore user handler
+// @Summary Restore user account
+// @Description Restore a user deleted within the restore window, together with the repositories and runs deleted along with them (admin only)
+// @Tags admin
+// @Security CookieAuth
+// @Produce json
+// @Param user_id path string true "User UUID"
+// @Success 200 {object} db.User
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 410 {object} problem.Problem
+// @Router /admin/users/{user_id}/restore [post]
+func (s *Server) handleAdminRestoreUser(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_USER_ID", "Invalid user ID")
+		return
+	}
+
+	user, err := s.userService.RestoreUser(userID, time.Now().Add(-s.cfg.RestoreWindow))
+	if err != nil {
+		restoreError(c, err, "user", "USER_NOT_FOUND")
+		return
+	}
+
+	statsScopes := []string{cache.UserScope(user.ID.String())}
+	if repoIDs, err := s.userService.ListRepositoryIDs(user.ID); err == nil {
+		for _, repoID := range repoIDs {
+			statsScopes = append(statsScopes, cache.RepositoryScope(repoID.String()))
+		}
+	}
+	s.invalidateCaches(c.Request.Context(), map[string][]string{
+		cache.GroupRepositories: {cache.ScopeAll},
+		cache.GroupLeaderboard:  {cache.ScopeAll},
+		cache.GroupStats:        statsScopes,
+	})
+	s.recordAudit(c, auditUser("user.restore", user.ID, nil))
+
+	c.JSON(http.StatusOK, user)
+}
+
+// Transfer repository handler
+// @Summary Transfer repository
+// @Description Reassign a repository and its runs to another user (admin only). The new owner must have signed in to EcoCI.
+// @Tags admin
+// @Security CookieAuth
+// @Accept json
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param transfer body TransferRepositoryRequest true "New owner"
+// @Success 200 {object} db.Repository
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /admin/repos/{repo_id}/transfer [post]
+func (s *Server) handleAdminTransferRepository(c *gin.Context) {
+	repoID, err := uuid.Parse(c.Param("repo_id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_REPOSITORY_ID", "Invalid repository ID")
+		return
+	}
+
+	var req TransferRepositoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body", err.Error())
+		return
+	}
+
+	previous, err := s.repoService.GetRepositoryByID(repoID)
+	if err != nil {
+		problem.Respond(c, http.StatusNotFound, "REPOSITORY_NOT_FOUND", "Repository not found")
+		return
+	}
+
+	owner, err := s.userService.GetUserByGitHubUsername(req.Owner)
+	if err != nil {
+		problem.Respond(c, http.StatusNotFound, "USER_NOT_FOUND", "User not found; they must sign in to EcoCI first")
+		return
+	}
+
+	repo, err := s.repoService.TransferRepository(repoID, owner.ID, req.KeepPreviousOwner)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "REPOSITORY_TRANSFER_FAILED", "Failed to transfer repository")
+		return
+	}
+
+	s.invalidateRepositoryCaches(c.Request.Context(), repo.ID)
+	s.recordAudit(c, auditRepository("repository.transfer", repo, service.AuditDiff(
+		map[string]interface{}{"owner_id": previous.OwnerID.String()},
+		map[string]interface{}{"owner_id": repo.OwnerID.String()},
+	)))
+	s.publishRepoUpdated(repo)
+
+	c.JSON(http.StatusOK, repo)
+}
+
+// Platform stats handler
+// @Summary Platform statistics
+// @Description Get platform-wide counts of users, repositories and runs, and the run ingest rate over the last 24 hours (admin only)
+// @Tags admin
+// @Security CookieAuth
+// @Produce json
+// @Success 200 {object} service.PlatformStats
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Router /admin/stats [get]
+func (s *Server) handleAdminStats(c *gin.Context) {
+	stats, err := s.statsService.PlatformStats(time.Now())
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "PLATFORM_STATS_FAILED", "Failed to compute platform statistics")
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// Config handler
+// @Summary Inspect configuration
+// @Description Get the effective configuration keyed by environment variable, with secrets redacted (admin only)
+// @Tags admin
+// @Security CookieAuth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Router /admin/config [get]
+func (s *Server) handleAdminConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"config": s.cfg.Redacted(),
+	})
+}
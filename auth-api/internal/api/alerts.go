@@ -0,0 +1,259 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// requireAlertRule resolves the rule_id path parameter to an alert rule of the current
+// user; rules of other users are reported as not found
+func (s *Server) requireAlertRule(c *gin.Context) (*db.AlertRule, bool) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return nil, false
+	}
+
+	ruleID, err := uuid.Parse(c.Param("rule_id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_ALERT_RULE_ID", "Invalid alert rule ID")
+		return nil, false
+	}
+
+	rule, err := s.alertService.GetRule(ruleID)
+	if err != nil || rule.UserID != userID {
+		problem.Respond(c, http.StatusNotFound, "ALERT_RULE_NOT_FOUND", "Alert rule not found")
+		return nil, false
+	}
+
+	return rule, true
+}
+
+// bindAlertRule binds and validates an alert rule request and checks the current user may
+// watch its scope: a visible repository or an organization they belong to. Chat channels
+// post through an organization integration and require membership of that organization.
+// It returns the resolved organization ID of organization rules.
+func (s *Server) bindAlertRule(c *gin.Context, userID uuid.UUID) (*service.AlertRuleRequest, *uuid.UUID, bool) {
+	var req service.AlertRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body", err.Error())
+		return nil, nil, false
+	}
+	if err := service.ValidateAlertRule(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_ALERT_RULE", "Invalid alert rule", err.Error())
+		return nil, nil, false
+	}
+
+	var orgID *uuid.UUID
+	switch req.Scope {
+	case service.AlertScopeRepository:
+		repo, err := s.repoService.GetRepositoryByID(*req.RepositoryID)
+		visible := false
+		if err == nil {
+			visible, err = s.repoService.CanViewRepository(repo.ID, userID)
+		}
+		if err != nil || !visible {
+			problem.Respond(c, http.StatusNotFound, "REPOSITORY_NOT_FOUND", "Repository not found")
+			return nil, nil, false
+		}
+		if req.Channel != service.AlertChannelEmail {
+			if repo.OrganizationID == nil {
+				problem.Respond(c, http.StatusBadRequest, "REPOSITORY_NOT_IN_ORGANIZATION", "Chat alerts are posted through organization integrations; the repository does not belong to an organization")
+				return nil, nil, false
+			}
+			if member, err := s.orgService.IsMember(*repo.OrganizationID, userID); err != nil || !member {
+				problem.Respond(c, http.StatusForbidden, "NOT_ORGANIZATION_MEMBER", "Only organization members can post alerts through its integrations")
+				return nil, nil, false
+			}
+		}
+	case service.AlertScopeOrganization:
+		org, err := s.orgService.GetOrganizationByLogin(*req.Organization)
+		member := false
+		if err == nil {
+			member, err = s.orgService.IsMember(org.ID, userID)
+		}
+		if err != nil || !member {
+			problem.Respond(c, http.StatusNotFound, "ORGANIZATION_NOT_FOUND", "Organization not found")
+			return nil, nil, false
+		}
+		orgID = &org.ID
+	}
+
+	return &req, orgID, true
+}
+
+// List alert rules handler
+// @Summary List alert rules
+// @Description Get the alert rules of the current user
+// @Tags alerts
+// @Security CookieAuth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} problem.Problem
+// @Router /alert-rules [get]
+func (s *Server) handleListAlertRules(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	rules, err := s.alertService.ListRules(userID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "ALERT_RULES_FETCH_FAILED", "Failed to list alert rules")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rules": rules,
+	})
+}
+
+// Create alert rule handler
+// @Summary Create alert rule
+// @Description Alert when a metric of a repository, an organization or your own runs, aggregated over a rolling window, crosses a threshold (e.g. weekly CO2 above 5 kg, or average run CO2 up 20% week over week). Rules are evaluated every few minutes and delivered by email or through a chat integration of the organization, at most once per window.
+// @Tags alerts
+// @Security CookieAuth
+// @Accept json
+// @Produce json
+// @Param rule body service.AlertRuleRequest true "Alert rule"
+// @Success 201 {object} db.AlertRule
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /alert-rules [post]
+func (s *Server) handleCreateAlertRule(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	req, orgID, ok := s.bindAlertRule(c, userID)
+	if !ok {
+		return
+	}
+
+	rule, err := s.alertService.CreateRule(userID, req, orgID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "ALERT_RULE_CREATION_FAILED", "Failed to create alert rule")
+		return
+	}
+
+	s.recordAudit(c, auditAlertRule("alert_rule.create", rule, service.AuditDiff(nil, alertRuleAuditFields(rule))))
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+// Get alert rule handler
+// @Summary Get alert rule
+// @Description Get an alert rule of the current user with its last evaluation
+// @Tags alerts
+// @Security CookieAuth
+// @Produce json
+// @Param rule_id path string true "Alert rule UUID"
+// @Success 200 {object} db.AlertRule
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /alert-rules/{rule_id} [get]
+func (s *Server) handleGetAlertRule(c *gin.Context) {
+	rule, ok := s.requireAlertRule(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+// Update alert rule handler
+// @Summary Update alert rule
+// @Description Replace the definition of an alert rule of the current user; its evaluation state is reset
+// @Tags alerts
+// @Security CookieAuth
+// @Accept json
+// @Produce json
+// @Param rule_id path string true "Alert rule UUID"
+// @Param rule body service.AlertRuleRequest true "Alert rule"
+// @Success 200 {object} db.AlertRule
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /alert-rules/{rule_id} [put]
+func (s *Server) handleUpdateAlertRule(c *gin.Context) {
+	rule, ok := s.requireAlertRule(c)
+	if !ok {
+		return
+	}
+	req, orgID, ok := s.bindAlertRule(c, rule.UserID)
+	if !ok {
+		return
+	}
+
+	before := alertRuleAuditFields(rule)
+	updated, err := s.alertService.UpdateRule(rule, req, orgID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "ALERT_RULE_UPDATE_FAILED", "Failed to update alert rule")
+		return
+	}
+
+	s.recordAudit(c, auditAlertRule("alert_rule.update", updated, service.AuditDiff(before, alertRuleAuditFields(updated))))
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// Delete alert rule handler
+// @Summary Delete alert rule
+// @Description Remove an alert rule of the current user
+// @Tags alerts
+// @Security CookieAuth
+// @Produce json
+// @Param rule_id path string true "Alert rule UUID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /alert-rules/{rule_id} [delete]
+func (s *Server) handleDeleteAlertRule(c *gin.Context) {
+	rule, ok := s.requireAlertRule(c)
+	if !ok {
+		return
+	}
+
+	if err := s.alertService.DeleteRule(rule.ID); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "ALERT_RULE_DELETION_FAILED", "Failed to delete alert rule")
+		return
+	}
+
+	s.recordAudit(c, auditAlertRule("alert_rule.delete", rule, service.AuditDiff(alertRuleAuditFields(rule), nil)))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Alert rule deleted",
+	})
+}
+
+// alertRuleAuditFields returns the audited definition of an alert rule
+func alertRuleAuditFields(rule *db.AlertRule) map[string]interface{} {
+	fields := map[string]interface{}{
+		"name":        rule.Name,
+		"scope":       rule.Scope,
+		"metric":      rule.Metric,
+		"aggregation": rule.Aggregation,
+		"comparison":  rule.Comparison,
+		"threshold":   rule.Threshold,
+		"window":      rule.Window,
+		"channel":     rule.Channel,
+		"enabled":     rule.Enabled,
+	}
+	if rule.RepositoryID != nil {
+		fields["repository_id"] = rule.RepositoryID.String()
+	}
+	if rule.OrganizationID != nil {
+		fields["organization_id"] = rule.OrganizationID.String()
+	}
+	return fields
+}
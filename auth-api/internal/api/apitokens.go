@@ -0,0 +1,160 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/auth"
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// requireAPIToken resolves the token_id path parameter to an API token of the current user;
+// tokens of other users are reported as not found
+func (s *Server) requireAPIToken(c *gin.Context) (*db.APIToken, bool) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return nil, false
+	}
+
+	tokenID, err := uuid.Parse(c.Param("token_id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_API_TOKEN_ID", "Invalid API token ID")
+		return nil, false
+	}
+
+	token, err := s.userService.GetAPIToken(tokenID)
+	if err != nil || token.UserID != userID {
+		problem.Respond(c, http.StatusNotFound, "API_TOKEN_NOT_FOUND", "API token not found")
+		return nil, false
+	}
+
+	return token, true
+}
+
+// List API tokens handler
+// @Summary List API tokens
+// @Description Get the API tokens of the current user, newest first, with their expiry and the time and source IP of their last use to spot stale or leaked tokens. The tokens themselves are only returned when created.
+// @Tags users
+// @Security CookieAuth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} problem.Problem
+// @Router /me/api-tokens [get]
+func (s *Server) handleListAPITokens(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	tokens, err := s.userService.ListAPITokens(userID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "API_TOKENS_FETCH_FAILED", "Failed to list API tokens")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tokens": tokens,
+	})
+}
+
+// Create API token handler
+// @Summary Create API token
+// @Description Create a named API token for API clients such as CI integrations, sent as Authorization: Bearer <token>. Unlike session tokens it stays valid until expires_at, at most a year and a year when omitted, unless it is deleted. API tokens cannot create other API tokens. The token is only returned in this response.
+// @Tags users
+// @Security CookieAuth
+// @Accept json
+// @Produce json
+// @Param token body service.APITokenRequest true "API token"
+// @Success 201 {object} service.CreatedAPIToken
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Router /me/api-tokens [post]
+func (s *Server) handleCreateAPIToken(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	// A leaked API token must not be able to mint tokens that outlive it
+	if claims, ok := c.Get("jwt_claims"); ok && claims.(*auth.JWTClaims).IsAPIToken() {
+		problem.Respond(c, http.StatusForbidden, "SESSION_REQUIRED", "API tokens can only be created when signed in")
+		return
+	}
+
+	var req service.APITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body", err.Error())
+		return
+	}
+	if err := service.NormalizeAPITokenRequest(&req, time.Now()); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_API_TOKEN", "Invalid API token", err.Error())
+		return
+	}
+
+	token, err := s.userService.CreateAPIToken(userID, &req)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "API_TOKEN_CREATION_FAILED", "Failed to create API token")
+		return
+	}
+	signed, err := s.jwtManager.GenerateAPIToken(userID, c.GetString("github_username"), token.ID, token.ExpiresAt)
+	if err != nil {
+		if err := s.userService.DeleteAPIToken(token.ID); err != nil {
+			log.Printf("Failed to delete unsigned API token %s: %v", token.ID, err)
+		}
+		problem.Respond(c, http.StatusInternalServerError, "API_TOKEN_CREATION_FAILED", "Failed to create API token")
+		return
+	}
+
+	s.recordAudit(c, auditUser("api_token.create", userID, service.AuditDiff(nil, apiTokenAuditFields(token))))
+
+	c.JSON(http.StatusCreated, service.CreatedAPIToken{APIToken: *token, Token: signed})
+}
+
+// Delete API token handler
+// @Summary Delete API token
+// @Description Revoke an API token of the current user; requests made with it are rejected immediately
+// @Tags users
+// @Security CookieAuth
+// @Produce json
+// @Param token_id path string true "API token UUID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /me/api-tokens/{token_id} [delete]
+func (s *Server) handleDeleteAPIToken(c *gin.Context) {
+	token, ok := s.requireAPIToken(c)
+	if !ok {
+		return
+	}
+
+	if err := s.userService.DeleteAPIToken(token.ID); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "API_TOKEN_DELETION_FAILED", "Failed to delete API token")
+		return
+	}
+
+	s.recordAudit(c, auditUser("api_token.delete", token.UserID, service.AuditDiff(apiTokenAuditFields(token), nil)))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "API token deleted",
+	})
+}
+
+// apiTokenAuditFields returns the audited fields of an API token, never the token itself
+func apiTokenAuditFields(token *db.APIToken) map[string]interface{} {
+	fields := map[string]interface{}{
+		"id":   token.ID.String(),
+		"name": token.Name,
+	}
+	if token.ExpiresAt != nil {
+		fields["expires_at"] = token.ExpiresAt.Format(time.RFC3339)
+	}
+	return fields
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/archive"
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/problem"
+)
+
+// ArchiveColumn is a column of the files of the Parquet archive
+type ArchiveColumn struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Nullable bool   `json:"nullable"`
+}
+
+// ArchiveFile is a file of the Parquet archive
+type ArchiveFile struct {
+	db.ArchivePartition
+	URL string `json:"url"`
+}
+
+// Archive manifest handler
+// @Summary Get archive manifest
+// @Description List the Parquet files of the run archive with their schema, for loading into DuckDB, Athena or Spark (admin only)
+// @Tags admin
+// @Security CookieAuth
+// @Produce json
+// @Param repository_id query string false "Repository ID"
+// @Param from query string false "First day (YYYY-MM-DD)"
+// @Param to query string false "Last day (YYYY-MM-DD)"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(500)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /admin/archive/manifest [get]
+func (s *Server) handleArchiveManifest(c *gin.Context) {
+	if s.archive == nil {
+		problem.RespondDetail(c, http.StatusNotFound, "ARCHIVE_NOT_CONFIGURED", "Archive not configured", "Set ARCHIVE_S3_BUCKET to archive runs as Parquet files")
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "500"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 1000 {
+		limit = 500
+	}
+	offset := (page - 1) * limit
+
+	var filter archive.Filter
+	if value := c.Query("repository_id"); value != "" {
+		repoID, err := uuid.Parse(value)
+		if err != nil {
+			problem.Respond(c, http.StatusBadRequest, "INVALID_REPOSITORY_ID", "Invalid repository ID")
+			return
+		}
+		filter.RepositoryID = &repoID
+	}
+	for param, bound := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(timeSeriesDateLayout, value)
+		if err != nil {
+			problem.RespondDetail(c, http.StatusBadRequest, "INVALID_DATE_RANGE", "Invalid date range", "The "+param+" parameter must be a date (YYYY-MM-DD)")
+			return
+		}
+		*bound = &parsed
+	}
+
+	partitions, total, err := s.archive.Partitions(c.Request.Context(), filter, limit, offset)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "ARCHIVE_MANIFEST_FETCH_FAILED", "Failed to list archive files")
+		return
+	}
+
+	files := make([]ArchiveFile, len(partitions))
+	for i, partition := range partitions {
+		files[i] = ArchiveFile{ArchivePartition: partition, URL: s.archive.URL(partition.Key)}
+	}
+	columns := make([]ArchiveColumn, len(archive.Columns))
+	for i, column := range archive.Columns {
+		columns[i] = ArchiveColumn{Name: column.Name, Type: column.Type.String(), Nullable: column.Optional}
+	}
+
+	totalPages := (total + int64(limit) - 1) / int64(limit)
+
+	c.JSON(http.StatusOK, gin.H{
+		"format":         "parquet",
+		"location":       s.archive.Location(),
+		"pattern":        s.archive.Pattern(),
+		"partition_keys": []string{"day", "repo"},
+		"columns":        columns,
+		"files":          files,
+		"pagination": gin.H{
+			"page":     page,
+			"limit":    limit,
+			"total":    total,
+			"pages":    totalPages,
+			"has_next": int64(page) < totalPages,
+			"has_prev": page > 1,
+		},
+	})
+}
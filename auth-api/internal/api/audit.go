@@ -0,0 +1,265 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/auth"
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// recordAudit records a mutation the current request made. The actor and request ID are
+// taken from the request unless the event sets them; a failure to record is logged and does
+// not fail the request, whose change has already been made.
+func (s *Server) recordAudit(c *gin.Context, event *db.AuditEvent) {
+	if event.ActorID == nil {
+		if userID, exists := c.Get("user_id"); exists {
+			actorID := userID.(uuid.UUID)
+			event.ActorID = &actorID
+		}
+	}
+	if event.ActorUsername == "" {
+		event.ActorUsername = c.GetString("github_username")
+	}
+	event.RequestID = c.GetString("request_id")
+
+	if err := s.auditService.Record(event); err != nil {
+		log.Printf("Failed to record audit event %s for %s %s: %v", event.Action, event.ResourceType, event.ResourceID, err)
+	}
+}
+
+// Audited resource types
+const (
+	auditResourceRun            = "run"
+	auditResourceRepository     = "repository"
+	auditResourceOrganization   = "organization"
+	auditResourceUser           = "user"
+	auditResourceAlertRule      = "alert_rule"
+	auditResourceWebhook        = "webhook"
+	auditResourceToken          = "token"
+	auditResourceJob            = "job"
+	auditResourceFeatureFlag    = "feature_flag"
+	auditResourceEmissionFactor = "emission_factor"
+)
+
+// auditRepository builds the audit event of a change to a repository or one of its settings
+func auditRepository(action string, repo *db.Repository, changes db.JSONB) *db.AuditEvent {
+	return &db.AuditEvent{
+		Action:         action,
+		ResourceType:   auditResourceRepository,
+		ResourceID:     repo.ID.String(),
+		OrganizationID: repo.OrganizationID,
+		Changes:        changes,
+	}
+}
+
+// auditOrganization builds the audit event of a change to the settings of an organization
+func auditOrganization(action string, org *db.Organization, changes db.JSONB) *db.AuditEvent {
+	return &db.AuditEvent{
+		Action:         action,
+		ResourceType:   auditResourceOrganization,
+		ResourceID:     org.ID.String(),
+		OrganizationID: &org.ID,
+		Changes:        changes,
+	}
+}
+
+// auditRun builds the audit event of a change to a run; the organization is known when the
+// repository of the run is loaded
+func auditRun(action string, run *db.Run, changes db.JSONB) *db.AuditEvent {
+	event := &db.AuditEvent{
+		Action:       action,
+		ResourceType: auditResourceRun,
+		ResourceID:   run.ID.String(),
+		Changes:      changes,
+	}
+	if run.Repository != nil {
+		event.OrganizationID = run.Repository.OrganizationID
+	}
+	return event
+}
+
+// auditAlertRule builds the audit event of a change to an alert rule
+func auditAlertRule(action string, rule *db.AlertRule, changes db.JSONB) *db.AuditEvent {
+	return &db.AuditEvent{
+		Action:         action,
+		ResourceType:   auditResourceAlertRule,
+		ResourceID:     rule.ID.String(),
+		OrganizationID: rule.OrganizationID,
+		Changes:        changes,
+	}
+}
+
+// auditWebhook builds the audit event of a change to a webhook; the organization of a
+// repository webhook is that of its repository
+func (s *Server) auditWebhook(action string, hook *db.Webhook, changes db.JSONB) *db.AuditEvent {
+	event := &db.AuditEvent{
+		Action:         action,
+		ResourceType:   auditResourceWebhook,
+		ResourceID:     hook.ID.String(),
+		OrganizationID: hook.OrganizationID,
+		Changes:        changes,
+	}
+	if hook.RepositoryID != nil {
+		if repo, err := s.repoService.GetRepositoryByID(*hook.RepositoryID); err == nil {
+			event.OrganizationID = repo.OrganizationID
+		}
+	}
+	return event
+}
+
+// webhookAuditFields returns the audited fields of a webhook. Only the host of the URL is
+// recorded since webhook URLs often embed credentials.
+func webhookAuditFields(hook *db.Webhook) map[string]interface{} {
+	fields := map[string]interface{}{
+		"events": []string(hook.Events),
+	}
+	if parsed, err := url.Parse(hook.URL); err == nil {
+		fields["url_host"] = parsed.Host
+	}
+	if hook.RepositoryID != nil {
+		fields["repository_id"] = hook.RepositoryID.String()
+	}
+	return fields
+}
+
+// auditToken builds the audit event of a change to a session token, identified by its JWT ID
+func auditToken(action string, claims *auth.JWTClaims) *db.AuditEvent {
+	changes := db.JSONB{}
+	if claims.ExpiresAt != nil {
+		changes["expires_at"] = claims.ExpiresAt.Time.UTC()
+	}
+	return &db.AuditEvent{
+		Action:       action,
+		ResourceType: auditResourceToken,
+		ResourceID:   claims.ID,
+		Changes:      changes,
+	}
+}
+
+// auditUser builds the audit event of a change to a user account
+func auditUser(action string, userID uuid.UUID, changes db.JSONB) *db.AuditEvent {
+	return &db.AuditEvent{
+		Action:       action,
+		ResourceType: auditResourceUser,
+		ResourceID:   userID.String(),
+		Changes:      changes,
+	}
+}
+
+// runAuditFields returns the audited fields of a run
+func runAuditFields(run *db.Run) map[string]interface{} {
+	fields := map[string]interface{}{
+		"repository_id": run.RepositoryID.String(),
+		"co2_kg":        run.CO2Kg,
+		"energy_kwh":    run.EnergyKWh,
+		"duration_s":    run.DurationS,
+	}
+	if run.GitCommitSHA != nil {
+		fields["git_commit_sha"] = *run.GitCommitSHA
+	}
+	if run.BranchName != nil {
+		fields["branch_name"] = *run.BranchName
+	}
+	if run.WorkflowName != nil {
+		fields["workflow_name"] = *run.WorkflowName
+	}
+	if run.WorkflowRunGroup != nil {
+		fields["workflow_run_group"] = *run.WorkflowRunGroup
+	}
+	if run.GitTag != nil {
+		fields["git_tag"] = *run.GitTag
+	}
+	if run.Environment != "" {
+		fields["environment"] = run.Environment
+	}
+	return fields
+}
+
+// List audit events handler
+// @Summary List audit events
+// @Description Search the audit log of mutations made through the API, newest first (admin only)
+// @Tags admin
+// @Security CookieAuth
+// @Produce json
+// @Param actor query string false "GitHub username of the actor"
+// @Param action query string false "Action, such as run.delete or budget.set"
+// @Param resource_type query string false "Resource type, such as run, repository, organization or user"
+// @Param resource_id query string false "Resource ID"
+// @Param organization query string false "GitHub organization login"
+// @Param from query string false "Start of the range (RFC3339)"
+// @Param to query string false "End of the range (RFC3339)"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(50)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /admin/audit-events [get]
+func (s *Server) handleAdminListAuditEvents(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+	offset := (page - 1) * limit
+
+	filter := service.AuditFilter{
+		Actor:        c.Query("actor"),
+		Action:       c.Query("action"),
+		ResourceType: c.Query("resource_type"),
+		ResourceID:   c.Query("resource_id"),
+	}
+	for param, bound := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			problem.RespondDetail(c, http.StatusBadRequest, "INVALID_TIME_RANGE", "Invalid time range", "The "+param+" parameter must be an RFC3339 time")
+			return
+		}
+		*bound = &parsed
+	}
+	if login := c.Query("organization"); login != "" {
+		org, err := s.orgService.GetOrganizationByLogin(login)
+		if err != nil {
+			problem.Respond(c, http.StatusNotFound, "ORGANIZATION_NOT_FOUND", "Organization not found")
+			return
+		}
+		filter.OrganizationID = &org.ID
+	}
+
+	events, total, err := s.auditService.ListEvents(filter, limit, offset)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "AUDIT_EVENTS_FETCH_FAILED", "Failed to list audit events")
+		return
+	}
+
+	totalPages := (total + int64(limit) - 1) / int64(limit)
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": events,
+		"pagination": gin.H{
+			"page":     page,
+			"limit":    limit,
+			"total":    total,
+			"pages":    totalPages,
+			"has_next": int64(page) < totalPages,
+			"has_prev": page > 1,
+		},
+	})
+}
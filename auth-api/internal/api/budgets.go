@@ -0,0 +1,231 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// BudgetRequest represents the CO2 limit of a budget period
+type BudgetRequest struct {
+	CO2KgLimit float64 `json:"co2_kg_limit" binding:"required,gt=0"`
+}
+
+// requireBudgetPeriod validates the period path parameter.
+// On failure it writes a 400 response and returns false.
+func requireBudgetPeriod(c *gin.Context) (string, bool) {
+	period := c.Param("period")
+	if !service.IsValidBudgetPeriod(period) {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_BUDGET_PERIOD", "Invalid budget period, must be one of month, quarter")
+		return "", false
+	}
+	return period, true
+}
+
+// List repository budgets handler
+// @Summary List repository budgets
+// @Description Get the CO2 budgets of a repository
+// @Tags budgets
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/budgets [get]
+func (s *Server) handleListBudgets(c *gin.Context) {
+	repo, ok := s.requireVisibleRepository(c)
+	if !ok {
+		return
+	}
+
+	budgets, err := s.budgetService.ListBudgets(repo.ID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "BUDGETS_FETCH_FAILED", "Failed to list budgets")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"budgets": budgets,
+	})
+}
+
+// Set repository budget handler
+// @Summary Set repository budget
+// @Description Create or replace the CO2 budget of a repository for a calendar month or quarter (repository owner only)
+// @Tags budgets
+// @Security CookieAuth
+// @Accept json
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param period path string true "Budget period (month, quarter)"
+// @Param budget body BudgetRequest true "Budget limit"
+// @Success 200 {object} db.RepositoryBudget
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/budgets/{period} [put]
+func (s *Server) handleSetBudget(c *gin.Context) {
+	repo, ok := s.requireRepositoryOwner(c)
+	if !ok {
+		return
+	}
+	period, ok := requireBudgetPeriod(c)
+	if !ok {
+		return
+	}
+
+	var req BudgetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body", err.Error())
+		return
+	}
+
+	before := s.budgetAuditFields(repo.ID)
+	budget, err := s.budgetService.SetBudget(repo.ID, period, req.CO2KgLimit)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "BUDGET_UPDATE_FAILED", "Failed to set budget")
+		return
+	}
+
+	after := s.budgetAuditFields(repo.ID)
+	s.recordAudit(c, auditRepository("budget.set", repo, service.AuditDiff(before, after)))
+
+	c.JSON(http.StatusOK, budget)
+}
+
+// Delete repository budget handler
+// @Summary Delete repository budget
+// @Description Remove the CO2 budget of a repository for a period (repository owner only)
+// @Tags budgets
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param period path string true "Budget period (month, quarter)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/budgets/{period} [delete]
+func (s *Server) handleDeleteBudget(c *gin.Context) {
+	repo, ok := s.requireRepositoryOwner(c)
+	if !ok {
+		return
+	}
+	period, ok := requireBudgetPeriod(c)
+	if !ok {
+		return
+	}
+
+	before := s.budgetAuditFields(repo.ID)
+	if err := s.budgetService.DeleteBudget(repo.ID, period); err != nil {
+		problem.Respond(c, http.StatusNotFound, "BUDGET_NOT_FOUND", "Budget not found")
+		return
+	}
+
+	after := s.budgetAuditFields(repo.ID)
+	s.recordAudit(c, auditRepository("budget.delete", repo, service.AuditDiff(before, after)))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Budget deleted",
+	})
+}
+
+// Repository forecast handler
+// @Summary Get repository CO2 forecast
+// @Description Project end-of-month and end-of-quarter CO2 from the recent weekday run rate, with status against the repository budgets
+// @Tags budgets
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param lookback_days query int false "Run-rate window in days (7-365)" default(28)
+// @Success 200 {object} service.Forecast
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/forecast [get]
+func (s *Server) handleForecast(c *gin.Context) {
+	repo, ok := s.requireVisibleRepository(c)
+	if !ok {
+		return
+	}
+
+	if forecast, ok := s.repositoryForecast(c, repo.ID); ok {
+		c.JSON(http.StatusOK, forecast)
+	}
+}
+
+// Repository budget check handler
+// @Summary Check repository budgets
+// @Description Report whether the repository is within its CO2 budgets for the current month and quarter, so pipelines can fail once a budget is exceeded. The status is the worst of the budgets: exceeded when emissions to date are over a limit, at_risk when the forecast is, else on_track, or no_budget without budgets.
+// @Tags budgets
+// @Security CookieAuth
+// @Security BearerAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param lookback_days query int false "Run-rate window of the forecast in days (7-365)" default(28)
+// @Success 200 {object} service.BudgetCheck
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/budget-check [get]
+func (s *Server) handleBudgetCheck(c *gin.Context) {
+	repo, ok := s.requireVisibleRepository(c)
+	if !ok {
+		return
+	}
+
+	if forecast, ok := s.repositoryForecast(c, repo.ID); ok {
+		c.JSON(http.StatusOK, service.CheckBudgets(forecast))
+	}
+}
+
+// repositoryForecast projects the CO2 of a repository against its budgets, with the
+// lookback_days query parameter. On failure it writes the error response and returns false.
+func (s *Server) repositoryForecast(c *gin.Context, repoID uuid.UUID) (*service.Forecast, bool) {
+	lookbackDays, err := strconv.Atoi(c.DefaultQuery("lookback_days", strconv.Itoa(service.DefaultForecastLookbackDays)))
+	if err != nil || lookbackDays < 7 || lookbackDays > 365 {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_LOOKBACK", "Invalid lookback_days, must be between 7 and 365")
+		return nil, false
+	}
+
+	budgets, err := s.budgetService.ListBudgets(repoID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "BUDGETS_FETCH_FAILED", "Failed to list budgets")
+		return nil, false
+	}
+	limits := make(map[string]float64, len(budgets))
+	for _, budget := range budgets {
+		limits[budget.Period] = budget.CO2KgLimit
+	}
+
+	forecast, err := s.statsService.ForecastCO2(service.RepositoryRuns(repoID), time.Now().UTC(), lookbackDays, limits)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "FORECAST_FAILED", "Failed to compute forecast")
+		return nil, false
+	}
+	return forecast, true
+}
+
+// budgetAuditFields returns the budget limits of a repository keyed by period, such as
+// "month.co2_kg_limit", for the audit log
+func (s *Server) budgetAuditFields(repoID uuid.UUID) map[string]interface{} {
+	fields := map[string]interface{}{}
+	budgets, err := s.budgetService.ListBudgets(repoID)
+	if err != nil {
+		return fields
+	}
+	for _, budget := range budgets {
+		fields[budget.Period+".co2_kg_limit"] = budget.CO2KgLimit
+	}
+	return fields
+}
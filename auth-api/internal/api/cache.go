@@ -0,0 +1,150 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/cache"
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// CacheBypassHeader skips the response cache for a request when set to "true"
+const CacheBypassHeader = "X-Cache-Bypass"
+
+// CacheStatusHeader reports whether a response was served from the cache (HIT, MISS or BYPASS)
+const CacheStatusHeader = "X-Cache"
+
+// cacheRecorder captures the body written by a handler so it can be cached
+type cacheRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+// Write implements io.Writer, copying the body into the recorder
+func (w *cacheRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+// WriteString implements io.StringWriter, copying the body into the recorder
+func (w *cacheRecorder) WriteString(data string) (int, error) {
+	w.body.WriteString(data)
+	return w.ResponseWriter.WriteString(data)
+}
+
+// cached serves successful GET responses of the route from the cache for ttl. Entries are
+// keyed by path, query and viewer, so visibility checks of the handler still apply per
+// user, and belong to the group and scope returned by scope for invalidation. Cache
+// failures are logged and the request is served by the handler.
+func (s *Server) cached(group string, scope func(c *gin.Context) string, ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.cache == nil || ttl <= 0 {
+			c.Next()
+			return
+		}
+		if strings.EqualFold(c.GetHeader(CacheBypassHeader), "true") {
+			c.Header(CacheStatusHeader, "BYPASS")
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		groupScope := scope(c)
+		key := c.Request.URL.Path + "?" + c.Request.URL.Query().Encode()
+		if userID, ok := c.Get("user_id"); ok {
+			key += "#" + userID.(uuid.UUID).String()
+		}
+
+		entry, found, err := s.cache.Get(ctx, group, groupScope, key)
+		if err != nil {
+			log.Printf("Failed to read %s cache: %v", group, err)
+		}
+		if found {
+			c.Header(CacheStatusHeader, "HIT")
+			c.Data(http.StatusOK, entry.ContentType, entry.Body)
+			c.Abort()
+			return
+		}
+
+		c.Header(CacheStatusHeader, "MISS")
+		recorder := &cacheRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		if recorder.Status() != http.StatusOK {
+			return
+		}
+		entry = &cache.Entry{ContentType: recorder.Header().Get("Content-Type"), Body: recorder.body.Bytes()}
+		if err := s.cache.Set(ctx, group, groupScope, key, entry, ttl); err != nil {
+			log.Printf("Failed to write %s cache: %v", group, err)
+		}
+	}
+}
+
+// cacheScopeAll is the scope function of groups that are only invalidated as a whole
+func cacheScopeAll(c *gin.Context) string {
+	return cache.ScopeAll
+}
+
+// cacheScopeRepository scopes cached responses to the repository of the repo_id path parameter
+func cacheScopeRepository(c *gin.Context) string {
+	repoID, err := uuid.Parse(c.Param("repo_id"))
+	if err != nil {
+		return cache.ScopeAll
+	}
+	return cache.RepositoryScope(repoID.String())
+}
+
+// cacheScopeCurrentUser scopes cached responses to the runs of the current user
+func cacheScopeCurrentUser(c *gin.Context) string {
+	userID, ok := c.Get("user_id")
+	if !ok {
+		return cache.ScopeAll
+	}
+	return cache.UserScope(userID.(uuid.UUID).String())
+}
+
+// invalidateCaches drops the cached responses of the given groups and scopes; failures
+// are logged since stale entries expire with their TTL
+func (s *Server) invalidateCaches(ctx context.Context, groups map[string][]string) {
+	if s.cache == nil {
+		return
+	}
+	for group, scopes := range groups {
+		for _, scope := range scopes {
+			if err := s.cache.Invalidate(ctx, group, scope); err != nil {
+				log.Printf("Failed to invalidate cache: %v", err)
+			}
+		}
+	}
+}
+
+// invalidateRunCaches drops the cached responses that include a newly ingested run:
+// repository lists, the leaderboard, and the statistics of its repository and user
+func (s *Server) invalidateRunCaches(ctx context.Context, run *db.Run) {
+	s.invalidateCaches(ctx, map[string][]string{
+		cache.GroupRepositories: {cache.ScopeAll},
+		cache.GroupLeaderboard:  {cache.ScopeAll},
+		cache.GroupStats: {
+			cache.RepositoryScope(run.RepositoryID.String()),
+			cache.UserScope(run.UserID.String()),
+		},
+	})
+}
+
+// invalidateRepositoryCaches drops the cached responses of a repository after its settings
+// or access change
+func (s *Server) invalidateRepositoryCaches(ctx context.Context, repoID uuid.UUID) {
+	s.invalidateCaches(ctx, map[string][]string{
+		cache.GroupRepositories: {cache.ScopeAll},
+		cache.GroupLeaderboard:  {cache.ScopeAll},
+		cache.GroupStats:        {cache.RepositoryScope(repoID.String())},
+	})
+}
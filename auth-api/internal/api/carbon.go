@@ -0,0 +1,224 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ecoci/auth-api/internal/carbon"
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// Bounds of carbon-aware scheduling windows
+const (
+	minWindowDuration = 15 * time.Minute
+	maxWindowHorizon  = 72 * time.Hour
+	maxWindows        = 10
+	maxRegions        = 20
+)
+
+// carbonWindow is a scheduling window with its savings over running right away
+type carbonWindow struct {
+	carbon.Window
+	// SavingsPercent is how much lower the intensity is than in the window starting now,
+	// null when the forecast does not cover now
+	SavingsPercent *float64 `json:"savings_percent"`
+}
+
+// Carbon windows handler
+// @Summary Find low-carbon scheduling windows
+// @Description Find the windows of the next hours with the lowest forecast grid carbon intensity in a region, to schedule non-urgent workflows such as nightly jobs when the grid is greenest. Windows start now or on a forecast point and do not overlap.
+// @Tags carbon
+// @Security CookieAuth
+// @Produce json
+// @Param region query string true "Cloud region (such as westeurope or eu-north-1) or grid zone of the provider"
+// @Param duration query string false "Duration of the workflow, at least 15m" default(1h)
+// @Param horizon query string false "How far ahead windows must end, at most 72h" default(24h)
+// @Param limit query int false "Number of windows, at most 10" default(3)
+// @Success 200 {object} carbonWindowsResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 502 {object} problem.Problem
+// @Router /carbon/windows [get]
+func (s *Server) handleCarbonWindows(c *gin.Context) {
+	region := strings.TrimSpace(c.Query("region"))
+	if region == "" {
+		problem.Respond(c, http.StatusBadRequest, "MISSING_REGION", "Missing region")
+		return
+	}
+
+	horizon, err := time.ParseDuration(c.DefaultQuery("horizon", "24h"))
+	if err != nil || horizon <= 0 || horizon > maxWindowHorizon {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_HORIZON", "Invalid horizon, must be a duration of at most 72h")
+		return
+	}
+	duration, err := time.ParseDuration(c.DefaultQuery("duration", "1h"))
+	if err != nil || duration < minWindowDuration || duration > horizon {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_DURATION", "Invalid duration, must be at least 15m and at most the horizon")
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "3"))
+	if err != nil || limit < 1 || limit > maxWindows {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_LIMIT", "Invalid limit, must be between 1 and 10")
+		return
+	}
+
+	from := time.Now().UTC()
+	until := from.Add(horizon)
+	forecast, err := s.carbonIntensity.Forecast(c.Request.Context(), region, from, until)
+	if errors.Is(err, carbon.ErrUnknownRegion) {
+		problem.Respond(c, http.StatusBadRequest, "UNKNOWN_REGION", "No carbon intensity forecast for region "+region)
+		return
+	}
+	if err != nil {
+		problem.Respond(c, http.StatusBadGateway, "CARBON_INTENSITY_UNAVAILABLE", "Failed to get the carbon intensity forecast")
+		return
+	}
+
+	var now *carbon.Window
+	if intensity, ok := carbon.Average(forecast, from, from.Add(duration)); ok {
+		now = &carbon.Window{Start: from, End: from.Add(duration), Intensity: intensity}
+	}
+	windows := []carbonWindow{}
+	for _, window := range carbon.Windows(forecast, from, until, duration, limit) {
+		result := carbonWindow{Window: window}
+		if now != nil && now.Intensity > 0 {
+			savings := (now.Intensity - window.Intensity) / now.Intensity * 100
+			result.SavingsPercent = &savings
+		}
+		windows = append(windows, result)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"region":   region,
+		"provider": s.carbonIntensity.Name(),
+		"duration": duration.String(),
+		"from":     from,
+		"until":    until,
+		"now":      now,
+		"windows":  windows,
+	})
+}
+
+// parseRegionPrices parses runner prices of the form region=price,region=price
+func parseRegionPrices(value string) (map[string]float64, bool) {
+	prices := map[string]float64{}
+	if strings.TrimSpace(value) == "" {
+		return prices, true
+	}
+	for _, pair := range strings.Split(value, ",") {
+		region, priceStr, found := strings.Cut(pair, "=")
+		region = strings.TrimSpace(region)
+		price, err := strconv.ParseFloat(strings.TrimSpace(priceStr), 64)
+		if !found || region == "" || err != nil || price < 0 {
+			return nil, false
+		}
+		prices[region] = price
+	}
+	return prices, true
+}
+
+// Region recommendation handler
+// @Summary Recommend a runner region for a repository
+// @Description Rank candidate runner regions by the current and forecast grid carbon intensity, or by runner price, and estimate what the repository's typical run of the last 30 days would emit and cost in each. Runs are assumed to need the same energy and time in every region.
+// @Tags carbon
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param regions query string true "Comma-separated candidate cloud regions or grid zones, at most 20"
+// @Param horizon query string false "How far ahead the forecast is averaged, at most 72h" default(24h)
+// @Param optimize query string false "Rank by carbon or cost" default(carbon)
+// @Param prices query string false "Runner prices per minute as region=price pairs, required for every region to optimize cost"
+// @Success 200 {object} regionRecommendationResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 502 {object} problem.Problem
+// @Router /repos/{repo_id}/regions/recommendation [get]
+func (s *Server) handleRegionRecommendation(c *gin.Context) {
+	repo, ok := s.requireVisibleRepository(c)
+	if !ok {
+		return
+	}
+
+	var regions []string
+	seen := map[string]bool{}
+	for _, region := range strings.Split(c.Query("regions"), ",") {
+		region = strings.TrimSpace(region)
+		if region != "" && !seen[region] {
+			seen[region] = true
+			regions = append(regions, region)
+		}
+	}
+	if len(regions) == 0 {
+		problem.Respond(c, http.StatusBadRequest, "MISSING_REGIONS", "Missing regions")
+		return
+	}
+	if len(regions) > maxRegions {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_REGIONS", "Too many regions, at most 20 are compared")
+		return
+	}
+
+	horizon, err := time.ParseDuration(c.DefaultQuery("horizon", "24h"))
+	if err != nil || horizon <= 0 || horizon > maxWindowHorizon {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_HORIZON", "Invalid horizon, must be a duration of at most 72h")
+		return
+	}
+	optimize := c.DefaultQuery("optimize", service.OptimizeCarbon)
+	if optimize != service.OptimizeCarbon && optimize != service.OptimizeCost {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_OPTIMIZE", "Invalid optimize, must be carbon or cost")
+		return
+	}
+	prices, ok := parseRegionPrices(c.Query("prices"))
+	if !ok {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_PRICES", "Invalid prices, expected region=price pairs")
+		return
+	}
+	if optimize == service.OptimizeCost {
+		for _, region := range regions {
+			if _, ok := prices[region]; !ok {
+				problem.Respond(c, http.StatusBadRequest, "MISSING_PRICES", "Missing price for region "+region)
+				return
+			}
+		}
+	}
+
+	now := time.Now().UTC()
+	profile, err := s.statsService.RunProfile(service.RepositoryRuns(repo.ID), now.AddDate(0, 0, -30), now)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "STATS_FETCH_FAILED", "Failed to get the run profile")
+		return
+	}
+
+	// Repositories without runs are compared for runs of an hour
+	duration := time.Duration(profile.DurationS * float64(time.Second))
+	if duration <= 0 {
+		duration = time.Hour
+	}
+	until := now.Add(horizon)
+	forecasts, err := carbon.Forecasts(c.Request.Context(), s.carbonIntensity, regions, now, until, duration)
+	if errors.Is(err, carbon.ErrUnknownRegion) {
+		problem.Respond(c, http.StatusBadRequest, "UNKNOWN_REGION", "No carbon intensity forecast for "+err.Error())
+		return
+	}
+	if err != nil {
+		problem.Respond(c, http.StatusBadGateway, "CARBON_INTENSITY_UNAVAILABLE", "Failed to get the carbon intensity forecast")
+		return
+	}
+
+	estimates := service.RankRegions(profile, forecasts, prices, optimize)
+	c.JSON(http.StatusOK, gin.H{
+		"provider":    s.carbonIntensity.Name(),
+		"optimize":    optimize,
+		"from":        now,
+		"until":       until,
+		"profile":     profile,
+		"recommended": estimates[0].Region,
+		"regions":     estimates,
+	})
+}
@@ -0,0 +1,137 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// CollaboratorAddRequest represents the data needed to share a repository with a user
+type CollaboratorAddRequest struct {
+	GitHubUsername string `json:"github_username" binding:"required"`
+}
+
+// List repository collaborators handler
+// @Summary List repository collaborators
+// @Description Get the users a repository has been shared with
+// @Tags repositories
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/collaborators [get]
+func (s *Server) handleListCollaborators(c *gin.Context) {
+	repo, ok := s.requireVisibleRepository(c)
+	if !ok {
+		return
+	}
+
+	collaborators, err := s.repoService.ListCollaborators(repo.ID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "COLLABORATORS_FETCH_FAILED", "Failed to list collaborators")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"collaborators": collaborators,
+	})
+}
+
+// Add repository collaborator handler
+// @Summary Add repository collaborator
+// @Description Share a repository with another EcoCI user (repository owner only)
+// @Tags repositories
+// @Security CookieAuth
+// @Accept json
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param collaborator body CollaboratorAddRequest true "Collaborator to add"
+// @Success 201 {object} db.RepositoryCollaborator
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/collaborators [post]
+func (s *Server) handleAddCollaborator(c *gin.Context) {
+	repo, ok := s.requireRepositoryOwner(c)
+	if !ok {
+		return
+	}
+
+	var req CollaboratorAddRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body", err.Error())
+		return
+	}
+
+	user, err := s.userService.GetUserByGitHubUsername(req.GitHubUsername)
+	if err != nil {
+		problem.Respond(c, http.StatusNotFound, "USER_NOT_FOUND", "User not found")
+		return
+	}
+
+	collaborator, err := s.repoService.AddCollaborator(repo.ID, user.ID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "COLLABORATOR_CREATION_FAILED", "Failed to add collaborator")
+		return
+	}
+
+	s.invalidateRepositoryCaches(c.Request.Context(), repo.ID)
+	s.recordAudit(c, auditRepository("collaborator.add", repo, service.AuditDiff(nil, map[string]interface{}{
+		"collaborator": user.ID.String(),
+	})))
+
+	if inviter, err := s.userService.GetUserByID(repo.OwnerID); err == nil {
+		s.mailer.SendInvitation(user, inviter, repo)
+	}
+
+	c.JSON(http.StatusCreated, collaborator)
+}
+
+// Remove repository collaborator handler
+// @Summary Remove repository collaborator
+// @Description Revoke a user's access to a repository (repository owner only)
+// @Tags repositories
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param user_id path string true "Collaborator user UUID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/collaborators/{user_id} [delete]
+func (s *Server) handleRemoveCollaborator(c *gin.Context) {
+	repo, ok := s.requireRepositoryOwner(c)
+	if !ok {
+		return
+	}
+
+	collaboratorID, err := uuid.Parse(c.Param("user_id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_USER_ID", "Invalid user ID")
+		return
+	}
+
+	if err := s.repoService.RemoveCollaborator(repo.ID, collaboratorID); err != nil {
+		problem.Respond(c, http.StatusNotFound, "COLLABORATOR_NOT_FOUND", "Collaborator not found")
+		return
+	}
+
+	s.invalidateRepositoryCaches(c.Request.Context(), repo.ID)
+	s.recordAudit(c, auditRepository("collaborator.remove", repo, service.AuditDiff(map[string]interface{}{
+		"collaborator": collaboratorID.String(),
+	}, nil)))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Collaborator removed",
+	})
+}
@@ -0,0 +1,192 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// List run comments handler
+// @Summary List run comments
+// @Description Get the comments on a run, oldest first, with their replies nested under them
+// @Tags comments
+// @Security CookieAuth
+// @Produce json
+// @Param run_id path string true "Run UUID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /runs/{run_id}/comments [get]
+func (s *Server) handleListRunComments(c *gin.Context) {
+	run, ok := s.requireVisibleRun(c)
+	if !ok {
+		return
+	}
+
+	comments, err := s.commentService.ListComments(run)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "COMMENTS_FETCH_FAILED", "Failed to list comments")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"comments": comments,
+	})
+}
+
+// Create run comment handler
+// @Summary Comment on run
+// @Description Annotate a run, such as a regression, with a comment, or reply to a top-level comment of the run with parent_id
+// @Tags comments
+// @Security CookieAuth
+// @Accept json
+// @Produce json
+// @Param run_id path string true "Run UUID"
+// @Param comment body service.CommentRequest true "Comment"
+// @Success 201 {object} service.Comment
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /runs/{run_id}/comments [post]
+func (s *Server) handleCreateRunComment(c *gin.Context) {
+	run, ok := s.requireVisibleRun(c)
+	if !ok {
+		return
+	}
+	userID, _ := currentUserID(c)
+
+	var req service.CommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body", err.Error())
+		return
+	}
+	if err := service.ValidateComment(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "VALIDATION_FAILED", "Invalid comment", err.Error())
+		return
+	}
+
+	comment, err := s.commentService.CreateComment(run, userID, &req)
+	if errors.Is(err, service.ErrInvalidCommentParent) {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_COMMENT_PARENT", "Invalid parent comment", err.Error())
+		return
+	}
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "COMMENT_CREATION_FAILED", "Failed to create comment")
+		return
+	}
+
+	s.recordAudit(c, auditRun("run_comment.create", run, service.AuditDiff(nil, commentAuditFields(comment.ID, comment.ParentID, comment.Body))))
+
+	c.JSON(http.StatusCreated, comment)
+}
+
+// Delete run comment handler
+// @Summary Delete run comment
+// @Description Remove a comment on a run with its replies (comment author or repository owner only)
+// @Tags comments
+// @Security CookieAuth
+// @Produce json
+// @Param run_id path string true "Run UUID"
+// @Param comment_id path string true "Comment UUID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /runs/{run_id}/comments/{comment_id} [delete]
+func (s *Server) handleDeleteRunComment(c *gin.Context) {
+	run, ok := s.requireVisibleRun(c)
+	if !ok {
+		return
+	}
+	userID, _ := currentUserID(c)
+
+	commentID, err := uuid.Parse(c.Param("comment_id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_COMMENT_ID", "Invalid comment ID")
+		return
+	}
+
+	comment, err := s.commentService.GetComment(run.ID, commentID)
+	if errors.Is(err, service.ErrCommentNotFound) {
+		problem.Respond(c, http.StatusNotFound, "COMMENT_NOT_FOUND", "Comment not found")
+		return
+	}
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "COMMENT_FETCH_FAILED", "Failed to get comment")
+		return
+	}
+	if comment.AuthorID != userID && (run.Repository == nil || run.Repository.OwnerID != userID) {
+		problem.Respond(c, http.StatusForbidden, "NOT_COMMENT_AUTHOR", "Only the comment author or repository owner can delete this comment")
+		return
+	}
+
+	if err := s.commentService.DeleteComment(comment); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "COMMENT_DELETION_FAILED", "Failed to delete comment")
+		return
+	}
+
+	s.recordAudit(c, auditRun("run_comment.delete", run, service.AuditDiff(commentAuditFields(comment.ID, comment.ParentID, comment.Body), nil)))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Comment deleted",
+	})
+}
+
+// List repository comments handler
+// @Summary List repository comments
+// @Description Get the comments on the runs of a repository created over a time range, in the order of their runs, with the run_created_at to place them on charts of the data
+// @Tags comments
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/comments [get]
+func (s *Server) handleListRepositoryComments(c *gin.Context) {
+	repo, ok := s.requireVisibleRepository(c)
+	if !ok {
+		return
+	}
+	from, to, ok := parseTimeRange(c, func(to time.Time) time.Time {
+		return to.AddDate(0, 0, -30)
+	})
+	if !ok {
+		return
+	}
+
+	comments, err := s.commentService.RepositoryComments(repo.ID, from, to)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "COMMENTS_FETCH_FAILED", "Failed to list comments")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":     from,
+		"to":       to,
+		"comments": comments,
+	})
+}
+
+// commentAuditFields returns the fields of a comment recorded in the audit log
+func commentAuditFields(id uuid.UUID, parentID *uuid.UUID, body string) map[string]interface{} {
+	fields := map[string]interface{}{
+		"comment_id": id.String(),
+		"body":       body,
+	}
+	if parentID != nil {
+		fields["parent_id"] = parentID.String()
+	}
+	return fields
+}
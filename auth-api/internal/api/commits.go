@@ -0,0 +1,111 @@
+package api
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// commitSHAPattern matches a full 40 character git commit SHA
+var commitSHAPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// Commit statistics handler
+// @Summary Get commit statistics
+// @Description Aggregate all runs of a repository for a commit SHA
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param sha path string true "Full 40 character commit SHA"
+// @Success 200 {object} service.CommitStats
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/commits/{sha}/stats [get]
+func (s *Server) handleCommitStats(c *gin.Context) {
+	repo, ok := s.requireVisibleRepository(c)
+	if !ok {
+		return
+	}
+
+	sha := strings.ToLower(c.Param("sha"))
+	if !commitSHAPattern.MatchString(sha) {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_COMMIT_SHA", "Invalid commit SHA, expected 40 hexadecimal characters")
+		return
+	}
+
+	stats, err := s.statsService.CommitStats(repo.ID, sha)
+	if err != nil {
+		if err.Error() == "commit not found" {
+			problem.Respond(c, http.StatusNotFound, "COMMIT_NOT_FOUND", "No runs found for commit")
+			return
+		}
+		problem.Respond(c, http.StatusInternalServerError, "STATS_FETCH_FAILED", "Failed to fetch commit statistics")
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// Commit series handler
+// @Summary Get commit-ordered statistics
+// @Description Get per-commit aggregates of a repository ordered by when each commit was first measured, with deltas against the preceding commit
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param branch query string false "Only include runs of this branch"
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD), defaults to 90 days before to"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Param limit query int false "Maximum number of most recent commits (max 500)" default(50)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/commits [get]
+func (s *Server) handleCommitSeries(c *gin.Context) {
+	repo, ok := s.requireVisibleRepository(c)
+	if !ok {
+		return
+	}
+
+	from, to, ok := parseTimeRange(c, func(to time.Time) time.Time {
+		return to.AddDate(0, 0, -90)
+	})
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit < 1 || limit > service.MaxCommitSeriesLength {
+		limit = 50
+	}
+
+	q := service.CommitSeriesQuery{
+		From:  from,
+		To:    to,
+		Limit: limit,
+	}
+	if branch := c.Query("branch"); branch != "" {
+		q.Branch = &branch
+	}
+
+	commits, err := s.statsService.CommitSeries(repo.ID, q)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "STATS_FETCH_FAILED", "Failed to fetch commit series")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":    from,
+		"to":      to,
+		"commits": commits,
+	})
+}
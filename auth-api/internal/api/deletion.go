@@ -0,0 +1,193 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/cache"
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// restoreError responds to a failed restore of a deleted record of the given kind, such
+// as "run" or "repository"
+func restoreError(c *gin.Context, err error, kind, notFoundCode string) {
+	switch err.Error() {
+	case "deleted " + kind + " not found":
+		problem.Respond(c, http.StatusNotFound, notFoundCode, "Deleted "+kind+" not found")
+	case "restore window has expired":
+		problem.Respond(c, http.StatusGone, "RESTORE_WINDOW_EXPIRED", "Restore window has expired")
+	case "repository is deleted":
+		problem.Respond(c, http.StatusConflict, "REPOSITORY_DELETED", "Repository of the run is deleted; restore the repository instead")
+	case "repository already exists":
+		problem.Respond(c, http.StatusConflict, "REPOSITORY_EXISTS", "A repository with the same name was created after the deletion")
+	default:
+		problem.Respond(c, http.StatusInternalServerError, "RESTORE_FAILED", "Failed to restore")
+	}
+}
+
+// parseRunID parses the run_id path parameter
+func parseRunID(c *gin.Context) (uuid.UUID, bool) {
+	runID, err := uuid.Parse(c.Param("run_id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_RUN_ID", "Invalid run ID")
+		return uuid.Nil, false
+	}
+	return runID, true
+}
+
+// Delete run handler
+// @Summary Delete run
+// @Description Delete a run submitted by the current user. The run is excluded from all statistics at once and can be restored within the restore window.
+// @Tags runs
+// @Security CookieAuth
+// @Produce json
+// @Param run_id path string true "Run UUID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /runs/{run_id} [delete]
+func (s *Server) handleDeleteRun(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	runID, ok := parseRunID(c)
+	if !ok {
+		return
+	}
+
+	run, err := s.runService.GetRunByID(runID)
+	if err != nil || run.UserID != userID {
+		problem.Respond(c, http.StatusNotFound, "RUN_NOT_FOUND", "Run not found")
+		return
+	}
+
+	if err := s.runService.DeleteRun(run.ID, userID); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "RUN_DELETION_FAILED", "Failed to delete run")
+		return
+	}
+
+	s.invalidateRunCaches(c.Request.Context(), run)
+	s.recordAudit(c, auditRun("run.delete", run, service.AuditDiff(runAuditFields(run), nil)))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Run deleted",
+		"restorable_until": time.Now().UTC().Add(s.cfg.RestoreWindow),
+	})
+}
+
+// Restore run handler
+// @Summary Restore run
+// @Description Restore a run the current user deleted within the restore window. Runs deleted along with their repository are restored with the repository.
+// @Tags runs
+// @Security CookieAuth
+// @Produce json
+// @Param run_id path string true "Run UUID"
+// @Success 200 {object} db.Run
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Failure 410 {object} problem.Problem
+// @Router /runs/{run_id}/restore [post]
+func (s *Server) handleRestoreRun(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	runID, ok := parseRunID(c)
+	if !ok {
+		return
+	}
+
+	run, err := s.runService.RestoreRun(runID, userID, time.Now().Add(-s.cfg.RestoreWindow))
+	if err != nil {
+		restoreError(c, err, "run", "RUN_NOT_FOUND")
+		return
+	}
+
+	s.invalidateRunCaches(c.Request.Context(), run)
+	s.recordAudit(c, auditRun("run.restore", run, nil))
+
+	c.JSON(http.StatusOK, run)
+}
+
+// Delete repository handler
+// @Summary Delete repository
+// @Description Delete a repository with its runs (owner only). The repository can be restored within the restore window; submitting a run for the same repository meanwhile creates a new one.
+// @Tags repositories
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id} [delete]
+func (s *Server) handleDeleteRepository(c *gin.Context) {
+	repo, ok := s.requireRepositoryOwner(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now().UTC()
+	if err := s.repoService.DeleteRepository(repo.ID, now); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "REPOSITORY_DELETION_FAILED", "Failed to delete repository")
+		return
+	}
+
+	s.invalidateRepositoryCaches(c.Request.Context(), repo.ID)
+	s.recordAudit(c, auditRepository("repository.delete", repo, nil))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Repository deleted",
+		"restorable_until": now.Add(s.cfg.RestoreWindow),
+	})
+}
+
+// Restore repository handler
+// @Summary Restore repository
+// @Description Restore a repository the current user deleted within the restore window, together with the runs deleted along with it
+// @Tags repositories
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Success 200 {object} db.Repository
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Failure 410 {object} problem.Problem
+// @Router /repos/{repo_id}/restore [post]
+func (s *Server) handleRestoreRepository(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	repoID, err := uuid.Parse(c.Param("repo_id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_REPOSITORY_ID", "Invalid repository ID")
+		return
+	}
+
+	repo, err := s.repoService.RestoreRepository(repoID, userID, time.Now().Add(-s.cfg.RestoreWindow))
+	if err != nil {
+		restoreError(c, err, "repository", "REPOSITORY_NOT_FOUND")
+		return
+	}
+
+	s.invalidateCaches(c.Request.Context(), map[string][]string{
+		cache.GroupRepositories: {cache.ScopeAll},
+		cache.GroupLeaderboard:  {cache.ScopeAll},
+		cache.GroupStats:        {cache.RepositoryScope(repo.ID.String()), cache.UserScope(userID.String())},
+	})
+	s.recordAudit(c, auditRepository("repository.restore", repo, nil))
+
+	c.JSON(http.StatusOK, repo)
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// Get email preferences handler
+// @Summary Get email preferences
+// @Description Get which optional emails (invitations, alerts, reports) the current user receives. Account notices are always sent.
+// @Tags users
+// @Security CookieAuth
+// @Produce json
+// @Success 200 {object} service.EmailPreferences
+// @Failure 401 {object} problem.Problem
+// @Router /me/email-preferences [get]
+func (s *Server) handleGetEmailPreferences(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	user, err := s.userService.GetUserByID(userID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "USER_FETCH_FAILED", "Failed to get user information")
+		return
+	}
+
+	c.JSON(http.StatusOK, s.userService.GetEmailPreferences(user))
+}
+
+// Update email preferences handler
+// @Summary Update email preferences
+// @Description Opt in to or out of optional email categories; omitted categories are unchanged
+// @Tags users
+// @Security CookieAuth
+// @Accept json
+// @Produce json
+// @Param preferences body service.EmailPreferencesRequest true "Categories to change"
+// @Success 200 {object} service.EmailPreferences
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Router /me/email-preferences [patch]
+func (s *Server) handleUpdateEmailPreferences(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req service.EmailPreferencesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body", err.Error())
+		return
+	}
+
+	var before map[string]interface{}
+	if user, err := s.userService.GetUserByID(userID); err == nil {
+		before = emailPreferencesAuditFields(s.userService.GetEmailPreferences(user))
+	}
+
+	preferences, err := s.userService.UpdateEmailPreferences(userID, &req)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "EMAIL_PREFERENCES_UPDATE_FAILED", "Failed to update email preferences")
+		return
+	}
+
+	s.recordAudit(c, auditUser("email_preferences.update", userID, service.AuditDiff(before, emailPreferencesAuditFields(preferences))))
+
+	c.JSON(http.StatusOK, preferences)
+}
+
+// emailPreferencesAuditFields returns the audited email categories of a user
+func emailPreferencesAuditFields(preferences *service.EmailPreferences) map[string]interface{} {
+	return map[string]interface{}{
+		"invitations": preferences.Invitations,
+		"alerts":      preferences.Alerts,
+		"reports":     preferences.Reports,
+	}
+}
@@ -0,0 +1,336 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// Resolve emission factor handler
+// @Summary Get the emission factor of a region
+// @Description Get the grid carbon intensity of a cloud region on a day with its source, methodology and effective period, so the CO2 of runs can be traced back to it. Regions without a managed factor get the built-in factor.
+// @Tags carbon
+// @Security CookieAuth
+// @Produce json
+// @Param region path string true "Cloud region, such as westeurope or eu-west-1"
+// @Param at query string false "Day (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Success 200 {object} service.ResolvedEmissionFactor
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Router /emission-factors/{region} [get]
+func (s *Server) handleResolveEmissionFactor(c *gin.Context) {
+	at := time.Now().UTC()
+	if raw := c.Query("at"); raw != "" {
+		parsed, err := parseTimeSeriesTime(raw)
+		if err != nil {
+			problem.Respond(c, http.StatusBadRequest, "INVALID_TIME", "Invalid at, expected RFC3339 or YYYY-MM-DD")
+			return
+		}
+		at = parsed
+	}
+
+	factor, err := s.factorService.ResolveFactor(c.Param("region"), at)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "EMISSION_FACTOR_FETCH_FAILED", "Failed to get emission factor")
+		return
+	}
+
+	c.JSON(http.StatusOK, factor)
+}
+
+// List emission factors handler
+// @Summary List emission factors
+// @Description Get the managed emission factors with their provenance, by region and most recent first (admin only)
+// @Tags admin
+// @Security CookieAuth
+// @Produce json
+// @Param region query string false "Only the factors of this region"
+// @Success 200 {object} emissionFactorsResponse
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Router /admin/emission-factors [get]
+func (s *Server) handleListEmissionFactors(c *gin.Context) {
+	factors, err := s.factorService.ListFactors(c.Query("region"))
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "EMISSION_FACTORS_FETCH_FAILED", "Failed to list emission factors")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"factors": factors,
+	})
+}
+
+// Create emission factor handler
+// @Summary Create emission factor
+// @Description Record the grid carbon intensity of a region from a date, with its source and methodology (admin only). The effective periods of the factors of a region must not overlap.
+// @Tags admin
+// @Security CookieAuth
+// @Accept json
+// @Produce json
+// @Param factor body service.EmissionFactorRequest true "Emission factor"
+// @Success 201 {object} db.EmissionFactor
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Router /admin/emission-factors [post]
+func (s *Server) handleCreateEmissionFactor(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	req, ok := bindEmissionFactor(c)
+	if !ok {
+		return
+	}
+
+	factor, err := s.factorService.CreateFactor(userID, req)
+	if err != nil {
+		respondEmissionFactorError(c, err, "EMISSION_FACTOR_CREATION_FAILED", "Failed to create emission factor")
+		return
+	}
+
+	s.recordAudit(c, auditEmissionFactor("emission_factor.create", factor, service.AuditDiff(nil, emissionFactorAuditFields(factor))))
+
+	c.JSON(http.StatusCreated, factor)
+}
+
+// Get emission factor handler
+// @Summary Get emission factor
+// @Description Get a managed emission factor with its provenance (admin only)
+// @Tags admin
+// @Security CookieAuth
+// @Produce json
+// @Param factor_id path string true "Emission factor UUID"
+// @Success 200 {object} db.EmissionFactor
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /admin/emission-factors/{factor_id} [get]
+func (s *Server) handleGetEmissionFactor(c *gin.Context) {
+	factor, ok := s.requireEmissionFactor(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, factor)
+}
+
+// Update emission factor handler
+// @Summary Update emission factor
+// @Description Replace a managed emission factor with its next version (admin only). Previous versions are kept, and the change is recorded in the audit log.
+// @Tags admin
+// @Security CookieAuth
+// @Accept json
+// @Produce json
+// @Param factor_id path string true "Emission factor UUID"
+// @Param factor body service.EmissionFactorRequest true "Emission factor"
+// @Success 200 {object} db.EmissionFactor
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Router /admin/emission-factors/{factor_id} [put]
+func (s *Server) handleUpdateEmissionFactor(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	factor, ok := s.requireEmissionFactor(c)
+	if !ok {
+		return
+	}
+	req, ok := bindEmissionFactor(c)
+	if !ok {
+		return
+	}
+
+	before := emissionFactorAuditFields(factor)
+	updated, err := s.factorService.UpdateFactor(factor, userID, req)
+	if err != nil {
+		respondEmissionFactorError(c, err, "EMISSION_FACTOR_UPDATE_FAILED", "Failed to update emission factor")
+		return
+	}
+
+	s.recordAudit(c, auditEmissionFactor("emission_factor.update", updated, service.AuditDiff(before, emissionFactorAuditFields(updated))))
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// Delete emission factor handler
+// @Summary Delete emission factor
+// @Description Remove a managed emission factor; the days it covered fall back to the built-in factor of the region. Its versions are kept. (admin only)
+// @Tags admin
+// @Security CookieAuth
+// @Produce json
+// @Param factor_id path string true "Emission factor UUID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /admin/emission-factors/{factor_id} [delete]
+func (s *Server) handleDeleteEmissionFactor(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	factor, ok := s.requireEmissionFactor(c)
+	if !ok {
+		return
+	}
+
+	if err := s.factorService.DeleteFactor(factor, userID); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "EMISSION_FACTOR_DELETION_FAILED", "Failed to delete emission factor")
+		return
+	}
+
+	s.recordAudit(c, auditEmissionFactor("emission_factor.delete", factor, service.AuditDiff(emissionFactorAuditFields(factor), nil)))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Emission factor deleted",
+	})
+}
+
+// List emission factor versions handler
+// @Summary List emission factor versions
+// @Description Get every version of an emission factor, including the deletion of a deleted factor, most recent first (admin only)
+// @Tags admin
+// @Security CookieAuth
+// @Produce json
+// @Param factor_id path string true "Emission factor UUID"
+// @Success 200 {object} emissionFactorVersionsResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /admin/emission-factors/{factor_id}/versions [get]
+func (s *Server) handleListEmissionFactorVersions(c *gin.Context) {
+	factorID, err := uuid.Parse(c.Param("factor_id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_EMISSION_FACTOR_ID", "Invalid emission factor ID")
+		return
+	}
+
+	versions, err := s.factorService.ListVersions(factorID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "EMISSION_FACTOR_VERSIONS_FETCH_FAILED", "Failed to list emission factor versions")
+		return
+	}
+	if len(versions) == 0 {
+		problem.Respond(c, http.StatusNotFound, "EMISSION_FACTOR_NOT_FOUND", "Emission factor not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"versions": versions,
+	})
+}
+
+// List recalculation reports handler
+// @Summary List recalculation reports
+// @Description Get what the recalculations of the current-methodology CO2 of runs changed, newest first (admin only)
+// @Tags admin
+// @Security CookieAuth
+// @Produce json
+// @Param limit query int false "Number of reports" default(30)
+// @Success 200 {object} recalculationReportsResponse
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Router /admin/recalculation-reports [get]
+func (s *Server) handleListRecalculationReports(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "30"))
+	if limit < 1 || limit > 100 {
+		limit = 30
+	}
+
+	reports, err := s.factorService.ListRecalculationReports(limit)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "RECALCULATION_REPORTS_FETCH_FAILED", "Failed to list recalculation reports")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reports": reports,
+	})
+}
+
+// requireEmissionFactor resolves the factor_id path parameter to a managed emission factor
+func (s *Server) requireEmissionFactor(c *gin.Context) (*db.EmissionFactor, bool) {
+	factorID, err := uuid.Parse(c.Param("factor_id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_EMISSION_FACTOR_ID", "Invalid emission factor ID")
+		return nil, false
+	}
+
+	factor, err := s.factorService.GetFactor(factorID)
+	if err != nil {
+		problem.Respond(c, http.StatusNotFound, "EMISSION_FACTOR_NOT_FOUND", "Emission factor not found")
+		return nil, false
+	}
+	return factor, true
+}
+
+// bindEmissionFactor binds and validates the emission factor of the request body
+func bindEmissionFactor(c *gin.Context) (*service.EmissionFactorRequest, bool) {
+	var req service.EmissionFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body", err.Error())
+		return nil, false
+	}
+	if err := service.ValidateEmissionFactor(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_EMISSION_FACTOR", "Invalid emission factor", err.Error())
+		return nil, false
+	}
+	return &req, true
+}
+
+// respondEmissionFactorError writes the response of a failed write of an emission factor
+func respondEmissionFactorError(c *gin.Context, err error, code, message string) {
+	if errors.Is(err, service.ErrEmissionFactorOverlap) {
+		problem.RespondDetail(c, http.StatusConflict, "EMISSION_FACTOR_OVERLAP", "Emission factor overlaps another factor of the region", err.Error())
+		return
+	}
+	problem.Respond(c, http.StatusInternalServerError, code, message)
+}
+
+// auditEmissionFactor builds the audit event of a change to an emission factor
+func auditEmissionFactor(action string, factor *db.EmissionFactor, changes db.JSONB) *db.AuditEvent {
+	return &db.AuditEvent{
+		Action:       action,
+		ResourceType: auditResourceEmissionFactor,
+		ResourceID:   factor.ID.String(),
+		Changes:      changes,
+	}
+}
+
+// emissionFactorAuditFields returns the audited state of an emission factor
+func emissionFactorAuditFields(factor *db.EmissionFactor) map[string]interface{} {
+	fields := map[string]interface{}{
+		"region":             factor.Region,
+		"grams_co2e_per_kwh": factor.GramsPerKWh,
+		"source":             factor.Source,
+		"source_url":         nil,
+		"methodology":        factor.Methodology,
+		"effective_from":     factor.EffectiveFrom.Format(timeSeriesDateLayout),
+		"effective_to":       nil,
+	}
+	if factor.SourceURL != nil {
+		fields["source_url"] = *factor.SourceURL
+	}
+	if factor.EffectiveTo != nil {
+		fields["effective_to"] = factor.EffectiveTo.Format(timeSeriesDateLayout)
+	}
+	return fields
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// respondEnvironmentStats aggregates the runs in scope over the requested range by environment
+// and writes the result
+func (s *Server) respondEnvironmentStats(c *gin.Context, scope service.RunScope) {
+	from, to, ok := parseTimeRange(c, func(to time.Time) time.Time {
+		return to.AddDate(0, 0, -30)
+	})
+	if !ok {
+		return
+	}
+
+	environments, err := s.statsService.EnvironmentStats(scope, from, to)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "STATS_FETCH_FAILED", "Failed to fetch environment statistics")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":         from,
+		"to":           to,
+		"environments": environments,
+	})
+}
+
+// Repository environment statistics handler
+// @Summary Get repository environment statistics
+// @Description Get the runs of a repository over a time range by environment (ci, staging, production-deploy), with the runs, CO2, energy and duration of each and its share of the CO2, separating deployment from test pipelines
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Success 200 {object} environmentStatsResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/environments [get]
+func (s *Server) handleRepositoryEnvironmentStats(c *gin.Context) {
+	repo, ok := s.requireVisibleRepository(c)
+	if !ok {
+		return
+	}
+
+	s.respondEnvironmentStats(c, service.RepositoryRuns(repo.ID))
+}
+
+// User environment statistics handler
+// @Summary Get current user environment statistics
+// @Description Get the current user's runs over a time range by environment (ci, staging, production-deploy), with the runs, CO2, energy and duration of each and its share of the CO2, separating deployment from test pipelines
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Success 200 {object} environmentStatsResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Router /me/environments [get]
+func (s *Server) handleUserEnvironmentStats(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	s.respondEnvironmentStats(c, service.UserRuns(userID))
+}
+
+// Organization environment statistics handler
+// @Summary Get organization environment statistics
+// @Description Get the runs of an organization over a time range by environment (ci, staging, production-deploy), with the runs, CO2, energy and duration of each and its share of the CO2, separating deployment from test pipelines (members only)
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param org path string true "GitHub organization login"
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Success 200 {object} environmentStatsResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /orgs/{org}/environments [get]
+func (s *Server) handleOrganizationEnvironmentStats(c *gin.Context) {
+	org, ok := s.requireOrganizationMember(c)
+	if !ok {
+		return
+	}
+
+	s.respondEnvironmentStats(c, service.OrganizationRuns(org.ID))
+}
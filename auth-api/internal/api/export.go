@@ -0,0 +1,112 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ecoci/auth-api/internal/export"
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// respondXLSX renders the report workbook for scope directly into the response
+func (s *Server) respondXLSX(c *gin.Context, scope service.RunScope, name string) {
+	from, to, ok := parseTimeRange(c, func(to time.Time) time.Time {
+		return to.AddDate(-1, 0, 0)
+	})
+	if !ok {
+		return
+	}
+
+	filename := fmt.Sprintf("ecoci-%s-%s-%s.xlsx",
+		strings.ReplaceAll(name, "/", "-"), from.Format("20060102"), to.Format("20060102"))
+	c.Header("Content-Type", export.ContentTypeXLSX)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	// The workbook is assembled before the first byte is written, so failures can
+	// still be reported as a regular error response
+	if err := export.WriteXLSX(c.Writer, s.statsService, scope, from, to); err != nil {
+		c.Writer.Header().Del("Content-Disposition")
+		problem.Respond(c, http.StatusInternalServerError, "EXPORT_FAILED", "Failed to generate export")
+	}
+}
+
+// Repository XLSX export handler
+// @Summary Export repository report as XLSX
+// @Description Download an Excel workbook with the raw runs, monthly aggregates and per-workflow breakdown of a repository
+// @Tags export
+// @Security CookieAuth
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Param repo_id path string true "Repository UUID"
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD), defaults to one year before to"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Success 200 {file} file
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/export.xlsx [get]
+func (s *Server) handleRepositoryExportXLSX(c *gin.Context) {
+	repo, ok := s.requireVisibleRepository(c)
+	if !ok {
+		return
+	}
+
+	s.respondXLSX(c, service.RepositoryRuns(repo.ID), repo.FullName)
+}
+
+// Organization XLSX export handler
+// @Summary Export organization report as XLSX
+// @Description Download an Excel workbook with the raw runs, monthly aggregates and per-workflow breakdown of an organization (members only)
+// @Tags export
+// @Security CookieAuth
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Param org path string true "GitHub organization login"
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD), defaults to one year before to"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Success 200 {file} file
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /orgs/{org}/export.xlsx [get]
+func (s *Server) handleOrganizationExportXLSX(c *gin.Context) {
+	org, ok := s.requireOrganizationMember(c)
+	if !ok {
+		return
+	}
+
+	s.respondXLSX(c, service.OrganizationRuns(org.ID), org.GitHubLogin)
+}
+
+// Repository carbon history export handler
+// @Summary Export repository carbon history
+// @Description Download the versioned JSON manifest of every run of a repository, with its measurements and metadata, to import into another EcoCI instance with POST /imports/ecoci or into other tools. Runs deleted by the retention policy are not included.
+// @Tags export
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Success 200 {object} export.Manifest
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/export.json [get]
+func (s *Server) handleRepositoryExportManifest(c *gin.Context) {
+	repo, ok := s.requireVisibleRepository(c)
+	if !ok {
+		return
+	}
+
+	var manifest bytes.Buffer
+	now := time.Now().UTC()
+	if err := export.WriteManifest(&manifest, s.statsService, repo, s.cfg.AppURL, now); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "EXPORT_FAILED", "Failed to generate export")
+		return
+	}
+
+	filename := fmt.Sprintf("ecoci-%s-%s.json", strings.ReplaceAll(repo.FullName, "/", "-"), now.Format("20060102"))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Data(http.StatusOK, "application/json", manifest.Bytes())
+}
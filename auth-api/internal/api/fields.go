@@ -0,0 +1,156 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ecoci/auth-api/internal/problem"
+)
+
+// fieldSet is the sparse fieldset of a list response: the members of its items a client asked
+// for with ?fields=, and the relations to embed it asked for with ?include=
+type fieldSet struct {
+	// fields are the members to keep, every member when nil
+	fields map[string]bool
+	// include are the relations to embed
+	include map[string]bool
+	// relations are every relation of the items, removed unless included
+	relations map[string]bool
+}
+
+// parseFieldSet parses ?fields= and ?include= for items like model. The relations of model
+// are its members with a foreign key; those in supported can be included, and without
+// ?include= those in defaults are, as before the parameter existed. An empty ?include=
+// embeds none. Unknown names are rejected with 400.
+func parseFieldSet(c *gin.Context, model interface{}, supported, defaults []string) (*fieldSet, bool) {
+	members, relations := jsonMembers(reflect.TypeOf(model))
+	set := &fieldSet{include: map[string]bool{}, relations: map[string]bool{}}
+	for _, relation := range relations {
+		set.relations[relation] = true
+	}
+
+	if raw, ok := c.GetQuery("fields"); ok {
+		set.fields = map[string]bool{}
+		for _, name := range splitNames(raw) {
+			if !contains(members, name) {
+				problem.RespondDetail(c, http.StatusBadRequest, "INVALID_FIELDS", "Invalid fields parameter",
+					"Unknown field "+name+"; fields are "+strings.Join(members, ", "))
+				return nil, false
+			}
+			set.fields[name] = true
+		}
+	}
+
+	include := defaults
+	if raw, ok := c.GetQuery("include"); ok {
+		include = splitNames(raw)
+	}
+	for _, name := range include {
+		if !contains(supported, name) {
+			problem.RespondDetail(c, http.StatusBadRequest, "INVALID_INCLUDE", "Invalid include parameter",
+				"Unknown relation "+name+"; relations are "+strings.Join(supported, ", "))
+			return nil, false
+		}
+		set.include[name] = true
+	}
+	return set, true
+}
+
+// names returns the members asked for, sorted, or nil for every member
+func (f *fieldSet) names() []string {
+	if f.fields == nil {
+		return nil
+	}
+	names := make([]string, 0, len(f.fields))
+	for name := range f.fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// includes reports whether relation is embedded
+func (f *fieldSet) includes(relation string) bool {
+	return f.include[relation]
+}
+
+// apply returns the JSON objects of items with only the members asked for and the included
+// relations
+func (f *fieldSet) apply(items interface{}) ([]map[string]json.RawMessage, error) {
+	encoded, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+	objects := []map[string]json.RawMessage{}
+	if err := json.Unmarshal(encoded, &objects); err != nil {
+		return nil, err
+	}
+	for _, object := range objects {
+		for name := range object {
+			if f.relations[name] {
+				if !f.include[name] {
+					delete(object, name)
+				}
+			} else if f.fields != nil && !f.fields[name] {
+				delete(object, name)
+			}
+		}
+	}
+	return objects, nil
+}
+
+// jsonMembers returns the JSON names of the members of a struct, including those of embedded
+// structs, and separately those of its relations
+func jsonMembers(t reflect.Type) (members, relations []string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.Anonymous && name == "" {
+			embedded, embeddedRelations := jsonMembers(field.Type)
+			members = append(members, embedded...)
+			relations = append(relations, embeddedRelations...)
+			continue
+		}
+		if name == "-" || !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if strings.Contains(field.Tag.Get("gorm"), "foreignKey") {
+			relations = append(relations, name)
+		} else {
+			members = append(members, name)
+		}
+	}
+	return members, relations
+}
+
+// splitNames splits a comma-separated parameter, ignoring blanks
+func splitNames(raw string) []string {
+	names := []string{}
+	for _, name := range strings.Split(raw, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// contains reports whether names contains name
+func contains(names []string, name string) bool {
+	for _, candidate := range names {
+		if candidate == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ecoci/auth-api/internal/filter"
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// runFilterDescription documents the filter parameter of run endpoints
+const runFilterDescription = "Filter expression over co2_kg, energy_kwh, duration_s, created_at, workflow_name, workflow_run_group, branch, git_commit_sha, tag and ci_provider, such as co2_kg>0.5 AND branch=main AND tag IN (nightly,release)"
+
+// parseRunFilter parses the filter query parameter, returning nil when it is absent. Invalid
+// expressions are answered with 400.
+func parseRunFilter(c *gin.Context) (*filter.Expr, bool) {
+	raw := c.Query("filter")
+	if raw == "" {
+		return nil, true
+	}
+	expr, err := service.ParseRunFilter(raw)
+	if err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_FILTER", "Invalid filter parameter", err.Error())
+		return nil, false
+	}
+	return expr, true
+}
+
+// runSortDescription documents the sort parameter of run endpoints
+const runSortDescription = "Sort field (created_at, co2_kg, energy_kwh, duration_s)"
+
+// parseRunSort parses the sort and order query parameters of run listings, defaulting to
+// defaultSort in descending order. Invalid values are answered with 400.
+func parseRunSort(c *gin.Context, defaultSort string) (sortBy, order string, ok bool) {
+	sortBy = c.DefaultQuery("sort", defaultSort)
+	order = c.DefaultQuery("order", "desc")
+	if sortBy != defaultSort && !service.IsValidRunSort(sortBy) {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_SORT", "Invalid sort, must be one of created_at, co2_kg, energy_kwh, duration_s")
+		return "", "", false
+	}
+	if order != "asc" && order != "desc" {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_ORDER", "Invalid order, must be one of asc, desc")
+		return "", "", false
+	}
+	return sortBy, order, true
+}
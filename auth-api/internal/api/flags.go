@@ -0,0 +1,229 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/flags"
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// registerFlags defines the feature flags of the API
+func (s *Server) registerFlags() error {
+	definitions := []flags.Definition{
+		{
+			Name:        flags.Webhooks,
+			Description: "Repository and organization webhooks",
+			Default:     true,
+		},
+	}
+
+	for _, definition := range definitions {
+		if err := s.flags.Register(definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// requireFeature responds 404 to users a feature flag is off for, as if the endpoint did not
+// exist. It must run after authentication.
+func (s *Server) requireFeature(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, ok := currentUserID(c)
+		if !ok {
+			c.Abort()
+			return
+		}
+		if !s.flags.Enabled(c.Request.Context(), name, userID) {
+			problem.Abort(c, http.StatusNotFound, "FEATURE_DISABLED", "Feature not available")
+			return
+		}
+		c.Next()
+	}
+}
+
+// UpdateFlagRequest changes the state of a feature flag
+type UpdateFlagRequest struct {
+	Enabled *bool `json:"enabled,omitempty"`
+	// RolloutPercentage is the share of users, beyond the targeted ones, the flag is on for
+	RolloutPercentage *int `json:"rollout_percentage,omitempty" binding:"omitempty,min=0,max=100" example:"25"`
+	// UserIDs are the users the flag is always on for; replaces the current list
+	UserIDs *[]uuid.UUID `json:"user_ids,omitempty"`
+	// OrganizationIDs are the organizations whose members the flag is always on for;
+	// replaces the current list
+	OrganizationIDs *[]uuid.UUID `json:"organization_ids,omitempty"`
+}
+
+// requireFlag resolves the name path parameter to a defined feature flag
+func (s *Server) requireFlag(c *gin.Context) (*flags.Flag, bool) {
+	flag, err := s.flags.Get(c.Param("name"))
+	if err != nil {
+		if errors.Is(err, flags.ErrFlagNotFound) {
+			problem.Respond(c, http.StatusNotFound, "FLAG_NOT_FOUND", "Feature flag not found")
+		} else {
+			problem.Respond(c, http.StatusInternalServerError, "FLAG_FETCH_FAILED", "Failed to get feature flag")
+		}
+		return nil, false
+	}
+	return flag, true
+}
+
+// auditFlag builds the audit event of a change to a feature flag
+func auditFlag(action string, before, after *flags.Flag) *db.AuditEvent {
+	state := func(flag *flags.Flag) map[string]interface{} {
+		return map[string]interface{}{
+			"overridden":         flag.Overridden,
+			"enabled":            flag.Enabled,
+			"rollout_percentage": flag.RolloutPercentage,
+			"user_ids":           flag.UserIDs,
+			"organization_ids":   flag.OrganizationIDs,
+		}
+	}
+	return &db.AuditEvent{
+		Action:       action,
+		ResourceType: auditResourceFeatureFlag,
+		ResourceID:   after.Name,
+		Changes:      service.AuditDiff(state(before), state(after)),
+	}
+}
+
+// Get my flags handler
+// @Summary Get my feature flags
+// @Description Get whether each feature flag is on for the current user, for clients that hide unavailable features
+// @Tags users
+// @Security CookieAuth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} problem.Problem
+// @Router /me/flags [get]
+func (s *Server) handleGetMyFlags(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"flags": s.flags.EnabledFlags(c.Request.Context(), userID),
+	})
+}
+
+// List flags handler
+// @Summary List feature flags
+// @Description Get the feature flags with their defaults and targeting (admin only)
+// @Tags admin
+// @Security CookieAuth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Router /admin/flags [get]
+func (s *Server) handleListFlags(c *gin.Context) {
+	list, err := s.flags.List()
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "FLAGS_FETCH_FAILED", "Failed to list feature flags")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"flags": list,
+	})
+}
+
+// Get flag handler
+// @Summary Get feature flag
+// @Description Get a feature flag with its default and targeting (admin only)
+// @Tags admin
+// @Security CookieAuth
+// @Produce json
+// @Param name path string true "Flag name"
+// @Success 200 {object} flags.Flag
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /admin/flags/{name} [get]
+func (s *Server) handleGetFlag(c *gin.Context) {
+	flag, ok := s.requireFlag(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, flag)
+}
+
+// Update flag handler
+// @Summary Update feature flag
+// @Description Toggle a feature flag or change its targeting (admin only). A flag still on its default starts from it. Changes reach every instance within 30 seconds.
+// @Tags admin
+// @Security CookieAuth
+// @Accept json
+// @Produce json
+// @Param name path string true "Flag name"
+// @Param flag body UpdateFlagRequest true "Flag state"
+// @Success 200 {object} flags.Flag
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /admin/flags/{name} [patch]
+func (s *Server) handleUpdateFlag(c *gin.Context) {
+	flag, ok := s.requireFlag(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateFlagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body", err.Error())
+		return
+	}
+
+	updated, err := s.flags.Update(flag.Name, flags.Update{
+		Enabled:           req.Enabled,
+		RolloutPercentage: req.RolloutPercentage,
+		UserIDs:           req.UserIDs,
+		OrganizationIDs:   req.OrganizationIDs,
+	})
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "FLAG_UPDATE_FAILED", "Failed to update feature flag")
+		return
+	}
+
+	s.recordAudit(c, auditFlag("feature_flag.update", flag, updated))
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// Reset flag handler
+// @Summary Reset feature flag
+// @Description Remove the overrides of a feature flag so it uses its default again (admin only)
+// @Tags admin
+// @Security CookieAuth
+// @Produce json
+// @Param name path string true "Flag name"
+// @Success 200 {object} flags.Flag
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /admin/flags/{name} [delete]
+func (s *Server) handleResetFlag(c *gin.Context) {
+	flag, ok := s.requireFlag(c)
+	if !ok {
+		return
+	}
+
+	reset, err := s.flags.Reset(flag.Name)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "FLAG_RESET_FAILED", "Failed to reset feature flag")
+		return
+	}
+
+	s.recordAudit(c, auditFlag("feature_flag.reset", flag, reset))
+
+	c.JSON(http.StatusOK, reset)
+}
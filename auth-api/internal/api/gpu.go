@@ -0,0 +1,101 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// respondGPUStats aggregates the GPU energy of the runs in scope over the requested range by
+// GPU model and writes the result
+func (s *Server) respondGPUStats(c *gin.Context, scope service.RunScope) {
+	from, to, ok := parseTimeRange(c, func(to time.Time) time.Time {
+		return to.AddDate(0, 0, -30)
+	})
+	if !ok {
+		return
+	}
+
+	models, err := s.statsService.GPUStats(scope, from, to)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "STATS_FETCH_FAILED", "Failed to fetch GPU energy")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":   from,
+		"to":     to,
+		"models": models,
+	})
+}
+
+// Repository GPU energy handler
+// @Summary Get repository GPU energy
+// @Description Get the GPU energy of the runs of a repository over a time range by GPU model, with the share of their energy it makes up
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Success 200 {object} gpuStatsResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/gpus [get]
+func (s *Server) handleRepositoryGPUStats(c *gin.Context) {
+	repo, ok := s.requireVisibleRepository(c)
+	if !ok {
+		return
+	}
+
+	s.respondGPUStats(c, service.RepositoryRuns(repo.ID))
+}
+
+// User GPU energy handler
+// @Summary Get current user GPU energy
+// @Description Get the GPU energy of the current user's runs over a time range by GPU model, with the share of their energy it makes up
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Success 200 {object} gpuStatsResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Router /me/gpus [get]
+func (s *Server) handleUserGPUStats(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	s.respondGPUStats(c, service.UserRuns(userID))
+}
+
+// Organization GPU energy handler
+// @Summary Get organization GPU energy
+// @Description Get the GPU energy of the runs of an organization over a time range by GPU model, with the share of their energy it makes up (members only)
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param org path string true "GitHub organization login"
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Success 200 {object} gpuStatsResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /orgs/{org}/gpus [get]
+func (s *Server) handleOrganizationGPUStats(c *gin.Context) {
+	org, ok := s.requireOrganizationMember(c)
+	if !ok {
+		return
+	}
+
+	s.respondGPUStats(c, service.OrganizationRuns(org.ID))
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql"
+
+	"github.com/ecoci/auth-api/internal/gql"
+	"github.com/ecoci/auth-api/internal/problem"
+)
+
+// GraphQLRequest represents a GraphQL query over HTTP
+type GraphQLRequest struct {
+	Query         string                 `json:"query" binding:"required"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// GraphQL handler
+// @Summary Execute a GraphQL query
+// @Description Query users, repositories, runs and stats with nested selection and filtering. Resolver errors are reported in the errors field of a 200 response, as is usual for GraphQL.
+// @Tags graphql
+// @Security CookieAuth
+// @Accept json
+// @Produce json
+// @Param query body GraphQLRequest true "GraphQL query"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Router /graphql [post]
+func (s *Server) handleGraphQL(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req GraphQLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body", err.Error())
+		return
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         s.graphqlSchema,
+		RequestString:  req.Query,
+		OperationName:  req.OperationName,
+		VariableValues: req.Variables,
+		Context:        gql.WithViewer(c.Request.Context(), userID),
+	})
+
+	c.JSON(http.StatusOK, result)
+}
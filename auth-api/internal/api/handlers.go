@@ -1,30 +1,50 @@
 package api
 
 import (
-	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/google/uuid"
 
+	"github.com/ecoci/auth-api/internal/auth"
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/problem"
 	"github.com/ecoci/auth-api/internal/service"
+	"github.com/ecoci/auth-api/internal/tracing"
+	"github.com/ecoci/auth-api/internal/version"
 )
 
 // Health check handler
 // @Summary Health check
-// @Description Get the health status of the API
+// @Description Get the health status of the API. Authenticated users can add verbose=true for the status of its dependencies and the build of the binary.
 // @Tags health
 // @Produce json
+// @Param verbose query bool false "Report dependency status and build information (requires authentication)"
 // @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
 // @Router /health [get]
 func (s *Server) handleHealth(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"status":    "healthy",
-		"timestamp": time.Now().UTC(),
-		"version":   "1.0.0",
-	})
+	if c.Query("verbose") != "true" {
+		c.JSON(http.StatusOK, gin.H{
+			"status":    "healthy",
+			"timestamp": time.Now().UTC(),
+			"version":   version.Version,
+		})
+		return
+	}
+
+	// Dependency details are only shown to active accounts, which OptionalJWTAuth checked
+	if _, exists := c.Get("user_id"); !exists {
+		problem.Respond(c, http.StatusUnauthorized, "MISSING_TOKEN", "Authentication required for verbose health")
+		return
+	}
+
+	c.JSON(http.StatusOK, s.healthDetails(c.Request.Context()))
 }
 
 // GitHub OAuth initiation handler
@@ -33,7 +53,7 @@ func (s *Server) handleHealth(c *gin.Context) {
 // @Tags auth
 // @Param redirect_uri query string false "Redirect URI after auth"
 // @Success 302 "Redirect to GitHub"
-// @Failure 400 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
 // @Router /auth/github [get]
 func (s *Server) handleGitHubAuth(c *gin.Context) {
 	// Generate state parameter for CSRF protection
@@ -59,19 +79,15 @@ func (s *Server) handleGitHubAuth(c *gin.Context) {
 // @Param code query string true "Authorization code"
 // @Param state query string false "State parameter"
 // @Success 302 "Redirect to application"
-// @Failure 400 {object} map[string]interface{}
-// @Failure 500 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 500 {object} problem.Problem
 // @Router /auth/github/callback [get]
 func (s *Server) handleGitHubCallback(c *gin.Context) {
 	// Verify state parameter
 	state := c.Query("state")
 	storedState, err := c.Cookie("oauth_state")
 	if err != nil || state != storedState {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":     "Invalid state parameter",
-			"code":      "INVALID_STATE",
-			"timestamp": time.Now().UTC(),
-		})
+		problem.Respond(c, http.StatusBadRequest, "INVALID_STATE", "Invalid state parameter")
 		return
 	}
 
@@ -81,58 +97,84 @@ func (s *Server) handleGitHubCallback(c *gin.Context) {
 	// Get authorization code
 	code := c.Query("code")
 	if code == "" {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":     "Missing authorization code",
-			"code":      "MISSING_CODE",
-			"timestamp": time.Now().UTC(),
-		})
+		problem.Respond(c, http.StatusBadRequest, "MISSING_CODE", "Missing authorization code")
 		return
 	}
 
 	// Exchange code for token
 	token, err := s.oauthManager.ExchangeCodeForToken(c.Request.Context(), code)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":     "Failed to exchange code for token",
-			"code":      "TOKEN_EXCHANGE_FAILED",
-			"timestamp": time.Now().UTC(),
-		})
+		problem.Respond(c, http.StatusBadRequest, "TOKEN_EXCHANGE_FAILED", "Failed to exchange code for token")
 		return
 	}
 
 	// Get user info from GitHub
 	githubUser, err := s.oauthManager.GetUserInfo(c.Request.Context(), token)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":     "Failed to get user info from GitHub",
-			"code":      "USER_INFO_FAILED",
-			"timestamp": time.Now().UTC(),
-		})
+		problem.Respond(c, http.StatusInternalServerError, "USER_INFO_FAILED", "Failed to get user info from GitHub")
 		return
 	}
 
 	// Create or update user in database
+	_, lookupErr := s.userService.GetUserByGitHubID(githubUser.ID)
+	isNewUser := lookupErr != nil && lookupErr.Error() == "user not found"
 	user, err := s.userService.CreateOrUpdateUserFromGitHub(githubUser)
+	if err != nil && err.Error() == "account deleted" {
+		problem.Respond(c, http.StatusForbidden, "ACCOUNT_DELETED", "Account deleted")
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":     "Failed to create user",
-			"code":      "USER_CREATION_FAILED",
-			"timestamp": time.Now().UTC(),
-		})
+		problem.Respond(c, http.StatusInternalServerError, "USER_CREATION_FAILED", "Failed to create user")
+		return
+	}
+
+	if user.SuspendedAt != nil {
+		problem.Respond(c, http.StatusForbidden, "ACCOUNT_SUSPENDED", "Account suspended")
 		return
 	}
 
+	// Grant the admin role to the users configured in ADMIN_USERS
+	if user.Role != db.RoleAdmin && s.cfg.IsAdminUser(user.GitHubUsername) {
+		role := db.RoleAdmin
+		if promoted, err := s.userService.UpdateAccount(user.ID, service.AccountUpdate{Role: &role}, time.Now()); err != nil {
+			log.Printf("Warning: failed to grant admin role to %s: %v", user.GitHubUsername, err)
+		} else {
+			user = promoted
+		}
+	}
+
+	if isNewUser {
+		s.mailer.SendWelcome(user)
+	}
+
+	// Keep the token so the profile can be refreshed without signing in again
+	if err := s.userService.SaveGitHubCredential(user.ID, token.AccessToken); err != nil {
+		log.Printf("Warning: failed to save GitHub credentials for user %s: %v", user.GitHubUsername, err)
+	}
+
+	// Sync organization memberships used for repository visibility; a failure here
+	// should not block login, the memberships are refreshed on the next login
+	if githubOrgs, err := s.oauthManager.GetUserOrganizations(c.Request.Context(), token); err != nil {
+		log.Printf("Warning: failed to get organizations for user %s: %v", user.GitHubUsername, err)
+	} else if err := s.userService.SyncOrganizations(user.ID, githubOrgs); err != nil {
+		log.Printf("Warning: failed to sync organizations for user %s: %v", user.GitHubUsername, err)
+	}
+
 	// Generate JWT token
 	jwtToken, err := s.jwtManager.GenerateToken(user.ID, user.GitHubUsername)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":     "Failed to generate auth token",
-			"code":      "TOKEN_GENERATION_FAILED",
-			"timestamp": time.Now().UTC(),
-		})
+		problem.Respond(c, http.StatusInternalServerError, "TOKEN_GENERATION_FAILED", "Failed to generate auth token")
 		return
 	}
 
+	// Sign-ins run before authentication, so the actor is set explicitly
+	if claims, err := s.jwtManager.ValidateToken(jwtToken); err == nil {
+		event := auditToken("token.issue", claims)
+		event.ActorID = &user.ID
+		event.ActorUsername = user.GitHubUsername
+		s.recordAudit(c, event)
+	}
+
 	// Set JWT cookie
 	maxAge := int(s.cfg.JWTExpiration.Seconds())
 	c.SetCookie("ecoci_token", jwtToken, maxAge, "/", s.cfg.CookieDomain, s.cfg.CookieSecure, true)
@@ -153,11 +195,15 @@ func (s *Server) handleGitHubCallback(c *gin.Context) {
 // @Tags auth
 // @Security CookieAuth
 // @Success 200 {object} map[string]interface{}
-// @Failure 401 {object} map[string]interface{}
+// @Failure 401 {object} problem.Problem
 // @Router /auth/logout [post]
 func (s *Server) handleLogout(c *gin.Context) {
 	// Clear JWT cookie
 	c.SetCookie("ecoci_token", "", -1, "/", s.cfg.CookieDomain, s.cfg.CookieSecure, true)
+
+	if claims, ok := c.Get("jwt_claims"); ok {
+		s.recordAudit(c, auditToken("token.logout", claims.(*auth.JWTClaims)))
+	}
 	
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Successfully logged out",
@@ -171,26 +217,18 @@ func (s *Server) handleLogout(c *gin.Context) {
 // @Security CookieAuth
 // @Produce json
 // @Success 200 {object} db.User
-// @Failure 401 {object} map[string]interface{}
+// @Failure 401 {object} problem.Problem
 // @Router /auth/me [get]
 func (s *Server) handleGetMe(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error":     "User ID not found in context",
-			"code":      "MISSING_USER_ID",
-			"timestamp": time.Now().UTC(),
-		})
+		problem.Respond(c, http.StatusUnauthorized, "MISSING_USER_ID", "User ID not found in context")
 		return
 	}
 
 	user, err := s.userService.GetUserByID(userID.(uuid.UUID))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":     "Failed to get user information",
-			"code":      "USER_FETCH_FAILED",
-			"timestamp": time.Now().UTC(),
-		})
+		problem.Respond(c, http.StatusInternalServerError, "USER_FETCH_FAILED", "Failed to get user information")
 		return
 	}
 
@@ -199,61 +237,106 @@ func (s *Server) handleGetMe(c *gin.Context) {
 
 // Create run handler
 // @Summary Create CO2 measurement run
-// @Description Store a new CO2 measurement run
+// @Description Store a new CO2 measurement run. Energy and CO2 are given as energy_kwh and co2_kg, or once each in other units (energy with energy_unit kWh, Wh or J, energy_wh or energy_j; co2 with co2_unit kg or g, or co2_g) and stored as kWh and kg. The body may be gzip or deflate encoded and is limited to MAX_INGEST_BODY_BYTES as sent and decoded. Runs for repositories that require signed runs must also carry X-EcoCI-Timestamp, the Unix time in seconds, and X-EcoCI-Signature-256, sha256= followed by the hex HMAC-SHA256 of "<timestamp>.<body>" with the run signing secret of the repository, over the decoded body and within 5 minutes of the server time.
 // @Tags runs
 // @Security CookieAuth
+// @Security BearerAuth
 // @Accept json
 // @Produce json
+// @Param Content-Encoding header string false "gzip or deflate"
+// @Param X-EcoCI-Timestamp header string false "Unix time the run was signed at, for repositories that require signed runs"
+// @Param X-EcoCI-Signature-256 header string false "Run signature, for repositories that require signed runs"
 // @Param run body service.RunCreateRequest true "Run data"
 // @Success 201 {object} db.Run
-// @Failure 400 {object} map[string]interface{}
-// @Failure 401 {object} map[string]interface{}
-// @Failure 422 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 402 {object} problem.Problem
+// @Failure 413 {object} problem.Problem
+// @Failure 415 {object} problem.Problem
+// @Failure 422 {object} problem.Problem
+// @Failure 429 {object} problem.Problem
 // @Router /runs [post]
 func (s *Server) handleCreateRun(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{
-			"error":     "User ID not found in context",
-			"code":      "MISSING_USER_ID",
-			"timestamp": time.Now().UTC(),
-		})
+		problem.Respond(c, http.StatusUnauthorized, "MISSING_USER_ID", "User ID not found in context")
 		return
 	}
 
+	// Keep the body as sent, decoded, to check the signature of repositories that require one
+	body, err := c.GetRawData()
+	if err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body", err.Error())
+		return
+	}
 	var req service.RunCreateRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":     "Invalid request body",
-			"code":      "INVALID_REQUEST_BODY",
-			"timestamp": time.Now().UTC(),
-			"details":   err.Error(),
-		})
+	if err := binding.JSON.BindBody(body, &req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body", err.Error())
+		return
+	}
+	if !s.verifyRunSignature(c, userID.(uuid.UUID), req.Repository.FullName, body) {
+		return
+	}
+	if err := service.NormalizeRunUnits(&req); err != nil {
+		problem.RespondDetail(c, http.StatusUnprocessableEntity, "INVALID_UNITS", "Invalid energy or CO2 units", err.Error())
+		return
+	}
+	if err := service.NormalizeMeasurements(&req); err != nil {
+		problem.RespondDetail(c, http.StatusUnprocessableEntity, "INVALID_MEASUREMENTS", "Invalid measurements", err.Error())
+		return
+	}
+	if err := service.NormalizeGPUs(&req); err != nil {
+		problem.RespondDetail(c, http.StatusUnprocessableEntity, "INVALID_GPUS", "Invalid GPU energy", err.Error())
+		return
+	}
+	if err := service.ValidateImageBuild(req.ImageBuild); err != nil {
+		problem.RespondDetail(c, http.StatusUnprocessableEntity, "INVALID_IMAGE_BUILD", "Invalid image build", err.Error())
+		return
+	}
+	if err := service.NormalizeEnvironment(&req); err != nil {
+		problem.RespondDetail(c, http.StatusUnprocessableEntity, "INVALID_ENVIRONMENT", "Invalid environment", err.Error())
+		return
+	}
+	if err := service.ValidateSteps(req.Metadata); err != nil {
+		problem.RespondDetail(c, http.StatusUnprocessableEntity, "INVALID_STEPS", "Invalid steps", err.Error())
 		return
 	}
 
 	// Validate required fields
 	if req.EnergyKWh < 0 || req.CO2Kg < 0 || req.DurationS < 0 {
-		c.JSON(http.StatusUnprocessableEntity, gin.H{
-			"error":     "Energy, CO2, and duration values must be non-negative",
-			"code":      "VALIDATION_FAILED",
-			"timestamp": time.Now().UTC(),
-		})
+		problem.Respond(c, http.StatusUnprocessableEntity, "VALIDATION_FAILED", "Energy, CO2, and duration values must be non-negative")
+		return
+	}
+	if req.NetworkBytes != nil && *req.NetworkBytes < 0 {
+		problem.Respond(c, http.StatusUnprocessableEntity, "VALIDATION_FAILED", "Network bytes must be non-negative")
+		return
+	}
+	if req.WorkflowRunGroup != nil && len(*req.WorkflowRunGroup) > service.MaxWorkflowRunGroupLength {
+		problem.Respond(c, http.StatusUnprocessableEntity, "VALIDATION_FAILED", "Workflow run group must be at most 255 characters")
+		return
+	}
+	if req.GitTag != nil && (*req.GitTag == "" || len(*req.GitTag) > service.MaxGitTagLength) {
+		problem.Respond(c, http.StatusUnprocessableEntity, "VALIDATION_FAILED", "Git tag must be 1 to 255 characters")
 		return
 	}
 
 	// Create the run
-	run, err := s.runService.CreateRun(userID.(uuid.UUID), &req, s.repoService)
+	ctx := c.Request.Context()
+	run, err := s.runService.WithContext(ctx).CreateRun(userID.(uuid.UUID), &req, s.repoService.WithContext(ctx), s.quotaService.WithContext(ctx))
+	if s.respondQuotaExceeded(c, err) {
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":     "Failed to create run",
-			"code":      "RUN_CREATION_FAILED",
-			"timestamp": time.Now().UTC(),
-			"details":   err.Error(),
-		})
+		problem.RespondDetail(c, http.StatusInternalServerError, "RUN_CREATION_FAILED", "Failed to create run", err.Error())
 		return
 	}
 
+	s.invalidateRunCaches(ctx, run)
+	_, span := tracing.Tracer().Start(ctx, "publish run events")
+	s.publishRunEvents(run)
+	span.End()
+	s.recordAudit(c, auditRun("run.create", run, service.AuditDiff(nil, runAuditFields(run))))
+
 	c.JSON(http.StatusCreated, run)
 }
 
@@ -269,11 +352,28 @@ func (s *Server) handleCreateRun(c *gin.Context) {
 // @Param order query string false "Sort order" Enums(asc,desc) default(desc)
 // @Param owner query string false "Filter by owner username"
 // @Param name query string false "Filter by repository name"
+// @Param full_name query string false "Filter by full name, such as octocat/hello-world"
+// @Param mine query bool false "Only repositories owned by, shared with, or in an organization of the current user"
+// @Param visibility query string false "Filter by visibility" Enums(all,public,private) default(all)
+// @Param fields query string false "Comma-separated members of each repository to return, such as id,full_name,stats; all when omitted"
+// @Param include query string false "Comma-separated relations to embed: owner (default); empty for none"
 // @Success 200 {object} map[string]interface{}
-// @Failure 400 {object} map[string]interface{}
-// @Failure 401 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
 // @Router /repos [get]
 func (s *Server) handleListRepositories(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		problem.Respond(c, http.StatusUnauthorized, "MISSING_USER_ID", "User ID not found in context")
+		return
+	}
+
+	// Repositories embed their owner unless the client asks for less
+	fields, ok := parseFieldSet(c, db.RepositoryStats{}, []string{"owner"}, []string{"owner"})
+	if !ok {
+		return
+	}
+
 	// Parse pagination parameters
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
@@ -292,23 +392,43 @@ func (s *Server) handleListRepositories(c *gin.Context) {
 		order = "desc"
 	}
 
-	// Parse filters
-	filters := make(map[string]interface{})
+	// Parse filters; repositories are always scoped to what the current user may see
+	filters := map[string]interface{}{
+		"viewer_id": userID.(uuid.UUID),
+	}
+	if mineParam := c.Query("mine"); mineParam != "" {
+		mine, err := strconv.ParseBool(mineParam)
+		if err != nil {
+			problem.Respond(c, http.StatusBadRequest, "INVALID_MINE_FILTER", "Invalid mine parameter, expected true or false")
+			return
+		}
+		filters["mine"] = mine
+	}
+	visibility := c.DefaultQuery("visibility", "all")
+	if visibility != "all" && visibility != "public" && visibility != "private" {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_VISIBILITY", "Invalid visibility parameter, expected all, public or private")
+		return
+	}
+	filters["visibility"] = visibility
 	if owner := c.Query("owner"); owner != "" {
 		filters["owner"] = owner
 	}
 	if name := c.Query("name"); name != "" {
 		filters["name"] = name
 	}
+	if fullName := c.Query("full_name"); fullName != "" {
+		filters["full_name"] = fullName
+	}
 
 	// Get repositories with stats
 	repos, total, err := s.repoService.ListRepositoriesWithStats(limit, offset, sortBy, order, filters)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":     "Failed to list repositories",
-			"code":      "REPOSITORIES_FETCH_FAILED",
-			"timestamp": time.Now().UTC(),
-		})
+		problem.Respond(c, http.StatusInternalServerError, "REPOSITORIES_FETCH_FAILED", "Failed to list repositories")
+		return
+	}
+	items, err := fields.apply(repos)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "REPOSITORIES_FETCH_FAILED", "Failed to list repositories")
 		return
 	}
 
@@ -316,7 +436,95 @@ func (s *Server) handleListRepositories(c *gin.Context) {
 	totalPages := (total + int64(limit) - 1) / int64(limit)
 	
 	c.JSON(http.StatusOK, gin.H{
-		"repositories": repos,
+		"repositories": items,
+		"pagination": gin.H{
+			"page":     page,
+			"limit":    limit,
+			"total":    total,
+			"pages":    totalPages,
+			"has_next": int64(page) < totalPages,
+			"has_prev": page > 1,
+		},
+	})
+}
+
+// List current user's runs handler
+// @Summary List my runs
+// @Description Get paginated list of the runs submitted by the current user across repositories
+// @Tags runs
+// @Security CookieAuth
+// @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Param repository_id query string false "Repository UUID to list the runs of"
+// @Param from_date query string false "Filter from date (ISO 8601)"
+// @Param to_date query string false "Filter to date (ISO 8601)"
+// @Param filter query string false "Filter expression, such as co2_kg>0.5 AND branch=main AND tag IN (nightly,release)"
+// @Param sort query string false "Sort field (created_at, co2_kg, energy_kwh, duration_s)" default(created_at)
+// @Param order query string false "Sort order (asc, desc)" default(desc)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Router /me/runs [get]
+func (s *Server) handleListMyRuns(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	// Parse pagination parameters
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	offset := (page - 1) * limit
+
+	filters := make(map[string]interface{})
+	if raw := c.Query("repository_id"); raw != "" {
+		repoID, err := uuid.Parse(raw)
+		if err != nil {
+			problem.Respond(c, http.StatusBadRequest, "INVALID_REPOSITORY_ID", "Invalid repository ID")
+			return
+		}
+		filters["repository_id"] = repoID
+	}
+	if fromDate := c.Query("from_date"); fromDate != "" {
+		if parsedDate, err := time.Parse(time.RFC3339, fromDate); err == nil {
+			filters["from_date"] = parsedDate
+		}
+	}
+	if toDate := c.Query("to_date"); toDate != "" {
+		if parsedDate, err := time.Parse(time.RFC3339, toDate); err == nil {
+			filters["to_date"] = parsedDate
+		}
+	}
+	expr, ok := parseRunFilter(c)
+	if !ok {
+		return
+	}
+	if expr != nil {
+		filters["filter"] = expr
+	}
+	sortBy, order, ok := parseRunSort(c, "created_at")
+	if !ok {
+		return
+	}
+
+	runs, total, err := s.runService.WithContext(c.Request.Context()).ListUserRuns(userID, limit, offset, sortBy, order, filters)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "RUNS_FETCH_FAILED", "Failed to list runs")
+		return
+	}
+
+	// Calculate pagination info
+	totalPages := (total + int64(limit) - 1) / int64(limit)
+
+	c.JSON(http.StatusOK, gin.H{
+		"runs": runs,
 		"pagination": gin.H{
 			"page":     page,
 			"limit":    limit,
@@ -330,7 +538,7 @@ func (s *Server) handleListRepositories(c *gin.Context) {
 
 // Get repository runs handler
 // @Summary Get runs for a repository
-// @Description Get paginated list of runs for a specific repository
+// @Description Get paginated list of runs for a specific repository. Runs older than the retention of the repository's plan are not listed.
 // @Tags repositories
 // @Security CookieAuth
 // @Produce json
@@ -339,34 +547,37 @@ func (s *Server) handleListRepositories(c *gin.Context) {
 // @Param limit query int false "Items per page" default(20)
 // @Param from_date query string false "Filter from date (ISO 8601)"
 // @Param to_date query string false "Filter to date (ISO 8601)"
+// @Param fields query string false "Comma-separated members of each run to return, such as id,co2_kg,created_at; all when omitted"
+// @Param include query string false "Comma-separated relations to embed: user and repository (default); empty for none"
+// @Param filter query string false "Filter expression, such as co2_kg>0.5 AND branch=main AND tag IN (nightly,release)"
+// @Param sort query string false "Sort field (created_at, co2_kg, energy_kwh, duration_s)" default(created_at)
+// @Param order query string false "Sort order (asc, desc)" default(desc)
 // @Success 200 {object} map[string]interface{}
-// @Failure 400 {object} map[string]interface{}
-// @Failure 401 {object} map[string]interface{}
-// @Failure 404 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
 // @Router /repos/{repo_id}/runs [get]
 func (s *Server) handleGetRepositoryRuns(c *gin.Context) {
-	// Parse repository ID
-	repoIDStr := c.Param("repo_id")
-	repoID, err := uuid.Parse(repoIDStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":     "Invalid repository ID",
-			"code":      "INVALID_REPO_ID",
-			"timestamp": time.Now().UTC(),
-		})
+	// Check if repository exists and is visible; private repositories the user
+	// cannot access are reported as not found to avoid leaking their existence
+	repo, ok := s.requireVisibleRepository(c)
+	if !ok {
 		return
 	}
+	repoID := repo.ID
 
-	// Check if repository exists
-	_, err = s.repoService.GetRepositoryByID(repoID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{
-			"error":     "Repository not found",
-			"code":      "REPOSITORY_NOT_FOUND",
-			"timestamp": time.Now().UTC(),
-		})
+	// Runs embed their user and repository unless the client asks for less
+	fields, ok := parseFieldSet(c, db.Run{}, []string{"user", "repository"}, []string{"user", "repository"})
+	if !ok {
 		return
 	}
+	view := service.RunView{Columns: fields.names()}
+	if fields.includes("user") {
+		view.Relations = append(view.Relations, "User")
+	}
+	if fields.includes("repository") {
+		view.Relations = append(view.Relations, "Repository")
+	}
 
 	// Parse pagination parameters
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
@@ -391,15 +602,37 @@ func (s *Server) handleGetRepositoryRuns(c *gin.Context) {
 			filters["to_date"] = parsedDate
 		}
 	}
+	expr, ok := parseRunFilter(c)
+	if !ok {
+		return
+	}
+	if expr != nil {
+		filters["filter"] = expr
+	}
+	sortBy, order, ok := parseRunSort(c, "created_at")
+	if !ok {
+		return
+	}
+
+	// Runs older than the plan's retention are not listed
+	cutoff, err := s.quotaService.WithContext(c.Request.Context()).RetentionCutoff(repo, time.Now())
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "PLAN_FETCH_FAILED", "Failed to get repository plan")
+		return
+	}
+	if fromDate, ok := filters["from_date"].(time.Time); cutoff != nil && (!ok || fromDate.Before(*cutoff)) {
+		filters["from_date"] = *cutoff
+	}
 
 	// Get runs
-	runs, total, err := s.repoService.GetRepositoryRuns(repoID, limit, offset, filters)
+	runs, total, err := s.repoService.GetRepositoryRuns(repoID, limit, offset, sortBy, order, filters, view)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":     "Failed to get repository runs",
-			"code":      "RUNS_FETCH_FAILED",
-			"timestamp": time.Now().UTC(),
-		})
+		problem.Respond(c, http.StatusInternalServerError, "RUNS_FETCH_FAILED", "Failed to get repository runs")
+		return
+	}
+	items, err := fields.apply(runs)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "RUNS_FETCH_FAILED", "Failed to get repository runs")
 		return
 	}
 
@@ -407,7 +640,7 @@ func (s *Server) handleGetRepositoryRuns(c *gin.Context) {
 	totalPages := (total + int64(limit) - 1) / int64(limit)
 	
 	c.JSON(http.StatusOK, gin.H{
-		"runs": runs,
+		"runs": items,
 		"pagination": gin.H{
 			"page":     page,
 			"limit":    limit,
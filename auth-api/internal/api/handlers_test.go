@@ -2,23 +2,65 @@ package api
 
 import (
 	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 
+	"github.com/ecoci/auth-api/internal/alerts"
+	"github.com/ecoci/auth-api/internal/archive"
 	"github.com/ecoci/auth-api/internal/auth"
+	"github.com/ecoci/auth-api/internal/cache"
+	"github.com/ecoci/auth-api/internal/commitstatus"
+	"github.com/ecoci/auth-api/internal/client"
+	"github.com/ecoci/auth-api/internal/cloudevents"
+	"github.com/ecoci/auth-api/internal/carbon"
 	"github.com/ecoci/auth-api/internal/config"
 	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/eventbus"
+	"github.com/ecoci/auth-api/internal/export"
+	"github.com/ecoci/auth-api/internal/flags"
+	"github.com/ecoci/auth-api/internal/github"
+	"github.com/ecoci/auth-api/internal/jobs"
+	"github.com/ecoci/auth-api/internal/mail"
 	"github.com/ecoci/auth-api/internal/service"
+	"github.com/ecoci/auth-api/internal/tracing"
+	"github.com/ecoci/auth-api/internal/webhook"
 )
 
 func setupTestServer(t *testing.T) (*Server, func()) {
@@ -28,14 +70,31 @@ func setupTestServer(t *testing.T) (*Server, func()) {
 	// Create in-memory database
 	database, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	require.NoError(t, err)
+	// Every connection to :memory: opens a new, empty database, so background jobs running
+	// concurrently must share the one the tables are migrated in
+	sqlDB, err := database.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
 
 	// Auto-migrate tables
-	err = database.AutoMigrate(&db.User{}, &db.Repository{}, &db.Run{})
+	err = database.AutoMigrate(&db.User{}, &db.Repository{}, &db.Run{},
+		&db.Organization{}, &db.OrganizationMember{}, &db.RepositoryCollaborator{},
+		&db.RepositoryBaseline{}, &db.RepositoryBudget{},
+		&db.Webhook{}, &db.WebhookDelivery{}, &db.WebhookDeliveryAttempt{},
+		&db.OrganizationIntegration{}, &db.RepositoryNotificationRoute{},
+		&db.AlertRule{}, &db.RepositoryDailyRollup{}, &db.Job{}, &db.JobRun{},
+		&db.RetentionPolicy{}, &db.RetentionReport{}, &db.AuditEvent{}, &db.FeatureFlag{},
+		&db.ArchivePartition{}, &db.CarbonOffset{}, &db.EmissionFactor{},
+		&db.EmissionFactorVersion{}, &db.RecalculationReport{}, &db.Measurement{}, &db.RunGPU{},
+		&db.StorageReport{}, &db.RepositoryStorageDay{}, &db.RunTestSuite{},
+		&db.RepositoryLanguage{}, &db.RunImageBuild{}, &db.RunComment{}, &db.SavedView{}, &db.UserPreference{}, &db.NotificationPreference{}, &db.GitHubCredential{}, &db.APIToken{})
 	require.NoError(t, err)
 
 	// Create test config
 	cfg := &config.Config{
 		JWTSecret:      "test-secret",
+		AppURL:         "http://localhost:3000",
+		BadgeURL:       "https://badge.ecoci.dev",
 		JWTExpiration:  time.Hour,
 		CookieDomain:   "localhost",
 		CookieSecure:   false,
@@ -44,6 +103,21 @@ func setupTestServer(t *testing.T) (*Server, func()) {
 		RateLimitBurst: 200,
 		TrustedProxies: []string{"127.0.0.1"},
 		Environment:    "test",
+
+		CacheTTLRepos:       time.Minute,
+		CacheTTLStats:       time.Minute,
+		CacheTTLLeaderboard: time.Minute,
+
+		RestoreWindow: 30 * 24 * time.Hour,
+
+		MaxIngestBodyBytes: 1 << 20,
+
+		// Test receivers listen on loopback
+		WebhookPrivateTargets: true,
+
+		NetworkKWhPerGB:        0.001,
+		StorageKWhPerTBMonth:   1.42,
+		StorageCarbonIntensity: 400,
 	}
 
 	// Create server
@@ -58,14 +132,14 @@ func setupTestServer(t *testing.T) (*Server, func()) {
 	return server, cleanup
 }
 
-func createTestUser(t *testing.T, db *gorm.DB) *db.User {
+func createTestUser(t *testing.T, database *gorm.DB) *db.User {
 	user := &db.User{
 		GitHubID:       12345,
 		GitHubUsername: "testuser",
 		GitHubEmail:    stringPtr("test@example.com"),
 		Name:           stringPtr("Test User"),
 	}
-	require.NoError(t, db.Create(user).Error)
+	require.NoError(t, database.Create(user).Error)
 	return user
 }
 
@@ -240,6 +314,57 @@ func TestHandleCreateRun(t *testing.T) {
 		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
 	})
 
+	t.Run("units are normalized", func(t *testing.T) {
+		repository := map[string]interface{}{
+			"name": "testrepo", "full_name": "testuser/testrepo", "html_url": "https://github.com/testuser/testrepo",
+		}
+		post := func(body map[string]interface{}) *httptest.ResponseRecorder {
+			body["duration_s"] = 120.0
+			body["repository"] = repository
+			jsonData, _ := json.Marshal(body)
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/runs", bytes.NewBuffer(jsonData))
+			req.Header.Set("Content-Type", "application/json")
+			req.AddCookie(&http.Cookie{
+				Name:  "ecoci_token",
+				Value: token,
+			})
+			server.router.ServeHTTP(w, req)
+			return w
+		}
+
+		for _, body := range []map[string]interface{}{
+			{"energy": 500, "energy_unit": "Wh", "co2": 300, "co2_unit": "g"},
+			{"energy_wh": 500, "co2_g": 300},
+			{"energy": 1.8e6, "energy_unit": "j", "co2_kg": 0.3},
+			{"energy_j": 1.8e6, "co2": 0.3, "co2_unit": "kg"},
+		} {
+			w := post(body)
+			require.Equal(t, http.StatusCreated, w.Code, body)
+			var response db.Run
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.InDelta(t, 0.5, response.EnergyKWh, 1e-9, body)
+			assert.InDelta(t, 0.3, response.CO2Kg, 1e-9, body)
+		}
+
+		for _, body := range []map[string]interface{}{
+			{"energy_kwh": 0.5, "energy_wh": 500, "co2_kg": 0.3},
+			{"energy_kwh": 0.5, "co2_kg": 0.3, "co2": 300, "co2_unit": "g"},
+			{"energy": 500, "energy_unit": "Wh", "energy_j": 1.8e6, "co2_kg": 0.3},
+			{"energy": 500, "co2_kg": 0.3},
+			{"energy_kwh": 0.5, "co2_unit": "g"},
+			{"energy": 500, "energy_unit": "calories", "co2_kg": 0.3},
+		} {
+			w := post(body)
+			assert.Equal(t, http.StatusUnprocessableEntity, w.Code, body)
+			assert.Contains(t, w.Body.String(), "INVALID_UNITS", body)
+		}
+
+		w := post(map[string]interface{}{"energy_wh": -500, "co2_g": 300})
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), "VALIDATION_FAILED")
+	})
+
 	t.Run("unauthenticated request", func(t *testing.T) {
 		runData := service.RunCreateRequest{
 			EnergyKWh: 0.5,
@@ -325,6 +450,53 @@ func TestHandleListRepositories(t *testing.T) {
 		assert.Equal(t, float64(10), pagination["limit"])
 	})
 
+	t.Run("filter by name is case-insensitive", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/repos?name=TESTREPO", nil)
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+
+		server.router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response map[string]interface{}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		require.NoError(t, err)
+
+		repos := response["repositories"].([]interface{})
+		require.Len(t, repos, 1)
+
+		stats := repos[0].(map[string]interface{})["stats"].(map[string]interface{})
+		assert.Equal(t, float64(2), stats["run_count"])
+		assert.InDelta(t, 0.6, stats["total_co2_kg"], 1e-9)
+	})
+
+	t.Run("sparse fieldsets and embeds", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/repos?fields=full_name,stats&include=", nil)
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+		server.router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Repositories []map[string]interface{} `json:"repositories"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Repositories, 1)
+		assert.Len(t, response.Repositories[0], 2)
+		assert.Equal(t, repo.FullName, response.Repositories[0]["full_name"])
+		assert.Contains(t, response.Repositories[0], "stats")
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/repos?include=runs", nil)
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+		server.router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
 	t.Run("unauthenticated request", func(t *testing.T) {
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("GET", "/repos", nil)
@@ -335,6 +507,97 @@ func TestHandleListRepositories(t *testing.T) {
 	})
 }
 
+func TestHandleListRepositoriesVisibility(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	other := &db.User{GitHubID: 54321, GitHubUsername: "otheruser"}
+	require.NoError(t, database.Create(other).Error)
+
+	// Public repository owned by the current user
+	ownRepo := createTestRepository(t, database, user.ID)
+	createTestRun(t, database, user.ID, ownRepo.ID)
+
+	// Private repository owned by someone else
+	privateRepo := &db.Repository{
+		OwnerID:      other.ID,
+		GitHubRepoID: 11111,
+		Name:         "secret",
+		FullName:     "otheruser/secret",
+		HTMLURL:      "https://github.com/otheruser/secret",
+		Private:      true,
+	}
+	require.NoError(t, database.Create(privateRepo).Error)
+	createTestRun(t, database, other.ID, privateRepo.ID)
+
+	// Public repository owned by someone else
+	publicRepo := &db.Repository{
+		OwnerID:      other.ID,
+		GitHubRepoID: 22222,
+		Name:         "open",
+		FullName:     "otheruser/open",
+		HTMLURL:      "https://github.com/otheruser/open",
+	}
+	require.NoError(t, database.Create(publicRepo).Error)
+	createTestRun(t, database, other.ID, publicRepo.ID)
+
+	listRepos := func(t *testing.T, query string) []interface{} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/repos"+query, nil)
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+		server.router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		repos, _ := response["repositories"].([]interface{})
+		return repos
+	}
+
+	t.Run("private repositories of others are hidden", func(t *testing.T) {
+		assert.Len(t, listRepos(t, ""), 2)
+	})
+
+	t.Run("mine only returns own repositories", func(t *testing.T) {
+		repos := listRepos(t, "?mine=true")
+		require.Len(t, repos, 1)
+		assert.Equal(t, ownRepo.ID.String(), repos[0].(map[string]interface{})["id"])
+	})
+
+	t.Run("collaborators can see shared private repositories", func(t *testing.T) {
+		require.NoError(t, database.Create(&db.RepositoryCollaborator{
+			RepositoryID: privateRepo.ID,
+			UserID:       user.ID,
+		}).Error)
+		defer database.Where("repository_id = ?", privateRepo.ID).Delete(&db.RepositoryCollaborator{})
+
+		assert.Len(t, listRepos(t, "?visibility=private"), 1)
+		assert.Len(t, listRepos(t, "?mine=true"), 2)
+	})
+
+	t.Run("runs of hidden private repositories are not found", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/repos/"+privateRepo.ID.String()+"/runs", nil)
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+		server.router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("invalid visibility parameter", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/repos?visibility=secret", nil)
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+		server.router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
 func TestHandleGetRepositoryRuns(t *testing.T) {
 	server, cleanup := setupTestServer(t)
 	defer cleanup()
@@ -374,6 +637,78 @@ func TestHandleGetRepositoryRuns(t *testing.T) {
 		assert.Equal(t, float64(2), pagination["total"])
 	})
 
+	t.Run("sparse fieldsets and embeds", func(t *testing.T) {
+		get := func(query string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/repos/"+repo.ID.String()+"/runs?"+query, nil)
+			req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+			server.router.ServeHTTP(w, req)
+			return w
+		}
+		runs := func(w *httptest.ResponseRecorder) []map[string]interface{} {
+			require.Equal(t, http.StatusOK, w.Code)
+			var response struct {
+				Runs []map[string]interface{} `json:"runs"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			require.Len(t, response.Runs, 2)
+			return response.Runs
+		}
+
+		// Runs embed their user and repository by default
+		run := runs(get(""))[0]
+		assert.Contains(t, run, "user")
+		assert.Contains(t, run, "repository")
+
+		run = runs(get("fields=id,co2_kg&include="))[0]
+		assert.Len(t, run, 2)
+		assert.NotEmpty(t, run["id"])
+		assert.Equal(t, 0.3, run["co2_kg"])
+
+		run = runs(get("fields=co2_kg,created_at&include=repository"))[0]
+		assert.Len(t, run, 3)
+		assert.Contains(t, run, "created_at")
+		assert.Equal(t, repo.FullName, run["repository"].(map[string]interface{})["full_name"])
+
+		assert.Equal(t, http.StatusBadRequest, get("fields=co2_kg,password").Code)
+		assert.Equal(t, http.StatusBadRequest, get("fields=user").Code)
+		assert.Equal(t, http.StatusBadRequest, get("include=organization").Code)
+	})
+
+	t.Run("filter", func(t *testing.T) {
+		get := func(filter string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/repos/"+repo.ID.String()+"/runs?filter="+url.QueryEscape(filter), nil)
+			req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+			server.router.ServeHTTP(w, req)
+			return w
+		}
+		total := func(w *httptest.ResponseRecorder) float64 {
+			require.Equal(t, http.StatusOK, w.Code)
+			var response map[string]interface{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			return response["pagination"].(map[string]interface{})["total"].(float64)
+		}
+
+		assert.Equal(t, float64(2), total(get("co2_kg<=0.3 AND branch!=main")))
+		assert.Equal(t, float64(0), total(get("co2_kg>0.3 OR branch IN (main)")))
+		assert.Equal(t, http.StatusBadRequest, get("co2_kg>").Code)
+	})
+
+	t.Run("sort", func(t *testing.T) {
+		get := func(query string) int {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/repos/"+repo.ID.String()+"/runs?"+query, nil)
+			req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+			server.router.ServeHTTP(w, req)
+			return w.Code
+		}
+
+		assert.Equal(t, http.StatusOK, get("sort=duration_s&order=asc"))
+		assert.Equal(t, http.StatusBadRequest, get("sort=branch_name"))
+		assert.Equal(t, http.StatusBadRequest, get("order=random"))
+	})
+
 	t.Run("invalid repository ID", func(t *testing.T) {
 		w := httptest.NewRecorder()
 		req, _ := http.NewRequest("GET", "/repos/invalid-uuid/runs", nil)
@@ -411,7 +746,7 @@ func TestHandleGetRepositoryRuns(t *testing.T) {
 	})
 }
 
-func TestHandleLogout(t *testing.T) {
+func TestHandleListMyRuns(t *testing.T) {
 	server, cleanup := setupTestServer(t)
 	defer cleanup()
 
@@ -419,36 +754,8094 @@ func TestHandleLogout(t *testing.T) {
 	user := createTestUser(t, database)
 	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
 
-	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("POST", "/auth/logout", nil)
-	req.AddCookie(&http.Cookie{
-		Name:  "ecoci_token",
-		Value: token,
+	other := &db.User{GitHubID: 54321, GitHubUsername: "otheruser"}
+	require.NoError(t, database.Create(other).Error)
+
+	repo := createTestRepository(t, database, user.ID)
+	now := time.Now().UTC()
+	for i, co2 := range []float64{0.2, 0.9, 0.5} {
+		run := &db.Run{UserID: user.ID, RepositoryID: repo.ID, CO2Kg: co2, EnergyKWh: 1 - co2, DurationS: 60}
+		require.NoError(t, database.Create(run).Error)
+		require.NoError(t, database.Model(run).Update("created_at", now.Add(time.Duration(i)*time.Minute)).Error)
+	}
+	// Runs of other users in the same repository are not listed
+	createTestRun(t, database, other.ID, repo.ID)
+
+	list := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/me/runs"+query, nil)
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	co2 := func(w *httptest.ResponseRecorder) []float64 {
+		require.Equal(t, http.StatusOK, w.Code)
+		var response runsResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		values := []float64{}
+		for _, run := range response.Runs {
+			values = append(values, run.CO2Kg)
+		}
+		return values
+	}
+
+	t.Run("newest first by default", func(t *testing.T) {
+		assert.Equal(t, []float64{0.5, 0.9, 0.2}, co2(list("")))
 	})
-	
-	server.router.ServeHTTP(w, req)
-	
-	assert.Equal(t, http.StatusOK, w.Code)
-	
-	var response map[string]interface{}
-	err := json.Unmarshal(w.Body.Bytes(), &response)
-	require.NoError(t, err)
-	
-	assert.Equal(t, "Successfully logged out", response["message"])
-	
-	// Check that cookie is cleared
-	cookies := w.Result().Cookies()
-	var tokenCookie *http.Cookie
-	for _, cookie := range cookies {
-		if cookie.Name == "ecoci_token" {
-			tokenCookie = cookie
-			break
+
+	t.Run("sorted", func(t *testing.T) {
+		assert.Equal(t, []float64{0.9, 0.5, 0.2}, co2(list("?sort=co2_kg")))
+		assert.Equal(t, []float64{0.2, 0.5, 0.9}, co2(list("?sort=co2_kg&order=asc")))
+		assert.Equal(t, []float64{0.9, 0.5, 0.2}, co2(list("?sort=energy_kwh&order=asc")))
+		assert.Equal(t, []float64{0.2, 0.9, 0.5}, co2(list("?sort=created_at&order=asc")))
+		assert.Equal(t, []float64{0.9}, co2(list("?sort=co2_kg&limit=1")))
+		assert.Equal(t, []float64{0.5}, co2(list("?sort=co2_kg&limit=1&page=2")))
+	})
+
+	t.Run("filtered", func(t *testing.T) {
+		assert.Equal(t, []float64{0.2, 0.5}, co2(list("?sort=co2_kg&order=asc&filter="+url.QueryEscape("co2_kg<0.9"))))
+		assert.Empty(t, co2(list("?repository_id="+uuid.New().String())))
+	})
+
+	t.Run("rejects invalid parameters", func(t *testing.T) {
+		w := list("?sort=password")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "INVALID_SORT")
+
+		w = list("?order=sideways")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "INVALID_ORDER")
+	})
+}
+
+func TestHandleSearchRuns(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	other := &db.User{GitHubID: 54321, GitHubUsername: "otheruser"}
+	require.NoError(t, database.Create(other).Error)
+
+	repo := createTestRepository(t, database, user.ID)
+	privateRepo := &db.Repository{
+		OwnerID:      other.ID,
+		GitHubRepoID: 11111,
+		Name:         "secret",
+		FullName:     "otheruser/secret",
+		HTMLURL:      "https://github.com/otheruser/secret",
+		Private:      true,
+	}
+	require.NoError(t, database.Create(privateRepo).Error)
+
+	createRun := func(userID, repoID uuid.UUID, workflow, branch string, metadata db.JSONB) *db.Run {
+		run := &db.Run{
+			UserID:       userID,
+			RepositoryID: repoID,
+			EnergyKWh:    0.5,
+			CO2Kg:        0.3,
+			DurationS:    120,
+			WorkflowName: stringPtr(workflow),
+			BranchName:   stringPtr(branch),
+			RunMetadata:  metadata,
 		}
+		require.NoError(t, database.Create(run).Error)
+		return run
 	}
-	
-	require.NotNil(t, tokenCookie)
-	assert.Equal(t, "", tokenCookie.Value)
-	assert.Equal(t, -1, tokenCookie.MaxAge)
+	nightly := createRun(user.ID, repo.ID, "Nightly Build", "main", db.JSONB{"tag": "nightly", "commit_message": "Bump 50% of the cache"})
+	release := createRun(user.ID, repo.ID, "Release", "release/1.2", db.JSONB{"tag": "release"})
+	createRun(other.ID, privateRepo.ID, "Nightly Build", "main", db.JSONB{"tag": "nightly"})
+
+	search := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/runs/search"+query, nil)
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	runIDs := func(w *httptest.ResponseRecorder) []string {
+		var response runsResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		ids := []string{}
+		for _, run := range response.Runs {
+			ids = append(ids, run.ID.String())
+		}
+		return ids
+	}
+
+	t.Run("matches workflow, branch and metadata of visible runs", func(t *testing.T) {
+		w := search("?q=nightly")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{nightly.ID.String()}, runIDs(w))
+
+		w = search("?q=RELEASE%2F1.2")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{release.ID.String()}, runIDs(w))
+	})
+
+	t.Run("filtered", func(t *testing.T) {
+		w := search("?q=e")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, runIDs(w), 2)
+
+		w = search("?q=e&filter=" + url.QueryEscape("branch!=main"))
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{release.ID.String()}, runIDs(w))
+
+		w = search("?q=e&filter=" + url.QueryEscape("branch"))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("sorted", func(t *testing.T) {
+		require.NoError(t, database.Model(release).Update("co2_kg", 2).Error)
+
+		w := search("?q=e&sort=co2_kg")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{release.ID.String(), nightly.ID.String()}, runIDs(w))
+
+		w = search("?q=e&sort=co2_kg&order=asc")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{nightly.ID.String(), release.ID.String()}, runIDs(w))
+
+		w = search("?q=e&sort=relevance")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("every word must match", func(t *testing.T) {
+		w := search("?q=nightly+main")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{nightly.ID.String()}, runIDs(w))
+
+		w = search("?q=nightly+release")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, runIDs(w))
+	})
+
+	t.Run("wildcards are matched literally", func(t *testing.T) {
+		w := search("?q=50%25")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{nightly.ID.String()}, runIDs(w))
+
+		w = search("?q=%25")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Len(t, runIDs(w), 1)
+	})
+
+	t.Run("within a repository", func(t *testing.T) {
+		w := search("?q=nightly&repository_id=" + privateRepo.ID.String())
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, runIDs(w))
+
+		w = search("?q=nightly&repository_id=not-a-uuid")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("requires a query", func(t *testing.T) {
+		w := search("?q=+")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "MISSING_QUERY")
+	})
+}
+
+func TestHandleRepositoryTimeSeries(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	repo := createTestRepository(t, database, user.ID)
+	now := time.Now().UTC()
+	for _, createdAt := range []time.Time{now, now, now.AddDate(0, 0, -2)} {
+		run := createTestRun(t, database, user.ID, repo.ID)
+		require.NoError(t, database.Model(run).Update("created_at", createdAt).Error)
+	}
+
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/repos/"+repo.ID.String()+"/timeseries"+query, nil)
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("daily buckets include empty days", func(t *testing.T) {
+		from := now.AddDate(0, 0, -3).Format("2006-01-02")
+		w := get("?metric=co2_kg&interval=day&from=" + from)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Points []struct {
+				Sum   float64 `json:"sum"`
+				Count int64   `json:"count"`
+			} `json:"points"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Points, 4)
+
+		assert.Equal(t, int64(0), response.Points[0].Count)
+		assert.Equal(t, int64(1), response.Points[1].Count)
+		assert.Equal(t, int64(0), response.Points[2].Count)
+		assert.Equal(t, int64(2), response.Points[3].Count)
+		assert.InDelta(t, 0.6, response.Points[3].Sum, 0.0001)
+	})
+
+	t.Run("invalid metric", func(t *testing.T) {
+		w := get("?metric=bogus")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("invalid interval", func(t *testing.T) {
+		w := get("?interval=hour")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("range too large", func(t *testing.T) {
+		w := get("?interval=day&from=2000-01-01")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestHandleRepositoryStatsCompare(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	repo := createTestRepository(t, database, user.ID)
+	now := time.Now().UTC()
+	for _, createdAt := range []time.Time{now.Add(-time.Hour), now.Add(-2 * time.Hour), now.AddDate(0, 0, -40)} {
+		run := createTestRun(t, database, user.ID, repo.ID)
+		require.NoError(t, database.Model(run).Update("created_at", createdAt).Error)
+	}
+
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/repos/"+repo.ID.String()+"/stats"+query, nil)
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("previous period comparison", func(t *testing.T) {
+		w := get("?compare=previous_period")
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Summary struct {
+				TotalCO2Kg float64 `json:"total_co2_kg"`
+				RunCount   int64   `json:"run_count"`
+			} `json:"summary"`
+			Comparison struct {
+				Changes map[string]struct {
+					Absolute float64  `json:"absolute"`
+					Percent  *float64 `json:"percent"`
+				} `json:"changes"`
+			} `json:"comparison"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+		assert.Equal(t, int64(2), response.Summary.RunCount)
+		assert.InDelta(t, 0.6, response.Summary.TotalCO2Kg, 0.0001)
+
+		co2 := response.Comparison.Changes["co2_kg"]
+		assert.InDelta(t, 0.3, co2.Absolute, 0.0001)
+		require.NotNil(t, co2.Percent)
+		assert.InDelta(t, 100.0, *co2.Percent, 0.0001)
+
+		runs := response.Comparison.Changes["run_count"]
+		assert.Equal(t, 1.0, runs.Absolute)
+	})
+
+	t.Run("percent is null without previous data", func(t *testing.T) {
+		w := get("?compare=previous_period&from=" + now.AddDate(0, 0, -50).Format(time.RFC3339))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		changes := response["comparison"].(map[string]interface{})["changes"].(map[string]interface{})
+		assert.Nil(t, changes["co2_kg"].(map[string]interface{})["percent"])
+	})
+
+	t.Run("invalid compare", func(t *testing.T) {
+		w := get("?compare=last_year")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestHandleRepositoryWorkflowStats(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	repo := createTestRepository(t, database, user.ID)
+	for _, co2 := range []float64{1, 2, 3, 4, 5} {
+		run := &db.Run{
+			UserID:       user.ID,
+			RepositoryID: repo.ID,
+			EnergyKWh:    co2,
+			CO2Kg:        co2,
+			DurationS:    co2 * 60,
+			WorkflowName: stringPtr("build"),
+		}
+		require.NoError(t, database.Create(run).Error)
+	}
+	for _, co2 := range []float64{0.5, 1.5} {
+		run := &db.Run{
+			UserID:       user.ID,
+			RepositoryID: repo.ID,
+			EnergyKWh:    co2,
+			CO2Kg:        co2,
+			DurationS:    co2 * 60,
+			WorkflowName: stringPtr("lint"),
+		}
+		require.NoError(t, database.Create(run).Error)
+	}
+	createTestRun(t, database, user.ID, repo.ID)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/repos/"+repo.ID.String()+"/workflows/stats", nil)
+	req.AddCookie(&http.Cookie{
+		Name:  "ecoci_token",
+		Value: token,
+	})
+	server.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Workflows []struct {
+			WorkflowName *string `json:"workflow_name"`
+			RunCount     int64   `json:"run_count"`
+			Percentiles  struct {
+				CO2Kg struct {
+					P50 float64 `json:"p50"`
+					P90 float64 `json:"p90"`
+				} `json:"co2_kg"`
+				DurationS struct {
+					P50 float64 `json:"p50"`
+				} `json:"duration_s"`
+			} `json:"percentiles"`
+		} `json:"workflows"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Workflows, 3)
+
+	build := response.Workflows[0]
+	require.NotNil(t, build.WorkflowName)
+	assert.Equal(t, "build", *build.WorkflowName)
+	assert.Equal(t, int64(5), build.RunCount)
+	assert.InDelta(t, 3.0, build.Percentiles.CO2Kg.P50, 0.0001)
+	assert.InDelta(t, 4.6, build.Percentiles.CO2Kg.P90, 0.0001)
+	assert.InDelta(t, 180.0, build.Percentiles.DurationS.P50, 0.0001)
+
+	// Percentiles are computed per workflow, including the runs without a workflow name
+	lint := response.Workflows[1]
+	require.NotNil(t, lint.WorkflowName)
+	assert.Equal(t, "lint", *lint.WorkflowName)
+	assert.InDelta(t, 1.0, lint.Percentiles.CO2Kg.P50, 0.0001)
+	assert.InDelta(t, 60.0, lint.Percentiles.DurationS.P50, 0.0001)
+
+	assert.Nil(t, response.Workflows[2].WorkflowName)
+	assert.InDelta(t, 0.3, response.Workflows[2].Percentiles.CO2Kg.P50, 0.0001)
+	assert.InDelta(t, 120.0, response.Workflows[2].Percentiles.DurationS.P50, 0.0001)
+}
+
+func TestHandleRepositoryExportXLSX(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	repo := createTestRepository(t, database, user.ID)
+	createTestRun(t, database, user.ID, repo.ID)
+	createTestRun(t, database, user.ID, repo.ID)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/repos/"+repo.ID.String()+"/export.xlsx", nil)
+	req.AddCookie(&http.Cookie{
+		Name:  "ecoci_token",
+		Value: token,
+	})
+	server.router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+
+	workbook, err := excelize.OpenReader(w.Body)
+	require.NoError(t, err)
+	defer workbook.Close()
+
+	assert.Equal(t, []string{"Runs", "Monthly", "Workflows"}, workbook.GetSheetList())
+
+	runs, err := workbook.GetRows("Runs")
+	require.NoError(t, err)
+	assert.Len(t, runs, 3)
+	assert.Equal(t, repo.FullName, runs[1][1])
+
+	monthly, err := workbook.GetRows("Monthly")
+	require.NoError(t, err)
+	require.Len(t, monthly, 2)
+	assert.Equal(t, "2", monthly[1][1])
+}
+
+func TestHandleLeaderboard(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	now := time.Now().UTC()
+	newRepo := func(githubRepoID int64, name string, private bool) *db.Repository {
+		repo := &db.Repository{
+			OwnerID:      user.ID,
+			GitHubRepoID: githubRepoID,
+			Name:         name,
+			FullName:     "testuser/" + name,
+			HTMLURL:      "https://github.com/testuser/" + name,
+			Private:      private,
+		}
+		require.NoError(t, database.Create(repo).Error)
+		return repo
+	}
+	addRun := func(repo *db.Repository, co2 float64, createdAt time.Time) {
+		run := &db.Run{UserID: user.ID, RepositoryID: repo.ID, CO2Kg: co2, EnergyKWh: co2, DurationS: 60}
+		require.NoError(t, database.Create(run).Error)
+		require.NoError(t, database.Model(run).Update("created_at", createdAt).Error)
+	}
+
+	efficient := newRepo(1001, "efficient", false)
+	heavy := newRepo(1002, "heavy", false)
+	hidden := newRepo(1003, "hidden", false)
+	secret := newRepo(1004, "secret", true)
+
+	addRun(efficient, 1, now.AddDate(0, 0, -1))
+	addRun(efficient, 2, now.AddDate(0, 0, -40))
+	addRun(heavy, 5, now.AddDate(0, 0, -1))
+	addRun(heavy, 6, now.AddDate(0, 0, -40))
+	addRun(hidden, 0.1, now.AddDate(0, 0, -1))
+	addRun(secret, 0.1, now.AddDate(0, 0, -1))
+
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/leaderboard"+query, nil)
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	optIn := func(repo *db.Repository) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PATCH", "/repos/"+repo.ID.String()+"/settings", bytes.NewBufferString(`{"public_stats": true}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+	optIn(efficient)
+	optIn(heavy)
+	optIn(secret)
+
+	// Deleted repositories leave the leaderboard even while they can be restored
+	deleted := newRepo(1005, "deleted", false)
+	addRun(deleted, 0.1, now.AddDate(0, 0, -1))
+	addRun(deleted, 0.2, now.AddDate(0, 0, -40))
+	optIn(deleted)
+	require.NoError(t, database.Delete(deleted).Error)
+
+	type entry struct {
+		FullName    string   `json:"full_name"`
+		Rank        int      `json:"rank"`
+		ReductionKg *float64 `json:"reduction_kg"`
+	}
+
+	t.Run("rank by co2 per run without authentication", func(t *testing.T) {
+		w := get("")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Entries []entry `json:"entries"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Entries, 2)
+		assert.Equal(t, "testuser/efficient", response.Entries[0].FullName)
+		assert.Equal(t, 1, response.Entries[0].Rank)
+		assert.Equal(t, "testuser/heavy", response.Entries[1].FullName)
+	})
+
+	t.Run("rank by reduction", func(t *testing.T) {
+		w := get("?rank_by=reduction&period=month")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Entries []entry `json:"entries"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Entries, 2)
+		require.NotNil(t, response.Entries[0].ReductionKg)
+		assert.InDelta(t, 1.0, *response.Entries[0].ReductionKg, 0.0001)
+	})
+
+	t.Run("reduction requires bounded period", func(t *testing.T) {
+		w := get("?rank_by=reduction&period=all")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("invalid period", func(t *testing.T) {
+		w := get("?period=decade")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestHandleCommitStats(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	repo := createTestRepository(t, database, user.ID)
+	shaA := strings.Repeat("a", 40)
+	shaB := strings.Repeat("b", 40)
+	now := time.Now().UTC()
+	for i, commit := range []struct {
+		sha string
+		co2 float64
+	}{{shaA, 1}, {shaA, 2}, {shaB, 4}} {
+		run := &db.Run{
+			UserID:       user.ID,
+			RepositoryID: repo.ID,
+			CO2Kg:        commit.co2,
+			EnergyKWh:    commit.co2,
+			DurationS:    60,
+			GitCommitSHA: stringPtr(commit.sha),
+			BranchName:   stringPtr("main"),
+		}
+		require.NoError(t, database.Create(run).Error)
+		require.NoError(t, database.Model(run).Update("created_at", now.Add(time.Duration(i-3)*time.Hour)).Error)
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/repos/"+repo.ID.String()+path, nil)
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("commit stats", func(t *testing.T) {
+		w := get("/commits/" + shaA + "/stats")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, shaA, response["sha"])
+		assert.Equal(t, float64(2), response["run_count"])
+		assert.InDelta(t, 1.5, response["avg_co2_kg"], 0.0001)
+	})
+
+	t.Run("unknown commit", func(t *testing.T) {
+		w := get("/commits/" + strings.Repeat("c", 40) + "/stats")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("invalid sha", func(t *testing.T) {
+		w := get("/commits/not-a-sha/stats")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("commit series", func(t *testing.T) {
+		w := get("/commits?branch=main")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Commits []struct {
+				SHA           string   `json:"sha"`
+				AvgCO2KgDelta *float64 `json:"avg_co2_kg_delta"`
+			} `json:"commits"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Commits, 2)
+		assert.Equal(t, shaA, response.Commits[0].SHA)
+		assert.Nil(t, response.Commits[0].AvgCO2KgDelta)
+		assert.Equal(t, shaB, response.Commits[1].SHA)
+		require.NotNil(t, response.Commits[1].AvgCO2KgDelta)
+		assert.InDelta(t, 2.5, *response.Commits[1].AvgCO2KgDelta, 0.0001)
+	})
+}
+
+func TestReleaseStats(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	repo := createTestRepository(t, database, user.ID)
+	start := time.Now().UTC().AddDate(0, 0, -10).Truncate(time.Hour)
+	for i, run := range []struct {
+		tag *string
+		co2 float64
+	}{
+		{nil, 1},
+		{stringPtr("v1.0.0"), 2},
+		{nil, 4},
+		{nil, 8},
+		{stringPtr("v1.1.0"), 16},
+		{stringPtr("v1.1.0"), 32},
+		{nil, 64},
+	} {
+		r := &db.Run{UserID: user.ID, RepositoryID: repo.ID, CO2Kg: run.co2, EnergyKWh: run.co2 * 2, DurationS: 60, GitTag: run.tag}
+		require.NoError(t, database.Create(r).Error)
+		require.NoError(t, database.Model(r).Update("created_at", start.Add(time.Duration(i)*time.Hour)).Error)
+	}
+
+	get := func(tag string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/repos/"+repo.ID.String()+"/releases/"+tag+"/stats", nil)
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("CI since the previous release", func(t *testing.T) {
+		w := get("v1.1.0")
+		require.Equal(t, http.StatusOK, w.Code)
+		var stats service.ReleaseStats
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+		require.NotNil(t, stats.PreviousTag)
+		assert.Equal(t, "v1.0.0", *stats.PreviousTag)
+		require.NotNil(t, stats.From)
+		assert.True(t, stats.From.Equal(start.Add(time.Hour)))
+		assert.True(t, stats.ReleasedAt.Equal(start.Add(5*time.Hour)))
+		assert.Equal(t, int64(2), stats.TaggedRunCount)
+		assert.Equal(t, int64(4), stats.RunCount)
+		assert.InDelta(t, 60, stats.TotalCO2Kg, 1e-9)
+		assert.InDelta(t, 120, stats.TotalEnergyKWh, 1e-9)
+	})
+
+	t.Run("first release", func(t *testing.T) {
+		w := get("v1.0.0")
+		require.Equal(t, http.StatusOK, w.Code)
+		var stats service.ReleaseStats
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+		assert.Nil(t, stats.PreviousTag)
+		assert.Nil(t, stats.From)
+		assert.Equal(t, int64(2), stats.RunCount)
+		assert.InDelta(t, 3, stats.TotalCO2Kg, 1e-9)
+	})
+
+	t.Run("unknown tag", func(t *testing.T) {
+		w := get("v2.0.0")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "RELEASE_NOT_FOUND")
+	})
+
+	t.Run("submit and filter by tag", func(t *testing.T) {
+		body, _ := json.Marshal(service.RunCreateRequest{
+			EnergyKWh: 1, CO2Kg: 0.5, DurationS: 60, GitTag: stringPtr(strings.Repeat("v", 256)),
+			Repository: service.RepositoryCreateRequest{Name: "testrepo", FullName: "testuser/testrepo", HTMLURL: "https://github.com/testuser/testrepo"},
+		})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/runs", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+		server.router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("GET", "/repos/"+repo.ID.String()+"/runs?filter="+url.QueryEscape("git_tag=v1.1.0"), nil)
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+		server.router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Runs []db.Run `json:"runs"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Len(t, response.Runs, 2)
+	})
+}
+
+func TestHandleGetRepositoryWorkflowRuns(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	user := createTestUser(t, server.db)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	request := func(method, path string, body []byte) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	submit := func(group, branch string, co2, duration float64) *httptest.ResponseRecorder {
+		runData := service.RunCreateRequest{
+			EnergyKWh: co2 * 2,
+			CO2Kg:     co2,
+			DurationS: duration,
+			Repository: service.RepositoryCreateRequest{
+				Name:     "testrepo",
+				FullName: "testuser/testrepo",
+				HTMLURL:  "https://github.com/testuser/testrepo",
+			},
+			BranchName: &branch,
+		}
+		if group != "" {
+			runData.WorkflowRunGroup = &group
+		}
+		body, _ := json.Marshal(runData)
+		return request("POST", "/runs", body)
+	}
+
+	// A matrix build of three jobs, a build of one job and a run without a group
+	var repoID uuid.UUID
+	for _, job := range []struct {
+		group    string
+		branch   string
+		co2      float64
+		duration float64
+	}{
+		{"github-actions/100/1", "main", 1, 60},
+		{"github-actions/100/1", "main", 2, 120},
+		{"github-actions/100/1", "main", 0.5, 90},
+		{"github-actions/101/1", "feature", 4, 30},
+		{"", "main", 0.25, 10},
+	} {
+		w := submit(job.group, job.branch, job.co2, job.duration)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var run db.Run
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &run))
+		if job.group != "" {
+			require.NotNil(t, run.WorkflowRunGroup)
+			assert.Equal(t, job.group, *run.WorkflowRunGroup)
+		}
+		repoID = run.RepositoryID
+	}
+
+	list := func(query string) workflowRunsResponse {
+		w := request("GET", "/repos/"+repoID.String()+"/workflow-runs"+query, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var response workflowRunsResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+
+	t.Run("collapses groups", func(t *testing.T) {
+		response := list("")
+		assert.Equal(t, int64(3), response.Pagination.Total)
+		require.Len(t, response.WorkflowRuns, 3)
+
+		executions := map[string]service.WorkflowRun{}
+		for _, execution := range response.WorkflowRuns {
+			if execution.WorkflowRunGroup != nil {
+				assert.Nil(t, execution.RunID)
+				executions[*execution.WorkflowRunGroup] = execution
+			} else {
+				require.NotNil(t, execution.RunID)
+				assert.Equal(t, int64(1), execution.RunCount)
+				assert.InDelta(t, 0.25, execution.TotalCO2Kg, 1e-9)
+			}
+		}
+		matrix := executions["github-actions/100/1"]
+		assert.Equal(t, int64(3), matrix.RunCount)
+		assert.InDelta(t, 3.5, matrix.TotalCO2Kg, 1e-9)
+		assert.InDelta(t, 7, matrix.TotalEnergyKWh, 1e-9)
+		assert.InDelta(t, 270, matrix.TotalDurationS, 1e-9)
+		assert.InDelta(t, 120, matrix.MaxDurationS, 1e-9)
+		assert.Equal(t, "main", *matrix.BranchName)
+		assert.Equal(t, int64(1), executions["github-actions/101/1"].RunCount)
+	})
+
+	t.Run("pagination and filter", func(t *testing.T) {
+		response := list("?limit=2&page=2")
+		assert.Len(t, response.WorkflowRuns, 1)
+		assert.False(t, response.Pagination.HasNext)
+
+		response = list("?filter=branch=feature")
+		require.Len(t, response.WorkflowRuns, 1)
+		assert.Equal(t, "github-actions/101/1", *response.WorkflowRuns[0].WorkflowRunGroup)
+
+		assert.Equal(t, http.StatusBadRequest, request("GET", "/repos/"+repoID.String()+"/workflow-runs?filter=nonsense>1", nil).Code)
+	})
+
+	t.Run("runs of a group", func(t *testing.T) {
+		w := request("GET", "/repos/"+repoID.String()+"/runs?filter=workflow_run_group=github-actions/100/1", nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var response runsResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Len(t, response.Runs, 3)
+	})
+
+	t.Run("per-execution aggregates", func(t *testing.T) {
+		w := request("GET", "/repos/"+repoID.String()+"/runs/aggregate?group_by=workflow_run_group", nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var response struct {
+			Groups []service.GroupAggregate `json:"groups"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Groups, 3)
+		assert.Equal(t, "github-actions/101/1", *response.Groups[0].Key)
+		assert.Equal(t, "github-actions/100/1", *response.Groups[1].Key)
+		assert.InDelta(t, 3.5, response.Groups[1].Sum, 1e-9)
+		assert.Nil(t, response.Groups[2].Key)
+	})
+
+	t.Run("group too long", func(t *testing.T) {
+		w := submit(strings.Repeat("x", 256), "main", 1, 60)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	})
+}
+
+func TestHandleAggregateRuns(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	repo := createTestRepository(t, database, user.ID)
+	for _, run := range []struct {
+		provider string
+		runnerOS string
+		co2      float64
+	}{{"github_actions", "Linux", 1}, {"github_actions", "macOS", 3}, {"gitlab_ci", "Linux", 0.5}} {
+		require.NoError(t, database.Create(&db.Run{
+			UserID:       user.ID,
+			RepositoryID: repo.ID,
+			CO2Kg:        run.co2,
+			EnergyKWh:    run.co2,
+			DurationS:    60,
+			RunMetadata:  db.JSONB{"ci_provider": run.provider, "runner_os": run.runnerOS},
+		}).Error)
+	}
+
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/repos/"+repo.ID.String()+"/runs/aggregate"+query, nil)
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("group by ci provider", func(t *testing.T) {
+		w := get("?group_by=ci_provider&metric=co2_kg")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Groups []struct {
+				Key   *string `json:"key"`
+				Count int64   `json:"count"`
+				Sum   float64 `json:"sum"`
+				Avg   float64 `json:"avg"`
+			} `json:"groups"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Groups, 2)
+		require.NotNil(t, response.Groups[0].Key)
+		assert.Equal(t, "github_actions", *response.Groups[0].Key)
+		assert.Equal(t, int64(2), response.Groups[0].Count)
+		assert.InDelta(t, 4.0, response.Groups[0].Sum, 0.0001)
+		assert.InDelta(t, 2.0, response.Groups[0].Avg, 0.0001)
+	})
+
+	t.Run("group by metadata key", func(t *testing.T) {
+		w := get("?group_by=metadata.runner_os")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			GroupBy string `json:"group_by"`
+			Groups  []struct {
+				Key   *string `json:"key"`
+				Count int64   `json:"count"`
+				Sum   float64 `json:"sum"`
+			} `json:"groups"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "metadata.runner_os", response.GroupBy)
+		require.Len(t, response.Groups, 2)
+		assert.Equal(t, "macOS", *response.Groups[0].Key)
+		assert.InDelta(t, 3.0, response.Groups[0].Sum, 0.0001)
+		assert.Equal(t, "Linux", *response.Groups[1].Key)
+		assert.Equal(t, int64(2), response.Groups[1].Count)
+
+		// Runs without the key form one group
+		w = get("?group_by=metadata.cache_hit")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Groups, 1)
+		assert.Nil(t, response.Groups[0].Key)
+		assert.Equal(t, int64(3), response.Groups[0].Count)
+
+		for _, groupBy := range []string{"metadata.", "metadata.runner-os", "metadata.a')--", "metadata.a.b"} {
+			w = get("?group_by=" + url.QueryEscape(groupBy))
+			assert.Equal(t, http.StatusBadRequest, w.Code, groupBy)
+		}
+	})
+
+	t.Run("filtered", func(t *testing.T) {
+		w := get("?group_by=ci_provider&filter=" + url.QueryEscape("co2_kg>=1 AND ci_provider IN (github_actions,gitlab_ci)"))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Groups []struct {
+				Key   *string `json:"key"`
+				Count int64   `json:"count"`
+			} `json:"groups"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Groups, 1)
+		assert.Equal(t, "github_actions", *response.Groups[0].Key)
+		assert.Equal(t, int64(2), response.Groups[0].Count)
+
+		w = get("?group_by=ci_provider&filter=" + url.QueryEscape("region=eu"))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "INVALID_FILTER")
+		assert.Contains(t, w.Body.String(), `unknown field \"region\"`)
+	})
+
+	t.Run("missing group_by", func(t *testing.T) {
+		w := get("")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestHandleRunHistogram(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	repo := createTestRepository(t, database, user.ID)
+	for _, duration := range []float64{10, 20, 30, 40, 100} {
+		require.NoError(t, database.Create(&db.Run{
+			UserID:       user.ID,
+			RepositoryID: repo.ID,
+			CO2Kg:        0.1,
+			EnergyKWh:    0.1,
+			DurationS:    duration,
+		}).Error)
+	}
+
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/repos/"+repo.ID.String()+"/runs/histogram"+query, nil)
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	histogram := func(w *httptest.ResponseRecorder) histogramResponse {
+		require.Equal(t, http.StatusOK, w.Code)
+		var response histogramResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+
+	t.Run("buckets of equal width", func(t *testing.T) {
+		response := histogram(get("?metric=duration_s&buckets=4"))
+		assert.Equal(t, int64(5), response.Count)
+		assert.Equal(t, 10.0, response.Min)
+		assert.Equal(t, 100.0, response.Max)
+		require.Len(t, response.Buckets, 4)
+
+		counts := []int64{}
+		for _, bucket := range response.Buckets {
+			counts = append(counts, bucket.Count)
+		}
+		assert.Equal(t, []int64{3, 1, 0, 1}, counts)
+		assert.Equal(t, 10.0, response.Buckets[0].Lower)
+		assert.Equal(t, 32.5, response.Buckets[0].Upper)
+		assert.Equal(t, 100.0, response.Buckets[3].Upper)
+	})
+
+	t.Run("filtered", func(t *testing.T) {
+		response := histogram(get("?metric=duration_s&buckets=3&filter=" + url.QueryEscape("duration_s<=40")))
+		assert.Equal(t, int64(4), response.Count)
+		require.Len(t, response.Buckets, 3)
+		// 10 | 20 | 30 and 40, the maximum falling into the last bucket
+		assert.Equal(t, int64(1), response.Buckets[0].Count)
+		assert.Equal(t, int64(1), response.Buckets[1].Count)
+		assert.Equal(t, int64(2), response.Buckets[2].Count)
+	})
+
+	t.Run("equal values and no runs", func(t *testing.T) {
+		response := histogram(get("?metric=co2_kg"))
+		require.Len(t, response.Buckets, 1)
+		assert.Equal(t, int64(5), response.Buckets[0].Count)
+
+		response = histogram(get("?from=2020-01-01&to=2020-02-01"))
+		assert.Equal(t, int64(0), response.Count)
+		assert.Empty(t, response.Buckets)
+	})
+
+	t.Run("invalid parameters", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, get("?metric=cost").Code)
+		assert.Equal(t, http.StatusBadRequest, get("?buckets=0").Code)
+		assert.Equal(t, http.StatusBadRequest, get("?buckets=101").Code)
+		assert.Equal(t, http.StatusBadRequest, get("?buckets=many").Code)
+	})
+}
+
+func TestHandleRecommendations(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	repo := createTestRepository(t, database, user.ID)
+	day := time.Now().UTC().AddDate(0, 0, -2).Truncate(24 * time.Hour)
+	createRun := func(workflow string, co2, energy, duration float64, hour int, metadata db.JSONB) {
+		require.NoError(t, database.Create(&db.Run{
+			UserID:       user.ID,
+			RepositoryID: repo.ID,
+			WorkflowName: &workflow,
+			CO2Kg:        co2,
+			EnergyKWh:    energy,
+			DurationS:    duration,
+			RunMetadata:  metadata,
+			CreatedAt:    day.Add(time.Duration(hour) * time.Hour),
+		}).Error)
+	}
+	for i := 0; i < 3; i++ {
+		// Cold caches emit 0.2 kg more per run
+		createRun("build", 0.1, 0.2, 60, 8, db.JSONB{"cache_hit": true})
+		createRun("build", 0.3, 0.6, 180, 8, db.JSONB{"cache_hit": "false"})
+		// Scheduled at noon on a grid four times dirtier than at night
+		createRun("nightly", 0.3, 1, 600, 12, db.JSONB{"github_event_name": "schedule", "carbon_intensity": 400.0})
+		// A quarter of four CPUs used for half the time
+		createRun("deploy", 0.2, 0.4, 120, 9, db.JSONB{"cpu_count": 4.0, "cpu_seconds": 60.0})
+	}
+	for i := 0; i < 10; i++ {
+		metadata := db.JSONB{"carbon_intensity": 100.0}
+		if i < 4 {
+			metadata["conclusion"] = "failure"
+		}
+		createRun("test", 0.2, 0.4, 120, 3, metadata)
+	}
+
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/repos/"+repo.ID.String()+"/recommendations"+query, nil)
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("largest savings first", func(t *testing.T) {
+		w := get("")
+		require.Equal(t, http.StatusOK, w.Code)
+		var response service.Recommendations
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+		assert.Equal(t, int64(22), response.RunCount)
+		require.Len(t, response.Recommendations, 4)
+
+		expected := []struct {
+			kind     string
+			workflow string
+			runs     int64
+			savings  float64
+		}{
+			// 3 runs × 1 kWh × (400 - 100) g/kWh
+			{service.RecommendationOffPeak, "nightly", 3, 0.9},
+			{service.RecommendationColdCache, "build", 6, 0.6},
+			{service.RecommendationFailedRuns, "test", 4, 0.4},
+			{service.RecommendationOversizedRunner, "deploy", 3, 0.3},
+		}
+		for i, want := range expected {
+			got := response.Recommendations[i]
+			assert.Equal(t, want.kind, got.Type)
+			require.NotNil(t, got.WorkflowName)
+			assert.Equal(t, want.workflow, *got.WorkflowName)
+			assert.Equal(t, want.runs, got.Runs)
+			assert.InDelta(t, want.savings, got.EstimatedSavingsCO2Kg, 1e-9)
+			assert.NotEmpty(t, got.Detail)
+		}
+		assert.Contains(t, response.Recommendations[0].Title, "03:00 UTC")
+		assert.InDelta(t, 2.2, response.EstimatedSavingsCO2Kg, 1e-9)
+	})
+
+	t.Run("no runs", func(t *testing.T) {
+		w := get("?from=2020-01-01&to=2020-02-01")
+		require.Equal(t, http.StatusOK, w.Code)
+		var response service.Recommendations
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, int64(0), response.RunCount)
+		assert.Empty(t, response.Recommendations)
+	})
+
+	t.Run("invalid range", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, get("?from=yesterday").Code)
+	})
+}
+
+func TestHandleCompareBranches(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	repo := createTestRepository(t, database, user.ID)
+	now := time.Now().UTC()
+	for _, run := range []struct {
+		branch   string
+		co2      float64
+		duration float64
+		daysAgo  int
+	}{
+		{"main", 1, 100, 1},
+		{"main", 3, 300, 5},
+		{"main", 10, 1000, 20},
+		{"feature-x", 3, 150, 2},
+		{"other", 5, 500, 1},
+	} {
+		branch := run.branch
+		r := &db.Run{UserID: user.ID, RepositoryID: repo.ID, BranchName: &branch, CO2Kg: run.co2, EnergyKWh: run.co2 * 2, DurationS: run.duration}
+		require.NoError(t, database.Create(r).Error)
+		require.NoError(t, database.Model(r).Update("created_at", now.AddDate(0, 0, -run.daysAgo)).Error)
+	}
+
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/repos/"+repo.ID.String()+"/compare"+query, nil)
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("deltas from base to head", func(t *testing.T) {
+		w := get("?base=main&head=feature-x")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var comparison service.BranchComparison
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &comparison))
+
+		// The run of main 20 days ago is outside the default window of 14 days
+		assert.Equal(t, int64(2), comparison.Base.RunCount)
+		assert.InDelta(t, 2, comparison.Base.AvgCO2Kg, 1e-9)
+		assert.Equal(t, int64(1), comparison.Head.RunCount)
+
+		co2 := comparison.Changes["co2_kg_per_run"]
+		assert.InDelta(t, 1, co2.Absolute, 1e-9)
+		require.NotNil(t, co2.Percent)
+		assert.InDelta(t, 50, *co2.Percent, 1e-9)
+		assert.InDelta(t, -50, comparison.Changes["duration_s_per_run"].Absolute, 1e-9)
+		assert.InDelta(t, -1, comparison.Changes["run_count"].Absolute, 1e-9)
+	})
+
+	t.Run("window in days", func(t *testing.T) {
+		w := get("?base=main&head=feature-x&window=30d")
+		require.Equal(t, http.StatusOK, w.Code)
+		var comparison service.BranchComparison
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &comparison))
+		assert.Equal(t, int64(3), comparison.Base.RunCount)
+	})
+
+	t.Run("branch without runs", func(t *testing.T) {
+		w := get("?base=main&head=unknown&window=36h")
+		require.Equal(t, http.StatusOK, w.Code)
+		var comparison service.BranchComparison
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &comparison))
+		assert.Equal(t, int64(1), comparison.Base.RunCount)
+		assert.Equal(t, int64(0), comparison.Head.RunCount)
+		assert.InDelta(t, -1, comparison.Changes["co2_kg_per_run"].Absolute, 1e-9)
+	})
+
+	t.Run("invalid parameters", func(t *testing.T) {
+		for _, query := range []string{
+			"?base=main",
+			"?head=feature-x",
+			"?base=main&head=feature-x&window=2w",
+			"?base=main&head=feature-x&window=0d",
+			"?base=main&head=feature-x&window=400d",
+		} {
+			assert.Equal(t, http.StatusBadRequest, get(query).Code, query)
+		}
+	})
+}
+
+func TestHandleWastedCarbon(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	repo := createTestRepository(t, database, user.ID)
+	now := time.Now().UTC()
+	for _, run := range []struct {
+		workflow string
+		co2      float64
+		daysAgo  int
+		metadata db.JSONB
+	}{
+		// Attempt 1 of run 500 failed and was retried
+		{"CI", 1, 2, db.JSONB{"github_run_id": "500", "github_run_attempt": "1", "conclusion": "failure"}},
+		{"CI", 1, 1, db.JSONB{"github_run_id": "500", "github_run_attempt": "2", "conclusion": "success"}},
+		{"CI", 1, 1, db.JSONB{"github_run_id": "501", "github_run_attempt": "1"}},
+		// Run 502 succeeded but was retried anyway
+		{"CI", 2, 1, db.JSONB{"github_run_id": 502, "github_run_attempt": 1}},
+		{"CI", 2, 1, db.JSONB{"github_run_id": 502, "github_run_attempt": 2}},
+		{"Lint", 0.5, 2, db.JSONB{"status": "Cancelled"}},
+		{"Lint", 0.5, 1, db.JSONB{"status": "success"}},
+		{"Docs", 1, 1, nil},
+	} {
+		workflow := run.workflow
+		r := &db.Run{UserID: user.ID, RepositoryID: repo.ID, WorkflowName: &workflow, CO2Kg: run.co2, EnergyKWh: run.co2 * 2, DurationS: 60, RunMetadata: run.metadata}
+		require.NoError(t, database.Create(r).Error)
+		require.NoError(t, database.Model(r).Update("created_at", now.AddDate(0, 0, -run.daysAgo)).Error)
+	}
+
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/repos/"+repo.ID.String()+"/wasted-carbon"+query, nil)
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("failed and retried runs", func(t *testing.T) {
+		w := get("?interval=day&from=" + now.AddDate(0, 0, -6).Format("2006-01-02"))
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var waste service.WastedCarbon
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &waste))
+
+		assert.Equal(t, int64(8), waste.RunCount)
+		assert.InDelta(t, 9, waste.TotalCO2Kg, 1e-9)
+		assert.Equal(t, int64(2), waste.Failed.RunCount)
+		assert.InDelta(t, 1.5, waste.Failed.CO2Kg, 1e-9)
+		assert.Equal(t, int64(1), waste.Retried.RunCount)
+		assert.InDelta(t, 2, waste.Retried.CO2Kg, 1e-9)
+		assert.InDelta(t, 3.5, waste.WastedCO2Kg, 1e-9)
+		require.NotNil(t, waste.WastedPercent)
+		assert.InDelta(t, 3.5/9*100, *waste.WastedPercent, 1e-9)
+
+		// Docs wasted nothing
+		require.Len(t, waste.Workflows, 2)
+		assert.Equal(t, "CI", *waste.Workflows[0].WorkflowName)
+		assert.InDelta(t, 3, waste.Workflows[0].WastedCO2Kg, 1e-9)
+		assert.Equal(t, "Lint", *waste.Workflows[1].WorkflowName)
+		assert.InDelta(t, 50, *waste.Workflows[1].WastedPercent, 1e-9)
+
+		require.Len(t, waste.Trend, 7)
+		var wasted, total float64
+		for _, point := range waste.Trend {
+			wasted += point.WastedCO2Kg
+			total += point.TotalCO2Kg
+		}
+		assert.InDelta(t, 3.5, wasted, 1e-9)
+		assert.InDelta(t, 9, total, 1e-9)
+		assert.Nil(t, waste.Trend[0].WastedPercent, "no runs")
+		// Both runs two days ago failed
+		assert.InDelta(t, 100, *waste.Trend[4].WastedPercent, 1e-9)
+	})
+
+	t.Run("invalid parameters", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, get("?interval=hour").Code)
+		assert.Equal(t, http.StatusBadRequest, get("?interval=day&from=2000-01-01").Code)
+	})
+}
+
+// hourlyIntensity forecasts the given intensities for the hours starting with the current one
+type hourlyIntensity []float64
+
+func (h hourlyIntensity) Name() string { return "hourly" }
+
+func (h hourlyIntensity) Forecast(ctx context.Context, region string, from, to time.Time) ([]carbon.Point, error) {
+	if region != "westeurope" {
+		return nil, carbon.ErrUnknownRegion
+	}
+	points := make([]carbon.Point, len(h))
+	for i, intensity := range h {
+		points[i] = carbon.Point{Time: from.Truncate(time.Hour).Add(time.Duration(i) * time.Hour), Intensity: intensity}
+	}
+	return points, nil
+}
+
+func TestHandleCarbonWindows(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	user := createTestUser(t, server.db)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/carbon/windows"+query, nil)
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	windows := func(w *httptest.ResponseRecorder) carbonWindowsResponse {
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var response carbonWindowsResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+
+	t.Run("regional averages", func(t *testing.T) {
+		response := windows(get("?region=swedencentral&duration=2h&horizon=7h"))
+		assert.Equal(t, "static", response.Provider)
+		assert.Equal(t, "2h0m0s", response.Duration)
+		require.NotNil(t, response.Now)
+		assert.Equal(t, 8.0, response.Now.Intensity)
+		// Every window is as clean as now, so the earliest ones are returned
+		require.Len(t, response.Windows, 3)
+		assert.Equal(t, response.Now.Start, response.Windows[0].Start)
+		require.NotNil(t, response.Windows[0].SavingsPercent)
+		assert.Equal(t, 0.0, *response.Windows[0].SavingsPercent)
+	})
+
+	t.Run("greenest hours first", func(t *testing.T) {
+		server.carbonIntensity = hourlyIntensity{400, 400, 400, 100, 100, 400, 200, 200, 400}
+		defer func() { server.carbonIntensity = carbon.Static{} }()
+
+		response := windows(get("?region=westeurope&duration=2h&horizon=9h&limit=2"))
+		assert.Equal(t, "hourly", response.Provider)
+		require.Len(t, response.Windows, 2)
+		hour := response.From.Truncate(time.Hour)
+		assert.Equal(t, hour.Add(3*time.Hour), response.Windows[0].Start)
+		assert.Equal(t, 100.0, response.Windows[0].Intensity)
+		assert.InDelta(t, 75, *response.Windows[0].SavingsPercent, 1e-9)
+		assert.Equal(t, hour.Add(6*time.Hour), response.Windows[1].Start)
+		assert.InDelta(t, 50, *response.Windows[1].SavingsPercent, 1e-9)
+
+		assert.Equal(t, http.StatusBadRequest, get("?region=eastus").Code)
+	})
+
+	t.Run("invalid parameters", func(t *testing.T) {
+		for _, query := range []string{
+			"",
+			"?region=westeurope&duration=5m",
+			"?region=westeurope&duration=soon",
+			"?region=westeurope&duration=3h&horizon=2h",
+			"?region=westeurope&horizon=96h",
+			"?region=westeurope&limit=11",
+			"?region=moon-base-1",
+		} {
+			assert.Equal(t, http.StatusBadRequest, get(query).Code, query)
+		}
+	})
+}
+
+func TestHandleRegionRecommendation(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	repo := createTestRepository(t, database, user.ID)
+	for _, daysAgo := range []int{3, 1} {
+		r := &db.Run{UserID: user.ID, RepositoryID: repo.ID, CO2Kg: 0.3, EnergyKWh: 1, DurationS: 600}
+		require.NoError(t, database.Create(r).Error)
+		require.NoError(t, database.Model(r).Update("created_at", time.Now().UTC().AddDate(0, 0, -daysAgo)).Error)
+	}
+
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/repos/"+repo.ID.String()+"/regions/recommendation"+query, nil)
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	recommend := func(query string) regionRecommendationResponse {
+		w := get(query)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var response regionRecommendationResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+	prices := "&prices=westeurope=0.008,francecentral=0.006,swedencentral=0.01"
+
+	t.Run("lowest carbon", func(t *testing.T) {
+		response := recommend("?regions=westeurope,francecentral,swedencentral" + prices)
+		assert.Equal(t, int64(2), response.Profile.RunCount)
+		assert.InDelta(t, 600, response.Profile.DurationS, 1e-9)
+		assert.Equal(t, "swedencentral", response.Recommended)
+		require.Len(t, response.Regions, 3)
+		assert.Equal(t, []string{"swedencentral", "francecentral", "westeurope"},
+			[]string{response.Regions[0].Region, response.Regions[1].Region, response.Regions[2].Region})
+
+		sweden := response.Regions[0]
+		require.NotNil(t, sweden.Current)
+		assert.Equal(t, 8.0, *sweden.Current)
+		require.NotNil(t, sweden.BestWindow)
+		assert.InDelta(t, 0.008, *sweden.CO2KgPerRun, 1e-9)
+		// Two runs in 30 days
+		assert.InDelta(t, 0.016, *sweden.CO2KgPerMonth, 1e-9)
+		assert.InDelta(t, 0.1, *sweden.CostPerRun, 1e-9)
+	})
+
+	t.Run("lowest cost", func(t *testing.T) {
+		response := recommend("?regions=westeurope,francecentral,swedencentral&optimize=cost" + prices)
+		assert.Equal(t, "francecentral", response.Recommended)
+		assert.InDelta(t, 0.06, *response.Regions[0].CostPerRun, 1e-9)
+		assert.Equal(t, "westeurope", response.Regions[1].Region)
+	})
+
+	t.Run("forecast", func(t *testing.T) {
+		server.carbonIntensity = hourlyIntensity{400, 100, 100}
+		defer func() { server.carbonIntensity = carbon.Static{} }()
+
+		response := recommend("?regions=westeurope&horizon=3h")
+		region := response.Regions[0]
+		assert.InDelta(t, 200, region.Average, 1e-9)
+		require.NotNil(t, region.BestWindow)
+		assert.Equal(t, 100.0, region.BestWindow.Intensity)
+		assert.Nil(t, region.PricePerMinute)
+	})
+
+	t.Run("invalid parameters", func(t *testing.T) {
+		for _, query := range []string{
+			"",
+			"?regions=westeurope&horizon=96h",
+			"?regions=westeurope&optimize=speed",
+			"?regions=westeurope&prices=westeurope",
+			"?regions=westeurope&prices=westeurope=-1",
+			"?regions=westeurope,eu-north-1&optimize=cost&prices=westeurope=0.008",
+			"?regions=westeurope,moon-base-1",
+		} {
+			assert.Equal(t, http.StatusBadRequest, get(query).Code, query)
+		}
+	})
+}
+
+func TestHandleSavings(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	repo := createTestRepository(t, database, user.ID)
+	now := time.Now().UTC()
+	for _, run := range []struct {
+		co2       float64
+		createdAt time.Time
+	}{
+		{2, now.AddDate(0, 0, -60)},
+		{2, now.AddDate(0, 0, -59)},
+		{0.5, now.AddDate(0, 0, -2)},
+		{0.5, now.AddDate(0, 0, -1)},
+	} {
+		r := &db.Run{UserID: user.ID, RepositoryID: repo.ID, CO2Kg: run.co2, EnergyKWh: run.co2 * 2, DurationS: 60}
+		require.NoError(t, database.Create(r).Error)
+		require.NoError(t, database.Model(r).Update("created_at", run.createdAt).Error)
+	}
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/repos/"+repo.ID.String()+path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("savings without baseline", func(t *testing.T) {
+		w := request("GET", "/savings", "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("empty baseline period", func(t *testing.T) {
+		w := request("PUT", "/baseline", `{"from": "2000-01-01", "to": "2000-02-01"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("savings against frozen baseline", func(t *testing.T) {
+		from := now.AddDate(0, 0, -61).Format(time.RFC3339)
+		to := now.AddDate(0, 0, -30).Format(time.RFC3339)
+		w := request("PUT", "/baseline", `{"from": "`+from+`", "to": "`+to+`"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = request("GET", "/savings", "")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var report struct {
+			RunCount        int64    `json:"run_count"`
+			ActualCO2Kg     float64  `json:"actual_co2_kg"`
+			BaselineCO2Kg   float64  `json:"baseline_co2_kg"`
+			SavedCO2Kg      float64  `json:"saved_co2_kg"`
+			SavedCO2Percent *float64 `json:"saved_co2_percent"`
+			SavedEnergyKWh  float64  `json:"saved_energy_kwh"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+		assert.Equal(t, int64(2), report.RunCount)
+		assert.InDelta(t, 1.0, report.ActualCO2Kg, 0.0001)
+		assert.InDelta(t, 4.0, report.BaselineCO2Kg, 0.0001)
+		assert.InDelta(t, 3.0, report.SavedCO2Kg, 0.0001)
+		require.NotNil(t, report.SavedCO2Percent)
+		assert.InDelta(t, 75.0, *report.SavedCO2Percent, 0.0001)
+		assert.InDelta(t, 6.0, report.SavedEnergyKWh, 0.0001)
+	})
+}
+
+func TestHandleForecast(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	repo := createTestRepository(t, database, user.ID)
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	for day := 1; day <= 28; day++ {
+		run := createTestRun(t, database, user.ID, repo.ID)
+		require.NoError(t, database.Model(run).Update("created_at", today.AddDate(0, 0, -day).Add(time.Hour)).Error)
+	}
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/repos/"+repo.ID.String()+path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	type periodForecast struct {
+		Period             string   `json:"period"`
+		ActualCO2Kg        float64  `json:"actual_co2_kg"`
+		ProjectedRemaining float64  `json:"projected_remaining_co2_kg"`
+		ForecastCO2Kg      float64  `json:"forecast_co2_kg"`
+		BudgetCO2Kg        *float64 `json:"budget_co2_kg"`
+		BudgetStatus       string   `json:"budget_status"`
+	}
+	forecast := func() map[string]periodForecast {
+		w := request("GET", "/forecast", "")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Periods []periodForecast `json:"periods"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		periods := make(map[string]periodForecast)
+		for _, period := range response.Periods {
+			periods[period.Period] = period
+		}
+		return periods
+	}
+
+	t.Run("forecast without budget", func(t *testing.T) {
+		periods := forecast()
+		require.Contains(t, periods, "month")
+		require.Contains(t, periods, "quarter")
+
+		month := periods["month"]
+		assert.Equal(t, "no_budget", month.BudgetStatus)
+		assert.Nil(t, month.BudgetCO2Kg)
+		assert.Greater(t, month.ProjectedRemaining, 0.0)
+		assert.InDelta(t, month.ActualCO2Kg+month.ProjectedRemaining, month.ForecastCO2Kg, 0.0001)
+	})
+
+	t.Run("forecast against budget", func(t *testing.T) {
+		w := request("PUT", "/budgets/month", `{"co2_kg_limit": 0.001}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		w = request("PUT", "/budgets/quarter", `{"co2_kg_limit": 1000}`)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		periods := forecast()
+		assert.Contains(t, []string{"at_risk", "exceeded"}, periods["month"].BudgetStatus)
+		assert.Equal(t, "on_track", periods["quarter"].BudgetStatus)
+	})
+
+	t.Run("list and delete budgets", func(t *testing.T) {
+		w := request("GET", "/budgets", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Budgets []map[string]interface{} `json:"budgets"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Len(t, response.Budgets, 2)
+
+		w = request("DELETE", "/budgets/month", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		w = request("DELETE", "/budgets/month", "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("invalid budget period", func(t *testing.T) {
+		w := request("PUT", "/budgets/year", `{"co2_kg_limit": 1}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestHandleUserYearInReview(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	repo := createTestRepository(t, database, user.ID)
+	year := time.Now().UTC().Year() - 1
+	for _, run := range []struct {
+		month time.Month
+		co2   float64
+	}{{time.January, 1}, {time.February, 3}, {time.March, 1.5}} {
+		r := &db.Run{UserID: user.ID, RepositoryID: repo.ID, CO2Kg: run.co2, EnergyKWh: run.co2, DurationS: 60}
+		require.NoError(t, database.Create(r).Error)
+		require.NoError(t, database.Model(r).Update("created_at", time.Date(year, run.month, 10, 12, 0, 0, 0, time.UTC)).Error)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/me/year-in-review?year="+strconv.Itoa(year), nil)
+	req.AddCookie(&http.Cookie{
+		Name:  "ecoci_token",
+		Value: token,
+	})
+	server.router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var review struct {
+		TotalCO2Kg  float64 `json:"total_co2_kg"`
+		RunCount    int64   `json:"run_count"`
+		Equivalents struct {
+			KmDriven float64 `json:"km_driven"`
+		} `json:"equivalents"`
+		BiggestRegression *struct {
+			ChangePercent float64 `json:"change_percent"`
+		} `json:"biggest_regression"`
+		BiggestImprovement *struct {
+			ChangePercent float64 `json:"change_percent"`
+		} `json:"biggest_improvement"`
+		Months []struct {
+			RunCount int64 `json:"run_count"`
+		} `json:"months"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &review))
+
+	assert.InDelta(t, 5.5, review.TotalCO2Kg, 0.0001)
+	assert.Equal(t, int64(3), review.RunCount)
+	assert.InDelta(t, 5.5/0.17, review.Equivalents.KmDriven, 0.0001)
+	require.NotNil(t, review.BiggestRegression)
+	assert.InDelta(t, 200.0, review.BiggestRegression.ChangePercent, 0.0001)
+	require.NotNil(t, review.BiggestImprovement)
+	assert.InDelta(t, -50.0, review.BiggestImprovement.ChangePercent, 0.0001)
+	require.Len(t, review.Months, 12)
+	assert.Equal(t, int64(1), review.Months[1].RunCount)
+	assert.Equal(t, int64(0), review.Months[11].RunCount)
+}
+
+func TestHandleRepositoryStatsBenchmark(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	language := "Go"
+	size := int64(2048)
+	var repos []*db.Repository
+	for i, co2 := range []float64{0.1, 0.2, 0.3, 0.4, 0.5, 0.6} {
+		repo := &db.Repository{
+			OwnerID:        user.ID,
+			GitHubRepoID:   int64(2000 + i),
+			Name:           "repo" + strconv.Itoa(i),
+			FullName:       "testuser/repo" + strconv.Itoa(i),
+			HTMLURL:        "https://github.com/testuser/repo" + strconv.Itoa(i),
+			Language:       &language,
+			SizeKB:         &size,
+			BenchmarkOptIn: true,
+		}
+		require.NoError(t, database.Create(repo).Error)
+		require.NoError(t, database.Create(&db.Run{
+			UserID: user.ID, RepositoryID: repo.ID, CO2Kg: co2, EnergyKWh: co2, DurationS: 60,
+		}).Error)
+		repos = append(repos, repo)
+	}
+
+	getBenchmark := func(repo *db.Repository) map[string]interface{} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/repos/"+repo.ID.String()+"/stats", nil)
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response["benchmark"].(map[string]interface{})
+	}
+
+	t.Run("most efficient repository scores highest", func(t *testing.T) {
+		benchmark := getBenchmark(repos[0])
+		assert.Equal(t, "ok", benchmark["status"])
+		assert.Equal(t, float64(5), benchmark["peer_count"])
+		assert.InDelta(t, 100.0, benchmark["percentile_score"], 0.0001)
+		assert.InDelta(t, 0.4, benchmark["peer_median_co2_kg_per_build_minute"], 0.0001)
+
+		cohort := benchmark["cohort"].(map[string]interface{})
+		assert.Equal(t, "Go", cohort["language"])
+		assert.Equal(t, "small", cohort["size"])
+	})
+
+	t.Run("least efficient repository scores lowest", func(t *testing.T) {
+		benchmark := getBenchmark(repos[5])
+		assert.InDelta(t, 0.0, benchmark["percentile_score"], 0.0001)
+	})
+
+	t.Run("not opted in", func(t *testing.T) {
+		require.NoError(t, database.Model(repos[1]).Update("benchmark_opt_in", false).Error)
+		benchmark := getBenchmark(repos[1])
+		assert.Equal(t, "not_opted_in", benchmark["status"])
+
+		benchmark = getBenchmark(repos[0])
+		assert.Equal(t, "insufficient_peers", benchmark["status"])
+	})
+}
+
+func TestHandleGraphQL(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	repo := createTestRepository(t, database, user.ID)
+	mainBranch, featureBranch := "main", "feature"
+	require.NoError(t, database.Create(&db.Run{
+		UserID: user.ID, RepositoryID: repo.ID, CO2Kg: 0.2, EnergyKWh: 0.4, DurationS: 60, BranchName: &mainBranch,
+	}).Error)
+	require.NoError(t, database.Create(&db.Run{
+		UserID: user.ID, RepositoryID: repo.ID, CO2Kg: 0.3, EnergyKWh: 0.6, DurationS: 90, BranchName: &featureBranch,
+	}).Error)
+
+	// A private repository of another user must not be reachable
+	other := &db.User{GitHubID: 54321, GitHubUsername: "otheruser"}
+	require.NoError(t, database.Create(other).Error)
+	hidden := &db.Repository{
+		OwnerID:      other.ID,
+		GitHubRepoID: 3000,
+		Name:         "hidden",
+		FullName:     "otheruser/hidden",
+		HTMLURL:      "https://github.com/otheruser/hidden",
+		Private:      true,
+	}
+	require.NoError(t, database.Create(hidden).Error)
+	createTestRun(t, database, other.ID, hidden.ID)
+
+	query := func(body string, variables map[string]interface{}) map[string]interface{} {
+		payload, _ := json.Marshal(map[string]interface{}{"query": body, "variables": variables})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/graphql", bytes.NewBuffer(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Nil(t, response["errors"])
+		return response["data"].(map[string]interface{})
+	}
+
+	t.Run("nested selection with filtering", func(t *testing.T) {
+		data := query(`query($id: ID!) {
+			me { githubUsername stats { runCount } }
+			repository(id: $id) {
+				fullName
+				owner { githubUsername }
+				stats { runCount totalCo2Kg }
+				runs(branch: "main") { total nodes { co2Kg branchName } }
+			}
+		}`, map[string]interface{}{"id": repo.ID.String()})
+
+		me := data["me"].(map[string]interface{})
+		assert.Equal(t, "testuser", me["githubUsername"])
+		assert.Equal(t, float64(2), me["stats"].(map[string]interface{})["runCount"])
+
+		repository := data["repository"].(map[string]interface{})
+		assert.Equal(t, "testuser/testrepo", repository["fullName"])
+		assert.Equal(t, "testuser", repository["owner"].(map[string]interface{})["githubUsername"])
+		stats := repository["stats"].(map[string]interface{})
+		assert.Equal(t, float64(2), stats["runCount"])
+		assert.InDelta(t, 0.5, stats["totalCo2Kg"], 0.0001)
+
+		runs := repository["runs"].(map[string]interface{})
+		assert.Equal(t, float64(1), runs["total"])
+		nodes := runs["nodes"].([]interface{})
+		require.Len(t, nodes, 1)
+		assert.Equal(t, "main", nodes[0].(map[string]interface{})["branchName"])
+	})
+
+	t.Run("invisible repositories are hidden", func(t *testing.T) {
+		data := query(`query($id: ID!) {
+			repository(id: $id) { name }
+			repositories { fullName }
+		}`, map[string]interface{}{"id": hidden.ID.String()})
+
+		assert.Nil(t, data["repository"])
+		repositories := data["repositories"].([]interface{})
+		require.Len(t, repositories, 1)
+		assert.Equal(t, "testuser/testrepo", repositories[0].(map[string]interface{})["fullName"])
+	})
+
+	t.Run("private profiles are hidden", func(t *testing.T) {
+		shared := &db.Repository{
+			OwnerID:      other.ID,
+			GitHubRepoID: 3001,
+			Name:         "shared",
+			FullName:     "otheruser/shared",
+			HTMLURL:      "https://github.com/otheruser/shared",
+		}
+		require.NoError(t, database.Create(shared).Error)
+		createTestRun(t, database, other.ID, shared.ID)
+
+		owner := func() (interface{}, interface{}) {
+			data := query(`query($id: ID!) {
+				repository(id: $id) { owner { githubUsername } runs { nodes { user { githubUsername } } } }
+			}`, map[string]interface{}{"id": shared.ID.String()})
+			repository := data["repository"].(map[string]interface{})
+			nodes := repository["runs"].(map[string]interface{})["nodes"].([]interface{})
+			require.Len(t, nodes, 1)
+			return repository["owner"], nodes[0].(map[string]interface{})["user"]
+		}
+
+		// Profiles are private by default
+		repoOwner, runUser := owner()
+		assert.Nil(t, repoOwner)
+		assert.Nil(t, runUser)
+
+		visibility := service.ProfileVisibilityPublic
+		_, err := server.userService.UpdatePreferences(other.ID, &service.PreferencesRequest{ProfileVisibility: &visibility})
+		require.NoError(t, err)
+
+		repoOwner, runUser = owner()
+		assert.Equal(t, "otheruser", repoOwner.(map[string]interface{})["githubUsername"])
+		assert.Equal(t, "otheruser", runUser.(map[string]interface{})["githubUsername"])
+	})
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+	repo := createTestRepository(t, database, user.ID)
+
+	type received struct {
+		event     string
+		signature string
+		body      []byte
+	}
+	var requests []received
+	responseStatus := http.StatusOK
+	responseBody := ""
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, received{
+			event:     r.Header.Get(webhook.HeaderEvent),
+			signature: r.Header.Get(webhook.HeaderSignature),
+			body:      body,
+		})
+		w.WriteHeader(responseStatus)
+		w.Write([]byte(responseBody))
+	}))
+	defer receiver.Close()
+
+	doRequest := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := doRequest("POST", "/repos/"+repo.ID.String()+"/webhooks", map[string]interface{}{
+		"url":    receiver.URL,
+		"events": []string{"run.created", "regression.detected", "budget.exceeded"},
+		"secret": "s3cret",
+	})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		Webhook db.Webhook `json:"webhook"`
+		Secret  string     `json:"secret"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "s3cret", created.Secret)
+	hookID := created.Webhook.ID.String()
+
+	w = doRequest("POST", "/repos/"+repo.ID.String()+"/webhooks", map[string]interface{}{
+		"url":    receiver.URL,
+		"events": []string{"run.deleted"},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	_, err := server.budgetService.SetBudget(repo.ID, "month", 2.0)
+	require.NoError(t, err)
+	for i := 0; i < service.RegressionMinHistory; i++ {
+		createTestRun(t, database, user.ID, repo.ID)
+	}
+	run := &db.Run{UserID: user.ID, RepositoryID: repo.ID, CO2Kg: 0.9, EnergyKWh: 1, DurationS: 60}
+	require.NoError(t, database.Create(run).Error)
+	require.NoError(t, database.Preload("Repository").First(run, "id = ?", run.ID).Error)
+
+	t.Run("signed deliveries for all events", func(t *testing.T) {
+		server.publishRunEvents(run)
+		attempted, err := server.webhooks.DeliverDue(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 3, attempted)
+
+		require.Len(t, requests, 3)
+		events := map[string]bool{}
+		for _, r := range requests {
+			events[r.event] = true
+			assert.Equal(t, webhook.Sign("s3cret", r.body), r.signature)
+		}
+		assert.True(t, events["run.created"])
+		assert.True(t, events["regression.detected"])
+		assert.True(t, events["budget.exceeded"])
+
+		// The budget was already exceeded before the next run, so it is not reported again
+		requests = nil
+		next := createTestRun(t, database, user.ID, repo.ID)
+		server.publishRunEvents(next)
+		_, err = server.webhooks.DeliverDue(context.Background())
+		require.NoError(t, err)
+		for _, r := range requests {
+			assert.NotEqual(t, "budget.exceeded", r.event)
+		}
+	})
+
+	t.Run("failing deliveries are dead-lettered", func(t *testing.T) {
+		require.NoError(t, database.Where("1 = 1").Delete(&db.WebhookDelivery{}).Error)
+		responseStatus = http.StatusInternalServerError
+		require.NoError(t, server.webhooks.Publish(webhook.Event{Type: webhook.EventRunCreated, RepositoryID: repo.ID}))
+
+		for i := 0; i < webhook.MaxAttempts; i++ {
+			_, err := server.webhooks.DeliverDue(context.Background())
+			require.NoError(t, err)
+			// Skip the backoff
+			require.NoError(t, database.Model(&db.WebhookDelivery{}).Where("1 = 1").
+				Update("next_attempt_at", time.Now().UTC().Add(-time.Minute)).Error)
+		}
+
+		w := doRequest("GET", "/webhooks/"+hookID+"/deliveries?status=dead", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Deliveries []db.WebhookDelivery `json:"deliveries"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Deliveries, 1)
+		dead := response.Deliveries[0]
+		assert.Equal(t, webhook.MaxAttempts, dead.Attempts)
+		require.NotNil(t, dead.ResponseStatus)
+		assert.Equal(t, http.StatusInternalServerError, *dead.ResponseStatus)
+
+		w = doRequest("POST", "/webhooks/"+hookID+"/deliveries/"+dead.ID.String()+"/redeliver", nil)
+		require.Equal(t, http.StatusAccepted, w.Code)
+		var redelivery db.WebhookDelivery
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &redelivery))
+		assert.Equal(t, webhook.StatusPending, redelivery.Status)
+		assert.Equal(t, 0, redelivery.Attempts)
+	})
+
+	t.Run("attempt history and redrive", func(t *testing.T) {
+		require.NoError(t, database.Where("1 = 1").Delete(&db.WebhookDelivery{}).Error)
+		responseStatus = http.StatusBadGateway
+		responseBody = strings.Repeat("upstream unavailable ", 100)
+		require.NoError(t, server.webhooks.Publish(webhook.Event{Type: webhook.EventRunCreated, RepositoryID: repo.ID}))
+		for i := 0; i < webhook.MaxAttempts; i++ {
+			_, err := server.webhooks.DeliverDue(context.Background())
+			require.NoError(t, err)
+			require.NoError(t, database.Model(&db.WebhookDelivery{}).Where("1 = 1").
+				Update("next_attempt_at", time.Now().UTC().Add(-time.Minute)).Error)
+		}
+		var dead db.WebhookDelivery
+		require.NoError(t, database.First(&dead, "status = ?", webhook.StatusDead).Error)
+
+		getDelivery := func(t *testing.T) WebhookDeliveryDetail {
+			w := doRequest("GET", "/webhooks/"+hookID+"/deliveries/"+dead.ID.String(), nil)
+			require.Equal(t, http.StatusOK, w.Code)
+			var detail WebhookDeliveryDetail
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &detail))
+			return detail
+		}
+
+		detail := getDelivery(t)
+		assert.Equal(t, webhook.StatusDead, detail.Status)
+		require.Len(t, detail.AttemptHistory, webhook.MaxAttempts)
+		first := detail.AttemptHistory[0]
+		assert.Equal(t, 1, first.Attempt)
+		require.NotNil(t, first.ResponseStatus)
+		assert.Equal(t, http.StatusBadGateway, *first.ResponseStatus)
+		assert.GreaterOrEqual(t, first.LatencyMS, int64(0))
+		// Response bodies of receivers on private addresses are not kept
+		assert.Nil(t, first.ResponseSnippet)
+		require.NotNil(t, first.Error)
+		assert.Contains(t, *first.Error, "502")
+		assert.Equal(t, webhook.MaxAttempts, detail.AttemptHistory[webhook.MaxAttempts-1].Attempt)
+
+		w := doRequest("GET", "/webhooks/"+hookID+"/deliveries/"+uuid.New().String(), nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = doRequest("POST", "/webhooks/"+hookID+"/deliveries/redrive?since=yesterday", nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w = doRequest("POST", "/webhooks/"+hookID+"/deliveries/redrive?since="+time.Now().UTC().Add(time.Hour).Format(time.RFC3339), nil)
+		require.Equal(t, http.StatusAccepted, w.Code)
+		assert.JSONEq(t, `{"redriven": 0}`, w.Body.String())
+
+		w = doRequest("POST", "/webhooks/"+hookID+"/deliveries/redrive", nil)
+		require.Equal(t, http.StatusAccepted, w.Code)
+		assert.JSONEq(t, `{"redriven": 1}`, w.Body.String())
+
+		responseStatus = http.StatusOK
+		responseBody = "ok"
+		_, err := server.webhooks.DeliverDue(context.Background())
+		require.NoError(t, err)
+
+		detail = getDelivery(t)
+		assert.Equal(t, webhook.StatusDelivered, detail.Status)
+		require.Len(t, detail.AttemptHistory, webhook.MaxAttempts+1)
+		last := detail.AttemptHistory[webhook.MaxAttempts]
+		assert.Equal(t, 1, last.Attempt)
+		assert.Equal(t, http.StatusOK, *last.ResponseStatus)
+		assert.Nil(t, last.ResponseSnippet)
+		assert.Nil(t, last.Error)
+	})
+}
+
+func TestWebhookCloudEvents(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+	repo := createTestRepository(t, database, user.ID)
+
+	requests := map[string]*http.Request{}
+	bodies := map[string][]byte{}
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests[r.URL.Path] = r
+		bodies[r.URL.Path] = body
+	}))
+	defer receiver.Close()
+
+	createWebhook := func(path, format string) int {
+		payload, _ := json.Marshal(map[string]interface{}{
+			"url":    receiver.URL + path,
+			"events": []string{"run.created"},
+			"secret": "s3cret",
+			"format": format,
+		})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/repos/"+repo.ID.String()+"/webhooks", bytes.NewBuffer(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+		server.router.ServeHTTP(w, req)
+		return w.Code
+	}
+	require.Equal(t, http.StatusCreated, createWebhook("/structured", webhook.FormatCloudEventsStructured))
+	require.Equal(t, http.StatusCreated, createWebhook("/binary", webhook.FormatCloudEventsBinary))
+	assert.Equal(t, http.StatusBadRequest, createWebhook("/avro", "avro"))
+
+	run := createTestRun(t, database, user.ID, repo.ID)
+	require.NoError(t, database.Preload("Repository").First(run, "id = ?", run.ID).Error)
+	server.publishRunEvents(run)
+	_, err := server.webhooks.DeliverDue(context.Background())
+	require.NoError(t, err)
+	require.Len(t, requests, 2)
+
+	source := server.cfg.AppURL + "/repos/" + repo.ID.String()
+
+	structured := requests["/structured"]
+	assert.Equal(t, "application/cloudevents+json", structured.Header.Get("Content-Type"))
+	assert.Equal(t, webhook.Sign("s3cret", bodies["/structured"]), structured.Header.Get(webhook.HeaderSignature))
+	event, err := cloudevents.Parse(bodies["/structured"])
+	require.NoError(t, err)
+	assert.Equal(t, "dev.ecoci.run.created", event.Type)
+	assert.Equal(t, source, event.Source)
+	assert.Equal(t, "runs/"+run.ID.String(), event.Subject)
+	assert.Equal(t, structured.Header.Get(webhook.HeaderDelivery), event.ID)
+
+	// In binary mode the attributes are headers and the signature covers the data alone
+	binary := requests["/binary"]
+	assert.Equal(t, "application/json", binary.Header.Get("Content-Type"))
+	assert.Equal(t, "1.0", binary.Header.Get("ce-specversion"))
+	assert.Equal(t, binary.Header.Get(webhook.HeaderDelivery), binary.Header.Get("ce-id"))
+	assert.Equal(t, "dev.ecoci.run.created", binary.Header.Get("ce-type"))
+	assert.Equal(t, source, binary.Header.Get("ce-source"))
+	assert.Equal(t, "runs/"+run.ID.String(), binary.Header.Get("ce-subject"))
+	assert.Equal(t, webhook.Sign("s3cret", bodies["/binary"]), binary.Header.Get(webhook.HeaderSignature))
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal(bodies["/binary"], &data))
+	assert.Equal(t, run.ID.String(), data["id"])
+}
+
+func TestWebhookTargets(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+	repo := createTestRepository(t, database, user.ID)
+
+	server.cfg.WebhookPrivateTargets = false
+	server.webhooks = webhook.NewDispatcher(database, server.cfg.AppURL, false)
+
+	var hits []string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits = append(hits, r.URL.Path)
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/target", http.StatusFound)
+		}
+	}))
+	defer receiver.Close()
+
+	// deliver queues a run.created delivery for a webhook stored without the creation
+	// check, as if its host had resolved to a public address then, and attempts it
+	deliver := func(t *testing.T, url string) db.WebhookDeliveryAttempt {
+		require.NoError(t, database.Where("1 = 1").Delete(&db.Webhook{}).Error)
+		hook := &db.Webhook{RepositoryID: &repo.ID, CreatedByID: user.ID, URL: url, Secret: "s3cret",
+			Events: db.StringList{webhook.EventRunCreated}, Format: webhook.FormatEcoCI, Active: true}
+		require.NoError(t, database.Create(hook).Error)
+		require.NoError(t, server.webhooks.Publish(webhook.Event{Type: webhook.EventRunCreated, RepositoryID: repo.ID}))
+		_, err := server.webhooks.DeliverDue(context.Background())
+		require.NoError(t, err)
+
+		var attempt db.WebhookDeliveryAttempt
+		require.NoError(t, database.Joins("JOIN webhook_deliveries ON webhook_deliveries.id = webhook_delivery_attempts.delivery_id").
+			Where("webhook_deliveries.webhook_id = ?", hook.ID).First(&attempt).Error)
+		return attempt
+	}
+
+	t.Run("internal addresses are rejected on creation", func(t *testing.T) {
+		for _, target := range []string{
+			"http://127.0.0.1:8080/hook",
+			"http://localhost:6379",
+			"http://169.254.169.254/latest/meta-data/",
+			"http://10.0.0.12/admin",
+			"http://[::1]/hook",
+			"http://0.0.0.0/hook",
+		} {
+			payload, _ := json.Marshal(map[string]interface{}{"url": target, "events": []string{"run.created"}})
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/repos/"+repo.ID.String()+"/webhooks", bytes.NewBuffer(payload))
+			req.Header.Set("Content-Type", "application/json")
+			req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+			server.router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code, target)
+			assert.Contains(t, w.Body.String(), "WEBHOOK_TARGET_NOT_ALLOWED", target)
+		}
+	})
+
+	t.Run("internal addresses are refused at dial time", func(t *testing.T) {
+		attempt := deliver(t, receiver.URL+"/hook")
+		assert.Empty(t, hits)
+		assert.Nil(t, attempt.ResponseStatus)
+		require.NotNil(t, attempt.Error)
+		assert.Contains(t, *attempt.Error, "not allowed")
+	})
+
+	t.Run("redirects are not followed", func(t *testing.T) {
+		server.webhooks = webhook.NewDispatcher(database, server.cfg.AppURL, true)
+		attempt := deliver(t, receiver.URL+"/redirect")
+		assert.Equal(t, []string{"/redirect"}, hits)
+		require.NotNil(t, attempt.ResponseStatus)
+		assert.Equal(t, http.StatusFound, *attempt.ResponseStatus)
+		require.NotNil(t, attempt.Error)
+		assert.Contains(t, *attempt.Error, "302")
+	})
+}
+
+func TestOrganizationWebhooks(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	admin := createTestUser(t, database)
+	member := &db.User{GitHubID: 54321, GitHubUsername: "member"}
+	require.NoError(t, database.Create(member).Error)
+
+	org := &db.Organization{GitHubID: 780, GitHubLogin: "hookorg"}
+	require.NoError(t, database.Create(org).Error)
+	require.NoError(t, database.Create(&db.OrganizationMember{OrganizationID: org.ID, UserID: admin.ID, Role: db.OrganizationRoleAdmin}).Error)
+	require.NoError(t, database.Create(&db.OrganizationMember{OrganizationID: org.ID, UserID: member.ID}).Error)
+
+	doRequest := func(user *db.User, method, path string, body interface{}) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: generateTestJWT(t, server, user.ID, user.GitHubUsername)})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	subscription := map[string]interface{}{"url": "https://receiver.example/hook", "events": []string{"run.created"}}
+
+	w := doRequest(member, "POST", "/orgs/hookorg/webhooks", subscription)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "NOT_ORGANIZATION_ADMIN")
+
+	w = doRequest(admin, "POST", "/orgs/hookorg/webhooks", subscription)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		Webhook db.Webhook `json:"webhook"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	hookPath := "/webhooks/" + created.Webhook.ID.String()
+
+	// Members see the organization's webhooks but cannot manage them
+	w = doRequest(member, "GET", "/orgs/hookorg/webhooks", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doRequest(member, "GET", hookPath+"/deliveries", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = doRequest(member, "DELETE", hookPath, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = doRequest(admin, "GET", hookPath+"/deliveries", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = doRequest(admin, "DELETE", hookPath, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestSlackNotifications(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	org := &db.Organization{GitHubID: 777, GitHubLogin: "greenorg"}
+	require.NoError(t, database.Create(org).Error)
+	require.NoError(t, database.Create(&db.OrganizationMember{OrganizationID: org.ID, UserID: user.ID, Role: db.OrganizationRoleAdmin}).Error)
+	repo := createTestRepository(t, database, user.ID)
+	require.NoError(t, database.Model(repo).Update("organization_id", org.ID).Error)
+
+	var mu sync.Mutex
+	var messages []map[string]interface{}
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&message)
+		mu.Lock()
+		messages = append(messages, message)
+		mu.Unlock()
+	}))
+	defer slack.Close()
+
+	doRequest := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := doRequest("PUT", "/orgs/greenorg/integrations/slack", map[string]interface{}{
+		"webhook_url": slack.URL,
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), slack.URL)
+
+	w = doRequest("PUT", "/repos/"+repo.ID.String()+"/notifications/slack", map[string]interface{}{
+		"channel": "#carbon",
+		"events":  []string{"budget.exceeded", "weekly.summary"},
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = doRequest("PUT", "/repos/"+repo.ID.String()+"/notifications/slack", map[string]interface{}{
+		"events": []string{"run.deleted"},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	t.Run("budget breach", func(t *testing.T) {
+		_, err := server.budgetService.SetBudget(repo.ID, "month", 0.5)
+		require.NoError(t, err)
+		createTestRun(t, database, user.ID, repo.ID)
+		run := createTestRun(t, database, user.ID, repo.ID)
+
+		server.publishRunEvents(run)
+		server.notifier.Wait()
+
+		require.Len(t, messages, 1)
+		assert.Equal(t, "#carbon", messages[0]["channel"])
+		attachment := messages[0]["attachments"].([]interface{})[0].(map[string]interface{})
+		assert.Contains(t, attachment["title"], "exceeded its monthly CO₂ budget")
+	})
+
+	t.Run("weekly summary", func(t *testing.T) {
+		messages = nil
+		require.NoError(t, server.notifier.SendWeeklySummaries(context.Background(), time.Now().UTC().AddDate(0, 0, 7)))
+
+		require.Len(t, messages, 1)
+		attachment := messages[0]["attachments"].([]interface{})[0].(map[string]interface{})
+		assert.Contains(t, attachment["title"], "Weekly CO₂ summary for testuser/testrepo")
+	})
+
+	t.Run("members cannot change integrations", func(t *testing.T) {
+		member := &db.User{GitHubID: 54321, GitHubUsername: "member"}
+		require.NoError(t, database.Create(member).Error)
+		require.NoError(t, database.Create(&db.OrganizationMember{OrganizationID: org.ID, UserID: member.ID}).Error)
+		memberToken := generateTestJWT(t, server, member.ID, member.GitHubUsername)
+
+		memberRequest := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+			payload, _ := json.Marshal(body)
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(method, path, bytes.NewBuffer(payload))
+			req.Header.Set("Content-Type", "application/json")
+			req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: memberToken})
+			server.router.ServeHTTP(w, req)
+			return w
+		}
+
+		w := memberRequest("GET", "/orgs/greenorg/integrations", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w = memberRequest("PUT", "/orgs/greenorg/integrations/slack", map[string]interface{}{
+			"webhook_url": "https://attacker.example/hook",
+		})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "NOT_ORGANIZATION_ADMIN")
+
+		w = memberRequest("DELETE", "/orgs/greenorg/integrations/slack", nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		integrations, err := server.notificationService.ListIntegrations(org.ID)
+		require.NoError(t, err)
+		require.Len(t, integrations, 1)
+		require.NotNil(t, integrations[0].WebhookURL)
+		assert.Equal(t, slack.URL, *integrations[0].WebhookURL)
+	})
+}
+
+func TestTeamsAndDiscordNotifications(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	org := &db.Organization{GitHubID: 778, GitHubLogin: "bluorg"}
+	require.NoError(t, database.Create(org).Error)
+	require.NoError(t, database.Create(&db.OrganizationMember{OrganizationID: org.ID, UserID: user.ID, Role: db.OrganizationRoleAdmin}).Error)
+	repo := createTestRepository(t, database, user.ID)
+	require.NoError(t, database.Model(repo).Update("organization_id", org.ID).Error)
+
+	var mu sync.Mutex
+	received := map[string]map[string]interface{}{}
+	receiver := func(provider string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var message map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&message)
+			mu.Lock()
+			received[provider] = message
+			mu.Unlock()
+		}))
+	}
+	teams, discord := receiver("teams"), receiver("discord")
+	defer teams.Close()
+	defer discord.Close()
+
+	doRequest := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := doRequest("PUT", "/orgs/bluorg/integrations/teams", map[string]interface{}{"bot_token": "token"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	for provider, url := range map[string]string{"teams": teams.URL, "discord": discord.URL} {
+		w := doRequest("PUT", "/orgs/bluorg/integrations/"+provider, map[string]interface{}{"webhook_url": url})
+		require.Equal(t, http.StatusOK, w.Code)
+		w = doRequest("PUT", "/repos/"+repo.ID.String()+"/notifications/"+provider, map[string]interface{}{
+			"events": []string{"budget.exceeded"},
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+	}
+
+	_, err := server.budgetService.SetBudget(repo.ID, "month", 0.1)
+	require.NoError(t, err)
+	run := createTestRun(t, database, user.ID, repo.ID)
+	server.publishRunEvents(run)
+	server.notifier.Wait()
+
+	card := received["teams"]
+	require.NotNil(t, card)
+	assert.Equal(t, "MessageCard", card["@type"])
+	assert.Contains(t, card["title"], "exceeded its monthly CO₂ budget")
+
+	message := received["discord"]
+	require.NotNil(t, message)
+	embed := message["embeds"].([]interface{})[0].(map[string]interface{})
+	assert.Contains(t, embed["title"], "exceeded its monthly CO₂ budget")
+	assert.Equal(t, float64(0xE01E5A), embed["color"])
+}
+
+// recordingSender collects emails instead of sending them
+type recordingSender struct {
+	mu       sync.Mutex
+	messages []*mail.Message
+}
+
+func (r *recordingSender) Send(msg *mail.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, msg)
+	return nil
+}
+
+func (r *recordingSender) take() []*mail.Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	messages := r.messages
+	r.messages = nil
+	return messages
+}
+
+func TestDisplayUnits(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+	repo := createTestRepository(t, database, user.ID)
+	createTestRun(t, database, user.ID, repo.ID)
+
+	call := func(t *testing.T, method, path string, body interface{}) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	listRuns := func(t *testing.T, query string) map[string]interface{} {
+		w := call(t, "GET", "/repos/"+repo.ID.String()+"/runs"+query, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+	firstRun := func(t *testing.T, response map[string]interface{}) map[string]interface{} {
+		runs, ok := response["runs"].([]interface{})
+		require.True(t, ok)
+		require.Len(t, runs, 1)
+		return runs[0].(map[string]interface{})
+	}
+
+	t.Run("canonical units by default", func(t *testing.T) {
+		response := listRuns(t, "")
+		assert.NotContains(t, response, "units")
+		run := firstRun(t, response)
+		assert.Equal(t, 0.3, run["co2_kg"])
+		assert.Equal(t, 0.5, run["energy_kwh"])
+	})
+
+	t.Run("units parameter", func(t *testing.T) {
+		response := listRuns(t, "?units=g,Wh")
+		assert.Equal(t, map[string]interface{}{"co2": "g", "energy": "Wh"}, response["units"])
+		run := firstRun(t, response)
+		assert.Equal(t, 300.0, run["co2_g"])
+		assert.Equal(t, 500.0, run["energy_wh"])
+		assert.NotContains(t, run, "co2_kg")
+		assert.NotContains(t, run, "energy_kwh")
+
+		w := call(t, "GET", "/repos/"+repo.ID.String()+"/runs?units=t", nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "INVALID_UNITS")
+		w = call(t, "GET", "/repos/"+repo.ID.String()+"/runs?units=g,kg", nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("intensities keep their denominator", func(t *testing.T) {
+		w := call(t, "GET", "/emission-factors/westeurope?units=g,Wh", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var factor map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &factor))
+		assert.Equal(t, 328.0, factor["grams_co2e_per_kwh"])
+	})
+
+	t.Run("user preference", func(t *testing.T) {
+		w := call(t, "PUT", "/me/display-units", map[string]interface{}{"co2": "G"})
+		require.Equal(t, http.StatusOK, w.Code)
+		var units service.DisplayUnits
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &units))
+		assert.Equal(t, service.DisplayUnits{CO2: "g", Energy: "kWh"}, units)
+
+		run := firstRun(t, listRuns(t, ""))
+		assert.Equal(t, 300.0, run["co2_g"])
+		assert.Equal(t, 0.5, run["energy_kwh"])
+		run = firstRun(t, listRuns(t, "?units=kg"))
+		assert.Equal(t, 0.3, run["co2_kg"])
+
+		var event db.AuditEvent
+		require.NoError(t, database.Where("action = ?", "display_units.update").First(&event).Error)
+		assert.Contains(t, event.Changes, "co2")
+
+		w = call(t, "PUT", "/me/display-units", map[string]interface{}{"co2": "g", "energy": "J"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		// The canonical units clear the preference
+		w = call(t, "PUT", "/me/display-units", map[string]interface{}{"co2": "kg", "energy": "kWh"})
+		require.Equal(t, http.StatusOK, w.Code)
+		var reloaded db.User
+		require.NoError(t, database.First(&reloaded, "id = ?", user.ID).Error)
+		assert.Nil(t, reloaded.DisplayUnits)
+		assert.NotContains(t, listRuns(t, ""), "units")
+	})
+}
+
+func TestEmailNotifications(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+	repo := createTestRepository(t, database, user.ID)
+
+	sender := &recordingSender{}
+	server.mailer = mail.NewMailer(sender, "https://app.ecoci.dev", server.userService, server.statsService)
+
+	doRequest := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("invitation", func(t *testing.T) {
+		collaborator := &db.User{GitHubID: 23456, GitHubUsername: "friend", GitHubEmail: stringPtr("friend@example.com")}
+		require.NoError(t, database.Create(collaborator).Error)
+
+		w := doRequest("POST", "/repos/"+repo.ID.String()+"/collaborators", map[string]interface{}{
+			"github_username": "friend",
+		})
+		require.Equal(t, http.StatusCreated, w.Code)
+		server.mailer.Wait()
+
+		messages := sender.take()
+		require.Len(t, messages, 1)
+		assert.Equal(t, "friend@example.com", messages[0].To)
+		assert.Equal(t, "testuser shared testuser/testrepo with you on EcoCI", messages[0].Subject)
+		assert.Contains(t, messages[0].HTML, "https://app.ecoci.dev/repos/"+repo.ID.String())
+		assert.Contains(t, messages[0].Text, "Manage email preferences: https://app.ecoci.dev/settings/notifications")
+	})
+
+	t.Run("preferences", func(t *testing.T) {
+		w := doRequest("GET", "/me/email-preferences", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var preferences service.EmailPreferences
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &preferences))
+		assert.Equal(t, "test@example.com", *preferences.Email)
+		assert.True(t, preferences.Alerts)
+		assert.True(t, preferences.Reports)
+
+		w = doRequest("PATCH", "/me/email-preferences", map[string]interface{}{"alerts": false})
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &preferences))
+		assert.False(t, preferences.Alerts)
+		assert.True(t, preferences.Invitations)
+		assert.True(t, preferences.Reports)
+	})
+
+	t.Run("alerts respect opt-out", func(t *testing.T) {
+		_, err := server.budgetService.SetBudget(repo.ID, "month", 0.5)
+		require.NoError(t, err)
+		createTestRun(t, database, user.ID, repo.ID)
+		server.publishRunEvents(createTestRun(t, database, user.ID, repo.ID))
+		server.mailer.Wait()
+		assert.Empty(t, sender.take())
+
+		w := doRequest("PATCH", "/me/email-preferences", map[string]interface{}{"alerts": true})
+		require.Equal(t, http.StatusOK, w.Code)
+		_, err = server.budgetService.SetBudget(repo.ID, "month", 0.8)
+		require.NoError(t, err)
+		server.publishRunEvents(createTestRun(t, database, user.ID, repo.ID))
+		server.mailer.Wait()
+
+		messages := sender.take()
+		require.Len(t, messages, 1)
+		assert.Equal(t, "test@example.com", messages[0].To)
+		assert.Equal(t, "testuser/testrepo exceeded its monthly CO₂ budget", messages[0].Subject)
+		assert.Contains(t, messages[0].HTML, "Budget")
+	})
+
+	t.Run("weekly report", func(t *testing.T) {
+		require.NoError(t, server.mailer.SendWeeklyReports(context.Background(), time.Now().UTC().AddDate(0, 0, 7)))
+		server.mailer.Wait()
+
+		messages := sender.take()
+		require.Len(t, messages, 1)
+		assert.Equal(t, "test@example.com", messages[0].To)
+		assert.Contains(t, messages[0].Subject, "Your weekly EcoCI report")
+		assert.Contains(t, messages[0].Text, "Runs: 3")
+
+		w := doRequest("PATCH", "/me/email-preferences", map[string]interface{}{"reports": false})
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, server.mailer.SendWeeklyReports(context.Background(), time.Now().UTC().AddDate(0, 0, 7)))
+		server.mailer.Wait()
+		assert.Empty(t, sender.take())
+	})
+}
+
+func TestCommitStatus(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+	repo := createTestRepository(t, database, user.ID)
+
+	type postedStatus struct {
+		path          string
+		authorization string
+		status        commitstatus.Status
+	}
+	var mu sync.Mutex
+	var posted []postedStatus
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var status commitstatus.Status
+		json.NewDecoder(r.Body).Decode(&status)
+		mu.Lock()
+		posted = append(posted, postedStatus{path: r.URL.Path, authorization: r.Header.Get("Authorization"), status: status})
+		mu.Unlock()
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer github.Close()
+	server.commitStatuses = commitstatus.NewPublisher(github.URL, "status-token")
+
+	submit := func(sha string) {
+		run := createTestRun(t, database, user.ID, repo.ID)
+		require.NoError(t, database.Model(run).Update("git_commit_sha", sha).Error)
+		run.GitCommitSHA = stringPtr(sha)
+		server.publishRunEvents(run)
+		server.commitStatuses.Wait()
+	}
+
+	t.Run("disabled by default", func(t *testing.T) {
+		submit("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+		assert.Empty(t, posted)
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PATCH", "/repos/"+repo.ID.String()+"/settings", bytes.NewBufferString(`{"commit_status": true}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(&http.Cookie{
+		Name:  "ecoci_token",
+		Value: token,
+	})
+	server.router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"commit_status":true`)
+
+	t.Run("within budget", func(t *testing.T) {
+		sha := "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"
+		submit(sha)
+
+		require.Len(t, posted, 1)
+		assert.Equal(t, "/repos/testuser/testrepo/statuses/"+sha, posted[0].path)
+		assert.Equal(t, "Bearer status-token", posted[0].authorization)
+		assert.Equal(t, commitstatus.StateSuccess, posted[0].status.State)
+		assert.Equal(t, commitstatus.Context, posted[0].status.Context)
+		assert.Equal(t, "300.0 g CO₂, within budget", posted[0].status.Description)
+		assert.Equal(t, "http://localhost:3000/repos/"+repo.ID.String()+"/commits/"+sha, posted[0].status.TargetURL)
+	})
+
+	t.Run("budget exceeded", func(t *testing.T) {
+		posted = nil
+		_, err := server.budgetService.SetBudget(repo.ID, "month", 0.5)
+		require.NoError(t, err)
+		submit("cccccccccccccccccccccccccccccccccccccccc")
+
+		require.Len(t, posted, 1)
+		assert.Equal(t, commitstatus.StateFailure, posted[0].status.State)
+		assert.Equal(t, "Monthly budget exceeded: 900.0 g of 500.0 g CO₂", posted[0].status.Description)
+	})
+}
+
+func TestWaterUsage(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	org := &db.Organization{GitHubID: 779, GitHubLogin: "waterorg"}
+	require.NoError(t, database.Create(org).Error)
+	require.NoError(t, database.Create(&db.OrganizationMember{OrganizationID: org.ID, UserID: user.ID, Role: db.OrganizationRoleAdmin}).Error)
+
+	doRequest := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	submit := func(t *testing.T, metadata map[string]interface{}) *db.Run {
+		w := doRequest("POST", "/runs", service.RunCreateRequest{
+			EnergyKWh: 0.5, CO2Kg: 0.3, DurationS: 120,
+			Repository: service.RepositoryCreateRequest{Name: "app", FullName: "waterorg/app", HTMLURL: "https://github.com/waterorg/app"},
+			Metadata:   metadata,
+		})
+		require.Equal(t, http.StatusCreated, w.Code)
+		var run db.Run
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &run))
+		return &run
+	}
+
+	t.Run("no water without a WUE", func(t *testing.T) {
+		assert.Nil(t, submit(t, nil).WaterL)
+	})
+
+	t.Run("organization WUE", func(t *testing.T) {
+		w := doRequest("PUT", "/orgs/waterorg/water", map[string]interface{}{"wue_l_per_kwh": -1})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w = doRequest("PUT", "/orgs/waterorg/water", map[string]interface{}{"wue_l_per_kwh": 1.8})
+		require.Equal(t, http.StatusOK, w.Code)
+
+		run := submit(t, nil)
+		require.NotNil(t, run.WaterL)
+		assert.Equal(t, 0.9, *run.WaterL)
+
+		var event db.AuditEvent
+		require.NoError(t, database.Where("action = ? AND resource_type = ?", "water_settings.set", "organization").First(&event).Error)
+		assert.Contains(t, event.Changes, "wue_l_per_kwh")
+	})
+
+	var repoID string
+	t.Run("repository WUE overrides the organization", func(t *testing.T) {
+		var repo db.Repository
+		require.NoError(t, database.First(&repo, "full_name = ?", "waterorg/app").Error)
+		repoID = repo.ID.String()
+
+		w := doRequest("PUT", "/repos/"+repoID+"/water", map[string]interface{}{"wue_l_per_kwh": 0.2})
+		require.Equal(t, http.StatusOK, w.Code)
+		w = doRequest("GET", "/repos/"+repoID+"/water", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var settings service.WaterSettings
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &settings))
+		require.NotNil(t, settings.WUELitersPerKWh)
+		assert.Equal(t, 0.2, *settings.WUELitersPerKWh)
+
+		run := submit(t, nil)
+		require.NotNil(t, run.WaterL)
+		assert.Equal(t, 0.1, *run.WaterL)
+	})
+
+	t.Run("hardware profile WUE", func(t *testing.T) {
+		require.Equal(t, http.StatusOK, doRequest("PUT", "/repos/"+repoID+"/water", map[string]interface{}{"wue_l_per_kwh": nil}).Code)
+		require.Equal(t, http.StatusOK, doRequest("PUT", "/orgs/waterorg/water", map[string]interface{}{}).Code)
+
+		run := submit(t, map[string]interface{}{"hardware_profile": "aws"})
+		require.NotNil(t, run.WaterL)
+		assert.Equal(t, 0.09, *run.WaterL)
+		assert.Nil(t, submit(t, map[string]interface{}{"hardware_profile": "gcp"}).WaterL)
+	})
+
+	t.Run("stats total the water", func(t *testing.T) {
+		w := doRequest("GET", "/repos/"+repoID+"/stats", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Summary service.PeriodSummary `json:"summary"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, int64(5), response.Summary.RunCount)
+		assert.InDelta(t, 1.09, response.Summary.TotalWaterL, 1e-9)
+	})
+
+	t.Run("members cannot change the organization WUE", func(t *testing.T) {
+		member := &db.User{GitHubID: 54321, GitHubUsername: "member"}
+		require.NoError(t, database.Create(member).Error)
+		require.NoError(t, database.Create(&db.OrganizationMember{OrganizationID: org.ID, UserID: member.ID}).Error)
+		token = generateTestJWT(t, server, member.ID, member.GitHubUsername)
+
+		w := doRequest("GET", "/orgs/waterorg/water", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		w = doRequest("PUT", "/orgs/waterorg/water", map[string]interface{}{"wue_l_per_kwh": 20})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "NOT_ORGANIZATION_ADMIN")
+
+		w = doRequest("GET", "/orgs/waterorg/water", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var settings service.WaterSettings
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &settings))
+		assert.Nil(t, settings.WUELitersPerKWh)
+	})
+}
+
+func TestMeasurements(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	doRequest := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	submit := func(measurements []service.MeasurementRequest) *httptest.ResponseRecorder {
+		return doRequest("POST", "/runs", service.RunCreateRequest{
+			EnergyKWh: 0.5, CO2Kg: 0.3, DurationS: 120,
+			Repository:   service.RepositoryCreateRequest{Name: "gpu", FullName: "testuser/gpu", HTMLURL: "https://github.com/testuser/gpu"},
+			Measurements: measurements,
+		})
+	}
+
+	t.Run("invalid measurements", func(t *testing.T) {
+		for _, measurements := range [][]service.MeasurementRequest{
+			{{Type: "GPU Energy", Value: 1, Unit: "Wh"}},
+			{{Type: "gpu_energy", Value: -1, Unit: "Wh"}},
+			{{Type: "gpu_energy", Value: 1}},
+			{{Type: "gpu_energy", Value: 1, Unit: "Wh"}, {Type: "gpu_energy", Value: 2, Unit: "Wh"}},
+		} {
+			w := submit(measurements)
+			assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+			assert.Contains(t, w.Body.String(), "INVALID_MEASUREMENTS")
+		}
+	})
+
+	t.Run("measurements are normalized and stored", func(t *testing.T) {
+		w := submit([]service.MeasurementRequest{
+			{Type: "gpu_energy", Value: 250, Unit: "Wh"},
+			{Type: "network_transfer", Value: 1.5, Unit: "MB"},
+			{Type: "gpu_utilization", Value: 80, Unit: "%"},
+		})
+		require.Equal(t, http.StatusCreated, w.Code)
+		var run db.Run
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &run))
+		require.Len(t, run.Measurements, 3)
+
+		values := map[string]db.Measurement{}
+		for _, measurement := range run.Measurements {
+			values[measurement.Type] = measurement
+		}
+		assert.Equal(t, "kWh", values["gpu_energy"].Unit)
+		assert.InDelta(t, 0.25, values["gpu_energy"].Value, 1e-9)
+		assert.Equal(t, "B", values["network_transfer"].Unit)
+		assert.InDelta(t, 1.5e6, values["network_transfer"].Value, 1e-6)
+		assert.Equal(t, "%", values["gpu_utilization"].Unit)
+	})
+
+	t.Run("totals by type", func(t *testing.T) {
+		require.Equal(t, http.StatusCreated, submit([]service.MeasurementRequest{{Type: "gpu_energy", Value: 0.75, Unit: "kWh"}}).Code)
+		require.Equal(t, http.StatusCreated, submit(nil).Code)
+
+		var repo db.Repository
+		require.NoError(t, database.First(&repo, "full_name = ?", "testuser/gpu").Error)
+		for _, path := range []string{"/repos/" + repo.ID.String() + "/measurements", "/me/measurements"} {
+			w := doRequest("GET", path, nil)
+			require.Equal(t, http.StatusOK, w.Code)
+			var response struct {
+				Measurements []service.MeasurementTotal `json:"measurements"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			require.Len(t, response.Measurements, 3)
+			assert.Equal(t, "gpu_energy", response.Measurements[0].Type)
+			assert.Equal(t, int64(2), response.Measurements[0].RunCount)
+			assert.InDelta(t, 1.0, response.Measurements[0].Total, 1e-9)
+			assert.InDelta(t, 0.5, response.Measurements[0].Average, 1e-9)
+			assert.Equal(t, "network_transfer", response.Measurements[2].Type)
+		}
+	})
+}
+
+func TestGPUEnergy(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	doRequest := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	submit := func(req service.RunCreateRequest) *httptest.ResponseRecorder {
+		req.CO2Kg, req.DurationS = 0.3, 120
+		req.Repository = service.RepositoryCreateRequest{Name: "ml", FullName: "testuser/ml", HTMLURL: "https://github.com/testuser/ml"}
+		return doRequest("POST", "/runs", req)
+	}
+	model, count := "nvidia-t4", 2
+	gpuEnergy := func(kwh float64) *float64 { return &kwh }
+
+	t.Run("invalid GPU energy", func(t *testing.T) {
+		for _, req := range []service.RunCreateRequest{
+			{EnergyKWh: 1, GPUEnergyKWh: gpuEnergy(2)},
+			{EnergyKWh: 1, GPUModel: &model},
+			{EnergyKWh: 1, GPUEnergyKWh: gpuEnergy(0.5), GPUCount: new(int)},
+			{EnergyKWh: 1, GPUEnergyKWh: gpuEnergy(0.5), GPUs: []service.GPUDeviceRequest{{Model: "T4", EnergyKWh: 0.5}}},
+			{EnergyKWh: 1, GPUs: []service.GPUDeviceRequest{{Model: "T4", EnergyKWh: 0.2}, {Model: "T4", EnergyKWh: 0.2}}},
+		} {
+			w := submit(req)
+			assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+			assert.Contains(t, w.Body.String(), "INVALID_GPUS")
+		}
+	})
+
+	t.Run("per-device GPU energy", func(t *testing.T) {
+		w := submit(service.RunCreateRequest{EnergyKWh: 1, GPUs: []service.GPUDeviceRequest{
+			{Index: 0, Model: "nvidia-a100", EnergyKWh: 0.3},
+			{Index: 1, Model: "nvidia-a100", EnergyKWh: 0.4},
+		}})
+		require.Equal(t, http.StatusCreated, w.Code)
+		var run db.Run
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &run))
+		require.NotNil(t, run.GPUEnergyKWh)
+		assert.InDelta(t, 0.7, *run.GPUEnergyKWh, 1e-9)
+		require.NotNil(t, run.GPUModel)
+		assert.Equal(t, "nvidia-a100", *run.GPUModel)
+		require.NotNil(t, run.GPUCount)
+		assert.Equal(t, 2, *run.GPUCount)
+		require.Len(t, run.GPUDevices, 2)
+
+		w = submit(service.RunCreateRequest{EnergyKWh: 0.5, GPUs: []service.GPUDeviceRequest{
+			{Index: 0, Model: "nvidia-a100", EnergyKWh: 0.1},
+			{Index: 1, Model: "nvidia-t4", EnergyKWh: 0.1},
+		}})
+		require.Equal(t, http.StatusCreated, w.Code)
+		run = db.Run{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &run))
+		assert.Nil(t, run.GPUModel)
+	})
+
+	t.Run("GPU energy by model", func(t *testing.T) {
+		require.Equal(t, http.StatusCreated, submit(service.RunCreateRequest{EnergyKWh: 0.5, GPUEnergyKWh: gpuEnergy(0.25), GPUModel: &model, GPUCount: &count}).Code)
+		require.Equal(t, http.StatusCreated, submit(service.RunCreateRequest{EnergyKWh: 0.5}).Code)
+
+		var repo db.Repository
+		require.NoError(t, database.First(&repo, "full_name = ?", "testuser/ml").Error)
+		w := doRequest("GET", "/repos/"+repo.ID.String()+"/gpus", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Models []service.GPUModelStats `json:"models"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Models, 3)
+		require.NotNil(t, response.Models[0].Model)
+		assert.Equal(t, "nvidia-a100", *response.Models[0].Model)
+		assert.InDelta(t, 0.7, response.Models[0].GPUShare, 1e-9)
+		assert.Equal(t, "nvidia-t4", *response.Models[1].Model)
+		assert.Equal(t, int64(2), response.Models[1].GPUCount)
+		assert.Nil(t, response.Models[2].Model)
+
+		w = doRequest("GET", "/me/stats", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var stats struct {
+			Summary service.PeriodSummary `json:"summary"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+		assert.InDelta(t, 1.15, stats.Summary.TotalGPUEnergyKWh, 1e-9)
+	})
+}
+
+func TestStepPhases(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	doRequest := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	workflow := "ci"
+	submit := func(energy, co2 float64, steps interface{}) *httptest.ResponseRecorder {
+		req := service.RunCreateRequest{
+			EnergyKWh: energy, CO2Kg: co2, DurationS: 120, WorkflowName: &workflow,
+			Repository: service.RepositoryCreateRequest{Name: "web", FullName: "testuser/web", HTMLURL: "https://github.com/testuser/web"},
+		}
+		if steps != nil {
+			req.Metadata = map[string]interface{}{"steps": steps}
+		}
+		return doRequest("POST", "/runs", req)
+	}
+	type step = map[string]interface{}
+
+	t.Run("classify steps", func(t *testing.T) {
+		for name, phase := range map[string]string{
+			"actions/checkout@v4":  service.PhaseCheckout,
+			"npm ci && npm install": service.PhaseDeps,
+			"Setup Go":             service.PhaseDeps,
+			"docker push":          service.PhaseDeploy,
+			"Run unit tests":       service.PhaseTest,
+			"go vet ./...":         service.PhaseTest,
+			"make":                 service.PhaseBuild,
+			"Build":                service.PhaseBuild,
+			"Post job cleanup":     service.PhaseOther,
+		} {
+			assert.Equal(t, phase, service.ClassifyStep(name), name)
+		}
+	})
+
+	t.Run("invalid steps", func(t *testing.T) {
+		for _, steps := range []interface{}{
+			"checkout",
+			[]interface{}{"checkout"},
+			[]step{{"phase": "deps"}},
+			[]step{{"name": "lint", "phase": "lint"}},
+			[]step{{"name": "npm ci", "energy_kwh": -1}},
+			[]step{{"name": "npm ci", "co2_kg": "a lot"}},
+		} {
+			w := submit(1, 0.4, steps)
+			assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+			assert.Contains(t, w.Body.String(), "INVALID_STEPS")
+		}
+	})
+
+	t.Run("emissions by phase", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			require.Equal(t, http.StatusCreated, submit(1, 0.4, []step{
+				{"name": "actions/checkout@v4", "energy_kwh": 0.025, "co2_kg": 0.01, "duration_s": 5},
+				{"name": "npm ci", "energy_kwh": 0.5, "co2_kg": 0.2, "duration_s": 60},
+				{"name": "npm run verify", "phase": "test", "energy_kwh": 0.25, "co2_kg": 0.1, "duration_s": 30},
+			}).Code)
+		}
+		// Steps without CO2 emit at the intensity of the run
+		require.Equal(t, http.StatusCreated, submit(1, 0.5, []step{
+			{"name": "Run make", "energy_kwh": 0.4, "duration_s": 100},
+			{"name": "Ship it", "phase": "deploy", "energy_kwh": 0.1, "co2_kg": 0.05},
+		}).Code)
+		require.Equal(t, http.StatusCreated, submit(1, 0.4, nil).Code)
+
+		var repo db.Repository
+		require.NoError(t, database.First(&repo, "full_name = ?", "testuser/web").Error)
+		w := doRequest("GET", "/repos/"+repo.ID.String()+"/phases", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response service.PhaseBreakdown
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, int64(4), response.RunCount)
+		assert.InDelta(t, 1.18, response.CO2Kg, 1e-9)
+		require.Len(t, response.Phases, len(service.Phases))
+
+		phases := map[string]service.PhaseStats{}
+		for _, phase := range response.Phases {
+			phases[phase.Phase] = phase
+		}
+		deps := phases[service.PhaseDeps]
+		assert.Equal(t, int64(3), deps.StepCount)
+		assert.Equal(t, int64(3), deps.RunCount)
+		assert.Equal(t, int64(3), deps.DominantRunCount)
+		assert.InDelta(t, 0.6, deps.CO2Kg, 1e-9)
+		assert.InDelta(t, 180, deps.DurationS, 1e-9)
+		assert.InDelta(t, 0.6/1.18, deps.Share, 1e-9)
+		assert.InDelta(t, 0.3, phases[service.PhaseTest].CO2Kg, 1e-9)
+		assert.InDelta(t, 0.03, phases[service.PhaseCheckout].CO2Kg, 1e-9)
+		assert.InDelta(t, 0.2, phases[service.PhaseBuild].CO2Kg, 1e-9)
+		assert.Equal(t, int64(1), phases[service.PhaseBuild].DominantRunCount)
+		assert.InDelta(t, 0.05, phases[service.PhaseDeploy].CO2Kg, 1e-9)
+		assert.Equal(t, int64(0), phases[service.PhaseOther].RunCount)
+
+		w = doRequest("GET", "/me/phases", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		// Installing dependencies emits 0.6 of the 0.83 kg of the steps of the first runs
+		w = doRequest("GET", "/repos/"+repo.ID.String()+"/recommendations", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var recommendations service.Recommendations
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &recommendations))
+		require.Len(t, recommendations.Recommendations, 1)
+		assert.Equal(t, service.RecommendationCacheDependencies, recommendations.Recommendations[0].Type)
+		assert.Equal(t, int64(4), recommendations.Recommendations[0].Runs)
+		assert.InDelta(t, 0.3, recommendations.Recommendations[0].EstimatedSavingsCO2Kg, 1e-9)
+	})
+}
+
+func TestRunTimeline(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+	repo := createTestRepository(t, database, user.ID)
+
+	createRun := func(metadata db.JSONB) *db.Run {
+		run := &db.Run{UserID: user.ID, RepositoryID: repo.ID, EnergyKWh: 0.1, CO2Kg: 0.04, DurationS: 60, RunMetadata: metadata}
+		require.NoError(t, database.Create(run).Error)
+		return run
+	}
+	get := func(runID string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/runs/"+runID+"/timeline", nil)
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("steps on the timeline", func(t *testing.T) {
+		run := createRun(db.JSONB{"steps": []interface{}{
+			map[string]interface{}{"name": "actions/checkout@v4", "energy_kwh": 0.001, "duration_s": 6.0},
+			map[string]interface{}{"name": "npm ci", "energy_kwh": 0.036, "co2_kg": 0.015, "duration_s": 36.0},
+			// Lint and unit tests ran in parallel with the install
+			map[string]interface{}{"name": "lint", "energy_kwh": 0.01, "duration_s": 20.0, "start_offset_s": 10.0},
+			map[string]interface{}{"name": "Unit tests", "energy_kwh": 0.05, "duration_s": 40.0},
+		}})
+		w := get(run.ID.String())
+		require.Equal(t, http.StatusOK, w.Code)
+		var timeline service.RunTimeline
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &timeline))
+		assert.Equal(t, run.ID, timeline.RunID)
+		// The last step ends after the duration of the run
+		assert.InDelta(t, 70, timeline.DurationS, 1e-9)
+		require.Len(t, timeline.Steps, 4)
+
+		expected := []struct {
+			index int
+			phase string
+			start float64
+			end   float64
+		}{
+			{0, service.PhaseCheckout, 0, 6},
+			{1, service.PhaseDeps, 6, 42},
+			{2, service.PhaseTest, 10, 30},
+			{3, service.PhaseTest, 30, 70},
+		}
+		for i, want := range expected {
+			step := timeline.Steps[i]
+			assert.Equal(t, want.index, step.Index)
+			assert.Equal(t, want.phase, step.Phase)
+			assert.InDelta(t, want.start, step.StartOffsetS, 1e-9)
+			assert.InDelta(t, want.end, step.EndOffsetS, 1e-9)
+		}
+		assert.InDelta(t, 0.015, timeline.Steps[1].CO2Kg, 1e-9)
+		assert.InDelta(t, 3600, timeline.Steps[1].PowerW, 1e-9)
+		// Steps without CO2 emit at the intensity of the run
+		assert.InDelta(t, 0.004, timeline.Steps[2].CO2Kg, 1e-9)
+	})
+
+	t.Run("run without steps", func(t *testing.T) {
+		w := get(createRun(nil).ID.String())
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "RUN_STEPS_NOT_FOUND")
+	})
+
+	t.Run("invisible run", func(t *testing.T) {
+		other := &db.User{GitHubID: 54321, GitHubUsername: "otheruser"}
+		require.NoError(t, database.Create(other).Error)
+		otherRepo := &db.Repository{OwnerID: other.ID, GitHubRepoID: 11111, Name: "secret", FullName: "otheruser/secret", HTMLURL: "https://github.com/otheruser/secret", Private: true}
+		require.NoError(t, database.Create(otherRepo).Error)
+		run := &db.Run{UserID: other.ID, RepositoryID: otherRepo.ID, DurationS: 60, RunMetadata: db.JSONB{"steps": []interface{}{map[string]interface{}{"name": "build"}}}}
+		require.NoError(t, database.Create(run).Error)
+		assert.Equal(t, http.StatusNotFound, get(run.ID.String()).Code)
+	})
+}
+
+func TestRunEnvironments(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	doRequest := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	submit := func(environment string, co2 float64) *httptest.ResponseRecorder {
+		return doRequest("POST", "/runs", service.RunCreateRequest{
+			EnergyKWh: co2 * 2, CO2Kg: co2, DurationS: 60, Environment: environment,
+			Repository: service.RepositoryCreateRequest{Name: "app", FullName: "testuser/app", HTMLURL: "https://github.com/testuser/app"},
+		})
+	}
+
+	t.Run("invalid environment", func(t *testing.T) {
+		w := submit("production", 1)
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), "INVALID_ENVIRONMENT")
+	})
+
+	t.Run("runs default to ci", func(t *testing.T) {
+		w := submit("", 1)
+		require.Equal(t, http.StatusCreated, w.Code)
+		var run db.Run
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &run))
+		assert.Equal(t, service.EnvironmentCI, run.Environment)
+	})
+
+	t.Run("statistics by environment", func(t *testing.T) {
+		require.Equal(t, http.StatusCreated, submit(service.EnvironmentCI, 1).Code)
+		require.Equal(t, http.StatusCreated, submit(service.EnvironmentProductionDeploy, 2).Code)
+
+		var repo db.Repository
+		require.NoError(t, database.First(&repo, "full_name = ?", "testuser/app").Error)
+		w := doRequest("GET", "/repos/"+repo.ID.String()+"/environments", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Environments []service.EnvironmentStats `json:"environments"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Environments, 3)
+		ci, staging, production := response.Environments[0], response.Environments[1], response.Environments[2]
+		assert.Equal(t, service.EnvironmentCI, ci.Environment)
+		assert.Equal(t, int64(2), ci.RunCount)
+		assert.InDelta(t, 1, ci.AvgCO2Kg, 1e-9)
+		assert.InDelta(t, 0.5, ci.Share, 1e-9)
+		assert.Equal(t, service.EnvironmentStaging, staging.Environment)
+		assert.Equal(t, int64(0), staging.RunCount)
+		assert.Equal(t, service.EnvironmentProductionDeploy, production.Environment)
+		assert.InDelta(t, 4, production.TotalEnergyKWh, 1e-9)
+
+		w = doRequest("GET", "/repos/"+repo.ID.String()+"/runs/aggregate?group_by=environment&metric=co2_kg", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"key":"production-deploy"`)
+
+		w = doRequest("GET", "/repos/"+repo.ID.String()+"/runs?filter="+url.QueryEscape("environment=production-deploy"), nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var runs struct {
+			Runs []db.Run `json:"runs"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &runs))
+		require.Len(t, runs.Runs, 1)
+		assert.InDelta(t, 2, runs.Runs[0].CO2Kg, 1e-9)
+	})
+}
+
+func TestImageBuilds(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	doRequest := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	submit := func(co2 float64, build *service.ImageBuildRequest) *httptest.ResponseRecorder {
+		return doRequest("POST", "/runs", service.RunCreateRequest{
+			EnergyKWh: 0.5, CO2Kg: co2, DurationS: 120,
+			Repository: service.RepositoryCreateRequest{Name: "images", FullName: "testuser/images", HTMLURL: "https://github.com/testuser/images"},
+			ImageBuild: build,
+		})
+	}
+	int64Ptr := func(v int64) *int64 { return &v }
+
+	t.Run("invalid image builds", func(t *testing.T) {
+		for _, build := range []*service.ImageBuildRequest{
+			{},
+			{LayersBuilt: -1, LayersCached: 3},
+			{LayersBuilt: 1, PushBytes: int64Ptr(-1)},
+		} {
+			w := submit(0.2, build)
+			assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+			assert.Contains(t, w.Body.String(), "INVALID_IMAGE_BUILD")
+		}
+	})
+
+	var run db.Run
+	t.Run("image-build runs", func(t *testing.T) {
+		w := submit(0.3, &service.ImageBuildRequest{Image: stringPtr("ghcr.io/testuser/images:1"), LayersBuilt: 3, LayersCached: 1,
+			ImageSizeBytes: int64Ptr(400e6), PushBytes: int64Ptr(100e6)})
+		require.Equal(t, http.StatusCreated, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &run))
+		require.NotNil(t, run.ImageBuild)
+		assert.Equal(t, 3, run.ImageBuild.LayersBuilt)
+		assert.Equal(t, int64(100e6), *run.ImageBuild.PushBytes)
+
+		w = submit(0.1, &service.ImageBuildRequest{LayersBuilt: 1, LayersCached: 7})
+		require.Equal(t, http.StatusCreated, w.Code)
+		// Runs without an image build are left out
+		w = submit(1, nil)
+		require.Equal(t, http.StatusCreated, w.Code)
+	})
+
+	t.Run("cache hit rate", func(t *testing.T) {
+		w := doRequest("GET", "/repos/"+run.RepositoryID.String()+"/image-builds?interval=day", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var stats service.ImageBuildStats
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+		assert.Equal(t, int64(2), stats.Summary.BuildCount)
+		assert.Equal(t, int64(4), stats.Summary.LayersBuilt)
+		assert.Equal(t, int64(8), stats.Summary.LayersCached)
+		require.NotNil(t, stats.Summary.CacheHitRate)
+		assert.InDelta(t, 8.0/12, *stats.Summary.CacheHitRate, 1e-9)
+		require.NotNil(t, stats.Summary.AvgImageSizeBytes)
+		assert.InDelta(t, 400e6, *stats.Summary.AvgImageSizeBytes, 1e-3)
+		assert.Equal(t, int64(100e6), stats.Summary.PushBytes)
+		// 0.4 kg over 4 built layers, saved 8 times over by the cache
+		require.NotNil(t, stats.Summary.CacheSavingsCO2Kg)
+		assert.InDelta(t, 0.1, *stats.Summary.CO2PerBuiltLayerKg, 1e-9)
+		assert.InDelta(t, 0.8, *stats.Summary.CacheSavingsCO2Kg, 1e-9)
+
+		// The trend covers every day of the range, the last one holding the builds
+		require.Len(t, stats.Trend, 31)
+		assert.Equal(t, int64(2), stats.Trend[30].BuildCount)
+		assert.Nil(t, stats.Trend[0].CacheHitRate)
+
+		w = doRequest("GET", "/repos/"+run.RepositoryID.String()+"/image-builds?interval=hour", nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestNetworkTransfer(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	doRequest := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	submit := func(networkBytes int64, metadata map[string]interface{}) *httptest.ResponseRecorder {
+		return doRequest("POST", "/runs", service.RunCreateRequest{
+			EnergyKWh: 0.5, CO2Kg: 0.2, DurationS: 120,
+			Repository:   service.RepositoryCreateRequest{Name: "images", FullName: "testuser/images", HTMLURL: "https://github.com/testuser/images"},
+			Metadata:     metadata,
+			NetworkBytes: &networkBytes,
+		})
+	}
+
+	t.Run("negative transfer", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnprocessableEntity, submit(-1, nil).Code)
+	})
+
+	t.Run("transfer emissions", func(t *testing.T) {
+		// 5 GB at 0.001 kWh/GB and the carbon intensity of the run
+		w := submit(5e9, map[string]interface{}{"carbon_intensity": 200})
+		require.Equal(t, http.StatusCreated, w.Code)
+		var run db.Run
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &run))
+		require.NotNil(t, run.NetworkEnergyKWh)
+		assert.InDelta(t, 0.005, *run.NetworkEnergyKWh, 1e-9)
+		require.NotNil(t, run.NetworkCO2Kg)
+		assert.InDelta(t, 0.001, *run.NetworkCO2Kg, 1e-9)
+		assert.Equal(t, 0.2, run.CO2Kg)
+
+		// Region averages apply without a carbon intensity
+		w = submit(1e9, map[string]interface{}{"region": "us-east-1"})
+		require.Equal(t, http.StatusCreated, w.Code)
+		run = db.Run{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &run))
+		require.NotNil(t, run.NetworkCO2Kg)
+		assert.InDelta(t, 0.000379, *run.NetworkCO2Kg, 1e-9)
+	})
+
+	t.Run("stats report the transfer apart", func(t *testing.T) {
+		w := doRequest("GET", "/me/stats", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Summary service.PeriodSummary `json:"summary"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, int64(6e9), response.Summary.TotalNetworkBytes)
+		assert.InDelta(t, 0.006, response.Summary.TotalNetworkEnergyKWh, 1e-9)
+		assert.InDelta(t, 0.001379, response.Summary.TotalNetworkCO2Kg, 1e-9)
+		assert.InDelta(t, 0.4, response.Summary.TotalCO2Kg, 1e-9)
+	})
+}
+
+func TestRepositoryLanguages(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	githubAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/testuser/testrepo/languages":
+			w.Write([]byte(`{"Go": 7500, "Shell": 2000, "Makefile": 500}`))
+		case "/repos/testuser/webapp/languages":
+			w.Write([]byte(`{"TypeScript": 9000, "CSS": 1000}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer githubAPI.Close()
+	server.languageService = service.NewLanguageService(server.db, github.NewClient(githubAPI.URL, ""))
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+	goRepo := createTestRepository(t, database, user.ID)
+	webRepo := &db.Repository{OwnerID: user.ID, GitHubRepoID: 67891, Name: "webapp", FullName: "testuser/webapp", HTMLURL: "https://github.com/testuser/webapp"}
+	require.NoError(t, database.Create(webRepo).Error)
+	goneRepo := &db.Repository{OwnerID: user.ID, GitHubRepoID: 67892, Name: "gone", FullName: "testuser/gone", HTMLURL: "https://github.com/testuser/gone"}
+	require.NoError(t, database.Create(goneRepo).Error)
+	createTestRun(t, database, user.ID, goRepo.ID)
+	createTestRun(t, database, user.ID, goRepo.ID)
+	createTestRun(t, database, user.ID, webRepo.ID)
+
+	call := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, nil)
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("sync a repository", func(t *testing.T) {
+		w := call("POST", "/repos/"+goRepo.ID.String()+"/languages/sync")
+		require.Equal(t, http.StatusOK, w.Code)
+		var languages service.RepositoryLanguages
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &languages))
+		require.NotNil(t, languages.Primary)
+		assert.Equal(t, "Go", *languages.Primary)
+		assert.NotNil(t, languages.SyncedAt)
+		require.Len(t, languages.Languages, 3)
+		assert.Equal(t, service.LanguageShare{Language: "Go", Bytes: 7500, Share: 0.75}, languages.Languages[0])
+
+		w = call("POST", "/repos/"+goneRepo.ID.String()+"/languages/sync")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "GITHUB_REPOSITORY_NOT_FOUND")
+	})
+
+	t.Run("sync job", func(t *testing.T) {
+		synced, failed, err := server.languageService.SyncStale(context.Background(), time.Now())
+		require.NoError(t, err)
+		// The repository synced before is not stale; the one GitHub cannot show is marked synced
+		assert.Equal(t, 2, synced)
+		assert.Equal(t, 0, failed)
+
+		synced, _, err = server.languageService.SyncStale(context.Background(), time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, 0, synced)
+
+		w := call("GET", "/repos/"+webRepo.ID.String()+"/languages")
+		require.Equal(t, http.StatusOK, w.Code)
+		var languages service.RepositoryLanguages
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &languages))
+		require.NotNil(t, languages.Primary)
+		assert.Equal(t, "TypeScript", *languages.Primary)
+	})
+
+	t.Run("stats by primary language", func(t *testing.T) {
+		w := call("GET", "/me/languages")
+		require.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Languages []service.LanguageStats `json:"languages"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Languages, 2)
+		require.NotNil(t, response.Languages[0].Language)
+		assert.Equal(t, "Go", *response.Languages[0].Language)
+		assert.Equal(t, int64(1), response.Languages[0].RepositoryCount)
+		assert.Equal(t, int64(2), response.Languages[0].RunCount)
+		assert.InDelta(t, 0.6, response.Languages[0].TotalCO2Kg, 1e-9)
+		assert.InDelta(t, 0.3, response.Languages[0].AvgCO2Kg, 1e-9)
+		require.NotNil(t, response.Languages[1].Language)
+		assert.Equal(t, "TypeScript", *response.Languages[1].Language)
+	})
+}
+
+func TestTestSuites(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+	repo := createTestRepository(t, database, user.ID)
+	run := createTestRun(t, database, user.ID, repo.ID)
+
+	other := &db.User{GitHubID: 54321, GitHubUsername: "otheruser"}
+	require.NoError(t, database.Create(other).Error)
+	otherToken := generateTestJWT(t, server, other.ID, other.GitHubUsername)
+
+	doRequest := func(method, path, token, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/xml")
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	path := "/runs/" + run.ID.String() + "/test-suites"
+	report := `<testsuites>
+  <testsuite name="api" time="90"><testcase name="create" time="90"><failure/></testcase></testsuite>
+  <testsuite name="db" time="30"><testcase name="migrate" time="30"/></testsuite>
+</testsuites>`
+
+	t.Run("invalid report", func(t *testing.T) {
+		w := doRequest("PUT", path, token, "<html></html>")
+		assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+		assert.Contains(t, w.Body.String(), "INVALID_TEST_REPORT")
+	})
+
+	t.Run("only the submitter uploads", func(t *testing.T) {
+		// Others can see the runs of the public repository but not change their reports
+		w := doRequest("PUT", path, otherToken, report)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "NOT_RUN_SUBMITTER")
+		w = doRequest("GET", path, otherToken, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("energy is apportioned by duration", func(t *testing.T) {
+		w := doRequest("PUT", path, token, report)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			TestSuites []db.RunTestSuite `json:"test_suites"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.TestSuites, 2)
+		assert.Equal(t, "api", response.TestSuites[0].Name)
+		assert.Equal(t, 1, response.TestSuites[0].Failures)
+		assert.InDelta(t, 0.375, response.TestSuites[0].EnergyKWh, 1e-9)
+		assert.InDelta(t, 0.225, response.TestSuites[0].CO2Kg, 1e-9)
+		assert.InDelta(t, 0.075, response.TestSuites[1].CO2Kg, 1e-9)
+
+		// Uploading again replaces the suites
+		w = doRequest("PUT", path, token, `<testsuite name="api" time="10"/>`)
+		require.Equal(t, http.StatusOK, w.Code)
+		w = doRequest("GET", path, token, "")
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.TestSuites, 1)
+		assert.InDelta(t, 0.3, response.TestSuites[0].CO2Kg, 1e-9)
+	})
+
+	t.Run("repository breakdown", func(t *testing.T) {
+		second := createTestRun(t, database, user.ID, repo.ID)
+		w := doRequest("PUT", "/runs/"+second.ID.String()+"/test-suites", token, report)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = doRequest("GET", "/repos/"+repo.ID.String()+"/test-suites", token, "")
+		require.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			TestSuites []service.TestSuiteStats `json:"test_suites"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.TestSuites, 2)
+		assert.Equal(t, "api", response.TestSuites[0].Name)
+		assert.Equal(t, int64(2), response.TestSuites[0].RunCount)
+		assert.InDelta(t, 0.525, response.TestSuites[0].CO2Kg, 1e-9)
+		assert.InDelta(t, 0.2625, response.TestSuites[0].AvgCO2Kg, 1e-9)
+		assert.Equal(t, "db", response.TestSuites[1].Name)
+		assert.Equal(t, int64(1), response.TestSuites[1].RunCount)
+	})
+
+	t.Run("the repository owner uploads", func(t *testing.T) {
+		submitted := createTestRun(t, database, other.ID, repo.ID)
+		w := doRequest("PUT", "/runs/"+submitted.ID.String()+"/test-suites", token, report)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	})
+}
+
+func TestStorageEmissions(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+	repo := createTestRepository(t, database, user.ID)
+
+	doRequest := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	path := "/repos/" + repo.ID.String() + "/storage"
+
+	t.Run("invalid report", func(t *testing.T) {
+		w := doRequest("POST", path, map[string]interface{}{"artifact_bytes": 1})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w = doRequest("POST", path, map[string]interface{}{"artifact_bytes": -1, "cache_bytes": 0})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "INVALID_STORAGE_REPORT")
+	})
+
+	t.Run("report", func(t *testing.T) {
+		w := doRequest("POST", path, map[string]interface{}{"artifact_bytes": 7e11, "cache_bytes": 3e11})
+		require.Equal(t, http.StatusCreated, w.Code)
+		var report db.StorageReport
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+		assert.Equal(t, int64(7e11), report.ArtifactBytes)
+	})
+
+	t.Run("accrued footprint", func(t *testing.T) {
+		// The day of the report and the two after it are complete three days later
+		now := time.Now().UTC()
+		days, err := server.storageService.AccrueAll(context.Background(), now.AddDate(0, 0, 3))
+		require.NoError(t, err)
+		assert.Equal(t, 3, days)
+
+		// Accrued days are not accrued again
+		days, err = server.storageService.AccrueAll(context.Background(), now.AddDate(0, 0, 3))
+		require.NoError(t, err)
+		assert.Equal(t, 0, days)
+
+		w := doRequest("GET", path+"?from="+now.Format("2006-01-02")+"&to="+now.AddDate(0, 0, 5).Format("2006-01-02"), nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var footprint service.StorageFootprint
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &footprint))
+		require.NotNil(t, footprint.Latest)
+		// 1 TB at 1.42 kWh per TB-month and 400 g CO2e/kWh
+		assert.InDelta(t, 1.42, footprint.MonthlyEnergyKWh, 1e-9)
+		assert.InDelta(t, 0.568, footprint.MonthlyCO2Kg, 1e-9)
+		assert.Equal(t, int64(3), footprint.Days)
+		assert.InDelta(t, 3*1.42/(365.25/12), footprint.EnergyKWh, 1e-9)
+		assert.InDelta(t, 3*0.568/(365.25/12), footprint.CO2Kg, 1e-9)
+	})
+}
+
+func TestCarbonOffsets(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	org := &db.Organization{GitHubID: 778, GitHubLogin: "offsetorg"}
+	require.NoError(t, database.Create(org).Error)
+	require.NoError(t, database.Create(&db.OrganizationMember{OrganizationID: org.ID, UserID: user.ID, Role: db.OrganizationRoleAdmin}).Error)
+	repo := createTestRepository(t, database, user.ID)
+	require.NoError(t, database.Model(repo).Update("organization_id", org.ID).Error)
+	for i := 0; i < 4; i++ {
+		run := createTestRun(t, database, user.ID, repo.ID)
+		require.NoError(t, database.Model(run).Update("created_at", time.Date(2024, 3, 10+i, 12, 0, 0, 0, time.UTC)).Error)
+	}
+
+	doRequest := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	emissions := func() service.NetEmissions {
+		w := doRequest("GET", "/orgs/offsetorg/stats?from=2024-03-01T00:00:00Z&to=2024-04-01T00:00:00Z", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Emissions service.NetEmissions `json:"emissions"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Emissions
+	}
+
+	t.Run("validation", func(t *testing.T) {
+		for _, body := range []map[string]interface{}{
+			{"kind": "offset", "energy_kwh": 1, "vendor": "Acme", "period_start": "2024-03-01", "period_end": "2024-03-31"},
+			{"kind": "renewable", "energy_kwh": -1, "vendor": "Acme", "period_start": "2024-03-01", "period_end": "2024-03-31"},
+			{"kind": "credit", "co2_kg": 1, "vendor": "Acme", "period_start": "2024-03-01", "period_end": "2024-03-31"},
+			{"kind": "offset", "co2_kg": 1, "vendor": "Acme", "period_start": "2024-03-31", "period_end": "2024-03-01"},
+			{"kind": "offset", "co2_kg": 1, "vendor": "Acme", "certificate_url": "ftp://acme", "period_start": "2024-03-01", "period_end": "2024-03-31"},
+		} {
+			w := doRequest("POST", "/orgs/offsetorg/offsets", body)
+			assert.Equal(t, http.StatusBadRequest, w.Code, body)
+			assert.Contains(t, w.Body.String(), "INVALID_CARBON_OFFSET")
+		}
+	})
+
+	t.Run("no offsets", func(t *testing.T) {
+		got := emissions()
+		assert.InDelta(t, 1.2, got.GrossCO2Kg, 1e-9)
+		assert.InDelta(t, 1.2, got.MarketBasedCO2Kg, 1e-9)
+		assert.InDelta(t, 1.2, got.NetCO2Kg, 1e-9)
+	})
+
+	w := doRequest("POST", "/orgs/offsetorg/offsets", map[string]interface{}{
+		"kind": "renewable", "energy_kwh": 1, "vendor": "Windco",
+		"certificate_url": "https://windco.example/certificates/42", "period_start": "2024-03-01", "period_end": "2024-03-31",
+	})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var renewable db.CarbonOffset
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &renewable))
+	assert.Equal(t, "renewable", renewable.Kind)
+
+	w = doRequest("POST", "/orgs/offsetorg/offsets", map[string]interface{}{
+		"kind": "offset", "co2_kg": 0.4, "vendor": "Treeco", "period_start": "2024-03-01", "period_end": "2024-03-31",
+	})
+	require.Equal(t, http.StatusCreated, w.Code)
+	w = doRequest("POST", "/orgs/offsetorg/offsets", map[string]interface{}{
+		"kind": "offset", "co2_kg": 100, "vendor": "Treeco", "period_start": "2023-01-01", "period_end": "2023-12-31",
+	})
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	t.Run("market-based and net", func(t *testing.T) {
+		got := emissions()
+		assert.InDelta(t, 1.2, got.GrossCO2Kg, 1e-9)
+		assert.InDelta(t, 1.0, got.RenewableMatchedKWh, 1e-9)
+		assert.InDelta(t, 0.6, got.RenewableCO2Kg, 1e-9)
+		assert.InDelta(t, 0.6, got.MarketBasedCO2Kg, 1e-9)
+		assert.InDelta(t, 0.4, got.OffsetCO2Kg, 1e-9)
+		assert.InDelta(t, 0.2, got.NetCO2Kg, 1e-9)
+	})
+
+	t.Run("partial periods are prorated", func(t *testing.T) {
+		// 31 of the 60 days of February and March 2024 fall in the range
+		w := doRequest("POST", "/orgs/offsetorg/offsets", map[string]interface{}{
+			"kind": "offset", "co2_kg": 6, "vendor": "Treeco", "period_start": "2024-02-01", "period_end": "2024-03-31",
+		})
+		require.Equal(t, http.StatusCreated, w.Code)
+
+		got := emissions()
+		assert.InDelta(t, 3.5, got.OffsetCO2Kg, 1e-9)
+		assert.Equal(t, 0.0, got.NetCO2Kg)
+	})
+
+	t.Run("accounting method", func(t *testing.T) {
+		summary := func(path string) service.PeriodSummary {
+			w := doRequest("GET", path, nil)
+			require.Equal(t, http.StatusOK, w.Code)
+			var response struct {
+				Summary    service.PeriodSummary    `json:"summary"`
+				Comparison service.PeriodComparison `json:"comparison"`
+				Emissions  service.NetEmissions     `json:"emissions"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			if response.Comparison.Compare != "" {
+				assert.Equal(t, response.Summary.Method, response.Comparison.Previous.Method)
+			}
+			if strings.HasPrefix(path, "/orgs/") {
+				assert.InDelta(t, 1.2, response.Emissions.GrossCO2Kg, 1e-9)
+				assert.InDelta(t, 0.6, response.Emissions.MarketBasedCO2Kg, 1e-9)
+			}
+			return response.Summary
+		}
+		const period = "from=2024-03-01T00:00:00Z&to=2024-04-01T00:00:00Z"
+
+		// Location-based is the default
+		got := summary("/repos/" + repo.ID.String() + "/stats?" + period)
+		assert.Equal(t, service.AccountingLocation, got.Method)
+		assert.InDelta(t, 1.2, got.TotalCO2Kg, 1e-9)
+		assert.Nil(t, got.LocationBasedCO2Kg)
+
+		// The renewable purchase matches half of the 2 kWh used in March
+		for _, path := range []string{
+			"/repos/" + repo.ID.String() + "/stats?method=market&compare=previous_period&" + period,
+			"/me/stats?method=market&" + period,
+			"/orgs/offsetorg/stats?method=market&" + period,
+		} {
+			got := summary(path)
+			assert.Equal(t, service.AccountingMarket, got.Method, path)
+			assert.InDelta(t, 0.6, got.TotalCO2Kg, 1e-9, path)
+			require.NotNil(t, got.LocationBasedCO2Kg, path)
+			assert.InDelta(t, 1.2, *got.LocationBasedCO2Kg, 1e-9, path)
+		}
+
+		// Runs of repositories without an organization have no purchases to match them
+		solo := &db.Repository{OwnerID: user.ID, GitHubRepoID: 67891, Name: "solo", FullName: "testuser/solo", HTMLURL: "https://github.com/testuser/solo"}
+		require.NoError(t, database.Create(solo).Error)
+		other := createTestRun(t, database, user.ID, solo.ID)
+		require.NoError(t, database.Model(other).Update("created_at", time.Date(2024, 3, 20, 12, 0, 0, 0, time.UTC)).Error)
+		got = summary("/me/stats?method=market&" + period)
+		assert.InDelta(t, 0.9, got.TotalCO2Kg, 1e-9)
+		require.NoError(t, database.Delete(other).Error)
+
+		w := doRequest("GET", "/me/stats?method=residual", nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "INVALID_ACCOUNTING_METHOD")
+	})
+
+	t.Run("list and delete", func(t *testing.T) {
+		w := doRequest("GET", "/orgs/offsetorg/offsets", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Offsets []db.CarbonOffset `json:"offsets"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Len(t, response.Offsets, 4)
+
+		w = doRequest("DELETE", "/orgs/offsetorg/offsets/"+renewable.ID.String(), nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		w = doRequest("DELETE", "/orgs/offsetorg/offsets/"+renewable.ID.String(), nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		got := emissions()
+		assert.Equal(t, 0.0, got.RenewableMatchedKWh)
+		assert.InDelta(t, 1.2, got.MarketBasedCO2Kg, 1e-9)
+	})
+
+	t.Run("admins only change offsets", func(t *testing.T) {
+		offsets, err := server.offsetService.ListOffsets(org.ID)
+		require.NoError(t, err)
+		require.Len(t, offsets, 3)
+
+		member := &db.User{GitHubID: 4343, GitHubUsername: "member"}
+		require.NoError(t, database.Create(member).Error)
+		require.NoError(t, database.Create(&db.OrganizationMember{OrganizationID: org.ID, UserID: member.ID}).Error)
+		token = generateTestJWT(t, server, member.ID, member.GitHubUsername)
+
+		w := doRequest("GET", "/orgs/offsetorg/offsets", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		w = doRequest("POST", "/orgs/offsetorg/offsets", map[string]interface{}{
+			"kind": "offset", "co2_kg": 1000, "vendor": "Treeco", "period_start": "2024-03-01", "period_end": "2024-03-31",
+		})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "NOT_ORGANIZATION_ADMIN")
+		w = doRequest("DELETE", "/orgs/offsetorg/offsets/"+offsets[0].ID.String(), nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		offsets, err = server.offsetService.ListOffsets(org.ID)
+		require.NoError(t, err)
+		assert.Len(t, offsets, 3)
+	})
+
+	t.Run("members only", func(t *testing.T) {
+		other := &db.User{GitHubID: 4242, GitHubUsername: "outsider"}
+		require.NoError(t, database.Create(other).Error)
+		token = generateTestJWT(t, server, other.ID, other.GitHubUsername)
+		w := doRequest("GET", "/orgs/offsetorg/offsets", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestAlertRules(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	org := &db.Organization{GitHubID: 777, GitHubLogin: "greenorg"}
+	require.NoError(t, database.Create(org).Error)
+	require.NoError(t, database.Create(&db.OrganizationMember{OrganizationID: org.ID, UserID: user.ID}).Error)
+	repo := createTestRepository(t, database, user.ID)
+	require.NoError(t, database.Model(repo).Update("organization_id", org.ID).Error)
+
+	var mu sync.Mutex
+	var messages []map[string]interface{}
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var message map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&message)
+		mu.Lock()
+		messages = append(messages, message)
+		mu.Unlock()
+	}))
+	defer slack.Close()
+	_, err := server.notificationService.SetIntegration(org.ID, "slack", &service.IntegrationRequest{WebhookURL: stringPtr(slack.URL)})
+	require.NoError(t, err)
+
+	sender := &recordingSender{}
+	server.mailer = mail.NewMailer(sender, "https://app.ecoci.dev", server.userService, server.statsService)
+	server.alerts = alerts.NewEngine(server.alertService, server.notificationService, server.userService, server.mailer)
+
+	doRequest := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		payload, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewBuffer(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("validation", func(t *testing.T) {
+		w := doRequest("POST", "/alert-rules", map[string]interface{}{
+			"name": "Own runs", "scope": "user", "metric": "co2_kg", "comparison": "above",
+			"threshold": 1, "window": "week", "channel": "slack",
+		})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "INVALID_ALERT_RULE")
+
+		w = doRequest("POST", "/alert-rules", map[string]interface{}{
+			"name": "Unknown", "scope": "repository", "repository_id": uuid.New(), "metric": "co2_kg",
+			"comparison": "above", "threshold": 1, "window": "week", "channel": "email",
+		})
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	w := doRequest("POST", "/alert-rules", map[string]interface{}{
+		"name": "Weekly CO2", "scope": "repository", "repository_id": repo.ID, "metric": "co2_kg",
+		"comparison": "above", "threshold": 0.5, "window": "week", "channel": "slack", "destination": "#carbon",
+	})
+	require.Equal(t, http.StatusCreated, w.Code)
+	var weekly db.AlertRule
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &weekly))
+	assert.Equal(t, "sum", weekly.Aggregation)
+	assert.True(t, weekly.Enabled)
+
+	w = doRequest("POST", "/alert-rules", map[string]interface{}{
+		"name": "Org growth", "scope": "organization", "organization": "greenorg", "metric": "co2_kg",
+		"aggregation": "avg", "comparison": "increase_percent", "threshold": 20, "window": "week", "channel": "email",
+	})
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	t.Run("evaluation", func(t *testing.T) {
+		previous := createTestRun(t, database, user.ID, repo.ID)
+		require.NoError(t, database.Model(previous).Update("created_at", time.Now().UTC().AddDate(0, 0, -8)).Error)
+		require.NoError(t, database.Model(previous).Update("co2_kg", 0.1).Error)
+		createTestRun(t, database, user.ID, repo.ID)
+		createTestRun(t, database, user.ID, repo.ID)
+
+		triggered, err := server.alerts.EvaluateAll(context.Background(), time.Now().UTC())
+		require.NoError(t, err)
+		assert.Equal(t, 2, triggered)
+		server.mailer.Wait()
+
+		require.Len(t, messages, 1)
+		assert.Equal(t, "#carbon", messages[0]["channel"])
+		attachment := messages[0]["attachments"].([]interface{})[0].(map[string]interface{})
+		assert.Equal(t, `Alert "Weekly CO2" triggered for testuser/testrepo`, attachment["title"])
+		assert.Contains(t, attachment["text"], "total CO₂ over the last week is 600.0 g, above the threshold of 500.0 g")
+
+		emails := sender.take()
+		require.Len(t, emails, 1)
+		assert.Equal(t, `Alert "Org growth" triggered for greenorg`, emails[0].Subject)
+		assert.Contains(t, emails[0].Text, "rose by 200%")
+
+		// A lasting breach is delivered once per window
+		triggered, err = server.alerts.EvaluateAll(context.Background(), time.Now().UTC())
+		require.NoError(t, err)
+		assert.Equal(t, 0, triggered)
+
+		w := doRequest("GET", "/alert-rules/"+weekly.ID.String(), nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var rule db.AlertRule
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rule))
+		require.NotNil(t, rule.LastTriggeredAt)
+		assert.InDelta(t, 0.6, *rule.LastValue, 0.0001)
+	})
+
+	t.Run("update and delete", func(t *testing.T) {
+		w := doRequest("PUT", "/alert-rules/"+weekly.ID.String(), map[string]interface{}{
+			"name": "Weekly CO2", "scope": "repository", "repository_id": repo.ID, "metric": "co2_kg",
+			"comparison": "above", "threshold": 5, "window": "week", "channel": "slack", "enabled": false,
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+		var rule db.AlertRule
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rule))
+		assert.False(t, rule.Enabled)
+		assert.Nil(t, rule.LastTriggeredAt)
+
+		w = doRequest("DELETE", "/alert-rules/"+weekly.ID.String(), nil)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = doRequest("GET", "/alert-rules", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Rules []db.AlertRule `json:"rules"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Rules, 1)
+		assert.Equal(t, "Org growth", response.Rules[0].Name)
+	})
+}
+
+func TestRepositoryRollups(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+	repo := createTestRepository(t, database, user.ID)
+
+	now := time.Now().UTC()
+	createTestRun(t, database, user.ID, repo.ID)
+	latest := createTestRun(t, database, user.ID, repo.ID)
+	old := &db.Run{UserID: user.ID, RepositoryID: repo.ID, CO2Kg: 0.9, EnergyKWh: 1.5, DurationS: 60, CreatedAt: now.AddDate(0, 0, -2)}
+	require.NoError(t, database.Create(old).Error)
+
+	listStats := func(t *testing.T) map[string]interface{} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/repos", nil)
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Repositories []struct {
+				Stats map[string]interface{} `json:"stats"`
+			} `json:"repositories"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Repositories, 1)
+		return response.Repositories[0].Stats
+	}
+
+	t.Run("maintained on ingest", func(t *testing.T) {
+		var rollups []db.RepositoryDailyRollup
+		require.NoError(t, database.Where("repository_id = ?", repo.ID).Order("day ASC").Find(&rollups).Error)
+		require.Len(t, rollups, 2)
+		assert.Equal(t, db.RollupDay(old.CreatedAt), rollups[0].Day.UTC())
+		assert.Equal(t, int64(1), rollups[0].RunCount)
+		assert.Equal(t, db.RollupDay(latest.CreatedAt), rollups[1].Day.UTC())
+		assert.Equal(t, int64(2), rollups[1].RunCount)
+		assert.InDelta(t, 0.6, rollups[1].TotalCO2Kg, 1e-9)
+		assert.InDelta(t, 1.0, rollups[1].TotalEnergyKWh, 1e-9)
+		assert.InDelta(t, 240.0, rollups[1].TotalDurationS, 1e-9)
+	})
+
+	t.Run("list served from rollups", func(t *testing.T) {
+		stats := listStats(t)
+		assert.Equal(t, float64(3), stats["run_count"])
+		assert.InDelta(t, 1.5, stats["total_co2_kg"], 1e-9)
+		assert.InDelta(t, 0.5, stats["avg_co2_kg"], 1e-9)
+		assert.InDelta(t, 2.5, stats["total_energy_kwh"], 1e-9)
+		lastRunAt, err := time.Parse(time.RFC3339Nano, stats["last_run_at"].(string))
+		require.NoError(t, err)
+		assert.WithinDuration(t, latest.CreatedAt, lastRunAt, time.Millisecond)
+	})
+
+	t.Run("rebuilt on delete", func(t *testing.T) {
+		require.NoError(t, server.runService.DeleteRun(old.ID, user.ID))
+
+		stats := listStats(t)
+		assert.Equal(t, float64(2), stats["run_count"])
+		assert.InDelta(t, 0.6, stats["total_co2_kg"], 1e-9)
+		assert.InDelta(t, 0.3, stats["avg_co2_kg"], 1e-9)
+	})
+
+	t.Run("backfill", func(t *testing.T) {
+		require.NoError(t, database.Where("repository_id = ?", repo.ID).Delete(&db.RepositoryDailyRollup{}).Error)
+
+		rebuilt, err := server.repoService.BackfillRollups(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 1, rebuilt)
+
+		stats := listStats(t)
+		assert.Equal(t, float64(2), stats["run_count"])
+		assert.InDelta(t, 0.6, stats["total_co2_kg"], 1e-9)
+
+		rebuilt, err = server.repoService.BackfillRollups(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 0, rebuilt)
+
+		createTestRun(t, database, user.ID, repo.ID)
+		assert.Equal(t, float64(3), listStats(t)["run_count"])
+	})
+}
+
+func TestResponseCache(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	redisServer := miniredis.RunT(t)
+	responseCache, err := cache.New("redis://" + redisServer.Addr())
+	require.NoError(t, err)
+	defer responseCache.Close()
+	server.cache = responseCache
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+	repo := createTestRepository(t, database, user.ID)
+	createTestRun(t, database, user.ID, repo.ID)
+
+	get := func(path string, header map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		for name, value := range header {
+			req.Header.Set(name, value)
+		}
+		server.router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		return w
+	}
+	runCount := func(w *httptest.ResponseRecorder) float64 {
+		var response struct {
+			Repositories []struct {
+				Stats struct {
+					RunCount float64 `json:"run_count"`
+				} `json:"stats"`
+			} `json:"repositories"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Repositories, 1)
+		return response.Repositories[0].Stats.RunCount
+	}
+
+	t.Run("miss then hit", func(t *testing.T) {
+		first := get("/repos", nil)
+		assert.Equal(t, "MISS", first.Header().Get(CacheStatusHeader))
+		assert.Equal(t, float64(1), runCount(first))
+
+		// Runs written behind the API's back are not visible until the entry is invalidated
+		createTestRun(t, database, user.ID, repo.ID)
+		second := get("/repos", nil)
+		assert.Equal(t, "HIT", second.Header().Get(CacheStatusHeader))
+		assert.Equal(t, first.Body.String(), second.Body.String())
+		assert.Equal(t, "application/json; charset=utf-8", second.Header().Get("Content-Type"))
+	})
+
+	t.Run("bypass header", func(t *testing.T) {
+		w := get("/repos", map[string]string{CacheBypassHeader: "true"})
+		assert.Equal(t, "BYPASS", w.Header().Get(CacheStatusHeader))
+		assert.Equal(t, float64(2), runCount(w))
+	})
+
+	t.Run("keyed by query and viewer", func(t *testing.T) {
+		assert.Equal(t, "MISS", get("/repos?limit=5", nil).Header().Get(CacheStatusHeader))
+
+		other := &db.User{GitHubID: 54321, GitHubUsername: "otheruser"}
+		require.NoError(t, database.Create(other).Error)
+		otherToken := generateTestJWT(t, server, other.ID, other.GitHubUsername)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/repos", nil)
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: otherToken,
+		})
+		server.router.ServeHTTP(w, req)
+		assert.Equal(t, "MISS", w.Header().Get(CacheStatusHeader))
+	})
+
+	t.Run("invalidated on ingest", func(t *testing.T) {
+		stats := "/repos/" + repo.ID.String() + "/stats"
+		get(stats, nil)
+		assert.Equal(t, "HIT", get(stats, nil).Header().Get(CacheStatusHeader))
+
+		runData := service.RunCreateRequest{
+			EnergyKWh: 0.5,
+			CO2Kg:     0.3,
+			DurationS: 120.0,
+			Repository: service.RepositoryCreateRequest{
+				Name:     "testrepo",
+				FullName: "testuser/testrepo",
+				HTMLURL:  "https://github.com/testuser/testrepo",
+			},
+		}
+		jsonData, _ := json.Marshal(runData)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/runs", bytes.NewBuffer(jsonData))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusCreated, w.Code)
+
+		list := get("/repos", nil)
+		assert.Equal(t, "MISS", list.Header().Get(CacheStatusHeader))
+		assert.Equal(t, float64(3), runCount(list))
+		assert.Equal(t, "MISS", get(stats, nil).Header().Get(CacheStatusHeader))
+	})
+
+	t.Run("errors are not cached", func(t *testing.T) {
+		path := "/repos/" + repo.ID.String() + "/stats?from=invalid"
+		for i := 0; i < 2; i++ {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", path, nil)
+			req.AddCookie(&http.Cookie{
+				Name:  "ecoci_token",
+				Value: token,
+			})
+			server.router.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Equal(t, "MISS", w.Header().Get(CacheStatusHeader))
+		}
+	})
+
+	t.Run("unreachable redis", func(t *testing.T) {
+		redisServer.Close()
+		w := get("/repos", nil)
+		assert.Equal(t, float64(3), runCount(w))
+	})
+}
+
+func TestBackgroundJobs(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	repo := createTestRepository(t, database, user.ID)
+	createTestRun(t, database, user.ID, repo.ID)
+
+	admin := &db.User{GitHubID: 1, GitHubUsername: "octoadmin", Role: db.RoleAdmin}
+	require.NoError(t, database.Create(admin).Error)
+	adminToken := generateTestJWT(t, server, admin.ID, admin.GitHubUsername)
+	userToken := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	now := time.Now().UTC()
+	require.NoError(t, server.scheduler.Sync(now))
+
+	call := func(t *testing.T, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("admin only", func(t *testing.T) {
+		w := call(t, "GET", "/admin/jobs", userToken, nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("list jobs", func(t *testing.T) {
+		w := call(t, "GET", "/admin/jobs", adminToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Jobs []db.Job `json:"jobs"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		names := make([]string, 0, len(response.Jobs))
+		for _, job := range response.Jobs {
+			names = append(names, job.Name)
+			assert.True(t, job.Enabled)
+		}
+		assert.Equal(t, []string{"alert-evaluation", "data-retention", "emission-recalculation", "language-sync", "purge-deleted", "retention",
+			"rollup-backfill", "storage-emissions", "webhook-deliveries", "weekly-reports", "weekly-summaries"}, names)
+	})
+
+	t.Run("trigger records a run", func(t *testing.T) {
+		// Drift the rollups so the backfill has something to rebuild
+		require.NoError(t, database.Where("repository_id = ?", repo.ID).Delete(&db.RepositoryDailyRollup{}).Error)
+
+		w := call(t, "POST", "/admin/jobs/rollup-backfill/run", adminToken, nil)
+		require.Equal(t, http.StatusAccepted, w.Code)
+		var run db.JobRun
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &run))
+		assert.Equal(t, jobs.TriggerManual, run.Trigger)
+		assert.Equal(t, jobs.StatusRunning, run.Status)
+		server.scheduler.Wait()
+
+		w = call(t, "GET", "/admin/jobs/rollup-backfill", adminToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Job  db.Job      `json:"job"`
+			Runs []db.JobRun `json:"runs"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Runs, 1)
+		assert.Equal(t, run.ID, response.Runs[0].ID)
+		assert.Equal(t, jobs.StatusSucceeded, response.Runs[0].Status)
+		require.NotNil(t, response.Runs[0].Result)
+		assert.Equal(t, "rebuilt 1 repositories", *response.Runs[0].Result)
+		require.NotNil(t, response.Job.LastStatus)
+		assert.Equal(t, jobs.StatusSucceeded, *response.Job.LastStatus)
+		assert.Nil(t, response.Job.LockedUntil)
+
+		var rollups int64
+		require.NoError(t, database.Model(&db.RepositoryDailyRollup{}).Where("repository_id = ?", repo.ID).Count(&rollups).Error)
+		assert.Equal(t, int64(1), rollups)
+	})
+
+	t.Run("scheduled runs", func(t *testing.T) {
+		started, err := server.scheduler.RunDue(context.Background(), now)
+		require.NoError(t, err)
+		assert.Equal(t, 11, started)
+		server.scheduler.Wait()
+
+		// Nothing is due again until the next tick of each schedule
+		started, err = server.scheduler.RunDue(context.Background(), now)
+		require.NoError(t, err)
+		assert.Equal(t, 0, started)
+
+		job, err := server.scheduler.Get("rollup-backfill")
+		require.NoError(t, err)
+		assert.True(t, job.NextRunAt.After(now))
+		assert.Equal(t, 3, job.NextRunAt.UTC().Hour())
+	})
+
+	t.Run("update job", func(t *testing.T) {
+		w := call(t, "PATCH", "/admin/jobs/retention", adminToken, map[string]interface{}{"schedule": "not a schedule"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = call(t, "PATCH", "/admin/jobs/retention", adminToken, map[string]interface{}{"schedule": "@every 1h", "enabled": false})
+		require.Equal(t, http.StatusOK, w.Code)
+		var job db.Job
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &job))
+		assert.Equal(t, "@every 1h", job.Schedule)
+		assert.False(t, job.Enabled)
+
+		// Disabled jobs are skipped by the schedule but can still be run manually
+		_, err := server.scheduler.RunDue(context.Background(), now.Add(2*time.Hour))
+		require.NoError(t, err)
+		server.scheduler.Wait()
+		runs, err := server.scheduler.ListRuns("retention", 10)
+		require.NoError(t, err)
+		assert.Len(t, runs, 1)
+
+		w = call(t, "POST", "/admin/jobs/retention/run", adminToken, nil)
+		assert.Equal(t, http.StatusAccepted, w.Code)
+		server.scheduler.Wait()
+		runs, err = server.scheduler.ListRuns("retention", 10)
+		require.NoError(t, err)
+		require.Len(t, runs, 2)
+		assert.Equal(t, jobs.TriggerManual, runs[0].Trigger)
+		assert.Equal(t, jobs.StatusSucceeded, runs[0].Status)
+	})
+
+	t.Run("unknown job", func(t *testing.T) {
+		w := call(t, "POST", "/admin/jobs/unknown/run", adminToken, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestAdminAPI(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	userToken := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+	repo := createTestRepository(t, database, user.ID)
+	createTestRun(t, database, user.ID, repo.ID)
+	createTestRun(t, database, user.ID, repo.ID)
+
+	admin := &db.User{GitHubID: 1, GitHubUsername: "octoadmin", Role: db.RoleAdmin}
+	require.NoError(t, database.Create(admin).Error)
+	adminToken := generateTestJWT(t, server, admin.ID, admin.GitHubUsername)
+
+	call := func(t *testing.T, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("requires admin role", func(t *testing.T) {
+		// The former hard-coded admin usernames carry no privileges without the role
+		legacy := &db.User{GitHubID: 2, GitHubUsername: "admin"}
+		require.NoError(t, database.Create(legacy).Error)
+		assert.Equal(t, db.RoleUser, legacy.Role)
+
+		w := call(t, "GET", "/admin/users", generateTestJWT(t, server, legacy.ID, legacy.GitHubUsername), nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		w = call(t, "GET", "/admin/stats", userToken, nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		require.NoError(t, database.Delete(legacy).Error)
+	})
+
+	t.Run("search users", func(t *testing.T) {
+		w := call(t, "GET", "/admin/users?q=TESTU", adminToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Users      []db.User              `json:"users"`
+			Pagination map[string]interface{} `json:"pagination"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Users, 1)
+		assert.Equal(t, user.ID, response.Users[0].ID)
+		assert.Equal(t, float64(1), response.Pagination["total"])
+
+		w = call(t, "GET", "/admin/users?role=admin", adminToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Users, 1)
+		assert.Equal(t, admin.ID, response.Users[0].ID)
+
+		w = call(t, "GET", "/admin/users?role=owner", adminToken, nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("sort users", func(t *testing.T) {
+		w := call(t, "GET", "/admin/users?sort=run_count&order=desc", adminToken, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var response struct {
+			Users []service.UserDirectoryEntry `json:"users"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Users, 2)
+		assert.Equal(t, user.ID, response.Users[0].ID)
+		assert.Equal(t, int64(2), response.Users[0].RunCount)
+		assert.False(t, response.Users[0].Suspended)
+		assert.Equal(t, admin.ID, response.Users[1].ID)
+		assert.Equal(t, int64(0), response.Users[1].RunCount)
+
+		w = call(t, "GET", "/admin/users?sort=github_username&order=asc", adminToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Users, 2)
+		assert.Equal(t, "octoadmin", response.Users[0].GitHubUsername)
+
+		w = call(t, "GET", "/admin/users?sort=password", adminToken, nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "INVALID_SORT")
+		w = call(t, "GET", "/admin/users?order=up", adminToken, nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("suspend and reinstate", func(t *testing.T) {
+		w := call(t, "PATCH", "/admin/users/"+user.ID.String(), adminToken, map[string]interface{}{"suspended": true})
+		require.Equal(t, http.StatusOK, w.Code)
+		var updated db.User
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+		assert.NotNil(t, updated.SuspendedAt)
+
+		// Existing sessions stop working immediately
+		w = call(t, "GET", "/repos", userToken, nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "ACCOUNT_SUSPENDED")
+
+		w = call(t, "GET", "/admin/users?suspended=true", adminToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), user.ID.String())
+		assert.Contains(t, w.Body.String(), `"suspended":true`)
+
+		w = call(t, "PATCH", "/admin/users/"+user.ID.String(), adminToken, map[string]interface{}{"suspended": false})
+		require.Equal(t, http.StatusOK, w.Code)
+		w = call(t, "GET", "/repos", userToken, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("change role", func(t *testing.T) {
+		w := call(t, "PATCH", "/admin/users/"+user.ID.String(), adminToken, map[string]interface{}{"role": "owner"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = call(t, "PATCH", "/admin/users/"+admin.ID.String(), adminToken, map[string]interface{}{"role": "user"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "CANNOT_MODIFY_SELF")
+
+		w = call(t, "PATCH", "/admin/users/"+user.ID.String(), adminToken, map[string]interface{}{"role": "admin"})
+		require.Equal(t, http.StatusOK, w.Code)
+		w = call(t, "GET", "/admin/stats", userToken, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		w = call(t, "PATCH", "/admin/users/"+user.ID.String(), adminToken, map[string]interface{}{"role": "user"})
+		require.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("platform stats", func(t *testing.T) {
+		w := call(t, "GET", "/admin/stats", adminToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var stats service.PlatformStats
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+		assert.Equal(t, int64(2), stats.Users.Total)
+		assert.Equal(t, int64(1), stats.Users.Admins)
+		assert.Equal(t, int64(1), stats.Users.Active)
+		assert.Equal(t, int64(1), stats.Repositories.Total)
+		assert.Equal(t, int64(2), stats.Runs.Total)
+		assert.Equal(t, int64(2), stats.Runs.Last24Hours)
+		assert.InDelta(t, 0.6, stats.Runs.TotalCO2Kg, 1e-9)
+		assert.InDelta(t, 2.0/24, stats.Runs.IngestRatePerHour, 1e-9)
+	})
+
+	t.Run("config is redacted", func(t *testing.T) {
+		w := call(t, "GET", "/admin/config", adminToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Config map[string]interface{} `json:"config"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "[redacted]", response.Config["JWT_SECRET"])
+		assert.Equal(t, server.cfg.AppURL, response.Config["APP_URL"])
+		assert.NotContains(t, w.Body.String(), server.cfg.JWTSecret)
+	})
+
+	t.Run("transfer repository", func(t *testing.T) {
+		w := call(t, "POST", "/admin/repos/"+repo.ID.String()+"/transfer", adminToken, map[string]interface{}{"owner": "nobody"})
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = call(t, "POST", "/admin/repos/"+repo.ID.String()+"/transfer", adminToken,
+			map[string]interface{}{"owner": admin.GitHubUsername, "keep_previous_owner": true})
+		require.Equal(t, http.StatusOK, w.Code)
+		var transferred db.Repository
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &transferred))
+		assert.Equal(t, admin.ID, transferred.OwnerID)
+
+		collaborators, err := server.repoService.ListCollaborators(repo.ID)
+		require.NoError(t, err)
+		require.Len(t, collaborators, 1)
+		assert.Equal(t, user.ID, collaborators[0].UserID)
+	})
+
+	t.Run("delete user", func(t *testing.T) {
+		w := call(t, "DELETE", "/admin/users/"+admin.ID.String(), adminToken, nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = call(t, "DELETE", "/admin/users/"+user.ID.String(), adminToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		// Tokens of deleted users are rejected
+		w = call(t, "GET", "/repos", userToken, nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w = call(t, "DELETE", "/admin/users/"+user.ID.String(), adminToken, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestEmissionFactors(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	userToken := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+	admin := &db.User{GitHubID: 1, GitHubUsername: "octoadmin", Role: db.RoleAdmin}
+	require.NoError(t, database.Create(admin).Error)
+	adminToken := generateTestJWT(t, server, admin.ID, admin.GitHubUsername)
+
+	call := func(t *testing.T, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	resolve := func(t *testing.T, path string) service.ResolvedEmissionFactor {
+		w := call(t, "GET", path, userToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var factor service.ResolvedEmissionFactor
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &factor))
+		return factor
+	}
+	factor2024 := map[string]interface{}{
+		"region": "WestEurope", "grams_co2e_per_kwh": 328, "source": "Cloud Carbon Footprint",
+		"methodology": "Annual average of the Netherlands grid, 2024", "effective_from": "2024-01-01", "effective_to": "2025-01-01",
+	}
+
+	t.Run("admin only", func(t *testing.T) {
+		w := call(t, "POST", "/admin/emission-factors", userToken, factor2024)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("built-in factors without managed ones", func(t *testing.T) {
+		factor := resolve(t, "/emission-factors/westeurope?at=2024-06-01")
+		assert.True(t, factor.BuiltIn)
+		assert.Nil(t, factor.FactorID)
+		assert.Equal(t, 328.0, factor.GramsPerKWh)
+		assert.Equal(t, service.BuiltInFactorMethodology, factor.Methodology)
+
+		factor = resolve(t, "/emission-factors/mars-north-1")
+		assert.Equal(t, service.DefaultFactorMethodology, factor.Methodology)
+	})
+
+	w := call(t, "POST", "/admin/emission-factors", adminToken, factor2024)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created db.EmissionFactor
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "westeurope", created.Region)
+	require.NotNil(t, created.CreatedByID)
+	assert.Equal(t, admin.ID, *created.CreatedByID)
+
+	t.Run("validation", func(t *testing.T) {
+		for _, body := range []map[string]interface{}{
+			{"region": "westeurope", "grams_co2e_per_kwh": -1, "source": "Ember", "methodology": "Annual", "effective_from": "2025-01-01"},
+			{"region": "westeurope", "grams_co2e_per_kwh": 290, "source": "Ember", "methodology": " ", "effective_from": "2025-01-01"},
+			{"region": "westeurope", "grams_co2e_per_kwh": 290, "source": "Ember", "methodology": "Annual", "effective_from": "2025-01-01", "effective_to": "2025-01-01"},
+			{"region": "westeurope", "grams_co2e_per_kwh": 290, "source": "Ember", "source_url": "ember", "methodology": "Annual", "effective_from": "2025-01-01"},
+		} {
+			w := call(t, "POST", "/admin/emission-factors", adminToken, body)
+			assert.Equal(t, http.StatusBadRequest, w.Code, body)
+			assert.Contains(t, w.Body.String(), "INVALID_EMISSION_FACTOR")
+		}
+
+		w := call(t, "POST", "/admin/emission-factors", adminToken, map[string]interface{}{
+			"region": "westeurope", "grams_co2e_per_kwh": 290, "source": "Ember", "methodology": "Annual", "effective_from": "2024-12-01",
+		})
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), "EMISSION_FACTOR_OVERLAP")
+	})
+
+	w = call(t, "POST", "/admin/emission-factors", adminToken, map[string]interface{}{
+		"region": "westeurope", "grams_co2e_per_kwh": 290, "source": "Ember", "source_url": "https://ember-energy.org/data",
+		"methodology": "Annual average of the Netherlands grid, 2025", "effective_from": "2025-01-01",
+	})
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	t.Run("resolve", func(t *testing.T) {
+		factor := resolve(t, "/emission-factors/westeurope?at=2024-06-01")
+		assert.False(t, factor.BuiltIn)
+		require.NotNil(t, factor.FactorID)
+		assert.Equal(t, created.ID, *factor.FactorID)
+		assert.Equal(t, 328.0, factor.GramsPerKWh)
+
+		factor = resolve(t, "/emission-factors/westeurope?at=2025-01-01")
+		assert.Equal(t, 290.0, factor.GramsPerKWh)
+		assert.Equal(t, "Ember", factor.Source)
+
+		factor = resolve(t, "/emission-factors/westeurope?at=2023-12-31")
+		assert.True(t, factor.BuiltIn)
+
+		w := call(t, "GET", "/emission-factors/westeurope?at=yesterday", userToken, nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("update is audited", func(t *testing.T) {
+		body := map[string]interface{}{}
+		for key, value := range factor2024 {
+			body[key] = value
+		}
+		body["grams_co2e_per_kwh"] = 320
+		w := call(t, "PUT", "/admin/emission-factors/"+created.ID.String(), adminToken, body)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, 320.0, resolve(t, "/emission-factors/westeurope?at=2024-06-01").GramsPerKWh)
+
+		var event db.AuditEvent
+		require.NoError(t, database.Where("action = ?", "emission_factor.update").First(&event).Error)
+		assert.Equal(t, created.ID.String(), event.ResourceID)
+		assert.Contains(t, event.Changes, "grams_co2e_per_kwh")
+	})
+
+	repo := createTestRepository(t, database, user.ID)
+	run2024 := &db.Run{UserID: user.ID, RepositoryID: repo.ID, CO2Kg: 0.3, EnergyKWh: 0.5, DurationS: 120,
+		RunMetadata: db.JSONB{"region": "WestEurope"}, CreatedAt: time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)}
+	require.NoError(t, database.Create(run2024).Error)
+	run2025 := &db.Run{UserID: user.ID, RepositoryID: repo.ID, CO2Kg: 0.3, EnergyKWh: 0.5, DurationS: 120,
+		RunMetadata: db.JSONB{"region": "westeurope"}, CreatedAt: time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)}
+	require.NoError(t, database.Create(run2025).Error)
+	require.NoError(t, database.Create(&db.Run{UserID: user.ID, RepositoryID: repo.ID, CO2Kg: 0.3, EnergyKWh: 0.5, DurationS: 120}).Error)
+	currentCO2 := func(t *testing.T, run *db.Run) *db.Run {
+		var reloaded db.Run
+		require.NoError(t, database.First(&reloaded, "id = ?", run.ID).Error)
+		require.NotNil(t, reloaded.CurrentCO2Kg)
+		assert.Equal(t, 0.3, reloaded.CO2Kg)
+		return &reloaded
+	}
+
+	t.Run("recalculation", func(t *testing.T) {
+		report, err := server.factorService.RecalculateRuns(context.Background(), time.Now())
+		require.NoError(t, err)
+		assert.True(t, report.FullScan)
+		assert.Equal(t, int64(2), report.RunsScanned)
+		assert.Equal(t, int64(2), report.RunsChanged)
+		assert.InDelta(t, 0.6, report.PreviousCO2Kg, 1e-9)
+		assert.InDelta(t, 0.305, report.CurrentCO2Kg, 1e-9)
+
+		reloaded := currentCO2(t, run2024)
+		assert.Equal(t, 0.16, *reloaded.CurrentCO2Kg)
+		require.NotNil(t, reloaded.EmissionFactorID)
+		assert.Equal(t, created.ID, *reloaded.EmissionFactorID)
+		require.NotNil(t, reloaded.EmissionFactorVersion)
+		assert.Equal(t, 2, *reloaded.EmissionFactorVersion)
+		assert.Equal(t, 0.145, *currentCO2(t, run2025).CurrentCO2Kg)
+
+		// Without factor changes only runs not computed yet are recomputed
+		report, err = server.factorService.RecalculateRuns(context.Background(), time.Now())
+		require.NoError(t, err)
+		assert.False(t, report.FullScan)
+		assert.Equal(t, int64(0), report.RunsScanned)
+	})
+
+	t.Run("list and delete", func(t *testing.T) {
+		w := call(t, "GET", "/admin/emission-factors?region=westeurope", adminToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Factors []db.EmissionFactor `json:"factors"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Factors, 2)
+		assert.Equal(t, 290.0, response.Factors[0].GramsPerKWh)
+
+		w = call(t, "DELETE", "/admin/emission-factors/"+created.ID.String(), adminToken, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		w = call(t, "GET", "/admin/emission-factors/"+created.ID.String(), adminToken, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.True(t, resolve(t, "/emission-factors/westeurope?at=2024-06-01").BuiltIn)
+	})
+
+	t.Run("versions are kept", func(t *testing.T) {
+		w := call(t, "GET", "/admin/emission-factors/"+created.ID.String()+"/versions", adminToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Versions []db.EmissionFactorVersion `json:"versions"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Versions, 3)
+		assert.Equal(t, db.EmissionFactorDeleted, response.Versions[0].Change)
+		assert.Equal(t, 3, response.Versions[0].Version)
+		assert.Equal(t, 320.0, response.Versions[1].GramsPerKWh)
+		assert.Equal(t, db.EmissionFactorCreated, response.Versions[2].Change)
+		assert.Equal(t, 328.0, response.Versions[2].GramsPerKWh)
+
+		w = call(t, "GET", "/admin/emission-factors/"+uuid.New().String()+"/versions", adminToken, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("recalculation after a change", func(t *testing.T) {
+		require.NoError(t, server.scheduler.Sync(time.Now().UTC()))
+		w := call(t, "POST", "/admin/jobs/emission-recalculation/run", adminToken, nil)
+		require.Equal(t, http.StatusAccepted, w.Code)
+		server.scheduler.Wait()
+
+		w = call(t, "GET", "/admin/recalculation-reports", adminToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Reports []db.RecalculationReport `json:"reports"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Reports, 3)
+		latest := response.Reports[0]
+		assert.True(t, latest.FullScan)
+		assert.Equal(t, int64(2), latest.RunsScanned)
+		assert.Equal(t, int64(1), latest.RunsChanged)
+		assert.Contains(t, latest.Regions, "westeurope")
+
+		reloaded := currentCO2(t, run2024)
+		assert.Equal(t, 0.164, *reloaded.CurrentCO2Kg)
+		assert.Nil(t, reloaded.EmissionFactorID)
+	})
+}
+
+func TestOrganizationSettingsRequireAdmin(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	member := createTestUser(t, database)
+	token := generateTestJWT(t, server, member.ID, member.GitHubUsername)
+	org := &db.Organization{GitHubID: 777, GitHubLogin: "greenorg"}
+	require.NoError(t, database.Create(org).Error)
+	require.NoError(t, database.Create(&db.OrganizationMember{OrganizationID: org.ID, UserID: member.ID}).Error)
+
+	// Every change to an organization-wide setting is reserved to its admins
+	path := strings.NewReplacer(":org", "greenorg", ":provider", "slack", ":offset_id", uuid.New().String())
+	mutations := 0
+	for _, route := range server.router.Routes() {
+		if route.Method == http.MethodGet || !strings.Contains(route.Path, "/orgs/:org") || strings.Contains(route.Path, "/admin/") {
+			continue
+		}
+		mutations++
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(route.Method, path.Replace(route.Path), strings.NewReader("{}"))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+		server.router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusForbidden, w.Code, route.Method+" "+route.Path)
+		assert.Contains(t, w.Body.String(), "NOT_ORGANIZATION_ADMIN", route.Method+" "+route.Path)
+	}
+	assert.NotZero(t, mutations)
+}
+
+func TestDataRetention(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	org := &db.Organization{GitHubID: 777, GitHubLogin: "greenorg"}
+	require.NoError(t, database.Create(org).Error)
+	require.NoError(t, database.Create(&db.OrganizationMember{OrganizationID: org.ID, UserID: user.ID, Role: db.OrganizationRoleAdmin}).Error)
+	repo := createTestRepository(t, database, user.ID)
+	require.NoError(t, database.Model(repo).Update("organization_id", org.ID).Error)
+
+	member := &db.User{GitHubID: 54321, GitHubUsername: "member"}
+	require.NoError(t, database.Create(member).Error)
+	require.NoError(t, database.Create(&db.OrganizationMember{OrganizationID: org.ID, UserID: member.ID}).Error)
+	memberToken := generateTestJWT(t, server, member.ID, member.GitHubUsername)
+
+	now := time.Now().UTC()
+	for _, age := range []int{400, 200, 200, 10} {
+		run := &db.Run{UserID: user.ID, RepositoryID: repo.ID, CO2Kg: 0.3, EnergyKWh: 0.5, DurationS: 120, CreatedAt: now.AddDate(0, 0, -age)}
+		require.NoError(t, database.Create(run).Error)
+	}
+
+	doRequest := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	countRuns := func() int64 {
+		var count int64
+		require.NoError(t, database.Model(&db.Run{}).Where("repository_id = ?", repo.ID).Count(&count).Error)
+		return count
+	}
+	countRollups := func() int64 {
+		var count int64
+		require.NoError(t, database.Model(&db.RepositoryDailyRollup{}).Where("repository_id = ?", repo.ID).Count(&count).Error)
+		return count
+	}
+
+	t.Run("members cannot change the policy", func(t *testing.T) {
+		asMember := func(method string, body string) *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(method, "/orgs/greenorg/retention", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: memberToken})
+			server.router.ServeHTTP(w, req)
+			return w
+		}
+
+		assert.Equal(t, http.StatusOK, asMember("GET", "").Code)
+		w := asMember("PUT", `{"run_retention_days": 1}`)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "NOT_ORGANIZATION_ADMIN")
+		assert.Equal(t, http.StatusForbidden, asMember("DELETE", "").Code)
+
+		var policies int64
+		require.NoError(t, database.Model(&db.RetentionPolicy{}).Count(&policies).Error)
+		assert.Zero(t, policies)
+	})
+
+	t.Run("policy validation", func(t *testing.T) {
+		w := doRequest("GET", "/orgs/greenorg/retention", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var policy db.RetentionPolicy
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &policy))
+		assert.Nil(t, policy.RunRetentionDays)
+
+		w = doRequest("PUT", "/orgs/greenorg/retention", map[string]interface{}{"rollup_retention_days": 30})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w = doRequest("PUT", "/orgs/greenorg/retention", map[string]interface{}{"run_retention_days": 100, "rollup_retention_days": 30})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w = doRequest("PUT", "/orgs/greenorg/retention", map[string]interface{}{"run_retention_days": 0})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("dry run reports without deleting", func(t *testing.T) {
+		w := doRequest("PUT", "/orgs/greenorg/retention", map[string]interface{}{"run_retention_days": 100, "dry_run": true})
+		require.Equal(t, http.StatusOK, w.Code)
+
+		reports, err := server.retentionService.ApplyAll(context.Background(), now)
+		require.NoError(t, err)
+		require.Len(t, reports, 1)
+		assert.True(t, reports[0].DryRun)
+		assert.Equal(t, int64(3), reports[0].RunsDeleted)
+		assert.Equal(t, int64(4), countRuns())
+	})
+
+	t.Run("purges runs and keeps their rollups", func(t *testing.T) {
+		w := doRequest("PUT", "/orgs/greenorg/retention", map[string]interface{}{"run_retention_days": 100, "rollup_retention_days": 365})
+		require.Equal(t, http.StatusOK, w.Code)
+
+		reports, err := server.retentionService.ApplyAll(context.Background(), now)
+		require.NoError(t, err)
+		require.Len(t, reports, 1)
+		assert.False(t, reports[0].DryRun)
+		assert.Equal(t, 1, reports[0].Repositories)
+		assert.Equal(t, int64(3), reports[0].RunsDeleted)
+		assert.Equal(t, int64(1), reports[0].RollupsDeleted)
+		assert.Equal(t, int64(1), countRuns())
+		assert.Equal(t, int64(2), countRollups())
+
+		// Statistics still include the purged runs that are within rollup retention
+		stats, err := server.repoService.GetRepositoryStats(repo.ID)
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), stats.Stats.RunCount)
+
+		// Purged days are not rebuilt from the remaining runs
+		rebuilt, err := server.repoService.BackfillRollups(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 0, rebuilt)
+		require.NoError(t, database.Transaction(func(tx *gorm.DB) error {
+			return db.RebuildRollups(tx, repo.ID)
+		}))
+		assert.Equal(t, int64(2), countRollups())
+	})
+
+	t.Run("reports", func(t *testing.T) {
+		w := doRequest("GET", "/orgs/greenorg/retention/reports", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Reports []db.RetentionReport `json:"reports"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Reports, 2)
+		assert.False(t, response.Reports[0].DryRun)
+		assert.Equal(t, int64(3), response.Reports[0].RunsDeleted)
+		assert.True(t, response.Reports[1].DryRun)
+	})
+
+	t.Run("delete policy", func(t *testing.T) {
+		w := doRequest("DELETE", "/orgs/greenorg/retention", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		w = doRequest("DELETE", "/orgs/greenorg/retention", nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		reports, err := server.retentionService.ApplyAll(context.Background(), now)
+		require.NoError(t, err)
+		assert.Empty(t, reports)
+	})
+}
+
+func TestSoftDeletes(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+	repo := createTestRepository(t, database, user.ID)
+	first := createTestRun(t, database, user.ID, repo.ID)
+	createTestRun(t, database, user.ID, repo.ID)
+
+	admin := &db.User{GitHubID: 1, GitHubUsername: "octoadmin", Role: db.RoleAdmin}
+	require.NoError(t, database.Create(admin).Error)
+	adminToken := generateTestJWT(t, server, admin.ID, admin.GitHubUsername)
+
+	call := func(t *testing.T, method, path, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, nil)
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	summaryRunCount := func(t *testing.T, path string) float64 {
+		w := call(t, "GET", path, token)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response["summary"].(map[string]interface{})["run_count"].(float64)
+	}
+	runCount := func(t *testing.T) float64 {
+		return summaryRunCount(t, "/repos/"+repo.ID.String()+"/stats")
+	}
+	userRunCount := func(t *testing.T) float64 {
+		return summaryRunCount(t, "/me/stats")
+	}
+
+	t.Run("delete and restore run", func(t *testing.T) {
+		w := call(t, "DELETE", "/runs/"+first.ID.String(), adminToken)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = call(t, "DELETE", "/runs/"+first.ID.String(), token)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "restorable_until")
+		assert.Equal(t, float64(1), runCount(t))
+		assert.Equal(t, float64(1), userRunCount(t))
+
+		// The row is kept for restoring
+		var count int64
+		require.NoError(t, database.Unscoped().Model(&db.Run{}).Where("id = ?", first.ID).Count(&count).Error)
+		assert.Equal(t, int64(1), count)
+
+		w = call(t, "POST", "/runs/"+first.ID.String()+"/restore", token)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, float64(2), runCount(t))
+		assert.Equal(t, float64(2), userRunCount(t))
+
+		w = call(t, "POST", "/runs/"+first.ID.String()+"/restore", token)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("delete and restore repository", func(t *testing.T) {
+		// A run deleted on its own stays deleted when the repository is restored
+		require.NoError(t, server.runService.DeleteRun(first.ID, user.ID))
+
+		w := call(t, "DELETE", "/repos/"+repo.ID.String(), token)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = call(t, "GET", "/repos/"+repo.ID.String()+"/stats", token)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		w = call(t, "GET", "/repos", token)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), repo.ID.String())
+		assert.Equal(t, float64(0), userRunCount(t))
+
+		w = call(t, "POST", "/runs/"+first.ID.String()+"/restore", token)
+		assert.Equal(t, http.StatusConflict, w.Code)
+
+		w = call(t, "POST", "/repos/"+repo.ID.String()+"/restore", token)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, float64(1), runCount(t))
+
+		w = call(t, "POST", "/runs/"+first.ID.String()+"/restore", token)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, float64(2), runCount(t))
+	})
+
+	t.Run("delete and restore user", func(t *testing.T) {
+		w := call(t, "DELETE", "/admin/users/"+user.ID.String(), adminToken)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = call(t, "GET", "/repos", token)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		_, err := server.userService.CreateOrUpdateUserFromGitHub(&auth.GitHubUser{ID: user.GitHubID, Login: user.GitHubUsername})
+		assert.EqualError(t, err, "account deleted")
+
+		w = call(t, "POST", "/admin/users/"+user.ID.String()+"/restore", adminToken)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, float64(2), runCount(t))
+	})
+
+	t.Run("restore window and purge", func(t *testing.T) {
+		require.NoError(t, server.runService.DeleteRun(first.ID, user.ID))
+		require.NoError(t, database.Unscoped().Model(&db.Run{}).Where("id = ?", first.ID).
+			Update("deleted_at", time.Now().Add(-31*24*time.Hour)).Error)
+
+		w := call(t, "POST", "/runs/"+first.ID.String()+"/restore", token)
+		assert.Equal(t, http.StatusGone, w.Code)
+
+		purged, err := server.retentionService.PurgeDeleted(context.Background(), time.Now().Add(-server.cfg.RestoreWindow))
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), purged.Runs)
+		assert.Equal(t, int64(0), purged.Repositories)
+		assert.Equal(t, int64(0), purged.Users)
+
+		var count int64
+		require.NoError(t, database.Unscoped().Model(&db.Run{}).Where("repository_id = ?", repo.ID).Count(&count).Error)
+		assert.Equal(t, int64(1), count)
+		assert.Equal(t, float64(1), runCount(t))
+	})
+}
+
+func TestAuditLog(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+	repo := createTestRepository(t, database, user.ID)
+	run := createTestRun(t, database, user.ID, repo.ID)
+
+	admin := &db.User{GitHubID: 1, GitHubUsername: "octoadmin", Role: db.RoleAdmin}
+	require.NoError(t, database.Create(admin).Error)
+	adminToken := generateTestJWT(t, server, admin.ID, admin.GitHubUsername)
+
+	call := func(t *testing.T, method, path, token, body, requestID string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if requestID != "" {
+			req.Header.Set("X-Request-ID", requestID)
+		}
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	listEvents := func(t *testing.T, query string) []db.AuditEvent {
+		w := call(t, "GET", "/admin/audit-events?"+query, adminToken, "", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Events []db.AuditEvent `json:"events"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Events
+	}
+
+	t.Run("records settings changes with request ID", func(t *testing.T) {
+		w := call(t, "PATCH", "/repos/"+repo.ID.String()+"/settings", token, `{"public_stats":true}`, "req-settings-1")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "req-settings-1", w.Header().Get("X-Request-ID"))
+
+		events := listEvents(t, "action=repository.update")
+		require.Len(t, events, 1)
+		event := events[0]
+		assert.Equal(t, "repository", event.ResourceType)
+		assert.Equal(t, repo.ID.String(), event.ResourceID)
+		assert.Equal(t, "testuser", event.ActorUsername)
+		require.NotNil(t, event.ActorID)
+		assert.Equal(t, user.ID, *event.ActorID)
+		assert.Equal(t, "req-settings-1", event.RequestID)
+		assert.Equal(t, map[string]interface{}{"from": false, "to": true}, event.Changes["public_stats"])
+		assert.NotContains(t, event.Changes, "benchmark_opt_in")
+	})
+
+	t.Run("generates a request ID when none is sent", func(t *testing.T) {
+		w := call(t, "PUT", "/repos/"+repo.ID.String()+"/budgets/month", token, `{"co2_kg_limit":5}`, "")
+		require.Equal(t, http.StatusOK, w.Code)
+		requestID := w.Header().Get("X-Request-ID")
+		assert.NotEmpty(t, requestID)
+
+		w = call(t, "PUT", "/repos/"+repo.ID.String()+"/budgets/month", token, `{"co2_kg_limit":8}`, "")
+		require.Equal(t, http.StatusOK, w.Code)
+		w = call(t, "DELETE", "/repos/"+repo.ID.String()+"/budgets/month", token, "", "")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		events := listEvents(t, "action=budget.set")
+		require.Len(t, events, 2)
+		assert.Equal(t, map[string]interface{}{"from": float64(5), "to": float64(8)}, events[0].Changes["month.co2_kg_limit"])
+		assert.Equal(t, map[string]interface{}{"to": float64(5)}, events[1].Changes["month.co2_kg_limit"])
+		assert.Equal(t, requestID, events[1].RequestID)
+
+		events = listEvents(t, "action=budget.delete")
+		require.Len(t, events, 1)
+		assert.Equal(t, map[string]interface{}{"from": float64(8)}, events[0].Changes["month.co2_kg_limit"])
+	})
+
+	t.Run("records run deletion", func(t *testing.T) {
+		w := call(t, "DELETE", "/runs/"+run.ID.String(), token, "", "")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		events := listEvents(t, "resource_type=run&resource_id="+run.ID.String())
+		require.Len(t, events, 1)
+		assert.Equal(t, "run.delete", events[0].Action)
+		assert.Contains(t, events[0].Changes, "co2_kg")
+	})
+
+	t.Run("records logout", func(t *testing.T) {
+		w := call(t, "POST", "/auth/logout", token, "", "")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		events := listEvents(t, "action=token.logout")
+		require.Len(t, events, 1)
+		assert.Equal(t, "token", events[0].ResourceType)
+		assert.NotEmpty(t, events[0].ResourceID)
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		assert.Len(t, listEvents(t, "actor=TESTUSER"), 6)
+		assert.Empty(t, listEvents(t, "actor=octoadmin"))
+		assert.Empty(t, listEvents(t, "from="+time.Now().Add(time.Hour).UTC().Format(time.RFC3339)))
+
+		w := call(t, "GET", "/admin/audit-events?from=yesterday", adminToken, "", "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		w = call(t, "GET", "/admin/audit-events?organization=unknown", adminToken, "", "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("admin only", func(t *testing.T) {
+		w := call(t, "GET", "/admin/audit-events", token, "", "")
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
+
+func TestGlobalRateLimitHeaders(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	cfg := *server.cfg
+	cfg.RateLimitRPS = 1
+	cfg.RateLimitBurst = 2
+	limited, err := NewServer(&cfg, server.db)
+	require.NoError(t, err)
+
+	health := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/health", nil)
+		limited.router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := health()
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("X-RateLimit-Remaining"))
+	reset, err := strconv.ParseInt(w.Header().Get("X-RateLimit-Reset"), 10, 64)
+	require.NoError(t, err)
+	assert.InDelta(t, time.Now().Add(time.Second).Unix(), reset, 1)
+	assert.Empty(t, w.Header().Get("Retry-After"))
+
+	w = health()
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+
+	w = health()
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "RATE_LIMIT_EXCEEDED")
+}
+
+func TestUserRateLimits(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	redisServer := miniredis.RunT(t)
+	cfg := *server.cfg
+	cfg.RedisURL = "redis://" + redisServer.Addr()
+	cfg.RateLimitPlans = map[string]config.RatePlan{
+		"free": {UserLimit: 3, TokenLimit: 2},
+		"pro":  {UserLimit: 5, TokenLimit: 5},
+	}
+	cfg.RateLimitDefaultPlan = "free"
+	cfg.RateLimitWindow = time.Minute
+	limited, err := NewServer(&cfg, server.db)
+	require.NoError(t, err)
+
+	database := server.db
+	user := createTestUser(t, database)
+	firstToken := generateTestJWT(t, limited, user.ID, user.GitHubUsername)
+	secondToken := generateTestJWT(t, limited, user.ID, user.GitHubUsername)
+
+	other := &db.User{GitHubID: 2, GitHubUsername: "otheruser"}
+	require.NoError(t, database.Create(other).Error)
+	otherToken := generateTestJWT(t, limited, other.ID, other.GitHubUsername)
+
+	admin := &db.User{GitHubID: 1, GitHubUsername: "octoadmin", Role: db.RoleAdmin, Plan: stringPtr("pro")}
+	require.NoError(t, database.Create(admin).Error)
+	adminToken := generateTestJWT(t, limited, admin.ID, admin.GitHubUsername)
+
+	call := func(t *testing.T, method, path, token, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		limited.router.ServeHTTP(w, req)
+		return w
+	}
+	var response map[string]interface{}
+
+	t.Run("limits each token", func(t *testing.T) {
+		w := call(t, "GET", "/me/stats", firstToken, "")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+		assert.Equal(t, "1", w.Header().Get("X-RateLimit-Remaining"))
+		assert.NotEmpty(t, w.Header().Get("X-RateLimit-Reset"))
+
+		w = call(t, "GET", "/me/stats", firstToken, "")
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = call(t, "GET", "/me/stats", firstToken, "")
+		require.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "TOKEN_RATE_LIMIT_EXCEEDED", response["code"])
+	})
+
+	t.Run("limits each user across tokens", func(t *testing.T) {
+		w := call(t, "GET", "/me/stats", secondToken, "")
+		require.Equal(t, http.StatusTooManyRequests, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "USER_RATE_LIMIT_EXCEEDED", response["code"])
+
+		// Other users keep their own budget
+		w = call(t, "GET", "/me/stats", otherToken, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("plans set by admins raise the limits", func(t *testing.T) {
+		w := call(t, "PATCH", "/admin/users/"+user.ID.String(), adminToken, `{"plan":"platinum"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = call(t, "PATCH", "/admin/users/"+user.ID.String(), adminToken, `{"plan":"pro"}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"plan":"pro"`)
+
+		w = call(t, "GET", "/me/stats", secondToken, "")
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "5", w.Header().Get("X-RateLimit-Limit"))
+		assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+
+		// An empty plan reverts to the default plan
+		w = call(t, "PATCH", "/admin/users/"+user.ID.String(), adminToken, `{"plan":""}`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), `"plan"`)
+	})
+
+	t.Run("counters reset with the window", func(t *testing.T) {
+		redisServer.FastForward(time.Minute)
+
+		w := call(t, "GET", "/me/stats", firstToken, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("requests are let through when Redis fails", func(t *testing.T) {
+		redisServer.Close()
+
+		// Only the global limit applies
+		w := call(t, "GET", "/me/stats", firstToken, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "200", w.Header().Get("X-RateLimit-Limit"))
+	})
+}
+
+func TestTracing(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(previous)
+
+	database := server.db
+	require.NoError(t, database.Use(tracing.GORMPlugin()))
+	traced, err := NewServer(server.cfg, database)
+	require.NoError(t, err)
+
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, traced, user.ID, user.GitHubUsername)
+
+	jsonData, _ := json.Marshal(service.RunCreateRequest{
+		EnergyKWh: 0.5,
+		CO2Kg:     0.3,
+		DurationS: 120.0,
+		Repository: service.RepositoryCreateRequest{
+			Name:     "testrepo",
+			FullName: "testuser/testrepo",
+			HTMLURL:  "https://github.com/testuser/testrepo",
+		},
+	})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/runs", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+	traced.router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	spans := recorder.Ended()
+	var root sdktrace.ReadOnlySpan
+	for _, span := range spans {
+		if span.Name() == "/runs" {
+			root = span
+		}
+	}
+	require.NotNil(t, root, "the request has a span")
+	assert.Equal(t, trace.SpanKindServer, root.SpanKind())
+
+	// The queries of the ingest path belong to the trace of the request
+	names := map[string]bool{}
+	for _, span := range spans {
+		if span.SpanContext().TraceID() == root.SpanContext().TraceID() {
+			names[span.Name()] = true
+		}
+	}
+	assert.True(t, names["db.create"], "the run insert is traced")
+	assert.True(t, names["db.query"], "the run lookup is traced")
+	assert.True(t, names["publish run events"])
+
+	t.Run("queries outside a request are not traced", func(t *testing.T) {
+		before := len(recorder.Ended())
+		var count int64
+		require.NoError(t, database.Model(&db.Run{}).Count(&count).Error)
+		assert.Len(t, recorder.Ended(), before)
+	})
+}
+
+func TestProbes(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	probe := func(target *Server, path string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		target.router.ServeHTTP(w, req)
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w, response
+	}
+
+	t.Run("liveness", func(t *testing.T) {
+		w, response := probe(server, "/healthz")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "alive", response["status"])
+		assert.Empty(t, w.Header().Get("X-RateLimit-Limit"), "probes bypass the middleware")
+	})
+
+	t.Run("not ready before migrations", func(t *testing.T) {
+		w, response := probe(server, "/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equal(t, "not_ready", response["status"])
+		checks := response["checks"].(map[string]interface{})
+		assert.Equal(t, "ok", checks["database"])
+		assert.Equal(t, "unavailable", checks["migrations"])
+		assert.Equal(t, "disabled", checks["cache"])
+	})
+
+	require.NoError(t, server.db.Exec("CREATE TABLE schema_migrations (version bigint NOT NULL, dirty boolean NOT NULL)").Error)
+	require.NoError(t, server.db.Exec("INSERT INTO schema_migrations (version, dirty) VALUES (17, false)").Error)
+	server.migrationVersion = 18
+
+	t.Run("not ready while migrations are pending", func(t *testing.T) {
+		w, response := probe(server, "/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		checks := response["checks"].(map[string]interface{})
+		assert.Equal(t, "unavailable", checks["migrations"])
+	})
+
+	t.Run("not ready after a failed migration", func(t *testing.T) {
+		require.NoError(t, server.db.Exec("UPDATE schema_migrations SET version = 18, dirty = true").Error)
+		w, _ := probe(server, "/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	})
+
+	require.NoError(t, server.db.Exec("UPDATE schema_migrations SET dirty = false").Error)
+
+	t.Run("ready", func(t *testing.T) {
+		w, response := probe(server, "/readyz")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "ready", response["status"])
+	})
+
+	t.Run("not ready when the cache is unreachable", func(t *testing.T) {
+		redisServer := miniredis.RunT(t)
+		cfg := *server.cfg
+		cfg.RedisURL = "redis://" + redisServer.Addr()
+		cfg.RateLimitPlans = map[string]config.RatePlan{"free": {UserLimit: 10, TokenLimit: 10}}
+		cfg.RateLimitDefaultPlan = "free"
+		cfg.RateLimitWindow = time.Minute
+		cached, err := NewServer(&cfg, server.db)
+		require.NoError(t, err)
+		cached.migrationVersion = 18
+
+		w, _ := probe(cached, "/readyz")
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		redisServer.Close()
+		w, response := probe(cached, "/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+		checks := response["checks"].(map[string]interface{})
+		assert.Equal(t, "unavailable", checks["cache"], "the Redis error is only logged")
+		assert.Equal(t, "ok", checks["database"])
+	})
+}
+
+func TestVerboseHealth(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer github.Close()
+
+	cfg := *server.cfg
+	cfg.GitHubAPIURL = github.URL
+	verbose, err := NewServer(&cfg, server.db)
+	require.NoError(t, err)
+	verbose.migrationVersion = 18
+
+	database := server.db
+	require.NoError(t, database.Exec("CREATE TABLE schema_migrations (version bigint NOT NULL, dirty boolean NOT NULL)").Error)
+	require.NoError(t, database.Exec("INSERT INTO schema_migrations (version, dirty) VALUES (18, false)").Error)
+
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, verbose, user.ID, user.GitHubUsername)
+
+	health := func(path, token string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		if token != "" {
+			req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+		}
+		verbose.router.ServeHTTP(w, req)
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w, response
+	}
+
+	t.Run("plain health stays public", func(t *testing.T) {
+		w, response := health("/health", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "healthy", response["status"])
+		assert.Nil(t, response["checks"])
+	})
+
+	t.Run("verbose requires authentication", func(t *testing.T) {
+		w, response := health("/health?verbose=true", "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, "MISSING_TOKEN", response["code"])
+	})
+
+	t.Run("verbose reports dependencies", func(t *testing.T) {
+		hook := &db.Webhook{CreatedByID: user.ID, URL: "https://example.com/hook", Secret: "secret", Events: db.StringList{webhook.EventRunCreated}}
+		require.NoError(t, database.Create(hook).Error)
+		require.NoError(t, database.Create(&db.WebhookDelivery{WebhookID: hook.ID, Event: webhook.EventRunCreated, Payload: "{}", Status: webhook.StatusPending, NextAttemptAt: time.Now()}).Error)
+		require.NoError(t, database.Create(&db.WebhookDelivery{WebhookID: hook.ID, Event: webhook.EventRunCreated, Payload: "{}", Status: webhook.StatusDelivered, NextAttemptAt: time.Now()}).Error)
+
+		w, response := health("/health?verbose=true", token)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "healthy", response["status"])
+
+		checks := response["checks"].(map[string]interface{})
+		dbCheck := checks["database"].(map[string]interface{})
+		assert.Equal(t, "ok", dbCheck["status"])
+		assert.Contains(t, dbCheck, "latency_ms")
+		migrations := checks["migrations"].(map[string]interface{})
+		assert.Equal(t, "ok", migrations["status"])
+		assert.Equal(t, float64(18), migrations["version"])
+		assert.Equal(t, float64(18), migrations["expected"])
+		githubCheck := checks["github"].(map[string]interface{})
+		assert.Equal(t, "ok", githubCheck["status"])
+		assert.Equal(t, float64(200), githubCheck["http_status"])
+
+		queues := response["queues"].(map[string]interface{})
+		assert.Equal(t, float64(1), queues["webhook_deliveries"].(map[string]interface{})["pending"])
+
+		build := response["build"].(map[string]interface{})
+		assert.NotEmpty(t, build["version"])
+		assert.NotEmpty(t, build["go_version"])
+	})
+
+	t.Run("unreachable GitHub degrades", func(t *testing.T) {
+		github.Close()
+		w, response := health("/health?verbose=true", token)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "degraded", response["status"])
+		githubCheck := response["checks"].(map[string]interface{})["github"].(map[string]interface{})
+		assert.Equal(t, "error", githubCheck["status"])
+		assert.NotEmpty(t, githubCheck["error"])
+	})
+
+	t.Run("suspended accounts are rejected", func(t *testing.T) {
+		require.NoError(t, database.Model(user).Update("suspended_at", time.Now()).Error)
+		w, _ := health("/health?verbose=true", token)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
+
+// writeTestCertificate writes a self-signed certificate for 127.0.0.1 to dir and returns the
+// paths of the certificate and key files
+func writeTestCertificate(t *testing.T, dir string) (string, string, *x509.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile, certificate
+}
+
+func TestTLS(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	t.Run("plain HTTP without TLS configuration", func(t *testing.T) {
+		httpServer, manager, err := server.httpServer(":0")
+		require.NoError(t, err)
+		assert.Nil(t, httpServer.TLSConfig)
+		assert.Nil(t, manager)
+	})
+
+	t.Run("certificate files", func(t *testing.T) {
+		certFile, keyFile, certificate := writeTestCertificate(t, t.TempDir())
+		cfg := *server.cfg
+		cfg.TLSCertFile = certFile
+		cfg.TLSKeyFile = keyFile
+		secured, err := NewServer(&cfg, server.db)
+		require.NoError(t, err)
+
+		httpServer, manager, err := secured.httpServer(":0")
+		require.NoError(t, err)
+		assert.Nil(t, manager)
+		require.NotNil(t, httpServer.TLSConfig)
+
+		ts := httptest.NewUnstartedServer(httpServer.Handler)
+		ts.TLS = httpServer.TLSConfig
+		ts.StartTLS()
+		defer ts.Close()
+
+		roots := x509.NewCertPool()
+		roots.AddCert(certificate)
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+		resp, err := client.Get(ts.URL + "/health")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.NotEmpty(t, resp.Header.Get("Strict-Transport-Security"))
+	})
+
+	t.Run("unreadable certificate", func(t *testing.T) {
+		cfg := *server.cfg
+		cfg.TLSCertFile = filepath.Join(t.TempDir(), "missing.pem")
+		cfg.TLSKeyFile = cfg.TLSCertFile
+		secured, err := NewServer(&cfg, server.db)
+		require.NoError(t, err)
+
+		_, _, err = secured.httpServer(":0")
+		assert.Error(t, err)
+	})
+
+	t.Run("ACME", func(t *testing.T) {
+		cfg := *server.cfg
+		cfg.ACMEHosts = []string{"ecoci.example.com"}
+		cfg.ACMECacheDir = t.TempDir()
+		secured, err := NewServer(&cfg, server.db)
+		require.NoError(t, err)
+
+		httpServer, manager, err := secured.httpServer(":0")
+		require.NoError(t, err)
+		require.NotNil(t, manager)
+		require.NotNil(t, httpServer.TLSConfig)
+		assert.Contains(t, httpServer.TLSConfig.NextProtos, "acme-tls/1")
+		assert.NoError(t, manager.HostPolicy(context.Background(), "ecoci.example.com"))
+		assert.Error(t, manager.HostPolicy(context.Background(), "other.example.com"))
+	})
+}
+
+func TestFeatureFlags(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	repo := createTestRepository(t, database, user.ID)
+	other := &db.User{GitHubID: 2, GitHubUsername: "otheruser"}
+	require.NoError(t, database.Create(other).Error)
+	otherRepo := &db.Repository{
+		OwnerID:      other.ID,
+		GitHubRepoID: 67891,
+		Name:         "otherrepo",
+		FullName:     "otheruser/otherrepo",
+		HTMLURL:      "https://github.com/otheruser/otherrepo",
+	}
+	require.NoError(t, database.Create(otherRepo).Error)
+
+	admin := &db.User{GitHubID: 1, GitHubUsername: "octoadmin", Role: db.RoleAdmin}
+	require.NoError(t, database.Create(admin).Error)
+	adminToken := generateTestJWT(t, server, admin.ID, admin.GitHubUsername)
+	userToken := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+	otherToken := generateTestJWT(t, server, other.ID, other.GitHubUsername)
+
+	call := func(t *testing.T, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	decodeFlag := func(t *testing.T, w *httptest.ResponseRecorder) flags.Flag {
+		var flag flags.Flag
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &flag))
+		return flag
+	}
+	webhooksStatus := func(t *testing.T, token string, repoID uuid.UUID) int {
+		return call(t, "GET", "/repos/"+repoID.String()+"/webhooks", token, nil).Code
+	}
+
+	t.Run("admin only", func(t *testing.T) {
+		w := call(t, "GET", "/admin/flags", userToken, nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("flags use their defaults", func(t *testing.T) {
+		w := call(t, "GET", "/admin/flags", adminToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Flags []flags.Flag `json:"flags"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Flags, 1)
+		assert.Equal(t, flags.Webhooks, response.Flags[0].Name)
+		assert.True(t, response.Flags[0].Default)
+		assert.False(t, response.Flags[0].Overridden)
+		assert.Equal(t, 100, response.Flags[0].RolloutPercentage)
+
+		assert.Equal(t, http.StatusOK, webhooksStatus(t, userToken, repo.ID))
+	})
+
+	t.Run("disabled flag hides the feature", func(t *testing.T) {
+		w := call(t, "PATCH", "/admin/flags/webhooks", adminToken, map[string]interface{}{"enabled": false})
+		require.Equal(t, http.StatusOK, w.Code)
+		flag := decodeFlag(t, w)
+		assert.True(t, flag.Overridden)
+		assert.False(t, flag.Enabled)
+
+		w = call(t, "GET", "/repos/"+repo.ID.String()+"/webhooks", userToken, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "FEATURE_DISABLED")
+
+		w = call(t, "GET", "/me/flags", userToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Flags map[string]bool `json:"flags"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, map[string]bool{flags.Webhooks: false}, response.Flags)
+	})
+
+	t.Run("user targeting", func(t *testing.T) {
+		w := call(t, "PATCH", "/admin/flags/webhooks", adminToken, map[string]interface{}{
+			"enabled":            true,
+			"rollout_percentage": 0,
+			"user_ids":           []string{user.ID.String()},
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, []string{user.ID.String()}, decodeFlag(t, w).UserIDs)
+
+		assert.Equal(t, http.StatusOK, webhooksStatus(t, userToken, repo.ID))
+		assert.Equal(t, http.StatusNotFound, webhooksStatus(t, otherToken, otherRepo.ID))
+	})
+
+	t.Run("organization targeting", func(t *testing.T) {
+		org := &db.Organization{GitHubID: 779, GitHubLogin: "flagorg"}
+		require.NoError(t, database.Create(org).Error)
+		require.NoError(t, database.Create(&db.OrganizationMember{OrganizationID: org.ID, UserID: other.ID}).Error)
+
+		w := call(t, "PATCH", "/admin/flags/webhooks", adminToken, map[string]interface{}{
+			"organization_ids": []string{org.ID.String()},
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+		flag := decodeFlag(t, w)
+		// Unchanged fields are kept
+		assert.Equal(t, []string{user.ID.String()}, flag.UserIDs)
+		assert.Equal(t, []string{org.ID.String()}, flag.OrganizationIDs)
+
+		assert.Equal(t, http.StatusOK, webhooksStatus(t, otherToken, otherRepo.ID))
+	})
+
+	t.Run("percentage rollout", func(t *testing.T) {
+		w := call(t, "PATCH", "/admin/flags/webhooks", adminToken, map[string]interface{}{
+			"rollout_percentage": 100,
+			"user_ids":           []string{},
+			"organization_ids":   []string{},
+		})
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, http.StatusOK, webhooksStatus(t, otherToken, otherRepo.ID))
+	})
+
+	t.Run("invalid updates", func(t *testing.T) {
+		w := call(t, "PATCH", "/admin/flags/webhooks", adminToken, map[string]interface{}{"rollout_percentage": 150})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = call(t, "PATCH", "/admin/flags/webhooks", adminToken, map[string]interface{}{"user_ids": []string{"octocat"}})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		w = call(t, "PATCH", "/admin/flags/estimation", adminToken, map[string]interface{}{"enabled": true})
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("reset to default", func(t *testing.T) {
+		w := call(t, "PATCH", "/admin/flags/webhooks", adminToken, map[string]interface{}{"enabled": false})
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = call(t, "DELETE", "/admin/flags/webhooks", adminToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		flag := decodeFlag(t, w)
+		assert.False(t, flag.Overridden)
+		assert.True(t, flag.Enabled)
+
+		assert.Equal(t, http.StatusOK, webhooksStatus(t, userToken, repo.ID))
+	})
+
+	t.Run("changes are audited", func(t *testing.T) {
+		var events []db.AuditEvent
+		require.NoError(t, database.Where("resource_type = ?", "feature_flag").Order("created_at ASC").Find(&events).Error)
+		require.NotEmpty(t, events)
+		assert.Equal(t, "feature_flag.update", events[0].Action)
+		assert.Equal(t, flags.Webhooks, events[0].ResourceID)
+		assert.Equal(t, "feature_flag.reset", events[len(events)-1].Action)
+	})
+}
+
+func TestPlanQuotas(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	cfg := *server.cfg
+	cfg.RateLimitPlans = map[string]config.RatePlan{
+		"free": {UserLimit: 10, TokenLimit: 10},
+		"pro":  {UserLimit: 100, TokenLimit: 100},
+	}
+	cfg.RateLimitDefaultPlan = "free"
+	cfg.PlanQuotas = map[string]config.PlanQuota{
+		"free": {MaxRepositories: 1, MaxRunsPerMonth: 3, RetentionDays: 30},
+	}
+	planned, err := NewServer(&cfg, server.db)
+	require.NoError(t, err)
+
+	database := server.db
+	user := createTestUser(t, database)
+	userToken := generateTestJWT(t, planned, user.ID, user.GitHubUsername)
+	admin := &db.User{GitHubID: 1, GitHubUsername: "octoadmin", Role: db.RoleAdmin}
+	require.NoError(t, database.Create(admin).Error)
+	adminToken := generateTestJWT(t, planned, admin.ID, admin.GitHubUsername)
+	org := &db.Organization{GitHubID: 100, GitHubLogin: "greenorg"}
+	require.NoError(t, database.Create(org).Error)
+	require.NoError(t, database.Create(&db.OrganizationMember{OrganizationID: org.ID, UserID: user.ID}).Error)
+	repo := createTestRepository(t, database, user.ID)
+	orgRepo := &db.Repository{OwnerID: user.ID, OrganizationID: &org.ID, GitHubRepoID: 67891, Name: "app",
+		FullName: "greenorg/app", HTMLURL: "https://github.com/greenorg/app"}
+	require.NoError(t, database.Create(orgRepo).Error)
+
+	call := func(t *testing.T, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		planned.router.ServeHTTP(w, req)
+		return w
+	}
+	createRun := func(t *testing.T, fullName string) *httptest.ResponseRecorder {
+		owner, name, _ := strings.Cut(fullName, "/")
+		return call(t, "POST", "/runs", userToken, service.RunCreateRequest{
+			EnergyKWh: 0.5,
+			CO2Kg:     0.2,
+			DurationS: 60,
+			Repository: service.RepositoryCreateRequest{
+				Name:     name,
+				FullName: fullName,
+				HTMLURL:  "https://github.com/" + owner + "/" + name,
+			},
+		})
+	}
+	var response map[string]interface{}
+
+	t.Run("repository limit", func(t *testing.T) {
+		require.Equal(t, http.StatusCreated, createRun(t, "testuser/testrepo").Code)
+
+		w := createRun(t, "testuser/second")
+		require.Equal(t, http.StatusPaymentRequired, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "PLAN_REPOSITORY_LIMIT_REACHED", response["code"])
+		assert.Equal(t, "free", response["plan"])
+		assert.Equal(t, float64(1), response["limit"])
+	})
+
+	t.Run("monthly run limit", func(t *testing.T) {
+		require.Equal(t, http.StatusCreated, createRun(t, "testuser/testrepo").Code)
+		require.Equal(t, http.StatusCreated, createRun(t, "testuser/testrepo").Code)
+
+		w := createRun(t, "testuser/testrepo")
+		require.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.NotEmpty(t, w.Header().Get("Retry-After"))
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "PLAN_RUN_LIMIT_REACHED", response["code"])
+		assert.NotEmpty(t, response["reset_at"])
+	})
+
+	t.Run("usage", func(t *testing.T) {
+		w := call(t, "GET", "/me/plan", userToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var plan PlanResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &plan))
+		assert.Equal(t, "free", plan.Plan)
+		assert.Equal(t, 10, plan.RateLimit.UserLimit)
+		assert.Equal(t, 1, plan.Quota.MaxRepositories)
+		assert.Equal(t, int64(1), plan.Usage.Repositories)
+		assert.Equal(t, int64(3), plan.Usage.RunsThisMonth)
+		assert.True(t, plan.Usage.MonthResetsAt.After(time.Now()))
+	})
+
+	t.Run("listing is limited to the retention", func(t *testing.T) {
+		old := &db.Run{UserID: user.ID, RepositoryID: repo.ID, EnergyKWh: 1, CO2Kg: 1, DurationS: 60,
+			CreatedAt: time.Now().AddDate(0, 0, -60)}
+		require.NoError(t, database.Create(old).Error)
+
+		w := call(t, "GET", "/repos/"+repo.ID.String()+"/runs", userToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, float64(3), response["pagination"].(map[string]interface{})["total"])
+
+		// An earlier from_date does not reach past the retention
+		from := url.QueryEscape(time.Now().AddDate(-1, 0, 0).Format(time.RFC3339))
+		w = call(t, "GET", "/repos/"+repo.ID.String()+"/runs?from_date="+from, userToken, nil)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, float64(3), response["pagination"].(map[string]interface{})["total"])
+	})
+
+	t.Run("organization plans", func(t *testing.T) {
+		w := call(t, "PATCH", "/admin/orgs/greenorg", userToken, map[string]string{"plan": "pro"})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		w = call(t, "PATCH", "/admin/orgs/greenorg", adminToken, map[string]string{"plan": "platinum"})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		// Organization repositories count against the organization's plan
+		require.Equal(t, http.StatusCreated, createRun(t, "greenorg/app").Code)
+		require.Equal(t, http.StatusPaymentRequired, createRun(t, "greenorg/second").Code)
+
+		w = call(t, "PATCH", "/admin/orgs/greenorg", adminToken, map[string]string{"plan": "pro"})
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, http.StatusCreated, createRun(t, "greenorg/second").Code)
+
+		w = call(t, "GET", "/orgs/greenorg/plan", userToken, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var plan PlanResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &plan))
+		assert.Equal(t, "pro", plan.Plan)
+		assert.Nil(t, plan.RateLimit)
+		assert.Equal(t, service.Quota{}, plan.Quota)
+		assert.Equal(t, int64(2), plan.Usage.Repositories)
+
+		var event db.AuditEvent
+		require.NoError(t, database.Where("action = ?", "organization.update").First(&event).Error)
+		assert.Equal(t, "pro", event.Changes["plan"].(map[string]interface{})["to"])
+
+		// The personal quotas of the user are unchanged
+		assert.Equal(t, http.StatusTooManyRequests, createRun(t, "testuser/testrepo").Code)
+	})
+
+	t.Run("upgrading the user", func(t *testing.T) {
+		w := call(t, "PATCH", "/admin/users/"+user.ID.String(), adminToken, map[string]string{"plan": "pro"})
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, http.StatusCreated, createRun(t, "testuser/testrepo").Code)
+	})
+}
+
+func TestAPIVersioning(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	user := createTestUser(t, server.db)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	call := func(t *testing.T, s *Server, path string, headers map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		req.AddCookie(&http.Cookie{
+			Name:  "ecoci_token",
+			Value: token,
+		})
+		s.router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("versioned routes", func(t *testing.T) {
+		w := call(t, server, "/api/v1/me/stats", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "1", w.Header().Get("API-Version"))
+		assert.Empty(t, w.Header().Get("Deprecation"))
+
+		w = call(t, server, "/api/v1/auth/me", map[string]string{"Accept": "application/vnd.ecoci.v1+json"})
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("legacy routes are deprecated aliases", func(t *testing.T) {
+		w := call(t, server, "/me/stats", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "1", w.Header().Get("API-Version"))
+		assert.Equal(t, "true", w.Header().Get("Deprecation"))
+		assert.Equal(t, `</api/v1/me/stats>; rel="successor-version"`, w.Header().Get("Link"))
+		assert.Empty(t, w.Header().Get("Sunset"))
+
+		cfg := *server.cfg
+		cfg.LegacyAPISunset = time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC)
+		sunsetting, err := NewServer(&cfg, server.db)
+		require.NoError(t, err)
+		w = call(t, sunsetting, "/me/stats", nil)
+		assert.Equal(t, "Mon, 30 Jun 2025 00:00:00 GMT", w.Header().Get("Sunset"))
+		w = call(t, sunsetting, "/api/v1/me/stats", nil)
+		assert.Empty(t, w.Header().Get("Sunset"))
+	})
+
+	t.Run("unsupported versions are rejected", func(t *testing.T) {
+		for _, headers := range []map[string]string{
+			{"API-Version": "2"},
+			{"API-Version": "latest"},
+			{"Accept": "application/vnd.ecoci.v2+json"},
+		} {
+			w := call(t, server, "/api/v1/me/stats", headers)
+			require.Equal(t, http.StatusNotAcceptable, w.Code, headers)
+			var response map[string]interface{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, "UNSUPPORTED_API_VERSION", response["code"])
+		}
+
+		w := call(t, server, "/me/stats", map[string]string{"API-Version": "2"})
+		assert.Equal(t, http.StatusNotAcceptable, w.Code)
+	})
+
+	t.Run("probes stay unversioned", func(t *testing.T) {
+		w := call(t, server, "/healthz", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("Deprecation"))
+	})
+}
+
+func TestProblemDetails(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	user := createTestUser(t, server.db)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	call := func(t *testing.T, method, path, token string, headers map[string]string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		if token != "" {
+			req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+		}
+		server.router.ServeHTTP(w, req)
+
+		assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w, response
+	}
+
+	t.Run("handler errors", func(t *testing.T) {
+		path := "/api/v1/runs/" + uuid.New().String()
+		w, response := call(t, "DELETE", path, token, map[string]string{"X-Request-ID": "req-123"})
+		require.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "https://ecoci.dev/problems/run-not-found", response["type"])
+		assert.Equal(t, "Run not found", response["title"])
+		assert.Equal(t, float64(http.StatusNotFound), response["status"])
+		assert.Equal(t, "RUN_NOT_FOUND", response["code"])
+		assert.Equal(t, path, response["instance"])
+		assert.Equal(t, "req-123", response["request_id"])
+		assert.NotEmpty(t, response["timestamp"])
+		assert.NotContains(t, response, "error")
+	})
+
+	t.Run("middleware errors", func(t *testing.T) {
+		w, response := call(t, "GET", "/api/v1/me/stats", "", nil)
+		require.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Equal(t, "MISSING_TOKEN", response["code"])
+		assert.Equal(t, "/api/v1/me/stats", response["instance"])
+		assert.NotEmpty(t, response["request_id"])
+	})
+
+	t.Run("extension members", func(t *testing.T) {
+		w, response := call(t, "GET", "/api/v1/me/stats", token, map[string]string{"API-Version": "2"})
+		require.Equal(t, http.StatusNotAcceptable, w.Code)
+		assert.Equal(t, "UNSUPPORTED_API_VERSION", response["code"])
+		assert.Equal(t, []interface{}{float64(1)}, response["supported_versions"])
+	})
+
+	t.Run("unknown routes", func(t *testing.T) {
+		w, response := call(t, "GET", "/api/v1/does-not-exist", token, nil)
+		require.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "ROUTE_NOT_FOUND", response["code"])
+		assert.Equal(t, "https://ecoci.dev/problems/route-not-found", response["type"])
+	})
+}
+
+func TestIngestRequestBody(t *testing.T) {
+	base, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	cfg := *base.cfg
+	cfg.MaxIngestBodyBytes = 4096
+	server, err := NewServer(&cfg, base.db)
+	require.NoError(t, err)
+
+	user := createTestUser(t, server.db)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	runBody := func(t *testing.T, padding int) []byte {
+		body, err := json.Marshal(service.RunCreateRequest{
+			EnergyKWh: 0.5,
+			CO2Kg:     0.3,
+			DurationS: 120,
+			Repository: service.RepositoryCreateRequest{
+				Name:     "testrepo",
+				FullName: "testuser/testrepo",
+				HTMLURL:  "https://github.com/testuser/testrepo",
+			},
+			Metadata: map[string]interface{}{"padding": strings.Repeat("x", padding)},
+		})
+		require.NoError(t, err)
+		return body
+	}
+	gzipped := func(t *testing.T, data []byte) []byte {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		_, err := gz.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, gz.Close())
+		return buf.Bytes()
+	}
+	deflated := func(t *testing.T, data []byte) []byte {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		_, err := zw.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, zw.Close())
+		return buf.Bytes()
+	}
+	post := func(t *testing.T, body []byte, encoding string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/runs", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if encoding != "" {
+			req.Header.Set("Content-Encoding", encoding)
+		}
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	code := func(t *testing.T, w *httptest.ResponseRecorder) string {
+		var response map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response["code"].(string)
+	}
+
+	t.Run("compressed bodies are decoded", func(t *testing.T) {
+		assert.Equal(t, http.StatusCreated, post(t, runBody(t, 100), "").Code)
+		assert.Equal(t, http.StatusCreated, post(t, gzipped(t, runBody(t, 100)), "gzip").Code)
+		assert.Equal(t, http.StatusCreated, post(t, deflated(t, runBody(t, 100)), "deflate").Code)
+	})
+
+	t.Run("oversized bodies are rejected", func(t *testing.T) {
+		w := post(t, runBody(t, 5000), "")
+		require.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		assert.Equal(t, "REQUEST_BODY_TOO_LARGE", code(t, w))
+
+		// The limit applies to the decoded body, however well it compresses
+		compressed := gzipped(t, runBody(t, 100000))
+		require.Less(t, len(compressed), 4096)
+		w = post(t, compressed, "gzip")
+		require.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		assert.Equal(t, "REQUEST_BODY_TOO_LARGE", code(t, w))
+	})
+
+	t.Run("unsupported and corrupt encodings are rejected", func(t *testing.T) {
+		w := post(t, runBody(t, 100), "br")
+		require.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+		assert.Equal(t, "UNSUPPORTED_CONTENT_ENCODING", code(t, w))
+		assert.Equal(t, "gzip, deflate", w.Header().Get("Accept-Encoding"))
+
+		w = post(t, runBody(t, 100), "gzip")
+		require.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "INVALID_CONTENT_ENCODING", code(t, w))
+	})
+}
+
+func TestAPIClient(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	user := createTestUser(t, server.db)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+	api := httptest.NewServer(server.router)
+	defer api.Close()
+
+	req := &service.RunCreateRequest{
+		EnergyKWh: 0.145,
+		CO2Kg:     0.087,
+		DurationS: 120.5,
+		Repository: service.RepositoryCreateRequest{
+			Name:     "testrepo",
+			FullName: "testuser/testrepo",
+			HTMLURL:  "https://github.com/testuser/testrepo",
+		},
+	}
+
+	t.Run("submits runs with a bearer token", func(t *testing.T) {
+		run, err := client.New(api.URL+"/", token).CreateRun(context.Background(), req)
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, run.UserID)
+		assert.Equal(t, 0.087, run.CO2Kg)
+	})
+
+	t.Run("reports problem details", func(t *testing.T) {
+		_, err := client.New(api.URL, "not-a-token").CreateRun(context.Background(), req)
+		var apiErr *client.Error
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+		assert.Equal(t, "INVALID_TOKEN", apiErr.Problem.Code)
+	})
+
+	t.Run("malformed authorization headers are rejected", func(t *testing.T) {
+		for _, header := range []string{token, "Basic " + token, "Bearer "} {
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("GET", "/api/v1/me/stats", nil)
+			r.Header.Set("Authorization", header)
+			server.router.ServeHTTP(w, r)
+			assert.Equal(t, http.StatusUnauthorized, w.Code, header)
+		}
+	})
+}
+
+func TestAPIClientStats(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	user := createTestUser(t, server.db)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+	api := httptest.NewServer(server.router)
+	defer api.Close()
+	ecoci := client.New(api.URL, token)
+
+	repo := createTestRepository(t, server.db, user.ID)
+	now := time.Now().UTC()
+	for i, co2 := range []float64{0.1, 0.2, 0.3} {
+		run := &db.Run{
+			UserID:       user.ID,
+			RepositoryID: repo.ID,
+			EnergyKWh:    co2 * 2,
+			CO2Kg:        co2,
+			DurationS:    60,
+			WorkflowName: stringPtr("build"),
+			CreatedAt:    now.AddDate(0, 0, -i),
+		}
+		require.NoError(t, server.db.Create(run).Error)
+	}
+	// A run of the previous period
+	require.NoError(t, server.db.Create(&db.Run{UserID: user.ID, RepositoryID: repo.ID, EnergyKWh: 1, CO2Kg: 0.5, DurationS: 60, CreatedAt: now.AddDate(0, 0, -10)}).Error)
+
+	found, err := ecoci.Repository(context.Background(), "testuser/testrepo")
+	require.NoError(t, err)
+	assert.Equal(t, repo.ID, found.ID)
+
+	_, err = ecoci.Repository(context.Background(), "testuser/other")
+	assert.ErrorIs(t, err, client.ErrRepositoryNotFound)
+
+	from, to := now.AddDate(0, 0, -7), now.Add(time.Minute)
+	stats, err := ecoci.RepositoryStats(context.Background(), repo.ID, from, to)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stats.Summary.RunCount)
+	assert.InDelta(t, 0.6, stats.Summary.TotalCO2Kg, 1e-9)
+	require.NotNil(t, stats.Comparison)
+	require.NotNil(t, stats.Comparison.Changes["co2_kg"].Percent)
+	assert.InDelta(t, 20.0, *stats.Comparison.Changes["co2_kg"].Percent, 1e-9)
+
+	points, err := ecoci.TimeSeries(context.Background(), repo.ID, "co2_kg", "day", from, to)
+	require.NoError(t, err)
+	var total float64
+	for _, point := range points {
+		total += point.Sum
+	}
+	assert.InDelta(t, 0.6, total, 1e-9)
+
+	workflows, err := ecoci.WorkflowStats(context.Background(), repo.ID, from, to)
+	require.NoError(t, err)
+	require.Len(t, workflows, 1)
+	assert.Equal(t, "build", *workflows[0].WorkflowName)
+	assert.Equal(t, int64(3), workflows[0].RunCount)
+}
+
+func TestImportCodecarbon(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	user := createTestUser(t, server.db)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+	api := httptest.NewServer(server.router)
+	defer api.Close()
+	ecoci := client.New(api.URL, token)
+
+	emissions := `timestamp,project_name,run_id,duration,emissions,emissions_rate,cpu_power,gpu_power,ram_power,cpu_energy,gpu_energy,ram_energy,energy_consumed,country_name,country_iso_code,region,cloud_provider,cloud_region,os,python_version,codecarbon_version,cpu_count,cpu_model,gpu_count,gpu_model,ram_total_size,tracking_mode
+2024-03-01T10:15:30,testuser/ml-pipeline,5b0fa12a-3dd7-45bb-9766-cc326314d9f1,120.5,0.0087,7.2e-05,42.5,0,5.9,0.00142,0,0.0002,0.00162,Germany,DEU,hesse,,,Linux-6.5.0-x86_64,3.11.7,2.3.4,8,Intel(R) Xeon(R) Platinum 8370C CPU @ 2.80GHz,,,15.6,machine
+2024-03-02T09:00:00+01:00,testuser/ml-pipeline,7c1eb23b-4ee8-46cc-a877-dd437425e0a2,60,0.004,6.6e-05,42.5,0,5.9,0.0007,0,0.0001,0.0008,,,,gcp,europe-west1,Linux,3.11.7,2.3.4,8,,,,15.6,machine
+`
+
+	t.Run("imports rows at their timestamps", func(t *testing.T) {
+		result, err := ecoci.Import(context.Background(), "codecarbon", nil, "text/csv", strings.NewReader(emissions))
+		require.NoError(t, err)
+		assert.Equal(t, 2, result.Imported)
+		assert.Equal(t, 0, result.Skipped)
+		assert.Equal(t, []string{"testuser/ml-pipeline"}, result.Repositories)
+
+		var runs []db.Run
+		require.NoError(t, server.db.Order("created_at ASC").Find(&runs).Error)
+		require.Len(t, runs, 2)
+		assert.True(t, runs[0].CreatedAt.Equal(time.Date(2024, 3, 1, 10, 15, 30, 0, time.UTC)))
+		assert.True(t, runs[1].CreatedAt.Equal(time.Date(2024, 3, 2, 8, 0, 0, 0, time.UTC)))
+		assert.Equal(t, 0.00162, runs[0].EnergyKWh)
+		assert.Equal(t, 0.0087, runs[0].CO2Kg)
+		assert.Equal(t, 120.5, runs[0].DurationS)
+		assert.Equal(t, "codecarbon", runs[0].RunMetadata["import_source"])
+		assert.Equal(t, "5b0fa12a-3dd7-45bb-9766-cc326314d9f1", runs[0].RunMetadata["import_id"])
+		assert.Equal(t, "hesse", runs[0].RunMetadata["region"])
+		assert.Equal(t, 8.0, runs[0].RunMetadata["cpu_count"])
+		assert.Equal(t, "europe-west1", runs[1].RunMetadata["region"])
+
+		// The rollups are filed under the days of the measurements
+		var days []db.RepositoryDailyRollup
+		require.NoError(t, server.db.Order("day ASC").Find(&days).Error)
+		require.Len(t, days, 2)
+		assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), days[0].Day.UTC())
+	})
+
+	t.Run("skips rows imported before", func(t *testing.T) {
+		result, err := ecoci.Import(context.Background(), "codecarbon", nil, "text/csv", strings.NewReader(emissions))
+		require.NoError(t, err)
+		assert.Equal(t, 0, result.Imported)
+		assert.Equal(t, 2, result.Skipped)
+	})
+
+	t.Run("the repository can be given", func(t *testing.T) {
+		body := &bytes.Buffer{}
+		form := multipart.NewWriter(body)
+		part, _ := form.CreateFormFile("file", "emissions.csv")
+		part.Write([]byte("timestamp,project_name,duration,emissions,energy_consumed\n2024-03-03T12:00:00,training,30,0.001,0.002\n"))
+		form.Close()
+
+		result, err := ecoci.Import(context.Background(), "codecarbon", url.Values{"repository": {"testuser/ml-pipeline"}}, form.FormDataContentType(), body)
+		require.NoError(t, err)
+		assert.Equal(t, 1, result.Imported)
+		assert.Equal(t, []string{"testuser/ml-pipeline"}, result.Repositories)
+	})
+
+	t.Run("invalid rows import nothing", func(t *testing.T) {
+		csv := "timestamp,project_name,duration,emissions,energy_consumed\n" +
+			"2024-03-04T12:00:00,testuser/other,30,0.001,0.002\n" +
+			"yesterday,testuser/other,30,0.001,0.002\n" +
+			"2024-03-04T13:00:00,not-a-repository,-1,0.001,0.002\n"
+		_, err := ecoci.Import(context.Background(), "codecarbon", nil, "text/csv", strings.NewReader(csv))
+		var apiErr *client.Error
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, http.StatusUnprocessableEntity, apiErr.StatusCode)
+		assert.Equal(t, "INVALID_IMPORT_FILE", apiErr.Problem.Code)
+		lineErrors, ok := apiErr.Problem.Extensions["errors"].([]interface{})
+		require.True(t, ok)
+		require.Len(t, lineErrors, 2)
+		assert.Equal(t, 3.0, lineErrors[0].(map[string]interface{})["line"])
+		assert.Contains(t, lineErrors[1].(map[string]interface{})["message"], "owner/name")
+
+		var count int64
+		server.db.Model(&db.Repository{}).Where("full_name = ?", "testuser/other").Count(&count)
+		assert.Zero(t, count)
+
+		_, err = ecoci.Import(context.Background(), "codecarbon", nil, "text/csv", strings.NewReader("name,value\n"))
+		require.ErrorAs(t, err, &apiErr)
+		assert.Equal(t, http.StatusUnprocessableEntity, apiErr.StatusCode)
+	})
+}
+
+func TestImportCloudCarbonFootprint(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	user := createTestUser(t, server.db)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+	api := httptest.NewServer(server.router)
+	defer api.Close()
+	ecoci := client.New(api.URL, token)
+
+	footprint := `[
+  {"timestamp": "2024-03-01T00:00:00.000Z", "serviceEstimates": [
+    {"cloudProvider": "AWS", "accountId": "123456789012", "accountName": "production", "serviceName": "AmazonEC2", "region": "eu-central-1", "kilowattHours": 12.5, "co2e": 0.0042, "cost": 31.2},
+    {"cloudProvider": "AWS", "accountId": "123456789012", "accountName": "production", "serviceName": "AmazonS3", "region": "eu-central-1", "kilowattHours": 0.8, "co2e": 0.0003, "cost": 4.1}
+  ]},
+  {"timestamp": "2024-03-02T00:00:00.000Z", "serviceEstimates": [
+    {"cloudProvider": "AWS", "accountId": "123456789012", "accountName": "production", "serviceName": "AmazonEC2", "region": "eu-central-1", "kilowattHours": 11, "co2e": 0.0038, "cost": 29.8}
+  ]}
+]`
+
+	// The estimates go to the cloud repository of the user
+	result, err := ecoci.Import(context.Background(), "cloud-carbon-footprint", nil, "application/json", strings.NewReader(footprint))
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.Imported)
+	assert.Equal(t, []string{"testuser/cloud"}, result.Repositories)
+
+	result, err = ecoci.Import(context.Background(), "cloud-carbon-footprint", nil, "application/json", strings.NewReader(footprint))
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.Imported)
+	assert.Equal(t, 3, result.Skipped)
+
+	var repo db.Repository
+	require.NoError(t, server.db.Where("full_name = ?", "testuser/cloud").First(&repo).Error)
+
+	// The workflow statistics break the estimates down by service
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/repos/"+repo.ID.String()+"/workflows/stats?from=2024-03-01&to=2024-03-31", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	server.router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Workflows []struct {
+			WorkflowName *string `json:"workflow_name"`
+			RunCount     int64   `json:"run_count"`
+		} `json:"workflows"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	counts := map[string]int64{}
+	for _, workflow := range response.Workflows {
+		require.NotNil(t, workflow.WorkflowName)
+		counts[*workflow.WorkflowName] = workflow.RunCount
+	}
+	assert.Equal(t, map[string]int64{"AmazonEC2": 2, "AmazonS3": 1}, counts)
+
+	var total float64
+	require.NoError(t, server.db.Model(&db.Run{}).Where("repository_id = ?", repo.ID).Select("SUM(co2_kg)").Scan(&total).Error)
+	assert.InDelta(t, 8.3, total, 1e-9)
+}
+
+func TestImportGreenMetricsTool(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	user := createTestUser(t, server.db)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+	api := httptest.NewServer(server.router)
+	defer api.Close()
+	ecoci := client.New(api.URL, token)
+
+	measurement := `{"success": true, "data": {
+  "id": "0b8b6b1e-8c51-4c38-9a6c-5b7a0c1e4f2d",
+  "name": "Stress test",
+  "uri": "https://github.com/testuser/hello-world",
+  "branch": "main",
+  "created_at": "2024-03-01T10:00:00Z",
+  "phase_stats": [
+    {"phase": "004_[RUNTIME]", "metric": "psu_energy_ac_mcp_machine", "detail_name": "[MACHINE]", "value": 3600000000, "unit": "uJ"},
+    {"phase": "004_[RUNTIME]", "metric": "psu_carbon_ac_mcp_machine", "detail_name": "[MACHINE]", "value": 400000, "unit": "ug"},
+    {"phase": "004_[RUNTIME]", "metric": "phase_time_syscall_system", "detail_name": "[SYSTEM]", "value": 40000000, "unit": "us"},
+    {"phase": "005_Build", "metric": "psu_energy_ac_mcp_machine", "detail_name": "[MACHINE]", "value": 1200000000, "unit": "uJ"},
+    {"phase": "005_Build", "metric": "phase_time_syscall_system", "detail_name": "[SYSTEM]", "value": 10000000, "unit": "us"},
+    {"phase": "006_Test", "metric": "psu_energy_ac_mcp_machine", "detail_name": "[MACHINE]", "value": 2400000000, "unit": "uJ"},
+    {"phase": "006_Test", "metric": "phase_time_syscall_system", "detail_name": "[SYSTEM]", "value": 30000000, "unit": "us"}
+  ]
+}}`
+
+	result, err := ecoci.Import(context.Background(), "green-metrics-tool", nil, "application/json", strings.NewReader(measurement))
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Imported)
+	assert.Equal(t, []string{"testuser/hello-world"}, result.Repositories)
+
+	result, err = ecoci.Import(context.Background(), "green-metrics-tool", nil, "application/json", strings.NewReader(measurement))
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Skipped)
+
+	// The run lists its steps and keeps the Green Metrics Tool ID
+	var repo db.Repository
+	require.NoError(t, server.db.Where("full_name = ?", "testuser/hello-world").First(&repo).Error)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/repos/"+repo.ID.String()+"/runs?from_date=2024-03-01", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	server.router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Runs []struct {
+			EnergyKWh   float64 `json:"energy_kwh"`
+			DurationS   float64 `json:"duration_s"`
+			RunMetadata struct {
+				GMTRunID string `json:"gmt_run_id"`
+				Steps    []struct {
+					Name      string  `json:"name"`
+					EnergyKWh float64 `json:"energy_kwh"`
+					DurationS float64 `json:"duration_s"`
+				} `json:"steps"`
+			} `json:"run_metadata"`
+		} `json:"runs"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	require.Len(t, response.Runs, 1)
+	run := response.Runs[0]
+	assert.InDelta(t, 0.001, run.EnergyKWh, 1e-12)
+	assert.InDelta(t, 40.0, run.DurationS, 1e-9)
+	assert.Equal(t, "0b8b6b1e-8c51-4c38-9a6c-5b7a0c1e4f2d", run.RunMetadata.GMTRunID)
+	require.Len(t, run.RunMetadata.Steps, 2)
+	assert.Equal(t, "Build", run.RunMetadata.Steps[0].Name)
+	assert.InDelta(t, 10.0, run.RunMetadata.Steps[0].DurationS, 1e-9)
+	assert.Equal(t, "Test", run.RunMetadata.Steps[1].Name)
+}
+
+func TestCarbonHistoryManifest(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	user := createTestUser(t, server.db)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+	api := httptest.NewServer(server.router)
+	defer api.Close()
+	ecoci := client.New(api.URL, token)
+
+	repo := createTestRepository(t, server.db, user.ID)
+	branch := "main"
+	first := &db.Run{UserID: user.ID, RepositoryID: repo.ID, EnergyKWh: 0.5, CO2Kg: 0.3, DurationS: 120, BranchName: &branch,
+		RunMetadata: db.JSONB{"runner": "ubuntu-latest"}, CreatedAt: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)}
+	require.NoError(t, server.db.Create(first).Error)
+	second := createTestRun(t, server.db, user.ID, repo.ID)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/repos/"+repo.ID.String()+"/export.json", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	server.router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "ecoci-testuser-testrepo-")
+
+	var manifest export.Manifest
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &manifest))
+	assert.Equal(t, export.ManifestFormat, manifest.Format)
+	assert.Equal(t, export.ManifestVersion, manifest.Version)
+	assert.Equal(t, server.cfg.AppURL, manifest.Source)
+	assert.Equal(t, repo.FullName, manifest.Repository.FullName)
+	require.Len(t, manifest.Runs, 2)
+	assert.Equal(t, first.ID.String(), manifest.Runs[0].ID)
+	assert.Equal(t, "main", *manifest.Runs[0].BranchName)
+	assert.Equal(t, map[string]interface{}{"runner": "ubuntu-latest"}, manifest.Runs[0].Metadata)
+	assert.Equal(t, second.ID.String(), manifest.Runs[1].ID)
+
+	// The manifest imports into another repository, once
+	query := url.Values{"repository": {"testuser/moved"}}
+	result, err := ecoci.Import(context.Background(), "ecoci", query, "application/json", bytes.NewReader(w.Body.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Imported)
+	assert.Equal(t, []string{"testuser/moved"}, result.Repositories)
+	result, err = ecoci.Import(context.Background(), "ecoci", query, "application/json", bytes.NewReader(w.Body.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Skipped)
+
+	var moved db.Run
+	require.NoError(t, server.db.Joins("JOIN repositories ON repositories.id = runs.repository_id").
+		Where("repositories.full_name = ? AND runs.created_at = ?", "testuser/moved", first.CreatedAt).First(&moved).Error)
+	assert.Equal(t, "main", *moved.BranchName)
+	assert.Equal(t, "ubuntu-latest", moved.RunMetadata["runner"])
+	assert.Equal(t, first.ID.String(), moved.RunMetadata["import_id"])
+
+	// Manifests of later versions are rejected
+	manifest.Version = export.ManifestVersion + 1
+	newer, _ := json.Marshal(manifest)
+	_, err = ecoci.Import(context.Background(), "ecoci", nil, "application/json", bytes.NewReader(newer))
+	var apiErr *client.Error
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusUnprocessableEntity, apiErr.StatusCode)
+}
+
+func TestBudgetCheck(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	user := createTestUser(t, server.db)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+	api := httptest.NewServer(server.router)
+	defer api.Close()
+	ecoci := client.New(api.URL, token)
+
+	repo := createTestRepository(t, server.db, user.ID)
+	createTestRun(t, server.db, user.ID, repo.ID)
+
+	check, err := ecoci.BudgetCheck(context.Background(), repo.ID)
+	require.NoError(t, err)
+	assert.Equal(t, service.BudgetStatusNone, check.Status)
+	assert.False(t, check.Exceeded)
+	assert.Empty(t, check.Budgets)
+
+	_, err = server.budgetService.SetBudget(repo.ID, "quarter", 1000)
+	require.NoError(t, err)
+	check, err = ecoci.BudgetCheck(context.Background(), repo.ID)
+	require.NoError(t, err)
+	assert.Equal(t, service.BudgetStatusOnTrack, check.Status)
+	require.Len(t, check.Budgets, 1)
+	assert.Equal(t, "quarter", check.Budgets[0].Period)
+
+	// The run's 0.3 kg is over the monthly budget
+	_, err = server.budgetService.SetBudget(repo.ID, "month", 0.2)
+	require.NoError(t, err)
+	check, err = ecoci.BudgetCheck(context.Background(), repo.ID)
+	require.NoError(t, err)
+	assert.Equal(t, service.BudgetStatusExceeded, check.Status)
+	assert.True(t, check.Exceeded)
+	require.Len(t, check.Budgets, 2)
+	assert.Equal(t, "month", check.Budgets[0].Period)
+	assert.Equal(t, service.BudgetStatusExceeded, check.Budgets[0].BudgetStatus)
+	assert.InDelta(t, 0.3, check.Budgets[0].ActualCO2Kg, 1e-9)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/repos/"+repo.ID.String()+"/budget-check?lookback_days=3", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	server.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestOpenAPI(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	t.Run("every route is documented", func(t *testing.T) {
+		served := map[string]bool{}
+		for _, route := range server.router.Routes() {
+			if path, ok := strings.CutPrefix(route.Path, APIPrefix); ok {
+				served[route.Method+" "+path] = true
+			}
+		}
+		for route := range served {
+			assert.Contains(t, routeOperations, route, "route is not documented")
+		}
+		for route := range routeOperations {
+			assert.Contains(t, served, route, "documented route is not served")
+		}
+	})
+
+	t.Run("document", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/openapi.json", nil)
+		server.router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var doc map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+		assert.Equal(t, "3.0.3", doc["openapi"])
+		assert.Equal(t, []interface{}{map[string]interface{}{"url": "/api/v1"}}, doc["servers"])
+
+		paths := doc["paths"].(map[string]interface{})
+		createRun := paths["/runs"].(map[string]interface{})["post"].(map[string]interface{})
+		assert.Equal(t, "createRun", createRun["operationId"])
+		assert.Equal(t, "#/components/schemas/service.RunCreateRequest",
+			createRun["requestBody"].(map[string]interface{})["content"].(map[string]interface{})["application/json"].(map[string]interface{})["schema"].(map[string]interface{})["$ref"])
+		responses := createRun["responses"].(map[string]interface{})
+		assert.Contains(t, responses, "201")
+		assert.Contains(t, responses["default"].(map[string]interface{})["content"], "application/problem+json")
+		assert.Len(t, createRun["security"], 2)
+
+		leaderboard := paths["/leaderboard"].(map[string]interface{})["get"].(map[string]interface{})
+		assert.Empty(t, leaderboard["security"])
+		assert.Contains(t, paths["/repos/{repo_id}/export.xlsx"].(map[string]interface{})["get"].(map[string]interface{})["responses"].(map[string]interface{})["200"].(map[string]interface{})["content"], export.ContentTypeXLSX)
+
+		// Operation IDs are unique and every reference resolves
+		schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+		ids := map[string]bool{}
+		for path, operations := range paths {
+			for method, operation := range operations.(map[string]interface{}) {
+				id := operation.(map[string]interface{})["operationId"].(string)
+				assert.False(t, ids[id], "%s %s: duplicate operation ID %s", method, path, id)
+				ids[id] = true
+			}
+		}
+		assert.Len(t, ids, len(routeOperations))
+		for _, ref := range regexp.MustCompile(`"\$ref":"#/components/schemas/([^"]+)"`).FindAllStringSubmatch(w.Body.String(), -1) {
+			assert.Contains(t, schemas, ref[1])
+		}
+		run := schemas["db.Run"].(map[string]interface{})["properties"].(map[string]interface{})
+		assert.Equal(t, map[string]interface{}{"type": "number", "format": "double"}, run["co2_kg"])
+	})
+
+	t.Run("Swagger UI is enabled by config", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/swagger/index.html", nil)
+		server.router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		cfg := *server.cfg
+		cfg.SwaggerUI = true
+		withUI, err := NewServer(&cfg, server.db)
+		require.NoError(t, err)
+		w = httptest.NewRecorder()
+		withUI.router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `url: "\/openapi.json"`)
+	})
+}
+
+// busSink keeps the messages published to the event bus
+type busSink struct {
+	mu       sync.Mutex
+	messages []eventbus.Message
+}
+
+func (b *busSink) Send(ctx context.Context, msg eventbus.Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.messages = append(b.messages, msg)
+	return nil
+}
+
+func TestEventBus(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+	repo := createTestRepository(t, database, user.ID)
+	sink := &busSink{}
+	server.eventBus = eventbus.NewPublisher(sink, eventbus.Options{Prefix: "ecoci.", Events: eventbus.Events, Format: webhook.FormatEcoCI})
+
+	_, err := server.budgetService.SetBudget(repo.ID, "month", 0.1)
+	require.NoError(t, err)
+	run := &db.Run{UserID: user.ID, RepositoryID: repo.ID, CO2Kg: 0.5, EnergyKWh: 1, DurationS: 60}
+	require.NoError(t, database.Create(run).Error)
+	server.publishRunEvents(run)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PATCH", "/repos/"+repo.ID.String()+"/settings", strings.NewReader(`{"public_stats":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+	server.router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	server.eventBus.Wait()
+
+	var topics []string
+	for _, msg := range sink.messages {
+		topics = append(topics, msg.Topic)
+		assert.Equal(t, repo.ID.String(), msg.Key)
+	}
+	assert.Equal(t, []string{"ecoci.run.created", "ecoci.budget.exceeded", "ecoci.repo.updated"}, topics)
+
+	var updated struct {
+		Event string        `json:"event"`
+		Data  db.Repository `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(sink.messages[2].Body, &updated))
+	assert.Equal(t, "repo.updated", updated.Event)
+	assert.True(t, updated.Data.PublicStats)
+	assert.Nil(t, updated.Data.Owner)
+}
+
+// archiveStore is an object store that discards what is written to it
+type archiveStore struct{}
+
+func (archiveStore) Put(ctx context.Context, key, contentType string, body []byte) error { return nil }
+func (archiveStore) Delete(ctx context.Context, key string) error                        { return nil }
+func (archiveStore) URL(key string) string                                               { return "s3://archive/" + key }
+
+func TestArchiveManifest(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	repo := createTestRepository(t, database, user.ID)
+	admin := &db.User{GitHubID: 1, GitHubUsername: "octoadmin", Role: db.RoleAdmin}
+	require.NoError(t, database.Create(admin).Error)
+	adminToken := generateTestJWT(t, server, admin.ID, admin.GitHubUsername)
+
+	get := func(t *testing.T, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: adminToken})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("not configured", func(t *testing.T) {
+		w := get(t, "/admin/archive/manifest")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "ARCHIVE_NOT_CONFIGURED")
+	})
+
+	server.archive = archive.NewArchiver(database, archiveStore{}, "ecoci")
+	day := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		d := day.AddDate(0, 0, i)
+		require.NoError(t, database.Create(&db.ArchivePartition{RepositoryID: repo.ID, Day: d, Key: server.archive.Key(repo.ID, d),
+			RunCount: 4, SizeBytes: 2048, ExportedAt: time.Now()}).Error)
+	}
+
+	t.Run("lists the files with their schema", func(t *testing.T) {
+		w := get(t, "/admin/archive/manifest?from=2024-06-02&repository_id="+repo.ID.String())
+		require.Equal(t, http.StatusOK, w.Code)
+		var response archiveManifestResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "parquet", response.Format)
+		assert.Equal(t, "s3://archive/ecoci/runs/day=*/repo=*/runs.parquet", response.Pattern)
+		assert.Equal(t, []string{"day", "repo"}, response.PartitionKeys)
+		assert.Contains(t, response.Columns, ArchiveColumn{Name: "co2_kg", Type: "double"})
+		assert.Contains(t, response.Columns, ArchiveColumn{Name: "branch", Type: "string", Nullable: true})
+		require.Len(t, response.Files, 2)
+		key := "ecoci/runs/day=2024-06-02/repo=" + repo.ID.String() + "/runs.parquet"
+		assert.Equal(t, key, response.Files[0].Key)
+		assert.Equal(t, "s3://archive/"+key, response.Files[0].URL)
+		assert.Equal(t, int64(4), response.Files[0].RunCount)
+		assert.Equal(t, int64(2), response.Pagination.Total)
+	})
+
+	t.Run("invalid filters", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, get(t, "/admin/archive/manifest?from=yesterday").Code)
+		assert.Equal(t, http.StatusBadRequest, get(t, "/admin/archive/manifest?repository_id=app").Code)
+	})
+}
+
+func TestHandleLogout(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/auth/logout", nil)
+	req.AddCookie(&http.Cookie{
+		Name:  "ecoci_token",
+		Value: token,
+	})
+	
+	server.router.ServeHTTP(w, req)
+	
+	assert.Equal(t, http.StatusOK, w.Code)
+	
+	var response map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	require.NoError(t, err)
+	
+	assert.Equal(t, "Successfully logged out", response["message"])
+	
+	// Check that cookie is cleared
+	cookies := w.Result().Cookies()
+	var tokenCookie *http.Cookie
+	for _, cookie := range cookies {
+		if cookie.Name == "ecoci_token" {
+			tokenCookie = cookie
+			break
+		}
+	}
+	
+	require.NotNil(t, tokenCookie)
+	assert.Equal(t, "", tokenCookie.Value)
+	assert.Equal(t, -1, tokenCookie.MaxAge)
+}
+
+func TestRunComments(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+	repo := createTestRepository(t, database, user.ID)
+	other := &db.User{GitHubID: 54321, GitHubUsername: "otheruser"}
+	require.NoError(t, database.Create(other).Error)
+	otherToken := generateTestJWT(t, server, other.ID, other.GitHubUsername)
+
+	doRequest := func(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	comment := func(run *db.Run, token string, body map[string]interface{}) service.Comment {
+		w := doRequest("POST", "/runs/"+run.ID.String()+"/comments", token, body)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var created service.Comment
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		return created
+	}
+
+	run := createTestRun(t, database, user.ID, repo.ID)
+	spike := comment(run, token, map[string]interface{}{"body": "  This spike was the quarterly load test  "})
+	assert.Equal(t, "This spike was the quarterly load test", spike.Body)
+	assert.Equal(t, user.ID, spike.Author.ID)
+	assert.Equal(t, "testuser", spike.Author.GitHubUsername)
+	assert.Nil(t, spike.ParentID)
+
+	reply := comment(run, otherToken, map[string]interface{}{"body": "Thanks, ignoring it", "parent_id": spike.ID})
+	assert.Equal(t, &spike.ID, reply.ParentID)
+	assert.Equal(t, "otheruser", reply.Author.GitHubUsername)
+
+	t.Run("list threads", func(t *testing.T) {
+		w := doRequest("GET", "/runs/"+run.ID.String()+"/comments", token, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Comments []service.Comment `json:"comments"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Comments, 1)
+		assert.Equal(t, spike.ID, response.Comments[0].ID)
+		require.Len(t, response.Comments[0].Replies, 1)
+		assert.Equal(t, reply.ID, response.Comments[0].Replies[0].ID)
+	})
+
+	t.Run("repository comments", func(t *testing.T) {
+		otherRun := createTestRun(t, database, user.ID, repo.ID)
+		comment(otherRun, token, map[string]interface{}{"body": "Dependency cache was cold"})
+
+		w := doRequest("GET", "/repos/"+repo.ID.String()+"/comments", token, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Comments []service.Comment `json:"comments"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Comments, 2)
+		for _, comment := range response.Comments {
+			assert.False(t, comment.RunCreatedAt.IsZero())
+		}
+	})
+
+	t.Run("invalid comments", func(t *testing.T) {
+		path := "/runs/" + run.ID.String() + "/comments"
+		w := doRequest("POST", path, token, map[string]interface{}{"body": "   "})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "VALIDATION_FAILED")
+
+		w = doRequest("POST", path, token, map[string]interface{}{"body": strings.Repeat("a", service.MaxCommentLength+1)})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		// Replies cannot be replied to
+		w = doRequest("POST", path, token, map[string]interface{}{"body": "Nested", "parent_id": reply.ID})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "INVALID_COMMENT_PARENT")
+
+		w = doRequest("POST", "/runs/"+uuid.New().String()+"/comments", token, map[string]interface{}{"body": "Missing"})
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		path := "/runs/" + run.ID.String() + "/comments/"
+		w := doRequest("DELETE", path+"not-a-uuid", token, nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "INVALID_COMMENT_ID")
+
+		// Only the author or the repository owner may delete a comment
+		w = doRequest("DELETE", path+spike.ID.String(), otherToken, nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+
+		w = doRequest("DELETE", path+spike.ID.String(), token, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		// Replies are deleted with their comment
+		var remaining int64
+		require.NoError(t, database.Model(&db.RunComment{}).Where("run_id = ?", run.ID).Count(&remaining).Error)
+		assert.Zero(t, remaining)
+
+		w = doRequest("DELETE", path+spike.ID.String(), token, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "COMMENT_NOT_FOUND")
+	})
+}
+
+func TestSavedViews(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+	repo := createTestRepository(t, database, user.ID)
+	other := &db.User{GitHubID: 54321, GitHubUsername: "otheruser"}
+	require.NoError(t, database.Create(other).Error)
+	otherToken := generateTestJWT(t, server, other.ID, other.GitHubUsername)
+
+	doRequest := func(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := doRequest("POST", "/saved-views", token, map[string]interface{}{
+		"name":          "Nightly builds on main",
+		"repository_id": repo.ID,
+		"filter":        "branch=main AND tag=nightly",
+		"sort":          "co2_kg",
+		"order":         "desc",
+		"group_by":      "workflow_name",
+		"range_days":    90,
+	})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var view db.SavedView
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &view))
+	assert.Equal(t, user.ID, view.UserID)
+	assert.Equal(t, &repo.ID, view.RepositoryID)
+	assert.Equal(t, "branch=main AND tag=nightly", *view.Filter)
+	assert.Equal(t, "desc", *view.Order)
+	assert.Equal(t, 90, *view.RangeDays)
+	viewPath := "/saved-views/" + view.ID.String()
+
+	t.Run("list and get", func(t *testing.T) {
+		w := doRequest("GET", "/saved-views", token, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response struct {
+			Views []db.SavedView `json:"views"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Views, 1)
+		assert.Equal(t, view.ID, response.Views[0].ID)
+
+		assert.Equal(t, http.StatusOK, doRequest("GET", viewPath, token, nil).Code)
+		// Views are private to their owner
+		assert.Equal(t, http.StatusNotFound, doRequest("GET", viewPath, otherToken, nil).Code)
+		assert.Equal(t, http.StatusBadRequest, doRequest("GET", "/saved-views/not-a-uuid", token, nil).Code)
+	})
+
+	t.Run("invalid views", func(t *testing.T) {
+		for name, body := range map[string]map[string]interface{}{
+			"filter":     {"name": "Bad", "filter": "co2_kg >"},
+			"sort":       {"name": "Bad", "sort": "name"},
+			"order":      {"name": "Bad", "order": "up"},
+			"group_by":   {"name": "Bad", "group_by": "metadata.bad-key"},
+			"range_days": {"name": "Bad", "range_days": 0},
+		} {
+			w := doRequest("POST", "/saved-views", token, body)
+			assert.Equal(t, http.StatusBadRequest, w.Code, name)
+			assert.Contains(t, w.Body.String(), "INVALID_SAVED_VIEW", name)
+		}
+
+		w := doRequest("POST", "/saved-views", token, map[string]interface{}{"name": "Nightly builds on main"})
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), "SAVED_VIEW_EXISTS")
+
+		// Other users cannot save views of repositories they cannot see
+		private := &db.Repository{OwnerID: user.ID, GitHubRepoID: 11111, Name: "secret", FullName: "testuser/secret", HTMLURL: "https://github.com/testuser/secret", Private: true}
+		require.NoError(t, database.Create(private).Error)
+		w = doRequest("POST", "/saved-views", otherToken, map[string]interface{}{"name": "Secret", "repository_id": private.ID})
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		// Names are unique per user only
+		w = doRequest("POST", "/saved-views", otherToken, map[string]interface{}{"name": "Nightly builds on main"})
+		assert.Equal(t, http.StatusCreated, w.Code)
+	})
+
+	t.Run("update and delete", func(t *testing.T) {
+		w := doRequest("PUT", viewPath, token, map[string]interface{}{"name": "All of main", "filter": "branch=main", "sort": ""})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var updated db.SavedView
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+		assert.Equal(t, "All of main", updated.Name)
+		assert.Nil(t, updated.RepositoryID)
+		assert.Nil(t, updated.Sort)
+		assert.Nil(t, updated.RangeDays)
+
+		assert.Equal(t, http.StatusNotFound, doRequest("DELETE", viewPath, otherToken, nil).Code)
+		assert.Equal(t, http.StatusOK, doRequest("DELETE", viewPath, token, nil).Code)
+		assert.Equal(t, http.StatusNotFound, doRequest("GET", viewPath, token, nil).Code)
+	})
+}
+
+func TestUserPreferences(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+	repo := createTestRepository(t, database, user.ID)
+
+	sender := &recordingSender{}
+	server.mailer = mail.NewMailer(sender, "https://app.ecoci.dev", server.userService, server.statsService)
+
+	doRequest := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("defaults", func(t *testing.T) {
+		w := doRequest("GET", "/me/preferences", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var preferences service.Preferences
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &preferences))
+		assert.Equal(t, "UTC", preferences.Timezone)
+		assert.Equal(t, "en", preferences.Locale)
+		assert.Equal(t, 30, preferences.DefaultRangeDays)
+		assert.Equal(t, service.CanonicalDisplayUnits, preferences.DisplayUnits)
+		assert.True(t, preferences.Email.Reports)
+	})
+
+	t.Run("update", func(t *testing.T) {
+		w := doRequest("PATCH", "/me/preferences", map[string]interface{}{
+			"timezone":           "Pacific/Auckland",
+			"locale":             "de-DE",
+			"default_range_days": 90,
+			"display_units":      map[string]interface{}{"co2": "G", "energy": "wh"},
+			"email":              map[string]interface{}{"alerts": false},
+		})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var preferences service.Preferences
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &preferences))
+		assert.Equal(t, "Pacific/Auckland", preferences.Timezone)
+		assert.Equal(t, "de-DE", preferences.Locale)
+		assert.Equal(t, 90, preferences.DefaultRangeDays)
+		assert.Equal(t, service.DisplayUnits{CO2: "g", Energy: "Wh"}, preferences.DisplayUnits)
+		assert.False(t, preferences.Email.Alerts)
+		assert.True(t, preferences.Email.Reports)
+
+		// Omitted settings are unchanged, and the older endpoints see the same settings
+		w = doRequest("PATCH", "/me/preferences", map[string]interface{}{"locale": "en-NZ"})
+		require.Equal(t, http.StatusOK, w.Code)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &preferences))
+		assert.Equal(t, "Pacific/Auckland", preferences.Timezone)
+		assert.Equal(t, "en-NZ", preferences.Locale)
+
+		w = doRequest("GET", "/me/email-preferences", nil)
+		assert.Contains(t, w.Body.String(), `"alerts":false`)
+		w = doRequest("GET", "/me/display-units", nil)
+		assert.Contains(t, w.Body.String(), `"co2":"g"`)
+	})
+
+	t.Run("invalid preferences", func(t *testing.T) {
+		for name, body := range map[string]map[string]interface{}{
+			"timezone":           {"timezone": "Mars/Olympus_Mons"},
+			"local timezone":     {"timezone": "Local"},
+			"locale":             {"locale": "english please"},
+			"default_range_days": {"default_range_days": 400},
+			"display_units":      {"display_units": map[string]interface{}{"co2": "t"}},
+		} {
+			w := doRequest("PATCH", "/me/preferences", body)
+			assert.Equal(t, http.StatusBadRequest, w.Code, name)
+			assert.Contains(t, w.Body.String(), "INVALID_PREFERENCES", name)
+		}
+	})
+
+	t.Run("weekly report", func(t *testing.T) {
+		createTestRun(t, database, user.ID, repo.ID)
+		require.NoError(t, server.mailer.SendWeeklyReports(context.Background(), time.Now().UTC().AddDate(0, 0, 7)))
+		server.mailer.Wait()
+
+		messages := sender.take()
+		require.Len(t, messages, 1)
+		assert.Contains(t, messages[0].Text, "(Pacific/Auckland)")
+		assert.Contains(t, messages[0].Text, "300.0 g")
+		assert.Contains(t, messages[0].Text, "500.0 Wh")
+	})
+}
+
+func TestNotificationPreferences(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	org := &db.Organization{GitHubID: 777, GitHubLogin: "greenorg"}
+	require.NoError(t, database.Create(org).Error)
+	require.NoError(t, database.Create(&db.OrganizationMember{OrganizationID: org.ID, UserID: user.ID, Role: db.OrganizationRoleAdmin}).Error)
+	repo := createTestRepository(t, database, user.ID)
+	require.NoError(t, database.Model(repo).Update("organization_id", org.ID).Error)
+
+	sender := &recordingSender{}
+	server.mailer = mail.NewMailer(sender, "https://app.ecoci.dev", server.userService, server.statsService)
+
+	doRequest := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	setPreference := func(body map[string]interface{}) db.NotificationPreference {
+		w := doRequest("PUT", "/me/notification-preferences", body)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var preference db.NotificationPreference
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &preference))
+		return preference
+	}
+	resolve := func(query string) map[string]service.NotificationChannel {
+		w := doRequest("GET", "/me/notification-preferences/resolved?"+query, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var response struct {
+			Channels []service.NotificationChannel `json:"channels"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		channels := map[string]service.NotificationChannel{}
+		for _, channel := range response.Channels {
+			channels[channel.Event] = channel
+		}
+		return channels
+	}
+
+	t.Run("inheritance", func(t *testing.T) {
+		channels := resolve("repository_id=" + repo.ID.String())
+		assert.Len(t, channels, 4)
+		assert.Equal(t, service.NotificationChannel{Event: "regression.detected", Channel: "email", Scope: "default"}, channels["regression.detected"])
+
+		setPreference(map[string]interface{}{"event": "regression.detected", "channel": "none"})
+		assert.Equal(t, "user", resolve("repository_id=" + repo.ID.String())["regression.detected"].Scope)
+		assert.Equal(t, "none", resolve("")["regression.detected"].Channel)
+
+		setPreference(map[string]interface{}{"event": "regression.detected", "channel": "email", "organization_id": org.ID})
+		channel := resolve("repository_id=" + repo.ID.String())["regression.detected"]
+		assert.Equal(t, "email", channel.Channel)
+		assert.Equal(t, "organization", channel.Scope)
+
+		repoPreference := setPreference(map[string]interface{}{"event": "regression.detected", "channel": "none", "repository_id": repo.ID})
+		channel = resolve("repository_id=" + repo.ID.String())["regression.detected"]
+		assert.Equal(t, "none", channel.Channel)
+		assert.Equal(t, "repository", channel.Scope)
+		assert.Equal(t, "email", resolve("organization_id=" + org.ID.String())["regression.detected"].Channel)
+
+		// Setting the same event and scope again replaces the preference
+		replaced := setPreference(map[string]interface{}{"event": "regression.detected", "channel": "email", "repository_id": repo.ID})
+		assert.Equal(t, repoPreference.ID, replaced.ID)
+
+		w := doRequest("GET", "/me/notification-preferences", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var list struct {
+			Preferences []db.NotificationPreference `json:"preferences"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+		require.Len(t, list.Preferences, 3)
+		assert.Nil(t, list.Preferences[0].OrganizationID)
+
+		w = doRequest("DELETE", "/me/notification-preferences/"+replaced.ID.String(), nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "organization", resolve("repository_id=" + repo.ID.String())["regression.detected"].Scope)
+	})
+
+	t.Run("invalid preferences", func(t *testing.T) {
+		for name, body := range map[string]map[string]interface{}{
+			"event":                   {"event": "run.created", "channel": "email"},
+			"channel":                 {"event": "budget.exceeded", "channel": "pager"},
+			"two scopes":              {"event": "budget.exceeded", "channel": "email", "repository_id": repo.ID, "organization_id": org.ID},
+			"scoped weekly digest":    {"event": "weekly.digest", "channel": "none", "organization_id": org.ID},
+			"slack weekly digest":     {"event": "weekly.digest", "channel": "slack_dm"},
+			"repository announcement": {"event": "org.announcement", "channel": "none", "repository_id": repo.ID},
+			"no slack user id":        {"event": "budget.exceeded", "channel": "slack_dm"},
+		} {
+			w := doRequest("PUT", "/me/notification-preferences", body)
+			assert.Equal(t, http.StatusBadRequest, w.Code, name)
+			assert.Contains(t, w.Body.String(), "INVALID_NOTIFICATION_PREFERENCE", name)
+		}
+
+		otherOrg := &db.Organization{GitHubID: 778, GitHubLogin: "otherorg"}
+		require.NoError(t, database.Create(otherOrg).Error)
+		w := doRequest("PUT", "/me/notification-preferences", map[string]interface{}{"event": "budget.exceeded", "channel": "none", "organization_id": otherOrg.ID})
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("owner alerts", func(t *testing.T) {
+		budgetPreference := setPreference(map[string]interface{}{"event": "budget.exceeded", "channel": "none"})
+		_, err := server.budgetService.SetBudget(repo.ID, "month", 0.5)
+		require.NoError(t, err)
+		createTestRun(t, database, user.ID, repo.ID)
+		server.publishRunEvents(createTestRun(t, database, user.ID, repo.ID))
+		server.mailer.Wait()
+		assert.Empty(t, sender.take())
+
+		// Without a Slack bot in the organization, direct messages fall back to email
+		w := doRequest("PATCH", "/me/preferences", map[string]interface{}{"slack_user_id": "U024BE7LH"})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), `"slack_user_id":"U024BE7LH"`)
+		setPreference(map[string]interface{}{"event": "budget.exceeded", "channel": "slack_dm", "organization_id": org.ID})
+		_, err = server.budgetService.SetBudget(repo.ID, "month", 0.8)
+		require.NoError(t, err)
+		server.publishRunEvents(createTestRun(t, database, user.ID, repo.ID))
+		server.mailer.Wait()
+		messages := sender.take()
+		require.Len(t, messages, 1)
+		assert.Equal(t, "testuser/testrepo exceeded its monthly CO₂ budget", messages[0].Subject)
+
+		w = doRequest("DELETE", "/me/notification-preferences/"+budgetPreference.ID.String(), nil)
+		require.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("weekly digest", func(t *testing.T) {
+		setPreference(map[string]interface{}{"event": "weekly.digest", "channel": "none"})
+		require.NoError(t, server.mailer.SendWeeklyReports(context.Background(), time.Now().UTC().AddDate(0, 0, 7)))
+		server.mailer.Wait()
+		assert.Empty(t, sender.take())
+
+		setPreference(map[string]interface{}{"event": "weekly.digest", "channel": "email"})
+		require.NoError(t, server.mailer.SendWeeklyReports(context.Background(), time.Now().UTC().AddDate(0, 0, 7)))
+		server.mailer.Wait()
+		assert.Len(t, sender.take(), 1)
+	})
+
+	t.Run("announcements", func(t *testing.T) {
+		member := &db.User{GitHubID: 54321, GitHubUsername: "otheruser", GitHubEmail: stringPtr("other@example.com")}
+		require.NoError(t, database.Create(member).Error)
+		require.NoError(t, database.Create(&db.OrganizationMember{OrganizationID: org.ID, UserID: member.ID}).Error)
+		_, err := server.userService.SetNotificationPreference(member.ID, &service.NotificationPreferenceRequest{
+			Event:          service.NotificationOrgAnnouncement,
+			Channel:        service.NotificationChannelNone,
+			OrganizationID: &org.ID,
+		})
+		require.NoError(t, err)
+
+		w := doRequest("POST", "/orgs/greenorg/announcements", map[string]interface{}{
+			"title": "Runners move to eu-north-1",
+			"text":  "From Monday all runners run on hydro power.",
+		})
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), `"recipients":1`)
+		server.mailer.Wait()
+
+		messages := sender.take()
+		require.Len(t, messages, 1)
+		assert.Equal(t, "test@example.com", messages[0].To)
+		assert.Equal(t, "greenorg: Runners move to eu-north-1", messages[0].Subject)
+		assert.Contains(t, messages[0].Text, "testuser")
+
+		w = doRequest("POST", "/orgs/otherorg/announcements", map[string]interface{}{"title": "Hi", "text": "Hello"})
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		// Only admins announce to the whole organization
+		memberToken := generateTestJWT(t, server, member.ID, member.GitHubUsername)
+		payload, _ := json.Marshal(map[string]interface{}{"title": "Hi", "text": "Hello"})
+		w = httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/orgs/greenorg/announcements", bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: memberToken})
+		server.router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "NOT_ORGANIZATION_ADMIN")
+		server.mailer.Wait()
+		assert.Empty(t, sender.take())
+	})
+}
+
+func TestRefreshProfile(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	var authorizations []string
+	githubAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		if r.Header.Get("Authorization") != "Bearer gho_valid" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/user":
+			w.Write([]byte(`{"id": 12345, "login": "renameduser", "name": "Test User", "email": null, "avatar_url": "https://avatars.example/u/12345"}`))
+		case "/user/emails":
+			w.Write([]byte(`[{"email": "old@example.com", "primary": false}, {"email": "new@example.com", "primary": true}]`))
+		case "/repos/testuser/testrepo":
+			w.Write([]byte(`{"id": 67890, "name": "greenrepo", "full_name": "renameduser/greenrepo", "description": "Renamed", "private": true, "html_url": "https://github.com/renameduser/greenrepo", "language": "Go", "size": 2048}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer githubAPI.Close()
+	server.githubClient = github.NewClient(githubAPI.URL, "")
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+	repo := createTestRepository(t, database, user.ID)
+	goneRepo := &db.Repository{OwnerID: user.ID, GitHubRepoID: 67892, Name: "gone", FullName: "testuser/gone", HTMLURL: "https://github.com/testuser/gone"}
+	require.NoError(t, database.Create(goneRepo).Error)
+
+	refresh := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/me/refresh", nil)
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("without credentials", func(t *testing.T) {
+		w := refresh()
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), "GITHUB_CREDENTIALS_MISSING")
+		assert.Empty(t, authorizations)
+	})
+
+	t.Run("refresh", func(t *testing.T) {
+		require.NoError(t, server.userService.SaveGitHubCredential(user.ID, "gho_stale"))
+		require.NoError(t, server.userService.SaveGitHubCredential(user.ID, "gho_valid"))
+
+		w := refresh()
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var response struct {
+			User         db.User         `json:"user"`
+			Repositories []db.Repository `json:"repositories"`
+			Unavailable  []string        `json:"unavailable"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Equal(t, "renameduser", response.User.GitHubUsername)
+		assert.Equal(t, "Test User", *response.User.Name)
+		assert.Equal(t, "new@example.com", *response.User.GitHubEmail)
+		assert.Equal(t, "https://avatars.example/u/12345", *response.User.AvatarURL)
+		require.Len(t, response.Repositories, 1)
+		assert.Equal(t, []string{"testuser/gone"}, response.Unavailable)
+
+		updated, err := server.repoService.GetRepositoryByID(repo.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "renameduser/greenrepo", updated.FullName)
+		assert.True(t, updated.Private)
+		assert.Equal(t, "Go", *updated.Language)
+		assert.Equal(t, int64(2048), *updated.SizeKB)
+		for _, authorization := range authorizations {
+			assert.Equal(t, "Bearer gho_valid", authorization)
+		}
+	})
+
+	t.Run("revoked credentials", func(t *testing.T) {
+		require.NoError(t, server.userService.SaveGitHubCredential(user.ID, "gho_revoked"))
+		w := refresh()
+		assert.Equal(t, http.StatusConflict, w.Code)
+		assert.Contains(t, w.Body.String(), "GITHUB_CREDENTIALS_REVOKED")
+
+		_, err := server.userService.GetGitHubCredential(user.ID)
+		assert.ErrorIs(t, err, service.ErrGitHubCredentialMissing)
+	})
+}
+
+func TestUserStats(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+	repo := createTestRepository(t, database, user.ID)
+	privateRepo := &db.Repository{OwnerID: user.ID, GitHubRepoID: 67891, Name: "secret", FullName: "testuser/secret", HTMLURL: "https://github.com/testuser/secret", Private: true}
+	require.NoError(t, database.Create(privateRepo).Error)
+
+	createTestRun(t, database, user.ID, repo.ID)
+	old := createTestRun(t, database, user.ID, repo.ID)
+	require.NoError(t, database.Model(old).Update("created_at", time.Now().AddDate(0, 0, -60)).Error)
+	last := &db.Run{UserID: user.ID, RepositoryID: privateRepo.ID, EnergyKWh: 1.5, CO2Kg: 0.9, DurationS: 240}
+	require.NoError(t, database.Create(last).Error)
+
+	viewer := &db.User{GitHubID: 54321, GitHubUsername: "viewer"}
+	require.NoError(t, database.Create(viewer).Error)
+	viewerToken := generateTestJWT(t, server, viewer.ID, viewer.GitHubUsername)
+
+	getStats := func(path, token string) (*httptest.ResponseRecorder, service.UserStats) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+		server.router.ServeHTTP(w, req)
+		var response struct {
+			Stats service.UserStats `json:"stats"`
+		}
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		}
+		return w, response.Stats
+	}
+
+	t.Run("own stats", func(t *testing.T) {
+		w, stats := getStats("/me/stats", token)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, int64(2), stats.RunCount)
+		assert.Equal(t, int64(2), stats.RepositoryCount)
+		assert.InDelta(t, 1.2, stats.TotalCO2Kg, 1e-9)
+		assert.InDelta(t, 0.6, stats.AvgCO2Kg, 1e-9)
+		assert.InDelta(t, 2.0, stats.TotalEnergyKWh, 1e-9)
+		assert.InDelta(t, 180.0, stats.AvgDurationS, 1e-9)
+		require.NotNil(t, stats.LastRunID)
+		assert.Equal(t, last.ID, *stats.LastRunID)
+		assert.Contains(t, w.Body.String(), `"summary"`)
+	})
+
+	t.Run("period", func(t *testing.T) {
+		from := time.Now().AddDate(0, 0, -90).Format("2006-01-02")
+		w, stats := getStats("/me/stats?from="+from, token)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, int64(3), stats.RunCount)
+
+		to := time.Now().AddDate(0, 0, -30).Format("2006-01-02")
+		w, stats = getStats("/me/stats?from="+from+"&to="+to, token)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, int64(1), stats.RunCount)
+		assert.Equal(t, old.ID, *stats.LastRunID)
+	})
+
+	t.Run("other user hides private repositories", func(t *testing.T) {
+		visibility, shown := service.ProfileVisibilityPublic, true
+		_, err := server.userService.UpdatePreferences(user.ID, &service.PreferencesRequest{ProfileVisibility: &visibility, ProfileStats: &shown})
+		require.NoError(t, err)
+
+		w, stats := getStats("/users/"+user.ID.String()+"/stats", viewerToken)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, int64(1), stats.RunCount)
+		assert.Equal(t, int64(1), stats.RepositoryCount)
+		assert.InDelta(t, 0.3, stats.TotalCO2Kg, 1e-9)
+		assert.NotEqual(t, last.ID, *stats.LastRunID)
+	})
+
+	t.Run("by username", func(t *testing.T) {
+		w, stats := getStats("/users/testuser/stats", token)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Equal(t, int64(2), stats.RunCount)
+	})
+
+	t.Run("unknown user", func(t *testing.T) {
+		w, _ := getStats("/users/nobody/stats", token)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "USER_NOT_FOUND")
+	})
+}
+
+func TestUserProfiles(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+	repo := createTestRepository(t, database, user.ID)
+	require.NoError(t, database.Model(repo).Update("public_stats", true).Error)
+	privateRepo := &db.Repository{OwnerID: user.ID, GitHubRepoID: 67891, Name: "secret", FullName: "testuser/secret", HTMLURL: "https://github.com/testuser/secret", Private: true, PublicStats: true}
+	require.NoError(t, database.Create(privateRepo).Error)
+	createTestRun(t, database, user.ID, repo.ID)
+	createTestRun(t, database, user.ID, privateRepo.ID)
+
+	member := &db.User{GitHubID: 54321, GitHubUsername: "member"}
+	require.NoError(t, database.Create(member).Error)
+	memberToken := generateTestJWT(t, server, member.ID, member.GitHubUsername)
+	stranger := &db.User{GitHubID: 54322, GitHubUsername: "stranger"}
+	require.NoError(t, database.Create(stranger).Error)
+	strangerToken := generateTestJWT(t, server, stranger.ID, stranger.GitHubUsername)
+
+	org := &db.Organization{GitHubLogin: "greenorg", GitHubID: 999}
+	require.NoError(t, database.Create(org).Error)
+	for _, id := range []uuid.UUID{user.ID, member.ID} {
+		require.NoError(t, database.Create(&db.OrganizationMember{OrganizationID: org.ID, UserID: id}).Error)
+	}
+
+	get := func(path, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		if token != "" {
+			req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+		}
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	setProfile := func(visibility string, stats bool) {
+		_, err := server.userService.UpdatePreferences(user.ID, &service.PreferencesRequest{ProfileVisibility: &visibility, ProfileStats: &stats})
+		require.NoError(t, err)
+	}
+
+	t.Run("private by default", func(t *testing.T) {
+		for _, token := range []string{memberToken, strangerToken, ""} {
+			w := get("/users/testuser", token)
+			assert.Equal(t, http.StatusNotFound, w.Code)
+			assert.Contains(t, w.Body.String(), "USER_NOT_FOUND")
+		}
+		assert.Equal(t, http.StatusNotFound, get("/users/testuser/stats", memberToken).Code)
+
+		w := get("/users/testuser", token)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var profile service.Profile
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &profile))
+		assert.Equal(t, service.ProfileVisibilityPrivate, profile.Visibility)
+		require.NotNil(t, profile.Stats)
+		assert.Equal(t, int64(2), profile.Stats.RunCount)
+	})
+
+	t.Run("organization", func(t *testing.T) {
+		setProfile(service.ProfileVisibilityOrganization, false)
+
+		w := get("/users/testuser", memberToken)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var profile service.Profile
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &profile))
+		assert.Equal(t, user.ID, profile.ID)
+		assert.Nil(t, profile.Stats)
+		require.Len(t, profile.Badges, 1)
+		assert.Equal(t, "testuser/testrepo", profile.Badges[0].FullName)
+		assert.Equal(t, "https://badge.ecoci.dev/testuser/testrepo.svg", profile.Badges[0].ImageURL)
+
+		w = get("/users/testuser/stats", memberToken)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "PROFILE_STATS_PRIVATE")
+
+		assert.Equal(t, http.StatusNotFound, get("/users/testuser", strangerToken).Code)
+		assert.Equal(t, http.StatusNotFound, get("/users/testuser", "").Code)
+	})
+
+	t.Run("public with stats", func(t *testing.T) {
+		setProfile(service.ProfileVisibilityPublic, true)
+
+		w := get("/users/"+user.ID.String(), "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var profile service.Profile
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &profile))
+		require.NotNil(t, profile.Stats)
+		assert.Equal(t, int64(1), profile.Stats.RunCount)
+		assert.NotContains(t, w.Body.String(), "github_email")
+
+		w = get("/users/testuser/stats", strangerToken)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), `"run_count":1`)
+	})
+
+	t.Run("suspended users are hidden", func(t *testing.T) {
+		require.NoError(t, database.Model(user).Update("suspended_at", time.Now()).Error)
+		defer database.Model(user).Update("suspended_at", nil)
+
+		assert.Equal(t, http.StatusNotFound, get("/users/testuser", strangerToken).Code)
+	})
+
+	t.Run("invalid visibility", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PATCH", "/me/preferences", strings.NewReader(`{"profile_visibility": "friends"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+		server.router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "INVALID_PREFERENCES")
+	})
+}
+
+func TestAPITokens(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	call := func(method, path string, auth func(*http.Request), body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = "203.0.113.7:51234"
+		auth(req)
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	session := func(req *http.Request) {
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+	}
+	bearer := func(apiToken string) func(*http.Request) {
+		return func(req *http.Request) {
+			req.Header.Set("Authorization", "Bearer "+apiToken)
+		}
+	}
+	create := func(body string) service.CreatedAPIToken {
+		w := call("POST", "/me/api-tokens", session, body)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var created service.CreatedAPIToken
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		require.NotEmpty(t, created.Token)
+		return created
+	}
+	list := func() []db.APIToken {
+		w := call("GET", "/me/api-tokens", session, "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var response struct {
+			Tokens []db.APIToken `json:"tokens"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Tokens
+	}
+
+	t.Run("records last use", func(t *testing.T) {
+		expiresAt := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+		created := create(`{"name": "GitHub Actions", "expires_at": "` + expiresAt.Format(time.RFC3339) + `"}`)
+		assert.Equal(t, "GitHub Actions", created.Name)
+		require.NotNil(t, created.ExpiresAt)
+		assert.True(t, expiresAt.Equal(*created.ExpiresAt))
+		assert.Nil(t, created.LastUsedAt)
+
+		w := call("GET", "/repos", bearer(created.Token), "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		tokens := list()
+		require.Len(t, tokens, 1)
+		assert.Equal(t, created.ID, tokens[0].ID)
+		require.NotNil(t, tokens[0].LastUsedAt)
+		require.NotNil(t, tokens[0].LastUsedIP)
+		assert.Equal(t, "203.0.113.7", *tokens[0].LastUsedIP)
+		assert.NotContains(t, call("GET", "/me/api-tokens", session, "").Body.String(), created.Token)
+	})
+
+	t.Run("expires after a year without expiry", func(t *testing.T) {
+		created := create(`{"name": "Jenkins"}`)
+		require.NotNil(t, created.ExpiresAt)
+		assert.WithinDuration(t, time.Now().Add(service.MaxAPITokenLifetime), *created.ExpiresAt, time.Minute)
+		assert.Equal(t, http.StatusOK, call("GET", "/repos", bearer(created.Token), "").Code)
+
+		w := call("POST", "/me/api-tokens", session, `{"name": "Forever", "expires_at": "`+time.Now().Add(2*service.MaxAPITokenLifetime).Format(time.RFC3339)+`"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "INVALID_API_TOKEN")
+	})
+
+	t.Run("API tokens cannot create tokens", func(t *testing.T) {
+		created := create(`{"name": "CI"}`)
+		w := call("POST", "/me/api-tokens", bearer(created.Token), `{"name": "Escalated"}`)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), "SESSION_REQUIRED")
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		created := create(`{"name": "Old", "expires_at": "` + time.Now().Add(time.Hour).Format(time.RFC3339) + `"}`)
+		require.NoError(t, database.Model(&db.APIToken{}).Where("id = ?", created.ID).Update("expires_at", time.Now().Add(-time.Minute)).Error)
+
+		w := call("GET", "/repos", bearer(created.Token), "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "API_TOKEN_EXPIRED")
+
+		w = call("POST", "/me/api-tokens", session, `{"name": "Past", "expires_at": "2020-01-01T00:00:00Z"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Contains(t, w.Body.String(), "INVALID_API_TOKEN")
+	})
+
+	t.Run("delete revokes", func(t *testing.T) {
+		created := create(`{"name": "Leaked"}`)
+
+		other := &db.User{GitHubID: 54321, GitHubUsername: "other"}
+		require.NoError(t, database.Create(other).Error)
+		otherToken := generateTestJWT(t, server, other.ID, other.GitHubUsername)
+		w := call("DELETE", "/me/api-tokens/"+created.ID.String(), func(req *http.Request) {
+			req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: otherToken})
+		}, "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = call("DELETE", "/me/api-tokens/"+created.ID.String(), session, "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		w = call("GET", "/repos", bearer(created.Token), "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "API_TOKEN_REVOKED")
+		for _, listed := range list() {
+			assert.NotEqual(t, created.ID, listed.ID)
+		}
+	})
+
+	t.Run("revoked tokens are rejected on optional routes", func(t *testing.T) {
+		created := create(`{"name": "Optional"}`)
+		w := call("GET", "/users/"+user.GitHubUsername, bearer(created.Token), "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		require.Equal(t, http.StatusOK, call("DELETE", "/me/api-tokens/"+created.ID.String(), session, "").Code)
+		w = call("GET", "/users/"+user.GitHubUsername, bearer(created.Token), "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "API_TOKEN_REVOKED")
+
+		expired := create(`{"name": "Expired"}`)
+		require.NoError(t, database.Model(&db.APIToken{}).Where("id = ?", expired.ID).Update("expires_at", time.Now().Add(-time.Minute)).Error)
+		w = call("GET", "/users/"+user.GitHubUsername, bearer(expired.Token), "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "API_TOKEN_EXPIRED")
+	})
+}
+
+func TestSignedRuns(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	database := server.db
+	user := createTestUser(t, database)
+	repo := createTestRepository(t, database, user.ID)
+	token := generateTestJWT(t, server, user.ID, user.GitHubUsername)
+
+	call := func(method, path string, body []byte, headers map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+	body := []byte(`{"energy_kwh": 0.5, "co2_kg": 0.3, "duration_s": 120, "repository": {"name": "testrepo", "full_name": "testuser/testrepo", "html_url": "https://github.com/testuser/testrepo"}}`)
+	signed := func(secret string, sentAt time.Time, body []byte) map[string]string {
+		return map[string]string{
+			service.HeaderRunTimestamp: strconv.FormatInt(sentAt.Unix(), 10),
+			service.HeaderRunSignature: service.SignRun(secret, sentAt.Unix(), body),
+		}
+	}
+
+	// Repositories accept unsigned runs until they get a secret
+	w := call("POST", "/runs", body, nil)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	w = call("POST", "/repos/"+repo.ID.String()+"/run-signing-secret", nil, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var enabled struct {
+		Repository db.Repository `json:"repository"`
+		Secret     string        `json:"secret"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &enabled))
+	require.Len(t, enabled.Secret, 64)
+	assert.True(t, enabled.Repository.SignedRuns)
+
+	w = call("GET", "/repos", nil, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.NotContains(t, w.Body.String(), enabled.Secret)
+
+	t.Run("signed", func(t *testing.T) {
+		w := call("POST", "/runs", body, signed(enabled.Secret, time.Now(), body))
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	})
+
+	t.Run("unsigned", func(t *testing.T) {
+		w := call("POST", "/runs", body, nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "RUN_SIGNATURE_MISSING")
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		headers := signed(enabled.Secret, time.Now(), body)
+		tampered := bytes.Replace(body, []byte(`"co2_kg": 0.3`), []byte(`"co2_kg": 0.1`), 1)
+		w := call("POST", "/runs", tampered, headers)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "RUN_SIGNATURE_INVALID")
+
+		w = call("POST", "/runs", body, signed("wrong-secret", time.Now(), body))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "RUN_SIGNATURE_INVALID")
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		w := call("POST", "/runs", body, signed(enabled.Secret, time.Now().Add(-10*time.Minute), body))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "RUN_SIGNATURE_EXPIRED")
+	})
+
+	t.Run("imports rejected", func(t *testing.T) {
+		var before int64
+		require.NoError(t, database.Model(&db.Run{}).Count(&before).Error)
+
+		emissions := []byte(`timestamp,run_id,duration,emissions,energy_consumed
+2024-03-01T10:15:30,5b0fa12a-3dd7-45bb-9766-cc326314d9f1,120.5,0.0087,0.00162
+`)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/imports/codecarbon?repository=testuser/testrepo", bytes.NewReader(emissions))
+		req.Header.Set("Content-Type", "text/csv")
+		for name, value := range signed(enabled.Secret, time.Now(), emissions) {
+			req.Header.Set(name, value)
+		}
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: token})
+		server.router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusForbidden, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), "SIGNED_RUNS_REQUIRED")
+
+		var after int64
+		require.NoError(t, database.Model(&db.Run{}).Count(&after).Error)
+		assert.Equal(t, before, after)
+	})
+
+	t.Run("owner only", func(t *testing.T) {
+		other := &db.User{GitHubID: 54321, GitHubUsername: "other"}
+		require.NoError(t, database.Create(other).Error)
+		require.NoError(t, database.Create(&db.RepositoryCollaborator{RepositoryID: repo.ID, UserID: other.ID}).Error)
+		otherToken := generateTestJWT(t, server, other.ID, other.GitHubUsername)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("DELETE", "/repos/"+repo.ID.String()+"/run-signing-secret", nil)
+		req.AddCookie(&http.Cookie{Name: "ecoci_token", Value: otherToken})
+		server.router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("disable", func(t *testing.T) {
+		w := call("DELETE", "/repos/"+repo.ID.String()+"/run-signing-secret", nil, nil)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.Contains(t, w.Body.String(), `"signed_runs":false`)
+
+		w = call("POST", "/runs", body, nil)
+		assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	})
 }
 
 // Helper function to create string pointer
@@ -0,0 +1,242 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/tracing"
+	"github.com/ecoci/auth-api/internal/version"
+)
+
+// readinessTimeout bounds the dependency checks of a readiness probe
+const readinessTimeout = 2 * time.Second
+
+// Readiness check results
+const (
+	checkOK          = "ok"
+	checkDisabled    = "disabled"
+	checkError       = "error"
+	checkUnavailable = "unavailable"
+)
+
+// githubProbeClient checks that the GitHub API is reachable; requests are bounded by their context
+var githubProbeClient = &http.Client{Transport: tracing.Transport(nil)}
+
+// expectedMigrationVersion returns the version of the newest migration shipped with the
+// binary, or 0 when the migrations are not available and only a clean schema is required
+func expectedMigrationVersion() uint {
+	latest, err := db.LatestMigrationVersion(db.MigrationsDir)
+	if err != nil {
+		log.Printf("Warning: readiness probe will not check the migration version: %v", err)
+		return 0
+	}
+	return latest
+}
+
+// setupProbes registers the liveness and readiness probes. They are registered ahead of the
+// middleware so that rate limiting and request logging neither fail nor flood them.
+func (s *Server) setupProbes() {
+	s.router.GET("/healthz", s.handleLiveness)
+	s.router.GET("/readyz", s.handleReadiness)
+}
+
+// Liveness probe handler
+// @Summary Liveness probe
+// @Description Report that the process is up; no dependency is checked
+// @Tags health
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /healthz [get]
+func (s *Server) handleLiveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status":    "alive",
+		"timestamp": time.Now().UTC(),
+	})
+}
+
+// Readiness probe handler
+// @Summary Readiness probe
+// @Description Check that the database answers, all migrations are applied and the cache is reachable
+// @Tags health
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 503 {object} map[string]interface{}
+// @Router /readyz [get]
+func (s *Server) handleReadiness(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+
+	results := map[string]string{
+		"database":   s.checkDatabase(ctx),
+		"migrations": s.checkMigrations(ctx),
+		"cache":      s.checkCache(ctx),
+	}
+
+	// The probe is unauthenticated, so failures are only detailed in the log and in the
+	// verbose health of authenticated users
+	status, code := "ready", http.StatusOK
+	checks := gin.H{}
+	for name, result := range results {
+		if result != checkOK && result != checkDisabled {
+			log.Printf("Readiness check %s failed: %s", name, result)
+			status, code = "not_ready", http.StatusServiceUnavailable
+			result = checkUnavailable
+		}
+		checks[name] = result
+	}
+
+	c.JSON(code, gin.H{
+		"status":    status,
+		"checks":    checks,
+		"timestamp": time.Now().UTC(),
+	})
+}
+
+// checkDatabase pings the database
+func (s *Server) checkDatabase(ctx context.Context) string {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err.Error()
+	}
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return err.Error()
+	}
+	return checkOK
+}
+
+// checkMigrations verifies that the schema is at least at the newest migration and that no
+// migration failed halfway
+func (s *Server) checkMigrations(ctx context.Context) string {
+	version, dirty, err := db.MigrationVersion(s.db.WithContext(ctx))
+	if err != nil {
+		return err.Error()
+	}
+	if dirty {
+		return fmt.Sprintf("migration %d failed and must be fixed manually", version)
+	}
+	if version < s.migrationVersion {
+		return fmt.Sprintf("schema is at version %d, expected %d", version, s.migrationVersion)
+	}
+	return checkOK
+}
+
+// checkCache pings the Redis server behind the response cache and the per-user rate limits
+func (s *Server) checkCache(ctx context.Context) string {
+	if s.cache == nil && s.rateLimiter == nil {
+		return checkDisabled
+	}
+	if s.cache != nil {
+		if err := s.cache.Ping(ctx); err != nil {
+			return err.Error()
+		}
+	}
+	if s.rateLimiter != nil {
+		if err := s.rateLimiter.Ping(ctx); err != nil {
+			return err.Error()
+		}
+	}
+	return checkOK
+}
+
+// healthDetails reports the state of the dependencies of the API, the depth of its queues and
+// the build of the binary for GET /health?verbose=true. A failing dependency marks the API as
+// degraded rather than failing the request.
+func (s *Server) healthDetails(ctx context.Context) gin.H {
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	status := "healthy"
+	track := func(check gin.H) gin.H {
+		if check["status"] == checkError {
+			status = "degraded"
+		}
+		return check
+	}
+
+	checks := gin.H{
+		"database":   track(s.databaseHealth(ctx)),
+		"migrations": track(s.migrationHealth(ctx)),
+		"github":     track(s.githubHealth(ctx)),
+	}
+
+	webhookQueue := gin.H{"status": checkOK}
+	if depth, err := s.webhooks.QueueDepth(ctx); err != nil {
+		webhookQueue = gin.H{"status": checkError, "error": err.Error()}
+	} else {
+		webhookQueue["pending"] = depth
+	}
+
+	return gin.H{
+		"status":    status,
+		"timestamp": time.Now().UTC(),
+		"version":   version.Version,
+		"build":     version.Get(),
+		"checks":    checks,
+		"queues": gin.H{
+			"webhook_deliveries": track(webhookQueue),
+		},
+	}
+}
+
+// checkResult turns the result of a readiness check into its verbose health entry
+func checkResult(result string) gin.H {
+	if result == checkOK || result == checkDisabled {
+		return gin.H{"status": result}
+	}
+	return gin.H{"status": checkError, "error": result}
+}
+
+// latencyMS converts a duration to fractional milliseconds
+func latencyMS(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// databaseHealth pings the database and reports how long it took
+func (s *Server) databaseHealth(ctx context.Context) gin.H {
+	start := time.Now()
+	check := checkResult(s.checkDatabase(ctx))
+	check["latency_ms"] = latencyMS(time.Since(start))
+	return check
+}
+
+// migrationHealth reports the applied and expected migration versions
+func (s *Server) migrationHealth(ctx context.Context) gin.H {
+	check := checkResult(s.checkMigrations(ctx))
+	if applied, dirty, err := db.MigrationVersion(s.db.WithContext(ctx)); err == nil {
+		check["version"] = applied
+		check["dirty"] = dirty
+	}
+	if s.migrationVersion > 0 {
+		check["expected"] = s.migrationVersion
+	}
+	return check
+}
+
+// githubHealth checks that the GitHub API answers and reports how long it took
+func (s *Server) githubHealth(ctx context.Context) gin.H {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.cfg.GitHubAPIURL, nil)
+	if err != nil {
+		return gin.H{"status": checkError, "error": err.Error()}
+	}
+
+	start := time.Now()
+	resp, err := githubProbeClient.Do(req)
+	latency := latencyMS(time.Since(start))
+	if err != nil {
+		return gin.H{"status": checkError, "error": err.Error(), "latency_ms": latency}
+	}
+	resp.Body.Close()
+
+	check := gin.H{"status": checkOK, "http_status": resp.StatusCode, "latency_ms": latency}
+	if resp.StatusCode >= http.StatusInternalServerError {
+		check["status"] = checkError
+		check["error"] = fmt.Sprintf("GitHub API returned status %d", resp.StatusCode)
+	}
+	return check
+}
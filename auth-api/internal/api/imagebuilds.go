@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// Repository image builds handler
+// @Summary Get repository image builds
+// @Description Get the image-build runs of a repository over a time range, in total and bucketed by interval: the layers built and cached, the cache hit rate, image size, registry push bytes and CO2, with the CO2 per built layer and the CO2 the cached layers are estimated to have saved
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param interval query string false "Bucket size: day, week or month" default(week)
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days, 12 weeks or 12 months before to"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Success 200 {object} service.ImageBuildStats
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/image-builds [get]
+func (s *Server) handleRepositoryImageBuilds(c *gin.Context) {
+	repo, ok := s.requireVisibleRepository(c)
+	if !ok {
+		return
+	}
+
+	interval := c.DefaultQuery("interval", "week")
+	if !service.IsValidInterval(interval) {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_INTERVAL", "Invalid interval, must be one of day, week, month")
+		return
+	}
+	from, to, ok := parseTimeRange(c, func(to time.Time) time.Time {
+		return defaultTimeSeriesFrom(to, interval)
+	})
+	if !ok {
+		return
+	}
+	if service.CountBuckets(from, to, interval) > service.MaxTimeSeriesBuckets {
+		problem.Respond(c, http.StatusBadRequest, "TIME_RANGE_TOO_LARGE", "Time range too large for the requested interval")
+		return
+	}
+
+	stats, err := s.statsService.ImageBuildStats(service.RepositoryRuns(repo.ID), from, to, interval)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "STATS_FETCH_FAILED", "Failed to fetch image builds")
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
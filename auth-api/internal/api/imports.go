@@ -0,0 +1,211 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/cache"
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/importer"
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// importFile returns the uploaded file of an import: the "file" field of a multipart form, or
+// the request body
+func importFile(c *gin.Context) (io.ReadCloser, error) {
+	if c.ContentType() == "multipart/form-data" {
+		header, err := c.FormFile("file")
+		if err != nil {
+			return nil, err
+		}
+		return header.Open()
+	}
+	return c.Request.Body, nil
+}
+
+// importRuns imports the runs converted from the uploaded file and responds with the result
+func (s *Server) importRuns(c *gin.Context, source string, convert func(io.Reader) ([]service.ImportedRun, error)) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		problem.Respond(c, http.StatusUnauthorized, "MISSING_USER_ID", "User ID not found in context")
+		return
+	}
+
+	file, err := importFile(c)
+	if err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_IMPORT_FILE", "Invalid import file", err.Error())
+		return
+	}
+	defer file.Close()
+
+	runs, err := convert(file)
+	var lineErrors importer.Errors
+	if errors.As(err, &lineErrors) {
+		problem.Write(c, problem.New(http.StatusUnprocessableEntity, "INVALID_IMPORT_FILE", "Invalid import file").
+			WithDetail("Nothing was imported; fix the listed lines and import the file again").
+			With("errors", lineErrors))
+		return
+	}
+	if err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_IMPORT_FILE", "Invalid import file", err.Error())
+		return
+	}
+
+	ctx := c.Request.Context()
+	result, err := s.runService.WithContext(ctx).ImportRuns(userID.(uuid.UUID), source, runs, s.repoService.WithContext(ctx), s.quotaService.WithContext(ctx))
+	if s.respondQuotaExceeded(c, err) {
+		return
+	}
+	var signedErr *service.SignedRunsError
+	if errors.As(err, &signedErr) {
+		problem.RespondDetail(c, http.StatusForbidden, "SIGNED_RUNS_REQUIRED", "Repository requires signed runs",
+			"Nothing was imported; runs for "+signedErr.Repository+" must be submitted signed to POST /runs")
+		return
+	}
+	if err != nil {
+		problem.RespondDetail(c, http.StatusInternalServerError, "IMPORT_FAILED", "Failed to import runs", err.Error())
+		return
+	}
+
+	if len(result.Targets) > 0 {
+		scopes := []string{cache.UserScope(userID.(uuid.UUID).String())}
+		for _, repo := range result.Targets {
+			scopes = append(scopes, cache.RepositoryScope(repo.ID.String()))
+		}
+		s.invalidateCaches(ctx, map[string][]string{
+			cache.GroupRepositories: {cache.ScopeAll},
+			cache.GroupLeaderboard:  {cache.ScopeAll},
+			cache.GroupStats:        scopes,
+		})
+	}
+	for _, repo := range result.Targets {
+		s.recordAudit(c, auditRepository("runs.import", repo, db.JSONB{
+			"source":   source,
+			"imported": result.Imported,
+			"skipped":  result.Skipped,
+		}))
+	}
+
+	c.JSON(http.StatusCreated, result)
+}
+
+// Import codecarbon handler
+// @Summary Import codecarbon measurements
+// @Description Convert the rows of a codecarbon emissions.csv into runs created at their timestamps. Every row becomes a run of the repository given, or of the repository named by its project_name. Rows already imported into the repository (by run_id) are skipped. The file is the request body or the file field of a multipart form; nothing is imported if any row is invalid. Repositories that require signed runs reject imports. The body may be gzip or deflate encoded and is limited to MAX_INGEST_BODY_BYTES.
+// @Tags runs
+// @Security CookieAuth
+// @Security BearerAuth
+// @Accept text/csv
+// @Accept multipart/form-data
+// @Produce json
+// @Param Content-Encoding header string false "gzip or deflate"
+// @Param repository query string false "Full name of the repository of every row, such as octocat/hello-world"
+// @Success 201 {object} service.ImportResult
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 402 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 413 {object} problem.Problem
+// @Failure 415 {object} problem.Problem
+// @Failure 422 {object} problem.Problem
+// @Failure 429 {object} problem.Problem
+// @Router /imports/codecarbon [post]
+func (s *Server) handleImportCodecarbon(c *gin.Context) {
+	repo := c.Query("repository")
+	s.importRuns(c, importer.SourceCodecarbon, func(file io.Reader) ([]service.ImportedRun, error) {
+		return importer.Codecarbon(file, repo)
+	})
+}
+
+// Import Cloud Carbon Footprint handler
+// @Summary Import Cloud Carbon Footprint estimates
+// @Description Convert the per-account, per-service and per-region estimates of Cloud Carbon Footprint into runs of a repository for cloud emissions, created at the start of their period, so CI emissions can be reported next to them. The file is the JSON of the /api/footprint endpoint or a CSV export, as the request body or the file field of a multipart form. The service of an estimate becomes the workflow of its run. Estimates already imported are skipped; nothing is imported if any estimate is invalid. Repositories that require signed runs reject imports. The body may be gzip or deflate encoded and is limited to MAX_INGEST_BODY_BYTES.
+// @Tags runs
+// @Security CookieAuth
+// @Security BearerAuth
+// @Accept json
+// @Accept text/csv
+// @Accept multipart/form-data
+// @Produce json
+// @Param Content-Encoding header string false "gzip or deflate"
+// @Param repository query string false "Full name of the repository of the estimates (default <username>/cloud)"
+// @Success 201 {object} service.ImportResult
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 402 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 413 {object} problem.Problem
+// @Failure 415 {object} problem.Problem
+// @Failure 422 {object} problem.Problem
+// @Failure 429 {object} problem.Problem
+// @Router /imports/cloud-carbon-footprint [post]
+func (s *Server) handleImportCloudCarbonFootprint(c *gin.Context) {
+	repo := c.Query("repository")
+	if repo == "" {
+		repo = c.GetString("github_username") + "/" + importer.CloudRepository
+	}
+	s.importRuns(c, importer.SourceCloudCarbonFootprint, func(file io.Reader) ([]service.ImportedRun, error) {
+		return importer.CloudCarbonFootprint(file, repo)
+	})
+}
+
+// Import Green Metrics Tool handler
+// @Summary Import Green Metrics Tool measurements
+// @Description Convert Green Metrics Tool measurement runs, each the run of its /v1/run endpoint with the rows of its phase_stats table, into runs created when they were measured. The runtime phase becomes the run and the flows of the usage scenario its steps metadata, with the energy, CO2 and duration of each. The Green Metrics Tool ID is kept as gmt_run_id; runs already imported are skipped. Runs belong to the repository given, or to the GitHub repository of their uri. The file is the request body or the file field of a multipart form; nothing is imported if any run is invalid. Repositories that require signed runs reject imports. The body may be gzip or deflate encoded and is limited to MAX_INGEST_BODY_BYTES.
+// @Tags runs
+// @Security CookieAuth
+// @Security BearerAuth
+// @Accept json
+// @Accept multipart/form-data
+// @Produce json
+// @Param Content-Encoding header string false "gzip or deflate"
+// @Param repository query string false "Full name of the repository of every run, such as octocat/hello-world"
+// @Success 201 {object} service.ImportResult
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 402 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 413 {object} problem.Problem
+// @Failure 415 {object} problem.Problem
+// @Failure 422 {object} problem.Problem
+// @Failure 429 {object} problem.Problem
+// @Router /imports/green-metrics-tool [post]
+func (s *Server) handleImportGreenMetricsTool(c *gin.Context) {
+	repo := c.Query("repository")
+	s.importRuns(c, importer.SourceGreenMetricsTool, func(file io.Reader) ([]service.ImportedRun, error) {
+		return importer.GreenMetricsTool(file, repo)
+	})
+}
+
+// Import EcoCI manifest handler
+// @Summary Import an EcoCI carbon history
+// @Description Import the runs of a carbon history manifest exported by an EcoCI instance with GET /repos/{repo_id}/export.json, keeping their measurements, metadata and creation times. Runs belong to the repository given, or to the repository of the manifest. Runs already imported (by their ID in the exporting instance) are skipped, so an import can be repeated. Manifests of newer format versions than this instance reads are rejected. The file is the request body or the file field of a multipart form; nothing is imported if any run is invalid. Repositories that require signed runs reject imports. The body may be gzip or deflate encoded and is limited to MAX_INGEST_BODY_BYTES.
+// @Tags runs
+// @Security CookieAuth
+// @Security BearerAuth
+// @Accept json
+// @Accept multipart/form-data
+// @Produce json
+// @Param Content-Encoding header string false "gzip or deflate"
+// @Param repository query string false "Full name of the repository to import into, such as octocat/hello-world"
+// @Success 201 {object} service.ImportResult
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 402 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 413 {object} problem.Problem
+// @Failure 415 {object} problem.Problem
+// @Failure 422 {object} problem.Problem
+// @Failure 429 {object} problem.Problem
+// @Router /imports/ecoci [post]
+func (s *Server) handleImportEcoCI(c *gin.Context) {
+	repo := c.Query("repository")
+	s.importRuns(c, importer.SourceEcoCI, func(file io.Reader) ([]service.ImportedRun, error) {
+		return importer.Manifest(file, repo)
+	})
+}
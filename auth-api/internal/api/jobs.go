@@ -0,0 +1,385 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ecoci/auth-api/internal/alerts"
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/jobs"
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+	"github.com/ecoci/auth-api/internal/webhook"
+)
+
+// jobRunHistoryLimit is how many recent runs are returned with a job
+const jobRunHistoryLimit = 20
+
+// jobRunRetention is how long the run history of jobs is kept
+const jobRunRetention = 14 * 24 * time.Hour
+
+// registerJobs registers the background jobs of the API with the scheduler
+func (s *Server) registerJobs() error {
+	definitions := []jobs.Definition{
+		{
+			Name:        "rollup-backfill",
+			Description: "Rebuild the daily rollups of repositories whose rollups do not match their runs",
+			Schedule:    "0 3 * * *",
+			Run: func(ctx context.Context, now time.Time) (string, error) {
+				rebuilt, err := s.repoService.BackfillRollups(ctx)
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("rebuilt %d repositories", rebuilt), nil
+			},
+		},
+		{
+			Name:        "webhook-deliveries",
+			Description: "Deliver queued webhook events and retry failed deliveries",
+			Schedule:    fmt.Sprintf("@every %s", webhook.PollInterval),
+			Timeout:     time.Minute,
+			Run: func(ctx context.Context, now time.Time) (string, error) {
+				delivered, err := s.webhooks.DeliverDue(ctx)
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("attempted %d deliveries", delivered), nil
+			},
+		},
+		{
+			Name:        "alert-evaluation",
+			Description: "Evaluate the threshold alert rules and deliver triggered alerts",
+			Schedule:    fmt.Sprintf("@every %s", alerts.EvaluationInterval),
+			Run: func(ctx context.Context, now time.Time) (string, error) {
+				evaluated, err := s.alerts.EvaluateAll(ctx, now)
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("evaluated %d rules", evaluated), nil
+			},
+		},
+		{
+			Name:        "weekly-summaries",
+			Description: "Post the weekly summaries of repositories to their chat notification routes",
+			Schedule:    "0 9 * * 1",
+			Run: func(ctx context.Context, now time.Time) (string, error) {
+				return "", s.notifier.SendWeeklySummaries(ctx, now)
+			},
+		},
+		{
+			Name:        "weekly-reports",
+			Description: "Email the weekly reports to subscribed users",
+			Schedule:    "0 9 * * 1",
+			Run: func(ctx context.Context, now time.Time) (string, error) {
+				return "", s.mailer.SendWeeklyReports(ctx, now)
+			},
+		},
+		{
+			Name:        "data-retention",
+			Description: "Purge the runs and rollups that expired under the retention policies of organizations",
+			Schedule:    "30 4 * * *",
+			Timeout:     time.Hour,
+			Run: func(ctx context.Context, now time.Time) (string, error) {
+				reports, err := s.retentionService.ApplyAll(ctx, now)
+				var runs, rollups int64
+				for i := range reports {
+					if reports[i].DryRun {
+						continue
+					}
+					runs += reports[i].RunsDeleted
+					rollups += reports[i].RollupsDeleted
+					for _, repoID := range reports[i].RepositoryIDs {
+						s.invalidateRepositoryCaches(ctx, repoID)
+					}
+				}
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("applied %d policies, deleted %d runs and %d rollups", len(reports), runs, rollups), nil
+			},
+		},
+		{
+			Name:        "emission-recalculation",
+			Description: "Recompute the current-methodology CO2 of runs with the emission factors in effect, after factor changes and for new runs",
+			Schedule:    "45 3 * * *",
+			Timeout:     time.Hour,
+			Run: func(ctx context.Context, now time.Time) (string, error) {
+				report, err := s.factorService.RecalculateRuns(ctx, now)
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("scanned %d runs, changed %d", report.RunsScanned, report.RunsChanged), nil
+			},
+		},
+		{
+			Name:        "storage-emissions",
+			Description: "Accrue the energy and CO2 of the artifact and cache storage of repositories for the previous days",
+			Schedule:    "30 0 * * *",
+			Run: func(ctx context.Context, now time.Time) (string, error) {
+				accrued, err := s.storageService.AccrueAll(ctx, now)
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("accrued %d repository storage days", accrued), nil
+			},
+		},
+		{
+			Name:        "language-sync",
+			Description: "Read the languages of repositories not synced within a week from GitHub",
+			Schedule:    "0 2 * * *",
+			Run: func(ctx context.Context, now time.Time) (string, error) {
+				synced, failed, err := s.languageService.SyncStale(ctx, now)
+				if err != nil {
+					return "", err
+				}
+				if failed > 0 && synced == 0 {
+					return "", fmt.Errorf("failed to sync the languages of %d repositories", failed)
+				}
+				return fmt.Sprintf("synced the languages of %d repositories, %d failed", synced, failed), nil
+			},
+		},
+		{
+			Name:        "purge-deleted",
+			Description: "Permanently delete the users, repositories and runs deleted longer ago than the restore window",
+			Schedule:    "15 4 * * *",
+			Run: func(ctx context.Context, now time.Time) (string, error) {
+				purged, err := s.retentionService.PurgeDeleted(ctx, now.Add(-s.cfg.RestoreWindow))
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("purged %d users, %d repositories and %d runs", purged.Users, purged.Repositories, purged.Runs), nil
+			},
+		},
+		{
+			Name:        "retention",
+			Description: "Delete old webhook deliveries and job run history",
+			Schedule:    "0 4 * * *",
+			Run: func(ctx context.Context, now time.Time) (string, error) {
+				deliveries, err := s.webhooks.PruneDeliveries(now.Add(-webhook.Retention))
+				if err != nil {
+					return "", err
+				}
+				runs, err := s.scheduler.PruneRuns(now.Add(-jobRunRetention))
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("deleted %d webhook deliveries and %d job runs", deliveries, runs), nil
+			},
+		},
+	}
+	if s.bigquery != nil {
+		definitions = append(definitions,
+			jobs.Definition{
+				Name:        "bigquery-runs",
+				Description: "Stream the runs created since the last export to BigQuery",
+				Schedule:    "@every 1m",
+				Timeout:     5 * time.Minute,
+				Run: func(ctx context.Context, now time.Time) (string, error) {
+					exported, err := s.bigquery.ExportRuns(ctx)
+					if err != nil {
+						return "", err
+					}
+					return fmt.Sprintf("exported %d runs", exported), nil
+				},
+			},
+			jobs.Definition{
+				Name:        "bigquery-rollups",
+				Description: "Stream the daily rollups of the previous days that changed since the last export to BigQuery",
+				Schedule:    "0 5 * * *",
+				Timeout:     time.Hour,
+				Run: func(ctx context.Context, now time.Time) (string, error) {
+					exported, err := s.bigquery.ExportRollups(ctx, now)
+					if err != nil {
+						return "", err
+					}
+					return fmt.Sprintf("exported %d rollups", exported), nil
+				},
+			},
+		)
+	}
+	if s.archive != nil {
+		definitions = append(definitions, jobs.Definition{
+			Name:        "parquet-archive",
+			Description: "Write the runs of the previous days that changed since the last archive to Parquet files in S3",
+			Schedule:    "30 5 * * *",
+			Timeout:     time.Hour,
+			Run: func(ctx context.Context, now time.Time) (string, error) {
+				result, err := s.archive.Export(ctx, now)
+				if err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("wrote %d files and removed %d", result.Written, result.Removed), nil
+			},
+		})
+	}
+
+	for _, definition := range definitions {
+		if err := s.scheduler.Register(definition); err != nil {
+			return fmt.Errorf("failed to register job %s: %w", definition.Name, err)
+		}
+	}
+	return nil
+}
+
+// UpdateJobRequest changes the schedule or enabled flag of a job
+type UpdateJobRequest struct {
+	// Schedule is a cron expression (UTC), a descriptor such as "@daily", or "@every <duration>"
+	Schedule *string `json:"schedule,omitempty" example:"0 3 * * *"`
+	Enabled  *bool   `json:"enabled,omitempty"`
+}
+
+// requireJob resolves the name path parameter to a registered job
+func (s *Server) requireJob(c *gin.Context) (*db.Job, bool) {
+	job, err := s.scheduler.Get(c.Param("name"))
+	if err != nil {
+		if errors.Is(err, jobs.ErrJobNotFound) {
+			problem.Respond(c, http.StatusNotFound, "JOB_NOT_FOUND", "Job not found")
+		} else {
+			problem.Respond(c, http.StatusInternalServerError, "JOB_FETCH_FAILED", "Failed to get job")
+		}
+		return nil, false
+	}
+	return job, true
+}
+
+// List jobs handler
+// @Summary List background jobs
+// @Description Get the background jobs with their schedules, next and last runs (admin only)
+// @Tags admin
+// @Security CookieAuth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Router /admin/jobs [get]
+func (s *Server) handleListJobs(c *gin.Context) {
+	list, err := s.scheduler.List()
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "JOBS_FETCH_FAILED", "Failed to list jobs")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"jobs": list,
+	})
+}
+
+// Get job handler
+// @Summary Get background job
+// @Description Get a background job with its recent runs, newest first (admin only)
+// @Tags admin
+// @Security CookieAuth
+// @Produce json
+// @Param name path string true "Job name"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /admin/jobs/{name} [get]
+func (s *Server) handleGetJob(c *gin.Context) {
+	job, ok := s.requireJob(c)
+	if !ok {
+		return
+	}
+
+	runs, err := s.scheduler.ListRuns(job.Name, jobRunHistoryLimit)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "JOB_RUNS_FETCH_FAILED", "Failed to list job runs")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"job":  job,
+		"runs": runs,
+	})
+}
+
+// Update job handler
+// @Summary Update background job
+// @Description Change the schedule of a background job or enable and disable it (admin only). A new schedule takes effect immediately.
+// @Tags admin
+// @Security CookieAuth
+// @Accept json
+// @Produce json
+// @Param name path string true "Job name"
+// @Param job body UpdateJobRequest true "Job settings"
+// @Success 200 {object} db.Job
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /admin/jobs/{name} [patch]
+func (s *Server) handleUpdateJob(c *gin.Context) {
+	job, ok := s.requireJob(c)
+	if !ok {
+		return
+	}
+
+	var req UpdateJobRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body", err.Error())
+		return
+	}
+	if req.Schedule != nil {
+		if _, err := jobs.ParseSchedule(*req.Schedule); err != nil {
+			problem.RespondDetail(c, http.StatusBadRequest, "INVALID_SCHEDULE", "Invalid schedule", err.Error())
+			return
+		}
+	}
+
+	updated, err := s.scheduler.Update(job.Name, req.Schedule, req.Enabled, time.Now().UTC())
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "JOB_UPDATE_FAILED", "Failed to update job")
+		return
+	}
+
+	s.recordAudit(c, &db.AuditEvent{
+		Action:       "job.update",
+		ResourceType: auditResourceJob,
+		ResourceID:   job.Name,
+		Changes: service.AuditDiff(
+			map[string]interface{}{"schedule": job.Schedule, "enabled": job.Enabled},
+			map[string]interface{}{"schedule": updated.Schedule, "enabled": updated.Enabled},
+		),
+	})
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// Run job handler
+// @Summary Run background job
+// @Description Start a run of a background job now, outside its schedule (admin only). The job runs in the background; poll the job for the outcome.
+// @Tags admin
+// @Security CookieAuth
+// @Produce json
+// @Param name path string true "Job name"
+// @Success 202 {object} db.JobRun
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Router /admin/jobs/{name}/run [post]
+func (s *Server) handleRunJob(c *gin.Context) {
+	job, ok := s.requireJob(c)
+	if !ok {
+		return
+	}
+
+	// The run outlives the request, so it is not bound to the request context
+	run, err := s.scheduler.Trigger(context.Background(), job.Name, time.Now().UTC())
+	if err != nil {
+		if errors.Is(err, jobs.ErrJobRunning) {
+			problem.Respond(c, http.StatusConflict, "JOB_ALREADY_RUNNING", "Job is already running")
+			return
+		}
+		problem.Respond(c, http.StatusInternalServerError, "JOB_START_FAILED", "Failed to start job")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, run)
+}
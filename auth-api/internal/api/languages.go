@@ -0,0 +1,141 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ecoci/auth-api/internal/github"
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// Get repository languages handler
+// @Summary Get repository languages
+// @Description Get the languages of a repository as detected by GitHub, with the bytes and share of its code in each, the most code first. The language-sync job reads them weekly.
+// @Tags repositories
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Success 200 {object} service.RepositoryLanguages
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/languages [get]
+func (s *Server) handleGetRepositoryLanguages(c *gin.Context) {
+	repo, ok := s.requireVisibleRepository(c)
+	if !ok {
+		return
+	}
+
+	languages, err := s.languageService.Languages(repo)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "LANGUAGES_FETCH_FAILED", "Failed to fetch languages")
+		return
+	}
+
+	c.JSON(http.StatusOK, languages)
+}
+
+// Sync repository languages handler
+// @Summary Sync repository languages
+// @Description Read the languages of a repository from GitHub now instead of waiting for the language-sync job. The language with the most code becomes the language of the repository (repository owner only).
+// @Tags repositories
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Success 200 {object} service.RepositoryLanguages
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 502 {object} problem.Problem
+// @Router /repos/{repo_id}/languages/sync [post]
+func (s *Server) handleSyncRepositoryLanguages(c *gin.Context) {
+	repo, ok := s.requireRepositoryOwner(c)
+	if !ok {
+		return
+	}
+
+	languages, err := s.languageService.Sync(c.Request.Context(), repo, time.Now())
+	if errors.Is(err, github.ErrNotFound) {
+		problem.Respond(c, http.StatusNotFound, "GITHUB_REPOSITORY_NOT_FOUND", "GitHub cannot show the repository; private repositories require GITHUB_SYNC_TOKEN")
+		return
+	}
+	if err != nil {
+		problem.Respond(c, http.StatusBadGateway, "LANGUAGE_SYNC_FAILED", "Failed to read the languages from GitHub")
+		return
+	}
+
+	s.invalidateRepositoryCaches(c.Request.Context(), repo.ID)
+	c.JSON(http.StatusOK, languages)
+}
+
+// respondLanguageStats aggregates the runs in scope over the requested range by the primary
+// language of their repository and writes the result
+func (s *Server) respondLanguageStats(c *gin.Context, scope service.RunScope) {
+	from, to, ok := parseTimeRange(c, func(to time.Time) time.Time {
+		return to.AddDate(0, 0, -30)
+	})
+	if !ok {
+		return
+	}
+
+	languages, err := s.statsService.LanguageStats(scope, from, to)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "STATS_FETCH_FAILED", "Failed to fetch language statistics")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":      from,
+		"to":        to,
+		"languages": languages,
+	})
+}
+
+// User language statistics handler
+// @Summary Get current user language statistics
+// @Description Get the runs of the current user over a time range by the primary language of their repository, with the repositories, runs, CO2, energy and duration of each, the most CO2 first
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Success 200 {object} languageStatsResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Router /me/languages [get]
+func (s *Server) handleUserLanguageStats(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	s.respondLanguageStats(c, service.UserRuns(userID))
+}
+
+// Organization language statistics handler
+// @Summary Get organization language statistics
+// @Description Get the runs of the repositories of an organization over a time range by their primary language, with the repositories, runs, CO2, energy and duration of each, the most CO2 first (members only)
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param org path string true "GitHub organization login"
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Success 200 {object} languageStatsResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /orgs/{org}/languages [get]
+func (s *Server) handleOrganizationLanguageStats(c *gin.Context) {
+	org, ok := s.requireOrganizationMember(c)
+	if !ok {
+		return
+	}
+
+	s.respondLanguageStats(c, service.OrganizationRuns(org.ID))
+}
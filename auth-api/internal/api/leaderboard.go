@@ -0,0 +1,80 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// Public leaderboard handler
+// @Summary Get public leaderboard
+// @Description Rank public repositories that opted into public stats by CO2 per run or by CO2 reduction versus the previous period
+// @Tags leaderboard
+// @Produce json
+// @Param rank_by query string false "Ranking (co2_per_run, reduction)" default(co2_per_run)
+// @Param period query string false "Period (week, month, quarter, year, all)" default(month)
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Router /leaderboard [get]
+func (s *Server) handleLeaderboard(c *gin.Context) {
+	q := service.LeaderboardQuery{
+		RankBy: c.DefaultQuery("rank_by", service.RankByCO2PerRun),
+		Period: c.DefaultQuery("period", "month"),
+		Now:    time.Now().UTC(),
+	}
+
+	if !service.IsValidRankBy(q.RankBy) {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_RANK_BY", "Invalid rank_by, must be one of co2_per_run, reduction")
+		return
+	}
+	if !service.IsValidLeaderboardPeriod(q.Period) {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_PERIOD", "Invalid period, must be one of week, month, quarter, year, all")
+		return
+	}
+	if q.RankBy == service.RankByReduction && q.Period == "all" {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_PERIOD", "Ranking by reduction requires a bounded period")
+		return
+	}
+
+	// Parse pagination parameters
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	q.Limit = limit
+	q.Offset = (page - 1) * limit
+
+	entries, total, err := s.statsService.Leaderboard(q)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "LEADERBOARD_FETCH_FAILED", "Failed to fetch leaderboard")
+		return
+	}
+
+	// Calculate pagination info
+	totalPages := (total + int64(limit) - 1) / int64(limit)
+
+	c.JSON(http.StatusOK, gin.H{
+		"rank_by": q.RankBy,
+		"period":  q.Period,
+		"entries": entries,
+		"pagination": gin.H{
+			"page":     page,
+			"limit":    limit,
+			"total":    total,
+			"pages":    totalPages,
+			"has_next": int64(page) < totalPages,
+			"has_prev": page > 1,
+		},
+	})
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// respondMeasurements aggregates the measurements of the runs in scope over the requested
+// range and writes the result
+func (s *Server) respondMeasurements(c *gin.Context, scope service.RunScope) {
+	from, to, ok := parseTimeRange(c, func(to time.Time) time.Time {
+		return to.AddDate(0, 0, -30)
+	})
+	if !ok {
+		return
+	}
+
+	measurements, err := s.statsService.MeasurementTotals(scope, from, to)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "STATS_FETCH_FAILED", "Failed to fetch measurements")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":         from,
+		"to":           to,
+		"measurements": measurements,
+	})
+}
+
+// Repository measurements handler
+// @Summary Get repository measurements
+// @Description Get the total and per-run average of each measurement type, such as gpu_energy or network_transfer, reported by the runs of a repository over a time range
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Success 200 {object} measurementsResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/measurements [get]
+func (s *Server) handleRepositoryMeasurements(c *gin.Context) {
+	repo, ok := s.requireVisibleRepository(c)
+	if !ok {
+		return
+	}
+
+	s.respondMeasurements(c, service.RepositoryRuns(repo.ID))
+}
+
+// User measurements handler
+// @Summary Get current user measurements
+// @Description Get the total and per-run average of each measurement type reported by the current user's runs over a time range
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Success 200 {object} measurementsResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Router /me/measurements [get]
+func (s *Server) handleUserMeasurements(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	s.respondMeasurements(c, service.UserRuns(userID))
+}
+
+// Organization measurements handler
+// @Summary Get organization measurements
+// @Description Get the total and per-run average of each measurement type reported by the runs of an organization over a time range (members only)
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param org path string true "GitHub organization login"
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Success 200 {object} measurementsResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /orgs/{org}/measurements [get]
+func (s *Server) handleOrganizationMeasurements(c *gin.Context) {
+	org, ok := s.requireOrganizationMember(c)
+	if !ok {
+		return
+	}
+
+	s.respondMeasurements(c, service.OrganizationRuns(org.ID))
+}
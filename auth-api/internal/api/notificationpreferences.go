@@ -0,0 +1,331 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/notify"
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// notifyUser delivers msg about event to user on the channel they chose for the repository
+// and organization it concerns, and reports whether it was delivered rather than muted.
+// Slack direct messages fall back to email when the user has no Slack member ID or the
+// organization no Slack bot; email is sent by the given mailer method.
+func (s *Server) notifyUser(user *db.User, event string, repoID, orgID *uuid.UUID, msg notify.Message, email func(*db.User, notify.Message)) bool {
+	channel, err := s.userService.ResolveNotificationChannel(user.ID, event, repoID, orgID)
+	if err != nil {
+		log.Printf("Failed to resolve %s notification channel of user %s: %v", event, user.ID, err)
+		return false
+	}
+
+	switch channel.Channel {
+	case service.NotificationChannelNone:
+		return false
+	case service.NotificationChannelSlackDM:
+		preferences, err := s.userService.GetPreferences(user)
+		if err == nil && preferences.SlackUserID != nil && orgID != nil {
+			if err := s.notifier.DirectMessage(*orgID, *preferences.SlackUserID, msg); err == nil {
+				return true
+			}
+		}
+	}
+	email(user, msg)
+	return true
+}
+
+// notifyRepositoryOwner delivers an alert about event of repo to its owner
+func (s *Server) notifyRepositoryOwner(repo *db.Repository, event string, msg notify.Message) {
+	owner, err := s.userService.GetUserByID(repo.OwnerID)
+	if err != nil {
+		log.Printf("Failed to notify owner of repository %s: %v", repo.FullName, err)
+		return
+	}
+	s.notifyUser(owner, event, &repo.ID, repo.OrganizationID, msg, s.mailer.SendAlert)
+}
+
+// requireNotificationPreference resolves the preference_id path parameter to a notification
+// preference of the current user; preferences of other users are reported as not found
+func (s *Server) requireNotificationPreference(c *gin.Context) (*db.NotificationPreference, bool) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return nil, false
+	}
+
+	preferenceID, err := uuid.Parse(c.Param("preference_id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_NOTIFICATION_PREFERENCE_ID", "Invalid notification preference ID")
+		return nil, false
+	}
+
+	preference, err := s.userService.GetNotificationPreference(preferenceID)
+	if err != nil || preference.UserID != userID {
+		problem.Respond(c, http.StatusNotFound, "NOTIFICATION_PREFERENCE_NOT_FOUND", "Notification preference not found")
+		return nil, false
+	}
+
+	return preference, true
+}
+
+// List notification preferences handler
+// @Summary List notification preferences
+// @Description Get the channels the current user chose for notification events, for all notifications, per organization and per repository
+// @Tags users
+// @Security CookieAuth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} problem.Problem
+// @Router /me/notification-preferences [get]
+func (s *Server) handleListNotificationPreferences(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	preferences, err := s.userService.ListNotificationPreferences(userID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "NOTIFICATION_PREFERENCES_FETCH_FAILED", "Failed to list notification preferences")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"preferences": preferences,
+	})
+}
+
+// Set notification preference handler
+// @Summary Set notification preference
+// @Description Choose whether an event (regression.detected, budget.exceeded, weekly.digest or org.announcement) is received by email, as a Slack direct message or not at all: for all notifications, for those of an organization (organization_id) or of a repository (repository_id). The most specific preference wins: repository over organization over all notifications; without any, events are emailed. Slack direct messages need slack_user_id in the preferences and are sent by the Slack bot of the organization, falling back to email without one. Replaces the preference of the same event and scope.
+// @Tags users
+// @Security CookieAuth
+// @Accept json
+// @Produce json
+// @Param preference body service.NotificationPreferenceRequest true "Notification preference"
+// @Success 200 {object} db.NotificationPreference
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /me/notification-preferences [put]
+func (s *Server) handleSetNotificationPreference(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req service.NotificationPreferenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body", err.Error())
+		return
+	}
+	if err := service.ValidateNotificationPreference(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_NOTIFICATION_PREFERENCE", "Invalid notification preference", err.Error())
+		return
+	}
+
+	if req.RepositoryID != nil {
+		visible, err := s.repoService.CanViewRepository(*req.RepositoryID, userID)
+		if err != nil || !visible {
+			problem.Respond(c, http.StatusNotFound, "REPOSITORY_NOT_FOUND", "Repository not found")
+			return
+		}
+	}
+	if req.OrganizationID != nil {
+		member, err := s.orgService.IsMember(*req.OrganizationID, userID)
+		if err != nil || !member {
+			problem.Respond(c, http.StatusNotFound, "ORGANIZATION_NOT_FOUND", "Organization not found")
+			return
+		}
+	}
+
+	preference, err := s.userService.SetNotificationPreference(userID, &req)
+	if errors.Is(err, service.ErrSlackUserIDRequired) {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_NOTIFICATION_PREFERENCE", "Invalid notification preference", err.Error())
+		return
+	}
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "NOTIFICATION_PREFERENCE_UPDATE_FAILED", "Failed to set notification preference")
+		return
+	}
+
+	s.recordAudit(c, auditUser("notification_preference.set", userID, service.AuditDiff(nil, notificationPreferenceAuditFields(preference))))
+
+	c.JSON(http.StatusOK, preference)
+}
+
+// Delete notification preference handler
+// @Summary Delete notification preference
+// @Description Remove a notification preference of the current user, so its event is received as chosen for the broader scopes again
+// @Tags users
+// @Security CookieAuth
+// @Produce json
+// @Param preference_id path string true "Notification preference UUID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /me/notification-preferences/{preference_id} [delete]
+func (s *Server) handleDeleteNotificationPreference(c *gin.Context) {
+	preference, ok := s.requireNotificationPreference(c)
+	if !ok {
+		return
+	}
+
+	if err := s.userService.DeleteNotificationPreference(preference.ID); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "NOTIFICATION_PREFERENCE_DELETION_FAILED", "Failed to delete notification preference")
+		return
+	}
+
+	s.recordAudit(c, auditUser("notification_preference.delete", preference.UserID, service.AuditDiff(notificationPreferenceAuditFields(preference), nil)))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Notification preference deleted",
+	})
+}
+
+// Resolve notification channels handler
+// @Summary Resolve notification channels
+// @Description Get the channel the current user receives each event on for a repository or organization, or for notifications of neither, with the scope of the preference it comes from (default when none applies)
+// @Tags users
+// @Security CookieAuth
+// @Produce json
+// @Param repository_id query string false "Repository UUID; the preferences of its organization apply too"
+// @Param organization_id query string false "Organization UUID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /me/notification-preferences/resolved [get]
+func (s *Server) handleResolveNotificationChannels(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var repoID, orgID *uuid.UUID
+	if value := c.Query("repository_id"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			problem.Respond(c, http.StatusBadRequest, "INVALID_REPOSITORY_ID", "Invalid repository ID")
+			return
+		}
+		visible, err := s.repoService.CanViewRepository(id, userID)
+		if err != nil || !visible {
+			problem.Respond(c, http.StatusNotFound, "REPOSITORY_NOT_FOUND", "Repository not found")
+			return
+		}
+		repo, err := s.repoService.GetRepositoryByID(id)
+		if err != nil {
+			problem.Respond(c, http.StatusInternalServerError, "REPOSITORY_FETCH_FAILED", "Failed to get repository")
+			return
+		}
+		repoID, orgID = &repo.ID, repo.OrganizationID
+	} else if value := c.Query("organization_id"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			problem.Respond(c, http.StatusBadRequest, "INVALID_ORGANIZATION_ID", "Invalid organization ID")
+			return
+		}
+		orgID = &id
+	}
+
+	channels := []service.NotificationChannel{}
+	for _, event := range service.PersonalNotificationEvents {
+		// The weekly digest is not about a repository or organization
+		eventRepoID, eventOrgID := repoID, orgID
+		if event == service.NotificationWeeklyDigest {
+			eventRepoID, eventOrgID = nil, nil
+		}
+		channel, err := s.userService.ResolveNotificationChannel(userID, event, eventRepoID, eventOrgID)
+		if err != nil {
+			problem.Respond(c, http.StatusInternalServerError, "NOTIFICATION_PREFERENCES_FETCH_FAILED", "Failed to resolve notification channels")
+			return
+		}
+		channels = append(channels, *channel)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"repository_id":   repoID,
+		"organization_id": orgID,
+		"channels":        channels,
+	})
+}
+
+// Create announcement handler
+// @Summary Post organization announcement
+// @Description Send an announcement to every member of an organization on the channel they chose for org.announcement (organization admins only)
+// @Tags notifications
+// @Security CookieAuth
+// @Accept json
+// @Produce json
+// @Param org path string true "Organization login"
+// @Param announcement body service.AnnouncementRequest true "Announcement"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /orgs/{org}/announcements [post]
+func (s *Server) handleCreateAnnouncement(c *gin.Context) {
+	org, ok := s.requireOrganizationAdmin(c)
+	if !ok {
+		return
+	}
+	userID, _ := currentUserID(c)
+
+	var req service.AnnouncementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body", err.Error())
+		return
+	}
+
+	author, err := s.userService.GetUserByID(userID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "USER_FETCH_FAILED", "Failed to get user information")
+		return
+	}
+	members, err := s.orgService.ListMembers(org.ID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "ORGANIZATION_MEMBERS_FETCH_FAILED", "Failed to list organization members")
+		return
+	}
+
+	msg := notify.AnnouncementMessage(org, author, req.Title, req.Text)
+	recipients := 0
+	for i := range members {
+		if s.notifyUser(&members[i], service.NotificationOrgAnnouncement, nil, &org.ID, msg, s.mailer.SendAnnouncement) {
+			recipients++
+		}
+	}
+
+	s.recordAudit(c, auditOrganization("announcement.create", org, service.AuditDiff(nil, map[string]interface{}{
+		"title": req.Title,
+		"text":  req.Text,
+	})))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Announcement sent",
+		"recipients": recipients,
+	})
+}
+
+// notificationPreferenceAuditFields returns the audited fields of a notification preference
+func notificationPreferenceAuditFields(preference *db.NotificationPreference) map[string]interface{} {
+	fields := map[string]interface{}{
+		"preference_id": preference.ID.String(),
+		"event":         preference.Event,
+		"channel":       preference.Channel,
+	}
+	if preference.RepositoryID != nil {
+		fields["repository_id"] = preference.RepositoryID.String()
+	}
+	if preference.OrganizationID != nil {
+		fields["organization_id"] = preference.OrganizationID.String()
+	}
+	return fields
+}
@@ -0,0 +1,272 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// requireNotificationProvider validates the provider path parameter.
+// On failure it writes a 400 response and returns false.
+func requireNotificationProvider(c *gin.Context) (string, bool) {
+	provider := c.Param("provider")
+	if !service.IsValidNotificationProvider(provider) {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_PROVIDER", "Invalid provider", "Must be one of "+strings.Join(service.NotificationProviders, ", "))
+		return "", false
+	}
+	return provider, true
+}
+
+// List organization integrations handler
+// @Summary List organization integrations
+// @Description Get the chat integrations of an organization (members only). Credentials are never returned.
+// @Tags notifications
+// @Security CookieAuth
+// @Produce json
+// @Param org path string true "GitHub organization login"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /orgs/{org}/integrations [get]
+func (s *Server) handleListIntegrations(c *gin.Context) {
+	org, ok := s.requireOrganizationMember(c)
+	if !ok {
+		return
+	}
+
+	integrations, err := s.notificationService.ListIntegrations(org.ID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "INTEGRATIONS_FETCH_FAILED", "Failed to list integrations")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"integrations": integrations,
+	})
+}
+
+// Set organization integration handler
+// @Summary Set organization integration
+// @Description Configure the chat integration of an organization (organization admins only). Slack accepts an incoming webhook URL or a bot token; Teams and Discord require a webhook URL.
+// @Tags notifications
+// @Security CookieAuth
+// @Accept json
+// @Produce json
+// @Param org path string true "GitHub organization login"
+// @Param provider path string true "Provider" Enums(slack,teams,discord)
+// @Param integration body service.IntegrationRequest true "Integration credentials"
+// @Success 200 {object} db.OrganizationIntegration
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /orgs/{org}/integrations/{provider} [put]
+func (s *Server) handleSetIntegration(c *gin.Context) {
+	org, ok := s.requireOrganizationAdmin(c)
+	if !ok {
+		return
+	}
+	provider, ok := requireNotificationProvider(c)
+	if !ok {
+		return
+	}
+
+	var req service.IntegrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body", err.Error())
+		return
+	}
+	if provider == service.NotificationProviderSlack {
+		if req.WebhookURL == nil && req.BotToken == nil {
+			problem.Respond(c, http.StatusBadRequest, "MISSING_CREDENTIALS", "Either webhook_url or bot_token is required")
+			return
+		}
+	} else if req.WebhookURL == nil || req.BotToken != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "MISSING_CREDENTIALS", "Missing credentials", "A webhook_url and no bot_token is required for "+provider)
+		return
+	}
+
+	integration, err := s.notificationService.SetIntegration(org.ID, provider, &req)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "INTEGRATION_UPDATE_FAILED", "Failed to save integration")
+		return
+	}
+
+	// Credentials are secrets; only which kind was set is recorded
+	fields := map[string]interface{}{"provider": provider}
+	if req.WebhookURL != nil {
+		fields["credentials"] = "webhook_url"
+	} else {
+		fields["credentials"] = "bot_token"
+	}
+	if req.DefaultChannel != nil {
+		fields["default_channel"] = *req.DefaultChannel
+	}
+	s.recordAudit(c, auditOrganization("integration.set", org, service.AuditDiff(nil, fields)))
+
+	c.JSON(http.StatusOK, integration)
+}
+
+// Delete organization integration handler
+// @Summary Delete organization integration
+// @Description Remove the chat integration of an organization (organization admins only)
+// @Tags notifications
+// @Security CookieAuth
+// @Produce json
+// @Param org path string true "GitHub organization login"
+// @Param provider path string true "Provider" Enums(slack,teams,discord)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /orgs/{org}/integrations/{provider} [delete]
+func (s *Server) handleDeleteIntegration(c *gin.Context) {
+	org, ok := s.requireOrganizationAdmin(c)
+	if !ok {
+		return
+	}
+	provider, ok := requireNotificationProvider(c)
+	if !ok {
+		return
+	}
+
+	if err := s.notificationService.DeleteIntegration(org.ID, provider); err != nil {
+		problem.Respond(c, http.StatusNotFound, "INTEGRATION_NOT_FOUND", "Integration not found")
+		return
+	}
+
+	s.recordAudit(c, auditOrganization("integration.delete", org, service.AuditDiff(map[string]interface{}{"provider": provider}, nil)))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Integration deleted",
+	})
+}
+
+// List repository notification routes handler
+// @Summary List repository notification routes
+// @Description Get which notifications of a repository are posted to which chat channels (repository owner only)
+// @Tags notifications
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/notifications [get]
+func (s *Server) handleListNotificationRoutes(c *gin.Context) {
+	repo, ok := s.requireRepositoryOwner(c)
+	if !ok {
+		return
+	}
+
+	routes, err := s.notificationService.ListRoutes(repo.ID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "NOTIFICATION_ROUTES_FETCH_FAILED", "Failed to list notification routes")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"routes": routes,
+	})
+}
+
+// Set repository notification route handler
+// @Summary Set repository notification route
+// @Description Post budget.exceeded, regression.detected and weekly.summary notifications of a repository through an integration of its organization, optionally to a specific channel (repository owner only)
+// @Tags notifications
+// @Security CookieAuth
+// @Accept json
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param provider path string true "Provider" Enums(slack,teams,discord)
+// @Param route body service.NotificationRouteRequest true "Events and channel"
+// @Success 200 {object} db.RepositoryNotificationRoute
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/notifications/{provider} [put]
+func (s *Server) handleSetNotificationRoute(c *gin.Context) {
+	repo, ok := s.requireRepositoryOwner(c)
+	if !ok {
+		return
+	}
+	provider, ok := requireNotificationProvider(c)
+	if !ok {
+		return
+	}
+
+	if repo.OrganizationID == nil {
+		problem.Respond(c, http.StatusBadRequest, "REPOSITORY_NOT_IN_ORGANIZATION", "Notifications are posted through organization integrations; the repository does not belong to an organization")
+		return
+	}
+
+	var req service.NotificationRouteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body", err.Error())
+		return
+	}
+	for _, event := range req.Events {
+		if !service.IsValidNotificationEvent(event) {
+			problem.RespondDetail(c, http.StatusBadRequest, "INVALID_NOTIFICATION_EVENT", "Invalid event", "Must be one of "+strings.Join(service.NotificationEvents, ", "))
+			return
+		}
+	}
+
+	route, err := s.notificationService.SetRoute(repo.ID, provider, &req)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "NOTIFICATION_ROUTE_UPDATE_FAILED", "Failed to save notification route")
+		return
+	}
+
+	fields := map[string]interface{}{"provider": provider, "events": req.Events}
+	if req.Channel != nil {
+		fields["channel"] = *req.Channel
+	}
+	s.recordAudit(c, auditRepository("notification_route.set", repo, service.AuditDiff(nil, fields)))
+
+	c.JSON(http.StatusOK, route)
+}
+
+// Delete repository notification route handler
+// @Summary Delete repository notification route
+// @Description Stop posting notifications of a repository through an integration (repository owner only)
+// @Tags notifications
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param provider path string true "Provider" Enums(slack,teams,discord)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/notifications/{provider} [delete]
+func (s *Server) handleDeleteNotificationRoute(c *gin.Context) {
+	repo, ok := s.requireRepositoryOwner(c)
+	if !ok {
+		return
+	}
+	provider, ok := requireNotificationProvider(c)
+	if !ok {
+		return
+	}
+
+	if err := s.notificationService.DeleteRoute(repo.ID, provider); err != nil {
+		problem.Respond(c, http.StatusNotFound, "NOTIFICATION_ROUTE_NOT_FOUND", "Notification route not found")
+		return
+	}
+
+	s.recordAudit(c, auditRepository("notification_route.delete", repo, service.AuditDiff(map[string]interface{}{"provider": provider}, nil)))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Notification route deleted",
+	})
+}
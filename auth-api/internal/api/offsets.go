@@ -0,0 +1,152 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// List carbon offsets handler
+// @Summary List carbon offsets
+// @Description Get the carbon offsets and renewable energy purchases of an organization, most recent period first (members only)
+// @Tags offsets
+// @Security CookieAuth
+// @Produce json
+// @Param org path string true "GitHub organization login"
+// @Success 200 {object} carbonOffsetsResponse
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /orgs/{org}/offsets [get]
+func (s *Server) handleListCarbonOffsets(c *gin.Context) {
+	org, ok := s.requireOrganizationMember(c)
+	if !ok {
+		return
+	}
+
+	offsets, err := s.offsetService.ListOffsets(org.ID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "CARBON_OFFSETS_FETCH_FAILED", "Failed to list carbon offsets")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"offsets": offsets,
+	})
+}
+
+// Create carbon offset handler
+// @Summary Record a carbon offset
+// @Description Record carbon offsets (kind offset, with co2_kg) or renewable energy (kind renewable, with energy_kwh) an organization purchased for a period (organization admins only). Organization statistics report the market-based and net emissions after them.
+// @Tags offsets
+// @Security CookieAuth
+// @Accept json
+// @Produce json
+// @Param org path string true "GitHub organization login"
+// @Param offset body service.CarbonOffsetRequest true "Carbon offset"
+// @Success 201 {object} db.CarbonOffset
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /orgs/{org}/offsets [post]
+func (s *Server) handleCreateCarbonOffset(c *gin.Context) {
+	org, ok := s.requireOrganizationAdmin(c)
+	if !ok {
+		return
+	}
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req service.CarbonOffsetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body", err.Error())
+		return
+	}
+	if err := service.ValidateCarbonOffset(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_CARBON_OFFSET", "Invalid carbon offset", err.Error())
+		return
+	}
+
+	offset, err := s.offsetService.CreateOffset(org.ID, userID, &req)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "CARBON_OFFSET_CREATION_FAILED", "Failed to record carbon offset")
+		return
+	}
+
+	s.recordAudit(c, auditOrganization("carbon_offset.create", org, service.AuditDiff(nil, carbonOffsetAuditFields(offset))))
+
+	c.JSON(http.StatusCreated, offset)
+}
+
+// Delete carbon offset handler
+// @Summary Delete a carbon offset
+// @Description Remove a carbon offset or renewable energy purchase of an organization (organization admins only)
+// @Tags offsets
+// @Security CookieAuth
+// @Produce json
+// @Param org path string true "GitHub organization login"
+// @Param offset_id path string true "Carbon offset UUID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /orgs/{org}/offsets/{offset_id} [delete]
+func (s *Server) handleDeleteCarbonOffset(c *gin.Context) {
+	org, ok := s.requireOrganizationAdmin(c)
+	if !ok {
+		return
+	}
+
+	offsetID, err := uuid.Parse(c.Param("offset_id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_CARBON_OFFSET_ID", "Invalid carbon offset ID")
+		return
+	}
+
+	offset, err := s.offsetService.GetOffset(org.ID, offsetID)
+	if err == nil {
+		err = s.offsetService.DeleteOffset(offset.ID)
+	}
+	if err != nil {
+		problem.Respond(c, http.StatusNotFound, "CARBON_OFFSET_NOT_FOUND", "Carbon offset not found")
+		return
+	}
+
+	s.recordAudit(c, auditOrganization("carbon_offset.delete", org, service.AuditDiff(carbonOffsetAuditFields(offset), nil)))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Carbon offset deleted",
+	})
+}
+
+// carbonOffsetAuditFields returns the audited fields of a carbon offset
+func carbonOffsetAuditFields(offset *db.CarbonOffset) map[string]interface{} {
+	fields := map[string]interface{}{
+		"id":              offset.ID.String(),
+		"kind":            offset.Kind,
+		"co2_kg":          nil,
+		"energy_kwh":      nil,
+		"vendor":          offset.Vendor,
+		"certificate_url": nil,
+		"period_start":    offset.PeriodStart.Format("2006-01-02"),
+		"period_end":      offset.PeriodEnd.Format("2006-01-02"),
+	}
+	if offset.CO2Kg != nil {
+		fields["co2_kg"] = *offset.CO2Kg
+	}
+	if offset.EnergyKWh != nil {
+		fields["energy_kwh"] = *offset.EnergyKWh
+	}
+	if offset.CertificateURL != nil {
+		fields["certificate_url"] = *offset.CertificateURL
+	}
+	return fields
+}
@@ -0,0 +1,2072 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/graphql-go/graphql"
+
+	"github.com/ecoci/auth-api/internal/carbon"
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/export"
+	"github.com/ecoci/auth-api/internal/flags"
+	"github.com/ecoci/auth-api/internal/openapi"
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+	"github.com/ecoci/auth-api/internal/version"
+)
+
+// Pagination describes the page of a paginated list
+type Pagination struct {
+	Page    int   `json:"page"`
+	Limit   int   `json:"limit"`
+	Total   int64 `json:"total"`
+	Pages   int64 `json:"pages"`
+	HasNext bool  `json:"has_next"`
+	HasPrev bool  `json:"has_prev"`
+}
+
+// Response bodies that handlers write as gin.H, typed for the OpenAPI document
+
+type messageResponse struct {
+	Message string `json:"message"`
+}
+
+type deletedResponse struct {
+	Message         string    `json:"message"`
+	RestorableUntil time.Time `json:"restorable_until"`
+}
+
+type healthCheck struct {
+	Status     string  `json:"status"`
+	Error      string  `json:"error,omitempty"`
+	LatencyMS  float64 `json:"latency_ms,omitempty"`
+	HTTPStatus int     `json:"http_status,omitempty"`
+	Pending    int64   `json:"pending,omitempty"`
+}
+
+type healthResponse struct {
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+	Version   string    `json:"version"`
+	// Only with verbose=true
+	Build  *version.Info          `json:"build,omitempty"`
+	Checks map[string]healthCheck `json:"checks,omitempty"`
+	Queues map[string]healthCheck `json:"queues,omitempty"`
+}
+
+type leaderboardResponse struct {
+	RankBy     string                     `json:"rank_by"`
+	Period     string                     `json:"period"`
+	Entries    []service.LeaderboardEntry `json:"entries"`
+	Pagination Pagination                 `json:"pagination"`
+}
+
+type repositoriesResponse struct {
+	Repositories []db.RepositoryStats `json:"repositories"`
+	Pagination   Pagination           `json:"pagination"`
+}
+
+type runsResponse struct {
+	Runs       []db.Run   `json:"runs"`
+	Pagination Pagination `json:"pagination"`
+}
+
+type workflowRunsResponse struct {
+	From         time.Time             `json:"from"`
+	To           time.Time             `json:"to"`
+	WorkflowRuns []service.WorkflowRun `json:"workflow_runs"`
+	Pagination   Pagination            `json:"pagination"`
+}
+
+type collaboratorsResponse struct {
+	Collaborators []db.RepositoryCollaborator `json:"collaborators"`
+}
+
+type timeSeriesResponse struct {
+	Metric     string                    `json:"metric"`
+	Interval   string                    `json:"interval"`
+	From       time.Time                 `json:"from"`
+	To         time.Time                 `json:"to"`
+	Points     []service.TimeSeriesPoint `json:"points"`
+	Comparison *service.PeriodComparison `json:"comparison,omitempty"`
+}
+
+type statsResponse struct {
+	Summary    *service.PeriodSummary    `json:"summary"`
+	Comparison *service.PeriodComparison `json:"comparison,omitempty"`
+}
+
+type userStatsResponse struct {
+	statsResponse
+	Stats *service.UserStats `json:"stats"`
+}
+
+type organizationStatsResponse struct {
+	statsResponse
+	Emissions *service.NetEmissions `json:"emissions"`
+}
+
+type repositoryStatsResponse struct {
+	statsResponse
+	Benchmark *service.Benchmark `json:"benchmark"`
+}
+
+type workflowStatsResponse struct {
+	From      time.Time               `json:"from"`
+	To        time.Time               `json:"to"`
+	Workflows []service.WorkflowStats `json:"workflows"`
+}
+
+type measurementsResponse struct {
+	From         time.Time                  `json:"from"`
+	To           time.Time                  `json:"to"`
+	Measurements []service.MeasurementTotal `json:"measurements"`
+}
+
+type gpuStatsResponse struct {
+	From   time.Time               `json:"from"`
+	To     time.Time               `json:"to"`
+	Models []service.GPUModelStats `json:"models"`
+}
+
+type environmentStatsResponse struct {
+	From         time.Time                  `json:"from"`
+	To           time.Time                  `json:"to"`
+	Environments []service.EnvironmentStats `json:"environments"`
+}
+
+type languageStatsResponse struct {
+	From      time.Time               `json:"from"`
+	To        time.Time               `json:"to"`
+	Languages []service.LanguageStats `json:"languages"`
+}
+
+type testSuitesResponse struct {
+	TestSuites []db.RunTestSuite `json:"test_suites"`
+}
+
+type testSuiteStatsResponse struct {
+	From       time.Time                `json:"from"`
+	To         time.Time                `json:"to"`
+	TestSuites []service.TestSuiteStats `json:"test_suites"`
+}
+
+type aggregateResponse struct {
+	GroupBy string                   `json:"group_by"`
+	Metric  string                   `json:"metric"`
+	From    time.Time                `json:"from"`
+	To      time.Time                `json:"to"`
+	Groups  []service.GroupAggregate `json:"groups"`
+}
+
+type histogramResponse struct {
+	Metric  string                    `json:"metric"`
+	From    time.Time                 `json:"from"`
+	To      time.Time                 `json:"to"`
+	Count   int64                     `json:"count"`
+	Min     float64                   `json:"min"`
+	Max     float64                   `json:"max"`
+	Buckets []service.HistogramBucket `json:"buckets"`
+}
+
+type carbonWindowsResponse struct {
+	Region   string         `json:"region"`
+	Provider string         `json:"provider"`
+	Duration string         `json:"duration"`
+	From     time.Time      `json:"from"`
+	Until    time.Time      `json:"until"`
+	Now      *carbon.Window `json:"now"`
+	Windows  []carbonWindow `json:"windows"`
+}
+
+type regionRecommendationResponse struct {
+	Provider    string                   `json:"provider"`
+	Optimize    string                   `json:"optimize"`
+	From        time.Time                `json:"from"`
+	Until       time.Time                `json:"until"`
+	Profile     service.RunProfile       `json:"profile"`
+	Recommended string                   `json:"recommended"`
+	Regions     []service.RegionEstimate `json:"regions"`
+}
+
+type commentsResponse struct {
+	Comments []service.Comment `json:"comments"`
+}
+
+type repositoryCommentsResponse struct {
+	From     time.Time         `json:"from"`
+	To       time.Time         `json:"to"`
+	Comments []service.Comment `json:"comments"`
+}
+
+type budgetsResponse struct {
+	Budgets []db.RepositoryBudget `json:"budgets"`
+}
+
+type commitsResponse struct {
+	From    time.Time             `json:"from"`
+	To      time.Time             `json:"to"`
+	Commits []service.CommitStats `json:"commits"`
+}
+
+type webhooksResponse struct {
+	Webhooks []db.Webhook `json:"webhooks"`
+}
+
+type webhookCreatedResponse struct {
+	Webhook *db.Webhook `json:"webhook"`
+	// Secret signs the deliveries and is only returned on creation
+	Secret string `json:"secret"`
+}
+
+type deliveriesResponse struct {
+	Deliveries []db.WebhookDelivery `json:"deliveries"`
+	Pagination Pagination           `json:"pagination"`
+}
+
+type redriveResponse struct {
+	Redriven int64 `json:"redriven"`
+}
+
+type integrationsResponse struct {
+	Integrations []db.OrganizationIntegration `json:"integrations"`
+}
+
+type notificationRoutesResponse struct {
+	Routes []db.RepositoryNotificationRoute `json:"routes"`
+}
+
+type userFlagsResponse struct {
+	Flags map[string]bool `json:"flags"`
+}
+
+type alertRulesResponse struct {
+	Rules []db.AlertRule `json:"rules"`
+}
+
+type savedViewsResponse struct {
+	Views []db.SavedView `json:"views"`
+}
+
+type profileRefreshResponse struct {
+	User         db.User         `json:"user"`
+	Repositories []db.Repository `json:"repositories"`
+	Unavailable  []string        `json:"unavailable"`
+}
+
+type apiTokensResponse struct {
+	Tokens []db.APIToken `json:"tokens"`
+}
+
+type runSigningSecretResponse struct {
+	Repository *db.Repository `json:"repository"`
+	// Secret signs the runs of the repository and is only returned when generated
+	Secret string `json:"secret"`
+}
+
+type notificationPreferencesResponse struct {
+	Preferences []db.NotificationPreference `json:"preferences"`
+}
+
+type notificationChannelsResponse struct {
+	RepositoryID   *uuid.UUID                    `json:"repository_id"`
+	OrganizationID *uuid.UUID                    `json:"organization_id"`
+	Channels       []service.NotificationChannel `json:"channels"`
+}
+
+type announcementResponse struct {
+	Message    string `json:"message"`
+	Recipients int    `json:"recipients"`
+}
+
+type retentionReportsResponse struct {
+	Reports []db.RetentionReport `json:"reports"`
+}
+
+type emissionFactorsResponse struct {
+	Factors []db.EmissionFactor `json:"factors"`
+}
+
+type emissionFactorVersionsResponse struct {
+	Versions []db.EmissionFactorVersion `json:"versions"`
+}
+
+type recalculationReportsResponse struct {
+	Reports []db.RecalculationReport `json:"reports"`
+}
+
+type carbonOffsetsResponse struct {
+	Offsets []db.CarbonOffset `json:"offsets"`
+}
+
+type usersResponse struct {
+	Users      []service.UserDirectoryEntry `json:"users"`
+	Pagination Pagination                   `json:"pagination"`
+}
+
+type configResponse struct {
+	Config map[string]interface{} `json:"config"`
+}
+
+type auditEventsResponse struct {
+	Events     []db.AuditEvent `json:"events"`
+	Pagination Pagination      `json:"pagination"`
+}
+
+type archiveManifestResponse struct {
+	Format        string          `json:"format"`
+	Location      string          `json:"location"`
+	Pattern       string          `json:"pattern"`
+	PartitionKeys []string        `json:"partition_keys"`
+	Columns       []ArchiveColumn `json:"columns"`
+	Files         []ArchiveFile   `json:"files"`
+	Pagination    Pagination      `json:"pagination"`
+}
+
+type jobsResponse struct {
+	Jobs []db.Job `json:"jobs"`
+}
+
+type jobResponse struct {
+	Job  *db.Job     `json:"job"`
+	Runs []db.JobRun `json:"runs"`
+}
+
+type flagsResponse struct {
+	Flags []flags.Flag `json:"flags"`
+}
+
+// routeOperations documents the routes of registerRoutes by method and path relative to
+// APIPrefix. Every route must be documented; TestOpenAPI fails for routes missing here.
+var routeOperations = map[string]openapi.Operation{
+	"GET /health": {
+		Summary:     "Health check",
+		Description: "Get the health status of the API. Authenticated users can add verbose=true for the status of its dependencies and the build of the binary.",
+		Tag:         "health",
+		Params: []openapi.Param{
+			openapi.QueryBool("verbose", "Report dependency status and build information (requires authentication)"),
+		},
+		Response: healthResponse{},
+		Public:   true,
+	},
+	"GET /leaderboard": {
+		Summary:     "Get public leaderboard",
+		Description: "Rank public repositories that opted into public stats by CO2 per run or by CO2 reduction versus the previous period",
+		Tag:         "leaderboard",
+		Params: []openapi.Param{
+			openapi.Query("rank_by", "Ranking (co2_per_run, reduction)").Default("co2_per_run"),
+			openapi.Query("period", "Period (week, month, quarter, year, all)").Default("month"),
+			openapi.QueryInt("page", "Page number").Default(1),
+			openapi.QueryInt("limit", "Items per page").Default(20),
+		},
+		Response: leaderboardResponse{},
+		Public:   true,
+	},
+	"GET /users/:user": {
+		Summary:     "Get user profile",
+		Description: "Get the profile of a user by ID or GitHub username: their name, avatar, the CO2 badges of their public repositories that opted into public stats and, when they chose to show them, their all-time statistics over the runs in repositories the caller can see. Profiles are private until their user makes them visible to members of a shared organization or to everyone, including anonymous callers; hidden profiles are reported as not found.",
+		Tag:         "users",
+		Params: []openapi.Param{
+			openapi.Path("user", "User UUID or GitHub username"),
+		},
+		Response: service.Profile{},
+		Public:   true,
+	},
+	"GET /auth/github": {
+		Summary:     "Initiate GitHub OAuth",
+		Description: "Redirect to GitHub OAuth authorization",
+		Tag:         "auth",
+		Params: []openapi.Param{
+			openapi.Query("redirect_uri", "Redirect URI after auth"),
+		},
+		Status: http.StatusFound,
+		Public: true,
+	},
+	"GET /auth/github/callback": {
+		Summary:     "GitHub OAuth callback",
+		Description: "Handle GitHub OAuth callback and create session",
+		Tag:         "auth",
+		Params: []openapi.Param{
+			openapi.Query("code", "Authorization code").Require(),
+			openapi.Query("state", "State parameter"),
+		},
+		Status: http.StatusFound,
+		Public: true,
+	},
+	"POST /auth/logout": {
+		Summary:     "Logout user",
+		Description: "Clear authentication session",
+		Tag:         "auth",
+		Response:    messageResponse{},
+	},
+	"GET /auth/me": {
+		Summary:     "Get current user",
+		Description: "Get information about the authenticated user",
+		Tag:         "auth",
+		Response:    db.User{},
+	},
+	"POST /runs": {
+		Summary:     "Create CO2 measurement run",
+		Description: "Store a new CO2 measurement run. Energy and CO2 are given as energy_kwh and co2_kg, or once each in other units (energy with energy_unit kWh, Wh or J, energy_wh or energy_j; co2 with co2_unit kg or g, or co2_g) and stored as kWh and kg. The body may be gzip or deflate encoded and is limited to MAX_INGEST_BODY_BYTES as sent and decoded. Runs for repositories that require signed runs must also carry X-EcoCI-Timestamp, the Unix time in seconds, and X-EcoCI-Signature-256, sha256= followed by the hex HMAC-SHA256 of \"<timestamp>.<body>\" with the run signing secret of the repository, over the decoded body and within 5 minutes of the server time.",
+		Tag:         "runs",
+		Params: []openapi.Param{
+			openapi.Header("Content-Encoding", "gzip or deflate"),
+			openapi.Header("X-EcoCI-Timestamp", "Unix time the run was signed at, for repositories that require signed runs"),
+			openapi.Header("X-EcoCI-Signature-256", "Run signature, for repositories that require signed runs"),
+		},
+		Request:  service.RunCreateRequest{},
+		Status:   http.StatusCreated,
+		Response: db.Run{},
+	},
+	"GET /runs/search": {
+		Summary:     "Search runs",
+		Description: "Find runs of repositories the current user can see by workflow, branch, commit or metadata values such as tags and commit messages. On PostgreSQL q is a web search query (\"quoted phrases\", or, -excluded words) and runs are ordered by relevance, then newest first.",
+		Tag:         "runs",
+		Params: []openapi.Param{
+			openapi.Query("q", "Search query").Require(),
+			openapi.Query("repository_id", "Repository UUID to search within"),
+			openapi.Query("filter", runFilterDescription),
+			openapi.Query("sort", runSortDescription+", by relevance when omitted"),
+			openapi.Query("order", "Sort order (asc, desc)").Default("desc"),
+			openapi.QueryInt("page", "Page number").Default(1),
+			openapi.QueryInt("limit", "Items per page").Default(20),
+		},
+		Response: runsResponse{},
+	},
+	"GET /me/runs": {
+		Summary:     "List my runs",
+		Description: "Get paginated list of the runs submitted by the current user across repositories",
+		Tag:         "runs",
+		Params: []openapi.Param{
+			openapi.QueryInt("page", "Page number").Default(1),
+			openapi.QueryInt("limit", "Items per page").Default(20),
+			openapi.Query("repository_id", "Repository UUID to list the runs of"),
+			openapi.Query("from_date", "Filter from date (ISO 8601)"),
+			openapi.Query("to_date", "Filter to date (ISO 8601)"),
+			openapi.Query("filter", runFilterDescription),
+			openapi.Query("sort", runSortDescription).Default("created_at"),
+			openapi.Query("order", "Sort order (asc, desc)").Default("desc"),
+		},
+		Response: runsResponse{},
+	},
+	"DELETE /runs/:run_id": {
+		Summary:     "Delete run",
+		Description: "Delete a run submitted by the current user. The run is excluded from all statistics at once and can be restored within the restore window.",
+		Tag:         "runs",
+		Params: []openapi.Param{
+			openapi.Path("run_id", "Run UUID"),
+		},
+		Response: deletedResponse{},
+	},
+	"PUT /runs/:run_id/test-suites": {
+		Summary:     "Upload run test report",
+		Description: "Attach the JUnit XML report of a run, replacing any uploaded before. The energy and CO2 of the run are apportioned across its test suites by duration, or by test count when the report has no times. Suites nested in others are flattened and suites of the same name merged. The report is the request body or the file field of a multipart form; it may be gzip or deflate encoded and is limited to MAX_INGEST_BODY_BYTES. Only the user who submitted the run and the owner of its repository may upload its report.",
+		Tag:         "runs",
+		Params: []openapi.Param{
+			openapi.Path("run_id", "Run UUID"),
+			openapi.Header("Content-Encoding", "gzip or deflate"),
+		},
+		Uploads:  []string{"application/xml", "multipart/form-data"},
+		Response: testSuitesResponse{},
+	},
+	"GET /runs/:run_id/test-suites": {
+		Summary:     "Get run test suites",
+		Description: "Get the test suites of the JUnit report of a run with the energy and CO2 apportioned to each, the most CO2 first",
+		Tag:         "runs",
+		Params: []openapi.Param{
+			openapi.Path("run_id", "Run UUID"),
+		},
+		Response: testSuitesResponse{},
+	},
+	"GET /runs/:run_id/timeline": {
+		Summary:     "Get run timeline",
+		Description: "Get the steps of a run in the order they ran with their phase, start and end offsets, duration, energy, CO2 and average power, shaped for a Gantt chart. Steps start at their start_offset_s, else when the step before them ended.",
+		Tag:         "runs",
+		Params: []openapi.Param{
+			openapi.Path("run_id", "Run UUID"),
+		},
+		Response: service.RunTimeline{},
+	},
+	"GET /runs/:run_id/comments": {
+		Summary:     "List run comments",
+		Description: "Get the comments on a run, oldest first, with their replies nested under them",
+		Tag:         "comments",
+		Params: []openapi.Param{
+			openapi.Path("run_id", "Run UUID"),
+		},
+		Response: commentsResponse{},
+	},
+	"POST /runs/:run_id/comments": {
+		Summary:     "Comment on run",
+		Description: "Annotate a run, such as a regression, with a comment, or reply to a top-level comment of the run with parent_id",
+		Tag:         "comments",
+		Params: []openapi.Param{
+			openapi.Path("run_id", "Run UUID"),
+		},
+		Request:  service.CommentRequest{},
+		Response: service.Comment{},
+		Status:   http.StatusCreated,
+	},
+	"DELETE /runs/:run_id/comments/:comment_id": {
+		Summary:     "Delete run comment",
+		Description: "Remove a comment on a run with its replies (comment author or repository owner only)",
+		Tag:         "comments",
+		Params: []openapi.Param{
+			openapi.Path("run_id", "Run UUID"),
+			openapi.Path("comment_id", "Comment UUID"),
+		},
+		Response: messageResponse{},
+	},
+	"GET /repos/:repo_id/comments": {
+		Summary:     "List repository comments",
+		Description: "Get the comments on the runs of a repository created over a time range, in the order of their runs, with the run_created_at to place them on charts of the data",
+		Tag:         "comments",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+		},
+		Response: repositoryCommentsResponse{},
+	},
+	"POST /runs/:run_id/restore": {
+		Summary:     "Restore run",
+		Description: "Restore a run the current user deleted within the restore window. Runs deleted along with their repository are restored with the repository.",
+		Tag:         "runs",
+		Params: []openapi.Param{
+			openapi.Path("run_id", "Run UUID"),
+		},
+		Response: db.Run{},
+	},
+	"POST /imports/codecarbon": {
+		Summary:     "Import codecarbon measurements",
+		Description: "Convert the rows of a codecarbon emissions.csv into runs created at their timestamps. Every row becomes a run of the repository given, or of the repository named by its project_name. Rows already imported into the repository (by run_id) are skipped. The file is the request body or the file field of a multipart form; nothing is imported if any row is invalid. Repositories that require signed runs reject imports. The body may be gzip or deflate encoded and is limited to MAX_INGEST_BODY_BYTES.",
+		Tag:         "runs",
+		Params: []openapi.Param{
+			openapi.Header("Content-Encoding", "gzip or deflate"),
+			openapi.Query("repository", "Full name of the repository of every row, such as octocat/hello-world"),
+		},
+		Uploads:  []string{"text/csv", "multipart/form-data"},
+		Status:   http.StatusCreated,
+		Response: service.ImportResult{},
+	},
+	"POST /imports/cloud-carbon-footprint": {
+		Summary:     "Import Cloud Carbon Footprint estimates",
+		Description: "Convert the per-account, per-service and per-region estimates of Cloud Carbon Footprint into runs of a repository for cloud emissions, created at the start of their period, so CI emissions can be reported next to them. The file is the JSON of the /api/footprint endpoint or a CSV export, as the request body or the file field of a multipart form. The service of an estimate becomes the workflow of its run. Estimates already imported are skipped; nothing is imported if any estimate is invalid. Repositories that require signed runs reject imports. The body may be gzip or deflate encoded and is limited to MAX_INGEST_BODY_BYTES.",
+		Tag:         "runs",
+		Params: []openapi.Param{
+			openapi.Header("Content-Encoding", "gzip or deflate"),
+			openapi.Query("repository", "Full name of the repository of the estimates (default <username>/cloud)"),
+		},
+		Uploads:  []string{"application/json", "text/csv", "multipart/form-data"},
+		Status:   http.StatusCreated,
+		Response: service.ImportResult{},
+	},
+	"POST /imports/green-metrics-tool": {
+		Summary:     "Import Green Metrics Tool measurements",
+		Description: "Convert Green Metrics Tool measurement runs, each the run of its /v1/run endpoint with the rows of its phase_stats table, into runs created when they were measured. The runtime phase becomes the run and the flows of the usage scenario its steps metadata, with the energy, CO2 and duration of each. The Green Metrics Tool ID is kept as gmt_run_id; runs already imported are skipped. Runs belong to the repository given, or to the GitHub repository of their uri. The file is the request body or the file field of a multipart form; nothing is imported if any run is invalid. Repositories that require signed runs reject imports. The body may be gzip or deflate encoded and is limited to MAX_INGEST_BODY_BYTES.",
+		Tag:         "runs",
+		Params: []openapi.Param{
+			openapi.Header("Content-Encoding", "gzip or deflate"),
+			openapi.Query("repository", "Full name of the repository of every run, such as octocat/hello-world"),
+		},
+		Uploads:  []string{"application/json", "multipart/form-data"},
+		Status:   http.StatusCreated,
+		Response: service.ImportResult{},
+	},
+	"POST /imports/ecoci": {
+		Summary:     "Import an EcoCI carbon history",
+		Description: "Import the runs of a carbon history manifest exported by an EcoCI instance with GET /repos/{repo_id}/export.json, keeping their measurements, metadata and creation times. Runs belong to the repository given, or to the repository of the manifest. Runs already imported (by their ID in the exporting instance) are skipped, so an import can be repeated. Manifests of newer format versions than this instance reads are rejected. The file is the request body or the file field of a multipart form; nothing is imported if any run is invalid. Repositories that require signed runs reject imports. The body may be gzip or deflate encoded and is limited to MAX_INGEST_BODY_BYTES.",
+		Tag:         "runs",
+		Params: []openapi.Param{
+			openapi.Header("Content-Encoding", "gzip or deflate"),
+			openapi.Query("repository", "Full name of the repository to import into, such as octocat/hello-world"),
+		},
+		Uploads:  []string{"application/json", "multipart/form-data"},
+		Status:   http.StatusCreated,
+		Response: service.ImportResult{},
+	},
+	"GET /repos": {
+		Summary:     "List repositories with CO2 statistics",
+		Description: "Get paginated list of repositories with aggregated CO2 data",
+		Tag:         "repositories",
+		Params: []openapi.Param{
+			openapi.QueryInt("page", "Page number").Default(1),
+			openapi.QueryInt("limit", "Items per page").Default(20),
+			openapi.Query("sort", "Sort field").Default("total_co2").Enum("total_co2", "avg_co2", "run_count", "last_run"),
+			openapi.Query("order", "Sort order").Default("desc").Enum("asc", "desc"),
+			openapi.Query("owner", "Filter by owner username"),
+			openapi.Query("name", "Filter by repository name"),
+			openapi.Query("full_name", "Filter by full name, such as octocat/hello-world"),
+			openapi.QueryBool("mine", "Only repositories owned by, shared with, or in an organization of the current user"),
+			openapi.Query("visibility", "Filter by visibility").Default("all").Enum("all", "public", "private"),
+			openapi.Query("fields", "Comma-separated members of each repository to return, such as id,full_name,stats; all when omitted"),
+			openapi.Query("include", "Comma-separated relations to embed: owner (default); empty for none"),
+		},
+		Response: repositoriesResponse{},
+	},
+	"DELETE /repos/:repo_id": {
+		Summary:     "Delete repository",
+		Description: "Delete a repository with its runs (owner only). The repository can be restored within the restore window; submitting a run for the same repository meanwhile creates a new one.",
+		Tag:         "repositories",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+		},
+		Response: deletedResponse{},
+	},
+	"POST /repos/:repo_id/restore": {
+		Summary:     "Restore repository",
+		Description: "Restore a repository the current user deleted within the restore window, together with the runs deleted along with it",
+		Tag:         "repositories",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+		},
+		Response: db.Repository{},
+	},
+	"GET /repos/:repo_id/runs": {
+		Summary:     "Get runs for a repository",
+		Description: "Get paginated list of runs for a specific repository. Runs older than the retention of the repository's plan are not listed.",
+		Tag:         "repositories",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+			openapi.QueryInt("page", "Page number").Default(1),
+			openapi.QueryInt("limit", "Items per page").Default(20),
+			openapi.Query("from_date", "Filter from date (ISO 8601)"),
+			openapi.Query("to_date", "Filter to date (ISO 8601)"),
+			openapi.Query("fields", "Comma-separated members of each run to return, such as id,co2_kg,created_at; all when omitted"),
+			openapi.Query("include", "Comma-separated relations to embed: user and repository (default); empty for none"),
+			openapi.Query("filter", runFilterDescription),
+			openapi.Query("sort", runSortDescription).Default("created_at"),
+			openapi.Query("order", "Sort order (asc, desc)").Default("desc"),
+		},
+		Response: runsResponse{},
+	},
+	"GET /repos/:repo_id/workflow-runs": {
+		Summary:     "Get workflow executions of a repository",
+		Description: "Get a paginated list of a repository's workflow executions, most recent first. Runs submitted with the same workflow run group, such as the jobs of a matrix build, are collapsed into one execution with their totals; runs without a group are executions of their own. Runs older than the retention of the repository's plan are not listed.",
+		Tag:         "repositories",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+			openapi.QueryInt("page", "Page number").Default(1),
+			openapi.QueryInt("limit", "Items per page").Default(20),
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+			openapi.Query("filter", runFilterDescription),
+		},
+		Response: workflowRunsResponse{},
+	},
+	"PATCH /repos/:repo_id/settings": {
+		Summary:     "Update repository settings",
+		Description: "Opt a repository in or out of the public leaderboard, peer benchmarking and GitHub commit statuses (repository owner only)",
+		Tag:         "repositories",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+		},
+		Request:  RepositorySettingsRequest{},
+		Response: db.Repository{},
+	},
+	"POST /repos/:repo_id/run-signing-secret": {
+		Summary:     "Require signed runs",
+		Description: "Generate a new run signing secret for a repository, replacing any previous one, and reject runs for it that are not signed with the secret from now on (repository owner only). The secret is only returned in this response.",
+		Tag:         "repositories",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+		},
+		Response: runSigningSecretResponse{},
+	},
+	"DELETE /repos/:repo_id/run-signing-secret": {
+		Summary:     "Stop requiring signed runs",
+		Description: "Forget the run signing secret of a repository, which accepts unsigned runs again (repository owner only)",
+		Tag:         "repositories",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+		},
+		Response: db.Repository{},
+	},
+	"GET /repos/:repo_id/collaborators": {
+		Summary:     "List repository collaborators",
+		Description: "Get the users a repository has been shared with",
+		Tag:         "repositories",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+		},
+		Response: collaboratorsResponse{},
+	},
+	"POST /repos/:repo_id/collaborators": {
+		Summary:     "Add repository collaborator",
+		Description: "Share a repository with another EcoCI user (repository owner only)",
+		Tag:         "repositories",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+		},
+		Request:  CollaboratorAddRequest{},
+		Status:   http.StatusCreated,
+		Response: db.RepositoryCollaborator{},
+	},
+	"DELETE /repos/:repo_id/collaborators/:user_id": {
+		Summary:     "Remove repository collaborator",
+		Description: "Revoke a user's access to a repository (repository owner only)",
+		Tag:         "repositories",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+			openapi.Path("user_id", "Collaborator user UUID"),
+		},
+		Response: messageResponse{},
+	},
+	"GET /repos/:repo_id/timeseries": {
+		Summary:     "Get repository time series",
+		Description: "Get a metric of a repository's runs bucketed by day, week or month",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+			openapi.Query("metric", "Metric (co2_kg, energy_kwh, duration_s)").Default("co2_kg"),
+			openapi.Query("interval", "Bucket size (day, week, month)").Default("day"),
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD)"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+			openapi.Query("compare", "Comparison window (previous_period)"),
+		},
+		Response: timeSeriesResponse{},
+	},
+	"GET /me/timeseries": {
+		Summary:     "Get current user time series",
+		Description: "Get a metric of the current user's runs bucketed by day, week or month",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Query("metric", "Metric (co2_kg, energy_kwh, duration_s)").Default("co2_kg"),
+			openapi.Query("interval", "Bucket size (day, week, month)").Default("day"),
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD)"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+			openapi.Query("compare", "Comparison window (previous_period)"),
+		},
+		Response: timeSeriesResponse{},
+	},
+	"GET /orgs/:org/timeseries": {
+		Summary:     "Get organization time series",
+		Description: "Get a metric of an organization's runs bucketed by day, week or month (members only)",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Path("org", "GitHub organization login"),
+			openapi.Query("metric", "Metric (co2_kg, energy_kwh, duration_s)").Default("co2_kg"),
+			openapi.Query("interval", "Bucket size (day, week, month)").Default("day"),
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD)"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+			openapi.Query("compare", "Comparison window (previous_period)"),
+		},
+		Response: timeSeriesResponse{},
+	},
+	"GET /repos/:repo_id/stats": {
+		Summary:     "Get repository statistics",
+		Description: "Get aggregated CO2, energy, duration and run count of a repository over a time range, with its peer benchmark when opted in",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+			openapi.Query("compare", "Comparison window (previous_period)"),
+			openapi.Query("method", "Accounting method of the CO2 (location, market)").Default("location"),
+		},
+		Response: repositoryStatsResponse{},
+	},
+	"GET /repos/:repo_id/workflows/stats": {
+		Summary:     "Get repository workflow statistics",
+		Description: "Get per-workflow aggregates and p50/p90/p99 CO2 and duration percentiles of a repository",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+		},
+		Response: workflowStatsResponse{},
+	},
+	"GET /repos/:repo_id/measurements": {
+		Summary:     "Get repository measurements",
+		Description: "Get the total and per-run average of each measurement type, such as gpu_energy or network_transfer, reported by the runs of a repository over a time range",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+		},
+		Response: measurementsResponse{},
+	},
+	"GET /me/measurements": {
+		Summary:     "Get current user measurements",
+		Description: "Get the total and per-run average of each measurement type reported by the current user's runs over a time range",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+		},
+		Response: measurementsResponse{},
+	},
+	"GET /orgs/:org/measurements": {
+		Summary:     "Get organization measurements",
+		Description: "Get the total and per-run average of each measurement type reported by the runs of an organization over a time range (members only)",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Path("org", "GitHub organization login"),
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+		},
+		Response: measurementsResponse{},
+	},
+	"GET /repos/:repo_id/gpus": {
+		Summary:     "Get repository GPU energy",
+		Description: "Get the GPU energy of the runs of a repository over a time range by GPU model, with the share of their energy it makes up",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+		},
+		Response: gpuStatsResponse{},
+	},
+	"GET /repos/:repo_id/languages": {
+		Summary:     "Get repository languages",
+		Description: "Get the languages of a repository as detected by GitHub, with the bytes and share of its code in each, the most code first. The language-sync job reads them weekly.",
+		Tag:         "repositories",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+		},
+		Response: service.RepositoryLanguages{},
+	},
+	"POST /repos/:repo_id/languages/sync": {
+		Summary:     "Sync repository languages",
+		Description: "Read the languages of a repository from GitHub now instead of waiting for the language-sync job. The language with the most code becomes the language of the repository (repository owner only).",
+		Tag:         "repositories",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+		},
+		Response: service.RepositoryLanguages{},
+	},
+	"GET /me/languages": {
+		Summary:     "Get current user language statistics",
+		Description: "Get the runs of the current user over a time range by the primary language of their repository, with the repositories, runs, CO2, energy and duration of each, the most CO2 first",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+		},
+		Response: languageStatsResponse{},
+	},
+	"GET /orgs/:org/languages": {
+		Summary:     "Get organization language statistics",
+		Description: "Get the runs of the repositories of an organization over a time range by their primary language, with the repositories, runs, CO2, energy and duration of each, the most CO2 first (members only)",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Path("org", "GitHub organization login"),
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+		},
+		Response: languageStatsResponse{},
+	},
+	"GET /repos/:repo_id/image-builds": {
+		Summary:     "Get repository image builds",
+		Description: "Get the image-build runs of a repository over a time range, in total and bucketed by interval: the layers built and cached, the cache hit rate, image size, registry push bytes and CO2, with the CO2 per built layer and the CO2 the cached layers are estimated to have saved",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+			openapi.Query("interval", "Bucket size: day, week or month (default week)"),
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days, 12 weeks or 12 months before to"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+		},
+		Response: service.ImageBuildStats{},
+	},
+	"GET /repos/:repo_id/test-suites": {
+		Summary:     "Get repository test suite emissions",
+		Description: "Get the test suites of the runs of a repository over a time range by name with the energy and CO2 apportioned to them, the most CO2 first, pointing at the most expensive tests",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+			openapi.Query("limit", "Test suites to return (at most 100, default 20)"),
+		},
+		Response: testSuiteStatsResponse{},
+	},
+	"GET /me/gpus": {
+		Summary:     "Get current user GPU energy",
+		Description: "Get the GPU energy of the current user's runs over a time range by GPU model, with the share of their energy it makes up",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+		},
+		Response: gpuStatsResponse{},
+	},
+	"GET /orgs/:org/gpus": {
+		Summary:     "Get organization GPU energy",
+		Description: "Get the GPU energy of the runs of an organization over a time range by GPU model, with the share of their energy it makes up (members only)",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Path("org", "GitHub organization login"),
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+		},
+		Response: gpuStatsResponse{},
+	},
+	"GET /repos/:repo_id/environments": {
+		Summary:     "Get repository environment statistics",
+		Description: "Get the runs of a repository over a time range by environment (ci, staging, production-deploy), with the runs, CO2, energy and duration of each and its share of the CO2, separating deployment from test pipelines",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+		},
+		Response: environmentStatsResponse{},
+	},
+	"GET /me/environments": {
+		Summary:     "Get current user environment statistics",
+		Description: "Get the current user's runs over a time range by environment (ci, staging, production-deploy), with the runs, CO2, energy and duration of each and its share of the CO2, separating deployment from test pipelines",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+		},
+		Response: environmentStatsResponse{},
+	},
+	"GET /orgs/:org/environments": {
+		Summary:     "Get organization environment statistics",
+		Description: "Get the runs of an organization over a time range by environment (ci, staging, production-deploy), with the runs, CO2, energy and duration of each and its share of the CO2, separating deployment from test pipelines (members only)",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Path("org", "GitHub organization login"),
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+		},
+		Response: environmentStatsResponse{},
+	},
+	"GET /repos/:repo_id/phases": {
+		Summary:     "Get repository phase emissions",
+		Description: "Get the energy, CO2 and duration of the steps of a repository's runs over a time range by phase (checkout, deps, build, test, deploy, other), with the share of the CO2 of the steps and the runs each phase dominates",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+		},
+		Response: service.PhaseBreakdown{},
+	},
+	"GET /me/phases": {
+		Summary:     "Get current user phase emissions",
+		Description: "Get the energy, CO2 and duration of the steps of the current user's runs over a time range by phase (checkout, deps, build, test, deploy, other), with the share of the CO2 of the steps and the runs each phase dominates",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+		},
+		Response: service.PhaseBreakdown{},
+	},
+	"GET /orgs/:org/phases": {
+		Summary:     "Get organization phase emissions",
+		Description: "Get the energy, CO2 and duration of the steps of an organization's runs over a time range by phase (checkout, deps, build, test, deploy, other), with the share of the CO2 of the steps and the runs each phase dominates (members only)",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Path("org", "GitHub organization login"),
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+		},
+		Response: service.PhaseBreakdown{},
+	},
+	"GET /repos/:repo_id/runs/aggregate": {
+		Summary:     "Aggregate repository runs by group",
+		Description: "Group a repository's runs by workflow, workflow run group, branch, CI provider, tag or any key of their metadata and aggregate a metric per group",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+			openapi.Query("group_by", "Grouping (workflow_name, workflow_run_group, branch, environment, ci_provider, tag, or metadata.<key> such as metadata.runner_os)").Require(),
+			openapi.Query("metric", "Metric (co2_kg, energy_kwh, duration_s)").Default("co2_kg"),
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+			openapi.Query("filter", runFilterDescription),
+		},
+		Response: aggregateResponse{},
+	},
+	"GET /repos/:repo_id/runs/histogram": {
+		Summary:     "Get the distribution of a metric over repository runs",
+		Description: "Count a repository's runs in buckets of equal width between the minimum and maximum of a metric, to chart its distribution and spot outliers",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+			openapi.Query("metric", "Metric (co2_kg, energy_kwh, duration_s)").Default("co2_kg"),
+			openapi.QueryInt("buckets", "Number of buckets, at most 100").Default(20),
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+			openapi.Query("filter", runFilterDescription),
+		},
+		Response: histogramResponse{},
+	},
+	"GET /carbon/windows": {
+		Summary:     "Find low-carbon scheduling windows",
+		Description: "Find the windows of the next hours with the lowest forecast grid carbon intensity in a region, to schedule non-urgent workflows such as nightly jobs when the grid is greenest. Windows start now or on a forecast point and do not overlap.",
+		Tag:         "carbon",
+		Params: []openapi.Param{
+			openapi.Query("region", "Cloud region (such as westeurope or eu-north-1) or grid zone of the provider").Require(),
+			openapi.Query("duration", "Duration of the workflow, at least 15m").Default("1h"),
+			openapi.Query("horizon", "How far ahead windows must end, at most 72h").Default("24h"),
+			openapi.QueryInt("limit", "Number of windows, at most 10").Default(3),
+		},
+		Response: carbonWindowsResponse{},
+	},
+	"GET /repos/:repo_id/regions/recommendation": {
+		Summary:     "Recommend a runner region for a repository",
+		Description: "Rank candidate runner regions by the current and forecast grid carbon intensity, or by runner price, and estimate what the repository's typical run of the last 30 days would emit and cost in each. Runs are assumed to need the same energy and time in every region.",
+		Tag:         "carbon",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+			openapi.Query("regions", "Comma-separated candidate cloud regions or grid zones, at most 20").Require(),
+			openapi.Query("horizon", "How far ahead the forecast is averaged, at most 72h").Default("24h"),
+			openapi.Query("optimize", "Rank by carbon or cost").Default("carbon"),
+			openapi.Query("prices", "Runner prices per minute as region=price pairs, required for every region to optimize cost"),
+		},
+		Response: regionRecommendationResponse{},
+	},
+	"GET /repos/:repo_id/recommendations": {
+		Summary:     "Get optimization recommendations for a repository",
+		Description: "Analyze a repository's runs for cold caches, failed runs, scheduled runs on a dirty grid, oversized runners and dependency installation dominating their steps, and suggest changes with the CO2 they are estimated to have saved over the period, largest savings first",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+		},
+		Response: service.Recommendations{},
+	},
+	"GET /repos/:repo_id/wasted-carbon": {
+		Summary:     "Get the wasted carbon of a repository",
+		Description: "Sum the CO2 of runs that produced no usable result: failed or cancelled runs (status or conclusion metadata) and attempts superseded by a retry (github_run_attempt metadata), in total, per workflow and as a trend, to find flaky pipelines",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+			openapi.Query("interval", "Bucket size of the trend (day, week, month)").Default("week"),
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD), defaults to 12 weeks before to for week buckets, 30 days for day and 12 months for month"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+		},
+		Response: service.WastedCarbon{},
+	},
+	"GET /repos/:repo_id/compare": {
+		Summary:     "Compare two branches of a repository",
+		Description: "Compare the runs of a head branch with those of a base branch over the same recent window: CO2, energy and duration per run, run counts and total CO2, with the change from base to head",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+			openapi.Query("base", "Base branch, such as main").Require(),
+			openapi.Query("head", "Head branch").Require(),
+			openapi.Query("window", "Window ending now, in days such as 14d or as a duration such as 36h, from 1h to 365d").Default("14d"),
+		},
+		Response: service.BranchComparison{},
+	},
+	"GET /repos/:repo_id/baseline": {
+		Summary:     "Get repository baseline",
+		Description: "Get the frozen baseline rates of a repository",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+		},
+		Response: db.RepositoryBaseline{},
+	},
+	"PUT /repos/:repo_id/baseline": {
+		Summary:     "Set repository baseline",
+		Description: "Freeze the per-run CO2 and energy rates of a reference period as the repository baseline (repository owner only)",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+		},
+		Request:  BaselineRequest{},
+		Response: db.RepositoryBaseline{},
+	},
+	"GET /repos/:repo_id/savings": {
+		Summary:     "Get savings versus baseline",
+		Description: "Compare a repository's actual CO2 and energy with what its runs would have emitted at the frozen baseline rates",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD), defaults to the end of the baseline period"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+		},
+		Response: service.SavingsReport{},
+	},
+	"GET /repos/:repo_id/budgets": {
+		Summary:     "List repository budgets",
+		Description: "Get the CO2 budgets of a repository",
+		Tag:         "budgets",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+		},
+		Response: budgetsResponse{},
+	},
+	"PUT /repos/:repo_id/budgets/:period": {
+		Summary:     "Set repository budget",
+		Description: "Create or replace the CO2 budget of a repository for a calendar month or quarter (repository owner only)",
+		Tag:         "budgets",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+			openapi.Path("period", "Budget period (month, quarter)"),
+		},
+		Request:  BudgetRequest{},
+		Response: db.RepositoryBudget{},
+	},
+	"DELETE /repos/:repo_id/budgets/:period": {
+		Summary:     "Delete repository budget",
+		Description: "Remove the CO2 budget of a repository for a period (repository owner only)",
+		Tag:         "budgets",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+			openapi.Path("period", "Budget period (month, quarter)"),
+		},
+		Response: messageResponse{},
+	},
+	"GET /repos/:repo_id/forecast": {
+		Summary:     "Get repository CO2 forecast",
+		Description: "Project end-of-month and end-of-quarter CO2 from the recent weekday run rate, with status against the repository budgets",
+		Tag:         "budgets",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+			openapi.QueryInt("lookback_days", "Run-rate window in days (7-365)").Default(28),
+		},
+		Response: service.Forecast{},
+	},
+	"GET /repos/:repo_id/budget-check": {
+		Summary:     "Check repository budgets",
+		Description: "Report whether the repository is within its CO2 budgets for the current month and quarter, so pipelines can fail once a budget is exceeded. The status is the worst of the budgets: exceeded when emissions to date are over a limit, at_risk when the forecast is, else on_track, or no_budget without budgets.",
+		Tag:         "budgets",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+			openapi.QueryInt("lookback_days", "Run-rate window of the forecast in days (7-365)").Default(28),
+		},
+		Response: service.BudgetCheck{},
+	},
+	"GET /repos/:repo_id/commits": {
+		Summary:     "Get commit-ordered statistics",
+		Description: "Get per-commit aggregates of a repository ordered by when each commit was first measured, with deltas against the preceding commit",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+			openapi.Query("branch", "Only include runs of this branch"),
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD), defaults to 90 days before to"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+			openapi.QueryInt("limit", "Maximum number of most recent commits (max 500)").Default(50),
+		},
+		Response: commitsResponse{},
+	},
+	"GET /repos/:repo_id/commits/:sha/stats": {
+		Summary:     "Get commit statistics",
+		Description: "Aggregate all runs of a repository for a commit SHA",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+			openapi.Path("sha", "Full 40 character commit SHA"),
+		},
+		Response: service.CommitStats{},
+	},
+	"GET /repos/:repo_id/releases/:tag/stats": {
+		Summary:     "Get release statistics",
+		Description: "Sum the CI that produced a release: the runs of a repository after the last run of the previous tag up to the last run submitted with the tag as git_tag",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+			openapi.Path("tag", "Git tag of the release"),
+		},
+		Response: service.ReleaseStats{},
+	},
+	"GET /me/stats": {
+		Summary:     "Get current user statistics",
+		Description: "Get aggregated CO2, energy, duration and run count of the current user's runs over a time range, with the averages per run, the number of repositories run in and the last run of the range as stats",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+			openapi.Query("compare", "Comparison window (previous_period)"),
+			openapi.Query("method", "Accounting method of the CO2 (location, market)").Default("location"),
+		},
+		Response: userStatsResponse{},
+	},
+	"GET /users/:user/stats": {
+		Summary:     "Get user statistics",
+		Description: "Get the statistics of another user like GET /me/stats, when their profile is visible to the current user and shows their statistics. Only their runs in repositories the current user can see are counted.",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Path("user", "User UUID or GitHub username"),
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+			openapi.Query("compare", "Comparison window (previous_period)"),
+			openapi.Query("method", "Accounting method of the CO2 (location, market)").Default("location"),
+		},
+		Response: userStatsResponse{},
+	},
+	"GET /orgs/:org/stats": {
+		Summary:     "Get organization statistics",
+		Description: "Get aggregated CO2, energy, duration and run count of an organization over a time range (members only), with the gross emissions next to the market-based emissions after renewable energy purchases and the net emissions after carbon offsets",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Path("org", "GitHub organization login"),
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+			openapi.Query("compare", "Comparison window (previous_period)"),
+			openapi.Query("method", "Accounting method of the CO2 (location, market)").Default("location"),
+		},
+		Response: organizationStatsResponse{},
+	},
+	"GET /me/year-in-review": {
+		Summary:     "Get current user year in review",
+		Description: "Summarize the current user's year: totals, everyday equivalents, biggest regression and improvement, and per-month chart data",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.QueryInt("year", "Calendar year, defaults to the current year"),
+		},
+		Response: service.YearInReview{},
+	},
+	"GET /orgs/:org/year-in-review": {
+		Summary:     "Get organization year in review",
+		Description: "Summarize an organization's year: totals, everyday equivalents, biggest regression and improvement, and per-month chart data (members only)",
+		Tag:         "statistics",
+		Params: []openapi.Param{
+			openapi.Path("org", "GitHub organization login"),
+			openapi.QueryInt("year", "Calendar year, defaults to the current year"),
+		},
+		Response: service.YearInReview{},
+	},
+	"GET /repos/:repo_id/export.xlsx": {
+		Summary:     "Export repository report as XLSX",
+		Description: "Download an Excel workbook with the raw runs, monthly aggregates and per-workflow breakdown of a repository",
+		Tag:         "export",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD), defaults to one year before to"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+		},
+		Download: export.ContentTypeXLSX,
+	},
+	"GET /repos/:repo_id/export.json": {
+		Summary:     "Export repository carbon history",
+		Description: "Download the versioned JSON manifest of every run of a repository, with its measurements and metadata, to import into another EcoCI instance with POST /imports/ecoci or into other tools. Runs deleted by the retention policy are not included.",
+		Tag:         "export",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+		},
+		Response: export.Manifest{},
+	},
+	"GET /orgs/:org/export.xlsx": {
+		Summary:     "Export organization report as XLSX",
+		Description: "Download an Excel workbook with the raw runs, monthly aggregates and per-workflow breakdown of an organization (members only)",
+		Tag:         "export",
+		Params: []openapi.Param{
+			openapi.Path("org", "GitHub organization login"),
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD), defaults to one year before to"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+		},
+		Download: export.ContentTypeXLSX,
+	},
+	"GET /repos/:repo_id/webhooks": {
+		Summary:     "List repository webhooks",
+		Description: "Get the webhook subscriptions of a repository (repository owner only)",
+		Tag:         "webhooks",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+		},
+		Response: webhooksResponse{},
+	},
+	"POST /repos/:repo_id/webhooks": {
+		Summary:     "Create repository webhook",
+		Description: "Subscribe a URL to run.created, regression.detected and budget.exceeded events of a repository (repository owner only). Deliveries are signed with HMAC-SHA256 of the body in the X-EcoCI-Signature-256 header. The URL must resolve to a public address. The secret is only returned in this response.",
+		Tag:         "webhooks",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+		},
+		Request:  service.WebhookCreateRequest{},
+		Status:   http.StatusCreated,
+		Response: webhookCreatedResponse{},
+	},
+	"GET /orgs/:org/webhooks": {
+		Summary:     "List organization webhooks",
+		Description: "Get the webhook subscriptions of an organization (members only)",
+		Tag:         "webhooks",
+		Params: []openapi.Param{
+			openapi.Path("org", "GitHub organization login"),
+		},
+		Response: webhooksResponse{},
+	},
+	"POST /orgs/:org/webhooks": {
+		Summary:     "Create organization webhook",
+		Description: "Subscribe a URL to events of every repository of an organization (organization admins only). The URL must resolve to a public address. The secret is only returned in this response.",
+		Tag:         "webhooks",
+		Params: []openapi.Param{
+			openapi.Path("org", "GitHub organization login"),
+		},
+		Request:  service.WebhookCreateRequest{},
+		Status:   http.StatusCreated,
+		Response: webhookCreatedResponse{},
+	},
+	"DELETE /webhooks/:webhook_id": {
+		Summary:     "Delete webhook",
+		Description: "Remove a webhook subscription and its delivery history (repository owner or organization admins only)",
+		Tag:         "webhooks",
+		Params: []openapi.Param{
+			openapi.Path("webhook_id", "Webhook UUID"),
+		},
+		Response: messageResponse{},
+	},
+	"GET /webhooks/:webhook_id/deliveries": {
+		Summary:     "List webhook deliveries",
+		Description: "Get the deliveries of a webhook, newest first. Use status=dead to list dead-lettered deliveries that exhausted their retries.",
+		Tag:         "webhooks",
+		Params: []openapi.Param{
+			openapi.Path("webhook_id", "Webhook UUID"),
+			openapi.Query("status", "Filter by status").Enum("pending", "delivered", "dead"),
+			openapi.QueryInt("page", "Page number").Default(1),
+			openapi.QueryInt("limit", "Items per page").Default(20),
+		},
+		Response: deliveriesResponse{},
+	},
+	"POST /webhooks/:webhook_id/deliveries/redrive": {
+		Summary:     "Redrive dead-lettered webhook deliveries",
+		Description: "Queue every dead-lettered delivery of a webhook for immediate redelivery with a fresh retry budget, for example after the receiving endpoint was fixed",
+		Tag:         "webhooks",
+		Params: []openapi.Param{
+			openapi.Path("webhook_id", "Webhook UUID"),
+			openapi.Query("since", "Only redrive deliveries created at or after this time (RFC3339)"),
+		},
+		Status:   http.StatusAccepted,
+		Response: redriveResponse{},
+	},
+	"GET /webhooks/:webhook_id/deliveries/:delivery_id": {
+		Summary:     "Get webhook delivery",
+		Description: "Get a delivery of a webhook with its attempt history: the response status, latency, start of the response body (unless private webhook targets are allowed) and error of every attempt, oldest first",
+		Tag:         "webhooks",
+		Params: []openapi.Param{
+			openapi.Path("webhook_id", "Webhook UUID"),
+			openapi.Path("delivery_id", "Delivery UUID"),
+		},
+		Response: WebhookDeliveryDetail{},
+	},
+	"POST /webhooks/:webhook_id/deliveries/:delivery_id/redeliver": {
+		Summary:     "Redeliver webhook delivery",
+		Description: "Queue a delivery, typically a dead-lettered one, for immediate redelivery with a fresh retry budget",
+		Tag:         "webhooks",
+		Params: []openapi.Param{
+			openapi.Path("webhook_id", "Webhook UUID"),
+			openapi.Path("delivery_id", "Delivery UUID"),
+		},
+		Status:   http.StatusAccepted,
+		Response: db.WebhookDelivery{},
+	},
+	"GET /orgs/:org/integrations": {
+		Summary:     "List organization integrations",
+		Description: "Get the chat integrations of an organization (members only). Credentials are never returned.",
+		Tag:         "notifications",
+		Params: []openapi.Param{
+			openapi.Path("org", "GitHub organization login"),
+		},
+		Response: integrationsResponse{},
+	},
+	"PUT /orgs/:org/integrations/:provider": {
+		Summary:     "Set organization integration",
+		Description: "Configure the chat integration of an organization (organization admins only). Slack accepts an incoming webhook URL or a bot token; Teams and Discord require a webhook URL.",
+		Tag:         "notifications",
+		Params: []openapi.Param{
+			openapi.Path("org", "GitHub organization login"),
+			openapi.Path("provider", "Provider").Enum("slack", "teams", "discord"),
+		},
+		Request:  service.IntegrationRequest{},
+		Response: db.OrganizationIntegration{},
+	},
+	"DELETE /orgs/:org/integrations/:provider": {
+		Summary:     "Delete organization integration",
+		Description: "Remove the chat integration of an organization (organization admins only)",
+		Tag:         "notifications",
+		Params: []openapi.Param{
+			openapi.Path("org", "GitHub organization login"),
+			openapi.Path("provider", "Provider").Enum("slack", "teams", "discord"),
+		},
+		Response: messageResponse{},
+	},
+	"GET /repos/:repo_id/notifications": {
+		Summary:     "List repository notification routes",
+		Description: "Get which notifications of a repository are posted to which chat channels (repository owner only)",
+		Tag:         "notifications",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+		},
+		Response: notificationRoutesResponse{},
+	},
+	"PUT /repos/:repo_id/notifications/:provider": {
+		Summary:     "Set repository notification route",
+		Description: "Post budget.exceeded, regression.detected and weekly.summary notifications of a repository through an integration of its organization, optionally to a specific channel (repository owner only)",
+		Tag:         "notifications",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+			openapi.Path("provider", "Provider").Enum("slack", "teams", "discord"),
+		},
+		Request:  service.NotificationRouteRequest{},
+		Response: db.RepositoryNotificationRoute{},
+	},
+	"DELETE /repos/:repo_id/notifications/:provider": {
+		Summary:     "Delete repository notification route",
+		Description: "Stop posting notifications of a repository through an integration (repository owner only)",
+		Tag:         "notifications",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+			openapi.Path("provider", "Provider").Enum("slack", "teams", "discord"),
+		},
+		Response: messageResponse{},
+	},
+	"GET /me/preferences": {
+		Summary:     "Get preferences",
+		Description: "Get the settings of the current user: time zone, locale, default date range in days, display units, the optional emails they receive, the Slack member ID direct messages are sent to and who sees their profile. Settings never changed have their defaults.",
+		Tag:         "users",
+		Response:    service.Preferences{},
+	},
+	"PATCH /me/preferences": {
+		Summary:     "Update preferences",
+		Description: "Change settings of the current user; omitted settings are unchanged. Weekly report emails cover the calendar week of the user's time zone and report CO2 and energy in their display units.",
+		Tag:         "users",
+		Request:     service.PreferencesRequest{},
+		Response:    service.Preferences{},
+	},
+	"GET /me/email-preferences": {
+		Summary:     "Get email preferences",
+		Description: "Get which optional emails (invitations, alerts, reports) the current user receives. Account notices are always sent.",
+		Tag:         "users",
+		Response:    service.EmailPreferences{},
+	},
+	"PATCH /me/email-preferences": {
+		Summary:     "Update email preferences",
+		Description: "Opt in to or out of optional email categories; omitted categories are unchanged",
+		Tag:         "users",
+		Request:     service.EmailPreferencesRequest{},
+		Response:    service.EmailPreferences{},
+	},
+	"GET /me/display-units": {
+		Summary:     "Get display units",
+		Description: "Get the units responses report CO2 and energy in for the current user unless a request asks for others with ?units=",
+		Tag:         "users",
+		Response:    service.DisplayUnits{},
+	},
+	"PUT /me/display-units": {
+		Summary:     "Update display units",
+		Description: "Set the units responses report CO2 and energy in for the current user: co2 kg or g and energy kWh or Wh. Omitted quantities are reported in kg and kWh.",
+		Tag:         "users",
+		Request:     service.DisplayUnits{},
+		Response:    service.DisplayUnits{},
+	},
+	"GET /me/flags": {
+		Summary:     "Get my feature flags",
+		Description: "Get whether each feature flag is on for the current user, for clients that hide unavailable features",
+		Tag:         "users",
+		Response:    userFlagsResponse{},
+	},
+	"POST /me/refresh": {
+		Summary:     "Refresh GitHub profile",
+		Description: "Re-read the GitHub profile (username, name, avatar and email) of the current user and the metadata of the repositories they own with the GitHub token of their last sign-in, instead of signing in again. Repositories GitHub no longer shows are listed as unavailable and left unchanged. A token GitHub rejects is forgotten.",
+		Tag:         "users",
+		Response:    profileRefreshResponse{},
+	},
+	"GET /me/notification-preferences": {
+		Summary:     "List notification preferences",
+		Description: "Get the channels the current user chose for notification events, for all notifications, per organization and per repository",
+		Tag:         "users",
+		Response:    notificationPreferencesResponse{},
+	},
+	"PUT /me/notification-preferences": {
+		Summary:     "Set notification preference",
+		Description: "Choose whether an event (regression.detected, budget.exceeded, weekly.digest or org.announcement) is received by email, as a Slack direct message or not at all: for all notifications, for those of an organization (organization_id) or of a repository (repository_id). The most specific preference wins: repository over organization over all notifications; without any, events are emailed. Slack direct messages need slack_user_id in the preferences and are sent by the Slack bot of the organization, falling back to email without one. Replaces the preference of the same event and scope.",
+		Tag:         "users",
+		Request:     service.NotificationPreferenceRequest{},
+		Response:    db.NotificationPreference{},
+	},
+	"GET /me/notification-preferences/resolved": {
+		Summary:     "Resolve notification channels",
+		Description: "Get the channel the current user receives each event on for a repository or organization, or for notifications of neither, with the scope of the preference it comes from (default when none applies)",
+		Tag:         "users",
+		Params: []openapi.Param{
+			openapi.Query("repository_id", "Repository UUID; the preferences of its organization apply too"),
+			openapi.Query("organization_id", "Organization UUID"),
+		},
+		Response: notificationChannelsResponse{},
+	},
+	"DELETE /me/notification-preferences/:preference_id": {
+		Summary:     "Delete notification preference",
+		Description: "Remove a notification preference of the current user, so its event is received as chosen for the broader scopes again",
+		Tag:         "users",
+		Params: []openapi.Param{
+			openapi.Path("preference_id", "Notification preference UUID"),
+		},
+		Response: messageResponse{},
+	},
+	"POST /orgs/:org/announcements": {
+		Summary:     "Post organization announcement",
+		Description: "Send an announcement to every member of an organization on the channel they chose for org.announcement (organization admins only)",
+		Tag:         "notifications",
+		Params: []openapi.Param{
+			openapi.Path("org", "Organization login"),
+		},
+		Request:  service.AnnouncementRequest{},
+		Response: announcementResponse{},
+	},
+	"GET /me/api-tokens": {
+		Summary:     "List API tokens",
+		Description: "Get the API tokens of the current user, newest first, with their expiry and the time and source IP of their last use to spot stale or leaked tokens. The tokens themselves are only returned when created.",
+		Tag:         "users",
+		Response:    apiTokensResponse{},
+	},
+	"POST /me/api-tokens": {
+		Summary:     "Create API token",
+		Description: "Create a named API token for API clients such as CI integrations, sent as Authorization: Bearer <token>. Unlike session tokens it stays valid until expires_at, at most a year and a year when omitted, unless it is deleted. API tokens cannot create other API tokens. The token is only returned in this response.",
+		Tag:         "users",
+		Request:     service.APITokenRequest{},
+		Response:    service.CreatedAPIToken{},
+		Status:      http.StatusCreated,
+	},
+	"DELETE /me/api-tokens/:token_id": {
+		Summary:     "Delete API token",
+		Description: "Revoke an API token of the current user; requests made with it are rejected immediately",
+		Tag:         "users",
+		Params: []openapi.Param{
+			openapi.Path("token_id", "API token UUID"),
+		},
+		Response: messageResponse{},
+	},
+	"GET /me/plan": {
+		Summary:     "Get my plan",
+		Description: "Get the plan of the current user with its rate limit and the quotas and usage of their personal repositories. Repositories of an organization count against the organization's plan.",
+		Tag:         "plans",
+		Response:    PlanResponse{},
+	},
+	"GET /orgs/:org/plan": {
+		Summary:     "Get organization plan",
+		Description: "Get the plan of an organization with the quotas and usage of its repositories (members only)",
+		Tag:         "plans",
+		Params: []openapi.Param{
+			openapi.Path("org", "GitHub organization login"),
+		},
+		Response: PlanResponse{},
+	},
+	"GET /alert-rules": {
+		Summary:     "List alert rules",
+		Description: "Get the alert rules of the current user",
+		Tag:         "alerts",
+		Response:    alertRulesResponse{},
+	},
+	"POST /alert-rules": {
+		Summary:     "Create alert rule",
+		Description: "Alert when a metric of a repository, an organization or your own runs, aggregated over a rolling window, crosses a threshold (e.g. weekly CO2 above 5 kg, or average run CO2 up 20% week over week). Rules are evaluated every few minutes and delivered by email or through a chat integration of the organization, at most once per window.",
+		Tag:         "alerts",
+		Request:     service.AlertRuleRequest{},
+		Status:      http.StatusCreated,
+		Response:    db.AlertRule{},
+	},
+	"GET /alert-rules/:rule_id": {
+		Summary:     "Get alert rule",
+		Description: "Get an alert rule of the current user with its last evaluation",
+		Tag:         "alerts",
+		Params: []openapi.Param{
+			openapi.Path("rule_id", "Alert rule UUID"),
+		},
+		Response: db.AlertRule{},
+	},
+	"PUT /alert-rules/:rule_id": {
+		Summary:     "Update alert rule",
+		Description: "Replace the definition of an alert rule of the current user; its evaluation state is reset",
+		Tag:         "alerts",
+		Params: []openapi.Param{
+			openapi.Path("rule_id", "Alert rule UUID"),
+		},
+		Request:  service.AlertRuleRequest{},
+		Response: db.AlertRule{},
+	},
+	"DELETE /alert-rules/:rule_id": {
+		Summary:     "Delete alert rule",
+		Description: "Remove an alert rule of the current user",
+		Tag:         "alerts",
+		Params: []openapi.Param{
+			openapi.Path("rule_id", "Alert rule UUID"),
+		},
+		Response: messageResponse{},
+	},
+	"GET /saved-views": {
+		Summary:     "List saved views",
+		Description: "Get the saved views of the current user by name",
+		Tag:         "views",
+		Response:    savedViewsResponse{},
+	},
+	"POST /saved-views": {
+		Summary:     "Create saved view",
+		Description: "Bookmark a recurring query of runs, such as the main branch's nightly runs of the last 90 days: a filter expression, sort field and order, aggregate grouping and a date range of the last range_days days, optionally of one repository. Names are unique per user.",
+		Tag:         "views",
+		Request:     service.SavedViewRequest{},
+		Status:      http.StatusCreated,
+		Response:    db.SavedView{},
+	},
+	"GET /saved-views/:view_id": {
+		Summary:     "Get saved view",
+		Description: "Get a saved view of the current user",
+		Tag:         "views",
+		Params: []openapi.Param{
+			openapi.Path("view_id", "Saved view UUID"),
+		},
+		Response: db.SavedView{},
+	},
+	"PUT /saved-views/:view_id": {
+		Summary:     "Update saved view",
+		Description: "Replace a saved view of the current user",
+		Tag:         "views",
+		Params: []openapi.Param{
+			openapi.Path("view_id", "Saved view UUID"),
+		},
+		Request:  service.SavedViewRequest{},
+		Response: db.SavedView{},
+	},
+	"DELETE /saved-views/:view_id": {
+		Summary:     "Delete saved view",
+		Description: "Remove a saved view of the current user",
+		Tag:         "views",
+		Params: []openapi.Param{
+			openapi.Path("view_id", "Saved view UUID"),
+		},
+		Response: messageResponse{},
+	},
+	"GET /orgs/:org/retention": {
+		Summary:     "Get retention policy",
+		Description: "Get how long the runs and rollups of the repositories of an organization are kept (members only). Organizations without a policy keep their data forever.",
+		Tag:         "retention",
+		Params: []openapi.Param{
+			openapi.Path("org", "GitHub organization login"),
+		},
+		Response: db.RetentionPolicy{},
+	},
+	"PUT /orgs/:org/retention": {
+		Summary:     "Set retention policy",
+		Description: "Set how long the runs and rollups of the repositories of an organization are kept (organization admins only). Expired runs are deleted daily after their totals are kept in the daily rollups; rollups must be kept at least as long as runs. In dry-run mode the daily reports only count what would be deleted.",
+		Tag:         "retention",
+		Params: []openapi.Param{
+			openapi.Path("org", "GitHub organization login"),
+		},
+		Request:  service.RetentionPolicyRequest{},
+		Response: db.RetentionPolicy{},
+	},
+	"DELETE /orgs/:org/retention": {
+		Summary:     "Delete retention policy",
+		Description: "Remove the retention policy of an organization so its data is kept forever (organization admins only)",
+		Tag:         "retention",
+		Params: []openapi.Param{
+			openapi.Path("org", "GitHub organization login"),
+		},
+		Response: messageResponse{},
+	},
+	"GET /orgs/:org/retention/reports": {
+		Summary:     "List retention reports",
+		Description: "Get what the daily retention runs deleted, or would have deleted in dry-run mode, newest first (members only)",
+		Tag:         "retention",
+		Params: []openapi.Param{
+			openapi.Path("org", "GitHub organization login"),
+			openapi.QueryInt("limit", "Number of reports").Default(30),
+		},
+		Response: retentionReportsResponse{},
+	},
+	"GET /repos/:repo_id/water": {
+		Summary:     "Get repository water settings",
+		Description: "Get the water usage effectiveness (WUE) the water of the runs of a repository is computed with, overriding that of its organization; null when none is set",
+		Tag:         "water",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+		},
+		Response: service.WaterSettings{},
+	},
+	"PUT /repos/:repo_id/water": {
+		Summary:     "Set repository water settings",
+		Description: "Set the water usage effectiveness (WUE) in liters per kWh the water of new runs of a repository is computed with; null falls back to that of its organization and then of the hardware profile of the run (repository owner only)",
+		Tag:         "water",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+		},
+		Request:  service.WaterSettings{},
+		Response: service.WaterSettings{},
+	},
+	"GET /repos/:repo_id/storage": {
+		Summary:     "Get repository storage footprint",
+		Description: "Get the latest artifact and cache storage of a repository, the energy and CO2 of keeping it for a month, and the storage energy and CO2 accrued over a time range",
+		Tag:         "storage",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+			openapi.Query("from", "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"),
+			openapi.Query("to", "Range end (RFC3339 or YYYY-MM-DD), defaults to now"),
+		},
+		Response: service.StorageFootprint{},
+	},
+	"POST /repos/:repo_id/storage": {
+		Summary:     "Report repository storage",
+		Description: "Report the bytes of artifacts and caches a repository currently stores; the storage-emissions job accrues its energy and CO2 daily from the latest report (repository owner only)",
+		Tag:         "storage",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+		},
+		Request:  service.StorageReportRequest{},
+		Response: db.StorageReport{},
+		Status:   http.StatusCreated,
+	},
+	"GET /orgs/:org/water": {
+		Summary:     "Get organization water settings",
+		Description: "Get the water usage effectiveness (WUE) the water of the runs of the repositories of an organization is computed with; null when none is set (members only)",
+		Tag:         "water",
+		Params: []openapi.Param{
+			openapi.Path("org", "GitHub organization login"),
+		},
+		Response: service.WaterSettings{},
+	},
+	"PUT /orgs/:org/water": {
+		Summary:     "Set organization water settings",
+		Description: "Set the water usage effectiveness (WUE) in liters per kWh the water of new runs of the repositories of an organization is computed with, unless a repository sets its own; null falls back to the hardware profile of the run (organization admins only)",
+		Tag:         "water",
+		Params: []openapi.Param{
+			openapi.Path("org", "GitHub organization login"),
+		},
+		Request:  service.WaterSettings{},
+		Response: service.WaterSettings{},
+	},
+	"GET /orgs/:org/offsets": {
+		Summary:     "List carbon offsets",
+		Description: "Get the carbon offsets and renewable energy purchases of an organization, most recent period first (members only)",
+		Tag:         "offsets",
+		Params: []openapi.Param{
+			openapi.Path("org", "GitHub organization login"),
+		},
+		Response: carbonOffsetsResponse{},
+	},
+	"POST /orgs/:org/offsets": {
+		Summary:     "Record a carbon offset",
+		Description: "Record carbon offsets (kind offset, with co2_kg) or renewable energy (kind renewable, with energy_kwh) an organization purchased for a period (organization admins only). Organization statistics report the market-based and net emissions after them.",
+		Tag:         "offsets",
+		Params: []openapi.Param{
+			openapi.Path("org", "GitHub organization login"),
+		},
+		Request:  service.CarbonOffsetRequest{},
+		Status:   http.StatusCreated,
+		Response: db.CarbonOffset{},
+	},
+	"DELETE /orgs/:org/offsets/:offset_id": {
+		Summary:     "Delete a carbon offset",
+		Description: "Remove a carbon offset or renewable energy purchase of an organization (organization admins only)",
+		Tag:         "offsets",
+		Params: []openapi.Param{
+			openapi.Path("org", "GitHub organization login"),
+			openapi.Path("offset_id", "Carbon offset UUID"),
+		},
+		Response: messageResponse{},
+	},
+	"GET /emission-factors/:region": {
+		Summary:     "Get the emission factor of a region",
+		Description: "Get the grid carbon intensity of a cloud region on a day with its source, methodology and effective period, so the CO2 of runs can be traced back to it. Regions without a managed factor get the built-in factor.",
+		Tag:         "carbon",
+		Params: []openapi.Param{
+			openapi.Path("region", "Cloud region, such as westeurope or eu-west-1"),
+			openapi.Query("at", "Day (RFC3339 or YYYY-MM-DD), defaults to now"),
+		},
+		Response: service.ResolvedEmissionFactor{},
+	},
+	"POST /graphql": {
+		Summary:     "Execute a GraphQL query",
+		Description: "Query users, repositories, runs and stats with nested selection and filtering. Resolver errors are reported in the errors field of a 200 response, as is usual for GraphQL.",
+		Tag:         "graphql",
+		Request:     GraphQLRequest{},
+		Response:    graphql.Result{},
+	},
+	"GET /admin/users": {
+		Summary:     "List users",
+		Description: "Search the user accounts of the platform with the number of runs each submitted and whether they are suspended, newest first unless sorted otherwise (admin only)",
+		Tag:         "admin",
+		Params: []openapi.Param{
+			openapi.Query("q", "Match GitHub username, name or email"),
+			openapi.Query("role", "Filter by role").Enum("user", "admin"),
+			openapi.QueryBool("suspended", "Only suspended (true) or active (false) users"),
+			openapi.Query("sort", "Sort field").Default("created_at").Enum("created_at", "github_username", "github_email", "run_count"),
+			openapi.Query("order", "Sort order").Default("desc").Enum("asc", "desc"),
+			openapi.QueryInt("page", "Page number").Default(1),
+			openapi.QueryInt("limit", "Items per page").Default(20),
+		},
+		Response: usersResponse{},
+	},
+	"PATCH /admin/users/:user_id": {
+		Summary:     "Update user account",
+		Description: "Change the role or rate limit plan of a user, or suspend and reinstate them (admin only). Suspended users cannot sign in and their sessions stop working immediately. Administrators cannot change their own account.",
+		Tag:         "admin",
+		Params: []openapi.Param{
+			openapi.Path("user_id", "User UUID"),
+		},
+		Request:  UpdateUserRequest{},
+		Response: db.User{},
+	},
+	"DELETE /admin/users/:user_id": {
+		Summary:     "Delete user account",
+		Description: "Delete a user with their repositories and runs (admin only). The account can be restored within the restore window. Administrators cannot delete their own account.",
+		Tag:         "admin",
+		Params: []openapi.Param{
+			openapi.Path("user_id", "User UUID"),
+		},
+		Response: messageResponse{},
+	},
+	"POST /admin/users/:user_id/restore": {
+		Summary:     "Restore user account",
+		Description: "Restore a user deleted within the restore window, together with the repositories and runs deleted along with them (admin only)",
+		Tag:         "admin",
+		Params: []openapi.Param{
+			openapi.Path("user_id", "User UUID"),
+		},
+		Response: db.User{},
+	},
+	"POST /admin/repos/:repo_id/transfer": {
+		Summary:     "Transfer repository",
+		Description: "Reassign a repository and its runs to another user (admin only). The new owner must have signed in to EcoCI.",
+		Tag:         "admin",
+		Params: []openapi.Param{
+			openapi.Path("repo_id", "Repository UUID"),
+		},
+		Request:  TransferRepositoryRequest{},
+		Response: db.Repository{},
+	},
+	"PATCH /admin/orgs/:org": {
+		Summary:     "Update organization",
+		Description: "Assign a plan to an organization, which sets the quotas of its repositories (admin only)",
+		Tag:         "admin",
+		Params: []openapi.Param{
+			openapi.Path("org", "GitHub organization login"),
+		},
+		Request:  UpdateOrganizationRequest{},
+		Response: db.Organization{},
+	},
+	"GET /admin/stats": {
+		Summary:     "Platform statistics",
+		Description: "Get platform-wide counts of users, repositories and runs, and the run ingest rate over the last 24 hours (admin only)",
+		Tag:         "admin",
+		Response:    service.PlatformStats{},
+	},
+	"GET /admin/config": {
+		Summary:     "Inspect configuration",
+		Description: "Get the effective configuration keyed by environment variable, with secrets redacted (admin only)",
+		Tag:         "admin",
+		Response:    configResponse{},
+	},
+	"GET /admin/audit-events": {
+		Summary:     "List audit events",
+		Description: "Search the audit log of mutations made through the API, newest first (admin only)",
+		Tag:         "admin",
+		Params: []openapi.Param{
+			openapi.Query("actor", "GitHub username of the actor"),
+			openapi.Query("action", "Action, such as run.delete or budget.set"),
+			openapi.Query("resource_type", "Resource type, such as run, repository, organization or user"),
+			openapi.Query("resource_id", "Resource ID"),
+			openapi.Query("organization", "GitHub organization login"),
+			openapi.Query("from", "Start of the range (RFC3339)"),
+			openapi.Query("to", "End of the range (RFC3339)"),
+			openapi.QueryInt("page", "Page number").Default(1),
+			openapi.QueryInt("limit", "Items per page").Default(50),
+		},
+		Response: auditEventsResponse{},
+	},
+	"GET /admin/archive/manifest": {
+		Summary:     "Get archive manifest",
+		Description: "List the Parquet files of the run archive with their schema, for loading into DuckDB, Athena or Spark (admin only)",
+		Tag:         "admin",
+		Params: []openapi.Param{
+			openapi.Query("repository_id", "Repository ID"),
+			openapi.Query("from", "First day (YYYY-MM-DD)"),
+			openapi.Query("to", "Last day (YYYY-MM-DD)"),
+			openapi.QueryInt("page", "Page number").Default(1),
+			openapi.QueryInt("limit", "Items per page").Default(500),
+		},
+		Response: archiveManifestResponse{},
+	},
+	"GET /admin/jobs": {
+		Summary:     "List background jobs",
+		Description: "Get the background jobs with their schedules, next and last runs (admin only)",
+		Tag:         "admin",
+		Response:    jobsResponse{},
+	},
+	"GET /admin/jobs/:name": {
+		Summary:     "Get background job",
+		Description: "Get a background job with its recent runs, newest first (admin only)",
+		Tag:         "admin",
+		Params: []openapi.Param{
+			openapi.Path("name", "Job name"),
+		},
+		Response: jobResponse{},
+	},
+	"PATCH /admin/jobs/:name": {
+		Summary:     "Update background job",
+		Description: "Change the schedule of a background job or enable and disable it (admin only). A new schedule takes effect immediately.",
+		Tag:         "admin",
+		Params: []openapi.Param{
+			openapi.Path("name", "Job name"),
+		},
+		Request:  UpdateJobRequest{},
+		Response: db.Job{},
+	},
+	"POST /admin/jobs/:name/run": {
+		Summary:     "Run background job",
+		Description: "Start a run of a background job now, outside its schedule (admin only). The job runs in the background; poll the job for the outcome.",
+		Tag:         "admin",
+		Params: []openapi.Param{
+			openapi.Path("name", "Job name"),
+		},
+		Status:   http.StatusAccepted,
+		Response: db.JobRun{},
+	},
+	"GET /admin/flags": {
+		Summary:     "List feature flags",
+		Description: "Get the feature flags with their defaults and targeting (admin only)",
+		Tag:         "admin",
+		Response:    flagsResponse{},
+	},
+	"GET /admin/flags/:name": {
+		Summary:     "Get feature flag",
+		Description: "Get a feature flag with its default and targeting (admin only)",
+		Tag:         "admin",
+		Params: []openapi.Param{
+			openapi.Path("name", "Flag name"),
+		},
+		Response: flags.Flag{},
+	},
+	"PATCH /admin/flags/:name": {
+		Summary:     "Update feature flag",
+		Description: "Toggle a feature flag or change its targeting (admin only). A flag still on its default starts from it. Changes reach every instance within 30 seconds.",
+		Tag:         "admin",
+		Params: []openapi.Param{
+			openapi.Path("name", "Flag name"),
+		},
+		Request:  UpdateFlagRequest{},
+		Response: flags.Flag{},
+	},
+	"DELETE /admin/flags/:name": {
+		Summary:     "Reset feature flag",
+		Description: "Remove the overrides of a feature flag so it uses its default again (admin only)",
+		Tag:         "admin",
+		Params: []openapi.Param{
+			openapi.Path("name", "Flag name"),
+		},
+		Response: flags.Flag{},
+	},
+	"GET /admin/emission-factors": {
+		Summary:     "List emission factors",
+		Description: "Get the managed emission factors with their provenance, by region and most recent first (admin only)",
+		Tag:         "admin",
+		Params: []openapi.Param{
+			openapi.Query("region", "Only the factors of this region"),
+		},
+		Response: emissionFactorsResponse{},
+	},
+	"POST /admin/emission-factors": {
+		Summary:     "Create emission factor",
+		Description: "Record the grid carbon intensity of a region from a date, with its source and methodology (admin only). The effective periods of the factors of a region must not overlap.",
+		Tag:         "admin",
+		Status:      http.StatusCreated,
+		Request:     service.EmissionFactorRequest{},
+		Response:    db.EmissionFactor{},
+	},
+	"GET /admin/emission-factors/:factor_id": {
+		Summary:     "Get emission factor",
+		Description: "Get a managed emission factor with its provenance (admin only)",
+		Tag:         "admin",
+		Params: []openapi.Param{
+			openapi.Path("factor_id", "Emission factor UUID"),
+		},
+		Response: db.EmissionFactor{},
+	},
+	"PUT /admin/emission-factors/:factor_id": {
+		Summary:     "Update emission factor",
+		Description: "Replace a managed emission factor with its next version (admin only). Previous versions are kept, and the change is recorded in the audit log.",
+		Tag:         "admin",
+		Params: []openapi.Param{
+			openapi.Path("factor_id", "Emission factor UUID"),
+		},
+		Request:  service.EmissionFactorRequest{},
+		Response: db.EmissionFactor{},
+	},
+	"DELETE /admin/emission-factors/:factor_id": {
+		Summary:     "Delete emission factor",
+		Description: "Remove a managed emission factor; the days it covered fall back to the built-in factor of the region. Its versions are kept. (admin only)",
+		Tag:         "admin",
+		Params: []openapi.Param{
+			openapi.Path("factor_id", "Emission factor UUID"),
+		},
+		Response: messageResponse{},
+	},
+	"GET /admin/emission-factors/:factor_id/versions": {
+		Summary:     "List emission factor versions",
+		Description: "Get every version of an emission factor, including the deletion of a deleted factor, most recent first (admin only)",
+		Tag:         "admin",
+		Params: []openapi.Param{
+			openapi.Path("factor_id", "Emission factor UUID"),
+		},
+		Response: emissionFactorVersionsResponse{},
+	},
+	"GET /admin/recalculation-reports": {
+		Summary:     "List recalculation reports",
+		Description: "Get what the recalculations of the current-methodology CO2 of runs changed, newest first (admin only)",
+		Tag:         "admin",
+		Params: []openapi.Param{
+			openapi.QueryInt("limit", "Number of reports").Default(30),
+		},
+		Response: recalculationReportsResponse{},
+	},
+}
+
+// openAPIDocument generates the OpenAPI document of the routes served under APIPrefix
+func (s *Server) openAPIDocument() *openapi.Document {
+	var routes []openapi.Route
+	for _, route := range s.router.Routes() {
+		path, ok := strings.CutPrefix(route.Path, APIPrefix)
+		if !ok {
+			continue
+		}
+		operation, ok := routeOperations[route.Method+" "+path]
+		if !ok {
+			continue
+		}
+		routes = append(routes, openapi.Route{Method: route.Method, Path: path, ID: operationID(route.Handler), Operation: operation})
+	}
+
+	return openapi.Generate(openapi.Spec{
+		Info: openapi.Info{
+			Title:       "EcoCI Auth API",
+			Description: "Authentication and data management API for the EcoCI carbon footprint tracking system. Authenticated JSON responses report CO2 in kg and energy in kWh unless the request asks for other units with ?units=, such as g,Wh, or the user set display units; members are then renamed after their unit, such as co2_g, and the units are echoed as units.",
+			Version:     version.Version,
+		},
+		Servers: []openapi.Server{{URL: APIPrefix}},
+		Routes:  routes,
+		SecuritySchemes: map[string]*openapi.SecurityScheme{
+			"CookieAuth": {Type: "apiKey", In: "cookie", Name: "ecoci_token", Description: "JWT token stored in HttpOnly cookie"},
+			"BearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT", Description: "The same JWT as an API token, sent by CI integrations"},
+		},
+		Error:            problem.Problem{},
+		ErrorContentType: problem.ContentType,
+	})
+}
+
+// operationID derives the ID of an operation from the name of its handler, so
+// github.com/ecoci/auth-api/internal/api.(*Server).handleCreateRun-fm becomes createRun
+func operationID(handler string) string {
+	name := strings.TrimSuffix(handler[strings.LastIndex(handler, ".")+1:], "-fm")
+	name = strings.TrimPrefix(name, "handle")
+	if name == "" {
+		return ""
+	}
+	return strings.ToLower(name[:1]) + name[1:]
+}
+
+// OpenAPI document handler
+// @Summary Get OpenAPI document
+// @Description Get the OpenAPI 3 document of the API, generated from the routes the server registers
+// @Tags docs
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /openapi.json [get]
+func (s *Server) handleOpenAPI(c *gin.Context) {
+	// Routes are registered before the server starts, so the document never changes
+	s.openAPIOnce.Do(func() {
+		s.openAPI = s.openAPIDocument()
+	})
+	c.JSON(http.StatusOK, s.openAPI)
+}
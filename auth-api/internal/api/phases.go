@@ -0,0 +1,125 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// respondPhaseStats aggregates the steps of the runs in scope over the requested range by
+// phase and writes the result
+func (s *Server) respondPhaseStats(c *gin.Context, scope service.RunScope) {
+	from, to, ok := parseTimeRange(c, func(to time.Time) time.Time {
+		return to.AddDate(0, 0, -30)
+	})
+	if !ok {
+		return
+	}
+
+	phases, err := s.statsService.PhaseStats(scope, from, to)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "STATS_FETCH_FAILED", "Failed to fetch phase emissions")
+		return
+	}
+
+	c.JSON(http.StatusOK, phases)
+}
+
+// Repository phase emissions handler
+// @Summary Get repository phase emissions
+// @Description Get the energy, CO2 and duration of the steps of a repository's runs over a time range by phase (checkout, deps, build, test, deploy, other), with the share of the CO2 of the steps and the runs each phase dominates
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Success 200 {object} service.PhaseBreakdown
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/phases [get]
+func (s *Server) handleRepositoryPhaseStats(c *gin.Context) {
+	repo, ok := s.requireVisibleRepository(c)
+	if !ok {
+		return
+	}
+
+	s.respondPhaseStats(c, service.RepositoryRuns(repo.ID))
+}
+
+// User phase emissions handler
+// @Summary Get current user phase emissions
+// @Description Get the energy, CO2 and duration of the steps of the current user's runs over a time range by phase (checkout, deps, build, test, deploy, other), with the share of the CO2 of the steps and the runs each phase dominates
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Success 200 {object} service.PhaseBreakdown
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Router /me/phases [get]
+func (s *Server) handleUserPhaseStats(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	s.respondPhaseStats(c, service.UserRuns(userID))
+}
+
+// Organization phase emissions handler
+// @Summary Get organization phase emissions
+// @Description Get the energy, CO2 and duration of the steps of an organization's runs over a time range by phase (checkout, deps, build, test, deploy, other), with the share of the CO2 of the steps and the runs each phase dominates (members only)
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param org path string true "GitHub organization login"
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Success 200 {object} service.PhaseBreakdown
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /orgs/{org}/phases [get]
+func (s *Server) handleOrganizationPhaseStats(c *gin.Context) {
+	org, ok := s.requireOrganizationMember(c)
+	if !ok {
+		return
+	}
+
+	s.respondPhaseStats(c, service.OrganizationRuns(org.ID))
+}
+
+// Run timeline handler
+// @Summary Get run timeline
+// @Description Get the steps of a run in the order they ran with their phase, start and end offsets, duration, energy, CO2 and average power, shaped for a Gantt chart. Steps start at their start_offset_s, else when the step before them ended.
+// @Tags runs
+// @Security CookieAuth
+// @Security BearerAuth
+// @Produce json
+// @Param run_id path string true "Run UUID"
+// @Success 200 {object} service.RunTimeline
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /runs/{run_id}/timeline [get]
+func (s *Server) handleGetRunTimeline(c *gin.Context) {
+	run, ok := s.requireVisibleRun(c)
+	if !ok {
+		return
+	}
+
+	timeline := service.BuildRunTimeline(run)
+	if timeline == nil {
+		problem.Respond(c, http.StatusNotFound, "RUN_STEPS_NOT_FOUND", "Run has no step breakdown")
+		return
+	}
+
+	c.JSON(http.StatusOK, timeline)
+}
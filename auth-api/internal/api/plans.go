@@ -0,0 +1,183 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ecoci/auth-api/internal/config"
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/middleware"
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// PlanResponse describes the plan of a user or organization and what it holds against the
+// plan's quotas
+type PlanResponse struct {
+	Plan string `json:"plan" example:"free"`
+	// RateLimit is the number of API requests per rate limit window; it applies to users only
+	RateLimit *config.RatePlan    `json:"rate_limit,omitempty"`
+	Quota     service.Quota       `json:"quota"`
+	Usage     *service.QuotaUsage `json:"usage"`
+}
+
+// UpdateOrganizationRequest represents the organization state an administrator can change
+type UpdateOrganizationRequest struct {
+	// Plan is a plan of RATE_LIMIT_PLANS, or empty for the default plan
+	Plan *string `json:"plan" binding:"required" example:"pro"`
+}
+
+// planQuota returns the quotas of the named plan
+func (s *Server) planQuota(plan string) service.Quota {
+	return service.Quota(s.cfg.PlanQuota(plan))
+}
+
+// respondPlan responds with the plan of account and its usage
+func (s *Server) respondPlan(c *gin.Context, account *service.QuotaAccount, rateLimit *config.RatePlan) {
+	usage, err := s.quotaService.WithContext(c.Request.Context()).Usage(account, time.Now())
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "PLAN_USAGE_FETCH_FAILED", "Failed to get plan usage")
+		return
+	}
+
+	c.JSON(http.StatusOK, PlanResponse{
+		Plan:      s.cfg.PlanName(account.Plan),
+		RateLimit: rateLimit,
+		Quota:     s.quotaService.Quota(account),
+		Usage:     usage,
+	})
+}
+
+// respondQuotaExceeded responds to a request that would exceed a quota of a plan, returning
+// false for other errors. Exceeding the number of repositories requires a larger plan (402);
+// monthly runs are accepted again once the month starts over (429).
+func (s *Server) respondQuotaExceeded(c *gin.Context, err error) bool {
+	var quotaErr *service.QuotaError
+	if !errors.As(err, &quotaErr) {
+		return false
+	}
+
+	plan := s.cfg.PlanName(quotaErr.Plan)
+	if quotaErr.Resource == service.QuotaRepositories {
+		problem.Write(c, problem.New(http.StatusPaymentRequired, "PLAN_REPOSITORY_LIMIT_REACHED", "Repository limit of the plan reached").
+			With("plan", plan).
+			With("limit", quotaErr.Limit))
+		return true
+	}
+
+	c.Header(middleware.RetryAfterHeader, strconv.Itoa(int(math.Ceil(time.Until(quotaErr.ResetAt).Seconds()))))
+	problem.Write(c, problem.New(http.StatusTooManyRequests, "PLAN_RUN_LIMIT_REACHED", "Monthly run limit of the plan reached").
+		With("plan", plan).
+		With("limit", quotaErr.Limit).
+		With("reset_at", quotaErr.ResetAt))
+	return true
+}
+
+// Get my plan handler
+// @Summary Get my plan
+// @Description Get the plan of the current user with its rate limit and the quotas and usage of their personal repositories. Repositories of an organization count against the organization's plan.
+// @Tags plans
+// @Security CookieAuth
+// @Produce json
+// @Success 200 {object} PlanResponse
+// @Failure 401 {object} problem.Problem
+// @Router /me/plan [get]
+func (s *Server) handleGetMyPlan(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	account, err := s.quotaService.WithContext(c.Request.Context()).UserAccount(userID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "PLAN_FETCH_FAILED", "Failed to get plan")
+		return
+	}
+
+	rateLimit := s.cfg.RatePlan(account.Plan)
+	s.respondPlan(c, account, &rateLimit)
+}
+
+// Get organization plan handler
+// @Summary Get organization plan
+// @Description Get the plan of an organization with the quotas and usage of its repositories (members only)
+// @Tags plans
+// @Security CookieAuth
+// @Produce json
+// @Param org path string true "GitHub organization login"
+// @Success 200 {object} PlanResponse
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /orgs/{org}/plan [get]
+func (s *Server) handleGetOrganizationPlan(c *gin.Context) {
+	org, ok := s.requireOrganizationMember(c)
+	if !ok {
+		return
+	}
+
+	s.respondPlan(c, s.quotaService.OrganizationAccount(org), nil)
+}
+
+// Update organization handler
+// @Summary Update organization
+// @Description Assign a plan to an organization, which sets the quotas of its repositories (admin only)
+// @Tags admin
+// @Security CookieAuth
+// @Accept json
+// @Produce json
+// @Param org path string true "GitHub organization login"
+// @Param organization body UpdateOrganizationRequest true "Organization state"
+// @Success 200 {object} db.Organization
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /admin/orgs/{org} [patch]
+func (s *Server) handleAdminUpdateOrganization(c *gin.Context) {
+	org, err := s.orgService.GetOrganizationByLogin(c.Param("org"))
+	if err != nil {
+		problem.Respond(c, http.StatusNotFound, "ORGANIZATION_NOT_FOUND", "Organization not found")
+		return
+	}
+
+	var req UpdateOrganizationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body", err.Error())
+		return
+	}
+	if *req.Plan != "" {
+		if _, ok := s.cfg.RateLimitPlans[*req.Plan]; !ok {
+			problem.Respond(c, http.StatusBadRequest, "INVALID_PLAN", "Unknown plan")
+			return
+		}
+	}
+
+	updated, err := s.orgService.SetPlan(org.ID, *req.Plan)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "ORGANIZATION_UPDATE_FAILED", "Failed to update organization")
+		return
+	}
+
+	s.recordAudit(c, auditOrganization("organization.update", updated, service.AuditDiff(
+		organizationAuditFields(org),
+		organizationAuditFields(updated),
+	)))
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// organizationAuditFields returns the audited state of an organization
+func organizationAuditFields(org *db.Organization) map[string]interface{} {
+	fields := map[string]interface{}{
+		"plan": nil,
+	}
+	if org.Plan != nil {
+		fields["plan"] = *org.Plan
+	}
+	return fields
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// Get preferences handler
+// @Summary Get preferences
+// @Description Get the settings of the current user: time zone, locale, default date range in days, display units, the optional emails they receive, the Slack member ID direct messages are sent to and who sees their profile. Settings never changed have their defaults.
+// @Tags users
+// @Security CookieAuth
+// @Produce json
+// @Success 200 {object} service.Preferences
+// @Failure 401 {object} problem.Problem
+// @Router /me/preferences [get]
+func (s *Server) handleGetPreferences(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	user, err := s.userService.GetUserByID(userID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "USER_FETCH_FAILED", "Failed to get user information")
+		return
+	}
+	preferences, err := s.userService.GetPreferences(user)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "PREFERENCES_FETCH_FAILED", "Failed to get preferences")
+		return
+	}
+
+	c.JSON(http.StatusOK, preferences)
+}
+
+// Update preferences handler
+// @Summary Update preferences
+// @Description Change settings of the current user; omitted settings are unchanged. Weekly report emails cover the calendar week of the user's time zone and report CO2 and energy in their display units.
+// @Tags users
+// @Security CookieAuth
+// @Accept json
+// @Produce json
+// @Param preferences body service.PreferencesRequest true "Settings to change"
+// @Success 200 {object} service.Preferences
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Router /me/preferences [patch]
+func (s *Server) handleUpdatePreferences(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req service.PreferencesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body", err.Error())
+		return
+	}
+	if err := service.ValidatePreferences(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_PREFERENCES", "Invalid preferences", err.Error())
+		return
+	}
+
+	var before map[string]interface{}
+	if user, err := s.userService.GetUserByID(userID); err == nil {
+		if preferences, err := s.userService.GetPreferences(user); err == nil {
+			before = preferencesAuditFields(preferences)
+		}
+	}
+
+	preferences, err := s.userService.UpdatePreferences(userID, &req)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "PREFERENCES_UPDATE_FAILED", "Failed to update preferences")
+		return
+	}
+
+	s.recordAudit(c, auditUser("preferences.update", userID, service.AuditDiff(before, preferencesAuditFields(preferences))))
+
+	c.JSON(http.StatusOK, preferences)
+}
+
+// preferencesAuditFields returns the audited settings of a user
+func preferencesAuditFields(preferences *service.Preferences) map[string]interface{} {
+	fields := map[string]interface{}{
+		"timezone":           preferences.Timezone,
+		"locale":             preferences.Locale,
+		"default_range_days": preferences.DefaultRangeDays,
+		"profile_visibility": preferences.ProfileVisibility,
+		"profile_stats":      preferences.ProfileStats,
+	}
+	if preferences.SlackUserID != nil {
+		fields["slack_user_id"] = *preferences.SlackUserID
+	}
+	for key, value := range displayUnitsAuditFields(preferences.DisplayUnits) {
+		fields["display_units."+key] = value
+	}
+	for key, value := range emailPreferencesAuditFields(&preferences.Email) {
+		fields["email."+key] = value
+	}
+	return fields
+}
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/github"
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// User profile handler
+// @Summary Get user profile
+// @Description Get the profile of a user by ID or GitHub username: their name, avatar, the CO2 badges of their public repositories that opted into public stats and, when they chose to show them, their all-time statistics over the runs in repositories the caller can see. Profiles are private until their user makes them visible to members of a shared organization or to everyone, including anonymous callers; hidden profiles are reported as not found.
+// @Tags users
+// @Produce json
+// @Param user path string true "User UUID or GitHub username"
+// @Success 200 {object} service.Profile
+// @Failure 404 {object} problem.Problem
+// @Router /users/{user} [get]
+func (s *Server) handleGetUserProfile(c *gin.Context) {
+	// Anonymous callers only see public profiles
+	viewerID := uuid.Nil
+	if value, exists := c.Get("user_id"); exists {
+		viewerID = value.(uuid.UUID)
+	}
+
+	user, settings, ok := s.requireVisibleUser(c, viewerID)
+	if !ok {
+		return
+	}
+
+	profile := service.Profile{
+		ID:             user.ID,
+		GitHubUsername: user.GitHubUsername,
+		Name:           user.Name,
+		AvatarURL:      user.AvatarURL,
+		Visibility:     settings.ProfileVisibility,
+		CreatedAt:      user.CreatedAt,
+	}
+	if settings.ProfileStats || user.ID == viewerID {
+		scope := service.UserRunsVisibleTo(user.ID, viewerID)
+		if user.ID == viewerID {
+			scope = service.UserRuns(user.ID)
+		}
+		stats, err := s.runService.GetUserStats(scope, user.CreatedAt, time.Now().UTC())
+		if err != nil {
+			problem.Respond(c, http.StatusInternalServerError, "STATS_FETCH_FAILED", "Failed to fetch statistics")
+			return
+		}
+		profile.Stats = stats
+	}
+
+	badges, err := s.repoService.ProfileBadges(user.ID, s.cfg.BadgeURL)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "BADGES_FETCH_FAILED", "Failed to list badges")
+		return
+	}
+	profile.Badges = badges
+
+	c.JSON(http.StatusOK, profile)
+}
+
+// requireVisibleUser resolves the user path parameter, a user ID or GitHub username, to a user
+// whose profile viewerID may see, with their profile settings. Hidden profiles are reported
+// as not found.
+func (s *Server) requireVisibleUser(c *gin.Context, viewerID uuid.UUID) (*db.User, *db.UserPreference, bool) {
+	value := c.Param("user")
+	var user *db.User
+	var err error
+	if userID, parseErr := uuid.Parse(value); parseErr == nil {
+		user, err = s.userService.GetUserByID(userID)
+	} else {
+		user, err = s.userService.GetUserByGitHubUsername(value)
+	}
+	if err != nil {
+		problem.Respond(c, http.StatusNotFound, "USER_NOT_FOUND", "User not found")
+		return nil, nil, false
+	}
+
+	visible, settings, err := s.userService.CanViewProfile(user, viewerID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "PROFILE_FETCH_FAILED", "Failed to get profile")
+		return nil, nil, false
+	}
+	if !visible {
+		problem.Respond(c, http.StatusNotFound, "USER_NOT_FOUND", "User not found")
+		return nil, nil, false
+	}
+	return user, settings, true
+}
+
+// Refresh profile handler
+// @Summary Refresh GitHub profile
+// @Description Re-read the GitHub profile (username, name, avatar and email) of the current user and the metadata of the repositories they own with the GitHub token of their last sign-in, instead of signing in again. Repositories GitHub no longer shows are listed as unavailable and left unchanged. A token GitHub rejects is forgotten.
+// @Tags users
+// @Security CookieAuth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Failure 502 {object} problem.Problem
+// @Router /me/refresh [post]
+func (s *Server) handleRefreshProfile(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	credential, err := s.userService.GetGitHubCredential(userID)
+	if errors.Is(err, service.ErrGitHubCredentialMissing) {
+		problem.Respond(c, http.StatusConflict, "GITHUB_CREDENTIALS_MISSING", "No GitHub credentials are stored; sign in with GitHub again")
+		return
+	}
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "GITHUB_CREDENTIALS_FETCH_FAILED", "Failed to get GitHub credentials")
+		return
+	}
+
+	client := s.githubClient.WithToken(credential.AccessToken)
+	profile, err := client.AuthenticatedUser(c.Request.Context())
+	if errors.Is(err, github.ErrUnauthorized) {
+		if err := s.userService.DeleteGitHubCredential(userID); err != nil {
+			log.Printf("Failed to delete revoked GitHub credentials of user %s: %v", userID, err)
+		}
+		problem.Respond(c, http.StatusConflict, "GITHUB_CREDENTIALS_REVOKED", "GitHub rejected the stored credentials; sign in with GitHub again")
+		return
+	}
+	if err != nil {
+		problem.Respond(c, http.StatusBadGateway, "GITHUB_PROFILE_FETCH_FAILED", "Failed to read the profile from GitHub")
+		return
+	}
+
+	var before map[string]interface{}
+	if user, err := s.userService.GetUserByID(userID); err == nil {
+		before = profileAuditFields(user)
+	}
+	user, err := s.userService.RefreshGitHubProfile(userID, profile)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "PROFILE_UPDATE_FAILED", "Failed to update profile")
+		return
+	}
+
+	repos, err := s.repoService.ListOwnedRepositories(userID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "REPOSITORIES_FETCH_FAILED", "Failed to list repositories")
+		return
+	}
+	refreshed := []db.Repository{}
+	unavailable := []string{}
+	for i := range repos {
+		repo := &repos[i]
+		metadata, err := client.Repository(c.Request.Context(), repo.FullName)
+		if err == nil {
+			repo, err = s.repoService.RefreshFromGitHub(repo, metadata)
+		}
+		if err != nil {
+			if !errors.Is(err, github.ErrNotFound) {
+				log.Printf("Failed to refresh repository %s from GitHub: %v", repos[i].FullName, err)
+			}
+			unavailable = append(unavailable, repos[i].FullName)
+			continue
+		}
+		s.invalidateRepositoryCaches(c.Request.Context(), repo.ID)
+		s.publishRepoUpdated(repo)
+		refreshed = append(refreshed, *repo)
+	}
+
+	s.recordAudit(c, auditUser("profile.refresh", userID, service.AuditDiff(before, profileAuditFields(user))))
+
+	c.JSON(http.StatusOK, gin.H{
+		"user":         user,
+		"repositories": refreshed,
+		"unavailable":  unavailable,
+	})
+}
+
+// profileAuditFields returns the fields of a user read from their GitHub profile
+func profileAuditFields(user *db.User) map[string]interface{} {
+	fields := map[string]interface{}{
+		"github_username": user.GitHubUsername,
+	}
+	if user.Name != nil {
+		fields["name"] = *user.Name
+	}
+	if user.AvatarURL != nil {
+		fields["avatar_url"] = *user.AvatarURL
+	}
+	if user.GitHubEmail != nil {
+		fields["github_email"] = *user.GitHubEmail
+	}
+	return fields
+}
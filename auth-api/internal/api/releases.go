@@ -0,0 +1,49 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// Release statistics handler
+// @Summary Get release statistics
+// @Description Sum the CI that produced a release: the runs of a repository after the last run of the previous tag up to the last run submitted with the tag as git_tag
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param tag path string true "Git tag of the release"
+// @Success 200 {object} service.ReleaseStats
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/releases/{tag}/stats [get]
+func (s *Server) handleReleaseStats(c *gin.Context) {
+	repo, ok := s.requireVisibleRepository(c)
+	if !ok {
+		return
+	}
+
+	tag := c.Param("tag")
+	if len(tag) > service.MaxGitTagLength {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_GIT_TAG", "Git tag must be at most 255 characters")
+		return
+	}
+
+	stats, err := s.statsService.ReleaseStats(repo.ID, tag)
+	if errors.Is(err, service.ErrReleaseNotFound) {
+		problem.Respond(c, http.StatusNotFound, "RELEASE_NOT_FOUND", "No runs found for tag")
+		return
+	}
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "STATS_FETCH_FAILED", "Failed to fetch release statistics")
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// Get retention policy handler
+// @Summary Get retention policy
+// @Description Get how long the runs and rollups of the repositories of an organization are kept (members only). Organizations without a policy keep their data forever.
+// @Tags retention
+// @Security CookieAuth
+// @Produce json
+// @Param org path string true "GitHub organization login"
+// @Success 200 {object} db.RetentionPolicy
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /orgs/{org}/retention [get]
+func (s *Server) handleGetRetentionPolicy(c *gin.Context) {
+	org, ok := s.requireOrganizationMember(c)
+	if !ok {
+		return
+	}
+
+	policy, err := s.retentionService.GetPolicy(org.ID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "RETENTION_POLICY_FETCH_FAILED", "Failed to get retention policy")
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// Set retention policy handler
+// @Summary Set retention policy
+// @Description Set how long the runs and rollups of the repositories of an organization are kept (organization admins only). Expired runs are deleted daily after their totals are kept in the daily rollups; rollups must be kept at least as long as runs. In dry-run mode the daily reports only count what would be deleted.
+// @Tags retention
+// @Security CookieAuth
+// @Accept json
+// @Produce json
+// @Param org path string true "GitHub organization login"
+// @Param policy body service.RetentionPolicyRequest true "Retention policy"
+// @Success 200 {object} db.RetentionPolicy
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /orgs/{org}/retention [put]
+func (s *Server) handleSetRetentionPolicy(c *gin.Context) {
+	org, ok := s.requireOrganizationAdmin(c)
+	if !ok {
+		return
+	}
+
+	var req service.RetentionPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body", err.Error())
+		return
+	}
+	if err := service.ValidateRetentionPolicy(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_RETENTION_POLICY", "Invalid retention policy", err.Error())
+		return
+	}
+
+	var before map[string]interface{}
+	if previous, err := s.retentionService.GetPolicy(org.ID); err == nil {
+		before = retentionPolicyAuditFields(previous)
+	}
+
+	policy, err := s.retentionService.SetPolicy(org.ID, &req)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "RETENTION_POLICY_SAVE_FAILED", "Failed to save retention policy")
+		return
+	}
+
+	s.recordAudit(c, auditOrganization("retention_policy.set", org, service.AuditDiff(before, retentionPolicyAuditFields(policy))))
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// Delete retention policy handler
+// @Summary Delete retention policy
+// @Description Remove the retention policy of an organization so its data is kept forever (organization admins only)
+// @Tags retention
+// @Security CookieAuth
+// @Produce json
+// @Param org path string true "GitHub organization login"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /orgs/{org}/retention [delete]
+func (s *Server) handleDeleteRetentionPolicy(c *gin.Context) {
+	org, ok := s.requireOrganizationAdmin(c)
+	if !ok {
+		return
+	}
+
+	previous, err := s.retentionService.GetPolicy(org.ID)
+	if err == nil {
+		err = s.retentionService.DeletePolicy(org.ID)
+	}
+	if err != nil {
+		problem.Respond(c, http.StatusNotFound, "RETENTION_POLICY_NOT_FOUND", "Retention policy not found")
+		return
+	}
+
+	s.recordAudit(c, auditOrganization("retention_policy.delete", org, service.AuditDiff(retentionPolicyAuditFields(previous), nil)))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Retention policy deleted",
+	})
+}
+
+// retentionPolicyAuditFields returns the audited fields of a retention policy; a retention
+// of nil keeps data forever
+func retentionPolicyAuditFields(policy *db.RetentionPolicy) map[string]interface{} {
+	fields := map[string]interface{}{
+		"run_retention_days":    nil,
+		"rollup_retention_days": nil,
+		"dry_run":               policy.DryRun,
+	}
+	if policy.RunRetentionDays != nil {
+		fields["run_retention_days"] = *policy.RunRetentionDays
+	}
+	if policy.RollupRetentionDays != nil {
+		fields["rollup_retention_days"] = *policy.RollupRetentionDays
+	}
+	return fields
+}
+
+// List retention reports handler
+// @Summary List retention reports
+// @Description Get what the daily retention runs deleted, or would have deleted in dry-run mode, newest first (members only)
+// @Tags retention
+// @Security CookieAuth
+// @Produce json
+// @Param org path string true "GitHub organization login"
+// @Param limit query int false "Number of reports" default(30)
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /orgs/{org}/retention/reports [get]
+func (s *Server) handleListRetentionReports(c *gin.Context) {
+	org, ok := s.requireOrganizationMember(c)
+	if !ok {
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "30"))
+	if limit < 1 || limit > 100 {
+		limit = 30
+	}
+
+	reports, err := s.retentionService.ListReports(org.ID, limit)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "RETENTION_REPORTS_FETCH_FAILED", "Failed to list retention reports")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reports": reports,
+	})
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// verifyRunSignature checks the signature of a run body for the repository fullName of a user
+// when the repository requires signed runs. Missing, invalid and expired signatures are
+// rejected with 401.
+func (s *Server) verifyRunSignature(c *gin.Context, userID uuid.UUID, fullName string, body []byte) bool {
+	secret, err := s.repoService.RunSigningSecret(userID, fullName)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "RUN_SIGNATURE_CHECK_FAILED", "Failed to check run signature")
+		return false
+	}
+	if secret == "" {
+		return true
+	}
+
+	err = service.VerifyRunSignature(secret, c.GetHeader(service.HeaderRunSignature), c.GetHeader(service.HeaderRunTimestamp), body, time.Now())
+	switch {
+	case errors.Is(err, service.ErrRunSignatureMissing):
+		problem.RespondDetail(c, http.StatusUnauthorized, "RUN_SIGNATURE_MISSING", "Run signature missing",
+			"Runs for "+fullName+" must be signed with the "+service.HeaderRunTimestamp+" and "+service.HeaderRunSignature+" headers")
+		return false
+	case errors.Is(err, service.ErrRunSignatureExpired):
+		problem.RespondDetail(c, http.StatusUnauthorized, "RUN_SIGNATURE_EXPIRED", "Run signature expired",
+			"The run timestamp must be within 5 minutes of the server time")
+		return false
+	case err != nil:
+		problem.Respond(c, http.StatusUnauthorized, "RUN_SIGNATURE_INVALID", "Run signature invalid")
+		return false
+	}
+	return true
+}
+
+// Enable signed runs handler
+// @Summary Require signed runs
+// @Description Generate a new run signing secret for a repository, replacing any previous one, and reject runs for it that are not signed with the secret from now on (repository owner only). The secret is only returned in this response.
+// @Tags repositories
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/run-signing-secret [post]
+func (s *Server) handleEnableSignedRuns(c *gin.Context) {
+	repo, ok := s.requireRepositoryOwner(c)
+	if !ok {
+		return
+	}
+
+	updated, secret, err := s.repoService.EnableSignedRuns(repo.ID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "REPOSITORY_UPDATE_FAILED", "Failed to update repository settings")
+		return
+	}
+
+	s.invalidateRepositoryCaches(c.Request.Context(), repo.ID)
+	s.recordAudit(c, auditRepository("run_signing_secret.set", repo, service.AuditDiff(
+		repositorySettingsAuditFields(repo),
+		repositorySettingsAuditFields(updated),
+	)))
+	s.publishRepoUpdated(updated)
+
+	c.JSON(http.StatusOK, gin.H{
+		"repository": updated,
+		"secret":     secret,
+	})
+}
+
+// Disable signed runs handler
+// @Summary Stop requiring signed runs
+// @Description Forget the run signing secret of a repository, which accepts unsigned runs again (repository owner only)
+// @Tags repositories
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Success 200 {object} db.Repository
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/run-signing-secret [delete]
+func (s *Server) handleDisableSignedRuns(c *gin.Context) {
+	repo, ok := s.requireRepositoryOwner(c)
+	if !ok {
+		return
+	}
+
+	updated, err := s.repoService.DisableSignedRuns(repo.ID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "REPOSITORY_UPDATE_FAILED", "Failed to update repository settings")
+		return
+	}
+
+	s.invalidateRepositoryCaches(c.Request.Context(), repo.ID)
+	s.recordAudit(c, auditRepository("run_signing_secret.delete", repo, service.AuditDiff(
+		repositorySettingsAuditFields(repo),
+		repositorySettingsAuditFields(updated),
+	)))
+	s.publishRepoUpdated(updated)
+
+	c.JSON(http.StatusOK, updated)
+}
@@ -0,0 +1,211 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// requireSavedView resolves the view_id path parameter to a saved view of the current user;
+// views of other users are reported as not found
+func (s *Server) requireSavedView(c *gin.Context) (*db.SavedView, bool) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return nil, false
+	}
+
+	viewID, err := uuid.Parse(c.Param("view_id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_SAVED_VIEW_ID", "Invalid saved view ID")
+		return nil, false
+	}
+
+	view, err := s.savedViewService.GetView(viewID)
+	if err != nil || view.UserID != userID {
+		problem.Respond(c, http.StatusNotFound, "SAVED_VIEW_NOT_FOUND", "Saved view not found")
+		return nil, false
+	}
+
+	return view, true
+}
+
+// bindSavedView binds and validates a saved view request and checks the current user can see
+// its repository, if any
+func (s *Server) bindSavedView(c *gin.Context, userID uuid.UUID) (*service.SavedViewRequest, bool) {
+	var req service.SavedViewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body", err.Error())
+		return nil, false
+	}
+	if err := service.ValidateSavedView(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_SAVED_VIEW", "Invalid saved view", err.Error())
+		return nil, false
+	}
+
+	if req.RepositoryID != nil {
+		visible, err := s.repoService.CanViewRepository(*req.RepositoryID, userID)
+		if err != nil || !visible {
+			problem.Respond(c, http.StatusNotFound, "REPOSITORY_NOT_FOUND", "Repository not found")
+			return nil, false
+		}
+	}
+
+	return &req, true
+}
+
+// respondSavedViewError writes the response of a failed write of a saved view
+func respondSavedViewError(c *gin.Context, err error, code, message string) {
+	if errors.Is(err, service.ErrSavedViewNameTaken) {
+		problem.Respond(c, http.StatusConflict, "SAVED_VIEW_EXISTS", "A saved view of the same name already exists")
+		return
+	}
+	problem.Respond(c, http.StatusInternalServerError, code, message)
+}
+
+// List saved views handler
+// @Summary List saved views
+// @Description Get the saved views of the current user by name
+// @Tags views
+// @Security CookieAuth
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} problem.Problem
+// @Router /saved-views [get]
+func (s *Server) handleListSavedViews(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	views, err := s.savedViewService.ListViews(userID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "SAVED_VIEWS_FETCH_FAILED", "Failed to list saved views")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"views": views,
+	})
+}
+
+// Create saved view handler
+// @Summary Create saved view
+// @Description Bookmark a recurring query of runs, such as the main branch's nightly runs of the last 90 days: a filter expression, sort field and order, aggregate grouping and a date range of the last range_days days, optionally of one repository. Names are unique per user.
+// @Tags views
+// @Security CookieAuth
+// @Accept json
+// @Produce json
+// @Param view body service.SavedViewRequest true "Saved view"
+// @Success 201 {object} db.SavedView
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Router /saved-views [post]
+func (s *Server) handleCreateSavedView(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	req, ok := s.bindSavedView(c, userID)
+	if !ok {
+		return
+	}
+
+	view, err := s.savedViewService.CreateView(userID, req)
+	if err != nil {
+		respondSavedViewError(c, err, "SAVED_VIEW_CREATION_FAILED", "Failed to create saved view")
+		return
+	}
+
+	c.JSON(http.StatusCreated, view)
+}
+
+// Get saved view handler
+// @Summary Get saved view
+// @Description Get a saved view of the current user
+// @Tags views
+// @Security CookieAuth
+// @Produce json
+// @Param view_id path string true "Saved view UUID"
+// @Success 200 {object} db.SavedView
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /saved-views/{view_id} [get]
+func (s *Server) handleGetSavedView(c *gin.Context) {
+	view, ok := s.requireSavedView(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, view)
+}
+
+// Update saved view handler
+// @Summary Update saved view
+// @Description Replace a saved view of the current user
+// @Tags views
+// @Security CookieAuth
+// @Accept json
+// @Produce json
+// @Param view_id path string true "Saved view UUID"
+// @Param view body service.SavedViewRequest true "Saved view"
+// @Success 200 {object} db.SavedView
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Router /saved-views/{view_id} [put]
+func (s *Server) handleUpdateSavedView(c *gin.Context) {
+	view, ok := s.requireSavedView(c)
+	if !ok {
+		return
+	}
+	req, ok := s.bindSavedView(c, view.UserID)
+	if !ok {
+		return
+	}
+
+	updated, err := s.savedViewService.UpdateView(view, req)
+	if err != nil {
+		respondSavedViewError(c, err, "SAVED_VIEW_UPDATE_FAILED", "Failed to update saved view")
+		return
+	}
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// Delete saved view handler
+// @Summary Delete saved view
+// @Description Remove a saved view of the current user
+// @Tags views
+// @Security CookieAuth
+// @Produce json
+// @Param view_id path string true "Saved view UUID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /saved-views/{view_id} [delete]
+func (s *Server) handleDeleteSavedView(c *gin.Context) {
+	view, ok := s.requireSavedView(c)
+	if !ok {
+		return
+	}
+
+	if err := s.savedViewService.DeleteView(view.ID); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "SAVED_VIEW_DELETION_FAILED", "Failed to delete saved view")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Saved view deleted",
+	})
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// BaselineRequest represents the reference period a baseline is frozen from
+type BaselineRequest struct {
+	From string `json:"from" binding:"required"`
+	To   string `json:"to" binding:"required"`
+}
+
+// Get repository baseline handler
+// @Summary Get repository baseline
+// @Description Get the frozen baseline rates of a repository
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Success 200 {object} db.RepositoryBaseline
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/baseline [get]
+func (s *Server) handleGetBaseline(c *gin.Context) {
+	repo, ok := s.requireVisibleRepository(c)
+	if !ok {
+		return
+	}
+
+	baseline, err := s.statsService.GetBaseline(repo.ID)
+	if err != nil {
+		problem.Respond(c, http.StatusNotFound, "BASELINE_NOT_FOUND", "Baseline not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, baseline)
+}
+
+// baselineAuditFields returns the audited fields of a baseline
+func baselineAuditFields(baseline *db.RepositoryBaseline) map[string]interface{} {
+	return map[string]interface{}{
+		"period_from":        baseline.PeriodFrom.UTC().Format(time.RFC3339),
+		"period_to":          baseline.PeriodTo.UTC().Format(time.RFC3339),
+		"co2_kg_per_run":     baseline.CO2KgPerRun,
+		"energy_kwh_per_run": baseline.EnergyKWhPerRun,
+	}
+}
+
+// Set repository baseline handler
+// @Summary Set repository baseline
+// @Description Freeze the per-run CO2 and energy rates of a reference period as the repository baseline (repository owner only)
+// @Tags statistics
+// @Security CookieAuth
+// @Accept json
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param baseline body BaselineRequest true "Baseline period (RFC3339 or YYYY-MM-DD)"
+// @Success 200 {object} db.RepositoryBaseline
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/baseline [put]
+func (s *Server) handleSetBaseline(c *gin.Context) {
+	repo, ok := s.requireRepositoryOwner(c)
+	if !ok {
+		return
+	}
+
+	var req BaselineRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body", err.Error())
+		return
+	}
+
+	from, fromErr := parseTimeSeriesTime(req.From)
+	to, toErr := parseTimeSeriesTime(req.To)
+	if fromErr != nil || toErr != nil || !from.Before(to) {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_TIME_RANGE", "Invalid baseline period, expected from before to as RFC3339 or YYYY-MM-DD")
+		return
+	}
+
+	var before map[string]interface{}
+	if previous, err := s.statsService.GetBaseline(repo.ID); err == nil {
+		before = baselineAuditFields(previous)
+	}
+
+	baseline, err := s.statsService.FreezeBaseline(repo.ID, from, to)
+	if err != nil {
+		if err.Error() == "baseline period has no runs" {
+			problem.Respond(c, http.StatusBadRequest, "EMPTY_BASELINE_PERIOD", "Baseline period has no runs")
+			return
+		}
+		problem.Respond(c, http.StatusInternalServerError, "BASELINE_UPDATE_FAILED", "Failed to set baseline")
+		return
+	}
+
+	s.recordAudit(c, auditRepository("baseline.set", repo, service.AuditDiff(before, baselineAuditFields(baseline))))
+
+	c.JSON(http.StatusOK, baseline)
+}
+
+// Savings report handler
+// @Summary Get savings versus baseline
+// @Description Compare a repository's actual CO2 and energy with what its runs would have emitted at the frozen baseline rates
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD), defaults to the end of the baseline period"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Success 200 {object} service.SavingsReport
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/savings [get]
+func (s *Server) handleSavings(c *gin.Context) {
+	repo, ok := s.requireVisibleRepository(c)
+	if !ok {
+		return
+	}
+
+	baseline, err := s.statsService.GetBaseline(repo.ID)
+	if err != nil {
+		problem.Respond(c, http.StatusNotFound, "BASELINE_NOT_FOUND", "Baseline not found, set one with PUT /repos/{repo_id}/baseline")
+		return
+	}
+
+	from, to, ok := parseTimeRange(c, func(time.Time) time.Time {
+		return baseline.PeriodTo
+	})
+	if !ok {
+		return
+	}
+
+	report, err := s.statsService.Savings(repo.ID, from, to)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "STATS_FETCH_FAILED", "Failed to compute savings")
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
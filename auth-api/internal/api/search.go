@@ -0,0 +1,101 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/problem"
+)
+
+// maxSearchQueryLength bounds the search query
+const maxSearchQueryLength = 256
+
+// Search runs handler
+// @Summary Search runs
+// @Description Find runs of repositories the current user can see by workflow, branch, commit or metadata values such as tags and commit messages. On PostgreSQL q is a web search query ("quoted phrases", or, -excluded words) and runs are ordered by relevance, then newest first.
+// @Tags runs
+// @Security CookieAuth
+// @Produce json
+// @Param q query string true "Search query"
+// @Param repository_id query string false "Repository UUID to search within"
+// @Param filter query string false "Filter expression, such as co2_kg>0.5 AND branch=main AND tag IN (nightly,release)"
+// @Param sort query string false "Sort field (created_at, co2_kg, energy_kwh, duration_s), by relevance when omitted"
+// @Param order query string false "Sort order (asc, desc)" default(desc)
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Router /runs/search [get]
+func (s *Server) handleSearchRuns(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		problem.Respond(c, http.StatusBadRequest, "MISSING_QUERY", "Missing search query q")
+		return
+	}
+	if len(q) > maxSearchQueryLength {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_QUERY", "Search query must be at most 256 characters")
+		return
+	}
+
+	var repoID *uuid.UUID
+	if raw := c.Query("repository_id"); raw != "" {
+		parsed, err := uuid.Parse(raw)
+		if err != nil {
+			problem.Respond(c, http.StatusBadRequest, "INVALID_REPOSITORY_ID", "Invalid repository ID")
+			return
+		}
+		repoID = &parsed
+	}
+
+	expr, ok := parseRunFilter(c)
+	if !ok {
+		return
+	}
+	// Without a sort field runs are ordered by relevance
+	sortBy, order, ok := parseRunSort(c, "")
+	if !ok {
+		return
+	}
+
+	// Parse pagination parameters
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	offset := (page - 1) * limit
+
+	runs, total, err := s.runService.WithContext(c.Request.Context()).SearchRuns(userID, q, repoID, expr, limit, offset, sortBy, order)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "RUNS_SEARCH_FAILED", "Failed to search runs")
+		return
+	}
+
+	// Calculate pagination info
+	totalPages := (total + int64(limit) - 1) / int64(limit)
+
+	c.JSON(http.StatusOK, gin.H{
+		"runs": runs,
+		"pagination": gin.H{
+			"page":     page,
+			"limit":    limit,
+			"total":    total,
+			"pages":    totalPages,
+			"has_next": int64(page) < totalPages,
+			"has_prev": page > 1,
+		},
+	})
+}
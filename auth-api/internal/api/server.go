@@ -1,32 +1,94 @@
 package api
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"golang.org/x/time/rate"
 	"gorm.io/gorm"
 
+	"github.com/ecoci/auth-api/internal/alerts"
+	"github.com/ecoci/auth-api/internal/archive"
 	"github.com/ecoci/auth-api/internal/auth"
+	"github.com/ecoci/auth-api/internal/cache"
+	"github.com/ecoci/auth-api/internal/carbon"
+	"github.com/ecoci/auth-api/internal/bigquery"
+	"github.com/ecoci/auth-api/internal/commitstatus"
 	"github.com/ecoci/auth-api/internal/config"
+	"github.com/ecoci/auth-api/internal/eventbus"
+	"github.com/ecoci/auth-api/internal/github"
+	"github.com/ecoci/auth-api/internal/gql"
+	"github.com/ecoci/auth-api/internal/flags"
+	"github.com/ecoci/auth-api/internal/jobs"
+	"github.com/ecoci/auth-api/internal/mail"
 	"github.com/ecoci/auth-api/internal/middleware"
+	"github.com/ecoci/auth-api/internal/notify"
+	"github.com/ecoci/auth-api/internal/openapi"
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/ratelimit"
 	"github.com/ecoci/auth-api/internal/service"
+	"github.com/ecoci/auth-api/internal/webhook"
+)
+
+// API version served by the server and the path prefix of its routes
+const (
+	APIVersion = 1
+	APIPrefix  = "/api/v1"
 )
 
 // Server represents the API server
 type Server struct {
-	cfg          *config.Config
-	db           *gorm.DB
-	router       *gin.Engine
-	jwtManager   *auth.JWTManager
-	oauthManager *auth.OAuthManager
-	userService  *service.UserService
-	runService   *service.RunService
-	repoService  *service.RepositoryService
+	cfg                 *config.Config
+	db                  *gorm.DB
+	router              *gin.Engine
+	jwtManager          *auth.JWTManager
+	oauthManager        *auth.OAuthManager
+	userService         *service.UserService
+	runService          *service.RunService
+	repoService         *service.RepositoryService
+	orgService          *service.OrganizationService
+	statsService        *service.StatsService
+	budgetService       *service.BudgetService
+	webhookService      *service.WebhookService
+	notificationService *service.NotificationService
+	alertService        *service.AlertService
+	retentionService    *service.RetentionService
+	offsetService       *service.OffsetService
+	factorService       *service.EmissionFactorService
+	storageService      *service.StorageService
+	languageService     *service.LanguageService
+	auditService        *service.AuditService
+	quotaService        *service.QuotaService
+	commentService      *service.CommentService
+	savedViewService    *service.SavedViewService
+	webhooks            *webhook.Dispatcher
+	notifier            *notify.Dispatcher
+	mailer              *mail.Mailer
+	commitStatuses      *commitstatus.Publisher
+	githubClient        *github.Client
+	bigquery            *bigquery.Exporter
+	archive             *archive.Archiver
+	eventBus            *eventbus.Publisher
+	carbonIntensity     carbon.Provider
+	alerts              *alerts.Engine
+	cache               *cache.Cache
+	rateLimiter         *ratelimit.Limiter
+	migrationVersion    uint
+	scheduler           *jobs.Scheduler
+	flags               *flags.Store
+	graphqlSchema       graphql.Schema
+	openAPIOnce         sync.Once
+	openAPI             *openapi.Document
 }
 
 // NewServer creates a new API server instance
@@ -37,8 +99,108 @@ func NewServer(cfg *config.Config, db *gorm.DB) (*Server, error) {
 
 	// Initialize services
 	userService := service.NewUserService(db)
-	runService := service.NewRunService(db)
+	runService := service.NewRunService(db, cfg.NetworkKWhPerGB)
 	repoService := service.NewRepositoryService(db)
+	orgService := service.NewOrganizationService(db)
+	statsService := service.NewStatsService(db)
+	budgetService := service.NewBudgetService(db)
+	webhookService := service.NewWebhookService(db)
+	notificationService := service.NewNotificationService(db)
+	alertService := service.NewAlertService(db)
+	retentionService := service.NewRetentionService(db)
+	offsetService := service.NewOffsetService(db)
+	factorService := service.NewEmissionFactorService(db)
+	storageService := service.NewStorageService(db, cfg.StorageKWhPerTBMonth, cfg.StorageCarbonIntensity)
+	languageService := service.NewLanguageService(db, github.NewClient(cfg.GitHubAPIURL, cfg.GitHubSyncToken))
+	auditService := service.NewAuditService(db)
+
+	// Email is only sent when an SMTP server is configured
+	var mailSender mail.Sender
+	if cfg.SMTPHost != "" {
+		smtpSender, err := mail.NewSMTPSender(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPFrom)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure SMTP: %w", err)
+		}
+		mailSender = smtpSender
+	}
+
+	mailer := mail.NewMailer(mailSender, cfg.AppURL, userService, statsService)
+
+	// Hot endpoints are only cached when Redis is configured
+	var responseCache *cache.Cache
+	if cfg.RedisURL != "" {
+		var err error
+		if responseCache, err = cache.New(cfg.RedisURL); err != nil {
+			return nil, fmt.Errorf("failed to configure Redis: %w", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := responseCache.Ping(ctx); err != nil {
+			log.Printf("Warning: Redis is unreachable, responses are served uncached until it recovers: %v", err)
+		}
+		cancel()
+	}
+
+	// Per-user rate limits need counters shared by all instances, so they are only enforced
+	// when Redis is configured
+	var rateLimiter *ratelimit.Limiter
+	if cfg.RedisURL != "" {
+		var err error
+		if rateLimiter, err = ratelimit.New(cfg.RedisURL, cfg.RateLimitWindow); err != nil {
+			return nil, fmt.Errorf("failed to configure rate limiting: %w", err)
+		}
+	}
+
+	// Runs are only queued for export when BigQuery is configured
+	var bigqueryExporter *bigquery.Exporter
+	if cfg.BigQueryProject != "" {
+		client, err := bigquery.NewClient(cfg.BigQueryAPIURL, cfg.BigQueryProject, cfg.BigQueryDataset, cfg.BigQueryCredentialsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure BigQuery export: %w", err)
+		}
+		if err := bigquery.QueueRuns(db); err != nil {
+			return nil, fmt.Errorf("failed to configure BigQuery export: %w", err)
+		}
+		bigqueryExporter = bigquery.NewExporter(db, client)
+	}
+
+	var archiver *archive.Archiver
+	if cfg.ArchiveBucket != "" {
+		store, err := archive.NewS3(context.Background(), cfg.ArchiveEndpoint, cfg.ArchiveRegion, cfg.ArchiveBucket)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure Parquet archive: %w", err)
+		}
+		archiver = archive.NewArchiver(db, store, cfg.ArchivePrefix)
+	}
+
+	var eventBus *eventbus.Publisher
+	if cfg.EventBus != "" {
+		events := cfg.EventBusEvents
+		if len(events) == 0 {
+			events = eventbus.Events
+		}
+		bus, err := eventbus.New(cfg.EventBus, cfg.EventBusURL, eventbus.Options{
+			Prefix:    cfg.EventBusTopicPrefix,
+			Events:    events,
+			Format:    cfg.EventBusFormat,
+			SourceURL: cfg.AppURL,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure event bus: %w", err)
+		}
+		eventBus = bus
+	}
+
+	// Grid carbon intensity is forecast from the regional averages unless a live source is
+	// configured
+	var carbonIntensity carbon.Provider = carbon.Static{}
+	if cfg.CarbonIntensityProvider == "electricitymaps" {
+		carbonIntensity = carbon.NewElectricityMaps(cfg.ElectricityMapsAPIURL, cfg.ElectricityMapsToken)
+	}
+
+	graphqlSchema, err := gql.NewSchema(userService, repoService, statsService)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build GraphQL schema: %w", err)
+	}
 
 	// Set Gin mode based on environment
 	if cfg.IsProduction() {
@@ -49,17 +211,56 @@ func NewServer(cfg *config.Config, db *gorm.DB) (*Server, error) {
 	router := gin.New()
 
 	server := &Server{
-		cfg:          cfg,
-		db:           db,
-		router:       router,
-		jwtManager:   jwtManager,
-		oauthManager: oauthManager,
-		userService:  userService,
-		runService:   runService,
-		repoService:  repoService,
+		cfg:                 cfg,
+		db:                  db,
+		router:              router,
+		jwtManager:          jwtManager,
+		oauthManager:        oauthManager,
+		userService:         userService,
+		runService:          runService,
+		repoService:         repoService,
+		orgService:          orgService,
+		statsService:        statsService,
+		budgetService:       budgetService,
+		webhookService:      webhookService,
+		notificationService: notificationService,
+		alertService:        alertService,
+		retentionService:    retentionService,
+		offsetService:       offsetService,
+		factorService:       factorService,
+		storageService:      storageService,
+		languageService:     languageService,
+		auditService:        auditService,
+		commentService:      service.NewCommentService(db),
+		savedViewService:    service.NewSavedViewService(db),
+		webhooks:            webhook.NewDispatcher(db, cfg.AppURL, cfg.WebhookPrivateTargets),
+		notifier:            notify.NewDispatcher(notificationService, statsService),
+		mailer:              mailer,
+		commitStatuses:      commitstatus.NewPublisher(cfg.GitHubAPIURL, cfg.GitHubStatusToken),
+		githubClient:        github.NewClient(cfg.GitHubAPIURL, ""),
+		bigquery:            bigqueryExporter,
+		archive:             archiver,
+		eventBus:            eventBus,
+		carbonIntensity:     carbonIntensity,
+		alerts:              alerts.NewEngine(alertService, notificationService, userService, mailer),
+		cache:               responseCache,
+		rateLimiter:         rateLimiter,
+		migrationVersion:    expectedMigrationVersion(),
+		scheduler:           jobs.NewScheduler(db),
+		flags:               flags.NewStore(db),
+		graphqlSchema:       graphqlSchema,
+	}
+	server.quotaService = service.NewQuotaService(db, server.planQuota)
+
+	if err := server.registerJobs(); err != nil {
+		return nil, err
+	}
+	if err := server.registerFlags(); err != nil {
+		return nil, err
 	}
 
-	// Setup middleware and routes
+	// Setup probes, middleware and routes
+	server.setupProbes()
 	server.setupMiddleware()
 	server.setupRoutes()
 
@@ -69,14 +270,17 @@ func NewServer(cfg *config.Config, db *gorm.DB) (*Server, error) {
 // setupMiddleware configures middleware for the server
 func (s *Server) setupMiddleware() {
 	// Recovery and logging middleware
-	s.router.Use(gin.Recovery())
+	s.router.Use(gin.CustomRecovery(problem.Recover))
+	s.router.Use(otelgin.Middleware(s.cfg.TracingServiceName))
+	s.router.Use(middleware.RequestID())
 	s.router.Use(gin.Logger())
 
 	// CORS middleware
 	corsConfig := cors.Config{
 		AllowOrigins:     s.cfg.AllowedOrigins,
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With", "Content-Encoding", CacheBypassHeader, middleware.RequestIDHeader, middleware.APIVersionHeader},
+		ExposeHeaders:    append([]string{middleware.RequestIDHeader}, append(middleware.VersionHeaders, middleware.RateLimitHeaders...)...),
 		AllowCredentials: true,
 		MaxAge:           300, // 5 minutes
 	}
@@ -95,45 +299,299 @@ func (s *Server) setupMiddleware() {
 	}
 }
 
-// setupRoutes configures API routes
+// setupRoutes configures API routes. Version 1 is served under /api/v1 and, for clients that
+// predate versioning, at the unversioned legacy paths, which are deprecated.
 func (s *Server) setupRoutes() {
+	// OpenAPI document, browsable in Swagger UI when enabled
+	s.router.GET("/openapi.json", s.handleOpenAPI)
+	if s.cfg.SwaggerUI {
+		s.router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler, ginSwagger.URL("/openapi.json")))
+	}
+
+	s.registerRoutes(s.router.Group(APIPrefix, middleware.APIVersion(APIVersion)))
+	s.registerRoutes(s.router.Group("/", middleware.APIVersion(APIVersion), middleware.Deprecated(APIPrefix, s.cfg.LegacyAPISunset)))
+
+	s.router.NoRoute(problem.NotFound)
+}
+
+// registerRoutes registers the routes of API version 1 on router
+func (s *Server) registerRoutes(router *gin.RouterGroup) {
 	// Health check endpoint
-	s.router.GET("/health", s.handleHealth)
+	router.GET("/health", middleware.OptionalJWTAuth(s.jwtManager, s.userService), s.handleHealth)
 
-	// Swagger documentation (only in development)
-	if s.cfg.IsDevelopment() {
-		s.router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
-	}
+	// Public leaderboard of repositories that opted into public stats
+	router.GET("/leaderboard", s.cached(cache.GroupLeaderboard, cacheScopeAll, s.cfg.CacheTTLLeaderboard), s.handleLeaderboard)
+
+	// User profiles, visible to anonymous callers when public
+	router.GET("/users/:user", middleware.OptionalJWTAuth(s.jwtManager, s.userService), s.handleGetUserProfile)
 
 	// Authentication routes
-	authGroup := s.router.Group("/auth")
+	authGroup := router.Group("/auth")
 	{
 		authGroup.GET("/github", s.handleGitHubAuth)
 		authGroup.GET("/github/callback", s.handleGitHubCallback)
 		authGroup.POST("/logout", middleware.JWTAuth(s.jwtManager), s.handleLogout)
-		authGroup.GET("/me", middleware.JWTAuth(s.jwtManager), s.handleGetMe)
+		authGroup.GET("/me", middleware.JWTAuth(s.jwtManager), middleware.ActiveAccount(s.userService), s.handleGetMe)
+	}
+
+	// Authenticated routes are rate limited per user and token on top of the global limit
+	authenticated := []gin.HandlerFunc{middleware.JWTAuth(s.jwtManager), middleware.ActiveAccount(s.userService)}
+	if s.rateLimiter != nil {
+		authenticated = append(authenticated, middleware.UserRateLimiter(s.rateLimiter, s.cfg))
 	}
+	authenticated = append(authenticated, s.displayUnits())
+
+	// Ingest endpoints accept bounded, optionally compressed bodies
+	ingestBody := middleware.RequestBody(int64(s.cfg.MaxIngestBodyBytes))
 
 	// API routes (authenticated)
-	apiGroup := s.router.Group("/")
-	apiGroup.Use(middleware.JWTAuth(s.jwtManager))
+	apiGroup := router.Group("/")
+	apiGroup.Use(authenticated...)
 	{
 		// Runs endpoints
-		apiGroup.POST("/runs", s.handleCreateRun)
+		apiGroup.POST("/runs", ingestBody, s.handleCreateRun)
+		apiGroup.GET("/runs/search", s.handleSearchRuns)
+		apiGroup.GET("/me/runs", s.handleListMyRuns)
+		apiGroup.DELETE("/runs/:run_id", s.handleDeleteRun)
+		apiGroup.POST("/runs/:run_id/restore", s.handleRestoreRun)
+		apiGroup.PUT("/runs/:run_id/test-suites", ingestBody, s.handleUploadTestReport)
+		apiGroup.GET("/runs/:run_id/test-suites", s.handleGetRunTestSuites)
+		apiGroup.GET("/runs/:run_id/timeline", s.handleGetRunTimeline)
+		apiGroup.GET("/runs/:run_id/comments", s.handleListRunComments)
+		apiGroup.POST("/runs/:run_id/comments", s.handleCreateRunComment)
+		apiGroup.DELETE("/runs/:run_id/comments/:comment_id", s.handleDeleteRunComment)
+
+		// Import endpoints
+		apiGroup.POST("/imports/codecarbon", ingestBody, s.handleImportCodecarbon)
+		apiGroup.POST("/imports/cloud-carbon-footprint", ingestBody, s.handleImportCloudCarbonFootprint)
+		apiGroup.POST("/imports/green-metrics-tool", ingestBody, s.handleImportGreenMetricsTool)
+		apiGroup.POST("/imports/ecoci", ingestBody, s.handleImportEcoCI)
 
 		// Repositories endpoints
-		apiGroup.GET("/repos", s.handleListRepositories)
+		apiGroup.GET("/repos", s.cached(cache.GroupRepositories, cacheScopeAll, s.cfg.CacheTTLRepos), s.handleListRepositories)
+		apiGroup.DELETE("/repos/:repo_id", s.handleDeleteRepository)
+		apiGroup.POST("/repos/:repo_id/restore", s.handleRestoreRepository)
 		apiGroup.GET("/repos/:repo_id/runs", s.handleGetRepositoryRuns)
+		apiGroup.GET("/repos/:repo_id/workflow-runs", s.handleGetRepositoryWorkflowRuns)
+		apiGroup.PATCH("/repos/:repo_id/settings", s.handleUpdateRepositorySettings)
+		apiGroup.POST("/repos/:repo_id/run-signing-secret", s.handleEnableSignedRuns)
+		apiGroup.DELETE("/repos/:repo_id/run-signing-secret", s.handleDisableSignedRuns)
+		apiGroup.GET("/repos/:repo_id/collaborators", s.handleListCollaborators)
+		apiGroup.POST("/repos/:repo_id/collaborators", s.handleAddCollaborator)
+		apiGroup.DELETE("/repos/:repo_id/collaborators/:user_id", s.handleRemoveCollaborator)
+		apiGroup.GET("/repos/:repo_id/comments", s.handleListRepositoryComments)
+
+		// Statistics endpoints
+		apiGroup.GET("/repos/:repo_id/timeseries", s.cached(cache.GroupStats, cacheScopeRepository, s.cfg.CacheTTLStats), s.handleRepositoryTimeSeries)
+		apiGroup.GET("/me/timeseries", s.cached(cache.GroupStats, cacheScopeCurrentUser, s.cfg.CacheTTLStats), s.handleUserTimeSeries)
+		apiGroup.GET("/orgs/:org/timeseries", s.handleOrganizationTimeSeries)
+		apiGroup.GET("/repos/:repo_id/stats", s.cached(cache.GroupStats, cacheScopeRepository, s.cfg.CacheTTLStats), s.handleRepositoryStats)
+		apiGroup.GET("/repos/:repo_id/workflows/stats", s.cached(cache.GroupStats, cacheScopeRepository, s.cfg.CacheTTLStats), s.handleRepositoryWorkflowStats)
+		apiGroup.GET("/repos/:repo_id/measurements", s.cached(cache.GroupStats, cacheScopeRepository, s.cfg.CacheTTLStats), s.handleRepositoryMeasurements)
+		apiGroup.GET("/me/measurements", s.cached(cache.GroupStats, cacheScopeCurrentUser, s.cfg.CacheTTLStats), s.handleUserMeasurements)
+		apiGroup.GET("/orgs/:org/measurements", s.handleOrganizationMeasurements)
+		apiGroup.GET("/repos/:repo_id/gpus", s.cached(cache.GroupStats, cacheScopeRepository, s.cfg.CacheTTLStats), s.handleRepositoryGPUStats)
+		apiGroup.GET("/me/gpus", s.cached(cache.GroupStats, cacheScopeCurrentUser, s.cfg.CacheTTLStats), s.handleUserGPUStats)
+		apiGroup.GET("/orgs/:org/gpus", s.handleOrganizationGPUStats)
+		apiGroup.GET("/repos/:repo_id/environments", s.cached(cache.GroupStats, cacheScopeRepository, s.cfg.CacheTTLStats), s.handleRepositoryEnvironmentStats)
+		apiGroup.GET("/me/environments", s.cached(cache.GroupStats, cacheScopeCurrentUser, s.cfg.CacheTTLStats), s.handleUserEnvironmentStats)
+		apiGroup.GET("/orgs/:org/environments", s.handleOrganizationEnvironmentStats)
+		apiGroup.GET("/repos/:repo_id/phases", s.cached(cache.GroupStats, cacheScopeRepository, s.cfg.CacheTTLStats), s.handleRepositoryPhaseStats)
+		apiGroup.GET("/me/phases", s.cached(cache.GroupStats, cacheScopeCurrentUser, s.cfg.CacheTTLStats), s.handleUserPhaseStats)
+		apiGroup.GET("/orgs/:org/phases", s.handleOrganizationPhaseStats)
+		apiGroup.GET("/repos/:repo_id/languages", s.handleGetRepositoryLanguages)
+		apiGroup.POST("/repos/:repo_id/languages/sync", s.handleSyncRepositoryLanguages)
+		apiGroup.GET("/me/languages", s.cached(cache.GroupStats, cacheScopeCurrentUser, s.cfg.CacheTTLStats), s.handleUserLanguageStats)
+		apiGroup.GET("/orgs/:org/languages", s.handleOrganizationLanguageStats)
+		apiGroup.GET("/repos/:repo_id/image-builds", s.cached(cache.GroupStats, cacheScopeRepository, s.cfg.CacheTTLStats), s.handleRepositoryImageBuilds)
+		apiGroup.GET("/repos/:repo_id/test-suites", s.cached(cache.GroupStats, cacheScopeRepository, s.cfg.CacheTTLStats), s.handleRepositoryTestSuiteStats)
+		apiGroup.GET("/repos/:repo_id/runs/aggregate", s.handleAggregateRuns)
+		apiGroup.GET("/repos/:repo_id/runs/histogram", s.handleRunHistogram)
+		apiGroup.GET("/carbon/windows", s.handleCarbonWindows)
+		apiGroup.GET("/repos/:repo_id/regions/recommendation", s.handleRegionRecommendation)
+		apiGroup.GET("/repos/:repo_id/recommendations", s.cached(cache.GroupStats, cacheScopeRepository, s.cfg.CacheTTLStats), s.handleRecommendations)
+		apiGroup.GET("/repos/:repo_id/wasted-carbon", s.cached(cache.GroupStats, cacheScopeRepository, s.cfg.CacheTTLStats), s.handleWastedCarbon)
+		apiGroup.GET("/repos/:repo_id/compare", s.cached(cache.GroupStats, cacheScopeRepository, s.cfg.CacheTTLStats), s.handleCompareBranches)
+		apiGroup.GET("/repos/:repo_id/baseline", s.handleGetBaseline)
+		apiGroup.PUT("/repos/:repo_id/baseline", s.handleSetBaseline)
+		apiGroup.GET("/repos/:repo_id/savings", s.handleSavings)
+
+		// Budget endpoints
+		apiGroup.GET("/repos/:repo_id/budgets", s.handleListBudgets)
+		apiGroup.PUT("/repos/:repo_id/budgets/:period", s.handleSetBudget)
+		apiGroup.DELETE("/repos/:repo_id/budgets/:period", s.handleDeleteBudget)
+		apiGroup.GET("/repos/:repo_id/forecast", s.handleForecast)
+		apiGroup.GET("/repos/:repo_id/budget-check", s.handleBudgetCheck)
+		apiGroup.GET("/repos/:repo_id/commits", s.handleCommitSeries)
+		apiGroup.GET("/repos/:repo_id/commits/:sha/stats", s.handleCommitStats)
+		apiGroup.GET("/repos/:repo_id/releases/:tag/stats", s.handleReleaseStats)
+		apiGroup.GET("/me/stats", s.cached(cache.GroupStats, cacheScopeCurrentUser, s.cfg.CacheTTLStats), s.handleUserStats)
+		apiGroup.GET("/users/:user/stats", s.handleOtherUserStats)
+		apiGroup.GET("/orgs/:org/stats", s.handleOrganizationStats)
+		apiGroup.GET("/me/year-in-review", s.handleUserYearInReview)
+		apiGroup.GET("/orgs/:org/year-in-review", s.handleOrganizationYearInReview)
+
+		// Export endpoints
+		apiGroup.GET("/repos/:repo_id/export.xlsx", s.handleRepositoryExportXLSX)
+		apiGroup.GET("/repos/:repo_id/export.json", s.handleRepositoryExportManifest)
+		apiGroup.GET("/orgs/:org/export.xlsx", s.handleOrganizationExportXLSX)
+
+		// Webhook endpoints
+		webhooksEnabled := s.requireFeature(flags.Webhooks)
+		apiGroup.GET("/repos/:repo_id/webhooks", webhooksEnabled, s.handleListRepositoryWebhooks)
+		apiGroup.POST("/repos/:repo_id/webhooks", webhooksEnabled, s.handleCreateRepositoryWebhook)
+		apiGroup.GET("/orgs/:org/webhooks", webhooksEnabled, s.handleListOrganizationWebhooks)
+		apiGroup.POST("/orgs/:org/webhooks", webhooksEnabled, s.handleCreateOrganizationWebhook)
+		apiGroup.DELETE("/webhooks/:webhook_id", webhooksEnabled, s.handleDeleteWebhook)
+		apiGroup.GET("/webhooks/:webhook_id/deliveries", webhooksEnabled, s.handleListWebhookDeliveries)
+		apiGroup.POST("/webhooks/:webhook_id/deliveries/redrive", webhooksEnabled, s.handleRedriveWebhookDeliveries)
+		apiGroup.GET("/webhooks/:webhook_id/deliveries/:delivery_id", webhooksEnabled, s.handleGetWebhookDelivery)
+		apiGroup.POST("/webhooks/:webhook_id/deliveries/:delivery_id/redeliver", webhooksEnabled, s.handleRedeliverWebhookDelivery)
+
+		// Notification endpoints
+		apiGroup.GET("/orgs/:org/integrations", s.handleListIntegrations)
+		apiGroup.PUT("/orgs/:org/integrations/:provider", s.handleSetIntegration)
+		apiGroup.DELETE("/orgs/:org/integrations/:provider", s.handleDeleteIntegration)
+		apiGroup.GET("/repos/:repo_id/notifications", s.handleListNotificationRoutes)
+		apiGroup.PUT("/repos/:repo_id/notifications/:provider", s.handleSetNotificationRoute)
+		apiGroup.DELETE("/repos/:repo_id/notifications/:provider", s.handleDeleteNotificationRoute)
+		apiGroup.GET("/me/preferences", s.handleGetPreferences)
+		apiGroup.PATCH("/me/preferences", s.handleUpdatePreferences)
+		apiGroup.GET("/me/email-preferences", s.handleGetEmailPreferences)
+		apiGroup.PATCH("/me/email-preferences", s.handleUpdateEmailPreferences)
+		apiGroup.GET("/me/display-units", s.handleGetDisplayUnits)
+		apiGroup.PUT("/me/display-units", s.handleUpdateDisplayUnits)
+		apiGroup.GET("/me/flags", s.handleGetMyFlags)
+		apiGroup.POST("/me/refresh", s.handleRefreshProfile)
+		apiGroup.GET("/me/notification-preferences", s.handleListNotificationPreferences)
+		apiGroup.PUT("/me/notification-preferences", s.handleSetNotificationPreference)
+		apiGroup.GET("/me/notification-preferences/resolved", s.handleResolveNotificationChannels)
+		apiGroup.DELETE("/me/notification-preferences/:preference_id", s.handleDeleteNotificationPreference)
+		apiGroup.POST("/orgs/:org/announcements", s.handleCreateAnnouncement)
+
+		// API token endpoints
+		apiGroup.GET("/me/api-tokens", s.handleListAPITokens)
+		apiGroup.POST("/me/api-tokens", s.handleCreateAPIToken)
+		apiGroup.DELETE("/me/api-tokens/:token_id", s.handleDeleteAPIToken)
+
+		// Plan endpoints
+		apiGroup.GET("/me/plan", s.handleGetMyPlan)
+		apiGroup.GET("/orgs/:org/plan", s.handleGetOrganizationPlan)
+
+		// Alert rule endpoints
+		apiGroup.GET("/alert-rules", s.handleListAlertRules)
+		apiGroup.POST("/alert-rules", s.handleCreateAlertRule)
+		apiGroup.GET("/alert-rules/:rule_id", s.handleGetAlertRule)
+		apiGroup.PUT("/alert-rules/:rule_id", s.handleUpdateAlertRule)
+		apiGroup.DELETE("/alert-rules/:rule_id", s.handleDeleteAlertRule)
+
+		// Saved view endpoints
+		apiGroup.GET("/saved-views", s.handleListSavedViews)
+		apiGroup.POST("/saved-views", s.handleCreateSavedView)
+		apiGroup.GET("/saved-views/:view_id", s.handleGetSavedView)
+		apiGroup.PUT("/saved-views/:view_id", s.handleUpdateSavedView)
+		apiGroup.DELETE("/saved-views/:view_id", s.handleDeleteSavedView)
+
+		// Data retention endpoints
+		apiGroup.GET("/orgs/:org/retention", s.handleGetRetentionPolicy)
+		apiGroup.PUT("/orgs/:org/retention", s.handleSetRetentionPolicy)
+		apiGroup.DELETE("/orgs/:org/retention", s.handleDeleteRetentionPolicy)
+		apiGroup.GET("/orgs/:org/retention/reports", s.handleListRetentionReports)
+
+		// Water usage endpoints
+		apiGroup.GET("/repos/:repo_id/water", s.handleGetRepositoryWater)
+		apiGroup.PUT("/repos/:repo_id/water", s.handleSetRepositoryWater)
+		apiGroup.GET("/repos/:repo_id/storage", s.handleGetRepositoryStorage)
+		apiGroup.POST("/repos/:repo_id/storage", s.handleReportRepositoryStorage)
+		apiGroup.GET("/orgs/:org/water", s.handleGetOrganizationWater)
+		apiGroup.PUT("/orgs/:org/water", s.handleSetOrganizationWater)
+
+		// Carbon offset endpoints
+		apiGroup.GET("/orgs/:org/offsets", s.handleListCarbonOffsets)
+		apiGroup.POST("/orgs/:org/offsets", s.handleCreateCarbonOffset)
+		apiGroup.DELETE("/orgs/:org/offsets/:offset_id", s.handleDeleteCarbonOffset)
+		apiGroup.GET("/emission-factors/:region", s.handleResolveEmissionFactor)
+
+		// GraphQL
+		apiGroup.POST("/graphql", ingestBody, s.handleGraphQL)
+	}
+
+	// Admin routes (users with the admin role)
+	adminGroup := router.Group("/admin")
+	adminGroup.Use(append(authenticated, middleware.AdminAuth())...)
+	{
+		adminGroup.GET("/users", s.handleAdminListUsers)
+		adminGroup.PATCH("/users/:user_id", s.handleAdminUpdateUser)
+		adminGroup.DELETE("/users/:user_id", s.handleAdminDeleteUser)
+		adminGroup.POST("/users/:user_id/restore", s.handleAdminRestoreUser)
+		adminGroup.POST("/repos/:repo_id/transfer", s.handleAdminTransferRepository)
+		adminGroup.PATCH("/orgs/:org", s.handleAdminUpdateOrganization)
+		adminGroup.GET("/stats", s.handleAdminStats)
+		adminGroup.GET("/config", s.handleAdminConfig)
+		adminGroup.GET("/audit-events", s.handleAdminListAuditEvents)
+		adminGroup.GET("/archive/manifest", s.handleArchiveManifest)
+
+		// Background jobs
+		adminGroup.GET("/jobs", s.handleListJobs)
+		adminGroup.GET("/jobs/:name", s.handleGetJob)
+		adminGroup.PATCH("/jobs/:name", s.handleUpdateJob)
+		adminGroup.POST("/jobs/:name/run", s.handleRunJob)
+
+		// Feature flags
+		adminGroup.GET("/flags", s.handleListFlags)
+		adminGroup.GET("/flags/:name", s.handleGetFlag)
+		adminGroup.PATCH("/flags/:name", s.handleUpdateFlag)
+		adminGroup.DELETE("/flags/:name", s.handleResetFlag)
+
+		// Emission factor management
+		adminGroup.GET("/emission-factors", s.handleListEmissionFactors)
+		adminGroup.POST("/emission-factors", s.handleCreateEmissionFactor)
+		adminGroup.GET("/emission-factors/:factor_id", s.handleGetEmissionFactor)
+		adminGroup.PUT("/emission-factors/:factor_id", s.handleUpdateEmissionFactor)
+		adminGroup.DELETE("/emission-factors/:factor_id", s.handleDeleteEmissionFactor)
+		adminGroup.GET("/emission-factors/:factor_id/versions", s.handleListEmissionFactorVersions)
+		adminGroup.GET("/recalculation-reports", s.handleListRecalculationReports)
 	}
 }
 
-// Start starts the server on the given address
+// Start starts the server on the given address, terminating TLS when certificate files or
+// ACME hosts are configured
 func (s *Server) Start(addr string) error {
-	log.Printf("Starting server on %s", addr)
-	return s.router.Run(addr)
+	// Run the background jobs (rollups, retention, webhook deliveries, alert evaluation
+	// and scheduled reports) on their schedules
+	go s.scheduler.Run(context.Background(), jobs.PollInterval)
+
+	server, acmeManager, err := s.httpServer(addr)
+	if err != nil {
+		return err
+	}
+
+	if server.TLSConfig == nil {
+		log.Printf("Starting server on %s", addr)
+		return server.ListenAndServe()
+	}
+
+	if acmeManager != nil {
+		s.serveACMEChallenges(acmeManager)
+		log.Printf("Starting server on %s with Let's Encrypt certificates for %s", addr, strings.Join(s.cfg.ACMEHosts, ", "))
+	} else {
+		log.Printf("Starting server on %s with TLS", addr)
+	}
+	// The certificates come from the TLS configuration
+	return server.ListenAndServeTLS("", "")
 }
 
 // GetRouter returns the Gin router (useful for testing)
 func (s *Server) GetRouter() *gin.Engine {
 	return s.router
-}
\ No newline at end of file
+}
+// RotateJWTSecret signs new tokens with secret; tokens signed with the previous secret stay
+// valid until they expire
+func (s *Server) RotateJWTSecret(secret string) {
+	s.jwtManager.SetSecret(secret)
+}
+
+// RotateOAuthClientSecret exchanges GitHub authorization codes with the new client secret
+func (s *Server) RotateOAuthClientSecret(secret string) {
+	s.oauthManager.SetClientSecret(secret)
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// RepositorySettingsRequest represents the repository settings an owner can change;
+// omitted fields are left unchanged
+type RepositorySettingsRequest struct {
+	PublicStats    *bool `json:"public_stats"`
+	BenchmarkOptIn *bool `json:"benchmark_opt_in"`
+	CommitStatus   *bool `json:"commit_status"`
+}
+
+// Update repository settings handler
+// @Summary Update repository settings
+// @Description Opt a repository in or out of the public leaderboard, peer benchmarking and GitHub commit statuses (repository owner only)
+// @Tags repositories
+// @Security CookieAuth
+// @Accept json
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param settings body RepositorySettingsRequest true "Repository settings"
+// @Success 200 {object} db.Repository
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/settings [patch]
+func (s *Server) handleUpdateRepositorySettings(c *gin.Context) {
+	repo, ok := s.requireRepositoryOwner(c)
+	if !ok {
+		return
+	}
+
+	var req RepositorySettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body", err.Error())
+		return
+	}
+
+	updated, err := s.repoService.UpdateSettings(repo.ID, service.RepositorySettings{
+		PublicStats:    req.PublicStats,
+		BenchmarkOptIn: req.BenchmarkOptIn,
+		CommitStatus:   req.CommitStatus,
+	})
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "REPOSITORY_UPDATE_FAILED", "Failed to update repository settings")
+		return
+	}
+
+	s.invalidateRepositoryCaches(c.Request.Context(), repo.ID)
+	s.recordAudit(c, auditRepository("repository.update", repo, service.AuditDiff(
+		repositorySettingsAuditFields(repo),
+		repositorySettingsAuditFields(updated),
+	)))
+	s.publishRepoUpdated(updated)
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// repositorySettingsAuditFields returns the audited settings of a repository
+func repositorySettingsAuditFields(repo *db.Repository) map[string]interface{} {
+	return map[string]interface{}{
+		"public_stats":     repo.PublicStats,
+		"benchmark_opt_in": repo.BenchmarkOptIn,
+		"commit_status":    repo.CommitStatus,
+		"signed_runs":      repo.SignedRuns,
+	}
+}
@@ -0,0 +1,849 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// timeSeriesDateLayout is accepted for from/to in addition to RFC3339
+const timeSeriesDateLayout = "2006-01-02"
+
+// parseTimeSeriesTime parses a from/to query value as RFC3339 or a plain date
+func parseTimeSeriesTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+	t, err := time.Parse(timeSeriesDateLayout, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.UTC(), nil
+}
+
+// defaultTimeSeriesFrom returns the start of the default range for an interval
+func defaultTimeSeriesFrom(to time.Time, interval string) time.Time {
+	switch interval {
+	case "week":
+		return to.AddDate(0, 0, -7*12)
+	case "month":
+		return to.AddDate(0, -12, 0)
+	default:
+		return to.AddDate(0, 0, -30)
+	}
+}
+
+// parseTimeRange parses the from and to query parameters; to defaults to now and from to
+// defaultFrom(to). On failure it writes a 400 response and returns false.
+func parseTimeRange(c *gin.Context, defaultFrom func(time.Time) time.Time) (time.Time, time.Time, bool) {
+	to := time.Now().UTC()
+	if toStr := c.Query("to"); toStr != "" {
+		parsed, err := parseTimeSeriesTime(toStr)
+		if err != nil {
+			problem.Respond(c, http.StatusBadRequest, "INVALID_TIME_RANGE", "Invalid to parameter, expected RFC3339 or YYYY-MM-DD")
+			return time.Time{}, time.Time{}, false
+		}
+		to = parsed
+	}
+
+	from := defaultFrom(to)
+	if fromStr := c.Query("from"); fromStr != "" {
+		parsed, err := parseTimeSeriesTime(fromStr)
+		if err != nil {
+			problem.Respond(c, http.StatusBadRequest, "INVALID_TIME_RANGE", "Invalid from parameter, expected RFC3339 or YYYY-MM-DD")
+			return time.Time{}, time.Time{}, false
+		}
+		from = parsed
+	}
+
+	if from.After(to) {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_TIME_RANGE", "from must not be after to")
+		return time.Time{}, time.Time{}, false
+	}
+
+	return from, to, true
+}
+
+// parseCompare validates the compare query parameter.
+// On failure it writes a 400 response and returns false.
+func parseCompare(c *gin.Context) (string, bool) {
+	compare := c.Query("compare")
+	if !service.IsValidCompare(compare) {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_COMPARE", "Invalid compare, must be previous_period")
+		return "", false
+	}
+	return compare, true
+}
+
+// parseAccountingMethod validates the method query parameter, defaulting to location.
+// On failure it writes a 400 response and returns false.
+func parseAccountingMethod(c *gin.Context) (string, bool) {
+	method := c.DefaultQuery("method", service.AccountingLocation)
+	if !service.IsValidAccountingMethod(method) {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_ACCOUNTING_METHOD", "Invalid method, must be location or market")
+		return "", false
+	}
+	return method, true
+}
+
+// parseTimeSeriesQuery validates the metric, interval, from and to query parameters.
+// On failure it writes a 400 response and returns false.
+func parseTimeSeriesQuery(c *gin.Context) (service.TimeSeriesQuery, bool) {
+	q := service.TimeSeriesQuery{
+		Metric:   c.DefaultQuery("metric", "co2_kg"),
+		Interval: c.DefaultQuery("interval", "day"),
+	}
+
+	if !service.IsValidMetric(q.Metric) {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_METRIC", "Invalid metric, must be one of co2_kg, energy_kwh, duration_s")
+		return q, false
+	}
+
+	if !service.IsValidInterval(q.Interval) {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_INTERVAL", "Invalid interval, must be one of day, week, month")
+		return q, false
+	}
+
+	from, to, ok := parseTimeRange(c, func(to time.Time) time.Time {
+		return defaultTimeSeriesFrom(to, q.Interval)
+	})
+	if !ok {
+		return q, false
+	}
+	q.From, q.To = from, to
+
+	if service.CountBuckets(q.From, q.To, q.Interval) > service.MaxTimeSeriesBuckets {
+		problem.Respond(c, http.StatusBadRequest, "TIME_RANGE_TOO_LARGE", "Time range too large for the requested interval")
+		return q, false
+	}
+
+	return q, true
+}
+
+// respondTimeSeries runs the time series query for scope and writes the result
+func (s *Server) respondTimeSeries(c *gin.Context, scope service.RunScope) {
+	q, ok := parseTimeSeriesQuery(c)
+	if !ok {
+		return
+	}
+	compare, ok := parseCompare(c)
+	if !ok {
+		return
+	}
+
+	points, err := s.statsService.TimeSeries(scope, q)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "TIMESERIES_FETCH_FAILED", "Failed to fetch time series")
+		return
+	}
+
+	response := gin.H{
+		"metric":   q.Metric,
+		"interval": q.Interval,
+		"from":     q.From,
+		"to":       q.To,
+		"points":   points,
+	}
+
+	if compare == service.ComparePreviousPeriod {
+		current, err := s.statsService.Summary(scope, q.From, q.To)
+		if err != nil {
+			problem.Respond(c, http.StatusInternalServerError, "STATS_FETCH_FAILED", "Failed to fetch statistics")
+			return
+		}
+		comparison, ok := s.comparePeriod(c, scope, current)
+		if !ok {
+			return
+		}
+		response["comparison"] = comparison
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// comparePeriod compares current with the preceding period of equal length.
+// On failure it writes a 500 response and returns false.
+func (s *Server) comparePeriod(c *gin.Context, scope service.RunScope, current *service.PeriodSummary) (*service.PeriodComparison, bool) {
+	comparison, err := s.statsService.CompareWithPreviousPeriod(scope, current)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "STATS_COMPARISON_FAILED", "Failed to compare periods")
+		return nil, false
+	}
+	return comparison, true
+}
+
+// respondSummary aggregates the runs in scope over the requested range and writes the result
+func (s *Server) respondSummary(c *gin.Context, scope service.RunScope) {
+	if response, ok := s.buildSummary(c, scope); ok {
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// buildSummary aggregates the runs in scope over the requested range with the requested
+// accounting method, with the optional comparison. On failure it writes the error response and returns false.
+func (s *Server) buildSummary(c *gin.Context, scope service.RunScope) (gin.H, bool) {
+	from, to, ok := parseTimeRange(c, func(to time.Time) time.Time {
+		return to.AddDate(0, 0, -30)
+	})
+	if !ok {
+		return nil, false
+	}
+	compare, ok := parseCompare(c)
+	if !ok {
+		return nil, false
+	}
+	method, ok := parseAccountingMethod(c)
+	if !ok {
+		return nil, false
+	}
+
+	summary, err := s.statsService.Summary(scope, from, to)
+	if err == nil {
+		err = s.statsService.ApplyAccountingMethod(scope, summary, method)
+	}
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "STATS_FETCH_FAILED", "Failed to fetch statistics")
+		return nil, false
+	}
+
+	response := gin.H{
+		"summary": summary,
+	}
+
+	if compare == service.ComparePreviousPeriod {
+		comparison, ok := s.comparePeriod(c, scope, summary)
+		if !ok {
+			return nil, false
+		}
+		response["comparison"] = comparison
+	}
+
+	return response, true
+}
+
+// Repository time series handler
+// @Summary Get repository time series
+// @Description Get a metric of a repository's runs bucketed by day, week or month
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param metric query string false "Metric (co2_kg, energy_kwh, duration_s)" default(co2_kg)
+// @Param interval query string false "Bucket size (day, week, month)" default(day)
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD)"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Param compare query string false "Comparison window (previous_period)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/timeseries [get]
+func (s *Server) handleRepositoryTimeSeries(c *gin.Context) {
+	repo, ok := s.requireVisibleRepository(c)
+	if !ok {
+		return
+	}
+
+	s.respondTimeSeries(c, service.RepositoryRuns(repo.ID))
+}
+
+// User time series handler
+// @Summary Get current user time series
+// @Description Get a metric of the current user's runs bucketed by day, week or month
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param metric query string false "Metric (co2_kg, energy_kwh, duration_s)" default(co2_kg)
+// @Param interval query string false "Bucket size (day, week, month)" default(day)
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD)"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Param compare query string false "Comparison window (previous_period)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Router /me/timeseries [get]
+func (s *Server) handleUserTimeSeries(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	s.respondTimeSeries(c, service.UserRuns(userID))
+}
+
+// Organization time series handler
+// @Summary Get organization time series
+// @Description Get a metric of an organization's runs bucketed by day, week or month (members only)
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param org path string true "GitHub organization login"
+// @Param metric query string false "Metric (co2_kg, energy_kwh, duration_s)" default(co2_kg)
+// @Param interval query string false "Bucket size (day, week, month)" default(day)
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD)"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Param compare query string false "Comparison window (previous_period)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /orgs/{org}/timeseries [get]
+func (s *Server) handleOrganizationTimeSeries(c *gin.Context) {
+	org, ok := s.requireOrganizationMember(c)
+	if !ok {
+		return
+	}
+
+	s.respondTimeSeries(c, service.OrganizationRuns(org.ID))
+}
+
+// Repository statistics handler
+// @Summary Get repository statistics
+// @Description Get aggregated CO2, energy, duration and run count of a repository over a time range, with its peer benchmark when opted in
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Param compare query string false "Comparison window (previous_period)"
+// @Param method query string false "Accounting method of the CO2 (location, market)" default(location)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/stats [get]
+func (s *Server) handleRepositoryStats(c *gin.Context) {
+	repo, ok := s.requireVisibleRepository(c)
+	if !ok {
+		return
+	}
+
+	response, ok := s.buildSummary(c, service.RepositoryRuns(repo.ID))
+	if !ok {
+		return
+	}
+
+	// Peer benchmark over the same range; only repositories that opted in are scored
+	summary := response["summary"].(*service.PeriodSummary)
+	benchmark, err := s.statsService.Benchmark(repo, summary.From, summary.To)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "STATS_FETCH_FAILED", "Failed to compute benchmark")
+		return
+	}
+	response["benchmark"] = benchmark
+
+	c.JSON(http.StatusOK, response)
+}
+
+// User statistics handler
+// @Summary Get current user statistics
+// @Description Get aggregated CO2, energy, duration and run count of the current user's runs over a time range, with the averages per run, the number of repositories run in and the last run of the range as stats
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Param compare query string false "Comparison window (previous_period)"
+// @Param method query string false "Accounting method of the CO2 (location, market)" default(location)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Router /me/stats [get]
+func (s *Server) handleUserStats(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	s.respondUserStats(c, service.UserRuns(userID))
+}
+
+// Other user statistics handler
+// @Summary Get user statistics
+// @Description Get the statistics of another user like GET /me/stats, when their profile is visible to the current user and shows their statistics. Only their runs in repositories the current user can see are counted.
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param user path string true "User UUID or GitHub username"
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Param compare query string false "Comparison window (previous_period)"
+// @Param method query string false "Accounting method of the CO2 (location, market)" default(location)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /users/{user}/stats [get]
+func (s *Server) handleOtherUserStats(c *gin.Context) {
+	viewerID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+	user, settings, ok := s.requireVisibleUser(c, viewerID)
+	if !ok {
+		return
+	}
+
+	if user.ID == viewerID {
+		s.respondUserStats(c, service.UserRuns(user.ID))
+		return
+	}
+	if !settings.ProfileStats {
+		problem.Respond(c, http.StatusForbidden, "PROFILE_STATS_PRIVATE", "The user does not share their statistics")
+		return
+	}
+	s.respondUserStats(c, service.UserRunsVisibleTo(user.ID, viewerID))
+}
+
+// respondUserStats writes the summary of the runs in scope with the user statistics of the
+// same range
+func (s *Server) respondUserStats(c *gin.Context, scope service.RunScope) {
+	response, ok := s.buildSummary(c, scope)
+	if !ok {
+		return
+	}
+
+	summary := response["summary"].(*service.PeriodSummary)
+	stats, err := s.runService.GetUserStats(scope, summary.From, summary.To)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "STATS_FETCH_FAILED", "Failed to fetch statistics")
+		return
+	}
+	response["stats"] = stats
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Organization statistics handler
+// @Summary Get organization statistics
+// @Description Get aggregated CO2, energy, duration and run count of an organization over a time range (members only), with the gross emissions next to the market-based emissions after renewable energy purchases and the net emissions after carbon offsets
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param org path string true "GitHub organization login"
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Param compare query string false "Comparison window (previous_period)"
+// @Param method query string false "Accounting method of the CO2 (location, market)" default(location)
+// @Success 200 {object} organizationStatsResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /orgs/{org}/stats [get]
+func (s *Server) handleOrganizationStats(c *gin.Context) {
+	org, ok := s.requireOrganizationMember(c)
+	if !ok {
+		return
+	}
+
+	response, ok := s.buildSummary(c, service.OrganizationRuns(org.ID))
+	if !ok {
+		return
+	}
+
+	emissions, err := s.offsetService.NetEmissions(org.ID, response["summary"].(*service.PeriodSummary))
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "STATS_FETCH_FAILED", "Failed to fetch statistics")
+		return
+	}
+	response["emissions"] = emissions
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Repository workflow statistics handler
+// @Summary Get repository workflow statistics
+// @Description Get per-workflow aggregates and p50/p90/p99 CO2 and duration percentiles of a repository
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/workflows/stats [get]
+func (s *Server) handleRepositoryWorkflowStats(c *gin.Context) {
+	repo, ok := s.requireVisibleRepository(c)
+	if !ok {
+		return
+	}
+
+	from, to, ok := parseTimeRange(c, func(to time.Time) time.Time {
+		return to.AddDate(0, 0, -30)
+	})
+	if !ok {
+		return
+	}
+
+	workflows, err := s.statsService.WorkflowStats(service.RepositoryRuns(repo.ID), from, to)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "STATS_FETCH_FAILED", "Failed to fetch workflow statistics")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":      from,
+		"to":        to,
+		"workflows": workflows,
+	})
+}
+
+// Run aggregate handler
+// @Summary Aggregate repository runs by group
+// @Description Group a repository's runs by workflow, workflow run group, branch, CI provider, tag or any key of their metadata and aggregate a metric per group
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param group_by query string true "Grouping (workflow_name, workflow_run_group, branch, environment, ci_provider, tag, or metadata.<key> such as metadata.runner_os)"
+// @Param metric query string false "Metric (co2_kg, energy_kwh, duration_s)" default(co2_kg)
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Param filter query string false "Filter expression, such as co2_kg>0.5 AND branch=main AND tag IN (nightly,release)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/runs/aggregate [get]
+func (s *Server) handleAggregateRuns(c *gin.Context) {
+	repo, ok := s.requireVisibleRepository(c)
+	if !ok {
+		return
+	}
+
+	q := service.AggregateQuery{
+		GroupBy: c.Query("group_by"),
+		Metric:  c.DefaultQuery("metric", "co2_kg"),
+	}
+
+	if !service.IsValidGroupBy(q.GroupBy) {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_GROUP_BY", "Invalid group_by, must be one of workflow_name, workflow_run_group, branch, environment, ci_provider, tag or metadata.<key> with a key of letters, digits and underscores")
+		return
+	}
+
+	if !service.IsValidMetric(q.Metric) {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_METRIC", "Invalid metric, must be one of co2_kg, energy_kwh, duration_s")
+		return
+	}
+
+	from, to, ok := parseTimeRange(c, func(to time.Time) time.Time {
+		return to.AddDate(0, 0, -30)
+	})
+	if !ok {
+		return
+	}
+	q.From, q.To = from, to
+
+	if q.Filter, ok = parseRunFilter(c); !ok {
+		return
+	}
+
+	groups, err := s.statsService.Aggregate(service.RepositoryRuns(repo.ID), q)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "STATS_FETCH_FAILED", "Failed to aggregate runs")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"group_by": q.GroupBy,
+		"metric":   q.Metric,
+		"from":     q.From,
+		"to":       q.To,
+		"groups":   groups,
+	})
+}
+
+// Run histogram handler
+// @Summary Get the distribution of a metric over repository runs
+// @Description Count a repository's runs in buckets of equal width between the minimum and maximum of a metric, to chart its distribution and spot outliers
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param metric query string false "Metric (co2_kg, energy_kwh, duration_s)" default(co2_kg)
+// @Param buckets query int false "Number of buckets, at most 100" default(20)
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Param filter query string false "Filter expression, such as co2_kg>0.5 AND branch=main AND tag IN (nightly,release)"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/runs/histogram [get]
+func (s *Server) handleRunHistogram(c *gin.Context) {
+	repo, ok := s.requireVisibleRepository(c)
+	if !ok {
+		return
+	}
+
+	q := service.HistogramQuery{
+		Metric: c.DefaultQuery("metric", "co2_kg"),
+	}
+
+	if !service.IsValidMetric(q.Metric) {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_METRIC", "Invalid metric, must be one of co2_kg, energy_kwh, duration_s")
+		return
+	}
+
+	buckets, err := strconv.Atoi(c.DefaultQuery("buckets", strconv.Itoa(service.DefaultHistogramBuckets)))
+	if err != nil || buckets < 1 || buckets > service.MaxHistogramBuckets {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_BUCKETS", "Invalid buckets, must be between 1 and 100")
+		return
+	}
+	q.Buckets = buckets
+
+	from, to, ok := parseTimeRange(c, func(to time.Time) time.Time {
+		return to.AddDate(0, 0, -30)
+	})
+	if !ok {
+		return
+	}
+	q.From, q.To = from, to
+
+	if q.Filter, ok = parseRunFilter(c); !ok {
+		return
+	}
+
+	histogram, err := s.statsService.Histogram(service.RepositoryRuns(repo.ID), q)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "STATS_FETCH_FAILED", "Failed to build histogram")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"metric":  q.Metric,
+		"from":    q.From,
+		"to":      q.To,
+		"count":   histogram.Count,
+		"min":     histogram.Min,
+		"max":     histogram.Max,
+		"buckets": histogram.Buckets,
+	})
+}
+
+// Recommendations handler
+// @Summary Get optimization recommendations for a repository
+// @Description Analyze a repository's runs for cold caches, failed runs, scheduled runs on a dirty grid, oversized runners and dependency installation dominating their steps, and suggest changes with the CO2 they are estimated to have saved over the period, largest savings first
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Success 200 {object} service.Recommendations
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/recommendations [get]
+func (s *Server) handleRecommendations(c *gin.Context) {
+	repo, ok := s.requireVisibleRepository(c)
+	if !ok {
+		return
+	}
+
+	from, to, ok := parseTimeRange(c, func(to time.Time) time.Time {
+		return to.AddDate(0, 0, -30)
+	})
+	if !ok {
+		return
+	}
+
+	recommendations, err := s.statsService.Recommend(service.RepositoryRuns(repo.ID), from, to)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "STATS_FETCH_FAILED", "Failed to build recommendations")
+		return
+	}
+
+	c.JSON(http.StatusOK, recommendations)
+}
+
+// Wasted carbon handler
+// @Summary Get the wasted carbon of a repository
+// @Description Sum the CO2 of runs that produced no usable result: failed or cancelled runs (status or conclusion metadata) and attempts superseded by a retry (github_run_attempt metadata), in total, per workflow and as a trend, to find flaky pipelines
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param interval query string false "Bucket size of the trend (day, week, month)" default(week)
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD), defaults to 12 weeks before to for week buckets, 30 days for day and 12 months for month"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Success 200 {object} service.WastedCarbon
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/wasted-carbon [get]
+func (s *Server) handleWastedCarbon(c *gin.Context) {
+	repo, ok := s.requireVisibleRepository(c)
+	if !ok {
+		return
+	}
+
+	interval := c.DefaultQuery("interval", "week")
+	if !service.IsValidInterval(interval) {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_INTERVAL", "Invalid interval, must be one of day, week, month")
+		return
+	}
+	from, to, ok := parseTimeRange(c, func(to time.Time) time.Time {
+		return defaultTimeSeriesFrom(to, interval)
+	})
+	if !ok {
+		return
+	}
+	if service.CountBuckets(from, to, interval) > service.MaxTimeSeriesBuckets {
+		problem.Respond(c, http.StatusBadRequest, "TIME_RANGE_TOO_LARGE", "Time range too large for the requested interval")
+		return
+	}
+
+	waste, err := s.statsService.WastedCarbon(service.RepositoryRuns(repo.ID), from, to, interval)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "STATS_FETCH_FAILED", "Failed to analyze wasted carbon")
+		return
+	}
+
+	c.JSON(http.StatusOK, waste)
+}
+
+// maxCompareWindow bounds the window of branch comparisons
+const maxCompareWindow = 365 * 24 * time.Hour
+
+// parseCompareWindow parses a window given in days such as 14d, or as a duration such as 36h
+func parseCompareWindow(value string) (time.Duration, bool) {
+	var window time.Duration
+	if days, found := strings.CutSuffix(value, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, false
+		}
+		window = time.Duration(n) * 24 * time.Hour
+	} else {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, false
+		}
+		window = parsed
+	}
+	return window, window >= time.Hour && window <= maxCompareWindow
+}
+
+// Branch comparison handler
+// @Summary Compare two branches of a repository
+// @Description Compare the runs of a head branch with those of a base branch over the same recent window: CO2, energy and duration per run, run counts and total CO2, with the change from base to head
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param base query string true "Base branch, such as main"
+// @Param head query string true "Head branch"
+// @Param window query string false "Window ending now, in days such as 14d or as a duration such as 36h, from 1h to 365d" default(14d)
+// @Success 200 {object} service.BranchComparison
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/compare [get]
+func (s *Server) handleCompareBranches(c *gin.Context) {
+	repo, ok := s.requireVisibleRepository(c)
+	if !ok {
+		return
+	}
+
+	base, head := strings.TrimSpace(c.Query("base")), strings.TrimSpace(c.Query("head"))
+	if base == "" || head == "" {
+		problem.Respond(c, http.StatusBadRequest, "MISSING_BRANCH", "Missing base or head branch")
+		return
+	}
+	window, ok := parseCompareWindow(c.DefaultQuery("window", "14d"))
+	if !ok {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_WINDOW", "Invalid window, expected days such as 14d or a duration such as 36h, from 1h to 365d")
+		return
+	}
+
+	to := time.Now().UTC()
+	comparison, err := s.statsService.CompareBranches(service.RepositoryRuns(repo.ID), base, head, to.Add(-window), to)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "STATS_FETCH_FAILED", "Failed to compare branches")
+		return
+	}
+
+	c.JSON(http.StatusOK, comparison)
+}
+
+// parseReviewYear validates the year query parameter, defaulting to the current year.
+// On failure it writes a 400 response and returns false.
+func parseReviewYear(c *gin.Context) (int, bool) {
+	currentYear := time.Now().UTC().Year()
+	year, err := strconv.Atoi(c.DefaultQuery("year", strconv.Itoa(currentYear)))
+	if err != nil || year < 2000 || year > currentYear {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_YEAR", "Invalid year")
+		return 0, false
+	}
+	return year, true
+}
+
+// respondYearInReview builds the year in review for scope and writes the result
+func (s *Server) respondYearInReview(c *gin.Context, scope service.RunScope) {
+	year, ok := parseReviewYear(c)
+	if !ok {
+		return
+	}
+
+	review, err := s.statsService.YearInReview(scope, year)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "STATS_FETCH_FAILED", "Failed to build year in review")
+		return
+	}
+
+	c.JSON(http.StatusOK, review)
+}
+
+// User year in review handler
+// @Summary Get current user year in review
+// @Description Summarize the current user's year: totals, everyday equivalents, biggest regression and improvement, and per-month chart data
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param year query int false "Calendar year, defaults to the current year"
+// @Success 200 {object} service.YearInReview
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Router /me/year-in-review [get]
+func (s *Server) handleUserYearInReview(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	s.respondYearInReview(c, service.UserRuns(userID))
+}
+
+// Organization year in review handler
+// @Summary Get organization year in review
+// @Description Summarize an organization's year: totals, everyday equivalents, biggest regression and improvement, and per-month chart data (members only)
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param org path string true "GitHub organization login"
+// @Param year query int false "Calendar year, defaults to the current year"
+// @Success 200 {object} service.YearInReview
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /orgs/{org}/year-in-review [get]
+func (s *Server) handleOrganizationYearInReview(c *gin.Context) {
+	org, ok := s.requireOrganizationMember(c)
+	if !ok {
+		return
+	}
+
+	s.respondYearInReview(c, service.OrganizationRuns(org.ID))
+}
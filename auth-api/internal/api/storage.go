@@ -0,0 +1,87 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// Get repository storage footprint handler
+// @Summary Get repository storage footprint
+// @Description Get the latest artifact and cache storage of a repository, the energy and CO2 of keeping it for a month, and the storage energy and CO2 accrued over a time range
+// @Tags storage
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Success 200 {object} service.StorageFootprint
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/storage [get]
+func (s *Server) handleGetRepositoryStorage(c *gin.Context) {
+	repo, ok := s.requireVisibleRepository(c)
+	if !ok {
+		return
+	}
+
+	from, to, ok := parseTimeRange(c, func(to time.Time) time.Time {
+		return to.AddDate(0, 0, -30)
+	})
+	if !ok {
+		return
+	}
+
+	footprint, err := s.storageService.Footprint(repo.ID, from, to)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "STORAGE_FETCH_FAILED", "Failed to fetch storage footprint")
+		return
+	}
+
+	c.JSON(http.StatusOK, footprint)
+}
+
+// Report repository storage handler
+// @Summary Report repository storage
+// @Description Report the bytes of artifacts and caches a repository currently stores; the storage-emissions job accrues its energy and CO2 daily from the latest report (repository owner only)
+// @Tags storage
+// @Security CookieAuth
+// @Accept json
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param report body service.StorageReportRequest true "Storage report"
+// @Success 201 {object} db.StorageReport
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/storage [post]
+func (s *Server) handleReportRepositoryStorage(c *gin.Context) {
+	repo, ok := s.requireRepositoryOwner(c)
+	if !ok {
+		return
+	}
+
+	var req service.StorageReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body", err.Error())
+		return
+	}
+	if err := service.ValidateStorageReport(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_STORAGE_REPORT", "Invalid storage report", err.Error())
+		return
+	}
+
+	report, err := s.storageService.Report(repo.ID, &req, time.Now())
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "STORAGE_REPORT_FAILED", "Failed to save storage report")
+		return
+	}
+
+	c.JSON(http.StatusCreated, report)
+}
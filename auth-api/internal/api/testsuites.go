@@ -0,0 +1,134 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ecoci/auth-api/internal/junit"
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// Upload run test report handler
+// @Summary Upload run test report
+// @Description Attach the JUnit XML report of a run, replacing any uploaded before. The energy and CO2 of the run are apportioned across its test suites by duration, or by test count when the report has no times. Suites nested in others are flattened and suites of the same name merged. The report is the request body or the file field of a multipart form; it may be gzip or deflate encoded and is limited to MAX_INGEST_BODY_BYTES. Only the user who submitted the run and the owner of its repository may upload its report.
+// @Tags runs
+// @Security CookieAuth
+// @Security BearerAuth
+// @Accept xml
+// @Accept multipart/form-data
+// @Produce json
+// @Param run_id path string true "Run UUID"
+// @Param Content-Encoding header string false "gzip or deflate"
+// @Success 200 {object} testSuitesResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 413 {object} problem.Problem
+// @Failure 422 {object} problem.Problem
+// @Router /runs/{run_id}/test-suites [put]
+func (s *Server) handleUploadTestReport(c *gin.Context) {
+	run, ok := s.requireSubmittedRun(c)
+	if !ok {
+		return
+	}
+
+	file, err := importFile(c)
+	if err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_TEST_REPORT", "Invalid test report", err.Error())
+		return
+	}
+	defer file.Close()
+
+	suites, err := junit.Parse(file)
+	if err != nil {
+		problem.RespondDetail(c, http.StatusUnprocessableEntity, "INVALID_TEST_REPORT", "Invalid test report", err.Error())
+		return
+	}
+
+	saved, err := s.runService.WithContext(c.Request.Context()).ReplaceTestSuites(run, suites)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "TEST_REPORT_UPLOAD_FAILED", "Failed to save test report")
+		return
+	}
+
+	s.invalidateRunCaches(c.Request.Context(), run)
+	c.JSON(http.StatusOK, gin.H{"test_suites": saved})
+}
+
+// Get run test suites handler
+// @Summary Get run test suites
+// @Description Get the test suites of the JUnit report of a run with the energy and CO2 apportioned to each, the most CO2 first
+// @Tags runs
+// @Security CookieAuth
+// @Security BearerAuth
+// @Produce json
+// @Param run_id path string true "Run UUID"
+// @Success 200 {object} testSuitesResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /runs/{run_id}/test-suites [get]
+func (s *Server) handleGetRunTestSuites(c *gin.Context) {
+	run, ok := s.requireVisibleRun(c)
+	if !ok {
+		return
+	}
+
+	suites, err := s.runService.ListTestSuites(run.ID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "TEST_SUITES_FETCH_FAILED", "Failed to fetch test suites")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"test_suites": suites})
+}
+
+// Repository test suite emissions handler
+// @Summary Get repository test suite emissions
+// @Description Get the test suites of the runs of a repository over a time range by name with the energy and CO2 apportioned to them, the most CO2 first, pointing at the most expensive tests
+// @Tags statistics
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Param limit query int false "Test suites to return (at most 100)" default(20)
+// @Success 200 {object} testSuiteStatsResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/test-suites [get]
+func (s *Server) handleRepositoryTestSuiteStats(c *gin.Context) {
+	repo, ok := s.requireVisibleRepository(c)
+	if !ok {
+		return
+	}
+
+	from, to, ok := parseTimeRange(c, func(to time.Time) time.Time {
+		return to.AddDate(0, 0, -30)
+	})
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit < 1 || limit > service.MaxTestSuiteStats {
+		limit = 20
+	}
+
+	suites, err := s.statsService.TestSuiteStats(service.RepositoryRuns(repo.ID), from, to, limit)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "STATS_FETCH_FAILED", "Failed to fetch test suite emissions")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":        from,
+		"to":          to,
+		"test_suites": suites,
+	})
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// acmeReadHeaderTimeout bounds how long the ACME challenge listener waits for request headers
+const acmeReadHeaderTimeout = 10 * time.Second
+
+// httpServer creates the HTTP server of the API on addr. When TLS is configured, the server
+// carries the TLS configuration and, for ACME, the certificate manager that obtains and
+// renews the certificates of the configured hosts.
+func (s *Server) httpServer(addr string) (*http.Server, *autocert.Manager, error) {
+	server := &http.Server{Addr: addr, Handler: s.router}
+
+	switch {
+	case len(s.cfg.ACMEHosts) > 0:
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(s.cfg.ACMEHosts...),
+			Cache:      autocert.DirCache(s.cfg.ACMECacheDir),
+			Email:      s.cfg.ACMEEmail,
+		}
+		server.TLSConfig = manager.TLSConfig()
+		server.TLSConfig.MinVersion = tls.VersionTLS12
+		return server, manager, nil
+
+	case s.cfg.TLSCertFile != "":
+		certificate, err := tls.LoadX509KeyPair(s.cfg.TLSCertFile, s.cfg.TLSKeyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+		server.TLSConfig = &tls.Config{
+			Certificates: []tls.Certificate{certificate},
+			MinVersion:   tls.VersionTLS12,
+		}
+		return server, nil, nil
+	}
+
+	return server, nil, nil
+}
+
+// serveACMEChallenges answers the HTTP-01 challenges of Let's Encrypt on the plain HTTP
+// listener and redirects every other request to HTTPS
+func (s *Server) serveACMEChallenges(manager *autocert.Manager) {
+	if s.cfg.ACMEHTTPAddr == "" {
+		return
+	}
+	challengeServer := &http.Server{
+		Addr:              s.cfg.ACMEHTTPAddr,
+		Handler:           manager.HTTPHandler(nil),
+		ReadHeaderTimeout: acmeReadHeaderTimeout,
+	}
+	go func() {
+		log.Printf("Answering ACME challenges on %s", s.cfg.ACMEHTTPAddr)
+		if err := challengeServer.ListenAndServe(); err != nil {
+			log.Printf("ACME challenge listener stopped: %v", err)
+		}
+	}()
+}
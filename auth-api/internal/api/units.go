@@ -0,0 +1,229 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// unitsRecorder holds back the body written by a handler so its units can be converted
+// before it is sent
+type unitsRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+// Write implements io.Writer, buffering the body
+func (w *unitsRecorder) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+// WriteString implements io.StringWriter, buffering the body
+func (w *unitsRecorder) WriteString(data string) (int, error) {
+	return w.body.WriteString(data)
+}
+
+// displayUnits reports the CO2 and energy of successful JSON responses in the units asked
+// for with ?units=, such as g,Wh, or else in those the user prefers. Members named after
+// their unit are converted and renamed, such as co2_kg to co2_g, and the units are echoed
+// as the units member of object responses. Without either the response is left as it is.
+// GraphQL responses keep the units of their schema.
+func (s *Server) displayUnits() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw, ok := c.GetQuery("units")
+		if !ok {
+			raw = c.GetString("user_display_units")
+		}
+		if raw == "" || strings.HasSuffix(c.FullPath(), "/graphql") {
+			c.Next()
+			return
+		}
+		units, err := service.ParseDisplayUnits(raw)
+		if err != nil {
+			problem.Abort(c, http.StatusBadRequest, "INVALID_UNITS", "Invalid units parameter, expected units such as g,Wh")
+			return
+		}
+
+		recorder := &unitsRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+		c.Writer = recorder.ResponseWriter
+
+		body := recorder.body.Bytes()
+		if recorder.Status() >= 200 && recorder.Status() < 300 &&
+			strings.HasPrefix(recorder.Header().Get("Content-Type"), "application/json") {
+			if converted, err := convertResponseUnits(body, units); err == nil {
+				body = converted
+			}
+		}
+		if len(body) == 0 {
+			c.Writer.WriteHeaderNow()
+			return
+		}
+		if _, err := c.Writer.Write(body); err != nil {
+			_ = c.Error(err)
+		}
+	}
+}
+
+// convertResponseUnits converts a JSON body to units, echoing them in object bodies
+func convertResponseUnits(body []byte, units service.DisplayUnits) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	value = convertUnits(value, units)
+	if object, ok := value.(map[string]interface{}); ok {
+		object["units"] = units
+	}
+	return json.Marshal(value)
+}
+
+// convertUnits converts the members of value named after a CO2 or energy unit, renaming
+// them after the new unit. Units after "per", the denominator of intensities such as
+// grams_co2e_per_kwh, are left as they are.
+func convertUnits(value interface{}, units service.DisplayUnits) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(value))
+		for key, member := range value {
+			name, factor := unitMember(key, units)
+			if factor != 1 {
+				member = scaleNumbers(member, factor)
+			}
+			converted[name] = convertUnits(member, units)
+		}
+		return converted
+	case []interface{}:
+		for i := range value {
+			value[i] = convertUnits(value[i], units)
+		}
+		return value
+	}
+	return value
+}
+
+// unitMember returns the name of the member key in units and the factor converting its
+// values
+func unitMember(key string, units service.DisplayUnits) (string, float64) {
+	tokens := strings.Split(key, "_")
+	factor := 1.0
+	for i, token := range tokens {
+		switch token {
+		case "per":
+			return strings.Join(tokens, "_"), factor
+		case "kg":
+			tokens[i] = strings.ToLower(units.CO2)
+			factor *= units.CO2Factor()
+		case "kwh":
+			tokens[i] = strings.ToLower(units.Energy)
+			factor *= units.EnergyFactor()
+		}
+	}
+	return strings.Join(tokens, "_"), factor
+}
+
+// scaleNumbers multiplies the numbers of value by factor, keeping 12 significant digits so
+// conversions do not show floating-point noise
+func scaleNumbers(value interface{}, factor float64) interface{} {
+	switch value := value.(type) {
+	case json.Number:
+		number, err := value.Float64()
+		if err != nil {
+			return value
+		}
+		scaled, _ := strconv.ParseFloat(strconv.FormatFloat(number*factor, 'g', 12, 64), 64)
+		return scaled
+	case []interface{}:
+		for i := range value {
+			value[i] = scaleNumbers(value[i], factor)
+		}
+		return value
+	}
+	return value
+}
+
+// Get display units handler
+// @Summary Get display units
+// @Description Get the units responses report CO2 and energy in for the current user unless a request asks for others with ?units=
+// @Tags users
+// @Security CookieAuth
+// @Produce json
+// @Success 200 {object} service.DisplayUnits
+// @Failure 401 {object} problem.Problem
+// @Router /me/display-units [get]
+func (s *Server) handleGetDisplayUnits(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	user, err := s.userService.GetUserByID(userID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "USER_FETCH_FAILED", "Failed to get user information")
+		return
+	}
+
+	c.JSON(http.StatusOK, service.GetDisplayUnits(user))
+}
+
+// Update display units handler
+// @Summary Update display units
+// @Description Set the units responses report CO2 and energy in for the current user: co2 kg or g and energy kWh or Wh. Omitted quantities are reported in kg and kWh.
+// @Tags users
+// @Security CookieAuth
+// @Accept json
+// @Produce json
+// @Param units body service.DisplayUnits true "Display units"
+// @Success 200 {object} service.DisplayUnits
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Router /me/display-units [put]
+func (s *Server) handleUpdateDisplayUnits(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var units service.DisplayUnits
+	if err := c.ShouldBindJSON(&units); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body", err.Error())
+		return
+	}
+	if err := service.ValidateDisplayUnits(&units); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_UNITS", "Invalid display units", err.Error())
+		return
+	}
+
+	var before map[string]interface{}
+	if user, err := s.userService.GetUserByID(userID); err == nil {
+		before = displayUnitsAuditFields(service.GetDisplayUnits(user))
+	}
+
+	if err := s.userService.UpdateDisplayUnits(userID, units); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "DISPLAY_UNITS_UPDATE_FAILED", "Failed to update display units")
+		return
+	}
+
+	s.recordAudit(c, auditUser("display_units.update", userID, service.AuditDiff(before, displayUnitsAuditFields(units))))
+
+	c.JSON(http.StatusOK, units)
+}
+
+// displayUnitsAuditFields returns the audited display units of a user
+func displayUnitsAuditFields(units service.DisplayUnits) map[string]interface{} {
+	return map[string]interface{}{
+		"co2":    units.CO2,
+		"energy": units.Energy,
+	}
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// Get repository water settings handler
+// @Summary Get repository water settings
+// @Description Get the water usage effectiveness (WUE) the water of the runs of a repository is computed with, overriding that of its organization; null when none is set
+// @Tags water
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Success 200 {object} service.WaterSettings
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/water [get]
+func (s *Server) handleGetRepositoryWater(c *gin.Context) {
+	repo, ok := s.requireVisibleRepository(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, service.WaterSettings{WUELitersPerKWh: repo.WUELitersPerKWh})
+}
+
+// Set repository water settings handler
+// @Summary Set repository water settings
+// @Description Set the water usage effectiveness (WUE) in liters per kWh the water of new runs of a repository is computed with; null falls back to that of its organization and then of the hardware profile of the run (repository owner only)
+// @Tags water
+// @Security CookieAuth
+// @Accept json
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param settings body service.WaterSettings true "Water settings"
+// @Success 200 {object} service.WaterSettings
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/water [put]
+func (s *Server) handleSetRepositoryWater(c *gin.Context) {
+	repo, ok := s.requireRepositoryOwner(c)
+	if !ok {
+		return
+	}
+
+	req, ok := bindWaterSettings(c)
+	if !ok {
+		return
+	}
+
+	updated, err := s.repoService.SetWUE(repo.ID, req.WUELitersPerKWh)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "WATER_SETTINGS_SAVE_FAILED", "Failed to save water settings")
+		return
+	}
+
+	s.invalidateRepositoryCaches(c.Request.Context(), repo.ID)
+	s.recordAudit(c, auditRepository("water_settings.set", repo, service.AuditDiff(
+		waterSettingsAuditFields(service.WaterSettings{WUELitersPerKWh: repo.WUELitersPerKWh}),
+		waterSettingsAuditFields(*req),
+	)))
+
+	c.JSON(http.StatusOK, service.WaterSettings{WUELitersPerKWh: updated.WUELitersPerKWh})
+}
+
+// Get organization water settings handler
+// @Summary Get organization water settings
+// @Description Get the water usage effectiveness (WUE) the water of the runs of the repositories of an organization is computed with; null when none is set (members only)
+// @Tags water
+// @Security CookieAuth
+// @Produce json
+// @Param org path string true "GitHub organization login"
+// @Success 200 {object} service.WaterSettings
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /orgs/{org}/water [get]
+func (s *Server) handleGetOrganizationWater(c *gin.Context) {
+	org, ok := s.requireOrganizationMember(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, service.WaterSettings{WUELitersPerKWh: org.WUELitersPerKWh})
+}
+
+// Set organization water settings handler
+// @Summary Set organization water settings
+// @Description Set the water usage effectiveness (WUE) in liters per kWh the water of new runs of the repositories of an organization is computed with, unless a repository sets its own; null falls back to the hardware profile of the run (organization admins only)
+// @Tags water
+// @Security CookieAuth
+// @Accept json
+// @Produce json
+// @Param org path string true "GitHub organization login"
+// @Param settings body service.WaterSettings true "Water settings"
+// @Success 200 {object} service.WaterSettings
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /orgs/{org}/water [put]
+func (s *Server) handleSetOrganizationWater(c *gin.Context) {
+	org, ok := s.requireOrganizationAdmin(c)
+	if !ok {
+		return
+	}
+
+	req, ok := bindWaterSettings(c)
+	if !ok {
+		return
+	}
+
+	updated, err := s.orgService.SetWUE(org.ID, req.WUELitersPerKWh)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "WATER_SETTINGS_SAVE_FAILED", "Failed to save water settings")
+		return
+	}
+
+	s.recordAudit(c, auditOrganization("water_settings.set", org, service.AuditDiff(
+		waterSettingsAuditFields(service.WaterSettings{WUELitersPerKWh: org.WUELitersPerKWh}),
+		waterSettingsAuditFields(*req),
+	)))
+
+	c.JSON(http.StatusOK, service.WaterSettings{WUELitersPerKWh: updated.WUELitersPerKWh})
+}
+
+// bindWaterSettings binds and validates the water settings of the request body
+func bindWaterSettings(c *gin.Context) (*service.WaterSettings, bool) {
+	var req service.WaterSettings
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body", err.Error())
+		return nil, false
+	}
+	if err := service.ValidateWaterSettings(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_WATER_SETTINGS", "Invalid water settings", err.Error())
+		return nil, false
+	}
+	return &req, true
+}
+
+// waterSettingsAuditFields returns the audited water settings; a WUE of nil is not set
+func waterSettingsAuditFields(settings service.WaterSettings) map[string]interface{} {
+	fields := map[string]interface{}{
+		"wue_l_per_kwh": nil,
+	}
+	if settings.WUELitersPerKWh != nil {
+		fields["wue_l_per_kwh"] = *settings.WUELitersPerKWh
+	}
+	return fields
+}
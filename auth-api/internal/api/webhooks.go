@@ -0,0 +1,513 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/commitstatus"
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/eventbus"
+	"github.com/ecoci/auth-api/internal/notify"
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+	"github.com/ecoci/auth-api/internal/webhook"
+)
+
+// publishRunEvents queues the webhook and event bus events, chat notifications, owner alerts
+// and commit status caused by a newly created run. Failures are logged rather than returned so they never fail the run
+// submission itself.
+func (s *Server) publishRunEvents(run *db.Run) {
+	repo := run.Repository
+	if repo == nil {
+		var err error
+		if repo, err = s.repoService.GetRepositoryByID(run.RepositoryID); err != nil {
+			log.Printf("Failed to publish events for run %s: %v", run.ID, err)
+			return
+		}
+	}
+	orgID := repo.OrganizationID
+	publish := func(eventType, subject string, data interface{}) {
+		event := webhook.Event{Type: eventType, RepositoryID: run.RepositoryID, OrganizationID: orgID, Subject: subject, Data: data}
+		if err := s.webhooks.Publish(event); err != nil {
+			log.Printf("Failed to publish %s event for run %s: %v", eventType, run.ID, err)
+		}
+		s.eventBus.Publish(event)
+	}
+
+	// The submitting user's profile is not part of the payload
+	payload := *run
+	payload.User = nil
+	publish(webhook.EventRunCreated, "runs/"+run.ID.String(), payload)
+
+	regression, err := s.statsService.DetectRegression(run)
+	if err != nil {
+		log.Printf("Failed to check run %s for regressions: %v", run.ID, err)
+	} else if regression != nil {
+		publish(webhook.EventRegressionDetected, "runs/"+run.ID.String(), regression)
+		msg := notify.RegressionMessage(repo, regression)
+		s.notifier.Notify(repo.ID, service.NotificationRegressionDetected, msg)
+		s.notifyRepositoryOwner(repo, service.NotificationRegressionDetected, msg)
+	}
+
+	crossings, err := s.budgetService.CrossedBudgets(run)
+	if err != nil {
+		log.Printf("Failed to check budgets for run %s: %v", run.ID, err)
+	}
+	for i := range crossings {
+		publish(webhook.EventBudgetExceeded, "budgets/"+crossings[i].Period, crossings[i])
+		msg := notify.BudgetExceededMessage(repo, &crossings[i])
+		s.notifier.Notify(repo.ID, service.NotificationBudgetExceeded, msg)
+		s.notifyRepositoryOwner(repo, service.NotificationBudgetExceeded, msg)
+	}
+
+	if repo.CommitStatus && run.GitCommitSHA != nil {
+		s.publishCommitStatus(repo, run, regression)
+	}
+}
+
+// publishRepoUpdated publishes the settings or owner change of a repository to the event bus
+func (s *Server) publishRepoUpdated(repo *db.Repository) {
+	// Related records are not part of the payload
+	payload := *repo
+	payload.Owner = nil
+	payload.Organization = nil
+	payload.Runs = nil
+	s.eventBus.Publish(webhook.Event{Type: eventbus.EventRepoUpdated, RepositoryID: repo.ID, OrganizationID: repo.OrganizationID, Data: payload})
+}
+
+// publishCommitStatus reports whether run kept its repository within budget and free of
+// regressions as a status on its commit
+func (s *Server) publishCommitStatus(repo *db.Repository, run *db.Run, regression *service.Regression) {
+	exceeded, err := s.budgetService.ExceededBudgets(run)
+	if err != nil {
+		log.Printf("Failed to check budgets for commit status of run %s: %v", run.ID, err)
+		return
+	}
+
+	sha := *run.GitCommitSHA
+	detailsURL := fmt.Sprintf("%s/repos/%s/commits/%s", strings.TrimRight(s.cfg.AppURL, "/"), repo.ID, sha)
+	s.commitStatuses.Publish(repo.FullName, sha, commitstatus.Evaluate(run, exceeded, regression, detailsURL))
+}
+
+// requireWebhook resolves the webhook_id path parameter and ensures the current user may
+// manage it: the repository owner for repository webhooks, an admin for organization
+// webhooks. Webhooks the user cannot manage are reported as not found.
+func (s *Server) requireWebhook(c *gin.Context) (*db.Webhook, bool) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return nil, false
+	}
+
+	notFound := func() {
+		problem.Respond(c, http.StatusNotFound, "WEBHOOK_NOT_FOUND", "Webhook not found")
+	}
+
+	webhookID, err := uuid.Parse(c.Param("webhook_id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_WEBHOOK_ID", "Invalid webhook ID")
+		return nil, false
+	}
+
+	hook, err := s.webhookService.GetWebhook(webhookID)
+	if err != nil {
+		notFound()
+		return nil, false
+	}
+
+	allowed := false
+	if hook.RepositoryID != nil {
+		repo, err := s.repoService.GetRepositoryByID(*hook.RepositoryID)
+		allowed = err == nil && repo.OwnerID == userID
+	} else if hook.OrganizationID != nil {
+		allowed, err = s.orgService.IsAdmin(*hook.OrganizationID, userID)
+		if err != nil {
+			problem.Respond(c, http.StatusInternalServerError, "ORGANIZATION_ACCESS_CHECK_FAILED", "Failed to check organization role")
+			return nil, false
+		}
+	}
+	if !allowed {
+		notFound()
+		return nil, false
+	}
+
+	return hook, true
+}
+
+// createWebhook validates the request body and creates a webhook for target
+func (s *Server) createWebhook(c *gin.Context, target service.WebhookTarget) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		return
+	}
+
+	var req service.WebhookCreateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_REQUEST_BODY", "Invalid request body", err.Error())
+		return
+	}
+
+	if parsed, err := url.Parse(req.URL); err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_WEBHOOK_URL", "Webhook URL must be an absolute http or https URL")
+		return
+	}
+	if err := webhook.CheckTarget(c.Request.Context(), req.URL, s.cfg.WebhookPrivateTargets); err != nil {
+		problem.RespondDetail(c, http.StatusBadRequest, "WEBHOOK_TARGET_NOT_ALLOWED", "Webhook target not allowed",
+			"Webhook URLs must resolve to public addresses, not loopback, private or link-local ones")
+		return
+	}
+	for _, event := range req.Events {
+		if !webhook.IsValidEvent(event) {
+			problem.RespondDetail(c, http.StatusBadRequest, "INVALID_WEBHOOK_EVENT", "Invalid event", "Must be one of "+strings.Join(webhook.Events, ", "))
+			return
+		}
+	}
+	if req.Format != "" && !webhook.IsValidFormat(req.Format) {
+		problem.RespondDetail(c, http.StatusBadRequest, "INVALID_WEBHOOK_FORMAT", "Invalid format", "Must be one of "+strings.Join(webhook.Formats, ", "))
+		return
+	}
+
+	hook, err := s.webhookService.CreateWebhook(target, userID, &req)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "WEBHOOK_CREATION_FAILED", "Failed to create webhook")
+		return
+	}
+
+	s.recordAudit(c, s.auditWebhook("webhook.create", hook, service.AuditDiff(nil, webhookAuditFields(hook))))
+
+	// The secret is only ever returned on creation
+	c.JSON(http.StatusCreated, gin.H{
+		"webhook": hook,
+		"secret":  hook.Secret,
+	})
+}
+
+// listWebhooks responds with the webhooks of target
+func (s *Server) listWebhooks(c *gin.Context, target service.WebhookTarget) {
+	webhooks, err := s.webhookService.ListWebhooks(target)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "WEBHOOKS_FETCH_FAILED", "Failed to list webhooks")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"webhooks": webhooks,
+	})
+}
+
+// List repository webhooks handler
+// @Summary List repository webhooks
+// @Description Get the webhook subscriptions of a repository (repository owner only)
+// @Tags webhooks
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/webhooks [get]
+func (s *Server) handleListRepositoryWebhooks(c *gin.Context) {
+	repo, ok := s.requireRepositoryOwner(c)
+	if !ok {
+		return
+	}
+
+	s.listWebhooks(c, service.RepositoryWebhooks(repo.ID))
+}
+
+// Create repository webhook handler
+// @Summary Create repository webhook
+// @Description Subscribe a URL to run.created, regression.detected and budget.exceeded events of a repository (repository owner only). Deliveries are signed with HMAC-SHA256 of the body in the X-EcoCI-Signature-256 header. The URL must resolve to a public address. The secret is only returned in this response.
+// @Tags webhooks
+// @Security CookieAuth
+// @Accept json
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param webhook body service.WebhookCreateRequest true "Webhook subscription"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/webhooks [post]
+func (s *Server) handleCreateRepositoryWebhook(c *gin.Context) {
+	repo, ok := s.requireRepositoryOwner(c)
+	if !ok {
+		return
+	}
+
+	s.createWebhook(c, service.RepositoryWebhooks(repo.ID))
+}
+
+// List organization webhooks handler
+// @Summary List organization webhooks
+// @Description Get the webhook subscriptions of an organization (members only)
+// @Tags webhooks
+// @Security CookieAuth
+// @Produce json
+// @Param org path string true "GitHub organization login"
+// @Success 200 {object} map[string]interface{}
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /orgs/{org}/webhooks [get]
+func (s *Server) handleListOrganizationWebhooks(c *gin.Context) {
+	org, ok := s.requireOrganizationMember(c)
+	if !ok {
+		return
+	}
+
+	s.listWebhooks(c, service.OrganizationWebhooks(org.ID))
+}
+
+// Create organization webhook handler
+// @Summary Create organization webhook
+// @Description Subscribe a URL to events of every repository of an organization (organization admins only). The URL must resolve to a public address. The secret is only returned in this response.
+// @Tags webhooks
+// @Security CookieAuth
+// @Accept json
+// @Produce json
+// @Param org path string true "GitHub organization login"
+// @Param webhook body service.WebhookCreateRequest true "Webhook subscription"
+// @Success 201 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /orgs/{org}/webhooks [post]
+func (s *Server) handleCreateOrganizationWebhook(c *gin.Context) {
+	org, ok := s.requireOrganizationAdmin(c)
+	if !ok {
+		return
+	}
+
+	s.createWebhook(c, service.OrganizationWebhooks(org.ID))
+}
+
+// Delete webhook handler
+// @Summary Delete webhook
+// @Description Remove a webhook subscription and its delivery history (repository owner or organization admins only)
+// @Tags webhooks
+// @Security CookieAuth
+// @Produce json
+// @Param webhook_id path string true "Webhook UUID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /webhooks/{webhook_id} [delete]
+func (s *Server) handleDeleteWebhook(c *gin.Context) {
+	hook, ok := s.requireWebhook(c)
+	if !ok {
+		return
+	}
+
+	if err := s.webhookService.DeleteWebhook(hook.ID); err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "WEBHOOK_DELETION_FAILED", "Failed to delete webhook")
+		return
+	}
+
+	s.recordAudit(c, s.auditWebhook("webhook.delete", hook, service.AuditDiff(webhookAuditFields(hook), nil)))
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Webhook deleted",
+	})
+}
+
+// List webhook deliveries handler
+// @Summary List webhook deliveries
+// @Description Get the deliveries of a webhook, newest first. Use status=dead to list dead-lettered deliveries that exhausted their retries.
+// @Tags webhooks
+// @Security CookieAuth
+// @Produce json
+// @Param webhook_id path string true "Webhook UUID"
+// @Param status query string false "Filter by status" Enums(pending,delivered,dead)
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /webhooks/{webhook_id}/deliveries [get]
+func (s *Server) handleListWebhookDeliveries(c *gin.Context) {
+	hook, ok := s.requireWebhook(c)
+	if !ok {
+		return
+	}
+
+	status := c.Query("status")
+	if status != "" && status != webhook.StatusPending && status != webhook.StatusDelivered && status != webhook.StatusDead {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_STATUS", "Invalid status, must be one of pending, delivered, dead")
+		return
+	}
+
+	// Parse pagination parameters
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	deliveries, total, err := s.webhookService.ListDeliveries(hook.ID, status, limit, (page-1)*limit)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "WEBHOOK_DELIVERIES_FETCH_FAILED", "Failed to list webhook deliveries")
+		return
+	}
+
+	// Calculate pagination info
+	totalPages := (total + int64(limit) - 1) / int64(limit)
+
+	c.JSON(http.StatusOK, gin.H{
+		"deliveries": deliveries,
+		"pagination": gin.H{
+			"page":     page,
+			"limit":    limit,
+			"total":    total,
+			"pages":    totalPages,
+			"has_next": int64(page) < totalPages,
+			"has_prev": page > 1,
+		},
+	})
+}
+
+// Redeliver webhook delivery handler
+// @Summary Redeliver webhook delivery
+// @Description Queue a delivery, typically a dead-lettered one, for immediate redelivery with a fresh retry budget
+// @Tags webhooks
+// @Security CookieAuth
+// @Produce json
+// @Param webhook_id path string true "Webhook UUID"
+// @Param delivery_id path string true "Delivery UUID"
+// @Success 202 {object} db.WebhookDelivery
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /webhooks/{webhook_id}/deliveries/{delivery_id}/redeliver [post]
+func (s *Server) handleRedeliverWebhookDelivery(c *gin.Context) {
+	hook, ok := s.requireWebhook(c)
+	if !ok {
+		return
+	}
+
+	deliveryID, err := uuid.Parse(c.Param("delivery_id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_DELIVERY_ID", "Invalid delivery ID")
+		return
+	}
+
+	delivery, err := s.webhookService.Redeliver(hook.ID, deliveryID)
+	if err != nil {
+		if err.Error() == "delivery not found" {
+			problem.Respond(c, http.StatusNotFound, "DELIVERY_NOT_FOUND", "Delivery not found")
+			return
+		}
+		problem.Respond(c, http.StatusInternalServerError, "REDELIVERY_FAILED", "Failed to queue redelivery")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, delivery)
+}
+
+// WebhookDeliveryDetail is a delivery with the outcome of every attempt to send it
+type WebhookDeliveryDetail struct {
+	db.WebhookDelivery
+	AttemptHistory []db.WebhookDeliveryAttempt `json:"attempt_history"`
+}
+
+// Get webhook delivery handler
+// @Summary Get webhook delivery
+// @Description Get a delivery of a webhook with its attempt history: the response status, latency, start of the response body (unless private webhook targets are allowed) and error of every attempt, oldest first
+// @Tags webhooks
+// @Security CookieAuth
+// @Produce json
+// @Param webhook_id path string true "Webhook UUID"
+// @Param delivery_id path string true "Delivery UUID"
+// @Success 200 {object} WebhookDeliveryDetail
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /webhooks/{webhook_id}/deliveries/{delivery_id} [get]
+func (s *Server) handleGetWebhookDelivery(c *gin.Context) {
+	hook, ok := s.requireWebhook(c)
+	if !ok {
+		return
+	}
+
+	deliveryID, err := uuid.Parse(c.Param("delivery_id"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, "INVALID_DELIVERY_ID", "Invalid delivery ID")
+		return
+	}
+
+	delivery, err := s.webhookService.GetDelivery(hook.ID, deliveryID)
+	if err != nil {
+		if err.Error() == "delivery not found" {
+			problem.Respond(c, http.StatusNotFound, "DELIVERY_NOT_FOUND", "Delivery not found")
+			return
+		}
+		problem.Respond(c, http.StatusInternalServerError, "WEBHOOK_DELIVERY_FETCH_FAILED", "Failed to get webhook delivery")
+		return
+	}
+
+	attempts, err := s.webhookService.ListDeliveryAttempts(delivery.ID)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "WEBHOOK_DELIVERY_FETCH_FAILED", "Failed to get webhook delivery")
+		return
+	}
+
+	c.JSON(http.StatusOK, WebhookDeliveryDetail{
+		WebhookDelivery: *delivery,
+		AttemptHistory:  attempts,
+	})
+}
+
+// Redrive webhook deliveries handler
+// @Summary Redrive dead-lettered webhook deliveries
+// @Description Queue every dead-lettered delivery of a webhook for immediate redelivery with a fresh retry budget, for example after the receiving endpoint was fixed
+// @Tags webhooks
+// @Security CookieAuth
+// @Produce json
+// @Param webhook_id path string true "Webhook UUID"
+// @Param since query string false "Only redrive deliveries created at or after this time (RFC3339)"
+// @Success 202 {object} map[string]interface{}
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /webhooks/{webhook_id}/deliveries/redrive [post]
+func (s *Server) handleRedriveWebhookDeliveries(c *gin.Context) {
+	hook, ok := s.requireWebhook(c)
+	if !ok {
+		return
+	}
+
+	var since *time.Time
+	if value := c.Query("since"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			problem.RespondDetail(c, http.StatusBadRequest, "INVALID_TIME_RANGE", "Invalid time range", "The since parameter must be an RFC3339 time")
+			return
+		}
+		since = &parsed
+	}
+
+	redriven, err := s.webhookService.RedriveDead(hook.ID, since)
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "REDELIVERY_FAILED", "Failed to queue redelivery")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"redriven": redriven,
+	})
+}
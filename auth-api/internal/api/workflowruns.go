@@ -0,0 +1,93 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// Get repository workflow runs handler
+// @Summary Get workflow executions of a repository
+// @Description Get a paginated list of a repository's workflow executions, most recent first. Runs submitted with the same workflow run group, such as the jobs of a matrix build, are collapsed into one execution with their totals; runs without a group are executions of their own. Runs older than the retention of the repository's plan are not listed.
+// @Tags repositories
+// @Security CookieAuth
+// @Produce json
+// @Param repo_id path string true "Repository UUID"
+// @Param page query int false "Page number" default(1)
+// @Param limit query int false "Items per page" default(20)
+// @Param from query string false "Range start (RFC3339 or YYYY-MM-DD), defaults to 30 days before to"
+// @Param to query string false "Range end (RFC3339 or YYYY-MM-DD), defaults to now"
+// @Param filter query string false "Filter expression over the runs collapsed, such as branch=main AND workflow_name=CI"
+// @Success 200 {object} workflowRunsResponse
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Router /repos/{repo_id}/workflow-runs [get]
+func (s *Server) handleGetRepositoryWorkflowRuns(c *gin.Context) {
+	repo, ok := s.requireVisibleRepository(c)
+	if !ok {
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	from, to, ok := parseTimeRange(c, func(to time.Time) time.Time {
+		return to.AddDate(0, 0, -30)
+	})
+	if !ok {
+		return
+	}
+	expr, ok := parseRunFilter(c)
+	if !ok {
+		return
+	}
+
+	// Runs older than the plan's retention are not listed
+	cutoff, err := s.quotaService.WithContext(c.Request.Context()).RetentionCutoff(repo, time.Now())
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "PLAN_FETCH_FAILED", "Failed to get repository plan")
+		return
+	}
+	if cutoff != nil && from.Before(*cutoff) {
+		from = *cutoff
+	}
+
+	executions, total, err := s.statsService.WorkflowRuns(service.RepositoryRuns(repo.ID), service.WorkflowRunQuery{
+		From:   from,
+		To:     to,
+		Limit:  limit,
+		Offset: (page - 1) * limit,
+		Filter: expr,
+	})
+	if err != nil {
+		problem.Respond(c, http.StatusInternalServerError, "RUNS_FETCH_FAILED", "Failed to get repository workflow runs")
+		return
+	}
+
+	totalPages := (total + int64(limit) - 1) / int64(limit)
+	c.JSON(http.StatusOK, gin.H{
+		"from":          from,
+		"to":            to,
+		"workflow_runs": executions,
+		"pagination": gin.H{
+			"page":     page,
+			"limit":    limit,
+			"total":    total,
+			"pages":    totalPages,
+			"has_next": int64(page) < totalPages,
+			"has_prev": page > 1,
+		},
+	})
+}
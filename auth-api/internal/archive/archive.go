@@ -0,0 +1,296 @@
+// Package archive writes the runs of every repository and UTC day as a Parquet file to an
+// S3-compatible bucket, partitioned Hive-style by day and repository, for long-term analytics
+// with DuckDB, Athena or Spark. The daily rollups track which days changed, so a day is
+// written again when late runs are imported or runs are deleted.
+package archive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/parquet"
+)
+
+// batchSize is the number of partitions selected at a time
+const batchSize = 500
+
+// fileName is the name of the file of each partition
+const fileName = "runs.parquet"
+
+// Columns are the columns of the files. The day and repository ID are also the partition
+// keys of the paths.
+var Columns = []parquet.Column{
+	{Name: "run_id", Type: parquet.String},
+	{Name: "repository_id", Type: parquet.String},
+	{Name: "repository", Type: parquet.String, Optional: true},
+	{Name: "organization_id", Type: parquet.String, Optional: true},
+	{Name: "organization", Type: parquet.String, Optional: true},
+	{Name: "user_id", Type: parquet.String},
+	{Name: "energy_kwh", Type: parquet.Double},
+	{Name: "co2_kg", Type: parquet.Double},
+	{Name: "duration_s", Type: parquet.Double},
+	{Name: "git_commit_sha", Type: parquet.String, Optional: true},
+	{Name: "branch", Type: parquet.String, Optional: true},
+	{Name: "workflow", Type: parquet.String, Optional: true},
+	{Name: "metadata", Type: parquet.JSON, Optional: true},
+	{Name: "created_at", Type: parquet.Timestamp},
+}
+
+// Archiver writes the partitions of the runs to a store
+type Archiver struct {
+	db     *gorm.DB
+	store  Store
+	prefix string
+	now    func() time.Time
+}
+
+// NewArchiver creates an archiver of the runs of database, writing to the keys of store
+// under prefix
+func NewArchiver(database *gorm.DB, store Store, prefix string) *Archiver {
+	return &Archiver{db: database, store: store, prefix: prefix, now: time.Now}
+}
+
+// Key returns the object key of the partition of a repository and day
+func (a *Archiver) Key(repoID uuid.UUID, day time.Time) string {
+	return path.Join(a.prefix, "runs", "day="+day.Format("2006-01-02"), "repo="+repoID.String(), fileName)
+}
+
+// Location returns the URL of the directory of the partitions
+func (a *Archiver) Location() string {
+	return a.store.URL(path.Join(a.prefix, "runs") + "/")
+}
+
+// Pattern returns the glob matching the files of every partition
+func (a *Archiver) Pattern() string {
+	return a.store.URL(path.Join(a.prefix, "runs", "day=*", "repo=*", fileName))
+}
+
+// partition identifies the runs of a repository on a day
+type partition struct {
+	RepositoryID uuid.UUID
+	Day          time.Time
+}
+
+// Result counts the files an export wrote and removed
+type Result struct {
+	Written int
+	Removed int
+}
+
+// Export writes the partitions of the days before now that were never written or whose
+// rollups changed since, and removes the partitions whose runs were deleted. Days whose
+// runs were purged by a retention policy are kept as they were archived.
+func (a *Archiver) Export(ctx context.Context, now time.Time) (Result, error) {
+	var result Result
+	var after *partition
+	for {
+		query := a.db.WithContext(ctx).Table("repository_daily_rollups AS r").
+			Select("r.repository_id, r.day").
+			Joins("JOIN repositories AS repo ON repo.id = r.repository_id").
+			Joins("LEFT JOIN archive_partitions AS p ON p.repository_id = r.repository_id AND p.day = r.day").
+			Where("r.day < ?", db.RollupDay(now)).
+			Where("repo.runs_purged_before IS NULL OR r.day >= repo.runs_purged_before").
+			Where("p.repository_id IS NULL OR r.updated_at > p.exported_at").
+			Order("r.day, r.repository_id").
+			Limit(batchSize)
+		if after != nil {
+			query = query.Where("r.day > ? OR (r.day = ? AND r.repository_id > ?)", after.Day, after.Day, after.RepositoryID)
+		}
+		var due []partition
+		if err := query.Scan(&due).Error; err != nil {
+			return result, fmt.Errorf("failed to select partitions to archive: %w", err)
+		}
+
+		for _, p := range due {
+			written, err := a.write(ctx, p)
+			if err != nil {
+				return result, err
+			}
+			if written {
+				result.Written++
+			} else {
+				result.Removed++
+			}
+		}
+		if len(due) < batchSize {
+			break
+		}
+		after = &due[len(due)-1]
+	}
+
+	// Days without a rollup have no runs left, unless the runs were purged
+	var stale []db.ArchivePartition
+	err := a.db.WithContext(ctx).Table("archive_partitions AS p").
+		Select("p.*").
+		Joins("LEFT JOIN repository_daily_rollups AS r ON r.repository_id = p.repository_id AND r.day = p.day").
+		Joins("LEFT JOIN repositories AS repo ON repo.id = p.repository_id").
+		Where("r.repository_id IS NULL").
+		Where("repo.runs_purged_before IS NULL OR p.day >= repo.runs_purged_before").
+		Scan(&stale).Error
+	if err != nil {
+		return result, fmt.Errorf("failed to select stale partitions: %w", err)
+	}
+	for _, p := range stale {
+		if err := a.remove(ctx, &p); err != nil {
+			return result, err
+		}
+		result.Removed++
+	}
+	return result, nil
+}
+
+// write writes the file of a partition and records it. A partition without runs is removed
+// instead; it reports whether the file was written.
+func (a *Archiver) write(ctx context.Context, p partition) (bool, error) {
+	// Changes after this point are written by the next export
+	exportedAt := a.now().UTC()
+
+	var repo db.Repository
+	err := a.db.WithContext(ctx).Unscoped().Preload("Organization").Where("id = ?", p.RepositoryID).Take(&repo).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to load repository %s: %w", p.RepositoryID, err)
+	}
+	var runs []db.Run
+	err = a.db.WithContext(ctx).
+		Where("repository_id = ? AND created_at >= ? AND created_at < ?", p.RepositoryID, p.Day, p.Day.AddDate(0, 0, 1)).
+		Order("created_at, id").
+		Find(&runs).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to load runs of %s on %s: %w", repo.FullName, p.Day.Format("2006-01-02"), err)
+	}
+	if len(runs) == 0 {
+		return false, a.remove(ctx, &db.ArchivePartition{RepositoryID: p.RepositoryID, Day: p.Day, Key: a.Key(p.RepositoryID, p.Day)})
+	}
+
+	file, err := writeRuns(&repo, runs)
+	if err != nil {
+		return false, err
+	}
+	key := a.Key(p.RepositoryID, p.Day)
+	if err := a.store.Put(ctx, key, parquet.ContentType, file); err != nil {
+		return false, fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+
+	record := db.ArchivePartition{
+		RepositoryID: p.RepositoryID,
+		Day:          p.Day,
+		Key:          key,
+		RunCount:     int64(len(runs)),
+		SizeBytes:    int64(len(file)),
+		ExportedAt:   exportedAt,
+	}
+	err = a.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "repository_id"}, {Name: "day"}},
+		DoUpdates: clause.AssignmentColumns([]string{"key", "run_count", "size_bytes", "exported_at"}),
+	}).Create(&record).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to record partition %s: %w", key, err)
+	}
+	return true, nil
+}
+
+// remove deletes the file of a partition and its record
+func (a *Archiver) remove(ctx context.Context, p *db.ArchivePartition) error {
+	if err := a.store.Delete(ctx, p.Key); err != nil {
+		return fmt.Errorf("failed to delete %s: %w", p.Key, err)
+	}
+	err := a.db.WithContext(ctx).Where("repository_id = ? AND day = ?", p.RepositoryID, p.Day).Delete(&db.ArchivePartition{}).Error
+	if err != nil {
+		return fmt.Errorf("failed to remove partition %s: %w", p.Key, err)
+	}
+	return nil
+}
+
+// writeRuns returns the Parquet file of the runs of a repository
+func writeRuns(repo *db.Repository, runs []db.Run) ([]byte, error) {
+	var organizationID, organization *string
+	if repo.OrganizationID != nil {
+		id := repo.OrganizationID.String()
+		organizationID = &id
+	}
+	if repo.Organization != nil {
+		organization = &repo.Organization.GitHubLogin
+	}
+
+	var buf bytes.Buffer
+	w := parquet.NewWriter(&buf, Columns)
+	for _, run := range runs {
+		var metadata interface{}
+		if len(run.RunMetadata) > 0 {
+			encoded, err := json.Marshal(run.RunMetadata)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode metadata of run %s: %w", run.ID, err)
+			}
+			metadata = string(encoded)
+		}
+		err := w.Write(
+			run.ID.String(),
+			run.RepositoryID.String(),
+			repo.FullName,
+			organizationID,
+			organization,
+			run.UserID.String(),
+			run.EnergyKWh,
+			run.CO2Kg,
+			run.DurationS,
+			run.GitCommitSHA,
+			run.BranchName,
+			run.WorkflowName,
+			metadata,
+			run.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write run %s: %w", run.ID, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Filter selects the partitions of a manifest
+type Filter struct {
+	RepositoryID *uuid.UUID
+	// From and To bound the days, both inclusive
+	From *time.Time
+	To   *time.Time
+}
+
+// Partitions returns a page of the archived partitions, oldest day first, and their total
+func (a *Archiver) Partitions(ctx context.Context, filter Filter, limit, offset int) ([]db.ArchivePartition, int64, error) {
+	query := a.db.WithContext(ctx).Model(&db.ArchivePartition{})
+	if filter.RepositoryID != nil {
+		query = query.Where("repository_id = ?", *filter.RepositoryID)
+	}
+	if filter.From != nil {
+		query = query.Where("day >= ?", db.RollupDay(*filter.From))
+	}
+	if filter.To != nil {
+		query = query.Where("day <= ?", db.RollupDay(*filter.To))
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count archive partitions: %w", err)
+	}
+	var partitions []db.ArchivePartition
+	if err := query.Order("day, repository_id").Limit(limit).Offset(offset).Find(&partitions).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list archive partitions: %w", err)
+	}
+	return partitions, total, nil
+}
+
+// URL returns the location of an object of the archive
+func (a *Archiver) URL(key string) string {
+	return a.store.URL(key)
+}
@@ -0,0 +1,223 @@
+package archive
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/parquet"
+)
+
+// memoryStore keeps the objects of a bucket in memory
+type memoryStore struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (m *memoryStore) Put(ctx context.Context, key, contentType string, body []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = body
+	return nil
+}
+
+func (m *memoryStore) Delete(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+func (m *memoryStore) URL(key string) string {
+	return "s3://archive/" + key
+}
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	database, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := database.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	require.NoError(t, database.AutoMigrate(&db.User{}, &db.Organization{}, &db.Repository{}, &db.Run{},
+		&db.RepositoryDailyRollup{}, &db.ArchivePartition{}))
+	return database
+}
+
+// createRepository creates a user and a repository of an organization
+func createRepository(t *testing.T, database *gorm.DB) (*db.User, *db.Repository) {
+	org := &db.Organization{GitHubID: 100, GitHubLogin: "greenorg"}
+	require.NoError(t, database.Create(org).Error)
+	user := &db.User{GitHubID: 1, GitHubUsername: "alice"}
+	require.NoError(t, database.Create(user).Error)
+	repo := &db.Repository{OwnerID: user.ID, OrganizationID: &org.ID, GitHubRepoID: 10, Name: "app", FullName: "greenorg/app", HTMLURL: "https://github.com/greenorg/app"}
+	require.NoError(t, database.Create(repo).Error)
+	return user, repo
+}
+
+func partitions(t *testing.T, database *gorm.DB) []db.ArchivePartition {
+	var result []db.ArchivePartition
+	require.NoError(t, database.Order("day").Find(&result).Error)
+	return result
+}
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+	database := setupTestDB(t)
+	store := &memoryStore{objects: map[string][]byte{}}
+	archiver := NewArchiver(database, store, "ecoci")
+
+	// Rollups record when they changed, so the days are relative to the current one
+	user, repo := createRepository(t, database)
+	today := db.RollupDay(time.Now())
+	branch := "main"
+	var runs []*db.Run
+	for _, i := range []int{-2, -1, -1, 0} {
+		run := &db.Run{UserID: user.ID, RepositoryID: repo.ID, EnergyKWh: 1, CO2Kg: 0.5, DurationS: 60, BranchName: &branch,
+			RunMetadata: db.JSONB{"ci": "github"}, CreatedAt: today.AddDate(0, 0, i).Add(time.Hour)}
+		require.NoError(t, database.Create(run).Error)
+		runs = append(runs, run)
+	}
+	now := time.Now().UTC()
+
+	// Today's runs wait for the day to end
+	result, err := archiver.Export(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, Result{Written: 2}, result)
+	written := partitions(t, database)
+	require.Len(t, written, 2)
+	key := "ecoci/runs/day=" + today.AddDate(0, 0, -1).Format("2006-01-02") + "/repo=" + repo.ID.String() + "/runs.parquet"
+	assert.Equal(t, key, written[1].Key)
+	assert.Equal(t, int64(2), written[1].RunCount)
+	file := store.objects[key]
+	require.NotEmpty(t, file)
+	assert.Equal(t, int64(len(file)), written[1].SizeBytes)
+	assert.Equal(t, "PAR1", string(file[:4]))
+	assert.Equal(t, "PAR1", string(file[len(file)-4:]))
+	assert.Contains(t, string(file), "greenorg/app")
+
+	// Unchanged days are not written again
+	result, err = archiver.Export(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, Result{}, result)
+
+	// The next night writes the day that was in progress and the days of late runs
+	require.NoError(t, database.Create(&db.Run{UserID: user.ID, RepositoryID: repo.ID, EnergyKWh: 1, CO2Kg: 0.5, DurationS: 60,
+		CreatedAt: today.AddDate(0, 0, -2).Add(2 * time.Hour)}).Error)
+	result, err = archiver.Export(ctx, now.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	assert.Equal(t, Result{Written: 2}, result)
+	written = partitions(t, database)
+	require.Len(t, written, 3)
+	assert.Equal(t, int64(2), written[0].RunCount)
+
+	// Days whose runs were deleted are removed
+	require.NoError(t, database.Delete(runs[1]).Error)
+	require.NoError(t, database.Delete(runs[2]).Error)
+	require.NoError(t, db.RebuildRollups(database, repo.ID))
+	result, err = archiver.Export(ctx, now.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Removed)
+	assert.NotContains(t, store.objects, key)
+	require.Len(t, partitions(t, database), 2)
+
+	// Days whose runs and rollups were purged by the retention policy stay archived
+	purged := today.AddDate(0, 0, -1)
+	require.NoError(t, database.Unscoped().Where("created_at < ?", purged).Delete(&db.Run{}).Error)
+	require.NoError(t, database.Model(repo).Update("runs_purged_before", purged).Error)
+	require.NoError(t, database.Where("day < ?", purged).Delete(&db.RepositoryDailyRollup{}).Error)
+	result, err = archiver.Export(ctx, now.AddDate(0, 0, 2))
+	require.NoError(t, err)
+	assert.Equal(t, Result{}, result)
+	assert.Len(t, partitions(t, database), 2)
+}
+
+func TestPartitions(t *testing.T) {
+	ctx := context.Background()
+	database := setupTestDB(t)
+	archiver := NewArchiver(database, &memoryStore{objects: map[string][]byte{}}, "ecoci")
+
+	_, repo := createRepository(t, database)
+	day := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		d := day.AddDate(0, 0, i)
+		require.NoError(t, database.Create(&db.ArchivePartition{RepositoryID: repo.ID, Day: d, Key: archiver.Key(repo.ID, d),
+			RunCount: 1, SizeBytes: 100, ExportedAt: time.Now()}).Error)
+	}
+
+	from, to := day.AddDate(0, 0, 1), day.AddDate(0, 0, 2)
+	result, total, err := archiver.Partitions(ctx, Filter{RepositoryID: &repo.ID, From: &from, To: &to}, 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), total)
+	require.Len(t, result, 1)
+	assert.Equal(t, "ecoci/runs/day=2024-06-02/repo="+repo.ID.String()+"/runs.parquet", result[0].Key)
+
+	assert.Equal(t, "s3://archive/ecoci/runs/", archiver.Location())
+	assert.Equal(t, "s3://archive/ecoci/runs/day=*/repo=*/runs.parquet", archiver.Pattern())
+}
+
+func TestS3(t *testing.T) {
+	var requests []*http.Request
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r)
+		bodies = append(bodies, string(body))
+		switch {
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNotFound)
+		case strings.Contains(r.URL.Path, "denied"):
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>AccessDenied</Code><Message>Access Denied</Message></Error>`)
+		}
+	}))
+	defer server.Close()
+
+	credentials := aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		return aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}, nil
+	})
+	store, err := newS3(server.Client(), server.URL, "eu-central-1", "archive", credentials)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// Keys are addressed by path and escaped strictly
+	require.NoError(t, store.Put(ctx, "ecoci/runs/day=2024-06-01/a b.parquet", parquet.ContentType, []byte("data")))
+	require.Len(t, requests, 1)
+	put := requests[0]
+	assert.Equal(t, http.MethodPut, put.Method)
+	assert.Equal(t, "/archive/ecoci/runs/day%3D2024-06-01/a%20b.parquet", put.URL.EscapedPath())
+	assert.Equal(t, "data", bodies[0])
+	assert.Equal(t, parquet.ContentType, put.Header.Get("Content-Type"))
+	sum := sha256.Sum256([]byte("data"))
+	assert.Equal(t, hex.EncodeToString(sum[:]), put.Header.Get("X-Amz-Content-Sha256"))
+	assert.True(t, strings.HasPrefix(put.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"))
+	assert.Contains(t, put.Header.Get("Authorization"), "/eu-central-1/s3/aws4_request")
+
+	// Deleting a missing object succeeds
+	require.NoError(t, store.Delete(ctx, "ecoci/missing.parquet"))
+
+	err = store.Put(ctx, "denied.parquet", parquet.ContentType, []byte("data"))
+	assert.EqualError(t, err, "PUT denied.parquet failed with status 403: AccessDenied: Access Denied")
+
+	assert.Equal(t, "s3://archive/ecoci/runs.parquet", store.URL("ecoci/runs.parquet"))
+
+	// Amazon S3 is addressed by virtual host
+	amazon, err := newS3(server.Client(), "", "eu-central-1", "archive", credentials)
+	require.NoError(t, err)
+	assert.Equal(t, "https://archive.s3.eu-central-1.amazonaws.com/ecoci/a%2Bb.parquet", amazon.objectURL("ecoci/a+b.parquet").String())
+}
@@ -0,0 +1,176 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+
+	"github.com/ecoci/auth-api/internal/tracing"
+)
+
+// requestTimeout bounds every request to the object store
+const requestTimeout = time.Minute
+
+// Store is an S3-compatible bucket that files of the archive are written to
+type Store interface {
+	// Put writes an object, replacing any object with the same key
+	Put(ctx context.Context, key, contentType string, body []byte) error
+	// Delete removes an object; deleting a missing object succeeds
+	Delete(ctx context.Context, key string) error
+	// URL returns the location of an object as query engines name it, such as s3://bucket/key
+	URL(key string) string
+}
+
+// S3 is a bucket of Amazon S3 or an S3-compatible store such as MinIO or Cloudflare R2.
+// Requests are signed with AWS Signature Version 4.
+type S3 struct {
+	client      *http.Client
+	endpoint    *url.URL
+	bucket      string
+	region      string
+	pathStyle   bool
+	credentials aws.CredentialsProvider
+	signer      *v4.Signer
+}
+
+// NewS3 creates a store of bucket with credentials from the standard AWS sources
+// (environment, shared files, instance roles). Amazon S3 is addressed by virtual host; an
+// endpoint, as S3-compatible stores need, is addressed by path.
+func NewS3(ctx context.Context, endpoint, region, bucket string) (*S3, error) {
+	var options []func(*awsconfig.LoadOptions) error
+	if region != "" {
+		options = append(options, awsconfig.WithRegion(region))
+	}
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	return newS3(&http.Client{Timeout: requestTimeout, Transport: tracing.Transport(nil)}, endpoint, cfg.Region, bucket, cfg.Credentials)
+}
+
+// newS3 creates a store sending requests with client
+func newS3(client *http.Client, endpoint, region, bucket string, credentials aws.CredentialsProvider) (*S3, error) {
+	pathStyle := endpoint != ""
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+	parsed, err := url.Parse(strings.TrimRight(endpoint, "/"))
+	if err != nil || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", endpoint)
+	}
+	return &S3{
+		client:      client,
+		endpoint:    parsed,
+		bucket:      bucket,
+		region:      region,
+		pathStyle:   pathStyle,
+		credentials: credentials,
+		signer:      v4.NewSigner(),
+	}, nil
+}
+
+// URL implements Store
+func (s *S3) URL(key string) string {
+	return "s3://" + s.bucket + "/" + key
+}
+
+// objectURL returns the URL of an object. Every byte of the key but the unreserved ones is
+// escaped, as the canonical requests of Signature Version 4 require.
+func (s *S3) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	path := "/" + key
+	if s.pathStyle {
+		path = "/" + s.bucket + path
+	} else {
+		u.Host = s.bucket + "." + u.Host
+	}
+	u.Path = u.Path + path
+
+	var escaped strings.Builder
+	escaped.WriteString(s.endpoint.EscapedPath())
+	for _, segment := range strings.Split(path, "/")[1:] {
+		escaped.WriteByte('/')
+		for _, b := range []byte(segment) {
+			if 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9' || strings.IndexByte("-_.~", b) >= 0 {
+				escaped.WriteByte(b)
+			} else {
+				fmt.Fprintf(&escaped, "%%%02X", b)
+			}
+		}
+	}
+	u.RawPath = escaped.String()
+	return &u
+}
+
+// Put implements Store
+func (s *S3) Put(ctx context.Context, key, contentType string, body []byte) error {
+	header := http.Header{}
+	header.Set("Content-Type", contentType)
+	return s.do(ctx, http.MethodPut, key, header, body)
+}
+
+// Delete implements Store
+func (s *S3) Delete(ctx context.Context, key string) error {
+	return s.do(ctx, http.MethodDelete, key, nil, nil)
+}
+
+// do sends a signed request for an object
+func (s *S3) do(ctx context.Context, method, key string, header http.Header, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(key).String(), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.ContentLength = int64(len(body))
+
+	credentials, err := s.credentials.Retrieve(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get AWS credentials: %w", err)
+	}
+	sum := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(sum[:])
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	err = s.signer.SignHTTP(ctx, credentials, req, payloadHash, "s3", s.region, time.Now(), func(o *v4.SignerOptions) {
+		o.DisableURIPathEscaping = true
+	})
+	if err != nil {
+		return fmt.Errorf("failed to sign request: %w", err)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %w", method, key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 || (method == http.MethodDelete && resp.StatusCode == http.StatusNotFound) {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	var s3Err struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if xml.Unmarshal(data, &s3Err) == nil && s3Err.Code != "" {
+		return fmt.Errorf("%s %s failed with status %d: %s: %s", method, key, resp.StatusCode, s3Err.Code, s3Err.Message)
+	}
+	return fmt.Errorf("%s %s failed with status %d", method, key, resp.StatusCode)
+}
@@ -1,13 +1,19 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
+// APITokenAudience is the audience of API tokens, which users create for API clients and
+// which stay valid until they expire or are deleted
+const APITokenAudience = "ecoci-api-token"
+
 // JWTClaims represents the JWT token claims
 type JWTClaims struct {
 	UserID         uuid.UUID `json:"user_id"`
@@ -15,10 +21,23 @@ type JWTClaims struct {
 	jwt.RegisteredClaims
 }
 
+// IsAPIToken reports whether the claims belong to an API token rather than a session
+func (c *JWTClaims) IsAPIToken() bool {
+	for _, audience := range c.Audience {
+		if audience == APITokenAudience {
+			return true
+		}
+	}
+	return false
+}
+
 // JWTManager handles JWT token creation and validation
 type JWTManager struct {
-	secretKey  []byte
-	expiration time.Duration
+	mu        sync.RWMutex
+	secretKey []byte
+	// previousKey still validates the tokens signed before the secret was rotated
+	previousKey []byte
+	expiration  time.Duration
 }
 
 // NewJWTManager creates a new JWT manager
@@ -46,8 +65,41 @@ func (jm *JWTManager) GenerateToken(userID uuid.UUID, githubUsername string) (st
 		},
 	}
 
+	return jm.sign(claims)
+}
+
+// GenerateAPIToken generates the JWT of the API token tokenID, which expires at expiresAt or
+// never when it is nil
+func (jm *JWTManager) GenerateAPIToken(userID uuid.UUID, githubUsername string, tokenID uuid.UUID, expiresAt *time.Time) (string, error) {
+	now := time.Now().UTC()
+
+	claims := &JWTClaims{
+		UserID:         userID,
+		GitHubUsername: githubUsername,
+		RegisteredClaims: jwt.RegisteredClaims{
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    "ecoci-auth-api",
+			Subject:   userID.String(),
+			Audience:  jwt.ClaimStrings{APITokenAudience},
+			ID:        tokenID.String(),
+		},
+	}
+	if expiresAt != nil {
+		claims.ExpiresAt = jwt.NewNumericDate(*expiresAt)
+	}
+
+	return jm.sign(claims)
+}
+
+// sign signs claims with the current secret
+func (jm *JWTManager) sign(claims *JWTClaims) (string, error) {
+	jm.mu.RLock()
+	secretKey := jm.secretKey
+	jm.mu.RUnlock()
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jm.secretKey)
+	tokenString, err := token.SignedString(secretKey)
 	if err != nil {
 		return "", fmt.Errorf("failed to sign JWT token: %w", err)
 	}
@@ -55,16 +107,38 @@ func (jm *JWTManager) GenerateToken(userID uuid.UUID, githubUsername string) (st
 	return tokenString, nil
 }
 
+// SetSecret rotates the signing secret. Tokens signed with the previous secret stay valid
+// until they expire, so rotating the secret does not sign everybody out.
+func (jm *JWTManager) SetSecret(secretKey string) {
+	jm.mu.Lock()
+	defer jm.mu.Unlock()
+	if string(jm.secretKey) == secretKey {
+		return
+	}
+	jm.previousKey = jm.secretKey
+	jm.secretKey = []byte(secretKey)
+}
+
 // ValidateToken validates a JWT token and returns the claims
 func (jm *JWTManager) ValidateToken(tokenString string) (*JWTClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		// Validate the signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return jm.secretKey, nil
-	})
+	jm.mu.RLock()
+	secretKey, previousKey := jm.secretKey, jm.previousKey
+	jm.mu.RUnlock()
 
+	parse := func(key []byte) (*jwt.Token, error) {
+		return jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
+			// Validate the signing method
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			}
+			return key, nil
+		})
+	}
+
+	token, err := parse(secretKey)
+	if errors.Is(err, jwt.ErrTokenSignatureInvalid) && previousKey != nil {
+		token, err = parse(previousKey)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse JWT token: %w", err)
 	}
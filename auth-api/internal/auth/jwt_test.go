@@ -181,4 +181,58 @@ func TestJWTClaims_Validation(t *testing.T) {
 	assert.True(t, claims.ExpiresAt.Time.After(now))
 	assert.True(t, claims.IssuedAt.Time.Before(now.Add(time.Second))) // Allow 1 second tolerance
 	assert.True(t, claims.NotBefore.Time.Before(now.Add(time.Second)))
-}
\ No newline at end of file
+}
+func TestJWTManager_SetSecret(t *testing.T) {
+	jm := NewJWTManager("old-secret", time.Hour)
+	userID := uuid.New()
+
+	oldToken, err := jm.GenerateToken(userID, "testuser")
+	require.NoError(t, err)
+
+	jm.SetSecret("new-secret")
+	newToken, err := jm.GenerateToken(userID, "testuser")
+	require.NoError(t, err)
+
+	// New tokens are signed with the new secret
+	_, err = NewJWTManager("new-secret", time.Hour).ValidateToken(newToken)
+	assert.NoError(t, err)
+
+	// Tokens signed before the rotation stay valid
+	claims, err := jm.ValidateToken(oldToken)
+	require.NoError(t, err)
+	assert.Equal(t, userID, claims.UserID)
+
+	// Only the previous secret is kept
+	jm.SetSecret("newest-secret")
+	_, err = jm.ValidateToken(oldToken)
+	assert.Error(t, err)
+	_, err = jm.ValidateToken(newToken)
+	assert.NoError(t, err)
+}
+
+func TestJWTManager_GenerateAPIToken(t *testing.T) {
+	jm := NewJWTManager("test-secret-key", time.Hour)
+	userID, tokenID := uuid.New(), uuid.New()
+
+	// Without an expiry the token outlives session tokens
+	token, err := jm.GenerateAPIToken(userID, "testuser", tokenID, nil)
+	require.NoError(t, err)
+	claims, err := jm.ValidateToken(token)
+	require.NoError(t, err)
+	assert.True(t, claims.IsAPIToken())
+	assert.Equal(t, tokenID.String(), claims.ID)
+	assert.Equal(t, userID, claims.UserID)
+	assert.Nil(t, claims.ExpiresAt)
+
+	expiresAt := time.Now().Add(-time.Minute)
+	token, err = jm.GenerateAPIToken(userID, "testuser", tokenID, &expiresAt)
+	require.NoError(t, err)
+	_, err = jm.ValidateToken(token)
+	assert.Error(t, err)
+
+	session, err := jm.GenerateToken(userID, "testuser")
+	require.NoError(t, err)
+	claims, err = jm.ValidateToken(session)
+	require.NoError(t, err)
+	assert.False(t, claims.IsAPIToken())
+}
@@ -6,9 +6,12 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
 
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/github"
+
+	"github.com/ecoci/auth-api/internal/tracing"
 )
 
 // GitHubUser represents a GitHub user from the API
@@ -20,8 +23,17 @@ type GitHubUser struct {
 	AvatarURL string  `json:"avatar_url"`
 }
 
+// GitHubOrganization represents a GitHub organization the user belongs to
+type GitHubOrganization struct {
+	ID    int64  `json:"id"`
+	Login string `json:"login"`
+	// Role is the role of the user in the organization, "admin" or "member"
+	Role string `json:"-"`
+}
+
 // OAuthManager handles GitHub OAuth authentication
 type OAuthManager struct {
+	mu     sync.RWMutex
 	config *oauth2.Config
 }
 
@@ -31,7 +43,7 @@ func NewOAuthManager(clientID, clientSecret, redirectURL string) *OAuthManager {
 		ClientID:     clientID,
 		ClientSecret: clientSecret,
 		RedirectURL:  redirectURL,
-		Scopes:       []string{"user:email", "read:user"},
+		Scopes:       []string{"user:email", "read:user", "read:org"},
 		Endpoint:     github.Endpoint,
 	}
 
@@ -40,14 +52,45 @@ func NewOAuthManager(clientID, clientSecret, redirectURL string) *OAuthManager {
 	}
 }
 
+// SetClientSecret rotates the OAuth client secret
+func (om *OAuthManager) SetClientSecret(clientSecret string) {
+	om.mu.Lock()
+	defer om.mu.Unlock()
+	config := *om.config
+	config.ClientSecret = clientSecret
+	om.config = &config
+}
+
+// oauthConfig returns the current OAuth configuration
+func (om *OAuthManager) oauthConfig() *oauth2.Config {
+	om.mu.RLock()
+	defer om.mu.RUnlock()
+	return om.config
+}
+
+// withTracedClient makes the OAuth2 library send its requests through a traced transport, so
+// every call to GitHub appears as a span of the request in ctx
+func withTracedClient(ctx context.Context) context.Context {
+	return context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: tracing.Transport(nil)})
+}
+
+// getWithContext sends a GET request bound to ctx
+func getWithContext(ctx context.Context, client *http.Client, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
 // GetAuthURL returns the GitHub OAuth authorization URL
 func (om *OAuthManager) GetAuthURL(state string) string {
-	return om.config.AuthCodeURL(state, oauth2.AccessTypeOnline)
+	return om.oauthConfig().AuthCodeURL(state, oauth2.AccessTypeOnline)
 }
 
 // ExchangeCodeForToken exchanges the authorization code for an access token
 func (om *OAuthManager) ExchangeCodeForToken(ctx context.Context, code string) (*oauth2.Token, error) {
-	token, err := om.config.Exchange(ctx, code)
+	token, err := om.oauthConfig().Exchange(withTracedClient(ctx), code)
 	if err != nil {
 		return nil, fmt.Errorf("failed to exchange code for token: %w", err)
 	}
@@ -57,10 +100,10 @@ func (om *OAuthManager) ExchangeCodeForToken(ctx context.Context, code string) (
 
 // GetUserInfo retrieves user information from GitHub using the access token
 func (om *OAuthManager) GetUserInfo(ctx context.Context, token *oauth2.Token) (*GitHubUser, error) {
-	client := om.config.Client(ctx, token)
+	client := om.oauthConfig().Client(withTracedClient(ctx), token)
 	
 	// Get user info from GitHub API
-	resp, err := client.Get("https://api.github.com/user")
+	resp, err := getWithContext(ctx, client, "https://api.github.com/user")
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user info from GitHub: %w", err)
 	}
@@ -92,9 +135,42 @@ func (om *OAuthManager) GetUserInfo(ctx context.Context, token *oauth2.Token) (*
 	return &user, nil
 }
 
+// GetUserOrganizations retrieves the organizations the user is an active member of, with
+// their role in each
+func (om *OAuthManager) GetUserOrganizations(ctx context.Context, token *oauth2.Token) ([]GitHubOrganization, error) {
+	client := om.oauthConfig().Client(withTracedClient(ctx), token)
+
+	resp, err := getWithContext(ctx, client, "https://api.github.com/user/memberships/orgs?state=active&per_page=100")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organizations from GitHub: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("GitHub API returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var memberships []struct {
+		Role         string             `json:"role"`
+		Organization GitHubOrganization `json:"organization"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&memberships); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal organizations: %w", err)
+	}
+
+	orgs := make([]GitHubOrganization, 0, len(memberships))
+	for _, membership := range memberships {
+		org := membership.Organization
+		org.Role = membership.Role
+		orgs = append(orgs, org)
+	}
+	return orgs, nil
+}
+
 // getPrimaryEmail retrieves the user's primary email from GitHub
 func (om *OAuthManager) getPrimaryEmail(ctx context.Context, client *http.Client) (string, error) {
-	resp, err := client.Get("https://api.github.com/user/emails")
+	resp, err := getWithContext(ctx, client, "https://api.github.com/user/emails")
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,446 @@
+// Package backup dumps all EcoCI data to a portable archive and loads it back, for moving
+// an instance to a new database and for disaster recovery without raw pg_dump files.
+//
+// An archive is a gzip-compressed tar file holding manifest.json followed by one JSON Lines
+// file per table (tables/<name>.jsonl). Rows are keyed by column name, so archives can be
+// restored into a database whose schema has gained columns since the backup was taken.
+// Archives contain secrets (webhook signing secrets, chat integration tokens) and must be
+// stored accordingly.
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/version"
+)
+
+// Format identifies EcoCI backup archives
+const Format = "ecoci-backup"
+
+// FormatVersion is the version of the archive layout written by Write
+const FormatVersion = 1
+
+// manifestName is the name of the manifest entry, the first of an archive
+const manifestName = "manifest.json"
+
+// batchSize is how many rows are inserted at once when restoring
+const batchSize = 500
+
+// ErrNotEmpty is returned when restoring into a database that already holds data
+var ErrNotEmpty = errors.New("database already holds data")
+
+// tables are the backed up models, parents before the tables referencing them
+var tables = []interface{}{
+	&db.Organization{},
+	&db.User{},
+	&db.Repository{},
+	&db.RepositoryLanguage{},
+	&db.OrganizationMember{},
+	&db.RepositoryCollaborator{},
+	&db.RepositoryBaseline{},
+	&db.RepositoryBudget{},
+	&db.Run{},
+	&db.Measurement{},
+	&db.RunGPU{},
+	&db.RunTestSuite{},
+	&db.RunImageBuild{},
+	&db.RunComment{},
+	&db.RepositoryDailyRollup{},
+	&db.StorageReport{},
+	&db.RepositoryStorageDay{},
+	&db.Webhook{},
+	&db.WebhookDelivery{},
+	&db.WebhookDeliveryAttempt{},
+	&db.OrganizationIntegration{},
+	&db.RepositoryNotificationRoute{},
+	&db.AlertRule{},
+	&db.SavedView{},
+	&db.UserPreference{},
+	&db.NotificationPreference{},
+	&db.GitHubCredential{},
+	&db.APIToken{},
+	&db.RetentionPolicy{},
+	&db.RetentionReport{},
+	&db.CarbonOffset{},
+	&db.EmissionFactor{},
+	&db.EmissionFactorVersion{},
+	&db.RecalculationReport{},
+	&db.AuditEvent{},
+	&db.FeatureFlag{},
+	&db.Job{},
+	&db.JobRun{},
+}
+
+// schedulerTables hold the state of the job scheduler, which the server creates on start.
+// Restoring replaces them instead of requiring them to be empty.
+var schedulerTables = map[string]bool{"jobs": true, "job_runs": true}
+
+// Manifest describes an archive
+type Manifest struct {
+	Format        string    `json:"format"`
+	FormatVersion int       `json:"format_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	// MigrationVersion is the schema version of the database the backup was taken from
+	MigrationVersion uint   `json:"migration_version"`
+	AppVersion       string `json:"app_version"`
+	// Tables maps each table to its number of rows, in restore order
+	Tables []TableCount `json:"tables"`
+}
+
+// TableCount is the number of rows of a table in an archive
+type TableCount struct {
+	Name string `json:"name"`
+	Rows int64  `json:"rows"`
+}
+
+// table is a backed up model with its parsed schema
+type table struct {
+	model  interface{}
+	schema *schema.Schema
+}
+
+// parseTables parses the schemas of the backed up models
+func parseTables(database *gorm.DB) ([]table, error) {
+	parsed := make([]table, 0, len(tables))
+	for _, model := range tables {
+		stmt := &gorm.Statement{DB: database}
+		if err := stmt.Parse(model); err != nil {
+			return nil, fmt.Errorf("failed to parse model %T: %w", model, err)
+		}
+		parsed = append(parsed, table{model: model, schema: stmt.Schema})
+	}
+	return parsed, nil
+}
+
+// snapshot runs fn in a read-only transaction that sees every table at the same point in time
+func snapshot(ctx context.Context, database *gorm.DB, fn func(tx *gorm.DB) error) error {
+	if !db.DialectOf(database).IsPostgres() {
+		return database.WithContext(ctx).Transaction(fn)
+	}
+	return database.WithContext(ctx).Transaction(fn, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+}
+
+// Write writes an archive of every table to w
+func Write(ctx context.Context, database *gorm.DB, w io.Writer, now time.Time) (*Manifest, error) {
+	parsed, err := parseTables(database)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{
+		Format:        Format,
+		FormatVersion: FormatVersion,
+		CreatedAt:     now.UTC(),
+		AppVersion:    version.Version,
+	}
+	gz := gzip.NewWriter(w)
+	archive := tar.NewWriter(gz)
+
+	err = snapshot(ctx, database, func(tx *gorm.DB) error {
+		migrationVersion, dirty, err := db.MigrationVersion(tx)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return fmt.Errorf("migration %d of the database is dirty", migrationVersion)
+		}
+		manifest.MigrationVersion = migrationVersion
+
+		for _, t := range parsed {
+			var count int64
+			if err := tx.Unscoped().Model(t.model).Count(&count).Error; err != nil {
+				return fmt.Errorf("failed to count %s: %w", t.schema.Table, err)
+			}
+			manifest.Tables = append(manifest.Tables, TableCount{Name: t.schema.Table, Rows: count})
+		}
+		data, err := json.MarshalIndent(manifest, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode manifest: %w", err)
+		}
+		if err := writeEntry(archive, manifestName, now, data); err != nil {
+			return err
+		}
+
+		for _, t := range parsed {
+			if err := writeTable(ctx, tx, archive, t, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	return manifest, nil
+}
+
+// writeEntry adds a file to the archive
+func writeEntry(archive *tar.Writer, name string, modTime time.Time, data []byte) error {
+	header := &tar.Header{Name: name, Mode: 0o600, Size: int64(len(data)), ModTime: modTime}
+	if err := archive.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if _, err := archive.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// writeTable adds the rows of a table to the archive. Tar entries need their size up front,
+// so the rows are spooled to a temporary file first.
+func writeTable(ctx context.Context, tx *gorm.DB, archive *tar.Writer, t table, modTime time.Time) error {
+	spool, err := os.CreateTemp("", "ecoci-backup-*.jsonl")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(spool.Name())
+	defer spool.Close()
+
+	rows, err := tx.Unscoped().Model(t.model).Rows()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", t.schema.Table, err)
+	}
+	defer rows.Close()
+
+	buffered := bufio.NewWriter(spool)
+	encoder := json.NewEncoder(buffered)
+	for rows.Next() {
+		row := reflect.New(t.schema.ModelType)
+		if err := tx.ScanRows(rows, row.Interface()); err != nil {
+			return fmt.Errorf("failed to read %s: %w", t.schema.Table, err)
+		}
+		if err := encoder.Encode(encodeRow(ctx, t.schema, row.Elem())); err != nil {
+			return fmt.Errorf("failed to encode %s: %w", t.schema.Table, err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", t.schema.Table, err)
+	}
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("failed to spool %s: %w", t.schema.Table, err)
+	}
+
+	size, err := spool.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to spool %s: %w", t.schema.Table, err)
+	}
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to spool %s: %w", t.schema.Table, err)
+	}
+	name := tableEntry(t.schema.Table)
+	header := &tar.Header{Name: name, Mode: 0o600, Size: size, ModTime: modTime}
+	if err := archive.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if _, err := io.Copy(archive, spool); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// tableEntry returns the name of the archive entry holding the rows of a table
+func tableEntry(name string) string {
+	return "tables/" + name + ".jsonl"
+}
+
+// encodeRow maps the columns of a row to their values
+func encodeRow(ctx context.Context, s *schema.Schema, row reflect.Value) map[string]interface{} {
+	values := make(map[string]interface{}, len(s.DBNames))
+	for _, field := range s.Fields {
+		if field.DBName == "" {
+			continue
+		}
+		values[field.DBName] = field.ReflectValueOf(ctx, row).Interface()
+	}
+	return values
+}
+
+// decodeRow sets the fields of a new row from the columns of an archived row; columns the
+// archive lacks are left unset
+func decodeRow(ctx context.Context, s *schema.Schema, columns map[string]json.RawMessage) (reflect.Value, error) {
+	row := reflect.New(s.ModelType).Elem()
+	for _, field := range s.Fields {
+		raw, ok := columns[field.DBName]
+		if field.DBName == "" || !ok {
+			continue
+		}
+		value := reflect.New(field.FieldType)
+		if err := json.Unmarshal(raw, value.Interface()); err != nil {
+			return reflect.Value{}, fmt.Errorf("invalid value of %s: %w", field.DBName, err)
+		}
+		field.ReflectValueOf(ctx, row).Set(value.Elem())
+	}
+	return row, nil
+}
+
+// ReadManifest reads the manifest of an archive without restoring it
+func ReadManifest(r io.Reader) (*Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a backup archive: %w", err)
+	}
+	defer gz.Close()
+	return readManifest(tar.NewReader(gz))
+}
+
+// readManifest reads and checks the first entry of an archive
+func readManifest(archive *tar.Reader) (*Manifest, error) {
+	header, err := archive.Next()
+	if err != nil || header.Name != manifestName {
+		return nil, fmt.Errorf("not a backup archive: %s is missing", manifestName)
+	}
+	var manifest Manifest
+	if err := json.NewDecoder(archive).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if manifest.Format != Format {
+		return nil, fmt.Errorf("not a backup archive: unknown format %q", manifest.Format)
+	}
+	if manifest.FormatVersion > FormatVersion {
+		return nil, fmt.Errorf("archive format version %d is newer than the supported version %d", manifest.FormatVersion, FormatVersion)
+	}
+	return &manifest, nil
+}
+
+// Restore loads an archive into database, which must be migrated to at least the schema
+// version of the backup and must not hold data yet. The rows are inserted as they are,
+// without hooks, in a single transaction.
+func Restore(ctx context.Context, database *gorm.DB, r io.Reader) (*Manifest, error) {
+	parsed, err := parseTables(database)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]table, len(parsed))
+	for _, t := range parsed {
+		byName[t.schema.Table] = t
+	}
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a backup archive: %w", err)
+	}
+	defer gz.Close()
+	archive := tar.NewReader(gz)
+	manifest, err := readManifest(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	migrationVersion, _, err := db.MigrationVersion(database.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if manifest.MigrationVersion > migrationVersion {
+		return nil, fmt.Errorf("backup has schema version %d but the database has %d; upgrade EcoCI first", manifest.MigrationVersion, migrationVersion)
+	}
+
+	err = database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, t := range parsed {
+			if schedulerTables[t.schema.Table] {
+				continue
+			}
+			var count int64
+			if err := tx.Unscoped().Model(t.model).Count(&count).Error; err != nil {
+				return fmt.Errorf("failed to count %s: %w", t.schema.Table, err)
+			}
+			if count > 0 {
+				return fmt.Errorf("%w: table %s has %d rows", ErrNotEmpty, t.schema.Table, count)
+			}
+		}
+		// Children first, so the jobs can be deleted
+		for i := len(parsed) - 1; i >= 0; i-- {
+			if schedulerTables[parsed[i].schema.Table] {
+				if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Delete(parsed[i].model).Error; err != nil {
+					return fmt.Errorf("failed to clear %s: %w", parsed[i].schema.Table, err)
+				}
+			}
+		}
+
+		for _, expected := range manifest.Tables {
+			t, ok := byName[expected.Name]
+			if !ok {
+				return fmt.Errorf("archive holds unknown table %s", expected.Name)
+			}
+			header, err := archive.Next()
+			if err != nil || header.Name != tableEntry(expected.Name) {
+				return fmt.Errorf("archive is missing %s", tableEntry(expected.Name))
+			}
+			restored, err := restoreTable(ctx, tx, archive, t)
+			if err != nil {
+				return err
+			}
+			if restored != expected.Rows {
+				return fmt.Errorf("archive holds %d rows of %s but the manifest lists %d", restored, expected.Name, expected.Rows)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// restoreTable inserts the rows of a table entry in batches and returns how many it inserted
+func restoreTable(ctx context.Context, tx *gorm.DB, r io.Reader, t table) (int64, error) {
+	// Rows are inserted as column maps: GORM would replace zero values of struct fields
+	// whose columns have defaults (such as a disabled job) with the default, and would run
+	// the hooks, which for runs add to the rollups restored separately
+	insert := tx.Session(&gorm.Session{SkipHooks: true}).Table(t.schema.Table)
+	batch := make([]map[string]interface{}, 0, batchSize)
+	var restored int64
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := insert.Create(&batch).Error; err != nil {
+			return fmt.Errorf("failed to restore %s: %w", t.schema.Table, err)
+		}
+		restored += int64(len(batch))
+		batch = batch[:0]
+		return nil
+	}
+
+	decoder := json.NewDecoder(r)
+	for {
+		var columns map[string]json.RawMessage
+		if err := decoder.Decode(&columns); err == io.EOF {
+			break
+		} else if err != nil {
+			return restored, fmt.Errorf("invalid row of %s: %w", t.schema.Table, err)
+		}
+		row, err := decodeRow(ctx, t.schema, columns)
+		if err != nil {
+			return restored, fmt.Errorf("invalid row of %s: %w", t.schema.Table, err)
+		}
+		batch = append(batch, encodeRow(ctx, t.schema, row))
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return restored, err
+			}
+		}
+	}
+	return restored, flush()
+}
@@ -0,0 +1,141 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// setupTestDB creates an empty database at schema version migrationVersion
+func setupTestDB(t *testing.T, migrationVersion uint) *gorm.DB {
+	database, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := database.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	require.NoError(t, database.AutoMigrate(tables...))
+	require.NoError(t, database.Exec("CREATE TABLE schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)").Error)
+	require.NoError(t, database.Exec("INSERT INTO schema_migrations (version, dirty) VALUES (?, ?)", migrationVersion, false).Error)
+	return database
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 6, 14, 12, 0, 0, 0, time.UTC)
+	source := setupTestDB(t, 19)
+
+	org := &db.Organization{GitHubID: 100, GitHubLogin: "greenorg"}
+	require.NoError(t, source.Create(org).Error)
+	user := &db.User{GitHubID: 1, GitHubUsername: "alice", EmailOptOut: db.StringList{"reports"}}
+	require.NoError(t, source.Create(user).Error)
+	deleted := &db.User{GitHubID: 2, GitHubUsername: "bob"}
+	require.NoError(t, source.Create(deleted).Error)
+	require.NoError(t, source.Delete(deleted).Error)
+	require.NoError(t, source.Create(&db.OrganizationMember{OrganizationID: org.ID, UserID: user.ID}).Error)
+
+	repo := &db.Repository{OwnerID: user.ID, OrganizationID: &org.ID, GitHubRepoID: 10, Name: "app", FullName: "greenorg/app", HTMLURL: "https://github.com/greenorg/app"}
+	require.NoError(t, source.Create(repo).Error)
+	for i := 0; i < 3; i++ {
+		run := &db.Run{UserID: user.ID, RepositoryID: repo.ID, EnergyKWh: 0.5, CO2Kg: 0.2, DurationS: 60,
+			RunMetadata: db.JSONB{"ci_provider": "github-actions"}, CreatedAt: now.Add(-time.Duration(i) * 24 * time.Hour)}
+		require.NoError(t, source.Create(run).Error)
+	}
+	webhook := &db.Webhook{RepositoryID: &repo.ID, URL: "https://example.com/hook", Secret: "signing-secret",
+		Events: db.StringList{"run.created"}, CreatedByID: user.ID}
+	require.NoError(t, source.Create(webhook).Error)
+	require.NoError(t, source.Model(webhook).Update("active", false).Error)
+	require.NoError(t, source.Create(&db.Job{Name: "rollup-backfill", Description: "Rebuild rollups", Schedule: "0 3 * * *", NextRunAt: now}).Error)
+	require.NoError(t, source.Model(&db.Job{}).Where("name = ?", "rollup-backfill").Update("enabled", false).Error)
+	require.NoError(t, source.Create(&db.FeatureFlag{Name: "webhooks", Enabled: true, RolloutPercentage: 25, UserIDs: db.StringList{user.ID.String()}}).Error)
+
+	var archive bytes.Buffer
+	manifest, err := Write(ctx, source, &archive, now)
+	require.NoError(t, err)
+	assert.Equal(t, uint(19), manifest.MigrationVersion)
+	counts := map[string]int64{}
+	for _, table := range manifest.Tables {
+		counts[table.Name] = table.Rows
+	}
+	assert.Equal(t, int64(2), counts["users"])
+	assert.Equal(t, int64(3), counts["runs"])
+	assert.Equal(t, int64(3), counts["repository_daily_rollups"])
+
+	t.Run("manifest", func(t *testing.T) {
+		read, err := ReadManifest(bytes.NewReader(archive.Bytes()))
+		require.NoError(t, err)
+		assert.Equal(t, manifest.Tables, read.Tables)
+		assert.True(t, read.CreatedAt.Equal(now))
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		target := setupTestDB(t, 19)
+		// The server may have created the jobs already
+		require.NoError(t, target.Create(&db.Job{Name: "rollup-backfill", Description: "Rebuild rollups", Schedule: "0 3 * * *", NextRunAt: now}).Error)
+
+		_, err := Restore(ctx, target, bytes.NewReader(archive.Bytes()))
+		require.NoError(t, err)
+
+		for name, rows := range counts {
+			var count int64
+			require.NoError(t, target.Table(name).Count(&count).Error)
+			assert.Equal(t, rows, count, name)
+		}
+
+		var restoredUser db.User
+		require.NoError(t, target.First(&restoredUser, "id = ?", user.ID).Error)
+		assert.Equal(t, db.StringList{"reports"}, restoredUser.EmailOptOut)
+		assert.True(t, restoredUser.CreatedAt.Equal(user.CreatedAt))
+
+		// Soft deleted records stay deleted
+		var restoredDeleted db.User
+		assert.Error(t, target.First(&restoredDeleted, "id = ?", deleted.ID).Error)
+		require.NoError(t, target.Unscoped().First(&restoredDeleted, "id = ?", deleted.ID).Error)
+		assert.True(t, restoredDeleted.DeletedAt.Valid)
+
+		// Fields hidden from the API and zero values of columns with defaults are kept
+		var restoredWebhook db.Webhook
+		require.NoError(t, target.First(&restoredWebhook, "id = ?", webhook.ID).Error)
+		assert.Equal(t, "signing-secret", restoredWebhook.Secret)
+		assert.False(t, restoredWebhook.Active)
+		var job db.Job
+		require.NoError(t, target.First(&job, "name = ?", "rollup-backfill").Error)
+		assert.False(t, job.Enabled)
+
+		var run db.Run
+		require.NoError(t, target.First(&run, "repository_id = ?", repo.ID).Error)
+		assert.Equal(t, "github-actions", run.RunMetadata["ci_provider"])
+
+		var rollupRuns int64
+		require.NoError(t, target.Model(&db.RepositoryDailyRollup{}).Select("SUM(run_count)").Scan(&rollupRuns).Error)
+		assert.Equal(t, int64(3), rollupRuns)
+
+		var flag db.FeatureFlag
+		require.NoError(t, target.First(&flag, "name = ?", "webhooks").Error)
+		assert.Equal(t, 25, flag.RolloutPercentage)
+
+		t.Run("into a database with data", func(t *testing.T) {
+			_, err := Restore(ctx, target, bytes.NewReader(archive.Bytes()))
+			assert.ErrorIs(t, err, ErrNotEmpty)
+		})
+	})
+
+	t.Run("restore into an older schema", func(t *testing.T) {
+		_, err := Restore(ctx, setupTestDB(t, 18), bytes.NewReader(archive.Bytes()))
+		assert.ErrorContains(t, err, "upgrade EcoCI first")
+	})
+
+	t.Run("not an archive", func(t *testing.T) {
+		_, err := Restore(ctx, setupTestDB(t, 19), bytes.NewReader([]byte("users.csv")))
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,291 @@
+package bigquery
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// fakeBigQuery serves the tables of one dataset from memory
+type fakeBigQuery struct {
+	mu     sync.Mutex
+	tables map[string]*Table
+	rows   map[string][]Row
+	// failInsert makes inserts into the table fail
+	failInsert string
+}
+
+func newFakeBigQuery(t *testing.T) (*fakeBigQuery, *Client) {
+	fake := &fakeBigQuery{tables: map[string]*Table{}, rows: map[string][]Row{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, newClient(server.Client(), server.URL, "ecoci", "carbon")
+}
+
+func (f *fakeBigQuery) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	path, ok := strings.CutPrefix(r.URL.Path, "/projects/ecoci/datasets/carbon/tables")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	name, insert := strings.CutSuffix(strings.TrimPrefix(path, "/"), "/insertAll")
+	switch {
+	case r.Method == http.MethodPost && name == "":
+		var table Table
+		json.NewDecoder(r.Body).Decode(&table)
+		f.tables[table.TableReference.TableID] = &table
+		json.NewEncoder(w).Encode(table)
+	case f.tables[name] == nil:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error":{"code":404,"message":"Not found: Table ecoci:carbon.` + name + `"}}`))
+	case r.Method == http.MethodGet:
+		json.NewEncoder(w).Encode(f.tables[name])
+	case r.Method == http.MethodPatch:
+		var table Table
+		json.NewDecoder(r.Body).Decode(&table)
+		f.tables[name].Schema = table.Schema
+		json.NewEncoder(w).Encode(f.tables[name])
+	case r.Method == http.MethodPost && insert:
+		var body struct {
+			Rows []Row `json:"rows"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if name == f.failInsert {
+			w.Write([]byte(`{"insertErrors":[{"index":0,"errors":[{"reason":"invalid","message":"no such field: bogus"}]},{"index":1,"errors":[{"reason":"stopped"}]}]}`))
+			return
+		}
+		f.rows[name] = append(f.rows[name], body.Rows...)
+		w.Write([]byte(`{}`))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// inserted returns the rows inserted into a table
+func (f *fakeBigQuery) inserted(table string) []Row {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Row(nil), f.rows[table]...)
+}
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	database, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := database.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	require.NoError(t, database.AutoMigrate(&db.User{}, &db.Organization{}, &db.Repository{}, &db.Run{},
+		&db.RepositoryDailyRollup{}, &db.BigQueryExportQueueEntry{}, &db.BigQueryExportCursor{}))
+	require.NoError(t, QueueRuns(database))
+	return database
+}
+
+// createRepository creates a user and a repository of an organization
+func createRepository(t *testing.T, database *gorm.DB) (*db.User, *db.Repository) {
+	org := &db.Organization{GitHubID: 100, GitHubLogin: "greenorg"}
+	require.NoError(t, database.Create(org).Error)
+	user := &db.User{GitHubID: 1, GitHubUsername: "alice"}
+	require.NoError(t, database.Create(user).Error)
+	repo := &db.Repository{OwnerID: user.ID, OrganizationID: &org.ID, GitHubRepoID: 10, Name: "app", FullName: "greenorg/app", HTMLURL: "https://github.com/greenorg/app"}
+	require.NoError(t, database.Create(repo).Error)
+	return user, repo
+}
+
+func TestEnsureTables(t *testing.T) {
+	ctx := context.Background()
+	fake, client := newFakeBigQuery(t)
+
+	changed, err := client.EnsureTables(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{RunsTable, RollupsTable, CurrentRunsView, CurrentRollupsView}, changed)
+	runs := fake.tables[RunsTable]
+	assert.Equal(t, TableReference{ProjectID: "ecoci", DatasetID: "carbon", TableID: RunsTable}, runs.TableReference)
+	assert.Equal(t, &TimePartitioning{Type: "DAY", Field: "created_at"}, runs.TimePartitioning)
+	assert.Contains(t, fake.tables[CurrentRunsView].View.Query, "`ecoci.carbon.runs`")
+
+	// Up-to-date tables are left alone
+	changed, err = client.EnsureTables(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, changed)
+
+	// Missing columns are added as nullable columns, after the existing ones
+	runs.Schema.Fields = runs.Schema.Fields[:3]
+	changed, err = client.EnsureTables(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{RunsTable}, changed)
+	fields := fake.tables[RunsTable].Schema.Fields
+	require.Len(t, fields, len(tables[0].Schema.Fields))
+	assert.Equal(t, Field{Name: "run_id", Type: typeString, Mode: modeRequired, Description: "EcoCI ID of the run"}, fields[0])
+	assert.Equal(t, "co2_kg", fields[7].Name)
+	assert.Equal(t, modeNullable, fields[7].Mode)
+}
+
+func TestExportRuns(t *testing.T) {
+	ctx := context.Background()
+	database := setupTestDB(t)
+	fake, client := newFakeBigQuery(t)
+	exporter := NewExporter(database, client)
+	exportedAt := time.Date(2024, 6, 15, 8, 0, 0, 0, time.UTC)
+	exporter.now = func() time.Time { return exportedAt }
+
+	user, repo := createRepository(t, database)
+	branch := "main"
+	run := &db.Run{UserID: user.ID, RepositoryID: repo.ID, EnergyKWh: 0.5, CO2Kg: 0.2, DurationS: 60, BranchName: &branch,
+		RunMetadata: db.JSONB{"ci_provider": "github-actions"}, CreatedAt: time.Date(2024, 6, 14, 12, 0, 0, 0, time.UTC)}
+	require.NoError(t, database.Create(run).Error)
+	batch := []*db.Run{
+		{UserID: user.ID, RepositoryID: repo.ID, EnergyKWh: 1, CO2Kg: 0.4, DurationS: 120},
+		{UserID: user.ID, RepositoryID: repo.ID, EnergyKWh: 2, CO2Kg: 0.8, DurationS: 240},
+	}
+	require.NoError(t, database.Create(&batch).Error)
+	deleted := &db.Run{UserID: user.ID, RepositoryID: repo.ID, EnergyKWh: 1, CO2Kg: 0.4, DurationS: 30}
+	require.NoError(t, database.Create(deleted).Error)
+	require.NoError(t, database.Delete(deleted).Error)
+
+	// Runs of failed transactions are not queued
+	database.Transaction(func(tx *gorm.DB) error {
+		require.NoError(t, tx.Create(&db.Run{UserID: user.ID, RepositoryID: repo.ID, DurationS: 1}).Error)
+		return assert.AnError
+	})
+
+	var queued int64
+	require.NoError(t, database.Model(&db.BigQueryExportQueueEntry{}).Count(&queued).Error)
+	assert.Equal(t, int64(4), queued)
+
+	exported, err := exporter.ExportRuns(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, exported)
+	require.NoError(t, database.Model(&db.BigQueryExportQueueEntry{}).Count(&queued).Error)
+	assert.Zero(t, queued)
+
+	rows := fake.inserted(RunsTable)
+	require.Len(t, rows, 3)
+	var first Row
+	for _, row := range rows {
+		if row.InsertID == run.ID.String() {
+			first = row
+		}
+	}
+	assert.Equal(t, map[string]interface{}{
+		"run_id":          run.ID.String(),
+		"user_id":         user.ID.String(),
+		"repository_id":   repo.ID.String(),
+		"repository":      "greenorg/app",
+		"organization_id": repo.OrganizationID.String(),
+		"organization":    "greenorg",
+		"energy_kwh":      0.5,
+		"co2_kg":          0.2,
+		"duration_s":      float64(60),
+		"git_commit_sha":  nil,
+		"branch":          "main",
+		"workflow":        nil,
+		"metadata":        `{"ci_provider":"github-actions"}`,
+		"created_at":      "2024-06-14T12:00:00Z",
+		"exported_at":     "2024-06-15T08:00:00Z",
+	}, first.JSON)
+
+	// Failed inserts keep the runs queued
+	require.NoError(t, database.Create(&db.Run{UserID: user.ID, RepositoryID: repo.ID, DurationS: 1}).Error)
+	fake.failInsert = RunsTable
+	_, err = exporter.ExportRuns(ctx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no such field: bogus")
+	require.NoError(t, database.Model(&db.BigQueryExportQueueEntry{}).Count(&queued).Error)
+	assert.Equal(t, int64(1), queued)
+
+	// Registering the callback again does not queue runs twice
+	require.NoError(t, QueueRuns(database))
+	fake.failInsert = ""
+	require.NoError(t, database.Create(&db.Run{UserID: user.ID, RepositoryID: repo.ID, DurationS: 1}).Error)
+	exported, err = exporter.ExportRuns(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, exported)
+}
+
+func TestExportRollups(t *testing.T) {
+	ctx := context.Background()
+	database := setupTestDB(t)
+	fake, client := newFakeBigQuery(t)
+	exporter := NewExporter(database, client)
+
+	// Rollups record when they changed, so the days are relative to the current one
+	user, repo := createRepository(t, database)
+	today := db.RollupDay(time.Now())
+	for i := -2; i <= 0; i++ {
+		require.NoError(t, database.Create(&db.Run{UserID: user.ID, RepositoryID: repo.ID, EnergyKWh: 1, CO2Kg: 0.5, DurationS: 60,
+			CreatedAt: today.AddDate(0, 0, i)}).Error)
+	}
+	now := time.Now().UTC()
+
+	// Today's rollup waits for the day to end
+	exported, err := exporter.ExportRollups(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, 2, exported)
+	rows := fake.inserted(RollupsTable)
+	require.Len(t, rows, 2)
+	assert.Equal(t, today.AddDate(0, 0, -2).Format("2006-01-02"), rows[0].JSON["day"])
+	assert.Equal(t, float64(1), rows[0].JSON["run_count"])
+	assert.Equal(t, 0.5, rows[0].JSON["co2_kg"])
+	assert.Equal(t, "greenorg/app", rows[0].JSON["repository"])
+	assert.True(t, strings.HasPrefix(rows[0].InsertID, repo.ID.String()+":"+today.AddDate(0, 0, -2).Format("2006-01-02")+":"))
+
+	// The next night exports the day that was in progress and the days of late runs, not the
+	// unchanged days
+	require.NoError(t, database.Create(&db.Run{UserID: user.ID, RepositoryID: repo.ID, EnergyKWh: 1, CO2Kg: 0.5, DurationS: 60,
+		CreatedAt: today.AddDate(0, 0, -2).Add(time.Hour)}).Error)
+	exported, err = exporter.ExportRollups(ctx, now.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	assert.Equal(t, 2, exported)
+	rows = fake.inserted(RollupsTable)
+	require.Len(t, rows, 4)
+	assert.Equal(t, today.AddDate(0, 0, -2).Format("2006-01-02"), rows[2].JSON["day"])
+	assert.Equal(t, float64(2), rows[2].JSON["run_count"])
+	assert.Equal(t, today.Format("2006-01-02"), rows[3].JSON["day"])
+
+	var cursor db.BigQueryExportCursor
+	require.NoError(t, database.Where("stream = ?", rollupsStream).Take(&cursor).Error)
+	assert.WithinDuration(t, now.AddDate(0, 0, 1), cursor.Position, time.Millisecond)
+}
+
+func TestBackfill(t *testing.T) {
+	ctx := context.Background()
+	database := setupTestDB(t)
+	fake, client := newFakeBigQuery(t)
+	exporter := NewExporter(database, client)
+
+	user, repo := createRepository(t, database)
+	day := time.Date(2024, 6, 13, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		require.NoError(t, database.Create(&db.Run{UserID: user.ID, RepositoryID: repo.ID, EnergyKWh: 1, CO2Kg: 0.5, DurationS: 60,
+			CreatedAt: day.Add(time.Duration(i*24+12) * time.Hour)}).Error)
+	}
+
+	runs, rollups, err := exporter.Backfill(ctx, day.Add(24*time.Hour), day.Add(3*24*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 2, runs)
+	assert.Equal(t, 2, rollups)
+	assert.Len(t, fake.inserted(RunsTable), 2)
+	assert.Len(t, fake.tables, 4, "backfills create the tables")
+
+	// Backfills leave the queue to the export job
+	var queued int64
+	require.NoError(t, database.Model(&db.BigQueryExportQueueEntry{}).Count(&queued).Error)
+	assert.Equal(t, int64(4), queued)
+}
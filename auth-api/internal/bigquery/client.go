@@ -0,0 +1,325 @@
+// Package bigquery exports runs and daily rollups into BigQuery tables, so data teams can join
+// the carbon footprint of CI with the other data of their warehouse. New runs are queued as
+// they are created and streamed by a background job; rollups are exported nightly. The tables
+// are created, and extended with new columns, by the exporter itself.
+package bigquery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/jwt"
+
+	"github.com/ecoci/auth-api/internal/tracing"
+)
+
+// DefaultAPIURL is the BigQuery REST API used unless configured otherwise
+const DefaultAPIURL = "https://bigquery.googleapis.com/bigquery/v2"
+
+// Scope is the OAuth scope of the BigQuery API
+const Scope = "https://www.googleapis.com/auth/bigquery"
+
+// metadataTokenURL returns tokens of the service account of the GCE instance or GKE workload
+const metadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// requestTimeout bounds every request to the BigQuery API
+const requestTimeout = 30 * time.Second
+
+// ErrNotFound is returned for tables that do not exist
+var ErrNotFound = errors.New("not found")
+
+// Client calls the BigQuery REST API for the tables of one dataset
+type Client struct {
+	client  *http.Client
+	apiURL  string
+	project string
+	dataset string
+}
+
+// NewClient creates a client of the tables of project.dataset. Requests are authenticated with
+// the service account key at credentialsFile, or with the service account of the instance
+// (read from the metadata server) when it is empty.
+func NewClient(apiURL, project, dataset, credentialsFile string) (*Client, error) {
+	base := &http.Client{Timeout: requestTimeout, Transport: tracing.Transport(nil)}
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, base)
+
+	var tokens oauth2.TokenSource
+	if credentialsFile != "" {
+		config, err := serviceAccountConfig(credentialsFile)
+		if err != nil {
+			return nil, err
+		}
+		tokens = config.TokenSource(ctx)
+	} else {
+		tokens = oauth2.ReuseTokenSource(nil, &metadataTokenSource{client: base})
+	}
+
+	client := oauth2.NewClient(ctx, tokens)
+	client.Timeout = requestTimeout
+	return newClient(client, apiURL, project, dataset), nil
+}
+
+// newClient creates a client sending requests with client as they are
+func newClient(client *http.Client, apiURL, project, dataset string) *Client {
+	if apiURL == "" {
+		apiURL = DefaultAPIURL
+	}
+	return &Client{client: client, apiURL: strings.TrimRight(apiURL, "/"), project: project, dataset: dataset}
+}
+
+// serviceAccountConfig reads a service account key file as downloaded from the Google Cloud
+// console
+func serviceAccountConfig(path string) (*jwt.Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read BigQuery credentials: %w", err)
+	}
+	var key struct {
+		Type         string `json:"type"`
+		ClientEmail  string `json:"client_email"`
+		PrivateKey   string `json:"private_key"`
+		PrivateKeyID string `json:"private_key_id"`
+		TokenURI     string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("failed to parse BigQuery credentials: %w", err)
+	}
+	if key.Type != "service_account" || key.ClientEmail == "" || key.PrivateKey == "" {
+		return nil, fmt.Errorf("BigQuery credentials must be a service account key")
+	}
+	if key.TokenURI == "" {
+		key.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	return &jwt.Config{
+		Email:        key.ClientEmail,
+		PrivateKey:   []byte(key.PrivateKey),
+		PrivateKeyID: key.PrivateKeyID,
+		Scopes:       []string{Scope},
+		TokenURL:     key.TokenURI,
+	}, nil
+}
+
+// metadataTokenSource gets access tokens from the metadata server of Google Cloud
+type metadataTokenSource struct {
+	client *http.Client
+}
+
+// Token implements oauth2.TokenSource
+func (s *metadataTokenSource) Token() (*oauth2.Token, error) {
+	req, err := http.NewRequest(http.MethodGet, metadataTokenURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token from metadata server: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get token from metadata server: status %d", resp.StatusCode)
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+		TokenType   string `json:"token_type"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("failed to decode metadata server token: %w", err)
+	}
+	return &oauth2.Token{
+		AccessToken: token.AccessToken,
+		TokenType:   token.TokenType,
+		Expiry:      time.Now().Add(time.Duration(token.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// Field is a column of a table schema
+type Field struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Mode        string `json:"mode,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Schema is the schema of a table
+type Schema struct {
+	Fields []Field `json:"fields"`
+}
+
+// TimePartitioning partitions a table by day of a column
+type TimePartitioning struct {
+	Type  string `json:"type"`
+	Field string `json:"field,omitempty"`
+}
+
+// Clustering sorts the data of a table by columns
+type Clustering struct {
+	Fields []string `json:"fields"`
+}
+
+// TableReference names a table
+type TableReference struct {
+	ProjectID string `json:"projectId"`
+	DatasetID string `json:"datasetId"`
+	TableID   string `json:"tableId"`
+}
+
+// View is the query of a view
+type View struct {
+	Query        string `json:"query"`
+	UseLegacySQL bool   `json:"useLegacySql"`
+}
+
+// Table is a table resource, or a view when View is set
+type Table struct {
+	TableReference   TableReference    `json:"tableReference"`
+	Description      string            `json:"description,omitempty"`
+	Schema           *Schema           `json:"schema,omitempty"`
+	TimePartitioning *TimePartitioning `json:"timePartitioning,omitempty"`
+	Clustering       *Clustering       `json:"clustering,omitempty"`
+	View             *View             `json:"view,omitempty"`
+}
+
+// Row is a row streamed into a table. BigQuery drops rows with an insert ID it has seen in
+// the last minutes, so retried inserts are not duplicated.
+type Row struct {
+	InsertID string                 `json:"insertId,omitempty"`
+	JSON     map[string]interface{} `json:"json"`
+}
+
+// apiError is the error of a failed API request
+type apiError struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// tableURL returns the URL of the tables of the dataset, or of table
+func (c *Client) tableURL(table string) string {
+	u := fmt.Sprintf("%s/projects/%s/datasets/%s/tables", c.apiURL, url.PathEscape(c.project), url.PathEscape(c.dataset))
+	if table != "" {
+		u += "/" + url.PathEscape(table)
+	}
+	return u
+}
+
+// do sends a request with a JSON body and decodes the JSON response into out
+func (c *Client) do(ctx context.Context, method, url string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	if resp.StatusCode >= 300 {
+		var apiErr apiError
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Error.Message != "" {
+			return fmt.Errorf("BigQuery API error %d: %s", resp.StatusCode, apiErr.Error.Message)
+		}
+		return fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	}
+	if out == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// GetTable returns a table of the dataset, or ErrNotFound
+func (c *Client) GetTable(ctx context.Context, table string) (*Table, error) {
+	var t Table
+	if err := c.do(ctx, http.MethodGet, c.tableURL(table), nil, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// CreateTable creates a table in the dataset
+func (c *Client) CreateTable(ctx context.Context, table *Table) error {
+	table.TableReference = TableReference{ProjectID: c.project, DatasetID: c.dataset, TableID: table.TableReference.TableID}
+	return c.do(ctx, http.MethodPost, c.tableURL(""), table, nil)
+}
+
+// UpdateSchema replaces the schema of a table. BigQuery only accepts new nullable or repeated
+// columns; existing columns cannot be changed.
+func (c *Client) UpdateSchema(ctx context.Context, table string, schema *Schema) error {
+	return c.do(ctx, http.MethodPatch, c.tableURL(table), &Table{Schema: schema}, nil)
+}
+
+// InsertAll streams rows into a table. Rows are inserted together or, when any is invalid, not
+// at all.
+func (c *Client) InsertAll(ctx context.Context, table string, rows []Row) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	body := struct {
+		Kind string `json:"kind"`
+		Rows []Row  `json:"rows"`
+	}{Kind: "bigquery#tableDataInsertAllRequest", Rows: rows}
+
+	var resp struct {
+		InsertErrors []struct {
+			Index  int `json:"index"`
+			Errors []struct {
+				Reason  string `json:"reason"`
+				Message string `json:"message"`
+			} `json:"errors"`
+		} `json:"insertErrors"`
+	}
+	if err := c.do(ctx, http.MethodPost, c.tableURL(table)+"/insertAll", body, &resp); err != nil {
+		return err
+	}
+
+	// Valid rows are reported as "stopped" next to the row that failed them
+	for _, rowErr := range resp.InsertErrors {
+		for _, e := range rowErr.Errors {
+			if e.Reason == "stopped" {
+				continue
+			}
+			if rowErr.Index >= 0 && rowErr.Index < len(rows) {
+				return fmt.Errorf("failed to insert row %s into %s: %s: %s", rows[rowErr.Index].InsertID, table, e.Reason, e.Message)
+			}
+			return fmt.Errorf("failed to insert row %d into %s: %s: %s", rowErr.Index, table, e.Reason, e.Message)
+		}
+	}
+	if len(resp.InsertErrors) > 0 {
+		return fmt.Errorf("failed to insert %d rows into %s", len(resp.InsertErrors), table)
+	}
+	return nil
+}
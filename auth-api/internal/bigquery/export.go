@@ -0,0 +1,342 @@
+package bigquery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// batchSize is the number of rows read and streamed at a time
+const batchSize = 500
+
+// rollupsStream is the cursor of the nightly rollup export
+const rollupsStream = "rollups"
+
+// queueCallback is the name of the callback queueing created runs
+const queueCallback = "bigquery:queue_runs"
+
+// QueueRuns makes every run created through database, by any ingestion path, queue itself
+// for export in the transaction that creates it, so runs are neither lost when BigQuery is
+// unavailable nor exported before they are committed.
+func QueueRuns(database *gorm.DB) error {
+	create := database.Callback().Create()
+	if create.Get(queueCallback) != nil {
+		return create.Replace(queueCallback, queueRuns)
+	}
+	return create.After("gorm:create").Register(queueCallback, queueRuns)
+}
+
+// queueRuns queues the runs created by a statement
+func queueRuns(tx *gorm.DB) {
+	if tx.Error != nil || tx.Statement.Schema == nil || tx.Statement.Schema.Table != "runs" {
+		return
+	}
+
+	var entries []db.BigQueryExportQueueEntry
+	now := time.Now().UTC()
+	add := func(value reflect.Value) {
+		for value.Kind() == reflect.Pointer {
+			value = value.Elem()
+		}
+		if !value.CanAddr() {
+			return
+		}
+		if run, ok := value.Addr().Interface().(*db.Run); ok && run.ID != uuid.Nil {
+			entries = append(entries, db.BigQueryExportQueueEntry{RunID: run.ID, QueuedAt: now})
+		}
+	}
+	switch value := reflect.Indirect(tx.Statement.ReflectValue); value.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			add(value.Index(i))
+		}
+	case reflect.Struct:
+		add(value)
+	}
+	if len(entries) == 0 {
+		return
+	}
+
+	err := tx.Session(&gorm.Session{NewDB: true}).Clauses(clause.OnConflict{DoNothing: true}).
+		CreateInBatches(entries, batchSize).Error
+	if err != nil {
+		tx.AddError(fmt.Errorf("failed to queue runs for BigQuery export: %w", err))
+	}
+}
+
+// Exporter streams runs and rollups into the tables of a dataset
+type Exporter struct {
+	db     *gorm.DB
+	client *Client
+	now    func() time.Time
+
+	// ensured is set once the tables are known to match their schemas
+	mu      sync.Mutex
+	ensured bool
+}
+
+// NewExporter creates an exporter of the runs and rollups of database
+func NewExporter(database *gorm.DB, client *Client) *Exporter {
+	return &Exporter{db: database, client: client, now: time.Now}
+}
+
+// EnsureTables creates and extends the tables of the dataset, once per exporter unless it
+// fails. It returns the names of the tables it changed.
+func (e *Exporter) EnsureTables(ctx context.Context) ([]string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.ensured {
+		return nil, nil
+	}
+	changed, err := e.client.EnsureTables(ctx)
+	if err != nil {
+		return changed, err
+	}
+	e.ensured = true
+	return changed, nil
+}
+
+// ExportRuns streams the queued runs and removes them from the queue. Runs deleted since they
+// were queued are dropped. It returns the number of runs exported.
+func (e *Exporter) ExportRuns(ctx context.Context) (int, error) {
+	if _, err := e.EnsureTables(ctx); err != nil {
+		return 0, err
+	}
+
+	exported := 0
+	for {
+		var entries []db.BigQueryExportQueueEntry
+		err := e.db.WithContext(ctx).Order("queued_at, run_id").Limit(batchSize).Find(&entries).Error
+		if err != nil {
+			return exported, fmt.Errorf("failed to read export queue: %w", err)
+		}
+		if len(entries) == 0 {
+			return exported, nil
+		}
+
+		ids := make([]uuid.UUID, len(entries))
+		for i, entry := range entries {
+			ids[i] = entry.RunID
+		}
+		var runs []db.Run
+		if err := e.runs(ctx).Where("id IN ?", ids).Find(&runs).Error; err != nil {
+			return exported, fmt.Errorf("failed to load queued runs: %w", err)
+		}
+		if err := e.client.InsertAll(ctx, RunsTable, e.runRows(runs)); err != nil {
+			return exported, fmt.Errorf("failed to export runs: %w", err)
+		}
+		exported += len(runs)
+
+		// A run exported twice, when deleting the batch fails, is dropped by its insert ID or
+		// by the runs_current view
+		if err := e.db.WithContext(ctx).Where("run_id IN ?", ids).Delete(&db.BigQueryExportQueueEntry{}).Error; err != nil {
+			return exported, fmt.Errorf("failed to remove exported runs from queue: %w", err)
+		}
+		if len(entries) < batchSize {
+			return exported, nil
+		}
+	}
+}
+
+// ExportRollups streams the rollups of the days before now that changed since the last
+// export, and records now as the last export. It returns the number of rollups exported.
+func (e *Exporter) ExportRollups(ctx context.Context, now time.Time) (int, error) {
+	if _, err := e.EnsureTables(ctx); err != nil {
+		return 0, err
+	}
+
+	var cursor db.BigQueryExportCursor
+	err := e.db.WithContext(ctx).Where("stream = ?", rollupsStream).Take(&cursor).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return 0, fmt.Errorf("failed to read rollup export cursor: %w", err)
+	}
+
+	// Today's rollups are exported once the day is over. Rollups of the day of the last
+	// export were incomplete then, so they are exported again even when unchanged.
+	query := e.db.WithContext(ctx).Where("day < ?", db.RollupDay(now))
+	if err == nil {
+		query = query.Where("updated_at > ? OR day >= ?", cursor.Position, db.RollupDay(cursor.Position))
+	}
+	exported, err := e.exportRollups(ctx, query)
+	if err != nil {
+		return exported, err
+	}
+
+	cursor = db.BigQueryExportCursor{Stream: rollupsStream, Position: now.UTC()}
+	err = e.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "stream"}},
+		DoUpdates: clause.AssignmentColumns([]string{"position", "updated_at"}),
+	}).Create(&cursor).Error
+	if err != nil {
+		return exported, fmt.Errorf("failed to save rollup export cursor: %w", err)
+	}
+	return exported, nil
+}
+
+// Backfill streams the runs created and the rollups of the days in [from, to), such as the
+// history from before the export was configured. Rows exported before are exported again;
+// the *_current views hold one row of each. It returns the numbers of runs and rollups
+// exported.
+func (e *Exporter) Backfill(ctx context.Context, from, to time.Time) (int, int, error) {
+	if _, err := e.EnsureTables(ctx); err != nil {
+		return 0, 0, err
+	}
+
+	runs := 0
+	var after *db.Run
+	for {
+		query := e.runs(ctx).Where("created_at >= ? AND created_at < ?", from, to).
+			Order("created_at, id").Limit(batchSize)
+		if after != nil {
+			query = query.Where("created_at > ? OR (created_at = ? AND id > ?)", after.CreatedAt, after.CreatedAt, after.ID)
+		}
+		var batch []db.Run
+		if err := query.Find(&batch).Error; err != nil {
+			return runs, 0, fmt.Errorf("failed to load runs: %w", err)
+		}
+		if err := e.client.InsertAll(ctx, RunsTable, e.runRows(batch)); err != nil {
+			return runs, 0, fmt.Errorf("failed to export runs: %w", err)
+		}
+		runs += len(batch)
+		if len(batch) < batchSize {
+			break
+		}
+		after = &batch[len(batch)-1]
+	}
+
+	rollups, err := e.exportRollups(ctx, e.db.WithContext(ctx).Where("day >= ? AND day < ?", db.RollupDay(from), to))
+	return runs, rollups, err
+}
+
+// runs returns a query of the runs that are not deleted, with their repositories and
+// organizations, including deleted ones
+func (e *Exporter) runs(ctx context.Context) *gorm.DB {
+	return e.db.WithContext(ctx).
+		Preload("Repository", func(tx *gorm.DB) *gorm.DB { return tx.Unscoped() }).
+		Preload("Repository.Organization")
+}
+
+// exportRollups streams the rollups selected by query. It returns the number exported.
+func (e *Exporter) exportRollups(ctx context.Context, query *gorm.DB) (int, error) {
+	exported := 0
+	for offset := 0; ; offset += batchSize {
+		var rollups []db.RepositoryDailyRollup
+		err := query.Session(&gorm.Session{}).Order("day, repository_id").Offset(offset).Limit(batchSize).Find(&rollups).Error
+		if err != nil {
+			return exported, fmt.Errorf("failed to load rollups: %w", err)
+		}
+		rows, err := e.rollupRows(ctx, rollups)
+		if err != nil {
+			return exported, err
+		}
+		if err := e.client.InsertAll(ctx, RollupsTable, rows); err != nil {
+			return exported, fmt.Errorf("failed to export rollups: %w", err)
+		}
+		exported += len(rollups)
+		if len(rollups) < batchSize {
+			return exported, nil
+		}
+	}
+}
+
+// runRows returns the rows of runs
+func (e *Exporter) runRows(runs []db.Run) []Row {
+	exportedAt := e.now().UTC()
+	rows := make([]Row, len(runs))
+	for i, run := range runs {
+		row := map[string]interface{}{
+			"run_id":         run.ID.String(),
+			"user_id":        run.UserID.String(),
+			"energy_kwh":     run.EnergyKWh,
+			"co2_kg":         run.CO2Kg,
+			"duration_s":     run.DurationS,
+			"git_commit_sha": run.GitCommitSHA,
+			"branch":         run.BranchName,
+			"workflow":       run.WorkflowName,
+			"metadata":       nil,
+			"created_at":     timestamp(run.CreatedAt),
+			"exported_at":    timestamp(exportedAt),
+		}
+		if len(run.RunMetadata) > 0 {
+			// JSON columns are streamed as encoded JSON
+			metadata, err := json.Marshal(run.RunMetadata)
+			if err == nil {
+				row["metadata"] = string(metadata)
+			}
+		}
+		repositoryColumns(row, run.RepositoryID, run.Repository)
+		rows[i] = Row{InsertID: run.ID.String(), JSON: row}
+	}
+	return rows
+}
+
+// rollupRows returns the rows of rollups, with their repositories
+func (e *Exporter) rollupRows(ctx context.Context, rollups []db.RepositoryDailyRollup) ([]Row, error) {
+	var ids []uuid.UUID
+	for _, rollup := range rollups {
+		ids = append(ids, rollup.RepositoryID)
+	}
+	repos := map[uuid.UUID]*db.Repository{}
+	if len(ids) > 0 {
+		var found []db.Repository
+		if err := e.db.WithContext(ctx).Unscoped().Preload("Organization").Where("id IN ?", ids).Find(&found).Error; err != nil {
+			return nil, fmt.Errorf("failed to load repositories of rollups: %w", err)
+		}
+		for i := range found {
+			repos[found[i].ID] = &found[i]
+		}
+	}
+
+	exportedAt := e.now().UTC()
+	rows := make([]Row, len(rollups))
+	for i, rollup := range rollups {
+		row := map[string]interface{}{
+			"day":         rollup.Day.Format("2006-01-02"),
+			"run_count":   rollup.RunCount,
+			"co2_kg":      rollup.TotalCO2Kg,
+			"energy_kwh":  rollup.TotalEnergyKWh,
+			"duration_s":  rollup.TotalDurationS,
+			"last_run_at": timestamp(rollup.LastRunAt),
+			"updated_at":  timestamp(rollup.UpdatedAt),
+			"exported_at": timestamp(exportedAt),
+		}
+		repositoryColumns(row, rollup.RepositoryID, repos[rollup.RepositoryID])
+		// The same version of a rollup is only inserted once
+		insertID := rollup.RepositoryID.String() + ":" + row["day"].(string) + ":" + strconv.FormatInt(rollup.UpdatedAt.UnixNano(), 10)
+		rows[i] = Row{InsertID: insertID, JSON: row}
+	}
+	return rows, nil
+}
+
+// repositoryColumns sets the repository columns of a row
+func repositoryColumns(row map[string]interface{}, repoID uuid.UUID, repo *db.Repository) {
+	row["repository_id"] = repoID.String()
+	row["repository"] = nil
+	row["organization_id"] = nil
+	row["organization"] = nil
+	if repo == nil {
+		return
+	}
+	row["repository"] = repo.FullName
+	if repo.OrganizationID != nil {
+		row["organization_id"] = repo.OrganizationID.String()
+	}
+	if repo.Organization != nil {
+		row["organization"] = repo.Organization.GitHubLogin
+	}
+}
+
+// timestamp formats a time as a BigQuery timestamp
+func timestamp(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.999999Z07:00")
+}
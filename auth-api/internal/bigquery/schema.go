@@ -0,0 +1,167 @@
+package bigquery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Tables the exporter writes to, and views of their current rows
+const (
+	RunsTable          = "runs"
+	RollupsTable       = "repository_daily_rollups"
+	CurrentRunsView    = "runs_current"
+	CurrentRollupsView = "repository_daily_rollups_current"
+)
+
+// Column types and modes
+const (
+	typeString    = "STRING"
+	typeInteger   = "INTEGER"
+	typeFloat     = "FLOAT"
+	typeTimestamp = "TIMESTAMP"
+	typeDate      = "DATE"
+	typeJSON      = "JSON"
+
+	modeRequired = "REQUIRED"
+	modeNullable = "NULLABLE"
+)
+
+// repositoryFields describe the repository of a row
+var repositoryFields = []Field{
+	{Name: "repository_id", Type: typeString, Mode: modeRequired, Description: "EcoCI ID of the repository"},
+	{Name: "repository", Type: typeString, Mode: modeNullable, Description: "Full name of the repository, such as octocat/hello-world"},
+	{Name: "organization_id", Type: typeString, Mode: modeNullable, Description: "EcoCI ID of the organization of the repository"},
+	{Name: "organization", Type: typeString, Mode: modeNullable, Description: "GitHub login of the organization of the repository"},
+}
+
+// tables are the tables of the dataset. Columns are only ever added, as nullable columns, so
+// older rows stay valid.
+var tables = []*Table{
+	{
+		TableReference: TableReference{TableID: RunsTable},
+		Description:    "CO2 measurement runs of EcoCI, one row per run. Backfills may repeat runs; see the runs_current view.",
+		Schema: &Schema{Fields: append([]Field{
+			{Name: "run_id", Type: typeString, Mode: modeRequired, Description: "EcoCI ID of the run"},
+			{Name: "user_id", Type: typeString, Mode: modeRequired, Description: "EcoCI ID of the user who submitted the run"},
+		}, append(repositoryFields, []Field{
+			{Name: "energy_kwh", Type: typeFloat, Mode: modeRequired, Description: "Energy used, in kWh"},
+			{Name: "co2_kg", Type: typeFloat, Mode: modeRequired, Description: "CO2 emitted, in kg"},
+			{Name: "duration_s", Type: typeFloat, Mode: modeRequired, Description: "Duration, in seconds"},
+			{Name: "git_commit_sha", Type: typeString, Mode: modeNullable},
+			{Name: "branch", Type: typeString, Mode: modeNullable},
+			{Name: "workflow", Type: typeString, Mode: modeNullable},
+			{Name: "metadata", Type: typeJSON, Mode: modeNullable, Description: "Metadata submitted with the run"},
+			{Name: "created_at", Type: typeTimestamp, Mode: modeRequired, Description: "When the run was measured"},
+			{Name: "exported_at", Type: typeTimestamp, Mode: modeRequired},
+		}...)...)},
+		TimePartitioning: &TimePartitioning{Type: "DAY", Field: "created_at"},
+		Clustering:       &Clustering{Fields: []string{"repository_id"}},
+	},
+	{
+		TableReference: TableReference{TableID: RollupsTable},
+		Description:    "Daily totals of the runs of each repository (UTC days). A rollup is exported again when its day changes, such as when runs are imported late; see the repository_daily_rollups_current view.",
+		Schema: &Schema{Fields: append(append([]Field{}, repositoryFields...), []Field{
+			{Name: "day", Type: typeDate, Mode: modeRequired},
+			{Name: "run_count", Type: typeInteger, Mode: modeRequired},
+			{Name: "co2_kg", Type: typeFloat, Mode: modeRequired, Description: "CO2 emitted, in kg"},
+			{Name: "energy_kwh", Type: typeFloat, Mode: modeRequired, Description: "Energy used, in kWh"},
+			{Name: "duration_s", Type: typeFloat, Mode: modeRequired, Description: "Duration, in seconds"},
+			{Name: "last_run_at", Type: typeTimestamp, Mode: modeRequired},
+			{Name: "updated_at", Type: typeTimestamp, Mode: modeRequired, Description: "When the rollup last changed"},
+			{Name: "exported_at", Type: typeTimestamp, Mode: modeRequired},
+		}...)},
+		TimePartitioning: &TimePartitioning{Type: "DAY", Field: "day"},
+		Clustering:       &Clustering{Fields: []string{"repository_id"}},
+	},
+}
+
+// views returns the views of the latest row of every run and rollup, with project.dataset as
+// their dataset
+func views(dataset string) []*Table {
+	return []*Table{
+		{
+			TableReference: TableReference{TableID: CurrentRunsView},
+			Description:    "Runs without the repetitions of backfills",
+			View: &View{Query: fmt.Sprintf("SELECT * FROM `%s.%s` WHERE TRUE QUALIFY ROW_NUMBER() OVER (PARTITION BY run_id ORDER BY exported_at DESC) = 1",
+				dataset, RunsTable)},
+		},
+		{
+			TableReference: TableReference{TableID: CurrentRollupsView},
+			Description:    "The current daily rollup of each repository and day",
+			View: &View{Query: fmt.Sprintf("SELECT * FROM `%s.%s` WHERE TRUE QUALIFY ROW_NUMBER() OVER (PARTITION BY repository_id, day ORDER BY updated_at DESC, exported_at DESC) = 1",
+				dataset, RollupsTable)},
+		},
+	}
+}
+
+// EnsureTables creates the tables and views of the dataset that do not exist and adds the
+// columns missing from existing tables. It returns the names of the tables it changed.
+func (c *Client) EnsureTables(ctx context.Context) ([]string, error) {
+	var changed []string
+	for _, want := range tables {
+		name := want.TableReference.TableID
+		existing, err := c.GetTable(ctx, name)
+		if errors.Is(err, ErrNotFound) {
+			table := *want
+			if err := c.CreateTable(ctx, &table); err != nil {
+				return changed, fmt.Errorf("failed to create table %s: %w", name, err)
+			}
+			changed = append(changed, name)
+			continue
+		}
+		if err != nil {
+			return changed, fmt.Errorf("failed to get table %s: %w", name, err)
+		}
+
+		schema, extended := extendSchema(existing.Schema, want.Schema)
+		if !extended {
+			continue
+		}
+		if err := c.UpdateSchema(ctx, name, schema); err != nil {
+			return changed, fmt.Errorf("failed to update schema of table %s: %w", name, err)
+		}
+		changed = append(changed, name)
+	}
+
+	for _, view := range views(c.project + "." + c.dataset) {
+		name := view.TableReference.TableID
+		_, err := c.GetTable(ctx, name)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return changed, fmt.Errorf("failed to get view %s: %w", name, err)
+		}
+		if err := c.CreateTable(ctx, view); err != nil {
+			return changed, fmt.Errorf("failed to create view %s: %w", name, err)
+		}
+		changed = append(changed, name)
+	}
+	return changed, nil
+}
+
+// extendSchema returns existing with the columns of want it lacks, added as nullable columns,
+// and whether any were missing. Columns added later cannot be required, since the rows
+// already in the table have no value for them.
+func extendSchema(existing, want *Schema) (*Schema, bool) {
+	extended := &Schema{}
+	have := map[string]bool{}
+	if existing != nil {
+		extended.Fields = append(extended.Fields, existing.Fields...)
+		for _, field := range existing.Fields {
+			have[field.Name] = true
+		}
+	}
+
+	missing := false
+	for _, field := range want.Fields {
+		if have[field.Name] {
+			continue
+		}
+		field.Mode = modeNullable
+		extended.Fields = append(extended.Fields, field)
+		missing = true
+	}
+	return extended, missing
+}
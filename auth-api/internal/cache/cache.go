@@ -0,0 +1,142 @@
+// Package cache stores rendered responses of hot endpoints in Redis. Entries are grouped
+// by what they depend on (a repository, a user, or everything) and invalidated by bumping
+// the generation of their group, so an invalidation is a single Redis command regardless
+// of how many entries it covers.
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// keyPrefix namespaces every key written by the cache
+const keyPrefix = "ecoci:cache:"
+
+// Groups of cached responses
+const (
+	GroupRepositories = "repos"
+	GroupStats        = "stats"
+	GroupLeaderboard  = "leaderboard"
+)
+
+// ScopeAll is the scope of groups that are invalidated as a whole
+const ScopeAll = "all"
+
+// RepositoryScope returns the scope of responses that depend on one repository
+func RepositoryScope(repoID string) string {
+	return "repo:" + repoID
+}
+
+// UserScope returns the scope of responses that depend on the runs of one user
+func UserScope(userID string) string {
+	return "user:" + userID
+}
+
+// Entry is a cached response body with its content type
+type Entry struct {
+	ContentType string
+	Body        []byte
+}
+
+// Cache is a Redis-backed response cache
+type Cache struct {
+	client *redis.Client
+}
+
+// New connects to the Redis server at url ("redis://[:password@]host:port/db")
+func New(url string) (*Cache, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+	// A slow or unreachable cache must not hold up requests for long
+	if opts.DialTimeout == 0 {
+		opts.DialTimeout = time.Second
+	}
+	if opts.ReadTimeout == 0 {
+		opts.ReadTimeout = 500 * time.Millisecond
+	}
+	if opts.WriteTimeout == 0 {
+		opts.WriteTimeout = 500 * time.Millisecond
+	}
+	return &Cache{client: redis.NewClient(opts)}, nil
+}
+
+// Ping checks the connection to Redis
+func (c *Cache) Ping(ctx context.Context) error {
+	return c.client.Ping(ctx).Err()
+}
+
+// Close closes the connection to Redis
+func (c *Cache) Close() error {
+	return c.client.Close()
+}
+
+// Get returns the entry stored under key in the current generation of group and scope
+func (c *Cache) Get(ctx context.Context, group, scope, key string) (*Entry, bool, error) {
+	entryKey, err := c.entryKey(ctx, group, scope, key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	value, err := c.client.Get(ctx, entryKey).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read cache entry: %w", err)
+	}
+
+	contentType, body, found := strings.Cut(string(value), "\n")
+	if !found {
+		return nil, false, nil
+	}
+	return &Entry{ContentType: contentType, Body: []byte(body)}, true, nil
+}
+
+// Set stores entry under key in the current generation of group and scope for ttl
+func (c *Cache) Set(ctx context.Context, group, scope, key string, entry *Entry, ttl time.Duration) error {
+	entryKey, err := c.entryKey(ctx, group, scope, key)
+	if err != nil {
+		return err
+	}
+
+	value := append([]byte(entry.ContentType+"\n"), entry.Body...)
+	if err := c.client.Set(ctx, entryKey, value, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	return nil
+}
+
+// Invalidate drops every entry of group and scope by starting a new generation; the
+// entries of older generations are never read again and expire with their TTL
+func (c *Cache) Invalidate(ctx context.Context, group, scope string) error {
+	if err := c.client.Incr(ctx, generationKey(group, scope)).Err(); err != nil {
+		return fmt.Errorf("failed to invalidate %s cache: %w", group, err)
+	}
+	return nil
+}
+
+// entryKey returns the Redis key of key in the current generation of group and scope
+func (c *Cache) entryKey(ctx context.Context, group, scope, key string) (string, error) {
+	generation, err := c.client.Get(ctx, generationKey(group, scope)).Result()
+	if err == redis.Nil {
+		generation = "0"
+	} else if err != nil {
+		return "", fmt.Errorf("failed to read cache generation: %w", err)
+	}
+
+	sum := sha256.Sum256([]byte(key))
+	return keyPrefix + group + ":" + scope + ":" + generation + ":" + hex.EncodeToString(sum[:]), nil
+}
+
+// generationKey returns the Redis key holding the generation of group and scope
+func generationKey(group, scope string) string {
+	return keyPrefix + "generation:" + group + ":" + scope
+}
@@ -0,0 +1,107 @@
+// Package carbon forecasts the carbon intensity of electricity grids, so non-urgent CI runs
+// can be scheduled for the hours and regions where the grid is cleanest
+package carbon
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ecoci/auth-api/internal/energy"
+)
+
+// ErrUnknownRegion is returned for regions a provider has no forecast of
+var ErrUnknownRegion = errors.New("unknown region")
+
+// Point is the carbon intensity of a grid in g CO2e/kWh from Time until the next point
+type Point struct {
+	Time      time.Time `json:"time"`
+	Intensity float64   `json:"carbon_intensity"`
+}
+
+// Provider forecasts the carbon intensity of the grid of a region
+type Provider interface {
+	// Name identifies the provider in responses
+	Name() string
+	// Forecast returns the points covering from to to, oldest first. Regions are cloud
+	// regions such as westeurope or eu-north-1, or grid zones of the provider.
+	Forecast(ctx context.Context, region string, from, to time.Time) ([]Point, error)
+}
+
+// Static forecasts the average carbon intensity of each cloud region for every hour, without
+// daily or seasonal variation
+type Static struct{}
+
+// Name returns "static"
+func (Static) Name() string {
+	return "static"
+}
+
+// Forecast returns the average intensity of the region for every hour from from to to
+func (Static) Forecast(ctx context.Context, region string, from, to time.Time) ([]Point, error) {
+	intensity, ok := energy.CarbonIntensity(region)
+	if !ok {
+		return nil, ErrUnknownRegion
+	}
+	var points []Point
+	for at := from.Truncate(time.Hour); at.Before(to); at = at.Add(time.Hour) {
+		points = append(points, Point{Time: at, Intensity: intensity})
+	}
+	return points, nil
+}
+
+// zones maps cloud regions to the grid zones of the Electricity Maps API
+var zones = map[string]string{
+	// Azure
+	"australiaeast":      "AU-NSW",
+	"brazilsouth":        "BR-CS",
+	"canadacentral":      "CA-ON",
+	"centralindia":       "IN-WE",
+	"centralus":          "US-MIDW-MISO",
+	"eastasia":           "HK",
+	"eastus":             "US-MIDA-PJM",
+	"eastus2":            "US-MIDA-PJM",
+	"francecentral":      "FR",
+	"germanywestcentral": "DE",
+	"japaneast":          "JP-TK",
+	"koreacentral":       "KR",
+	"northcentralus":     "US-MIDW-MISO",
+	"northeurope":        "IE",
+	"norwayeast":         "NO-NO1",
+	"southcentralus":     "US-TEX-ERCO",
+	"southeastasia":      "SG",
+	"swedencentral":      "SE-SE3",
+	"switzerlandnorth":   "CH",
+	"uksouth":            "GB",
+	"westcentralus":      "US-NW-PACE",
+	"westeurope":         "NL",
+	"westus":             "US-CAL-CISO",
+	"westus2":            "US-NW-BPAT",
+	"westus3":            "US-SW-AZPS",
+	// AWS
+	"ap-northeast-1": "JP-TK",
+	"ap-south-1":     "IN-WE",
+	"ap-southeast-1": "SG",
+	"ap-southeast-2": "AU-NSW",
+	"ca-central-1":   "CA-QC",
+	"eu-central-1":   "DE",
+	"eu-north-1":     "SE-SE3",
+	"eu-west-1":      "IE",
+	"eu-west-2":      "GB",
+	"eu-west-3":      "FR",
+	"sa-east-1":      "BR-CS",
+	"us-east-1":      "US-MIDA-PJM",
+	"us-east-2":      "US-MIDA-PJM",
+	"us-west-1":      "US-CAL-CISO",
+	"us-west-2":      "US-NW-BPAT",
+}
+
+// Zone returns the Electricity Maps zone of a cloud region; other regions are taken to be
+// zones already
+func Zone(region string) string {
+	if zone, ok := zones[strings.ToLower(region)]; ok {
+		return zone
+	}
+	return region
+}
@@ -0,0 +1,143 @@
+package carbon
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var midnight = time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+// hourly returns a forecast starting at midnight with one point per hour
+func hourly(intensities ...float64) []Point {
+	points := make([]Point, len(intensities))
+	for i, intensity := range intensities {
+		points[i] = Point{Time: midnight.Add(time.Duration(i) * time.Hour), Intensity: intensity}
+	}
+	return points
+}
+
+func TestAverage(t *testing.T) {
+	forecast := hourly(100, 300, 200)
+
+	average, ok := Average(forecast, midnight.Add(30*time.Minute), midnight.Add(90*time.Minute))
+	require.True(t, ok)
+	assert.InDelta(t, 200, average, 1e-9)
+
+	// The last point lasts as long as the one before it
+	average, ok = Average(forecast, midnight.Add(2*time.Hour), midnight.Add(3*time.Hour))
+	require.True(t, ok)
+	assert.InDelta(t, 200, average, 1e-9)
+
+	_, ok = Average(forecast, midnight.Add(-time.Minute), midnight.Add(time.Hour))
+	assert.False(t, ok, "starts before the forecast")
+	_, ok = Average(forecast, midnight.Add(2*time.Hour), midnight.Add(4*time.Hour))
+	assert.False(t, ok, "ends after the forecast")
+	_, ok = Average(nil, midnight, midnight.Add(time.Hour))
+	assert.False(t, ok, "no forecast")
+}
+
+func TestWindows(t *testing.T) {
+	forecast := hourly(400, 300, 100, 120, 500, 90, 600, 600)
+	from := midnight.Add(15 * time.Minute)
+
+	windows := Windows(forecast, from, midnight.Add(8*time.Hour), 2*time.Hour, 3)
+	require.Len(t, windows, 3)
+	// 02:00 averages 110; 01:00, 03:00 and 05:00 overlap a better window, leaving 04:00 and 06:00
+	assert.Equal(t, midnight.Add(2*time.Hour), windows[0].Start)
+	assert.Equal(t, midnight.Add(4*time.Hour), windows[0].End)
+	assert.InDelta(t, 110, windows[0].Intensity, 1e-9)
+	assert.Equal(t, midnight.Add(4*time.Hour), windows[1].Start)
+	assert.InDelta(t, 295, windows[1].Intensity, 1e-9)
+	assert.Equal(t, midnight.Add(6*time.Hour), windows[2].Start)
+	assert.InDelta(t, 600, windows[2].Intensity, 1e-9)
+
+	for i, window := range windows {
+		for _, other := range windows[i+1:] {
+			assert.False(t, window.Start.Before(other.End) && other.Start.Before(window.End), "windows overlap")
+		}
+	}
+
+	assert.Empty(t, Windows(forecast, from, midnight.Add(2*time.Hour), 3*time.Hour, 3), "longer than the horizon")
+
+	// Windows may start now, which wins ties with later windows
+	windows = Windows(hourly(100, 100, 500, 500), from, midnight.Add(4*time.Hour), time.Hour, 1)
+	require.Len(t, windows, 1)
+	assert.Equal(t, from, windows[0].Start)
+	assert.InDelta(t, 100, windows[0].Intensity, 1e-9)
+}
+
+func TestForecasts(t *testing.T) {
+	from := midnight.Add(30 * time.Minute)
+	forecasts, err := Forecasts(context.Background(), Static{}, []string{"westeurope", "eu-north-1"}, from, midnight.Add(3*time.Hour), time.Hour)
+	require.NoError(t, err)
+	require.Len(t, forecasts, 2)
+	assert.Equal(t, "westeurope", forecasts[0].Region)
+	require.NotNil(t, forecasts[0].Current)
+	assert.Equal(t, 328.0, *forecasts[0].Current)
+	assert.Equal(t, 328.0, forecasts[0].Average)
+	require.NotNil(t, forecasts[1].BestWindow)
+	assert.Equal(t, from, forecasts[1].BestWindow.Start)
+	assert.Equal(t, 8.0, forecasts[1].BestWindow.Intensity)
+
+	forecasts, err = Forecasts(context.Background(), Static{}, []string{"westeurope"}, from, midnight.Add(time.Hour), 2*time.Hour)
+	require.NoError(t, err)
+	assert.Nil(t, forecasts[0].BestWindow, "longer than the horizon")
+
+	_, err = Forecasts(context.Background(), Static{}, []string{"westeurope", "moon-base-1"}, from, midnight.Add(time.Hour), time.Hour)
+	assert.ErrorIs(t, err, ErrUnknownRegion)
+	assert.Contains(t, err.Error(), "moon-base-1")
+}
+
+func TestStatic(t *testing.T) {
+	points, err := Static{}.Forecast(context.Background(), "eu-north-1", midnight.Add(30*time.Minute), midnight.Add(3*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, points, 3)
+	assert.Equal(t, midnight, points[0].Time)
+	assert.Equal(t, 8.0, points[2].Intensity)
+
+	_, err = Static{}.Forecast(context.Background(), "moon-base-1", midnight, midnight.Add(time.Hour))
+	assert.ErrorIs(t, err, ErrUnknownRegion)
+}
+
+func TestElectricityMaps(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "/carbon-intensity/forecast", r.URL.Path)
+		assert.Equal(t, "secret-token", r.Header.Get("auth-token"))
+		if r.URL.Query().Get("zone") != "NL" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"Zone does not exist"}`))
+			return
+		}
+		w.Write([]byte(`{"zone":"NL","forecast":[
+			{"carbonIntensity":310,"datetime":"2024-03-01T00:00:00.000Z"},
+			{"carbonIntensity":280,"datetime":"2024-03-01T01:00:00.000Z"},
+			{"carbonIntensity":150,"datetime":"2024-03-01T02:00:00.000Z"},
+			{"carbonIntensity":120,"datetime":"2024-03-01T03:00:00.000Z"}
+		]}`))
+	}))
+	defer server.Close()
+
+	provider := NewElectricityMaps(server.URL+"/", "secret-token")
+	points, err := provider.Forecast(context.Background(), "westeurope", midnight.Add(90*time.Minute), midnight.Add(3*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []Point{
+		{Time: midnight.Add(time.Hour), Intensity: 280},
+		{Time: midnight.Add(2 * time.Hour), Intensity: 150},
+	}, points)
+
+	// The forecast of a zone is reused
+	_, err = provider.Forecast(context.Background(), "NL", midnight, midnight.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 1, requests)
+
+	_, err = provider.Forecast(context.Background(), "atlantis", midnight, midnight.Add(time.Hour))
+	assert.ErrorIs(t, err, ErrUnknownRegion)
+}
@@ -0,0 +1,132 @@
+package carbon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ecoci/auth-api/internal/tracing"
+)
+
+// DefaultElectricityMapsURL is the Electricity Maps API used unless configured otherwise
+const DefaultElectricityMapsURL = "https://api.electricitymap.org/v3"
+
+const (
+	// requestTimeout bounds every request to the Electricity Maps API
+	requestTimeout = 10 * time.Second
+	// forecastTTL is how long a forecast is reused; Electricity Maps updates them hourly
+	forecastTTL = 15 * time.Minute
+)
+
+// ElectricityMaps forecasts the carbon intensity of grid zones with the Electricity Maps API
+type ElectricityMaps struct {
+	client *http.Client
+	apiURL string
+	token  string
+
+	mu        sync.Mutex
+	forecasts map[string]cachedForecast
+}
+
+// cachedForecast is the forecast of a zone and when it was fetched
+type cachedForecast struct {
+	points    []Point
+	fetchedAt time.Time
+}
+
+// NewElectricityMaps creates a provider authenticated with an Electricity Maps API token
+func NewElectricityMaps(apiURL, token string) *ElectricityMaps {
+	return &ElectricityMaps{
+		client:    &http.Client{Timeout: requestTimeout, Transport: tracing.Transport(nil)},
+		apiURL:    strings.TrimSuffix(apiURL, "/"),
+		token:     token,
+		forecasts: map[string]cachedForecast{},
+	}
+}
+
+// Name returns "electricitymaps"
+func (e *ElectricityMaps) Name() string {
+	return "electricitymaps"
+}
+
+// Forecast returns the forecast points of the zone of region between from and to
+func (e *ElectricityMaps) Forecast(ctx context.Context, region string, from, to time.Time) ([]Point, error) {
+	points, err := e.forecast(ctx, Zone(region))
+	if err != nil {
+		return nil, err
+	}
+	var covering []Point
+	for i, point := range points {
+		// Keep the point in effect at from, which may have started before it
+		if point.Time.Before(to) && (i+1 == len(points) || points[i+1].Time.After(from)) {
+			covering = append(covering, point)
+		}
+	}
+	return covering, nil
+}
+
+// forecast returns the forecast of a zone, fetching it when the cached one is stale
+func (e *ElectricityMaps) forecast(ctx context.Context, zone string) ([]Point, error) {
+	e.mu.Lock()
+	cached, ok := e.forecasts[zone]
+	e.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < forecastTTL {
+		return cached.points, nil
+	}
+
+	points, err := e.fetch(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	e.forecasts[zone] = cachedForecast{points: points, fetchedAt: time.Now()}
+	e.mu.Unlock()
+	return points, nil
+}
+
+// fetch requests the forecast of a zone
+func (e *ElectricityMaps) fetch(ctx context.Context, zone string) ([]Point, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, e.apiURL+"/carbon-intensity/forecast?zone="+url.QueryEscape(zone), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create forecast request: %w", err)
+	}
+	req.Header.Set("auth-token", e.token)
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request forecast: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read forecast: %w", err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusNotFound:
+		return nil, ErrUnknownRegion
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("electricity maps returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var response struct {
+		Forecast []struct {
+			CarbonIntensity float64   `json:"carbonIntensity"`
+			Datetime        time.Time `json:"datetime"`
+		} `json:"forecast"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to decode forecast: %w", err)
+	}
+	points := make([]Point, 0, len(response.Forecast))
+	for _, entry := range response.Forecast {
+		points = append(points, Point{Time: entry.Datetime.UTC(), Intensity: entry.CarbonIntensity})
+	}
+	return points, nil
+}
@@ -0,0 +1,75 @@
+package carbon
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RegionForecast summarizes the forecast of a region for runs of a duration
+type RegionForecast struct {
+	Region string `json:"region"`
+	// Current is the intensity of a run starting now, nil when the forecast does not cover now
+	Current *float64 `json:"current_intensity"`
+	// Average is the average intensity of the forecast up to the horizon
+	Average float64 `json:"forecast_intensity"`
+	// BestWindow is when a run is forecast to meet the cleanest grid, nil when no run fits
+	// into the forecast
+	BestWindow *Window `json:"best_window"`
+}
+
+// Forecasts summarizes the forecasts of regions from from until until for runs of duration, in
+// the order of regions. Forecasts are requested concurrently; an unknown region fails all of
+// them with an error wrapping ErrUnknownRegion.
+func Forecasts(ctx context.Context, provider Provider, regions []string, from, until time.Time, duration time.Duration) ([]RegionForecast, error) {
+	forecasts := make([]RegionForecast, len(regions))
+	errs := make([]error, len(regions))
+
+	var wg sync.WaitGroup
+	for i, region := range regions {
+		wg.Add(1)
+		go func(i int, region string) {
+			defer wg.Done()
+			points, err := provider.Forecast(ctx, region, from, until)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", region, err)
+				return
+			}
+			forecasts[i] = summarize(region, points, from, until, duration)
+		}(i, region)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return forecasts, nil
+}
+
+// summarize builds the forecast summary of a region from its points
+func summarize(region string, points []Point, from, until time.Time, duration time.Duration) RegionForecast {
+	forecast := RegionForecast{Region: region}
+	if intensity, ok := Average(points, from, from.Add(duration)); ok {
+		forecast.Current = &intensity
+	}
+	if windows := Windows(points, from, until, duration, 1); len(windows) > 0 {
+		forecast.BestWindow = &windows[0]
+	}
+
+	// Points are weighted equally, as forecasts are hourly
+	var sum float64
+	var count int
+	for _, point := range points {
+		if point.Time.Before(until) {
+			sum += point.Intensity
+			count++
+		}
+	}
+	if count > 0 {
+		forecast.Average = sum / float64(count)
+	}
+	return forecast
+}
@@ -0,0 +1,105 @@
+package carbon
+
+import (
+	"sort"
+	"time"
+)
+
+// defaultStep is how long the last point of a forecast, or a single point, is in effect
+const defaultStep = time.Hour
+
+// Window is a period with the average carbon intensity forecast for it
+type Window struct {
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Intensity float64   `json:"carbon_intensity"`
+}
+
+// Average returns the average carbon intensity of the forecast between start and end, and
+// false when the forecast does not cover the whole period
+func Average(forecast []Point, start, end time.Time) (float64, bool) {
+	if len(forecast) == 0 || !end.After(start) || start.Before(forecast[0].Time) {
+		return 0, false
+	}
+	var weighted float64
+	covered := start
+	for i, point := range forecast {
+		pointEnd := point.Time.Add(defaultStep)
+		if i+1 < len(forecast) {
+			pointEnd = forecast[i+1].Time
+		} else if i > 0 {
+			pointEnd = point.Time.Add(point.Time.Sub(forecast[i-1].Time))
+		}
+		from, to := maxTime(point.Time, start), minTime(pointEnd, end)
+		if !to.After(from) {
+			continue
+		}
+		if from.After(covered) {
+			return 0, false
+		}
+		weighted += point.Intensity * to.Sub(from).Seconds()
+		covered = to
+	}
+	if covered.Before(end) {
+		return 0, false
+	}
+	return weighted / end.Sub(start).Seconds(), true
+}
+
+// Windows returns up to count windows of duration that start at from or at a point of the
+// forecast and end by until, lowest carbon intensity first. Windows do not overlap; of equal
+// intensities the earlier window is preferred.
+func Windows(forecast []Point, from, until time.Time, duration time.Duration, count int) []Window {
+	starts := []time.Time{from}
+	for _, point := range forecast {
+		if point.Time.After(from) {
+			starts = append(starts, point.Time)
+		}
+	}
+
+	var candidates []Window
+	for _, start := range starts {
+		end := start.Add(duration)
+		if end.After(until) {
+			break
+		}
+		if intensity, ok := Average(forecast, start, end); ok {
+			candidates = append(candidates, Window{Start: start, End: end, Intensity: intensity})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Intensity < candidates[j].Intensity
+	})
+
+	windows := []Window{}
+	for _, candidate := range candidates {
+		if len(windows) == count {
+			break
+		}
+		overlaps := false
+		for _, window := range windows {
+			if candidate.Start.Before(window.End) && window.Start.Before(candidate.End) {
+				overlaps = true
+				break
+			}
+		}
+		if !overlaps {
+			windows = append(windows, candidate)
+		}
+	}
+	return windows
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,90 @@
+// Package ci describes the CI run a command executes in from the environment variables of the
+// CI system, so integrations need no configuration beyond an API token.
+package ci
+
+import "strings"
+
+// ProviderGitHubActions is the provider of runs detected from the GITHUB_* variables
+const ProviderGitHubActions = "github-actions"
+
+// Environment describes a CI run; fields the CI system does not provide are empty
+type Environment struct {
+	Provider string
+	// Repository is the full name of the repository, such as octocat/hello-world
+	Repository    string
+	RepositoryURL string
+	CommitSHA     string
+	Branch        string
+	Tag           string
+	Workflow      string
+	// WorkflowRunGroup identifies the execution of the workflow, shared by all of its jobs
+	WorkflowRunGroup string
+	// Metadata identifies the run within the CI system, such as its run ID and runner
+	Metadata map[string]interface{}
+}
+
+// Detect returns the CI run described by the environment variables read with getenv, or nil
+// outside of a supported CI system
+func Detect(getenv func(string) string) *Environment {
+	if getenv("GITHUB_REPOSITORY") != "" {
+		return gitHubActions(getenv)
+	}
+	return nil
+}
+
+// gitHubActions describes a GitHub Actions run from its default environment variables
+func gitHubActions(getenv func(string) string) *Environment {
+	env := &Environment{
+		Provider:   ProviderGitHubActions,
+		Repository: getenv("GITHUB_REPOSITORY"),
+		CommitSHA:  getenv("GITHUB_SHA"),
+		Workflow:   getenv("GITHUB_WORKFLOW"),
+		Metadata:   map[string]interface{}{"ci_provider": ProviderGitHubActions},
+	}
+
+	serverURL := getenv("GITHUB_SERVER_URL")
+	if serverURL == "" {
+		serverURL = "https://github.com"
+	}
+	env.RepositoryURL = strings.TrimRight(serverURL, "/") + "/" + env.Repository
+
+	// Pull request runs check out a merge ref; the branch is the source branch of the pull
+	// request. Tag runs have no branch, but a tag.
+	switch ref := getenv("GITHUB_REF"); {
+	case getenv("GITHUB_HEAD_REF") != "":
+		env.Branch = getenv("GITHUB_HEAD_REF")
+	case strings.HasPrefix(ref, "refs/heads/"):
+		env.Branch = strings.TrimPrefix(ref, "refs/heads/")
+	case strings.HasPrefix(ref, "refs/tags/"):
+		env.Tag = strings.TrimPrefix(ref, "refs/tags/")
+	case ref == "" && getenv("GITHUB_REF_TYPE") == "branch":
+		env.Branch = getenv("GITHUB_REF_NAME")
+	case ref == "" && getenv("GITHUB_REF_TYPE") == "tag":
+		env.Tag = getenv("GITHUB_REF_NAME")
+	}
+
+	// The jobs of a workflow run, such as those of a matrix, share its ID; re-running jobs
+	// starts a new attempt, which is a separate execution
+	if runID := getenv("GITHUB_RUN_ID"); runID != "" {
+		attempt := getenv("GITHUB_RUN_ATTEMPT")
+		if attempt == "" {
+			attempt = "1"
+		}
+		env.WorkflowRunGroup = ProviderGitHubActions + "/" + runID + "/" + attempt
+	}
+
+	for key, variable := range map[string]string{
+		"github_run_id":      "GITHUB_RUN_ID",
+		"github_run_attempt": "GITHUB_RUN_ATTEMPT",
+		"github_job":         "GITHUB_JOB",
+		"github_event_name":  "GITHUB_EVENT_NAME",
+		"runner_os":          "RUNNER_OS",
+		"runner_arch":        "RUNNER_ARCH",
+	} {
+		if value := getenv(variable); value != "" {
+			env.Metadata[key] = value
+		}
+	}
+
+	return env
+}
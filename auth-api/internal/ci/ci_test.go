@@ -0,0 +1,72 @@
+package ci
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func lookup(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+func TestDetect(t *testing.T) {
+	t.Run("outside of CI", func(t *testing.T) {
+		assert.Nil(t, Detect(lookup(nil)))
+	})
+
+	t.Run("GitHub Actions push", func(t *testing.T) {
+		env := Detect(lookup(map[string]string{
+			"GITHUB_ACTIONS":    "true",
+			"GITHUB_REPOSITORY": "octocat/hello-world",
+			"GITHUB_SERVER_URL": "https://github.example.com/",
+			"GITHUB_SHA":        "ffac537e6cbbf934b08745a378932722df287a53",
+			"GITHUB_REF":        "refs/heads/feature/green",
+			"GITHUB_REF_NAME":   "feature/green",
+			"GITHUB_WORKFLOW":   "CI",
+			"GITHUB_RUN_ID":     "1658821493",
+			"RUNNER_OS":         "Linux",
+		}))
+		require.NotNil(t, env)
+		assert.Equal(t, ProviderGitHubActions, env.Provider)
+		assert.Equal(t, "octocat/hello-world", env.Repository)
+		assert.Equal(t, "https://github.example.com/octocat/hello-world", env.RepositoryURL)
+		assert.Equal(t, "ffac537e6cbbf934b08745a378932722df287a53", env.CommitSHA)
+		assert.Equal(t, "feature/green", env.Branch)
+		assert.Equal(t, "CI", env.Workflow)
+		assert.Equal(t, "github-actions/1658821493/1", env.WorkflowRunGroup)
+		assert.Equal(t, map[string]interface{}{
+			"ci_provider":   ProviderGitHubActions,
+			"github_run_id": "1658821493",
+			"runner_os":     "Linux",
+		}, env.Metadata)
+	})
+
+	t.Run("GitHub Actions pull request", func(t *testing.T) {
+		env := Detect(lookup(map[string]string{
+			"GITHUB_REPOSITORY":  "octocat/hello-world",
+			"GITHUB_REF":         "refs/pull/42/merge",
+			"GITHUB_HEAD_REF":    "fix-leak",
+			"GITHUB_RUN_ID":      "1658821500",
+			"GITHUB_RUN_ATTEMPT": "2",
+		}))
+		require.NotNil(t, env)
+		assert.Equal(t, "fix-leak", env.Branch)
+		assert.Equal(t, "github-actions/1658821500/2", env.WorkflowRunGroup)
+		assert.Equal(t, "https://github.com/octocat/hello-world", env.RepositoryURL)
+	})
+
+	t.Run("GitHub Actions tag", func(t *testing.T) {
+		env := Detect(lookup(map[string]string{
+			"GITHUB_REPOSITORY": "octocat/hello-world",
+			"GITHUB_REF":        "refs/tags/v1.0.0",
+			"GITHUB_REF_NAME":   "v1.0.0",
+			"GITHUB_REF_TYPE":   "tag",
+		}))
+		require.NotNil(t, env)
+		assert.Empty(t, env.Branch)
+		assert.Equal(t, "v1.0.0", env.Tag)
+		assert.Empty(t, env.WorkflowRunGroup)
+	})
+}
@@ -0,0 +1,151 @@
+// Package client talks to the EcoCI API on behalf of CI integrations such as the ecoci CLI.
+// Requests are authenticated with an API token sent as a bearer token.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
+	"github.com/ecoci/auth-api/internal/version"
+)
+
+// DefaultBaseURL is the EcoCI API used when no other is configured
+const DefaultBaseURL = "https://api.ecoci.dev"
+
+// apiPrefix is the path of the API version the client speaks
+const apiPrefix = "/api/v1"
+
+// DefaultTimeout bounds each request, so a slow API cannot hold up a pipeline for long
+const DefaultTimeout = 30 * time.Second
+
+// Error is an error response of the API, described by its problem details when the API sent
+// them
+type Error struct {
+	StatusCode int
+	Problem    problem.Problem
+}
+
+func (e *Error) Error() string {
+	if e.Problem.Title == "" {
+		return fmt.Sprintf("API responded with status %d", e.StatusCode)
+	}
+	message := fmt.Sprintf("%s (%d %s)", e.Problem.Title, e.StatusCode, e.Problem.Code)
+	if e.Problem.Detail != "" {
+		message += ": " + e.Problem.Detail
+	}
+	return message
+}
+
+// Client is a client of the EcoCI API
+type Client struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+}
+
+// New creates a client of the API at baseURL, the root of the server such as
+// https://api.ecoci.dev, authenticating with token
+func New(baseURL, token string) *Client {
+	return &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		token:      token,
+		httpClient: &http.Client{Timeout: DefaultTimeout},
+	}
+}
+
+// CreateRun submits the measurement of a CI run and returns the stored run
+func (c *Client) CreateRun(ctx context.Context, req *service.RunCreateRequest) (*db.Run, error) {
+	var run db.Run
+	if err := c.do(ctx, http.MethodPost, "/runs", req, &run); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// UploadTestReport attaches the JUnit XML report of a run, replacing any uploaded before, and
+// returns its test suites with the energy and CO2 apportioned to them
+func (c *Client) UploadTestReport(ctx context.Context, runID uuid.UUID, report io.Reader) ([]db.RunTestSuite, error) {
+	var result struct {
+		TestSuites []db.RunTestSuite `json:"test_suites"`
+	}
+	if err := c.send(ctx, http.MethodPut, "/runs/"+runID.String()+"/test-suites", "application/xml", report, &result); err != nil {
+		return nil, err
+	}
+	return result.TestSuites, nil
+}
+
+// Import uploads a file exported by another measurement tool to the importer of source,
+// such as codecarbon, with the query parameters of the importer
+func (c *Client) Import(ctx context.Context, source string, query url.Values, contentType string, file io.Reader) (*service.ImportResult, error) {
+	path := "/imports/" + url.PathEscape(source)
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	var result service.ImportResult
+	if err := c.send(ctx, http.MethodPost, path, contentType, file, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// do sends a request with body encoded as JSON and decodes the response into out, returning an
+// *Error for error responses
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	if body == nil {
+		return c.send(ctx, method, path, "", nil, out)
+	}
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+	return c.send(ctx, method, path, "application/json", bytes.NewReader(encoded), out)
+}
+
+// send sends a request with a body of contentType, if any, and decodes the response into out
+func (c *Client) send(ctx context.Context, method, path, contentType string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+apiPrefix+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("API-Version", "1")
+	req.Header.Set("User-Agent", "ecoci-cli/"+version.Version)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		// Responses without problem details, such as from a proxy, only report the status
+		json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&apiErr.Problem)
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// Backoff of spooled runs: the delay before the next attempt doubles with every failed
+// attempt, from spoolBaseDelay up to spoolMaxDelay
+const (
+	spoolBaseDelay = time.Minute
+	spoolMaxDelay  = 6 * time.Hour
+)
+
+// The spool is locked with a lock file next to it. Flushes hold the lock while submitting,
+// which a request timeout bounds, so older locks were left by a process that died.
+const (
+	spoolLockWait  = time.Minute
+	spoolLockStale = 10 * time.Minute
+)
+
+// ErrSpooled is returned by Spool.CreateRun when the API was unreachable and the run was
+// queued to be submitted later
+var ErrSpooled = errors.New("run queued for retry")
+
+// spooledRun is a run waiting in the spool
+type spooledRun struct {
+	Run         service.RunCreateRequest `json:"run"`
+	QueuedAt    time.Time                `json:"queued_at"`
+	Attempts    int                      `json:"attempts"`
+	NextAttempt time.Time                `json:"next_attempt"`
+}
+
+// FlushResult reports a flush of the spool
+type FlushResult struct {
+	// Submitted is the number of runs submitted
+	Submitted int
+	// Rejected are the errors of the runs the API rejected, which are dropped from the spool
+	Rejected []error
+	// Pending is the number of runs left in the spool
+	Pending int
+}
+
+// Spool submits runs through a client, queueing them in a file when the API is unreachable
+// or fails, so an outage does not lose measurements. Queued runs are retried by Flush with
+// exponential backoff. Several processes may share a spool file.
+type Spool struct {
+	client *Client
+	path   string
+	now    func() time.Time
+}
+
+// NewSpool returns a spool of the runs of client in the file at path. With an empty path runs
+// are submitted without queueing.
+func NewSpool(client *Client, path string) *Spool {
+	return &Spool{client: client, path: path, now: time.Now}
+}
+
+// DefaultSpoolPath returns the spool file in the user's cache directory
+func DefaultSpoolPath() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "ecoci", "spool.jsonl")
+}
+
+// Retryable reports whether a request that failed with err may succeed later: when the API
+// could not be reached, failed or asked to slow down
+func Retryable(err error) bool {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500 || apiErr.StatusCode == http.StatusRequestTimeout || apiErr.StatusCode == http.StatusTooManyRequests
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// CreateRun submits a run, queueing it when the request is retryable. A queued run returns an
+// error wrapping ErrSpooled and the error of the request.
+func (s *Spool) CreateRun(ctx context.Context, req *service.RunCreateRequest) (*db.Run, error) {
+	run, err := s.client.CreateRun(ctx, req)
+	if err == nil || s.path == "" || !Retryable(err) {
+		return run, err
+	}
+
+	now := s.now().UTC()
+	entry := spooledRun{Run: *req, QueuedAt: now, Attempts: 1, NextAttempt: now.Add(spoolBaseDelay)}
+	if spoolErr := s.locked(func() error { return s.append(entry) }); spoolErr != nil {
+		return nil, fmt.Errorf("%w; failed to queue run: %v", err, spoolErr)
+	}
+	return nil, fmt.Errorf("%w: %w", ErrSpooled, err)
+}
+
+// Flush submits the queued runs that are due, in the order they were queued. It stops at the
+// first retryable failure, which postpones that run by its backoff, and drops the runs the API
+// rejects.
+func (s *Spool) Flush(ctx context.Context) (*FlushResult, error) {
+	result := &FlushResult{}
+	if s.path == "" {
+		return result, nil
+	}
+	if _, err := os.Stat(s.path); errors.Is(err, os.ErrNotExist) {
+		return result, nil
+	}
+
+	err := s.locked(func() error {
+		entries, err := s.read()
+		if err != nil {
+			return err
+		}
+		var pending []spooledRun
+		reachable, attempted := true, false
+		for _, entry := range entries {
+			if !reachable || entry.NextAttempt.After(s.now()) {
+				pending = append(pending, entry)
+				continue
+			}
+			attempted = true
+			req := entry.Run
+			if req.Metadata == nil {
+				req.Metadata = map[string]interface{}{}
+			}
+			// The API dates runs by their submission; the queue time records when it was measured
+			req.Metadata["spooled_at"] = entry.QueuedAt.Format(time.RFC3339)
+			_, err := s.client.CreateRun(ctx, &req)
+			switch {
+			case err == nil:
+				result.Submitted++
+			case Retryable(err):
+				entry.NextAttempt = s.now().UTC().Add(spoolBackoff(entry.Attempts))
+				entry.Attempts++
+				pending = append(pending, entry)
+				reachable = false
+			default:
+				result.Rejected = append(result.Rejected, fmt.Errorf("run of %s queued at %s: %w", entry.Run.Repository.FullName, entry.QueuedAt.Format(time.RFC3339), err))
+			}
+		}
+		result.Pending = len(pending)
+		if !attempted {
+			return nil
+		}
+		return s.write(pending)
+	})
+	return result, err
+}
+
+// spoolBackoff returns the delay after the given number of failed attempts
+func spoolBackoff(attempts int) time.Duration {
+	delay := spoolBaseDelay
+	for i := 0; i < attempts && delay < spoolMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, spoolMaxDelay)
+}
+
+// locked runs fn holding the lock of the spool
+func (s *Spool) locked(fn func() error) error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return fmt.Errorf("failed to create spool directory: %w", err)
+	}
+	lock := s.path + ".lock"
+	deadline := time.Now().Add(spoolLockWait)
+	for {
+		file, err := os.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			file.WriteString(strconv.Itoa(os.Getpid()))
+			file.Close()
+			break
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("failed to lock spool: %w", err)
+		}
+		if info, statErr := os.Stat(lock); statErr == nil && time.Since(info.ModTime()) > spoolLockStale {
+			os.Remove(lock)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("failed to lock spool: %s is held by another process", lock)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	defer os.Remove(lock)
+	return fn()
+}
+
+// append adds a run to the spool file
+func (s *Spool) append(entry spooledRun) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode run: %w", err)
+	}
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open spool: %w", err)
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write spool: %w", err)
+	}
+	return file.Close()
+}
+
+// read returns the runs in the spool file. Lines that do not decode, such as one cut short by
+// a crash, are skipped.
+func (s *Spool) read() ([]spooledRun, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool: %w", err)
+	}
+	var entries []spooledRun
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 10*1024*1024)
+	for scanner.Scan() {
+		var entry spooledRun
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// write replaces the spool file with entries, removing it when none are left
+func (s *Spool) write(entries []spooledRun) error {
+	if len(entries) == 0 {
+		if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove spool: %w", err)
+		}
+		return nil
+	}
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("failed to encode run: %w", err)
+		}
+		buf.Write(append(line, '\n'))
+	}
+	// A crash while writing leaves the previous spool in place
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o600); err != nil {
+		return fmt.Errorf("failed to write spool: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to replace spool: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// fakeRunsAPI accepts runs while status is 201 and fails them with status otherwise
+type fakeRunsAPI struct {
+	mu       sync.Mutex
+	status   int
+	received []service.RunCreateRequest
+}
+
+func (a *fakeRunsAPI) setStatus(status int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.status = status
+}
+
+func (a *fakeRunsAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	if a.status != http.StatusCreated {
+		w.WriteHeader(a.status)
+		json.NewEncoder(w).Encode(map[string]interface{}{"title": http.StatusText(a.status), "status": a.status})
+		return
+	}
+	var req service.RunCreateRequest
+	json.NewDecoder(r.Body).Decode(&req)
+	a.received = append(a.received, req)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(db.Run{ID: uuid.New(), EnergyKWh: req.EnergyKWh, CO2Kg: req.CO2Kg})
+}
+
+func testRunRequest(co2 float64) *service.RunCreateRequest {
+	return &service.RunCreateRequest{
+		EnergyKWh:  0.1,
+		CO2Kg:      co2,
+		DurationS:  60,
+		Repository: service.RepositoryCreateRequest{Name: "hello-world", FullName: "octocat/hello-world", HTMLURL: "https://github.com/octocat/hello-world"},
+	}
+}
+
+func TestSpool(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	newSpool := func(t *testing.T) (*Spool, *fakeRunsAPI) {
+		api := &fakeRunsAPI{status: http.StatusCreated}
+		server := httptest.NewServer(api)
+		t.Cleanup(server.Close)
+		spool := NewSpool(New(server.URL, "token"), filepath.Join(t.TempDir(), "ecoci", "spool.jsonl"))
+		spool.now = func() time.Time { return now }
+		return spool, api
+	}
+
+	t.Run("queues runs while the API fails and retries them with backoff", func(t *testing.T) {
+		spool, api := newSpool(t)
+		api.setStatus(http.StatusServiceUnavailable)
+
+		_, err := spool.CreateRun(ctx, testRunRequest(0.05))
+		require.ErrorIs(t, err, ErrSpooled)
+		assert.True(t, Retryable(err))
+		entries, err := spool.read()
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, now.Add(time.Minute), entries[0].NextAttempt)
+
+		// Not due yet
+		result, err := spool.Flush(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, &FlushResult{Pending: 1}, result)
+
+		spool.now = func() time.Time { return now.Add(time.Minute) }
+		result, err = spool.Flush(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, &FlushResult{Pending: 1}, result)
+		entries, err = spool.read()
+		require.NoError(t, err)
+		assert.Equal(t, 2, entries[0].Attempts)
+		assert.Equal(t, now.Add(3*time.Minute), entries[0].NextAttempt)
+
+		api.setStatus(http.StatusCreated)
+		spool.now = func() time.Time { return now.Add(3 * time.Minute) }
+		result, err = spool.Flush(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, &FlushResult{Submitted: 1}, result)
+		require.Len(t, api.received, 1)
+		assert.Equal(t, 0.05, api.received[0].CO2Kg)
+		assert.Equal(t, "2024-03-01T12:00:00Z", api.received[0].Metadata["spooled_at"])
+		assert.NoFileExists(t, spool.path)
+	})
+
+	t.Run("stops flushing at the first failure", func(t *testing.T) {
+		spool, api := newSpool(t)
+		api.setStatus(http.StatusBadGateway)
+		for _, co2 := range []float64{0.1, 0.2} {
+			_, err := spool.CreateRun(ctx, testRunRequest(co2))
+			require.ErrorIs(t, err, ErrSpooled)
+		}
+
+		spool.now = func() time.Time { return now.Add(time.Hour) }
+		result, err := spool.Flush(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, &FlushResult{Pending: 2}, result)
+		entries, err := spool.read()
+		require.NoError(t, err)
+		assert.Equal(t, []int{2, 1}, []int{entries[0].Attempts, entries[1].Attempts})
+
+		api.setStatus(http.StatusCreated)
+		spool.now = func() time.Time { return now.Add(2 * time.Hour) }
+		result, err = spool.Flush(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, &FlushResult{Submitted: 2}, result)
+		require.Len(t, api.received, 2)
+		assert.Equal(t, 0.1, api.received[0].CO2Kg)
+	})
+
+	t.Run("drops runs the API rejects", func(t *testing.T) {
+		spool, api := newSpool(t)
+		api.setStatus(http.StatusTooManyRequests)
+		_, err := spool.CreateRun(ctx, testRunRequest(0.1))
+		require.ErrorIs(t, err, ErrSpooled)
+
+		api.setStatus(http.StatusBadRequest)
+		spool.now = func() time.Time { return now.Add(time.Hour) }
+		result, err := spool.Flush(ctx)
+		require.NoError(t, err)
+		require.Len(t, result.Rejected, 1)
+		assert.ErrorContains(t, result.Rejected[0], "run of octocat/hello-world queued at 2024-03-01T12:00:00Z: Bad Request (400")
+		assert.Zero(t, result.Pending)
+		assert.NoFileExists(t, spool.path)
+	})
+
+	t.Run("does not queue rejected runs", func(t *testing.T) {
+		spool, api := newSpool(t)
+		api.setStatus(http.StatusUnprocessableEntity)
+		_, err := spool.CreateRun(ctx, testRunRequest(0.1))
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, ErrSpooled)
+		assert.False(t, Retryable(err))
+		assert.NoFileExists(t, spool.path)
+	})
+
+	t.Run("queues runs while the API is unreachable", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		server.Close()
+		path := filepath.Join(t.TempDir(), "spool.jsonl")
+		_, err := NewSpool(New(server.URL, "token"), path).CreateRun(ctx, testRunRequest(0.1))
+		require.ErrorIs(t, err, ErrSpooled)
+		assert.FileExists(t, path)
+	})
+
+	t.Run("skips lines cut short", func(t *testing.T) {
+		spool, _ := newSpool(t)
+		require.NoError(t, os.MkdirAll(filepath.Dir(spool.path), 0o700))
+		line, err := json.Marshal(spooledRun{Run: *testRunRequest(0.3), QueuedAt: now, Attempts: 1, NextAttempt: now})
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(spool.path, append(append(line, '\n'), `{"run": {"energy_kwh"`...), 0o600))
+
+		result, err := spool.Flush(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, &FlushResult{Submitted: 1}, result)
+	})
+}
+
+func TestSpoolBackoff(t *testing.T) {
+	assert.Equal(t, 2*time.Minute, spoolBackoff(1))
+	assert.Equal(t, 4*time.Minute, spoolBackoff(2))
+	assert.Equal(t, 256*time.Minute, spoolBackoff(8))
+	assert.Equal(t, 6*time.Hour, spoolBackoff(9))
+	assert.Equal(t, 6*time.Hour, spoolBackoff(100))
+}
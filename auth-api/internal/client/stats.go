@@ -0,0 +1,101 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// ErrRepositoryNotFound is returned when no repository with runs has the requested full name
+var ErrRepositoryNotFound = errors.New("repository not found")
+
+// RepositoryStats are the statistics of a repository over a time range, compared with the
+// preceding range of equal length
+type RepositoryStats struct {
+	Summary    service.PeriodSummary     `json:"summary"`
+	Comparison *service.PeriodComparison `json:"comparison,omitempty"`
+}
+
+// Repository returns the repository with the full name, such as octocat/hello-world, that
+// the caller has access to. Where several users submitted runs for it, the repository with
+// the most runs is returned.
+func (c *Client) Repository(ctx context.Context, fullName string) (*db.RepositoryStats, error) {
+	query := url.Values{
+		"full_name": {fullName},
+		"mine":      {"true"},
+		"sort":      {"run_count"},
+		"limit":     {"1"},
+	}
+	var response struct {
+		Repositories []db.RepositoryStats `json:"repositories"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/repos?"+query.Encode(), nil, &response); err != nil {
+		return nil, err
+	}
+	if len(response.Repositories) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrRepositoryNotFound, fullName)
+	}
+	return &response.Repositories[0], nil
+}
+
+// RepositoryStats returns the statistics of a repository between from and to
+func (c *Client) RepositoryStats(ctx context.Context, repoID uuid.UUID, from, to time.Time) (*RepositoryStats, error) {
+	var stats RepositoryStats
+	path := "/repos/" + repoID.String() + "/stats?" + timeRange(from, to).Encode() + "&compare=" + service.ComparePreviousPeriod
+	if err := c.do(ctx, http.MethodGet, path, nil, &stats); err != nil {
+		return nil, err
+	}
+	return &stats, nil
+}
+
+// TimeSeries returns a metric of the runs of a repository between from and to, bucketed by
+// interval
+func (c *Client) TimeSeries(ctx context.Context, repoID uuid.UUID, metric, interval string, from, to time.Time) ([]service.TimeSeriesPoint, error) {
+	query := timeRange(from, to)
+	query.Set("metric", metric)
+	query.Set("interval", interval)
+	var response struct {
+		Points []service.TimeSeriesPoint `json:"points"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/repos/"+repoID.String()+"/timeseries?"+query.Encode(), nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Points, nil
+}
+
+// WorkflowStats returns the statistics of the workflows of a repository between from and to,
+// ordered by total CO2 descending
+func (c *Client) WorkflowStats(ctx context.Context, repoID uuid.UUID, from, to time.Time) ([]service.WorkflowStats, error) {
+	var response struct {
+		Workflows []service.WorkflowStats `json:"workflows"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/repos/"+repoID.String()+"/workflows/stats?"+timeRange(from, to).Encode(), nil, &response); err != nil {
+		return nil, err
+	}
+	return response.Workflows, nil
+}
+
+// BudgetCheck returns the state of the budgets of a repository
+func (c *Client) BudgetCheck(ctx context.Context, repoID uuid.UUID) (*service.BudgetCheck, error) {
+	var check service.BudgetCheck
+	if err := c.do(ctx, http.MethodGet, "/repos/"+repoID.String()+"/budget-check", nil, &check); err != nil {
+		return nil, err
+	}
+	return &check, nil
+}
+
+// timeRange returns the query parameters of a time range
+func timeRange(from, to time.Time) url.Values {
+	return url.Values{
+		"from": {from.UTC().Format(time.RFC3339)},
+		"to":   {to.UTC().Format(time.RFC3339)},
+	}
+}
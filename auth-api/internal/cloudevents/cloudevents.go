@@ -0,0 +1,109 @@
+// Package cloudevents formats carbon events as CloudEvents 1.0, in the structured mode, where
+// the event is one JSON document, and the binary mode, where the attributes travel as headers
+// and the body is the data alone.
+package cloudevents
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SpecVersion is the version of the CloudEvents specification events conform to
+const SpecVersion = "1.0"
+
+// Content types of the two modes
+const (
+	// ContentTypeStructured is the content type of structured events
+	ContentTypeStructured = "application/cloudevents+json"
+	// ContentTypeData is the content type of the data of every event
+	ContentTypeData = "application/json"
+)
+
+// TypePrefix namespaces the EcoCI event types, as the specification recommends reverse-DNS
+// names
+const TypePrefix = "dev.ecoci."
+
+// HeaderPrefix prefixes the headers of attributes in the binary mode of the HTTP and NATS
+// protocol bindings
+const HeaderPrefix = "ce-"
+
+// Event is a CloudEvent with JSON data
+type Event struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data"`
+}
+
+// New creates the CloudEvent of an EcoCI event type, such as run.created, that happened to
+// the resource at source
+func New(id, eventType, source, subject string, at time.Time, data interface{}) (*Event, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event data: %w", err)
+	}
+	return &Event{
+		SpecVersion:     SpecVersion,
+		ID:              id,
+		Source:          source,
+		Type:            Type(eventType),
+		Subject:         subject,
+		Time:            at.UTC(),
+		DataContentType: ContentTypeData,
+		Data:            encoded,
+	}, nil
+}
+
+// Type returns the CloudEvents type of an EcoCI event type
+func Type(eventType string) string {
+	return TypePrefix + eventType
+}
+
+// Source returns the source of the events of a repository: its page under baseURL
+func Source(baseURL, repositoryID string) string {
+	return strings.TrimRight(baseURL, "/") + "/repos/" + repositoryID
+}
+
+// Structured returns the event as a structured JSON document
+func (e *Event) Structured() ([]byte, error) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event: %w", err)
+	}
+	return body, nil
+}
+
+// Binary returns the headers and body of the event in binary mode: a header per attribute
+// and the data as the body, described by the Content-Type header
+func (e *Event) Binary() (map[string]string, []byte) {
+	headers := map[string]string{
+		HeaderPrefix + "specversion": e.SpecVersion,
+		HeaderPrefix + "id":          e.ID,
+		HeaderPrefix + "source":      e.Source,
+		HeaderPrefix + "type":        e.Type,
+		HeaderPrefix + "time":        e.Time.Format(time.RFC3339Nano),
+		"Content-Type":               e.DataContentType,
+	}
+	if e.Subject != "" {
+		headers[HeaderPrefix+"subject"] = e.Subject
+	}
+	return headers, e.Data
+}
+
+// Parse decodes a structured event
+func Parse(body []byte) (*Event, error) {
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, fmt.Errorf("failed to decode event: %w", err)
+	}
+	if event.SpecVersion != SpecVersion {
+		return nil, fmt.Errorf("unsupported CloudEvents version %q", event.SpecVersion)
+	}
+	return &event, nil
+}
@@ -0,0 +1,56 @@
+package cloudevents
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvent(t *testing.T) {
+	at := time.Date(2024, 3, 1, 12, 0, 0, 500, time.FixedZone("CET", 3600))
+	event, err := New("d1", "run.created", Source("https://ecoci.dev/", "r1"), "runs/42", at, map[string]interface{}{"co2_kg": 0.5})
+	require.NoError(t, err)
+	assert.Equal(t, "https://ecoci.dev/repos/r1", event.Source)
+	assert.Equal(t, "dev.ecoci.run.created", event.Type)
+
+	body, err := event.Structured()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"specversion": "1.0",
+		"id": "d1",
+		"source": "https://ecoci.dev/repos/r1",
+		"type": "dev.ecoci.run.created",
+		"subject": "runs/42",
+		"time": "2024-03-01T11:00:00.0000005Z",
+		"datacontenttype": "application/json",
+		"data": {"co2_kg": 0.5}
+	}`, string(body))
+
+	parsed, err := Parse(body)
+	require.NoError(t, err)
+	assert.Equal(t, event, parsed)
+
+	headers, data := parsed.Binary()
+	assert.Equal(t, map[string]string{
+		"ce-specversion": "1.0",
+		"ce-id":          "d1",
+		"ce-source":      "https://ecoci.dev/repos/r1",
+		"ce-type":        "dev.ecoci.run.created",
+		"ce-subject":     "runs/42",
+		"ce-time":        "2024-03-01T11:00:00.0000005Z",
+		"Content-Type":   "application/json",
+	}, headers)
+	assert.JSONEq(t, `{"co2_kg": 0.5}`, string(data))
+
+	// The subject is optional
+	event.Subject = ""
+	headers, _ = event.Binary()
+	assert.NotContains(t, headers, "ce-subject")
+
+	_, err = Parse([]byte(`{"specversion":"0.3","id":"d1"}`))
+	assert.EqualError(t, err, `unsupported CloudEvents version "0.3"`)
+	_, err = Parse([]byte(`not json`))
+	assert.Error(t, err)
+}
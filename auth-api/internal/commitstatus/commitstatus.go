@@ -0,0 +1,151 @@
+// Package commitstatus publishes the carbon budget verdict of each run as a GitHub commit
+// status, so emissions are visible next to the other checks of a pull request
+package commitstatus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/service"
+	"github.com/ecoci/auth-api/internal/tracing"
+)
+
+// DefaultAPIURL is the GitHub REST API used unless configured otherwise (GitHub Enterprise)
+const DefaultAPIURL = "https://api.github.com"
+
+// Context is the name the status is listed under on GitHub
+const Context = "EcoCI / Carbon budget"
+
+// Commit status states
+const (
+	StateSuccess = "success"
+	StateFailure = "failure"
+)
+
+// requestTimeout bounds every request to the GitHub API
+const requestTimeout = 10 * time.Second
+
+// Status is a GitHub commit status
+type Status struct {
+	State       string `json:"state"`
+	TargetURL   string `json:"target_url,omitempty"`
+	Description string `json:"description"`
+	Context     string `json:"context"`
+}
+
+// Evaluate builds the status of a run: failure when a budget of its period is exceeded or
+// the run is a regression, success otherwise. detailsURL links the status into EcoCI.
+func Evaluate(run *db.Run, exceeded []service.BudgetCrossing, regression *service.Regression, detailsURL string) Status {
+	status := Status{
+		State:       StateSuccess,
+		TargetURL:   detailsURL,
+		Description: fmt.Sprintf("%s CO₂, within budget", formatKg(run.CO2Kg)),
+		Context:     Context,
+	}
+
+	switch {
+	case len(exceeded) > 0:
+		budget := exceeded[0]
+		status.State = StateFailure
+		status.Description = fmt.Sprintf("%sly budget exceeded: %s of %s CO₂",
+			strings.ToUpper(budget.Period[:1])+budget.Period[1:], formatKg(budget.ActualCO2Kg), formatKg(budget.CO2KgLimit))
+	case regression != nil:
+		status.State = StateFailure
+		status.Description = fmt.Sprintf("%s CO₂, %.0f%% above the recent average",
+			formatKg(regression.CO2Kg), regression.ChangePercent)
+	}
+	return status
+}
+
+// Publisher posts commit statuses with a token that has the repo:status scope on the
+// repositories. A publisher without a token is disabled.
+type Publisher struct {
+	client  *http.Client
+	apiURL  string
+	token   string
+	pending sync.WaitGroup
+}
+
+// NewPublisher creates a commit status publisher
+func NewPublisher(apiURL, token string) *Publisher {
+	return &Publisher{
+		client: &http.Client{Timeout: requestTimeout, Transport: tracing.Transport(nil)},
+		apiURL: strings.TrimRight(apiURL, "/"),
+		token:  token,
+	}
+}
+
+// Enabled reports whether the publisher has a token
+func (p *Publisher) Enabled() bool {
+	return p.token != ""
+}
+
+// Publish posts status for a commit of a repository ("owner/name") in the background;
+// failures are logged
+func (p *Publisher) Publish(fullName, sha string, status Status) {
+	if !p.Enabled() {
+		return
+	}
+
+	p.pending.Add(1)
+	go func() {
+		defer p.pending.Done()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := p.post(ctx, fullName, sha, status); err != nil {
+			log.Printf("Failed to publish commit status for %s@%s: %v", fullName, sha, err)
+		}
+	}()
+}
+
+// Wait blocks until all statuses started by Publish have been posted
+func (p *Publisher) Wait() {
+	p.pending.Wait()
+}
+
+// post creates the commit status through the GitHub API
+func (p *Publisher) post(ctx context.Context, fullName, sha string, status Status) error {
+	body, err := json.Marshal(status)
+	if err != nil {
+		return fmt.Errorf("failed to encode commit status: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/repos/%s/statuses/%s", p.apiURL, fullName, sha)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+p.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// formatKg formats a CO2 mass, switching to grams below one kilogram
+func formatKg(kg float64) string {
+	if kg < 1 {
+		return fmt.Sprintf("%.1f g", kg*1000)
+	}
+	return fmt.Sprintf("%.3f kg", kg)
+}
@@ -1,9 +1,13 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -12,6 +16,15 @@ type Config struct {
 	// Database
 	DatabaseURL string
 
+	// Secrets backend ("vault" or "aws"). Secrets with a reference ("path#key") are read from
+	// the backend instead of their plaintext setting and re-read every SecretsRefreshInterval.
+	// DatabaseCredentialsRef is the path of a secret with "username" and "password" keys.
+	SecretsBackend         string
+	SecretsRefreshInterval time.Duration
+	JWTSecretRef           string
+	GitHubClientSecretRef  string
+	DatabaseCredentialsRef string
+
 	// JWT Configuration
 	JWTSecret     string
 	JWTExpiration time.Duration
@@ -21,10 +34,29 @@ type Config struct {
 	GitHubClientSecret string
 	GitHubRedirectURL  string
 
+	// GitHub commit statuses (disabled when GitHubStatusToken is empty)
+	GitHubAPIURL      string
+	GitHubStatusToken string
+	// GitHubSyncToken reads repository metadata such as languages; public repositories are
+	// read without it
+	GitHubSyncToken string
+
 	// Server Configuration
+	Port        string
 	Environment string
 	LogLevel    string
 
+	// TLS termination: certificate files, or certificates obtained from Let's Encrypt for
+	// ACMEHosts. The server speaks plain HTTP when neither is set.
+	TLSCertFile  string
+	TLSKeyFile   string
+	ACMEHosts    []string
+	ACMEEmail    string
+	ACMECacheDir string
+	// Plain HTTP listener answering ACME HTTP-01 challenges and redirecting to HTTPS
+	// (disabled when empty)
+	ACMEHTTPAddr string
+
 	// Security
 	CookieDomain   string
 	CookieSecure   bool
@@ -33,47 +65,277 @@ type Config struct {
 	// Rate Limiting
 	RateLimitRPS   int
 	RateLimitBurst int
+	// Per-user and per-token limits of each plan, counted in Redis (disabled when RedisURL
+	// is empty)
+	RateLimitPlans       map[string]RatePlan
+	RateLimitDefaultPlan string
+	RateLimitWindow      time.Duration
+	// Repository, run and retention quotas of each plan; plans without quotas are unlimited
+	PlanQuotas map[string]PlanQuota
 
 	// CORS
 	AllowedOrigins []string
+
+	// Largest request body accepted by the ingest endpoints, in bytes, both as sent and after
+	// decoding a gzip or deflate Content-Encoding
+	MaxIngestBodyBytes int
+
+	// When the deprecated unversioned API paths are removed; zero when not scheduled
+	LegacyAPISunset time.Time
+
+	// Serve Swagger UI for the OpenAPI document at /swagger/index.html
+	SwaggerUI bool
+
+	// GitHub usernames granted the admin role when they sign in
+	AdminUsers []string
+
+	// How long deleted users, repositories and runs can be restored before they are purged
+	RestoreWindow time.Duration
+
+	// Public URL of the EcoCI web app, used for links in outgoing messages
+	AppURL string
+
+	// Allow webhooks to target loopback, private and link-local addresses, for receivers on
+	// the server's own network
+	WebhookPrivateTargets bool
+
+	// Public URL of the badge service, used for the badges shown on user profiles
+	BadgeURL string
+
+	// SMTP (email is disabled when SMTPHost is empty)
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	SMTPFrom     string
+
+	// OpenTelemetry tracing (disabled when TracingEndpoint is empty)
+	TracingEndpoint    string
+	TracingServiceName string
+	TracingSampleRatio float64
+
+	// Response cache (disabled when RedisURL is empty)
+	RedisURL            string
+	CacheTTLRepos       time.Duration
+	CacheTTLStats       time.Duration
+	CacheTTLLeaderboard time.Duration
+
+	// BigQuery export of runs and rollups (disabled when BigQueryProject is empty). Requests
+	// are authenticated with the service account key at BigQueryCredentialsFile, or with the
+	// service account of the instance when it is empty.
+	BigQueryProject         string
+	BigQueryDataset         string
+	BigQueryCredentialsFile string
+	BigQueryAPIURL          string
+
+	// Parquet archive of runs in an S3-compatible bucket (disabled when ArchiveBucket is
+	// empty). Credentials come from the standard AWS sources; ArchiveEndpoint selects a store
+	// other than Amazon S3, such as MinIO or Cloudflare R2.
+	ArchiveBucket   string
+	ArchivePrefix   string
+	ArchiveEndpoint string
+	ArchiveRegion   string
+
+	// Event bus ("kafka" or "nats", disabled when empty) that carbon events are published to.
+	// EventBusURL is the base URL of a Kafka REST proxy or a nats:// or tls:// server URL.
+	// Events are published to the topic or subject EventBusTopicPrefix followed by the event
+	// type; EventBusEvents selects the event types, all of them when empty. EventBusFormat is
+	// ecoci or a CloudEvents mode, as for webhooks; the binary mode needs NATS headers.
+	EventBus            string
+	EventBusURL         string
+	EventBusTopicPrefix string
+	EventBusEvents      []string
+	EventBusFormat      string
+
+	// Grid carbon intensity forecasts used to schedule runs: "static" for the average intensity
+	// of each cloud region, or "electricitymaps" for live forecasts from the Electricity Maps API
+	CarbonIntensityProvider string
+	ElectricityMapsAPIURL   string
+	ElectricityMapsToken    string
+
+	// Energy of transferring a GB over the network, which the network transfer of runs is
+	// converted to emissions with
+	NetworkKWhPerGB float64
+
+	// Energy of storing a TB of artifacts and caches for a month, and the carbon intensity in
+	// g CO2e/kWh it is converted to emissions at
+	StorageKWhPerTBMonth   float64
+	StorageCarbonIntensity float64
+}
+
+// RatePlan is the number of requests a user, and each of their tokens, may make per rate
+// limit window
+type RatePlan struct {
+	UserLimit  int `json:"user_limit"`
+	TokenLimit int `json:"token_limit"`
+}
+
+// PlanQuota is what the repositories of a user or organization on a plan may hold; zero
+// values are unlimited
+type PlanQuota struct {
+	MaxRepositories int `json:"max_repositories"`
+	MaxRunsPerMonth int `json:"max_runs_per_month"`
+	// RetentionDays is how far back runs are listed
+	RetentionDays int `json:"retention_days"`
 }
 
-// Load loads configuration from environment variables
-func Load() (*Config, error) {
+// Load loads configuration from the YAML or TOML file at path, or at CONFIG_FILE when path is
+// empty, with environment variables taking precedence over the file. Without a file only the
+// environment is read.
+func Load(path string) (*Config, error) {
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	src := &source{used: map[string]bool{}}
+	if path != "" {
+		values, err := readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		src.file = values
+	}
+
+	ratePlans, err := parseRatePlans(src.getOrDefault("RATE_LIMIT_PLANS", "free=600/300,pro=3000/1500,enterprise=12000/6000"))
+	if err != nil {
+		src.errs = append(src.errs, fmt.Errorf("invalid RATE_LIMIT_PLANS: %w", err))
+	}
+	planQuotas, err := parsePlanQuotas(src.getOrDefault("PLAN_QUOTAS", ""))
+	if err != nil {
+		src.errs = append(src.errs, fmt.Errorf("invalid PLAN_QUOTAS: %w", err))
+	}
+
 	cfg := &Config{
 		// Database
-		DatabaseURL: getEnvOrDefault("DATABASE_URL", "postgres://localhost/ecoci_auth?sslmode=disable"),
+		DatabaseURL: src.getOrDefault("DATABASE_URL", "postgres://localhost/ecoci_auth?sslmode=disable"),
+
+		// Secrets backend
+		SecretsBackend:         src.getOrDefault("SECRETS_BACKEND", ""),
+		SecretsRefreshInterval: src.getDurationOrDefault("SECRETS_REFRESH_INTERVAL", "5m"),
+		JWTSecretRef:           src.getOrDefault("JWT_SECRET_REF", ""),
+		GitHubClientSecretRef:  src.getOrDefault("GITHUB_CLIENT_SECRET_REF", ""),
+		DatabaseCredentialsRef: src.getOrDefault("DATABASE_CREDENTIALS_REF", ""),
 
 		// JWT
-		JWTSecret:     getEnvOrDefault("JWT_SECRET", ""),
-		JWTExpiration: getEnvDurationOrDefault("JWT_EXPIRATION", "24h"),
+		JWTSecret:     src.getOrDefault("JWT_SECRET", ""),
+		JWTExpiration: src.getDurationOrDefault("JWT_EXPIRATION", "24h"),
 
 		// GitHub OAuth
-		GitHubClientID:     getEnvOrDefault("GITHUB_CLIENT_ID", ""),
-		GitHubClientSecret: getEnvOrDefault("GITHUB_CLIENT_SECRET", ""),
-		GitHubRedirectURL:  getEnvOrDefault("GITHUB_REDIRECT_URL", "http://localhost:8080/auth/github/callback"),
+		GitHubClientID:     src.getOrDefault("GITHUB_CLIENT_ID", ""),
+		GitHubClientSecret: src.getOrDefault("GITHUB_CLIENT_SECRET", ""),
+		GitHubRedirectURL:  src.getOrDefault("GITHUB_REDIRECT_URL", "http://localhost:8080/auth/github/callback"),
+
+		// GitHub commit statuses
+		GitHubAPIURL:      src.getOrDefault("GITHUB_API_URL", "https://api.github.com"),
+		GitHubStatusToken: src.getOrDefault("GITHUB_STATUS_TOKEN", ""),
+		GitHubSyncToken:   src.getOrDefault("GITHUB_SYNC_TOKEN", ""),
 
 		// Server
-		Environment: getEnvOrDefault("ENVIRONMENT", "development"),
-		LogLevel:    getEnvOrDefault("LOG_LEVEL", "info"),
+		Port:        src.getOrDefault("PORT", "8080"),
+		Environment: src.getOrDefault("ENVIRONMENT", "development"),
+		LogLevel:    src.getOrDefault("LOG_LEVEL", "info"),
+
+		// TLS
+		TLSCertFile:  src.getOrDefault("TLS_CERT_FILE", ""),
+		TLSKeyFile:   src.getOrDefault("TLS_KEY_FILE", ""),
+		ACMEHosts:    src.getSliceOrDefault("ACME_HOSTS", nil),
+		ACMEEmail:    src.getOrDefault("ACME_EMAIL", ""),
+		ACMECacheDir: src.getOrDefault("ACME_CACHE_DIR", "acme-cache"),
+		ACMEHTTPAddr: src.getOrDefault("ACME_HTTP_ADDR", ":80"),
 
 		// Security
-		CookieDomain: getEnvOrDefault("COOKIE_DOMAIN", "localhost"),
-		CookieSecure: getEnvBoolOrDefault("COOKIE_SECURE", false),
-		TrustedProxies: getEnvSliceOrDefault("TRUSTED_PROXIES", []string{
+		CookieDomain: src.getOrDefault("COOKIE_DOMAIN", "localhost"),
+		CookieSecure: src.getBoolOrDefault("COOKIE_SECURE", false),
+		TrustedProxies: src.getSliceOrDefault("TRUSTED_PROXIES", []string{
 			"127.0.0.1",
 			"::1",
 		}),
 
 		// Rate Limiting
-		RateLimitRPS:   getEnvIntOrDefault("RATE_LIMIT_RPS", 100),
-		RateLimitBurst: getEnvIntOrDefault("RATE_LIMIT_BURST", 200),
+		RateLimitRPS:   src.getIntOrDefault("RATE_LIMIT_RPS", 100),
+		RateLimitBurst: src.getIntOrDefault("RATE_LIMIT_BURST", 200),
+
+		RateLimitPlans:       ratePlans,
+		RateLimitDefaultPlan: src.getOrDefault("RATE_LIMIT_DEFAULT_PLAN", "free"),
+		RateLimitWindow:      src.getDurationOrDefault("RATE_LIMIT_WINDOW", "1m"),
+		PlanQuotas:           planQuotas,
 
 		// CORS
-		AllowedOrigins: getEnvSliceOrDefault("ALLOWED_ORIGINS", []string{
+		AllowedOrigins: src.getSliceOrDefault("ALLOWED_ORIGINS", []string{
 			"http://localhost:3000",
 			"http://localhost:8080",
 		}),
+
+		MaxIngestBodyBytes: src.getIntOrDefault("MAX_INGEST_BODY_BYTES", 1<<20),
+
+		LegacyAPISunset: src.getDateOrDefault("LEGACY_API_SUNSET", time.Time{}),
+
+		SwaggerUI: src.getBoolOrDefault("SWAGGER_UI", false),
+
+		AdminUsers: src.getSliceOrDefault("ADMIN_USERS", nil),
+
+		RestoreWindow: src.getDurationOrDefault("RESTORE_WINDOW", "720h"),
+
+		AppURL: src.getOrDefault("APP_URL", "http://localhost:3000"),
+
+		WebhookPrivateTargets: src.getBoolOrDefault("WEBHOOK_PRIVATE_TARGETS", false),
+
+		BadgeURL: src.getOrDefault("BADGE_URL", "https://badge.ecoci.dev"),
+
+		// SMTP
+		SMTPHost:     src.getOrDefault("SMTP_HOST", ""),
+		SMTPPort:     src.getIntOrDefault("SMTP_PORT", 587),
+		SMTPUsername: src.getOrDefault("SMTP_USERNAME", ""),
+		SMTPPassword: src.getOrDefault("SMTP_PASSWORD", ""),
+		SMTPFrom:     src.getOrDefault("SMTP_FROM", "EcoCI <noreply@ecoci.dev>"),
+
+		// Tracing
+		TracingEndpoint:    src.getOrDefault("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+		TracingServiceName: src.getOrDefault("OTEL_SERVICE_NAME", "ecoci-auth-api"),
+		TracingSampleRatio: src.getFloatOrDefault("TRACING_SAMPLE_RATIO", 1),
+
+		// Response cache
+		RedisURL:            src.getOrDefault("REDIS_URL", ""),
+		CacheTTLRepos:       src.getDurationOrDefault("CACHE_TTL_REPOS", "1m"),
+		CacheTTLStats:       src.getDurationOrDefault("CACHE_TTL_STATS", "5m"),
+		CacheTTLLeaderboard: src.getDurationOrDefault("CACHE_TTL_LEADERBOARD", "10m"),
+
+		// BigQuery export
+		BigQueryProject:         src.getOrDefault("BIGQUERY_PROJECT", ""),
+		BigQueryDataset:         src.getOrDefault("BIGQUERY_DATASET", ""),
+		BigQueryCredentialsFile: src.getOrDefault("BIGQUERY_CREDENTIALS_FILE", ""),
+		BigQueryAPIURL:          src.getOrDefault("BIGQUERY_API_URL", "https://bigquery.googleapis.com/bigquery/v2"),
+
+		// Parquet archive
+		ArchiveBucket:   src.getOrDefault("ARCHIVE_S3_BUCKET", ""),
+		ArchivePrefix:   strings.Trim(src.getOrDefault("ARCHIVE_S3_PREFIX", "ecoci"), "/"),
+		ArchiveEndpoint: src.getOrDefault("ARCHIVE_S3_ENDPOINT", ""),
+		ArchiveRegion:   src.getOrDefault("ARCHIVE_S3_REGION", ""),
+
+		// Event bus
+		EventBus:            src.getOrDefault("EVENT_BUS", ""),
+		EventBusURL:         src.getOrDefault("EVENT_BUS_URL", ""),
+		EventBusTopicPrefix: src.getOrDefault("EVENT_BUS_TOPIC_PREFIX", "ecoci."),
+		EventBusEvents:      src.getSliceOrDefault("EVENT_BUS_EVENTS", nil),
+		EventBusFormat:      src.getOrDefault("EVENT_BUS_FORMAT", "ecoci"),
+
+		// Carbon intensity
+		CarbonIntensityProvider: src.getOrDefault("CARBON_INTENSITY_PROVIDER", "static"),
+		ElectricityMapsAPIURL:   src.getOrDefault("ELECTRICITY_MAPS_API_URL", "https://api.electricitymap.org/v3"),
+		ElectricityMapsToken:    src.getOrDefault("ELECTRICITY_MAPS_TOKEN", ""),
+
+		// Network transfer
+		NetworkKWhPerGB: src.getFloatOrDefault("NETWORK_KWH_PER_GB", 0.001),
+
+		// Storage
+		StorageKWhPerTBMonth:   src.getFloatOrDefault("STORAGE_KWH_PER_TB_MONTH", 1.42),
+		StorageCarbonIntensity: src.getFloatOrDefault("STORAGE_CARBON_INTENSITY", 400),
+	}
+
+	if path != "" {
+		src.rejectUnknown(path)
+	}
+	if err := errors.Join(src.errs...); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
 	}
 
 	// Validate required configuration
@@ -84,25 +346,108 @@ func Load() (*Config, error) {
 	return cfg, nil
 }
 
-// validate ensures all required configuration is present
+// validate checks every setting and reports all problems at once
 func (c *Config) validate() error {
-	if c.JWTSecret == "" {
-		return fmt.Errorf("JWT_SECRET is required")
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
 	}
 
-	if c.GitHubClientID == "" {
-		return fmt.Errorf("GITHUB_CLIENT_ID is required")
+	check(c.JWTSecret != "" || c.JWTSecretRef != "", "JWT_SECRET or JWT_SECRET_REF is required")
+	check(c.GitHubClientID != "", "GITHUB_CLIENT_ID is required")
+	check(c.GitHubClientSecret != "" || c.GitHubClientSecretRef != "", "GITHUB_CLIENT_SECRET or GITHUB_CLIENT_SECRET_REF is required")
+	check(c.DatabaseURL != "", "DATABASE_URL is required")
+
+	check(oneOf(c.SecretsBackend, "", "vault", "aws"), "SECRETS_BACKEND must be vault or aws")
+	usesSecrets := c.JWTSecretRef != "" || c.GitHubClientSecretRef != "" || c.DatabaseCredentialsRef != ""
+	check(!usesSecrets || c.SecretsBackend != "", "SECRETS_BACKEND is required for secret references")
+	check(c.SecretsBackend == "" || c.SecretsRefreshInterval > 0, "SECRETS_REFRESH_INTERVAL must be positive")
+
+	port, err := strconv.Atoi(c.Port)
+	check(err == nil && port > 0 && port <= 65535, "PORT must be a port number")
+	check(oneOf(c.Environment, "development", "test", "staging", "production"), "ENVIRONMENT must be development, test, staging or production")
+	check(oneOf(c.LogLevel, "debug", "info", "warn", "error"), "LOG_LEVEL must be debug, info, warn or error")
+
+	for key, value := range map[string]string{
+		"APP_URL":             c.AppURL,
+		"BADGE_URL":           c.BadgeURL,
+		"GITHUB_REDIRECT_URL": c.GitHubRedirectURL,
+		"GITHUB_API_URL":      c.GitHubAPIURL,
+	} {
+		check(isHTTPURL(value), "%s must be an http(s) URL", key)
 	}
+	check(c.TracingEndpoint == "" || isHTTPURL(c.TracingEndpoint), "OTEL_EXPORTER_OTLP_ENDPOINT must be an http(s) URL")
 
-	if c.GitHubClientSecret == "" {
-		return fmt.Errorf("GITHUB_CLIENT_SECRET is required")
+	for key, value := range map[string]time.Duration{
+		"JWT_EXPIRATION":        c.JWTExpiration,
+		"RATE_LIMIT_WINDOW":     c.RateLimitWindow,
+		"RESTORE_WINDOW":        c.RestoreWindow,
+		"CACHE_TTL_REPOS":       c.CacheTTLRepos,
+		"CACHE_TTL_STATS":       c.CacheTTLStats,
+		"CACHE_TTL_LEADERBOARD": c.CacheTTLLeaderboard,
+	} {
+		check(value > 0, "%s must be positive", key)
 	}
 
-	if c.DatabaseURL == "" {
-		return fmt.Errorf("DATABASE_URL is required")
+	check(c.RateLimitRPS > 0, "RATE_LIMIT_RPS must be positive")
+	check(c.RateLimitBurst > 0, "RATE_LIMIT_BURST must be positive")
+	check(c.MaxIngestBodyBytes > 0, "MAX_INGEST_BODY_BYTES must be positive")
+	_, ok := c.RateLimitPlans[c.RateLimitDefaultPlan]
+	check(ok, "RATE_LIMIT_DEFAULT_PLAN %q is not defined in RATE_LIMIT_PLANS", c.RateLimitDefaultPlan)
+	for name := range c.PlanQuotas {
+		_, ok := c.RateLimitPlans[name]
+		check(ok, "PLAN_QUOTAS plan %q is not defined in RATE_LIMIT_PLANS", name)
+	}
+
+	check((c.TLSCertFile == "") == (c.TLSKeyFile == ""), "TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	check(c.TLSCertFile == "" || len(c.ACMEHosts) == 0, "TLS_CERT_FILE and ACME_HOSTS cannot both be set")
+	check(len(c.ACMEHosts) == 0 || c.ACMECacheDir != "", "ACME_CACHE_DIR is required when ACME_HOSTS is set")
+
+	check(c.SMTPHost == "" || c.SMTPFrom != "", "SMTP_FROM is required when SMTP_HOST is set")
+	check(c.SMTPHost == "" || (c.SMTPPort > 0 && c.SMTPPort <= 65535), "SMTP_PORT must be a port number")
+
+	check(c.TracingSampleRatio >= 0 && c.TracingSampleRatio <= 1, "TRACING_SAMPLE_RATIO must be between 0 and 1")
+
+	check(c.BigQueryProject == "" || c.BigQueryDataset != "", "BIGQUERY_DATASET is required when BIGQUERY_PROJECT is set")
+	check(c.BigQueryProject == "" || isHTTPURL(c.BigQueryAPIURL), "BIGQUERY_API_URL must be an http(s) URL")
+
+	check(c.ArchiveEndpoint == "" || isHTTPURL(c.ArchiveEndpoint), "ARCHIVE_S3_ENDPOINT must be an http(s) URL")
+
+	check(oneOf(c.EventBus, "", "kafka", "nats"), "EVENT_BUS must be kafka or nats")
+	check(c.EventBus == "" || c.EventBusURL != "", "EVENT_BUS_URL is required when EVENT_BUS is set")
+	check(oneOf(c.EventBusFormat, "ecoci", "cloudevents-structured", "cloudevents-binary"), "EVENT_BUS_FORMAT must be ecoci, cloudevents-structured or cloudevents-binary")
+	check(c.EventBus != "kafka" || c.EventBusFormat != "cloudevents-binary", "EVENT_BUS_FORMAT cloudevents-binary requires EVENT_BUS nats")
+
+	check(oneOf(c.CarbonIntensityProvider, "static", "electricitymaps"), "CARBON_INTENSITY_PROVIDER must be static or electricitymaps")
+	usesElectricityMaps := c.CarbonIntensityProvider == "electricitymaps"
+	check(!usesElectricityMaps || c.ElectricityMapsToken != "", "ELECTRICITY_MAPS_TOKEN is required when CARBON_INTENSITY_PROVIDER is electricitymaps")
+	check(!usesElectricityMaps || isHTTPURL(c.ElectricityMapsAPIURL), "ELECTRICITY_MAPS_API_URL must be an http(s) URL")
+
+	check(c.NetworkKWhPerGB >= 0, "NETWORK_KWH_PER_GB must not be negative")
+	check(c.StorageKWhPerTBMonth >= 0, "STORAGE_KWH_PER_TB_MONTH must not be negative")
+	check(c.StorageCarbonIntensity >= 0, "STORAGE_CARBON_INTENSITY must not be negative")
+
+	// Map iteration is random; report problems in a stable order
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errors.Join(errs...)
+}
+
+// oneOf returns true if value is one of allowed
+func oneOf(value string, allowed ...string) bool {
+	for _, candidate := range allowed {
+		if value == candidate {
+			return true
+		}
 	}
+	return false
+}
 
-	return nil
+// isHTTPURL returns true if value is an absolute http or https URL
+func isHTTPURL(value string) bool {
+	parsed, err := url.Parse(value)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
 }
 
 // IsProduction returns true if running in production environment
@@ -115,53 +460,357 @@ func (c *Config) IsDevelopment() bool {
 	return c.Environment == "development"
 }
 
-// getEnvOrDefault returns environment variable value or default
-func getEnvOrDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+// TLSEnabled returns true if the server terminates TLS itself
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" || len(c.ACMEHosts) > 0
+}
+
+// PlanName returns the plan that applies to a user or organization assigned the named plan:
+// the default plan for those without a plan or with a plan that is no longer configured
+func (c *Config) PlanName(name string) string {
+	if _, ok := c.RateLimitPlans[name]; ok {
+		return name
 	}
-	return defaultValue
+	return c.RateLimitDefaultPlan
 }
 
-// getEnvIntOrDefault returns environment variable as int or default
-func getEnvIntOrDefault(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
+// RatePlan returns the rate limits of the named plan, falling back to the default plan
+func (c *Config) RatePlan(name string) RatePlan {
+	return c.RateLimitPlans[c.PlanName(name)]
+}
+
+// PlanQuota returns the quotas of the named plan, falling back to the default plan
+func (c *Config) PlanQuota(name string) PlanQuota {
+	return c.PlanQuotas[c.PlanName(name)]
+}
+
+// IsAdminUser returns true if the GitHub username is configured in ADMIN_USERS
+func (c *Config) IsAdminUser(githubUsername string) bool {
+	for _, username := range c.AdminUsers {
+		if strings.EqualFold(username, githubUsername) {
+			return true
 		}
 	}
-	return defaultValue
+	return false
 }
 
-// getEnvBoolOrDefault returns environment variable as bool or default
-func getEnvBoolOrDefault(key string, defaultValue bool) bool {
+// redactedValue replaces secrets in Redacted
+const redactedValue = "[redacted]"
+
+// Redacted returns the configuration keyed by environment variable, with secrets replaced
+// by "[redacted]" when set and passwords removed from URLs, for inspection by administrators
+func (c *Config) Redacted() map[string]interface{} {
+	secret := func(value string) string {
+		if value == "" {
+			return ""
+		}
+		return redactedValue
+	}
+	redactURL := func(value string) string {
+		parsed, err := url.Parse(value)
+		if err != nil {
+			return secret(value)
+		}
+		return parsed.Redacted()
+	}
+	// NATS URLs carry a token as their username
+	redactToken := func(value string) string {
+		parsed, err := url.Parse(value)
+		if err != nil {
+			return secret(value)
+		}
+		if parsed.User != nil {
+			if _, ok := parsed.User.Password(); !ok {
+				parsed.User = url.User("xxxxx")
+			}
+		}
+		return parsed.Redacted()
+	}
+
+	return map[string]interface{}{
+		"DATABASE_URL":                redactURL(c.DatabaseURL),
+		"SECRETS_BACKEND":             c.SecretsBackend,
+		"SECRETS_REFRESH_INTERVAL":    c.SecretsRefreshInterval.String(),
+		"JWT_SECRET_REF":              c.JWTSecretRef,
+		"GITHUB_CLIENT_SECRET_REF":    c.GitHubClientSecretRef,
+		"DATABASE_CREDENTIALS_REF":    c.DatabaseCredentialsRef,
+		"JWT_SECRET":                  secret(c.JWTSecret),
+		"JWT_EXPIRATION":              c.JWTExpiration.String(),
+		"GITHUB_CLIENT_ID":            c.GitHubClientID,
+		"GITHUB_CLIENT_SECRET":        secret(c.GitHubClientSecret),
+		"GITHUB_REDIRECT_URL":         c.GitHubRedirectURL,
+		"GITHUB_API_URL":              c.GitHubAPIURL,
+		"GITHUB_STATUS_TOKEN":         secret(c.GitHubStatusToken),
+		"GITHUB_SYNC_TOKEN":           secret(c.GitHubSyncToken),
+		"PORT":                        c.Port,
+		"ENVIRONMENT":                 c.Environment,
+		"LOG_LEVEL":                   c.LogLevel,
+		"TLS_CERT_FILE":               c.TLSCertFile,
+		"TLS_KEY_FILE":                c.TLSKeyFile,
+		"ACME_HOSTS":                  c.ACMEHosts,
+		"ACME_EMAIL":                  c.ACMEEmail,
+		"ACME_CACHE_DIR":              c.ACMECacheDir,
+		"ACME_HTTP_ADDR":              c.ACMEHTTPAddr,
+		"COOKIE_DOMAIN":               c.CookieDomain,
+		"COOKIE_SECURE":               c.CookieSecure,
+		"TRUSTED_PROXIES":             c.TrustedProxies,
+		"RATE_LIMIT_RPS":              c.RateLimitRPS,
+		"RATE_LIMIT_BURST":            c.RateLimitBurst,
+		"RATE_LIMIT_PLANS":            c.RateLimitPlans,
+		"RATE_LIMIT_DEFAULT_PLAN":     c.RateLimitDefaultPlan,
+		"RATE_LIMIT_WINDOW":           c.RateLimitWindow.String(),
+		"PLAN_QUOTAS":                 c.PlanQuotas,
+		"ALLOWED_ORIGINS":             c.AllowedOrigins,
+		"MAX_INGEST_BODY_BYTES":       c.MaxIngestBodyBytes,
+		"LEGACY_API_SUNSET":           formatDate(c.LegacyAPISunset),
+		"SWAGGER_UI":                  c.SwaggerUI,
+		"ADMIN_USERS":                 c.AdminUsers,
+		"RESTORE_WINDOW":              c.RestoreWindow.String(),
+		"APP_URL":                     c.AppURL,
+		"WEBHOOK_PRIVATE_TARGETS":     c.WebhookPrivateTargets,
+		"BADGE_URL":                   c.BadgeURL,
+		"SMTP_HOST":                   c.SMTPHost,
+		"SMTP_PORT":                   c.SMTPPort,
+		"SMTP_USERNAME":               c.SMTPUsername,
+		"SMTP_PASSWORD":               secret(c.SMTPPassword),
+		"SMTP_FROM":                   c.SMTPFrom,
+		"OTEL_EXPORTER_OTLP_ENDPOINT": redactURL(c.TracingEndpoint),
+		"OTEL_SERVICE_NAME":           c.TracingServiceName,
+		"TRACING_SAMPLE_RATIO":        c.TracingSampleRatio,
+		"REDIS_URL":                   redactURL(c.RedisURL),
+		"CACHE_TTL_REPOS":             c.CacheTTLRepos.String(),
+		"CACHE_TTL_STATS":             c.CacheTTLStats.String(),
+		"CACHE_TTL_LEADERBOARD":       c.CacheTTLLeaderboard.String(),
+		"BIGQUERY_PROJECT":            c.BigQueryProject,
+		"BIGQUERY_DATASET":            c.BigQueryDataset,
+		"BIGQUERY_CREDENTIALS_FILE":   c.BigQueryCredentialsFile,
+		"BIGQUERY_API_URL":            c.BigQueryAPIURL,
+		"ARCHIVE_S3_BUCKET":           c.ArchiveBucket,
+		"ARCHIVE_S3_PREFIX":           c.ArchivePrefix,
+		"ARCHIVE_S3_ENDPOINT":         c.ArchiveEndpoint,
+		"ARCHIVE_S3_REGION":           c.ArchiveRegion,
+		"EVENT_BUS":                   c.EventBus,
+		"EVENT_BUS_URL":               redactToken(c.EventBusURL),
+		"EVENT_BUS_TOPIC_PREFIX":      c.EventBusTopicPrefix,
+		"EVENT_BUS_EVENTS":            c.EventBusEvents,
+		"EVENT_BUS_FORMAT":            c.EventBusFormat,
+		"CARBON_INTENSITY_PROVIDER":   c.CarbonIntensityProvider,
+		"ELECTRICITY_MAPS_API_URL":    c.ElectricityMapsAPIURL,
+		"ELECTRICITY_MAPS_TOKEN":      secret(c.ElectricityMapsToken),
+		"NETWORK_KWH_PER_GB":          c.NetworkKWhPerGB,
+		"STORAGE_KWH_PER_TB_MONTH":    c.StorageKWhPerTBMonth,
+		"STORAGE_CARBON_INTENSITY":    c.StorageCarbonIntensity,
+	}
+}
+
+// source looks settings up in the environment first and the configuration file second. It
+// records which settings were read, to reject unknown keys of the file, and collects the
+// values that cannot be parsed instead of silently falling back to defaults.
+type source struct {
+	file map[string]string
+	used map[string]bool
+	errs []error
+}
+
+// lookup returns the value of key, or false when it is unset or empty
+func (s *source) lookup(key string) (string, bool) {
+	s.used[key] = true
 	if value := os.Getenv(key); value != "" {
-		if boolValue, err := strconv.ParseBool(value); err == nil {
-			return boolValue
+		return value, true
+	}
+	if value := s.file[key]; value != "" {
+		return value, true
+	}
+	return "", false
+}
+
+// invalid records a value of key that cannot be parsed
+func (s *source) invalid(key, value, kind string) {
+	s.errs = append(s.errs, fmt.Errorf("%s: %q is not a valid %s", key, value, kind))
+}
+
+// rejectUnknown records the keys of the configuration file that are not settings
+func (s *source) rejectUnknown(path string) {
+	var unknown []string
+	for key := range s.file {
+		if !s.used[key] {
+			unknown = append(unknown, strings.ToLower(key))
 		}
 	}
+	sort.Strings(unknown)
+	for _, key := range unknown {
+		s.errs = append(s.errs, fmt.Errorf("%s: unknown setting %s", path, key))
+	}
+}
+
+// getOrDefault returns the value of key or default
+func (s *source) getOrDefault(key, defaultValue string) string {
+	if value, ok := s.lookup(key); ok {
+		return value
+	}
 	return defaultValue
 }
 
-// getEnvDurationOrDefault returns environment variable as duration or default
-func getEnvDurationOrDefault(key, defaultValue string) time.Duration {
-	value := getEnvOrDefault(key, defaultValue)
-	if duration, err := time.ParseDuration(value); err == nil {
-		return duration
+// getIntOrDefault returns the value of key as int or default
+func (s *source) getIntOrDefault(key string, defaultValue int) int {
+	value, ok := s.lookup(key)
+	if !ok {
+		return defaultValue
 	}
-	// Fallback to default if parsing fails
-	if duration, err := time.ParseDuration(defaultValue); err == nil {
-		return duration
+	intValue, err := strconv.Atoi(value)
+	if err != nil {
+		s.invalid(key, value, "integer")
+		return defaultValue
 	}
-	return 24 * time.Hour // Ultimate fallback
+	return intValue
 }
 
-// getEnvSliceOrDefault returns environment variable as slice or default
-func getEnvSliceOrDefault(key string, defaultValue []string) []string {
-	if value := os.Getenv(key); value != "" {
-		// Simple comma-separated parsing
-		// In production, might want more sophisticated parsing
-		return []string{value}
+// getFloatOrDefault returns the value of key as float or default
+func (s *source) getFloatOrDefault(key string, defaultValue float64) float64 {
+	value, ok := s.lookup(key)
+	if !ok {
+		return defaultValue
 	}
-	return defaultValue
-}
\ No newline at end of file
+	floatValue, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		s.invalid(key, value, "number")
+		return defaultValue
+	}
+	return floatValue
+}
+
+// getBoolOrDefault returns the value of key as bool or default
+func (s *source) getBoolOrDefault(key string, defaultValue bool) bool {
+	value, ok := s.lookup(key)
+	if !ok {
+		return defaultValue
+	}
+	boolValue, err := strconv.ParseBool(value)
+	if err != nil {
+		s.invalid(key, value, "boolean")
+		return defaultValue
+	}
+	return boolValue
+}
+
+// getDurationOrDefault returns the value of key as duration or default
+func (s *source) getDurationOrDefault(key, defaultValue string) time.Duration {
+	value := s.getOrDefault(key, defaultValue)
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		s.invalid(key, value, "duration")
+		duration, _ = time.ParseDuration(defaultValue)
+	}
+	return duration
+}
+
+// getDateOrDefault returns the value of key, a date (2006-01-02) or RFC 3339 time, or default
+func (s *source) getDateOrDefault(key string, defaultValue time.Time) time.Time {
+	value, ok := s.lookup(key)
+	if !ok {
+		return defaultValue
+	}
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		return date
+	}
+	date, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		s.invalid(key, value, "date")
+		return defaultValue
+	}
+	return date
+}
+
+// formatDate writes a time in a format read by getDateOrDefault, or empty for the zero time
+func formatDate(value time.Time) string {
+	if value.IsZero() {
+		return ""
+	}
+	return value.Format(time.RFC3339)
+}
+
+// getSliceOrDefault returns the value of key as slice or default
+func (s *source) getSliceOrDefault(key string, defaultValue []string) []string {
+	value, ok := s.lookup(key)
+	if !ok {
+		return defaultValue
+	}
+	// Comma-separated, ignoring blanks around and between items
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseRatePlans parses plans written as "name=user_limit/token_limit" separated by commas,
+// such as "free=600/300,pro=3000/1500". A plan without a token limit ("free=600") limits each
+// token like the user.
+func parseRatePlans(value string) (map[string]RatePlan, error) {
+	plans := map[string]RatePlan{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, limits, found := strings.Cut(item, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return nil, fmt.Errorf("expected name=user_limit/token_limit, got %q", item)
+		}
+		userLimit, tokenLimit, hasTokenLimit := strings.Cut(limits, "/")
+		if !hasTokenLimit {
+			tokenLimit = userLimit
+		}
+		var plan RatePlan
+		var err error
+		if plan.UserLimit, err = strconv.Atoi(strings.TrimSpace(userLimit)); err != nil || plan.UserLimit <= 0 {
+			return nil, fmt.Errorf("invalid user limit of plan %s", name)
+		}
+		if plan.TokenLimit, err = strconv.Atoi(strings.TrimSpace(tokenLimit)); err != nil || plan.TokenLimit <= 0 {
+			return nil, fmt.Errorf("invalid token limit of plan %s", name)
+		}
+		plans[name] = plan
+	}
+	if len(plans) == 0 {
+		return nil, fmt.Errorf("at least one plan is required")
+	}
+	return plans, nil
+}
+
+// parsePlanQuotas parses quotas written as "name=max_repositories/max_runs_per_month/retention_days"
+// separated by commas, such as "free=3/1000/90,pro=50/50000/730". Zero or a missing value is
+// unlimited.
+func parsePlanQuotas(value string) (map[string]PlanQuota, error) {
+	quotas := map[string]PlanQuota{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, limits, found := strings.Cut(item, "=")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return nil, fmt.Errorf("expected name=max_repositories/max_runs_per_month/retention_days, got %q", item)
+		}
+		parts := strings.Split(limits, "/")
+		if len(parts) > 3 {
+			return nil, fmt.Errorf("too many quotas for plan %s", name)
+		}
+		values := make([]int, 3)
+		for i, part := range parts {
+			if part = strings.TrimSpace(part); part == "" {
+				continue
+			}
+			n, err := strconv.Atoi(part)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid quota %q of plan %s", part, name)
+			}
+			values[i] = n
+		}
+		quotas[name] = PlanQuota{MaxRepositories: values[0], MaxRunsPerMonth: values[1], RetentionDays: values[2]}
+	}
+	return quotas, nil
+}
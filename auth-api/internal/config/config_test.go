@@ -0,0 +1,186 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeConfigFile writes content to a file named name in a temporary directory
+func writeConfigFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+// requiredSettings are the settings without defaults, as YAML
+const requiredSettings = `
+jwt_secret: file-secret
+github_client_id: client-id
+github_client_secret: client-secret
+`
+
+func TestLoadFromFile(t *testing.T) {
+	t.Run("YAML with sections and lists", func(t *testing.T) {
+		path := writeConfigFile(t, "ecoci.yaml", requiredSettings+`
+port: 9090
+allowed_origins:
+  - https://ecoci.dev
+  - https://app.ecoci.dev
+rate_limit:
+  plans: free=10/5,team=100/50
+  default_plan: team
+plan_quotas: team=10/500,free=1/100/30
+smtp:
+  host: mail.example.com
+  port: 2525
+cache_ttl_stats: 30s
+legacy_api_sunset: 2025-06-30
+`)
+		cfg, err := Load(path)
+		require.NoError(t, err)
+
+		assert.Equal(t, "file-secret", cfg.JWTSecret)
+		assert.Equal(t, "9090", cfg.Port)
+		assert.Equal(t, []string{"https://ecoci.dev", "https://app.ecoci.dev"}, cfg.AllowedOrigins)
+		assert.Equal(t, RatePlan{UserLimit: 100, TokenLimit: 50}, cfg.RatePlan("team"))
+		assert.Equal(t, PlanQuota{MaxRepositories: 10, MaxRunsPerMonth: 500}, cfg.PlanQuota("team"))
+		assert.Equal(t, PlanQuota{MaxRepositories: 1, MaxRunsPerMonth: 100, RetentionDays: 30}, cfg.PlanQuota("free"))
+		// Unknown plans fall back to the default plan
+		assert.Equal(t, "team", cfg.PlanName("retired"))
+		assert.Equal(t, cfg.PlanQuota("team"), cfg.PlanQuota("retired"))
+		assert.Equal(t, "mail.example.com", cfg.SMTPHost)
+		assert.Equal(t, 2525, cfg.SMTPPort)
+		assert.Equal(t, 30*time.Second, cfg.CacheTTLStats)
+		assert.Equal(t, time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC), cfg.LegacyAPISunset)
+		// Unset settings keep their defaults
+		assert.Equal(t, "development", cfg.Environment)
+	})
+
+	t.Run("TOML", func(t *testing.T) {
+		path := writeConfigFile(t, "ecoci.toml", `
+jwt_secret = "file-secret"
+github_client_id = "client-id"
+github_client_secret = "client-secret"
+trusted_proxies = ["10.0.0.1"]
+
+[tracing]
+sample_ratio = 0.25
+`)
+		cfg, err := Load(path)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"10.0.0.1"}, cfg.TrustedProxies)
+		assert.Equal(t, 0.25, cfg.TracingSampleRatio)
+	})
+
+	t.Run("environment overrides the file", func(t *testing.T) {
+		path := writeConfigFile(t, "ecoci.yml", requiredSettings+"log_level: debug\n")
+		t.Setenv("JWT_SECRET", "env-secret")
+		t.Setenv("CONFIG_FILE", path)
+
+		cfg, err := Load("")
+		require.NoError(t, err)
+		assert.Equal(t, "env-secret", cfg.JWTSecret)
+		assert.Equal(t, "debug", cfg.LogLevel)
+	})
+
+	t.Run("unknown settings are rejected", func(t *testing.T) {
+		path := writeConfigFile(t, "ecoci.yaml", requiredSettings+"jwt_expiry: 1h\n")
+		_, err := Load(path)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unknown setting jwt_expiry")
+	})
+
+	t.Run("unsupported format", func(t *testing.T) {
+		_, err := Load(writeConfigFile(t, "ecoci.json", "{}"))
+		assert.Error(t, err)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := Load(filepath.Join(t.TempDir(), "missing.yaml"))
+		assert.Error(t, err)
+	})
+}
+
+func TestValidation(t *testing.T) {
+	t.Run("unparsable values are reported", func(t *testing.T) {
+		path := writeConfigFile(t, "ecoci.yaml", requiredSettings)
+		t.Setenv("RATE_LIMIT_RPS", "fast")
+		t.Setenv("CACHE_TTL_REPOS", "forever")
+		t.Setenv("LEGACY_API_SUNSET", "soon")
+
+		_, err := Load(path)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `RATE_LIMIT_RPS: "fast" is not a valid integer`)
+		assert.Contains(t, err.Error(), `CACHE_TTL_REPOS: "forever" is not a valid duration`)
+		assert.Contains(t, err.Error(), `LEGACY_API_SUNSET: "soon" is not a valid date`)
+	})
+
+	t.Run("every problem is reported at once", func(t *testing.T) {
+		path := writeConfigFile(t, "ecoci.yaml", `
+environment: prod
+app_url: ecoci.dev
+rate_limit_burst: 0
+max_ingest_body_bytes: 0
+tls_cert_file: cert.pem
+plan_quotas: startup=5/1000
+bigquery_project: ecoci-analytics
+archive_s3_endpoint: minio:9000
+event_bus: rabbitmq
+event_bus_format: avro
+carbon_intensity_provider: electricitymaps
+network_kwh_per_gb: -0.5
+storage_kwh_per_tb_month: -1
+storage_carbon_intensity: -400
+`)
+		_, err := Load(path)
+		require.Error(t, err)
+		for _, problem := range []string{
+			"JWT_SECRET or JWT_SECRET_REF is required",
+			"ENVIRONMENT must be",
+			"APP_URL must be an http(s) URL",
+			"RATE_LIMIT_BURST must be positive",
+			"MAX_INGEST_BODY_BYTES must be positive",
+			"TLS_CERT_FILE and TLS_KEY_FILE must be set together",
+			`PLAN_QUOTAS plan "startup" is not defined in RATE_LIMIT_PLANS`,
+			"BIGQUERY_DATASET is required when BIGQUERY_PROJECT is set",
+			"ARCHIVE_S3_ENDPOINT must be an http(s) URL",
+			"EVENT_BUS must be kafka or nats",
+			"EVENT_BUS_FORMAT must be ecoci, cloudevents-structured or cloudevents-binary",
+			"ELECTRICITY_MAPS_TOKEN is required when CARBON_INTENSITY_PROVIDER is electricitymaps",
+			"NETWORK_KWH_PER_GB must not be negative",
+			"STORAGE_KWH_PER_TB_MONTH must not be negative",
+			"STORAGE_CARBON_INTENSITY must not be negative",
+		} {
+			assert.Contains(t, err.Error(), problem)
+		}
+	})
+}
+
+func TestWriteYAML(t *testing.T) {
+	path := writeConfigFile(t, "ecoci.yaml", requiredSettings+`
+allowed_origins: [https://ecoci.dev]
+rate_limit_plans: free=10/5
+plan_quotas: free=3/1000/90
+`)
+	cfg, err := Load(path)
+	require.NoError(t, err)
+
+	var printed bytes.Buffer
+	require.NoError(t, cfg.WriteYAML(&printed))
+	assert.Contains(t, printed.String(), "jwt_secret: '[redacted]'")
+	assert.Contains(t, printed.String(), "rate_limit_plans: free=10/5")
+
+	// The printed configuration can be loaded again
+	reloaded, err := Load(writeConfigFile(t, "printed.yaml", printed.String()))
+	require.NoError(t, err)
+	assert.Equal(t, cfg.AllowedOrigins, reloaded.AllowedOrigins)
+	assert.Equal(t, cfg.RateLimitPlans, reloaded.RateLimitPlans)
+	assert.Equal(t, cfg.PlanQuotas, reloaded.PlanQuotas)
+	assert.Equal(t, cfg.CacheTTLLeaderboard, reloaded.CacheTTLLeaderboard)
+}
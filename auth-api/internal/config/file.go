@@ -0,0 +1,139 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// readFile reads a YAML (.yaml, .yml) or TOML (.toml) configuration file into settings keyed
+// like the environment variables. Keys are case-insensitive and nested tables are joined with
+// underscores, so "smtp: {host: mail}" sets SMTP_HOST. Lists become comma-separated values.
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration file: %w", err)
+	}
+
+	document := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &document)
+	case ".toml":
+		err = toml.Unmarshal(data, &document)
+	default:
+		return nil, fmt.Errorf("configuration file %s must be .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse configuration file %s: %w", path, err)
+	}
+
+	values := map[string]string{}
+	if err := flatten("", document, values); err != nil {
+		return nil, fmt.Errorf("invalid configuration file %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// flatten stores value under key in values, descending into tables
+func flatten(key string, value interface{}, values map[string]string) error {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for name, nested := range value {
+			nestedKey := strings.ToUpper(name)
+			if key != "" {
+				nestedKey = key + "_" + nestedKey
+			}
+			if err := flatten(nestedKey, nested, values); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		items := make([]string, 0, len(value))
+		for _, item := range value {
+			switch item.(type) {
+			case map[string]interface{}, []interface{}:
+				return fmt.Errorf("%s: list items must be plain values", strings.ToLower(key))
+			}
+			items = append(items, fmt.Sprint(item))
+		}
+		values[key] = strings.Join(items, ",")
+	case time.Time:
+		// YAML reads unquoted dates and timestamps as times
+		values[key] = value.Format(time.RFC3339)
+	case nil:
+		values[key] = ""
+	default:
+		values[key] = fmt.Sprint(value)
+	}
+	return nil
+}
+
+// WriteYAML writes the redacted configuration as a YAML configuration file, as accepted by
+// Load, for --print-config
+func (c *Config) WriteYAML(w io.Writer) error {
+	settings := c.Redacted()
+	settings["RATE_LIMIT_PLANS"] = formatRatePlans(c.RateLimitPlans)
+	settings["PLAN_QUOTAS"] = formatPlanQuotas(c.PlanQuotas)
+
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	document := &yaml.Node{Kind: yaml.MappingNode}
+	for _, key := range keys {
+		var value yaml.Node
+		if err := value.Encode(settings[key]); err != nil {
+			return fmt.Errorf("failed to encode %s: %w", key, err)
+		}
+		document.Content = append(document.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: strings.ToLower(key)}, &value)
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(document); err != nil {
+		return fmt.Errorf("failed to write configuration: %w", err)
+	}
+	return encoder.Close()
+}
+
+// formatRatePlans writes plans in the format read by parseRatePlans
+func formatRatePlans(plans map[string]RatePlan) string {
+	names := make([]string, 0, len(plans))
+	for name := range plans {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	items := make([]string, 0, len(names))
+	for _, name := range names {
+		items = append(items, fmt.Sprintf("%s=%d/%d", name, plans[name].UserLimit, plans[name].TokenLimit))
+	}
+	return strings.Join(items, ",")
+}
+
+// formatPlanQuotas writes quotas in the format read by parsePlanQuotas
+func formatPlanQuotas(quotas map[string]PlanQuota) string {
+	names := make([]string, 0, len(quotas))
+	for name := range quotas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	items := make([]string, 0, len(names))
+	for _, name := range names {
+		quota := quotas[name]
+		items = append(items, fmt.Sprintf("%s=%d/%d/%d", name, quota.MaxRepositories, quota.MaxRunsPerMonth, quota.RetentionDays))
+	}
+	return strings.Join(items, ",")
+}
@@ -1,18 +1,80 @@
 package db
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net/url"
 	"os"
+	"sync"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
+// Credentials are the database username and password, replaced when the secrets backend
+// rotates them
+type Credentials struct {
+	mu       sync.RWMutex
+	username string
+	password string
+}
+
+// NewCredentials creates database credentials
+func NewCredentials(username, password string) *Credentials {
+	return &Credentials{username: username, password: password}
+}
+
+// Set replaces the credentials; connections opened from then on use them
+func (c *Credentials) Set(username, password string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.username, c.password = username, password
+}
+
+// Get returns the current credentials
+func (c *Credentials) Get() (string, string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.username, c.password
+}
+
+// WithCredentials returns databaseURL with its username and password replaced
+func WithCredentials(databaseURL, username, password string) (string, error) {
+	parsed, err := url.Parse(databaseURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid database URL: %w", err)
+	}
+	parsed.User = url.UserPassword(username, password)
+	return parsed.String(), nil
+}
+
 // Connect establishes a connection to the PostgreSQL database
 func Connect(databaseURL string) (*gorm.DB, error) {
+	return open(postgres.Open(databaseURL))
+}
+
+// ConnectWithCredentials establishes a connection to the PostgreSQL database that logs in
+// with the current credentials each time the pool opens a connection, so rotated passwords
+// are picked up as old connections expire
+func ConnectWithCredentials(databaseURL string, credentials *Credentials) (*gorm.DB, error) {
+	connConfig, err := pgx.ParseConfig(databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database URL: %w", err)
+	}
+	sqlDB := stdlib.OpenDB(*connConfig, stdlib.OptionBeforeConnect(func(ctx context.Context, config *pgx.ConnConfig) error {
+		config.User, config.Password = credentials.Get()
+		return nil
+	}))
+	return open(postgres.New(postgres.Config{Conn: sqlDB}))
+}
+
+// open opens the database with dialector and configures its connection pool
+func open(dialector gorm.Dialector) (*gorm.DB, error) {
 	// Configure GORM logger based on environment
 	var gormLogger logger.Interface
 	if os.Getenv("ENVIRONMENT") == "production" {
@@ -22,7 +84,7 @@ func Connect(databaseURL string) (*gorm.DB, error) {
 	}
 
 	// Open database connection
-	db, err := gorm.Open(postgres.Open(databaseURL), &gorm.Config{
+	db, err := gorm.Open(dialector, &gorm.Config{
 		Logger: gormLogger,
 		NowFunc: func() time.Time {
 			return time.Now().UTC()
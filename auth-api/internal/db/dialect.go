@@ -0,0 +1,138 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Dialect wraps the SQL constructs that differ between the supported databases.
+// Production runs on PostgreSQL while the test suite runs on SQLite, so any query
+// that cannot be expressed portably should be built through a Dialect.
+type Dialect struct {
+	name string
+}
+
+// DialectOf returns the dialect of the given database connection
+func DialectOf(database *gorm.DB) Dialect {
+	return Dialect{name: database.Dialector.Name()}
+}
+
+// Name returns the GORM dialector name ("postgres", "sqlite", ...)
+func (d Dialect) Name() string {
+	return d.name
+}
+
+// IsPostgres returns true when running against PostgreSQL
+func (d Dialect) IsPostgres() bool {
+	return d.name == "postgres"
+}
+
+// ILike returns a case-insensitive LIKE condition on column with a single placeholder
+func (d Dialect) ILike(column string) string {
+	if d.IsPostgres() {
+		return column + " ILIKE ?"
+	}
+	return "LOWER(" + column + ") LIKE LOWER(?) ESCAPE '\\'"
+}
+
+// Now returns the expression for the current timestamp
+func (d Dialect) Now() string {
+	if d.IsPostgres() {
+		return "NOW()"
+	}
+	return "CURRENT_TIMESTAMP"
+}
+
+// Greatest returns the larger of two expressions
+func (d Dialect) Greatest(a, b string) string {
+	if d.IsPostgres() {
+		return "GREATEST(" + a + ", " + b + ")"
+	}
+	return "MAX(" + a + ", " + b + ")"
+}
+
+// JSONText returns an expression extracting key from a JSON column as text
+func (d Dialect) JSONText(column, key string) string {
+	if d.IsPostgres() {
+		return column + "->>'" + key + "'"
+	}
+	return "json_extract(" + column + ", '$." + key + "')"
+}
+
+// EscapeLike escapes LIKE wildcards in user input so it is matched literally
+func EscapeLike(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(value)
+}
+
+// sqliteTimeFormats are the layouts SQLite uses when returning timestamps as text,
+// which happens for aggregate expressions such as MAX(created_at)
+var sqliteTimeFormats = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// timeScanner scans timestamps returned either natively or as text
+type timeScanner struct {
+	dest *time.Time
+}
+
+// ScanTime wraps a time destination so aggregate timestamps can be scanned on every dialect
+func ScanTime(dest *time.Time) sql.Scanner {
+	return &timeScanner{dest: dest}
+}
+
+// Scan implements the sql.Scanner interface
+func (ts *timeScanner) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*ts.dest = time.Time{}
+		return nil
+	case time.Time:
+		*ts.dest = v.UTC()
+		return nil
+	case []byte:
+		return ts.parse(string(v))
+	case string:
+		return ts.parse(v)
+	default:
+		return fmt.Errorf("failed to scan timestamp value: %v", value)
+	}
+}
+
+// parse parses a textual timestamp using the known SQLite layouts
+func (ts *timeScanner) parse(value string) error {
+	value = strings.TrimSuffix(value, "Z")
+	for _, layout := range sqliteTimeFormats {
+		if t, err := time.ParseInLocation(layout, value, time.UTC); err == nil {
+			*ts.dest = t.UTC()
+			return nil
+		}
+	}
+	return fmt.Errorf("failed to parse timestamp value: %q", value)
+}
+
+// DateTrunc returns an expression truncating column to the start of the given
+// interval ("day", "week" or "month"); weeks start on Monday on every dialect
+func (d Dialect) DateTrunc(interval, column string) string {
+	if d.IsPostgres() {
+		return "date_trunc('" + interval + "', " + column + " AT TIME ZONE 'UTC')"
+	}
+	switch interval {
+	case "week":
+		return "strftime('%Y-%m-%d 00:00:00', " + column + ", 'weekday 0', '-6 days')"
+	case "month":
+		return "strftime('%Y-%m-01 00:00:00', " + column + ")"
+	default:
+		return "strftime('%Y-%m-%d 00:00:00', " + column + ")"
+	}
+}
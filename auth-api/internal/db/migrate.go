@@ -3,15 +3,21 @@ package db
 import (
 	"fmt"
 	"log"
+	"os"
+	"strconv"
+	"strings"
 
 	"github.com/golang-migrate/migrate/v4"
-	"github.com/golang-migrate/migrate/v4/database/postgres"
+	migratepostgres "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/lib/pq"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
+// MigrationsDir is the directory holding the SQL migrations, relative to the working directory
+const MigrationsDir = "migrations"
+
 // Migrate runs database migrations
 func Migrate(databaseURL string) error {
 	// Connect to database for migration
@@ -26,14 +32,14 @@ func Migrate(databaseURL string) error {
 	}
 
 	// Create migration driver
-	driver, err := postgres.WithInstance(sqlDB, &postgres.Config{})
+	driver, err := migratepostgres.WithInstance(sqlDB, &migratepostgres.Config{})
 	if err != nil {
 		return fmt.Errorf("failed to create migration driver: %w", err)
 	}
 
 	// Create migrate instance
 	m, err := migrate.NewWithDatabaseInstance(
-		"file://migrations",
+		"file://"+MigrationsDir,
 		"postgres",
 		driver,
 	)
@@ -55,6 +61,51 @@ func Migrate(databaseURL string) error {
 	return nil
 }
 
+// LatestMigrationVersion returns the version of the newest migration in dir
+func LatestMigrationVersion(dir string) (uint, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	var latest uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, ".up.sql") {
+			continue
+		}
+		prefix, _, _ := strings.Cut(name, "_")
+		version, err := strconv.ParseUint(prefix, 10, 64)
+		if err != nil {
+			continue
+		}
+		if version > latest {
+			latest = version
+		}
+	}
+	if latest == 0 {
+		return 0, fmt.Errorf("no migrations found in %s", dir)
+	}
+	return uint(latest), nil
+}
+
+// MigrationVersion returns the version of the last migration applied to database and whether
+// it failed halfway (dirty)
+func MigrationVersion(database *gorm.DB) (uint, bool, error) {
+	var state struct {
+		Version uint
+		Dirty   bool
+	}
+	result := database.Raw("SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&state)
+	if result.Error != nil {
+		return 0, false, fmt.Errorf("failed to read migration version: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return 0, false, fmt.Errorf("no migrations applied")
+	}
+	return state.Version, state.Dirty, nil
+}
+
 // CreateDatabase creates the database if it doesn't exist
 func CreateDatabase(databaseURL string) error {
 	// Parse the database URL to extract database name
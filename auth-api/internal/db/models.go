@@ -4,22 +4,49 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// User roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Organization member roles, as on GitHub
+const (
+	OrganizationRoleMember = "member"
+	OrganizationRoleAdmin  = "admin"
+)
+
 // User represents a GitHub OAuth authenticated user
 type User struct {
-	ID              uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
-	GitHubID        int64     `gorm:"uniqueIndex;not null" json:"github_id"`
-	GitHubUsername  string    `gorm:"index;not null" json:"github_username"`
-	GitHubEmail     *string   `json:"github_email"`
+	ID              uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	GitHubID        int64     `gorm:"column:github_id;uniqueIndex;not null" json:"github_id"`
+	GitHubUsername  string    `gorm:"column:github_username;index;not null" json:"github_username"`
+	GitHubEmail     *string   `gorm:"column:github_email" json:"github_email"`
 	AvatarURL       *string   `json:"avatar_url"`
 	Name            *string   `json:"name"`
+	// Email categories ("alerts", "reports", ...) the user opted out of
+	EmailOptOut     StringList `gorm:"column:email_opt_out;type:text;not null;default:''" json:"-"`
+	// Role is RoleUser or RoleAdmin
+	Role            string     `gorm:"size:16;not null;default:'user'" json:"role"`
+	// SuspendedAt is set while an administrator has suspended the account
+	SuspendedAt     *time.Time `json:"suspended_at,omitempty"`
+	// Plan selects the rate limits of the user and the quotas of their personal repositories;
+	// users without a plan get the default plan
+	Plan            *string    `gorm:"size:32" json:"plan,omitempty"`
+	// DisplayUnits are the units responses report CO2 and energy in, such as "g,Wh"; NULL
+	// reports kg and kWh
+	DisplayUnits    *string    `gorm:"size:32" json:"display_units,omitempty"`
 	CreatedAt       time.Time `json:"created_at"`
 	UpdatedAt       time.Time `json:"updated_at"`
+	// DeletedAt is set while the account is deleted but can still be restored
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
 
 	// Relationships
 	Repositories []Repository `gorm:"foreignKey:OwnerID" json:"repositories,omitempty"`
@@ -28,30 +55,522 @@ type User struct {
 
 // Repository represents a GitHub repository
 type Repository struct {
-	ID           uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
-	OwnerID      uuid.UUID `gorm:"type:uuid;not null;index" json:"owner_id"`
-	GitHubRepoID int64     `gorm:"uniqueIndex;not null" json:"github_repo_id"`
-	Name         string    `gorm:"not null" json:"name"`
-	FullName     string    `gorm:"index;not null" json:"full_name"`
-	Description  *string   `json:"description"`
-	Private      bool      `gorm:"not null;default:false" json:"private"`
-	HTMLURL      string    `gorm:"not null" json:"html_url"`
+	ID             uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	OwnerID        uuid.UUID  `gorm:"type:uuid;not null;index" json:"owner_id"`
+	OrganizationID *uuid.UUID `gorm:"type:uuid;index" json:"organization_id,omitempty"`
+	GitHubRepoID   int64      `gorm:"column:github_repo_id;uniqueIndex;not null" json:"github_repo_id"`
+	Name           string     `gorm:"not null" json:"name"`
+	FullName       string     `gorm:"index;not null" json:"full_name"`
+	Description    *string    `json:"description"`
+	Private        bool       `gorm:"not null;default:false" json:"private"`
+	PublicStats    bool       `gorm:"not null;default:false" json:"public_stats"`
+	HTMLURL        string     `gorm:"not null" json:"html_url"`
+	Language       *string    `gorm:"size:64" json:"language,omitempty"`
+	SizeKB         *int64     `gorm:"column:size_kb" json:"size_kb,omitempty"`
+	BenchmarkOptIn bool       `gorm:"not null;default:false" json:"benchmark_opt_in"`
+	CommitStatus   bool       `gorm:"not null;default:false" json:"commit_status"`
+	// SignedRuns requires runs submitted for the repository to carry an HMAC signature made
+	// with RunSigningSecret, which is only returned when it is generated
+	SignedRuns       bool    `gorm:"not null;default:false" json:"signed_runs"`
+	RunSigningSecret *string `gorm:"size:64" json:"-"`
+	// WUELitersPerKWh is the water usage effectiveness of the data centers the runs of the
+	// repository run in, overriding that of its organization
+	WUELitersPerKWh *float64  `gorm:"column:wue_l_per_kwh" json:"wue_l_per_kwh,omitempty"`
+	// RunsPurgedBefore is the UTC day before which runs were deleted by the retention policy;
+	// the rollups of earlier days are kept as the only record of those runs
+	RunsPurgedBefore *time.Time `gorm:"type:date" json:"runs_purged_before,omitempty"`
+	// LanguagesSyncedAt is when the languages of the repository were last read from GitHub
+	LanguagesSyncedAt *time.Time `json:"languages_synced_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	// DeletedAt is set while the repository is deleted but can still be restored
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+
+	// Relationships
+	Owner        *User         `gorm:"foreignKey:OwnerID" json:"owner,omitempty"`
+	Organization *Organization `gorm:"foreignKey:OrganizationID" json:"organization,omitempty"`
+	Runs         []Run         `gorm:"foreignKey:RepositoryID" json:"runs,omitempty"`
+}
+
+// Organization represents a GitHub organization that owns repositories
+type Organization struct {
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	GitHubID    int64     `gorm:"column:github_id;uniqueIndex;not null" json:"github_id"`
+	GitHubLogin string    `gorm:"column:github_login;uniqueIndex;not null" json:"github_login"`
+	// Plan selects the quotas of the organization's repositories; organizations without a
+	// plan get the default plan
+	Plan        *string   `gorm:"size:32" json:"plan,omitempty"`
+	// WUELitersPerKWh is the water usage effectiveness of the data centers the runs of the
+	// organization's repositories run in
+	WUELitersPerKWh *float64 `gorm:"column:wue_l_per_kwh" json:"wue_l_per_kwh,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// OrganizationMember links a user to an organization they belong to on GitHub
+type OrganizationMember struct {
+	OrganizationID uuid.UUID `gorm:"type:uuid;primaryKey" json:"organization_id"`
+	UserID         uuid.UUID `gorm:"type:uuid;primaryKey;index" json:"user_id"`
+	// Role is OrganizationRoleMember or OrganizationRoleAdmin, the role of the user on GitHub
+	Role           string    `gorm:"size:16;not null;default:member" json:"role"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// RepositoryCollaborator grants a user read access to a repository they do not own
+type RepositoryCollaborator struct {
+	RepositoryID uuid.UUID `gorm:"type:uuid;primaryKey" json:"repository_id"`
+	UserID       uuid.UUID `gorm:"type:uuid;primaryKey;index" json:"user_id"`
+	CreatedAt    time.Time `json:"created_at"`
+
+	// Relationships
+	User *User `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
+
+// RepositoryBaseline holds the per-run emission rates of a reference period. The rates are
+// computed once when the baseline is set so later data retention does not change them.
+type RepositoryBaseline struct {
+	RepositoryID    uuid.UUID `gorm:"type:uuid;primaryKey" json:"repository_id"`
+	PeriodFrom      time.Time `gorm:"not null" json:"period_from"`
+	PeriodTo        time.Time `gorm:"not null" json:"period_to"`
+	RunCount        int64     `gorm:"not null" json:"run_count"`
+	CO2KgPerRun     float64   `gorm:"column:co2_kg_per_run;type:decimal(12,6);not null" json:"co2_kg_per_run"`
+	EnergyKWhPerRun float64   `gorm:"column:energy_kwh_per_run;type:decimal(12,6);not null" json:"energy_kwh_per_run"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// RepositoryBudget limits the CO2 a repository may emit per calendar period ("month" or "quarter")
+type RepositoryBudget struct {
+	RepositoryID uuid.UUID `gorm:"type:uuid;primaryKey" json:"repository_id"`
+	Period       string    `gorm:"primaryKey;size:16" json:"period"`
+	CO2KgLimit   float64   `gorm:"column:co2_kg_limit;type:decimal(12,6);not null" json:"co2_kg_limit"`
 	CreatedAt    time.Time `json:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Webhook subscribes an external URL to carbon events of a repository or an organization.
+// Exactly one of RepositoryID and OrganizationID is set.
+type Webhook struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	RepositoryID   *uuid.UUID `gorm:"type:uuid;index" json:"repository_id,omitempty"`
+	OrganizationID *uuid.UUID `gorm:"type:uuid;index" json:"organization_id,omitempty"`
+	CreatedByID    uuid.UUID  `gorm:"type:uuid;not null" json:"created_by_id"`
+	URL            string     `gorm:"not null" json:"url"`
+	Secret         string     `gorm:"not null" json:"-"`
+	Events         StringList `gorm:"type:text;not null" json:"events"`
+	// Format of the payloads: ecoci, cloudevents-structured or cloudevents-binary
+	Format         string     `gorm:"size:32;not null;default:ecoci" json:"format"`
+	Active         bool       `gorm:"not null;default:true" json:"active"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// WebhookDelivery is one event queued for delivery to a webhook. Deliveries that still
+// fail after the maximum number of attempts are kept with status "dead" for inspection
+// and manual redelivery.
+type WebhookDelivery struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	WebhookID      uuid.UUID  `gorm:"type:uuid;not null;index" json:"webhook_id"`
+	Event          string     `gorm:"size:64;not null" json:"event"`
+	Payload        string     `gorm:"type:text;not null" json:"payload"`
+	Status         string     `gorm:"size:16;not null;index:idx_webhook_deliveries_due" json:"status"`
+	Attempts       int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt  time.Time  `gorm:"not null;index:idx_webhook_deliveries_due" json:"next_attempt_at"`
+	ResponseStatus *int       `json:"response_status,omitempty"`
+	LastError      *string    `json:"last_error,omitempty"`
+	DeliveredAt    *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// WebhookDeliveryAttempt records the outcome of one attempt to send a delivery. Attempt
+// counts within the retry budget of the delivery and restarts at 1 after a redelivery.
+type WebhookDeliveryAttempt struct {
+	ID              uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	DeliveryID      uuid.UUID `gorm:"type:uuid;not null;index:idx_webhook_delivery_attempts_delivery_id" json:"delivery_id"`
+	Attempt         int       `gorm:"not null" json:"attempt"`
+	ResponseStatus  *int      `json:"response_status,omitempty"`
+	LatencyMS       int64     `gorm:"column:latency_ms;not null" json:"latency_ms"`
+	ResponseSnippet *string   `gorm:"type:text" json:"response_snippet,omitempty"`
+	Error           *string   `gorm:"type:text" json:"error,omitempty"`
+	AttemptedAt     time.Time `gorm:"not null;index:idx_webhook_delivery_attempts_delivery_id" json:"attempted_at"`
+}
+
+// OrganizationIntegration holds the credentials of a chat integration ("slack") of an
+// organization. Credentials are never serialized.
+type OrganizationIntegration struct {
+	OrganizationID uuid.UUID `gorm:"type:uuid;primaryKey" json:"organization_id"`
+	Provider       string    `gorm:"primaryKey;size:32" json:"provider"`
+	WebhookURL     *string   `json:"-"`
+	BotToken       *string   `json:"-"`
+	DefaultChannel *string   `gorm:"size:255" json:"default_channel,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// RepositoryNotificationRoute selects which notifications of a repository are posted
+// through an integration of its organization, and to which channel
+type RepositoryNotificationRoute struct {
+	RepositoryID uuid.UUID  `gorm:"type:uuid;primaryKey" json:"repository_id"`
+	Provider     string     `gorm:"primaryKey;size:32" json:"provider"`
+	Channel      *string    `gorm:"size:255" json:"channel,omitempty"`
+	Events       StringList `gorm:"type:text;not null" json:"events"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
 
 	// Relationships
-	Owner *User `gorm:"foreignKey:OwnerID" json:"owner,omitempty"`
-	Runs  []Run `gorm:"foreignKey:RepositoryID" json:"runs,omitempty"`
+	Repository *Repository `gorm:"foreignKey:RepositoryID" json:"-"`
+}
+
+// AlertRule is a user-defined threshold on an aggregated metric over a rolling window,
+// evaluated periodically for a repository, an organization or the user's own runs.
+// RepositoryID or OrganizationID is set according to Scope.
+type AlertRule struct {
+	ID              uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID          uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	Name            string     `gorm:"not null" json:"name"`
+	Scope           string     `gorm:"size:16;not null" json:"scope"`
+	RepositoryID    *uuid.UUID `gorm:"type:uuid;index" json:"repository_id,omitempty"`
+	OrganizationID  *uuid.UUID `gorm:"type:uuid;index" json:"organization_id,omitempty"`
+	Metric          string     `gorm:"size:32;not null" json:"metric"`
+	Aggregation     string     `gorm:"size:16;not null" json:"aggregation"`
+	Comparison      string     `gorm:"size:32;not null" json:"comparison"`
+	Threshold       float64    `gorm:"type:decimal(12,6);not null" json:"threshold"`
+	Window          string     `gorm:"column:time_window;size:16;not null" json:"window"`
+	Channel         string     `gorm:"size:16;not null" json:"channel"`
+	Destination     *string    `json:"destination,omitempty"`
+	Enabled         bool       `gorm:"not null;default:true;index" json:"enabled"`
+	LastValue       *float64   `gorm:"type:decimal(18,6)" json:"last_value,omitempty"`
+	LastEvaluatedAt *time.Time `json:"last_evaluated_at,omitempty"`
+	LastTriggeredAt *time.Time `json:"last_triggered_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// UserPreference holds the settings of a user beyond their display units and email opt-outs,
+// which are kept on the user. Users without a row use the defaults.
+type UserPreference struct {
+	UserID uuid.UUID `gorm:"type:uuid;primaryKey" json:"user_id"`
+	// Timezone is the IANA time zone reports are rendered in
+	Timezone string `gorm:"size:64;not null;default:UTC" json:"timezone"`
+	// Locale is the BCP 47 language tag numbers and dates are formatted for
+	Locale string `gorm:"size:35;not null;default:en" json:"locale"`
+	// DefaultRangeDays is the date range dashboards show when none is chosen
+	DefaultRangeDays int `gorm:"not null;default:30" json:"default_range_days"`
+	// SlackUserID is the Slack member ID notifications are sent to as direct messages
+	SlackUserID *string `gorm:"size:32" json:"slack_user_id,omitempty"`
+	// ProfileVisibility is who may see the user's profile: "private", "organization" or "public"
+	ProfileVisibility string `gorm:"size:16;not null;default:private" json:"profile_visibility"`
+	// ProfileStats shows the aggregate statistics of the user on their profile
+	ProfileStats bool      `gorm:"not null;default:false" json:"profile_stats"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// GitHubCredential holds the GitHub OAuth token of a user from their last sign-in, used to
+// refresh their profile and repositories on demand
+type GitHubCredential struct {
+	UserID      uuid.UUID `gorm:"type:uuid;primaryKey" json:"user_id"`
+	AccessToken string    `gorm:"type:text;not null" json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// APIToken is a named, long-lived token a user created for API clients such as CI
+// integrations. Its ID is the ID of the JWT, so deleting it revokes the token.
+type APIToken struct {
+	ID     uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
+	Name   string    `gorm:"size:100;not null" json:"name"`
+	// ExpiresAt is nil for tokens that never expire
+	ExpiresAt *time.Time `json:"expires_at"`
+	// LastUsedAt and LastUsedIP record the last authenticated request made with the token
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP *string    `gorm:"column:last_used_ip;size:45" json:"last_used_ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// NotificationPreference chooses the channel a user receives an event on, for all their
+// notifications or only those of a repository or organization. Without either ID the
+// preference applies to every repository and organization of the user.
+type NotificationPreference struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID         uuid.UUID  `gorm:"type:uuid;not null;index" json:"user_id"`
+	RepositoryID   *uuid.UUID `gorm:"type:uuid;index" json:"repository_id,omitempty"`
+	OrganizationID *uuid.UUID `gorm:"type:uuid;index" json:"organization_id,omitempty"`
+	Event          string     `gorm:"size:32;not null" json:"event"`
+	Channel        string     `gorm:"size:16;not null" json:"channel"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// SavedView bookmarks a recurring query of a user over runs: a filter expression, sort,
+// grouping and relative date range, optionally of one repository
+type SavedView struct {
+	ID           uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID       uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_saved_views_user_name" json:"user_id"`
+	Name         string     `gorm:"size:255;not null;uniqueIndex:idx_saved_views_user_name" json:"name"`
+	RepositoryID *uuid.UUID `gorm:"type:uuid;index" json:"repository_id"`
+	Filter       *string    `gorm:"type:text" json:"filter"`
+	Sort         *string    `gorm:"size:32" json:"sort"`
+	Order        *string    `gorm:"column:sort_order;size:4" json:"order"`
+	GroupBy      *string    `gorm:"size:128" json:"group_by"`
+	// RangeDays is the number of days up to now the view covers, nil for all time
+	RangeDays *int      `json:"range_days"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RepositoryDailyRollup holds the totals of the runs of a repository on one UTC day. Rollups
+// are kept up to date as runs are created so repository statistics never scan the runs table.
+type RepositoryDailyRollup struct {
+	RepositoryID   uuid.UUID `gorm:"type:uuid;primaryKey" json:"repository_id"`
+	Day            time.Time `gorm:"type:date;primaryKey" json:"day"`
+	RunCount       int64     `gorm:"not null" json:"run_count"`
+	TotalCO2Kg     float64   `gorm:"column:total_co2_kg;type:decimal(18,6);not null" json:"total_co2_kg"`
+	TotalEnergyKWh float64   `gorm:"column:total_energy_kwh;type:decimal(18,6);not null" json:"total_energy_kwh"`
+	TotalDurationS float64   `gorm:"column:total_duration_s;type:decimal(18,3);not null" json:"total_duration_s"`
+	LastRunAt      time.Time `gorm:"not null" json:"last_run_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// StorageReport is the artifact and cache storage a repository held when it was reported.
+// The latest report up to a day is taken as the storage of the repository on that day.
+type StorageReport struct {
+	ID            uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	RepositoryID  uuid.UUID `gorm:"type:uuid;not null;index:idx_storage_reports_repository_reported,priority:1" json:"repository_id"`
+	ArtifactBytes int64     `gorm:"not null;check:artifact_bytes >= 0" json:"artifact_bytes"`
+	CacheBytes    int64     `gorm:"not null;check:cache_bytes >= 0" json:"cache_bytes"`
+	ReportedAt    time.Time `gorm:"not null;index:idx_storage_reports_repository_reported,priority:2" json:"reported_at"`
+}
+
+// RepositoryStorageDay is the energy and CO2 of the storage a repository held on one UTC
+// day, accrued by the storage-emissions job from the storage reports
+type RepositoryStorageDay struct {
+	RepositoryID  uuid.UUID `gorm:"type:uuid;primaryKey" json:"repository_id"`
+	Day           time.Time `gorm:"type:date;primaryKey" json:"day"`
+	ArtifactBytes int64     `gorm:"not null" json:"artifact_bytes"`
+	CacheBytes    int64     `gorm:"not null" json:"cache_bytes"`
+	EnergyKWh     float64   `gorm:"column:energy_kwh;type:decimal(18,9);not null" json:"energy_kwh"`
+	CO2Kg         float64   `gorm:"column:co2_kg;type:decimal(18,9);not null" json:"co2_kg"`
+}
+
+// RetentionPolicy controls how long the runs and rollups of the repositories of an
+// organization are kept. Nil retention keeps the data forever; with DryRun the retention
+// job only reports what it would delete.
+type RetentionPolicy struct {
+	OrganizationID      uuid.UUID `gorm:"type:uuid;primaryKey" json:"organization_id"`
+	RunRetentionDays    *int      `json:"run_retention_days"`
+	RollupRetentionDays *int      `json:"rollup_retention_days"`
+	DryRun              bool      `gorm:"not null;default:false" json:"dry_run"`
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+// RetentionReport records what one application of a retention policy deleted, or would
+// have deleted in dry-run mode
+type RetentionReport struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	OrganizationID uuid.UUID  `gorm:"type:uuid;not null;index:idx_retention_reports_org_created" json:"organization_id"`
+	DryRun         bool       `gorm:"not null" json:"dry_run"`
+	RunCutoff      *time.Time `json:"run_cutoff,omitempty"`
+	RollupCutoff   *time.Time `json:"rollup_cutoff,omitempty"`
+	Repositories   int        `gorm:"not null" json:"repositories"`
+	RunsDeleted    int64      `gorm:"not null" json:"runs_deleted"`
+	RollupsDeleted int64      `gorm:"not null" json:"rollups_deleted"`
+	CreatedAt      time.Time  `gorm:"index:idx_retention_reports_org_created" json:"created_at"`
+
+	// RepositoryIDs lists the repositories whose data was deleted
+	RepositoryIDs []uuid.UUID `gorm:"-" json:"-"`
+}
+
+// AuditEvent records a mutation made through the API. Events are never updated and outlive
+// the records they describe, so the actor is stored by username as well as by ID.
+type AuditEvent struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	ActorID        *uuid.UUID `gorm:"type:uuid;index" json:"actor_id,omitempty"`
+	ActorUsername  string     `gorm:"size:255;not null;default:''" json:"actor_username"`
+	// Action is "<resource>.<verb>", such as "run.delete" or "budget.set"
+	Action         string     `gorm:"size:64;not null;index" json:"action"`
+	ResourceType   string     `gorm:"size:32;not null;index:idx_audit_events_resource" json:"resource_type"`
+	ResourceID     string     `gorm:"size:64;not null;index:idx_audit_events_resource" json:"resource_id"`
+	// OrganizationID is set when the resource belongs to an organization
+	OrganizationID *uuid.UUID `gorm:"type:uuid;index" json:"organization_id,omitempty"`
+	// Changes maps each changed field to its "from" and "to" values
+	Changes        JSONB      `gorm:"type:jsonb" json:"changes,omitempty"`
+	RequestID      string     `gorm:"size:128;not null;default:''" json:"request_id"`
+	CreatedAt      time.Time  `gorm:"index" json:"created_at"`
+}
+
+// Job is the definition and state of a background job. Jobs are registered in code; their
+// schedule and enabled flag live here so they can be changed without a deploy. A running job
+// holds a lease (LockedBy, LockedUntil) so only one instance runs it at a time.
+type Job struct {
+	Name           string     `gorm:"primaryKey;size:64" json:"name"`
+	Description    string     `gorm:"not null" json:"description"`
+	Schedule       string     `gorm:"size:64;not null" json:"schedule"`
+	Enabled        bool       `gorm:"not null;default:true" json:"enabled"`
+	NextRunAt      time.Time  `gorm:"not null;index" json:"next_run_at"`
+	LastRunAt      *time.Time `json:"last_run_at,omitempty"`
+	LastStatus     *string    `gorm:"size:16" json:"last_status,omitempty"`
+	LastError      *string    `json:"last_error,omitempty"`
+	LastDurationMs *int64     `json:"last_duration_ms,omitempty"`
+	LockedBy       *string    `gorm:"size:255" json:"locked_by,omitempty"`
+	LockedUntil    *time.Time `json:"locked_until,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// JobRun is one execution of a background job, started by its schedule or manually
+type JobRun struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	JobName    string     `gorm:"size:64;not null;index:idx_job_runs_job_started" json:"job_name"`
+	Trigger    string     `gorm:"size:16;not null" json:"trigger"`
+	Status     string     `gorm:"size:16;not null" json:"status"`
+	Result     *string    `json:"result,omitempty"`
+	Error      *string    `json:"error,omitempty"`
+	StartedAt  time.Time  `gorm:"not null;index:idx_job_runs_job_started" json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	DurationMs *int64     `json:"duration_ms,omitempty"`
+}
+
+// FeatureFlag is the runtime state of a feature flag defined in code; flags without a row
+// use their default. An enabled flag is on for the targeted users, for the members of the
+// targeted organizations, and for RolloutPercentage percent of everybody else.
+type FeatureFlag struct {
+	Name              string     `gorm:"primaryKey;size:64" json:"name"`
+	Enabled           bool       `gorm:"not null;default:false" json:"enabled"`
+	RolloutPercentage int        `gorm:"not null;default:0" json:"rollout_percentage"`
+	UserIDs           StringList `gorm:"column:user_ids;type:text;not null;default:''" json:"user_ids"`
+	OrganizationIDs   StringList `gorm:"column:organization_ids;type:text;not null;default:''" json:"organization_ids"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// BigQueryExportQueueEntry is a run waiting to be exported to BigQuery. Runs are queued in
+// the transaction that creates them while the export is enabled.
+type BigQueryExportQueueEntry struct {
+	RunID    uuid.UUID `gorm:"type:uuid;primaryKey" json:"run_id"`
+	QueuedAt time.Time `gorm:"not null;index:idx_bigquery_export_queue_queued_at" json:"queued_at"`
+}
+
+// BigQueryExportCursor records the time of the last export of a stream that is not queued,
+// such as the nightly rollups
+type BigQueryExportCursor struct {
+	Stream    string    `gorm:"primaryKey;size:32" json:"stream"`
+	Position  time.Time `gorm:"not null" json:"position"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ArchivePartition is a Parquet file in the archive bucket holding the runs of a repository on
+// one UTC day. The file is written again when the rollup of the day changes after ExportedAt.
+type ArchivePartition struct {
+	RepositoryID uuid.UUID `gorm:"type:uuid;primaryKey" json:"repository_id"`
+	Day          time.Time `gorm:"type:date;primaryKey;index:idx_archive_partitions_day" json:"day"`
+	Key          string    `gorm:"not null" json:"key"`
+	RunCount     int64     `gorm:"not null" json:"run_count"`
+	SizeBytes    int64     `gorm:"not null" json:"size_bytes"`
+	ExportedAt   time.Time `gorm:"not null" json:"exported_at"`
+}
+
+// CarbonOffset kinds: offsets are purchased CO2 removals or avoidances, renewable purchases
+// match energy use with certified renewable energy
+const (
+	CarbonOffsetKindOffset    = "offset"
+	CarbonOffsetKindRenewable = "renewable"
+)
+
+// CarbonOffset records carbon offsets or renewable-matched energy an organization purchased
+// for a period, so reports can show market-based and net emissions next to the measured ones.
+// Offsets set CO2Kg and renewable purchases set EnergyKWh; the period is inclusive.
+type CarbonOffset struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	OrganizationID uuid.UUID  `gorm:"type:uuid;not null;index:idx_carbon_offsets_org_period" json:"organization_id"`
+	Kind           string     `gorm:"size:16;not null" json:"kind"`
+	CO2Kg          *float64   `gorm:"column:co2_kg" json:"co2_kg,omitempty"`
+	EnergyKWh      *float64   `gorm:"column:energy_kwh" json:"energy_kwh,omitempty"`
+	Vendor         string     `gorm:"size:255;not null" json:"vendor"`
+	CertificateURL *string    `gorm:"size:2048" json:"certificate_url,omitempty"`
+	PeriodStart    time.Time  `gorm:"type:date;not null;index:idx_carbon_offsets_org_period" json:"period_start"`
+	PeriodEnd      time.Time  `gorm:"type:date;not null" json:"period_end"`
+	CreatedByID    *uuid.UUID `gorm:"type:uuid" json:"created_by_id,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// EmissionFactor is the grid carbon intensity of a region over the days it is effective, with
+// the provenance of the number so the CO2 of runs can be traced back to it. EffectiveTo is
+// exclusive; nil keeps the factor effective until further notice.
+type EmissionFactor struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	Region        string     `gorm:"size:64;not null;index:idx_emission_factors_region_from" json:"region"`
+	GramsPerKWh   float64    `gorm:"column:grams_co2e_per_kwh;not null" json:"grams_co2e_per_kwh"`
+	Source        string     `gorm:"size:255;not null" json:"source"`
+	SourceURL     *string    `gorm:"size:2048" json:"source_url,omitempty"`
+	Methodology   string     `gorm:"not null" json:"methodology"`
+	EffectiveFrom time.Time  `gorm:"type:date;not null;index:idx_emission_factors_region_from" json:"effective_from"`
+	EffectiveTo   *time.Time `gorm:"type:date" json:"effective_to,omitempty"`
+	// Version is incremented by every change; each version is kept in emission_factor_versions
+	Version       int        `gorm:"not null;default:1" json:"version"`
+	CreatedByID   *uuid.UUID `gorm:"type:uuid" json:"created_by_id,omitempty"`
+	UpdatedByID   *uuid.UUID `gorm:"type:uuid" json:"updated_by_id,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// Emission factor version changes
+const (
+	EmissionFactorCreated = "create"
+	EmissionFactorUpdated = "update"
+	EmissionFactorDeleted = "delete"
+)
+
+// EmissionFactorVersion is the state of an emission factor after one of its changes. Versions
+// are never updated and outlive deleted factors, so recalculated runs keep the provenance of
+// their CO2.
+type EmissionFactorVersion struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	FactorID      uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_emission_factor_versions_factor_version" json:"factor_id"`
+	Version       int        `gorm:"not null;uniqueIndex:idx_emission_factor_versions_factor_version" json:"version"`
+	Change        string     `gorm:"size:16;not null" json:"change"`
+	Region        string     `gorm:"size:64;not null" json:"region"`
+	GramsPerKWh   float64    `gorm:"column:grams_co2e_per_kwh;not null" json:"grams_co2e_per_kwh"`
+	Source        string     `gorm:"size:255;not null" json:"source"`
+	SourceURL     *string    `gorm:"size:2048" json:"source_url,omitempty"`
+	Methodology   string     `gorm:"not null" json:"methodology"`
+	EffectiveFrom time.Time  `gorm:"type:date;not null" json:"effective_from"`
+	EffectiveTo   *time.Time `gorm:"type:date" json:"effective_to,omitempty"`
+	ChangedByID   *uuid.UUID `gorm:"type:uuid" json:"changed_by_id,omitempty"`
+	CreatedAt     time.Time  `gorm:"index" json:"created_at"`
+}
+
+// RecalculationReport records what one recalculation of the current-methodology CO2 of runs
+// changed. Full scans follow changes of emission factors; otherwise only the runs submitted
+// since are computed.
+type RecalculationReport struct {
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	FullScan    bool      `gorm:"not null" json:"full_scan"`
+	RunsScanned int64     `gorm:"not null" json:"runs_scanned"`
+	RunsChanged int64     `gorm:"not null" json:"runs_changed"`
+	// PreviousCO2Kg sums the previous current-methodology CO2 of the changed runs, or their
+	// reported CO2 when they had none
+	PreviousCO2Kg float64 `gorm:"column:previous_co2_kg;not null" json:"previous_co2_kg"`
+	CurrentCO2Kg  float64 `gorm:"column:current_co2_kg;not null" json:"current_co2_kg"`
+	// Regions maps each region with changed runs to its runs_changed, previous_co2_kg and
+	// current_co2_kg
+	Regions   JSONB     `gorm:"type:jsonb" json:"regions"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
 }
 
 // Run represents a CO2 measurement run
 type Run struct {
-	ID           uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	ID           uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
 	UserID       uuid.UUID `gorm:"type:uuid;not null;index" json:"user_id"`
 	RepositoryID uuid.UUID `gorm:"type:uuid;not null;index" json:"repository_id"`
 
 	// CO2 measurement data
-	EnergyKWh  float64 `gorm:"type:decimal(12,6);not null;check:energy_kwh >= 0" json:"energy_kwh"`
+	EnergyKWh  float64 `gorm:"column:energy_kwh;type:decimal(12,6);not null;check:energy_kwh >= 0" json:"energy_kwh"`
 	CO2Kg      float64 `gorm:"type:decimal(12,6);not null;check:co2_kg >= 0" json:"co2_kg"`
 	DurationS  float64 `gorm:"type:decimal(10,3);not null;check:duration_s >= 0" json:"duration_s"`
 
@@ -60,12 +579,120 @@ type Run struct {
 	GitCommitSHA  *string `gorm:"size:40" json:"git_commit_sha,omitempty"`
 	BranchName    *string `json:"branch_name,omitempty"`
 	WorkflowName  *string `json:"workflow_name,omitempty"`
+	// WorkflowRunGroup links the runs submitted for one execution of a CI workflow, such as
+	// the jobs of a matrix build
+	WorkflowRunGroup *string `gorm:"size:255" json:"workflow_run_group,omitempty"`
+	// GitTag is the git tag or release the run was submitted for; the runs since the previous
+	// tag of the repository produced the release
+	GitTag *string `gorm:"size:255" json:"git_tag,omitempty"`
+	// Environment separates deployment pipelines from test pipelines: ci, staging or
+	// production-deploy
+	Environment string `gorm:"size:32;not null;default:ci" json:"environment"`
+	// WaterL is the water consumed by the data center for the energy of the run, computed at
+	// ingest from the water usage effectiveness in effect; nil when none is known
+	WaterL *float64 `gorm:"column:water_l;type:decimal(14,6)" json:"water_l,omitempty"`
+	// GPUEnergyKWh is the part of the energy of the run consumed by its GPUCount GPUs of
+	// GPUModel; all are nil for runs without GPUs. GPUModel is nil for mixed devices.
+	GPUEnergyKWh *float64 `gorm:"column:gpu_energy_kwh;type:decimal(12,6)" json:"gpu_energy_kwh,omitempty"`
+	GPUModel     *string  `gorm:"column:gpu_model;size:128" json:"gpu_model,omitempty"`
+	GPUCount     *int     `gorm:"column:gpu_count" json:"gpu_count,omitempty"`
+	// NetworkBytes is the data the run transferred, such as artifact uploads and image pulls.
+	// Its energy and CO2 are computed at ingest and reported apart from those of the run.
+	NetworkBytes     *int64   `gorm:"column:network_bytes" json:"network_bytes,omitempty"`
+	NetworkEnergyKWh *float64 `gorm:"column:network_energy_kwh;type:decimal(12,6)" json:"network_energy_kwh,omitempty"`
+	NetworkCO2Kg     *float64 `gorm:"column:network_co2_kg;type:decimal(12,6)" json:"network_co2_kg,omitempty"`
+
+	// CurrentCO2Kg is the CO2 recomputed from the energy with the emission factor of the
+	// region of the run in effect on its day under the current methodology, next to the CO2 as
+	// reported. It is nil for runs without a region and until the recalculation job has run.
+	CurrentCO2Kg *float64 `gorm:"column:current_co2_kg;type:decimal(12,6)" json:"current_co2_kg,omitempty"`
+	// EmissionFactorID and EmissionFactorVersion identify the managed factor version
+	// CurrentCO2Kg was computed with; both are nil for the built-in factors
+	EmissionFactorID      *uuid.UUID `gorm:"type:uuid" json:"emission_factor_id,omitempty"`
+	EmissionFactorVersion *int       `json:"emission_factor_version,omitempty"`
+	RecalculatedAt        *time.Time `json:"recalculated_at,omitempty"`
 
 	CreatedAt time.Time `gorm:"index:idx_runs_created_at" json:"created_at"`
+	// DeletedAt is set while the run is deleted but can still be restored
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
 
 	// Relationships
 	User       *User       `gorm:"foreignKey:UserID" json:"user,omitempty"`
 	Repository *Repository `gorm:"foreignKey:RepositoryID" json:"repository,omitempty"`
+	// Measurements are the metrics of the run beyond its energy, CO2 and duration
+	Measurements []Measurement `gorm:"foreignKey:RunID" json:"measurements,omitempty"`
+	// GPUDevices break the GPU energy of the run down by device, when it was measured per GPU
+	GPUDevices []RunGPU `gorm:"foreignKey:RunID" json:"gpus,omitempty"`
+	// ImageBuild is the container image the run built, for image-build runs
+	ImageBuild *RunImageBuild `gorm:"foreignKey:RunID" json:"image_build,omitempty"`
+}
+
+// RunGPU is the energy one GPU of a run consumed
+type RunGPU struct {
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey" json:"-"`
+	RunID       uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_run_gpus_run_device" json:"-"`
+	DeviceIndex int       `gorm:"not null;uniqueIndex:idx_run_gpus_run_device" json:"index"`
+	Model       string    `gorm:"size:128;not null" json:"model"`
+	EnergyKWh   float64   `gorm:"column:energy_kwh;type:decimal(12,6);not null" json:"energy_kwh"`
+}
+
+// RunImageBuild is the container image an image-build run built: the layers it built and
+// took from the cache, the size of the image and the bytes pushed to the registry
+type RunImageBuild struct {
+	RunID          uuid.UUID `gorm:"type:uuid;primaryKey" json:"-"`
+	Image          *string   `gorm:"size:255" json:"image,omitempty"`
+	LayersBuilt    int       `gorm:"not null;check:layers_built >= 0" json:"layers_built"`
+	LayersCached   int       `gorm:"not null;check:layers_cached >= 0" json:"layers_cached"`
+	ImageSizeBytes *int64    `json:"image_size_bytes,omitempty"`
+	PushBytes      *int64    `json:"push_bytes,omitempty"`
+}
+
+// Measurement is a metric of a run beyond its energy, CO2 and duration, such as the energy of
+// its GPUs or the bytes it transferred, so new metrics can be recorded without a column each.
+// Energy is stored in kWh and data in bytes; other units are stored as submitted.
+type Measurement struct {
+	ID    uuid.UUID `gorm:"type:uuid;primaryKey" json:"-"`
+	RunID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_measurements_run_type" json:"-"`
+	Type  string    `gorm:"size:64;not null;uniqueIndex:idx_measurements_run_type;index:idx_measurements_type" json:"type"`
+	Value float64   `gorm:"not null;check:value >= 0" json:"value"`
+	Unit  string    `gorm:"size:16;not null" json:"unit"`
+}
+
+// RepositoryLanguage is the code of a repository in one language, as detected by GitHub
+type RepositoryLanguage struct {
+	RepositoryID uuid.UUID `gorm:"type:uuid;primaryKey" json:"-"`
+	Language     string    `gorm:"size:64;primaryKey" json:"language"`
+	Bytes        int64     `gorm:"not null" json:"bytes"`
+}
+
+// RunTestSuite is a test suite of the JUnit report of a run, with the share of the energy and
+// CO2 of the run apportioned to it by duration
+type RunTestSuite struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey" json:"-"`
+	RunID     uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_run_test_suites_run_name" json:"-"`
+	Name      string    `gorm:"size:512;not null;uniqueIndex:idx_run_test_suites_run_name" json:"name"`
+	Tests     int       `gorm:"not null" json:"tests"`
+	Failures  int       `gorm:"not null" json:"failures"`
+	Errors    int       `gorm:"not null" json:"errors"`
+	Skipped   int       `gorm:"not null" json:"skipped"`
+	DurationS float64   `gorm:"column:duration_s;type:decimal(12,3);not null" json:"duration_s"`
+	EnergyKWh float64   `gorm:"column:energy_kwh;type:decimal(18,9);not null" json:"energy_kwh"`
+	CO2Kg     float64   `gorm:"column:co2_kg;type:decimal(18,9);not null" json:"co2_kg"`
+}
+
+// RunComment annotates a run, such as explaining the spike of a regression. Comments with a
+// ParentID reply to a top-level comment of the same run, forming its thread.
+type RunComment struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	RunID     uuid.UUID  `gorm:"type:uuid;not null;index" json:"run_id"`
+	ParentID  *uuid.UUID `gorm:"type:uuid;index" json:"parent_id"`
+	AuthorID  uuid.UUID  `gorm:"type:uuid;not null" json:"author_id"`
+	Body      string     `gorm:"type:text;not null" json:"body"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+
+	// Relationships
+	Author *User `gorm:"foreignKey:AuthorID" json:"-"`
 }
 
 // JSONB represents a JSONB field for PostgreSQL
@@ -86,12 +713,46 @@ func (j *JSONB) Scan(value interface{}) error {
 		return nil
 	}
 
-	bytes, ok := value.([]byte)
-	if !ok {
+	// PostgreSQL drivers return []byte, SQLite may return the column as text
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, j)
+	case string:
+		return json.Unmarshal([]byte(v), j)
+	default:
 		return fmt.Errorf("failed to unmarshal JSONB value: %v", value)
 	}
+}
+
+// StringList is a list of strings stored as a comma-separated text column
+type StringList []string
+
+// Value implements the driver.Valuer interface for StringList
+func (l StringList) Value() (driver.Value, error) {
+	return strings.Join(l, ","), nil
+}
+
+// Scan implements the sql.Scanner interface for StringList
+func (l *StringList) Scan(value interface{}) error {
+	var text string
+	switch v := value.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		text = string(v)
+	case string:
+		text = v
+	default:
+		return fmt.Errorf("failed to scan string list value: %v", value)
+	}
 
-	return json.Unmarshal(bytes, j)
+	if text == "" {
+		*l = StringList{}
+		return nil
+	}
+	*l = strings.Split(text, ",")
+	return nil
 }
 
 // RepositoryStats represents aggregated statistics for a repository
@@ -107,11 +768,14 @@ type RepositoryStats struct {
 	} `json:"stats"`
 }
 
-// BeforeCreate sets the ID if not already set for User
+// BeforeCreate sets the ID and role if not already set for User
 func (u *User) BeforeCreate(tx *gorm.DB) error {
 	if u.ID == uuid.Nil {
 		u.ID = uuid.New()
 	}
+	if u.Role == "" {
+		u.Role = RoleUser
+	}
 	return nil
 }
 
@@ -131,6 +795,166 @@ func (r *Run) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+// BeforeCreate sets the ID if not already set for Organization
+func (o *Organization) BeforeCreate(tx *gorm.DB) error {
+	if o.ID == uuid.Nil {
+		o.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate sets the ID if not already set for AlertRule
+func (a *AlertRule) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate sets the ID if not already set for APIToken
+func (t *APIToken) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate sets the ID if not already set for NotificationPreference
+func (p *NotificationPreference) BeforeCreate(tx *gorm.DB) error {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate sets the ID if not already set for SavedView
+func (v *SavedView) BeforeCreate(tx *gorm.DB) error {
+	if v.ID == uuid.Nil {
+		v.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate sets the ID if not already set for JobRun
+func (r *JobRun) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate sets the ID if not already set for RetentionReport
+func (r *RetentionReport) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate sets the ID if not already set for CarbonOffset
+func (o *CarbonOffset) BeforeCreate(tx *gorm.DB) error {
+	if o.ID == uuid.Nil {
+		o.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate sets the ID if not already set for EmissionFactor
+func (f *EmissionFactor) BeforeCreate(tx *gorm.DB) error {
+	if f.ID == uuid.Nil {
+		f.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate sets the ID if not already set for EmissionFactorVersion
+func (v *EmissionFactorVersion) BeforeCreate(tx *gorm.DB) error {
+	if v.ID == uuid.Nil {
+		v.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate sets the ID if not already set for RecalculationReport
+func (r *RecalculationReport) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate sets the ID if not already set for AuditEvent
+func (e *AuditEvent) BeforeCreate(tx *gorm.DB) error {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate sets the ID if not already set for Measurement
+func (m *Measurement) BeforeCreate(tx *gorm.DB) error {
+	if m.ID == uuid.Nil {
+		m.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate sets the ID if not already set for StorageReport
+func (r *StorageReport) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate sets the ID if not already set for RunGPU
+func (g *RunGPU) BeforeCreate(tx *gorm.DB) error {
+	if g.ID == uuid.Nil {
+		g.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate sets the ID if not already set for RunTestSuite
+func (t *RunTestSuite) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate sets the ID if not already set for RunComment
+func (c *RunComment) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate sets the ID if not already set for Webhook
+func (w *Webhook) BeforeCreate(tx *gorm.DB) error {
+	if w.ID == uuid.Nil {
+		w.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate sets the ID if not already set for WebhookDelivery
+func (d *WebhookDelivery) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return nil
+}
+
+// BeforeCreate sets the ID if not already set for WebhookDeliveryAttempt
+func (a *WebhookDeliveryAttempt) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
 // TableName returns the table name for User
 func (User) TableName() string {
 	return "users"
@@ -144,4 +968,194 @@ func (Repository) TableName() string {
 // TableName returns the table name for Run
 func (Run) TableName() string {
 	return "runs"
-}
\ No newline at end of file
+}
+
+// TableName returns the table name for Organization
+func (Organization) TableName() string {
+	return "organizations"
+}
+
+// TableName returns the table name for OrganizationMember
+func (OrganizationMember) TableName() string {
+	return "organization_members"
+}
+
+// TableName returns the table name for RepositoryBaseline
+func (RepositoryBaseline) TableName() string {
+	return "repository_baselines"
+}
+
+// TableName returns the table name for RepositoryBudget
+func (RepositoryBudget) TableName() string {
+	return "repository_budgets"
+}
+
+// TableName returns the table name for RepositoryCollaborator
+func (RepositoryCollaborator) TableName() string {
+	return "repository_collaborators"
+}
+
+// TableName returns the table name for Webhook
+func (Webhook) TableName() string {
+	return "webhooks"
+}
+
+// TableName returns the table name for WebhookDelivery
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+// TableName returns the table name for WebhookDeliveryAttempt
+func (WebhookDeliveryAttempt) TableName() string {
+	return "webhook_delivery_attempts"
+}
+
+// TableName returns the table name for OrganizationIntegration
+func (OrganizationIntegration) TableName() string {
+	return "organization_integrations"
+}
+
+// TableName returns the table name for RepositoryNotificationRoute
+func (RepositoryNotificationRoute) TableName() string {
+	return "repository_notification_routes"
+}
+
+// TableName returns the table name for RepositoryDailyRollup
+func (RepositoryDailyRollup) TableName() string {
+	return "repository_daily_rollups"
+}
+
+// TableName returns the table name for RetentionPolicy
+func (RetentionPolicy) TableName() string {
+	return "retention_policies"
+}
+
+// TableName returns the table name for RetentionReport
+func (RetentionReport) TableName() string {
+	return "retention_reports"
+}
+
+// TableName returns the table name for Measurement
+func (Measurement) TableName() string {
+	return "measurements"
+}
+
+// TableName returns the table name for StorageReport
+func (StorageReport) TableName() string {
+	return "storage_reports"
+}
+
+// TableName returns the table name for RepositoryStorageDay
+func (RepositoryStorageDay) TableName() string {
+	return "repository_storage_days"
+}
+
+// TableName returns the table name for RunGPU
+func (RunGPU) TableName() string {
+	return "run_gpus"
+}
+
+// TableName returns the table name for RunImageBuild
+func (RunImageBuild) TableName() string {
+	return "run_image_builds"
+}
+
+// TableName returns the table name for RepositoryLanguage
+func (RepositoryLanguage) TableName() string {
+	return "repository_languages"
+}
+
+// TableName returns the table name for RunTestSuite
+func (RunTestSuite) TableName() string {
+	return "run_test_suites"
+}
+
+// TableName returns the table name for RunComment
+func (RunComment) TableName() string {
+	return "run_comments"
+}
+
+// TableName returns the table name for CarbonOffset
+func (CarbonOffset) TableName() string {
+	return "carbon_offsets"
+}
+
+// TableName returns the table name for EmissionFactor
+func (EmissionFactor) TableName() string {
+	return "emission_factors"
+}
+
+// TableName returns the table name for EmissionFactorVersion
+func (EmissionFactorVersion) TableName() string {
+	return "emission_factor_versions"
+}
+
+// TableName returns the table name for RecalculationReport
+func (RecalculationReport) TableName() string {
+	return "recalculation_reports"
+}
+
+// TableName returns the table name for AuditEvent
+func (AuditEvent) TableName() string {
+	return "audit_events"
+}
+
+// TableName returns the table name for Job
+func (Job) TableName() string {
+	return "jobs"
+}
+
+// TableName returns the table name for JobRun
+func (JobRun) TableName() string {
+	return "job_runs"
+}
+
+// TableName returns the table name for BigQueryExportQueueEntry
+func (BigQueryExportQueueEntry) TableName() string {
+	return "bigquery_export_queue"
+}
+
+// TableName returns the table name for BigQueryExportCursor
+func (BigQueryExportCursor) TableName() string {
+	return "bigquery_export_cursors"
+}
+
+// TableName returns the table name for ArchivePartition
+func (ArchivePartition) TableName() string {
+	return "archive_partitions"
+}
+
+// TableName returns the table name for FeatureFlag
+func (FeatureFlag) TableName() string {
+	return "feature_flags"
+}
+
+// TableName returns the table name for AlertRule
+func (AlertRule) TableName() string {
+	return "alert_rules"
+}
+
+// TableName returns the table name for UserPreference
+func (UserPreference) TableName() string {
+	return "user_preferences"
+}
+
+// TableName returns the table name for GitHubCredential
+func (GitHubCredential) TableName() string {
+	return "github_credentials"
+}
+
+// TableName returns the table name for APIToken
+func (APIToken) TableName() string {
+	return "api_tokens"
+}
+
+// TableName returns the table name for NotificationPreference
+func (NotificationPreference) TableName() string {
+	return "notification_preferences"
+}
+
+// TableName returns the table name for SavedView
+func (SavedView) TableName() string {
+	return "saved_views"
+}
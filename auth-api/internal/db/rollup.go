@@ -0,0 +1,106 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RollupDay returns the UTC day a timestamp is rolled up into
+func RollupDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// AfterCreate adds the run to the daily rollup of its repository within the same
+// transaction, so every ingestion path keeps the rollups consistent with the runs
+func (r *Run) AfterCreate(tx *gorm.DB) error {
+	rollup := RepositoryDailyRollup{
+		RepositoryID:   r.RepositoryID,
+		Day:            RollupDay(r.CreatedAt),
+		RunCount:       1,
+		TotalCO2Kg:     r.CO2Kg,
+		TotalEnergyKWh: r.EnergyKWh,
+		TotalDurationS: r.DurationS,
+		LastRunAt:      r.CreatedAt.UTC(),
+	}
+
+	dialect := DialectOf(tx)
+	err := tx.Session(&gorm.Session{NewDB: true}).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "repository_id"}, {Name: "day"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"run_count":        gorm.Expr("repository_daily_rollups.run_count + excluded.run_count"),
+			"total_co2_kg":     gorm.Expr("repository_daily_rollups.total_co2_kg + excluded.total_co2_kg"),
+			"total_energy_kwh": gorm.Expr("repository_daily_rollups.total_energy_kwh + excluded.total_energy_kwh"),
+			"total_duration_s": gorm.Expr("repository_daily_rollups.total_duration_s + excluded.total_duration_s"),
+			"last_run_at":      gorm.Expr(dialect.Greatest("repository_daily_rollups.last_run_at", "excluded.last_run_at")),
+			"updated_at":       gorm.Expr("excluded.updated_at"),
+		}),
+	}).Create(&rollup).Error
+	if err != nil {
+		return fmt.Errorf("failed to update repository rollup: %w", err)
+	}
+	return nil
+}
+
+// RebuildRollups recomputes the daily rollups of a repository from its runs. It is used
+// after runs are deleted and to backfill repositories whose rollups have drifted; the
+// repository row is locked so concurrent ingestion waits for the rebuild. Rollups of days
+// whose runs were purged by the retention policy are kept as they are.
+func RebuildRollups(tx *gorm.DB, repoID uuid.UUID) error {
+	var repo Repository
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "runs_purged_before").Where("id = ?", repoID).Take(&repo).Error
+	deleted := err == gorm.ErrRecordNotFound
+	if err != nil && !deleted {
+		return fmt.Errorf("failed to lock repository: %w", err)
+	}
+
+	clear := tx.Where("repository_id = ?", repoID)
+	runs := tx.Model(&Run{}).Where("repository_id = ?", repoID)
+	if !deleted && repo.RunsPurgedBefore != nil {
+		clear = clear.Where("day >= ?", *repo.RunsPurgedBefore)
+		runs = runs.Where("created_at >= ?", *repo.RunsPurgedBefore)
+	}
+	if err := clear.Delete(&RepositoryDailyRollup{}).Error; err != nil {
+		return fmt.Errorf("failed to clear repository rollups: %w", err)
+	}
+	if deleted {
+		return nil
+	}
+
+	dayExpr := DialectOf(tx).DateTrunc("day", "created_at")
+	rows, err := runs.
+		Select(dayExpr + " as day, COUNT(*), COALESCE(SUM(co2_kg), 0), COALESCE(SUM(energy_kwh), 0), " +
+			"COALESCE(SUM(duration_s), 0), MAX(created_at)").
+		Group(dayExpr).
+		Rows()
+	if err != nil {
+		return fmt.Errorf("failed to aggregate repository runs: %w", err)
+	}
+	defer rows.Close()
+
+	var rollups []RepositoryDailyRollup
+	for rows.Next() {
+		rollup := RepositoryDailyRollup{RepositoryID: repoID}
+		if err := rows.Scan(ScanTime(&rollup.Day), &rollup.RunCount, &rollup.TotalCO2Kg,
+			&rollup.TotalEnergyKWh, &rollup.TotalDurationS, ScanTime(&rollup.LastRunAt)); err != nil {
+			return fmt.Errorf("failed to scan repository rollup: %w", err)
+		}
+		rollups = append(rollups, rollup)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read repository rollups: %w", err)
+	}
+	rows.Close()
+
+	if len(rollups) == 0 {
+		return nil
+	}
+	if err := tx.CreateInBatches(rollups, 500).Error; err != nil {
+		return fmt.Errorf("failed to store repository rollups: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package energy
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// CgroupCPU reads the CPU time consumed by the cgroup of the current process, which on a CI
+// runner contains the job. Energy is estimated from it with the CPU power coefficients.
+type CgroupCPU struct {
+	dir string
+}
+
+// NewCgroupCPU returns the CPU time meter of the cgroup of the current process on the machine
+// whose /sys and /proc are mounted under root. The root cgroup is used when the process's
+// cgroup cannot be read, such as in containers that hide it.
+func NewCgroupCPU(root string) (*CgroupCPU, error) {
+	v2Path, v1Path := "/", "/"
+	if file, err := os.Open(filepath.Join(root, "proc/self/cgroup")); err == nil {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			// Lines are hierarchy-ID:controllers:path; cgroup v2 has ID 0 and no controllers
+			parts := strings.SplitN(scanner.Text(), ":", 3)
+			if len(parts) != 3 {
+				continue
+			}
+			if parts[0] == "0" && parts[1] == "" {
+				v2Path = parts[2]
+			}
+			for _, controller := range strings.Split(parts[1], ",") {
+				if controller == "cpuacct" {
+					v1Path = parts[2]
+				}
+			}
+		}
+		file.Close()
+	}
+
+	cgroup := filepath.Join(root, "sys/fs/cgroup")
+	for _, dir := range []string{
+		filepath.Join(cgroup, v2Path),
+		cgroup,
+		filepath.Join(cgroup, "cpuacct", v1Path),
+		filepath.Join(cgroup, "cpu,cpuacct", v1Path),
+		filepath.Join(cgroup, "cpuacct"),
+	} {
+		if _, err := CgroupCPUTime(dir); err == nil {
+			return &CgroupCPU{dir: dir}, nil
+		}
+	}
+	return nil, ErrUnavailable
+}
+
+// Method returns MethodCgroupCPU
+func (m *CgroupCPU) Method() string {
+	return MethodCgroupCPU
+}
+
+// Read returns the CPU time of the cgroup
+func (m *CgroupCPU) Read() (Reading, error) {
+	cpuTime, err := CgroupCPUTime(m.dir)
+	if err != nil {
+		return Reading{}, fmt.Errorf("failed to read cgroup CPU time: %w", err)
+	}
+	return Reading{At: time.Now().UTC(), CPUTime: cpuTime}, nil
+}
+
+// CgroupCPUTime returns the cumulative CPU time of the cgroup directory dir, from usage_usec
+// in cpu.stat of cgroup v2 or the nanoseconds in cpuacct.usage of cgroup v1
+func CgroupCPUTime(dir string) (time.Duration, error) {
+	// The cpu controller of cgroup v1 has a cpu.stat too, without usage_usec
+	if data, err := os.ReadFile(filepath.Join(dir, "cpu.stat")); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			var usec uint64
+			if _, err := fmt.Sscanf(line, "usage_usec %d", &usec); err == nil {
+				return time.Duration(usec) * time.Microsecond, nil
+			}
+		}
+	}
+	usage, err := readUint(filepath.Join(dir, "cpuacct.usage"))
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(usage), nil
+}
@@ -0,0 +1,68 @@
+package energy
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DockerSample is one line of `docker stats --no-stream --format '{{json .}}'`
+type DockerSample struct {
+	// CPUs is the CPU usage in CPUs; docker reports 100% per fully used CPU
+	CPUs        float64
+	MemoryBytes float64
+}
+
+// ParseDockerStats parses a line of `docker stats --format '{{json .}}'`
+func ParseDockerStats(line []byte) (DockerSample, error) {
+	var stats struct {
+		CPUPerc  string `json:"CPUPerc"`
+		MemUsage string `json:"MemUsage"`
+	}
+	if err := json.Unmarshal(line, &stats); err != nil {
+		return DockerSample{}, fmt.Errorf("invalid docker stats: %w", err)
+	}
+	// Stopped containers report "--"
+	if stats.CPUPerc == "--" {
+		return DockerSample{}, nil
+	}
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(stats.CPUPerc, "%"), 64)
+	if err != nil {
+		return DockerSample{}, fmt.Errorf("invalid CPU usage %q", stats.CPUPerc)
+	}
+	usage, _, _ := strings.Cut(stats.MemUsage, "/")
+	memory, err := parseSize(strings.TrimSpace(usage))
+	if err != nil {
+		return DockerSample{}, fmt.Errorf("invalid memory usage %q", stats.MemUsage)
+	}
+	return DockerSample{CPUs: percent / 100, MemoryBytes: memory}, nil
+}
+
+// sizeUnits are the units docker formats sizes with, binary for memory and decimal otherwise
+var sizeUnits = map[string]float64{
+	"B":   1,
+	"kB":  1e3,
+	"KB":  1e3,
+	"MB":  1e6,
+	"GB":  1e9,
+	"TB":  1e12,
+	"KiB": 1 << 10,
+	"MiB": 1 << 20,
+	"GiB": 1 << 30,
+	"TiB": 1 << 40,
+}
+
+// parseSize parses a size such as 1.5GiB into bytes
+func parseSize(size string) (float64, error) {
+	number := strings.TrimRightFunc(size, func(r rune) bool { return r < '0' || r > '9' })
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, err
+	}
+	multiplier, ok := sizeUnits[strings.TrimSpace(size[len(number):])]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit in %q", size)
+	}
+	return value * multiplier, nil
+}
@@ -0,0 +1,158 @@
+// Package energy measures the energy a CI job consumes on its runner. It reads the RAPL
+// counters of the powercap interface where the runner exposes them and otherwise estimates
+// the energy from the CPU time of the runner's cgroup.
+package energy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Measurement methods
+const (
+	MethodRAPL      = "rapl"
+	MethodCgroupCPU = "cgroup_cpu"
+)
+
+// CPU power coefficients used to estimate energy from CPU time, the Cloud Carbon Footprint
+// averages for Azure, which hosts the GitHub-hosted runners
+const (
+	IdleWattsPerCPU = 0.78
+	MaxWattsPerCPU  = 3.76
+)
+
+// joulesPerKWh converts joules to kWh
+const joulesPerKWh = 3.6e6
+
+// ErrUnavailable is returned by meters the machine does not support
+var ErrUnavailable = errors.New("energy meter unavailable")
+
+// Counter is the cumulative energy counter of a RAPL zone, which wraps around to zero after
+// reaching MaxMicrojoules
+type Counter struct {
+	Microjoules    uint64 `json:"microjoules"`
+	MaxMicrojoules uint64 `json:"max_microjoules"`
+}
+
+// Reading is the state of a meter at one time
+type Reading struct {
+	At time.Time `json:"at"`
+	// Counters are the RAPL counters by zone
+	Counters map[string]Counter `json:"counters,omitempty"`
+	// CPUTime is the cumulative CPU time of the cgroup
+	CPUTime time.Duration `json:"cpu_time,omitempty"`
+}
+
+// Meter reads an energy source of the machine
+type Meter interface {
+	// Method is the measurement method of the meter, MethodRAPL or MethodCgroupCPU
+	Method() string
+	Read() (Reading, error)
+}
+
+// Detect returns the most accurate meter of the machine whose /sys and /proc are mounted
+// under root ("/" normally): RAPL when its counters are readable, otherwise the CPU time of
+// the cgroup of the current process
+func Detect(root string) (Meter, error) {
+	if meter, err := NewRAPL(filepath.Join(root, "sys/class/powercap")); err == nil {
+		return meter, nil
+	}
+	return NewCgroupCPU(root)
+}
+
+// Session accumulates the energy measured over a CI job. It is saved between the readings,
+// which are taken by separate processes.
+type Session struct {
+	Method    string    `json:"method"`
+	StartedAt time.Time `json:"started_at"`
+	// SamplerPID is the process sampling the counters in the background, if any
+	SamplerPID int     `json:"sampler_pid,omitempty"`
+	Last       Reading `json:"last"`
+	// Joules is the RAPL energy measured since the start
+	Joules float64 `json:"joules"`
+	// CPUs is the number of CPUs the CPU time estimate is spread across
+	CPUs int `json:"cpus"`
+	// StartCPUTime is the CPU time of the cgroup at the start
+	StartCPUTime time.Duration `json:"start_cpu_time,omitempty"`
+}
+
+// NewSession starts a session at the first reading of a meter
+func NewSession(method string, first Reading, cpus int) *Session {
+	return &Session{
+		Method:       method,
+		StartedAt:    first.At,
+		Last:         first,
+		CPUs:         cpus,
+		StartCPUTime: first.CPUTime,
+	}
+}
+
+// Add accumulates the energy consumed since the previous reading. RAPL counters that went
+// backwards wrapped around once; readings must be taken often enough that they cannot wrap
+// twice in between.
+func (s *Session) Add(r Reading) {
+	for zone, counter := range r.Counters {
+		previous, ok := s.Last.Counters[zone]
+		if !ok {
+			continue
+		}
+		delta := counter.Microjoules - previous.Microjoules
+		if counter.Microjoules < previous.Microjoules {
+			delta = previous.MaxMicrojoules - previous.Microjoules + counter.Microjoules
+		}
+		s.Joules += float64(delta) / 1e6
+	}
+	if r.CPUTime == 0 {
+		r.CPUTime = s.Last.CPUTime
+	}
+	s.Last = r
+}
+
+// Duration is the time between the start and the last reading
+func (s *Session) Duration() time.Duration {
+	return s.Last.At.Sub(s.StartedAt)
+}
+
+// EnergyKWh returns the energy consumed since the start: the RAPL energy, or for CPU time
+// the idle power of every CPU over the duration plus the additional power of the busy time
+func (s *Session) EnergyKWh() float64 {
+	if s.Method == MethodRAPL {
+		return s.Joules / joulesPerKWh
+	}
+	busy := (s.Last.CPUTime - s.StartCPUTime).Seconds()
+	joules := float64(s.CPUs)*s.Duration().Seconds()*IdleWattsPerCPU + busy*(MaxWattsPerCPU-IdleWattsPerCPU)
+	return joules / joulesPerKWh
+}
+
+// Save writes the session to path atomically, so readers never see a partial file
+func (s *Session) Save(path string) error {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to encode session: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write session: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write session: %w", err)
+	}
+	return nil
+}
+
+// LoadSession reads a session saved at path
+func LoadSession(path string) (*Session, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session: %w", err)
+	}
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("invalid session %s: %w", path, err)
+	}
+	return &session, nil
+}
@@ -0,0 +1,260 @@
+package energy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeFiles creates files with their contents under root
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+}
+
+func TestRAPL(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"sys/class/powercap/intel-rapl:0/name":                  "package-0\n",
+		"sys/class/powercap/intel-rapl:0/energy_uj":             "1000000\n",
+		"sys/class/powercap/intel-rapl:0/max_energy_range_uj":   "262143328850\n",
+		"sys/class/powercap/intel-rapl:0:0/name":                "core\n",
+		"sys/class/powercap/intel-rapl:0:0/energy_uj":           "500000\n",
+		"sys/class/powercap/intel-rapl:0:0/max_energy_range_uj": "262143328850\n",
+		"sys/class/powercap/intel-rapl:1/name":                  "psys\n",
+		"sys/class/powercap/intel-rapl:1/energy_uj":             "9000000\n",
+		"sys/class/powercap/intel-rapl:1/max_energy_range_uj":   "262143328850\n",
+	})
+
+	meter, err := Detect(root)
+	require.NoError(t, err)
+	assert.Equal(t, MethodRAPL, meter.Method())
+
+	reading, err := meter.Read()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Counter{
+		"intel-rapl:0": {Microjoules: 1000000, MaxMicrojoules: 262143328850},
+	}, reading.Counters)
+
+	t.Run("unavailable", func(t *testing.T) {
+		_, err := NewRAPL(filepath.Join(t.TempDir(), "powercap"))
+		assert.ErrorIs(t, err, ErrUnavailable)
+	})
+}
+
+func TestCgroupCPU(t *testing.T) {
+	t.Run("cgroup v2", func(t *testing.T) {
+		root := t.TempDir()
+		writeFiles(t, root, map[string]string{
+			"proc/self/cgroup": "0::/system.slice/runner.service\n",
+			"sys/fs/cgroup/system.slice/runner.service/cpu.stat": "usage_usec 2500000\nuser_usec 2000000\nsystem_usec 500000\n",
+			"sys/fs/cgroup/cpu.stat":                             "usage_usec 99000000\n",
+		})
+
+		meter, err := Detect(root)
+		require.NoError(t, err)
+		assert.Equal(t, MethodCgroupCPU, meter.Method())
+		reading, err := meter.Read()
+		require.NoError(t, err)
+		assert.Equal(t, 2500*time.Millisecond, reading.CPUTime)
+	})
+
+	t.Run("cgroup v1", func(t *testing.T) {
+		root := t.TempDir()
+		writeFiles(t, root, map[string]string{
+			"proc/self/cgroup": "4:cpu,cpuacct:/docker/abc\n3:memory:/docker/abc\n",
+			"sys/fs/cgroup/cpu,cpuacct/docker/abc/cpuacct.usage": "1500000000\n",
+			"sys/fs/cgroup/cpu,cpuacct/docker/abc/cpu.stat":      "nr_periods 0\nnr_throttled 0\n",
+		})
+
+		meter, err := NewCgroupCPU(root)
+		require.NoError(t, err)
+		reading, err := meter.Read()
+		require.NoError(t, err)
+		assert.Equal(t, 1500*time.Millisecond, reading.CPUTime)
+	})
+
+	t.Run("root cgroup fallback", func(t *testing.T) {
+		root := t.TempDir()
+		writeFiles(t, root, map[string]string{
+			"sys/fs/cgroup/cpu.stat": "usage_usec 1000000\n",
+		})
+
+		meter, err := NewCgroupCPU(root)
+		require.NoError(t, err)
+		reading, err := meter.Read()
+		require.NoError(t, err)
+		assert.Equal(t, time.Second, reading.CPUTime)
+	})
+
+	t.Run("unavailable", func(t *testing.T) {
+		_, err := Detect(t.TempDir())
+		assert.ErrorIs(t, err, ErrUnavailable)
+	})
+}
+
+func TestSession(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("RAPL with wraparound", func(t *testing.T) {
+		session := NewSession(MethodRAPL, Reading{
+			At:       start,
+			Counters: map[string]Counter{"intel-rapl:0": {Microjoules: 900e6, MaxMicrojoules: 1000e6}},
+		}, 2)
+		session.Add(Reading{
+			At:       start.Add(time.Minute),
+			Counters: map[string]Counter{"intel-rapl:0": {Microjoules: 950e6, MaxMicrojoules: 1000e6}},
+		})
+		session.Add(Reading{
+			At:       start.Add(2 * time.Minute),
+			Counters: map[string]Counter{"intel-rapl:0": {Microjoules: 30e6, MaxMicrojoules: 1000e6}},
+		})
+
+		assert.InDelta(t, 130.0, session.Joules, 1e-9)
+		assert.InDelta(t, 130.0/3.6e6, session.EnergyKWh(), 1e-12)
+		assert.Equal(t, 2*time.Minute, session.Duration())
+	})
+
+	t.Run("cgroup CPU estimate", func(t *testing.T) {
+		session := NewSession(MethodCgroupCPU, Reading{At: start, CPUTime: 10 * time.Second}, 2)
+		session.Add(Reading{At: start.Add(100 * time.Second), CPUTime: 70 * time.Second})
+
+		// 2 CPUs idle for 100 s plus 60 s of CPU time above idle
+		joules := 2*100*IdleWattsPerCPU + 60*(MaxWattsPerCPU-IdleWattsPerCPU)
+		assert.InDelta(t, joules/3.6e6, session.EnergyKWh(), 1e-12)
+	})
+
+	t.Run("save and load", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "session.json")
+		session := NewSession(MethodCgroupCPU, Reading{At: start, CPUTime: time.Second}, 4)
+		session.SamplerPID = 1234
+		require.NoError(t, session.Save(path))
+
+		loaded, err := LoadSession(path)
+		require.NoError(t, err)
+		assert.Equal(t, session, loaded)
+
+		_, err = LoadSession(filepath.Join(t.TempDir(), "missing.json"))
+		assert.Error(t, err)
+	})
+}
+
+func TestRegionResolver(t *testing.T) {
+	t.Run("Azure", func(t *testing.T) {
+		azure := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Metadata") != "true" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte("westeurope"))
+		}))
+		defer azure.Close()
+
+		resolver := NewRegionResolver()
+		resolver.AzureURL = azure.URL
+		resolver.AWSURL = "http://127.0.0.1:0"
+		assert.Equal(t, "westeurope", resolver.Resolve(context.Background()))
+	})
+
+	t.Run("AWS", func(t *testing.T) {
+		aws := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == http.MethodPut && r.URL.Path == "/api/token":
+				w.Write([]byte("session-token"))
+			case r.URL.Path == "/dynamic/instance-identity/document" && r.Header.Get("X-aws-ec2-metadata-token") == "session-token":
+				w.Write([]byte(`{"region": "eu-north-1", "instanceType": "c5.large"}`))
+			default:
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		}))
+		defer aws.Close()
+
+		resolver := NewRegionResolver()
+		resolver.AzureURL = aws.URL + "/metadata"
+		resolver.AWSURL = aws.URL
+		assert.Equal(t, "eu-north-1", resolver.Resolve(context.Background()))
+	})
+
+	t.Run("outside of a cloud", func(t *testing.T) {
+		resolver := NewRegionResolver()
+		resolver.AzureURL = "http://127.0.0.1:0"
+		resolver.AWSURL = "http://127.0.0.1:0"
+		assert.Empty(t, resolver.Resolve(context.Background()))
+	})
+}
+
+func TestCarbonIntensity(t *testing.T) {
+	intensity, ok := CarbonIntensity("WestEurope")
+	assert.True(t, ok)
+	assert.Equal(t, 328.0, intensity)
+
+	intensity, ok = CarbonIntensity("mars-1")
+	assert.False(t, ok)
+	assert.Equal(t, DefaultCarbonIntensity, intensity)
+}
+
+func TestParseDockerStats(t *testing.T) {
+	sample, err := ParseDockerStats([]byte(`{"BlockIO":"0B / 0B","CPUPerc":"150.25%","Container":"build","ID":"3c1e9f","MemPerc":"19.63%","MemUsage":"1.5GiB / 7.637GiB","Name":"build","NetIO":"1.2kB / 0B","PIDs":"12"}`))
+	require.NoError(t, err)
+	assert.InDelta(t, 1.5025, sample.CPUs, 1e-9)
+	assert.Equal(t, 1.5*(1<<30), sample.MemoryBytes)
+
+	sample, err = ParseDockerStats([]byte(`{"CPUPerc":"0.00%","MemUsage":"512KiB / 1GiB"}`))
+	require.NoError(t, err)
+	assert.Equal(t, float64(512<<10), sample.MemoryBytes)
+
+	// Stopped containers
+	sample, err = ParseDockerStats([]byte(`{"CPUPerc":"--","MemUsage":"-- / --"}`))
+	require.NoError(t, err)
+	assert.Equal(t, DockerSample{}, sample)
+
+	_, err = ParseDockerStats([]byte(`{"CPUPerc":"1%","MemUsage":"12 parsecs / 1GiB"}`))
+	assert.Error(t, err)
+	_, err = ParseDockerStats([]byte(`Error response from daemon: No such container: build`))
+	assert.Error(t, err)
+}
+
+func TestProfile(t *testing.T) {
+	profile := Profiles[DefaultProfile]
+	// Two busy CPUs and 4 GB of memory
+	assert.InDelta(t, 2*MaxWattsPerCPU+4*MemoryWattsPerGB, profile.ContainerWatts(2, 4), 1e-9)
+}
+
+func TestGPU(t *testing.T) {
+	readings, err := ParseNvidiaSMI([]byte("0, NVIDIA A100-SXM4-40GB, 250.50\n1, NVIDIA A100-SXM4-40GB, [N/A]\n"))
+	require.NoError(t, err)
+	assert.Equal(t, []GPUReading{
+		{Index: 0, Model: "NVIDIA A100-SXM4-40GB", Watts: 250.5},
+		{Index: 1, Model: "NVIDIA A100-SXM4-40GB"},
+	}, readings)
+	_, err = ParseNvidiaSMI([]byte("NVIDIA-SMI has failed because it couldn't communicate with the NVIDIA driver"))
+	assert.Error(t, err)
+
+	// Each power draw is held until the next reading
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	session := NewGPUSession(start, []GPUReading{{Index: 1, Model: "T4", Watts: 60}, {Index: 0, Model: "T4", Watts: 30}})
+	session.Add(start.Add(10*time.Second), []GPUReading{{Index: 0, Model: "T4", Watts: 70}, {Index: 1, Model: "T4", Watts: 0}})
+	session.Add(start.Add(20*time.Second), nil)
+	devices := session.Devices()
+	require.Len(t, devices, 2)
+	assert.Equal(t, GPUDevice{Index: 0, Model: "T4", Joules: 1000}, devices[0])
+	assert.Equal(t, GPUDevice{Index: 1, Model: "T4", Joules: 600}, devices[1])
+	assert.InDelta(t, 1000/3.6e6, devices[0].EnergyKWh(), 1e-12)
+
+	kwh, err := GPUKWh("nvidia-a100", 2, 0.5, time.Hour)
+	require.NoError(t, err)
+	assert.InDelta(t, 0.4, kwh, 1e-9)
+	_, err = GPUKWh("voodoo2", 1, 1, time.Hour)
+	assert.Error(t, err)
+}
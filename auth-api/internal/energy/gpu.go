@@ -0,0 +1,123 @@
+package energy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NvidiaSMIArgs are the nvidia-smi arguments printing the power draw of every GPU in the
+// format ParseNvidiaSMI reads
+var NvidiaSMIArgs = []string{"--query-gpu=index,name,power.draw", "--format=csv,noheader,nounits"}
+
+// GPUProfiles are the board power (TDP) in watts of the GPUs of CI runners by model, used to
+// estimate their energy where their power draw cannot be read
+var GPUProfiles = map[string]float64{
+	"nvidia-t4":   70,
+	"nvidia-l4":   72,
+	"nvidia-a10g": 150,
+	"nvidia-v100": 300,
+	"nvidia-a100": 400,
+	"nvidia-h100": 700,
+}
+
+// GPUKWh estimates the energy of count GPUs of a model in GPUProfiles running at utilization
+// (0 to 1) of their board power for the duration
+func GPUKWh(model string, count int, utilization float64, duration time.Duration) (float64, error) {
+	watts, ok := GPUProfiles[model]
+	if !ok {
+		return 0, fmt.Errorf("unknown GPU model %q", model)
+	}
+	return float64(count) * watts * utilization * duration.Seconds() / joulesPerKWh, nil
+}
+
+// GPUReading is the power draw of one GPU at a time
+type GPUReading struct {
+	Index int
+	Model string
+	Watts float64
+}
+
+// ParseNvidiaSMI parses the output of nvidia-smi with NvidiaSMIArgs, one GPU per line.
+// GPUs that do not report their power draw ("[N/A]") read zero watts.
+func ParseNvidiaSMI(output []byte) ([]GPUReading, error) {
+	var readings []GPUReading
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("invalid nvidia-smi line %q", line)
+		}
+		index, err := strconv.Atoi(strings.TrimSpace(fields[0]))
+		if err != nil || index < 0 {
+			return nil, fmt.Errorf("invalid GPU index in %q", line)
+		}
+		reading := GPUReading{Index: index, Model: strings.TrimSpace(fields[1])}
+		if power := strings.TrimSpace(fields[2]); !strings.HasPrefix(power, "[") {
+			if reading.Watts, err = strconv.ParseFloat(power, 64); err != nil {
+				return nil, fmt.Errorf("invalid GPU power draw in %q", line)
+			}
+		}
+		readings = append(readings, reading)
+	}
+	return readings, nil
+}
+
+// GPUDevice is the energy one GPU consumed over a measurement
+type GPUDevice struct {
+	Index  int
+	Model  string
+	Joules float64
+}
+
+// GPUSession accumulates the energy of each GPU from readings of their power draw, holding
+// the power of a reading until the next
+type GPUSession struct {
+	last    time.Time
+	watts   map[int]float64
+	devices map[int]*GPUDevice
+}
+
+// NewGPUSession starts a session at the first readings of the GPUs
+func NewGPUSession(at time.Time, readings []GPUReading) *GPUSession {
+	s := &GPUSession{watts: map[int]float64{}, devices: map[int]*GPUDevice{}}
+	s.Add(at, readings)
+	return s
+}
+
+// Add accumulates the energy since the previous readings and holds the new power draws
+func (s *GPUSession) Add(at time.Time, readings []GPUReading) {
+	elapsed := at.Sub(s.last).Seconds()
+	if s.last.IsZero() {
+		elapsed = 0
+	}
+	for index, watts := range s.watts {
+		s.devices[index].Joules += watts * elapsed
+	}
+	for _, reading := range readings {
+		if _, ok := s.devices[reading.Index]; !ok {
+			s.devices[reading.Index] = &GPUDevice{Index: reading.Index, Model: reading.Model}
+		}
+		s.watts[reading.Index] = reading.Watts
+	}
+	s.last = at
+}
+
+// Devices returns the energy of each GPU by index
+func (s *GPUSession) Devices() []GPUDevice {
+	devices := make([]GPUDevice, 0, len(s.devices))
+	for index := 0; len(devices) < len(s.devices); index++ {
+		if device, ok := s.devices[index]; ok {
+			devices = append(devices, *device)
+		}
+	}
+	return devices
+}
+
+// EnergyKWh returns the energy of the device in kWh
+func (d GPUDevice) EnergyKWh() float64 {
+	return d.Joules / joulesPerKWh
+}
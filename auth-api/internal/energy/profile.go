@@ -0,0 +1,32 @@
+package energy
+
+// MemoryWattsPerGB is the power of memory in use, the Cloud Carbon Footprint coefficient
+const MemoryWattsPerGB = 0.392
+
+// Profile is the power of the hardware a workload runs on, used to estimate energy where
+// nothing can be measured
+type Profile struct {
+	IdleWattsPerCPU float64
+	MaxWattsPerCPU  float64
+	WattsPerGB      float64
+	// WUELitersPerKWh is the water usage effectiveness the provider reports for its data
+	// centers, zero where it publishes none
+	WUELitersPerKWh float64
+}
+
+// DefaultProfile is the profile of the GitHub-hosted runners
+const DefaultProfile = "azure"
+
+// Profiles are the average vCPU and memory power of the cloud providers, from Cloud Carbon
+// Footprint, and the water usage effectiveness of their 2022 sustainability reports
+var Profiles = map[string]Profile{
+	"aws":   {IdleWattsPerCPU: 0.74, MaxWattsPerCPU: 3.5, WattsPerGB: MemoryWattsPerGB, WUELitersPerKWh: 0.18},
+	"azure": {IdleWattsPerCPU: IdleWattsPerCPU, MaxWattsPerCPU: MaxWattsPerCPU, WattsPerGB: MemoryWattsPerGB, WUELitersPerKWh: 0.49},
+	"gcp":   {IdleWattsPerCPU: 0.71, MaxWattsPerCPU: 4.26, WattsPerGB: MemoryWattsPerGB},
+}
+
+// ContainerWatts estimates the power of a container busy on cpus CPUs with memoryGB of memory
+// in use. The idle power of the host is not attributed to its containers.
+func (p Profile) ContainerWatts(cpus, memoryGB float64) float64 {
+	return cpus*p.MaxWattsPerCPU + memoryGB*p.WattsPerGB
+}
@@ -0,0 +1,82 @@
+package energy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RAPL reads the energy counters of the Intel RAPL (Running Average Power Limit) zones in the
+// powercap interface. Only the package zones are read: their subzones, such as core and dram,
+// are contained in them, and the psys zone covers the packages.
+type RAPL struct {
+	zones []string
+}
+
+// NewRAPL returns the RAPL meter of the powercap directory, usually /sys/class/powercap. It
+// returns ErrUnavailable when no zone is readable, which is the case on most virtual machines
+// and when energy_uj is restricted to root.
+func NewRAPL(powercap string) (*RAPL, error) {
+	matches, _ := filepath.Glob(filepath.Join(powercap, "intel-rapl:*"))
+	meter := &RAPL{}
+	for _, zone := range matches {
+		// Subzones are named intel-rapl:<package>:<subzone>
+		if strings.Count(filepath.Base(zone), ":") != 1 {
+			continue
+		}
+		if name, _ := readString(filepath.Join(zone, "name")); name == "psys" {
+			continue
+		}
+		if _, err := readUint(filepath.Join(zone, "energy_uj")); err != nil {
+			continue
+		}
+		meter.zones = append(meter.zones, zone)
+	}
+	if len(meter.zones) == 0 {
+		return nil, ErrUnavailable
+	}
+	return meter, nil
+}
+
+// Method returns MethodRAPL
+func (m *RAPL) Method() string {
+	return MethodRAPL
+}
+
+// Read returns the counters of every zone
+func (m *RAPL) Read() (Reading, error) {
+	reading := Reading{At: time.Now().UTC(), Counters: make(map[string]Counter, len(m.zones))}
+	for _, zone := range m.zones {
+		energy, err := readUint(filepath.Join(zone, "energy_uj"))
+		if err != nil {
+			return Reading{}, fmt.Errorf("failed to read RAPL zone %s: %w", filepath.Base(zone), err)
+		}
+		max, err := readUint(filepath.Join(zone, "max_energy_range_uj"))
+		if err != nil {
+			return Reading{}, fmt.Errorf("failed to read RAPL zone %s: %w", filepath.Base(zone), err)
+		}
+		reading.Counters[filepath.Base(zone)] = Counter{Microjoules: energy, MaxMicrojoules: max}
+	}
+	return reading, nil
+}
+
+// readString reads a sysfs attribute
+func readString(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// readUint reads a numeric sysfs attribute
+func readUint(path string) (uint64, error) {
+	value, err := readString(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
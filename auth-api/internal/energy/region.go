@@ -0,0 +1,168 @@
+package energy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultCarbonIntensity is the grid carbon intensity in g CO2e/kWh used for unknown regions,
+// roughly the global average
+const DefaultCarbonIntensity = 400.0
+
+// carbonIntensity is the grid carbon intensity in g CO2e/kWh of the cloud regions CI runners
+// run in, from the Cloud Carbon Footprint emission factors
+var carbonIntensity = map[string]float64{
+	// Azure, which hosts the GitHub-hosted runners
+	"australiaeast":      790,
+	"brazilsouth":        74,
+	"canadacentral":      120,
+	"centralindia":       708,
+	"centralus":          426,
+	"eastasia":           710,
+	"eastus":             379,
+	"eastus2":            379,
+	"francecentral":      52,
+	"germanywestcentral": 338,
+	"japaneast":          466,
+	"koreacentral":       500,
+	"northcentralus":     426,
+	"northeurope":        278,
+	"norwayeast":         8,
+	"southcentralus":     373,
+	"southeastasia":      408,
+	"swedencentral":      8,
+	"switzerlandnorth":   11,
+	"uksouth":            228,
+	"westcentralus":      589,
+	"westeurope":         328,
+	"westus":             240,
+	"westus2":            240,
+	"westus3":            451,
+	// AWS, which hosts most self-hosted runners
+	"ap-northeast-1": 466,
+	"ap-south-1":     708,
+	"ap-southeast-1": 408,
+	"ap-southeast-2": 790,
+	"ca-central-1":   120,
+	"eu-central-1":   338,
+	"eu-north-1":     8,
+	"eu-west-1":      278,
+	"eu-west-2":      228,
+	"eu-west-3":      52,
+	"sa-east-1":      74,
+	"us-east-1":      379,
+	"us-east-2":      411,
+	"us-west-1":      240,
+	"us-west-2":      136,
+}
+
+// CarbonIntensity returns the grid carbon intensity in g CO2e/kWh of a region and whether the
+// region is known; unknown regions get DefaultCarbonIntensity
+func CarbonIntensity(region string) (float64, bool) {
+	if intensity, ok := carbonIntensity[strings.ToLower(region)]; ok {
+		return intensity, true
+	}
+	return DefaultCarbonIntensity, false
+}
+
+// Instance metadata endpoints the region of the runner is resolved from
+const (
+	AzureMetadataURL = "http://169.254.169.254/metadata/instance/compute/location?api-version=2021-02-01&format=text"
+	AWSMetadataURL   = "http://169.254.169.254/latest"
+)
+
+// RegionResolver resolves the cloud region of the runner from the instance metadata service
+// of Azure, then of AWS
+type RegionResolver struct {
+	AzureURL string
+	AWSURL   string
+	// Timeout bounds every metadata request, so runners outside a cloud are not held up
+	Timeout time.Duration
+	Client  *http.Client
+}
+
+// NewRegionResolver returns a resolver for the standard metadata endpoints
+func NewRegionResolver() *RegionResolver {
+	return &RegionResolver{
+		AzureURL: AzureMetadataURL,
+		AWSURL:   AWSMetadataURL,
+		Timeout:  time.Second,
+		Client:   &http.Client{},
+	}
+}
+
+// Resolve returns the region of the runner, or an empty string outside of Azure and AWS
+func (r *RegionResolver) Resolve(ctx context.Context) string {
+	if region, err := r.azure(ctx); err == nil && region != "" {
+		return region
+	}
+	if region, err := r.aws(ctx); err == nil && region != "" {
+		return region
+	}
+	return ""
+}
+
+// azure reads the location of the VM from the Azure instance metadata service
+func (r *RegionResolver) azure(ctx context.Context) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, r.AzureURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata", "true")
+	body, err := r.do(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// aws reads the region of the instance from the AWS instance metadata service, with an
+// IMDSv2 session token
+func (r *RegionResolver) aws(ctx context.Context) (string, error) {
+	req, err := http.NewRequest(http.MethodPut, r.AWSURL+"/api/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "60")
+	token, err := r.do(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	req, err = http.NewRequest(http.MethodGet, r.AWSURL+"/dynamic/instance-identity/document", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token", string(token))
+	body, err := r.do(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	var document struct {
+		Region string `json:"region"`
+	}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return "", fmt.Errorf("invalid instance identity document: %w", err)
+	}
+	return document.Region, nil
+}
+
+// do sends a metadata request and returns its body
+func (r *RegionResolver) do(ctx context.Context, req *http.Request) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.Timeout)
+	defer cancel()
+	resp, err := r.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metadata service returned %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+}
@@ -0,0 +1,235 @@
+// Package eventbus publishes carbon events to a Kafka topic or NATS subject per event type,
+// so internal systems can consume runs, budget crossings and repository changes as they
+// happen. Unlike webhooks, events are not stored: events that cannot be published are logged
+// and dropped.
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/cloudevents"
+	"github.com/ecoci/auth-api/internal/webhook"
+)
+
+// Kinds of event bus
+const (
+	KindKafka = "kafka"
+	KindNATS  = "nats"
+)
+
+// EventRepoUpdated is published when the settings or owner of a repository change
+const EventRepoUpdated = "repo.updated"
+
+// Events lists every event type published to the bus
+var Events = []string{webhook.EventRunCreated, webhook.EventRegressionDetected, webhook.EventBudgetExceeded, EventRepoUpdated}
+
+const (
+	// queueSize is the number of events waiting to be published before new ones are dropped
+	queueSize = 1000
+	// sendTimeout bounds the publishing of one event
+	sendTimeout = 30 * time.Second
+)
+
+// Message is an encoded event addressed to a topic
+type Message struct {
+	// Topic is the Kafka topic or NATS subject
+	Topic string
+	// ID identifies the event, for consumers to deduplicate
+	ID string
+	// Key orders the events of a repository: Kafka partitions by it
+	Key string
+	// Headers are the attributes of binary CloudEvents, and the content type of structured ones
+	Headers map[string]string
+	Body    []byte
+}
+
+// Sink sends messages to a broker
+type Sink interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// payload is the JSON body of an event
+type payload struct {
+	ID             uuid.UUID   `json:"id"`
+	Event          string      `json:"event"`
+	CreatedAt      time.Time   `json:"created_at"`
+	RepositoryID   uuid.UUID   `json:"repository_id"`
+	OrganizationID *uuid.UUID  `json:"organization_id,omitempty"`
+	Data           interface{} `json:"data"`
+}
+
+// Options configure what a publisher publishes
+type Options struct {
+	// Prefix is prepended to the event type to name the topic of an event
+	Prefix string
+	// Events are the event types to publish
+	Events []string
+	// Format is the payload format, one of the webhook formats
+	Format string
+	// SourceURL is the base of the CloudEvents source of repositories
+	SourceURL string
+}
+
+// Publisher publishes events to a sink in the background, in the order they were published.
+// A nil publisher discards events.
+type Publisher struct {
+	sink    Sink
+	options Options
+	events  map[string]bool
+	queue   chan Message
+	pending sync.WaitGroup
+}
+
+// New creates a publisher to the bus of kind at rawURL: the base URL of a Kafka REST proxy, or
+// a nats:// or tls:// server URL
+func New(kind, rawURL string, options Options) (*Publisher, error) {
+	for _, event := range options.Events {
+		if !isEvent(event) {
+			return nil, fmt.Errorf("unknown event %q", event)
+		}
+	}
+	if !webhook.IsValidFormat(options.Format) {
+		return nil, fmt.Errorf("unknown format %q", options.Format)
+	}
+
+	var sink Sink
+	var err error
+	switch kind {
+	case KindKafka:
+		// The v2 API of REST proxies cannot set record headers
+		if options.Format == webhook.FormatCloudEventsBinary {
+			return nil, fmt.Errorf("format %s is not supported by Kafka REST proxies", options.Format)
+		}
+		sink, err = NewKafka(rawURL)
+	case KindNATS:
+		sink, err = NewNATS(rawURL)
+	default:
+		return nil, fmt.Errorf("unknown event bus %q", kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return NewPublisher(sink, options), nil
+}
+
+// NewPublisher creates a publisher of events to sink
+func NewPublisher(sink Sink, options Options) *Publisher {
+	p := &Publisher{
+		sink:    sink,
+		options: options,
+		events:  map[string]bool{},
+		queue:   make(chan Message, queueSize),
+	}
+	for _, event := range options.Events {
+		p.events[event] = true
+	}
+	go p.run()
+	return p
+}
+
+// isEvent reports whether event is published to the bus
+func isEvent(event string) bool {
+	for _, supported := range Events {
+		if event == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// Topic returns the topic events of a type are published to
+func (p *Publisher) Topic(event string) string {
+	return p.options.Prefix + event
+}
+
+// Publish queues event for publishing if the publisher is configured for its type. Events
+// are dropped when the queue is full, so a slow broker never delays the caller.
+func (p *Publisher) Publish(event webhook.Event) {
+	if p == nil || !p.events[event.Type] {
+		return
+	}
+
+	msg, err := p.encode(uuid.New(), event, time.Now().UTC())
+	if err != nil {
+		log.Printf("Failed to encode %s event: %v", event.Type, err)
+		return
+	}
+
+	p.pending.Add(1)
+	select {
+	case p.queue <- msg:
+	default:
+		p.pending.Done()
+		log.Printf("Dropped %s event for repository %s: event bus queue is full", event.Type, event.RepositoryID)
+	}
+}
+
+// encode returns the message of an event in the format of the publisher
+func (p *Publisher) encode(id uuid.UUID, event webhook.Event, now time.Time) (Message, error) {
+	msg := Message{Topic: p.Topic(event.Type), ID: id.String(), Key: event.RepositoryID.String()}
+
+	if p.options.Format == webhook.FormatCloudEventsStructured || p.options.Format == webhook.FormatCloudEventsBinary {
+		source := cloudevents.Source(p.options.SourceURL, event.RepositoryID.String())
+		ce, err := cloudevents.New(msg.ID, event.Type, source, event.Subject, now, event.Data)
+		if err != nil {
+			return msg, err
+		}
+		if p.options.Format == webhook.FormatCloudEventsBinary {
+			msg.Headers, msg.Body = ce.Binary()
+			return msg, nil
+		}
+		msg.Headers = map[string]string{"Content-Type": cloudevents.ContentTypeStructured}
+		msg.Body, err = ce.Structured()
+		return msg, err
+	}
+
+	body, err := json.Marshal(payload{
+		ID:             id,
+		Event:          event.Type,
+		CreatedAt:      now,
+		RepositoryID:   event.RepositoryID,
+		OrganizationID: event.OrganizationID,
+		Data:           event.Data,
+	})
+	if err != nil {
+		return msg, err
+	}
+	msg.Body = body
+	return msg, nil
+}
+
+// Wait blocks until all queued events have been published or dropped
+func (p *Publisher) Wait() {
+	if p != nil {
+		p.pending.Wait()
+	}
+}
+
+// run publishes the queued events one at a time
+func (p *Publisher) run() {
+	for msg := range p.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		if err := p.sink.Send(ctx, msg); err != nil {
+			log.Printf("Failed to publish event %s to %s: %v", msg.ID, msg.Topic, err)
+		}
+		cancel()
+		p.pending.Done()
+	}
+}
+
+// userinfo returns the credentials of a URL
+func userinfo(u *url.URL) (username, password string, ok bool) {
+	if u.User == nil {
+		return "", "", false
+	}
+	password, _ = u.User.Password()
+	return u.User.Username(), password, true
+}
@@ -0,0 +1,267 @@
+package eventbus
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ecoci/auth-api/internal/webhook"
+)
+
+// recordingSink keeps the messages sent to it
+type recordingSink struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (r *recordingSink) Send(ctx context.Context, msg Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.messages = append(r.messages, msg)
+	return nil
+}
+
+func TestPublisher(t *testing.T) {
+	sink := &recordingSink{}
+	publisher := NewPublisher(sink, Options{Prefix: "ecoci.", Events: []string{webhook.EventRunCreated, EventRepoUpdated}, Format: webhook.FormatEcoCI})
+
+	repoID := uuid.New()
+	orgID := uuid.New()
+	publisher.Publish(webhook.Event{Type: webhook.EventRunCreated, RepositoryID: repoID, OrganizationID: &orgID, Data: map[string]interface{}{"co2_kg": 0.5}})
+	publisher.Publish(webhook.Event{Type: webhook.EventBudgetExceeded, RepositoryID: repoID})
+	publisher.Publish(webhook.Event{Type: EventRepoUpdated, RepositoryID: repoID, Data: map[string]interface{}{"public_stats": true}})
+	publisher.Wait()
+
+	// Event types the publisher is not configured for are skipped
+	require.Len(t, sink.messages, 2)
+	msg := sink.messages[0]
+	assert.Equal(t, "ecoci.run.created", msg.Topic)
+	assert.Equal(t, repoID.String(), msg.Key)
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(msg.Body, &body))
+	assert.Equal(t, msg.ID, body["id"])
+	assert.Equal(t, "run.created", body["event"])
+	assert.Equal(t, repoID.String(), body["repository_id"])
+	assert.Equal(t, orgID.String(), body["organization_id"])
+	assert.Equal(t, map[string]interface{}{"co2_kg": 0.5}, body["data"])
+	assert.Equal(t, "ecoci.repo.updated", sink.messages[1].Topic)
+
+	// A nil publisher discards events
+	var disabled *Publisher
+	disabled.Publish(webhook.Event{Type: webhook.EventRunCreated, RepositoryID: repoID})
+	disabled.Wait()
+
+	_, err := New(KindKafka, "http://kafka-rest:8082", Options{Events: []string{"run.deleted"}, Format: webhook.FormatEcoCI})
+	assert.EqualError(t, err, `unknown event "run.deleted"`)
+	_, err = New("rabbitmq", "amqp://rabbit", Options{Events: Events, Format: webhook.FormatEcoCI})
+	assert.EqualError(t, err, `unknown event bus "rabbitmq"`)
+	_, err = New(KindNATS, "http://nats:4222", Options{Events: Events, Format: webhook.FormatEcoCI})
+	assert.EqualError(t, err, `invalid NATS URL "http://nats:4222"`)
+	_, err = New(KindKafka, "http://kafka-rest:8082", Options{Events: Events, Format: webhook.FormatCloudEventsBinary})
+	assert.EqualError(t, err, "format cloudevents-binary is not supported by Kafka REST proxies")
+}
+
+func TestPublisherCloudEvents(t *testing.T) {
+	repoID := uuid.New()
+	event := webhook.Event{Type: webhook.EventRunCreated, RepositoryID: repoID, Subject: "runs/42", Data: map[string]interface{}{"co2_kg": 0.5}}
+
+	sink := &recordingSink{}
+	structured := NewPublisher(sink, Options{Prefix: "ecoci.", Events: Events, Format: webhook.FormatCloudEventsStructured, SourceURL: "https://ecoci.dev/"})
+	structured.Publish(event)
+	structured.Wait()
+	require.Len(t, sink.messages, 1)
+	msg := sink.messages[0]
+	assert.Equal(t, map[string]string{"Content-Type": "application/cloudevents+json"}, msg.Headers)
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(msg.Body, &body))
+	assert.Equal(t, "1.0", body["specversion"])
+	assert.Equal(t, msg.ID, body["id"])
+	assert.Equal(t, "dev.ecoci.run.created", body["type"])
+	assert.Equal(t, "https://ecoci.dev/repos/"+repoID.String(), body["source"])
+	assert.Equal(t, "runs/42", body["subject"])
+	assert.Equal(t, map[string]interface{}{"co2_kg": 0.5}, body["data"])
+
+	sink = &recordingSink{}
+	binary := NewPublisher(sink, Options{Prefix: "ecoci.", Events: Events, Format: webhook.FormatCloudEventsBinary, SourceURL: "https://ecoci.dev"})
+	binary.Publish(event)
+	binary.Wait()
+	require.Len(t, sink.messages, 1)
+	msg = sink.messages[0]
+	assert.Equal(t, msg.ID, msg.Headers["ce-id"])
+	assert.Equal(t, "dev.ecoci.run.created", msg.Headers["ce-type"])
+	assert.Equal(t, "https://ecoci.dev/repos/"+repoID.String(), msg.Headers["ce-source"])
+	assert.Equal(t, "runs/42", msg.Headers["ce-subject"])
+	assert.Equal(t, "application/json", msg.Headers["Content-Type"])
+	assert.JSONEq(t, `{"co2_kg":0.5}`, string(msg.Body))
+}
+
+func TestKafka(t *testing.T) {
+	var requests []*http.Request
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r)
+		bodies = append(bodies, string(body))
+		switch r.URL.Path {
+		case "/topics/ecoci.run.created":
+			io.WriteString(w, `{"offsets":[{"partition":0,"offset":41,"error_code":null,"error":null}]}`)
+		case "/topics/ecoci.repo.updated":
+			io.WriteString(w, `{"offsets":[{"partition":null,"offset":null,"error_code":1,"error":"Record too large"}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"error_code":40401,"message":"Topic not found."}`)
+		}
+	}))
+	defer server.Close()
+
+	kafka, err := NewKafka(strings.Replace(server.URL, "http://", "http://ecoci:secret@", 1))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, kafka.Send(ctx, Message{Topic: "ecoci.run.created", ID: "1", Key: "repo-1", Body: []byte(`{"event":"run.created"}`)}))
+	req := requests[0]
+	assert.Equal(t, http.MethodPost, req.Method)
+	assert.Equal(t, kafkaContentType, req.Header.Get("Content-Type"))
+	username, password, ok := req.BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "ecoci", username)
+	assert.Equal(t, "secret", password)
+	assert.JSONEq(t, `{"records":[{"key":"repo-1","value":{"event":"run.created"}}]}`, bodies[0])
+
+	err = kafka.Send(ctx, Message{Topic: "ecoci.repo.updated", Key: "repo-1", Body: []byte(`{}`)})
+	assert.EqualError(t, err, "record rejected: Record too large")
+	err = kafka.Send(ctx, Message{Topic: "ecoci.budget.exceeded", Key: "repo-1", Body: []byte(`{}`)})
+	assert.EqualError(t, err, "unexpected response status 404: Topic not found.")
+
+	_, err = NewKafka("kafka:9092")
+	assert.Error(t, err)
+}
+
+// fakeNATS is a NATS server that records the messages published to it. The first connection
+// is closed after confirming one message, to make the client reconnect.
+type fakeNATS struct {
+	listener    net.Listener
+	mu          sync.Mutex
+	connects    []map[string]interface{}
+	published   []string
+	connections int
+}
+
+func newFakeNATS(t *testing.T) *fakeNATS {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	fake := &fakeNATS{listener: listener}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go fake.serve(conn)
+		}
+	}()
+	return fake
+}
+
+func (f *fakeNATS) serve(conn net.Conn) {
+	defer conn.Close()
+	f.mu.Lock()
+	f.connections++
+	first := f.connections == 1
+	f.mu.Unlock()
+
+	fmt.Fprintf(conn, "INFO {\"server_id\":\"fake\",\"headers\":true,\"max_payload\":1048576}\r\n")
+	reader := bufio.NewReader(conn)
+	published := 0
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		switch fields[0] {
+		case "CONNECT":
+			var options map[string]interface{}
+			json.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(line), "CONNECT ")), &options)
+			f.mu.Lock()
+			f.connects = append(f.connects, options)
+			f.mu.Unlock()
+		case "PING":
+			io.WriteString(conn, "PONG\r\n")
+			if first && published == 1 {
+				return
+			}
+		case "HPUB":
+			size, _ := strconv.Atoi(fields[3])
+			data := make([]byte, size+2)
+			io.ReadFull(reader, data)
+			if strings.HasPrefix(fields[1], "forbidden.") {
+				io.WriteString(conn, "-ERR 'Permissions Violation for Publish to \""+fields[1]+"\"'\r\n")
+				continue
+			}
+			published++
+			f.mu.Lock()
+			f.published = append(f.published, fields[1]+" "+string(data[:size]))
+			f.mu.Unlock()
+		}
+	}
+}
+
+func TestNATS(t *testing.T) {
+	fake := newFakeNATS(t)
+	nats, err := NewNATS("nats://s3cret@" + fake.listener.Addr().String())
+	require.NoError(t, err)
+	defer nats.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	require.NoError(t, nats.Send(ctx, Message{Topic: "ecoci.run.created", ID: "id-1", Body: []byte(`{"n":1}`)}))
+	// The server closed the connection since; the message is published on a new one
+	require.NoError(t, nats.Send(ctx, Message{Topic: "ecoci.run.created", ID: "id-2", Body: []byte(`{"n":2}`)}))
+	require.NoError(t, nats.Send(ctx, Message{Topic: "ecoci.repo.updated", ID: "id-3", Body: []byte(`{"n":3}`)}))
+
+	fake.mu.Lock()
+	assert.Equal(t, []string{
+		"ecoci.run.created NATS/1.0\r\nNats-Msg-Id: id-1\r\n\r\n{\"n\":1}",
+		"ecoci.run.created NATS/1.0\r\nNats-Msg-Id: id-2\r\n\r\n{\"n\":2}",
+		"ecoci.repo.updated NATS/1.0\r\nNats-Msg-Id: id-3\r\n\r\n{\"n\":3}",
+	}, fake.published)
+	require.Len(t, fake.connects, 2)
+	assert.Equal(t, "s3cret", fake.connects[0]["auth_token"])
+	assert.Equal(t, true, fake.connects[0]["headers"])
+	fake.mu.Unlock()
+
+	err = nats.Send(ctx, Message{Topic: "forbidden.run.created", ID: "id-4", Body: []byte(`{}`)})
+	assert.ErrorContains(t, err, `server error: Permissions Violation for Publish to "forbidden.run.created"`)
+
+	// Headers follow the message ID, sorted by name
+	require.NoError(t, nats.Send(ctx, Message{Topic: "ecoci.run.created", ID: "id-5", Headers: map[string]string{"ce-type": "dev.ecoci.run.created", "Content-Type": "application/json"}, Body: []byte(`{}`)}))
+	fake.mu.Lock()
+	assert.Equal(t, "ecoci.run.created NATS/1.0\r\nNats-Msg-Id: id-5\r\nContent-Type: application/json\r\nce-type: dev.ecoci.run.created\r\n\r\n{}", fake.published[len(fake.published)-1])
+	fake.mu.Unlock()
+
+	// Without header support, only self-describing messages can be published
+	noHeaders := &NATS{conn: discardConn{}, headers: false}
+	err = noHeaders.send(ctx, Message{Topic: "ecoci.run.created", Headers: map[string]string{"ce-type": "dev.ecoci.run.created"}, Body: []byte(`{}`)})
+	assert.EqualError(t, err, "the server does not support message headers")
+}
+
+// discardConn is a connection the tests never write to
+type discardConn struct{ net.Conn }
+
+func (discardConn) SetDeadline(time.Time) error { return nil }
@@ -0,0 +1,114 @@
+package eventbus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ecoci/auth-api/internal/tracing"
+)
+
+// Content types of the Kafka REST proxy API v2
+const (
+	kafkaContentType = "application/vnd.kafka.json.v2+json"
+	kafkaAccept      = "application/vnd.kafka.v2+json"
+)
+
+// Kafka produces messages through a Kafka REST proxy (v2 API), as served by the Confluent REST
+// Proxy and Redpanda's HTTP proxy. Credentials of the URL are sent as basic authentication.
+type Kafka struct {
+	client   *http.Client
+	baseURL  string
+	username string
+	password string
+	auth     bool
+}
+
+// NewKafka creates a sink producing to the REST proxy at rawURL
+func NewKafka(rawURL string) (*Kafka, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid Kafka REST proxy URL %q", rawURL)
+	}
+	username, password, auth := userinfo(u)
+	u.User = nil
+	return &Kafka{
+		client:   &http.Client{Timeout: sendTimeout, Transport: tracing.Transport(nil)},
+		baseURL:  strings.TrimRight(u.String(), "/"),
+		username: username,
+		password: password,
+		auth:     auth,
+	}, nil
+}
+
+// kafkaRecords is the body of a produce request
+type kafkaRecords struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+type kafkaRecord struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// kafkaResponse is the response of a produce request: the offset of each record, with an
+// error for the records that failed, or the error of the whole request
+type kafkaResponse struct {
+	Offsets []struct {
+		ErrorCode *int    `json:"error_code"`
+		Error     *string `json:"error"`
+	} `json:"offsets"`
+	ErrorCode int    `json:"error_code"`
+	Message   string `json:"message"`
+}
+
+// Send implements Sink
+func (k *Kafka) Send(ctx context.Context, msg Message) error {
+	body, err := json.Marshal(kafkaRecords{Records: []kafkaRecord{{Key: msg.Key, Value: msg.Body}}})
+	if err != nil {
+		return fmt.Errorf("failed to encode records: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, k.baseURL+"/topics/"+url.PathEscape(msg.Topic), bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", kafkaContentType)
+	req.Header.Set("Accept", kafkaAccept)
+	if k.auth {
+		req.SetBasicAuth(k.username, k.password)
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	var result kafkaResponse
+	decodeErr := json.Unmarshal(data, &result)
+	if resp.StatusCode != http.StatusOK {
+		if decodeErr == nil && result.Message != "" {
+			return fmt.Errorf("unexpected response status %d: %s", resp.StatusCode, result.Message)
+		}
+		return fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	}
+	if decodeErr != nil {
+		return fmt.Errorf("failed to decode response: %w", decodeErr)
+	}
+	for _, offset := range result.Offsets {
+		if offset.ErrorCode != nil || offset.Error != nil {
+			message := "unknown error"
+			if offset.Error != nil {
+				message = *offset.Error
+			}
+			return fmt.Errorf("record rejected: %s", message)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+package eventbus
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// natsDefaultPort is the client port of NATS servers
+const natsDefaultPort = "4222"
+
+// NATS publishes messages to a NATS server over its client protocol. Each message is
+// confirmed with a PING round trip, so errors of the server, such as missing permissions, are
+// reported for the message that caused them. The connection is opened on the first message
+// and reopened after errors.
+type NATS struct {
+	addr     string
+	host     string
+	tls      bool
+	username string
+	password string
+	auth     bool
+
+	mu      sync.Mutex
+	conn    net.Conn
+	reader  *bufio.Reader
+	headers bool
+}
+
+// NewNATS creates a sink publishing to the server at rawURL: nats://host:port, or tls:// to
+// require TLS. A URL with a username and password authenticates with them, one with only a
+// username authenticates with it as a token.
+func NewNATS(rawURL string) (*NATS, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "nats" && u.Scheme != "tls") || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid NATS URL %q", rawURL)
+	}
+	port := u.Port()
+	if port == "" {
+		port = natsDefaultPort
+	}
+	username, password, auth := userinfo(u)
+	return &NATS{
+		addr:     net.JoinHostPort(u.Hostname(), port),
+		host:     u.Hostname(),
+		tls:      u.Scheme == "tls",
+		username: username,
+		password: password,
+		auth:     auth,
+	}, nil
+}
+
+// natsInfo is the part of the INFO message of the server the client uses
+type natsInfo struct {
+	TLSRequired bool `json:"tls_required"`
+	Headers     bool `json:"headers"`
+}
+
+// natsConnect are the options of the CONNECT message
+type natsConnect struct {
+	Verbose     bool   `json:"verbose"`
+	Pedantic    bool   `json:"pedantic"`
+	TLSRequired bool   `json:"tls_required"`
+	Name        string `json:"name"`
+	Lang        string `json:"lang"`
+	Version     string `json:"version"`
+	Protocol    int    `json:"protocol"`
+	Headers     bool   `json:"headers"`
+	User        string `json:"user,omitempty"`
+	Pass        string `json:"pass,omitempty"`
+	AuthToken   string `json:"auth_token,omitempty"`
+}
+
+// Send implements Sink. A message published on a connection the server closed since the
+// previous message is published again on a new connection.
+func (n *NATS) Send(ctx context.Context, msg Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	reused := n.conn != nil
+	err := n.send(ctx, msg)
+	if err != nil && reused && ctx.Err() == nil {
+		err = n.send(ctx, msg)
+	}
+	return err
+}
+
+// send publishes a message, connecting first if needed, and closes the connection on errors
+func (n *NATS) send(ctx context.Context, msg Message) error {
+	if n.conn == nil {
+		if err := n.connect(ctx); err != nil {
+			return err
+		}
+	}
+	deadline, _ := ctx.Deadline()
+	n.conn.SetDeadline(deadline)
+
+	var frame strings.Builder
+	switch {
+	case n.headers:
+		// JetStream deduplicates messages by their ID
+		var header strings.Builder
+		header.WriteString("NATS/1.0\r\n")
+		if msg.ID != "" {
+			header.WriteString("Nats-Msg-Id: " + msg.ID + "\r\n")
+		}
+		names := make([]string, 0, len(msg.Headers))
+		for name := range msg.Headers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			header.WriteString(name + ": " + msg.Headers[name] + "\r\n")
+		}
+		header.WriteString("\r\n")
+		fmt.Fprintf(&frame, "HPUB %s %d %d\r\n%s", msg.Topic, header.Len(), header.Len()+len(msg.Body), header.String())
+	default:
+		// Structured events describe themselves, but binary ones would lose their attributes
+		for name := range msg.Headers {
+			if name != "Content-Type" {
+				return errors.New("the server does not support message headers")
+			}
+		}
+		fmt.Fprintf(&frame, "PUB %s %d\r\n", msg.Topic, len(msg.Body))
+	}
+	frame.Write(msg.Body)
+	frame.WriteString("\r\nPING\r\n")
+
+	if _, err := n.conn.Write([]byte(frame.String())); err != nil {
+		n.close()
+		return fmt.Errorf("failed to publish: %w", err)
+	}
+	if err := n.awaitPong(); err != nil {
+		n.close()
+		return err
+	}
+	return nil
+}
+
+// connect opens a connection, upgrading it to TLS when either side requires it, and
+// authenticates
+func (n *NATS) connect(ctx context.Context) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", n.addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", n.addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	n.conn = conn
+	n.reader = bufio.NewReader(conn)
+
+	line, err := n.readLine()
+	if err != nil {
+		n.close()
+		return fmt.Errorf("failed to read server info: %w", err)
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		n.close()
+		return fmt.Errorf("unexpected greeting %q", line)
+	}
+	var info natsInfo
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info); err != nil {
+		n.close()
+		return fmt.Errorf("failed to decode server info: %w", err)
+	}
+
+	secure := n.tls || info.TLSRequired
+	if secure {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: n.host, MinVersion: tls.VersionTLS12})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			n.close()
+			return fmt.Errorf("TLS handshake failed: %w", err)
+		}
+		n.conn = tlsConn
+		n.reader = bufio.NewReader(tlsConn)
+	}
+
+	options := natsConnect{
+		TLSRequired: secure,
+		Name:        "ecoci",
+		Lang:        "go",
+		Version:     "1.0",
+		Protocol:    1,
+		Headers:     info.Headers,
+	}
+	if n.auth {
+		if n.password != "" {
+			options.User, options.Pass = n.username, n.password
+		} else {
+			options.AuthToken = n.username
+		}
+	}
+	encoded, err := json.Marshal(options)
+	if err != nil {
+		n.close()
+		return fmt.Errorf("failed to encode connect options: %w", err)
+	}
+	if _, err := n.conn.Write([]byte("CONNECT " + string(encoded) + "\r\nPING\r\n")); err != nil {
+		n.close()
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	if err := n.awaitPong(); err != nil {
+		n.close()
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	n.headers = info.Headers
+	return nil
+}
+
+// awaitPong reads messages until the PONG answering a PING, answering the PINGs of the server
+// and returning the errors it reports
+func (n *NATS) awaitPong() error {
+	for {
+		line, err := n.readLine()
+		if err != nil {
+			return fmt.Errorf("failed to read server response: %w", err)
+		}
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := n.conn.Write([]byte("PONG\r\n")); err != nil {
+				return fmt.Errorf("failed to answer ping: %w", err)
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.New("server error: " + strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")), "'"))
+		}
+		// +OK and INFO updates need no answer
+	}
+}
+
+// readLine reads a line of the protocol without its CRLF
+func (n *NATS) readLine() (string, error) {
+	line, err := n.reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// close closes the connection so the next message opens a new one
+func (n *NATS) close() {
+	if n.conn != nil {
+		n.conn.Close()
+		n.conn = nil
+		n.reader = nil
+	}
+}
+
+// Close closes the connection to the server
+func (n *NATS) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.close()
+	return nil
+}
@@ -0,0 +1,108 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// ManifestFormat identifies carbon history manifests
+const ManifestFormat = "ecoci.carbon-history"
+
+// ManifestVersion is the version of the manifest format written. Readers accept manifests of
+// this version and older ones; fields are only ever added within a version.
+const ManifestVersion = 1
+
+// Manifest is the portable carbon history of a repository: its runs with every measurement
+// and the metadata they were submitted with, to move the history to another EcoCI instance or
+// to another tool
+type Manifest struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+	// Source is the URL of the instance the manifest was exported from
+	Source     string             `json:"source,omitempty"`
+	Repository ManifestRepository `json:"repository"`
+	Runs       []ManifestRun      `json:"runs"`
+}
+
+// ManifestRepository describes the repository of a manifest
+type ManifestRepository struct {
+	FullName    string  `json:"full_name"`
+	Name        string  `json:"name"`
+	Description *string `json:"description,omitempty"`
+	Private     bool    `json:"private"`
+	HTMLURL     string  `json:"html_url"`
+	Language    *string `json:"language,omitempty"`
+}
+
+// ManifestRun is a run of a manifest. The ID is that of the exporting instance, which
+// importers use to skip runs imported before.
+type ManifestRun struct {
+	ID               string                 `json:"id"`
+	CreatedAt        time.Time              `json:"created_at"`
+	EnergyKWh        float64                `json:"energy_kwh"`
+	CO2Kg            float64                `json:"co2_kg"`
+	DurationS        float64                `json:"duration_s"`
+	GitCommitSHA     *string                `json:"git_commit_sha,omitempty"`
+	BranchName       *string                `json:"branch_name,omitempty"`
+	WorkflowName     *string                `json:"workflow_name,omitempty"`
+	WorkflowRunGroup *string                `json:"workflow_run_group,omitempty"`
+	GitTag           *string                `json:"git_tag,omitempty"`
+	Environment      string                 `json:"environment,omitempty"`
+	Metadata         map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// WriteManifest writes the manifest of every run of repo, oldest first. The manifest is
+// assembled before it is written, so failures leave w untouched.
+func WriteManifest(w io.Writer, stats *service.StatsService, repo *db.Repository, source string, now time.Time) error {
+	manifest := Manifest{
+		Format:     ManifestFormat,
+		Version:    ManifestVersion,
+		ExportedAt: now.UTC(),
+		Source:     source,
+		Repository: ManifestRepository{
+			FullName:    repo.FullName,
+			Name:        repo.Name,
+			Description: repo.Description,
+			Private:     repo.Private,
+			HTMLURL:     repo.HTMLURL,
+			Language:    repo.Language,
+		},
+		Runs: []ManifestRun{},
+	}
+
+	err := stats.EachRun(service.RepositoryRuns(repo.ID), time.Time{}, now, func(run *service.RunRow) error {
+		manifest.Runs = append(manifest.Runs, ManifestRun{
+			ID:               run.ID.String(),
+			CreatedAt:        run.CreatedAt.UTC(),
+			EnergyKWh:        run.EnergyKWh,
+			CO2Kg:            run.CO2Kg,
+			DurationS:        run.DurationS,
+			GitCommitSHA:     run.GitCommitSHA,
+			BranchName:       run.BranchName,
+			WorkflowName:     run.WorkflowName,
+			WorkflowRunGroup: run.WorkflowRunGroup,
+			GitTag:           run.GitTag,
+			Environment:      run.Environment,
+			Metadata:         run.RunMetadata,
+		})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if _, err := w.Write(body); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
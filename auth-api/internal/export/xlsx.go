@@ -0,0 +1,192 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// ContentTypeXLSX is the MIME type of Excel workbooks
+const ContentTypeXLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// Sheet names of the report workbook
+const (
+	sheetRuns      = "Runs"
+	sheetMonthly   = "Monthly"
+	sheetWorkflows = "Workflows"
+)
+
+// WriteXLSX writes a report workbook for the runs in scope created between from and to.
+// The workbook contains the raw runs, monthly aggregates and a per-workflow breakdown.
+// Rows are written through excelize stream writers, so large run sheets are buffered on
+// disk rather than held in memory.
+func WriteXLSX(w io.Writer, stats *service.StatsService, scope service.RunScope, from, to time.Time) error {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	if err := f.SetSheetName("Sheet1", sheetRuns); err != nil {
+		return fmt.Errorf("failed to create runs sheet: %w", err)
+	}
+	if err := writeRunsSheet(f, stats, scope, from, to); err != nil {
+		return err
+	}
+
+	if _, err := f.NewSheet(sheetMonthly); err != nil {
+		return fmt.Errorf("failed to create monthly sheet: %w", err)
+	}
+	if err := writeMonthlySheet(f, stats, scope, from, to); err != nil {
+		return err
+	}
+
+	if _, err := f.NewSheet(sheetWorkflows); err != nil {
+		return fmt.Errorf("failed to create workflows sheet: %w", err)
+	}
+	if err := writeWorkflowsSheet(f, stats, scope, from, to); err != nil {
+		return err
+	}
+
+	if err := f.Write(w); err != nil {
+		return fmt.Errorf("failed to write workbook: %w", err)
+	}
+	return nil
+}
+
+// writeRunsSheet writes one row per run
+func writeRunsSheet(f *excelize.File, stats *service.StatsService, scope service.RunScope, from, to time.Time) error {
+	sw, err := f.NewStreamWriter(sheetRuns)
+	if err != nil {
+		return fmt.Errorf("failed to open runs sheet: %w", err)
+	}
+
+	row := 1
+	header := []interface{}{"Created At (UTC)", "Repository", "Workflow", "Branch", "Commit SHA", "Energy (kWh)", "CO2 (kg)", "Duration (s)"}
+	if err := writeRow(sw, row, header); err != nil {
+		return err
+	}
+
+	err = stats.EachRun(scope, from, to, func(run *service.RunRow) error {
+		row++
+		return writeRow(sw, row, []interface{}{
+			run.CreatedAt.UTC().Format("2006-01-02 15:04:05"),
+			run.RepositoryFullName,
+			stringValue(run.WorkflowName),
+			stringValue(run.BranchName),
+			stringValue(run.GitCommitSHA),
+			run.EnergyKWh,
+			run.CO2Kg,
+			run.DurationS,
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write runs sheet: %w", err)
+	}
+
+	if err := sw.Flush(); err != nil {
+		return fmt.Errorf("failed to flush runs sheet: %w", err)
+	}
+	return nil
+}
+
+// writeMonthlySheet writes one row per calendar month with runs
+func writeMonthlySheet(f *excelize.File, stats *service.StatsService, scope service.RunScope, from, to time.Time) error {
+	summaries, err := stats.MonthlySummaries(scope, from, to)
+	if err != nil {
+		return err
+	}
+
+	sw, err := f.NewStreamWriter(sheetMonthly)
+	if err != nil {
+		return fmt.Errorf("failed to open monthly sheet: %w", err)
+	}
+
+	header := []interface{}{"Month", "Runs", "Energy (kWh)", "CO2 (kg)", "Duration (s)"}
+	if err := writeRow(sw, 1, header); err != nil {
+		return err
+	}
+	for i, summary := range summaries {
+		err := writeRow(sw, i+2, []interface{}{
+			summary.From.Format("2006-01"),
+			summary.RunCount,
+			summary.TotalEnergyKWh,
+			summary.TotalCO2Kg,
+			summary.TotalDurationS,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := sw.Flush(); err != nil {
+		return fmt.Errorf("failed to flush monthly sheet: %w", err)
+	}
+	return nil
+}
+
+// writeWorkflowsSheet writes one row per workflow with aggregates and percentiles
+func writeWorkflowsSheet(f *excelize.File, stats *service.StatsService, scope service.RunScope, from, to time.Time) error {
+	workflows, err := stats.WorkflowStats(scope, from, to)
+	if err != nil {
+		return err
+	}
+
+	sw, err := f.NewStreamWriter(sheetWorkflows)
+	if err != nil {
+		return fmt.Errorf("failed to open workflows sheet: %w", err)
+	}
+
+	header := []interface{}{
+		"Workflow", "Runs", "Total CO2 (kg)", "Avg CO2 (kg)", "Total Energy (kWh)", "Avg Duration (s)",
+		"CO2 p50 (kg)", "CO2 p90 (kg)", "CO2 p99 (kg)", "Duration p50 (s)", "Duration p90 (s)", "Duration p99 (s)",
+	}
+	if err := writeRow(sw, 1, header); err != nil {
+		return err
+	}
+	for i, workflow := range workflows {
+		err := writeRow(sw, i+2, []interface{}{
+			stringValue(workflow.WorkflowName),
+			workflow.RunCount,
+			workflow.TotalCO2Kg,
+			workflow.AvgCO2Kg,
+			workflow.TotalEnergyKWh,
+			workflow.AvgDurationS,
+			workflow.Percentiles.CO2Kg.P50,
+			workflow.Percentiles.CO2Kg.P90,
+			workflow.Percentiles.CO2Kg.P99,
+			workflow.Percentiles.DurationS.P50,
+			workflow.Percentiles.DurationS.P90,
+			workflow.Percentiles.DurationS.P99,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := sw.Flush(); err != nil {
+		return fmt.Errorf("failed to flush workflows sheet: %w", err)
+	}
+	return nil
+}
+
+// writeRow writes values starting in column A of the given row
+func writeRow(sw *excelize.StreamWriter, row int, values []interface{}) error {
+	cell, err := excelize.CoordinatesToCellName(1, row)
+	if err != nil {
+		return fmt.Errorf("failed to resolve cell: %w", err)
+	}
+	if err := sw.SetRow(cell, values); err != nil {
+		return fmt.Errorf("failed to write row %d: %w", row, err)
+	}
+	return nil
+}
+
+// stringValue returns the value of an optional string or an empty string
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
@@ -0,0 +1,353 @@
+// Package filter parses filter expressions such as
+//
+//	co2_kg>0.5 AND branch=main AND tag IN (nightly,release)
+//
+// into SQL conditions. Only the fields a caller declares can be named, each compared with
+// the operators of its type, and every value is bound as a query parameter, so expressions
+// from clients are safe to run.
+//
+// Comparisons are joined with AND and OR, AND binding tighter, negated with NOT and grouped
+// with parentheses. Values are bare words or double-quoted strings with backslash escapes.
+// A field without a value, such as a run without a branch, matches != and NOT IN but no
+// other comparison.
+package filter
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// Limits of an expression
+const (
+	// MaxLength is the longest expression accepted, in bytes
+	MaxLength = 1000
+	// MaxConditions is the most comparisons an expression may have
+	MaxConditions = 20
+	// maxDepth is the deepest nesting of parentheses and NOT accepted
+	maxDepth = 10
+)
+
+// Type is the type of the values of a field
+type Type int
+
+// Types of fields
+const (
+	String Type = iota
+	Number
+	Time
+)
+
+// Field is a field expressions can name
+type Field struct {
+	// Column is the SQL column of the field
+	Column string
+	// Key, when set, is the key of the field in the JSON object stored in Column
+	Key  string
+	Type Type
+}
+
+// expression returns the SQL expression of the field
+func (f Field) expression(dialect db.Dialect) string {
+	if f.Key != "" {
+		return dialect.JSONText(f.Column, f.Key)
+	}
+	return f.Column
+}
+
+// Error is a syntax or validation error of an expression
+type Error struct {
+	// Position is the 1-based position in the expression the error was found at
+	Position int
+	Message  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Message, e.Position)
+}
+
+// Expr is a parsed filter expression
+type Expr struct {
+	root node
+}
+
+// Where returns the SQL condition of the expression with its parameters
+func (e *Expr) Where(dialect db.Dialect) (string, []interface{}) {
+	var b builder
+	e.root.write(dialect, &b)
+	return b.sql.String(), b.args
+}
+
+// Parse parses an expression over fields, keyed by the names expressions use
+func Parse(input string, fields map[string]Field) (*Expr, error) {
+	if len(input) > MaxLength {
+		return nil, &Error{Position: MaxLength + 1, Message: fmt.Sprintf("filter is longer than %d characters", MaxLength)}
+	}
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens, fields: fields}
+	if p.peek().kind == tokenEOF {
+		return nil, &Error{Position: 1, Message: "empty filter"}
+	}
+	root, err := p.or(0)
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.unexpected(t, "AND, OR or end of filter")
+	}
+	return &Expr{root: root}, nil
+}
+
+// node is a node of the syntax tree
+type node interface {
+	write(dialect db.Dialect, b *builder)
+}
+
+// builder accumulates the SQL of a tree
+type builder struct {
+	sql  strings.Builder
+	args []interface{}
+}
+
+// logical joins conditions with AND or OR
+type logical struct {
+	op       string
+	operands []node
+}
+
+func (n *logical) write(dialect db.Dialect, b *builder) {
+	b.sql.WriteString("(")
+	for i, operand := range n.operands {
+		if i > 0 {
+			b.sql.WriteString(" " + n.op + " ")
+		}
+		operand.write(dialect, b)
+	}
+	b.sql.WriteString(")")
+}
+
+// not negates a condition
+type not struct {
+	operand node
+}
+
+func (n *not) write(dialect db.Dialect, b *builder) {
+	b.sql.WriteString("NOT ")
+	n.operand.write(dialect, b)
+}
+
+// comparison compares a field with values
+type comparison struct {
+	field  Field
+	op     string
+	values []interface{}
+}
+
+func (n *comparison) write(dialect db.Dialect, b *builder) {
+	column := n.field.expression(dialect)
+	// Missing values match the negative operators only, also when negated with NOT
+	negative := n.op == "!=" || n.op == "NOT IN"
+	if negative {
+		b.sql.WriteString("(" + column + " IS NULL OR " + column)
+	} else {
+		b.sql.WriteString("(" + column + " IS NOT NULL AND " + column)
+	}
+	switch n.op {
+	case "IN", "NOT IN":
+		b.sql.WriteString(" " + n.op + " (?" + strings.Repeat(", ?", len(n.values)-1) + "))")
+	case "!=":
+		b.sql.WriteString(" <> ?)")
+	default:
+		b.sql.WriteString(" " + n.op + " ?)")
+	}
+	b.args = append(b.args, n.values...)
+}
+
+// parser is a recursive descent parser of the tokens of an expression
+type parser struct {
+	tokens     []token
+	pos        int
+	fields     map[string]Field
+	conditions int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+// or parses conditions joined with OR
+func (p *parser) or(depth int) (node, error) {
+	return p.logical("OR", depth, p.and)
+}
+
+// and parses conditions joined with AND
+func (p *parser) and(depth int) (node, error) {
+	return p.logical("AND", depth, p.unary)
+}
+
+// logical parses operands joined with the keyword op
+func (p *parser) logical(op string, depth int, operand func(int) (node, error)) (node, error) {
+	first, err := operand(depth)
+	if err != nil {
+		return nil, err
+	}
+	operands := []node{first}
+	for p.peek().isKeyword(op) {
+		p.next()
+		next, err := operand(depth)
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, next)
+	}
+	if len(operands) == 1 {
+		return first, nil
+	}
+	return &logical{op: op, operands: operands}, nil
+}
+
+// unary parses a negated or parenthesized condition or a comparison
+func (p *parser) unary(depth int) (node, error) {
+	t := p.peek()
+	if depth >= maxDepth && (t.kind == tokenLParen || t.isKeyword("NOT")) {
+		return nil, &Error{Position: t.pos, Message: fmt.Sprintf("filter is nested deeper than %d levels", maxDepth)}
+	}
+	switch {
+	case t.isKeyword("NOT"):
+		p.next()
+		operand, err := p.unary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return &not{operand: operand}, nil
+	case t.kind == tokenLParen:
+		p.next()
+		inner, err := p.or(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, p.unexpected(closing, ")")
+		}
+		return inner, nil
+	}
+	return p.comparison()
+}
+
+// comparison parses a field, an operator and its values
+func (p *parser) comparison() (node, error) {
+	name := p.next()
+	if name.kind != tokenWord || name.isKeyword("AND", "OR", "IN") {
+		return nil, p.unexpected(name, "a field")
+	}
+	field, ok := p.fields[name.text]
+	if !ok {
+		return nil, &Error{Position: name.pos, Message: fmt.Sprintf("unknown field %q; fields are %s", name.text, strings.Join(p.names(), ", "))}
+	}
+
+	p.conditions++
+	if p.conditions > MaxConditions {
+		return nil, &Error{Position: name.pos, Message: fmt.Sprintf("filter has more than %d conditions", MaxConditions)}
+	}
+
+	n := &comparison{field: field}
+	op := p.next()
+	switch {
+	case op.kind == tokenOperator:
+		if field.Type == String && op.text != "=" && op.text != "!=" {
+			return nil, &Error{Position: op.pos, Message: fmt.Sprintf("field %s only supports =, !=, IN and NOT IN", name.text)}
+		}
+		n.op = op.text
+		value, err := p.value(field)
+		if err != nil {
+			return nil, err
+		}
+		n.values = []interface{}{value}
+		return n, nil
+	case op.isKeyword("IN"):
+		n.op = "IN"
+	case op.isKeyword("NOT") && p.peek().isKeyword("IN"):
+		p.next()
+		n.op = "NOT IN"
+	default:
+		return nil, p.unexpected(op, "an operator")
+	}
+
+	if open := p.next(); open.kind != tokenLParen {
+		return nil, p.unexpected(open, "(")
+	}
+	for {
+		value, err := p.value(field)
+		if err != nil {
+			return nil, err
+		}
+		n.values = append(n.values, value)
+		t := p.next()
+		if t.kind == tokenRParen {
+			return n, nil
+		}
+		if t.kind != tokenComma {
+			return nil, p.unexpected(t, ", or )")
+		}
+	}
+}
+
+// value parses a value of field
+func (p *parser) value(field Field) (interface{}, error) {
+	t := p.next()
+	if t.kind != tokenWord && t.kind != tokenString {
+		return nil, p.unexpected(t, "a value")
+	}
+	switch field.Type {
+	case Number:
+		value, err := strconv.ParseFloat(t.text, 64)
+		if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+			return nil, &Error{Position: t.pos, Message: fmt.Sprintf("invalid number %q", t.text)}
+		}
+		return value, nil
+	case Time:
+		if value, err := time.Parse(time.RFC3339, t.text); err == nil {
+			return value.UTC(), nil
+		}
+		if value, err := time.Parse("2006-01-02", t.text); err == nil {
+			return value, nil
+		}
+		return nil, &Error{Position: t.pos, Message: fmt.Sprintf("invalid time %q, expected RFC3339 or YYYY-MM-DD", t.text)}
+	}
+	return t.text, nil
+}
+
+// unexpected returns the error of finding t instead of what was expected
+func (p *parser) unexpected(t token, expected string) error {
+	found := strconv.Quote(t.text)
+	if t.kind == tokenEOF {
+		found = "end of filter"
+	}
+	return &Error{Position: t.pos, Message: fmt.Sprintf("expected %s, found %s", expected, found)}
+}
+
+// names returns the names of the fields, sorted
+func (p *parser) names() []string {
+	names := make([]string, 0, len(p.fields))
+	for name := range p.fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,93 @@
+package filter
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+func TestParse(t *testing.T) {
+	fields := map[string]Field{
+		"co2_kg":     {Column: "runs.co2_kg", Type: Number},
+		"created_at": {Column: "runs.created_at", Type: Time},
+		"branch":     {Column: "runs.branch_name", Type: String},
+		"tag":        {Column: "runs.run_metadata", Key: "tag", Type: String},
+	}
+	database, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	dialect := db.DialectOf(database)
+
+	where := func(t *testing.T, input string) (string, []interface{}) {
+		expr, err := Parse(input, fields)
+		require.NoError(t, err)
+		return expr.Where(dialect)
+	}
+
+	t.Run("comparisons", func(t *testing.T) {
+		sql, args := where(t, `co2_kg>0.5 AND branch=main AND tag IN (nightly,"release candidate")`)
+		assert.Equal(t, "((runs.co2_kg IS NOT NULL AND runs.co2_kg > ?) AND "+
+			"(runs.branch_name IS NOT NULL AND runs.branch_name = ?) AND "+
+			"(json_extract(runs.run_metadata, '$.tag') IS NOT NULL AND json_extract(runs.run_metadata, '$.tag') IN (?, ?)))", sql)
+		assert.Equal(t, []interface{}{0.5, "main", "nightly", "release candidate"}, args)
+	})
+
+	t.Run("negative operators match missing values", func(t *testing.T) {
+		sql, args := where(t, `branch != main OR tag not in (nightly)`)
+		assert.Equal(t, "((runs.branch_name IS NULL OR runs.branch_name <> ?) OR "+
+			"(json_extract(runs.run_metadata, '$.tag') IS NULL OR json_extract(runs.run_metadata, '$.tag') NOT IN (?)))", sql)
+		assert.Equal(t, []interface{}{"main", "nightly"}, args)
+	})
+
+	t.Run("AND binds tighter than OR", func(t *testing.T) {
+		sql, _ := where(t, `branch=a OR branch=b AND co2_kg<=1`)
+		assert.Equal(t, "((runs.branch_name IS NOT NULL AND runs.branch_name = ?) OR "+
+			"((runs.branch_name IS NOT NULL AND runs.branch_name = ?) AND (runs.co2_kg IS NOT NULL AND runs.co2_kg <= ?)))", sql)
+
+		sql, _ = where(t, `NOT (branch=a OR branch=b) and co2_kg>=1`)
+		assert.Equal(t, "(NOT ((runs.branch_name IS NOT NULL AND runs.branch_name = ?) OR "+
+			"(runs.branch_name IS NOT NULL AND runs.branch_name = ?)) AND (runs.co2_kg IS NOT NULL AND runs.co2_kg >= ?))", sql)
+	})
+
+	t.Run("parses times and quoted values", func(t *testing.T) {
+		_, args := where(t, `created_at>=2024-03-01 AND created_at<2024-03-02T12:00:00+02:00 AND branch="feat/\"quoted\" (1)"`)
+		assert.Equal(t, []interface{}{
+			time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			time.Date(2024, 3, 2, 10, 0, 0, 0, time.UTC),
+			`feat/"quoted" (1)`,
+		}, args)
+	})
+
+	t.Run("rejects invalid expressions", func(t *testing.T) {
+		for input, message := range map[string]string{
+			``:                        "empty filter at position 1",
+			`region=eu`:               `unknown field "region"; fields are branch, co2_kg, created_at, tag at position 1`,
+			`branch>main`:             "field branch only supports =, !=, IN and NOT IN at position 7",
+			`co2_kg>high`:             `invalid number "high" at position 8`,
+			`created_at>yesterday`:    `invalid time "yesterday", expected RFC3339 or YYYY-MM-DD at position 12`,
+			`co2_kg>1 branch=main`:    `expected AND, OR or end of filter, found "branch" at position 10`,
+			`co2_kg>1 AND`:            "expected a field, found end of filter at position 13",
+			`(co2_kg>1`:               "expected ), found end of filter at position 10",
+			`tag IN nightly`:          `expected (, found "nightly" at position 8`,
+			`tag IN (a b)`:            `expected , or ), found "b" at position 11`,
+			`branch="main`:            "unterminated string at position 8",
+			`branch=main; DROP TABLE`: `expected AND, OR or end of filter, found "DROP" at position 14`,
+			`co2_kg!1`:                `unexpected "!" at position 7`,
+			strings.Repeat("(", 11):   "filter is nested deeper than 10 levels at position 11",
+			strings.Repeat("x", 1001): "filter is longer than 1000 characters at position 1001",
+		} {
+			_, err := Parse(input, fields)
+			assert.EqualError(t, err, message, input)
+		}
+
+		conditions := strings.TrimSuffix(strings.Repeat("co2_kg>1 AND ", MaxConditions+1), " AND ")
+		_, err := Parse(conditions, fields)
+		assert.ErrorContains(t, err, "filter has more than 20 conditions")
+	})
+}
@@ -0,0 +1,129 @@
+package filter
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// tokenKind is the kind of a token
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	// tokenWord is a field, keyword or bare value
+	tokenWord
+	// tokenString is a double-quoted value, unescaped
+	tokenString
+	tokenOperator
+	tokenLParen
+	tokenRParen
+	tokenComma
+)
+
+// token is a token of an expression
+type token struct {
+	kind tokenKind
+	text string
+	// pos is the 1-based position of the token
+	pos int
+}
+
+// isKeyword reports whether t is a bare word equal to one of keywords, ignoring case
+func (t token) isKeyword(keywords ...string) bool {
+	if t.kind != tokenWord {
+		return false
+	}
+	for _, keyword := range keywords {
+		if strings.EqualFold(t.text, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// operators are the comparison operators, longest first so they match greedily
+var operators = []string{"!=", "<=", ">=", "=", "<", ">"}
+
+// lex splits an expression into tokens, ending with an EOF token
+func lex(input string) ([]token, error) {
+	var tokens []token
+	i := 0
+	for i < len(input) {
+		r, size := utf8.DecodeRuneInString(input[i:])
+		pos := utf8.RuneCountInString(input[:i]) + 1
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+			continue
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLParen, text: "(", pos: pos})
+			i++
+			continue
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRParen, text: ")", pos: pos})
+			i++
+			continue
+		case r == ',':
+			tokens = append(tokens, token{kind: tokenComma, text: ",", pos: pos})
+			i++
+			continue
+		case r == '"':
+			text, n, err := lexString(input[i:], pos)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, text: text, pos: pos})
+			i += n
+			continue
+		}
+
+		if op := lexOperator(input[i:]); op != "" {
+			tokens = append(tokens, token{kind: tokenOperator, text: op, pos: pos})
+			i += len(op)
+			continue
+		}
+		if r == '!' {
+			return nil, &Error{Position: pos, Message: `unexpected "!"`}
+		}
+
+		start := i
+		for i < len(input) {
+			r, size := utf8.DecodeRuneInString(input[i:])
+			if unicode.IsSpace(r) || strings.ContainsRune(`()",=!<>`, r) {
+				break
+			}
+			i += size
+		}
+		tokens = append(tokens, token{kind: tokenWord, text: input[start:i], pos: pos})
+	}
+	return append(tokens, token{kind: tokenEOF, pos: utf8.RuneCountInString(input) + 1}), nil
+}
+
+// lexOperator returns the operator input starts with, if any
+func lexOperator(input string) string {
+	for _, op := range operators {
+		if strings.HasPrefix(input, op) {
+			return op
+		}
+	}
+	return ""
+}
+
+// lexString reads the double-quoted string input starts with, returning it unescaped and the
+// number of bytes read
+func lexString(input string, pos int) (string, int, error) {
+	var text strings.Builder
+	for i := 1; i < len(input); i++ {
+		switch input[i] {
+		case '"':
+			return text.String(), i + 1, nil
+		case '\\':
+			if i+1 < len(input) {
+				i++
+			}
+		}
+		text.WriteByte(input[i])
+	}
+	return "", 0, &Error{Position: pos, Message: "unterminated string"}
+}
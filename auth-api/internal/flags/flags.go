@@ -0,0 +1,338 @@
+// Package flags evaluates feature flags, so new subsystems can be rolled out gradually. Flags
+// are defined in code with a default; administrators override them at runtime in the
+// feature_flags table to target users and organizations or a percentage of users. The table
+// is cached in memory and re-read every CacheTTL, so changes reach every instance within it.
+package flags
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// CacheTTL is how long the flag states are cached before they are read again
+const CacheTTL = 30 * time.Second
+
+// Flags defined by the API
+const (
+	// Webhooks gates the webhook endpoints
+	Webhooks = "webhooks"
+)
+
+// ErrFlagNotFound is returned for names that are not defined
+var ErrFlagNotFound = errors.New("feature flag not found")
+
+// Definition describes a flag defined in code
+type Definition struct {
+	Name        string
+	Description string
+	// Default applies to everybody until the flag is overridden
+	Default bool
+}
+
+// Flag is a flag with its runtime state
+type Flag struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Default     bool   `json:"default"`
+	// Overridden is false while the flag uses its default
+	Overridden        bool       `json:"overridden"`
+	Enabled           bool       `json:"enabled"`
+	RolloutPercentage int        `json:"rollout_percentage"`
+	UserIDs           []string   `json:"user_ids"`
+	OrganizationIDs   []string   `json:"organization_ids"`
+	UpdatedAt         *time.Time `json:"updated_at,omitempty"`
+}
+
+// Update changes the state of a flag; nil fields are left unchanged
+type Update struct {
+	Enabled           *bool
+	RolloutPercentage *int
+	UserIDs           *[]uuid.UUID
+	OrganizationIDs   *[]uuid.UUID
+}
+
+// Store evaluates the flags defined in code against their cached states
+type Store struct {
+	db          *gorm.DB
+	definitions map[string]*Definition
+
+	mu       sync.Mutex
+	states   map[string]db.FeatureFlag
+	loadedAt time.Time
+}
+
+// NewStore creates a new feature flag store
+func NewStore(database *gorm.DB) *Store {
+	return &Store{
+		db:          database,
+		definitions: make(map[string]*Definition),
+	}
+}
+
+// Register adds a flag definition
+func (s *Store) Register(definition Definition) error {
+	if _, exists := s.definitions[definition.Name]; exists {
+		return fmt.Errorf("feature flag %s is already registered", definition.Name)
+	}
+	s.definitions[definition.Name] = &definition
+	return nil
+}
+
+// Enabled reports whether a flag is on for a user. Flags whose state cannot be read fall
+// back to their default.
+func (s *Store) Enabled(ctx context.Context, name string, userID uuid.UUID) bool {
+	definition, ok := s.definitions[name]
+	if !ok {
+		log.Printf("Warning: evaluating undefined feature flag %s", name)
+		return false
+	}
+
+	states, err := s.load(ctx)
+	if err != nil {
+		log.Printf("Warning: using the default of feature flag %s: %v", name, err)
+		return definition.Default
+	}
+	state, ok := states[name]
+	if !ok {
+		return definition.Default
+	}
+	if !state.Enabled {
+		return false
+	}
+
+	for _, id := range state.UserIDs {
+		if id == userID.String() {
+			return true
+		}
+	}
+	if bucket(name, userID) < state.RolloutPercentage {
+		return true
+	}
+	if len(state.OrganizationIDs) == 0 {
+		return false
+	}
+
+	var members int64
+	err = s.db.WithContext(ctx).Model(&db.OrganizationMember{}).
+		Where("user_id = ? AND organization_id IN ?", userID, []string(state.OrganizationIDs)).
+		Count(&members).Error
+	if err != nil {
+		log.Printf("Warning: failed to check the organizations targeted by feature flag %s: %v", name, err)
+		return false
+	}
+	return members > 0
+}
+
+// EnabledFlags evaluates every flag for a user
+func (s *Store) EnabledFlags(ctx context.Context, userID uuid.UUID) map[string]bool {
+	enabled := make(map[string]bool, len(s.definitions))
+	for name := range s.definitions {
+		enabled[name] = s.Enabled(ctx, name, userID)
+	}
+	return enabled
+}
+
+// bucket places a user in one of 100 buckets of a flag. Buckets are stable, so raising the
+// rollout percentage only adds users, and differ between flags, so the same users are not
+// always the first to get new features.
+func bucket(name string, userID uuid.UUID) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(name))
+	hash.Write(userID[:])
+	return int(hash.Sum32() % 100)
+}
+
+// load returns the cached flag states, reading them again once they are older than CacheTTL.
+// Stale states are kept when they cannot be read.
+func (s *Store) load(ctx context.Context) (map[string]db.FeatureFlag, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.states != nil && time.Since(s.loadedAt) < CacheTTL {
+		return s.states, nil
+	}
+
+	var rows []db.FeatureFlag
+	if err := s.db.WithContext(ctx).Find(&rows).Error; err != nil {
+		if s.states != nil {
+			log.Printf("Warning: using stale feature flags: %v", err)
+			return s.states, nil
+		}
+		return nil, fmt.Errorf("failed to load feature flags: %w", err)
+	}
+
+	states := make(map[string]db.FeatureFlag, len(rows))
+	for _, row := range rows {
+		states[row.Name] = row
+	}
+	s.states = states
+	s.loadedAt = time.Now()
+	return states, nil
+}
+
+// invalidate makes the next evaluation read the flag states again
+func (s *Store) invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states = nil
+}
+
+// List returns the defined flags with their states, ordered by name
+func (s *Store) List() ([]Flag, error) {
+	var rows []db.FeatureFlag
+	if err := s.db.Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to list feature flags: %w", err)
+	}
+	states := make(map[string]*db.FeatureFlag, len(rows))
+	for i := range rows {
+		states[rows[i].Name] = &rows[i]
+	}
+
+	names := make([]string, 0, len(s.definitions))
+	for name := range s.definitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	list := make([]Flag, 0, len(names))
+	for _, name := range names {
+		list = append(list, s.flag(s.definitions[name], states[name]))
+	}
+	return list, nil
+}
+
+// Get returns a defined flag with its state
+func (s *Store) Get(name string) (*Flag, error) {
+	definition, ok := s.definitions[name]
+	if !ok {
+		return nil, ErrFlagNotFound
+	}
+
+	state, err := s.getState(name)
+	if err != nil {
+		return nil, err
+	}
+	flag := s.flag(definition, state)
+	return &flag, nil
+}
+
+// getState returns the stored state of a flag, or nil while it uses its default
+func (s *Store) getState(name string) (*db.FeatureFlag, error) {
+	var state db.FeatureFlag
+	if err := s.db.Where("name = ?", name).Take(&state).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get feature flag: %w", err)
+	}
+	return &state, nil
+}
+
+// flag combines a definition with its stored state, if any
+func (s *Store) flag(definition *Definition, state *db.FeatureFlag) Flag {
+	flag := Flag{
+		Name:            definition.Name,
+		Description:     definition.Description,
+		Default:         definition.Default,
+		Enabled:         definition.Default,
+		UserIDs:         []string{},
+		OrganizationIDs: []string{},
+	}
+	if state == nil {
+		if definition.Default {
+			flag.RolloutPercentage = 100
+		}
+		return flag
+	}
+
+	flag.Overridden = true
+	flag.Enabled = state.Enabled
+	flag.RolloutPercentage = state.RolloutPercentage
+	flag.UserIDs = append(flag.UserIDs, state.UserIDs...)
+	flag.OrganizationIDs = append(flag.OrganizationIDs, state.OrganizationIDs...)
+	flag.UpdatedAt = &state.UpdatedAt
+	return flag
+}
+
+// Update overrides the state of a flag. A flag using its default starts from it: on for
+// everybody when the default is on, and off otherwise.
+func (s *Store) Update(name string, update Update) (*Flag, error) {
+	if _, ok := s.definitions[name]; !ok {
+		return nil, ErrFlagNotFound
+	}
+	if update.RolloutPercentage != nil && (*update.RolloutPercentage < 0 || *update.RolloutPercentage > 100) {
+		return nil, fmt.Errorf("rollout percentage must be between 0 and 100")
+	}
+
+	current, err := s.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	state := db.FeatureFlag{
+		Name:              name,
+		Enabled:           current.Enabled,
+		RolloutPercentage: current.RolloutPercentage,
+		UserIDs:           current.UserIDs,
+		OrganizationIDs:   current.OrganizationIDs,
+	}
+	if update.Enabled != nil {
+		state.Enabled = *update.Enabled
+	}
+	if update.RolloutPercentage != nil {
+		state.RolloutPercentage = *update.RolloutPercentage
+	}
+	if update.UserIDs != nil {
+		state.UserIDs = ids(*update.UserIDs)
+	}
+	if update.OrganizationIDs != nil {
+		state.OrganizationIDs = ids(*update.OrganizationIDs)
+	}
+
+	if current.Overridden {
+		err = s.db.Model(&db.FeatureFlag{Name: name}).Select("enabled", "rollout_percentage", "user_ids", "organization_ids").Updates(&state).Error
+	} else {
+		err = s.db.Create(&state).Error
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update feature flag: %w", err)
+	}
+	s.invalidate()
+
+	return s.Get(name)
+}
+
+// Reset removes the override of a flag, so it uses its default again
+func (s *Store) Reset(name string) (*Flag, error) {
+	if _, ok := s.definitions[name]; !ok {
+		return nil, ErrFlagNotFound
+	}
+	if err := s.db.Where("name = ?", name).Delete(&db.FeatureFlag{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to reset feature flag: %w", err)
+	}
+	s.invalidate()
+
+	return s.Get(name)
+}
+
+// ids formats a list of IDs for storage, without duplicates
+func ids(list []uuid.UUID) db.StringList {
+	seen := make(map[uuid.UUID]bool, len(list))
+	formatted := make(db.StringList, 0, len(list))
+	for _, id := range list {
+		if !seen[id] {
+			seen[id] = true
+			formatted = append(formatted, id.String())
+		}
+	}
+	return formatted
+}
@@ -0,0 +1,149 @@
+// Package github reads repository metadata from the GitHub REST API, such as the languages
+// repositories are written in, and the profiles of users
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ecoci/auth-api/internal/tracing"
+)
+
+// requestTimeout bounds every request to the GitHub API
+const requestTimeout = 10 * time.Second
+
+// ErrNotFound is returned for repositories that do not exist or the token cannot see
+var ErrNotFound = errors.New("repository not found on GitHub")
+
+// ErrUnauthorized is returned when GitHub rejects the token, such as a revoked OAuth token
+var ErrUnauthorized = errors.New("GitHub rejected the token")
+
+// Client reads from the GitHub API, authenticated with token when it is set. Without a token
+// only public repositories can be read, at a lower rate limit.
+type Client struct {
+	client *http.Client
+	apiURL string
+	token  string
+}
+
+// NewClient creates a GitHub API client
+func NewClient(apiURL, token string) *Client {
+	return &Client{
+		client: &http.Client{Timeout: requestTimeout, Transport: tracing.Transport(nil)},
+		apiURL: strings.TrimRight(apiURL, "/"),
+		token:  token,
+	}
+}
+
+// WithToken returns a client of the same API authenticated with token, such as the OAuth
+// token of a user
+func (c *Client) WithToken(token string) *Client {
+	return &Client{client: c.client, apiURL: c.apiURL, token: token}
+}
+
+// User is the GitHub profile of the user a token belongs to
+type User struct {
+	ID        int64   `json:"id"`
+	Login     string  `json:"login"`
+	Name      *string `json:"name"`
+	Email     *string `json:"email"`
+	AvatarURL string  `json:"avatar_url"`
+}
+
+// Repository is the metadata of a GitHub repository
+type Repository struct {
+	ID          int64   `json:"id"`
+	Name        string  `json:"name"`
+	FullName    string  `json:"full_name"`
+	Description *string `json:"description"`
+	Private     bool    `json:"private"`
+	HTMLURL     string  `json:"html_url"`
+	Language    *string `json:"language"`
+	// SizeKB is the size of the repository in kilobytes
+	SizeKB int64 `json:"size"`
+}
+
+// Languages returns the bytes of code of a repository ("owner/name") in each language, as
+// detected by GitHub
+func (c *Client) Languages(ctx context.Context, fullName string) (map[string]int64, error) {
+	languages := map[string]int64{}
+	if err := c.get(ctx, "/repos/"+fullName+"/languages", &languages); err != nil {
+		return nil, err
+	}
+	return languages, nil
+}
+
+// AuthenticatedUser returns the profile of the user the token of the client belongs to. Users
+// that keep their email private get their primary email address when the token may read it.
+func (c *Client) AuthenticatedUser(ctx context.Context) (*User, error) {
+	var user User
+	if err := c.get(ctx, "/user", &user); err != nil {
+		return nil, err
+	}
+	if user.Email == nil {
+		var emails []struct {
+			Email   string `json:"email"`
+			Primary bool   `json:"primary"`
+		}
+		if err := c.get(ctx, "/user/emails", &emails); err == nil {
+			for _, email := range emails {
+				if email.Primary {
+					user.Email = &email.Email
+					break
+				}
+			}
+		}
+	}
+	return &user, nil
+}
+
+// Repository returns the metadata of a repository ("owner/name")
+func (c *Client) Repository(ctx context.Context, fullName string) (*Repository, error) {
+	var repo Repository
+	if err := c.get(ctx, "/repos/"+fullName, &repo); err != nil {
+		return nil, err
+	}
+	return &repo, nil
+}
+
+// get decodes the JSON response to a GET request of path into result. Missing resources are
+// ErrNotFound and rejected tokens ErrUnauthorized.
+func (c *Client) get(ctx context.Context, path string, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.apiURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+		return ErrNotFound
+	case resp.StatusCode == http.StatusUnauthorized:
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+		return ErrUnauthorized
+	case resp.StatusCode != http.StatusOK:
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+		return fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,481 @@
+// Package gql exposes users, repositories, runs and stats through a GraphQL schema
+package gql
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/graphql-go/graphql"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// Pagination limits for list fields
+const (
+	DefaultListLimit = 20
+	MaxListLimit     = 100
+)
+
+// defaultStatsWindow is the range used by stats fields when from is omitted
+const defaultStatsWindow = 30 * 24 * time.Hour
+
+type viewerKey struct{}
+
+// WithViewer returns a context carrying the ID of the authenticated user. Every
+// resolver scopes its results to what this user is allowed to see.
+func WithViewer(ctx context.Context, userID uuid.UUID) context.Context {
+	return context.WithValue(ctx, viewerKey{}, userID)
+}
+
+// viewerFrom returns the authenticated user stored by WithViewer
+func viewerFrom(ctx context.Context) (uuid.UUID, error) {
+	userID, ok := ctx.Value(viewerKey{}).(uuid.UUID)
+	if !ok {
+		return uuid.Nil, fmt.Errorf("authentication required")
+	}
+	return userID, nil
+}
+
+// resolver holds the services backing the schema
+type resolver struct {
+	users *service.UserService
+	repos *service.RepositoryService
+	stats *service.StatsService
+}
+
+// NewSchema builds the GraphQL schema. Queries are read-only and resolved against the
+// same services as the REST endpoints, with the same visibility rules.
+func NewSchema(users *service.UserService, repos *service.RepositoryService, stats *service.StatsService) (graphql.Schema, error) {
+	r := &resolver{users: users, repos: repos, stats: stats}
+
+	percentilesType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Percentiles",
+		Fields: graphql.Fields{
+			"p50": &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+			"p90": &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+			"p99": &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+		},
+	})
+
+	metricPercentilesType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "MetricPercentiles",
+		Fields: graphql.Fields{
+			"co2Kg":     &graphql.Field{Type: graphql.NewNonNull(percentilesType)},
+			"durationS": &graphql.Field{Type: graphql.NewNonNull(percentilesType)},
+		},
+	})
+
+	summaryType := graphql.NewObject(graphql.ObjectConfig{
+		Name:        "Summary",
+		Description: "Aggregate of the runs created within a time range",
+		Fields: graphql.Fields{
+			"from":           &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+			"to":             &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+			"totalCo2Kg":     &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+			"totalEnergyKwh": &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+			"totalDurationS": &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+			"runCount":       &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"percentiles":    &graphql.Field{Type: metricPercentilesType},
+		},
+	})
+
+	timeSeriesPointType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "TimeSeriesPoint",
+		Fields: graphql.Fields{
+			"bucketStart": &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+			"sum":         &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+			"avg":         &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+			"count":       &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		},
+	})
+
+	workflowStatsType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "WorkflowStats",
+		Fields: graphql.Fields{
+			"workflowName":   &graphql.Field{Type: graphql.String},
+			"runCount":       &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"totalCo2Kg":     &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+			"avgCo2Kg":       &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+			"totalEnergyKwh": &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+			"avgDurationS":   &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+			"percentiles":    &graphql.Field{Type: graphql.NewNonNull(metricPercentilesType)},
+		},
+	})
+
+	rangeArgs := graphql.FieldConfigArgument{
+		"from": &graphql.ArgumentConfig{Type: graphql.DateTime, Description: "Range start, defaults to 30 days before to"},
+		"to":   &graphql.ArgumentConfig{Type: graphql.DateTime, Description: "Range end, defaults to now"},
+	}
+
+	userType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "User",
+		Fields: graphql.Fields{
+			"id":             &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+			"githubUsername": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"name":           &graphql.Field{Type: graphql.String},
+			"avatarUrl":      &graphql.Field{Type: graphql.String},
+			"stats": &graphql.Field{
+				Type:        summaryType,
+				Description: "Aggregate of the user's runs, only available for the authenticated user",
+				Args:        rangeArgs,
+				Resolve:     r.resolveUserStats,
+			},
+		},
+	})
+
+	// Repository and Run reference each other, so their fields are declared lazily
+	var repositoryType *graphql.Object
+	runType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Run",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":               &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+				"energyKwh":        &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+				"co2Kg":            &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+				"durationS":        &graphql.Field{Type: graphql.NewNonNull(graphql.Float)},
+				"gitCommitSha":     &graphql.Field{Type: graphql.String},
+				"branchName":       &graphql.Field{Type: graphql.String},
+				"workflowName":     &graphql.Field{Type: graphql.String},
+				"workflowRunGroup": &graphql.Field{Type: graphql.String},
+				"createdAt":        &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+				"user": &graphql.Field{
+					Type:        userType,
+					Description: "The user who submitted the run, or null when their profile is hidden from the viewer",
+					Resolve:     r.resolveRunUser,
+				},
+				"repository": &graphql.Field{Type: repositoryType},
+			}
+		}),
+	})
+
+	runConnectionType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "RunConnection",
+		Fields: graphql.Fields{
+			"total": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"nodes": &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(runType)))},
+		},
+	})
+
+	repositoryType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Repository",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":          &graphql.Field{Type: graphql.NewNonNull(graphql.ID)},
+				"name":        &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"fullName":    &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"description": &graphql.Field{Type: graphql.String},
+				"private":     &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+				"htmlUrl":     &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+				"language":    &graphql.Field{Type: graphql.String},
+				"createdAt":   &graphql.Field{Type: graphql.NewNonNull(graphql.DateTime)},
+				"owner": &graphql.Field{
+					Type:        userType,
+					Description: "The owner of the repository, or null when their profile is hidden from the viewer",
+					Resolve:     r.resolveRepositoryOwner,
+				},
+				"runs": &graphql.Field{
+					Type:        graphql.NewNonNull(runConnectionType),
+					Description: "Runs of the repository, newest first unless sorted otherwise",
+					Args: graphql.FieldConfigArgument{
+						"limit":        &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: DefaultListLimit},
+						"offset":       &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0},
+						"from":         &graphql.ArgumentConfig{Type: graphql.DateTime},
+						"to":           &graphql.ArgumentConfig{Type: graphql.DateTime},
+						"branch":       &graphql.ArgumentConfig{Type: graphql.String},
+						"workflowName": &graphql.ArgumentConfig{Type: graphql.String},
+						"sort":         &graphql.ArgumentConfig{Type: graphql.String, DefaultValue: "created_at", Description: "created_at, co2_kg, energy_kwh or duration_s"},
+						"order":        &graphql.ArgumentConfig{Type: graphql.String, DefaultValue: "desc", Description: "asc or desc"},
+					},
+					Resolve: r.resolveRepositoryRuns,
+				},
+				"stats": &graphql.Field{
+					Type:    graphql.NewNonNull(summaryType),
+					Args:    rangeArgs,
+					Resolve: r.resolveRepositoryStats,
+				},
+				"timeseries": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(timeSeriesPointType))),
+					Args: graphql.FieldConfigArgument{
+						"metric":   &graphql.ArgumentConfig{Type: graphql.String, DefaultValue: "co2_kg", Description: "co2_kg, energy_kwh or duration_s"},
+						"interval": &graphql.ArgumentConfig{Type: graphql.String, DefaultValue: "day", Description: "day, week or month"},
+						"from":     rangeArgs["from"],
+						"to":       rangeArgs["to"],
+					},
+					Resolve: r.resolveRepositoryTimeSeries,
+				},
+				"workflows": &graphql.Field{
+					Type:    graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(workflowStatsType))),
+					Args:    rangeArgs,
+					Resolve: r.resolveRepositoryWorkflows,
+				},
+			}
+		}),
+	})
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"me": &graphql.Field{
+				Type:        graphql.NewNonNull(userType),
+				Description: "The authenticated user",
+				Resolve:     r.resolveMe,
+			},
+			"repository": &graphql.Field{
+				Type:        repositoryType,
+				Description: "A repository visible to the authenticated user, or null",
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: r.resolveRepository,
+			},
+			"repositories": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(repositoryType))),
+				Description: "Repositories with runs visible to the authenticated user, by total CO2 descending",
+				Args: graphql.FieldConfigArgument{
+					"name":       &graphql.ArgumentConfig{Type: graphql.String, Description: "Case-insensitive name filter"},
+					"owner":      &graphql.ArgumentConfig{Type: graphql.String, Description: "Owner GitHub username"},
+					"mine":       &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: false, Description: "Only repositories the user owns, collaborates on or reaches through an organization"},
+					"visibility": &graphql.ArgumentConfig{Type: graphql.String, Description: "public or private"},
+					"limit":      &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: DefaultListLimit},
+					"offset":     &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0},
+				},
+				Resolve: r.resolveRepositories,
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+}
+
+func (r *resolver) resolveMe(p graphql.ResolveParams) (interface{}, error) {
+	viewerID, err := viewerFrom(p.Context)
+	if err != nil {
+		return nil, err
+	}
+	return r.users.GetUserByID(viewerID)
+}
+
+func (r *resolver) resolveUserStats(p graphql.ResolveParams) (interface{}, error) {
+	viewerID, err := viewerFrom(p.Context)
+	if err != nil {
+		return nil, err
+	}
+	user := p.Source.(*db.User)
+	// Another user's totals would include runs of repositories the viewer cannot see
+	if user.ID != viewerID {
+		return nil, nil
+	}
+
+	from, to, err := timeRange(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	return r.stats.Summary(service.UserRuns(user.ID), from, to)
+}
+
+func (r *resolver) resolveRepository(p graphql.ResolveParams) (interface{}, error) {
+	viewerID, err := viewerFrom(p.Context)
+	if err != nil {
+		return nil, err
+	}
+	repoID, err := uuid.Parse(p.Args["id"].(string))
+	if err != nil {
+		return nil, fmt.Errorf("invalid repository ID")
+	}
+
+	visible, err := r.repos.CanViewRepository(repoID, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	if !visible {
+		return nil, nil
+	}
+	return r.repos.GetRepositoryByID(repoID)
+}
+
+func (r *resolver) resolveRepositories(p graphql.ResolveParams) (interface{}, error) {
+	viewerID, err := viewerFrom(p.Context)
+	if err != nil {
+		return nil, err
+	}
+	limit, offset, err := pagination(p.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	filters := map[string]interface{}{
+		"viewer_id": viewerID,
+		"mine":      p.Args["mine"].(bool),
+	}
+	if name, ok := p.Args["name"].(string); ok && name != "" {
+		filters["name"] = name
+	}
+	if owner, ok := p.Args["owner"].(string); ok && owner != "" {
+		filters["owner"] = owner
+	}
+	if visibility, ok := p.Args["visibility"].(string); ok && visibility != "" {
+		if visibility != "public" && visibility != "private" {
+			return nil, fmt.Errorf("invalid visibility, must be one of public, private")
+		}
+		filters["visibility"] = visibility
+	}
+
+	stats, _, err := r.repos.ListRepositoriesWithStats(limit, offset, "total_co2", "DESC", filters)
+	if err != nil {
+		return nil, err
+	}
+	repos := make([]*db.Repository, len(stats))
+	for i := range stats {
+		repos[i] = &stats[i].Repository
+	}
+	return repos, nil
+}
+
+func (r *resolver) resolveRepositoryOwner(p graphql.ResolveParams) (interface{}, error) {
+	repo := p.Source.(*db.Repository)
+	return r.visibleUser(p.Context, repo.Owner, repo.OwnerID)
+}
+
+func (r *resolver) resolveRunUser(p graphql.ResolveParams) (interface{}, error) {
+	run := p.Source.(*db.Run)
+	return r.visibleUser(p.Context, run.User, run.UserID)
+}
+
+// visibleUser returns the user with userID, loading it unless user is already set, or nil
+// when the viewer may not see their profile, as GET /users/{user} would answer 404
+func (r *resolver) visibleUser(ctx context.Context, user *db.User, userID uuid.UUID) (interface{}, error) {
+	viewerID, err := viewerFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		if user, err = r.users.GetUserByID(userID); err != nil {
+			return nil, err
+		}
+	}
+
+	visible, _, err := r.users.CanViewProfile(user, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	if !visible {
+		return nil, nil
+	}
+	return user, nil
+}
+
+func (r *resolver) resolveRepositoryRuns(p graphql.ResolveParams) (interface{}, error) {
+	repo := p.Source.(*db.Repository)
+	limit, offset, err := pagination(p.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	filters := make(map[string]interface{})
+	if from, ok := p.Args["from"].(time.Time); ok {
+		filters["from_date"] = from
+	}
+	if to, ok := p.Args["to"].(time.Time); ok {
+		filters["to_date"] = to
+	}
+	if branch, ok := p.Args["branch"].(string); ok {
+		filters["branch_name"] = branch
+	}
+	if workflowName, ok := p.Args["workflowName"].(string); ok {
+		filters["workflow_name"] = workflowName
+	}
+
+	sortBy, _ := p.Args["sort"].(string)
+	order, _ := p.Args["order"].(string)
+	if !service.IsValidRunSort(sortBy) {
+		return nil, fmt.Errorf("invalid sort, must be one of created_at, co2_kg, energy_kwh, duration_s")
+	}
+	if order != "asc" && order != "desc" {
+		return nil, fmt.Errorf("invalid order, must be one of asc, desc")
+	}
+
+	runs, total, err := r.repos.GetRepositoryRuns(repo.ID, limit, offset, sortBy, order, filters, service.DefaultRunView)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]*db.Run, len(runs))
+	for i := range runs {
+		nodes[i] = &runs[i]
+	}
+	return map[string]interface{}{
+		"total": total,
+		"nodes": nodes,
+	}, nil
+}
+
+func (r *resolver) resolveRepositoryStats(p graphql.ResolveParams) (interface{}, error) {
+	repo := p.Source.(*db.Repository)
+	from, to, err := timeRange(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	return r.stats.Summary(service.RepositoryRuns(repo.ID), from, to)
+}
+
+func (r *resolver) resolveRepositoryTimeSeries(p graphql.ResolveParams) (interface{}, error) {
+	repo := p.Source.(*db.Repository)
+	from, to, err := timeRange(p.Args)
+	if err != nil {
+		return nil, err
+	}
+
+	q := service.TimeSeriesQuery{
+		Metric:   p.Args["metric"].(string),
+		Interval: p.Args["interval"].(string),
+		From:     from,
+		To:       to,
+	}
+	if !service.IsValidMetric(q.Metric) {
+		return nil, fmt.Errorf("invalid metric, must be one of co2_kg, energy_kwh, duration_s")
+	}
+	if !service.IsValidInterval(q.Interval) {
+		return nil, fmt.Errorf("invalid interval, must be one of day, week, month")
+	}
+	return r.stats.TimeSeries(service.RepositoryRuns(repo.ID), q)
+}
+
+func (r *resolver) resolveRepositoryWorkflows(p graphql.ResolveParams) (interface{}, error) {
+	repo := p.Source.(*db.Repository)
+	from, to, err := timeRange(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	return r.stats.WorkflowStats(service.RepositoryRuns(repo.ID), from, to)
+}
+
+// timeRange reads the optional from and to arguments, applying the REST defaults
+func timeRange(args map[string]interface{}) (time.Time, time.Time, error) {
+	to := time.Now().UTC()
+	if value, ok := args["to"].(time.Time); ok {
+		to = value
+	}
+	from := to.Add(-defaultStatsWindow)
+	if value, ok := args["from"].(time.Time); ok {
+		from = value
+	}
+	if from.After(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from must be before to")
+	}
+	return from, to, nil
+}
+
+// pagination reads and validates the limit and offset arguments
+func pagination(args map[string]interface{}) (int, int, error) {
+	limit, _ := args["limit"].(int)
+	offset, _ := args["offset"].(int)
+	if limit < 1 || limit > MaxListLimit {
+		return 0, 0, fmt.Errorf("limit must be between 1 and %d", MaxListLimit)
+	}
+	if offset < 0 {
+		return 0, 0, fmt.Errorf("offset must not be negative")
+	}
+	return limit, offset, nil
+}
@@ -0,0 +1,268 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// CloudRepository is the name of the repository that cloud estimates are imported into by
+// default, under the account of the importing user
+const CloudRepository = "cloud"
+
+// ccfEstimate is a per-account, per-service and per-region estimate of Cloud Carbon Footprint
+type ccfEstimate struct {
+	CloudProvider          string  `json:"cloudProvider"`
+	AccountID              string  `json:"accountId"`
+	AccountName            string  `json:"accountName"`
+	ServiceName            string  `json:"serviceName"`
+	Region                 string  `json:"region"`
+	KilowattHours          float64 `json:"kilowattHours"`
+	CO2e                   float64 `json:"co2e"` // metric tonnes
+	Cost                   float64 `json:"cost"`
+	UsesAverageCPUConstant bool    `json:"usesAverageCPUConstant"`
+}
+
+// ccfResult is the estimates of a period, as returned by the /api/footprint endpoint
+type ccfResult struct {
+	Timestamp        string        `json:"timestamp"`
+	ServiceEstimates []ccfEstimate `json:"serviceEstimates"`
+}
+
+// ccfRecord is an estimate read from the line of a file
+type ccfRecord struct {
+	line      int
+	timestamp string
+	estimate  ccfEstimate
+}
+
+// ccfColumns maps the normalized CSV column names of the CLI export to estimate fields
+var ccfColumns = map[string]string{
+	"date":                   "timestamp",
+	"timestamp":              "timestamp",
+	"cloudprovider":          "cloudProvider",
+	"accountid":              "accountId",
+	"account":                "accountName",
+	"accountname":            "accountName",
+	"service":                "serviceName",
+	"servicename":            "serviceName",
+	"region":                 "region",
+	"kilowatthours":          "kilowattHours",
+	"kwh":                    "kilowattHours",
+	"co2e":                   "co2e",
+	"co2emetrictonnes":       "co2e",
+	"cost":                   "cost",
+	"usesaveragecpuconstant": "usesAverageCPUConstant",
+}
+
+// CloudCarbonFootprint converts the estimates of Cloud Carbon Footprint into runs of repo, one
+// per period, account, service and region. It reads the JSON of the /api/footprint endpoint
+// or a CSV export with the same fields. The service becomes the workflow of the run, so the
+// workflow statistics of repo break the cloud emissions down by service.
+func CloudCarbonFootprint(r io.Reader, repo string) ([]service.ImportedRun, error) {
+	repository, err := repository(repo)
+	if err != nil {
+		return nil, Errors{{Line: 1, Message: err.Error()}}
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+
+	var records []ccfRecord
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && (trimmed[0] == '[' || trimmed[0] == '{') {
+		records, err = ccfJSON(data)
+	} else {
+		records, err = ccfCSV(data)
+	}
+	// Invalid records are reported along with the invalid estimates
+	var lineErrors Errors
+	if err != nil && !errors.As(err, &lineErrors) {
+		return nil, err
+	}
+
+	var runs []service.ImportedRun
+	for _, record := range records {
+		run, err := ccfRun(record.timestamp, record.estimate, repository)
+		if err != nil {
+			lineErrors = append(lineErrors, LineError{Line: record.line, Message: err.Error()})
+			continue
+		}
+		runs = append(runs, *run)
+	}
+	sort.SliceStable(lineErrors, func(i, j int) bool { return lineErrors[i].Line < lineErrors[j].Line })
+	if len(runs) > service.MaxImportRuns {
+		return nil, Errors{{Line: 1, Message: fmt.Sprintf("imports are limited to %d runs", service.MaxImportRuns)}}
+	}
+	if len(lineErrors) > 0 {
+		return nil, lineErrors
+	}
+	return runs, nil
+}
+
+// ccfJSON reads the results of the /api/footprint endpoint
+func ccfJSON(data []byte) ([]ccfRecord, error) {
+	results, err := jsonRecords(data)
+	if err != nil {
+		return nil, err
+	}
+	var records []ccfRecord
+	for _, record := range results {
+		var result ccfResult
+		if err := json.Unmarshal(record.raw, &result); err != nil {
+			return nil, Errors{{Line: record.line, Message: err.Error()}}
+		}
+		if result.Timestamp == "" && len(result.ServiceEstimates) == 0 {
+			return nil, Errors{{Line: record.line, Message: "expected Cloud Carbon Footprint estimation results"}}
+		}
+		for _, estimate := range result.ServiceEstimates {
+			records = append(records, ccfRecord{line: record.line, timestamp: result.Timestamp, estimate: estimate})
+		}
+	}
+	return records, nil
+}
+
+// ccfCSV reads a CSV export of the estimates
+func ccfCSV(data []byte) ([]ccfRecord, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, Errors{{Line: 1, Message: "file is empty"}}
+	}
+	if err != nil {
+		return nil, Errors{{Line: 1, Message: err.Error()}}
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		normalized := strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return unicode.ToLower(r)
+			}
+			return -1
+		}, name)
+		if field, ok := ccfColumns[normalized]; ok {
+			columns[field] = i
+		}
+	}
+	for _, required := range []string{"timestamp", "kilowattHours", "co2e"} {
+		if _, ok := columns[required]; !ok {
+			return nil, Errors{{Line: 1, Message: fmt.Sprintf("missing column %s; is this a Cloud Carbon Footprint export?", required)}}
+		}
+	}
+
+	var records []ccfRecord
+	var lineErrors Errors
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			lineErrors = append(lineErrors, LineError{Line: line, Message: err.Error()})
+			continue
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		estimate := ccfEstimate{
+			CloudProvider: field("cloudProvider"),
+			AccountID:     field("accountId"),
+			AccountName:   field("accountName"),
+			ServiceName:   field("serviceName"),
+			Region:        field("region"),
+		}
+		estimate.UsesAverageCPUConstant, _ = strconv.ParseBool(field("usesAverageCPUConstant"))
+		numbers := []struct {
+			name  string
+			value *float64
+		}{{"kilowattHours", &estimate.KilowattHours}, {"co2e", &estimate.CO2e}, {"cost", &estimate.Cost}}
+		valid := true
+		for _, number := range numbers {
+			raw := field(number.name)
+			if raw == "" && number.name == "cost" {
+				continue
+			}
+			if *number.value, err = strconv.ParseFloat(raw, 64); err != nil {
+				lineErrors = append(lineErrors, LineError{Line: line, Message: fmt.Sprintf("invalid %s %q", number.name, raw)})
+				valid = false
+				break
+			}
+		}
+		if valid {
+			records = append(records, ccfRecord{line: line, timestamp: field("timestamp"), estimate: estimate})
+		}
+	}
+	if len(lineErrors) > 0 {
+		return records, lineErrors
+	}
+	return records, nil
+}
+
+// ccfRun converts an estimate of the period starting at timestamp
+func ccfRun(timestamp string, estimate ccfEstimate, repository service.RepositoryCreateRequest) (*service.ImportedRun, error) {
+	var measuredAt time.Time
+	var err error
+	for _, layout := range []string{time.RFC3339Nano, time.DateOnly} {
+		if measuredAt, err = time.Parse(layout, timestamp); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp %q", timestamp)
+	}
+	if estimate.KilowattHours < 0 || estimate.CO2e < 0 {
+		return nil, fmt.Errorf("kilowatt hours and CO2e must not be negative")
+	}
+
+	run := &service.ImportedRun{
+		RunCreateRequest: service.RunCreateRequest{
+			EnergyKWh:  estimate.KilowattHours,
+			CO2Kg:      estimate.CO2e * 1000,
+			Repository: repository,
+			Metadata: map[string]interface{}{
+				"measurement_method":        "cloud_carbon_footprint",
+				"uses_average_cpu_constant": estimate.UsesAverageCPUConstant,
+			},
+		},
+		CreatedAt: measuredAt.UTC(),
+	}
+	account := estimate.AccountID
+	if account == "" {
+		account = estimate.AccountName
+	}
+	run.ImportID = strings.Join([]string{run.CreatedAt.Format(time.RFC3339), estimate.CloudProvider, account, estimate.ServiceName, estimate.Region}, "/")
+	if estimate.ServiceName != "" {
+		run.WorkflowName = &estimate.ServiceName
+	}
+	for key, value := range map[string]string{
+		"cloud_provider":   estimate.CloudProvider,
+		"cloud_account_id": estimate.AccountID,
+		"cloud_account":    estimate.AccountName,
+		"cloud_service":    estimate.ServiceName,
+		"region":           estimate.Region,
+	} {
+		if value != "" {
+			run.Metadata[key] = value
+		}
+	}
+	if estimate.Cost != 0 {
+		run.Metadata["cost"] = estimate.Cost
+	}
+	return run, nil
+}
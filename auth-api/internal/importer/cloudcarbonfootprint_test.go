@@ -0,0 +1,98 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloudCarbonFootprint(t *testing.T) {
+	t.Run("converts API results", func(t *testing.T) {
+		footprint := `[
+  {
+    "timestamp": "2024-03-01T00:00:00.000Z",
+    "serviceEstimates": [
+      {"cloudProvider": "AWS", "accountId": "123456789012", "accountName": "production", "serviceName": "AmazonEC2", "region": "eu-central-1", "kilowattHours": 12.5, "co2e": 0.0042, "cost": 31.2, "usesAverageCPUConstant": true},
+      {"cloudProvider": "AWS", "accountId": "123456789012", "accountName": "production", "serviceName": "AmazonS3", "region": "eu-central-1", "kilowattHours": 0.8, "co2e": 0.0003, "cost": 4.1, "usesAverageCPUConstant": false}
+    ]
+  },
+  {
+    "timestamp": "2024-03-02T00:00:00.000Z",
+    "serviceEstimates": [
+      {"cloudProvider": "GCP", "accountId": "ml-project", "accountName": "ML", "serviceName": "Compute Engine", "region": "europe-west1", "kilowattHours": 3, "co2e": 0.0001, "cost": 0}
+    ]
+  }
+]`
+		runs, err := CloudCarbonFootprint(strings.NewReader(footprint), "octocat/cloud")
+		require.NoError(t, err)
+		require.Len(t, runs, 3)
+
+		ec2 := runs[0]
+		assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), ec2.CreatedAt)
+		assert.Equal(t, "2024-03-01T00:00:00Z/AWS/123456789012/AmazonEC2/eu-central-1", ec2.ImportID)
+		assert.Equal(t, 12.5, ec2.EnergyKWh)
+		assert.InDelta(t, 4.2, ec2.CO2Kg, 1e-12)
+		assert.Equal(t, "octocat/cloud", ec2.Repository.FullName)
+		require.NotNil(t, ec2.WorkflowName)
+		assert.Equal(t, "AmazonEC2", *ec2.WorkflowName)
+		assert.Equal(t, map[string]interface{}{
+			"measurement_method":        "cloud_carbon_footprint",
+			"uses_average_cpu_constant": true,
+			"cloud_provider":            "AWS",
+			"cloud_account_id":          "123456789012",
+			"cloud_account":             "production",
+			"cloud_service":             "AmazonEC2",
+			"region":                    "eu-central-1",
+			"cost":                      31.2,
+		}, ec2.Metadata)
+		assert.Equal(t, "AmazonS3", *runs[1].WorkflowName)
+		assert.Equal(t, time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC), runs[2].CreatedAt)
+		assert.NotContains(t, runs[2].Metadata, "cost")
+	})
+
+	t.Run("converts CSV exports", func(t *testing.T) {
+		csv := "Date,Cloud Provider,Account Name,Service Name,Region,Kilowatt Hours,CO2e (metric tonnes),Cost\n" +
+			"2024-03-01,Azure,Engineering,Virtual Machines,westeurope,7.25,0.0024,18.5\n" +
+			"2024-03-01,Azure,Engineering,Storage,westeurope,0.5,0.0002,\n"
+		runs, err := CloudCarbonFootprint(strings.NewReader(csv), "octocat/cloud")
+		require.NoError(t, err)
+		require.Len(t, runs, 2)
+		assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), runs[0].CreatedAt)
+		assert.Equal(t, "2024-03-01T00:00:00Z/Azure/Engineering/Virtual Machines/westeurope", runs[0].ImportID)
+		assert.Equal(t, 7.25, runs[0].EnergyKWh)
+		assert.InDelta(t, 2.4, runs[0].CO2Kg, 1e-12)
+		assert.Equal(t, 18.5, runs[0].Metadata["cost"])
+		assert.Equal(t, "Storage", *runs[1].WorkflowName)
+	})
+
+	t.Run("reports the lines of invalid estimates", func(t *testing.T) {
+		footprint := `{"data": [
+  {"timestamp": "2024-03-01T00:00:00Z", "serviceEstimates": [{"serviceName": "AmazonEC2", "kilowattHours": 1, "co2e": 0.001}]},
+  {"timestamp": "March", "serviceEstimates": [{"serviceName": "AmazonEC2", "kilowattHours": 1, "co2e": 0.001}]},
+  {"timestamp": "2024-03-03T00:00:00Z", "serviceEstimates": [{"serviceName": "AmazonEC2", "kilowattHours": -1, "co2e": 0.001}]}
+]}`
+		_, err := CloudCarbonFootprint(strings.NewReader(footprint), "octocat/cloud")
+		var lineErrors Errors
+		require.ErrorAs(t, err, &lineErrors)
+		assert.Equal(t, Errors{
+			{Line: 3, Message: `invalid timestamp "March"`},
+			{Line: 4, Message: "kilowatt hours and CO2e must not be negative"},
+		}, lineErrors)
+
+		csv := "Date,Kilowatt Hours,CO2e (metric tonnes)\n2024-03-01,lots,0\n2024-03-01,1,0\n"
+		_, err = CloudCarbonFootprint(strings.NewReader(csv), "octocat/cloud")
+		require.ErrorAs(t, err, &lineErrors)
+		assert.Equal(t, Errors{{Line: 2, Message: `invalid kilowattHours "lots"`}}, lineErrors)
+	})
+
+	t.Run("rejects other files", func(t *testing.T) {
+		_, err := CloudCarbonFootprint(strings.NewReader(`{"error": "unauthorized"}`), "octocat/cloud")
+		assert.ErrorContains(t, err, "expected Cloud Carbon Footprint estimation results")
+
+		_, err = CloudCarbonFootprint(strings.NewReader("timestamp,duration\n"), "octocat/cloud")
+		assert.ErrorContains(t, err, "missing column kilowattHours")
+	})
+}
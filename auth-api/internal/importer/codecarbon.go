@@ -0,0 +1,162 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// codecarbonTimeLayouts are the timestamps codecarbon writes, with or without a UTC offset
+var codecarbonTimeLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999", "2006-01-02 15:04:05"}
+
+// codecarbonMetadata maps codecarbon columns to run metadata keys. Numeric columns are stored
+// as numbers.
+var codecarbonMetadata = map[string]string{
+	"project_name":       "codecarbon_project",
+	"run_id":             "codecarbon_run_id",
+	"experiment_id":      "codecarbon_experiment_id",
+	"codecarbon_version": "codecarbon_version",
+	"tracking_mode":      "codecarbon_tracking_mode",
+	"cpu_energy":         "cpu_energy_kwh",
+	"gpu_energy":         "gpu_energy_kwh",
+	"ram_energy":         "ram_energy_kwh",
+	"cpu_power":          "cpu_power_w",
+	"gpu_power":          "gpu_power_w",
+	"ram_power":          "ram_power_w",
+	"cpu_count":          "cpu_count",
+	"cpu_model":          "cpu_model",
+	"gpu_count":          "gpu_count",
+	"gpu_model":          "gpu_model",
+	"ram_total_size":     "ram_total_gb",
+	"os":                 "os",
+	"country_iso_code":   "country_iso_code",
+	"cloud_provider":     "cloud_provider",
+	"pue":                "pue",
+}
+
+// Codecarbon converts an emissions.csv file written by codecarbon into runs. Every row is a
+// run of repo, or when repo is empty of the repository named by its project_name. Rows are
+// identified by their run_id, or their timestamp in older files.
+func Codecarbon(r io.Reader, repo string) ([]service.ImportedRun, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, Errors{{Line: 1, Message: "file is empty"}}
+	}
+	if err != nil {
+		return nil, Errors{{Line: 1, Message: err.Error()}}
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+	for _, required := range []string{"timestamp", "duration", "emissions", "energy_consumed"} {
+		if _, ok := columns[required]; !ok {
+			return nil, Errors{{Line: 1, Message: fmt.Sprintf("missing column %s; is this a codecarbon emissions.csv?", required)}}
+		}
+	}
+
+	var runs []service.ImportedRun
+	var lineErrors Errors
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			lineErrors = append(lineErrors, LineError{Line: line, Message: err.Error()})
+			continue
+		}
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		run, err := codecarbonRun(field, repo)
+		if err != nil {
+			lineErrors = append(lineErrors, LineError{Line: line, Message: err.Error()})
+			continue
+		}
+		runs = append(runs, *run)
+		if len(runs) > service.MaxImportRuns {
+			return nil, Errors{{Line: line, Message: fmt.Sprintf("imports are limited to %d runs", service.MaxImportRuns)}}
+		}
+	}
+	if len(lineErrors) > 0 {
+		return nil, lineErrors
+	}
+	return runs, nil
+}
+
+// codecarbonRun converts a row of emissions.csv
+func codecarbonRun(field func(string) string, repo string) (*service.ImportedRun, error) {
+	if repo == "" {
+		repo = field("project_name")
+	}
+	repository, err := repository(repo)
+	if err != nil {
+		return nil, fmt.Errorf("%v; set the repository of the import", err)
+	}
+
+	var measuredAt time.Time
+	for _, layout := range codecarbonTimeLayouts {
+		if measuredAt, err = time.Parse(layout, field("timestamp")); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp %q", field("timestamp"))
+	}
+
+	values := map[string]float64{}
+	for _, name := range []string{"duration", "emissions", "energy_consumed"} {
+		value, err := strconv.ParseFloat(field(name), 64)
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("invalid %s %q", name, field(name))
+		}
+		values[name] = value
+	}
+
+	run := &service.ImportedRun{
+		RunCreateRequest: service.RunCreateRequest{
+			EnergyKWh:  values["energy_consumed"],
+			CO2Kg:      values["emissions"],
+			DurationS:  values["duration"],
+			Repository: repository,
+			Metadata:   map[string]interface{}{},
+		},
+		CreatedAt: measuredAt.UTC(),
+		ImportID:  field("run_id"),
+	}
+	if run.ImportID == "" {
+		run.ImportID = measuredAt.UTC().Format(time.RFC3339Nano)
+	}
+
+	for column, key := range codecarbonMetadata {
+		value := field(column)
+		if value == "" {
+			continue
+		}
+		if number, err := strconv.ParseFloat(value, 64); err == nil {
+			run.Metadata[key] = number
+		} else {
+			run.Metadata[key] = value
+		}
+	}
+	// The cloud region is more precise than the region of the country
+	if region := field("cloud_region"); region != "" {
+		run.Metadata["region"] = region
+	} else if region := field("region"); region != "" {
+		run.Metadata["region"] = region
+	}
+	return run, nil
+}
@@ -0,0 +1,70 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodecarbon(t *testing.T) {
+	t.Run("converts rows", func(t *testing.T) {
+		// Older files have no run_id and are written with a byte order mark by some editors
+		csv := "\ufefftimestamp,project_name,duration,emissions,energy_consumed,cpu_model,cpu_count,country_iso_code,region\n" +
+			"2023-11-20 08:30:00,octocat/hello-world,45.5,0.0012,0.003,AMD EPYC 7763,4,NLD,north holland\n" +
+			"2023-11-21T08:30:00.123456,octocat/hello-world,50,0.0013,0.0031,,,,\n"
+		runs, err := Codecarbon(strings.NewReader(csv), "")
+		require.NoError(t, err)
+		require.Len(t, runs, 2)
+
+		assert.Equal(t, time.Date(2023, 11, 20, 8, 30, 0, 0, time.UTC), runs[0].CreatedAt)
+		assert.Equal(t, "2023-11-20T08:30:00Z", runs[0].ImportID)
+		assert.Equal(t, 45.5, runs[0].DurationS)
+		assert.Equal(t, 0.0012, runs[0].CO2Kg)
+		assert.Equal(t, 0.003, runs[0].EnergyKWh)
+		assert.Equal(t, "hello-world", runs[0].Repository.Name)
+		assert.Equal(t, "https://github.com/octocat/hello-world", runs[0].Repository.HTMLURL)
+		assert.Equal(t, map[string]interface{}{
+			"codecarbon_project": "octocat/hello-world",
+			"cpu_model":          "AMD EPYC 7763",
+			"cpu_count":          4.0,
+			"country_iso_code":   "NLD",
+			"region":             "north holland",
+		}, runs[0].Metadata)
+
+		assert.Equal(t, time.Date(2023, 11, 21, 8, 30, 0, 123456000, time.UTC), runs[1].CreatedAt)
+		assert.Equal(t, map[string]interface{}{"codecarbon_project": "octocat/hello-world"}, runs[1].Metadata)
+	})
+
+	t.Run("the repository overrides the project", func(t *testing.T) {
+		runs, err := Codecarbon(strings.NewReader("timestamp,project_name,duration,emissions,energy_consumed\n2023-11-20T08:30:00+02:00,codecarbon,1,0,0\n"), "acme/models")
+		require.NoError(t, err)
+		require.Len(t, runs, 1)
+		assert.Equal(t, "acme/models", runs[0].Repository.FullName)
+		assert.Equal(t, time.Date(2023, 11, 20, 6, 30, 0, 0, time.UTC), runs[0].CreatedAt)
+	})
+
+	t.Run("reports every invalid line", func(t *testing.T) {
+		csv := "timestamp,project_name,duration,emissions,energy_consumed\n" +
+			"2023-11-20T08:30:00,codecarbon,1,0,0\n" +
+			"2023-11-20T08:30:00,octocat/hello-world,1,zero,0\n" +
+			"2023-11-20T08:30:00,octocat/hello-world,1,0,0\n"
+		_, err := Codecarbon(strings.NewReader(csv), "")
+		var lineErrors Errors
+		require.ErrorAs(t, err, &lineErrors)
+		require.Len(t, lineErrors, 2)
+		assert.Equal(t, 2, lineErrors[0].Line)
+		assert.Contains(t, lineErrors[0].Message, "owner/name")
+		assert.Equal(t, LineError{Line: 3, Message: `invalid emissions "zero"`}, lineErrors[1])
+	})
+
+	t.Run("rejects other files", func(t *testing.T) {
+		_, err := Codecarbon(strings.NewReader(""), "")
+		assert.EqualError(t, err, "line 1: file is empty")
+
+		_, err = Codecarbon(strings.NewReader("timestamp,duration\n"), "")
+		assert.ErrorContains(t, err, "missing column emissions")
+	})
+}
@@ -0,0 +1,269 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ecoci/auth-api/internal/energy"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// Green Metrics Tool phases. The runtime phase spans the phases of the flows of the usage
+// scenario, which have the names given in the scenario.
+const (
+	gmtRuntimePhase = "[RUNTIME]"
+	gmtTimeMetric   = "phase_time_syscall_system"
+	// gmtRAPLMetric is the sum of the RAPL components, used where the machine's power supply
+	// is not measured
+	gmtRAPLMetric = "rapl_components"
+)
+
+// gmtPhasePrefix is the order prefix of phase names, such as 004_ in 004_[RUNTIME]
+var gmtPhasePrefix = regexp.MustCompile(`^\d+_`)
+
+// gmtUnits are the factors converting the units of Green Metrics Tool to J, kg and s
+var gmtUnits = map[string]float64{
+	"uJ": 1e-6, "mJ": 1e-3, "J": 1,
+	"ug": 1e-9, "mg": 1e-6, "g": 1e-3,
+	"us": 1e-6, "ms": 1e-3, "s": 1,
+}
+
+// gmtRun is a measurement run of the Green Metrics Tool, as returned by its /v1/run endpoint,
+// with the rows of its phase_stats table
+type gmtRun struct {
+	ID         string         `json:"id"`
+	Name       string         `json:"name"`
+	URI        string         `json:"uri"`
+	Branch     string         `json:"branch"`
+	CommitHash string         `json:"commit_hash"`
+	Filename   string         `json:"filename"`
+	CreatedAt  string         `json:"created_at"`
+	PhaseStats []gmtPhaseStat `json:"phase_stats"`
+}
+
+// gmtPhaseStat is the value of a metric over a phase
+type gmtPhaseStat struct {
+	Phase      string  `json:"phase"`
+	Metric     string  `json:"metric"`
+	DetailName string  `json:"detail_name"`
+	Value      float64 `json:"value"`
+	Unit       string  `json:"unit"`
+}
+
+// gmtPhase totals the metrics of a phase
+type gmtPhase struct {
+	order string
+	name  string
+	// energy and carbon are per metric, in J and kg
+	energy map[string]float64
+	carbon map[string]float64
+	time   float64
+}
+
+// GreenMetricsTool converts measurement runs of the Green Metrics Tool into runs of repo, or
+// when repo is empty of the GitHub repository of their URI. The runtime phase becomes the run,
+// and its flows the steps in the steps metadata. Runs are identified by their Green Metrics
+// Tool ID.
+func GreenMetricsTool(r io.Reader, repo string) ([]service.ImportedRun, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	records, err := jsonRecords(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) > service.MaxImportRuns {
+		return nil, Errors{{Line: 1, Message: fmt.Sprintf("imports are limited to %d runs", service.MaxImportRuns)}}
+	}
+
+	var runs []service.ImportedRun
+	var lineErrors Errors
+	for _, record := range records {
+		var measurement gmtRun
+		if err := json.Unmarshal(record.raw, &measurement); err != nil {
+			lineErrors = append(lineErrors, LineError{Line: record.line, Message: err.Error()})
+			continue
+		}
+		run, err := gmtImportedRun(&measurement, repo)
+		if err != nil {
+			lineErrors = append(lineErrors, LineError{Line: record.line, Message: err.Error()})
+			continue
+		}
+		runs = append(runs, *run)
+	}
+	if len(lineErrors) > 0 {
+		return nil, lineErrors
+	}
+	return runs, nil
+}
+
+// gmtRepository returns the full name of a GitHub repository URI
+func gmtRepository(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Host != "github.com" {
+		return ""
+	}
+	return strings.TrimSuffix(strings.Trim(parsed.Path, "/"), ".git")
+}
+
+// gmtImportedRun converts a measurement run
+func gmtImportedRun(measurement *gmtRun, repo string) (*service.ImportedRun, error) {
+	if measurement.ID == "" {
+		return nil, fmt.Errorf("missing id; is this a Green Metrics Tool run?")
+	}
+	if repo == "" {
+		repo = gmtRepository(measurement.URI)
+	}
+	repository, err := repository(repo)
+	if err != nil {
+		return nil, fmt.Errorf("%v; set the repository of the import", err)
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, measurement.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid created_at %q", measurement.CreatedAt)
+	}
+
+	phases := map[string]*gmtPhase{}
+	for _, stat := range measurement.PhaseStats {
+		name := gmtPhasePrefix.ReplaceAllString(stat.Phase, "")
+		phase, ok := phases[name]
+		if !ok {
+			phase = &gmtPhase{order: stat.Phase, name: name, energy: map[string]float64{}, carbon: map[string]float64{}}
+			phases[name] = phase
+		}
+		factor, known := gmtUnits[stat.Unit]
+		switch {
+		case stat.Metric == gmtTimeMetric && known:
+			phase.time += stat.Value * factor
+		case strings.Contains(stat.Metric, "_energy_") && known:
+			phase.energy[stat.Metric] += stat.Value * factor
+		case strings.Contains(stat.Metric, "_carbon_") && known:
+			phase.carbon[stat.Metric] += stat.Value * factor
+		}
+	}
+
+	// The flows of the usage scenario are the phases without brackets, in their order
+	var flows []*gmtPhase
+	for _, phase := range phases {
+		if !strings.HasPrefix(phase.name, "[") {
+			flows = append(flows, phase)
+		}
+	}
+	sort.Slice(flows, func(i, j int) bool { return flows[i].order < flows[j].order })
+
+	runtime := phases[gmtRuntimePhase]
+	if runtime == nil {
+		if len(flows) == 0 {
+			return nil, fmt.Errorf("run %s has no runtime phase stats", measurement.ID)
+		}
+		runtime = &gmtPhase{energy: map[string]float64{}, carbon: map[string]float64{}}
+		for _, flow := range flows {
+			runtime.time += flow.time
+			for metric, joules := range flow.energy {
+				runtime.energy[metric] += joules
+			}
+			for metric, kg := range flow.carbon {
+				runtime.carbon[metric] += kg
+			}
+		}
+	}
+	metric := gmtEnergyMetric(runtime.energy)
+	if metric == "" {
+		return nil, fmt.Errorf("run %s has no energy metric", measurement.ID)
+	}
+	carbonMetric := strings.Replace(metric, "_energy_", "_carbon_", 1)
+	co2 := func(phase *gmtPhase) float64 {
+		energyKWh := gmtPhaseEnergy(phase, metric) / 3.6e6
+		if kg, ok := phase.carbon[carbonMetric]; ok {
+			return kg
+		}
+		return energyKWh * energy.DefaultCarbonIntensity / 1000
+	}
+
+	run := &service.ImportedRun{
+		RunCreateRequest: service.RunCreateRequest{
+			EnergyKWh:  gmtPhaseEnergy(runtime, metric) / 3.6e6,
+			CO2Kg:      co2(runtime),
+			DurationS:  runtime.time,
+			Repository: repository,
+			Metadata: map[string]interface{}{
+				"measurement_method": "green_metrics_tool",
+				"energy_metric":      metric,
+				"gmt_run_id":         measurement.ID,
+			},
+		},
+		CreatedAt: createdAt.UTC(),
+		ImportID:  measurement.ID,
+	}
+	if _, ok := runtime.carbon[carbonMetric]; !ok {
+		run.Metadata["carbon_intensity"] = energy.DefaultCarbonIntensity
+	}
+	for key, value := range map[string]string{"gmt_name": measurement.Name, "gmt_uri": measurement.URI, "gmt_filename": measurement.Filename} {
+		if value != "" {
+			run.Metadata[key] = value
+		}
+	}
+	if measurement.Name != "" {
+		run.WorkflowName = &measurement.Name
+	}
+	if measurement.Branch != "" {
+		run.BranchName = &measurement.Branch
+	}
+	if len(measurement.CommitHash) == 40 {
+		run.GitCommitSHA = &measurement.CommitHash
+	}
+
+	steps := make([]interface{}, 0, len(flows))
+	for _, flow := range flows {
+		steps = append(steps, map[string]interface{}{
+			"name":       flow.name,
+			"energy_kwh": gmtPhaseEnergy(flow, metric) / 3.6e6,
+			"co2_kg":     co2(flow),
+			"duration_s": flow.time,
+		})
+	}
+	run.Metadata["steps"] = steps
+	return run, nil
+}
+
+// gmtEnergyMetric picks the energy metric of a run: the machine's power supply when it is
+// measured, else the sum of the RAPL components
+func gmtEnergyMetric(metrics map[string]float64) string {
+	var machine []string
+	rapl := false
+	for metric := range metrics {
+		if strings.HasPrefix(metric, "psu_energy_") && strings.HasSuffix(metric, "_machine") {
+			machine = append(machine, metric)
+		}
+		rapl = rapl || strings.Contains(metric, "_energy_rapl_")
+	}
+	if len(machine) > 0 {
+		sort.Strings(machine)
+		return machine[0]
+	}
+	if rapl {
+		return gmtRAPLMetric
+	}
+	return ""
+}
+
+// gmtPhaseEnergy returns the energy of a phase in J by the metric of the run
+func gmtPhaseEnergy(phase *gmtPhase, metric string) float64 {
+	if metric != gmtRAPLMetric {
+		return phase.energy[metric]
+	}
+	var joules float64
+	for name, value := range phase.energy {
+		if strings.Contains(name, "_energy_rapl_") {
+			joules += value
+		}
+	}
+	return joules
+}
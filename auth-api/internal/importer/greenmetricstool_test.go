@@ -0,0 +1,102 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGreenMetricsTool(t *testing.T) {
+	t.Run("converts the runtime phase and its flows", func(t *testing.T) {
+		measurement := `{"success": true, "data": {
+  "id": "0b8b6b1e-8c51-4c38-9a6c-5b7a0c1e4f2d",
+  "name": "Stress test",
+  "uri": "https://github.com/octocat/hello-world.git",
+  "branch": "main",
+  "commit_hash": "a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2",
+  "filename": "usage_scenario.yml",
+  "created_at": "2024-03-01T10:00:00.123456+01:00",
+  "phase_stats": [
+    {"phase": "002_[BOOT]", "metric": "psu_energy_ac_mcp_machine", "detail_name": "[MACHINE]", "value": 500000000, "unit": "uJ"},
+    {"phase": "004_[RUNTIME]", "metric": "psu_energy_ac_mcp_machine", "detail_name": "[MACHINE]", "value": 3600000000, "unit": "uJ"},
+    {"phase": "004_[RUNTIME]", "metric": "psu_carbon_ac_mcp_machine", "detail_name": "[MACHINE]", "value": 400000, "unit": "ug"},
+    {"phase": "004_[RUNTIME]", "metric": "psu_power_ac_mcp_machine", "detail_name": "[MACHINE]", "value": 90000, "unit": "mW"},
+    {"phase": "004_[RUNTIME]", "metric": "cpu_energy_rapl_msr_component", "detail_name": "Package_0", "value": 2000000000, "unit": "uJ"},
+    {"phase": "004_[RUNTIME]", "metric": "phase_time_syscall_system", "detail_name": "[SYSTEM]", "value": 40000000, "unit": "us"},
+    {"phase": "006_Test", "metric": "psu_energy_ac_mcp_machine", "detail_name": "[MACHINE]", "value": 2400000000, "unit": "uJ"},
+    {"phase": "006_Test", "metric": "phase_time_syscall_system", "detail_name": "[SYSTEM]", "value": 30000000, "unit": "us"},
+    {"phase": "005_Build", "metric": "psu_energy_ac_mcp_machine", "detail_name": "[MACHINE]", "value": 1200000000, "unit": "uJ"},
+    {"phase": "005_Build", "metric": "psu_carbon_ac_mcp_machine", "detail_name": "[MACHINE]", "value": 130000, "unit": "ug"},
+    {"phase": "005_Build", "metric": "phase_time_syscall_system", "detail_name": "[SYSTEM]", "value": 10000000, "unit": "us"}
+  ]
+}}`
+		runs, err := GreenMetricsTool(strings.NewReader(measurement), "")
+		require.NoError(t, err)
+		require.Len(t, runs, 1)
+
+		run := runs[0]
+		assert.Equal(t, "0b8b6b1e-8c51-4c38-9a6c-5b7a0c1e4f2d", run.ImportID)
+		assert.Equal(t, time.Date(2024, 3, 1, 9, 0, 0, 123456000, time.UTC), run.CreatedAt)
+		assert.Equal(t, "octocat/hello-world", run.Repository.FullName)
+		assert.InDelta(t, 0.001, run.EnergyKWh, 1e-12)
+		assert.InDelta(t, 0.0004, run.CO2Kg, 1e-12)
+		assert.InDelta(t, 40.0, run.DurationS, 1e-9)
+		assert.Equal(t, "Stress test", *run.WorkflowName)
+		assert.Equal(t, "main", *run.BranchName)
+		assert.Equal(t, "a1b2c3d4e5f6a1b2c3d4e5f6a1b2c3d4e5f6a1b2", *run.GitCommitSHA)
+		assert.Equal(t, "green_metrics_tool", run.Metadata["measurement_method"])
+		assert.Equal(t, "psu_energy_ac_mcp_machine", run.Metadata["energy_metric"])
+		assert.Equal(t, "0b8b6b1e-8c51-4c38-9a6c-5b7a0c1e4f2d", run.Metadata["gmt_run_id"])
+		assert.Equal(t, "usage_scenario.yml", run.Metadata["gmt_filename"])
+		assert.NotContains(t, run.Metadata, "carbon_intensity")
+
+		steps := run.Metadata["steps"].([]interface{})
+		require.Len(t, steps, 2)
+		build := steps[0].(map[string]interface{})
+		assert.Equal(t, "Build", build["name"])
+		assert.InDelta(t, 1200.0/3.6e6, build["energy_kwh"], 1e-12)
+		assert.InDelta(t, 0.00013, build["co2_kg"], 1e-12)
+		assert.InDelta(t, 10.0, build["duration_s"], 1e-9)
+		// Without a carbon metric the default carbon intensity applies
+		test := steps[1].(map[string]interface{})
+		assert.Equal(t, "Test", test["name"])
+		assert.InDelta(t, 2400.0/3.6e6*400/1000, test["co2_kg"], 1e-12)
+	})
+
+	t.Run("sums the RAPL components of the flows", func(t *testing.T) {
+		measurements := `[
+  {"id": "run-1", "uri": "/home/me/project", "created_at": "2024-03-01T10:00:00Z", "phase_stats": [
+    {"phase": "005_Build", "metric": "cpu_energy_rapl_msr_component", "value": 3000, "unit": "J"},
+    {"phase": "005_Build", "metric": "memory_energy_rapl_msr_component", "value": 600, "unit": "J"}
+  ]}
+]`
+		runs, err := GreenMetricsTool(strings.NewReader(measurements), "octocat/hello-world")
+		require.NoError(t, err)
+		require.Len(t, runs, 1)
+		assert.InDelta(t, 0.001, runs[0].EnergyKWh, 1e-12)
+		assert.InDelta(t, 0.0004, runs[0].CO2Kg, 1e-12)
+		assert.Equal(t, "rapl_components", runs[0].Metadata["energy_metric"])
+		assert.Equal(t, 400.0, runs[0].Metadata["carbon_intensity"])
+		assert.Nil(t, runs[0].WorkflowName)
+	})
+
+	t.Run("reports invalid runs", func(t *testing.T) {
+		measurements := `[
+  {"id": "run-1", "uri": "/home/me/project", "created_at": "2024-03-01T10:00:00Z", "phase_stats": []},
+  {"id": "run-2", "uri": "https://github.com/octocat/hello-world", "created_at": "2024-03-01T10:00:00Z", "phase_stats": []},
+  {"name": "Stress test"}
+]`
+		_, err := GreenMetricsTool(strings.NewReader(measurements), "")
+		var lineErrors Errors
+		require.ErrorAs(t, err, &lineErrors)
+		require.Len(t, lineErrors, 3)
+		assert.Equal(t, 2, lineErrors[0].Line)
+		assert.Contains(t, lineErrors[0].Message, "set the repository of the import")
+		assert.Equal(t, LineError{Line: 3, Message: "run run-2 has no runtime phase stats"}, lineErrors[1])
+		assert.Equal(t, 4, lineErrors[2].Line)
+		assert.Contains(t, lineErrors[2].Message, "missing id")
+	})
+}
@@ -0,0 +1,113 @@
+// Package importer converts the output of other carbon measurement tools into EcoCI runs, so
+// existing measurement setups can bring their history along.
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// Import sources
+const (
+	SourceCodecarbon           = "codecarbon"
+	SourceCloudCarbonFootprint = "cloud-carbon-footprint"
+	SourceGreenMetricsTool     = "green-metrics-tool"
+	SourceEcoCI                = "ecoci"
+)
+
+// LineError is a record of an import that cannot be converted
+type LineError struct {
+	// Line is the line of the record in the file, counting the header
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+// Errors are the records of an import that cannot be converted; nothing is imported then
+type Errors []LineError
+
+func (e Errors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, lineErr := range e {
+		messages = append(messages, fmt.Sprintf("line %d: %s", lineErr.Line, lineErr.Message))
+	}
+	return strings.Join(messages, "; ")
+}
+
+// repository returns the repository request of a full name such as octocat/hello-world
+func repository(fullName string) (service.RepositoryCreateRequest, error) {
+	owner, name, ok := strings.Cut(fullName, "/")
+	if !ok || owner == "" || name == "" || strings.Contains(name, "/") {
+		return service.RepositoryCreateRequest{}, fmt.Errorf("repository must be owner/name, got %q", fullName)
+	}
+	return service.RepositoryCreateRequest{
+		Name:     name,
+		FullName: fullName,
+		HTMLURL:  "https://github.com/" + fullName,
+	}, nil
+}
+
+// jsonRecord is a record of a JSON file and the line it starts on
+type jsonRecord struct {
+	line int
+	raw  json.RawMessage
+}
+
+// jsonRecords returns the records of a JSON file: the elements of an array or of the data
+// member of a response object, which may also hold a single record, or a single object
+func jsonRecords(data []byte) ([]jsonRecord, error) {
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(data, &envelope); err == nil {
+		member, ok := envelope["data"]
+		if !ok {
+			return []jsonRecord{{line: 1, raw: data}}, nil
+		}
+		if member = bytes.TrimSpace(member); len(member) > 0 && member[0] == '{' {
+			return []jsonRecord{{line: 1, raw: member}}, nil
+		}
+	}
+	return jsonArray(data, "data")
+}
+
+// jsonArray returns the elements of a JSON array, or of the array in the named member of an
+// object
+func jsonArray(data []byte, name string) ([]jsonRecord, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	lineOf := func() int {
+		offset := int(decoder.InputOffset())
+		for offset < len(data) && (data[offset] == ',' || unicode.IsSpace(rune(data[offset]))) {
+			offset++
+		}
+		return 1 + bytes.Count(data[:offset], []byte("\n"))
+	}
+
+	token, err := decoder.Token()
+	if err == nil && token == json.Delim('{') {
+		for err == nil && token != name {
+			if token, err = decoder.Token(); err == nil && token != name {
+				var skip json.RawMessage
+				err = decoder.Decode(&skip)
+			}
+		}
+		if err == nil {
+			token, err = decoder.Token()
+		}
+	}
+	if err != nil || token != json.Delim('[') {
+		return nil, Errors{{Line: lineOf(), Message: "expected a JSON array or object"}}
+	}
+
+	var records []jsonRecord
+	for decoder.More() {
+		record := jsonRecord{line: lineOf()}
+		if err := decoder.Decode(&record.raw); err != nil {
+			return nil, Errors{{Line: record.line, Message: err.Error()}}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
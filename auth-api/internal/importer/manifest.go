@@ -0,0 +1,116 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/ecoci/auth-api/internal/export"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// manifestHeader is the part of a manifest describing its runs
+type manifestHeader struct {
+	Format     string                    `json:"format"`
+	Version    int                       `json:"version"`
+	Repository export.ManifestRepository `json:"repository"`
+}
+
+// Manifest converts the runs of an EcoCI carbon history manifest into runs of repo, or when
+// repo is empty of the repository of the manifest. Runs are identified by their ID in the
+// instance they were exported from, and keep their metadata.
+func Manifest(r io.Reader, repo string) ([]service.ImportedRun, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var header manifestHeader
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, Errors{{Line: 1, Message: err.Error()}}
+	}
+	if header.Format != export.ManifestFormat {
+		return nil, Errors{{Line: 1, Message: fmt.Sprintf("format must be %s; is this an EcoCI export?", export.ManifestFormat)}}
+	}
+	if header.Version < 1 || header.Version > export.ManifestVersion {
+		return nil, Errors{{Line: 1, Message: fmt.Sprintf("unsupported manifest version %d; this instance reads versions up to %d", header.Version, export.ManifestVersion)}}
+	}
+
+	if repo == "" {
+		repo = header.Repository.FullName
+	}
+	repository, err := repository(repo)
+	if err != nil {
+		return nil, Errors{{Line: 1, Message: err.Error()}}
+	}
+	if repo == header.Repository.FullName && header.Repository.HTMLURL != "" {
+		repository.HTMLURL = header.Repository.HTMLURL
+	}
+	repository.Description = header.Repository.Description
+	repository.Private = header.Repository.Private
+	repository.Language = header.Repository.Language
+
+	records, err := jsonArray(data, "runs")
+	if err != nil {
+		return nil, err
+	}
+	if len(records) > service.MaxImportRuns {
+		return nil, Errors{{Line: 1, Message: fmt.Sprintf("imports are limited to %d runs", service.MaxImportRuns)}}
+	}
+
+	var runs []service.ImportedRun
+	var lineErrors Errors
+	for _, record := range records {
+		var run export.ManifestRun
+		if err := json.Unmarshal(record.raw, &run); err != nil {
+			lineErrors = append(lineErrors, LineError{Line: record.line, Message: err.Error()})
+			continue
+		}
+		if err := validateManifestRun(&run); err != nil {
+			lineErrors = append(lineErrors, LineError{Line: record.line, Message: err.Error()})
+			continue
+		}
+		runs = append(runs, service.ImportedRun{
+			RunCreateRequest: service.RunCreateRequest{
+				EnergyKWh:        run.EnergyKWh,
+				CO2Kg:            run.CO2Kg,
+				DurationS:        run.DurationS,
+				GitCommitSHA:     run.GitCommitSHA,
+				BranchName:       run.BranchName,
+				WorkflowName:     run.WorkflowName,
+				WorkflowRunGroup: run.WorkflowRunGroup,
+				GitTag:           run.GitTag,
+				Environment:      run.Environment,
+				Repository:       repository,
+				Metadata:         run.Metadata,
+			},
+			CreatedAt: run.CreatedAt.UTC(),
+			ImportID:  run.ID,
+		})
+	}
+	if len(lineErrors) > 0 {
+		return nil, lineErrors
+	}
+	return runs, nil
+}
+
+// validateManifestRun checks the fields runs require
+func validateManifestRun(run *export.ManifestRun) error {
+	switch {
+	case run.ID == "":
+		return fmt.Errorf("missing id")
+	case run.CreatedAt.IsZero():
+		return fmt.Errorf("missing created_at")
+	case run.EnergyKWh < 0 || run.CO2Kg < 0 || run.DurationS < 0:
+		return fmt.Errorf("energy_kwh, co2_kg and duration_s must not be negative")
+	case run.GitCommitSHA != nil && len(*run.GitCommitSHA) != 40:
+		return fmt.Errorf("git_commit_sha must be 40 characters, got %q", *run.GitCommitSHA)
+	case run.WorkflowRunGroup != nil && len(*run.WorkflowRunGroup) > service.MaxWorkflowRunGroupLength:
+		return fmt.Errorf("workflow_run_group must be at most %d characters", service.MaxWorkflowRunGroupLength)
+	case run.GitTag != nil && (*run.GitTag == "" || len(*run.GitTag) > service.MaxGitTagLength):
+		return fmt.Errorf("git_tag must be 1 to %d characters", service.MaxGitTagLength)
+	case run.Environment != "" && !service.IsValidEnvironment(run.Environment):
+		return fmt.Errorf("unknown environment %q", run.Environment)
+	}
+	return nil
+}
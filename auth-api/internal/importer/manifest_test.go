@@ -0,0 +1,73 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifest(t *testing.T) {
+	manifest := `{
+  "format": "ecoci.carbon-history",
+  "version": 1,
+  "exported_at": "2024-04-01T00:00:00Z",
+  "source": "https://ecoci.example.com",
+  "repository": {"full_name": "octocat/hello-world", "name": "hello-world", "description": "Hi", "private": true, "html_url": "https://github.example.com/octocat/hello-world", "language": "Go"},
+  "runs": [
+    {"id": "3f0e1c9a-1d5b-4c1e-9d8f-0a2b3c4d5e6f", "created_at": "2024-03-01T10:00:00+01:00", "energy_kwh": 0.003, "co2_kg": 0.0012, "duration_s": 45.5,
+     "branch_name": "main", "workflow_name": "CI", "metadata": {"region": "eu-west-1"}},
+    {"id": "9a8b7c6d-5e4f-4a3b-8c2d-1e0f9a8b7c6d", "created_at": "2024-03-02T10:00:00Z", "energy_kwh": 0.002, "co2_kg": 0.0008, "duration_s": 30}
+  ]
+}`
+
+	t.Run("converts runs", func(t *testing.T) {
+		runs, err := Manifest(strings.NewReader(manifest), "")
+		require.NoError(t, err)
+		require.Len(t, runs, 2)
+
+		run := runs[0]
+		assert.Equal(t, "3f0e1c9a-1d5b-4c1e-9d8f-0a2b3c4d5e6f", run.ImportID)
+		assert.Equal(t, time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC), run.CreatedAt)
+		assert.Equal(t, 0.003, run.EnergyKWh)
+		assert.Equal(t, 0.0012, run.CO2Kg)
+		assert.Equal(t, 45.5, run.DurationS)
+		assert.Equal(t, "main", *run.BranchName)
+		assert.Equal(t, "CI", *run.WorkflowName)
+		assert.Nil(t, run.GitCommitSHA)
+		assert.Equal(t, map[string]interface{}{"region": "eu-west-1"}, run.Metadata)
+		assert.Equal(t, "octocat/hello-world", run.Repository.FullName)
+		assert.Equal(t, "https://github.example.com/octocat/hello-world", run.Repository.HTMLURL)
+		assert.Equal(t, "Hi", *run.Repository.Description)
+		assert.True(t, run.Repository.Private)
+		assert.Equal(t, "Go", *run.Repository.Language)
+	})
+
+	t.Run("imports into the repository given", func(t *testing.T) {
+		runs, err := Manifest(strings.NewReader(manifest), "octocat/moved")
+		require.NoError(t, err)
+		assert.Equal(t, "octocat/moved", runs[1].Repository.FullName)
+		assert.Equal(t, "https://github.com/octocat/moved", runs[1].Repository.HTMLURL)
+	})
+
+	t.Run("rejects other formats and newer versions", func(t *testing.T) {
+		_, err := Manifest(strings.NewReader(`{"format": "codecarbon", "version": 1}`), "")
+		assert.EqualError(t, err, "line 1: format must be ecoci.carbon-history; is this an EcoCI export?")
+		_, err = Manifest(strings.NewReader(strings.Replace(manifest, `"version": 1`, `"version": 2`, 1)), "")
+		assert.EqualError(t, err, "line 1: unsupported manifest version 2; this instance reads versions up to 1")
+	})
+
+	t.Run("reports invalid runs by line", func(t *testing.T) {
+		invalid := strings.Replace(manifest, `"duration_s": 30}`, `"duration_s": -30, "git_commit_sha": "abc"}`, 1)
+		invalid = strings.Replace(invalid, `"id": "3f0e1c9a-1d5b-4c1e-9d8f-0a2b3c4d5e6f", `, "", 1)
+		_, err := Manifest(strings.NewReader(invalid), "")
+		var lineErrors Errors
+		require.ErrorAs(t, err, &lineErrors)
+		assert.Equal(t, Errors{
+			{Line: 8, Message: "missing id"},
+			{Line: 10, Message: "energy_kwh, co2_kg and duration_s must not be negative"},
+		}, lineErrors)
+	})
+}
@@ -0,0 +1,448 @@
+// Package jobs runs the background jobs of the API (rollups, retention, scheduled reports,
+// webhook retries, alert evaluation) on cron schedules stored in the database. Every run is
+// recorded, and a lease on the job row ensures only one instance runs a job at a time.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"gorm.io/gorm"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/tracing"
+)
+
+// PollInterval is how often the scheduler looks for due jobs
+const PollInterval = 5 * time.Second
+
+// Run statuses
+const (
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// Run triggers
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+// Scheduling tuning
+const (
+	// DefaultTimeout bounds a run of a job that does not set its own timeout
+	DefaultTimeout = 10 * time.Minute
+	// RetryDelay is how soon a failed job runs again when its schedule is further away
+	RetryDelay = 15 * time.Minute
+)
+
+// ErrJobNotFound is returned for names that are not registered
+var ErrJobNotFound = errors.New("job not found")
+
+// ErrJobRunning is returned when triggering a job that is already running
+var ErrJobRunning = errors.New("job is already running")
+
+// Func runs a job at now and returns a short summary of what it did
+type Func func(ctx context.Context, now time.Time) (string, error)
+
+// Definition describes a job registered in code
+type Definition struct {
+	Name        string
+	Description string
+	// Schedule is the default cron expression (UTC), e.g. "0 9 * * 1" or "@every 10s";
+	// it can be changed at runtime
+	Schedule string
+	// Timeout bounds one run and is the length of its lease; DefaultTimeout when zero
+	Timeout time.Duration
+	Run     Func
+}
+
+// timeout returns the run timeout of the definition
+func (d *Definition) timeout() time.Duration {
+	if d.Timeout > 0 {
+		return d.Timeout
+	}
+	return DefaultTimeout
+}
+
+// Scheduler runs registered jobs on their schedules
+type Scheduler struct {
+	db          *gorm.DB
+	instance    string
+	definitions map[string]*Definition
+	running     sync.WaitGroup
+}
+
+// NewScheduler creates a new job scheduler
+func NewScheduler(database *gorm.DB) *Scheduler {
+	hostname, _ := os.Hostname()
+	return &Scheduler{
+		db:          database,
+		instance:    fmt.Sprintf("%s:%d", hostname, os.Getpid()),
+		definitions: make(map[string]*Definition),
+	}
+}
+
+// ParseSchedule parses a cron expression: five fields, a descriptor such as "@daily", or
+// "@every <duration>"
+func ParseSchedule(schedule string) (cron.Schedule, error) {
+	parsed, err := cron.ParseStandard(schedule)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule %q: %w", schedule, err)
+	}
+	return parsed, nil
+}
+
+// nextRun returns the next time schedule fires after now
+func nextRun(schedule string, now time.Time) (time.Time, error) {
+	parsed, err := ParseSchedule(schedule)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return parsed.Next(now.UTC()).UTC(), nil
+}
+
+// Register adds a job definition
+func (s *Scheduler) Register(definition Definition) error {
+	if _, err := ParseSchedule(definition.Schedule); err != nil {
+		return err
+	}
+	if _, exists := s.definitions[definition.Name]; exists {
+		return fmt.Errorf("job %s is already registered", definition.Name)
+	}
+	s.definitions[definition.Name] = &definition
+	return nil
+}
+
+// Sync creates the rows of registered jobs that are not stored yet, due immediately.
+// Stored jobs keep their schedule and enabled flag.
+func (s *Scheduler) Sync(now time.Time) error {
+	for _, definition := range s.definitions {
+		var job db.Job
+		err := s.db.Where("name = ?", definition.Name).Take(&job).Error
+		if err == nil {
+			if job.Description != definition.Description {
+				if err := s.db.Model(&job).Update("description", definition.Description).Error; err != nil {
+					return fmt.Errorf("failed to update job %s: %w", definition.Name, err)
+				}
+			}
+			continue
+		}
+		if err != gorm.ErrRecordNotFound {
+			return fmt.Errorf("failed to get job %s: %w", definition.Name, err)
+		}
+
+		job = db.Job{
+			Name:        definition.Name,
+			Description: definition.Description,
+			Schedule:    definition.Schedule,
+			Enabled:     true,
+			NextRunAt:   now.UTC(),
+		}
+		if err := s.db.Create(&job).Error; err != nil {
+			return fmt.Errorf("failed to create job %s: %w", definition.Name, err)
+		}
+	}
+	return nil
+}
+
+// List returns the registered jobs ordered by name
+func (s *Scheduler) List() ([]db.Job, error) {
+	names := make([]string, 0, len(s.definitions))
+	for name := range s.definitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var jobs []db.Job
+	if err := s.db.Where("name IN ?", names).Order("name ASC").Find(&jobs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// Get returns a registered job
+func (s *Scheduler) Get(name string) (*db.Job, error) {
+	if _, ok := s.definitions[name]; !ok {
+		return nil, ErrJobNotFound
+	}
+
+	var job db.Job
+	if err := s.db.Where("name = ?", name).Take(&job).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrJobNotFound
+		}
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+	return &job, nil
+}
+
+// ListRuns returns the most recent runs of a job, newest first
+func (s *Scheduler) ListRuns(name string, limit int) ([]db.JobRun, error) {
+	var runs []db.JobRun
+	err := s.db.Where("job_name = ?", name).
+		Order("started_at DESC").
+		Limit(limit).
+		Find(&runs).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list job runs: %w", err)
+	}
+	return runs, nil
+}
+
+// Update changes the schedule and enabled flag of a job; nil fields are left unchanged.
+// A new schedule takes effect from now.
+func (s *Scheduler) Update(name string, schedule *string, enabled *bool, now time.Time) (*db.Job, error) {
+	job, err := s.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if schedule != nil {
+		next, err := nextRun(*schedule, now)
+		if err != nil {
+			return nil, err
+		}
+		updates["schedule"] = *schedule
+		updates["next_run_at"] = next
+	}
+	if enabled != nil {
+		updates["enabled"] = *enabled
+	}
+	if len(updates) > 0 {
+		if err := s.db.Model(job).Updates(updates).Error; err != nil {
+			return nil, fmt.Errorf("failed to update job: %w", err)
+		}
+	}
+
+	return s.Get(name)
+}
+
+// RunDue starts every enabled job whose next run is due at now and that no instance holds
+// a lease on. Jobs run in the background; it returns how many were started.
+func (s *Scheduler) RunDue(ctx context.Context, now time.Time) (int, error) {
+	now = now.UTC()
+	var due []db.Job
+	err := s.db.Where("enabled = ? AND next_run_at <= ? AND (locked_until IS NULL OR locked_until < ?)", true, now, now).
+		Order("next_run_at ASC").
+		Find(&due).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to find due jobs: %w", err)
+	}
+
+	started := 0
+	for i := range due {
+		job := &due[i]
+		definition, ok := s.definitions[job.Name]
+		if !ok {
+			continue
+		}
+		next, err := nextRun(job.Schedule, now)
+		if err != nil {
+			log.Printf("Skipping job %s: %v", job.Name, err)
+			continue
+		}
+
+		run, err := s.claim(definition, now, TriggerSchedule, map[string]interface{}{"next_run_at": next})
+		if err != nil {
+			return started, err
+		}
+		if run == nil {
+			continue // claimed by another instance
+		}
+		s.start(ctx, definition, run)
+		started++
+	}
+	return started, nil
+}
+
+// Trigger runs a job now, outside its schedule, and returns the started run
+func (s *Scheduler) Trigger(ctx context.Context, name string, now time.Time) (*db.JobRun, error) {
+	if _, err := s.Get(name); err != nil {
+		return nil, err
+	}
+	definition := s.definitions[name]
+
+	run, err := s.claim(definition, now.UTC(), TriggerManual, map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+	if run == nil {
+		return nil, ErrJobRunning
+	}
+	s.start(ctx, definition, run)
+	return run, nil
+}
+
+// claim takes the lease of a job when it is free, and for scheduled runs still enabled and
+// due, applies updates to the job row and records a new run. It returns nil when the job
+// could not be claimed.
+func (s *Scheduler) claim(definition *Definition, now time.Time, trigger string, updates map[string]interface{}) (*db.JobRun, error) {
+	var run *db.JobRun
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		lockedUntil := now.Add(definition.timeout())
+		updates["locked_by"] = s.instance
+		updates["locked_until"] = lockedUntil
+
+		query := tx.Model(&db.Job{}).
+			Where("name = ? AND (locked_until IS NULL OR locked_until < ?)", definition.Name, now)
+		if trigger == TriggerSchedule {
+			query = query.Where("enabled = ? AND next_run_at <= ?", true, now)
+		}
+		result := query.Updates(updates)
+		if result.Error != nil {
+			return fmt.Errorf("failed to claim job %s: %w", definition.Name, result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		run = &db.JobRun{
+			ID:        uuid.New(),
+			JobName:   definition.Name,
+			Trigger:   trigger,
+			Status:    StatusRunning,
+			StartedAt: now.UTC(),
+		}
+		if err := tx.Create(run).Error; err != nil {
+			return fmt.Errorf("failed to record job run: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// start runs a claimed job in the background and records its outcome
+func (s *Scheduler) start(ctx context.Context, definition *Definition, run *db.JobRun) {
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+
+		runCtx, cancel := context.WithTimeout(ctx, definition.timeout())
+		defer cancel()
+
+		runCtx, span := tracing.Tracer().Start(runCtx, "job "+definition.Name)
+		span.SetAttributes(
+			attribute.String("job.name", definition.Name),
+			attribute.String("job.trigger", run.Trigger),
+			attribute.String("job.run_id", run.ID.String()),
+		)
+		defer span.End()
+
+		result, runErr := s.execute(runCtx, definition, run.StartedAt)
+		if runErr != nil {
+			span.RecordError(runErr)
+			span.SetStatus(codes.Error, runErr.Error())
+		}
+		if err := s.finish(definition, run, result, runErr); err != nil {
+			log.Printf("Failed to record run of job %s: %v", definition.Name, err)
+		}
+	}()
+}
+
+// execute calls the job function, turning a panic into an error
+func (s *Scheduler) execute(ctx context.Context, definition *Definition, now time.Time) (result string, err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("job panicked: %v", recovered)
+		}
+	}()
+	return definition.Run(ctx, now)
+}
+
+// finish records the outcome of a run and releases the lease of its job. Failed jobs are
+// retried after RetryDelay unless their schedule comes sooner.
+func (s *Scheduler) finish(definition *Definition, run *db.JobRun, result string, runErr error) error {
+	finished := time.Now().UTC()
+	duration := finished.Sub(run.StartedAt).Milliseconds()
+
+	run.Status = StatusSucceeded
+	run.FinishedAt = &finished
+	run.DurationMs = &duration
+	if result != "" {
+		run.Result = &result
+	}
+	if runErr != nil {
+		message := runErr.Error()
+		run.Status = StatusFailed
+		run.Error = &message
+		log.Printf("Job %s failed: %v", definition.Name, runErr)
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(run).Error; err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{
+			"last_run_at":      run.StartedAt,
+			"last_status":      run.Status,
+			"last_error":       run.Error,
+			"last_duration_ms": duration,
+			"locked_by":        nil,
+			"locked_until":     nil,
+		}
+		if runErr != nil {
+			retry := finished.Add(RetryDelay)
+			if err := tx.Model(&db.Job{}).
+				Where("name = ? AND next_run_at > ?", definition.Name, retry).
+				Update("next_run_at", retry).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&db.Job{}).
+			Where("name = ? AND locked_by = ?", definition.Name, s.instance).
+			Updates(updates).Error
+	})
+}
+
+// Wait blocks until all started runs have finished
+func (s *Scheduler) Wait() {
+	s.running.Wait()
+}
+
+// PruneRuns deletes the finished runs that started before cutoff and returns how many
+func (s *Scheduler) PruneRuns(cutoff time.Time) (int64, error) {
+	result := s.db.Where("status <> ? AND started_at < ?", StatusRunning, cutoff).Delete(&db.JobRun{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to prune job runs: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// Run creates missing job rows and starts due jobs every interval until ctx is cancelled
+func (s *Scheduler) Run(ctx context.Context, interval time.Duration) {
+	if err := s.Sync(time.Now().UTC()); err != nil {
+		log.Printf("Failed to sync jobs: %v", err)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.RunDue(ctx, time.Now().UTC()); err != nil {
+			log.Printf("Failed to start due jobs: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
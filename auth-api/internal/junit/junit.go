@@ -0,0 +1,168 @@
+// Package junit reads the test suites of JUnit XML reports, as written by JUnit, Surefire,
+// pytest, go-junit-report, Jest and most other test runners.
+package junit
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// MaxSuites bounds the test suites a report may hold
+const MaxSuites = 1000
+
+// Suite is a test suite of a report and the outcome of its test cases
+type Suite struct {
+	Name     string
+	Tests    int
+	Failures int
+	Errors   int
+	Skipped  int
+	// DurationS is the time the suite ran in seconds
+	DurationS float64
+}
+
+// xmlSuite is a testsuite or testsuites element
+type xmlSuite struct {
+	XMLName  xml.Name
+	Name     string     `xml:"name,attr"`
+	Time     string     `xml:"time,attr"`
+	Tests    string     `xml:"tests,attr"`
+	Failures string     `xml:"failures,attr"`
+	Errors   string     `xml:"errors,attr"`
+	Skipped  string     `xml:"skipped,attr"`
+	Cases    []xmlCase  `xml:"testcase"`
+	Suites   []xmlSuite `xml:"testsuite"`
+}
+
+// xmlCase is a testcase element
+type xmlCase struct {
+	ClassName string     `xml:"classname,attr"`
+	Time      string     `xml:"time,attr"`
+	Failures  []struct{} `xml:"failure"`
+	Errors    []struct{} `xml:"error"`
+	Skipped   []struct{} `xml:"skipped"`
+}
+
+// Parse reads the test suites of a JUnit XML report, whose root is a testsuites or a
+// testsuite element. Suites nesting others are flattened into their innermost suites, and
+// suites of the same name, such as the shards of a parallel run, are merged. Outcomes are
+// counted from the test cases of a suite, or taken from its attributes when it lists none;
+// its time is its time attribute, or the sum of its test cases.
+func Parse(r io.Reader) ([]Suite, error) {
+	var root xmlSuite
+	if err := xml.NewDecoder(r).Decode(&root); err != nil {
+		return nil, fmt.Errorf("invalid JUnit XML: %w", err)
+	}
+	if root.XMLName.Local != "testsuites" && root.XMLName.Local != "testsuite" {
+		return nil, fmt.Errorf("JUnit XML must have a testsuites or testsuite root, got %s", root.XMLName.Local)
+	}
+
+	var suites []Suite
+	index := map[string]int{}
+	var add func(s *xmlSuite) error
+	add = func(s *xmlSuite) error {
+		for i := range s.Suites {
+			if err := add(&s.Suites[i]); err != nil {
+				return err
+			}
+		}
+		if s.XMLName.Local == "testsuites" || (len(s.Suites) > 0 && len(s.Cases) == 0) {
+			return nil
+		}
+
+		suite, err := convert(s)
+		if err != nil {
+			return err
+		}
+		if i, ok := index[suite.Name]; ok {
+			merged := &suites[i]
+			merged.Tests += suite.Tests
+			merged.Failures += suite.Failures
+			merged.Errors += suite.Errors
+			merged.Skipped += suite.Skipped
+			merged.DurationS += suite.DurationS
+			return nil
+		}
+		if len(suites) == MaxSuites {
+			return fmt.Errorf("JUnit XML may hold at most %d test suites", MaxSuites)
+		}
+		index[suite.Name] = len(suites)
+		suites = append(suites, suite)
+		return nil
+	}
+	if err := add(&root); err != nil {
+		return nil, err
+	}
+	if len(suites) == 0 {
+		return nil, fmt.Errorf("JUnit XML holds no test suites")
+	}
+	return suites, nil
+}
+
+// convert returns the suite of a testsuite element
+func convert(s *xmlSuite) (Suite, error) {
+	suite := Suite{Name: strings.TrimSpace(s.Name)}
+	if suite.Name == "" && len(s.Cases) > 0 {
+		suite.Name = strings.TrimSpace(s.Cases[0].ClassName)
+	}
+	if suite.Name == "" {
+		return Suite{}, fmt.Errorf("test suites require a name")
+	}
+
+	caseTime := 0.0
+	for _, c := range s.Cases {
+		seconds, err := parseSeconds(c.Time)
+		if err != nil {
+			return Suite{}, fmt.Errorf("test suite %q: %w", suite.Name, err)
+		}
+		caseTime += seconds
+		switch {
+		case len(c.Errors) > 0:
+			suite.Errors++
+		case len(c.Failures) > 0:
+			suite.Failures++
+		case len(c.Skipped) > 0:
+			suite.Skipped++
+		}
+	}
+	suite.Tests = len(s.Cases)
+	if len(s.Cases) == 0 {
+		suite.Tests, suite.Failures = parseCount(s.Tests), parseCount(s.Failures)
+		suite.Errors, suite.Skipped = parseCount(s.Errors), parseCount(s.Skipped)
+	}
+
+	suite.DurationS = caseTime
+	if s.Time != "" {
+		seconds, err := parseSeconds(s.Time)
+		if err != nil {
+			return Suite{}, fmt.Errorf("test suite %q: %w", suite.Name, err)
+		}
+		suite.DurationS = seconds
+	}
+	return suite, nil
+}
+
+// parseSeconds parses a time attribute, which some runners write with thousands separators
+func parseSeconds(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	seconds, err := strconv.ParseFloat(strings.ReplaceAll(value, ",", ""), 64)
+	if err != nil || seconds < 0 || math.IsInf(seconds, 0) || math.IsNaN(seconds) {
+		return 0, fmt.Errorf("time %q is not a non-negative number of seconds", value)
+	}
+	return seconds, nil
+}
+
+// parseCount parses a count attribute; counts that are missing or invalid are zero
+func parseCount(value string) int {
+	count, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || count < 0 {
+		return 0
+	}
+	return count
+}
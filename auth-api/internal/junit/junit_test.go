@@ -0,0 +1,69 @@
+package junit
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("testsuites root", func(t *testing.T) {
+		report := `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites>
+  <testsuite name="api" time="12.5">
+    <testcase classname="api" name="create" time="10"/>
+    <testcase classname="api" name="delete" time="2"><failure message="boom"/></testcase>
+    <testcase classname="api" name="update"><skipped/></testcase>
+  </testsuite>
+  <testsuite name="db">
+    <testcase classname="db" name="migrate" time="1,200.5"><error/></testcase>
+  </testsuite>
+  <testsuite name="api" time="7.5">
+    <testcase classname="api" name="list" time="7.5"/>
+  </testsuite>
+</testsuites>`
+		suites, err := Parse(strings.NewReader(report))
+		require.NoError(t, err)
+		assert.Equal(t, []Suite{
+			// Shards of a suite are merged
+			{Name: "api", Tests: 4, Failures: 1, Skipped: 1, DurationS: 20},
+			// The time of a suite without one is that of its test cases
+			{Name: "db", Tests: 1, Errors: 1, DurationS: 1200.5},
+		}, suites)
+	})
+
+	t.Run("nested suites", func(t *testing.T) {
+		report := `<testsuite name="all" time="30">
+  <testsuite name="unit" time="10" tests="12" failures="1" errors="0" skipped="2"/>
+  <testsuite name="integration" time="20" tests="3"/>
+</testsuite>`
+		suites, err := Parse(strings.NewReader(report))
+		require.NoError(t, err)
+		assert.Equal(t, []Suite{
+			{Name: "unit", Tests: 12, Failures: 1, Skipped: 2, DurationS: 10},
+			{Name: "integration", Tests: 3, DurationS: 20},
+		}, suites)
+	})
+
+	t.Run("suite named by its test cases", func(t *testing.T) {
+		suites, err := Parse(strings.NewReader(`<testsuite><testcase classname="tests.test_models" time="0.5"/></testsuite>`))
+		require.NoError(t, err)
+		require.Len(t, suites, 1)
+		assert.Equal(t, "tests.test_models", suites[0].Name)
+	})
+
+	t.Run("invalid reports", func(t *testing.T) {
+		for name, report := range map[string]string{
+			"not XML":       "name,time\napi,1",
+			"other root":    `<report><testsuite name="api"/></report>`,
+			"no suites":     `<testsuites/>`,
+			"unnamed suite": `<testsuites><testsuite time="1"/></testsuites>`,
+			"invalid time":  `<testsuite name="api" time="-1"/>`,
+		} {
+			_, err := Parse(strings.NewReader(report))
+			assert.Error(t, err, name)
+		}
+	})
+}
@@ -0,0 +1,271 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/notify"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+var (
+	//go:embed templates/layout.html
+	htmlLayout string
+	//go:embed templates/layout.txt
+	textLayout string
+
+	htmlTemplate = htmltemplate.Must(htmltemplate.New("html").Parse(htmlLayout))
+	textTemplate = texttemplate.Must(texttemplate.New("text").Parse(textLayout))
+)
+
+// levelColors maps message levels to the accent color of the email
+var levelColors = map[string]string{
+	notify.LevelInfo:    "#2eb67d",
+	notify.LevelWarning: "#ecb22e",
+	notify.LevelAlert:   "#e01e5a",
+}
+
+// categoryReasons explains in the footer why a user receives an email of a category
+var categoryReasons = map[string]string{
+	service.EmailInvitations:   "You receive this email because a repository was shared with you on EcoCI.",
+	service.EmailAlerts:        "You receive this email because you own this repository on EcoCI.",
+	service.EmailReports:       "You receive this weekly report because you submit runs to EcoCI.",
+	service.EmailAccount:       "This is a notice about your EcoCI account.",
+	service.EmailAnnouncements: "You receive this announcement because you are a member of this organization on EcoCI.",
+}
+
+// Content is the data rendered into the email layout
+type Content struct {
+	Subject     string
+	Heading     string
+	Paragraphs  []string
+	Fields      []notify.Field
+	ActionLabel string
+	ActionURL   string
+	Level       string
+
+	// Set by the mailer from the email category
+	Color          string
+	Reason         string
+	PreferencesURL string
+}
+
+// Mailer sends the emails of a category to users that have not opted out of it.
+// A mailer without a sender is disabled and drops all emails.
+type Mailer struct {
+	sender  Sender
+	appURL  string
+	users   *service.UserService
+	stats   *service.StatsService
+	pending sync.WaitGroup
+}
+
+// NewMailer creates a mailer; sender may be nil to disable email
+func NewMailer(sender Sender, appURL string, users *service.UserService, stats *service.StatsService) *Mailer {
+	return &Mailer{
+		sender: sender,
+		appURL: strings.TrimRight(appURL, "/"),
+		users:  users,
+		stats:  stats,
+	}
+}
+
+// Enabled reports whether the mailer has a sender
+func (m *Mailer) Enabled() bool {
+	return m.sender != nil
+}
+
+// Render renders content into a message to the given address
+func Render(to string, content *Content) (*Message, error) {
+	var html, text bytes.Buffer
+	if err := htmlTemplate.Execute(&html, content); err != nil {
+		return nil, fmt.Errorf("failed to render email: %w", err)
+	}
+	if err := textTemplate.Execute(&text, content); err != nil {
+		return nil, fmt.Errorf("failed to render email: %w", err)
+	}
+
+	return &Message{
+		To:      to,
+		Subject: content.Subject,
+		HTML:    html.String(),
+		Text:    text.String(),
+	}, nil
+}
+
+// send renders content of category for user and delivers it in the background so slow
+// SMTP servers never delay the caller. Users without an email address or that opted out
+// of the category are skipped; failures are logged.
+func (m *Mailer) send(user *db.User, category string, content *Content) {
+	if !m.Enabled() || !service.WantsEmail(user, category) {
+		return
+	}
+
+	content.Color = levelColors[content.Level]
+	if content.Color == "" {
+		content.Color = levelColors[notify.LevelInfo]
+	}
+	content.Reason = categoryReasons[category]
+	if category != service.EmailAccount {
+		content.PreferencesURL = m.appURL + "/settings/notifications"
+	}
+
+	msg, err := Render(*user.GitHubEmail, content)
+	if err != nil {
+		log.Printf("Failed to render %s email for user %s: %v", category, user.ID, err)
+		return
+	}
+
+	m.pending.Add(1)
+	go func() {
+		defer m.pending.Done()
+		if err := m.sender.Send(msg); err != nil {
+			log.Printf("Failed to send %s email to user %s: %v", category, user.ID, err)
+		}
+	}()
+}
+
+// Wait blocks until all emails queued so far have been sent
+func (m *Mailer) Wait() {
+	m.pending.Wait()
+}
+
+// SendInvitation tells a user that inviter shared a repository with them
+func (m *Mailer) SendInvitation(user, inviter *db.User, repo *db.Repository) {
+	m.send(user, service.EmailInvitations, &Content{
+		Subject: fmt.Sprintf("%s shared %s with you on EcoCI", inviter.GitHubUsername, repo.FullName),
+		Heading: fmt.Sprintf("You now have access to %s", repo.FullName),
+		Paragraphs: []string{
+			fmt.Sprintf("%s added you as a collaborator, so you can follow the CO₂ emissions of its CI runs.", inviter.GitHubUsername),
+		},
+		ActionLabel: "Open repository",
+		ActionURL:   fmt.Sprintf("%s/repos/%s", m.appURL, repo.ID),
+		Level:       notify.LevelInfo,
+	})
+}
+
+// SendAlert emails a threshold alert, formatted like the chat notification, to a repository owner
+func (m *Mailer) SendAlert(user *db.User, msg notify.Message) {
+	content := &Content{
+		Subject:    msg.Title,
+		Heading:    msg.Title,
+		Paragraphs: []string{msg.Text},
+		Fields:     msg.Fields,
+		Level:      msg.Level,
+	}
+	if msg.Link != "" {
+		content.ActionLabel = "Open repository"
+		content.ActionURL = msg.Link
+	}
+	m.send(user, service.EmailAlerts, content)
+}
+
+// SendAnnouncement emails an announcement of an organization, formatted like the chat
+// notification, to one of its members
+func (m *Mailer) SendAnnouncement(user *db.User, msg notify.Message) {
+	m.send(user, service.EmailAnnouncements, &Content{
+		Subject:    msg.Title,
+		Heading:    msg.Title,
+		Paragraphs: []string{msg.Text},
+		Fields:     msg.Fields,
+		Level:      msg.Level,
+	})
+}
+
+// SendWelcome greets a user that signed in for the first time
+func (m *Mailer) SendWelcome(user *db.User) {
+	m.send(user, service.EmailAccount, &Content{
+		Subject: "Welcome to EcoCI",
+		Heading: fmt.Sprintf("Welcome, %s", user.GitHubUsername),
+		Paragraphs: []string{
+			"Your EcoCI account has been created. Submit runs from your CI pipelines to track the energy use and CO₂ emissions of your builds.",
+			"Threshold alerts and weekly reports are sent to this address; you can opt out of them at any time.",
+		},
+		ActionLabel: "Open EcoCI",
+		ActionURL:   m.appURL,
+		Level:       notify.LevelInfo,
+	})
+}
+
+// SendWeeklyReports emails every user that receives reports the summary of the runs they
+// submitted in the week before now. Users without runs that week, or that chose not to
+// receive the weekly digest, are skipped.
+func (m *Mailer) SendWeeklyReports(ctx context.Context, now time.Time) error {
+	if !m.Enabled() {
+		return nil
+	}
+
+	users, err := m.users.ListEmailRecipients(service.EmailReports)
+	if err != nil {
+		return err
+	}
+
+	for i := range users {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		user := &users[i]
+		channel, err := m.users.ResolveNotificationChannel(user.ID, service.NotificationWeeklyDigest, nil, nil)
+		if err != nil {
+			return err
+		}
+		if channel.Channel != service.NotificationChannelEmail {
+			continue
+		}
+		preferences, err := m.users.GetPreferences(user)
+		if err != nil {
+			return err
+		}
+		from, to := reportWeek(now, preferences.Location())
+		scope := service.UserRuns(user.ID)
+		summary, err := m.stats.Summary(scope, from, to)
+		if err != nil {
+			return err
+		}
+		if summary.RunCount == 0 {
+			continue
+		}
+		comparison, err := m.stats.CompareWithPreviousPeriod(scope, summary)
+		if err != nil {
+			return err
+		}
+		m.send(user, service.EmailReports, weeklyReport(summary, comparison, preferences, m.appURL))
+	}
+	return nil
+}
+
+// reportWeek returns the calendar week, Monday to Sunday, before the one of now in location
+func reportWeek(now time.Time, location *time.Location) (time.Time, time.Time) {
+	now = now.In(location)
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+	weekStart := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	return weekStart.AddDate(0, 0, -7), weekStart.Add(-time.Microsecond)
+}
+
+// weeklyReport formats the weekly report of a user in their time zone and display units
+func weeklyReport(summary *service.PeriodSummary, comparison *service.PeriodComparison, preferences *service.Preferences, appURL string) *Content {
+	fields, level := notify.SummaryFields(summary, comparison, preferences.DisplayUnits)
+	location := preferences.Location()
+	from, to := summary.From.In(location).Format("2006-01-02"), summary.To.In(location).Format("2006-01-02")
+	return &Content{
+		Subject: fmt.Sprintf("Your weekly EcoCI report (%s)", from),
+		Heading: "Your weekly CO₂ report",
+		Paragraphs: []string{
+			fmt.Sprintf("Runs you submitted from %s to %s (%s).", from, to, preferences.Timezone),
+		},
+		Fields:      fields,
+		ActionLabel: "Open EcoCI",
+		ActionURL:   appURL,
+		Level:       level,
+	}
+}
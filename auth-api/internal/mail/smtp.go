@@ -0,0 +1,118 @@
+// Package mail renders and sends the emails of EcoCI: invitations, threshold alerts,
+// scheduled reports and account notices
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Message is a rendered email with an HTML body and a plain text alternative
+type Message struct {
+	To      string
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// Sender delivers rendered emails
+type Sender interface {
+	Send(msg *Message) error
+}
+
+// SMTPSender delivers emails through an SMTP server. STARTTLS is used when the server
+// offers it; credentials are sent with PLAIN auth.
+type SMTPSender struct {
+	addr string
+	host string
+	auth smtp.Auth
+	from *mail.Address
+}
+
+// NewSMTPSender creates an SMTP sender. from may include a display name ("EcoCI <noreply@ecoci.dev>").
+func NewSMTPSender(host string, port int, username, password, from string) (*SMTPSender, error) {
+	address, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender address: %w", err)
+	}
+
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTPSender{
+		addr: net.JoinHostPort(host, strconv.Itoa(port)),
+		host: host,
+		auth: auth,
+		from: address,
+	}, nil
+}
+
+// Send delivers msg
+func (s *SMTPSender) Send(msg *Message) error {
+	body, err := s.encode(msg)
+	if err != nil {
+		return err
+	}
+	if err := smtp.SendMail(s.addr, s.auth, s.from.Address, []string{msg.To}, body); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+// encode builds the MIME representation of msg as a multipart/alternative email
+func (s *SMTPSender) encode(msg *Message) ([]byte, error) {
+	var buf bytes.Buffer
+	parts := multipart.NewWriter(&buf)
+
+	var out bytes.Buffer
+	for _, field := range [][2]string{
+		{"From", s.from.String()},
+		{"To", msg.To},
+		{"Subject", mime.QEncoding.Encode("utf-8", msg.Subject)},
+		{"Date", time.Now().UTC().Format(time.RFC1123Z)},
+		{"Message-ID", fmt.Sprintf("<%s@%s>", uuid.New(), s.host)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + parts.Boundary()},
+	} {
+		fmt.Fprintf(&out, "%s: %s\r\n", field[0], field[1])
+	}
+	out.WriteString("\r\n")
+
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode email: %w", err)
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.body)); err != nil {
+			return nil, fmt.Errorf("failed to encode email: %w", err)
+		}
+		if err := qp.Close(); err != nil {
+			return nil, fmt.Errorf("failed to encode email: %w", err)
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode email: %w", err)
+	}
+
+	out.Write(buf.Bytes())
+	return out.Bytes(), nil
+}
@@ -1,38 +1,46 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 
 	"github.com/ecoci/auth-api/internal/auth"
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/service"
 )
 
-// JWTAuth middleware validates JWT tokens from cookies
+// requestToken returns the JWT of a request: the bearer token of the Authorization header,
+// which API clients such as the ecoci CLI send, or else the session cookie of the web app
+func requestToken(c *gin.Context) (string, error) {
+	if header := c.GetHeader("Authorization"); header != "" {
+		scheme, token, ok := strings.Cut(header, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+			return "", errors.New("malformed Authorization header")
+		}
+		return strings.TrimSpace(token), nil
+	}
+	return c.Cookie("ecoci_token")
+}
+
+// JWTAuth middleware validates JWT tokens from the Authorization header or cookies
 func JWTAuth(jwtManager *auth.JWTManager) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Get token from cookie
-		tokenString, err := c.Cookie("ecoci_token")
+		tokenString, err := requestToken(c)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error":     "Authentication required",
-				"code":      "MISSING_TOKEN",
-				"timestamp": gin.H{"$ref": "#/components/schemas/Error"},
-			})
-			c.Abort()
+			problem.Abort(c, http.StatusUnauthorized, "MISSING_TOKEN", "Authentication required")
 			return
 		}
 
 		// Validate token
 		claims, err := jwtManager.ValidateToken(tokenString)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error":     "Invalid authentication token",
-				"code":      "INVALID_TOKEN",
-				"timestamp": gin.H{"$ref": "#/components/schemas/Error"},
-			})
-			c.Abort()
+			problem.Abort(c, http.StatusUnauthorized, "INVALID_TOKEN", "Invalid authentication token")
 			return
 		}
 
@@ -45,11 +53,12 @@ func JWTAuth(jwtManager *auth.JWTManager) gin.HandlerFunc {
 	}
 }
 
-// OptionalJWTAuth middleware validates JWT tokens but doesn't require them
-func OptionalJWTAuth(jwtManager *auth.JWTManager) gin.HandlerFunc {
+// OptionalJWTAuth middleware validates JWT tokens but doesn't require them. Valid tokens
+// ActiveAccount would reject, of deleted or suspended accounts or API tokens that were
+// deleted or expired, are rejected the same way rather than served as anonymous.
+func OptionalJWTAuth(jwtManager *auth.JWTManager, userService *service.UserService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Get token from cookie
-		tokenString, err := c.Cookie("ecoci_token")
+		tokenString, err := requestToken(c)
 		if err != nil {
 			// No token present, continue without authentication
 			c.Next()
@@ -63,6 +72,11 @@ func OptionalJWTAuth(jwtManager *auth.JWTManager) gin.HandlerFunc {
 			c.Next()
 			return
 		}
+		if _, rejected := checkAccount(c, userService, claims.UserID, claims); rejected != nil {
+			problem.Write(c, rejected)
+			c.Abort()
+			return
+		}
 
 		// Store user info in context if valid
 		c.Set("user_id", claims.UserID)
@@ -73,59 +87,86 @@ func OptionalJWTAuth(jwtManager *auth.JWTManager) gin.HandlerFunc {
 	}
 }
 
-// AdminAuth middleware ensures user has admin privileges
-func AdminAuth() gin.HandlerFunc {
+// ActiveAccount middleware loads the account of the authenticated user and rejects
+// deleted and suspended accounts, so their tokens stop working immediately, as well as API
+// tokens that were deleted or expired, recording the use of the others. It stores the role
+// and plan of the user in the context and must run after JWTAuth.
+func ActiveAccount(userService *service.UserService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// For now, admin is determined by specific GitHub usernames
-		// In production, this should be stored in the database
-		githubUsername, exists := c.Get("github_username")
+		userID, exists := c.Get("user_id")
 		if !exists {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error":     "Authentication required",
-				"code":      "MISSING_AUTH",
-				"timestamp": gin.H{"$ref": "#/components/schemas/Error"},
-			})
-			c.Abort()
+			problem.Abort(c, http.StatusUnauthorized, "MISSING_AUTH", "Authentication required")
 			return
 		}
 
-		username, ok := githubUsername.(string)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error":     "Invalid authentication data",
-				"code":      "INVALID_AUTH",
-				"timestamp": gin.H{"$ref": "#/components/schemas/Error"},
-			})
+		var claims *auth.JWTClaims
+		if value, ok := c.Get("jwt_claims"); ok {
+			claims = value.(*auth.JWTClaims)
+		}
+		user, rejected := checkAccount(c, userService, userID.(uuid.UUID), claims)
+		if rejected != nil {
+			problem.Write(c, rejected)
 			c.Abort()
 			return
 		}
 
-		// Simple admin check - in production, use database roles
-		adminUsers := []string{
-			"admin",
-			"ecoci-admin",
-			// Add more admin usernames as needed
+		c.Set("user_role", user.Role)
+		if user.Plan != nil {
+			c.Set("user_plan", *user.Plan)
 		}
+		if user.DisplayUnits != nil {
+			c.Set("user_display_units", *user.DisplayUnits)
+		}
+		c.Next()
+	}
+}
+
+// checkAccount loads the account of userID and checks that it is active and, for API tokens,
+// that the token is still valid, recording its use. Requests that may not proceed get the
+// problem to reject them with.
+func checkAccount(c *gin.Context, userService *service.UserService, userID uuid.UUID, claims *auth.JWTClaims) (*db.User, *problem.Problem) {
+	user, err := userService.GetUserByID(userID)
+	if err != nil {
+		return nil, problem.New(http.StatusUnauthorized, "ACCOUNT_NOT_FOUND", "Account not found")
+	}
+	if user.SuspendedAt != nil {
+		return nil, problem.New(http.StatusForbidden, "ACCOUNT_SUSPENDED", "Account suspended")
+	}
+	if claims == nil || !claims.IsAPIToken() {
+		return user, nil
+	}
 
-		isAdmin := false
-		for _, adminUser := range adminUsers {
-			if strings.EqualFold(username, adminUser) {
-				isAdmin = true
-				break
-			}
+	tokenID, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return nil, problem.New(http.StatusUnauthorized, "INVALID_TOKEN", "Invalid authentication token")
+	}
+	err = userService.UseAPIToken(user.ID, tokenID, c.ClientIP(), time.Now().UTC())
+	switch {
+	case errors.Is(err, service.ErrAPITokenRevoked):
+		return nil, problem.New(http.StatusUnauthorized, "API_TOKEN_REVOKED", "API token revoked")
+	case errors.Is(err, service.ErrAPITokenExpired):
+		return nil, problem.New(http.StatusUnauthorized, "API_TOKEN_EXPIRED", "API token expired")
+	case err != nil:
+		return nil, problem.New(http.StatusInternalServerError, "API_TOKEN_CHECK_FAILED", "Failed to check API token")
+	}
+	return user, nil
+}
+
+// AdminAuth middleware ensures user has admin privileges; it must run after ActiveAccount
+func AdminAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, exists := c.Get("user_role")
+		if !exists {
+			problem.Abort(c, http.StatusUnauthorized, "MISSING_AUTH", "Authentication required")
+			return
 		}
 
-		if !isAdmin {
-			c.JSON(http.StatusForbidden, gin.H{
-				"error":     "Admin privileges required",
-				"code":      "INSUFFICIENT_PRIVILEGES",
-				"timestamp": gin.H{"$ref": "#/components/schemas/Error"},
-			})
-			c.Abort()
+		if role != db.RoleAdmin {
+			problem.Abort(c, http.StatusForbidden, "INSUFFICIENT_PRIVILEGES", "Admin privileges required")
 			return
 		}
 
 		c.Set("is_admin", true)
 		c.Next()
 	}
-}
\ No newline at end of file
+}
@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ecoci/auth-api/internal/problem"
+)
+
+// supportedEncodings lists the request content codings RequestBody decodes, for the
+// Accept-Encoding header of 415 responses
+const supportedEncodings = "gzip, deflate"
+
+// errUnsupportedEncoding reports a Content-Encoding RequestBody cannot decode
+var errUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// decodeBody returns a reader of body decoded from encoding: gzip, or deflate as the zlib
+// format of RFC 9110
+func decodeBody(encoding string, body io.Reader) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "", "identity":
+		return body, nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(body)
+	case "deflate":
+		return zlib.NewReader(body)
+	default:
+		return nil, errUnsupportedEncoding
+	}
+}
+
+// RequestBody middleware limits request bodies to maxBytes and transparently decodes bodies
+// sent with a gzip or deflate Content-Encoding, so clients can compress large payloads. The
+// limit applies to the body as sent and as decoded, so a small compressed body cannot expand
+// without bound. Bodies over the limit are rejected with 413, unknown encodings with 415 and
+// bodies that fail to decode with 400.
+func RequestBody(maxBytes int64) gin.HandlerFunc {
+	tooLarge := func(c *gin.Context) {
+		problem.Write(c, problem.New(http.StatusRequestEntityTooLarge, "REQUEST_BODY_TOO_LARGE", "Request body too large").
+			WithDetail("Request bodies are limited to "+strconv.FormatInt(maxBytes, 10)+" bytes").
+			With("max_bytes", maxBytes))
+		c.Abort()
+	}
+
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > maxBytes {
+			tooLarge(c)
+			return
+		}
+
+		body := http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		decoded, err := decodeBody(c.GetHeader("Content-Encoding"), body)
+		var data []byte
+		if err == nil {
+			// Read one byte past the limit to tell a full body from an oversized one
+			data, err = io.ReadAll(io.LimitReader(decoded, maxBytes+1))
+		}
+
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.Is(err, errUnsupportedEncoding):
+			c.Header("Accept-Encoding", supportedEncodings)
+			problem.RespondDetail(c, http.StatusUnsupportedMediaType, "UNSUPPORTED_CONTENT_ENCODING", "Unsupported content encoding", "Request bodies may be encoded with "+supportedEncodings)
+			c.Abort()
+			return
+		case errors.As(err, &maxBytesErr) || int64(len(data)) > maxBytes:
+			tooLarge(c)
+			return
+		case err != nil:
+			problem.RespondDetail(c, http.StatusBadRequest, "INVALID_CONTENT_ENCODING", "Invalid content encoding", err.Error())
+			c.Abort()
+			return
+		}
+
+		// Handlers read the decoded body as if it had been sent uncompressed
+		c.Request.Body = io.NopCloser(bytes.NewReader(data))
+		c.Request.ContentLength = int64(len(data))
+		c.Request.Header.Del("Content-Encoding")
+		c.Next()
+	}
+}
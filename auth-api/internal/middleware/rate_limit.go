@@ -1,22 +1,84 @@
 package middleware
 
 import (
+	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"golang.org/x/time/rate"
+
+	"github.com/ecoci/auth-api/internal/auth"
+	"github.com/ecoci/auth-api/internal/config"
+	"github.com/ecoci/auth-api/internal/problem"
+	"github.com/ecoci/auth-api/internal/ratelimit"
+)
+
+// Rate limit response headers
+const (
+	RateLimitLimitHeader     = "X-RateLimit-Limit"
+	RateLimitRemainingHeader = "X-RateLimit-Remaining"
+	RateLimitResetHeader     = "X-RateLimit-Reset"
+	RetryAfterHeader         = "Retry-After"
 )
 
+// RateLimitHeaders lists the headers set by the rate limiters, for CORS
+var RateLimitHeaders = []string{RateLimitLimitHeader, RateLimitRemainingHeader, RateLimitResetHeader, RetryAfterHeader}
+
+// setRateLimitHeaders describes a limit to the client: its size, the requests left and when it
+// is fully available again (Unix time). Requests pass several limiters, so the headers keep
+// describing whichever limit has the fewest requests left.
+func setRateLimitHeaders(c *gin.Context, limit, remaining int, resetAt time.Time) {
+	if current, err := strconv.Atoi(c.Writer.Header().Get(RateLimitRemainingHeader)); err == nil && current < remaining {
+		return
+	}
+	c.Header(RateLimitLimitHeader, strconv.Itoa(limit))
+	c.Header(RateLimitRemainingHeader, strconv.Itoa(remaining))
+	c.Header(RateLimitResetHeader, strconv.FormatInt(resetAt.Unix(), 10))
+}
+
+// rejectRateLimited responds with 429 and a Retry-After of retryAfter, rounded up to whole
+// seconds
+func rejectRateLimited(c *gin.Context, retryAfter time.Duration, message, code string) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header(RetryAfterHeader, strconv.Itoa(seconds))
+	problem.Abort(c, http.StatusTooManyRequests, code, message)
+}
+
+// allowTokenBucket takes a token from limiter at now, sets the rate limit headers of the bucket
+// and reports whether a token was available; otherwise it returns how long until one is
+func allowTokenBucket(c *gin.Context, limiter *rate.Limiter, now time.Time) (bool, time.Duration) {
+	allowed := limiter.AllowN(now, 1)
+
+	tokens := limiter.TokensAt(now)
+	remaining := int(math.Floor(tokens))
+	if remaining < 0 {
+		remaining = 0
+	}
+	// The bucket refills at the limit; it is full again once the missing tokens are back
+	refill := func(missing float64) time.Duration {
+		rps := float64(limiter.Limit())
+		if missing <= 0 || rps <= 0 || math.IsInf(rps, 1) {
+			return 0
+		}
+		return time.Duration(missing / rps * float64(time.Second))
+	}
+	setRateLimitHeaders(c, limiter.Burst(), remaining, now.Add(refill(float64(limiter.Burst())-tokens)))
+
+	return allowed, refill(1 - tokens)
+}
+
 // RateLimiter middleware implements rate limiting using token bucket algorithm
 func RateLimiter(limiter *rate.Limiter) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if !limiter.Allow() {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error":     "Rate limit exceeded",
-				"code":      "RATE_LIMIT_EXCEEDED",
-				"timestamp": gin.H{"$ref": "#/components/schemas/Error"},
-			})
-			c.Abort()
+		if allowed, retryAfter := allowTokenBucket(c, limiter, time.Now()); !allowed {
+			rejectRateLimited(c, retryAfter, "Rate limit exceeded", "RATE_LIMIT_EXCEEDED")
 			return
 		}
 		c.Next()
@@ -37,16 +99,64 @@ func PerIPRateLimiter(rps rate.Limit, burst int) gin.HandlerFunc {
 			limiters[ip] = limiter
 		}
 
-		if !limiter.Allow() {
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error":     "Rate limit exceeded for your IP address",
-				"code":      "IP_RATE_LIMIT_EXCEEDED",
-				"timestamp": gin.H{"$ref": "#/components/schemas/Error"},
-			})
-			c.Abort()
+		if allowed, retryAfter := allowTokenBucket(c, limiter, time.Now()); !allowed {
+			rejectRateLimited(c, retryAfter, "Rate limit exceeded for your IP address", "IP_RATE_LIMIT_EXCEEDED")
 			return
 		}
 		
 		c.Next()
 	}
-}
\ No newline at end of file
+}
+
+// UserRateLimiter middleware limits the requests of each authenticated user, and of each of
+// their tokens, to the limits of the user's plan so one user cannot exhaust the global
+// budget. Counters live in Redis and are shared by all instances; when Redis fails, requests
+// are let through. It must run after ActiveAccount.
+func UserRateLimiter(limiter *ratelimit.Limiter, cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.Next()
+			return
+		}
+		plan := cfg.RatePlan(c.GetString("user_plan"))
+		now := time.Now()
+
+		result, err := limiter.Allow(c.Request.Context(), "user:"+userID.(uuid.UUID).String(), plan.UserLimit, now)
+		if err != nil {
+			log.Printf("Warning: rate limiting unavailable: %v", err)
+			c.Next()
+			return
+		}
+		code := ""
+		if !result.Allowed {
+			code = "USER_RATE_LIMIT_EXCEEDED"
+		}
+
+		if claims, ok := c.Get("jwt_claims"); ok {
+			if tokenID := claims.(*auth.JWTClaims).ID; tokenID != "" {
+				tokenResult, err := limiter.Allow(c.Request.Context(), "token:"+tokenID, plan.TokenLimit, now)
+				if err != nil {
+					log.Printf("Warning: rate limiting unavailable: %v", err)
+				} else {
+					if code == "" && !tokenResult.Allowed {
+						code = "TOKEN_RATE_LIMIT_EXCEEDED"
+					}
+					// Report whichever limit is closer to being reached
+					if tokenResult.Remaining < result.Remaining {
+						result = tokenResult
+					}
+				}
+			}
+		}
+
+		setRateLimitHeaders(c, result.Limit, result.Remaining, result.ResetAt)
+
+		if code != "" {
+			rejectRateLimited(c, time.Until(result.ResetAt), "Rate limit of your plan exceeded", code)
+			return
+		}
+
+		c.Next()
+	}
+}
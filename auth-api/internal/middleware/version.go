@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/ecoci/auth-api/internal/problem"
+)
+
+// API versioning headers
+const (
+	APIVersionHeader  = "API-Version"
+	DeprecationHeader = "Deprecation"
+	SunsetHeader      = "Sunset"
+	LinkHeader        = "Link"
+)
+
+// VersionHeaders lists the headers set by the versioning middleware, for CORS
+var VersionHeaders = []string{APIVersionHeader, DeprecationHeader, SunsetHeader, LinkHeader}
+
+// versionMediaType matches the vendor media type clients can request a version with in Accept,
+// such as application/vnd.ecoci.v1+json
+var versionMediaType = regexp.MustCompile(`application/vnd\.ecoci\.v(\d+)\+json`)
+
+// requestedVersion returns the API version requested with the API-Version header or the Accept
+// header, or 0 when the client did not ask for one. Values that are not a version number are
+// returned as -1.
+func requestedVersion(c *gin.Context) int {
+	if value := c.GetHeader(APIVersionHeader); value != "" {
+		version, err := strconv.Atoi(value)
+		if err != nil || version < 1 {
+			return -1
+		}
+		return version
+	}
+	if match := versionMediaType.FindStringSubmatch(c.GetHeader("Accept")); match != nil {
+		version, err := strconv.Atoi(match[1])
+		if err != nil || version < 1 {
+			return -1
+		}
+		return version
+	}
+	return 0
+}
+
+// APIVersion middleware serves routes of the given API version. Clients may pin the version
+// with the API-Version header or an Accept of application/vnd.ecoci.v<version>+json; requests
+// for another version are rejected with 406 so integrations notice instead of misreading
+// responses. Every response names the version it was served with.
+func APIVersion(version int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if requested := requestedVersion(c); requested != 0 && requested != version {
+			problem.Write(c, problem.New(http.StatusNotAcceptable, "UNSUPPORTED_API_VERSION", "Unsupported API version").
+				With("supported_versions", []int{version}))
+			c.Abort()
+			return
+		}
+
+		c.Header(APIVersionHeader, strconv.Itoa(version))
+		c.Next()
+	}
+}
+
+// Deprecated middleware marks the responses of deprecated routes with a Deprecation header, a
+// Sunset header when the routes have a removal date, and a Link to the successor route at the
+// same path under successorPrefix
+func Deprecated(successorPrefix string, sunset time.Time) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header(DeprecationHeader, "true")
+		if !sunset.IsZero() {
+			c.Header(SunsetHeader, sunset.UTC().Format(http.TimeFormat))
+		}
+		c.Header(LinkHeader, fmt.Sprintf(`<%s%s>; rel="successor-version"`, successorPrefix, c.Request.URL.Path))
+		c.Next()
+	}
+}
@@ -0,0 +1,71 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// discordColors maps message levels to Discord embed colors
+var discordColors = map[string]int{
+	LevelInfo:    0x2EB67D,
+	LevelWarning: 0xECB22E,
+	LevelAlert:   0xE01E5A,
+}
+
+// DiscordNotifier posts messages as embeds through a Discord channel webhook.
+// The webhook is bound to one channel, so the channel argument of Send is ignored.
+type DiscordNotifier struct {
+	client     *http.Client
+	webhookURL string
+}
+
+// NewDiscordNotifier creates a Discord notifier for a channel webhook URL
+func NewDiscordNotifier(client *http.Client, webhookURL string) *DiscordNotifier {
+	return &DiscordNotifier{
+		client:     client,
+		webhookURL: webhookURL,
+	}
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	URL         string         `json:"url,omitempty"`
+	Color       int            `json:"color,omitempty"`
+	Fields      []discordField `json:"fields,omitempty"`
+}
+
+type discordMessage struct {
+	Username string         `json:"username"`
+	Embeds   []discordEmbed `json:"embeds"`
+}
+
+// Send posts msg as an embed
+func (n *DiscordNotifier) Send(ctx context.Context, channel string, msg Message) error {
+	embed := discordEmbed{
+		Title:       msg.Title,
+		Description: msg.Text,
+		URL:         msg.Link,
+		Color:       discordColors[msg.Level],
+	}
+	for _, field := range msg.Fields {
+		embed.Fields = append(embed.Fields, discordField{Name: field.Name, Value: field.Value, Inline: true})
+	}
+
+	body, err := json.Marshal(discordMessage{
+		Username: "EcoCI",
+		Embeds:   []discordEmbed{embed},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode discord message: %w", err)
+	}
+	return postJSON(ctx, n.client, n.webhookURL, body, nil, nil)
+}
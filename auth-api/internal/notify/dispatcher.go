@@ -0,0 +1,137 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// ErrDirectMessageUnavailable is returned when an organization has no Slack integration with
+// a bot token to send direct messages through
+var ErrDirectMessageUnavailable = errors.New("organization has no Slack bot to send direct messages")
+
+// Dispatcher resolves the routes of repository notifications and posts them
+type Dispatcher struct {
+	notifications *service.NotificationService
+	stats         *service.StatsService
+	pending       sync.WaitGroup
+}
+
+// NewDispatcher creates a new notification dispatcher
+func NewDispatcher(notifications *service.NotificationService, stats *service.StatsService) *Dispatcher {
+	return &Dispatcher{
+		notifications: notifications,
+		stats:         stats,
+	}
+}
+
+// Notify posts msg for event of a repository to every routed channel. Messages are sent
+// in the background so slow chat providers never delay the caller; failures are logged.
+func (d *Dispatcher) Notify(repoID uuid.UUID, event string, msg Message) {
+	d.pending.Add(1)
+	go func() {
+		defer d.pending.Done()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := d.send(ctx, repoID, event, msg); err != nil {
+			log.Printf("Failed to send %s notification for repository %s: %v", event, repoID, err)
+		}
+	}()
+}
+
+// DirectMessage posts msg to a Slack member through the Slack bot of an organization. The
+// message is sent in the background; organizations without a Slack bot return
+// ErrDirectMessageUnavailable right away so the caller can fall back to email.
+func (d *Dispatcher) DirectMessage(orgID uuid.UUID, slackUserID string, msg Message) error {
+	integration, err := d.notifications.GetIntegration(orgID, service.NotificationProviderSlack)
+	if err != nil || integration.BotToken == nil {
+		return ErrDirectMessageUnavailable
+	}
+	notifier, err := NewNotifier(*integration)
+	if err != nil {
+		return err
+	}
+
+	d.pending.Add(1)
+	go func() {
+		defer d.pending.Done()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := notifier.Send(ctx, slackUserID, msg); err != nil {
+			log.Printf("Failed to send Slack direct message for organization %s: %v", orgID, err)
+		}
+	}()
+	return nil
+}
+
+// Wait blocks until all notifications started by Notify and DirectMessage have been sent
+func (d *Dispatcher) Wait() {
+	d.pending.Wait()
+}
+
+// send posts msg to every target of the event and returns the last failure
+func (d *Dispatcher) send(ctx context.Context, repoID uuid.UUID, event string, msg Message) error {
+	targets, err := d.notifications.Targets(repoID, event)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, target := range targets {
+		notifier, err := NewNotifier(target.Integration)
+		if err == nil {
+			err = notifier.Send(ctx, target.Channel, msg)
+		}
+		if err != nil {
+			lastErr = fmt.Errorf("%s: %w", target.Integration.Provider, err)
+		}
+	}
+	return lastErr
+}
+
+// SendWeeklySummaries posts the summary of the week before now to every repository
+// routing weekly summaries
+func (d *Dispatcher) SendWeeklySummaries(ctx context.Context, now time.Time) error {
+	repos, err := d.notifications.RepositoriesForEvent(service.NotificationWeeklySummary)
+	if err != nil {
+		return err
+	}
+
+	weekStart := service.TruncateToInterval(now, "week")
+	from, to := weekStart.AddDate(0, 0, -7), weekStart.Add(-time.Microsecond)
+	for i := range repos {
+		repo := &repos[i]
+		msg, err := d.weeklySummary(repo, from, to)
+		if err != nil {
+			return err
+		}
+		if err := d.send(ctx, repo.ID, service.NotificationWeeklySummary, msg); err != nil {
+			log.Printf("Failed to send weekly summary for repository %s: %v", repo.FullName, err)
+		}
+	}
+	return nil
+}
+
+// weeklySummary builds the summary message of a repository for the week [from, to]
+func (d *Dispatcher) weeklySummary(repo *db.Repository, from, to time.Time) (Message, error) {
+	scope := service.RepositoryRuns(repo.ID)
+	summary, err := d.stats.Summary(scope, from, to)
+	if err != nil {
+		return Message{}, err
+	}
+	comparison, err := d.stats.CompareWithPreviousPeriod(scope, summary)
+	if err != nil {
+		return Message{}, err
+	}
+	return WeeklySummaryMessage(repo, summary, comparison), nil
+}
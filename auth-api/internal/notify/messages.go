@@ -0,0 +1,185 @@
+package notify
+
+import (
+	"fmt"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// BudgetExceededMessage formats a budget breach of a repository
+func BudgetExceededMessage(repo *db.Repository, crossing *service.BudgetCrossing) Message {
+	return Message{
+		Title: fmt.Sprintf("%s exceeded its %sly CO₂ budget", repo.FullName, crossing.Period),
+		Text: fmt.Sprintf("Emissions since %s reached %s, over the budget of %s.",
+			crossing.PeriodStart.Format("2006-01-02"), formatKg(crossing.ActualCO2Kg), formatKg(crossing.CO2KgLimit)),
+		Link:  repo.HTMLURL,
+		Level: LevelAlert,
+		Fields: []Field{
+			{Name: "Budget", Value: formatKg(crossing.CO2KgLimit)},
+			{Name: "Actual", Value: formatKg(crossing.ActualCO2Kg)},
+		},
+	}
+}
+
+// AnnouncementMessage formats an announcement a member posted to an organization
+func AnnouncementMessage(org *db.Organization, author *db.User, title, text string) Message {
+	return Message{
+		Title:  fmt.Sprintf("%s: %s", org.GitHubLogin, title),
+		Text:   text,
+		Level:  LevelInfo,
+		Fields: []Field{{Name: "Posted by", Value: author.GitHubUsername}},
+	}
+}
+
+// RegressionMessage formats a run that emitted significantly more than the recent runs
+func RegressionMessage(repo *db.Repository, regression *service.Regression) Message {
+	fields := []Field{
+		{Name: "Run CO₂", Value: formatKg(regression.CO2Kg)},
+		{Name: "Recent average", Value: formatKg(regression.RecentAvgCO2Kg)},
+	}
+	if regression.WorkflowName != nil {
+		fields = append(fields, Field{Name: "Workflow", Value: *regression.WorkflowName})
+	}
+	if regression.BranchName != nil {
+		fields = append(fields, Field{Name: "Branch", Value: *regression.BranchName})
+	}
+	if regression.GitCommitSHA != nil {
+		fields = append(fields, Field{Name: "Commit", Value: shortSHA(*regression.GitCommitSHA)})
+	}
+
+	return Message{
+		Title: fmt.Sprintf("CO₂ regression in %s", repo.FullName),
+		Text: fmt.Sprintf("A run emitted %.0f%% more CO₂ than the average of the previous %d runs.",
+			regression.ChangePercent, regression.RecentRunCount),
+		Link:   repo.HTMLURL,
+		Level:  LevelWarning,
+		Fields: fields,
+	}
+}
+
+// WeeklySummaryMessage formats the emissions of a repository over a week compared with the week before
+func WeeklySummaryMessage(repo *db.Repository, summary *service.PeriodSummary, comparison *service.PeriodComparison) Message {
+	fields, level := SummaryFields(summary, comparison, service.CanonicalDisplayUnits)
+	return Message{
+		Title: fmt.Sprintf("Weekly CO₂ summary for %s", repo.FullName),
+		Text: fmt.Sprintf("Week of %s to %s.",
+			summary.From.Format("2006-01-02"), summary.To.Format("2006-01-02")),
+		Link:   repo.HTMLURL,
+		Level:  level,
+		Fields: fields,
+	}
+}
+
+// SummaryFields formats the totals of a period in units and the CO2 change against the
+// previous period. The level is a warning when emissions increased.
+func SummaryFields(summary *service.PeriodSummary, comparison *service.PeriodComparison, units service.DisplayUnits) ([]Field, string) {
+	fields := []Field{
+		{Name: "CO₂", Value: formatCO2(summary.TotalCO2Kg, units)},
+		{Name: "Energy", Value: formatEnergy(summary.TotalEnergyKWh, units)},
+		{Name: "Runs", Value: fmt.Sprintf("%d", summary.RunCount)},
+	}
+	level := LevelInfo
+	if comparison != nil {
+		change := comparison.Changes["co2_kg"]
+		value := "n/a"
+		if change.Percent != nil {
+			value = fmt.Sprintf("%+.1f%%", *change.Percent)
+			if *change.Percent > 0 {
+				level = LevelWarning
+			}
+		}
+		fields = append(fields, Field{Name: "CO₂ vs previous week", Value: value})
+	}
+	return fields, level
+}
+
+// alertMetricLabels names the metrics of alert rules in messages
+var alertMetricLabels = map[string]string{
+	"co2_kg":     "CO₂",
+	"energy_kwh": "energy",
+	"duration_s": "build time",
+	"run_count":  "run count",
+}
+
+// AlertRuleMessage formats a breached alert rule of the runs named target
+func AlertRuleMessage(rule *db.AlertRule, target *service.AlertTarget, evaluation *service.AlertEvaluation) Message {
+	measure := alertMetricLabels[rule.Metric]
+	if rule.Aggregation == service.AlertAggregationAvg {
+		measure = "average " + measure + " per run"
+	} else if rule.Metric != "run_count" {
+		measure = "total " + measure
+	}
+
+	var text string
+	switch rule.Comparison {
+	case service.AlertComparisonIncreasePercent:
+		text = fmt.Sprintf("The %s over the last %s rose by %.0f%% to %s, more than the threshold of %.0f%%.",
+			measure, rule.Window, *evaluation.ChangePercent, formatMetric(rule.Metric, evaluation.Value), rule.Threshold)
+	default:
+		text = fmt.Sprintf("The %s over the last %s is %s, %s the threshold of %s.",
+			measure, rule.Window, formatMetric(rule.Metric, evaluation.Value), rule.Comparison, formatMetric(rule.Metric, rule.Threshold))
+	}
+
+	fields := []Field{
+		{Name: "Value", Value: formatMetric(rule.Metric, evaluation.Value)},
+	}
+	if evaluation.Previous != nil {
+		fields = append(fields, Field{Name: "Previous " + rule.Window, Value: formatMetric(rule.Metric, *evaluation.Previous)})
+	}
+
+	return Message{
+		Title:  fmt.Sprintf("Alert \"%s\" triggered for %s", rule.Name, target.Name),
+		Text:   text,
+		Link:   target.Link,
+		Level:  LevelAlert,
+		Fields: fields,
+	}
+}
+
+// formatMetric formats a value of a run metric with its unit
+func formatMetric(metric string, value float64) string {
+	switch metric {
+	case "co2_kg":
+		return formatKg(value)
+	case "energy_kwh":
+		return fmt.Sprintf("%.3f kWh", value)
+	case "duration_s":
+		return fmt.Sprintf("%.0f s", value)
+	default:
+		return fmt.Sprintf("%.0f", value)
+	}
+}
+
+// formatKg formats a CO2 mass, switching to grams below one kilogram
+func formatKg(kg float64) string {
+	if kg < 1 {
+		return fmt.Sprintf("%.1f g", kg*1000)
+	}
+	return fmt.Sprintf("%.3f kg", kg)
+}
+
+// formatCO2 formats kilograms of CO2 in the CO2 unit of units; kg switch to grams below a
+// kilogram
+func formatCO2(kg float64, units service.DisplayUnits) string {
+	if units.CO2 == service.CanonicalDisplayUnits.CO2 {
+		return formatKg(kg)
+	}
+	return fmt.Sprintf("%.1f %s", kg*units.CO2Factor(), units.CO2)
+}
+
+// formatEnergy formats kilowatt-hours in the energy unit of units
+func formatEnergy(kwh float64, units service.DisplayUnits) string {
+	if units.Energy == service.CanonicalDisplayUnits.Energy {
+		return fmt.Sprintf("%.3f kWh", kwh)
+	}
+	return fmt.Sprintf("%.1f %s", kwh*units.EnergyFactor(), units.Energy)
+}
+
+// shortSHA abbreviates a commit SHA the way git does
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
@@ -0,0 +1,100 @@
+// Package notify posts carbon alerts and summaries to the chat integrations (Slack, Microsoft
+// Teams, Discord) of organizations
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/service"
+)
+
+// Message levels, rendered as colors by the chat providers
+const (
+	LevelInfo    = "info"
+	LevelWarning = "warning"
+	LevelAlert   = "alert"
+)
+
+// requestTimeout bounds every request to a chat provider
+const requestTimeout = 10 * time.Second
+
+// Message is a provider independent chat message
+type Message struct {
+	Title  string
+	Text   string
+	Link   string
+	Level  string
+	Fields []Field
+}
+
+// Field is a labelled value shown alongside the message text
+type Field struct {
+	Name  string
+	Value string
+}
+
+// Notifier posts messages to a chat provider
+type Notifier interface {
+	// Send posts msg to channel; an empty channel uses the provider's default destination
+	Send(ctx context.Context, channel string, msg Message) error
+}
+
+// NewNotifier returns the notifier for an organization integration
+func NewNotifier(integration db.OrganizationIntegration) (Notifier, error) {
+	client := &http.Client{Timeout: requestTimeout}
+
+	switch integration.Provider {
+	case service.NotificationProviderSlack:
+		return NewSlackNotifier(client, integration.WebhookURL, integration.BotToken), nil
+	case service.NotificationProviderTeams:
+		if integration.WebhookURL == nil {
+			return nil, fmt.Errorf("teams integration has no webhook URL")
+		}
+		return NewTeamsNotifier(client, *integration.WebhookURL), nil
+	case service.NotificationProviderDiscord:
+		if integration.WebhookURL == nil {
+			return nil, fmt.Errorf("discord integration has no webhook URL")
+		}
+		return NewDiscordNotifier(client, *integration.WebhookURL), nil
+	default:
+		return nil, fmt.Errorf("unsupported notification provider: %s", integration.Provider)
+	}
+}
+
+// postJSON posts body to url and decodes the response into result when it is not nil.
+// Any non-2xx response is a failure.
+func postJSON(ctx context.Context, client *http.Client, url string, body []byte, header http.Header, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	}
+	if result == nil {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// SlackAPIURL is the Slack Web API endpoint used with bot tokens
+const SlackAPIURL = "https://slack.com/api/chat.postMessage"
+
+// slackColors maps message levels to Slack attachment colors
+var slackColors = map[string]string{
+	LevelInfo:    "#2eb67d",
+	LevelWarning: "#ecb22e",
+	LevelAlert:   "#e01e5a",
+}
+
+// SlackNotifier posts messages through a Slack incoming webhook or, when a bot token is
+// configured, through chat.postMessage which can address any channel the bot is in
+type SlackNotifier struct {
+	client     *http.Client
+	webhookURL *string
+	botToken   *string
+	apiURL     string
+}
+
+// NewSlackNotifier creates a Slack notifier for an incoming webhook URL or a bot token
+func NewSlackNotifier(client *http.Client, webhookURL, botToken *string) *SlackNotifier {
+	return &SlackNotifier{
+		client:     client,
+		webhookURL: webhookURL,
+		botToken:   botToken,
+		apiURL:     SlackAPIURL,
+	}
+}
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+type slackAttachment struct {
+	Color     string       `json:"color,omitempty"`
+	Title     string       `json:"title"`
+	TitleLink string       `json:"title_link,omitempty"`
+	Text      string       `json:"text,omitempty"`
+	Fields    []slackField `json:"fields,omitempty"`
+}
+
+type slackMessage struct {
+	Channel     string            `json:"channel,omitempty"`
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments"`
+}
+
+// Send posts msg to channel
+func (n *SlackNotifier) Send(ctx context.Context, channel string, msg Message) error {
+	attachment := slackAttachment{
+		Color:     slackColors[msg.Level],
+		Title:     msg.Title,
+		TitleLink: msg.Link,
+		Text:      msg.Text,
+	}
+	for _, field := range msg.Fields {
+		attachment.Fields = append(attachment.Fields, slackField{Title: field.Name, Value: field.Value, Short: true})
+	}
+	body, err := json.Marshal(slackMessage{
+		Channel:     channel,
+		Text:        msg.Title,
+		Attachments: []slackAttachment{attachment},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode slack message: %w", err)
+	}
+
+	if n.botToken != nil {
+		if channel == "" {
+			return fmt.Errorf("slack bot token requires a channel")
+		}
+		return n.postMessage(ctx, body)
+	}
+	if n.webhookURL == nil {
+		return fmt.Errorf("slack integration has neither a webhook URL nor a bot token")
+	}
+	return postJSON(ctx, n.client, *n.webhookURL, body, nil, nil)
+}
+
+// postMessage sends body to chat.postMessage, which reports failures in the response body
+func (n *SlackNotifier) postMessage(ctx context.Context, body []byte) error {
+	var result struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	header := http.Header{"Authorization": {"Bearer " + *n.botToken}}
+	if err := postJSON(ctx, n.client, n.apiURL, body, header, &result); err != nil {
+		return err
+	}
+	if !result.OK {
+		return fmt.Errorf("slack API error: %s", result.Error)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// teamsColors maps message levels to Teams card theme colors
+var teamsColors = map[string]string{
+	LevelInfo:    "2EB67D",
+	LevelWarning: "ECB22E",
+	LevelAlert:   "E01E5A",
+}
+
+// TeamsNotifier posts messages as cards through a Microsoft Teams incoming webhook.
+// The webhook is bound to one channel, so the channel argument of Send is ignored.
+type TeamsNotifier struct {
+	client     *http.Client
+	webhookURL string
+}
+
+// NewTeamsNotifier creates a Teams notifier for an incoming webhook URL
+func NewTeamsNotifier(client *http.Client, webhookURL string) *TeamsNotifier {
+	return &TeamsNotifier{
+		client:     client,
+		webhookURL: webhookURL,
+	}
+}
+
+type teamsFact struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type teamsSection struct {
+	Facts []teamsFact `json:"facts"`
+}
+
+type teamsTarget struct {
+	OS  string `json:"os"`
+	URI string `json:"uri"`
+}
+
+type teamsAction struct {
+	Type    string        `json:"@type"`
+	Name    string        `json:"name"`
+	Targets []teamsTarget `json:"targets"`
+}
+
+type teamsCard struct {
+	Type            string         `json:"@type"`
+	Context         string         `json:"@context"`
+	ThemeColor      string         `json:"themeColor,omitempty"`
+	Summary         string         `json:"summary"`
+	Title           string         `json:"title"`
+	Text            string         `json:"text,omitempty"`
+	Sections        []teamsSection `json:"sections,omitempty"`
+	PotentialAction []teamsAction  `json:"potentialAction,omitempty"`
+}
+
+// Send posts msg as a message card
+func (n *TeamsNotifier) Send(ctx context.Context, channel string, msg Message) error {
+	card := teamsCard{
+		Type:       "MessageCard",
+		Context:    "https://schema.org/extensions",
+		ThemeColor: teamsColors[msg.Level],
+		Summary:    msg.Title,
+		Title:      msg.Title,
+		Text:       msg.Text,
+	}
+	if len(msg.Fields) > 0 {
+		section := teamsSection{}
+		for _, field := range msg.Fields {
+			section.Facts = append(section.Facts, teamsFact{Name: field.Name, Value: field.Value})
+		}
+		card.Sections = []teamsSection{section}
+	}
+	if msg.Link != "" {
+		card.PotentialAction = []teamsAction{{
+			Type:    "OpenUri",
+			Name:    "Open repository",
+			Targets: []teamsTarget{{OS: "default", URI: msg.Link}},
+		}}
+	}
+
+	body, err := json.Marshal(card)
+	if err != nil {
+		return fmt.Errorf("failed to encode teams message: %w", err)
+	}
+	return postJSON(ctx, n.client, n.webhookURL, body, nil, nil)
+}
@@ -0,0 +1,341 @@
+// Package openapi generates the OpenAPI 3 document of the API from the routes the server
+// registers and the Go types of their request and response bodies, so the document describes
+// the API as it is served rather than as it was annotated.
+package openapi
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Version is the OpenAPI version of the generated documents
+const Version = "3.0.3"
+
+// Parameter locations
+const (
+	InQuery  = "query"
+	InPath   = "path"
+	InHeader = "header"
+)
+
+// routeParam matches the parameters of router paths, such as :repo_id
+var routeParam = regexp.MustCompile(`:(\w+)`)
+
+// Operation documents what a route does and the types of its bodies
+type Operation struct {
+	Summary     string
+	Description string
+	Tag         string
+	// Params are the query and header parameters and descriptions of path parameters; the
+	// path parameters themselves are taken from the route
+	Params []Param
+	// Request is a value of the type of the JSON request body, nil without a body
+	Request interface{}
+	// Uploads are the content types of request bodies that are files, such as text/csv; a
+	// multipart form carries the file in its file field
+	Uploads []string
+	// Status is the status of successful responses, 200 when zero
+	Status int
+	// Response is a value of the type of the JSON response body, nil without a body
+	Response interface{}
+	// Download is the content type of responses that are files, such as a spreadsheet
+	Download string
+	// Public operations need no authentication
+	Public bool
+}
+
+// Param is a parameter of an operation
+type Param struct {
+	Name        string
+	In          string
+	Description string
+	Required    bool
+	Schema      *Schema
+}
+
+// Query returns an optional string query parameter
+func Query(name, description string) Param {
+	return Param{Name: name, In: InQuery, Description: description, Schema: &Schema{Type: "string"}}
+}
+
+// QueryInt returns an optional integer query parameter
+func QueryInt(name, description string) Param {
+	return Param{Name: name, In: InQuery, Description: description, Schema: &Schema{Type: "integer"}}
+}
+
+// QueryBool returns an optional boolean query parameter
+func QueryBool(name, description string) Param {
+	return Param{Name: name, In: InQuery, Description: description, Schema: &Schema{Type: "boolean"}}
+}
+
+// Header returns an optional string header parameter
+func Header(name, description string) Param {
+	return Param{Name: name, In: InHeader, Description: description, Schema: &Schema{Type: "string"}}
+}
+
+// Path describes the path parameter name
+func Path(name, description string) Param {
+	return Param{Name: name, In: InPath, Description: description, Required: true, Schema: pathSchema(name)}
+}
+
+// Require makes the parameter required
+func (p Param) Require() Param {
+	p.Required = true
+	return p
+}
+
+// Default sets the value of the parameter when it is omitted
+func (p Param) Default(value interface{}) Param {
+	p.Schema = p.Schema.clone()
+	p.Schema.Default = value
+	return p
+}
+
+// Enum restricts the parameter to values
+func (p Param) Enum(values ...string) Param {
+	p.Schema = p.Schema.clone()
+	p.Schema.Enum = make([]interface{}, len(values))
+	for i, value := range values {
+		p.Schema.Enum[i] = value
+	}
+	return p
+}
+
+// Route is an operation on a path of the router, such as GET /repos/:repo_id
+type Route struct {
+	Method string
+	Path   string
+	// ID identifies the operation, such as the name of its handler
+	ID string
+	Operation
+}
+
+// Info describes the API
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// Server is a base URL of the API
+type Server struct {
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+// Document is an OpenAPI document
+type Document struct {
+	OpenAPI    string                                 `json:"openapi"`
+	Info       Info                                   `json:"info"`
+	Servers    []Server                               `json:"servers,omitempty"`
+	Tags       []Tag                                  `json:"tags,omitempty"`
+	Paths      map[string]map[string]*OperationObject `json:"paths"`
+	Components Components                             `json:"components"`
+}
+
+// Tag groups operations
+type Tag struct {
+	Name string `json:"name"`
+}
+
+// Components holds the schemas of the named types and the security schemes
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes"`
+}
+
+// SecurityScheme is a way to authenticate
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+// OperationObject is an operation as written in the document
+type OperationObject struct {
+	OperationID string                `json:"operationId,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []ParameterObject     `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security"`
+}
+
+// ParameterObject is a parameter as written in the document
+type ParameterObject struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody is the body of a request by content type
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// Response is a response by content type
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// MediaType is the schema of a body
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Spec is what a document describes
+type Spec struct {
+	Info    Info
+	Servers []Server
+	Routes  []Route
+	// SecuritySchemes are the ways to authenticate; operations that are not public accept any
+	SecuritySchemes map[string]*SecurityScheme
+	// Error is a value of the type of error responses, which are written as ErrorContentType
+	Error            interface{}
+	ErrorContentType string
+}
+
+// Generate returns the document of spec
+func Generate(spec Spec) *Document {
+	schemas := newSchemaBuilder()
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    spec.Info,
+		Servers: spec.Servers,
+		Paths:   map[string]map[string]*OperationObject{},
+		Components: Components{
+			Schemas:         schemas.components,
+			SecuritySchemes: spec.SecuritySchemes,
+		},
+	}
+	errorResponse := &Response{
+		Description: "Error",
+		Content:     map[string]*MediaType{spec.ErrorContentType: {Schema: schemas.schema(typeOf(spec.Error))}},
+	}
+	var security []map[string][]string
+	for name := range spec.SecuritySchemes {
+		security = append(security, map[string][]string{name: {}})
+	}
+	sort.Slice(security, func(i, j int) bool { return firstKey(security[i]) < firstKey(security[j]) })
+
+	tags := map[string]bool{}
+	for _, route := range spec.Routes {
+		path := routeParam.ReplaceAllString(route.Path, "{$1}")
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]*OperationObject{}
+		}
+		operation := &OperationObject{
+			OperationID: route.ID,
+			Summary:     route.Summary,
+			Description: route.Description,
+			Parameters:  parameters(route),
+			Responses:   map[string]*Response{"default": errorResponse},
+			Security:    []map[string][]string{},
+		}
+		if route.Tag != "" {
+			operation.Tags = []string{route.Tag}
+			tags[route.Tag] = true
+		}
+		if !route.Public {
+			operation.Security = security
+		}
+		operation.RequestBody = requestBody(schemas, route.Operation)
+		status := route.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		operation.Responses[strconv.Itoa(status)] = response(schemas, status, route.Operation)
+		doc.Paths[path][strings.ToLower(route.Method)] = operation
+	}
+
+	for tag := range tags {
+		doc.Tags = append(doc.Tags, Tag{Name: tag})
+	}
+	sort.Slice(doc.Tags, func(i, j int) bool { return doc.Tags[i].Name < doc.Tags[j].Name })
+	return doc
+}
+
+// firstKey returns a key of a map with one entry
+func firstKey(m map[string][]string) string {
+	for key := range m {
+		return key
+	}
+	return ""
+}
+
+// parameters returns the path parameters of a route, described where the operation describes
+// them, followed by its other parameters
+func parameters(route Route) []ParameterObject {
+	described := map[string]Param{}
+	for _, param := range route.Params {
+		if param.In == InPath {
+			described[param.Name] = param
+		}
+	}
+
+	var params []ParameterObject
+	for _, match := range routeParam.FindAllStringSubmatch(route.Path, -1) {
+		param, ok := described[match[1]]
+		if !ok {
+			param = Path(match[1], "")
+		}
+		params = append(params, ParameterObject{Name: param.Name, In: InPath, Description: param.Description, Required: true, Schema: param.Schema})
+	}
+	for _, param := range route.Params {
+		if param.In != InPath {
+			params = append(params, ParameterObject{Name: param.Name, In: param.In, Description: param.Description, Required: param.Required, Schema: param.Schema})
+		}
+	}
+	return params
+}
+
+// pathSchema returns the schema of a path parameter: a UUID for IDs, else a string
+func pathSchema(name string) *Schema {
+	if strings.HasSuffix(name, "_id") {
+		return &Schema{Type: "string", Format: "uuid"}
+	}
+	return &Schema{Type: "string"}
+}
+
+// requestBody returns the request body of an operation, nil without one
+func requestBody(schemas *schemaBuilder, operation Operation) *RequestBody {
+	if operation.Request == nil && len(operation.Uploads) == 0 {
+		return nil
+	}
+	body := &RequestBody{Required: true, Content: map[string]*MediaType{}}
+	if operation.Request != nil {
+		body.Content["application/json"] = &MediaType{Schema: schemas.schema(typeOf(operation.Request))}
+	}
+	for _, contentType := range operation.Uploads {
+		file := &Schema{Type: "string", Format: "binary"}
+		if contentType == "multipart/form-data" {
+			file = &Schema{Type: "object", Properties: map[string]*Schema{"file": file}, Required: []string{"file"}}
+		}
+		body.Content[contentType] = &MediaType{Schema: file}
+	}
+	return body
+}
+
+// response returns the successful response of an operation
+func response(schemas *schemaBuilder, status int, operation Operation) *Response {
+	resp := &Response{Description: http.StatusText(status)}
+	switch {
+	case operation.Download != "":
+		resp.Content = map[string]*MediaType{operation.Download: {Schema: &Schema{Type: "string", Format: "binary"}}}
+	case operation.Response != nil:
+		resp.Content = map[string]*MediaType{"application/json": {Schema: schemas.schema(typeOf(operation.Response))}}
+	}
+	return resp
+}
@@ -0,0 +1,142 @@
+package openapi
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type Base struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Node struct {
+	Base
+	Name     string                 `json:"name" validate:"required,min=1,max=64"`
+	Kind     string                 `json:"kind" validate:"oneof=leaf branch"`
+	Weight   float64                `json:"weight" example:"0.5"`
+	Parent   *Node                  `json:"parent,omitempty"`
+	Children []Node                 `json:"children"`
+	Note     *string                `json:"note"`
+	Labels   map[string]string      `json:"labels"`
+	Extra    map[string]interface{} `json:"extra"`
+	Count    int64                  `json:"count,string"`
+	Secret   string                 `json:"-"`
+	internal string
+}
+
+type errorBody struct {
+	Message string `json:"message"`
+}
+
+func TestSchema(t *testing.T) {
+	schemas := newSchemaBuilder()
+	ref := schemas.schema(typeOf(&Node{}))
+	assert.Equal(t, "#/components/schemas/openapi.Node", ref.Ref)
+
+	node := schemas.components["openapi.Node"]
+	require.NotNil(t, node)
+	assert.Equal(t, "object", node.Type)
+	assert.ElementsMatch(t, []string{"id", "created_at", "name", "kind", "weight", "parent", "children", "note", "labels", "extra", "count"}, keys(node.Properties))
+	assert.Equal(t, []string{"name"}, node.Required)
+
+	// Embedded structs are inlined
+	assert.Equal(t, &Schema{Type: "string", Format: "uuid"}, node.Properties["id"])
+	assert.Equal(t, &Schema{Type: "string", Format: "date-time"}, node.Properties["created_at"])
+	assert.NotContains(t, schemas.components, "openapi.Base")
+
+	name := node.Properties["name"]
+	assert.Equal(t, 1, *name.MinLength)
+	assert.Equal(t, 64, *name.MaxLength)
+	assert.Equal(t, []interface{}{"leaf", "branch"}, node.Properties["kind"].Enum)
+	assert.Equal(t, 0.5, node.Properties["weight"].Example)
+
+	// Recursive types refer to their component
+	assert.Equal(t, &Schema{AllOf: []*Schema{ref}, Nullable: true}, node.Properties["parent"])
+	assert.Equal(t, &Schema{Type: "array", Items: ref}, node.Properties["children"])
+
+	assert.Equal(t, &Schema{Type: "string", Nullable: true}, node.Properties["note"])
+	assert.Equal(t, &Schema{Type: "object", AdditionalProperties: &Schema{Type: "string"}}, node.Properties["labels"])
+	assert.Equal(t, &Schema{Type: "object", AdditionalProperties: &Schema{}}, node.Properties["extra"])
+	assert.Equal(t, &Schema{Type: "string", Format: "integer"}, node.Properties["count"])
+
+	// Unexported types are written in place
+	body := schemas.schema(typeOf(errorBody{}))
+	assert.Equal(t, "object", body.Type)
+	assert.Len(t, schemas.components, 1)
+}
+
+func TestGenerate(t *testing.T) {
+	doc := Generate(Spec{
+		Info:    Info{Title: "Test API", Version: "1.0.0"},
+		Servers: []Server{{URL: "/api/v1"}},
+		Routes: []Route{
+			{Method: "GET", Path: "/nodes/:node_id/children/:name", ID: "getChild", Operation: Operation{
+				Summary: "Get child",
+				Tag:     "nodes",
+				Params: []Param{
+					Path("node_id", "Node UUID"),
+					QueryInt("depth", "Depth").Default(1),
+					Query("order", "Order").Enum("asc", "desc").Require(),
+				},
+				Response: Node{},
+			}},
+			{Method: "POST", Path: "/nodes", ID: "createNode", Operation: Operation{
+				Tag:      "nodes",
+				Request:  Node{},
+				Uploads:  []string{"multipart/form-data"},
+				Status:   http.StatusCreated,
+				Response: &Node{},
+			}},
+			{Method: "GET", Path: "/status", ID: "status", Operation: Operation{Tag: "status", Public: true}},
+		},
+		SecuritySchemes: map[string]*SecurityScheme{
+			"CookieAuth": {Type: "apiKey", In: "cookie", Name: "token"},
+			"BearerAuth": {Type: "http", Scheme: "bearer"},
+		},
+		Error:            errorBody{},
+		ErrorContentType: "application/problem+json",
+	})
+
+	assert.Equal(t, Version, doc.OpenAPI)
+	assert.Equal(t, []Tag{{Name: "nodes"}, {Name: "status"}}, doc.Tags)
+	assert.Contains(t, doc.Components.Schemas, "openapi.Node")
+
+	getChild := doc.Paths["/nodes/{node_id}/children/{name}"]["get"]
+	require.NotNil(t, getChild)
+	assert.Equal(t, "getChild", getChild.OperationID)
+	assert.Equal(t, []ParameterObject{
+		{Name: "node_id", In: InPath, Description: "Node UUID", Required: true, Schema: &Schema{Type: "string", Format: "uuid"}},
+		{Name: "name", In: InPath, Required: true, Schema: &Schema{Type: "string"}},
+		{Name: "depth", In: InQuery, Description: "Depth", Schema: &Schema{Type: "integer", Default: 1}},
+		{Name: "order", In: InQuery, Description: "Order", Required: true, Schema: &Schema{Type: "string", Enum: []interface{}{"asc", "desc"}}},
+	}, getChild.Parameters)
+	assert.Equal(t, []map[string][]string{{"BearerAuth": {}}, {"CookieAuth": {}}}, getChild.Security)
+	assert.Equal(t, "#/components/schemas/openapi.Node", getChild.Responses["200"].Content["application/json"].Schema.Ref)
+	assert.Equal(t, "object", getChild.Responses["default"].Content["application/problem+json"].Schema.Type)
+
+	createNode := doc.Paths["/nodes"]["post"]
+	require.NotNil(t, createNode.RequestBody)
+	assert.Equal(t, "#/components/schemas/openapi.Node", createNode.RequestBody.Content["application/json"].Schema.Ref)
+	assert.Equal(t, &Schema{Type: "string", Format: "binary"}, createNode.RequestBody.Content["multipart/form-data"].Schema.Properties["file"])
+	assert.Contains(t, createNode.Responses, "201")
+
+	status := doc.Paths["/status"]["get"]
+	assert.Empty(t, status.Security)
+	assert.NotNil(t, status.Security, "public operations override the default security")
+	assert.Nil(t, status.RequestBody)
+	assert.Nil(t, status.Responses["200"].Content)
+}
+
+func keys(m map[string]*Schema) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,241 @@
+package openapi
+
+import (
+	"encoding/json"
+	"go/token"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Schema is a JSON schema of the OpenAPI dialect
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Default              interface{}        `json:"default,omitempty"`
+	Example              interface{}        `json:"example,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// clone returns a shallow copy of s
+func (s *Schema) clone() *Schema {
+	copied := *s
+	return &copied
+}
+
+// Types with a JSON encoding of their own
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	uuidType      = reflect.TypeOf(uuid.UUID{})
+	deletedAtType = reflect.TypeOf(gorm.DeletedAt{})
+	rawType       = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaBuilder reflects Go types into schemas, collecting the exported struct types as
+// components referenced by their package and name, such as service.RunCreateRequest
+type schemaBuilder struct {
+	components map[string]*Schema
+}
+
+func newSchemaBuilder() *schemaBuilder {
+	return &schemaBuilder{components: map[string]*Schema{}}
+}
+
+// typeOf returns the type of value, looking through pointers
+func typeOf(value interface{}) reflect.Type {
+	t := reflect.TypeOf(value)
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+// schema returns the schema of values of t as encoded by encoding/json
+func (b *schemaBuilder) schema(t reflect.Type) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case uuidType:
+		return &Schema{Type: "string", Format: "uuid"}
+	case deletedAtType:
+		return &Schema{Type: "string", Format: "date-time", Nullable: true}
+	case rawType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		elem := b.schema(t.Elem())
+		if elem.Ref != "" {
+			// Siblings of a reference are ignored, so the reference is wrapped
+			return &Schema{AllOf: []*Schema{elem}, Nullable: true}
+		}
+		elem.Nullable = true
+		return elem
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Uint, reflect.Uint8, reflect.Uint16:
+		return &Schema{Type: "integer"}
+	case reflect.Int32, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: b.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: b.schema(t.Elem())}
+	case reflect.Struct:
+		// Anonymous and unexported structs are written in place
+		if !token.IsExported(t.Name()) {
+			return b.object(t)
+		}
+		name := strings.ReplaceAll(t.String(), "/", ".")
+		ref := &Schema{Ref: "#/components/schemas/" + name}
+		if _, ok := b.components[name]; !ok {
+			// Registered before its fields, so recursive types refer to themselves
+			b.components[name] = &Schema{}
+			*b.components[name] = *b.object(t)
+		}
+		return ref
+	default:
+		// Interfaces hold any value
+		return &Schema{}
+	}
+}
+
+// object returns the schema of a struct, with the fields of embedded structs inlined as
+// encoding/json does
+func (b *schemaBuilder) object(t reflect.Type) *Schema {
+	object := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	b.fields(t, object)
+	return object
+}
+
+// fields adds the fields of t to object
+func (b *schemaBuilder) fields(t reflect.Type, object *Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct && embedded != timeType && embedded != deletedAtType {
+				b.fields(embedded, object)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := b.schema(field.Type)
+		if strings.Contains(options, "string") && schema.Type != "" {
+			schema = &Schema{Type: "string", Format: schema.Type}
+		}
+		if schema.Ref == "" {
+			applyExample(schema, field.Tag.Get("example"))
+			if constraint(schema, field.Tag.Get("validate")) || constraint(schema, field.Tag.Get("binding")) {
+				object.Required = append(object.Required, name)
+			}
+		}
+		object.Properties[name] = schema
+	}
+}
+
+// constraint applies the validation rules of a validate or binding tag to schema and reports
+// whether they require the field
+func constraint(schema *Schema, rules string) bool {
+	required := false
+	for _, rule := range strings.Split(rules, ",") {
+		key, value, _ := strings.Cut(rule, "=")
+		switch key {
+		case "required":
+			required = true
+		case "min", "max", "len", "gte", "lte":
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			switch schema.Type {
+			case "string":
+				length := int(n)
+				if key != "max" && key != "lte" {
+					schema.MinLength = &length
+				}
+				if key != "min" && key != "gte" {
+					schema.MaxLength = &length
+				}
+			case "integer", "number":
+				if key != "max" && key != "lte" {
+					schema.Minimum = &n
+				}
+				if key != "min" && key != "gte" {
+					schema.Maximum = &n
+				}
+			}
+		case "oneof":
+			for _, option := range strings.Fields(value) {
+				schema.Enum = append(schema.Enum, option)
+			}
+		case "email":
+			schema.Format = "email"
+		case "url":
+			schema.Format = "uri"
+		}
+	}
+	return required
+}
+
+// applyExample sets the example of an example tag, parsed for numbers and booleans
+func applyExample(schema *Schema, example string) {
+	if example == "" {
+		return
+	}
+	switch schema.Type {
+	case "integer", "number":
+		if n, err := strconv.ParseFloat(example, 64); err == nil {
+			schema.Example = n
+			return
+		}
+	case "boolean":
+		if value, err := strconv.ParseBool(example); err == nil {
+			schema.Example = value
+			return
+		}
+	}
+	schema.Example = example
+}
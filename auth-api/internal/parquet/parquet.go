@@ -0,0 +1,510 @@
+// Package parquet writes flat tables as Apache Parquet files, as read by DuckDB, Athena,
+// Spark and pandas. It supports what the archive of runs needs and no more: required and
+// optional columns of strings, integers, doubles, dates and timestamps, PLAIN encoded and
+// GZIP compressed, one data page per column chunk.
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// ContentType is the MIME type of Parquet files
+const ContentType = "application/vnd.apache.parquet"
+
+// magic opens and closes every Parquet file
+const magic = "PAR1"
+
+// DefaultRowGroupSize is the number of rows buffered before they are written as a row group
+const DefaultRowGroupSize = 100000
+
+// Type is the type of a column
+type Type int
+
+// Column types
+const (
+	// String columns hold UTF-8 strings
+	String Type = iota
+	// JSON columns hold JSON documents as strings
+	JSON
+	Int64
+	Double
+	// Timestamp columns hold instants, stored as microseconds since the Unix epoch in UTC
+	Timestamp
+	// Date columns hold calendar days, stored as days since the Unix epoch
+	Date
+)
+
+// String returns the name of the type as shown in schemas
+func (t Type) String() string {
+	switch t {
+	case String:
+		return "string"
+	case JSON:
+		return "json"
+	case Int64:
+		return "int64"
+	case Double:
+		return "double"
+	case Timestamp:
+		return "timestamp"
+	case Date:
+		return "date"
+	}
+	return fmt.Sprintf("Type(%d)", int(t))
+}
+
+// Physical types, converted types, encodings and codecs of the Parquet format
+const (
+	physicalInt32     = 1
+	physicalInt64     = 2
+	physicalDouble    = 5
+	physicalByteArray = 6
+
+	repetitionRequired = 0
+	repetitionOptional = 1
+
+	convertedUTF8            = 0
+	convertedDate            = 6
+	convertedTimestampMicros = 10
+	convertedJSON            = 19
+
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	codecGzip = 2
+
+	pageData = 0
+)
+
+// Column is a column of a table
+type Column struct {
+	Name string
+	Type Type
+	// Optional columns accept nil values
+	Optional bool
+}
+
+// physical returns the physical type values of the column are stored as
+func (c Column) physical() int32 {
+	switch c.Type {
+	case Int64, Timestamp:
+		return physicalInt64
+	case Double:
+		return physicalDouble
+	case Date:
+		return physicalInt32
+	}
+	return physicalByteArray
+}
+
+// columnChunk buffers the values of a column in the current row group
+type columnChunk struct {
+	values  bytes.Buffer
+	present []bool
+	nulls   int64
+	// min and max are PLAIN encoded, without the length of byte arrays
+	min, max []byte
+}
+
+// Writer writes the rows of a table as a Parquet file. Rows are buffered in memory and
+// written a row group at a time; Close writes the last row group and the footer.
+type Writer struct {
+	w       io.Writer
+	offset  int64
+	columns []Column
+	chunks  []*columnChunk
+	// RowGroupSize is the number of rows of each row group but the last
+	RowGroupSize int
+
+	rows      int64
+	buffered  int
+	rowGroups []rowGroup
+	err       error
+}
+
+// rowGroup is the metadata of a written row group
+type rowGroup struct {
+	rows    int64
+	size    int64
+	columns []columnMeta
+}
+
+// columnMeta is the metadata of a written column chunk
+type columnMeta struct {
+	offset       int64
+	uncompressed int64
+	compressed   int64
+	values       int64
+	nulls        int64
+	min, max     []byte
+}
+
+// NewWriter creates a writer of a table with columns to w
+func NewWriter(w io.Writer, columns []Column) *Writer {
+	writer := &Writer{w: w, columns: columns, RowGroupSize: DefaultRowGroupSize}
+	for range columns {
+		writer.chunks = append(writer.chunks, &columnChunk{})
+	}
+	writer.write([]byte(magic))
+	return writer
+}
+
+// write writes p to the file, recording the first error
+func (w *Writer) write(p []byte) {
+	if w.err != nil {
+		return
+	}
+	n, err := w.w.Write(p)
+	w.offset += int64(n)
+	if err != nil {
+		w.err = fmt.Errorf("failed to write parquet file: %w", err)
+	}
+}
+
+// Write adds a row with a value for each column: a string for string and JSON columns, an
+// int64, a float64, or a time.Time for date and timestamp columns. Optional columns also take
+// nil and nil pointers to those types.
+func (w *Writer) Write(values ...interface{}) error {
+	if w.err != nil {
+		return w.err
+	}
+	if len(values) != len(w.columns) {
+		return fmt.Errorf("row has %d values for %d columns", len(values), len(w.columns))
+	}
+
+	encoded := make([][]byte, len(values))
+	for i, value := range values {
+		var err error
+		if encoded[i], err = encode(w.columns[i], value); err != nil {
+			return err
+		}
+	}
+	for i, value := range encoded {
+		w.chunks[i].add(w.columns[i], value)
+	}
+	w.rows++
+	w.buffered++
+	if w.buffered >= w.RowGroupSize {
+		w.flush()
+	}
+	return w.err
+}
+
+// encode returns the PLAIN encoding of a value of column, without the length prefix of byte
+// arrays, or nil for null values
+func encode(column Column, value interface{}) ([]byte, error) {
+	value = deref(value)
+	if value == nil {
+		if !column.Optional {
+			return nil, fmt.Errorf("column %s is required", column.Name)
+		}
+		return nil, nil
+	}
+
+	mismatch := fmt.Errorf("column %s of type %s cannot hold %T", column.Name, column.Type, value)
+	switch column.Type {
+	case String, JSON:
+		s, ok := value.(string)
+		if !ok {
+			return nil, mismatch
+		}
+		return []byte(s), nil
+	case Int64:
+		n, ok := value.(int64)
+		if !ok {
+			return nil, mismatch
+		}
+		return binary.LittleEndian.AppendUint64(nil, uint64(n)), nil
+	case Double:
+		f, ok := value.(float64)
+		if !ok {
+			return nil, mismatch
+		}
+		return binary.LittleEndian.AppendUint64(nil, math.Float64bits(f)), nil
+	case Timestamp:
+		t, ok := value.(time.Time)
+		if !ok {
+			return nil, mismatch
+		}
+		return binary.LittleEndian.AppendUint64(nil, uint64(t.UnixMicro())), nil
+	case Date:
+		t, ok := value.(time.Time)
+		if !ok {
+			return nil, mismatch
+		}
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return binary.LittleEndian.AppendUint32(nil, uint32(int32(day.Unix()/86400))), nil
+	}
+	return nil, mismatch
+}
+
+// deref returns the value pointers of the supported types point to, or nil
+func deref(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *string:
+		if v != nil {
+			return *v
+		}
+		return nil
+	case *int64:
+		if v != nil {
+			return *v
+		}
+		return nil
+	case *float64:
+		if v != nil {
+			return *v
+		}
+		return nil
+	case *time.Time:
+		if v != nil {
+			return *v
+		}
+		return nil
+	}
+	return value
+}
+
+// add appends an encoded value, nil for null, to the chunk
+func (c *columnChunk) add(column Column, value []byte) {
+	c.present = append(c.present, value != nil)
+	if value == nil {
+		c.nulls++
+		return
+	}
+	if column.physical() == physicalByteArray {
+		c.values.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(value))))
+	}
+	c.values.Write(value)
+
+	if column.Type == JSON {
+		return
+	}
+	if c.min == nil || less(column, value, c.min) {
+		c.min = value
+	}
+	if c.max == nil || less(column, c.max, value) {
+		c.max = value
+	}
+}
+
+// less compares PLAIN encoded values in the sort order of the column's type
+func less(column Column, a, b []byte) bool {
+	switch column.physical() {
+	case physicalInt64:
+		return int64(binary.LittleEndian.Uint64(a)) < int64(binary.LittleEndian.Uint64(b))
+	case physicalInt32:
+		return int32(binary.LittleEndian.Uint32(a)) < int32(binary.LittleEndian.Uint32(b))
+	case physicalDouble:
+		return math.Float64frombits(binary.LittleEndian.Uint64(a)) < math.Float64frombits(binary.LittleEndian.Uint64(b))
+	}
+	// Strings are ordered by their unsigned bytes
+	return bytes.Compare(a, b) < 0
+}
+
+// flush writes the buffered rows as a row group
+func (w *Writer) flush() {
+	if w.buffered == 0 || w.err != nil {
+		return
+	}
+	group := rowGroup{rows: int64(w.buffered)}
+	for i, column := range w.columns {
+		meta, err := w.writeChunk(column, w.chunks[i])
+		if err != nil {
+			w.err = err
+			return
+		}
+		group.columns = append(group.columns, meta)
+		group.size += meta.uncompressed
+		w.chunks[i] = &columnChunk{}
+	}
+	w.rowGroups = append(w.rowGroups, group)
+	w.buffered = 0
+}
+
+// writeChunk writes a column chunk as a single data page
+func (w *Writer) writeChunk(column Column, chunk *columnChunk) (columnMeta, error) {
+	var page bytes.Buffer
+	if column.Optional {
+		levels := definitionLevels(chunk.present)
+		page.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(levels))))
+		page.Write(levels)
+	}
+	page.Write(chunk.values.Bytes())
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	if _, err := gz.Write(page.Bytes()); err != nil {
+		return columnMeta{}, fmt.Errorf("failed to compress column %s: %w", column.Name, err)
+	}
+	if err := gz.Close(); err != nil {
+		return columnMeta{}, fmt.Errorf("failed to compress column %s: %w", column.Name, err)
+	}
+
+	var header compactWriter
+	header.beginStruct()
+	header.i32(1, pageData)
+	header.i32(2, int32(page.Len()))
+	header.i32(3, int32(compressed.Len()))
+	header.structField(5)
+	header.i32(1, int32(len(chunk.present)))
+	header.i32(2, encodingPlain)
+	header.i32(3, encodingRLE)
+	header.i32(4, encodingRLE)
+	header.endStruct()
+	header.endStruct()
+
+	meta := columnMeta{
+		offset:       w.offset,
+		uncompressed: int64(len(header.buf) + page.Len()),
+		compressed:   int64(len(header.buf) + compressed.Len()),
+		values:       int64(len(chunk.present)),
+		nulls:        chunk.nulls,
+		min:          chunk.min,
+		max:          chunk.max,
+	}
+	w.write(header.buf)
+	w.write(compressed.Bytes())
+	return meta, w.err
+}
+
+// definitionLevels encodes whether each value of an optional column is present with the RLE
+// hybrid encoding, as runs of equal levels of bit width 1
+func definitionLevels(present []bool) []byte {
+	var levels []byte
+	for i := 0; i < len(present); {
+		run := 1
+		for i+run < len(present) && present[i+run] == present[i] {
+			run++
+		}
+		levels = binary.AppendUvarint(levels, uint64(run)<<1)
+		if present[i] {
+			levels = append(levels, 1)
+		} else {
+			levels = append(levels, 0)
+		}
+		i += run
+	}
+	return levels
+}
+
+// Close writes the buffered rows and the footer. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	w.flush()
+	if w.err != nil {
+		return w.err
+	}
+	footer := w.footer()
+	w.write(footer)
+	w.write(binary.LittleEndian.AppendUint32(nil, uint32(len(footer))))
+	w.write([]byte(magic))
+	return w.err
+}
+
+// footer returns the file metadata
+func (w *Writer) footer() []byte {
+	var t compactWriter
+	t.beginStruct()
+	t.i32(1, 1)
+
+	// The schema is a root group followed by its columns
+	t.list(2, compactStruct, len(w.columns)+1)
+	t.beginStruct()
+	t.string(4, "schema")
+	t.i32(5, int32(len(w.columns)))
+	t.endStruct()
+	for _, column := range w.columns {
+		t.beginStruct()
+		t.i32(1, column.physical())
+		if column.Optional {
+			t.i32(3, repetitionOptional)
+		} else {
+			t.i32(3, repetitionRequired)
+		}
+		t.string(4, column.Name)
+		writeLogicalType(&t, column.Type)
+		t.endStruct()
+	}
+
+	t.i64(3, w.rows)
+	t.list(4, compactStruct, len(w.rowGroups))
+	for _, group := range w.rowGroups {
+		t.beginStruct()
+		t.list(1, compactStruct, len(group.columns))
+		for i, meta := range group.columns {
+			column := w.columns[i]
+			t.beginStruct()
+			t.i64(2, meta.offset)
+			t.structField(3)
+			t.i32(1, column.physical())
+			t.listI32(2, encodingPlain, encodingRLE)
+			t.listString(3, column.Name)
+			t.i32(4, codecGzip)
+			t.i64(5, meta.values)
+			t.i64(6, meta.uncompressed)
+			t.i64(7, meta.compressed)
+			t.i64(9, meta.offset)
+			t.structField(12)
+			t.i64(3, meta.nulls)
+			if meta.max != nil {
+				t.binary(5, meta.max)
+				t.binary(6, meta.min)
+			}
+			t.endStruct()
+			t.endStruct()
+			t.endStruct()
+		}
+		t.i64(2, group.size)
+		t.i64(3, group.rows)
+		t.endStruct()
+	}
+
+	t.string(6, "ecoci")
+	// Statistics are ordered by the logical types of the columns
+	t.list(7, compactStruct, len(w.columns))
+	for range w.columns {
+		t.beginStruct()
+		t.emptyStruct(1)
+		t.endStruct()
+	}
+	t.endStruct()
+	return t.buf
+}
+
+// writeLogicalType writes the converted and logical types of a schema element; integers and
+// doubles have none
+func writeLogicalType(t *compactWriter, typ Type) {
+	switch typ {
+	case String:
+		t.i32(6, convertedUTF8)
+		t.structField(10)
+		t.emptyStruct(1)
+		t.endStruct()
+	case JSON:
+		t.i32(6, convertedJSON)
+		t.structField(10)
+		t.emptyStruct(12)
+		t.endStruct()
+	case Timestamp:
+		t.i32(6, convertedTimestampMicros)
+		t.structField(10)
+		t.structField(8)
+		t.bool(1, true)
+		t.structField(2)
+		t.emptyStruct(2)
+		t.endStruct()
+		t.endStruct()
+		t.endStruct()
+	case Date:
+		t.i32(6, convertedDate)
+		t.structField(10)
+		t.emptyStruct(6)
+		t.endStruct()
+	}
+}
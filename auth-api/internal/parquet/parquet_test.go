@@ -0,0 +1,249 @@
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// compactReader decodes Thrift compact structs into maps of field ID to value
+type compactReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *compactReader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	r.pos += n
+	return v
+}
+
+func (r *compactReader) zigzag() int64 {
+	v := r.uvarint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *compactReader) readStruct() map[int16]interface{} {
+	fields := map[int16]interface{}{}
+	var last int16
+	for {
+		header := r.buf[r.pos]
+		r.pos++
+		if header == 0 {
+			return fields
+		}
+		typ := header & 0x0f
+		if delta := int16(header >> 4); delta != 0 {
+			last += delta
+		} else {
+			last = int16(r.zigzag())
+		}
+		fields[last] = r.value(typ)
+	}
+}
+
+func (r *compactReader) value(typ byte) interface{} {
+	switch typ {
+	case compactTrue:
+		return true
+	case compactFalse:
+		return false
+	case compactI32, compactI64:
+		return r.zigzag()
+	case compactBinary:
+		n := int(r.uvarint())
+		r.pos += n
+		return r.buf[r.pos-n : r.pos]
+	case compactList:
+		header := r.buf[r.pos]
+		r.pos++
+		n := int(header >> 4)
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			list[i] = r.value(header & 0x0f)
+		}
+		return list
+	case compactStruct:
+		return r.readStruct()
+	}
+	panic("unsupported compact type")
+}
+
+// readColumn decodes the values of a column chunk, with nil for nulls
+func readColumn(t *testing.T, file []byte, column Column, rows int, meta map[int16]interface{}) []interface{} {
+	offset := int(meta[9].(int64))
+	r := &compactReader{buf: file, pos: offset}
+	header := r.readStruct()
+	assert.Equal(t, int64(pageData), header[1])
+	compressed := file[r.pos : r.pos+int(header[3].(int64))]
+	assert.Equal(t, meta[7], int64(r.pos-offset+len(compressed)), "compressed size")
+
+	gz, err := gzip.NewReader(bytes.NewReader(compressed))
+	require.NoError(t, err)
+	page, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, header[2], int64(len(page)))
+	assert.Equal(t, meta[6], int64(r.pos-offset+len(page)), "uncompressed size")
+
+	present := make([]bool, rows)
+	for i := range present {
+		present[i] = true
+	}
+	if column.Optional {
+		n := int(binary.LittleEndian.Uint32(page))
+		levels := &compactReader{buf: page[4 : 4+n]}
+		present = present[:0]
+		for levels.pos < n {
+			run := int(levels.uvarint() >> 1)
+			value := levels.buf[levels.pos] == 1
+			levels.pos++
+			for i := 0; i < run; i++ {
+				present = append(present, value)
+			}
+		}
+		page = page[4+n:]
+	}
+
+	var values []interface{}
+	for _, ok := range present {
+		if !ok {
+			values = append(values, nil)
+			continue
+		}
+		switch column.Type {
+		case String, JSON:
+			n := int(binary.LittleEndian.Uint32(page))
+			values = append(values, string(page[4:4+n]))
+			page = page[4+n:]
+		case Int64:
+			values = append(values, int64(binary.LittleEndian.Uint64(page)))
+			page = page[8:]
+		case Double:
+			values = append(values, math.Float64frombits(binary.LittleEndian.Uint64(page)))
+			page = page[8:]
+		case Timestamp:
+			values = append(values, time.UnixMicro(int64(binary.LittleEndian.Uint64(page))).UTC())
+			page = page[8:]
+		case Date:
+			values = append(values, time.Unix(int64(int32(binary.LittleEndian.Uint32(page)))*86400, 0).UTC())
+			page = page[4:]
+		}
+	}
+	assert.Empty(t, page, "trailing page data")
+	return values
+}
+
+func TestWriter(t *testing.T) {
+	columns := []Column{
+		{Name: "id", Type: String},
+		{Name: "branch", Type: String, Optional: true},
+		{Name: "count", Type: Int64},
+		{Name: "co2_kg", Type: Double},
+		{Name: "metadata", Type: JSON, Optional: true},
+		{Name: "created_at", Type: Timestamp},
+		{Name: "day", Type: Date, Optional: true},
+	}
+	at := time.Date(2024, 6, 14, 12, 30, 0, 123456000, time.UTC)
+	day := time.Date(2024, 6, 14, 0, 0, 0, 0, time.UTC)
+	branch := "main"
+	rows := [][]interface{}{
+		{"a", &branch, int64(3), 0.25, `{"ci":"github"}`, at, day},
+		{"b", nil, int64(-1), 1.5, nil, at.Add(time.Hour), (*time.Time)(nil)},
+		{"c", (*string)(nil), int64(7), 0.0, nil, at.Add(-time.Hour), day.AddDate(0, 0, -1)},
+	}
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf, columns)
+	w.RowGroupSize = 2
+	for _, row := range rows {
+		require.NoError(t, w.Write(row...))
+	}
+	require.NoError(t, w.Close())
+	file := buf.Bytes()
+
+	require.Equal(t, magic, string(file[:4]))
+	require.Equal(t, magic, string(file[len(file)-4:]))
+	size := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	metadata := (&compactReader{buf: file[len(file)-8-size : len(file)-8]}).readStruct()
+
+	assert.Equal(t, int64(3), metadata[3])
+	schema := metadata[2].([]interface{})
+	require.Len(t, schema, len(columns)+1)
+	assert.Equal(t, int64(len(columns)), schema[0].(map[int16]interface{})[5])
+	for i, column := range columns {
+		element := schema[i+1].(map[int16]interface{})
+		assert.Equal(t, column.Name, string(element[4].([]byte)))
+		assert.Equal(t, int64(column.physical()), element[1])
+	}
+	timestamp := schema[6].(map[int16]interface{})
+	assert.Equal(t, int64(convertedTimestampMicros), timestamp[6])
+	assert.Equal(t, map[int16]interface{}{8: map[int16]interface{}{1: true, 2: map[int16]interface{}{2: map[int16]interface{}{}}}}, timestamp[10])
+
+	// Rows are split into row groups of RowGroupSize
+	groups := metadata[4].([]interface{})
+	require.Len(t, groups, 2)
+	got := make([][]interface{}, 0, len(rows))
+	for _, g := range groups {
+		group := g.(map[int16]interface{})
+		n := int(group[3].(int64))
+		first := len(got)
+		for i := 0; i < n; i++ {
+			got = append(got, make([]interface{}, len(columns)))
+		}
+		for i, chunk := range group[1].([]interface{}) {
+			meta := chunk.(map[int16]interface{})[3].(map[int16]interface{})
+			assert.Equal(t, columns[i].Name, string(meta[3].([]interface{})[0].([]byte)))
+			assert.Equal(t, int64(codecGzip), meta[4])
+			for j, value := range readColumn(t, file, columns[i], n, meta) {
+				got[first+j][i] = value
+			}
+		}
+	}
+	assert.Equal(t, [][]interface{}{
+		{"a", "main", int64(3), 0.25, `{"ci":"github"}`, at.Truncate(time.Microsecond), day},
+		{"b", nil, int64(-1), 1.5, nil, at.Add(time.Hour).Truncate(time.Microsecond), nil},
+		{"c", nil, int64(7), 0.0, nil, at.Add(-time.Hour).Truncate(time.Microsecond), day.AddDate(0, 0, -1)},
+	}, got)
+
+	// Statistics of the first row group
+	chunks := groups[0].(map[int16]interface{})[1].([]interface{})
+	stats := func(column int) map[int16]interface{} {
+		return chunks[column].(map[int16]interface{})[3].(map[int16]interface{})[12].(map[int16]interface{})
+	}
+	assert.Equal(t, int64(1), stats(1)[3], "null count")
+	assert.Equal(t, int64(-1), int64(binary.LittleEndian.Uint64(stats(2)[6].([]byte))), "min")
+	assert.Equal(t, int64(3), int64(binary.LittleEndian.Uint64(stats(2)[5].([]byte))), "max")
+	assert.Equal(t, "b", string(stats(0)[5].([]byte)))
+	assert.NotContains(t, stats(4), int16(5), "JSON columns have no order")
+}
+
+func TestWriterErrors(t *testing.T) {
+	w := NewWriter(io.Discard, []Column{{Name: "id", Type: String}, {Name: "co2_kg", Type: Double}})
+	assert.EqualError(t, w.Write("a"), "row has 1 values for 2 columns")
+	assert.EqualError(t, w.Write(nil, 1.0), "column id is required")
+	assert.EqualError(t, w.Write("a", 1), "column co2_kg of type double cannot hold int")
+	require.NoError(t, w.Write("a", 1.0))
+	require.NoError(t, w.Close())
+}
+
+func TestEmptyFile(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, []Column{{Name: "id", Type: String}})
+	require.NoError(t, w.Close())
+	file := buf.Bytes()
+	size := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	assert.Equal(t, len(file), 4+size+8)
+	metadata := (&compactReader{buf: file[4 : 4+size]}).readStruct()
+	assert.Equal(t, int64(0), metadata[3])
+	assert.Empty(t, metadata[4])
+}
@@ -0,0 +1,125 @@
+package parquet
+
+import (
+	"encoding/binary"
+)
+
+// Types of the Thrift compact protocol, in which the metadata of Parquet files is written
+const (
+	compactTrue   = 1
+	compactFalse  = 2
+	compactI32    = 5
+	compactI64    = 6
+	compactBinary = 8
+	compactList   = 9
+	compactStruct = 12
+)
+
+// compactWriter writes Thrift structs in the compact protocol. Field IDs are written as deltas
+// from the previous field of the same struct, so the writer tracks the last ID of every open
+// struct.
+type compactWriter struct {
+	buf  []byte
+	last []int16
+}
+
+// beginStruct opens a struct, the top-level one included
+func (w *compactWriter) beginStruct() {
+	w.last = append(w.last, 0)
+}
+
+// endStruct writes the stop field and closes the innermost struct
+func (w *compactWriter) endStruct() {
+	w.buf = append(w.buf, 0)
+	w.last = w.last[:len(w.last)-1]
+}
+
+// field writes the header of field id, which must be greater than the previous field's
+func (w *compactWriter) field(id int16, typ byte) {
+	last := &w.last[len(w.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		w.buf = append(w.buf, byte(delta)<<4|typ)
+	} else {
+		w.buf = append(w.buf, typ)
+		w.varint(zigzag(int64(id)))
+	}
+	*last = id
+}
+
+func (w *compactWriter) varint(v uint64) {
+	w.buf = binary.AppendUvarint(w.buf, v)
+}
+
+// zigzag maps signed integers to unsigned ones so small magnitudes encode short
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+func (w *compactWriter) i32(id int16, v int32) {
+	w.field(id, compactI32)
+	w.varint(zigzag(int64(v)))
+}
+
+func (w *compactWriter) i64(id int16, v int64) {
+	w.field(id, compactI64)
+	w.varint(zigzag(v))
+}
+
+func (w *compactWriter) bool(id int16, v bool) {
+	if v {
+		w.field(id, compactTrue)
+	} else {
+		w.field(id, compactFalse)
+	}
+}
+
+func (w *compactWriter) binary(id int16, v []byte) {
+	w.field(id, compactBinary)
+	w.varint(uint64(len(v)))
+	w.buf = append(w.buf, v...)
+}
+
+func (w *compactWriter) string(id int16, v string) {
+	w.binary(id, []byte(v))
+}
+
+// structField opens a struct that is field id of the current struct
+func (w *compactWriter) structField(id int16) {
+	w.field(id, compactStruct)
+	w.beginStruct()
+}
+
+// emptyStruct writes a struct without fields, as the members of unions often are
+func (w *compactWriter) emptyStruct(id int16) {
+	w.structField(id)
+	w.endStruct()
+}
+
+// list writes the header of a list of n elements of typ that is field id; the elements
+// follow
+func (w *compactWriter) list(id int16, typ byte, n int) {
+	w.field(id, compactList)
+	if n < 15 {
+		w.buf = append(w.buf, byte(n)<<4|typ)
+		return
+	}
+	w.buf = append(w.buf, 0xf0|typ)
+	w.varint(uint64(n))
+}
+
+// listI32 writes a list of integers that is field id
+func (w *compactWriter) listI32(id int16, values ...int32) {
+	w.list(id, compactI32, len(values))
+	for _, v := range values {
+		w.varint(zigzag(int64(v)))
+	}
+}
+
+// listString writes a list of strings that is field id
+func (w *compactWriter) listString(id int16, values ...string) {
+	w.list(id, compactBinary, len(values))
+	for _, v := range values {
+		w.varint(uint64(len(v)))
+		w.buf = append(w.buf, v...)
+	}
+}
@@ -0,0 +1,151 @@
+// Package problem renders error responses as RFC 7807 problem details
+// (application/problem+json), so clients can handle every error of the API the same way.
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContentType is the media type of problem details
+const ContentType = "application/problem+json"
+
+// TypeBase is the base URI of the problem types. The type of a problem is its code in kebab
+// case under TypeBase, such as https://ecoci.dev/problems/run-not-found.
+const TypeBase = "https://ecoci.dev/problems/"
+
+// Problem is an RFC 7807 problem detail. Code, RequestID and Timestamp are extension members;
+// Code is the stable, machine-readable error code clients should branch on.
+type Problem struct {
+	Type      string    `json:"type" example:"https://ecoci.dev/problems/run-not-found"`
+	Title     string    `json:"title" example:"Run not found"`
+	Status    int       `json:"status" example:"404"`
+	Detail    string    `json:"detail,omitempty"`
+	Instance  string    `json:"instance,omitempty" example:"/api/v1/runs/1b4e28ba-2fa1-11d2-883f-0016d3cca427"`
+	Code      string    `json:"code" example:"RUN_NOT_FOUND"`
+	RequestID string    `json:"request_id,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	// Extensions are additional members specific to the problem type
+	Extensions map[string]interface{} `json:"-"`
+}
+
+// New returns a problem with status, code and title; the title is the same for every
+// occurrence of the problem
+func New(status int, code, title string) *Problem {
+	return &Problem{
+		Type:   TypeBase + strings.ReplaceAll(strings.ToLower(code), "_", "-"),
+		Title:  title,
+		Status: status,
+		Code:   code,
+	}
+}
+
+// WithDetail explains this occurrence of the problem
+func (p *Problem) WithDetail(detail string) *Problem {
+	p.Detail = detail
+	return p
+}
+
+// With adds the extension member name
+func (p *Problem) With(name string, value interface{}) *Problem {
+	if p.Extensions == nil {
+		p.Extensions = map[string]interface{}{}
+	}
+	p.Extensions[name] = value
+	return p
+}
+
+// MarshalJSON writes the standard members and the extensions as one object
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	type members Problem
+	standard, err := json.Marshal((*members)(p))
+	if err != nil || len(p.Extensions) == 0 {
+		return standard, err
+	}
+
+	object := map[string]json.RawMessage{}
+	if err := json.Unmarshal(standard, &object); err != nil {
+		return nil, err
+	}
+	for name, value := range p.Extensions {
+		// Extensions cannot replace the standard members
+		if _, ok := object[name]; ok {
+			continue
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		object[name] = encoded
+	}
+	return json.Marshal(object)
+}
+
+// UnmarshalJSON reads the standard members and keeps the other members as extensions
+func (p *Problem) UnmarshalJSON(data []byte) error {
+	type members Problem
+	if err := json.Unmarshal(data, (*members)(p)); err != nil {
+		return err
+	}
+	object := map[string]interface{}{}
+	if err := json.Unmarshal(data, &object); err != nil {
+		return err
+	}
+	for _, name := range []string{"type", "title", "status", "detail", "instance", "code", "request_id", "timestamp"} {
+		delete(object, name)
+	}
+	p.Extensions = nil
+	if len(object) > 0 {
+		p.Extensions = object
+	}
+	return nil
+}
+
+// Write renders p as the response to c, identifying the occurrence by the request path and ID
+func Write(c *gin.Context, p *Problem) {
+	if p.Instance == "" {
+		p.Instance = c.Request.URL.Path
+	}
+	if p.RequestID == "" {
+		p.RequestID = c.GetString("request_id")
+	}
+	if p.Timestamp.IsZero() {
+		p.Timestamp = time.Now().UTC()
+	}
+
+	// The JSON renderer keeps a content type that is already set
+	c.Header("Content-Type", ContentType)
+	c.JSON(p.Status, p)
+}
+
+// Respond writes a problem with status, code and title
+func Respond(c *gin.Context, status int, code, title string) {
+	Write(c, New(status, code, title))
+}
+
+// RespondDetail writes a problem with status, code and title, explaining this occurrence
+// in detail
+func RespondDetail(c *gin.Context, status int, code, title, detail string) {
+	Write(c, New(status, code, title).WithDetail(detail))
+}
+
+// Abort writes a problem with status, code and title and stops the remaining handlers
+func Abort(c *gin.Context, status int, code, title string) {
+	Respond(c, status, code, title)
+	c.Abort()
+}
+
+// NotFound responds to requests for routes that do not exist
+func NotFound(c *gin.Context) {
+	Respond(c, http.StatusNotFound, "ROUTE_NOT_FOUND", "Route not found")
+}
+
+// Recover responds to requests whose handler panicked; the panic was logged by the recovery
+// middleware
+func Recover(c *gin.Context, _ interface{}) {
+	Abort(c, http.StatusInternalServerError, "INTERNAL_ERROR", "Internal server error")
+}
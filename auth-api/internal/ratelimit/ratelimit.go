@@ -0,0 +1,92 @@
+// Package ratelimit counts requests per key in fixed windows stored in Redis, so limits hold
+// across every API instance. Each window is one counter that expires with the window.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// keyPrefix namespaces every key written by the limiter
+const keyPrefix = "ecoci:ratelimit:"
+
+// Result is the state of a key's counter after a request was counted
+type Result struct {
+	// Allowed reports whether the request is within the limit
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// ResetAt is when the current window ends and the counter starts over
+	ResetAt time.Time
+}
+
+// Limiter is a Redis-backed fixed-window rate limiter
+type Limiter struct {
+	client *redis.Client
+	window time.Duration
+}
+
+// New connects to the Redis server at url ("redis://[:password@]host:port/db") and counts
+// requests in windows of the given length
+func New(url string, window time.Duration) (*Limiter, error) {
+	if window <= 0 {
+		return nil, fmt.Errorf("rate limit window must be positive")
+	}
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+	// Counting a request must not hold it up for long
+	if opts.DialTimeout == 0 {
+		opts.DialTimeout = time.Second
+	}
+	if opts.ReadTimeout == 0 {
+		opts.ReadTimeout = 200 * time.Millisecond
+	}
+	if opts.WriteTimeout == 0 {
+		opts.WriteTimeout = 200 * time.Millisecond
+	}
+	return &Limiter{client: redis.NewClient(opts), window: window}, nil
+}
+
+// Ping checks the connection to Redis
+func (l *Limiter) Ping(ctx context.Context) error {
+	return l.client.Ping(ctx).Err()
+}
+
+// Close closes the connection to Redis
+func (l *Limiter) Close() error {
+	return l.client.Close()
+}
+
+// Allow counts a request for key at now and reports whether it is within limit requests
+// per window
+func (l *Limiter) Allow(ctx context.Context, key string, limit int, now time.Time) (*Result, error) {
+	windowStart := now.Truncate(l.window)
+	counterKey := keyPrefix + key + ":" + strconv.FormatInt(windowStart.Unix(), 10)
+
+	var count *redis.IntCmd
+	_, err := l.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		count = pipe.Incr(ctx, counterKey)
+		pipe.Expire(ctx, counterKey, l.window)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count request: %w", err)
+	}
+
+	remaining := limit - int(count.Val())
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &Result{
+		Allowed:   count.Val() <= int64(limit),
+		Limit:     limit,
+		Remaining: remaining,
+		ResetAt:   windowStart.Add(l.window),
+	}, nil
+}
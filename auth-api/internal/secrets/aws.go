@@ -0,0 +1,52 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// awsProvider reads secrets from AWS Secrets Manager
+type awsProvider struct {
+	client *secretsmanager.Client
+}
+
+// newAWSProvider creates a Secrets Manager client with the default AWS configuration (region
+// and credentials from the environment, shared configuration or instance role)
+func newAWSProvider(ctx context.Context) (*awsProvider, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+	}
+	return &awsProvider{client: secretsmanager.NewFromConfig(cfg)}, nil
+}
+
+// Read implements Provider. Paths are secret names or ARNs. Secrets holding a JSON object
+// yield its keys; any other secret string is returned as the single value "value".
+func (p *awsProvider) Read(ctx context.Context, path string) (map[string]string, error) {
+	out, err := p.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(path),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if out.SecretString == nil {
+		return nil, fmt.Errorf("binary secrets are not supported")
+	}
+
+	var object map[string]interface{}
+	if err := json.Unmarshal([]byte(*out.SecretString), &object); err != nil {
+		return map[string]string{"value": *out.SecretString}, nil
+	}
+	values := make(map[string]string, len(object))
+	for key, v := range object {
+		if v != nil {
+			values[key] = fmt.Sprint(v)
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,201 @@
+// Package secrets reads the secrets of the API (JWT secret, OAuth client secret, database
+// credentials) from HashiCorp Vault or AWS Secrets Manager instead of plaintext settings. The
+// secrets are re-read periodically so rotated values take effect without a restart.
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Provider reads secrets from a secrets backend
+type Provider interface {
+	// Read returns the key/value pairs of the secret at path
+	Read(ctx context.Context, path string) (map[string]string, error)
+}
+
+// NewProvider creates the provider of a backend ("vault" or "aws"), configured from the
+// standard environment of the backend (VAULT_ADDR and VAULT_TOKEN, or the AWS credential chain)
+func NewProvider(ctx context.Context, backend string) (Provider, error) {
+	switch backend {
+	case "vault":
+		return newVaultProvider(nil)
+	case "aws":
+		return newAWSProvider(ctx)
+	default:
+		return nil, fmt.Errorf("unknown secrets backend %q", backend)
+	}
+}
+
+// ParseRef splits a secret reference "path#key" into the path of the secret and the key of
+// the value; the key may be omitted for secrets holding a single value
+func ParseRef(ref string) (string, string, error) {
+	path, key, _ := strings.Cut(ref, "#")
+	if path == "" {
+		return "", "", fmt.Errorf("invalid secret reference %q", ref)
+	}
+	return path, key, nil
+}
+
+// Store caches the secrets read through a provider and notifies watchers when a refresh finds
+// that a secret changed
+type Store struct {
+	provider Provider
+
+	mu       sync.Mutex
+	values   map[string]map[string]string
+	watchers map[string][]func(map[string]string)
+}
+
+// NewStore creates a store reading secrets through provider
+func NewStore(provider Provider) *Store {
+	return &Store{
+		provider: provider,
+		values:   map[string]map[string]string{},
+		watchers: map[string][]func(map[string]string){},
+	}
+}
+
+// Read returns the key/value pairs of the secret at path, reading it on first use
+func (s *Store) Read(ctx context.Context, path string) (map[string]string, error) {
+	s.mu.Lock()
+	values, ok := s.values[path]
+	s.mu.Unlock()
+	if ok {
+		return values, nil
+	}
+
+	values, err := s.provider.Read(ctx, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret %s: %w", path, err)
+	}
+	s.mu.Lock()
+	s.values[path] = values
+	s.mu.Unlock()
+	return values, nil
+}
+
+// Get returns the value a reference points to
+func (s *Store) Get(ctx context.Context, ref string) (string, error) {
+	path, key, err := ParseRef(ref)
+	if err != nil {
+		return "", err
+	}
+	values, err := s.Read(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	return value(path, key, values)
+}
+
+// value picks key out of the values of the secret at path, or its only value when key is empty
+func value(path, key string, values map[string]string) (string, error) {
+	if key == "" {
+		if len(values) != 1 {
+			return "", fmt.Errorf("secret %s holds %d values; name one with %s#key", path, len(values), path)
+		}
+		for _, v := range values {
+			return v, nil
+		}
+	}
+	v, ok := values[key]
+	if !ok || v == "" {
+		return "", fmt.Errorf("secret %s has no value %s", path, key)
+	}
+	return v, nil
+}
+
+// Watch calls fn with the new values whenever a refresh finds that the secret at path changed
+func (s *Store) Watch(path string, fn func(map[string]string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.watchers[path] = append(s.watchers[path], fn)
+}
+
+// WatchKey calls fn with the new value whenever a refresh finds that the value a reference
+// points to changed
+func (s *Store) WatchKey(ref string, fn func(string)) error {
+	path, key, err := ParseRef(ref)
+	if err != nil {
+		return err
+	}
+	s.Watch(path, func(values map[string]string) {
+		v, err := value(path, key, values)
+		if err != nil {
+			log.Printf("Warning: ignoring rotated secret: %v", err)
+			return
+		}
+		fn(v)
+	})
+	return nil
+}
+
+// Refresh re-reads every secret read so far and notifies the watchers of those that changed.
+// A secret that cannot be read keeps its previous value.
+func (s *Store) Refresh(ctx context.Context) error {
+	s.mu.Lock()
+	paths := make([]string, 0, len(s.values))
+	for path := range s.values {
+		paths = append(paths, path)
+	}
+	s.mu.Unlock()
+
+	var failed []string
+	for _, path := range paths {
+		values, err := s.provider.Read(ctx, path)
+		if err != nil {
+			failed = append(failed, path)
+			continue
+		}
+
+		s.mu.Lock()
+		changed := !equal(s.values[path], values)
+		s.values[path] = values
+		watchers := append([]func(map[string]string){}, s.watchers[path]...)
+		s.mu.Unlock()
+
+		if changed {
+			log.Printf("Secret %s changed", path)
+			for _, watcher := range watchers {
+				watcher(values)
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to re-read secrets %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// Run refreshes the secrets every interval until ctx is cancelled
+func (s *Store) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Refresh(ctx); err != nil {
+				log.Printf("Warning: %v", err)
+			}
+		}
+	}
+}
+
+// equal compares the values of two secrets
+func equal(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, v := range a {
+		if other, ok := b[key]; !ok || other != v {
+			return false
+		}
+	}
+	return true
+}
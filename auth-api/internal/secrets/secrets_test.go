@@ -0,0 +1,152 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	vault "github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProvider serves secrets from memory
+type fakeProvider struct {
+	mu      sync.Mutex
+	secrets map[string]map[string]string
+	reads   int
+}
+
+func (p *fakeProvider) Read(ctx context.Context, path string) (map[string]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reads++
+	values, ok := p.secrets[path]
+	if !ok {
+		return nil, errors.New("secret not found")
+	}
+	return values, nil
+}
+
+func (p *fakeProvider) set(path string, values map[string]string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.secrets[path] = values
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("references", func(t *testing.T) {
+		provider := &fakeProvider{secrets: map[string]map[string]string{
+			"ecoci/jwt":      {"value": "jwt-secret"},
+			"ecoci/database": {"username": "ecoci", "password": "hunter2"},
+		}}
+		store := NewStore(provider)
+
+		secret, err := store.Get(ctx, "ecoci/jwt")
+		require.NoError(t, err)
+		assert.Equal(t, "jwt-secret", secret)
+
+		password, err := store.Get(ctx, "ecoci/database#password")
+		require.NoError(t, err)
+		assert.Equal(t, "hunter2", password)
+
+		// Secrets are read once
+		_, err = store.Get(ctx, "ecoci/database#username")
+		require.NoError(t, err)
+		assert.Equal(t, 2, provider.reads)
+
+		_, err = store.Get(ctx, "ecoci/database")
+		assert.ErrorContains(t, err, "holds 2 values")
+		_, err = store.Get(ctx, "ecoci/database#token")
+		assert.ErrorContains(t, err, "has no value token")
+		_, err = store.Get(ctx, "ecoci/missing#value")
+		assert.Error(t, err)
+		_, err = store.Get(ctx, "#value")
+		assert.Error(t, err)
+	})
+
+	t.Run("rotation", func(t *testing.T) {
+		provider := &fakeProvider{secrets: map[string]map[string]string{
+			"ecoci/jwt": {"value": "old-secret"},
+		}}
+		store := NewStore(provider)
+		_, err := store.Get(ctx, "ecoci/jwt#value")
+		require.NoError(t, err)
+
+		var rotated []string
+		require.NoError(t, store.WatchKey("ecoci/jwt#value", func(secret string) {
+			rotated = append(rotated, secret)
+		}))
+
+		// Unchanged secrets do not notify the watchers
+		require.NoError(t, store.Refresh(ctx))
+		assert.Empty(t, rotated)
+
+		provider.set("ecoci/jwt", map[string]string{"value": "new-secret"})
+		require.NoError(t, store.Refresh(ctx))
+		assert.Equal(t, []string{"new-secret"}, rotated)
+
+		secret, err := store.Get(ctx, "ecoci/jwt#value")
+		require.NoError(t, err)
+		assert.Equal(t, "new-secret", secret)
+
+		// A secret that cannot be re-read keeps its value
+		delete(provider.secrets, "ecoci/jwt")
+		assert.Error(t, store.Refresh(ctx))
+		secret, err = store.Get(ctx, "ecoci/jwt#value")
+		require.NoError(t, err)
+		assert.Equal(t, "new-secret", secret)
+	})
+}
+
+func TestVaultProvider(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "test-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/ecoci":
+			// KV version 2 engine
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{
+					"data":     map[string]interface{}{"jwt_secret": "from-vault"},
+					"metadata": map[string]interface{}{"version": 3},
+				},
+			})
+		case "/v1/kv/ecoci":
+			// KV version 1 engine
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{"client_secret": "from-kv1"},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	config := vault.DefaultConfig()
+	config.Address = ts.URL
+	provider, err := newVaultProvider(config)
+	require.NoError(t, err)
+	provider.client.SetToken("test-token")
+	store := NewStore(provider)
+
+	ctx := context.Background()
+	secret, err := store.Get(ctx, "secret/data/ecoci#jwt_secret")
+	require.NoError(t, err)
+	assert.Equal(t, "from-vault", secret)
+
+	secret, err = store.Get(ctx, "kv/ecoci#client_secret")
+	require.NoError(t, err)
+	assert.Equal(t, "from-kv1", secret)
+
+	_, err = store.Get(ctx, "secret/data/missing#value")
+	assert.Error(t, err)
+}
@@ -0,0 +1,58 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+
+	vault "github.com/hashicorp/vault/api"
+)
+
+// vaultProvider reads secrets from HashiCorp Vault
+type vaultProvider struct {
+	client *vault.Client
+}
+
+// newVaultProvider connects to Vault with config, or with the configuration in the environment
+// (VAULT_ADDR, VAULT_TOKEN, VAULT_NAMESPACE, VAULT_CACERT) when nil
+func newVaultProvider(config *vault.Config) (*vaultProvider, error) {
+	if config == nil {
+		config = vault.DefaultConfig()
+		if config.Error != nil {
+			return nil, fmt.Errorf("invalid Vault configuration: %w", config.Error)
+		}
+	}
+
+	client, err := vault.NewClient(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Vault client: %w", err)
+	}
+	return &vaultProvider{client: client}, nil
+}
+
+// Read implements Provider. Paths are API paths, such as "secret/data/ecoci" for a secret of
+// the KV version 2 engine mounted at "secret".
+func (p *vaultProvider) Read(ctx context.Context, path string) (map[string]string, error) {
+	secret, err := p.client.Logical().ReadWithContext(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, fmt.Errorf("secret not found")
+	}
+
+	data := secret.Data
+	// The KV version 2 engine nests the secret under "data", next to its "metadata"
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, versioned := data["metadata"]; versioned {
+			data = nested
+		}
+	}
+
+	values := make(map[string]string, len(data))
+	for key, v := range data {
+		if v != nil {
+			values[key] = fmt.Sprint(v)
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,359 @@
+// Package seed fills a database with demo data: users, an organization, repositories and
+// a history of realistic CI runs, so the frontend and demos have data without real pipelines.
+// Seeded records use GitHub IDs from a reserved range, so they can be told apart from real
+// data and removed again.
+package seed
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// GitHubIDBase is the first GitHub ID of seeded users, organizations and repositories. It is
+// far above the IDs GitHub has handed out.
+const GitHubIDBase int64 = 9_000_000_000
+
+// Organization is the GitHub login of the seeded organization
+const Organization = "ecoci-demo"
+
+// ErrAlreadySeeded is returned when the database already holds seeded data
+var ErrAlreadySeeded = errors.New("database already holds seed data")
+
+// Options control how much data is seeded
+type Options struct {
+	// Users is the number of demo users; all of them are members of the demo organization
+	Users int
+	// ReposPerUser is the number of repositories of each user; every other one belongs to
+	// the demo organization
+	ReposPerUser int
+	// RunsPerDay is the average number of runs of a repository on a weekday; weekends see
+	// a quarter of that
+	RunsPerDay float64
+	// Days is how far back the run history goes
+	Days int
+	// Seed makes the generated data reproducible
+	Seed int64
+}
+
+// DefaultOptions seed a year of runs for a small team
+func DefaultOptions() Options {
+	return Options{
+		Users:        5,
+		ReposPerUser: 3,
+		RunsPerDay:   4,
+		Days:         365,
+		Seed:         1,
+	}
+}
+
+// validate checks that the options describe some data
+func (o Options) validate() error {
+	if o.Users < 1 {
+		return fmt.Errorf("at least one user is required")
+	}
+	if o.ReposPerUser < 1 {
+		return fmt.Errorf("at least one repository per user is required")
+	}
+	if o.RunsPerDay <= 0 {
+		return fmt.Errorf("runs per day must be positive")
+	}
+	if o.Days < 1 {
+		return fmt.Errorf("at least one day of runs is required")
+	}
+	return nil
+}
+
+// Summary describes the seeded records
+type Summary struct {
+	Users        []db.User
+	Repositories int
+	Runs         int
+}
+
+// Names of the demo users and repositories
+var (
+	userNames = []string{"ada", "grace", "linus", "margaret", "dennis", "barbara", "ken", "radia", "guido", "frances"}
+	repoNames = []string{"web-app", "api-gateway", "data-pipeline", "mobile-client", "infra", "docs-site", "ml-models", "billing", "search", "auth-service"}
+	branches  = []string{"develop", "feature/dark-mode", "feature/caching", "fix/flaky-tests", "chore/deps", "release/2.0"}
+	regions   = []struct {
+		name string
+		// intensity is the average grid carbon intensity in kg CO2 per kWh
+		intensity float64
+	}{
+		{"eu-north-1", 0.045},
+		{"eu-west-1", 0.28},
+		{"us-east-1", 0.38},
+		{"us-west-2", 0.24},
+		{"ap-south-1", 0.63},
+	}
+)
+
+// workflow is a kind of CI run
+type workflow struct {
+	name string
+	// share is the fraction of the runs of a repository that are of this workflow
+	share float64
+	// durationS is the typical duration in seconds
+	durationS float64
+}
+
+var workflows = []workflow{
+	{"CI", 0.55, 420},
+	{"Tests", 0.25, 900},
+	{"Deploy", 0.12, 600},
+	{"Nightly", 0.08, 2400},
+}
+
+// Seed creates demo users, their organization and repositories, and Days of runs up to now.
+// It returns ErrAlreadySeeded when seed data exists; Reset removes it first.
+func Seed(ctx context.Context, database *gorm.DB, opts Options, now time.Time) (*Summary, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+
+	var existing int64
+	if err := database.WithContext(ctx).Unscoped().Model(&db.User{}).Where("github_id >= ?", GitHubIDBase).Count(&existing).Error; err != nil {
+		return nil, fmt.Errorf("failed to check for seed data: %w", err)
+	}
+	if existing > 0 {
+		return nil, ErrAlreadySeeded
+	}
+
+	rng := rand.New(rand.NewSource(opts.Seed))
+	summary := &Summary{}
+	err := database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		org := db.Organization{GitHubID: GitHubIDBase, GitHubLogin: Organization}
+		if err := tx.Create(&org).Error; err != nil {
+			return fmt.Errorf("failed to create organization: %w", err)
+		}
+
+		users := make([]db.User, opts.Users)
+		for i := range users {
+			login := name(userNames, i)
+			users[i] = db.User{
+				GitHubID:       GitHubIDBase + int64(i) + 1,
+				GitHubUsername: login,
+				GitHubEmail:    stringPtr(login + "@demo.ecoci.dev"),
+				Name:           stringPtr(login),
+				AvatarURL:      stringPtr(fmt.Sprintf("https://avatars.githubusercontent.com/u/%d", i+1)),
+				CreatedAt:      now.AddDate(0, 0, -opts.Days-30),
+			}
+		}
+		if err := tx.Create(&users).Error; err != nil {
+			return fmt.Errorf("failed to create users: %w", err)
+		}
+		for _, user := range users {
+			member := db.OrganizationMember{OrganizationID: org.ID, UserID: user.ID}
+			if err := tx.Create(&member).Error; err != nil {
+				return fmt.Errorf("failed to add organization member: %w", err)
+			}
+		}
+
+		for i, user := range users {
+			for j := 0; j < opts.ReposPerUser; j++ {
+				index := i*opts.ReposPerUser + j
+				repo := db.Repository{
+					OwnerID:      user.ID,
+					GitHubRepoID: GitHubIDBase + int64(index) + 1,
+					Name:         name(repoNames, index),
+					Description:  stringPtr("Demo repository"),
+					PublicStats:  index%3 == 0,
+					CreatedAt:    now.AddDate(0, 0, -opts.Days-30),
+				}
+				owner := user.GitHubUsername
+				if j%2 == 1 {
+					repo.OrganizationID = &org.ID
+					owner = Organization
+				}
+				repo.FullName = owner + "/" + repo.Name
+				repo.HTMLURL = "https://github.com/" + repo.FullName
+				if err := tx.Create(&repo).Error; err != nil {
+					return fmt.Errorf("failed to create repository %s: %w", repo.FullName, err)
+				}
+
+				runs := generateRuns(rng, &repo, users, opts, now)
+				if len(runs) > 0 {
+					// Rollups are rebuilt once below instead of updated run by run
+					if err := tx.Session(&gorm.Session{SkipHooks: true}).CreateInBatches(runs, 500).Error; err != nil {
+						return fmt.Errorf("failed to create runs of %s: %w", repo.FullName, err)
+					}
+					if err := db.RebuildRollups(tx, repo.ID); err != nil {
+						return err
+					}
+				}
+				summary.Repositories++
+				summary.Runs += len(runs)
+			}
+		}
+
+		summary.Users = users
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// generateRuns generates the run history of a repository. Every repository gets its own
+// activity level, runner power, region and efficiency trend, so their statistics differ.
+func generateRuns(rng *rand.Rand, repo *db.Repository, users []db.User, opts Options, now time.Time) []db.Run {
+	activity := 0.5 + rng.Float64()
+	powerKW := 0.08 + rng.Float64()*0.07
+	region := regions[rng.Intn(len(regions))]
+	// trend is the change of energy use over the whole period, from 25% less to 10% more
+	trend := -0.25 + rng.Float64()*0.35
+
+	// Runs of organization repositories are started by any member
+	starters := []uuid.UUID{repo.OwnerID}
+	if repo.OrganizationID != nil {
+		starters = starters[:0]
+		for _, user := range users {
+			starters = append(starters, user.ID)
+		}
+	}
+
+	start := db.RollupDay(now).AddDate(0, 0, -opts.Days+1)
+	var runs []db.Run
+	for day := 0; day < opts.Days; day++ {
+		date := start.AddDate(0, 0, day)
+		expected := opts.RunsPerDay * activity
+		if weekday := date.Weekday(); weekday == time.Saturday || weekday == time.Sunday {
+			expected /= 4
+		}
+		progress := float64(day) / float64(opts.Days)
+		// Grid intensity peaks in winter
+		season := 1 + 0.1*math.Cos(2*math.Pi*float64(date.YearDay())/365)
+
+		for n := poisson(rng, expected); n > 0; n-- {
+			// Most runs start during working hours
+			createdAt := date.Add(time.Duration(8*3600+rng.Intn(10*3600)) * time.Second)
+			if createdAt.After(now) {
+				continue
+			}
+
+			wf := pickWorkflow(rng)
+			durationS := round(wf.durationS*math.Exp(rng.NormFloat64()*0.35), 3)
+			energyKWh := round(powerKW*durationS/3600*(1+trend*progress), 6)
+			intensity := region.intensity * season * (0.9 + rng.Float64()*0.2)
+
+			branch := "main"
+			if rng.Float64() < 0.4 {
+				branch = branches[rng.Intn(len(branches))]
+			}
+
+			// Hooks are skipped, so the ID is set here
+			id, _ := uuid.NewRandomFromReader(rng)
+			runs = append(runs, db.Run{
+				ID:           id,
+				UserID:       starters[rng.Intn(len(starters))],
+				RepositoryID: repo.ID,
+				EnergyKWh:    energyKWh,
+				CO2Kg:        round(energyKWh*intensity, 6),
+				DurationS:    durationS,
+				GitCommitSHA: stringPtr(commitSHA(rng)),
+				BranchName:   stringPtr(branch),
+				WorkflowName: stringPtr(wf.name),
+				RunMetadata: db.JSONB{
+					"ci_provider":      "github-actions",
+					"runner":           "ubuntu-latest",
+					"region":           region.name,
+					"carbon_intensity": round(intensity*1000, 1),
+				},
+				CreatedAt: createdAt,
+			})
+		}
+	}
+	return runs
+}
+
+// Reset removes the seeded users, organization and repositories with their runs. Soft
+// deleted seed data is removed as well.
+func Reset(ctx context.Context, database *gorm.DB) error {
+	return database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		tx = tx.Unscoped().Session(&gorm.Session{})
+		repos := tx.Model(&db.Repository{}).Select("id").Where("github_repo_id >= ?", GitHubIDBase)
+		users := tx.Model(&db.User{}).Select("id").Where("github_id >= ?", GitHubIDBase)
+		orgs := tx.Model(&db.Organization{}).Select("id").Where("github_id >= ?", GitHubIDBase)
+
+		steps := []struct {
+			what  string
+			query *gorm.DB
+			model interface{}
+		}{
+			{"runs", tx.Where("repository_id IN (?)", repos), &db.Run{}},
+			{"rollups", tx.Where("repository_id IN (?)", repos), &db.RepositoryDailyRollup{}},
+			{"collaborators", tx.Where("repository_id IN (?) OR user_id IN (?)", repos, users), &db.RepositoryCollaborator{}},
+			{"organization members", tx.Where("organization_id IN (?) OR user_id IN (?)", orgs, users), &db.OrganizationMember{}},
+			{"repositories", tx.Where("github_repo_id >= ?", GitHubIDBase), &db.Repository{}},
+			{"users", tx.Where("github_id >= ?", GitHubIDBase), &db.User{}},
+			{"organizations", tx.Where("github_id >= ?", GitHubIDBase), &db.Organization{}},
+		}
+		for _, step := range steps {
+			if err := step.query.Delete(step.model).Error; err != nil {
+				return fmt.Errorf("failed to delete seeded %s: %w", step.what, err)
+			}
+		}
+		return nil
+	})
+}
+
+// name returns the i-th name of a list, numbered once the list is exhausted
+func name(names []string, i int) string {
+	if i < len(names) {
+		return names[i]
+	}
+	return fmt.Sprintf("%s-%d", names[i%len(names)], i/len(names)+1)
+}
+
+// pickWorkflow picks a workflow by its share of runs
+func pickWorkflow(rng *rand.Rand) workflow {
+	x := rng.Float64()
+	for _, wf := range workflows {
+		if x < wf.share {
+			return wf
+		}
+		x -= wf.share
+	}
+	return workflows[0]
+}
+
+// poisson draws from a Poisson distribution with mean lambda (Knuth's method, fine for the
+// small means used here)
+func poisson(rng *rand.Rand, lambda float64) int {
+	limit := math.Exp(-lambda)
+	n := 0
+	for p := rng.Float64(); p > limit; p *= rng.Float64() {
+		n++
+	}
+	return n
+}
+
+// commitSHA returns a random commit SHA
+func commitSHA(rng *rand.Rand) string {
+	var seed [8]byte
+	rng.Read(seed[:])
+	sum := sha1.Sum(seed[:])
+	return hex.EncodeToString(sum[:])
+}
+
+// round rounds x to the given number of decimals
+func round(x float64, decimals int) float64 {
+	scale := math.Pow(10, float64(decimals))
+	return math.Round(x*scale) / scale
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
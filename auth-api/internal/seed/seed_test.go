@@ -0,0 +1,103 @@
+package seed
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	database, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		sqlDB, _ := database.DB()
+		sqlDB.Close()
+	})
+
+	require.NoError(t, database.AutoMigrate(&db.User{}, &db.Repository{}, &db.Run{},
+		&db.Organization{}, &db.OrganizationMember{}, &db.RepositoryCollaborator{},
+		&db.RepositoryDailyRollup{}))
+	return database
+}
+
+func TestSeed(t *testing.T) {
+	database := setupTestDB(t)
+	ctx := context.Background()
+	now := time.Date(2024, 6, 14, 18, 0, 0, 0, time.UTC)
+
+	// A real user is left alone by Reset
+	realUser := &db.User{GitHubID: 12345, GitHubUsername: "realuser"}
+	require.NoError(t, database.Create(realUser).Error)
+
+	opts := Options{Users: 2, ReposPerUser: 2, RunsPerDay: 3, Days: 60, Seed: 42}
+	summary, err := Seed(ctx, database, opts, now)
+	require.NoError(t, err)
+	require.Len(t, summary.Users, 2)
+	assert.Equal(t, "ada", summary.Users[0].GitHubUsername)
+	assert.Equal(t, 4, summary.Repositories)
+	// Weekdays average 3 runs per repository scaled by its activity, weekends a quarter
+	assert.Greater(t, summary.Runs, 60)
+
+	t.Run("records", func(t *testing.T) {
+		var runs int64
+		require.NoError(t, database.Model(&db.Run{}).Count(&runs).Error)
+		assert.Equal(t, int64(summary.Runs), runs)
+
+		var orgRepos int64
+		require.NoError(t, database.Model(&db.Repository{}).Where("full_name LIKE ?", Organization+"/%").Count(&orgRepos).Error)
+		assert.Equal(t, int64(2), orgRepos)
+
+		var oldest, newest db.Run
+		require.NoError(t, database.Order("created_at ASC").First(&oldest).Error)
+		require.NoError(t, database.Order("created_at DESC").First(&newest).Error)
+		assert.False(t, oldest.CreatedAt.Before(now.AddDate(0, 0, -opts.Days)))
+		assert.False(t, newest.CreatedAt.After(now))
+		assert.Len(t, *oldest.GitCommitSHA, 40)
+		assert.Greater(t, oldest.CO2Kg, 0.0)
+	})
+
+	t.Run("rollups match the runs", func(t *testing.T) {
+		var rolledUp int64
+		require.NoError(t, database.Model(&db.RepositoryDailyRollup{}).Select("COALESCE(SUM(run_count), 0)").Scan(&rolledUp).Error)
+		assert.Equal(t, int64(summary.Runs), rolledUp)
+	})
+
+	t.Run("seeding twice is refused", func(t *testing.T) {
+		_, err := Seed(ctx, database, opts, now)
+		assert.ErrorIs(t, err, ErrAlreadySeeded)
+	})
+
+	t.Run("reset and reseed is reproducible", func(t *testing.T) {
+		var before []float64
+		require.NoError(t, database.Model(&db.Run{}).Order("created_at ASC, co2_kg ASC").Pluck("co2_kg", &before).Error)
+
+		require.NoError(t, Reset(ctx, database))
+		for _, model := range []interface{}{&db.Run{}, &db.RepositoryDailyRollup{}, &db.Repository{}, &db.OrganizationMember{}, &db.Organization{}} {
+			var count int64
+			require.NoError(t, database.Model(model).Count(&count).Error)
+			assert.Zero(t, count)
+		}
+		var users []db.User
+		require.NoError(t, database.Find(&users).Error)
+		require.Len(t, users, 1)
+		assert.Equal(t, realUser.ID, users[0].ID)
+
+		_, err := Seed(ctx, database, opts, now)
+		require.NoError(t, err)
+		var after []float64
+		require.NoError(t, database.Model(&db.Run{}).Order("created_at ASC, co2_kg ASC").Pluck("co2_kg", &after).Error)
+		assert.Equal(t, before, after)
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := Seed(ctx, setupTestDB(t), Options{Users: 1, ReposPerUser: 1, RunsPerDay: 0, Days: 30}, now)
+		assert.Error(t, err)
+	})
+}
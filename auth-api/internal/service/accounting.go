@@ -0,0 +1,111 @@
+package service
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// AccountingLocation and AccountingMarket are the supported emissions accounting methods.
+// Location-based emissions use the carbon intensity of the grid the runs consumed, as
+// stored with every run; market-based emissions subtract the renewable energy purchases of
+// the organizations owning the repositories.
+const (
+	AccountingLocation = "location"
+	AccountingMarket   = "market"
+)
+
+// IsValidAccountingMethod reports whether method is a supported accounting method
+func IsValidAccountingMethod(method string) bool {
+	return method == AccountingLocation || method == AccountingMarket
+}
+
+// ApplyAccountingMethod reports the CO2 of summary, aggregated over scope, with method. The
+// location-based CO2 is kept as LocationBasedCO2Kg when it differs. Comparisons with a
+// previous period use the method of the current one.
+func (s *StatsService) ApplyAccountingMethod(scope RunScope, summary *PeriodSummary, method string) error {
+	summary.Method = method
+	if method != AccountingMarket {
+		return nil
+	}
+
+	location := summary.TotalCO2Kg
+	if summary.LocationBasedCO2Kg != nil {
+		location = *summary.LocationBasedCO2Kg
+	}
+	market, err := s.marketBasedCO2(scope, summary)
+	if err != nil {
+		return fmt.Errorf("failed to compute market-based emissions: %w", err)
+	}
+	summary.TotalCO2Kg = market
+	summary.LocationBasedCO2Kg = &location
+	return nil
+}
+
+// marketBasedCO2 sums the CO2 of the runs in scope over the period of summary by
+// organization, less the share of the energy of each organization over the period its
+// renewable energy purchases match. Runs of repositories without an organization, or of
+// organizations without purchases, count with their location-based CO2.
+func (s *StatsService) marketBasedCO2(scope RunScope, summary *PeriodSummary) (float64, error) {
+	var totals []struct {
+		OrganizationID *uuid.UUID
+		CO2Kg          float64
+	}
+	err := s.db.Model(&db.Run{}).
+		Select("repositories.organization_id AS organization_id, COALESCE(SUM(runs.co2_kg), 0) AS co2_kg").
+		Joins("JOIN repositories ON repositories.id = runs.repository_id").
+		Scopes(scope).
+		Where(summary.rangeCondition, summary.From, summary.To).
+		Group("repositories.organization_id").
+		Scan(&totals).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum emissions by organization: %w", err)
+	}
+
+	var market float64
+	for _, total := range totals {
+		if total.OrganizationID == nil {
+			market += total.CO2Kg
+			continue
+		}
+		share, err := s.renewableShare(*total.OrganizationID, summary)
+		if err != nil {
+			return 0, err
+		}
+		market += total.CO2Kg * (1 - share)
+	}
+	return market, nil
+}
+
+// renewableShare returns the share of the energy an organization used over the period of
+// summary that its renewable energy purchases match, counting purchases that only partly
+// overlap the period in proportion to the overlap
+func (s *StatsService) renewableShare(orgID uuid.UUID, summary *PeriodSummary) (float64, error) {
+	var purchases []db.CarbonOffset
+	err := s.db.Where("organization_id = ? AND kind = ?", orgID, db.CarbonOffsetKindRenewable).Find(&purchases).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to get renewable energy purchases: %w", err)
+	}
+
+	var matchedKWh float64
+	for _, purchase := range purchases {
+		if purchase.EnergyKWh != nil {
+			matchedKWh += *purchase.EnergyKWh * periodShare(purchase.PeriodStart, purchase.PeriodEnd, summary.From, summary.To)
+		}
+	}
+	if matchedKWh == 0 {
+		return 0, nil
+	}
+
+	used, err := s.summarize(OrganizationRuns(orgID), summary.From, summary.To, summary.rangeCondition)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get organization energy: %w", err)
+	}
+	if used.TotalEnergyKWh <= 0 {
+		return 0, nil
+	}
+	return math.Min(matchedKWh/used.TotalEnergyKWh, 1), nil
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/filter"
+)
+
+// MetadataGroupPrefix prefixes groupings by a key of the run metadata, such as
+// metadata.runner_os
+const MetadataGroupPrefix = "metadata."
+
+// metadataKeyPattern matches the metadata keys runs can be grouped by. Keys are part of the
+// SQL of the grouping, so they are limited to letters, digits and underscores.
+var metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_]{1,64}$`)
+
+// IsValidGroupBy reports whether groupBy is a supported run grouping
+func IsValidGroupBy(groupBy string) bool {
+	switch groupBy {
+	case "workflow_name", "workflow_run_group", "branch", "environment", "ci_provider", "tag":
+		return true
+	}
+	if key, ok := strings.CutPrefix(groupBy, MetadataGroupPrefix); ok {
+		return metadataKeyPattern.MatchString(key)
+	}
+	return false
+}
+
+// groupByExpression returns the SQL expression of a run grouping. ci_provider and tag
+// are read from the run metadata submitted by the CI integration, as are metadata groupings.
+func groupByExpression(dialect db.Dialect, groupBy string) string {
+	if key, ok := strings.CutPrefix(groupBy, MetadataGroupPrefix); ok {
+		return dialect.JSONText("runs.run_metadata", key)
+	}
+	switch groupBy {
+	case "branch":
+		return "runs.branch_name"
+	case "workflow_run_group":
+		return "runs.workflow_run_group"
+	case "environment":
+		return "runs.environment"
+	case "ci_provider":
+		return dialect.JSONText("runs.run_metadata", "ci_provider")
+	case "tag":
+		return dialect.JSONText("runs.run_metadata", "tag")
+	default:
+		return "runs.workflow_name"
+	}
+}
+
+// AggregateQuery describes a grouped aggregation request
+type AggregateQuery struct {
+	GroupBy string
+	Metric  string
+	From    time.Time
+	To      time.Time
+	// Filter restricts the runs aggregated, all runs in scope when nil
+	Filter *filter.Expr
+}
+
+// GroupAggregate represents the aggregate of a metric for one group of runs. Key is nil
+// for runs without a value for the grouping.
+type GroupAggregate struct {
+	Key   *string `json:"key"`
+	Count int64   `json:"count"`
+	Sum   float64 `json:"sum"`
+	Avg   float64 `json:"avg"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+}
+
+// Aggregate groups the runs in scope created between From and To and aggregates the metric
+// per group, ordered by sum descending
+func (s *StatsService) Aggregate(scope RunScope, q AggregateQuery) ([]GroupAggregate, error) {
+	column, ok := statsMetrics[q.Metric]
+	if !ok {
+		return nil, fmt.Errorf("unsupported metric: %s", q.Metric)
+	}
+	if !IsValidGroupBy(q.GroupBy) {
+		return nil, fmt.Errorf("unsupported grouping: %s", q.GroupBy)
+	}
+
+	groupExpr := groupByExpression(db.DialectOf(s.db), q.GroupBy)
+	rows, err := s.db.Model(&db.Run{}).
+		Select(groupExpr+" as group_key, "+
+			"COUNT(runs.id) as count, "+
+			"COALESCE(SUM(runs."+column+"), 0) as sum, "+
+			"COALESCE(AVG(runs."+column+"), 0) as avg, "+
+			"COALESCE(MIN(runs."+column+"), 0) as min, "+
+			"COALESCE(MAX(runs."+column+"), 0) as max").
+		Scopes(scope, RunsMatching(q.Filter)).
+		Where("runs.created_at >= ? AND runs.created_at <= ?", q.From, q.To).
+		Group(groupExpr).
+		Order("sum DESC").
+		Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute aggregate query: %w", err)
+	}
+	defer rows.Close()
+
+	groups := []GroupAggregate{}
+	for rows.Next() {
+		var group GroupAggregate
+		if err := rows.Scan(&group.Key, &group.Count, &group.Sum, &group.Avg, &group.Min, &group.Max); err != nil {
+			return nil, fmt.Errorf("failed to scan aggregate: %w", err)
+		}
+		groups = append(groups, group)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read aggregates: %w", err)
+	}
+
+	return groups, nil
+}
@@ -0,0 +1,352 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// Alert rule scopes
+const (
+	AlertScopeRepository   = "repository"
+	AlertScopeOrganization = "organization"
+	AlertScopeUser         = "user"
+)
+
+// Alert rule aggregations of a metric over the window
+const (
+	AlertAggregationSum = "sum"
+	AlertAggregationAvg = "avg"
+)
+
+// Alert rule comparisons. increase_percent compares the window with the window before it.
+const (
+	AlertComparisonAbove           = "above"
+	AlertComparisonBelow           = "below"
+	AlertComparisonIncreasePercent = "increase_percent"
+)
+
+// AlertChannelEmail delivers alerts to the rule owner by email; the other channels are the
+// chat integrations of the scope's organization
+const AlertChannelEmail = "email"
+
+var (
+	// AlertScopes lists the supported alert rule scopes
+	AlertScopes = []string{AlertScopeRepository, AlertScopeOrganization, AlertScopeUser}
+	// AlertMetrics lists the metrics alert rules can watch
+	AlertMetrics = []string{"co2_kg", "energy_kwh", "duration_s", "run_count"}
+	// AlertAggregations lists how a metric is aggregated over the window
+	AlertAggregations = []string{AlertAggregationSum, AlertAggregationAvg}
+	// AlertComparisons lists how the aggregated value is compared with the threshold
+	AlertComparisons = []string{AlertComparisonAbove, AlertComparisonBelow, AlertComparisonIncreasePercent}
+	// AlertChannels lists where alerts can be delivered
+	AlertChannels = append([]string{AlertChannelEmail}, NotificationProviders...)
+)
+
+// alertWindows maps the supported rolling windows to their length
+var alertWindows = map[string]time.Duration{
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+}
+
+// AlertWindows lists the supported rolling windows
+var AlertWindows = []string{"day", "week", "month"}
+
+// AlertWindowDuration returns the length of a rolling window
+func AlertWindowDuration(window string) time.Duration {
+	return alertWindows[window]
+}
+
+// AlertService handles alert rules and their evaluation
+type AlertService struct {
+	db    *gorm.DB
+	stats *StatsService
+}
+
+// NewAlertService creates a new alert service
+func NewAlertService(database *gorm.DB) *AlertService {
+	return &AlertService{
+		db:    database,
+		stats: NewStatsService(database),
+	}
+}
+
+// AlertRuleRequest represents an alert rule as created or replaced by its owner. The scope
+// target is RepositoryID for repository rules and the organization login for organization
+// rules; user rules watch the owner's own runs.
+type AlertRuleRequest struct {
+	Name         string     `json:"name" binding:"required,max=255"`
+	Scope        string     `json:"scope" binding:"required"`
+	RepositoryID *uuid.UUID `json:"repository_id,omitempty"`
+	Organization *string    `json:"organization,omitempty"`
+	Metric       string     `json:"metric" binding:"required"`
+	Aggregation  string     `json:"aggregation,omitempty"`
+	Comparison   string     `json:"comparison" binding:"required"`
+	Threshold    *float64   `json:"threshold" binding:"required,gte=0"`
+	Window       string     `json:"window" binding:"required"`
+	Channel      string     `json:"channel" binding:"required"`
+	// Chat channel for Slack bot integrations; the integration default when omitted
+	Destination *string `json:"destination,omitempty"`
+	Enabled     *bool   `json:"enabled,omitempty"`
+}
+
+// ValidateAlertRule checks the enumerated fields of req and fills in defaults
+func ValidateAlertRule(req *AlertRuleRequest) error {
+	if req.Aggregation == "" {
+		req.Aggregation = AlertAggregationSum
+	}
+
+	switch {
+	case !contains(AlertScopes, req.Scope):
+		return fmt.Errorf("scope must be one of %v", AlertScopes)
+	case req.Scope == AlertScopeRepository && req.RepositoryID == nil:
+		return fmt.Errorf("repository_id is required for repository rules")
+	case req.Scope == AlertScopeOrganization && req.Organization == nil:
+		return fmt.Errorf("organization is required for organization rules")
+	case !contains(AlertMetrics, req.Metric):
+		return fmt.Errorf("metric must be one of %v", AlertMetrics)
+	case !contains(AlertAggregations, req.Aggregation):
+		return fmt.Errorf("aggregation must be one of %v", AlertAggregations)
+	case req.Metric == "run_count" && req.Aggregation != AlertAggregationSum:
+		return fmt.Errorf("run_count only supports the sum aggregation")
+	case !contains(AlertComparisons, req.Comparison):
+		return fmt.Errorf("comparison must be one of %v", AlertComparisons)
+	case !contains(AlertWindows, req.Window):
+		return fmt.Errorf("window must be one of %v", AlertWindows)
+	case !contains(AlertChannels, req.Channel):
+		return fmt.Errorf("channel must be one of %v", AlertChannels)
+	case req.Scope == AlertScopeUser && req.Channel != AlertChannelEmail:
+		return fmt.Errorf("rules on your own runs can only be delivered by email")
+	}
+	return nil
+}
+
+// CreateRule creates an alert rule owned by userID. orgID is the resolved organization of
+// organization rules.
+func (s *AlertService) CreateRule(userID uuid.UUID, req *AlertRuleRequest, orgID *uuid.UUID) (*db.AlertRule, error) {
+	rule := db.AlertRule{UserID: userID, Enabled: true}
+	applyAlertRule(&rule, req, orgID)
+
+	if err := s.db.Create(&rule).Error; err != nil {
+		return nil, fmt.Errorf("failed to create alert rule: %w", err)
+	}
+	return &rule, nil
+}
+
+// UpdateRule replaces the definition of an alert rule. Changing the definition resets its
+// evaluation state.
+func (s *AlertService) UpdateRule(rule *db.AlertRule, req *AlertRuleRequest, orgID *uuid.UUID) (*db.AlertRule, error) {
+	applyAlertRule(rule, req, orgID)
+	rule.LastValue = nil
+	rule.LastEvaluatedAt = nil
+	rule.LastTriggeredAt = nil
+
+	if err := s.db.Save(rule).Error; err != nil {
+		return nil, fmt.Errorf("failed to update alert rule: %w", err)
+	}
+	return rule, nil
+}
+
+// applyAlertRule copies a validated request onto rule
+func applyAlertRule(rule *db.AlertRule, req *AlertRuleRequest, orgID *uuid.UUID) {
+	rule.Name = req.Name
+	rule.Scope = req.Scope
+	rule.RepositoryID = nil
+	rule.OrganizationID = nil
+	switch req.Scope {
+	case AlertScopeRepository:
+		rule.RepositoryID = req.RepositoryID
+	case AlertScopeOrganization:
+		rule.OrganizationID = orgID
+	}
+	rule.Metric = req.Metric
+	rule.Aggregation = req.Aggregation
+	rule.Comparison = req.Comparison
+	rule.Threshold = *req.Threshold
+	rule.Window = req.Window
+	rule.Channel = req.Channel
+	rule.Destination = req.Destination
+	if req.Enabled != nil {
+		rule.Enabled = *req.Enabled
+	}
+}
+
+// ListRules retrieves the alert rules of a user
+func (s *AlertService) ListRules(userID uuid.UUID) ([]db.AlertRule, error) {
+	rules := []db.AlertRule{}
+	if err := s.db.Where("user_id = ?", userID).Order("created_at ASC").Find(&rules).Error; err != nil {
+		return nil, fmt.Errorf("failed to list alert rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+// ListEnabledRules retrieves every enabled alert rule
+func (s *AlertService) ListEnabledRules() ([]db.AlertRule, error) {
+	var rules []db.AlertRule
+	if err := s.db.Where("enabled = ?", true).Order("created_at ASC").Find(&rules).Error; err != nil {
+		return nil, fmt.Errorf("failed to list alert rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+// GetRule retrieves an alert rule by ID
+func (s *AlertService) GetRule(ruleID uuid.UUID) (*db.AlertRule, error) {
+	var rule db.AlertRule
+	if err := s.db.First(&rule, "id = ?", ruleID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("alert rule not found")
+		}
+		return nil, fmt.Errorf("failed to get alert rule: %w", err)
+	}
+
+	return &rule, nil
+}
+
+// DeleteRule removes an alert rule
+func (s *AlertService) DeleteRule(ruleID uuid.UUID) error {
+	result := s.db.Where("id = ?", ruleID).Delete(&db.AlertRule{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete alert rule: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("alert rule not found")
+	}
+	return nil
+}
+
+// AlertEvaluation is the outcome of evaluating an alert rule over the window ending at To.
+// Previous and ChangePercent are only set for increase_percent rules; ChangePercent is nil
+// when the previous window is zero.
+type AlertEvaluation struct {
+	From          time.Time `json:"from"`
+	To            time.Time `json:"to"`
+	Value         float64   `json:"value"`
+	Previous      *float64  `json:"previous,omitempty"`
+	ChangePercent *float64  `json:"change_percent,omitempty"`
+	Breached      bool      `json:"breached"`
+}
+
+// Evaluate computes the metric of rule over the window ending at now and whether it
+// breaches the threshold
+func (s *AlertService) Evaluate(rule *db.AlertRule, now time.Time) (*AlertEvaluation, error) {
+	scope := alertRuleRuns(rule)
+	length := AlertWindowDuration(rule.Window)
+	from := now.Add(-length)
+
+	current, err := s.stats.summarize(scope, from, now, "runs.created_at > ? AND runs.created_at <= ?")
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate alert rule: %w", err)
+	}
+	evaluation := &AlertEvaluation{From: from, To: now, Value: alertMetricValue(rule, current)}
+
+	switch rule.Comparison {
+	case AlertComparisonAbove:
+		evaluation.Breached = evaluation.Value > rule.Threshold
+	case AlertComparisonBelow:
+		evaluation.Breached = evaluation.Value < rule.Threshold
+	case AlertComparisonIncreasePercent:
+		previous, err := s.stats.summarize(scope, from.Add(-length), from, "runs.created_at > ? AND runs.created_at <= ?")
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate alert rule: %w", err)
+		}
+		change := newMetricChange(alertMetricValue(rule, previous), evaluation.Value)
+		evaluation.Previous = &change.Previous
+		evaluation.ChangePercent = change.Percent
+		evaluation.Breached = change.Percent != nil && *change.Percent > rule.Threshold
+	}
+
+	return evaluation, nil
+}
+
+// alertRuleRuns returns the runs an alert rule watches
+func alertRuleRuns(rule *db.AlertRule) RunScope {
+	switch {
+	case rule.RepositoryID != nil:
+		return RepositoryRuns(*rule.RepositoryID)
+	case rule.OrganizationID != nil:
+		return OrganizationRuns(*rule.OrganizationID)
+	default:
+		return UserRuns(rule.UserID)
+	}
+}
+
+// alertMetricValue aggregates the metric of rule from a period summary; averages over a
+// period without runs are zero
+func alertMetricValue(rule *db.AlertRule, summary *PeriodSummary) float64 {
+	var total float64
+	switch rule.Metric {
+	case "co2_kg":
+		total = summary.TotalCO2Kg
+	case "energy_kwh":
+		total = summary.TotalEnergyKWh
+	case "duration_s":
+		total = summary.TotalDurationS
+	case "run_count":
+		return float64(summary.RunCount)
+	}
+
+	if rule.Aggregation == AlertAggregationAvg {
+		if summary.RunCount == 0 {
+			return 0
+		}
+		return total / float64(summary.RunCount)
+	}
+	return total
+}
+
+// RecordEvaluation stores the outcome of an evaluation; triggered marks the rule as
+// delivered at evaluation.To
+func (s *AlertService) RecordEvaluation(rule *db.AlertRule, evaluation *AlertEvaluation, triggered bool) error {
+	updates := map[string]interface{}{
+		"last_value":        evaluation.Value,
+		"last_evaluated_at": evaluation.To,
+	}
+	if triggered {
+		updates["last_triggered_at"] = evaluation.To
+	}
+
+	if err := s.db.Model(rule).UpdateColumns(updates).Error; err != nil {
+		return fmt.Errorf("failed to record alert evaluation: %w", err)
+	}
+	return nil
+}
+
+// InCooldown reports whether rule was triggered within the last window, so a lasting
+// breach is delivered once per window rather than on every evaluation
+func InCooldown(rule *db.AlertRule, now time.Time) bool {
+	return rule.LastTriggeredAt != nil && now.Sub(*rule.LastTriggeredAt) < AlertWindowDuration(rule.Window)
+}
+
+// AlertTarget describes what an alert rule watches, for messages and chat delivery
+type AlertTarget struct {
+	Name           string
+	Link           string
+	OrganizationID *uuid.UUID
+}
+
+// Target resolves the name, link and organization of the runs an alert rule watches
+func (s *AlertService) Target(rule *db.AlertRule) (*AlertTarget, error) {
+	switch rule.Scope {
+	case AlertScopeRepository:
+		var repo db.Repository
+		if err := s.db.First(&repo, "id = ?", rule.RepositoryID).Error; err != nil {
+			return nil, fmt.Errorf("failed to get repository: %w", err)
+		}
+		return &AlertTarget{Name: repo.FullName, Link: repo.HTMLURL, OrganizationID: repo.OrganizationID}, nil
+	case AlertScopeOrganization:
+		var org db.Organization
+		if err := s.db.First(&org, "id = ?", rule.OrganizationID).Error; err != nil {
+			return nil, fmt.Errorf("failed to get organization: %w", err)
+		}
+		return &AlertTarget{Name: org.GitHubLogin, Link: "https://github.com/" + org.GitHubLogin, OrganizationID: &org.ID}, nil
+	default:
+		return &AlertTarget{Name: "your runs"}, nil
+	}
+}
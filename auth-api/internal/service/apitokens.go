@@ -0,0 +1,126 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// apiTokenUsageInterval bounds how often the last use of a token is written, so busy CI
+// clients do not update it on every request; a new source IP is always recorded
+const apiTokenUsageInterval = time.Minute
+
+// ErrAPITokenRevoked is returned for API tokens that were deleted
+var ErrAPITokenRevoked = errors.New("API token revoked")
+
+// ErrAPITokenExpired is returned for API tokens past their expiry
+var ErrAPITokenExpired = errors.New("API token expired")
+
+// MaxAPITokenLifetime bounds how long a new API token stays valid, so a leaked token does not
+// grant access forever
+const MaxAPITokenLifetime = 365 * 24 * time.Hour
+
+// APITokenRequest creates an API token, which expires after MaxAPITokenLifetime without
+// expires_at
+type APITokenRequest struct {
+	Name      string     `json:"name" binding:"required,max=100" example:"GitHub Actions"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty" example:"2025-01-01T00:00:00Z"`
+}
+
+// NormalizeAPITokenRequest checks that the expiry of req lies after now and at most
+// MaxAPITokenLifetime later, defaulting it to the longest one
+func NormalizeAPITokenRequest(req *APITokenRequest, now time.Time) error {
+	latest := now.Add(MaxAPITokenLifetime)
+	if req.ExpiresAt == nil {
+		req.ExpiresAt = &latest
+		return nil
+	}
+	if !req.ExpiresAt.After(now) {
+		return fmt.Errorf("expires_at must be in the future")
+	}
+	if req.ExpiresAt.After(latest) {
+		return fmt.Errorf("expires_at must be at most %d days in the future", int(MaxAPITokenLifetime.Hours()/24))
+	}
+	return nil
+}
+
+// CreatedAPIToken is a new API token with its JWT, which is only returned once
+type CreatedAPIToken struct {
+	db.APIToken
+	Token string `json:"token"`
+}
+
+// CreateAPIToken records a new API token of a user from a validated req
+func (s *UserService) CreateAPIToken(userID uuid.UUID, req *APITokenRequest) (*db.APIToken, error) {
+	token := db.APIToken{UserID: userID, Name: req.Name}
+	if req.ExpiresAt != nil {
+		expiresAt := req.ExpiresAt.UTC()
+		token.ExpiresAt = &expiresAt
+	}
+	if err := s.db.Create(&token).Error; err != nil {
+		return nil, fmt.Errorf("failed to create API token: %w", err)
+	}
+	return &token, nil
+}
+
+// ListAPITokens retrieves the API tokens of a user, newest first
+func (s *UserService) ListAPITokens(userID uuid.UUID) ([]db.APIToken, error) {
+	tokens := []db.APIToken{}
+	if err := s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error; err != nil {
+		return nil, fmt.Errorf("failed to list API tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+// GetAPIToken retrieves an API token by ID
+func (s *UserService) GetAPIToken(tokenID uuid.UUID) (*db.APIToken, error) {
+	var token db.APIToken
+	if err := s.db.First(&token, "id = ?", tokenID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("API token not found")
+		}
+		return nil, fmt.Errorf("failed to get API token: %w", err)
+	}
+	return &token, nil
+}
+
+// DeleteAPIToken removes an API token, revoking it immediately
+func (s *UserService) DeleteAPIToken(tokenID uuid.UUID) error {
+	if err := s.db.Where("id = ?", tokenID).Delete(&db.APIToken{}).Error; err != nil {
+		return fmt.Errorf("failed to delete API token: %w", err)
+	}
+	return nil
+}
+
+// UseAPIToken checks that the API token tokenID of a user is still valid at now and records
+// its use from clientIP. Deleted tokens return ErrAPITokenRevoked and expired ones
+// ErrAPITokenExpired.
+func (s *UserService) UseAPIToken(userID, tokenID uuid.UUID, clientIP string, now time.Time) error {
+	var token db.APIToken
+	err := s.db.Where("id = ? AND user_id = ?", tokenID, userID).First(&token).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrAPITokenRevoked
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get API token: %w", err)
+	}
+	if token.ExpiresAt != nil && !now.Before(*token.ExpiresAt) {
+		return ErrAPITokenExpired
+	}
+
+	if token.LastUsedAt != nil && now.Sub(*token.LastUsedAt) < apiTokenUsageInterval &&
+		token.LastUsedIP != nil && *token.LastUsedIP == clientIP {
+		return nil
+	}
+	err = s.db.Model(&db.APIToken{}).Where("id = ?", tokenID).
+		UpdateColumns(map[string]interface{}{"last_used_at": now, "last_used_ip": clientIP}).Error
+	if err != nil {
+		return fmt.Errorf("failed to record API token use: %w", err)
+	}
+	return nil
+}
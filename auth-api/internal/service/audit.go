@@ -0,0 +1,107 @@
+package service
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// AuditFilter narrows the events returned by ListEvents; empty fields do not filter
+type AuditFilter struct {
+	// Actor matches the GitHub username of the actor, case-insensitively
+	Actor          string
+	Action         string
+	ResourceType   string
+	ResourceID     string
+	OrganizationID *uuid.UUID
+	From           *time.Time
+	To             *time.Time
+}
+
+// AuditService records and queries the audit log
+type AuditService struct {
+	db *gorm.DB
+}
+
+// NewAuditService creates a new audit service
+func NewAuditService(database *gorm.DB) *AuditService {
+	return &AuditService{
+		db: database,
+	}
+}
+
+// Record stores an audit event
+func (s *AuditService) Record(event *db.AuditEvent) error {
+	if err := s.db.Create(event).Error; err != nil {
+		return fmt.Errorf("failed to record audit event: %w", err)
+	}
+	return nil
+}
+
+// ListEvents retrieves the audit events matching filter, newest first
+func (s *AuditService) ListEvents(filter AuditFilter, limit, offset int) ([]db.AuditEvent, int64, error) {
+	query := s.db.Model(&db.AuditEvent{})
+	if filter.Actor != "" {
+		query = query.Where("LOWER(actor_username) = ?", strings.ToLower(filter.Actor))
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.ResourceType != "" {
+		query = query.Where("resource_type = ?", filter.ResourceType)
+	}
+	if filter.ResourceID != "" {
+		query = query.Where("resource_id = ?", filter.ResourceID)
+	}
+	if filter.OrganizationID != nil {
+		query = query.Where("organization_id = ?", *filter.OrganizationID)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at <= ?", *filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit events: %w", err)
+	}
+
+	var events []db.AuditEvent
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&events).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list audit events: %w", err)
+	}
+
+	return events, total, nil
+}
+
+// AuditDiff returns the fields whose values differ between before and after, each mapped to
+// its "from" and "to" values. Fields missing from before (a create) only have "to", and
+// fields missing from after (a delete) only have "from".
+func AuditDiff(before, after map[string]interface{}) db.JSONB {
+	changes := db.JSONB{}
+	for field, from := range before {
+		to, ok := after[field]
+		if !ok {
+			changes[field] = map[string]interface{}{"from": from}
+		} else if !reflect.DeepEqual(from, to) {
+			changes[field] = map[string]interface{}{"from": from, "to": to}
+		}
+	}
+	for field, to := range after {
+		if _, ok := before[field]; !ok {
+			changes[field] = map[string]interface{}{"to": to}
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	return changes
+}
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// MinBenchmarkPeers is the smallest cohort a repository is compared against, so that
+// aggregates never describe a single identifiable repository
+const MinBenchmarkPeers = 5
+
+// Benchmark statuses
+const (
+	BenchmarkStatusOK                = "ok"
+	BenchmarkStatusNotOptedIn        = "not_opted_in"
+	BenchmarkStatusNoRuns            = "no_runs"
+	BenchmarkStatusInsufficientPeers = "insufficient_peers"
+)
+
+// BenchmarkCohort describes the peer group a repository was compared with; empty fields
+// were not used to select peers
+type BenchmarkCohort struct {
+	Language string `json:"language,omitempty"`
+	Size     string `json:"size,omitempty"`
+	RunCount string `json:"run_count,omitempty"`
+}
+
+// Benchmark compares a repository's CO2 per build minute with anonymized peer aggregates.
+// PercentileScore is the share of peers that emit more per build minute (higher is better).
+type Benchmark struct {
+	Status              string           `json:"status"`
+	CO2KgPerBuildMinute float64          `json:"co2_kg_per_build_minute"`
+	Cohort              *BenchmarkCohort `json:"cohort,omitempty"`
+	PeerCount           int              `json:"peer_count"`
+	PeerMedian          *float64         `json:"peer_median_co2_kg_per_build_minute,omitempty"`
+	PeerP25             *float64         `json:"peer_p25_co2_kg_per_build_minute,omitempty"`
+	PeerP75             *float64         `json:"peer_p75_co2_kg_per_build_minute,omitempty"`
+	PercentileScore     *float64         `json:"percentile_score,omitempty"`
+}
+
+// benchmarkEntry is the CO2 rate and cohort attributes of one opted-in repository
+type benchmarkEntry struct {
+	language string
+	size     string
+	runCount string
+	rate     float64
+}
+
+// sizeBucket groups repository sizes on a log scale
+func sizeBucket(sizeKB *int64) string {
+	switch {
+	case sizeKB == nil:
+		return "unknown"
+	case *sizeKB < 10*1024:
+		return "small"
+	case *sizeKB < 100*1024:
+		return "medium"
+	case *sizeKB < 1024*1024:
+		return "large"
+	default:
+		return "xlarge"
+	}
+}
+
+// runCountBucket groups run counts on a log scale
+func runCountBucket(runs int64) string {
+	switch {
+	case runs <= 10:
+		return "1-10"
+	case runs <= 100:
+		return "11-100"
+	case runs <= 1000:
+		return "101-1000"
+	default:
+		return ">1000"
+	}
+}
+
+// Benchmark compares repo with the other opted-in repositories over the runs between from
+// and to. Peers are matched on language, size and run count; when that cohort is too small
+// the size and then the language criteria are dropped.
+func (s *StatsService) Benchmark(repo *db.Repository, from, to time.Time) (*Benchmark, error) {
+	if !repo.BenchmarkOptIn {
+		return &Benchmark{Status: BenchmarkStatusNotOptedIn}, nil
+	}
+
+	rows, err := s.db.Table("repositories r").
+		Select(`r.id, r.language, r.size_kb,
+			COUNT(runs.id) as run_count,
+			SUM(runs.co2_kg) as total_co2_kg,
+			SUM(runs.duration_s) as total_duration_s`).
+		Joins("JOIN runs ON runs.repository_id = r.id AND runs.deleted_at IS NULL").
+		Where("r.benchmark_opt_in = ?", true).
+		Where("runs.created_at >= ? AND runs.created_at <= ?", from, to).
+		Group("r.id, r.language, r.size_kb").
+		Having("SUM(runs.duration_s) > 0").
+		Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to query benchmark peers: %w", err)
+	}
+	defer rows.Close()
+
+	var self *benchmarkEntry
+	var peers []benchmarkEntry
+	for rows.Next() {
+		var id uuid.UUID
+		var language *string
+		var sizeKB *int64
+		var runCount int64
+		var totalCO2, totalDuration float64
+		if err := rows.Scan(&id, &language, &sizeKB, &runCount, &totalCO2, &totalDuration); err != nil {
+			return nil, fmt.Errorf("failed to scan benchmark peer: %w", err)
+		}
+
+		entry := benchmarkEntry{
+			size:     sizeBucket(sizeKB),
+			runCount: runCountBucket(runCount),
+			rate:     totalCO2 / (totalDuration / 60),
+		}
+		if language != nil {
+			entry.language = *language
+		}
+
+		if id == repo.ID {
+			e := entry
+			self = &e
+			continue
+		}
+		peers = append(peers, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read benchmark peers: %w", err)
+	}
+
+	if self == nil {
+		return &Benchmark{Status: BenchmarkStatusNoRuns}, nil
+	}
+
+	benchmark := &Benchmark{
+		Status:              BenchmarkStatusInsufficientPeers,
+		CO2KgPerBuildMinute: self.rate,
+	}
+
+	cohorts := []BenchmarkCohort{
+		{Language: self.language, Size: self.size, RunCount: self.runCount},
+		{Language: self.language, RunCount: self.runCount},
+		{RunCount: self.runCount},
+	}
+	for _, cohort := range cohorts {
+		if cohort.Language == "" && cohort != cohorts[len(cohorts)-1] {
+			// Repositories without a known language are only compared on run count
+			continue
+		}
+
+		var rates []float64
+		for _, peer := range peers {
+			if (cohort.Language == "" || peer.language == cohort.Language) &&
+				(cohort.Size == "" || peer.size == cohort.Size) &&
+				peer.runCount == cohort.RunCount {
+				rates = append(rates, peer.rate)
+			}
+		}
+		if len(rates) < MinBenchmarkPeers {
+			continue
+		}
+
+		sort.Float64s(rates)
+		var worse float64
+		for _, rate := range rates {
+			switch {
+			case rate > self.rate:
+				worse++
+			case rate == self.rate:
+				worse += 0.5
+			}
+		}
+		score := worse / float64(len(rates)) * 100
+		median := percentileCont(rates, 0.5)
+		p25 := percentileCont(rates, 0.25)
+		p75 := percentileCont(rates, 0.75)
+
+		c := cohort
+		benchmark.Status = BenchmarkStatusOK
+		benchmark.Cohort = &c
+		benchmark.PeerCount = len(rates)
+		benchmark.PeerMedian = &median
+		benchmark.PeerP25 = &p25
+		benchmark.PeerP75 = &p75
+		benchmark.PercentileScore = &score
+		break
+	}
+
+	return benchmark, nil
+}
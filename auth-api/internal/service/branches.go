@@ -0,0 +1,81 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// BranchSummary aggregates the runs of one branch
+type BranchSummary struct {
+	Branch         string  `json:"branch"`
+	RunCount       int64   `json:"run_count"`
+	TotalCO2Kg     float64 `json:"total_co2_kg"`
+	AvgCO2Kg       float64 `json:"avg_co2_kg"`
+	AvgEnergyKWh   float64 `json:"avg_energy_kwh"`
+	AvgDurationS   float64 `json:"avg_duration_s"`
+	TotalDurationS float64 `json:"total_duration_s"`
+}
+
+// BranchComparison compares the runs of a head branch with those of a base branch over the
+// same period. Changes go from base to head, per run except for run_count and total_co2_kg.
+type BranchComparison struct {
+	From    time.Time               `json:"from"`
+	To      time.Time               `json:"to"`
+	Base    BranchSummary           `json:"base"`
+	Head    BranchSummary           `json:"head"`
+	Changes map[string]MetricChange `json:"changes"`
+}
+
+// CompareBranches compares the runs in scope of head with those of base created between from
+// and to (inclusive)
+func (s *StatsService) CompareBranches(scope RunScope, base, head string, from, to time.Time) (*BranchComparison, error) {
+	baseSummary, err := s.summarizeBranch(scope, base, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize base branch: %w", err)
+	}
+	headSummary, err := s.summarizeBranch(scope, head, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize head branch: %w", err)
+	}
+
+	return &BranchComparison{
+		From: from,
+		To:   to,
+		Base: *baseSummary,
+		Head: *headSummary,
+		Changes: map[string]MetricChange{
+			"co2_kg_per_run":     newMetricChange(baseSummary.AvgCO2Kg, headSummary.AvgCO2Kg),
+			"energy_kwh_per_run": newMetricChange(baseSummary.AvgEnergyKWh, headSummary.AvgEnergyKWh),
+			"duration_s_per_run": newMetricChange(baseSummary.AvgDurationS, headSummary.AvgDurationS),
+			"run_count":          newMetricChange(float64(baseSummary.RunCount), float64(headSummary.RunCount)),
+			"total_co2_kg":       newMetricChange(baseSummary.TotalCO2Kg, headSummary.TotalCO2Kg),
+		},
+	}, nil
+}
+
+// summarizeBranch aggregates the runs in scope of branch created between from and to
+func (s *StatsService) summarizeBranch(scope RunScope, branch string, from, to time.Time) (*BranchSummary, error) {
+	branchScope := func(query *gorm.DB) *gorm.DB {
+		return scope(query).Where("runs.branch_name = ?", branch)
+	}
+	summary, err := s.summarize(branchScope, from, to, "runs.created_at >= ? AND runs.created_at <= ?")
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BranchSummary{
+		Branch:         branch,
+		RunCount:       summary.RunCount,
+		TotalCO2Kg:     summary.TotalCO2Kg,
+		TotalDurationS: summary.TotalDurationS,
+	}
+	if summary.RunCount > 0 {
+		count := float64(summary.RunCount)
+		result.AvgCO2Kg = summary.TotalCO2Kg / count
+		result.AvgEnergyKWh = summary.TotalEnergyKWh / count
+		result.AvgDurationS = summary.TotalDurationS / count
+	}
+	return result, nil
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// Budget statuses reported by forecasts and budget checks
+const (
+	BudgetStatusNone     = "no_budget"
+	BudgetStatusOnTrack  = "on_track"
+	BudgetStatusAtRisk   = "at_risk"
+	BudgetStatusExceeded = "exceeded"
+)
+
+// BudgetService handles repository carbon budgets
+type BudgetService struct {
+	db *gorm.DB
+}
+
+// NewBudgetService creates a new budget service
+func NewBudgetService(database *gorm.DB) *BudgetService {
+	return &BudgetService{
+		db: database,
+	}
+}
+
+// IsValidBudgetPeriod reports whether period is a supported budget period
+func IsValidBudgetPeriod(period string) bool {
+	return period == "month" || period == "quarter"
+}
+
+// PeriodBounds returns the start and end (exclusive) of the calendar month or quarter containing t (UTC)
+func PeriodBounds(t time.Time, period string) (time.Time, time.Time) {
+	t = t.UTC()
+	month := t.Month()
+	if period == "quarter" {
+		month = time.Month((int(month)-1)/3*3 + 1)
+		start := time.Date(t.Year(), month, 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 3, 0)
+	}
+	start := time.Date(t.Year(), month, 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 1, 0)
+}
+
+// ListBudgets retrieves the budgets of a repository
+func (s *BudgetService) ListBudgets(repoID uuid.UUID) ([]db.RepositoryBudget, error) {
+	budgets := []db.RepositoryBudget{}
+	if err := s.db.Where("repository_id = ?", repoID).Order("period ASC").Find(&budgets).Error; err != nil {
+		return nil, fmt.Errorf("failed to list budgets: %w", err)
+	}
+
+	return budgets, nil
+}
+
+// SetBudget creates or replaces the budget of a repository for a period
+func (s *BudgetService) SetBudget(repoID uuid.UUID, period string, co2KgLimit float64) (*db.RepositoryBudget, error) {
+	budget := db.RepositoryBudget{
+		RepositoryID: repoID,
+		Period:       period,
+		CO2KgLimit:   co2KgLimit,
+	}
+
+	err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "repository_id"}, {Name: "period"}},
+		DoUpdates: clause.AssignmentColumns([]string{"co2_kg_limit", "updated_at"}),
+	}).Create(&budget).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to save budget: %w", err)
+	}
+
+	if err := s.db.Where("repository_id = ? AND period = ?", repoID, period).First(&budget).Error; err != nil {
+		return nil, fmt.Errorf("failed to get budget: %w", err)
+	}
+	return &budget, nil
+}
+
+// DeleteBudget removes the budget of a repository for a period
+func (s *BudgetService) DeleteBudget(repoID uuid.UUID, period string) error {
+	result := s.db.Where("repository_id = ? AND period = ?", repoID, period).Delete(&db.RepositoryBudget{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete budget: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("budget not found")
+	}
+	return nil
+}
+
+// BudgetCrossing describes a budget exceeded in the period of a run
+type BudgetCrossing struct {
+	RepositoryID uuid.UUID `json:"repository_id"`
+	RunID        uuid.UUID `json:"run_id"`
+	Period       string    `json:"period"`
+	PeriodStart  time.Time `json:"period_start"`
+	PeriodEnd    time.Time `json:"period_end"`
+	CO2KgLimit   float64   `json:"co2_kg_limit"`
+	ActualCO2Kg  float64   `json:"actual_co2_kg"`
+}
+
+// CrossedBudgets returns the budgets of the run's repository that were within their limit
+// before run and exceeded with it, so each budget is reported once per period
+func (s *BudgetService) CrossedBudgets(run *db.Run) ([]BudgetCrossing, error) {
+	exceeded, err := s.ExceededBudgets(run)
+	if err != nil {
+		return nil, err
+	}
+
+	var crossings []BudgetCrossing
+	for _, crossing := range exceeded {
+		if crossing.ActualCO2Kg-run.CO2Kg <= crossing.CO2KgLimit {
+			crossings = append(crossings, crossing)
+		}
+	}
+	return crossings, nil
+}
+
+// ExceededBudgets returns the budgets of the run's repository whose period containing the
+// run is over its limit
+func (s *BudgetService) ExceededBudgets(run *db.Run) ([]BudgetCrossing, error) {
+	budgets, err := s.ListBudgets(run.RepositoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	var exceeded []BudgetCrossing
+	for _, budget := range budgets {
+		start, end := PeriodBounds(run.CreatedAt, budget.Period)
+
+		var actual float64
+		err := s.db.Model(&db.Run{}).
+			Select("COALESCE(SUM(runs.co2_kg), 0)").
+			Where("runs.repository_id = ? AND runs.created_at >= ? AND runs.created_at < ?", run.RepositoryID, start, end).
+			Row().Scan(&actual)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get period emissions: %w", err)
+		}
+
+		if actual <= budget.CO2KgLimit {
+			continue
+		}
+		exceeded = append(exceeded, BudgetCrossing{
+			RepositoryID: run.RepositoryID,
+			RunID:        run.ID,
+			Period:       budget.Period,
+			PeriodStart:  start,
+			PeriodEnd:    end,
+			CO2KgLimit:   budget.CO2KgLimit,
+			ActualCO2Kg:  actual,
+		})
+	}
+
+	return exceeded, nil
+}
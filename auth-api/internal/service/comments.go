@@ -0,0 +1,218 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// MaxCommentLength is the longest comment body in characters
+const MaxCommentLength = 5000
+
+// ErrCommentNotFound is returned for comments that do not exist on a run
+var ErrCommentNotFound = errors.New("comment not found")
+
+// ErrInvalidCommentParent is returned for replies to comments that are not a top-level
+// comment of the same run
+var ErrInvalidCommentParent = errors.New("parent_id must be a top-level comment of the run")
+
+// CommentRequest is a comment on a run, or a reply to one of its comments
+type CommentRequest struct {
+	Body     string     `json:"body" binding:"required" example:"This spike was the quarterly load test"`
+	ParentID *uuid.UUID `json:"parent_id,omitempty"`
+}
+
+// ValidateComment trims the body of req and checks that it is not empty or too long
+func ValidateComment(req *CommentRequest) error {
+	req.Body = strings.TrimSpace(req.Body)
+	switch {
+	case req.Body == "":
+		return fmt.Errorf("body must not be empty")
+	case utf8.RuneCountInString(req.Body) > MaxCommentLength:
+		return fmt.Errorf("body must be at most %d characters", MaxCommentLength)
+	}
+	return nil
+}
+
+// CommentAuthor is the user who wrote a comment
+type CommentAuthor struct {
+	ID             uuid.UUID `json:"id"`
+	GitHubUsername string    `json:"github_username"`
+	AvatarURL      *string   `json:"avatar_url"`
+}
+
+// Comment is a comment on a run with its author. Top-level comments carry their replies,
+// oldest first.
+type Comment struct {
+	ID       uuid.UUID     `json:"id"`
+	RunID    uuid.UUID     `json:"run_id"`
+	ParentID *uuid.UUID    `json:"parent_id"`
+	Author   CommentAuthor `json:"author"`
+	Body     string        `json:"body"`
+	// RunCreatedAt places the comment on charts of the data next to the run
+	RunCreatedAt time.Time `json:"run_created_at"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	Replies      []Comment `json:"replies,omitempty"`
+}
+
+// CommentService handles the comments on runs
+type CommentService struct {
+	db *gorm.DB
+}
+
+// NewCommentService creates a new comment service
+func NewCommentService(database *gorm.DB) *CommentService {
+	return &CommentService{db: database}
+}
+
+// CreateComment adds a comment by authorID to run, which must be validated first
+func (s *CommentService) CreateComment(run *db.Run, authorID uuid.UUID, req *CommentRequest) (*Comment, error) {
+	if req.ParentID != nil {
+		var parents int64
+		err := s.db.Model(&db.RunComment{}).
+			Where("id = ? AND run_id = ? AND parent_id IS NULL", *req.ParentID, run.ID).
+			Count(&parents).Error
+		if err != nil {
+			return nil, fmt.Errorf("failed to get parent comment: %w", err)
+		}
+		if parents == 0 {
+			return nil, ErrInvalidCommentParent
+		}
+	}
+
+	comment := db.RunComment{RunID: run.ID, ParentID: req.ParentID, AuthorID: authorID, Body: req.Body}
+	if err := s.db.Create(&comment).Error; err != nil {
+		return nil, fmt.Errorf("failed to create comment: %w", err)
+	}
+	if err := s.db.Preload("Author").First(&comment, "id = ?", comment.ID).Error; err != nil {
+		return nil, fmt.Errorf("failed to get comment: %w", err)
+	}
+	created := newComment(&comment, run.CreatedAt)
+	return &created, nil
+}
+
+// GetComment returns a comment of a run
+func (s *CommentService) GetComment(runID, commentID uuid.UUID) (*db.RunComment, error) {
+	var comment db.RunComment
+	err := s.db.Where("id = ? AND run_id = ?", commentID, runID).First(&comment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrCommentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get comment: %w", err)
+	}
+	return &comment, nil
+}
+
+// DeleteComment deletes a comment with its replies
+func (s *CommentService) DeleteComment(comment *db.RunComment) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("parent_id = ?", comment.ID).Delete(&db.RunComment{}).Error; err != nil {
+			return fmt.Errorf("failed to delete replies: %w", err)
+		}
+		if err := tx.Delete(comment).Error; err != nil {
+			return fmt.Errorf("failed to delete comment: %w", err)
+		}
+		return nil
+	})
+}
+
+// ListComments returns the threads of comments on a run, oldest first
+func (s *CommentService) ListComments(run *db.Run) ([]Comment, error) {
+	var comments []db.RunComment
+	err := s.db.Preload("Author").
+		Where("run_id = ?", run.ID).
+		Order("created_at, id").
+		Find(&comments).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list comments: %w", err)
+	}
+	return threadComments(comments, map[uuid.UUID]time.Time{run.ID: run.CreatedAt}), nil
+}
+
+// RepositoryComments returns the threads of comments on the runs of a repository created
+// between from and to (inclusive), in the order of their runs and then oldest first
+func (s *CommentService) RepositoryComments(repoID uuid.UUID, from, to time.Time) ([]Comment, error) {
+	var runs []db.Run
+	err := s.db.Select("id", "created_at").
+		Where("repository_id = ? AND created_at >= ? AND created_at <= ?", repoID, from, to).
+		Where("id IN (?)", s.db.Model(&db.RunComment{}).Select("run_id")).
+		Order("created_at").
+		Find(&runs).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list commented runs: %w", err)
+	}
+	if len(runs) == 0 {
+		return []Comment{}, nil
+	}
+
+	runIDs := make([]uuid.UUID, len(runs))
+	runCreatedAt := make(map[uuid.UUID]time.Time, len(runs))
+	for i, run := range runs {
+		runIDs[i] = run.ID
+		runCreatedAt[run.ID] = run.CreatedAt
+	}
+	var comments []db.RunComment
+	err = s.db.Preload("Author").
+		Where("run_id IN ?", runIDs).
+		Order("created_at, id").
+		Find(&comments).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list comments: %w", err)
+	}
+
+	threads := threadComments(comments, runCreatedAt)
+	order := make(map[uuid.UUID]int, len(runIDs))
+	for i, id := range runIDs {
+		order[id] = i
+	}
+	sort.SliceStable(threads, func(i, j int) bool {
+		return order[threads[i].RunID] < order[threads[j].RunID]
+	})
+	return threads, nil
+}
+
+// threadComments nests replies, which follow their parents when ordered by creation, under
+// the top-level comments
+func threadComments(comments []db.RunComment, runCreatedAt map[uuid.UUID]time.Time) []Comment {
+	threads := []Comment{}
+	index := map[uuid.UUID]int{}
+	for i := range comments {
+		comment := newComment(&comments[i], runCreatedAt[comments[i].RunID])
+		if comment.ParentID == nil {
+			index[comment.ID] = len(threads)
+			threads = append(threads, comment)
+		} else if parent, ok := index[*comment.ParentID]; ok {
+			threads[parent].Replies = append(threads[parent].Replies, comment)
+		}
+	}
+	return threads
+}
+
+// newComment returns a stored comment with its author
+func newComment(comment *db.RunComment, runCreatedAt time.Time) Comment {
+	result := Comment{
+		ID:           comment.ID,
+		RunID:        comment.RunID,
+		ParentID:     comment.ParentID,
+		Author:       CommentAuthor{ID: comment.AuthorID},
+		Body:         comment.Body,
+		RunCreatedAt: runCreatedAt,
+		CreatedAt:    comment.CreatedAt,
+		UpdatedAt:    comment.UpdatedAt,
+	}
+	if comment.Author != nil {
+		result.Author.GitHubUsername = comment.Author.GitHubUsername
+		result.Author.AvatarURL = comment.Author.AvatarURL
+	}
+	return result
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// MaxCommitSeriesLength caps the number of commits returned by CommitSeries
+const MaxCommitSeriesLength = 500
+
+// CommitStats represents aggregated statistics of all runs for one commit
+type CommitStats struct {
+	SHA            string    `json:"sha"`
+	BranchName     *string   `json:"branch_name,omitempty"`
+	RunCount       int64     `json:"run_count"`
+	TotalCO2Kg     float64   `json:"total_co2_kg"`
+	AvgCO2Kg       float64   `json:"avg_co2_kg"`
+	TotalEnergyKWh float64   `json:"total_energy_kwh"`
+	AvgEnergyKWh   float64   `json:"avg_energy_kwh"`
+	AvgDurationS   float64   `json:"avg_duration_s"`
+	FirstRunAt     time.Time `json:"first_run_at"`
+	LastRunAt      time.Time `json:"last_run_at"`
+
+	// Deltas against the preceding commit, only set in a commit series
+	AvgCO2KgDelta     *float64 `json:"avg_co2_kg_delta,omitempty"`
+	AvgEnergyKWhDelta *float64 `json:"avg_energy_kwh_delta,omitempty"`
+}
+
+// CommitSeriesQuery describes a commit-ordered series request
+type CommitSeriesQuery struct {
+	Branch *string
+	From   time.Time
+	To     time.Time
+	Limit  int
+}
+
+// commitStatsSelect aggregates runs grouped by commit SHA
+const commitStatsSelect = `
+	runs.git_commit_sha,
+	MAX(runs.branch_name) as branch_name,
+	COUNT(runs.id) as run_count,
+	COALESCE(SUM(runs.co2_kg), 0) as total_co2_kg,
+	COALESCE(AVG(runs.co2_kg), 0) as avg_co2_kg,
+	COALESCE(SUM(runs.energy_kwh), 0) as total_energy_kwh,
+	COALESCE(AVG(runs.energy_kwh), 0) as avg_energy_kwh,
+	COALESCE(AVG(runs.duration_s), 0) as avg_duration_s,
+	MIN(runs.created_at) as first_run_at,
+	MAX(runs.created_at) as last_run_at`
+
+// CommitStats aggregates all runs of a repository for a commit SHA
+func (s *StatsService) CommitStats(repoID uuid.UUID, sha string) (*CommitStats, error) {
+	stats, err := s.scanCommitStats(s.db.Model(&db.Run{}).
+		Select(commitStatsSelect).
+		Where("runs.repository_id = ? AND runs.git_commit_sha = ?", repoID, sha).
+		Group("runs.git_commit_sha"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit stats: %w", err)
+	}
+	if len(stats) == 0 {
+		return nil, fmt.Errorf("commit not found")
+	}
+
+	return &stats[0], nil
+}
+
+// CommitSeries returns per-commit aggregates of a repository ordered by the time a commit was
+// first measured, oldest first. When more commits match than Limit, the most recent are kept.
+// Each entry carries the change in average CO2 and energy against the preceding commit.
+func (s *StatsService) CommitSeries(repoID uuid.UUID, q CommitSeriesQuery) ([]CommitStats, error) {
+	query := s.db.Model(&db.Run{}).
+		Select(commitStatsSelect).
+		Where("runs.repository_id = ? AND runs.git_commit_sha IS NOT NULL", repoID).
+		Where("runs.created_at >= ? AND runs.created_at <= ?", q.From, q.To)
+	if q.Branch != nil {
+		query = query.Where("runs.branch_name = ?", *q.Branch)
+	}
+
+	stats, err := s.scanCommitStats(query.
+		Group("runs.git_commit_sha").
+		Order("first_run_at DESC").
+		Limit(q.Limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit series: %w", err)
+	}
+
+	// Reverse into chronological order and compute deltas
+	for i, j := 0, len(stats)-1; i < j; i, j = i+1, j-1 {
+		stats[i], stats[j] = stats[j], stats[i]
+	}
+	for i := 1; i < len(stats); i++ {
+		co2Delta := stats[i].AvgCO2Kg - stats[i-1].AvgCO2Kg
+		energyDelta := stats[i].AvgEnergyKWh - stats[i-1].AvgEnergyKWh
+		stats[i].AvgCO2KgDelta = &co2Delta
+		stats[i].AvgEnergyKWhDelta = &energyDelta
+	}
+
+	return stats, nil
+}
+
+// scanCommitStats executes a commitStatsSelect query
+func (s *StatsService) scanCommitStats(query *gorm.DB) ([]CommitStats, error) {
+	rows, err := query.Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []CommitStats{}
+	for rows.Next() {
+		var stat CommitStats
+		if err := rows.Scan(&stat.SHA, &stat.BranchName, &stat.RunCount, &stat.TotalCO2Kg, &stat.AvgCO2Kg,
+			&stat.TotalEnergyKWh, &stat.AvgEnergyKWh, &stat.AvgDurationS,
+			db.ScanTime(&stat.FirstRunAt), db.ScanTime(&stat.LastRunAt)); err != nil {
+			return nil, err
+		}
+		stats = append(stats, stat)
+	}
+
+	return stats, rows.Err()
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// Email categories. Account notices are always sent; users can opt out of the others.
+const (
+	EmailInvitations = "invitations"
+	EmailAlerts      = "alerts"
+	EmailReports     = "reports"
+	EmailAccount     = "account"
+)
+
+// EmailAnnouncements is the category of organization announcements, which users mute through
+// their notification preferences rather than email opt-outs
+const EmailAnnouncements = "announcements"
+
+// EmailOptionalCategories lists the email categories users can opt out of
+var EmailOptionalCategories = []string{EmailInvitations, EmailAlerts, EmailReports}
+
+// EmailPreferences tells which optional email categories a user receives
+type EmailPreferences struct {
+	Email       *string `json:"email"`
+	Invitations bool    `json:"invitations"`
+	Alerts      bool    `json:"alerts"`
+	Reports     bool    `json:"reports"`
+}
+
+// EmailPreferencesRequest represents a partial update of a user's email preferences
+type EmailPreferencesRequest struct {
+	Invitations *bool `json:"invitations"`
+	Alerts      *bool `json:"alerts"`
+	Reports     *bool `json:"reports"`
+}
+
+// WantsEmail reports whether user has an email address and receives emails of category
+func WantsEmail(user *db.User, category string) bool {
+	if user.GitHubEmail == nil || *user.GitHubEmail == "" {
+		return false
+	}
+	return category == EmailAccount || !contains(user.EmailOptOut, category)
+}
+
+// GetEmailPreferences returns the email preferences of a user
+func (s *UserService) GetEmailPreferences(user *db.User) *EmailPreferences {
+	return &EmailPreferences{
+		Email:       user.GitHubEmail,
+		Invitations: !contains(user.EmailOptOut, EmailInvitations),
+		Alerts:      !contains(user.EmailOptOut, EmailAlerts),
+		Reports:     !contains(user.EmailOptOut, EmailReports),
+	}
+}
+
+// UpdateEmailPreferences applies the categories set in req and returns the resulting preferences
+func (s *UserService) UpdateEmailPreferences(userID uuid.UUID, req *EmailPreferencesRequest) (*EmailPreferences, error) {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]*bool{
+		EmailInvitations: req.Invitations,
+		EmailAlerts:      req.Alerts,
+		EmailReports:     req.Reports,
+	}
+	optOut := db.StringList{}
+	for _, category := range EmailOptionalCategories {
+		receive := !contains(user.EmailOptOut, category)
+		if changes[category] != nil {
+			receive = *changes[category]
+		}
+		if !receive {
+			optOut = append(optOut, category)
+		}
+	}
+
+	if err := s.db.Model(user).Update("email_opt_out", optOut).Error; err != nil {
+		return nil, fmt.Errorf("failed to update email preferences: %w", err)
+	}
+	user.EmailOptOut = optOut
+
+	return s.GetEmailPreferences(user), nil
+}
+
+// ListEmailRecipients returns the users that receive emails of category
+func (s *UserService) ListEmailRecipients(category string) ([]db.User, error) {
+	var users []db.User
+	if err := s.db.Where("github_email IS NOT NULL AND github_email <> ''").Order("created_at").Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to list email recipients: %w", err)
+	}
+
+	recipients := users[:0]
+	for i := range users {
+		if WantsEmail(&users[i], category) {
+			recipients = append(recipients, users[i])
+		}
+	}
+	return recipients, nil
+}
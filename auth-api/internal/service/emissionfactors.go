@@ -0,0 +1,335 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/energy"
+)
+
+// Provenance of the built-in emission factors used for regions without a managed factor
+const (
+	BuiltInFactorSource      = "Cloud Carbon Footprint"
+	BuiltInFactorSourceURL   = "https://www.cloudcarbonfootprint.org/docs/methodology"
+	BuiltInFactorMethodology = "Built-in average grid carbon intensity of the cloud region"
+	DefaultFactorMethodology = "Built-in global average grid carbon intensity for unknown regions"
+)
+
+const (
+	emissionFactorDateLayout = "2006-01-02"
+	// maxGramsPerKWh bounds emission factors well above the dirtiest grids
+	maxGramsPerKWh = 5000
+	// maxRegionLength is the length of the region column
+	maxRegionLength = 64
+)
+
+// ErrEmissionFactorOverlap is returned when a factor would be effective on days another
+// factor of its region already is
+var ErrEmissionFactorOverlap = errors.New("emission factor overlaps the effective period of another factor of the region")
+
+// EmissionFactorRequest represents an emission factor as created or replaced by an admin.
+// EffectiveTo is exclusive; omitted, the factor stays effective until further notice.
+type EmissionFactorRequest struct {
+	Region        string   `json:"region" binding:"required" example:"westeurope"`
+	GramsPerKWh   *float64 `json:"grams_co2e_per_kwh" binding:"required" example:"290"`
+	Source        string   `json:"source" binding:"required,max=255" example:"Ember"`
+	SourceURL     *string  `json:"source_url,omitempty" binding:"omitempty,max=2048"`
+	Methodology   string   `json:"methodology" binding:"required" example:"Location-based annual average of the Netherlands grid, 2024"`
+	EffectiveFrom string   `json:"effective_from" binding:"required" example:"2025-01-01"`
+	EffectiveTo   *string  `json:"effective_to,omitempty" example:"2026-01-01"`
+
+	effectiveFrom time.Time
+	effectiveTo   *time.Time
+}
+
+// ValidateEmissionFactor checks the value, source URL and effective period of req and
+// normalizes its region
+func ValidateEmissionFactor(req *EmissionFactorRequest) error {
+	req.Region = normalizeRegion(req.Region)
+	switch {
+	case req.Region == "" || len(req.Region) > maxRegionLength:
+		return fmt.Errorf("region must be 1 to %d characters", maxRegionLength)
+	case math.IsNaN(*req.GramsPerKWh) || *req.GramsPerKWh < 0 || *req.GramsPerKWh > maxGramsPerKWh:
+		return fmt.Errorf("grams_co2e_per_kwh must be between 0 and %d", maxGramsPerKWh)
+	case strings.TrimSpace(req.Source) == "" || strings.TrimSpace(req.Methodology) == "":
+		return fmt.Errorf("source and methodology must not be blank")
+	}
+
+	if req.SourceURL != nil {
+		u, err := url.Parse(*req.SourceURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("source_url must be an http or https URL")
+		}
+	}
+
+	from, err := time.Parse(emissionFactorDateLayout, req.EffectiveFrom)
+	if err != nil {
+		return fmt.Errorf("effective_from must be a date (YYYY-MM-DD)")
+	}
+	req.effectiveFrom, req.effectiveTo = from, nil
+	if req.EffectiveTo != nil {
+		to, err := time.Parse(emissionFactorDateLayout, *req.EffectiveTo)
+		if err != nil {
+			return fmt.Errorf("effective_to must be a date (YYYY-MM-DD)")
+		}
+		if !to.After(from) {
+			return fmt.Errorf("effective_to must be after effective_from")
+		}
+		req.effectiveTo = &to
+	}
+	return nil
+}
+
+// normalizeRegion returns the lower-case cloud region name factors are keyed by
+func normalizeRegion(region string) string {
+	return strings.ToLower(strings.TrimSpace(region))
+}
+
+// EmissionFactorService handles the managed emission factors
+type EmissionFactorService struct {
+	db *gorm.DB
+}
+
+// NewEmissionFactorService creates a new emission factor service
+func NewEmissionFactorService(database *gorm.DB) *EmissionFactorService {
+	return &EmissionFactorService{
+		db: database,
+	}
+}
+
+// ListFactors retrieves the managed emission factors, of one region when region is not
+// empty, by region and most recent first
+func (s *EmissionFactorService) ListFactors(region string) ([]db.EmissionFactor, error) {
+	query := s.db.Order("region ASC, effective_from DESC")
+	if region != "" {
+		query = query.Where("region = ?", normalizeRegion(region))
+	}
+
+	factors := []db.EmissionFactor{}
+	if err := query.Find(&factors).Error; err != nil {
+		return nil, fmt.Errorf("failed to list emission factors: %w", err)
+	}
+	return factors, nil
+}
+
+// GetFactor retrieves a managed emission factor
+func (s *EmissionFactorService) GetFactor(factorID uuid.UUID) (*db.EmissionFactor, error) {
+	var factor db.EmissionFactor
+	if err := s.db.First(&factor, "id = ?", factorID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("emission factor not found")
+		}
+		return nil, fmt.Errorf("failed to get emission factor: %w", err)
+	}
+	return &factor, nil
+}
+
+// CreateFactor records an emission factor from a validated request with its first version,
+// returning ErrEmissionFactorOverlap when another factor of the region is effective on the
+// same days
+func (s *EmissionFactorService) CreateFactor(userID uuid.UUID, req *EmissionFactorRequest) (*db.EmissionFactor, error) {
+	factor := db.EmissionFactor{CreatedByID: &userID, Version: 1}
+	applyEmissionFactor(&factor, userID, req)
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkFactorOverlap(tx, &factor); err != nil {
+			return err
+		}
+		if err := tx.Create(&factor).Error; err != nil {
+			return err
+		}
+		return recordFactorVersion(tx, &factor, db.EmissionFactorCreated, userID)
+	})
+	if err != nil {
+		if errors.Is(err, ErrEmissionFactorOverlap) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to create emission factor: %w", err)
+	}
+	return &factor, nil
+}
+
+// UpdateFactor replaces an emission factor with a validated request as its next version,
+// keeping the previous ones, and returns ErrEmissionFactorOverlap when another factor of the
+// region is effective on the same days
+func (s *EmissionFactorService) UpdateFactor(factor *db.EmissionFactor, userID uuid.UUID, req *EmissionFactorRequest) (*db.EmissionFactor, error) {
+	applyEmissionFactor(factor, userID, req)
+	factor.Version++
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := checkFactorOverlap(tx, factor); err != nil {
+			return err
+		}
+		if err := tx.Save(factor).Error; err != nil {
+			return err
+		}
+		return recordFactorVersion(tx, factor, db.EmissionFactorUpdated, userID)
+	})
+	if err != nil {
+		if errors.Is(err, ErrEmissionFactorOverlap) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to update emission factor: %w", err)
+	}
+	return factor, nil
+}
+
+// DeleteFactor removes an emission factor; its versions are kept, ending with the deletion
+func (s *EmissionFactorService) DeleteFactor(factor *db.EmissionFactor, userID uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ?", factor.ID).Delete(&db.EmissionFactor{})
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete emission factor: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("emission factor not found")
+		}
+
+		deleted := *factor
+		deleted.Version++
+		return recordFactorVersion(tx, &deleted, db.EmissionFactorDeleted, userID)
+	})
+}
+
+// ListVersions retrieves the versions of an emission factor, including a deleted one, most
+// recent first
+func (s *EmissionFactorService) ListVersions(factorID uuid.UUID) ([]db.EmissionFactorVersion, error) {
+	versions := []db.EmissionFactorVersion{}
+	if err := s.db.Where("factor_id = ?", factorID).Order("version DESC").Find(&versions).Error; err != nil {
+		return nil, fmt.Errorf("failed to list emission factor versions: %w", err)
+	}
+	return versions, nil
+}
+
+// recordFactorVersion keeps the state of factor after a change
+func recordFactorVersion(tx *gorm.DB, factor *db.EmissionFactor, change string, userID uuid.UUID) error {
+	version := db.EmissionFactorVersion{
+		FactorID:      factor.ID,
+		Version:       factor.Version,
+		Change:        change,
+		Region:        factor.Region,
+		GramsPerKWh:   factor.GramsPerKWh,
+		Source:        factor.Source,
+		SourceURL:     factor.SourceURL,
+		Methodology:   factor.Methodology,
+		EffectiveFrom: factor.EffectiveFrom,
+		EffectiveTo:   factor.EffectiveTo,
+		ChangedByID:   &userID,
+	}
+	if err := tx.Create(&version).Error; err != nil {
+		return fmt.Errorf("failed to record emission factor version: %w", err)
+	}
+	return nil
+}
+
+// applyEmissionFactor copies a validated request onto factor
+func applyEmissionFactor(factor *db.EmissionFactor, userID uuid.UUID, req *EmissionFactorRequest) {
+	factor.Region = req.Region
+	factor.GramsPerKWh = *req.GramsPerKWh
+	factor.Source = strings.TrimSpace(req.Source)
+	factor.SourceURL = req.SourceURL
+	factor.Methodology = strings.TrimSpace(req.Methodology)
+	factor.EffectiveFrom = req.effectiveFrom
+	factor.EffectiveTo = req.effectiveTo
+	factor.UpdatedByID = &userID
+}
+
+// checkFactorOverlap returns ErrEmissionFactorOverlap when another factor of the region of
+// factor is effective on any of its days
+func checkFactorOverlap(tx *gorm.DB, factor *db.EmissionFactor) error {
+	var others []db.EmissionFactor
+	if err := tx.Where("region = ? AND id <> ?", factor.Region, factor.ID).Find(&others).Error; err != nil {
+		return fmt.Errorf("failed to get emission factors: %w", err)
+	}
+	for _, other := range others {
+		startsBeforeEnd := factor.EffectiveTo == nil || other.EffectiveFrom.Before(*factor.EffectiveTo)
+		endsAfterStart := other.EffectiveTo == nil || other.EffectiveTo.After(factor.EffectiveFrom)
+		if startsBeforeEnd && endsAfterStart {
+			return ErrEmissionFactorOverlap
+		}
+	}
+	return nil
+}
+
+// ResolvedEmissionFactor is the emission factor of a region on a day with its provenance.
+// FactorID and Version are nil for the built-in factors used when no managed factor is
+// effective.
+type ResolvedEmissionFactor struct {
+	Region        string     `json:"region"`
+	At            time.Time  `json:"at"`
+	GramsPerKWh   float64    `json:"grams_co2e_per_kwh"`
+	Source        string     `json:"source"`
+	SourceURL     *string    `json:"source_url,omitempty"`
+	Methodology   string     `json:"methodology"`
+	EffectiveFrom *time.Time `json:"effective_from,omitempty"`
+	EffectiveTo   *time.Time `json:"effective_to,omitempty"`
+	FactorID      *uuid.UUID `json:"factor_id"`
+	Version       *int       `json:"version"`
+	BuiltIn       bool       `json:"built_in"`
+}
+
+// ResolveFactor returns the emission factor of region effective at at: the managed factor
+// whose period contains the day, else the built-in factor of the region or, for unknown
+// regions, the built-in global average
+func (s *EmissionFactorService) ResolveFactor(region string, at time.Time) (*ResolvedEmissionFactor, error) {
+	region = normalizeRegion(region)
+
+	var factors []db.EmissionFactor
+	if err := s.db.Where("region = ?", region).Find(&factors).Error; err != nil {
+		return nil, fmt.Errorf("failed to get emission factors: %w", err)
+	}
+	return resolveFactor(region, factors, at), nil
+}
+
+// resolveFactor returns the emission factor of region effective at at from the managed
+// factors of the region, falling back to the built-in factors
+func resolveFactor(region string, factors []db.EmissionFactor, at time.Time) *ResolvedEmissionFactor {
+	day := at.UTC().Format(emissionFactorDateLayout)
+	for i := range factors {
+		factor := &factors[i]
+		if factor.EffectiveFrom.Format(emissionFactorDateLayout) > day {
+			continue
+		}
+		if factor.EffectiveTo != nil && factor.EffectiveTo.Format(emissionFactorDateLayout) <= day {
+			continue
+		}
+		effectiveFrom := factor.EffectiveFrom
+		factorID, version := factor.ID, factor.Version
+		return &ResolvedEmissionFactor{
+			Region:        region,
+			At:            at,
+			GramsPerKWh:   factor.GramsPerKWh,
+			Source:        factor.Source,
+			SourceURL:     factor.SourceURL,
+			Methodology:   factor.Methodology,
+			EffectiveFrom: &effectiveFrom,
+			EffectiveTo:   factor.EffectiveTo,
+			FactorID:      &factorID,
+			Version:       &version,
+		}
+	}
+
+	intensity, known := energy.CarbonIntensity(region)
+	methodology := BuiltInFactorMethodology
+	if !known {
+		methodology = DefaultFactorMethodology
+	}
+	sourceURL := BuiltInFactorSourceURL
+	return &ResolvedEmissionFactor{
+		Region:      region,
+		At:          at,
+		GramsPerKWh: intensity,
+		Source:      BuiltInFactorSource,
+		SourceURL:   &sourceURL,
+		Methodology: methodology,
+		BuiltIn:     true,
+	}
+}
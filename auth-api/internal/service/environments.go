@@ -0,0 +1,106 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// Environments runs are submitted for
+const (
+	EnvironmentCI               = "ci"
+	EnvironmentStaging          = "staging"
+	EnvironmentProductionDeploy = "production-deploy"
+)
+
+// Environments lists the environments runs can be submitted for, test pipelines first
+var Environments = []string{EnvironmentCI, EnvironmentStaging, EnvironmentProductionDeploy}
+
+// IsValidEnvironment reports whether environment is one of Environments
+func IsValidEnvironment(environment string) bool {
+	for _, known := range Environments {
+		if environment == known {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeEnvironment defaults the environment of req to ci and checks that it is known
+func NormalizeEnvironment(req *RunCreateRequest) error {
+	if req.Environment == "" {
+		req.Environment = EnvironmentCI
+	}
+	if !IsValidEnvironment(req.Environment) {
+		return fmt.Errorf("environment must be one of %s", strings.Join(Environments, ", "))
+	}
+	return nil
+}
+
+// EnvironmentStats aggregates the runs of one environment
+type EnvironmentStats struct {
+	Environment    string  `json:"environment" example:"production-deploy"`
+	RunCount       int64   `json:"run_count"`
+	TotalCO2Kg     float64 `json:"total_co2_kg"`
+	AvgCO2Kg       float64 `json:"avg_co2_kg"`
+	TotalEnergyKWh float64 `json:"total_energy_kwh"`
+	TotalDurationS float64 `json:"total_duration_s"`
+	// Share is the share of the CO2 of all runs the environment emitted
+	Share float64 `json:"share"`
+}
+
+// EnvironmentStats aggregates the runs in scope created between from and to (inclusive) by
+// environment, every environment in order
+func (s *StatsService) EnvironmentStats(scope RunScope, from, to time.Time) ([]EnvironmentStats, error) {
+	rows, err := s.db.Model(&db.Run{}).
+		Select(`
+			runs.environment,
+			COUNT(runs.id) as run_count,
+			COALESCE(SUM(runs.co2_kg), 0) as total_co2_kg,
+			COALESCE(SUM(runs.energy_kwh), 0) as total_energy_kwh,
+			COALESCE(SUM(runs.duration_s), 0) as total_duration_s
+		`).
+		Scopes(scope).
+		Where("runs.created_at >= ? AND runs.created_at <= ?", from, to).
+		Group("runs.environment").
+		Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute environment stats query: %w", err)
+	}
+	defer rows.Close()
+
+	stats := make([]EnvironmentStats, len(Environments))
+	index := map[string]int{}
+	for i, environment := range Environments {
+		stats[i].Environment = environment
+		index[environment] = i
+	}
+	var total float64
+	for rows.Next() {
+		var stat EnvironmentStats
+		if err := rows.Scan(&stat.Environment, &stat.RunCount, &stat.TotalCO2Kg, &stat.TotalEnergyKWh, &stat.TotalDurationS); err != nil {
+			return nil, fmt.Errorf("failed to scan environment stats: %w", err)
+		}
+		if stat.RunCount > 0 {
+			stat.AvgCO2Kg = stat.TotalCO2Kg / float64(stat.RunCount)
+		}
+		total += stat.TotalCO2Kg
+		if i, ok := index[stat.Environment]; ok {
+			stats[i] = stat
+		} else {
+			stats = append(stats, stat)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read environment stats: %w", err)
+	}
+
+	if total > 0 {
+		for i := range stats {
+			stats[i].Share = stats[i].TotalCO2Kg / total
+		}
+	}
+	return stats, nil
+}
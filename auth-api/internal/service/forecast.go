@@ -0,0 +1,145 @@
+package service
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultForecastLookbackDays is the run-rate window of forecasts; four full weeks give
+// every weekday the same weight in the seasonal model
+const DefaultForecastLookbackDays = 28
+
+// Forecast projects the CO2 of the current calendar periods
+type Forecast struct {
+	GeneratedAt  time.Time        `json:"generated_at"`
+	Model        string           `json:"model"`
+	LookbackDays int              `json:"lookback_days"`
+	Periods      []PeriodForecast `json:"periods"`
+}
+
+// PeriodForecast is the projection of one budget period
+type PeriodForecast struct {
+	Period             string    `json:"period"`
+	Start              time.Time `json:"start"`
+	End                time.Time `json:"end"`
+	ActualCO2Kg        float64   `json:"actual_co2_kg"`
+	ProjectedRemaining float64   `json:"projected_remaining_co2_kg"`
+	ForecastCO2Kg      float64   `json:"forecast_co2_kg"`
+	BudgetCO2Kg        *float64  `json:"budget_co2_kg"`
+	BudgetStatus       string    `json:"budget_status"`
+}
+
+// ForecastCO2 projects end-of-month and end-of-quarter CO2 for the runs in scope. The
+// model is a weekday-seasonal run rate: the remaining days of a period are filled with the
+// average daily CO2 of the same weekday over the lookback window, so weekday-heavy
+// pipelines are not over-projected into weekends. budgets maps periods to CO2 limits.
+func (s *StatsService) ForecastCO2(scope RunScope, now time.Time, lookbackDays int, budgets map[string]float64) (*Forecast, error) {
+	now = now.UTC()
+	today := TruncateToInterval(now, "day")
+
+	// Average daily CO2 per weekday over the complete days of the lookback window
+	history, err := s.TimeSeries(scope, TimeSeriesQuery{
+		Metric:   "co2_kg",
+		Interval: "day",
+		From:     today.AddDate(0, 0, -lookbackDays),
+		To:       today.Add(-time.Nanosecond),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get run rate: %w", err)
+	}
+	var weekdaySum [7]float64
+	var weekdayDays [7]int
+	for _, point := range history {
+		weekday := point.BucketStart.Weekday()
+		weekdaySum[weekday] += point.Sum
+		weekdayDays[weekday]++
+	}
+	var weekdayRate [7]float64
+	for i := range weekdayRate {
+		if weekdayDays[i] > 0 {
+			weekdayRate[i] = weekdaySum[i] / float64(weekdayDays[i])
+		}
+	}
+
+	forecast := &Forecast{
+		GeneratedAt:  now,
+		Model:        "weekday_seasonal",
+		LookbackDays: lookbackDays,
+	}
+	for _, period := range []string{"month", "quarter"} {
+		start, end := PeriodBounds(now, period)
+		actual, err := s.Summary(scope, start, now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get %s to date: %w", period, err)
+		}
+
+		// The rest of today counts proportionally, later days in full
+		dayFraction := 1 - now.Sub(today).Hours()/24
+		remaining := weekdayRate[today.Weekday()] * dayFraction
+		for day := today.AddDate(0, 0, 1); day.Before(end); day = day.AddDate(0, 0, 1) {
+			remaining += weekdayRate[day.Weekday()]
+		}
+
+		periodForecast := PeriodForecast{
+			Period:             period,
+			Start:              start,
+			End:                end,
+			ActualCO2Kg:        actual.TotalCO2Kg,
+			ProjectedRemaining: remaining,
+			ForecastCO2Kg:      actual.TotalCO2Kg + remaining,
+			BudgetStatus:       BudgetStatusNone,
+		}
+		if limit, ok := budgets[period]; ok {
+			periodForecast.BudgetCO2Kg = &limit
+			periodForecast.BudgetStatus = budgetStatus(periodForecast.ActualCO2Kg, periodForecast.ForecastCO2Kg, limit)
+		}
+		forecast.Periods = append(forecast.Periods, periodForecast)
+	}
+
+	return forecast, nil
+}
+
+// budgetStatus classifies actual and forecast emissions against a budget limit
+func budgetStatus(actual, forecast, limit float64) string {
+	switch {
+	case actual > limit:
+		return BudgetStatusExceeded
+	case forecast > limit:
+		return BudgetStatusAtRisk
+	default:
+		return BudgetStatusOnTrack
+	}
+}
+
+// budgetSeverity orders budget statuses from best to worst
+var budgetSeverity = map[string]int{
+	BudgetStatusNone:     0,
+	BudgetStatusOnTrack:  1,
+	BudgetStatusAtRisk:   2,
+	BudgetStatusExceeded: 3,
+}
+
+// BudgetCheck is the state of the budgets of a repository, for gating pipelines
+type BudgetCheck struct {
+	// Status is the worst status of the budgets, or no_budget without budgets
+	Status   string `json:"status"`
+	Exceeded bool   `json:"exceeded"`
+	// Budgets are the forecasts of the periods with a budget
+	Budgets []PeriodForecast `json:"budgets"`
+}
+
+// CheckBudgets summarizes the periods of forecast that have a budget
+func CheckBudgets(forecast *Forecast) *BudgetCheck {
+	check := &BudgetCheck{Status: BudgetStatusNone, Budgets: []PeriodForecast{}}
+	for _, period := range forecast.Periods {
+		if period.BudgetCO2Kg == nil {
+			continue
+		}
+		check.Budgets = append(check.Budgets, period)
+		if budgetSeverity[period.BudgetStatus] > budgetSeverity[check.Status] {
+			check.Status = period.BudgetStatus
+		}
+	}
+	check.Exceeded = check.Status == BudgetStatusExceeded
+	return check
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/github"
+)
+
+// ErrGitHubCredentialMissing is returned for users without a stored GitHub token, who signed
+// in before tokens were kept or whose token was revoked
+var ErrGitHubCredentialMissing = errors.New("no GitHub credentials stored for the user")
+
+// SaveGitHubCredential stores the GitHub OAuth token of a user, replacing the previous one
+func (s *UserService) SaveGitHubCredential(userID uuid.UUID, accessToken string) error {
+	credential := db.GitHubCredential{UserID: userID, AccessToken: accessToken}
+	err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"access_token", "updated_at"}),
+	}).Create(&credential).Error
+	if err != nil {
+		return fmt.Errorf("failed to save GitHub credentials: %w", err)
+	}
+	return nil
+}
+
+// GetGitHubCredential retrieves the stored GitHub token of a user, returning
+// ErrGitHubCredentialMissing when there is none
+func (s *UserService) GetGitHubCredential(userID uuid.UUID) (*db.GitHubCredential, error) {
+	var credential db.GitHubCredential
+	if err := s.db.Where("user_id = ?", userID).First(&credential).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, ErrGitHubCredentialMissing
+		}
+		return nil, fmt.Errorf("failed to get GitHub credentials: %w", err)
+	}
+	return &credential, nil
+}
+
+// DeleteGitHubCredential removes the stored GitHub token of a user
+func (s *UserService) DeleteGitHubCredential(userID uuid.UUID) error {
+	if err := s.db.Where("user_id = ?", userID).Delete(&db.GitHubCredential{}).Error; err != nil {
+		return fmt.Errorf("failed to delete GitHub credentials: %w", err)
+	}
+	return nil
+}
+
+// RefreshGitHubProfile updates the username, name, avatar and email of a user from their
+// GitHub profile. An email GitHub no longer shows keeps the stored one.
+func (s *UserService) RefreshGitHubProfile(userID uuid.UUID, profile *github.User) (*db.User, error) {
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if profile.ID != user.GitHubID {
+		return nil, fmt.Errorf("GitHub profile %d does not belong to user %s", profile.ID, userID)
+	}
+
+	user.GitHubUsername = profile.Login
+	user.Name = profile.Name
+	user.AvatarURL = &profile.AvatarURL
+	if profile.Email != nil {
+		user.GitHubEmail = profile.Email
+	}
+	if err := s.db.Save(user).Error; err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+	return user, nil
+}
+
+// ListOwnedRepositories retrieves the repositories a user owns by full name
+func (s *RepositoryService) ListOwnedRepositories(ownerID uuid.UUID) ([]db.Repository, error) {
+	repos := []db.Repository{}
+	if err := s.db.Where("owner_id = ?", ownerID).Order("full_name ASC").Find(&repos).Error; err != nil {
+		return nil, fmt.Errorf("failed to list repositories: %w", err)
+	}
+	return repos, nil
+}
+
+// RefreshFromGitHub updates the metadata of a repository from GitHub, following renames and
+// transfers to organizations EcoCI knows. Repositories without a GitHub ID yet record it.
+func (s *RepositoryService) RefreshFromGitHub(repo *db.Repository, metadata *github.Repository) (*db.Repository, error) {
+	if repo.GitHubRepoID != 0 && metadata.ID != repo.GitHubRepoID {
+		return nil, fmt.Errorf("GitHub repository %d is not repository %s", metadata.ID, repo.ID)
+	}
+
+	organizationID, err := s.organizationIDForFullName(metadata.FullName)
+	if err != nil {
+		return nil, err
+	}
+	sizeKB := metadata.SizeKB
+
+	repo.GitHubRepoID = metadata.ID
+	repo.Name = metadata.Name
+	repo.FullName = metadata.FullName
+	repo.Description = metadata.Description
+	repo.Private = metadata.Private
+	repo.HTMLURL = metadata.HTMLURL
+	repo.OrganizationID = organizationID
+	repo.SizeKB = &sizeKB
+	if metadata.Language != nil {
+		repo.Language = metadata.Language
+	}
+	if err := s.db.Save(repo).Error; err != nil {
+		return nil, fmt.Errorf("failed to update repository: %w", err)
+	}
+	return repo, nil
+}
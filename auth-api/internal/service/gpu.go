@@ -0,0 +1,141 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// MaxRunGPUs bounds the GPUs a run may be submitted with
+const MaxRunGPUs = 64
+
+// maxGPUModelLength is the longest GPU model a run may be submitted with
+const maxGPUModelLength = 128
+
+// GPUDeviceRequest is the energy one GPU of a run consumed
+type GPUDeviceRequest struct {
+	Index     int     `json:"index"`
+	Model     string  `json:"model" example:"nvidia-a100"`
+	EnergyKWh float64 `json:"energy_kwh"`
+}
+
+// NormalizeGPUs validates the GPU energy of req, which must be normalized to kWh first. Runs
+// submitted per device get gpu_energy_kwh, gpu_count and gpu_model from their gpus, the model
+// only when every device has the same one, and may not give them. The GPU energy is part of
+// the energy of the run, so it may not exceed it.
+func NormalizeGPUs(req *RunCreateRequest) error {
+	if len(req.GPUs) > 0 {
+		if req.GPUEnergyKWh != nil || req.GPUModel != nil || req.GPUCount != nil {
+			return fmt.Errorf("gpu_energy_kwh, gpu_model and gpu_count are derived from gpus and may not be given with them")
+		}
+		if len(req.GPUs) > MaxRunGPUs {
+			return fmt.Errorf("at most %d gpus may be given", MaxRunGPUs)
+		}
+
+		seen := map[int]bool{}
+		total, model := 0.0, req.GPUs[0].Model
+		for _, device := range req.GPUs {
+			switch {
+			case device.Index < 0 || seen[device.Index]:
+				return fmt.Errorf("gpu index %d must be non-negative and given once", device.Index)
+			case device.Model == "" || len(device.Model) > maxGPUModelLength:
+				return fmt.Errorf("gpu %d requires a model of at most %d characters", device.Index, maxGPUModelLength)
+			case !(device.EnergyKWh >= 0 && !math.IsInf(device.EnergyKWh, 0)):
+				return fmt.Errorf("energy of gpu %d must be non-negative", device.Index)
+			}
+			seen[device.Index] = true
+			total += device.EnergyKWh
+			if device.Model != model {
+				model = ""
+			}
+		}
+
+		count := len(req.GPUs)
+		req.GPUEnergyKWh, req.GPUCount = &total, &count
+		if model != "" {
+			req.GPUModel = &model
+		}
+	}
+
+	switch {
+	case req.GPUEnergyKWh == nil:
+		if req.GPUModel != nil || req.GPUCount != nil {
+			return fmt.Errorf("gpu_model and gpu_count require gpu_energy_kwh")
+		}
+		return nil
+	case !(*req.GPUEnergyKWh >= 0 && !math.IsInf(*req.GPUEnergyKWh, 0)):
+		return fmt.Errorf("gpu_energy_kwh must be non-negative")
+	case *req.GPUEnergyKWh > req.EnergyKWh*(1+1e-9):
+		return fmt.Errorf("gpu_energy_kwh is part of the energy of the run and may not exceed energy_kwh")
+	case req.GPUCount != nil && (*req.GPUCount < 1 || *req.GPUCount > MaxRunGPUs):
+		return fmt.Errorf("gpu_count must be between 1 and %d", MaxRunGPUs)
+	case req.GPUModel != nil && (*req.GPUModel == "" || len(*req.GPUModel) > maxGPUModelLength):
+		return fmt.Errorf("gpu_model must be at most %d characters", maxGPUModelLength)
+	}
+	return nil
+}
+
+// newGPUDevices returns the GPUs of a run from normalized requests
+func newGPUDevices(requests []GPUDeviceRequest) []db.RunGPU {
+	if len(requests) == 0 {
+		return nil
+	}
+	devices := make([]db.RunGPU, len(requests))
+	for i, req := range requests {
+		devices[i] = db.RunGPU{DeviceIndex: req.Index, Model: req.Model, EnergyKWh: req.EnergyKWh}
+	}
+	return devices
+}
+
+// GPUModelStats aggregates the GPU energy of the runs with one GPU model
+type GPUModelStats struct {
+	// Model is nil for the runs with mixed or unknown GPUs
+	Model        *string `json:"model"`
+	RunCount     int64   `json:"run_count"`
+	GPUCount     int64   `json:"gpu_count"`
+	GPUEnergyKWh float64 `json:"gpu_energy_kwh"`
+	// EnergyKWh is the total energy of the runs, of which GPUShare was used by their GPUs
+	EnergyKWh float64 `json:"energy_kwh"`
+	GPUShare  float64 `json:"gpu_share"`
+}
+
+// GPUStats aggregates the GPU energy of the runs in scope created between from and to
+// (inclusive) by GPU model, the most energy first. Runs without GPU energy are left out.
+func (s *StatsService) GPUStats(scope RunScope, from, to time.Time) ([]GPUModelStats, error) {
+	rows, err := s.db.Model(&db.Run{}).
+		Select(`
+			runs.gpu_model,
+			COUNT(runs.id) as run_count,
+			COALESCE(SUM(runs.gpu_count), 0) as gpu_count,
+			SUM(runs.gpu_energy_kwh) as gpu_energy_kwh,
+			SUM(runs.energy_kwh) as energy_kwh
+		`).
+		Scopes(scope).
+		Where("runs.gpu_energy_kwh IS NOT NULL").
+		Where("runs.created_at >= ? AND runs.created_at <= ?", from, to).
+		Group("runs.gpu_model").
+		Order("gpu_energy_kwh DESC").
+		Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute GPU stats query: %w", err)
+	}
+	defer rows.Close()
+
+	stats := []GPUModelStats{}
+	for rows.Next() {
+		var stat GPUModelStats
+		if err := rows.Scan(&stat.Model, &stat.RunCount, &stat.GPUCount, &stat.GPUEnergyKWh, &stat.EnergyKWh); err != nil {
+			return nil, fmt.Errorf("failed to scan GPU stats: %w", err)
+		}
+		if stat.EnergyKWh > 0 {
+			stat.GPUShare = stat.GPUEnergyKWh / stat.EnergyKWh
+		}
+		stats = append(stats, stat)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read GPU stats: %w", err)
+	}
+	return stats, nil
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/filter"
+)
+
+// Bounds of the number of histogram buckets
+const (
+	DefaultHistogramBuckets = 20
+	MaxHistogramBuckets     = 100
+)
+
+// HistogramQuery describes a distribution request
+type HistogramQuery struct {
+	Metric  string
+	Buckets int
+	From    time.Time
+	To      time.Time
+	// Filter restricts the runs counted, all runs in scope when nil
+	Filter *filter.Expr
+}
+
+// HistogramBucket counts the runs whose metric is at least Lower and below Upper; the last
+// bucket includes its upper bound
+type HistogramBucket struct {
+	Lower float64 `json:"lower"`
+	Upper float64 `json:"upper"`
+	Count int64   `json:"count"`
+}
+
+// Histogram is the distribution of a metric over runs in buckets of equal width between
+// its minimum and maximum
+type Histogram struct {
+	Count   int64             `json:"count"`
+	Min     float64           `json:"min"`
+	Max     float64           `json:"max"`
+	Buckets []HistogramBucket `json:"buckets"`
+}
+
+// Histogram counts the runs in scope created between From and To per bucket of the metric.
+// Without runs there are no buckets, and when every run has the same value there is one.
+func (s *StatsService) Histogram(scope RunScope, q HistogramQuery) (*Histogram, error) {
+	column, ok := statsMetrics[q.Metric]
+	if !ok {
+		return nil, fmt.Errorf("unsupported metric: %s", q.Metric)
+	}
+	if q.Buckets < 1 || q.Buckets > MaxHistogramBuckets {
+		return nil, fmt.Errorf("buckets must be between 1 and %d", MaxHistogramBuckets)
+	}
+	column = "runs." + column
+
+	runs := func() *gorm.DB {
+		return s.db.Model(&db.Run{}).
+			Scopes(scope, RunsMatching(q.Filter)).
+			Where("runs.created_at >= ? AND runs.created_at <= ?", q.From, q.To)
+	}
+
+	histogram := &Histogram{Buckets: []HistogramBucket{}}
+	row := runs().Select("COUNT(*), COALESCE(MIN(" + column + "), 0), COALESCE(MAX(" + column + "), 0)").Row()
+	if err := row.Scan(&histogram.Count, &histogram.Min, &histogram.Max); err != nil {
+		return nil, fmt.Errorf("failed to get metric range: %w", err)
+	}
+	if histogram.Count == 0 {
+		return histogram, nil
+	}
+	if histogram.Min == histogram.Max {
+		histogram.Buckets = append(histogram.Buckets, HistogramBucket{Lower: histogram.Min, Upper: histogram.Max, Count: histogram.Count})
+		return histogram, nil
+	}
+
+	width := (histogram.Max - histogram.Min) / float64(q.Buckets)
+	for i := 0; i < q.Buckets; i++ {
+		histogram.Buckets = append(histogram.Buckets, HistogramBucket{
+			Lower: histogram.Min + float64(i)*width,
+			Upper: histogram.Min + float64(i+1)*width,
+		})
+	}
+	histogram.Buckets[q.Buckets-1].Upper = histogram.Max
+
+	// Bucket numbers are 0-based; the maximum falls into the last bucket
+	last := strconv.Itoa(q.Buckets - 1)
+	var bucketExpr string
+	var args []interface{}
+	if db.DialectOf(s.db).IsPostgres() {
+		bucketExpr = "LEAST(width_bucket(" + column + ", ?, ?, ?) - 1, " + last + ")"
+		args = []interface{}{histogram.Min, histogram.Max, q.Buckets}
+	} else {
+		bucketExpr = "MIN(CAST((" + column + " - ?) / (? - ?) * ? AS INTEGER), " + last + ")"
+		args = []interface{}{histogram.Min, histogram.Max, histogram.Min, q.Buckets}
+	}
+
+	rows, err := runs().Select(bucketExpr+" AS bucket, COUNT(*)", args...).Group("bucket").Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count histogram buckets: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var bucket int
+		var count int64
+		if err := rows.Scan(&bucket, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan histogram bucket: %w", err)
+		}
+		if bucket >= 0 && bucket < q.Buckets {
+			histogram.Buckets[bucket].Count += count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read histogram buckets: %w", err)
+	}
+
+	return histogram, nil
+}
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// maxImageNameLength is the longest image name a run may be submitted with
+const maxImageNameLength = 255
+
+// ImageBuildRequest is the container image an image-build run built
+type ImageBuildRequest struct {
+	Image          *string `json:"image,omitempty" example:"ghcr.io/octocat/hello-world:latest"`
+	LayersBuilt    int     `json:"layers_built"`
+	LayersCached   int     `json:"layers_cached"`
+	ImageSizeBytes *int64  `json:"image_size_bytes,omitempty"`
+	PushBytes      *int64  `json:"push_bytes,omitempty"`
+}
+
+// ValidateImageBuild checks the image build of a run, if any: the layer counts and sizes may
+// not be negative and at least one layer must be built or cached
+func ValidateImageBuild(req *ImageBuildRequest) error {
+	switch {
+	case req == nil:
+		return nil
+	case req.LayersBuilt < 0 || req.LayersCached < 0:
+		return fmt.Errorf("layers_built and layers_cached must not be negative")
+	case req.LayersBuilt+req.LayersCached == 0:
+		return fmt.Errorf("an image build requires at least one layer built or cached")
+	case req.ImageSizeBytes != nil && *req.ImageSizeBytes < 0:
+		return fmt.Errorf("image_size_bytes must not be negative")
+	case req.PushBytes != nil && *req.PushBytes < 0:
+		return fmt.Errorf("push_bytes must not be negative")
+	case req.Image != nil && (*req.Image == "" || len(*req.Image) > maxImageNameLength):
+		return fmt.Errorf("image must be at most %d characters", maxImageNameLength)
+	}
+	return nil
+}
+
+// newImageBuild returns the image build of a run from a validated request
+func newImageBuild(req *ImageBuildRequest) *db.RunImageBuild {
+	if req == nil {
+		return nil
+	}
+	return &db.RunImageBuild{
+		Image:          req.Image,
+		LayersBuilt:    req.LayersBuilt,
+		LayersCached:   req.LayersCached,
+		ImageSizeBytes: req.ImageSizeBytes,
+		PushBytes:      req.PushBytes,
+	}
+}
+
+// ImageBuildTotals aggregates image-build runs
+type ImageBuildTotals struct {
+	BuildCount   int64 `json:"build_count"`
+	LayersBuilt  int64 `json:"layers_built"`
+	LayersCached int64 `json:"layers_cached"`
+	// CacheHitRate is the share of layers taken from the cache; nil without layers
+	CacheHitRate *float64 `json:"cache_hit_rate"`
+	// AvgImageSizeBytes is the average size of the images whose size was reported
+	AvgImageSizeBytes *float64 `json:"avg_image_size_bytes"`
+	PushBytes         int64    `json:"push_bytes"`
+	CO2Kg             float64  `json:"co2_kg"`
+	EnergyKWh         float64  `json:"energy_kwh"`
+	// CO2PerBuiltLayerKg attributes the CO2 of the builds to the layers they built, as cached
+	// layers cost next to nothing; nil when no layer was built
+	CO2PerBuiltLayerKg *float64 `json:"co2_per_built_layer_kg"`
+	// CacheSavingsCO2Kg estimates the CO2 the cached layers would have emitted if built
+	CacheSavingsCO2Kg *float64 `json:"cache_savings_co2_kg"`
+
+	// imageSizeBytes and imageSizeCount sum the reported image sizes
+	imageSizeBytes int64
+	imageSizeCount int64
+}
+
+// add adds other to the totals
+func (t *ImageBuildTotals) add(other *ImageBuildTotals) {
+	t.BuildCount += other.BuildCount
+	t.LayersBuilt += other.LayersBuilt
+	t.LayersCached += other.LayersCached
+	t.PushBytes += other.PushBytes
+	t.CO2Kg += other.CO2Kg
+	t.EnergyKWh += other.EnergyKWh
+	t.imageSizeBytes += other.imageSizeBytes
+	t.imageSizeCount += other.imageSizeCount
+}
+
+// derive computes the rates and averages of the totals
+func (t *ImageBuildTotals) derive() {
+	if layers := t.LayersBuilt + t.LayersCached; layers > 0 {
+		rate := float64(t.LayersCached) / float64(layers)
+		t.CacheHitRate = &rate
+	}
+	if t.imageSizeCount > 0 {
+		avg := float64(t.imageSizeBytes) / float64(t.imageSizeCount)
+		t.AvgImageSizeBytes = &avg
+	}
+	if t.LayersBuilt > 0 {
+		perLayer := t.CO2Kg / float64(t.LayersBuilt)
+		savings := perLayer * float64(t.LayersCached)
+		t.CO2PerBuiltLayerKg, t.CacheSavingsCO2Kg = &perLayer, &savings
+	}
+}
+
+// ImageBuildPoint is the image-build runs of one bucket
+type ImageBuildPoint struct {
+	BucketStart time.Time `json:"bucket_start"`
+	ImageBuildTotals
+}
+
+// ImageBuildStats is the image-build runs over a time range and their trend
+type ImageBuildStats struct {
+	From     time.Time         `json:"from"`
+	To       time.Time         `json:"to"`
+	Interval string            `json:"interval"`
+	Summary  ImageBuildTotals  `json:"summary"`
+	Trend    []ImageBuildPoint `json:"trend"`
+}
+
+// ImageBuildStats aggregates the image-build runs in scope created between from and to
+// (inclusive), in total and bucketed by interval including empty buckets, so the cache hit
+// rate and the CO2 of builds can be followed over time
+func (s *StatsService) ImageBuildStats(scope RunScope, from, to time.Time, interval string) (*ImageBuildStats, error) {
+	if !IsValidInterval(interval) {
+		return nil, fmt.Errorf("unsupported interval: %s", interval)
+	}
+	if CountBuckets(from, to, interval) > MaxTimeSeriesBuckets {
+		return nil, fmt.Errorf("time range spans more than %d buckets", MaxTimeSeriesBuckets)
+	}
+
+	bucketExpr := db.DialectOf(s.db).DateTrunc(interval, "runs.created_at")
+	rows, err := s.db.Model(&db.Run{}).
+		Select(bucketExpr+` as bucket_start,
+			COUNT(runs.id) as build_count,
+			COALESCE(SUM(run_image_builds.layers_built), 0) as layers_built,
+			COALESCE(SUM(run_image_builds.layers_cached), 0) as layers_cached,
+			COALESCE(SUM(run_image_builds.image_size_bytes), 0) as image_size_bytes,
+			COUNT(run_image_builds.image_size_bytes) as image_size_count,
+			COALESCE(SUM(run_image_builds.push_bytes), 0) as push_bytes,
+			COALESCE(SUM(runs.co2_kg), 0) as co2_kg,
+			COALESCE(SUM(runs.energy_kwh), 0) as energy_kwh`).
+		Joins("JOIN run_image_builds ON run_image_builds.run_id = runs.id").
+		Scopes(scope).
+		Where("runs.created_at >= ? AND runs.created_at <= ?", from, to).
+		Group(bucketExpr).
+		Order("bucket_start ASC").
+		Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute image build stats query: %w", err)
+	}
+	defer rows.Close()
+
+	buckets := make(map[int64]ImageBuildPoint)
+	for rows.Next() {
+		var point ImageBuildPoint
+		if err := rows.Scan(db.ScanTime(&point.BucketStart), &point.BuildCount, &point.LayersBuilt, &point.LayersCached,
+			&point.imageSizeBytes, &point.imageSizeCount, &point.PushBytes, &point.CO2Kg, &point.EnergyKWh); err != nil {
+			return nil, fmt.Errorf("failed to scan image build bucket: %w", err)
+		}
+		buckets[point.BucketStart.Unix()] = point
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read image build buckets: %w", err)
+	}
+
+	stats := &ImageBuildStats{From: from, To: to, Interval: interval, Trend: []ImageBuildPoint{}}
+	end := TruncateToInterval(to, interval)
+	for bucket := TruncateToInterval(from, interval); !bucket.After(end); bucket = nextBucket(bucket, interval) {
+		point, ok := buckets[bucket.Unix()]
+		if !ok {
+			point = ImageBuildPoint{BucketStart: bucket}
+		}
+		stats.Summary.add(&point.ImageBuildTotals)
+		point.derive()
+		stats.Trend = append(stats.Trend, point)
+	}
+	stats.Summary.derive()
+	return stats, nil
+}
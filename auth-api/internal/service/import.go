@@ -0,0 +1,132 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// MaxImportRuns bounds the runs of one import, which are created in a single transaction
+const MaxImportRuns = 10000
+
+// ImportedRun is a run measured by another tool, created at the time it was measured
+type ImportedRun struct {
+	RunCreateRequest
+	CreatedAt time.Time
+	// ImportID identifies the measurement in its source, so importing it again is skipped
+	ImportID string
+}
+
+// ImportResult summarizes an import
+type ImportResult struct {
+	Source       string   `json:"source"`
+	Imported     int      `json:"imported"`
+	Skipped      int      `json:"skipped"`
+	Repositories []string `json:"repositories"`
+	// Targets are the repositories runs were imported into
+	Targets []*db.Repository `json:"-"`
+}
+
+// ImportRuns creates the runs of an import in one transaction, keeping the time they were
+// measured. The source and ImportID are stored in the metadata as import_source and
+// import_id; runs already imported from the same source into the repository are skipped.
+// Quotas apply as for submitted runs, returning a QuotaError. Imports carry no run signatures,
+// so runs for repositories that require signed runs return a SignedRunsError.
+func (s *RunService) ImportRuns(userID uuid.UUID, source string, runs []ImportedRun, repoService *RepositoryService, quotaService *QuotaService) (*ImportResult, error) {
+	result := &ImportResult{Source: source, Repositories: []string{}}
+	now := time.Now()
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		dialect := db.DialectOf(tx)
+		repositories := map[string]*db.Repository{}
+
+		for i := range runs {
+			run := &runs[i]
+
+			var existing int64
+			err := tx.Model(&db.Run{}).
+				Joins("JOIN repositories ON repositories.id = runs.repository_id").
+				Where("repositories.full_name = ? AND repositories.owner_id = ?", run.Repository.FullName, userID).
+				Where(dialect.JSONText("runs.run_metadata", "import_source")+" = ?", source).
+				Where(dialect.JSONText("runs.run_metadata", "import_id")+" = ?", run.ImportID).
+				Count(&existing).Error
+			if err != nil {
+				return fmt.Errorf("failed to query imported runs: %w", err)
+			}
+			if existing > 0 {
+				result.Skipped++
+				continue
+			}
+
+			if err := quotaService.withTx(tx).checkRun(userID, &run.Repository, now); err != nil {
+				return err
+			}
+			repo, ok := repositories[run.Repository.FullName]
+			if !ok {
+				if repo, err = repoService.withTx(tx).CreateOrUpdateRepository(userID, &run.Repository); err != nil {
+					return fmt.Errorf("failed to create/update repository: %w", err)
+				}
+				repositories[run.Repository.FullName] = repo
+			}
+			if repo.SignedRuns {
+				return &SignedRunsError{Repository: repo.FullName}
+			}
+
+			metadata := db.JSONB{}
+			for key, value := range run.Metadata {
+				metadata[key] = value
+			}
+			metadata["import_source"] = source
+			metadata["import_id"] = run.ImportID
+			water, err := runWater(tx, repo, run.EnergyKWh, run.Metadata)
+			if err != nil {
+				return err
+			}
+
+			created := db.Run{
+				UserID:           userID,
+				RepositoryID:     repo.ID,
+				EnergyKWh:        run.EnergyKWh,
+				CO2Kg:            run.CO2Kg,
+				DurationS:        run.DurationS,
+				RunMetadata:      metadata,
+				GitCommitSHA:     run.GitCommitSHA,
+				BranchName:       run.BranchName,
+				WorkflowName:     run.WorkflowName,
+				WorkflowRunGroup: run.WorkflowRunGroup,
+				GitTag:           run.GitTag,
+				Environment:      run.Environment,
+				WaterL:           water,
+				Measurements:     newMeasurements(run.Measurements),
+				GPUEnergyKWh:     run.GPUEnergyKWh,
+				GPUModel:         run.GPUModel,
+				GPUCount:         run.GPUCount,
+				GPUDevices:       newGPUDevices(run.GPUs),
+				ImageBuild:       newImageBuild(run.ImageBuild),
+				CreatedAt:        run.CreatedAt,
+			}
+			s.applyNetworkTransfer(&created, run.NetworkBytes)
+			if err := tx.Create(&created).Error; err != nil {
+				return fmt.Errorf("failed to create run: %w", err)
+			}
+			result.Imported++
+		}
+
+		for fullName, repo := range repositories {
+			result.Repositories = append(result.Repositories, fullName)
+			result.Targets = append(result.Targets, repo)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(result.Repositories)
+	return result, nil
+}
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/github"
+)
+
+// LanguageSyncInterval is how long the languages of a repository are kept before the
+// language-sync job reads them from GitHub again
+const LanguageSyncInterval = 7 * 24 * time.Hour
+
+// MaxLanguageSyncs bounds the repositories one run of the language-sync job reads, keeping
+// it within the GitHub rate limit
+const MaxLanguageSyncs = 500
+
+// LanguageFetcher reads the bytes of code of a repository ("owner/name") in each language
+type LanguageFetcher interface {
+	Languages(ctx context.Context, fullName string) (map[string]int64, error)
+}
+
+// LanguageService keeps the language breakdown of repositories in sync with GitHub
+type LanguageService struct {
+	db      *gorm.DB
+	fetcher LanguageFetcher
+}
+
+// NewLanguageService creates a new language service reading languages with fetcher
+func NewLanguageService(database *gorm.DB, fetcher LanguageFetcher) *LanguageService {
+	return &LanguageService{
+		db:      database,
+		fetcher: fetcher,
+	}
+}
+
+// LanguageShare is the code of a repository in one language and its share of all its code
+type LanguageShare struct {
+	Language string  `json:"language"`
+	Bytes    int64   `json:"bytes"`
+	Share    float64 `json:"share"`
+}
+
+// RepositoryLanguages is the language breakdown of a repository
+type RepositoryLanguages struct {
+	// Primary is the language with the most code, used to group statistics
+	Primary   *string         `json:"primary"`
+	SyncedAt  *time.Time      `json:"synced_at"`
+	Languages []LanguageShare `json:"languages"`
+}
+
+// Sync reads the languages of a repository from GitHub and replaces its breakdown with them.
+// The language with the most code becomes the language of the repository.
+func (s *LanguageService) Sync(ctx context.Context, repo *db.Repository, now time.Time) (*RepositoryLanguages, error) {
+	languages, err := s.fetcher.Languages(ctx, repo.FullName)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]db.RepositoryLanguage, 0, len(languages))
+	for language, bytes := range languages {
+		if language == "" || len(language) > 64 || bytes < 0 {
+			continue
+		}
+		rows = append(rows, db.RepositoryLanguage{RepositoryID: repo.ID, Language: language, Bytes: bytes})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Bytes != rows[j].Bytes {
+			return rows[i].Bytes > rows[j].Bytes
+		}
+		return rows[i].Language < rows[j].Language
+	})
+
+	syncedAt := now.UTC()
+	updates := map[string]interface{}{"languages_synced_at": syncedAt}
+	if len(rows) > 0 {
+		updates["language"] = rows[0].Language
+	}
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("repository_id = ?", repo.ID).Delete(&db.RepositoryLanguage{}).Error; err != nil {
+			return err
+		}
+		if len(rows) > 0 {
+			if err := tx.Create(&rows).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&db.Repository{}).Where("id = ?", repo.ID).UpdateColumns(updates).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save languages: %w", err)
+	}
+
+	repo.LanguagesSyncedAt = &syncedAt
+	if len(rows) > 0 {
+		repo.Language = &rows[0].Language
+	}
+	return s.Languages(repo)
+}
+
+// SyncStale syncs the languages of the repositories never synced or synced longer than
+// LanguageSyncInterval before now, at most MaxLanguageSyncs of them, the least recently synced
+// first. Repositories GitHub cannot show keep their languages but are marked synced, so they
+// are not retried before the interval. It returns the repositories synced and those that
+// failed.
+func (s *LanguageService) SyncStale(ctx context.Context, now time.Time) (synced, failed int, err error) {
+	var repos []db.Repository
+	err = s.db.WithContext(ctx).
+		Where("languages_synced_at IS NULL OR languages_synced_at < ?", now.Add(-LanguageSyncInterval)).
+		Order("languages_synced_at IS NOT NULL, languages_synced_at, id").
+		Limit(MaxLanguageSyncs).
+		Find(&repos).Error
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to list repositories to sync: %w", err)
+	}
+
+	for i := range repos {
+		if err := ctx.Err(); err != nil {
+			return synced, failed, err
+		}
+		_, err := s.Sync(ctx, &repos[i], now)
+		if errors.Is(err, github.ErrNotFound) {
+			err = s.db.WithContext(ctx).Model(&db.Repository{}).Where("id = ?", repos[i].ID).
+				UpdateColumn("languages_synced_at", now.UTC()).Error
+		}
+		if err != nil {
+			log.Printf("Failed to sync languages of %s: %v", repos[i].FullName, err)
+			failed++
+			continue
+		}
+		synced++
+	}
+	return synced, failed, nil
+}
+
+// Languages returns the language breakdown of a repository, the most code first
+func (s *LanguageService) Languages(repo *db.Repository) (*RepositoryLanguages, error) {
+	var rows []db.RepositoryLanguage
+	err := s.db.Where("repository_id = ?", repo.ID).Order("bytes DESC, language").Find(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list languages: %w", err)
+	}
+
+	total := int64(0)
+	for _, row := range rows {
+		total += row.Bytes
+	}
+	breakdown := &RepositoryLanguages{
+		Primary:   repo.Language,
+		SyncedAt:  repo.LanguagesSyncedAt,
+		Languages: make([]LanguageShare, len(rows)),
+	}
+	for i, row := range rows {
+		breakdown.Languages[i] = LanguageShare{Language: row.Language, Bytes: row.Bytes}
+		if total > 0 {
+			breakdown.Languages[i].Share = float64(row.Bytes) / float64(total)
+		}
+	}
+	return breakdown, nil
+}
+
+// LanguageStats aggregates the runs of the repositories with one primary language
+type LanguageStats struct {
+	// Language is nil for the repositories whose language is unknown
+	Language        *string `json:"language"`
+	RepositoryCount int64   `json:"repository_count"`
+	RunCount        int64   `json:"run_count"`
+	TotalCO2Kg      float64 `json:"total_co2_kg"`
+	TotalEnergyKWh  float64 `json:"total_energy_kwh"`
+	TotalDurationS  float64 `json:"total_duration_s"`
+	AvgCO2Kg        float64 `json:"avg_co2_kg"`
+}
+
+// LanguageStats aggregates the runs in scope created between from and to (inclusive) by the
+// primary language of their repository, the most CO2 first
+func (s *StatsService) LanguageStats(scope RunScope, from, to time.Time) ([]LanguageStats, error) {
+	rows, err := s.db.Model(&db.Run{}).
+		Select(`
+			repositories.language,
+			COUNT(DISTINCT runs.repository_id) as repository_count,
+			COUNT(runs.id) as run_count,
+			COALESCE(SUM(runs.co2_kg), 0) as total_co2_kg,
+			COALESCE(SUM(runs.energy_kwh), 0) as total_energy_kwh,
+			COALESCE(SUM(runs.duration_s), 0) as total_duration_s
+		`).
+		Joins("JOIN repositories ON repositories.id = runs.repository_id").
+		Scopes(scope).
+		Where("runs.created_at >= ? AND runs.created_at <= ?", from, to).
+		Group("repositories.language").
+		Order("total_co2_kg DESC").
+		Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute language stats query: %w", err)
+	}
+	defer rows.Close()
+
+	stats := []LanguageStats{}
+	for rows.Next() {
+		var stat LanguageStats
+		if err := rows.Scan(&stat.Language, &stat.RepositoryCount, &stat.RunCount,
+			&stat.TotalCO2Kg, &stat.TotalEnergyKWh, &stat.TotalDurationS); err != nil {
+			return nil, fmt.Errorf("failed to scan language stats: %w", err)
+		}
+		if stat.RunCount > 0 {
+			stat.AvgCO2Kg = stat.TotalCO2Kg / float64(stat.RunCount)
+		}
+		stats = append(stats, stat)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read language stats: %w", err)
+	}
+	return stats, nil
+}
@@ -0,0 +1,156 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Leaderboard ranking criteria
+const (
+	RankByCO2PerRun = "co2_per_run"
+	RankByReduction = "reduction"
+)
+
+// leaderboardPeriods maps the supported leaderboard periods to their length; "all" has no bound
+var leaderboardPeriods = map[string]time.Duration{
+	"week":    7 * 24 * time.Hour,
+	"month":   30 * 24 * time.Hour,
+	"quarter": 90 * 24 * time.Hour,
+	"year":    365 * 24 * time.Hour,
+	"all":     0,
+}
+
+// IsValidLeaderboardPeriod reports whether period is a supported leaderboard period
+func IsValidLeaderboardPeriod(period string) bool {
+	_, ok := leaderboardPeriods[period]
+	return ok
+}
+
+// IsValidRankBy reports whether rankBy is a supported leaderboard ranking
+func IsValidRankBy(rankBy string) bool {
+	return rankBy == RankByCO2PerRun || rankBy == RankByReduction
+}
+
+// LeaderboardQuery describes a leaderboard request
+type LeaderboardQuery struct {
+	RankBy string
+	Period string
+	Limit  int
+	Offset int
+	Now    time.Time
+}
+
+// LeaderboardEntry is a ranked repository on the public leaderboard. Only aggregated,
+// opted-in data is exposed.
+type LeaderboardEntry struct {
+	Rank         int       `json:"rank"`
+	RepositoryID uuid.UUID `json:"repository_id"`
+	FullName     string    `json:"full_name"`
+	HTMLURL      string    `json:"html_url"`
+	RunCount     int64     `json:"run_count"`
+	TotalCO2Kg   float64   `json:"total_co2_kg"`
+	CO2PerRunKg  float64   `json:"co2_per_run_kg"`
+
+	// Reduction fields are only set when ranking by reduction
+	PreviousTotalCO2Kg *float64 `json:"previous_total_co2_kg,omitempty"`
+	ReductionKg        *float64 `json:"reduction_kg,omitempty"`
+	ReductionPercent   *float64 `json:"reduction_percent,omitempty"`
+}
+
+// Leaderboard ranks the public repositories that opted into public stats. Ranking by
+// co2_per_run orders by the lowest average CO2 per run in the period; ranking by reduction
+// orders by the largest drop in total CO2 compared with the preceding period of equal length.
+func (s *StatsService) Leaderboard(q LeaderboardQuery) ([]LeaderboardEntry, int64, error) {
+	length, ok := leaderboardPeriods[q.Period]
+	if !ok {
+		return nil, 0, fmt.Errorf("unsupported period: %s", q.Period)
+	}
+	if !IsValidRankBy(q.RankBy) {
+		return nil, 0, fmt.Errorf("unsupported ranking: %s", q.RankBy)
+	}
+	if q.RankBy == RankByReduction && length == 0 {
+		return nil, 0, fmt.Errorf("ranking by reduction requires a bounded period")
+	}
+
+	from := q.Now.Add(-length)
+	previousFrom := from.Add(-length)
+
+	query := s.db.Table("repositories r").
+		Joins("JOIN runs ON runs.repository_id = r.id AND runs.deleted_at IS NULL").
+		Where("r.public_stats = ? AND r.private = ? AND r.deleted_at IS NULL", true, false).
+		Group("r.id, r.full_name, r.html_url")
+
+	if q.RankBy == RankByReduction {
+		query = query.
+			Select(`r.id, r.full_name, r.html_url,
+				COALESCE(SUM(CASE WHEN runs.created_at >= ? THEN 1 ELSE 0 END), 0) as run_count,
+				COALESCE(SUM(CASE WHEN runs.created_at >= ? THEN runs.co2_kg ELSE 0 END), 0) as total_co2_kg,
+				COALESCE(SUM(CASE WHEN runs.created_at < ? THEN runs.co2_kg ELSE 0 END), 0) as previous_total_co2_kg`,
+				from, from, from).
+			Where("runs.created_at >= ? AND runs.created_at <= ?", previousFrom, q.Now).
+			Having("SUM(CASE WHEN runs.created_at >= ? THEN 1 ELSE 0 END) > 0 AND SUM(CASE WHEN runs.created_at < ? THEN 1 ELSE 0 END) > 0", from, from)
+	} else {
+		query = query.
+			Select(`r.id, r.full_name, r.html_url,
+				COUNT(runs.id) as run_count,
+				COALESCE(SUM(runs.co2_kg), 0) as total_co2_kg,
+				0 as previous_total_co2_kg`)
+		if length > 0 {
+			query = query.Where("runs.created_at >= ? AND runs.created_at <= ?", from, q.Now)
+		}
+	}
+
+	// Count ranked repositories
+	var total int64
+	if err := s.db.Table("(?) as ranked", query).Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count leaderboard entries: %w", err)
+	}
+
+	// Rank on the columns of the aggregate, as PostgreSQL does not resolve select aliases
+	// inside ORDER BY expressions
+	ranked := s.db.Table("(?) AS ranked", query).
+		Select("ranked.id, ranked.full_name, ranked.html_url, ranked.run_count, ranked.total_co2_kg, ranked.previous_total_co2_kg")
+	if q.RankBy == RankByReduction {
+		ranked = ranked.Order("ranked.previous_total_co2_kg - ranked.total_co2_kg DESC").Order("ranked.full_name ASC")
+	} else {
+		ranked = ranked.Order("ranked.total_co2_kg / ranked.run_count ASC").Order("ranked.full_name ASC")
+	}
+
+	rows, err := ranked.Limit(q.Limit).Offset(q.Offset).Rows()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to execute leaderboard query: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []LeaderboardEntry
+	for rows.Next() {
+		var entry LeaderboardEntry
+		var previous float64
+		if err := rows.Scan(&entry.RepositoryID, &entry.FullName, &entry.HTMLURL,
+			&entry.RunCount, &entry.TotalCO2Kg, &previous); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan leaderboard entry: %w", err)
+		}
+
+		entry.Rank = q.Offset + len(entries) + 1
+		if entry.RunCount > 0 {
+			entry.CO2PerRunKg = entry.TotalCO2Kg / float64(entry.RunCount)
+		}
+		if q.RankBy == RankByReduction {
+			reduction := previous - entry.TotalCO2Kg
+			entry.PreviousTotalCO2Kg = &previous
+			entry.ReductionKg = &reduction
+			if previous != 0 {
+				percent := reduction / previous * 100
+				entry.ReductionPercent = &percent
+			}
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read leaderboard entries: %w", err)
+	}
+
+	return entries, total, nil
+}
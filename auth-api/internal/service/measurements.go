@@ -0,0 +1,102 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"time"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// MaxRunMeasurements bounds the measurements a run may be submitted with
+const MaxRunMeasurements = 32
+
+// measurementTypePattern matches measurement types such as gpu_energy
+var measurementTypePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// dataUnits are the units data may be measured in; measurements store bytes
+var dataUnits = []measurementUnit{{"B", 1}, {"kB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12}}
+
+// MeasurementRequest is a metric of a run beyond its energy, CO2 and duration, such as
+// gpu_energy in Wh or network_transfer in MB
+type MeasurementRequest struct {
+	Type  string  `json:"type" example:"gpu_energy"`
+	Value float64 `json:"value" example:"12.5"`
+	Unit  string  `json:"unit" example:"Wh"`
+}
+
+// NormalizeMeasurements validates the measurements of req and converts energy to kWh and data
+// to bytes, so each type aggregates in one unit. Types are lowercase identifiers given at
+// most once per run; values must be non-negative.
+func NormalizeMeasurements(req *RunCreateRequest) error {
+	if len(req.Measurements) > MaxRunMeasurements {
+		return fmt.Errorf("at most %d measurements may be given", MaxRunMeasurements)
+	}
+
+	seen := map[string]bool{}
+	for i := range req.Measurements {
+		measurement := &req.Measurements[i]
+		switch {
+		case !measurementTypePattern.MatchString(measurement.Type):
+			return fmt.Errorf("measurement type %q must be a lowercase identifier of at most 64 characters", measurement.Type)
+		case seen[measurement.Type]:
+			return fmt.Errorf("measurement type %s is given more than once", measurement.Type)
+		case !(measurement.Value >= 0 && !math.IsInf(measurement.Value, 0)):
+			return fmt.Errorf("measurement %s must be non-negative", measurement.Type)
+		case measurement.Unit == "" || len(measurement.Unit) > 16:
+			return fmt.Errorf("measurement %s requires a unit of at most 16 characters", measurement.Type)
+		}
+		seen[measurement.Type] = true
+
+		if unit, ok := lookupUnit(energyUnits, measurement.Unit); ok {
+			measurement.Value, measurement.Unit = measurement.Value*unit.scale, energyUnits[0].name
+		} else if unit, ok := lookupUnit(dataUnits, measurement.Unit); ok {
+			measurement.Value, measurement.Unit = measurement.Value*unit.scale, dataUnits[0].name
+		}
+	}
+	return nil
+}
+
+// newMeasurements returns the measurements of a run from normalized requests
+func newMeasurements(requests []MeasurementRequest) []db.Measurement {
+	if len(requests) == 0 {
+		return nil
+	}
+	measurements := make([]db.Measurement, len(requests))
+	for i, req := range requests {
+		measurements[i] = db.Measurement{Type: req.Type, Value: req.Value, Unit: req.Unit}
+	}
+	return measurements
+}
+
+// MeasurementTotal aggregates a measurement type over the runs that reported it
+type MeasurementTotal struct {
+	Type     string  `json:"type"`
+	Unit     string  `json:"unit"`
+	Total    float64 `json:"total"`
+	Average  float64 `json:"average"`
+	RunCount int64   `json:"run_count"`
+}
+
+// MeasurementTotals aggregates the measurements of the runs in scope created between from
+// and to (inclusive) by type and unit, ordered by type
+func (s *StatsService) MeasurementTotals(scope RunScope, from, to time.Time) ([]MeasurementTotal, error) {
+	totals := []MeasurementTotal{}
+	err := s.db.Model(&db.Measurement{}).
+		Select("measurements.type, measurements.unit, SUM(measurements.value) AS total, COUNT(*) AS run_count").
+		Joins("JOIN runs ON runs.id = measurements.run_id AND runs.deleted_at IS NULL").
+		Scopes(scope).
+		Where("runs.created_at >= ? AND runs.created_at <= ?", from, to).
+		Group("measurements.type, measurements.unit").
+		Order("measurements.type, measurements.unit").
+		Scan(&totals).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate measurements: %w", err)
+	}
+
+	for i := range totals {
+		totals[i].Average = totals[i].Total / float64(totals[i].RunCount)
+	}
+	return totals, nil
+}
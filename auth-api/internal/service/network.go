@@ -0,0 +1,29 @@
+package service
+
+import (
+	"math"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/energy"
+)
+
+// bytesPerGB converts bytes to the GB the network energy factor is given per
+const bytesPerGB = 1e9
+
+// applyNetworkTransfer records the data a run transferred with its energy, from the
+// configured kWh per GB, and its CO2 at the carbon intensity the run was measured with:
+// carbon_intensity of its metadata, else that of its region
+func (s *RunService) applyNetworkTransfer(run *db.Run, networkBytes *int64) {
+	if networkBytes == nil {
+		return
+	}
+	metadata := map[string]interface{}(run.RunMetadata)
+	intensity, ok := metadataFloat(metadata, "carbon_intensity")
+	if !ok || intensity <= 0 {
+		intensity, _ = energy.CarbonIntensity(metadataString(metadata, "region"))
+	}
+
+	energyKWh := math.Round(float64(*networkBytes)/bytesPerGB*s.networkKWhPerGB*1e6) / 1e6
+	co2 := math.Round(energyKWh*intensity/1000*1e6) / 1e6
+	run.NetworkBytes, run.NetworkEnergyKWh, run.NetworkCO2Kg = networkBytes, &energyKWh, &co2
+}
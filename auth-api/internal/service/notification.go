@@ -0,0 +1,253 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// Supported notification providers
+const (
+	NotificationProviderSlack   = "slack"
+	NotificationProviderTeams   = "teams"
+	NotificationProviderDiscord = "discord"
+)
+
+// Notification events that can be routed to a chat channel
+const (
+	NotificationBudgetExceeded     = "budget.exceeded"
+	NotificationRegressionDetected = "regression.detected"
+	NotificationWeeklySummary      = "weekly.summary"
+)
+
+// NotificationProviders lists every supported notification provider
+var NotificationProviders = []string{NotificationProviderSlack, NotificationProviderTeams, NotificationProviderDiscord}
+
+// NotificationEvents lists every notification event
+var NotificationEvents = []string{NotificationBudgetExceeded, NotificationRegressionDetected, NotificationWeeklySummary}
+
+// IsValidNotificationProvider reports whether provider is a supported notification provider
+func IsValidNotificationProvider(provider string) bool {
+	return contains(NotificationProviders, provider)
+}
+
+// IsValidNotificationEvent reports whether event is a notification event
+func IsValidNotificationEvent(event string) bool {
+	return contains(NotificationEvents, event)
+}
+
+// contains reports whether values contains value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// NotificationService handles chat integrations and notification routing
+type NotificationService struct {
+	db *gorm.DB
+}
+
+// NewNotificationService creates a new notification service
+func NewNotificationService(database *gorm.DB) *NotificationService {
+	return &NotificationService{
+		db: database,
+	}
+}
+
+// IntegrationRequest represents the credentials of an organization chat integration.
+// Slack accepts an incoming webhook URL or a bot token; a bot token needs a channel,
+// either as default or on every route. Teams and Discord require a webhook URL, which
+// is bound to a single channel.
+type IntegrationRequest struct {
+	WebhookURL     *string `json:"webhook_url,omitempty" binding:"omitempty,url"`
+	BotToken       *string `json:"bot_token,omitempty"`
+	DefaultChannel *string `json:"default_channel,omitempty"`
+}
+
+// NotificationRouteRequest represents which events of a repository are posted through an
+// integration and to which channel (the integration default when omitted)
+type NotificationRouteRequest struct {
+	Channel *string  `json:"channel,omitempty"`
+	Events  []string `json:"events" binding:"required,min=1"`
+}
+
+// NotificationTarget is an integration and channel a notification is posted to
+type NotificationTarget struct {
+	Integration db.OrganizationIntegration
+	Channel     string
+}
+
+// ListIntegrations retrieves the chat integrations of an organization
+func (s *NotificationService) ListIntegrations(orgID uuid.UUID) ([]db.OrganizationIntegration, error) {
+	integrations := []db.OrganizationIntegration{}
+	if err := s.db.Where("organization_id = ?", orgID).Order("provider ASC").Find(&integrations).Error; err != nil {
+		return nil, fmt.Errorf("failed to list integrations: %w", err)
+	}
+
+	return integrations, nil
+}
+
+// SetIntegration creates or replaces the integration of an organization for a provider
+func (s *NotificationService) SetIntegration(orgID uuid.UUID, provider string, req *IntegrationRequest) (*db.OrganizationIntegration, error) {
+	integration := db.OrganizationIntegration{
+		OrganizationID: orgID,
+		Provider:       provider,
+		WebhookURL:     req.WebhookURL,
+		BotToken:       req.BotToken,
+		DefaultChannel: req.DefaultChannel,
+	}
+
+	err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "organization_id"}, {Name: "provider"}},
+		DoUpdates: clause.AssignmentColumns([]string{"webhook_url", "bot_token", "default_channel", "updated_at"}),
+	}).Create(&integration).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to save integration: %w", err)
+	}
+
+	if err := s.db.Where("organization_id = ? AND provider = ?", orgID, provider).First(&integration).Error; err != nil {
+		return nil, fmt.Errorf("failed to get integration: %w", err)
+	}
+	return &integration, nil
+}
+
+// GetIntegration retrieves the integration of an organization for a provider
+func (s *NotificationService) GetIntegration(orgID uuid.UUID, provider string) (*db.OrganizationIntegration, error) {
+	var integration db.OrganizationIntegration
+	if err := s.db.Where("organization_id = ? AND provider = ?", orgID, provider).First(&integration).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("integration not found")
+		}
+		return nil, fmt.Errorf("failed to get integration: %w", err)
+	}
+
+	return &integration, nil
+}
+
+// DeleteIntegration removes the integration of an organization for a provider
+func (s *NotificationService) DeleteIntegration(orgID uuid.UUID, provider string) error {
+	result := s.db.Where("organization_id = ? AND provider = ?", orgID, provider).Delete(&db.OrganizationIntegration{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete integration: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("integration not found")
+	}
+	return nil
+}
+
+// ListRoutes retrieves the notification routes of a repository
+func (s *NotificationService) ListRoutes(repoID uuid.UUID) ([]db.RepositoryNotificationRoute, error) {
+	routes := []db.RepositoryNotificationRoute{}
+	if err := s.db.Where("repository_id = ?", repoID).Order("provider ASC").Find(&routes).Error; err != nil {
+		return nil, fmt.Errorf("failed to list notification routes: %w", err)
+	}
+
+	return routes, nil
+}
+
+// SetRoute creates or replaces the notification route of a repository for a provider
+func (s *NotificationService) SetRoute(repoID uuid.UUID, provider string, req *NotificationRouteRequest) (*db.RepositoryNotificationRoute, error) {
+	route := db.RepositoryNotificationRoute{
+		RepositoryID: repoID,
+		Provider:     provider,
+		Channel:      req.Channel,
+		Events:       db.StringList(req.Events),
+	}
+
+	err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "repository_id"}, {Name: "provider"}},
+		DoUpdates: clause.AssignmentColumns([]string{"channel", "events", "updated_at"}),
+	}).Create(&route).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to save notification route: %w", err)
+	}
+
+	if err := s.db.Where("repository_id = ? AND provider = ?", repoID, provider).First(&route).Error; err != nil {
+		return nil, fmt.Errorf("failed to get notification route: %w", err)
+	}
+	return &route, nil
+}
+
+// DeleteRoute removes the notification route of a repository for a provider
+func (s *NotificationService) DeleteRoute(repoID uuid.UUID, provider string) error {
+	result := s.db.Where("repository_id = ? AND provider = ?", repoID, provider).Delete(&db.RepositoryNotificationRoute{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete notification route: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("notification route not found")
+	}
+	return nil
+}
+
+// Targets resolves where an event of a repository is posted: every route subscribed to the
+// event whose provider is integrated by the repository's organization. Routes without a
+// channel use the integration default.
+func (s *NotificationService) Targets(repoID uuid.UUID, event string) ([]NotificationTarget, error) {
+	var repo db.Repository
+	if err := s.db.First(&repo, "id = ?", repoID).Error; err != nil {
+		return nil, fmt.Errorf("failed to get repository: %w", err)
+	}
+	if repo.OrganizationID == nil {
+		return nil, nil
+	}
+
+	routes, err := s.ListRoutes(repoID)
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []NotificationTarget
+	for _, route := range routes {
+		if !contains(route.Events, event) {
+			continue
+		}
+
+		var integration db.OrganizationIntegration
+		err := s.db.Where("organization_id = ? AND provider = ?", *repo.OrganizationID, route.Provider).First(&integration).Error
+		if err == gorm.ErrRecordNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get integration: %w", err)
+		}
+
+		target := NotificationTarget{Integration: integration}
+		if route.Channel != nil {
+			target.Channel = *route.Channel
+		} else if integration.DefaultChannel != nil {
+			target.Channel = *integration.DefaultChannel
+		}
+		targets = append(targets, target)
+	}
+
+	return targets, nil
+}
+
+// RepositoriesForEvent retrieves the repositories with a notification route subscribed to event
+func (s *NotificationService) RepositoriesForEvent(event string) ([]db.Repository, error) {
+	var routes []db.RepositoryNotificationRoute
+	if err := s.db.Preload("Repository").Order("repository_id ASC").Find(&routes).Error; err != nil {
+		return nil, fmt.Errorf("failed to list notification routes: %w", err)
+	}
+
+	var repos []db.Repository
+	seen := make(map[uuid.UUID]bool)
+	for _, route := range routes {
+		if route.Repository == nil || seen[route.RepositoryID] || !contains(route.Events, event) {
+			continue
+		}
+		seen[route.RepositoryID] = true
+		repos = append(repos, *route.Repository)
+	}
+	return repos, nil
+}
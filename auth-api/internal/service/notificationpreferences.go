@@ -0,0 +1,223 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// Personal notification events beyond the repository events users receive as owners
+const (
+	NotificationWeeklyDigest    = "weekly.digest"
+	NotificationOrgAnnouncement = "org.announcement"
+)
+
+// Channels users receive their notifications on
+const (
+	NotificationChannelEmail   = "email"
+	NotificationChannelSlackDM = "slack_dm"
+	NotificationChannelNone    = "none"
+)
+
+// Scopes of notification preferences, from the most to the least specific
+const (
+	NotificationScopeRepository   = "repository"
+	NotificationScopeOrganization = "organization"
+	NotificationScopeUser         = "user"
+	NotificationScopeDefault      = "default"
+)
+
+// PersonalNotificationEvents lists the events users choose a channel for
+var PersonalNotificationEvents = []string{
+	NotificationRegressionDetected,
+	NotificationBudgetExceeded,
+	NotificationWeeklyDigest,
+	NotificationOrgAnnouncement,
+}
+
+// NotificationChannels lists every channel of a notification preference
+var NotificationChannels = []string{NotificationChannelEmail, NotificationChannelSlackDM, NotificationChannelNone}
+
+// ErrSlackUserIDRequired is returned when a user chooses Slack direct messages without having
+// set their Slack member ID
+var ErrSlackUserIDRequired = errors.New("set slack_user_id in the preferences before choosing slack_dm")
+
+// NotificationPreferenceRequest chooses the channel of an event for all notifications of the
+// user, or only for those of a repository or an organization
+type NotificationPreferenceRequest struct {
+	Event          string     `json:"event" binding:"required" example:"regression.detected"`
+	Channel        string     `json:"channel" binding:"required" example:"slack_dm"`
+	RepositoryID   *uuid.UUID `json:"repository_id,omitempty"`
+	OrganizationID *uuid.UUID `json:"organization_id,omitempty"`
+}
+
+// ValidateNotificationPreference checks the event, channel and scope of req. The weekly
+// digest covers all runs of a user, so it is only chosen at user scope, and by email as no
+// organization's Slack workspace is involved. Announcements are chosen per organization or
+// for all of them.
+func ValidateNotificationPreference(req *NotificationPreferenceRequest) error {
+	if !contains(PersonalNotificationEvents, req.Event) {
+		return fmt.Errorf("event must be one of %v", PersonalNotificationEvents)
+	}
+	if !contains(NotificationChannels, req.Channel) {
+		return fmt.Errorf("channel must be one of %v", NotificationChannels)
+	}
+	if req.RepositoryID != nil && req.OrganizationID != nil {
+		return fmt.Errorf("set at most one of repository_id and organization_id")
+	}
+
+	switch req.Event {
+	case NotificationWeeklyDigest:
+		if req.RepositoryID != nil || req.OrganizationID != nil {
+			return fmt.Errorf("%s can only be chosen for all notifications", req.Event)
+		}
+		if req.Channel == NotificationChannelSlackDM {
+			return fmt.Errorf("%s is delivered by email or not at all", req.Event)
+		}
+	case NotificationOrgAnnouncement:
+		if req.RepositoryID != nil {
+			return fmt.Errorf("%s can only be chosen per organization", req.Event)
+		}
+	}
+	return nil
+}
+
+// AnnouncementRequest represents an announcement posted to the members of an organization
+type AnnouncementRequest struct {
+	Title string `json:"title" binding:"required,max=200" example:"CI runners move to a greener region"`
+	Text  string `json:"text" binding:"required,max=5000" example:"From Monday all runners run in eu-north-1."`
+}
+
+// NotificationChannel is the channel a user receives an event on and the scope of the
+// preference it comes from
+type NotificationChannel struct {
+	Event   string `json:"event" example:"regression.detected"`
+	Channel string `json:"channel" example:"email"`
+	Scope   string `json:"scope" example:"organization"`
+}
+
+// ListNotificationPreferences retrieves the notification preferences of a user, those for all
+// notifications first
+func (s *UserService) ListNotificationPreferences(userID uuid.UUID) ([]db.NotificationPreference, error) {
+	preferences := []db.NotificationPreference{}
+	err := s.db.Where("user_id = ?", userID).
+		Order("repository_id IS NOT NULL, organization_id IS NOT NULL, event ASC, created_at ASC").
+		Find(&preferences).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notification preferences: %w", err)
+	}
+	return preferences, nil
+}
+
+// GetNotificationPreference retrieves a notification preference by ID
+func (s *UserService) GetNotificationPreference(preferenceID uuid.UUID) (*db.NotificationPreference, error) {
+	var preference db.NotificationPreference
+	if err := s.db.First(&preference, "id = ?", preferenceID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("notification preference not found")
+		}
+		return nil, fmt.Errorf("failed to get notification preference: %w", err)
+	}
+	return &preference, nil
+}
+
+// SetNotificationPreference creates or replaces the preference of a validated req for its
+// event and scope. Choosing Slack direct messages returns ErrSlackUserIDRequired when the
+// user has no Slack member ID.
+func (s *UserService) SetNotificationPreference(userID uuid.UUID, req *NotificationPreferenceRequest) (*db.NotificationPreference, error) {
+	if req.Channel == NotificationChannelSlackDM {
+		stored, err := s.userPreference(userID)
+		if err != nil {
+			return nil, err
+		}
+		if stored.SlackUserID == nil {
+			return nil, ErrSlackUserIDRequired
+		}
+	}
+
+	var preference db.NotificationPreference
+	err := scopedNotificationPreferences(s.db, req.RepositoryID, req.OrganizationID).
+		Where("user_id = ? AND event = ?", userID, req.Event).
+		First(&preference).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return nil, fmt.Errorf("failed to get notification preference: %w", err)
+	}
+
+	preference.UserID = userID
+	preference.Event = req.Event
+	preference.RepositoryID = req.RepositoryID
+	preference.OrganizationID = req.OrganizationID
+	preference.Channel = req.Channel
+	if err := s.db.Save(&preference).Error; err != nil {
+		return nil, fmt.Errorf("failed to save notification preference: %w", err)
+	}
+	return &preference, nil
+}
+
+// DeleteNotificationPreference removes a notification preference, so its event is again
+// received as chosen at the broader scopes
+func (s *UserService) DeleteNotificationPreference(preferenceID uuid.UUID) error {
+	if err := s.db.Where("id = ?", preferenceID).Delete(&db.NotificationPreference{}).Error; err != nil {
+		return fmt.Errorf("failed to delete notification preference: %w", err)
+	}
+	return nil
+}
+
+// ResolveNotificationChannel returns the channel a user receives event on for a repository
+// and its organization, either of which may be nil. The preference of the repository wins
+// over that of the organization, which wins over the one for all notifications; without
+// any, events are emailed.
+func (s *UserService) ResolveNotificationChannel(userID uuid.UUID, event string, repoID, orgID *uuid.UUID) (*NotificationChannel, error) {
+	var preferences []db.NotificationPreference
+	query := s.db.Where("user_id = ? AND event = ?", userID, event)
+	scopes := s.db.Where("repository_id IS NULL AND organization_id IS NULL")
+	if repoID != nil {
+		scopes = scopes.Or("repository_id = ?", *repoID)
+	}
+	if orgID != nil {
+		scopes = scopes.Or("organization_id = ?", *orgID)
+	}
+	if err := query.Where(scopes).Find(&preferences).Error; err != nil {
+		return nil, fmt.Errorf("failed to resolve notification channel: %w", err)
+	}
+
+	resolved := &NotificationChannel{Event: event, Channel: NotificationChannelEmail, Scope: NotificationScopeDefault}
+	rank := map[string]int{NotificationScopeDefault: 0, NotificationScopeUser: 1, NotificationScopeOrganization: 2, NotificationScopeRepository: 3}
+	for _, preference := range preferences {
+		scope := NotificationPreferenceScope(&preference)
+		if rank[scope] > rank[resolved.Scope] {
+			resolved.Channel = preference.Channel
+			resolved.Scope = scope
+		}
+	}
+	return resolved, nil
+}
+
+// NotificationPreferenceScope returns the scope a notification preference applies to
+func NotificationPreferenceScope(preference *db.NotificationPreference) string {
+	switch {
+	case preference.RepositoryID != nil:
+		return NotificationScopeRepository
+	case preference.OrganizationID != nil:
+		return NotificationScopeOrganization
+	default:
+		return NotificationScopeUser
+	}
+}
+
+// scopedNotificationPreferences restricts query to the preferences of exactly one scope
+func scopedNotificationPreferences(query *gorm.DB, repoID, orgID *uuid.UUID) *gorm.DB {
+	if repoID != nil {
+		query = query.Where("repository_id = ?", *repoID)
+	} else {
+		query = query.Where("repository_id IS NULL")
+	}
+	if orgID != nil {
+		return query.Where("organization_id = ?", *orgID)
+	}
+	return query.Where("organization_id IS NULL")
+}
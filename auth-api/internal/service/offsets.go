@@ -0,0 +1,202 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// offsetDateLayout is the layout of the period dates of carbon offsets
+const offsetDateLayout = "2006-01-02"
+
+// CarbonOffsetKinds lists the supported kinds of carbon offsets
+var CarbonOffsetKinds = []string{db.CarbonOffsetKindOffset, db.CarbonOffsetKindRenewable}
+
+// CarbonOffsetRequest represents an offset or renewable energy purchase of an organization.
+// Offsets give the CO2 offset and renewable purchases the energy matched; the period is
+// inclusive.
+type CarbonOffsetRequest struct {
+	Kind           string   `json:"kind" binding:"required" example:"offset"`
+	CO2Kg          *float64 `json:"co2_kg,omitempty" example:"1000"`
+	EnergyKWh      *float64 `json:"energy_kwh,omitempty"`
+	Vendor         string   `json:"vendor" binding:"required,max=255" example:"Climeworks"`
+	CertificateURL *string  `json:"certificate_url,omitempty" binding:"omitempty,max=2048"`
+	PeriodStart    string   `json:"period_start" binding:"required" example:"2024-01-01"`
+	PeriodEnd      string   `json:"period_end" binding:"required" example:"2024-12-31"`
+
+	periodStart time.Time
+	periodEnd   time.Time
+}
+
+// ValidateCarbonOffset checks that req gives the amount of its kind and a valid period
+func ValidateCarbonOffset(req *CarbonOffsetRequest) error {
+	switch {
+	case !contains(CarbonOffsetKinds, req.Kind):
+		return fmt.Errorf("kind must be one of %v", CarbonOffsetKinds)
+	case req.Kind == db.CarbonOffsetKindOffset && (req.CO2Kg == nil || req.EnergyKWh != nil):
+		return fmt.Errorf("offsets require co2_kg and no energy_kwh")
+	case req.Kind == db.CarbonOffsetKindRenewable && (req.EnergyKWh == nil || req.CO2Kg != nil):
+		return fmt.Errorf("renewable purchases require energy_kwh and no co2_kg")
+	case req.CO2Kg != nil && !(*req.CO2Kg > 0 && !math.IsInf(*req.CO2Kg, 0)):
+		return fmt.Errorf("co2_kg must be positive")
+	case req.EnergyKWh != nil && !(*req.EnergyKWh > 0 && !math.IsInf(*req.EnergyKWh, 0)):
+		return fmt.Errorf("energy_kwh must be positive")
+	}
+
+	if req.CertificateURL != nil {
+		u, err := url.Parse(*req.CertificateURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("certificate_url must be an http or https URL")
+		}
+	}
+
+	start, err := time.Parse(offsetDateLayout, req.PeriodStart)
+	if err != nil {
+		return fmt.Errorf("period_start must be a date (YYYY-MM-DD)")
+	}
+	end, err := time.Parse(offsetDateLayout, req.PeriodEnd)
+	if err != nil {
+		return fmt.Errorf("period_end must be a date (YYYY-MM-DD)")
+	}
+	if end.Before(start) {
+		return fmt.Errorf("period_end must not be before period_start")
+	}
+	req.periodStart, req.periodEnd = start, end
+	return nil
+}
+
+// OffsetService handles the carbon offsets and renewable energy purchases of organizations
+type OffsetService struct {
+	db *gorm.DB
+}
+
+// NewOffsetService creates a new offset service
+func NewOffsetService(database *gorm.DB) *OffsetService {
+	return &OffsetService{
+		db: database,
+	}
+}
+
+// ListOffsets retrieves the offsets of an organization, most recent period first
+func (s *OffsetService) ListOffsets(orgID uuid.UUID) ([]db.CarbonOffset, error) {
+	offsets := []db.CarbonOffset{}
+	if err := s.db.Where("organization_id = ?", orgID).Order("period_start DESC, created_at DESC").Find(&offsets).Error; err != nil {
+		return nil, fmt.Errorf("failed to list carbon offsets: %w", err)
+	}
+	return offsets, nil
+}
+
+// CreateOffset records an offset of an organization from a validated request
+func (s *OffsetService) CreateOffset(orgID uuid.UUID, createdByID uuid.UUID, req *CarbonOffsetRequest) (*db.CarbonOffset, error) {
+	offset := db.CarbonOffset{
+		OrganizationID: orgID,
+		Kind:           req.Kind,
+		CO2Kg:          req.CO2Kg,
+		EnergyKWh:      req.EnergyKWh,
+		Vendor:         req.Vendor,
+		CertificateURL: req.CertificateURL,
+		PeriodStart:    req.periodStart,
+		PeriodEnd:      req.periodEnd,
+		CreatedByID:    &createdByID,
+	}
+	if err := s.db.Create(&offset).Error; err != nil {
+		return nil, fmt.Errorf("failed to create carbon offset: %w", err)
+	}
+	return &offset, nil
+}
+
+// GetOffset retrieves an offset of an organization
+func (s *OffsetService) GetOffset(orgID, offsetID uuid.UUID) (*db.CarbonOffset, error) {
+	var offset db.CarbonOffset
+	if err := s.db.Where("organization_id = ?", orgID).First(&offset, "id = ?", offsetID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("carbon offset not found")
+		}
+		return nil, fmt.Errorf("failed to get carbon offset: %w", err)
+	}
+	return &offset, nil
+}
+
+// DeleteOffset removes an offset
+func (s *OffsetService) DeleteOffset(offsetID uuid.UUID) error {
+	result := s.db.Where("id = ?", offsetID).Delete(&db.CarbonOffset{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete carbon offset: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("carbon offset not found")
+	}
+	return nil
+}
+
+// NetEmissions compares the measured (location-based) emissions of a period with the
+// market-based emissions after renewable energy purchases and the net emissions after offsets
+type NetEmissions struct {
+	GrossCO2Kg          float64 `json:"gross_co2_kg"`
+	RenewableMatchedKWh float64 `json:"renewable_matched_kwh"`
+	RenewableCO2Kg      float64 `json:"renewable_co2_kg"`
+	MarketBasedCO2Kg    float64 `json:"market_based_co2_kg"`
+	OffsetCO2Kg         float64 `json:"offset_co2_kg"`
+	NetCO2Kg            float64 `json:"net_co2_kg"`
+}
+
+// NetEmissions computes the market-based and net emissions of an organization over the
+// period of summary from its location-based CO2. Purchases whose period only partly overlaps it count in proportion to
+// the overlap. Renewable energy covers at most the energy used, at the average carbon
+// intensity of the period; emissions are never reported below zero.
+func (s *OffsetService) NetEmissions(orgID uuid.UUID, summary *PeriodSummary) (*NetEmissions, error) {
+	offsets, err := s.ListOffsets(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	var matchedKWh, offsetCO2 float64
+	for _, offset := range offsets {
+		share := periodShare(offset.PeriodStart, offset.PeriodEnd, summary.From, summary.To)
+		if offset.EnergyKWh != nil {
+			matchedKWh += *offset.EnergyKWh * share
+		}
+		if offset.CO2Kg != nil {
+			offsetCO2 += *offset.CO2Kg * share
+		}
+	}
+
+	gross := summary.TotalCO2Kg
+	if summary.LocationBasedCO2Kg != nil {
+		gross = *summary.LocationBasedCO2Kg
+	}
+	emissions := &NetEmissions{
+		GrossCO2Kg:  gross,
+		OffsetCO2Kg: offsetCO2,
+	}
+	emissions.RenewableMatchedKWh = math.Min(matchedKWh, summary.TotalEnergyKWh)
+	if summary.TotalEnergyKWh > 0 {
+		emissions.RenewableCO2Kg = emissions.RenewableMatchedKWh / summary.TotalEnergyKWh * gross
+	}
+	emissions.MarketBasedCO2Kg = math.Max(gross-emissions.RenewableCO2Kg, 0)
+	emissions.NetCO2Kg = math.Max(emissions.MarketBasedCO2Kg-offsetCO2, 0)
+	return emissions, nil
+}
+
+// periodShare returns the share of the inclusive days from start to end that falls between
+// from and to
+func periodShare(start, end, from, to time.Time) float64 {
+	periodEnd := end.AddDate(0, 0, 1)
+	overlapStart, overlapEnd := start, periodEnd
+	if from.After(overlapStart) {
+		overlapStart = from
+	}
+	if to.Before(overlapEnd) {
+		overlapEnd = to
+	}
+	if !overlapEnd.After(overlapStart) {
+		return 0
+	}
+	return float64(overlapEnd.Sub(overlapStart)) / float64(periodEnd.Sub(start))
+}
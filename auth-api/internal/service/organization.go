@@ -0,0 +1,103 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// OrganizationService handles organization-related business logic
+type OrganizationService struct {
+	db *gorm.DB
+}
+
+// NewOrganizationService creates a new organization service
+func NewOrganizationService(database *gorm.DB) *OrganizationService {
+	return &OrganizationService{
+		db: database,
+	}
+}
+
+// GetOrganizationByLogin retrieves an organization by its GitHub login
+func (s *OrganizationService) GetOrganizationByLogin(login string) (*db.Organization, error) {
+	var org db.Organization
+	err := s.db.Where("github_login = ?", login).First(&org).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("organization not found")
+		}
+		return nil, fmt.Errorf("failed to get organization: %w", err)
+	}
+
+	return &org, nil
+}
+
+// IsMember reports whether the user belongs to the organization
+func (s *OrganizationService) IsMember(orgID, userID uuid.UUID) (bool, error) {
+	var count int64
+	if err := s.db.Model(&db.OrganizationMember{}).
+		Where("organization_id = ? AND user_id = ?", orgID, userID).
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check organization membership: %w", err)
+	}
+
+	return count > 0, nil
+}
+
+// IsAdmin checks if a user is an admin of an organization
+func (s *OrganizationService) IsAdmin(orgID, userID uuid.UUID) (bool, error) {
+	var count int64
+	if err := s.db.Model(&db.OrganizationMember{}).
+		Where("organization_id = ? AND user_id = ? AND role = ?", orgID, userID, db.OrganizationRoleAdmin).
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check organization role: %w", err)
+	}
+
+	return count > 0, nil
+}
+
+// ListMembers retrieves the users that belong to an organization
+func (s *OrganizationService) ListMembers(orgID uuid.UUID) ([]db.User, error) {
+	var users []db.User
+	if err := s.db.
+		Where("id IN (SELECT user_id FROM organization_members WHERE organization_id = ?)", orgID).
+		Order("github_username ASC").
+		Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("failed to list organization members: %w", err)
+	}
+
+	return users, nil
+}
+
+// ListUserOrganizations retrieves the organizations a user belongs to
+func (s *OrganizationService) ListUserOrganizations(userID uuid.UUID) ([]db.Organization, error) {
+	var orgs []db.Organization
+	if err := s.db.
+		Where("id IN (SELECT organization_id FROM organization_members WHERE user_id = ?)", userID).
+		Order("github_login ASC").
+		Find(&orgs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list organizations: %w", err)
+	}
+
+	return orgs, nil
+}
+
+// SetPlan assigns a plan to an organization; an empty plan reverts to the default plan
+func (s *OrganizationService) SetPlan(orgID uuid.UUID, plan string) (*db.Organization, error) {
+	var value interface{}
+	if plan != "" {
+		value = plan
+	}
+	if err := s.db.Model(&db.Organization{}).Where("id = ?", orgID).Update("plan", value).Error; err != nil {
+		return nil, fmt.Errorf("failed to update organization plan: %w", err)
+	}
+
+	var org db.Organization
+	if err := s.db.First(&org, "id = ?", orgID).Error; err != nil {
+		return nil, fmt.Errorf("failed to get organization: %w", err)
+	}
+	return &org, nil
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// Phases of the well-known step taxonomy
+const (
+	PhaseCheckout = "checkout"
+	PhaseDeps     = "deps"
+	PhaseBuild    = "build"
+	PhaseTest     = "test"
+	PhaseDeploy   = "deploy"
+	PhaseOther    = "other"
+)
+
+// Phases lists the phases in the order a job runs them, with other last
+var Phases = []string{PhaseCheckout, PhaseDeps, PhaseBuild, PhaseTest, PhaseDeploy, PhaseOther}
+
+// MaxRunSteps bounds the steps a run may be submitted with
+const MaxRunSteps = 500
+
+// maxStepNameLength is the longest step name a run may be submitted with
+const maxStepNameLength = 255
+
+// phaseKeywords classify steps by name: a step belongs to the first phase one of whose
+// prefixes starts a word, or words, of its name. Dependencies come before build and test, so
+// "npm install" is not a build, and deploy before build, so "docker push" is not one either.
+var phaseKeywords = []struct {
+	phase    string
+	prefixes []string
+}{
+	{PhaseCheckout, []string{"checkout", "clone"}},
+	{PhaseDeps, []string{"install", "depend", "deps", "restore", "setup", "vendor", "cache", "download", "npm ci", "go mod", "go get"}},
+	{PhaseDeploy, []string{"deploy", "releas", "publish", "push"}},
+	{PhaseTest, []string{"test", "spec", "lint", "vet", "check", "coverage", "e2e"}},
+	{PhaseBuild, []string{"build", "compil", "make", "package", "bundle", "assemble"}},
+}
+
+// ClassifyStep returns the phase of a step by its name, other when no keyword matches
+func ClassifyStep(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	normalized := " " + strings.Join(words, " ")
+	for _, keywords := range phaseKeywords {
+		for _, prefix := range keywords.prefixes {
+			if strings.Contains(normalized, " "+prefix) {
+				return keywords.phase
+			}
+		}
+	}
+	return PhaseOther
+}
+
+// isPhase reports whether phase is one of the taxonomy
+func isPhase(phase string) bool {
+	for _, known := range Phases {
+		if phase == known {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateSteps checks the steps metadata of a run, if any: a list of at most MaxRunSteps
+// objects with a name, an optional phase of the taxonomy and non-negative energy_kwh, co2_kg,
+// duration_s and start_offset_s
+func ValidateSteps(metadata map[string]interface{}) error {
+	value, ok := metadata["steps"]
+	if !ok {
+		return nil
+	}
+	steps, ok := value.([]interface{})
+	if !ok {
+		return fmt.Errorf("steps must be a list")
+	}
+	if len(steps) > MaxRunSteps {
+		return fmt.Errorf("at most %d steps may be given", MaxRunSteps)
+	}
+	for i, value := range steps {
+		step, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("step %d must be an object", i)
+		}
+		name, _ := step["name"].(string)
+		if name == "" || len(name) > maxStepNameLength {
+			return fmt.Errorf("step %d requires a name of at most %d characters", i, maxStepNameLength)
+		}
+		if phase, ok := step["phase"]; ok {
+			if phase, _ := phase.(string); !isPhase(phase) {
+				return fmt.Errorf("phase of step %q must be one of %s", name, strings.Join(Phases, ", "))
+			}
+		}
+		for _, key := range []string{"energy_kwh", "co2_kg", "duration_s", "start_offset_s"} {
+			if _, given := step[key]; !given {
+				continue
+			}
+			if value, ok := metadataFloat(step, key); !ok || !(value >= 0 && !math.IsInf(value, 0)) {
+				return fmt.Errorf("%s of step %q must be a non-negative number", key, name)
+			}
+		}
+	}
+	return nil
+}
+
+// phasedStep is a step of a run with its phase
+type phasedStep struct {
+	name      string
+	phase     string
+	energyKWh float64
+	co2Kg     float64
+	durationS float64
+	// startOffsetS is when the step started after the run, if given
+	startOffsetS *float64
+}
+
+// runSteps returns the steps of a run by their metadata, classified by name where they have
+// no phase. Steps without co2_kg emit their energy at the carbon intensity of the run.
+// Malformed steps, which runs created before steps were validated may have, are skipped.
+func runSteps(run *db.Run) []phasedStep {
+	values, _ := run.RunMetadata["steps"].([]interface{})
+	steps := make([]phasedStep, 0, len(values))
+	for _, value := range values {
+		step, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := step["name"].(string)
+		phase, _ := step["phase"].(string)
+		if !isPhase(phase) {
+			phase = ClassifyStep(name)
+		}
+		energy, _ := metadataFloat(step, "energy_kwh")
+		co2, ok := metadataFloat(step, "co2_kg")
+		if !ok && run.EnergyKWh > 0 {
+			co2 = energy * run.CO2Kg / run.EnergyKWh
+		}
+		duration, _ := metadataFloat(step, "duration_s")
+		phased := phasedStep{name: name, phase: phase, energyKWh: energy, co2Kg: co2, durationS: duration}
+		if offset, ok := metadataFloat(step, "start_offset_s"); ok {
+			phased.startOffsetS = &offset
+		}
+		steps = append(steps, phased)
+	}
+	return steps
+}
+
+// PhaseStats aggregates the steps of one phase
+type PhaseStats struct {
+	Phase     string  `json:"phase" example:"deps"`
+	StepCount int64   `json:"step_count"`
+	RunCount  int64   `json:"run_count"`
+	EnergyKWh float64 `json:"energy_kwh"`
+	CO2Kg     float64 `json:"co2_kg"`
+	DurationS float64 `json:"duration_s"`
+	// Share is the share of the CO2 of all steps the phase emitted
+	Share float64 `json:"share"`
+	// DominantRunCount is the number of runs whose steps emitted the most in this phase
+	DominantRunCount int64 `json:"dominant_run_count"`
+}
+
+// PhaseBreakdown is the emissions of the steps of the runs of a period by phase
+type PhaseBreakdown struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+	// RunCount is the number of runs with steps
+	RunCount  int64        `json:"run_count"`
+	EnergyKWh float64      `json:"energy_kwh"`
+	CO2Kg     float64      `json:"co2_kg"`
+	Phases    []PhaseStats `json:"phases"`
+}
+
+// PhaseStats aggregates the steps of the runs in scope created between from and to
+// (inclusive) by phase, every phase of the taxonomy in order. Runs without steps are left out.
+func (s *StatsService) PhaseStats(scope RunScope, from, to time.Time) (*PhaseBreakdown, error) {
+	result := &PhaseBreakdown{From: from, To: to, Phases: make([]PhaseStats, len(Phases))}
+	index := map[string]int{}
+	for i, phase := range Phases {
+		result.Phases[i].Phase = phase
+		index[phase] = i
+	}
+
+	err := s.EachRun(scope, from, to, func(run *RunRow) error {
+		steps := runSteps(&run.Run)
+		if len(steps) == 0 {
+			return nil
+		}
+		result.RunCount++
+
+		perPhase := make([]float64, len(Phases))
+		inRun := make([]bool, len(Phases))
+		for _, step := range steps {
+			i := index[step.phase]
+			stats := &result.Phases[i]
+			stats.StepCount++
+			stats.EnergyKWh += step.energyKWh
+			stats.CO2Kg += step.co2Kg
+			stats.DurationS += step.durationS
+			result.EnergyKWh += step.energyKWh
+			result.CO2Kg += step.co2Kg
+			perPhase[i] += step.co2Kg
+			inRun[i] = true
+		}
+		dominant := -1
+		for i := range Phases {
+			if inRun[i] {
+				result.Phases[i].RunCount++
+				if dominant < 0 || perPhase[i] > perPhase[dominant] {
+					dominant = i
+				}
+			}
+		}
+		result.Phases[dominant].DominantRunCount++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.CO2Kg > 0 {
+		for i := range result.Phases {
+			result.Phases[i].Share = result.Phases[i].CO2Kg / result.CO2Kg
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// PlatformUserStats counts the user accounts of the platform
+type PlatformUserStats struct {
+	Total     int64 `json:"total"`
+	Admins    int64 `json:"admins"`
+	Suspended int64 `json:"suspended"`
+	// New counts the accounts created in the last 7 days
+	New int64 `json:"new_last_7_days"`
+	// Active counts the users who submitted runs in the last 7 days
+	Active int64 `json:"active_last_7_days"`
+}
+
+// PlatformRepositoryStats counts the tracked repositories
+type PlatformRepositoryStats struct {
+	Total       int64 `json:"total"`
+	Private     int64 `json:"private"`
+	PublicStats int64 `json:"public_stats"`
+}
+
+// PlatformRunStats summarizes all runs and the recent ingest rate
+type PlatformRunStats struct {
+	Total          int64   `json:"total"`
+	TotalCO2Kg     float64 `json:"total_co2_kg"`
+	TotalEnergyKWh float64 `json:"total_energy_kwh"`
+	LastHour       int64   `json:"last_hour"`
+	Last24Hours    int64   `json:"last_24_hours"`
+	Last7Days      int64   `json:"last_7_days"`
+	// IngestRatePerHour is the average number of runs submitted per hour over the last 24 hours
+	IngestRatePerHour float64 `json:"ingest_rate_per_hour"`
+}
+
+// PlatformStats summarizes the usage of the whole platform for administrators
+type PlatformStats struct {
+	Users        PlatformUserStats       `json:"users"`
+	Repositories PlatformRepositoryStats `json:"repositories"`
+	Runs         PlatformRunStats        `json:"runs"`
+	GeneratedAt  time.Time               `json:"generated_at"`
+}
+
+// PlatformStats computes the platform-wide statistics at now. Run totals are read from the
+// daily rollups; the recent windows count runs directly.
+func (s *StatsService) PlatformStats(now time.Time) (*PlatformStats, error) {
+	now = now.UTC()
+	weekAgo := now.AddDate(0, 0, -7)
+	stats := &PlatformStats{GeneratedAt: now}
+
+	err := s.db.Model(&db.User{}).
+		Select("COUNT(*), "+
+			"COALESCE(SUM(CASE WHEN role = ? THEN 1 ELSE 0 END), 0), "+
+			"COALESCE(SUM(CASE WHEN suspended_at IS NOT NULL THEN 1 ELSE 0 END), 0), "+
+			"COALESCE(SUM(CASE WHEN created_at >= ? THEN 1 ELSE 0 END), 0)", db.RoleAdmin, weekAgo).
+		Row().Scan(&stats.Users.Total, &stats.Users.Admins, &stats.Users.Suspended, &stats.Users.New)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	err = s.db.Model(&db.Repository{}).
+		Select("COUNT(*), "+
+			"COALESCE(SUM(CASE WHEN private THEN 1 ELSE 0 END), 0), "+
+			"COALESCE(SUM(CASE WHEN public_stats THEN 1 ELSE 0 END), 0)").
+		Row().Scan(&stats.Repositories.Total, &stats.Repositories.Private, &stats.Repositories.PublicStats)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count repositories: %w", err)
+	}
+
+	err = s.db.Model(&db.RepositoryDailyRollup{}).
+		Select("COALESCE(SUM(run_count), 0), COALESCE(SUM(total_co2_kg), 0), COALESCE(SUM(total_energy_kwh), 0)").
+		Row().Scan(&stats.Runs.Total, &stats.Runs.TotalCO2Kg, &stats.Runs.TotalEnergyKWh)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sum runs: %w", err)
+	}
+
+	err = s.db.Model(&db.Run{}).
+		Select("COALESCE(SUM(CASE WHEN created_at >= ? THEN 1 ELSE 0 END), 0), "+
+			"COALESCE(SUM(CASE WHEN created_at >= ? THEN 1 ELSE 0 END), 0), "+
+			"COUNT(*), COUNT(DISTINCT user_id)", now.Add(-time.Hour), now.Add(-24*time.Hour)).
+		Where("created_at >= ?", weekAgo).
+		Row().Scan(&stats.Runs.LastHour, &stats.Runs.Last24Hours, &stats.Runs.Last7Days, &stats.Users.Active)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count recent runs: %w", err)
+	}
+	stats.Runs.IngestRatePerHour = float64(stats.Runs.Last24Hours) / 24
+
+	return stats, nil
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// Preference defaults of users that have not set them
+const (
+	DefaultTimezone       = "UTC"
+	DefaultLocale         = "en"
+	DefaultRangeDays      = 30
+	MaxDefaultRangeDays   = 365
+	maxTimezoneNameLength = 64
+	maxLocaleTagLength    = 35
+)
+
+// localePattern matches BCP 47 language tags such as en, de-CH or zh-Hant-TW
+var localePattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// slackUserIDPattern matches Slack member IDs such as U024BE7LH
+var slackUserIDPattern = regexp.MustCompile(`^[UW][A-Z0-9]{2,31}$`)
+
+// Preferences are the settings of a user: how reports are rendered, which optional emails
+// they receive and who sees their profile
+type Preferences struct {
+	Timezone         string           `json:"timezone" example:"Europe/Berlin"`
+	Locale           string           `json:"locale" example:"de-DE"`
+	DefaultRangeDays int              `json:"default_range_days" example:"30"`
+	DisplayUnits     DisplayUnits     `json:"display_units"`
+	Email            EmailPreferences `json:"email"`
+	// SlackUserID is the Slack member ID notifications chosen for Slack are sent to
+	SlackUserID *string `json:"slack_user_id" example:"U024BE7LH"`
+	// ProfileVisibility is who may see the profile of the user: private, organization or public
+	ProfileVisibility string `json:"profile_visibility" example:"public"`
+	// ProfileStats shows the aggregate statistics of the user on their profile
+	ProfileStats bool `json:"profile_stats" example:"true"`
+}
+
+// Location returns the time zone of the preferences, UTC when it cannot be loaded
+func (p *Preferences) Location() *time.Location {
+	location, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// PreferencesRequest represents a partial update of a user's preferences; omitted settings
+// are unchanged. An empty slack_user_id removes it.
+type PreferencesRequest struct {
+	Timezone          *string                  `json:"timezone,omitempty" example:"Europe/Berlin"`
+	Locale            *string                  `json:"locale,omitempty" example:"de-DE"`
+	DefaultRangeDays  *int                     `json:"default_range_days,omitempty" example:"90"`
+	DisplayUnits      *DisplayUnits            `json:"display_units,omitempty"`
+	Email             *EmailPreferencesRequest `json:"email,omitempty"`
+	SlackUserID       *string                  `json:"slack_user_id,omitempty" example:"U024BE7LH"`
+	ProfileVisibility *string                  `json:"profile_visibility,omitempty" example:"organization"`
+	ProfileStats      *bool                    `json:"profile_stats,omitempty" example:"true"`
+}
+
+// ValidatePreferences checks the settings of req, spelling display units as listed
+func ValidatePreferences(req *PreferencesRequest) error {
+	if req.Timezone != nil {
+		if len(*req.Timezone) > maxTimezoneNameLength {
+			return fmt.Errorf("timezone must be at most %d characters", maxTimezoneNameLength)
+		}
+		if _, err := time.LoadLocation(*req.Timezone); err != nil || *req.Timezone == "" || *req.Timezone == "Local" {
+			return fmt.Errorf("timezone must be an IANA time zone such as Europe/Berlin")
+		}
+	}
+	if req.Locale != nil && (len(*req.Locale) > maxLocaleTagLength || !localePattern.MatchString(*req.Locale)) {
+		return fmt.Errorf("locale must be a language tag such as en or de-CH")
+	}
+	if req.DefaultRangeDays != nil && (*req.DefaultRangeDays < 1 || *req.DefaultRangeDays > MaxDefaultRangeDays) {
+		return fmt.Errorf("default_range_days must be between 1 and %d", MaxDefaultRangeDays)
+	}
+	if req.DisplayUnits != nil {
+		if err := ValidateDisplayUnits(req.DisplayUnits); err != nil {
+			return fmt.Errorf("display_units: %w", err)
+		}
+	}
+	if req.SlackUserID != nil && *req.SlackUserID != "" && !slackUserIDPattern.MatchString(*req.SlackUserID) {
+		return fmt.Errorf("slack_user_id must be a Slack member ID such as U024BE7LH")
+	}
+	if req.ProfileVisibility != nil && !contains(ProfileVisibilities, *req.ProfileVisibility) {
+		return fmt.Errorf("profile_visibility must be one of %v", ProfileVisibilities)
+	}
+	return nil
+}
+
+// GetPreferences returns the preferences of a user, with defaults for those never set
+func (s *UserService) GetPreferences(user *db.User) (*Preferences, error) {
+	stored, err := s.userPreference(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &Preferences{
+		Timezone:          stored.Timezone,
+		Locale:            stored.Locale,
+		DefaultRangeDays:  stored.DefaultRangeDays,
+		DisplayUnits:      GetDisplayUnits(user),
+		Email:             *s.GetEmailPreferences(user),
+		SlackUserID:       stored.SlackUserID,
+		ProfileVisibility: stored.ProfileVisibility,
+		ProfileStats:      stored.ProfileStats,
+	}, nil
+}
+
+// UpdatePreferences applies the settings set in a validated req and returns the resulting
+// preferences. Display units and email opt-outs are stored on the user as by
+// UpdateDisplayUnits and UpdateEmailPreferences.
+func (s *UserService) UpdatePreferences(userID uuid.UUID, req *PreferencesRequest) (*Preferences, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		users := &UserService{db: tx}
+		if req.DisplayUnits != nil {
+			if err := users.UpdateDisplayUnits(userID, *req.DisplayUnits); err != nil {
+				return err
+			}
+		}
+		if req.Email != nil {
+			if _, err := users.UpdateEmailPreferences(userID, req.Email); err != nil {
+				return err
+			}
+		}
+		if req.Timezone == nil && req.Locale == nil && req.DefaultRangeDays == nil && req.SlackUserID == nil &&
+			req.ProfileVisibility == nil && req.ProfileStats == nil {
+			return nil
+		}
+
+		stored, err := users.userPreference(userID)
+		if err != nil {
+			return err
+		}
+		if req.Timezone != nil {
+			stored.Timezone = *req.Timezone
+		}
+		if req.Locale != nil {
+			stored.Locale = *req.Locale
+		}
+		if req.DefaultRangeDays != nil {
+			stored.DefaultRangeDays = *req.DefaultRangeDays
+		}
+		if req.SlackUserID != nil {
+			stored.SlackUserID = req.SlackUserID
+			if *req.SlackUserID == "" {
+				stored.SlackUserID = nil
+			}
+		}
+		if req.ProfileVisibility != nil {
+			stored.ProfileVisibility = *req.ProfileVisibility
+		}
+		if req.ProfileStats != nil {
+			stored.ProfileStats = *req.ProfileStats
+		}
+		err = tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"timezone", "locale", "default_range_days", "slack_user_id", "profile_visibility", "profile_stats", "updated_at"}),
+		}).Create(stored).Error
+		if err != nil {
+			return fmt.Errorf("failed to update preferences: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetPreferences(user)
+}
+
+// userPreference returns the stored preferences of a user, or the defaults when there are none
+func (s *UserService) userPreference(userID uuid.UUID) (*db.UserPreference, error) {
+	var stored db.UserPreference
+	err := s.db.Where("user_id = ?", userID).First(&stored).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &db.UserPreference{
+			UserID:            userID,
+			Timezone:          DefaultTimezone,
+			Locale:            DefaultLocale,
+			DefaultRangeDays:  DefaultRangeDays,
+			ProfileVisibility: ProfileVisibilityPrivate,
+		}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get preferences: %w", err)
+	}
+	return &stored, nil
+}
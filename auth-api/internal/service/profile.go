@@ -0,0 +1,102 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// Profile visibilities, from the most to the least restrictive
+const (
+	ProfileVisibilityPrivate      = "private"
+	ProfileVisibilityOrganization = "organization"
+	ProfileVisibilityPublic       = "public"
+)
+
+// ProfileVisibilities lists every visibility of a user profile
+var ProfileVisibilities = []string{ProfileVisibilityPrivate, ProfileVisibilityOrganization, ProfileVisibilityPublic}
+
+// Profile is the page of a user shown to others. Stats are only set when the user opted in
+// and count the runs in repositories the viewer may see.
+type Profile struct {
+	ID             uuid.UUID      `json:"id"`
+	GitHubUsername string         `json:"github_username" example:"octocat"`
+	Name           *string        `json:"name"`
+	AvatarURL      *string        `json:"avatar_url"`
+	Visibility     string         `json:"visibility" example:"public"`
+	CreatedAt      time.Time      `json:"created_at"`
+	Stats          *UserStats     `json:"stats,omitempty"`
+	Badges         []ProfileBadge `json:"badges"`
+}
+
+// ProfileBadge is the CO2 badge of a public repository of the user
+type ProfileBadge struct {
+	RepositoryID uuid.UUID `json:"repository_id"`
+	FullName     string    `json:"full_name" example:"octocat/hello-world"`
+	ImageURL     string    `json:"image_url" example:"https://badge.ecoci.dev/octocat/hello-world.svg"`
+	Markdown     string    `json:"markdown" example:"![CO2](https://badge.ecoci.dev/octocat/hello-world.svg)"`
+}
+
+// CanViewProfile reports whether viewerID may see the profile of a user, returning its
+// settings. Users always see their own profile; anonymous viewers have uuid.Nil and only
+// see public profiles. Suspended users are hidden from everyone else.
+func (s *UserService) CanViewProfile(user *db.User, viewerID uuid.UUID) (bool, *db.UserPreference, error) {
+	settings, err := s.userPreference(user.ID)
+	if err != nil {
+		return false, nil, err
+	}
+	if user.ID == viewerID {
+		return true, settings, nil
+	}
+	if user.SuspendedAt != nil {
+		return false, settings, nil
+	}
+
+	switch settings.ProfileVisibility {
+	case ProfileVisibilityPublic:
+		return true, settings, nil
+	case ProfileVisibilityOrganization:
+		if viewerID == uuid.Nil {
+			return false, settings, nil
+		}
+		var count int64
+		err := s.db.Table("organization_members om").
+			Joins("JOIN organization_members viewer ON viewer.organization_id = om.organization_id").
+			Where("om.user_id = ? AND viewer.user_id = ?", user.ID, viewerID).
+			Count(&count).Error
+		if err != nil {
+			return false, nil, fmt.Errorf("failed to check shared organizations: %w", err)
+		}
+		return count > 0, settings, nil
+	default:
+		return false, settings, nil
+	}
+}
+
+// ProfileBadges returns the badges of the public repositories a user owns that opted into
+// public stats, the ones the badge service at badgeURL renders, by full name
+func (s *RepositoryService) ProfileBadges(ownerID uuid.UUID, badgeURL string) ([]ProfileBadge, error) {
+	var repos []db.Repository
+	err := s.db.Where("owner_id = ? AND private = ? AND public_stats = ?", ownerID, false, true).
+		Order("full_name ASC").
+		Find(&repos).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list badge repositories: %w", err)
+	}
+
+	badges := make([]ProfileBadge, 0, len(repos))
+	for _, repo := range repos {
+		imageURL := strings.TrimSuffix(badgeURL, "/") + "/" + repo.FullName + ".svg"
+		badges = append(badges, ProfileBadge{
+			RepositoryID: repo.ID,
+			FullName:     repo.FullName,
+			ImageURL:     imageURL,
+			Markdown:     fmt.Sprintf("![CO2](%s)", imageURL),
+		})
+	}
+	return badges, nil
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// Quota limits what the repositories of a user or organization on a plan may hold; zero
+// values are unlimited
+type Quota struct {
+	MaxRepositories int `json:"max_repositories"`
+	MaxRunsPerMonth int `json:"max_runs_per_month"`
+	// RetentionDays is how far back runs are listed
+	RetentionDays int `json:"retention_days"`
+}
+
+// Quota resources reported by QuotaError
+const (
+	QuotaRepositories = "repositories"
+	QuotaRunsPerMonth = "runs_per_month"
+)
+
+// QuotaError reports a quota of a plan that a request would exceed
+type QuotaError struct {
+	// Plan is the assigned plan, empty for the default plan
+	Plan     string
+	Resource string
+	Limit    int
+	// ResetAt is when a monthly quota starts over; zero for the number of repositories
+	ResetAt time.Time
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("plan allows %d %s", e.Limit, e.Resource)
+}
+
+// QuotaAccount is the user or organization whose plan applies to repositories: the
+// organization for its repositories, otherwise the owner for their personal repositories
+type QuotaAccount struct {
+	UserID         *uuid.UUID
+	OrganizationID *uuid.UUID
+	// Plan is the assigned plan, empty for the default plan
+	Plan string
+}
+
+// QuotaUsage is what an account holds against the quotas of its plan
+type QuotaUsage struct {
+	Repositories  int64 `json:"repositories"`
+	RunsThisMonth int64 `json:"runs_this_month"`
+	// MonthResetsAt is when the monthly run count starts over
+	MonthResetsAt time.Time `json:"month_resets_at"`
+}
+
+// QuotaService resolves the plans of users and organizations and enforces their quotas
+type QuotaService struct {
+	db     *gorm.DB
+	quotas func(plan string) Quota
+}
+
+// NewQuotaService creates a new quota service; quotas returns the quotas of a plan, with the
+// empty plan being the default plan
+func NewQuotaService(database *gorm.DB, quotas func(plan string) Quota) *QuotaService {
+	return &QuotaService{
+		db:     database,
+		quotas: quotas,
+	}
+}
+
+// WithContext returns a quota service whose queries run with ctx
+func (s *QuotaService) WithContext(ctx context.Context) *QuotaService {
+	return s.withTx(s.db.WithContext(ctx))
+}
+
+func (s *QuotaService) withTx(tx *gorm.DB) *QuotaService {
+	return &QuotaService{
+		db:     tx,
+		quotas: s.quotas,
+	}
+}
+
+// Quota returns the quotas of the plan of account
+func (s *QuotaService) Quota(account *QuotaAccount) Quota {
+	return s.quotas(account.Plan)
+}
+
+// UserAccount returns the account of the personal repositories of a user
+func (s *QuotaService) UserAccount(userID uuid.UUID) (*QuotaAccount, error) {
+	var user db.User
+	if err := s.db.Select("id", "plan").First(&user, "id = ?", userID).Error; err != nil {
+		return nil, fmt.Errorf("failed to get user plan: %w", err)
+	}
+	account := &QuotaAccount{UserID: &user.ID}
+	if user.Plan != nil {
+		account.Plan = *user.Plan
+	}
+	return account, nil
+}
+
+// OrganizationAccount returns the account of the repositories of an organization
+func (s *QuotaService) OrganizationAccount(org *db.Organization) *QuotaAccount {
+	account := &QuotaAccount{OrganizationID: &org.ID}
+	if org.Plan != nil {
+		account.Plan = *org.Plan
+	}
+	return account
+}
+
+// accountFor returns the account of a repository owned by ownerID in organizationID, if any
+func (s *QuotaService) accountFor(ownerID uuid.UUID, organizationID *uuid.UUID) (*QuotaAccount, error) {
+	if organizationID == nil {
+		return s.UserAccount(ownerID)
+	}
+	var org db.Organization
+	if err := s.db.First(&org, "id = ?", *organizationID).Error; err != nil {
+		return nil, fmt.Errorf("failed to get organization plan: %w", err)
+	}
+	return s.OrganizationAccount(&org), nil
+}
+
+// accountRepositories returns a query scope restricting repositories to those of account
+func accountRepositories(account *QuotaAccount) func(*gorm.DB) *gorm.DB {
+	return func(query *gorm.DB) *gorm.DB {
+		if account.OrganizationID != nil {
+			return query.Where("repositories.organization_id = ?", *account.OrganizationID)
+		}
+		return query.Where("repositories.owner_id = ? AND repositories.organization_id IS NULL", *account.UserID)
+	}
+}
+
+// monthStart returns the start of the calendar month (UTC) of now
+func monthStart(now time.Time) time.Time {
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// Usage counts the repositories of account and their runs in the calendar month (UTC) of now
+func (s *QuotaService) Usage(account *QuotaAccount, now time.Time) (*QuotaUsage, error) {
+	start := monthStart(now)
+	usage := &QuotaUsage{MonthResetsAt: start.AddDate(0, 1, 0)}
+
+	if err := s.db.Model(&db.Repository{}).Scopes(accountRepositories(account)).Count(&usage.Repositories).Error; err != nil {
+		return nil, fmt.Errorf("failed to count repositories: %w", err)
+	}
+	err := s.db.Model(&db.Run{}).
+		Joins("JOIN repositories ON repositories.id = runs.repository_id AND repositories.deleted_at IS NULL").
+		Scopes(accountRepositories(account)).
+		Where("runs.created_at >= ?", start).
+		Count(&usage.RunsThisMonth).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to count runs: %w", err)
+	}
+	return usage, nil
+}
+
+// checkRun returns a QuotaError if storing a run of the repository in req for userID at now
+// would exceed the quotas of the repository's plan, counting the repository if it is new
+func (s *QuotaService) checkRun(userID uuid.UUID, req *RepositoryCreateRequest, now time.Time) error {
+	organizationID, err := (&RepositoryService{db: s.db}).organizationIDForFullName(req.FullName)
+	if err != nil {
+		return err
+	}
+	account, err := s.accountFor(userID, organizationID)
+	if err != nil {
+		return err
+	}
+	quota := s.Quota(account)
+	if quota.MaxRepositories == 0 && quota.MaxRunsPerMonth == 0 {
+		return nil
+	}
+
+	usage, err := s.Usage(account, now)
+	if err != nil {
+		return err
+	}
+
+	if quota.MaxRepositories > 0 && usage.Repositories >= int64(quota.MaxRepositories) {
+		var existing int64
+		if err := s.db.Model(&db.Repository{}).Where("full_name = ? AND owner_id = ?", req.FullName, userID).Count(&existing).Error; err != nil {
+			return fmt.Errorf("failed to query repository: %w", err)
+		}
+		if existing == 0 {
+			return &QuotaError{Plan: account.Plan, Resource: QuotaRepositories, Limit: quota.MaxRepositories}
+		}
+	}
+	if quota.MaxRunsPerMonth > 0 && usage.RunsThisMonth >= int64(quota.MaxRunsPerMonth) {
+		return &QuotaError{Plan: account.Plan, Resource: QuotaRunsPerMonth, Limit: quota.MaxRunsPerMonth, ResetAt: usage.MonthResetsAt}
+	}
+	return nil
+}
+
+// RetentionCutoff returns the oldest time the runs of repo are listed from under the
+// retention of its plan, or nil when the plan lists all runs
+func (s *QuotaService) RetentionCutoff(repo *db.Repository, now time.Time) (*time.Time, error) {
+	account, err := s.accountFor(repo.OwnerID, repo.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	days := s.Quota(account).RetentionDays
+	if days == 0 {
+		return nil, nil
+	}
+	cutoff := now.AddDate(0, 0, -days)
+	return &cutoff, nil
+}
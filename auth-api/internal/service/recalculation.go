@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// recalculationBatchSize is how many runs are recomputed per query
+const recalculationBatchSize = 500
+
+// RecalculateRuns recomputes the current-methodology CO2 of the runs that report their cloud
+// region, from their energy and the emission factor of the region in effect on their day.
+// When factors changed since the last recalculation every such run is recomputed, otherwise
+// only the runs not computed yet. The reported CO2 of runs is never changed; the returned
+// report, which is also stored, sums what changed.
+func (s *EmissionFactorService) RecalculateRuns(ctx context.Context, now time.Time) (*db.RecalculationReport, error) {
+	fullScan, err := s.factorsChangedSinceLastRecalculation()
+	if err != nil {
+		return nil, err
+	}
+
+	var factors []db.EmissionFactor
+	if err := s.db.WithContext(ctx).Find(&factors).Error; err != nil {
+		return nil, fmt.Errorf("failed to get emission factors: %w", err)
+	}
+	factorsByRegion := map[string][]db.EmissionFactor{}
+	for _, factor := range factors {
+		factorsByRegion[factor.Region] = append(factorsByRegion[factor.Region], factor)
+	}
+
+	report := &db.RecalculationReport{FullScan: fullScan}
+	regions := map[string]*regionRecalculation{}
+	regionExpr := db.DialectOf(s.db).JSONText("runs.run_metadata", "region")
+	lastID := uuid.Nil
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		query := s.db.WithContext(ctx).
+			Where(regionExpr+" IS NOT NULL AND "+regionExpr+" <> ''").
+			Where("runs.id > ?", lastID)
+		if !fullScan {
+			query = query.Where("runs.recalculated_at IS NULL")
+		}
+		var runs []db.Run
+		if err := query.Order("runs.id ASC").Limit(recalculationBatchSize).Find(&runs).Error; err != nil {
+			return nil, fmt.Errorf("failed to get runs to recalculate: %w", err)
+		}
+		if len(runs) == 0 {
+			break
+		}
+
+		for i := range runs {
+			run := &runs[i]
+			report.RunsScanned++
+			region := normalizeRegion(metadataString(run.RunMetadata, "region"))
+			factor := resolveFactor(region, factorsByRegion[region], run.CreatedAt)
+			current := math.Round(run.EnergyKWh*factor.GramsPerKWh*1e3) / 1e6
+			if run.CurrentCO2Kg != nil && *run.CurrentCO2Kg == current && sameFactor(run, factor) {
+				continue
+			}
+
+			previous := run.CO2Kg
+			if run.CurrentCO2Kg != nil {
+				previous = *run.CurrentCO2Kg
+			}
+			err := s.db.WithContext(ctx).Model(&db.Run{}).Where("id = ?", run.ID).Updates(map[string]interface{}{
+				"current_co2_kg":          current,
+				"emission_factor_id":      factor.FactorID,
+				"emission_factor_version": factor.Version,
+				"recalculated_at":         now,
+			}).Error
+			if err != nil {
+				return nil, fmt.Errorf("failed to update run %s: %w", run.ID, err)
+			}
+
+			report.RunsChanged++
+			report.PreviousCO2Kg += previous
+			report.CurrentCO2Kg += current
+			tally, ok := regions[region]
+			if !ok {
+				tally = &regionRecalculation{}
+				regions[region] = tally
+			}
+			tally.RunsChanged++
+			tally.PreviousCO2Kg += previous
+			tally.CurrentCO2Kg += current
+		}
+		lastID = runs[len(runs)-1].ID
+	}
+
+	report.Regions = db.JSONB{}
+	for region, tally := range regions {
+		report.Regions[region] = tally
+	}
+	if err := s.db.WithContext(ctx).Create(report).Error; err != nil {
+		return nil, fmt.Errorf("failed to record recalculation report: %w", err)
+	}
+	return report, nil
+}
+
+// regionRecalculation sums the runs of a region a recalculation changed
+type regionRecalculation struct {
+	RunsChanged   int64   `json:"runs_changed"`
+	PreviousCO2Kg float64 `json:"previous_co2_kg"`
+	CurrentCO2Kg  float64 `json:"current_co2_kg"`
+}
+
+// sameFactor reports whether the current CO2 of run was computed with factor
+func sameFactor(run *db.Run, factor *ResolvedEmissionFactor) bool {
+	if factor.FactorID == nil {
+		return run.EmissionFactorID == nil
+	}
+	return run.EmissionFactorID != nil && *run.EmissionFactorID == *factor.FactorID &&
+		run.EmissionFactorVersion != nil && *run.EmissionFactorVersion == *factor.Version
+}
+
+// factorsChangedSinceLastRecalculation reports whether an emission factor was created,
+// changed or deleted since the last recalculation, or no recalculation ran yet
+func (s *EmissionFactorService) factorsChangedSinceLastRecalculation() (bool, error) {
+	var last db.RecalculationReport
+	err := s.db.Order("created_at DESC").Limit(1).Find(&last).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to get last recalculation report: %w", err)
+	}
+	if last.ID == uuid.Nil {
+		return true, nil
+	}
+
+	var changed int64
+	if err := s.db.Model(&db.EmissionFactorVersion{}).Where("created_at >= ?", last.CreatedAt).Count(&changed).Error; err != nil {
+		return false, fmt.Errorf("failed to count emission factor changes: %w", err)
+	}
+	return changed > 0, nil
+}
+
+// ListRecalculationReports retrieves the most recent recalculation reports, newest first
+func (s *EmissionFactorService) ListRecalculationReports(limit int) ([]db.RecalculationReport, error) {
+	reports := []db.RecalculationReport{}
+	if err := s.db.Order("created_at DESC").Limit(limit).Find(&reports).Error; err != nil {
+		return nil, fmt.Errorf("failed to list recalculation reports: %w", err)
+	}
+	return reports, nil
+}
@@ -0,0 +1,323 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Types of recommendations
+const (
+	RecommendationCacheDependencies = "cache_dependencies"
+	RecommendationColdCache         = "cold_cache"
+	RecommendationFailedRuns        = "failed_runs"
+	RecommendationOffPeak           = "off_peak"
+	RecommendationOversizedRunner   = "oversized_runner"
+)
+
+const (
+	// minRecommendationRuns is the fewest runs a recommendation is based on
+	minRecommendationRuns = 3
+	// cacheDependenciesMinShare is the share of the emissions of the steps of a workflow from
+	// which installing dependencies dominates them
+	cacheDependenciesMinShare = 0.3
+	// cacheDependenciesSavings is the share of the emissions of installing dependencies that
+	// caching them is estimated to save
+	cacheDependenciesSavings = 0.5
+	// coldCacheMinExcess is how much more a cache miss must emit than a hit, relative to a hit
+	coldCacheMinExcess = 0.2
+	// failedRunsMinShare is the share of failed runs from which failures are worth reducing
+	failedRunsMinShare = 0.1
+	// failedRunsAvoidable is the share of the emissions of failed runs that failing early
+	// is estimated to avoid
+	failedRunsAvoidable = 0.5
+	// offPeakMinSavings is the share of the emissions of scheduled runs a better hour must save
+	offPeakMinSavings = 0.1
+	// oversizedMaxUtilization is the CPU utilization below which a runner is oversized
+	oversizedMaxUtilization = 0.25
+	// oversizedSavings is the share of emissions a runner with half the cores is estimated to
+	// save, as energy roughly scales with the cores of a runner
+	oversizedSavings = 0.5
+)
+
+// failedStatuses are the status and conclusion metadata values of failed runs
+var failedStatuses = map[string]bool{"failure": true, "failed": true, "cancelled": true, "canceled": true, "timed_out": true, "error": true}
+
+// Recommendation is a change to a workflow that would reduce its emissions, with the savings
+// it is estimated to have had over the analyzed period
+type Recommendation struct {
+	Type         string  `json:"type"`
+	WorkflowName *string `json:"workflow_name"`
+	Title        string  `json:"title"`
+	Detail       string  `json:"detail"`
+	// Runs is the number of runs the recommendation is based on
+	Runs                  int64   `json:"runs"`
+	EstimatedSavingsCO2Kg float64 `json:"estimated_savings_co2_kg"`
+}
+
+// Recommendations are the recommendations for the runs of a period, largest savings first
+type Recommendations struct {
+	From                  time.Time        `json:"from"`
+	To                    time.Time        `json:"to"`
+	RunCount              int64            `json:"run_count"`
+	EstimatedSavingsCO2Kg float64          `json:"estimated_savings_co2_kg"`
+	Recommendations       []Recommendation `json:"recommendations"`
+}
+
+// runTally sums the runs of a group
+type runTally struct {
+	runs  int64
+	co2   float64
+	extra float64
+}
+
+func (t *runTally) add(co2 float64) {
+	t.runs++
+	t.co2 += co2
+}
+
+func (t runTally) avg() float64 {
+	if t.runs == 0 {
+		return 0
+	}
+	return t.co2 / float64(t.runs)
+}
+
+// scheduledRun is a scheduled run with the carbon intensity of the grid when it ran
+type scheduledRun struct {
+	energyKWh float64
+	intensity float64
+}
+
+// workflowUsage collects what the analyzers need of the runs of a workflow
+type workflowUsage struct {
+	name      *string
+	total     runTally
+	cacheHit  runTally
+	cacheMiss runTally
+	failed    runTally
+	scheduled []scheduledRun
+	// utilization sums the CPU utilization of the runs that report it in extra
+	utilization runTally
+	cpuCount    float64
+	// steps sums the CO2 of the steps of the runs with steps, and in extra of their deps phase
+	steps runTally
+}
+
+// Recommend analyzes the runs in scope created between from and to and recommends how to
+// reduce their emissions. The analyzers read the metadata runs are submitted with:
+//
+//   - cold_cache compares runs with cache_hit false and true
+//   - failed_runs counts runs with a status or conclusion of failure, cancelled or timed_out
+//   - off_peak compares the carbon_intensity of scheduled runs (github_event_name schedule)
+//     with the cleanest hour of day of all runs
+//   - oversized_runner compares cpu_seconds with duration_s times cpu_count
+//   - cache_dependencies sums the steps of the deps phase
+func (s *StatsService) Recommend(scope RunScope, from, to time.Time) (*Recommendations, error) {
+	result := &Recommendations{From: from, To: to, Recommendations: []Recommendation{}}
+	workflows := map[string]*workflowUsage{}
+	var hourly [24]runTally
+
+	err := s.EachRun(scope, from, to, func(run *RunRow) error {
+		result.RunCount++
+		key := ""
+		if run.WorkflowName != nil {
+			key = *run.WorkflowName
+		}
+		usage, ok := workflows[key]
+		if !ok {
+			usage = &workflowUsage{name: run.WorkflowName}
+			workflows[key] = usage
+		}
+		metadata := run.RunMetadata
+
+		usage.total.add(run.CO2Kg)
+		if hit, ok := metadataBool(metadata, "cache_hit"); ok {
+			if hit {
+				usage.cacheHit.add(run.CO2Kg)
+			} else {
+				usage.cacheMiss.add(run.CO2Kg)
+			}
+		}
+		if runFailed(metadata) {
+			usage.failed.add(run.CO2Kg)
+		}
+		if intensity, ok := metadataFloat(metadata, "carbon_intensity"); ok && intensity > 0 {
+			hourly[run.CreatedAt.UTC().Hour()].add(intensity)
+			if metadataString(metadata, "github_event_name") == "schedule" {
+				usage.scheduled = append(usage.scheduled, scheduledRun{energyKWh: run.EnergyKWh, intensity: intensity})
+			}
+		}
+		cpuSeconds, hasCPU := metadataFloat(metadata, "cpu_seconds")
+		cpuCount, hasCount := metadataFloat(metadata, "cpu_count")
+		if hasCPU && hasCount && cpuCount > 0 && run.DurationS > 0 {
+			usage.utilization.add(run.CO2Kg)
+			usage.utilization.extra += cpuSeconds / (run.DurationS * cpuCount)
+			usage.cpuCount = math.Max(usage.cpuCount, cpuCount)
+		}
+		if steps := runSteps(&run.Run); len(steps) > 0 {
+			usage.steps.runs++
+			for _, step := range steps {
+				usage.steps.co2 += step.co2Kg
+				if step.phase == PhaseDeps {
+					usage.steps.extra += step.co2Kg
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cleanHour, cleanIntensity := -1, 0.0
+	for hour, tally := range hourly {
+		if tally.runs >= minRecommendationRuns && (cleanHour < 0 || tally.avg() < cleanIntensity) {
+			cleanHour, cleanIntensity = hour, tally.avg()
+		}
+	}
+
+	for _, usage := range workflows {
+		name := workflowLabel(usage.name)
+
+		if usage.cacheHit.runs >= minRecommendationRuns && usage.cacheMiss.runs >= minRecommendationRuns &&
+			usage.cacheMiss.avg() > usage.cacheHit.avg()*(1+coldCacheMinExcess) {
+			excess := usage.cacheMiss.avg() - usage.cacheHit.avg()
+			hitRate := float64(usage.cacheHit.runs) / float64(usage.cacheHit.runs+usage.cacheMiss.runs)
+			result.Recommendations = append(result.Recommendations, Recommendation{
+				Type:         RecommendationColdCache,
+				WorkflowName: usage.name,
+				Title:        fmt.Sprintf("Improve the cache hit rate of %s", name),
+				Detail: fmt.Sprintf("%.0f%% of its runs hit the cache. Runs with a cold cache emit %.0f%% more than warm ones; "+
+					"stabilize cache keys, for example by hashing lock files only, and restore from fallback keys.",
+					hitRate*100, excess/usage.cacheHit.avg()*100),
+				Runs:                  usage.cacheHit.runs + usage.cacheMiss.runs,
+				EstimatedSavingsCO2Kg: excess * float64(usage.cacheMiss.runs),
+			})
+		}
+
+		if usage.failed.runs >= minRecommendationRuns && float64(usage.failed.runs) >= failedRunsMinShare*float64(usage.total.runs) {
+			result.Recommendations = append(result.Recommendations, Recommendation{
+				Type:         RecommendationFailedRuns,
+				WorkflowName: usage.name,
+				Title:        fmt.Sprintf("Fail %s earlier", name),
+				Detail: fmt.Sprintf("%d of its %d runs failed or were cancelled, emitting %.3f kg CO2. Run fast checks such as "+
+					"linting first, cancel superseded runs with a concurrency group, and stop on the first failure.",
+					usage.failed.runs, usage.total.runs, usage.failed.co2),
+				Runs:                  usage.failed.runs,
+				EstimatedSavingsCO2Kg: usage.failed.co2 * failedRunsAvoidable,
+			})
+		}
+
+		if cleanHour >= 0 && len(usage.scheduled) >= minRecommendationRuns {
+			var co2, savings float64
+			for _, run := range usage.scheduled {
+				co2 += run.energyKWh * run.intensity / 1000
+				savings += math.Max(run.energyKWh*(run.intensity-cleanIntensity)/1000, 0)
+			}
+			if co2 > 0 && savings >= offPeakMinSavings*co2 {
+				result.Recommendations = append(result.Recommendations, Recommendation{
+					Type:         RecommendationOffPeak,
+					WorkflowName: usage.name,
+					Title:        fmt.Sprintf("Schedule %s at %02d:00 UTC", name, cleanHour),
+					Detail: fmt.Sprintf("Its scheduled runs ran on a grid averaging %.0f g CO2e/kWh, while runs at %02d:00 UTC saw %.0f g CO2e/kWh. "+
+						"Move its cron schedule to that hour.",
+						co2*1000/scheduledEnergy(usage.scheduled), cleanHour, cleanIntensity),
+					Runs:                  int64(len(usage.scheduled)),
+					EstimatedSavingsCO2Kg: savings,
+				})
+			}
+		}
+
+		if usage.utilization.runs >= minRecommendationRuns && usage.cpuCount >= 2 {
+			utilization := usage.utilization.extra / float64(usage.utilization.runs)
+			if utilization < oversizedMaxUtilization {
+				result.Recommendations = append(result.Recommendations, Recommendation{
+					Type:         RecommendationOversizedRunner,
+					WorkflowName: usage.name,
+					Title:        fmt.Sprintf("Use a smaller runner for %s", name),
+					Detail: fmt.Sprintf("Its runs use %.0f%% of the %s CPUs of their runner on average. A runner with half the cores "+
+						"would finish in about the same time.",
+						utilization*100, strconv.FormatFloat(usage.cpuCount, 'f', -1, 64)),
+					Runs:                  usage.utilization.runs,
+					EstimatedSavingsCO2Kg: usage.utilization.co2 * oversizedSavings,
+				})
+			}
+		}
+
+		if usage.steps.runs >= minRecommendationRuns && usage.steps.co2 > 0 &&
+			usage.steps.extra >= cacheDependenciesMinShare*usage.steps.co2 {
+			result.Recommendations = append(result.Recommendations, Recommendation{
+				Type:         RecommendationCacheDependencies,
+				WorkflowName: usage.name,
+				Title:        fmt.Sprintf("Cache the dependencies of %s", name),
+				Detail: fmt.Sprintf("Installing dependencies emits %.0f%% of the CO2 of its steps, %.3f kg over %d runs. "+
+					"Cache the package manager's downloads keyed by the lock file, or build on an image with them installed.",
+					usage.steps.extra/usage.steps.co2*100, usage.steps.extra, usage.steps.runs),
+				Runs:                  usage.steps.runs,
+				EstimatedSavingsCO2Kg: usage.steps.extra * cacheDependenciesSavings,
+			})
+		}
+	}
+
+	sort.SliceStable(result.Recommendations, func(i, j int) bool {
+		a, b := result.Recommendations[i], result.Recommendations[j]
+		if a.EstimatedSavingsCO2Kg != b.EstimatedSavingsCO2Kg {
+			return a.EstimatedSavingsCO2Kg > b.EstimatedSavingsCO2Kg
+		}
+		return a.Title < b.Title
+	})
+	for _, recommendation := range result.Recommendations {
+		result.EstimatedSavingsCO2Kg += recommendation.EstimatedSavingsCO2Kg
+	}
+	return result, nil
+}
+
+// scheduledEnergy returns the energy of scheduled runs in kWh
+func scheduledEnergy(runs []scheduledRun) float64 {
+	var energy float64
+	for _, run := range runs {
+		energy += run.energyKWh
+	}
+	return energy
+}
+
+// workflowLabel names a workflow in recommendations
+func workflowLabel(name *string) string {
+	if name == nil || *name == "" {
+		return "runs without a workflow"
+	}
+	return *name
+}
+
+// metadataString returns a string value of run metadata
+func metadataString(metadata map[string]interface{}, key string) string {
+	value, _ := metadata[key].(string)
+	return value
+}
+
+// metadataFloat returns a number of run metadata, which clients may send as a string
+func metadataFloat(metadata map[string]interface{}, key string) (float64, bool) {
+	switch value := metadata[key].(type) {
+	case float64:
+		return value, true
+	case string:
+		parsed, err := strconv.ParseFloat(value, 64)
+		return parsed, err == nil
+	}
+	return 0, false
+}
+
+// metadataBool returns a boolean of run metadata, which clients may send as a string
+func metadataBool(metadata map[string]interface{}, key string) (bool, bool) {
+	switch value := metadata[key].(type) {
+	case bool:
+		return value, true
+	case string:
+		parsed, err := strconv.ParseBool(value)
+		return parsed, err == nil
+	}
+	return false, false
+}
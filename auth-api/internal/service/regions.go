@@ -0,0 +1,100 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ecoci/auth-api/internal/carbon"
+)
+
+// Criteria regions are ranked by
+const (
+	OptimizeCarbon = "carbon"
+	OptimizeCost   = "cost"
+)
+
+// daysPerMonth converts daily estimates to monthly ones
+const daysPerMonth = 30
+
+// RunProfile is the typical run of a period, which region estimates are based on
+type RunProfile struct {
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+	RunCount   int64     `json:"run_count"`
+	EnergyKWh  float64   `json:"energy_kwh_per_run"`
+	DurationS  float64   `json:"duration_s_per_run"`
+	RunsPerDay float64   `json:"runs_per_day"`
+}
+
+// RegionEstimate is the forecast of a candidate region with what the typical run would emit and
+// cost there. Estimates are nil without runs in the profile, and costs without a price.
+type RegionEstimate struct {
+	carbon.RegionForecast
+	CO2KgPerRun    *float64 `json:"co2_kg_per_run"`
+	CO2KgPerMonth  *float64 `json:"co2_kg_per_month"`
+	PricePerMinute *float64 `json:"price_per_minute"`
+	CostPerRun     *float64 `json:"cost_per_run"`
+	CostPerMonth   *float64 `json:"cost_per_month"`
+}
+
+// RunProfile returns the average energy and duration of the runs in scope created between from
+// and to, and how many ran per day
+func (s *StatsService) RunProfile(scope RunScope, from, to time.Time) (*RunProfile, error) {
+	summary, err := s.summarize(scope, from, to, "runs.created_at >= ? AND runs.created_at <= ?")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get run profile: %w", err)
+	}
+	profile := &RunProfile{From: from, To: to, RunCount: summary.RunCount}
+	if summary.RunCount > 0 {
+		profile.EnergyKWh = summary.TotalEnergyKWh / float64(summary.RunCount)
+		profile.DurationS = summary.TotalDurationS / float64(summary.RunCount)
+	}
+	if days := to.Sub(from).Hours() / 24; days > 0 {
+		profile.RunsPerDay = float64(summary.RunCount) / days
+	}
+	return profile, nil
+}
+
+// RankRegions estimates the emissions and costs of the typical run of profile in each region
+// and ranks the regions, the recommended one first. Runs are assumed to need the same energy
+// and time everywhere, so carbon ranks by forecast intensity and cost by price per minute,
+// which prices must then hold for every region; ties are broken by the other criterion.
+func RankRegions(profile *RunProfile, forecasts []carbon.RegionForecast, prices map[string]float64, optimize string) []RegionEstimate {
+	estimates := make([]RegionEstimate, len(forecasts))
+	for i, forecast := range forecasts {
+		estimate := RegionEstimate{RegionForecast: forecast}
+		if profile.RunCount > 0 {
+			perRun := profile.EnergyKWh * forecast.Average / 1000
+			perMonth := perRun * profile.RunsPerDay * daysPerMonth
+			estimate.CO2KgPerRun, estimate.CO2KgPerMonth = &perRun, &perMonth
+		}
+		if price, ok := prices[forecast.Region]; ok {
+			estimate.PricePerMinute = &price
+			if profile.RunCount > 0 {
+				perRun := price * profile.DurationS / 60
+				perMonth := perRun * profile.RunsPerDay * daysPerMonth
+				estimate.CostPerRun, estimate.CostPerMonth = &perRun, &perMonth
+			}
+		}
+		estimates[i] = estimate
+	}
+
+	price := func(estimate RegionEstimate) float64 {
+		if estimate.PricePerMinute == nil {
+			return 0
+		}
+		return *estimate.PricePerMinute
+	}
+	sort.SliceStable(estimates, func(i, j int) bool {
+		a, b := estimates[i], estimates[j]
+		if optimize == OptimizeCost && price(a) != price(b) {
+			return price(a) < price(b)
+		}
+		if a.Average != b.Average {
+			return a.Average < b.Average
+		}
+		return price(a) < price(b)
+	})
+	return estimates
+}
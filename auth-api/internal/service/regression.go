@@ -0,0 +1,89 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// Regression detection tuning
+const (
+	// RegressionHistorySize is the number of preceding runs a run is compared with
+	RegressionHistorySize = 20
+	// RegressionMinHistory is the number of preceding runs needed before regressions are reported
+	RegressionMinHistory = 5
+	// RegressionThresholdPercent is the CO2 increase over the recent average that counts as a regression
+	RegressionThresholdPercent = 20.0
+)
+
+// Regression describes a run whose CO2 is significantly above the recent runs of the
+// same workflow and branch
+type Regression struct {
+	RunID            uuid.UUID `json:"run_id"`
+	RepositoryID     uuid.UUID `json:"repository_id"`
+	WorkflowName     *string   `json:"workflow_name"`
+	BranchName       *string   `json:"branch_name"`
+	GitCommitSHA     *string   `json:"git_commit_sha"`
+	CO2Kg            float64   `json:"co2_kg"`
+	RecentAvgCO2Kg   float64   `json:"recent_avg_co2_kg"`
+	ChangePercent    float64   `json:"change_percent"`
+	RecentRunCount   int64     `json:"recent_run_count"`
+	ThresholdPercent float64   `json:"threshold_percent"`
+}
+
+// DetectRegression compares run with the preceding runs of the same repository, workflow
+// and branch. It returns nil when there is not enough history or the increase stays
+// below RegressionThresholdPercent.
+func (s *StatsService) DetectRegression(run *db.Run) (*Regression, error) {
+	recent := s.db.Model(&db.Run{}).
+		Select("runs.co2_kg").
+		Where("runs.repository_id = ? AND runs.id <> ? AND runs.created_at <= ?", run.RepositoryID, run.ID, run.CreatedAt).
+		Scopes(matchingNullable("runs.workflow_name", run.WorkflowName), matchingNullable("runs.branch_name", run.BranchName)).
+		Order("runs.created_at DESC").
+		Limit(RegressionHistorySize)
+
+	var history struct {
+		AvgCO2Kg float64
+		RunCount int64
+	}
+	err := s.db.Table("(?) as recent", recent).
+		Select("COALESCE(AVG(recent.co2_kg), 0) as avg_co2_kg, COUNT(*) as run_count").
+		Scan(&history).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recent runs: %w", err)
+	}
+
+	if history.RunCount < RegressionMinHistory || history.AvgCO2Kg <= 0 {
+		return nil, nil
+	}
+	change := (run.CO2Kg - history.AvgCO2Kg) / history.AvgCO2Kg * 100
+	if change < RegressionThresholdPercent {
+		return nil, nil
+	}
+
+	return &Regression{
+		RunID:            run.ID,
+		RepositoryID:     run.RepositoryID,
+		WorkflowName:     run.WorkflowName,
+		BranchName:       run.BranchName,
+		GitCommitSHA:     run.GitCommitSHA,
+		CO2Kg:            run.CO2Kg,
+		RecentAvgCO2Kg:   history.AvgCO2Kg,
+		ChangePercent:    change,
+		RecentRunCount:   history.RunCount,
+		ThresholdPercent: RegressionThresholdPercent,
+	}, nil
+}
+
+// matchingNullable matches column against value, treating nil as SQL NULL
+func matchingNullable(column string, value *string) func(*gorm.DB) *gorm.DB {
+	return func(query *gorm.DB) *gorm.DB {
+		if value == nil {
+			return query.Where(column + " IS NULL")
+		}
+		return query.Where(column+" = ?", *value)
+	}
+}
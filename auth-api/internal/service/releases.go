@@ -0,0 +1,99 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// ErrReleaseNotFound is returned for tags no run of a repository was submitted for
+var ErrReleaseNotFound = errors.New("release not found")
+
+// ReleaseStats is the CI that produced a release: the runs of a repository after the previous
+// release up to the last run of the release's tag
+type ReleaseStats struct {
+	Tag         string  `json:"tag" example:"v1.2.0"`
+	PreviousTag *string `json:"previous_tag"`
+	// From is when the previous release was produced, nil for the first release
+	From *time.Time `json:"from"`
+	// ReleasedAt is the time of the last run of the tag
+	ReleasedAt time.Time `json:"released_at"`
+	// TaggedRunCount is the number of runs submitted for the tag itself
+	TaggedRunCount int64   `json:"tagged_run_count"`
+	RunCount       int64   `json:"run_count"`
+	TotalCO2Kg     float64 `json:"total_co2_kg"`
+	TotalEnergyKWh float64 `json:"total_energy_kwh"`
+	TotalDurationS float64 `json:"total_duration_s"`
+	TotalWaterL    float64 `json:"total_water_l"`
+}
+
+// releaseTag is a tag of a repository with the time of its last run
+type releaseTag struct {
+	tag        string
+	releasedAt time.Time
+	runs       int64
+}
+
+// ReleaseStats sums the runs of a repository that produced the release of tag: those created
+// after the last run of the previous tag, the tag whose last run came before the last run of
+// this one, up to and including the last run of this tag
+func (s *StatsService) ReleaseStats(repoID uuid.UUID, tag string) (*ReleaseStats, error) {
+	tagged := s.db.Model(&db.Run{}).
+		Select("runs.git_tag, MAX(runs.created_at) as released_at, COUNT(runs.id) as run_count").
+		Where("runs.repository_id = ? AND runs.git_tag IS NOT NULL", repoID).
+		Group("runs.git_tag")
+	release, err := s.scanReleaseTag(tagged.Session(&gorm.Session{}).Where("runs.git_tag = ?", tag))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get release: %w", err)
+	}
+	if release == nil {
+		return nil, ErrReleaseNotFound
+	}
+	previous, err := s.scanReleaseTag(tagged.Session(&gorm.Session{}).
+		Having("MAX(runs.created_at) < ?", release.releasedAt).
+		Order("released_at DESC").
+		Limit(1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get previous release: %w", err)
+	}
+
+	stats := &ReleaseStats{Tag: tag, ReleasedAt: release.releasedAt, TaggedRunCount: release.runs}
+	from := time.Time{}
+	if previous != nil {
+		stats.PreviousTag, stats.From = &previous.tag, &previous.releasedAt
+		from = previous.releasedAt
+	}
+	summary, err := s.summarize(RepositoryRuns(repoID), from, release.releasedAt, "runs.created_at > ? AND runs.created_at <= ?")
+	if err != nil {
+		return nil, fmt.Errorf("failed to summarize release: %w", err)
+	}
+	stats.RunCount = summary.RunCount
+	stats.TotalCO2Kg = summary.TotalCO2Kg
+	stats.TotalEnergyKWh = summary.TotalEnergyKWh
+	stats.TotalDurationS = summary.TotalDurationS
+	stats.TotalWaterL = summary.TotalWaterL
+	return stats, nil
+}
+
+// scanReleaseTag returns the first tag of a query of tags, or nil when there is none
+func (s *StatsService) scanReleaseTag(query *gorm.DB) (*releaseTag, error) {
+	rows, err := query.Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	var tag releaseTag
+	if err := rows.Scan(&tag.tag, db.ScanTime(&tag.releasedAt), &tag.runs); err != nil {
+		return nil, err
+	}
+	return &tag, nil
+}
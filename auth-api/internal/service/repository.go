@@ -1,12 +1,17 @@
 package service
 
 import (
+	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/filter"
 )
 
 // RepositoryService handles repository-related business logic
@@ -21,6 +26,21 @@ func NewRepositoryService(database *gorm.DB) *RepositoryService {
 	}
 }
 
+// withTx returns a copy of the service bound to the given transaction
+// WithContext returns a repository service whose queries run with ctx, so they are canceled
+// with it and traced as part of its span
+func (s *RepositoryService) WithContext(ctx context.Context) *RepositoryService {
+	return &RepositoryService{
+		db: s.db.WithContext(ctx),
+	}
+}
+
+func (s *RepositoryService) withTx(tx *gorm.DB) *RepositoryService {
+	return &RepositoryService{
+		db: tx,
+	}
+}
+
 // RepositoryCreateRequest represents the data needed to create/update a repository
 type RepositoryCreateRequest struct {
 	Name        string  `json:"name"`
@@ -28,14 +48,29 @@ type RepositoryCreateRequest struct {
 	Description *string `json:"description"`
 	Private     bool    `json:"private"`
 	HTMLURL     string  `json:"html_url"`
+	Language    *string `json:"language,omitempty"`
+	SizeKB      *int64  `json:"size_kb,omitempty" validate:"omitempty,min=0"`
+}
+
+// RepositorySettings represents the owner-controlled settings of a repository; nil fields are left unchanged
+type RepositorySettings struct {
+	PublicStats    *bool
+	BenchmarkOptIn *bool
+	CommitStatus   *bool
 }
 
 // CreateOrUpdateRepository creates or updates a repository
 func (s *RepositoryService) CreateOrUpdateRepository(ownerID uuid.UUID, req *RepositoryCreateRequest) (*db.Repository, error) {
 	var repo db.Repository
 
+	// Link the repository to its organization when the owner is a known GitHub organization
+	organizationID, err := s.organizationIDForFullName(req.FullName)
+	if err != nil {
+		return nil, err
+	}
+
 	// Try to find existing repository by full name and owner
-	err := s.db.Where("full_name = ? AND owner_id = ?", req.FullName, ownerID).First(&repo).Error
+	err = s.db.Where("full_name = ? AND owner_id = ?", req.FullName, ownerID).First(&repo).Error
 	if err != nil && err != gorm.ErrRecordNotFound {
 		return nil, fmt.Errorf("failed to query repository: %w", err)
 	}
@@ -43,12 +78,15 @@ func (s *RepositoryService) CreateOrUpdateRepository(ownerID uuid.UUID, req *Rep
 	// If repository doesn't exist, create new one
 	if err == gorm.ErrRecordNotFound {
 		repo = db.Repository{
-			OwnerID:     ownerID,
-			Name:        req.Name,
-			FullName:    req.FullName,
-			Description: req.Description,
-			Private:     req.Private,
-			HTMLURL:     req.HTMLURL,
+			OwnerID:        ownerID,
+			OrganizationID: organizationID,
+			Name:           req.Name,
+			FullName:       req.FullName,
+			Description:    req.Description,
+			Private:        req.Private,
+			HTMLURL:        req.HTMLURL,
+			Language:       req.Language,
+			SizeKB:         req.SizeKB,
 		}
 
 		if err := s.db.Create(&repo).Error; err != nil {
@@ -60,6 +98,13 @@ func (s *RepositoryService) CreateOrUpdateRepository(ownerID uuid.UUID, req *Rep
 		repo.Description = req.Description
 		repo.Private = req.Private
 		repo.HTMLURL = req.HTMLURL
+		repo.OrganizationID = organizationID
+		if req.Language != nil {
+			repo.Language = req.Language
+		}
+		if req.SizeKB != nil {
+			repo.SizeKB = req.SizeKB
+		}
 
 		if err := s.db.Save(&repo).Error; err != nil {
 			return nil, fmt.Errorf("failed to update repository: %w", err)
@@ -69,6 +114,108 @@ func (s *RepositoryService) CreateOrUpdateRepository(ownerID uuid.UUID, req *Rep
 	return &repo, nil
 }
 
+// organizationIDForFullName resolves the organization owning an "owner/repo" full name, if it is known
+func (s *RepositoryService) organizationIDForFullName(fullName string) (*uuid.UUID, error) {
+	ownerLogin, _, found := strings.Cut(fullName, "/")
+	if !found || ownerLogin == "" {
+		return nil, nil
+	}
+
+	var org db.Organization
+	err := s.db.Where("github_login = ?", ownerLogin).First(&org).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to query organization: %w", err)
+	}
+
+	return &org.ID, nil
+}
+
+// VisibleTo returns a query scope restricting repositories (aliased as r) to those the user may see:
+// public repositories, repositories they own, collaborate on, or that belong to one of their organizations
+func VisibleTo(userID uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return func(query *gorm.DB) *gorm.DB {
+		return query.Where(`(r.private = ? OR `+accessibleRepositoryCondition+`)`,
+			false, userID, userID, userID)
+	}
+}
+
+// accessibleRepositoryCondition matches repositories (aliased as r) the user owns, collaborates on,
+// or that belong to one of their organizations; it expects the user ID three times
+const accessibleRepositoryCondition = `(r.owner_id = ?
+	OR EXISTS (SELECT 1 FROM repository_collaborators rc WHERE rc.repository_id = r.id AND rc.user_id = ?)
+	OR EXISTS (SELECT 1 FROM organization_members om WHERE om.organization_id = r.organization_id AND om.user_id = ?))`
+
+// CanViewRepository reports whether the user is allowed to see the repository and its runs
+func (s *RepositoryService) CanViewRepository(repoID, userID uuid.UUID) (bool, error) {
+	var count int64
+	err := s.db.Table("repositories r").
+		Scopes(VisibleTo(userID)).
+		Where("r.id = ? AND r.deleted_at IS NULL", repoID).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to check repository visibility: %w", err)
+	}
+
+	return count > 0, nil
+}
+
+// ListCollaborators retrieves the collaborators of a repository
+func (s *RepositoryService) ListCollaborators(repoID uuid.UUID) ([]db.RepositoryCollaborator, error) {
+	var collaborators []db.RepositoryCollaborator
+	if err := s.db.Preload("User").
+		Where("repository_id = ?", repoID).
+		Order("created_at ASC").
+		Find(&collaborators).Error; err != nil {
+		return nil, fmt.Errorf("failed to list collaborators: %w", err)
+	}
+
+	return collaborators, nil
+}
+
+// AddCollaborator grants a user access to a repository
+func (s *RepositoryService) AddCollaborator(repoID, userID uuid.UUID) (*db.RepositoryCollaborator, error) {
+	collaborator := db.RepositoryCollaborator{
+		RepositoryID: repoID,
+		UserID:       userID,
+	}
+
+	var count int64
+	if err := s.db.Model(&db.RepositoryCollaborator{}).
+		Where("repository_id = ? AND user_id = ?", repoID, userID).
+		Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("failed to query collaborator: %w", err)
+	}
+
+	if count == 0 {
+		if err := s.db.Create(&collaborator).Error; err != nil {
+			return nil, fmt.Errorf("failed to add collaborator: %w", err)
+		}
+	}
+
+	if err := s.db.Preload("User").
+		Where("repository_id = ? AND user_id = ?", repoID, userID).
+		First(&collaborator).Error; err != nil {
+		return nil, fmt.Errorf("failed to load collaborator: %w", err)
+	}
+
+	return &collaborator, nil
+}
+
+// RemoveCollaborator revokes a user's access to a repository
+func (s *RepositoryService) RemoveCollaborator(repoID, userID uuid.UUID) error {
+	result := s.db.Where("repository_id = ? AND user_id = ?", repoID, userID).Delete(&db.RepositoryCollaborator{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to remove collaborator: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("collaborator not found")
+	}
+	return nil
+}
+
 // GetRepositoryByID retrieves a repository by ID
 func (s *RepositoryService) GetRepositoryByID(repoID uuid.UUID) (*db.Repository, error) {
 	var repo db.Repository
@@ -83,9 +230,43 @@ func (s *RepositoryService) GetRepositoryByID(repoID uuid.UUID) (*db.Repository,
 	return &repo, nil
 }
 
-// ListRepositoriesWithStats retrieves repositories with CO2 statistics
+// UpdateSettings applies the non-nil settings to a repository
+func (s *RepositoryService) UpdateSettings(repoID uuid.UUID, settings RepositorySettings) (*db.Repository, error) {
+	updates := map[string]interface{}{}
+	if settings.PublicStats != nil {
+		updates["public_stats"] = *settings.PublicStats
+	}
+	if settings.BenchmarkOptIn != nil {
+		updates["benchmark_opt_in"] = *settings.BenchmarkOptIn
+	}
+	if settings.CommitStatus != nil {
+		updates["commit_status"] = *settings.CommitStatus
+	}
+
+	if len(updates) > 0 {
+		result := s.db.Model(&db.Repository{}).Where("id = ?", repoID).Updates(updates)
+		if result.Error != nil {
+			return nil, fmt.Errorf("failed to update repository settings: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil, fmt.Errorf("repository not found")
+		}
+	}
+
+	return s.GetRepositoryByID(repoID)
+}
+
+// ListRepositoriesWithStats retrieves repositories with CO2 statistics computed from their daily rollups
 func (s *RepositoryService) ListRepositoriesWithStats(limit, offset int, sortBy, order string, filters map[string]interface{}) ([]db.RepositoryStats, int64, error) {
-	// Build base query with joins and aggregations
+	rollups := s.db.Table("repository_daily_rollups").
+		Select(`repository_id,
+			SUM(run_count) as run_count,
+			SUM(total_co2_kg) as total_co2_kg,
+			SUM(total_energy_kwh) as total_energy_kwh,
+			MAX(last_run_at) as last_run_at`).
+		Group("repository_id")
+
+	// Build base query joined with the per-repository totals
 	query := s.db.Table("repositories r").
 		Select(`
 			r.id, r.owner_id, r.github_repo_id, r.name, r.full_name, r.description, 
@@ -93,24 +274,42 @@ func (s *RepositoryService) ListRepositoriesWithStats(limit, offset int, sortBy,
 			u.id as "owner.id", u.github_username as "owner.github_username", 
 			u.github_email as "owner.github_email", u.avatar_url as "owner.avatar_url",
 			u.name as "owner.name", u.created_at as "owner.created_at",
-			COALESCE(SUM(runs.co2_kg), 0) as total_co2_kg,
-			COALESCE(AVG(runs.co2_kg), 0) as avg_co2_kg,
-			COALESCE(SUM(runs.energy_kwh), 0) as total_energy_kwh,
-			COALESCE(AVG(runs.energy_kwh), 0) as avg_energy_kwh,
-			COALESCE(COUNT(runs.id), 0) as run_count,
-			COALESCE(MAX(runs.created_at), r.created_at) as last_run_at
+			totals.total_co2_kg as total_co2_kg,
+			CAST(totals.total_co2_kg AS DOUBLE PRECISION) / totals.run_count as avg_co2_kg,
+			totals.total_energy_kwh as total_energy_kwh,
+			CAST(totals.total_energy_kwh AS DOUBLE PRECISION) / totals.run_count as avg_energy_kwh,
+			totals.run_count as run_count,
+			totals.last_run_at as last_run_at
 		`).
 		Joins("LEFT JOIN users u ON r.owner_id = u.id").
-		Joins("LEFT JOIN runs ON r.id = runs.repository_id").
-		Group("r.id, u.id").
-		Having("COUNT(runs.id) > 0") // Only include repos with runs
+		Joins("JOIN (?) totals ON totals.repository_id = r.id", rollups).
+		Where("r.deleted_at IS NULL").
+		Where("totals.run_count > 0") // Only include repos with runs
+
+	// Apply visibility scoping
+	if viewerID, ok := filters["viewer_id"].(uuid.UUID); ok {
+		query = query.Scopes(VisibleTo(viewerID))
+
+		if mine, ok := filters["mine"].(bool); ok && mine {
+			query = query.Where(accessibleRepositoryCondition, viewerID, viewerID, viewerID)
+		}
+	}
+	switch filters["visibility"] {
+	case "public":
+		query = query.Where("r.private = ?", false)
+	case "private":
+		query = query.Where("r.private = ?", true)
+	}
 
 	// Apply filters
 	if owner, ok := filters["owner"]; ok {
 		query = query.Where("u.github_username = ?", owner)
 	}
 	if name, ok := filters["name"]; ok {
-		query = query.Where("r.name ILIKE ?", "%"+name.(string)+"%")
+		query = query.Where(db.DialectOf(s.db).ILike("r.name"), "%"+db.EscapeLike(name.(string))+"%")
+	}
+	if fullName, ok := filters["full_name"]; ok {
+		query = query.Where("r.full_name = ?", fullName)
 	}
 
 	// Count total results
@@ -156,7 +355,7 @@ func (s *RepositoryService) ListRepositoriesWithStats(limit, offset int, sortBy,
 			&owner.Name, &owner.CreatedAt,
 			&stat.Stats.TotalCO2Kg, &stat.Stats.AvgCO2Kg,
 			&stat.Stats.TotalEnergyKWh, &stat.Stats.AvgEnergyKWh,
-			&stat.Stats.RunCount, &stat.Stats.LastRunAt,
+			&stat.Stats.RunCount, db.ScanTime(&stat.Stats.LastRunAt),
 		)
 		if err != nil {
 			return nil, 0, fmt.Errorf("failed to scan repository stats: %w", err)
@@ -169,8 +368,37 @@ func (s *RepositoryService) ListRepositoriesWithStats(limit, offset int, sortBy,
 	return results, total, nil
 }
 
-// GetRepositoryRuns retrieves runs for a specific repository
-func (s *RepositoryService) GetRepositoryRuns(repoID uuid.UUID, limit, offset int, filters map[string]interface{}) ([]db.Run, int64, error) {
+// RunView selects what is loaded of listed runs: the columns, every column when empty, and the
+// relations to preload, such as User
+type RunView struct {
+	Columns   []string
+	Relations []string
+}
+
+// DefaultRunView loads whole runs with their user and repository
+var DefaultRunView = RunView{Relations: []string{"User", "Repository"}}
+
+// apply restricts query to the view. The keys of runs are always loaded, as preloading needs
+// them.
+func (v RunView) apply(query *gorm.DB) *gorm.DB {
+	if len(v.Columns) > 0 {
+		columns := []string{"id", "user_id", "repository_id"}
+		for _, column := range v.Columns {
+			if column != "id" && column != "user_id" && column != "repository_id" {
+				columns = append(columns, column)
+			}
+		}
+		query = query.Select(columns)
+	}
+	for _, relation := range v.Relations {
+		query = query.Preload(relation)
+	}
+	return query
+}
+
+// GetRepositoryRuns retrieves the runs of a repository as loaded by view, sorted by sortBy in
+// order
+func (s *RepositoryService) GetRepositoryRuns(repoID uuid.UUID, limit, offset int, sortBy, order string, filters map[string]interface{}, view RunView) ([]db.Run, int64, error) {
 	query := s.db.Where("repository_id = ?", repoID)
 
 	// Apply date filters
@@ -180,6 +408,15 @@ func (s *RepositoryService) GetRepositoryRuns(repoID uuid.UUID, limit, offset in
 	if toDate, ok := filters["to_date"]; ok {
 		query = query.Where("created_at <= ?", toDate)
 	}
+	if branch, ok := filters["branch_name"]; ok {
+		query = query.Where("branch_name = ?", branch)
+	}
+	if workflowName, ok := filters["workflow_name"]; ok {
+		query = query.Where("workflow_name = ?", workflowName)
+	}
+	if expr, ok := filters["filter"].(*filter.Expr); ok {
+		query = query.Scopes(RunsMatching(expr))
+	}
 
 	// Count total
 	var total int64
@@ -189,8 +426,8 @@ func (s *RepositoryService) GetRepositoryRuns(repoID uuid.UUID, limit, offset in
 
 	// Get paginated results
 	var runs []db.Run
-	if err := query.Preload("User").Preload("Repository").
-		Order("created_at DESC").
+	if err := view.apply(query).
+		Order(runOrder(sortBy, order)).
 		Limit(limit).Offset(offset).
 		Find(&runs).Error; err != nil {
 		return nil, 0, fmt.Errorf("failed to get repository runs: %w", err)
@@ -211,15 +448,15 @@ func (s *RepositoryService) GetRepositoryStats(repoID uuid.UUID) (*db.Repository
 		return nil, fmt.Errorf("failed to get repository: %w", err)
 	}
 
-	// Get aggregated stats
-	row := s.db.Table("runs").
+	// Get aggregated stats from the daily rollups
+	row := s.db.Table("repository_daily_rollups").
 		Select(`
-			COALESCE(SUM(co2_kg), 0) as total_co2_kg,
-			COALESCE(AVG(co2_kg), 0) as avg_co2_kg,
-			COALESCE(SUM(energy_kwh), 0) as total_energy_kwh,
-			COALESCE(AVG(energy_kwh), 0) as avg_energy_kwh,
-			COALESCE(COUNT(id), 0) as run_count,
-			COALESCE(MAX(created_at), NOW()) as last_run_at
+			COALESCE(SUM(total_co2_kg), 0) as total_co2_kg,
+			COALESCE(CAST(SUM(total_co2_kg) AS DOUBLE PRECISION) / NULLIF(SUM(run_count), 0), 0) as avg_co2_kg,
+			COALESCE(SUM(total_energy_kwh), 0) as total_energy_kwh,
+			COALESCE(CAST(SUM(total_energy_kwh) AS DOUBLE PRECISION) / NULLIF(SUM(run_count), 0), 0) as avg_energy_kwh,
+			COALESCE(SUM(run_count), 0) as run_count,
+			COALESCE(MAX(last_run_at), ` + db.DialectOf(s.db).Now() + `) as last_run_at
 		`).
 		Where("repository_id = ?", repoID).
 		Row()
@@ -230,7 +467,7 @@ func (s *RepositoryService) GetRepositoryStats(repoID uuid.UUID) (*db.Repository
 		&stat.Stats.TotalEnergyKWh,
 		&stat.Stats.AvgEnergyKWh,
 		&stat.Stats.RunCount,
-		&stat.Stats.LastRunAt,
+		db.ScanTime(&stat.Stats.LastRunAt),
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get repository stats: %w", err)
@@ -239,19 +476,135 @@ func (s *RepositoryService) GetRepositoryStats(repoID uuid.UUID) (*db.Repository
 	return &stat, nil
 }
 
-// DeleteRepository deletes a repository and all related runs
-func (s *RepositoryService) DeleteRepository(repoID uuid.UUID) error {
+// BackfillRollups rebuilds the daily rollups of every repository whose rollups do not
+// account for all of its runs, such as runs ingested before the rollups existed. It returns
+// the number of rebuilt repositories.
+func (s *RepositoryService) BackfillRollups(ctx context.Context) (int, error) {
+	var repoIDs []uuid.UUID
+	// Rollups of days whose runs were purged have no runs to match
+	err := s.db.WithContext(ctx).Model(&db.Run{}).
+		Joins("JOIN repositories r ON r.id = runs.repository_id").
+		Select("runs.repository_id").
+		Group("runs.repository_id, r.runs_purged_before").
+		Having("COUNT(*) <> COALESCE((SELECT SUM(rollups.run_count) FROM repository_daily_rollups rollups " +
+			"WHERE rollups.repository_id = runs.repository_id " +
+			"AND (r.runs_purged_before IS NULL OR rollups.day >= r.runs_purged_before)), 0)").
+		Pluck("runs.repository_id", &repoIDs).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to find repositories to backfill: %w", err)
+	}
+
+	for i, repoID := range repoIDs {
+		if err := ctx.Err(); err != nil {
+			return i, err
+		}
+		err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return db.RebuildRollups(tx, repoID)
+		})
+		if err != nil {
+			return i, err
+		}
+	}
+	return len(repoIDs), nil
+}
+
+// TransferRepository reassigns a repository to a new owner. A collaborator entry of the new
+// owner is dropped since owners have access anyway; with keepPreviousOwner the previous owner
+// stays on as a collaborator.
+func (s *RepositoryService) TransferRepository(repoID, newOwnerID uuid.UUID, keepPreviousOwner bool) (*db.Repository, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var repo db.Repository
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("id = ?", repoID).Take(&repo).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return fmt.Errorf("repository not found")
+			}
+			return fmt.Errorf("failed to get repository: %w", err)
+		}
+		if repo.OwnerID == newOwnerID {
+			return nil
+		}
+
+		if err := tx.Model(&db.Repository{}).Where("id = ?", repoID).Update("owner_id", newOwnerID).Error; err != nil {
+			return fmt.Errorf("failed to transfer repository: %w", err)
+		}
+		if err := tx.Where("repository_id = ? AND user_id = ?", repoID, newOwnerID).Delete(&db.RepositoryCollaborator{}).Error; err != nil {
+			return fmt.Errorf("failed to remove collaborator: %w", err)
+		}
+		if keepPreviousOwner {
+			collaborator := db.RepositoryCollaborator{RepositoryID: repoID, UserID: repo.OwnerID}
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&collaborator).Error; err != nil {
+				return fmt.Errorf("failed to add collaborator: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetRepositoryByID(repoID)
+}
+
+// DeleteRepository soft-deletes a repository and its runs and clears its rollups. The runs
+// share the deletion time of the repository so RestoreRepository can tell them apart from
+// runs that were deleted on their own.
+func (s *RepositoryService) DeleteRepository(repoID uuid.UUID, now time.Time) error {
 	return s.db.Transaction(func(tx *gorm.DB) error {
 		// Delete all runs for this repository
-		if err := tx.Where("repository_id = ?", repoID).Delete(&db.Run{}).Error; err != nil {
+		if err := tx.Model(&db.Run{}).Where("repository_id = ?", repoID).Update("deleted_at", now).Error; err != nil {
 			return fmt.Errorf("failed to delete repository runs: %w", err)
 		}
+		if err := tx.Where("repository_id = ?", repoID).Delete(&db.RepositoryDailyRollup{}).Error; err != nil {
+			return fmt.Errorf("failed to delete repository rollups: %w", err)
+		}
 
 		// Delete the repository
-		if err := tx.Where("id = ?", repoID).Delete(&db.Repository{}).Error; err != nil {
+		if err := tx.Model(&db.Repository{}).Where("id = ?", repoID).Update("deleted_at", now).Error; err != nil {
 			return fmt.Errorf("failed to delete repository: %w", err)
 		}
 
 		return nil
 	})
+}
+
+// RestoreRepository restores a repository the owner deleted after deletedSince, together
+// with the runs deleted along with it, and rebuilds its rollups
+func (s *RepositoryService) RestoreRepository(repoID, ownerID uuid.UUID, deletedSince time.Time) (*db.Repository, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var repo db.Repository
+		err := tx.Unscoped().Where("id = ? AND owner_id = ? AND deleted_at IS NOT NULL", repoID, ownerID).First(&repo).Error
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return fmt.Errorf("deleted repository not found")
+			}
+			return fmt.Errorf("failed to get deleted repository: %w", err)
+		}
+		if repo.DeletedAt.Time.Before(deletedSince) {
+			return fmt.Errorf("restore window has expired")
+		}
+
+		// Runs of a repository with the same name were ingested into a new repository meanwhile
+		var existing int64
+		if err := tx.Model(&db.Repository{}).Where("full_name = ? AND owner_id = ?", repo.FullName, ownerID).Count(&existing).Error; err != nil {
+			return fmt.Errorf("failed to check repository name: %w", err)
+		}
+		if existing > 0 {
+			return fmt.Errorf("repository already exists")
+		}
+
+		if err := tx.Unscoped().Model(&db.Run{}).
+			Where("repository_id = ? AND deleted_at = ?", repo.ID, repo.DeletedAt.Time).
+			Update("deleted_at", nil).Error; err != nil {
+			return fmt.Errorf("failed to restore repository runs: %w", err)
+		}
+		if err := tx.Unscoped().Model(&repo).Update("deleted_at", nil).Error; err != nil {
+			return fmt.Errorf("failed to restore repository: %w", err)
+		}
+		return db.RebuildRollups(tx, repo.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetRepositoryByID(repoID)
 }
\ No newline at end of file
@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// RetentionPolicyRequest represents the retention settings of an organization; omitted
+// retention keeps the data forever
+type RetentionPolicyRequest struct {
+	RunRetentionDays    *int `json:"run_retention_days,omitempty" binding:"omitempty,min=1" example:"548"`
+	RollupRetentionDays *int `json:"rollup_retention_days,omitempty" binding:"omitempty,min=1"`
+	DryRun              bool `json:"dry_run"`
+}
+
+// ValidateRetentionPolicy checks that rollups outlive the runs they summarize, since
+// rollups of days that still have runs would be rebuilt from them
+func ValidateRetentionPolicy(req *RetentionPolicyRequest) error {
+	if req.RollupRetentionDays == nil {
+		return nil
+	}
+	if req.RunRetentionDays == nil || *req.RollupRetentionDays < *req.RunRetentionDays {
+		return fmt.Errorf("rollup_retention_days requires run_retention_days and must not be shorter")
+	}
+	return nil
+}
+
+// RetentionService handles data retention policies and purges
+type RetentionService struct {
+	db *gorm.DB
+}
+
+// NewRetentionService creates a new retention service
+func NewRetentionService(database *gorm.DB) *RetentionService {
+	return &RetentionService{
+		db: database,
+	}
+}
+
+// GetPolicy retrieves the retention policy of an organization; organizations without a
+// policy keep their data forever
+func (s *RetentionService) GetPolicy(orgID uuid.UUID) (*db.RetentionPolicy, error) {
+	var policy db.RetentionPolicy
+	if err := s.db.Where("organization_id = ?", orgID).First(&policy).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return &db.RetentionPolicy{OrganizationID: orgID}, nil
+		}
+		return nil, fmt.Errorf("failed to get retention policy: %w", err)
+	}
+
+	return &policy, nil
+}
+
+// SetPolicy creates or replaces the retention policy of an organization
+func (s *RetentionService) SetPolicy(orgID uuid.UUID, req *RetentionPolicyRequest) (*db.RetentionPolicy, error) {
+	policy := db.RetentionPolicy{
+		OrganizationID:      orgID,
+		RunRetentionDays:    req.RunRetentionDays,
+		RollupRetentionDays: req.RollupRetentionDays,
+		DryRun:              req.DryRun,
+	}
+
+	err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "organization_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"run_retention_days", "rollup_retention_days", "dry_run", "updated_at"}),
+	}).Create(&policy).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to save retention policy: %w", err)
+	}
+
+	return s.GetPolicy(orgID)
+}
+
+// DeletePolicy removes the retention policy of an organization so its data is kept forever
+func (s *RetentionService) DeletePolicy(orgID uuid.UUID) error {
+	result := s.db.Where("organization_id = ?", orgID).Delete(&db.RetentionPolicy{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete retention policy: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("retention policy not found")
+	}
+	return nil
+}
+
+// ListReports retrieves the most recent retention reports of an organization, newest first
+func (s *RetentionService) ListReports(orgID uuid.UUID, limit int) ([]db.RetentionReport, error) {
+	var reports []db.RetentionReport
+	err := s.db.Where("organization_id = ?", orgID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&reports).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list retention reports: %w", err)
+	}
+	return reports, nil
+}
+
+// ApplyAll applies every retention policy that expires data at now and returns their reports
+func (s *RetentionService) ApplyAll(ctx context.Context, now time.Time) ([]db.RetentionReport, error) {
+	var policies []db.RetentionPolicy
+	if err := s.db.WithContext(ctx).Where("run_retention_days IS NOT NULL").Find(&policies).Error; err != nil {
+		return nil, fmt.Errorf("failed to list retention policies: %w", err)
+	}
+
+	reports := make([]db.RetentionReport, 0, len(policies))
+	for i := range policies {
+		if err := ctx.Err(); err != nil {
+			return reports, err
+		}
+		report, err := s.Apply(ctx, &policies[i], now)
+		if err != nil {
+			return reports, err
+		}
+		reports = append(reports, *report)
+	}
+	return reports, nil
+}
+
+// Apply purges the runs and rollups of the repositories of an organization that expired
+// at now under policy, and records a report. Runs are deleted by whole UTC days after
+// their rollups are rebuilt, so the rollups remain the record of purged runs until they
+// expire themselves. In dry-run mode nothing is deleted and the report counts what would be.
+func (s *RetentionService) Apply(ctx context.Context, policy *db.RetentionPolicy, now time.Time) (*db.RetentionReport, error) {
+	report := db.RetentionReport{
+		OrganizationID: policy.OrganizationID,
+		DryRun:         policy.DryRun,
+	}
+	if policy.RunRetentionDays != nil {
+		cutoff := db.RollupDay(now.AddDate(0, 0, -*policy.RunRetentionDays))
+		report.RunCutoff = &cutoff
+	}
+	if policy.RollupRetentionDays != nil {
+		cutoff := db.RollupDay(now.AddDate(0, 0, -*policy.RollupRetentionDays))
+		report.RollupCutoff = &cutoff
+	}
+
+	var repoIDs []uuid.UUID
+	if err := s.db.WithContext(ctx).Model(&db.Repository{}).
+		Where("organization_id = ?", policy.OrganizationID).
+		Order("id ASC").
+		Pluck("id", &repoIDs).Error; err != nil {
+		return nil, fmt.Errorf("failed to list organization repositories: %w", err)
+	}
+
+	for _, repoID := range repoIDs {
+		var runs, rollups int64
+		err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var err error
+			if runs, err = purgeRuns(tx, repoID, report.RunCutoff, policy.DryRun); err != nil {
+				return err
+			}
+			rollups, err = purgeRollups(tx, repoID, report.RollupCutoff, policy.DryRun)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if runs > 0 || rollups > 0 {
+			report.Repositories++
+			report.RunsDeleted += runs
+			report.RollupsDeleted += rollups
+			report.RepositoryIDs = append(report.RepositoryIDs, repoID)
+		}
+	}
+
+	if err := s.db.WithContext(ctx).Create(&report).Error; err != nil {
+		return nil, fmt.Errorf("failed to record retention report: %w", err)
+	}
+	return &report, nil
+}
+
+// PurgedRecords counts the soft-deleted records PurgeDeleted removed permanently
+type PurgedRecords struct {
+	Users        int64
+	Repositories int64
+	Runs         int64
+}
+
+// PurgeDeleted permanently deletes the users, repositories and runs that were soft-deleted
+// before cutoff and can therefore no longer be restored
+func (s *RetentionService) PurgeDeleted(ctx context.Context, cutoff time.Time) (*PurgedRecords, error) {
+	var purged PurgedRecords
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Runs go first, including those of repositories and users that are purged
+		result := tx.Unscoped().
+			Where("deleted_at < ? OR repository_id IN (SELECT id FROM repositories WHERE deleted_at < ?) OR user_id IN (SELECT id FROM users WHERE deleted_at < ?)",
+				cutoff, cutoff, cutoff).
+			Delete(&db.Run{})
+		if result.Error != nil {
+			return fmt.Errorf("failed to purge deleted runs: %w", result.Error)
+		}
+		purged.Runs = result.RowsAffected
+
+		result = tx.Unscoped().
+			Where("deleted_at < ? OR owner_id IN (SELECT id FROM users WHERE deleted_at < ?)", cutoff, cutoff).
+			Delete(&db.Repository{})
+		if result.Error != nil {
+			return fmt.Errorf("failed to purge deleted repositories: %w", result.Error)
+		}
+		purged.Repositories = result.RowsAffected
+
+		result = tx.Unscoped().Where("deleted_at < ?", cutoff).Delete(&db.User{})
+		if result.Error != nil {
+			return fmt.Errorf("failed to purge deleted users: %w", result.Error)
+		}
+		purged.Users = result.RowsAffected
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &purged, nil
+}
+
+// purgeRuns permanently deletes the runs of a repository created before cutoff, including
+// deleted ones, after rebuilding its rollups from them, and returns how many runs were (or in dry-run mode would be) deleted
+func purgeRuns(tx *gorm.DB, repoID uuid.UUID, cutoff *time.Time, dryRun bool) (int64, error) {
+	if cutoff == nil {
+		return 0, nil
+	}
+
+	var expired int64
+	if err := tx.Unscoped().Model(&db.Run{}).Where("repository_id = ? AND created_at < ?", repoID, *cutoff).Count(&expired).Error; err != nil {
+		return 0, fmt.Errorf("failed to count expired runs: %w", err)
+	}
+	if expired == 0 || dryRun {
+		return expired, nil
+	}
+
+	if err := db.RebuildRollups(tx, repoID); err != nil {
+		return 0, err
+	}
+	result := tx.Unscoped().Where("repository_id = ? AND created_at < ?", repoID, *cutoff).Delete(&db.Run{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete expired runs: %w", result.Error)
+	}
+	err := tx.Model(&db.Repository{}).
+		Where("id = ? AND (runs_purged_before IS NULL OR runs_purged_before < ?)", repoID, *cutoff).
+		Update("runs_purged_before", *cutoff).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to record purged runs: %w", err)
+	}
+	return result.RowsAffected, nil
+}
+
+// purgeRollups deletes the daily rollups of a repository before cutoff and returns how many
+// were (or in dry-run mode would be) deleted
+func purgeRollups(tx *gorm.DB, repoID uuid.UUID, cutoff *time.Time, dryRun bool) (int64, error) {
+	if cutoff == nil {
+		return 0, nil
+	}
+
+	query := tx.Model(&db.RepositoryDailyRollup{}).Where("repository_id = ? AND day < ?", repoID, *cutoff)
+	if dryRun {
+		var expired int64
+		if err := query.Count(&expired).Error; err != nil {
+			return 0, fmt.Errorf("failed to count expired rollups: %w", err)
+		}
+		return expired, nil
+	}
+
+	result := query.Delete(&db.RepositoryDailyRollup{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete expired rollups: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
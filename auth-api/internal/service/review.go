@@ -0,0 +1,161 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// Conversion factors for the everyday equivalents of a year in review
+const (
+	// CarKgCO2PerKm is the average emission of a petrol passenger car per km driven
+	CarKgCO2PerKm = 0.17
+	// TreeKgCO2PerYear is the CO2 a mature tree absorbs in one year
+	TreeKgCO2PerYear = 21.0
+)
+
+// YearInReview summarizes a year of runs for shareable retrospectives
+type YearInReview struct {
+	Year               int                 `json:"year"`
+	TotalCO2Kg         float64             `json:"total_co2_kg"`
+	TotalEnergyKWh     float64             `json:"total_energy_kwh"`
+	TotalDurationS     float64             `json:"total_duration_s"`
+	RunCount           int64               `json:"run_count"`
+	Equivalents        CO2Equivalents      `json:"equivalents"`
+	BiggestRegression  *RepositoryMovement `json:"biggest_regression"`
+	BiggestImprovement *RepositoryMovement `json:"biggest_improvement"`
+	Months             []PeriodSummary     `json:"months"`
+}
+
+// CO2Equivalents expresses an amount of CO2 in everyday terms
+type CO2Equivalents struct {
+	KmDriven  float64 `json:"km_driven"`
+	TreeYears float64 `json:"tree_years"`
+}
+
+// RepositoryMovement is a month-over-month change of a repository's average CO2 per run
+type RepositoryMovement struct {
+	RepositoryID      uuid.UUID `json:"repository_id"`
+	FullName          string    `json:"full_name"`
+	Month             time.Time `json:"month"`
+	PreviousMonth     time.Time `json:"previous_month"`
+	PreviousCO2PerRun float64   `json:"previous_co2_kg_per_run"`
+	CO2PerRun         float64   `json:"co2_kg_per_run"`
+	ChangePercent     float64   `json:"change_percent"`
+}
+
+// NewCO2Equivalents converts kg of CO2 into everyday equivalents
+func NewCO2Equivalents(co2Kg float64) CO2Equivalents {
+	return CO2Equivalents{
+		KmDriven:  co2Kg / CarKgCO2PerKm,
+		TreeYears: co2Kg / TreeKgCO2PerYear,
+	}
+}
+
+// YearInReview summarizes the runs in scope during a calendar year (UTC). The biggest
+// regression and improvement are the largest month-over-month relative changes in average
+// CO2 per run of a single repository, comparing consecutive months that both had runs.
+func (s *StatsService) YearInReview(scope RunScope, year int) (*YearInReview, error) {
+	from := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(1, 0, 0).Add(-time.Nanosecond)
+
+	total, err := s.Summary(scope, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	months, err := s.MonthlySummaries(scope, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	review := &YearInReview{
+		Year:           year,
+		TotalCO2Kg:     total.TotalCO2Kg,
+		TotalEnergyKWh: total.TotalEnergyKWh,
+		TotalDurationS: total.TotalDurationS,
+		RunCount:       total.RunCount,
+		Equivalents:    NewCO2Equivalents(total.TotalCO2Kg),
+		Months:         fillMonths(year, months),
+	}
+
+	review.BiggestRegression, review.BiggestImprovement, err = s.repositoryMovements(scope, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	return review, nil
+}
+
+// repositoryMovements finds the largest month-over-month increase and decrease in average
+// CO2 per run across the repositories in scope
+func (s *StatsService) repositoryMovements(scope RunScope, from, to time.Time) (*RepositoryMovement, *RepositoryMovement, error) {
+	bucketExpr := db.DialectOf(s.db).DateTrunc("month", "runs.created_at")
+	rows, err := s.db.Model(&db.Run{}).
+		Select("runs.repository_id, repositories.full_name, "+bucketExpr+" as month, AVG(runs.co2_kg) as co2_per_run").
+		Joins("JOIN repositories ON repositories.id = runs.repository_id").
+		Scopes(scope).
+		Where("runs.created_at >= ? AND runs.created_at <= ?", from, to).
+		Group("runs.repository_id, repositories.full_name, " + bucketExpr).
+		Order("runs.repository_id, month ASC").
+		Rows()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query repository months: %w", err)
+	}
+	defer rows.Close()
+
+	var regression, improvement *RepositoryMovement
+	var previous *RepositoryMovement
+	for rows.Next() {
+		var current RepositoryMovement
+		if err := rows.Scan(&current.RepositoryID, &current.FullName, db.ScanTime(&current.Month), &current.CO2PerRun); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan repository month: %w", err)
+		}
+
+		if previous != nil && previous.RepositoryID == current.RepositoryID && previous.CO2PerRun > 0 {
+			movement := current
+			movement.PreviousMonth = previous.Month
+			movement.PreviousCO2PerRun = previous.CO2PerRun
+			movement.ChangePercent = (current.CO2PerRun - previous.CO2PerRun) / previous.CO2PerRun * 100
+
+			if movement.ChangePercent > 0 && (regression == nil || movement.ChangePercent > regression.ChangePercent) {
+				m := movement
+				regression = &m
+			}
+			if movement.ChangePercent < 0 && (improvement == nil || movement.ChangePercent < improvement.ChangePercent) {
+				m := movement
+				improvement = &m
+			}
+		}
+
+		c := current
+		previous = &c
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to read repository months: %w", err)
+	}
+
+	return regression, improvement, nil
+}
+
+// fillMonths returns one summary per month of the year, with zero values for months without runs
+func fillMonths(year int, summaries []PeriodSummary) []PeriodSummary {
+	byMonth := make(map[time.Month]PeriodSummary, len(summaries))
+	for _, summary := range summaries {
+		byMonth[summary.From.Month()] = summary
+	}
+
+	months := make([]PeriodSummary, 0, 12)
+	for month := time.January; month <= time.December; month++ {
+		summary, ok := byMonth[month]
+		if !ok {
+			start := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+			summary = PeriodSummary{From: start, To: start.AddDate(0, 1, 0)}
+		}
+		months = append(months, summary)
+	}
+	return months
+}
@@ -1,45 +1,107 @@
 package service
 
 import (
+	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 
 	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/filter"
 )
 
 // RunService handles run-related business logic
 type RunService struct {
 	db *gorm.DB
+	// networkKWhPerGB converts the network transfer of runs to energy
+	networkKWhPerGB float64
 }
 
-// NewRunService creates a new run service
-func NewRunService(database *gorm.DB) *RunService {
+// NewRunService creates a new run service converting network transfer to energy with
+// networkKWhPerGB
+func NewRunService(database *gorm.DB, networkKWhPerGB float64) *RunService {
 	return &RunService{
-		db: database,
+		db:              database,
+		networkKWhPerGB: networkKWhPerGB,
 	}
 }
 
+// WithContext returns a run service whose queries run with ctx, so they are canceled with it
+// and traced as part of its span
+func (s *RunService) WithContext(ctx context.Context) *RunService {
+	return &RunService{
+		db:              s.db.WithContext(ctx),
+		networkKWhPerGB: s.networkKWhPerGB,
+	}
+}
+
+// MaxWorkflowRunGroupLength is the longest workflow run group a run may be submitted with
+const MaxWorkflowRunGroupLength = 255
+
+// MaxGitTagLength is the longest git tag a run may be submitted with
+const MaxGitTagLength = 255
+
 // RunCreateRequest represents the data needed to create a run
 type RunCreateRequest struct {
-	EnergyKWh     float64                `json:"energy_kwh" validate:"required,min=0"`
-	CO2Kg         float64                `json:"co2_kg" validate:"required,min=0"`
+	EnergyKWh     float64                `json:"energy_kwh" validate:"min=0"`
+	CO2Kg         float64                `json:"co2_kg" validate:"min=0"`
 	DurationS     float64                `json:"duration_s" validate:"required,min=0"`
 	GitCommitSHA  *string                `json:"git_commit_sha,omitempty" validate:"omitempty,len=40"`
 	BranchName    *string                `json:"branch_name,omitempty"`
 	WorkflowName  *string                `json:"workflow_name,omitempty"`
+	// WorkflowRunGroup is shared by the runs of one workflow execution, such as the jobs of
+	// a matrix build
+	WorkflowRunGroup *string                `json:"workflow_run_group,omitempty" validate:"omitempty,max=255"`
+	// GitTag associates the run with a git tag or release
+	GitTag        *string                `json:"git_tag,omitempty" example:"v1.2.0"`
+	// Environment is ci, staging or production-deploy, ci when omitted; NormalizeEnvironment
+	// validates it
+	Environment   string                 `json:"environment,omitempty" example:"ci"`
 	Repository    RepositoryCreateRequest `json:"repository" validate:"required"`
+	// Metadata is free-form, except for its steps, which ValidateSteps validates
 	Metadata      map[string]interface{} `json:"metadata,omitempty"`
+	// The energy and CO2 may be submitted in other units instead, as energy with energy_unit
+	// and co2 with co2_unit or with a suffixed key; NormalizeRunUnits converts them to kWh
+	// and kg
+	Energy     *float64 `json:"energy,omitempty"`
+	EnergyUnit string   `json:"energy_unit,omitempty" example:"Wh"`
+	EnergyWh   *float64 `json:"energy_wh,omitempty"`
+	EnergyJ    *float64 `json:"energy_j,omitempty"`
+	CO2        *float64 `json:"co2,omitempty"`
+	CO2Unit    string   `json:"co2_unit,omitempty" example:"g"`
+	CO2G       *float64 `json:"co2_g,omitempty"`
+	// Measurements are further metrics of the run, such as GPU energy or network transfer;
+	// NormalizeMeasurements validates them
+	Measurements []MeasurementRequest `json:"measurements,omitempty"`
+	// The GPU energy is part of the energy of the run, given either as gpu_energy_kwh with
+	// the model and count of the GPUs or per device as gpus; NormalizeGPUs validates them
+	GPUEnergyKWh *float64           `json:"gpu_energy_kwh,omitempty"`
+	GPUModel     *string            `json:"gpu_model,omitempty" example:"nvidia-a100"`
+	GPUCount     *int               `json:"gpu_count,omitempty"`
+	GPUs         []GPUDeviceRequest `json:"gpus,omitempty"`
+	// NetworkBytes is the data the run transferred, reported as emissions of its own
+	NetworkBytes *int64 `json:"network_bytes,omitempty" validate:"omitempty,min=0"`
+	// ImageBuild makes the run an image-build run; ValidateImageBuild validates it
+	ImageBuild *ImageBuildRequest `json:"image_build,omitempty"`
 }
 
-// CreateRun creates a new CO2 measurement run
-func (s *RunService) CreateRun(userID uuid.UUID, req *RunCreateRequest, repoService *RepositoryService) (*db.Run, error) {
-	return s.db.Transaction(func(tx *gorm.DB) (*db.Run, error) {
+// CreateRun creates a new CO2 measurement run, returning a QuotaError when the plan of the
+// repository does not allow it
+func (s *RunService) CreateRun(userID uuid.UUID, req *RunCreateRequest, repoService *RepositoryService, quotaService *QuotaService) (*db.Run, error) {
+	var run db.Run
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := quotaService.withTx(tx).checkRun(userID, &req.Repository, time.Now()); err != nil {
+			return err
+		}
+
 		// Create or update repository first
-		repo, err := repoService.CreateOrUpdateRepository(userID, &req.Repository)
+		repo, err := repoService.withTx(tx).CreateOrUpdateRepository(userID, &req.Repository)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create/update repository: %w", err)
+			return fmt.Errorf("failed to create/update repository: %w", err)
 		}
 
 		// Convert metadata to JSONB
@@ -47,37 +109,57 @@ func (s *RunService) CreateRun(userID uuid.UUID, req *RunCreateRequest, repoServ
 		if req.Metadata != nil {
 			metadata = db.JSONB(req.Metadata)
 		}
-
-		// Create the run
-		run := db.Run{
-			UserID:       userID,
-			RepositoryID: repo.ID,
-			EnergyKWh:    req.EnergyKWh,
-			CO2Kg:        req.CO2Kg,
-			DurationS:    req.DurationS,
-			RunMetadata:  metadata,
-			GitCommitSHA: req.GitCommitSHA,
-			BranchName:   req.BranchName,
-			WorkflowName: req.WorkflowName,
+		water, err := runWater(tx, repo, req.EnergyKWh, req.Metadata)
+		if err != nil {
+			return err
 		}
 
-		if err := s.db.Create(&run).Error; err != nil {
-			return nil, fmt.Errorf("failed to create run: %w", err)
+		// Create the run
+		run = db.Run{
+			UserID:           userID,
+			RepositoryID:     repo.ID,
+			EnergyKWh:        req.EnergyKWh,
+			CO2Kg:            req.CO2Kg,
+			DurationS:        req.DurationS,
+			RunMetadata:      metadata,
+			GitCommitSHA:     req.GitCommitSHA,
+			BranchName:       req.BranchName,
+			WorkflowName:     req.WorkflowName,
+			WorkflowRunGroup: req.WorkflowRunGroup,
+			GitTag:           req.GitTag,
+			Environment:      req.Environment,
+			WaterL:           water,
+			Measurements:     newMeasurements(req.Measurements),
+			GPUEnergyKWh:     req.GPUEnergyKWh,
+			GPUModel:         req.GPUModel,
+			GPUCount:         req.GPUCount,
+			GPUDevices:       newGPUDevices(req.GPUs),
+			ImageBuild:       newImageBuild(req.ImageBuild),
 		}
+		s.applyNetworkTransfer(&run, req.NetworkBytes)
 
-		// Load relationships for response
-		if err := s.db.Preload("User").Preload("Repository").First(&run, run.ID).Error; err != nil {
-			return nil, fmt.Errorf("failed to load run relationships: %w", err)
+		if err := tx.Create(&run).Error; err != nil {
+			return fmt.Errorf("failed to create run: %w", err)
 		}
 
-		return &run, nil
+		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Load relationships for response
+	if err := s.db.Preload("User").Preload("Repository").Preload("Measurements").Preload("GPUDevices").Preload("ImageBuild").First(&run, "id = ?", run.ID).Error; err != nil {
+		return nil, fmt.Errorf("failed to load run relationships: %w", err)
+	}
+
+	return &run, nil
 }
 
 // GetRunByID retrieves a run by ID
 func (s *RunService) GetRunByID(runID uuid.UUID) (*db.Run, error) {
 	var run db.Run
-	err := s.db.Preload("User").Preload("Repository").Where("id = ?", runID).First(&run).Error
+	err := s.db.Preload("User").Preload("Repository").Preload("Measurements").Preload("GPUDevices").Preload("ImageBuild").Where("id = ?", runID).First(&run).Error
 	if err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, fmt.Errorf("run not found")
@@ -88,8 +170,34 @@ func (s *RunService) GetRunByID(runID uuid.UUID) (*db.Run, error) {
 	return &run, nil
 }
 
-// ListUserRuns retrieves runs for a specific user
-func (s *RunService) ListUserRuns(userID uuid.UUID, limit, offset int, filters map[string]interface{}) ([]db.Run, int64, error) {
+// RunSortFields are the fields run listings can be sorted by
+var RunSortFields = []string{"created_at", "co2_kg", "energy_kwh", "duration_s"}
+
+// IsValidRunSort reports whether sortBy is a field run listings can be sorted by
+func IsValidRunSort(sortBy string) bool {
+	for _, field := range RunSortFields {
+		if sortBy == field {
+			return true
+		}
+	}
+	return false
+}
+
+// runOrder returns the ORDER BY clause of runs sorted by sortBy in order (asc or desc),
+// newest first for other fields. Ties are broken by ID so pages never overlap; migration 026
+// indexes each field with the ID per repository and per user.
+func runOrder(sortBy, order string) string {
+	if !IsValidRunSort(sortBy) {
+		sortBy = "created_at"
+	}
+	if order != "asc" {
+		order = "desc"
+	}
+	return "runs." + sortBy + " " + strings.ToUpper(order) + ", runs.id " + strings.ToUpper(order)
+}
+
+// ListUserRuns retrieves runs for a specific user, sorted by sortBy in order
+func (s *RunService) ListUserRuns(userID uuid.UUID, limit, offset int, sortBy, order string, filters map[string]interface{}) ([]db.Run, int64, error) {
 	query := s.db.Where("user_id = ?", userID)
 
 	// Apply filters
@@ -102,6 +210,9 @@ func (s *RunService) ListUserRuns(userID uuid.UUID, limit, offset int, filters m
 	if toDate, ok := filters["to_date"]; ok {
 		query = query.Where("created_at <= ?", toDate)
 	}
+	if expr, ok := filters["filter"].(*filter.Expr); ok {
+		query = query.Scopes(RunsMatching(expr))
+	}
 
 	// Count total
 	var total int64
@@ -112,7 +223,7 @@ func (s *RunService) ListUserRuns(userID uuid.UUID, limit, offset int, filters m
 	// Get paginated results
 	var runs []db.Run
 	if err := query.Preload("User").Preload("Repository").
-		Order("created_at DESC").
+		Order(runOrder(sortBy, order)).
 		Limit(limit).Offset(offset).
 		Find(&runs).Error; err != nil {
 		return nil, 0, fmt.Errorf("failed to list runs: %w", err)
@@ -121,21 +232,23 @@ func (s *RunService) ListUserRuns(userID uuid.UUID, limit, offset int, filters m
 	return runs, total, nil
 }
 
-// GetUserStats retrieves aggregated CO2 statistics for a user
-func (s *RunService) GetUserStats(userID uuid.UUID) (*UserStats, error) {
-	var stats UserStats
+// GetUserStats retrieves aggregated CO2 statistics of the runs in scope created in [from, to],
+// typically UserRuns or UserRunsVisibleTo
+func (s *RunService) GetUserStats(scope RunScope, from, to time.Time) (*UserStats, error) {
+	stats := UserStats{From: from, To: to}
 
-	row := s.db.Table("runs").
+	row := s.db.Model(&db.Run{}).
 		Select(`
-			COALESCE(SUM(co2_kg), 0) as total_co2_kg,
-			COALESCE(AVG(co2_kg), 0) as avg_co2_kg,
-			COALESCE(SUM(energy_kwh), 0) as total_energy_kwh,
-			COALESCE(AVG(energy_kwh), 0) as avg_energy_kwh,
-			COALESCE(COUNT(id), 0) as run_count,
-			COALESCE(COUNT(DISTINCT repository_id), 0) as repository_count,
-			COALESCE(MAX(created_at), NOW()) as last_run_at
+			COALESCE(SUM(runs.co2_kg), 0) as total_co2_kg,
+			COALESCE(AVG(runs.co2_kg), 0) as avg_co2_kg,
+			COALESCE(SUM(runs.energy_kwh), 0) as total_energy_kwh,
+			COALESCE(AVG(runs.energy_kwh), 0) as avg_energy_kwh,
+			COALESCE(AVG(runs.duration_s), 0) as avg_duration_s,
+			COUNT(runs.id) as run_count,
+			COUNT(DISTINCT runs.repository_id) as repository_count
 		`).
-		Where("user_id = ?", userID).
+		Scopes(scope).
+		Where("runs.created_at BETWEEN ? AND ?", from, to).
 		Row()
 
 	err := row.Scan(
@@ -143,27 +256,84 @@ func (s *RunService) GetUserStats(userID uuid.UUID) (*UserStats, error) {
 		&stats.AvgCO2Kg,
 		&stats.TotalEnergyKWh,
 		&stats.AvgEnergyKWh,
+		&stats.AvgDurationS,
 		&stats.RunCount,
 		&stats.RepositoryCount,
-		&stats.LastRunAt,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user stats: %w", err)
 	}
+	if stats.RunCount == 0 {
+		return &stats, nil
+	}
+
+	var last db.Run
+	err = s.db.Select("runs.id", "runs.created_at").
+		Scopes(scope).
+		Where("runs.created_at BETWEEN ? AND ?", from, to).
+		Order("runs.created_at DESC").
+		First(&last).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get last run: %w", err)
+	}
+	stats.LastRunID = &last.ID
+	stats.LastRunAt = &last.CreatedAt
 
 	return &stats, nil
 }
 
-// DeleteRun deletes a run
+// DeleteRun soft-deletes a run and rebuilds the rollups of its repository without it
 func (s *RunService) DeleteRun(runID uuid.UUID, userID uuid.UUID) error {
-	result := s.db.Where("id = ? AND user_id = ?", runID, userID).Delete(&db.Run{})
-	if result.Error != nil {
-		return fmt.Errorf("failed to delete run: %w", result.Error)
-	}
-	if result.RowsAffected == 0 {
-		return fmt.Errorf("run not found or not owned by user")
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var run db.Run
+		if err := tx.Select("id", "repository_id").Where("id = ? AND user_id = ?", runID, userID).First(&run).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return fmt.Errorf("run not found or not owned by user")
+			}
+			return fmt.Errorf("failed to delete run: %w", err)
+		}
+
+		if err := tx.Where("id = ?", run.ID).Delete(&db.Run{}).Error; err != nil {
+			return fmt.Errorf("failed to delete run: %w", err)
+		}
+		return db.RebuildRollups(tx, run.RepositoryID)
+	})
+}
+
+// RestoreRun restores a run the user deleted after deletedSince and adds it back to the
+// rollups of its repository. Runs deleted along with their repository are restored with it.
+func (s *RunService) RestoreRun(runID uuid.UUID, userID uuid.UUID, deletedSince time.Time) (*db.Run, error) {
+	var run db.Run
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Where("id = ? AND user_id = ? AND deleted_at IS NOT NULL", runID, userID).First(&run).Error
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return fmt.Errorf("deleted run not found")
+			}
+			return fmt.Errorf("failed to get deleted run: %w", err)
+		}
+		if run.DeletedAt.Time.Before(deletedSince) {
+			return fmt.Errorf("restore window has expired")
+		}
+
+		var repositories int64
+		if err := tx.Model(&db.Repository{}).Where("id = ?", run.RepositoryID).Count(&repositories).Error; err != nil {
+			return fmt.Errorf("failed to get run repository: %w", err)
+		}
+		if repositories == 0 {
+			return fmt.Errorf("repository is deleted")
+		}
+
+		if err := tx.Unscoped().Model(&run).Update("deleted_at", nil).Error; err != nil {
+			return fmt.Errorf("failed to restore run: %w", err)
+		}
+		return db.RebuildRollups(tx, run.RepositoryID)
+	})
+	if err != nil {
+		return nil, err
 	}
-	return nil
+
+	return s.GetRunByID(run.ID)
 }
 
 // GetRunsByRepository retrieves runs for a specific repository
@@ -188,13 +358,18 @@ func (s *RunService) GetRunsByRepository(repoID uuid.UUID, limit, offset int) ([
 	return runs, total, nil
 }
 
-// UserStats represents aggregated statistics for a user
+// UserStats represents aggregated statistics for a user over a time range; the last run is
+// omitted when there are no runs
 type UserStats struct {
-	TotalCO2Kg      float64 `json:"total_co2_kg"`
-	AvgCO2Kg        float64 `json:"avg_co2_kg"`
-	TotalEnergyKWh  float64 `json:"total_energy_kwh"`
-	AvgEnergyKWh    float64 `json:"avg_energy_kwh"`
-	RunCount        int64   `json:"run_count"`
-	RepositoryCount int64   `json:"repository_count"`
-	LastRunAt       string  `json:"last_run_at"`
+	From            time.Time  `json:"from"`
+	To              time.Time  `json:"to"`
+	TotalCO2Kg      float64    `json:"total_co2_kg"`
+	AvgCO2Kg        float64    `json:"avg_co2_kg"`
+	TotalEnergyKWh  float64    `json:"total_energy_kwh"`
+	AvgEnergyKWh    float64    `json:"avg_energy_kwh"`
+	AvgDurationS    float64    `json:"avg_duration_s"`
+	RunCount        int64      `json:"run_count"`
+	RepositoryCount int64      `json:"repository_count"`
+	LastRunID       *uuid.UUID `json:"last_run_id,omitempty"`
+	LastRunAt       *time.Time `json:"last_run_at,omitempty"`
 }
\ No newline at end of file
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/filter"
+)
+
+// runFilterFields are the fields run filters can name: the measurements and creation time of
+// runs, their workflow, workflow run group, branch, commit, git tag and environment, and the
+// tag and CI provider of their metadata
+var runFilterFields = map[string]filter.Field{
+	"co2_kg":             {Column: "runs.co2_kg", Type: filter.Number},
+	"energy_kwh":         {Column: "runs.energy_kwh", Type: filter.Number},
+	"duration_s":         {Column: "runs.duration_s", Type: filter.Number},
+	"created_at":         {Column: "runs.created_at", Type: filter.Time},
+	"workflow_name":      {Column: "runs.workflow_name", Type: filter.String},
+	"workflow_run_group": {Column: "runs.workflow_run_group", Type: filter.String},
+	"branch":             {Column: "runs.branch_name", Type: filter.String},
+	"git_commit_sha":     {Column: "runs.git_commit_sha", Type: filter.String},
+	"git_tag":            {Column: "runs.git_tag", Type: filter.String},
+	"environment":        {Column: "runs.environment", Type: filter.String},
+	"tag":                {Column: "runs.run_metadata", Key: "tag", Type: filter.String},
+	"ci_provider":        {Column: "runs.run_metadata", Key: "ci_provider", Type: filter.String},
+}
+
+// ParseRunFilter parses a filter expression over runs, returning a *filter.Error when it is
+// invalid
+func ParseRunFilter(expression string) (*filter.Expr, error) {
+	return filter.Parse(expression, runFilterFields)
+}
+
+// RunsMatching scopes queries of runs to those matching expr; a nil expr matches every run
+func RunsMatching(expr *filter.Expr) RunScope {
+	return func(query *gorm.DB) *gorm.DB {
+		if expr == nil {
+			return query
+		}
+		condition, args := expr.Where(db.DialectOf(query))
+		return query.Where(condition, args...)
+	}
+}
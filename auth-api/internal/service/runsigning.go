@@ -0,0 +1,130 @@
+package service
+
+import (
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/webhook"
+)
+
+// Request headers of signed run submissions
+const (
+	HeaderRunSignature = webhook.HeaderSignature
+	HeaderRunTimestamp = "X-EcoCI-Timestamp"
+)
+
+// RunSignatureTolerance bounds how far the timestamp of a signed run may lie from the time it
+// is received, so captured submissions cannot be replayed later
+const RunSignatureTolerance = 5 * time.Minute
+
+// ErrRunSignatureMissing is returned for unsigned runs of repositories that require signatures
+var ErrRunSignatureMissing = errors.New("run signature missing")
+
+// ErrRunSignatureInvalid is returned for run signatures that do not match the body
+var ErrRunSignatureInvalid = errors.New("run signature invalid")
+
+// ErrRunSignatureExpired is returned for run signatures whose timestamp is too old or too far
+// in the future
+var ErrRunSignatureExpired = errors.New("run signature expired")
+
+// SignedRunsError is returned when runs are imported into a repository that requires signed
+// runs, which only POST /runs can check
+type SignedRunsError struct {
+	Repository string
+}
+
+func (e *SignedRunsError) Error() string {
+	return fmt.Sprintf("repository %s requires signed runs", e.Repository)
+}
+
+// SignRun returns the signature header value of a run body sent at timestamp, in Unix
+// seconds: the HMAC-SHA256 of "<timestamp>.<body>" with secret
+func SignRun(secret string, timestamp int64, body []byte) string {
+	return webhook.Sign(secret, append([]byte(strconv.FormatInt(timestamp, 10)+"."), body...))
+}
+
+// VerifyRunSignature checks the signature and timestamp headers of a run body against secret
+// at now
+func VerifyRunSignature(secret, signature, timestamp string, body []byte, now time.Time) error {
+	if signature == "" || timestamp == "" {
+		return ErrRunSignatureMissing
+	}
+	sentAt, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrRunSignatureInvalid
+	}
+	if !hmac.Equal([]byte(signature), []byte(SignRun(secret, sentAt, body))) {
+		return ErrRunSignatureInvalid
+	}
+	skew := now.Sub(time.Unix(sentAt, 0))
+	if skew > RunSignatureTolerance || skew < -RunSignatureTolerance {
+		return ErrRunSignatureExpired
+	}
+	return nil
+}
+
+// RunSigningSecret returns the secret runs for the repository fullName of a user must be
+// signed with, or "" when the repository does not exist yet or accepts unsigned runs
+func (s *RepositoryService) RunSigningSecret(ownerID uuid.UUID, fullName string) (string, error) {
+	var repo db.Repository
+	err := s.db.Where("full_name = ? AND owner_id = ?", fullName, ownerID).First(&repo).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to query repository: %w", err)
+	}
+	if !repo.SignedRuns || repo.RunSigningSecret == nil {
+		return "", nil
+	}
+	return *repo.RunSigningSecret, nil
+}
+
+// EnableSignedRuns generates a new run signing secret for a repository, replacing any
+// previous one, and requires runs to be signed with it from now on
+func (s *RepositoryService) EnableSignedRuns(repoID uuid.UUID) (*db.Repository, string, error) {
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		return nil, "", err
+	}
+	if err := s.setSignedRuns(repoID, &secret); err != nil {
+		return nil, "", err
+	}
+	repo, err := s.GetRepositoryByID(repoID)
+	if err != nil {
+		return nil, "", err
+	}
+	return repo, secret, nil
+}
+
+// DisableSignedRuns forgets the run signing secret of a repository, which accepts unsigned
+// runs again
+func (s *RepositoryService) DisableSignedRuns(repoID uuid.UUID) (*db.Repository, error) {
+	if err := s.setSignedRuns(repoID, nil); err != nil {
+		return nil, err
+	}
+	return s.GetRepositoryByID(repoID)
+}
+
+// setSignedRuns stores the run signing secret of a repository, requiring signatures unless
+// secret is nil
+func (s *RepositoryService) setSignedRuns(repoID uuid.UUID, secret *string) error {
+	result := s.db.Model(&db.Repository{}).Where("id = ?", repoID).Updates(map[string]interface{}{
+		"signed_runs":        secret != nil,
+		"run_signing_secret": secret,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update run signing: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("repository not found")
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// MaxSavedViewRangeDays is the longest relative date range of a saved view
+const MaxSavedViewRangeDays = 3650
+
+// ErrSavedViewNameTaken is returned when a user already has a saved view of the same name
+var ErrSavedViewNameTaken = errors.New("a saved view of the same name already exists")
+
+// SavedViewRequest represents a saved view as created or replaced by its owner. The query
+// parameters are those of the run listings and statistics: a filter expression, a sort field
+// and order, a grouping of the aggregates, and a date range relative to now.
+type SavedViewRequest struct {
+	Name         string     `json:"name" binding:"required,max=255" example:"Nightly builds on main"`
+	RepositoryID *uuid.UUID `json:"repository_id,omitempty"`
+	Filter       *string    `json:"filter,omitempty" example:"branch=main AND tag=nightly"`
+	Sort         *string    `json:"sort,omitempty" example:"co2_kg"`
+	Order        *string    `json:"order,omitempty" example:"desc"`
+	GroupBy      *string    `json:"group_by,omitempty" example:"workflow_name"`
+	RangeDays    *int       `json:"range_days,omitempty" example:"90"`
+}
+
+// ValidateSavedView checks the query parameters of req, dropping empty ones
+func ValidateSavedView(req *SavedViewRequest) error {
+	for _, value := range []**string{&req.Filter, &req.Sort, &req.Order, &req.GroupBy} {
+		if *value != nil && **value == "" {
+			*value = nil
+		}
+	}
+
+	if req.Filter != nil {
+		if _, err := ParseRunFilter(*req.Filter); err != nil {
+			return fmt.Errorf("invalid filter: %w", err)
+		}
+	}
+	switch {
+	case req.Sort != nil && !IsValidRunSort(*req.Sort):
+		return fmt.Errorf("sort must be one of %v", RunSortFields)
+	case req.Order != nil && *req.Order != "asc" && *req.Order != "desc":
+		return fmt.Errorf("order must be one of asc, desc")
+	case req.GroupBy != nil && !IsValidGroupBy(*req.GroupBy):
+		return fmt.Errorf("group_by must be one of workflow_name, workflow_run_group, branch, environment, ci_provider, tag or metadata.<key>")
+	case req.RangeDays != nil && (*req.RangeDays < 1 || *req.RangeDays > MaxSavedViewRangeDays):
+		return fmt.Errorf("range_days must be between 1 and %d", MaxSavedViewRangeDays)
+	}
+	return nil
+}
+
+// SavedViewService handles the saved views of users
+type SavedViewService struct {
+	db *gorm.DB
+}
+
+// NewSavedViewService creates a new saved view service
+func NewSavedViewService(database *gorm.DB) *SavedViewService {
+	return &SavedViewService{db: database}
+}
+
+// ListViews retrieves the saved views of a user by name
+func (s *SavedViewService) ListViews(userID uuid.UUID) ([]db.SavedView, error) {
+	views := []db.SavedView{}
+	if err := s.db.Where("user_id = ?", userID).Order("name ASC").Find(&views).Error; err != nil {
+		return nil, fmt.Errorf("failed to list saved views: %w", err)
+	}
+	return views, nil
+}
+
+// GetView retrieves a saved view by ID
+func (s *SavedViewService) GetView(viewID uuid.UUID) (*db.SavedView, error) {
+	var view db.SavedView
+	if err := s.db.First(&view, "id = ?", viewID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("saved view not found")
+		}
+		return nil, fmt.Errorf("failed to get saved view: %w", err)
+	}
+	return &view, nil
+}
+
+// CreateView saves a validated view for userID, returning ErrSavedViewNameTaken when the user
+// already has a view of the same name
+func (s *SavedViewService) CreateView(userID uuid.UUID, req *SavedViewRequest) (*db.SavedView, error) {
+	view := db.SavedView{UserID: userID}
+	applySavedView(&view, req)
+
+	if err := s.checkViewName(&view); err != nil {
+		return nil, err
+	}
+	if err := s.db.Create(&view).Error; err != nil {
+		return nil, fmt.Errorf("failed to create saved view: %w", err)
+	}
+	return &view, nil
+}
+
+// UpdateView replaces a saved view with a validated request, returning ErrSavedViewNameTaken
+// when it is renamed to the name of another view of its user
+func (s *SavedViewService) UpdateView(view *db.SavedView, req *SavedViewRequest) (*db.SavedView, error) {
+	applySavedView(view, req)
+
+	if err := s.checkViewName(view); err != nil {
+		return nil, err
+	}
+	if err := s.db.Save(view).Error; err != nil {
+		return nil, fmt.Errorf("failed to update saved view: %w", err)
+	}
+	return view, nil
+}
+
+// DeleteView removes a saved view
+func (s *SavedViewService) DeleteView(viewID uuid.UUID) error {
+	if err := s.db.Where("id = ?", viewID).Delete(&db.SavedView{}).Error; err != nil {
+		return fmt.Errorf("failed to delete saved view: %w", err)
+	}
+	return nil
+}
+
+// checkViewName returns ErrSavedViewNameTaken when another view of the user of view has its name
+func (s *SavedViewService) checkViewName(view *db.SavedView) error {
+	var taken int64
+	err := s.db.Model(&db.SavedView{}).
+		Where("user_id = ? AND name = ? AND id <> ?", view.UserID, view.Name, view.ID).
+		Count(&taken).Error
+	if err != nil {
+		return fmt.Errorf("failed to check saved view name: %w", err)
+	}
+	if taken > 0 {
+		return ErrSavedViewNameTaken
+	}
+	return nil
+}
+
+// applySavedView copies a validated request onto view
+func applySavedView(view *db.SavedView, req *SavedViewRequest) {
+	view.Name = req.Name
+	view.RepositoryID = req.RepositoryID
+	view.Filter = req.Filter
+	view.Sort = req.Sort
+	view.Order = req.Order
+	view.GroupBy = req.GroupBy
+	view.RangeDays = req.RangeDays
+}
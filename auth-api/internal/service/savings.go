@@ -0,0 +1,138 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// SavingsReport compares actual emissions with what the same number of runs would have
+// emitted at the frozen baseline rates. Positive savings mean less was emitted than at baseline.
+type SavingsReport struct {
+	Baseline          db.RepositoryBaseline `json:"baseline"`
+	From              time.Time             `json:"from"`
+	To                time.Time             `json:"to"`
+	RunCount          int64                 `json:"run_count"`
+	ActualCO2Kg       float64               `json:"actual_co2_kg"`
+	BaselineCO2Kg     float64               `json:"baseline_co2_kg"`
+	SavedCO2Kg        float64               `json:"saved_co2_kg"`
+	SavedCO2Percent   *float64              `json:"saved_co2_percent"`
+	ActualEnergyKWh   float64               `json:"actual_energy_kwh"`
+	BaselineEnergyKWh float64               `json:"baseline_energy_kwh"`
+	SavedEnergyKWh    float64               `json:"saved_energy_kwh"`
+	Months            []MonthlySavings      `json:"months"`
+}
+
+// MonthlySavings represents the savings of one calendar month and the running total
+type MonthlySavings struct {
+	Month                    time.Time `json:"month"`
+	RunCount                 int64     `json:"run_count"`
+	ActualCO2Kg              float64   `json:"actual_co2_kg"`
+	BaselineCO2Kg            float64   `json:"baseline_co2_kg"`
+	SavedCO2Kg               float64   `json:"saved_co2_kg"`
+	CumulativeSavedCO2Kg     float64   `json:"cumulative_saved_co2_kg"`
+	SavedEnergyKWh           float64   `json:"saved_energy_kwh"`
+	CumulativeSavedEnergyKWh float64   `json:"cumulative_saved_energy_kwh"`
+}
+
+// GetBaseline retrieves the frozen baseline of a repository
+func (s *StatsService) GetBaseline(repoID uuid.UUID) (*db.RepositoryBaseline, error) {
+	var baseline db.RepositoryBaseline
+	err := s.db.Where("repository_id = ?", repoID).First(&baseline).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("baseline not found")
+		}
+		return nil, fmt.Errorf("failed to get baseline: %w", err)
+	}
+
+	return &baseline, nil
+}
+
+// FreezeBaseline computes the per-run rates of a repository between from and to and stores
+// them as the repository's baseline, replacing any previous baseline
+func (s *StatsService) FreezeBaseline(repoID uuid.UUID, from, to time.Time) (*db.RepositoryBaseline, error) {
+	summary, err := s.Summary(RepositoryRuns(repoID), from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute baseline: %w", err)
+	}
+	if summary.RunCount == 0 {
+		return nil, fmt.Errorf("baseline period has no runs")
+	}
+
+	baseline := db.RepositoryBaseline{
+		RepositoryID:    repoID,
+		PeriodFrom:      from,
+		PeriodTo:        to,
+		RunCount:        summary.RunCount,
+		CO2KgPerRun:     summary.TotalCO2Kg / float64(summary.RunCount),
+		EnergyKWhPerRun: summary.TotalEnergyKWh / float64(summary.RunCount),
+	}
+
+	err = s.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "repository_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"period_from", "period_to", "run_count", "co2_kg_per_run", "energy_kwh_per_run", "updated_at",
+		}),
+	}).Create(&baseline).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to save baseline: %w", err)
+	}
+
+	return s.GetBaseline(repoID)
+}
+
+// Savings reports the cumulative savings of a repository between from and to against its baseline
+func (s *StatsService) Savings(repoID uuid.UUID, from, to time.Time) (*SavingsReport, error) {
+	baseline, err := s.GetBaseline(repoID)
+	if err != nil {
+		return nil, err
+	}
+
+	months, err := s.MonthlySummaries(RepositoryRuns(repoID), from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	report := SavingsReport{
+		Baseline: *baseline,
+		From:     from,
+		To:       to,
+		Months:   []MonthlySavings{},
+	}
+	for _, month := range months {
+		expectedCO2 := baseline.CO2KgPerRun * float64(month.RunCount)
+		expectedEnergy := baseline.EnergyKWhPerRun * float64(month.RunCount)
+
+		report.RunCount += month.RunCount
+		report.ActualCO2Kg += month.TotalCO2Kg
+		report.BaselineCO2Kg += expectedCO2
+		report.ActualEnergyKWh += month.TotalEnergyKWh
+		report.BaselineEnergyKWh += expectedEnergy
+
+		report.Months = append(report.Months, MonthlySavings{
+			Month:                    month.From,
+			RunCount:                 month.RunCount,
+			ActualCO2Kg:              month.TotalCO2Kg,
+			BaselineCO2Kg:            expectedCO2,
+			SavedCO2Kg:               expectedCO2 - month.TotalCO2Kg,
+			CumulativeSavedCO2Kg:     report.BaselineCO2Kg - report.ActualCO2Kg,
+			SavedEnergyKWh:           expectedEnergy - month.TotalEnergyKWh,
+			CumulativeSavedEnergyKWh: report.BaselineEnergyKWh - report.ActualEnergyKWh,
+		})
+	}
+
+	report.SavedCO2Kg = report.BaselineCO2Kg - report.ActualCO2Kg
+	report.SavedEnergyKWh = report.BaselineEnergyKWh - report.ActualEnergyKWh
+	if report.BaselineCO2Kg != 0 {
+		percent := report.SavedCO2Kg / report.BaselineCO2Kg * 100
+		report.SavedCO2Percent = &percent
+	}
+
+	return &report, nil
+}
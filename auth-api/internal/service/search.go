@@ -0,0 +1,83 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/filter"
+)
+
+// runSearchDocument is the text searched for each run on PostgreSQL: its workflow, branch and
+// commit and the string and number values of its metadata. It must match the expression of
+// the idx_runs_search index for the index to be used.
+const runSearchDocument = `(to_tsvector('simple', coalesce(runs.workflow_name, '') || ' ' || coalesce(runs.branch_name, '') || ' ' || coalesce(runs.git_commit_sha, ''))
+	|| jsonb_to_tsvector('simple', coalesce(runs.run_metadata, '{}'::jsonb), '["string", "numeric"]'))`
+
+// runSearchColumns are the columns matched by the search on other dialects
+var runSearchColumns = []string{
+	"COALESCE(runs.workflow_name, '')",
+	"COALESCE(runs.branch_name, '')",
+	"COALESCE(runs.git_commit_sha, '')",
+	"COALESCE(CAST(runs.run_metadata AS TEXT), '')",
+}
+
+// SearchRuns finds the runs of repositories the user can see whose workflow, branch, commit or
+// metadata values (tags, commit messages, ...) match q, optionally within one repository and
+// among the runs matching expr. On PostgreSQL q is a web search query ("quoted phrases", or,
+// -excluded words); elsewhere every word of q must appear in one of the searched columns.
+// Runs are sorted by sortBy in order, or without sortBy by relevance on PostgreSQL and newest
+// first elsewhere.
+func (s *RunService) SearchRuns(userID uuid.UUID, q string, repoID *uuid.UUID, expr *filter.Expr, limit, offset int, sortBy, order string) ([]db.Run, int64, error) {
+	postgres := db.DialectOf(s.db).IsPostgres()
+
+	query := func() *gorm.DB {
+		query := s.db.Model(&db.Run{}).
+			Joins("JOIN repositories r ON r.id = runs.repository_id").
+			Scopes(VisibleTo(userID)).
+			Where("r.deleted_at IS NULL").
+			Scopes(RunsMatching(expr))
+		if repoID != nil {
+			query = query.Where("runs.repository_id = ?", *repoID)
+		}
+		if postgres {
+			return query.Where(runSearchDocument+" @@ websearch_to_tsquery('simple', ?)", q)
+		}
+		dialect := db.DialectOf(s.db)
+		for _, term := range strings.Fields(q) {
+			conditions := make([]string, len(runSearchColumns))
+			values := make([]interface{}, len(runSearchColumns))
+			for i, column := range runSearchColumns {
+				conditions[i] = dialect.ILike(column)
+				values[i] = "%" + db.EscapeLike(term) + "%"
+			}
+			query = query.Where("("+strings.Join(conditions, " OR ")+")", values...)
+		}
+		return query
+	}
+
+	var total int64
+	if err := query().Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count runs: %w", err)
+	}
+
+	find := query().Preload("User").Preload("Repository")
+	if postgres && sortBy == "" {
+		find = find.Order(clause.OrderBy{Expression: clause.Expr{
+			SQL:  "ts_rank(" + runSearchDocument + ", websearch_to_tsquery('simple', ?)) DESC, runs.created_at DESC, runs.id DESC",
+			Vars: []interface{}{q},
+		}})
+	} else {
+		find = find.Order(runOrder(sortBy, order))
+	}
+
+	var runs []db.Run
+	if err := find.Limit(limit).Offset(offset).Find(&runs).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to search runs: %w", err)
+	}
+	return runs, total, nil
+}
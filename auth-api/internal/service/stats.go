@@ -0,0 +1,624 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// MaxTimeSeriesBuckets caps the number of buckets a single time series may span
+const MaxTimeSeriesBuckets = 1000
+
+// statsMetrics maps the metric names accepted by the API to run columns
+var statsMetrics = map[string]string{
+	"co2_kg":     "co2_kg",
+	"energy_kwh": "energy_kwh",
+	"duration_s": "duration_s",
+}
+
+// StatsService handles aggregated statistics over runs
+type StatsService struct {
+	db *gorm.DB
+}
+
+// NewStatsService creates a new stats service
+func NewStatsService(database *gorm.DB) *StatsService {
+	return &StatsService{
+		db: database,
+	}
+}
+
+// RunScope restricts the runs a statistic is computed over
+type RunScope func(*gorm.DB) *gorm.DB
+
+// RepositoryRuns scopes statistics to the runs of a repository
+func RepositoryRuns(repoID uuid.UUID) RunScope {
+	return func(query *gorm.DB) *gorm.DB {
+		return query.Where("runs.repository_id = ?", repoID)
+	}
+}
+
+// UserRuns scopes statistics to the runs submitted by a user
+func UserRuns(userID uuid.UUID) RunScope {
+	return func(query *gorm.DB) *gorm.DB {
+		return query.Where("runs.user_id = ?", userID)
+	}
+}
+
+// UserRunsVisibleTo scopes statistics to the runs a user submitted to repositories viewerID may
+// see: public repositories and those the viewer owns, collaborates on or whose organization
+// they belong to
+func UserRunsVisibleTo(userID, viewerID uuid.UUID) RunScope {
+	return func(query *gorm.DB) *gorm.DB {
+		return query.Where("runs.user_id = ?", userID).
+			Where(`runs.repository_id IN (SELECT r.id FROM repositories r WHERE (r.private = ? OR `+accessibleRepositoryCondition+`))`,
+				false, viewerID, viewerID, viewerID)
+	}
+}
+
+// OrganizationRuns scopes statistics to the runs of all repositories of an organization
+func OrganizationRuns(orgID uuid.UUID) RunScope {
+	return func(query *gorm.DB) *gorm.DB {
+		return query.Where("runs.repository_id IN (SELECT id FROM repositories WHERE organization_id = ?)", orgID)
+	}
+}
+
+// IsValidMetric reports whether metric can be aggregated by the stats endpoints
+func IsValidMetric(metric string) bool {
+	_, ok := statsMetrics[metric]
+	return ok
+}
+
+// IsValidInterval reports whether interval is a supported time series bucket size
+func IsValidInterval(interval string) bool {
+	return interval == "day" || interval == "week" || interval == "month"
+}
+
+// TimeSeriesQuery describes a bucketed time series request
+type TimeSeriesQuery struct {
+	Metric   string
+	Interval string
+	From     time.Time
+	To       time.Time
+}
+
+// TimeSeriesPoint represents the aggregate of a metric over one bucket
+type TimeSeriesPoint struct {
+	BucketStart time.Time `json:"bucket_start"`
+	Sum         float64   `json:"sum"`
+	Avg         float64   `json:"avg"`
+	Count       int64     `json:"count"`
+}
+
+// TruncateToInterval returns the start of the bucket containing t (weeks start on Monday, UTC)
+func TruncateToInterval(t time.Time, interval string) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch interval {
+	case "week":
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return day
+	}
+}
+
+// nextBucket returns the start of the bucket following start
+func nextBucket(start time.Time, interval string) time.Time {
+	switch interval {
+	case "week":
+		return start.AddDate(0, 0, 7)
+	case "month":
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// CountBuckets returns how many buckets of the interval the range [from, to] spans
+func CountBuckets(from, to time.Time, interval string) int {
+	count := 0
+	end := TruncateToInterval(to, interval)
+	for bucket := TruncateToInterval(from, interval); !bucket.After(end); bucket = nextBucket(bucket, interval) {
+		count++
+		if count > MaxTimeSeriesBuckets {
+			break
+		}
+	}
+	return count
+}
+
+// TimeSeries returns the metric bucketed by interval between From and To, including empty buckets
+func (s *StatsService) TimeSeries(scope RunScope, q TimeSeriesQuery) ([]TimeSeriesPoint, error) {
+	column, ok := statsMetrics[q.Metric]
+	if !ok {
+		return nil, fmt.Errorf("unsupported metric: %s", q.Metric)
+	}
+	if !IsValidInterval(q.Interval) {
+		return nil, fmt.Errorf("unsupported interval: %s", q.Interval)
+	}
+	if CountBuckets(q.From, q.To, q.Interval) > MaxTimeSeriesBuckets {
+		return nil, fmt.Errorf("time range spans more than %d buckets", MaxTimeSeriesBuckets)
+	}
+
+	bucketExpr := db.DialectOf(s.db).DateTrunc(q.Interval, "runs.created_at")
+	rows, err := s.db.Model(&db.Run{}).
+		Select(bucketExpr+" as bucket_start, "+
+			"COALESCE(SUM(runs."+column+"), 0) as sum, "+
+			"COALESCE(AVG(runs."+column+"), 0) as avg, "+
+			"COUNT(runs.id) as count").
+		Scopes(scope).
+		Where("runs.created_at >= ? AND runs.created_at <= ?", q.From, q.To).
+		Group(bucketExpr).
+		Order("bucket_start ASC").
+		Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute time series query: %w", err)
+	}
+	defer rows.Close()
+
+	buckets := make(map[int64]TimeSeriesPoint)
+	for rows.Next() {
+		var point TimeSeriesPoint
+		if err := rows.Scan(db.ScanTime(&point.BucketStart), &point.Sum, &point.Avg, &point.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan time series bucket: %w", err)
+		}
+		buckets[point.BucketStart.Unix()] = point
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read time series buckets: %w", err)
+	}
+
+	// Fill gaps so charts get a continuous series
+	var points []TimeSeriesPoint
+	end := TruncateToInterval(q.To, q.Interval)
+	for bucket := TruncateToInterval(q.From, q.Interval); !bucket.After(end); bucket = nextBucket(bucket, q.Interval) {
+		point, ok := buckets[bucket.Unix()]
+		if !ok {
+			point = TimeSeriesPoint{BucketStart: bucket}
+		}
+		points = append(points, point)
+	}
+
+	return points, nil
+}
+
+// CompareNone and ComparePreviousPeriod are the supported comparison windows
+const (
+	CompareNone           = ""
+	ComparePreviousPeriod = "previous_period"
+)
+
+// IsValidCompare reports whether compare is a supported comparison window
+func IsValidCompare(compare string) bool {
+	return compare == CompareNone || compare == ComparePreviousPeriod
+}
+
+// PeriodSummary aggregates runs over a time range
+type PeriodSummary struct {
+	From           time.Time `json:"from"`
+	To             time.Time `json:"to"`
+	TotalCO2Kg     float64   `json:"total_co2_kg"`
+	TotalEnergyKWh float64   `json:"total_energy_kwh"`
+	TotalDurationS float64   `json:"total_duration_s"`
+	RunCount       int64     `json:"run_count"`
+	// TotalWaterL is the water of the runs with a known water usage effectiveness
+	TotalWaterL float64 `json:"total_water_l"`
+	// TotalGPUEnergyKWh is the part of the energy consumed by GPUs
+	TotalGPUEnergyKWh float64 `json:"total_gpu_energy_kwh"`
+	// The network transfer of the runs and its emissions, reported apart from their energy
+	// and CO2
+	TotalNetworkBytes     int64   `json:"total_network_bytes"`
+	TotalNetworkEnergyKWh float64 `json:"total_network_energy_kwh"`
+	TotalNetworkCO2Kg     float64 `json:"total_network_co2_kg"`
+
+	// Method is the accounting method of TotalCO2Kg when one was asked for; market-based
+	// summaries keep the location-based CO2 as LocationBasedCO2Kg
+	Method             string   `json:"method,omitempty"`
+	LocationBasedCO2Kg *float64 `json:"location_based_co2_kg,omitempty"`
+
+	// Percentiles is only computed for the requested period, not for comparison periods
+	Percentiles *MetricPercentiles `json:"percentiles,omitempty"`
+
+	// rangeCondition is the created_at condition the summary was aggregated with
+	rangeCondition string
+}
+
+// MetricChange describes how a metric moved between two periods. Percent is nil when
+// the previous value is zero and a relative change is undefined.
+type MetricChange struct {
+	Previous float64  `json:"previous"`
+	Current  float64  `json:"current"`
+	Absolute float64  `json:"absolute"`
+	Percent  *float64 `json:"percent"`
+}
+
+// PeriodComparison compares a period with the preceding period of equal length
+type PeriodComparison struct {
+	Compare  string                  `json:"compare"`
+	Previous PeriodSummary           `json:"previous"`
+	Changes  map[string]MetricChange `json:"changes"`
+}
+
+// Summary aggregates the runs in scope created between from and to (inclusive)
+func (s *StatsService) Summary(scope RunScope, from, to time.Time) (*PeriodSummary, error) {
+	rangeCondition := "runs.created_at >= ? AND runs.created_at <= ?"
+	summary, err := s.summarize(scope, from, to, rangeCondition)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get period summary: %w", err)
+	}
+
+	percentiles, err := s.percentiles(func() *gorm.DB {
+		return s.db.Model(&db.Run{}).Scopes(scope).Where(rangeCondition, from, to)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get period percentiles: %w", err)
+	}
+	summary.Percentiles = percentiles
+
+	return summary, nil
+}
+
+// CompareWithPreviousPeriod compares current with the period of equal length ending where it starts
+func (s *StatsService) CompareWithPreviousPeriod(scope RunScope, current *PeriodSummary) (*PeriodComparison, error) {
+	length := current.To.Sub(current.From)
+	previous, err := s.summarize(scope, current.From.Add(-length), current.From, "runs.created_at >= ? AND runs.created_at < ?")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get previous period summary: %w", err)
+	}
+	if current.Method != "" {
+		if err := s.ApplyAccountingMethod(scope, previous, current.Method); err != nil {
+			return nil, fmt.Errorf("failed to get previous period summary: %w", err)
+		}
+	}
+
+	return &PeriodComparison{
+		Compare:  ComparePreviousPeriod,
+		Previous: *previous,
+		Changes: map[string]MetricChange{
+			"co2_kg":         newMetricChange(previous.TotalCO2Kg, current.TotalCO2Kg),
+			"energy_kwh":     newMetricChange(previous.TotalEnergyKWh, current.TotalEnergyKWh),
+			"duration_s":     newMetricChange(previous.TotalDurationS, current.TotalDurationS),
+			"run_count":      newMetricChange(float64(previous.RunCount), float64(current.RunCount)),
+			"water_l":        newMetricChange(previous.TotalWaterL, current.TotalWaterL),
+			"gpu_energy_kwh": newMetricChange(previous.TotalGPUEnergyKWh, current.TotalGPUEnergyKWh),
+			"network_co2_kg": newMetricChange(previous.TotalNetworkCO2Kg, current.TotalNetworkCO2Kg),
+		},
+	}, nil
+}
+
+// summarize runs the aggregate query for a range using the given created_at condition
+func (s *StatsService) summarize(scope RunScope, from, to time.Time, rangeCondition string) (*PeriodSummary, error) {
+	summary := PeriodSummary{From: from, To: to, rangeCondition: rangeCondition}
+	row := s.db.Model(&db.Run{}).
+		Select(`
+			COALESCE(SUM(runs.co2_kg), 0) as total_co2_kg,
+			COALESCE(SUM(runs.energy_kwh), 0) as total_energy_kwh,
+			COALESCE(SUM(runs.duration_s), 0) as total_duration_s,
+			COUNT(runs.id) as run_count,
+			COALESCE(SUM(runs.water_l), 0) as total_water_l,
+			COALESCE(SUM(runs.gpu_energy_kwh), 0) as total_gpu_energy_kwh,
+			COALESCE(SUM(runs.network_bytes), 0) as total_network_bytes,
+			COALESCE(SUM(runs.network_energy_kwh), 0) as total_network_energy_kwh,
+			COALESCE(SUM(runs.network_co2_kg), 0) as total_network_co2_kg
+		`).
+		Scopes(scope).
+		Where(rangeCondition, from, to).
+		Row()
+
+	if err := row.Scan(&summary.TotalCO2Kg, &summary.TotalEnergyKWh, &summary.TotalDurationS, &summary.RunCount, &summary.TotalWaterL, &summary.TotalGPUEnergyKWh,
+		&summary.TotalNetworkBytes, &summary.TotalNetworkEnergyKWh, &summary.TotalNetworkCO2Kg); err != nil {
+		return nil, err
+	}
+	return &summary, nil
+}
+
+// newMetricChange computes the absolute and percentage change from previous to current
+func newMetricChange(previous, current float64) MetricChange {
+	change := MetricChange{
+		Previous: previous,
+		Current:  current,
+		Absolute: current - previous,
+	}
+	if previous != 0 {
+		percent := (current - previous) / previous * 100
+		change.Percent = &percent
+	}
+	return change
+}
+
+// Percentiles holds the p50, p90 and p99 of a metric
+type Percentiles struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+}
+
+// MetricPercentiles holds the percentiles of the heavy-tailed run metrics
+type MetricPercentiles struct {
+	CO2Kg     Percentiles `json:"co2_kg"`
+	DurationS Percentiles `json:"duration_s"`
+}
+
+// WorkflowStats represents aggregated statistics for one workflow of a repository
+type WorkflowStats struct {
+	WorkflowName   *string           `json:"workflow_name"`
+	RunCount       int64             `json:"run_count"`
+	TotalCO2Kg     float64           `json:"total_co2_kg"`
+	AvgCO2Kg       float64           `json:"avg_co2_kg"`
+	TotalEnergyKWh float64           `json:"total_energy_kwh"`
+	AvgDurationS   float64           `json:"avg_duration_s"`
+	Percentiles    MetricPercentiles `json:"percentiles"`
+}
+
+// WorkflowStats aggregates the runs in scope created between from and to per workflow,
+// ordered by total CO2 descending. Runs without a workflow name are grouped together.
+func (s *StatsService) WorkflowStats(scope RunScope, from, to time.Time) ([]WorkflowStats, error) {
+	rangeCondition := "runs.created_at >= ? AND runs.created_at <= ?"
+	rows, err := s.db.Model(&db.Run{}).
+		Select(`
+			runs.workflow_name,
+			COUNT(runs.id) as run_count,
+			COALESCE(SUM(runs.co2_kg), 0) as total_co2_kg,
+			COALESCE(AVG(runs.co2_kg), 0) as avg_co2_kg,
+			COALESCE(SUM(runs.energy_kwh), 0) as total_energy_kwh,
+			COALESCE(AVG(runs.duration_s), 0) as avg_duration_s
+		`).
+		Scopes(scope).
+		Where(rangeCondition, from, to).
+		Group("runs.workflow_name").
+		Order("total_co2_kg DESC").
+		Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute workflow stats query: %w", err)
+	}
+	defer rows.Close()
+
+	var results []WorkflowStats
+	for rows.Next() {
+		var stat WorkflowStats
+		if err := rows.Scan(&stat.WorkflowName, &stat.RunCount, &stat.TotalCO2Kg, &stat.AvgCO2Kg,
+			&stat.TotalEnergyKWh, &stat.AvgDurationS); err != nil {
+			return nil, fmt.Errorf("failed to scan workflow stats: %w", err)
+		}
+		results = append(results, stat)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read workflow stats: %w", err)
+	}
+
+	percentiles, err := s.workflowPercentiles(scope, rangeCondition, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workflow percentiles: %w", err)
+	}
+	for i := range results {
+		results[i].Percentiles = percentiles[newWorkflowKey(results[i].WorkflowName)]
+	}
+
+	return results, nil
+}
+
+// workflowKey identifies a workflow in a map, telling runs without a workflow name apart
+// from a workflow with an empty name
+type workflowKey struct {
+	name  string
+	unset bool
+}
+
+func newWorkflowKey(name *string) workflowKey {
+	if name == nil {
+		return workflowKey{unset: true}
+	}
+	return workflowKey{name: *name}
+}
+
+// workflowPercentiles computes the CO2 and duration percentiles of every workflow in one
+// query. PostgreSQL groups percentile_cont by workflow; other dialects load the values of all
+// runs in range and split them per workflow.
+func (s *StatsService) workflowPercentiles(scope RunScope, rangeCondition string, from, to time.Time) (map[workflowKey]MetricPercentiles, error) {
+	query := s.db.Model(&db.Run{}).Scopes(scope).Where(rangeCondition, from, to)
+	result := make(map[workflowKey]MetricPercentiles)
+
+	if db.DialectOf(s.db).IsPostgres() {
+		rows, err := query.Select(`
+			runs.workflow_name,
+			COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY runs.co2_kg), 0),
+			COALESCE(percentile_cont(0.9) WITHIN GROUP (ORDER BY runs.co2_kg), 0),
+			COALESCE(percentile_cont(0.99) WITHIN GROUP (ORDER BY runs.co2_kg), 0),
+			COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY runs.duration_s), 0),
+			COALESCE(percentile_cont(0.9) WITHIN GROUP (ORDER BY runs.duration_s), 0),
+			COALESCE(percentile_cont(0.99) WITHIN GROUP (ORDER BY runs.duration_s), 0)
+		`).Group("runs.workflow_name").Rows()
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var name *string
+			var p MetricPercentiles
+			if err := rows.Scan(&name,
+				&p.CO2Kg.P50, &p.CO2Kg.P90, &p.CO2Kg.P99,
+				&p.DurationS.P50, &p.DurationS.P90, &p.DurationS.P99,
+			); err != nil {
+				return nil, err
+			}
+			result[newWorkflowKey(name)] = p
+		}
+		return result, rows.Err()
+	}
+
+	rows, err := query.Select("runs.workflow_name, runs.co2_kg, runs.duration_s").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	co2 := make(map[workflowKey][]float64)
+	durations := make(map[workflowKey][]float64)
+	for rows.Next() {
+		var name *string
+		var co2Kg, durationS float64
+		if err := rows.Scan(&name, &co2Kg, &durationS); err != nil {
+			return nil, err
+		}
+		key := newWorkflowKey(name)
+		co2[key] = append(co2[key], co2Kg)
+		durations[key] = append(durations[key], durationS)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for key := range co2 {
+		result[key] = MetricPercentiles{
+			CO2Kg:     computePercentiles(co2[key]),
+			DurationS: computePercentiles(durations[key]),
+		}
+	}
+	return result, nil
+}
+
+// percentiles computes CO2 and duration percentiles over the runs selected by query.
+// PostgreSQL computes them with percentile_cont; other dialects load the values and
+// interpolate in the same way.
+func (s *StatsService) percentiles(query func() *gorm.DB) (*MetricPercentiles, error) {
+	var result MetricPercentiles
+
+	if db.DialectOf(s.db).IsPostgres() {
+		row := query().Select(`
+			COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY runs.co2_kg), 0),
+			COALESCE(percentile_cont(0.9) WITHIN GROUP (ORDER BY runs.co2_kg), 0),
+			COALESCE(percentile_cont(0.99) WITHIN GROUP (ORDER BY runs.co2_kg), 0),
+			COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY runs.duration_s), 0),
+			COALESCE(percentile_cont(0.9) WITHIN GROUP (ORDER BY runs.duration_s), 0),
+			COALESCE(percentile_cont(0.99) WITHIN GROUP (ORDER BY runs.duration_s), 0)
+		`).Row()
+		if err := row.Scan(
+			&result.CO2Kg.P50, &result.CO2Kg.P90, &result.CO2Kg.P99,
+			&result.DurationS.P50, &result.DurationS.P90, &result.DurationS.P99,
+		); err != nil {
+			return nil, err
+		}
+		return &result, nil
+	}
+
+	var co2, durations []float64
+	if err := query().Pluck("runs.co2_kg", &co2).Error; err != nil {
+		return nil, err
+	}
+	if err := query().Pluck("runs.duration_s", &durations).Error; err != nil {
+		return nil, err
+	}
+	result.CO2Kg = computePercentiles(co2)
+	result.DurationS = computePercentiles(durations)
+	return &result, nil
+}
+
+// computePercentiles computes percentiles with linear interpolation, matching percentile_cont
+func computePercentiles(values []float64) Percentiles {
+	sort.Float64s(values)
+	return Percentiles{
+		P50: percentileCont(values, 0.5),
+		P90: percentileCont(values, 0.9),
+		P99: percentileCont(values, 0.99),
+	}
+}
+
+// percentileCont returns the p-th percentile of sorted values using linear interpolation
+func percentileCont(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := p * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	fraction := rank - float64(lower)
+	return sorted[lower] + (sorted[upper]-sorted[lower])*fraction
+}
+
+// MonthlySummaries aggregates the runs in scope created between from and to per calendar month (UTC)
+func (s *StatsService) MonthlySummaries(scope RunScope, from, to time.Time) ([]PeriodSummary, error) {
+	bucketExpr := db.DialectOf(s.db).DateTrunc("month", "runs.created_at")
+	rows, err := s.db.Model(&db.Run{}).
+		Select(bucketExpr+` as bucket_start,
+			COALESCE(SUM(runs.co2_kg), 0) as total_co2_kg,
+			COALESCE(SUM(runs.energy_kwh), 0) as total_energy_kwh,
+			COALESCE(SUM(runs.duration_s), 0) as total_duration_s,
+			COUNT(runs.id) as run_count,
+			COALESCE(SUM(runs.water_l), 0) as total_water_l,
+			COALESCE(SUM(runs.gpu_energy_kwh), 0) as total_gpu_energy_kwh,
+			COALESCE(SUM(runs.network_bytes), 0) as total_network_bytes,
+			COALESCE(SUM(runs.network_energy_kwh), 0) as total_network_energy_kwh,
+			COALESCE(SUM(runs.network_co2_kg), 0) as total_network_co2_kg`).
+		Scopes(scope).
+		Where("runs.created_at >= ? AND runs.created_at <= ?", from, to).
+		Group(bucketExpr).
+		Order("bucket_start ASC").
+		Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute monthly summary query: %w", err)
+	}
+	defer rows.Close()
+
+	var summaries []PeriodSummary
+	for rows.Next() {
+		var summary PeriodSummary
+		if err := rows.Scan(db.ScanTime(&summary.From), &summary.TotalCO2Kg, &summary.TotalEnergyKWh,
+			&summary.TotalDurationS, &summary.RunCount, &summary.TotalWaterL, &summary.TotalGPUEnergyKWh,
+			&summary.TotalNetworkBytes, &summary.TotalNetworkEnergyKWh, &summary.TotalNetworkCO2Kg); err != nil {
+			return nil, fmt.Errorf("failed to scan monthly summary: %w", err)
+		}
+		summary.To = nextBucket(summary.From, "month")
+		summaries = append(summaries, summary)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read monthly summaries: %w", err)
+	}
+
+	return summaries, nil
+}
+
+// RunRow is a run together with the full name of its repository, as used by exports
+type RunRow struct {
+	db.Run
+	RepositoryFullName string
+}
+
+// EachRun calls fn for every run in scope created between from and to, oldest first,
+// without loading them all into memory
+func (s *StatsService) EachRun(scope RunScope, from, to time.Time, fn func(*RunRow) error) error {
+	rows, err := s.db.Model(&db.Run{}).
+		Select("runs.*, repositories.full_name as repository_full_name").
+		Joins("JOIN repositories ON repositories.id = runs.repository_id").
+		Scopes(scope).
+		Where("runs.created_at >= ? AND runs.created_at <= ?", from, to).
+		Order("runs.created_at ASC").
+		Rows()
+	if err != nil {
+		return fmt.Errorf("failed to query runs: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row RunRow
+		if err := s.db.ScanRows(rows, &row); err != nil {
+			return fmt.Errorf("failed to scan run: %w", err)
+		}
+		if err := fn(&row); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read runs: %w", err)
+	}
+
+	return nil
+}
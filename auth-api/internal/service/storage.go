@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// storageDaysPerMonth is the average length of a month the storage energy factor is given per
+const storageDaysPerMonth = 365.25 / 12
+
+// bytesPerTB converts bytes to the TB the storage energy factor is given per
+const bytesPerTB = 1e12
+
+// MaxStorageCatchUpDays bounds how many past days the storage-emissions job accrues for a
+// repository, so a long outage or an old first report does not stall it
+const MaxStorageCatchUpDays = 31
+
+// StorageService accrues the standing energy and CO2 of the artifact and cache storage of
+// repositories
+type StorageService struct {
+	db *gorm.DB
+	// kwhPerTBMonth and gramsPerKWh convert storage to energy and CO2
+	kwhPerTBMonth float64
+	gramsPerKWh   float64
+}
+
+// NewStorageService creates a new storage service converting a TB stored for a month to
+// kwhPerTBMonth of energy, emitted at gramsPerKWh
+func NewStorageService(database *gorm.DB, kwhPerTBMonth, gramsPerKWh float64) *StorageService {
+	return &StorageService{
+		db:            database,
+		kwhPerTBMonth: kwhPerTBMonth,
+		gramsPerKWh:   gramsPerKWh,
+	}
+}
+
+// StorageReportRequest is the artifact and cache storage a repository holds
+type StorageReportRequest struct {
+	ArtifactBytes *int64 `json:"artifact_bytes" binding:"required" example:"52428800000"`
+	CacheBytes    *int64 `json:"cache_bytes" binding:"required" example:"10737418240"`
+}
+
+// ValidateStorageReport checks that the sizes of req are not negative
+func ValidateStorageReport(req *StorageReportRequest) error {
+	if *req.ArtifactBytes < 0 || *req.CacheBytes < 0 {
+		return fmt.Errorf("artifact_bytes and cache_bytes must not be negative")
+	}
+	return nil
+}
+
+// Report records the storage a repository holds at now
+func (s *StorageService) Report(repoID uuid.UUID, req *StorageReportRequest, now time.Time) (*db.StorageReport, error) {
+	report := db.StorageReport{
+		RepositoryID:  repoID,
+		ArtifactBytes: *req.ArtifactBytes,
+		CacheBytes:    *req.CacheBytes,
+		ReportedAt:    now.UTC(),
+	}
+	if err := s.db.Create(&report).Error; err != nil {
+		return nil, fmt.Errorf("failed to save storage report: %w", err)
+	}
+	return &report, nil
+}
+
+// energyKWh returns the energy of storing bytes for one day
+func (s *StorageService) energyKWh(bytes int64) float64 {
+	return float64(bytes) / bytesPerTB * s.kwhPerTBMonth / storageDaysPerMonth
+}
+
+// AccrueAll accrues the storage energy and CO2 of every repository with storage reports for
+// the complete UTC days before now that are not accrued yet, at most MaxStorageCatchUpDays
+// back, and returns the number of days accrued. Each day takes the latest report made before
+// it ended; days before the first report are skipped.
+func (s *StorageService) AccrueAll(ctx context.Context, now time.Time) (int, error) {
+	var repoIDs []uuid.UUID
+	err := s.db.WithContext(ctx).Model(&db.StorageReport{}).
+		Joins("JOIN repositories ON repositories.id = storage_reports.repository_id AND repositories.deleted_at IS NULL").
+		Distinct("storage_reports.repository_id").
+		Pluck("storage_reports.repository_id", &repoIDs).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to list repositories with storage reports: %w", err)
+	}
+
+	accrued := 0
+	for _, repoID := range repoIDs {
+		if err := ctx.Err(); err != nil {
+			return accrued, err
+		}
+		days, err := s.accrue(ctx, repoID, now)
+		if err != nil {
+			return accrued, err
+		}
+		accrued += days
+	}
+	return accrued, nil
+}
+
+// accrue accrues the storage of one repository, as AccrueAll
+func (s *StorageService) accrue(ctx context.Context, repoID uuid.UUID, now time.Time) (int, error) {
+	database := s.db.WithContext(ctx)
+	end := db.RollupDay(now)
+	start := end.AddDate(0, 0, -MaxStorageCatchUpDays)
+
+	var last db.RepositoryStorageDay
+	err := database.Where("repository_id = ?", repoID).Order("day DESC").Limit(1).Find(&last).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last storage day: %w", err)
+	}
+	if !last.Day.IsZero() && !db.RollupDay(last.Day).Before(start) {
+		start = db.RollupDay(last.Day).AddDate(0, 0, 1)
+	}
+
+	var reports []db.StorageReport
+	err = database.Where("repository_id = ? AND reported_at < ?", repoID, end).Order("reported_at").Find(&reports).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to list storage reports: %w", err)
+	}
+
+	var days []db.RepositoryStorageDay
+	next := 0
+	var current *db.StorageReport
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		dayEnd := day.AddDate(0, 0, 1)
+		for next < len(reports) && reports[next].ReportedAt.Before(dayEnd) {
+			current = &reports[next]
+			next++
+		}
+		if current == nil {
+			continue
+		}
+		energyKWh := s.energyKWh(current.ArtifactBytes + current.CacheBytes)
+		days = append(days, db.RepositoryStorageDay{
+			RepositoryID:  repoID,
+			Day:           day,
+			ArtifactBytes: current.ArtifactBytes,
+			CacheBytes:    current.CacheBytes,
+			EnergyKWh:     energyKWh,
+			CO2Kg:         energyKWh * s.gramsPerKWh / 1000,
+		})
+	}
+	if len(days) == 0 {
+		return 0, nil
+	}
+
+	// Days accrued by a concurrent run are kept
+	err = database.Clauses(clause.OnConflict{DoNothing: true}).Create(&days).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to save storage days: %w", err)
+	}
+	return len(days), nil
+}
+
+// StorageFootprint is the storage of a repository and the energy and CO2 it accrued
+type StorageFootprint struct {
+	// Latest is the latest storage report; nil when the repository never reported any
+	Latest *db.StorageReport `json:"latest"`
+	// MonthlyEnergyKWh and MonthlyCO2Kg are the standing cost of keeping the latest storage
+	// for a month
+	MonthlyEnergyKWh float64 `json:"monthly_energy_kwh"`
+	MonthlyCO2Kg     float64 `json:"monthly_co2_kg"`
+
+	// The energy and CO2 accrued between From and To (inclusive) over Days days
+	From      time.Time `json:"from"`
+	To        time.Time `json:"to"`
+	Days      int64     `json:"days"`
+	EnergyKWh float64   `json:"energy_kwh"`
+	CO2Kg     float64   `json:"co2_kg"`
+}
+
+// Footprint returns the latest storage of a repository and the energy and CO2 accrued on
+// the UTC days between from and to
+func (s *StorageService) Footprint(repoID uuid.UUID, from, to time.Time) (*StorageFootprint, error) {
+	footprint := &StorageFootprint{From: from, To: to}
+
+	var latest db.StorageReport
+	err := s.db.Where("repository_id = ?", repoID).Order("reported_at DESC").Limit(1).Find(&latest).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest storage report: %w", err)
+	}
+	if latest.ID != uuid.Nil {
+		footprint.Latest = &latest
+		footprint.MonthlyEnergyKWh = s.energyKWh(latest.ArtifactBytes+latest.CacheBytes) * storageDaysPerMonth
+		footprint.MonthlyCO2Kg = footprint.MonthlyEnergyKWh * s.gramsPerKWh / 1000
+	}
+
+	row := s.db.Model(&db.RepositoryStorageDay{}).
+		Select("COUNT(*), COALESCE(SUM(energy_kwh), 0), COALESCE(SUM(co2_kg), 0)").
+		Where("repository_id = ? AND day >= ? AND day <= ?", repoID, db.RollupDay(from), db.RollupDay(to)).
+		Row()
+	if err := row.Scan(&footprint.Days, &footprint.EnergyKWh, &footprint.CO2Kg); err != nil {
+		return nil, fmt.Errorf("failed to sum storage days: %w", err)
+	}
+	return footprint, nil
+}
@@ -0,0 +1,137 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/junit"
+)
+
+// MaxTestSuiteStats bounds the test suites a breakdown returns
+const MaxTestSuiteStats = 100
+
+// apportionTestSuites returns the test suites of a run with its energy and CO2 apportioned by
+// their duration, or by their tests when none took measurable time, or evenly when none
+// counted any
+func apportionTestSuites(run *db.Run, suites []junit.Suite) []db.RunTestSuite {
+	weight := func(suite junit.Suite) float64 { return suite.DurationS }
+	total := 0.0
+	for _, suite := range suites {
+		total += suite.DurationS
+	}
+	if total == 0 {
+		weight = func(suite junit.Suite) float64 { return float64(suite.Tests) }
+		for _, suite := range suites {
+			total += float64(suite.Tests)
+		}
+	}
+	if total == 0 {
+		weight = func(junit.Suite) float64 { return 1 }
+		total = float64(len(suites))
+	}
+
+	apportioned := make([]db.RunTestSuite, len(suites))
+	for i, suite := range suites {
+		share := weight(suite) / total
+		apportioned[i] = db.RunTestSuite{
+			RunID:     run.ID,
+			Name:      suite.Name,
+			Tests:     suite.Tests,
+			Failures:  suite.Failures,
+			Errors:    suite.Errors,
+			Skipped:   suite.Skipped,
+			DurationS: suite.DurationS,
+			EnergyKWh: run.EnergyKWh * share,
+			CO2Kg:     run.CO2Kg * share,
+		}
+	}
+	return apportioned
+}
+
+// ReplaceTestSuites replaces the test suites of a run with those of its JUnit report,
+// apportioning the energy and CO2 of the run across them, and returns them the most CO2 first
+func (s *RunService) ReplaceTestSuites(run *db.Run, suites []junit.Suite) ([]db.RunTestSuite, error) {
+	apportioned := apportionTestSuites(run, suites)
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("run_id = ?", run.ID).Delete(&db.RunTestSuite{}).Error; err != nil {
+			return err
+		}
+		return tx.CreateInBatches(&apportioned, 100).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save test suites: %w", err)
+	}
+	return s.ListTestSuites(run.ID)
+}
+
+// ListTestSuites returns the test suites of a run, the most CO2 first
+func (s *RunService) ListTestSuites(runID uuid.UUID) ([]db.RunTestSuite, error) {
+	suites := []db.RunTestSuite{}
+	err := s.db.Where("run_id = ?", runID).Order("co2_kg DESC, name").Find(&suites).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list test suites: %w", err)
+	}
+	return suites, nil
+}
+
+// TestSuiteStats aggregates the test suites of the runs with the same name
+type TestSuiteStats struct {
+	Name      string  `json:"name"`
+	RunCount  int64   `json:"run_count"`
+	Tests     int64   `json:"tests"`
+	Failures  int64   `json:"failures"`
+	Errors    int64   `json:"errors"`
+	DurationS float64 `json:"duration_s"`
+	EnergyKWh float64 `json:"energy_kwh"`
+	CO2Kg     float64 `json:"co2_kg"`
+	// AvgCO2Kg is the CO2 of the suite per run
+	AvgCO2Kg float64 `json:"avg_co2_kg"`
+}
+
+// TestSuiteStats aggregates the test suites of the runs in scope created between from and to
+// (inclusive) by name and returns the limit suites emitting the most CO2
+func (s *StatsService) TestSuiteStats(scope RunScope, from, to time.Time, limit int) ([]TestSuiteStats, error) {
+	rows, err := s.db.Model(&db.Run{}).
+		Select(`
+			run_test_suites.name,
+			COUNT(runs.id) as run_count,
+			SUM(run_test_suites.tests) as tests,
+			SUM(run_test_suites.failures) as failures,
+			SUM(run_test_suites.errors) as errors,
+			SUM(run_test_suites.duration_s) as duration_s,
+			SUM(run_test_suites.energy_kwh) as energy_kwh,
+			SUM(run_test_suites.co2_kg) as co2_kg
+		`).
+		Joins("JOIN run_test_suites ON run_test_suites.run_id = runs.id").
+		Scopes(scope).
+		Where("runs.created_at >= ? AND runs.created_at <= ?", from, to).
+		Group("run_test_suites.name").
+		Order("co2_kg DESC, run_test_suites.name").
+		Limit(limit).
+		Rows()
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute test suite stats query: %w", err)
+	}
+	defer rows.Close()
+
+	stats := []TestSuiteStats{}
+	for rows.Next() {
+		var stat TestSuiteStats
+		if err := rows.Scan(&stat.Name, &stat.RunCount, &stat.Tests, &stat.Failures, &stat.Errors,
+			&stat.DurationS, &stat.EnergyKWh, &stat.CO2Kg); err != nil {
+			return nil, fmt.Errorf("failed to scan test suite stats: %w", err)
+		}
+		if stat.RunCount > 0 {
+			stat.AvgCO2Kg = stat.CO2Kg / float64(stat.RunCount)
+		}
+		stats = append(stats, stat)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read test suite stats: %w", err)
+	}
+	return stats, nil
+}
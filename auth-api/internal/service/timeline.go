@@ -0,0 +1,81 @@
+package service
+
+import (
+	"math"
+	"sort"
+
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// TimelineStep is a step of a run placed on its timeline
+type TimelineStep struct {
+	Index int    `json:"index"`
+	Name  string `json:"name" example:"npm ci"`
+	Phase string `json:"phase" example:"deps"`
+	// StartOffsetS and EndOffsetS are the seconds after the start of the run the step started
+	// and ended
+	StartOffsetS float64 `json:"start_offset_s"`
+	EndOffsetS   float64 `json:"end_offset_s"`
+	DurationS    float64 `json:"duration_s"`
+	EnergyKWh    float64 `json:"energy_kwh"`
+	CO2Kg        float64 `json:"co2_kg"`
+	// PowerW is the average power of the step, zero for steps without a duration
+	PowerW float64 `json:"power_w"`
+}
+
+// RunTimeline is the steps of a run in the order they ran, shaped for a Gantt chart
+type RunTimeline struct {
+	RunID uuid.UUID `json:"run_id"`
+	// DurationS spans the run and all of its steps
+	DurationS float64        `json:"duration_s"`
+	EnergyKWh float64        `json:"energy_kwh"`
+	CO2Kg     float64        `json:"co2_kg"`
+	Steps     []TimelineStep `json:"steps"`
+}
+
+// BuildRunTimeline places the steps of a run on its timeline, or returns nil for runs without
+// steps. Steps start at their start_offset_s, else when the step before them ended, and are
+// ordered by start, keeping the submitted order of steps starting together.
+func BuildRunTimeline(run *db.Run) *RunTimeline {
+	steps := runSteps(run)
+	if len(steps) == 0 {
+		return nil
+	}
+
+	timeline := &RunTimeline{
+		RunID:     run.ID,
+		DurationS: run.DurationS,
+		EnergyKWh: run.EnergyKWh,
+		CO2Kg:     run.CO2Kg,
+		Steps:     make([]TimelineStep, len(steps)),
+	}
+	previousEnd := 0.0
+	for i, step := range steps {
+		start := previousEnd
+		if step.startOffsetS != nil {
+			start = *step.startOffsetS
+		}
+		entry := TimelineStep{
+			Index:        i,
+			Name:         step.name,
+			Phase:        step.phase,
+			StartOffsetS: start,
+			EndOffsetS:   start + step.durationS,
+			DurationS:    step.durationS,
+			EnergyKWh:    step.energyKWh,
+			CO2Kg:        step.co2Kg,
+		}
+		if step.durationS > 0 {
+			entry.PowerW = step.energyKWh * 3.6e6 / step.durationS
+		}
+		timeline.Steps[i] = entry
+		timeline.DurationS = math.Max(timeline.DurationS, entry.EndOffsetS)
+		previousEnd = entry.EndOffsetS
+	}
+	sort.SliceStable(timeline.Steps, func(i, j int) bool {
+		return timeline.Steps[i].StartOffsetS < timeline.Steps[j].StartOffsetS
+	})
+	return timeline
+}
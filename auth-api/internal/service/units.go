@@ -0,0 +1,222 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// measurementUnit is a unit a quantity may be submitted in, with its size in the canonical
+// unit of the quantity
+type measurementUnit struct {
+	name  string
+	scale float64
+}
+
+// energyUnits are the units energy may be submitted in; runs store kWh
+var energyUnits = []measurementUnit{{"kWh", 1}, {"Wh", 1e-3}, {"J", 1 / 3.6e6}}
+
+// emissionUnits are the units CO2 may be submitted in; runs store kg
+var emissionUnits = []measurementUnit{{"kg", 1}, {"g", 1e-3}}
+
+// suffixedQuantity is a quantity submitted with its unit in its key, such as energy_wh
+type suffixedQuantity struct {
+	key   string
+	value *float64
+	scale float64
+}
+
+// NormalizeRunUnits converts the energy and CO2 of req submitted in other units to kWh and
+// kg, leaving only energy_kwh and co2_kg set. Each quantity may be given once: energy as
+// energy_kwh, energy with energy_unit, energy_wh or energy_j, and CO2 as co2_kg, co2 with
+// co2_unit or co2_g. A zero energy_kwh or co2_kg counts as omitted. Units are matched
+// regardless of case. Submissions giving a quantity more than once, a unit without its
+// value or an unknown unit are rejected, so mismatched units never reach the aggregates.
+func NormalizeRunUnits(req *RunCreateRequest) error {
+	energy, err := normalizeQuantity("energy", "energy_kwh", req.EnergyKWh, "energy", req.Energy,
+		"energy_unit", req.EnergyUnit, energyUnits,
+		suffixedQuantity{"energy_wh", req.EnergyWh, 1e-3},
+		suffixedQuantity{"energy_j", req.EnergyJ, 1 / 3.6e6})
+	if err != nil {
+		return err
+	}
+	co2, err := normalizeQuantity("CO2", "co2_kg", req.CO2Kg, "co2", req.CO2,
+		"co2_unit", req.CO2Unit, emissionUnits,
+		suffixedQuantity{"co2_g", req.CO2G, 1e-3})
+	if err != nil {
+		return err
+	}
+
+	req.EnergyKWh, req.CO2Kg = energy, co2
+	req.Energy, req.EnergyUnit, req.EnergyWh, req.EnergyJ = nil, "", nil, nil
+	req.CO2, req.CO2Unit, req.CO2G = nil, "", nil
+	return nil
+}
+
+// normalizeQuantity returns the value of a quantity in its canonical unit from the one way
+// it was given
+func normalizeQuantity(quantity, canonicalKey string, canonical float64, valueKey string, value *float64,
+	unitKey, unit string, units []measurementUnit, suffixed ...suffixedQuantity) (float64, error) {
+	var given []string
+	normalized := canonical
+	if canonical != 0 {
+		given = append(given, canonicalKey)
+	}
+
+	if value != nil || unit != "" {
+		if value == nil {
+			return 0, fmt.Errorf("%s requires %s", unitKey, valueKey)
+		}
+		if unit == "" {
+			return 0, fmt.Errorf("%s requires %s", valueKey, unitKey)
+		}
+		found, ok := lookupUnit(units, unit)
+		if !ok {
+			return 0, fmt.Errorf("%s must be one of %s", unitKey, unitNames(units))
+		}
+		normalized = *value * found.scale
+		given = append(given, valueKey)
+	}
+
+	for _, other := range suffixed {
+		if other.value != nil {
+			normalized = *other.value * other.scale
+			given = append(given, other.key)
+		}
+	}
+
+	if len(given) > 1 {
+		return 0, fmt.Errorf("%s is ambiguous: give only one of %s", quantity, strings.Join(given, ", "))
+	}
+	return normalized, nil
+}
+
+// lookupUnit finds the unit named name, regardless of case
+func lookupUnit(units []measurementUnit, name string) (measurementUnit, bool) {
+	for _, unit := range units {
+		if strings.EqualFold(unit.name, name) {
+			return unit, true
+		}
+	}
+	return measurementUnit{}, false
+}
+
+// unitNames lists the names of units for messages
+func unitNames(units []measurementUnit) string {
+	names := make([]string, len(units))
+	for i, unit := range units {
+		names[i] = unit.name
+	}
+	return strings.Join(names, ", ")
+}
+
+// displayEnergyUnits are the units responses can report energy in
+var displayEnergyUnits = []measurementUnit{{"kWh", 1}, {"Wh", 1e-3}}
+
+// DisplayUnits are the units API responses report CO2 and energy in
+type DisplayUnits struct {
+	CO2    string `json:"co2" example:"g"`
+	Energy string `json:"energy" example:"Wh"`
+}
+
+// CanonicalDisplayUnits are the units runs are stored in, which responses report by default
+var CanonicalDisplayUnits = DisplayUnits{CO2: "kg", Energy: "kWh"}
+
+// ParseDisplayUnits parses a comma-separated list of units to report, such as g,Wh. Each
+// unit selects the unit of its quantity, regardless of case; quantities not listed keep
+// their canonical unit.
+func ParseDisplayUnits(raw string) (DisplayUnits, error) {
+	units := CanonicalDisplayUnits
+	var co2Set, energySet bool
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if unit, ok := lookupUnit(emissionUnits, name); ok {
+			if co2Set {
+				return units, fmt.Errorf("more than one CO2 unit")
+			}
+			units.CO2, co2Set = unit.name, true
+		} else if unit, ok := lookupUnit(displayEnergyUnits, name); ok {
+			if energySet {
+				return units, fmt.Errorf("more than one energy unit")
+			}
+			units.Energy, energySet = unit.name, true
+		} else {
+			return units, fmt.Errorf("unknown unit %q; units are %s and %s", name, unitNames(emissionUnits), unitNames(displayEnergyUnits))
+		}
+	}
+	return units, nil
+}
+
+// ValidateDisplayUnits checks the units of u, spelling them as listed and defaulting the
+// omitted ones to their canonical unit
+func ValidateDisplayUnits(u *DisplayUnits) error {
+	if u.CO2 == "" {
+		u.CO2 = CanonicalDisplayUnits.CO2
+	}
+	if u.Energy == "" {
+		u.Energy = CanonicalDisplayUnits.Energy
+	}
+	co2, ok := lookupUnit(emissionUnits, u.CO2)
+	if !ok {
+		return fmt.Errorf("co2 must be one of %s", unitNames(emissionUnits))
+	}
+	energy, ok := lookupUnit(displayEnergyUnits, u.Energy)
+	if !ok {
+		return fmt.Errorf("energy must be one of %s", unitNames(displayEnergyUnits))
+	}
+	u.CO2, u.Energy = co2.name, energy.name
+	return nil
+}
+
+// String returns the units as accepted by ParseDisplayUnits
+func (u DisplayUnits) String() string {
+	return u.CO2 + "," + u.Energy
+}
+
+// CO2Factor is the factor converting kg to the CO2 unit
+func (u DisplayUnits) CO2Factor() float64 {
+	unit, _ := lookupUnit(emissionUnits, u.CO2)
+	return 1 / unit.scale
+}
+
+// EnergyFactor is the factor converting kWh to the energy unit
+func (u DisplayUnits) EnergyFactor() float64 {
+	unit, _ := lookupUnit(displayEnergyUnits, u.Energy)
+	return 1 / unit.scale
+}
+
+// GetDisplayUnits returns the units responses report to user in
+func GetDisplayUnits(user *db.User) DisplayUnits {
+	if user.DisplayUnits == nil {
+		return CanonicalDisplayUnits
+	}
+	units, err := ParseDisplayUnits(*user.DisplayUnits)
+	if err != nil {
+		return CanonicalDisplayUnits
+	}
+	return units
+}
+
+// UpdateDisplayUnits stores the validated units responses report to a user in; the
+// canonical units clear the preference
+func (s *UserService) UpdateDisplayUnits(userID uuid.UUID, units DisplayUnits) error {
+	var value *string
+	if units != CanonicalDisplayUnits {
+		encoded := units.String()
+		value = &encoded
+	}
+	result := s.db.Model(&db.User{}).Where("id = ?", userID).Update("display_units", value)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update display units: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("user not found")
+	}
+	return nil
+}
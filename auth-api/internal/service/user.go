@@ -2,6 +2,8 @@ package service
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 
@@ -26,11 +28,15 @@ func NewUserService(database *gorm.DB) *UserService {
 func (s *UserService) CreateOrUpdateUserFromGitHub(githubUser *auth.GitHubUser) (*db.User, error) {
 	var user db.User
 
-	// Try to find existing user by GitHub ID
-	err := s.db.Where("github_id = ?", githubUser.ID).First(&user).Error
+	// Try to find existing user by GitHub ID, including deleted accounts that can still be
+	// restored; they keep their GitHub ID until they are purged
+	err := s.db.Unscoped().Where("github_id = ?", githubUser.ID).First(&user).Error
 	if err != nil && err != gorm.ErrRecordNotFound {
 		return nil, fmt.Errorf("failed to query user: %w", err)
 	}
+	if err == nil && user.DeletedAt.Valid {
+		return nil, fmt.Errorf("account deleted")
+	}
 
 	// If user doesn't exist, create new one
 	if err == gorm.ErrRecordNotFound {
@@ -60,6 +66,55 @@ func (s *UserService) CreateOrUpdateUserFromGitHub(githubUser *auth.GitHubUser)
 	return &user, nil
 }
 
+// SyncOrganizations replaces the user's organization memberships and their roles with the
+// given GitHub organizations
+func (s *UserService) SyncOrganizations(userID uuid.UUID, githubOrgs []auth.GitHubOrganization) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&db.OrganizationMember{}).Error; err != nil {
+			return fmt.Errorf("failed to clear organization memberships: %w", err)
+		}
+
+		for _, githubOrg := range githubOrgs {
+			var org db.Organization
+			err := tx.Where("github_id = ?", githubOrg.ID).First(&org).Error
+			if err != nil && err != gorm.ErrRecordNotFound {
+				return fmt.Errorf("failed to query organization: %w", err)
+			}
+
+			if err == gorm.ErrRecordNotFound {
+				org = db.Organization{
+					GitHubID:    githubOrg.ID,
+					GitHubLogin: githubOrg.Login,
+				}
+				if err := tx.Create(&org).Error; err != nil {
+					return fmt.Errorf("failed to create organization: %w", err)
+				}
+			} else if org.GitHubLogin != githubOrg.Login {
+				// Organization was renamed on GitHub
+				org.GitHubLogin = githubOrg.Login
+				if err := tx.Save(&org).Error; err != nil {
+					return fmt.Errorf("failed to update organization: %w", err)
+				}
+			}
+
+			role := db.OrganizationRoleMember
+			if githubOrg.Role == db.OrganizationRoleAdmin {
+				role = db.OrganizationRoleAdmin
+			}
+			member := db.OrganizationMember{
+				OrganizationID: org.ID,
+				UserID:         userID,
+				Role:           role,
+			}
+			if err := tx.Create(&member).Error; err != nil {
+				return fmt.Errorf("failed to create organization membership: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
 // GetUserByID retrieves a user by their UUID
 func (s *UserService) GetUserByID(userID uuid.UUID) (*db.User, error) {
 	var user db.User
@@ -102,43 +157,224 @@ func (s *UserService) GetUserByGitHubUsername(username string) (*db.User, error)
 	return &user, nil
 }
 
-// ListUsers retrieves a paginated list of users
-func (s *UserService) ListUsers(limit, offset int) ([]db.User, int64, error) {
-	var users []db.User
-	var total int64
-
-	// Get total count
-	if err := s.db.Model(&db.User{}).Count(&total).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to count users: %w", err)
-	}
-
-	// Get paginated results
-	if err := s.db.Limit(limit).Offset(offset).Order("created_at DESC").Find(&users).Error; err != nil {
-		return nil, 0, fmt.Errorf("failed to list users: %w", err)
+// ListRepositoryIDs returns the IDs of the repositories a user owns or submitted runs to
+func (s *UserService) ListRepositoryIDs(userID uuid.UUID) ([]uuid.UUID, error) {
+	var repoIDs []uuid.UUID
+	err := s.db.Raw(`SELECT id FROM repositories WHERE owner_id = ?
+		UNION SELECT DISTINCT repository_id FROM runs WHERE user_id = ?`, userID, userID).
+		Scan(&repoIDs).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list user repositories: %w", err)
 	}
-
-	return users, total, nil
+	return repoIDs, nil
 }
 
-// DeleteUser deletes a user and all related data
+// userRunsCondition matches the runs a user submitted or that belong to their repositories;
+// it expects the user ID twice
+const userRunsCondition = "(user_id = ? OR repository_id IN (SELECT id FROM repositories WHERE owner_id = ?))"
+
+// DeleteUser soft-deletes a user with their repositories, the runs they submitted and the
+// runs of their repositories, and removes their GitHub and API tokens. Everything shares the deletion time of the user so
+// RestoreUser can tell it apart from data that was deleted on its own.
 func (s *UserService) DeleteUser(userID uuid.UUID) error {
+	now := time.Now()
+
 	// Using transaction to ensure data consistency
 	return s.db.Transaction(func(tx *gorm.DB) error {
-		// Delete user's runs first (due to foreign key constraints)
-		if err := tx.Where("user_id = ?", userID).Delete(&db.Run{}).Error; err != nil {
-			return fmt.Errorf("failed to delete user runs: %w", err)
+		// Remember the repositories the user ran in or owns so their rollups can be rebuilt
+		var repoIDs []uuid.UUID
+		if err := tx.Model(&db.Run{}).Distinct("repository_id").Where(userRunsCondition, userID, userID).Pluck("repository_id", &repoIDs).Error; err != nil {
+			return fmt.Errorf("failed to list user run repositories: %w", err)
 		}
 
-		// Delete user's repositories
-		if err := tx.Where("owner_id = ?", userID).Delete(&db.Repository{}).Error; err != nil {
+		if err := tx.Model(&db.Run{}).Where(userRunsCondition, userID, userID).Update("deleted_at", now).Error; err != nil {
+			return fmt.Errorf("failed to delete user runs: %w", err)
+		}
+		if err := tx.Model(&db.Repository{}).Where("owner_id = ?", userID).Update("deleted_at", now).Error; err != nil {
 			return fmt.Errorf("failed to delete user repositories: %w", err)
 		}
-
-		// Delete user
-		if err := tx.Where("id = ?", userID).Delete(&db.User{}).Error; err != nil {
+		if err := tx.Model(&db.User{}).Where("id = ?", userID).Update("deleted_at", now).Error; err != nil {
 			return fmt.Errorf("failed to delete user: %w", err)
 		}
+		// Tokens are not kept for deleted accounts; restored users sign in again
+		if err := tx.Where("user_id = ?", userID).Delete(&db.GitHubCredential{}).Error; err != nil {
+			return fmt.Errorf("failed to delete GitHub credentials: %w", err)
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&db.APIToken{}).Error; err != nil {
+			return fmt.Errorf("failed to delete API tokens: %w", err)
+		}
+
+		// Rebuild the rollups of the repositories the user ran in; those of deleted repositories are cleared
+		for _, repoID := range repoIDs {
+			if err := db.RebuildRollups(tx, repoID); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// RestoreUser restores a user deleted after deletedSince together with the repositories
+// and runs deleted along with them, and rebuilds the rollups of the affected repositories
+func (s *UserService) RestoreUser(userID uuid.UUID, deletedSince time.Time) (*db.User, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var user db.User
+		if err := tx.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", userID).First(&user).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return fmt.Errorf("deleted user not found")
+			}
+			return fmt.Errorf("failed to get deleted user: %w", err)
+		}
+		if user.DeletedAt.Time.Before(deletedSince) {
+			return fmt.Errorf("restore window has expired")
+		}
+		deletedAt := user.DeletedAt.Time
+
+		var repoIDs []uuid.UUID
+		if err := tx.Unscoped().Model(&db.Run{}).Distinct("repository_id").
+			Where(userRunsCondition+" AND deleted_at = ?", userID, userID, deletedAt).
+			Pluck("repository_id", &repoIDs).Error; err != nil {
+			return fmt.Errorf("failed to list user run repositories: %w", err)
+		}
 
+		if err := tx.Unscoped().Model(&db.Repository{}).Where("owner_id = ? AND deleted_at = ?", userID, deletedAt).Update("deleted_at", nil).Error; err != nil {
+			return fmt.Errorf("failed to restore user repositories: %w", err)
+		}
+		if err := tx.Unscoped().Model(&db.Run{}).Where(userRunsCondition+" AND deleted_at = ?", userID, userID, deletedAt).Update("deleted_at", nil).Error; err != nil {
+			return fmt.Errorf("failed to restore user runs: %w", err)
+		}
+		if err := tx.Unscoped().Model(&user).Update("deleted_at", nil).Error; err != nil {
+			return fmt.Errorf("failed to restore user: %w", err)
+		}
+
+		for _, repoID := range repoIDs {
+			if err := db.RebuildRollups(tx, repoID); err != nil {
+				return err
+			}
+		}
 		return nil
 	})
-}
\ No newline at end of file
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetUserByID(userID)
+}
+// UserFilter narrows the users returned by ListUsers; empty fields do not filter
+type UserFilter struct {
+	// Query matches the GitHub username, name or email, case-insensitively
+	Query     string
+	Role      string
+	Suspended *bool
+}
+
+// UserSortFields are the fields the user directory can be sorted by
+var UserSortFields = []string{"created_at", "github_username", "github_email", "run_count"}
+
+// IsValidUserSort reports whether sortBy is a field the user directory can be sorted by
+func IsValidUserSort(sortBy string) bool {
+	return contains(UserSortFields, sortBy)
+}
+
+// UserDirectoryEntry is a user as listed to administrators, with the number of runs they
+// submitted and whether they are suspended
+type UserDirectoryEntry struct {
+	db.User
+	RunCount  int64 `json:"run_count"`
+	Suspended bool  `json:"suspended"`
+}
+
+// ListUsers retrieves a paginated list of users matching the filter, sorted by sortBy in
+// order (asc or desc) and newest first for other fields
+func (s *UserService) ListUsers(filter UserFilter, sortBy, order string, limit, offset int) ([]UserDirectoryEntry, int64, error) {
+	query := s.db.Model(&db.User{})
+	if filter.Query != "" {
+		pattern := "%" + db.EscapeLike(filter.Query) + "%"
+		ilike := db.DialectOf(s.db).ILike
+		query = query.Where("("+ilike("github_username")+" OR "+ilike("name")+" OR "+ilike("github_email")+")",
+			pattern, pattern, pattern)
+	}
+	if filter.Role != "" {
+		query = query.Where("role = ?", filter.Role)
+	}
+	if filter.Suspended != nil {
+		if *filter.Suspended {
+			query = query.Where("suspended_at IS NOT NULL")
+		} else {
+			query = query.Where("suspended_at IS NULL")
+		}
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	if !IsValidUserSort(sortBy) {
+		sortBy = "created_at"
+	}
+	if order != "asc" {
+		order = "desc"
+	}
+	directory := query.Select(`users.*,
+		(SELECT COUNT(*) FROM runs WHERE runs.user_id = users.id AND runs.deleted_at IS NULL) AS run_count`)
+
+	entries := []UserDirectoryEntry{}
+	err := s.db.Table("(?) AS directory", directory).
+		Order("directory." + sortBy + " " + strings.ToUpper(order) + ", directory.id " + strings.ToUpper(order)).
+		Limit(limit).
+		Offset(offset).
+		Scan(&entries).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list users: %w", err)
+	}
+	for i := range entries {
+		entries[i].Suspended = entries[i].SuspendedAt != nil
+	}
+
+	return entries, total, nil
+}
+
+// AccountUpdate represents the administrator-controlled state of an account; nil fields are left unchanged
+type AccountUpdate struct {
+	Role      *string
+	Suspended *bool
+	// Plan sets the plan of rate limits and quotas; an empty plan reverts to the default plan
+	Plan *string
+}
+
+// UpdateAccount changes the role or plan of a user or suspends and reinstates them at now
+func (s *UserService) UpdateAccount(userID uuid.UUID, update AccountUpdate, now time.Time) (*db.User, error) {
+	updates := map[string]interface{}{}
+	if update.Role != nil {
+		updates["role"] = *update.Role
+	}
+	if update.Plan != nil {
+		if *update.Plan == "" {
+			updates["plan"] = nil
+		} else {
+			updates["plan"] = *update.Plan
+		}
+	}
+	if update.Suspended != nil {
+		if *update.Suspended {
+			// Keep the original suspension time when suspending again
+			updates["suspended_at"] = gorm.Expr("COALESCE(suspended_at, ?)", now.UTC())
+		} else {
+			updates["suspended_at"] = nil
+		}
+	}
+
+	if len(updates) > 0 {
+		result := s.db.Model(&db.User{}).Where("id = ?", userID).Updates(updates)
+		if result.Error != nil {
+			return nil, fmt.Errorf("failed to update user: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil, fmt.Errorf("user not found")
+		}
+	}
+
+	return s.GetUserByID(userID)
+}
@@ -19,7 +19,13 @@ func setupTestDB(t *testing.T) (*gorm.DB, func()) {
 	require.NoError(t, err)
 
 	// Auto-migrate tables
-	err = database.AutoMigrate(&db.User{}, &db.Repository{}, &db.Run{})
+	err = database.AutoMigrate(&db.User{}, &db.Repository{}, &db.Run{},
+		&db.Organization{}, &db.OrganizationMember{}, &db.RepositoryCollaborator{},
+		&db.RepositoryBaseline{}, &db.RepositoryBudget{},
+		&db.Webhook{}, &db.WebhookDelivery{},
+		&db.OrganizationIntegration{}, &db.RepositoryNotificationRoute{},
+		&db.AlertRule{}, &db.RepositoryDailyRollup{}, &db.Job{}, &db.JobRun{},
+		&db.RetentionPolicy{}, &db.RetentionReport{}, &db.AuditEvent{}, &db.GitHubCredential{}, &db.APIToken{})
 	require.NoError(t, err)
 
 	cleanup := func() {
@@ -181,7 +187,7 @@ func TestUserService_ListUsers(t *testing.T) {
 	}
 
 	t.Run("list all users", func(t *testing.T) {
-		users, total, err := service.ListUsers(10, 0)
+		users, total, err := service.ListUsers(UserFilter{}, "", "", 10, 0)
 		require.NoError(t, err)
 		
 		assert.Equal(t, int64(5), total)
@@ -189,14 +195,14 @@ func TestUserService_ListUsers(t *testing.T) {
 	})
 
 	t.Run("paginated list", func(t *testing.T) {
-		users, total, err := service.ListUsers(2, 0)
+		users, total, err := service.ListUsers(UserFilter{}, "", "", 2, 0)
 		require.NoError(t, err)
 		
 		assert.Equal(t, int64(5), total)
 		assert.Len(t, users, 2)
 		
 		// Get next page
-		users2, total2, err := service.ListUsers(2, 2)
+		users2, total2, err := service.ListUsers(UserFilter{}, "", "", 2, 2)
 		require.NoError(t, err)
 		
 		assert.Equal(t, int64(5), total2)
@@ -205,6 +211,35 @@ func TestUserService_ListUsers(t *testing.T) {
 		// Ensure different users
 		assert.NotEqual(t, users[0].ID, users2[0].ID)
 	})
+
+	t.Run("sorted by run count", func(t *testing.T) {
+		var busy db.User
+		require.NoError(t, database.Where("github_username = ?", "testuser3").First(&busy).Error)
+		repo := &db.Repository{OwnerID: busy.ID, GitHubRepoID: 1, Name: "repo", FullName: "testuser3/repo", HTMLURL: "https://github.com/testuser3/repo"}
+		require.NoError(t, database.Create(repo).Error)
+		for i := 0; i < 3; i++ {
+			require.NoError(t, database.Create(&db.Run{UserID: busy.ID, RepositoryID: repo.ID}).Error)
+		}
+		deleted := &db.Run{UserID: busy.ID, RepositoryID: repo.ID}
+		require.NoError(t, database.Create(deleted).Error)
+		require.NoError(t, database.Delete(deleted).Error)
+
+		users, _, err := service.ListUsers(UserFilter{}, "run_count", "desc", 10, 0)
+		require.NoError(t, err)
+		require.Len(t, users, 5)
+		assert.Equal(t, busy.ID, users[0].ID)
+		assert.Equal(t, int64(3), users[0].RunCount)
+		assert.Equal(t, int64(0), users[1].RunCount)
+		assert.False(t, users[0].Suspended)
+	})
+
+	t.Run("sorted by username", func(t *testing.T) {
+		users, _, err := service.ListUsers(UserFilter{Query: "testuser"}, "github_username", "asc", 2, 0)
+		require.NoError(t, err)
+		require.Len(t, users, 2)
+		assert.Equal(t, "testuser0", users[0].GitHubUsername)
+		assert.Equal(t, "testuser1", users[1].GitHubUsername)
+	})
 }
 
 func TestUserService_DeleteUser(t *testing.T) {
@@ -265,6 +300,39 @@ func TestUserService_DeleteUser(t *testing.T) {
 }
 
 // Helper function to create string pointer
+func TestUserService_SyncOrganizations(t *testing.T) {
+	database, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	service := NewUserService(database)
+	orgService := NewOrganizationService(database)
+	user := &db.User{GitHubID: 12345, GitHubUsername: "testuser"}
+	require.NoError(t, database.Create(user).Error)
+
+	sync := func(orgs ...auth.GitHubOrganization) map[string]bool {
+		require.NoError(t, service.SyncOrganizations(user.ID, orgs))
+		admins := map[string]bool{}
+		for _, org := range orgs {
+			stored, err := orgService.GetOrganizationByLogin(org.Login)
+			require.NoError(t, err)
+			admin, err := orgService.IsAdmin(stored.ID, user.ID)
+			require.NoError(t, err)
+			admins[org.Login] = admin
+		}
+		return admins
+	}
+
+	admins := sync(
+		auth.GitHubOrganization{ID: 1, Login: "greenorg", Role: "admin"},
+		auth.GitHubOrganization{ID: 2, Login: "otherorg", Role: "member"},
+	)
+	assert.Equal(t, map[string]bool{"greenorg": true, "otherorg": false}, admins)
+
+	// A demotion on GitHub takes effect at the next sign-in
+	admins = sync(auth.GitHubOrganization{ID: 1, Login: "greenorg", Role: "member"})
+	assert.Equal(t, map[string]bool{"greenorg": false}, admins)
+}
+
 func stringPtr(s string) *string {
 	return &s
 }
\ No newline at end of file
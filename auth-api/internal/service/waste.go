@@ -0,0 +1,211 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WasteTally sums the runs wasted for one reason
+type WasteTally struct {
+	RunCount int64   `json:"run_count"`
+	CO2Kg    float64 `json:"co2_kg"`
+}
+
+func (t *WasteTally) add(co2 float64) {
+	t.RunCount++
+	t.CO2Kg += co2
+}
+
+// WorkflowWaste is the wasted carbon of one workflow. WastedPercent is nil when its runs
+// emitted nothing.
+type WorkflowWaste struct {
+	WorkflowName  *string    `json:"workflow_name"`
+	RunCount      int64      `json:"run_count"`
+	TotalCO2Kg    float64    `json:"total_co2_kg"`
+	Failed        WasteTally `json:"failed"`
+	Retried       WasteTally `json:"retried"`
+	WastedCO2Kg   float64    `json:"wasted_co2_kg"`
+	WastedPercent *float64   `json:"wasted_percent"`
+}
+
+// WastePoint is the wasted carbon of one bucket of the trend
+type WastePoint struct {
+	BucketStart   time.Time `json:"bucket_start"`
+	RunCount      int64     `json:"run_count"`
+	TotalCO2Kg    float64   `json:"total_co2_kg"`
+	WastedCO2Kg   float64   `json:"wasted_co2_kg"`
+	WastedPercent *float64  `json:"wasted_percent"`
+}
+
+// WastedCarbon is the carbon of runs that produced no usable result: failed runs and attempts
+// superseded by a retry. Workflows with waste are ordered by wasted CO2 descending.
+type WastedCarbon struct {
+	From          time.Time       `json:"from"`
+	To            time.Time       `json:"to"`
+	Interval      string          `json:"interval"`
+	RunCount      int64           `json:"run_count"`
+	TotalCO2Kg    float64         `json:"total_co2_kg"`
+	Failed        WasteTally      `json:"failed"`
+	Retried       WasteTally      `json:"retried"`
+	WastedCO2Kg   float64         `json:"wasted_co2_kg"`
+	WastedPercent *float64        `json:"wasted_percent"`
+	Workflows     []WorkflowWaste `json:"workflows"`
+	Trend         []WastePoint    `json:"trend"`
+}
+
+// wasteRun is what the analysis keeps of a run until retries are known
+type wasteRun struct {
+	workflow  *string
+	createdAt time.Time
+	co2       float64
+	failed    bool
+	// attempt identifies the CI run the run was an attempt of, nil when it is not known
+	attempt *runAttempt
+}
+
+// runAttempt is an attempt of a CI run of a repository
+type runAttempt struct {
+	key    string
+	number int
+}
+
+// WastedCarbon classifies the runs in scope created between from and to as failed, superseded
+// by a retry or usable, and sums the wasted CO2 in total, per workflow and per bucket of
+// interval. Runs are failed when their status or conclusion metadata is one of failure,
+// cancelled or timed_out, and superseded when a later github_run_attempt of the same
+// github_run_id was submitted; failed runs that were retried count as failed.
+func (s *StatsService) WastedCarbon(scope RunScope, from, to time.Time, interval string) (*WastedCarbon, error) {
+	if !IsValidInterval(interval) {
+		return nil, fmt.Errorf("unsupported interval: %s", interval)
+	}
+	if CountBuckets(from, to, interval) > MaxTimeSeriesBuckets {
+		return nil, fmt.Errorf("time range spans more than %d buckets", MaxTimeSeriesBuckets)
+	}
+
+	var runs []wasteRun
+	lastAttempts := map[string]int{}
+	err := s.EachRun(scope, from, to, func(run *RunRow) error {
+		wasted := wasteRun{
+			workflow:  run.WorkflowName,
+			createdAt: run.CreatedAt,
+			co2:       run.CO2Kg,
+			failed:    runFailed(run.RunMetadata),
+			attempt:   attemptOf(run.RepositoryID, run.RunMetadata),
+		}
+		if wasted.attempt != nil && wasted.attempt.number > lastAttempts[wasted.attempt.key] {
+			lastAttempts[wasted.attempt.key] = wasted.attempt.number
+		}
+		runs = append(runs, wasted)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &WastedCarbon{From: from, To: to, Interval: interval, Workflows: []WorkflowWaste{}, Trend: []WastePoint{}}
+	workflows := map[string]*WorkflowWaste{}
+	buckets := map[int64]*WastePoint{}
+	end := TruncateToInterval(to, interval)
+	for bucket := TruncateToInterval(from, interval); !bucket.After(end); bucket = nextBucket(bucket, interval) {
+		result.Trend = append(result.Trend, WastePoint{BucketStart: bucket})
+	}
+	for i := range result.Trend {
+		buckets[result.Trend[i].BucketStart.Unix()] = &result.Trend[i]
+	}
+
+	for _, run := range runs {
+		key := ""
+		if run.workflow != nil {
+			key = *run.workflow
+		}
+		workflow, ok := workflows[key]
+		if !ok {
+			workflow = &WorkflowWaste{WorkflowName: run.workflow}
+			workflows[key] = workflow
+		}
+		point := buckets[TruncateToInterval(run.createdAt, interval).Unix()]
+
+		result.RunCount++
+		result.TotalCO2Kg += run.co2
+		workflow.RunCount++
+		workflow.TotalCO2Kg += run.co2
+		if point != nil {
+			point.RunCount++
+			point.TotalCO2Kg += run.co2
+		}
+
+		switch {
+		case run.failed:
+			result.Failed.add(run.co2)
+			workflow.Failed.add(run.co2)
+		case run.attempt != nil && run.attempt.number < lastAttempts[run.attempt.key]:
+			result.Retried.add(run.co2)
+			workflow.Retried.add(run.co2)
+		default:
+			continue
+		}
+		result.WastedCO2Kg += run.co2
+		workflow.WastedCO2Kg += run.co2
+		if point != nil {
+			point.WastedCO2Kg += run.co2
+		}
+	}
+
+	result.WastedPercent = percentOf(result.WastedCO2Kg, result.TotalCO2Kg)
+	for i := range result.Trend {
+		result.Trend[i].WastedPercent = percentOf(result.Trend[i].WastedCO2Kg, result.Trend[i].TotalCO2Kg)
+	}
+	for _, workflow := range workflows {
+		if workflow.Failed.RunCount+workflow.Retried.RunCount == 0 {
+			continue
+		}
+		workflow.WastedPercent = percentOf(workflow.WastedCO2Kg, workflow.TotalCO2Kg)
+		result.Workflows = append(result.Workflows, *workflow)
+	}
+	sort.SliceStable(result.Workflows, func(i, j int) bool {
+		a, b := result.Workflows[i], result.Workflows[j]
+		if a.WastedCO2Kg != b.WastedCO2Kg {
+			return a.WastedCO2Kg > b.WastedCO2Kg
+		}
+		return workflowLabel(a.WorkflowName) < workflowLabel(b.WorkflowName)
+	})
+	return result, nil
+}
+
+// runFailed reports whether the status or conclusion metadata of a run marks it as failed
+func runFailed(metadata map[string]interface{}) bool {
+	return failedStatuses[strings.ToLower(metadataString(metadata, "status"))] ||
+		failedStatuses[strings.ToLower(metadataString(metadata, "conclusion"))]
+}
+
+// attemptOf returns the CI run attempt of a run from its github_run_id and github_run_attempt
+// metadata, which the CLI submits in GitHub Actions; runs without an attempt are the first
+func attemptOf(repoID uuid.UUID, metadata map[string]interface{}) *runAttempt {
+	runID := metadataString(metadata, "github_run_id")
+	if runID == "" {
+		if id, ok := metadataFloat(metadata, "github_run_id"); ok {
+			runID = fmt.Sprintf("%.0f", id)
+		}
+	}
+	if runID == "" {
+		return nil
+	}
+	number := 1
+	if attempt, ok := metadataFloat(metadata, "github_run_attempt"); ok && attempt >= 1 {
+		number = int(attempt)
+	}
+	return &runAttempt{key: repoID.String() + "/" + runID, number: number}
+}
+
+// percentOf returns part as a percentage of total, nil when total is zero
+func percentOf(part, total float64) *float64 {
+	if total == 0 {
+		return nil
+	}
+	percent := part / total * 100
+	return &percent
+}
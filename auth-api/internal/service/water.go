@@ -0,0 +1,80 @@
+package service
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/energy"
+)
+
+// MaxWUELitersPerKWh bounds the water usage effectiveness that can be configured, well above
+// that of evaporatively cooled data centers in hot climates
+const MaxWUELitersPerKWh = 20
+
+// WaterSettings is the water usage effectiveness (WUE) of a repository or organization in
+// liters of water per kWh of energy; null when none is set
+type WaterSettings struct {
+	WUELitersPerKWh *float64 `json:"wue_l_per_kwh" example:"0.49"`
+}
+
+// ValidateWaterSettings checks that the WUE of req, if any, is within range
+func ValidateWaterSettings(req *WaterSettings) error {
+	if wue := req.WUELitersPerKWh; wue != nil && !(*wue >= 0 && *wue <= MaxWUELitersPerKWh) {
+		return fmt.Errorf("wue_l_per_kwh must be between 0 and %d", MaxWUELitersPerKWh)
+	}
+	return nil
+}
+
+// SetWUE sets the water usage effectiveness of a repository; nil removes it
+func (s *RepositoryService) SetWUE(repoID uuid.UUID, wue *float64) (*db.Repository, error) {
+	result := s.db.Model(&db.Repository{}).Where("id = ?", repoID).Update("wue_l_per_kwh", wue)
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to update repository water usage effectiveness: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("repository not found")
+	}
+	return s.GetRepositoryByID(repoID)
+}
+
+// SetWUE sets the water usage effectiveness of an organization; nil removes it
+func (s *OrganizationService) SetWUE(orgID uuid.UUID, wue *float64) (*db.Organization, error) {
+	if err := s.db.Model(&db.Organization{}).Where("id = ?", orgID).Update("wue_l_per_kwh", wue).Error; err != nil {
+		return nil, fmt.Errorf("failed to update organization water usage effectiveness: %w", err)
+	}
+
+	var org db.Organization
+	if err := s.db.First(&org, "id = ?", orgID).Error; err != nil {
+		return nil, fmt.Errorf("failed to get organization: %w", err)
+	}
+	return &org, nil
+}
+
+// runWater computes the water of a run of repo from its energy with the WUE of the
+// repository, else of its organization, else of the hardware profile the run was estimated
+// with. It is nil when none of them is known.
+func runWater(tx *gorm.DB, repo *db.Repository, energyKWh float64, metadata map[string]interface{}) (*float64, error) {
+	wue := repo.WUELitersPerKWh
+	if wue == nil && repo.OrganizationID != nil {
+		var org db.Organization
+		if err := tx.Select("wue_l_per_kwh").First(&org, "id = ?", *repo.OrganizationID).Error; err != nil {
+			return nil, fmt.Errorf("failed to get organization water usage effectiveness: %w", err)
+		}
+		wue = org.WUELitersPerKWh
+	}
+	if wue == nil {
+		if profile, ok := energy.Profiles[metadataString(metadata, "hardware_profile")]; ok && profile.WUELitersPerKWh > 0 {
+			wue = &profile.WUELitersPerKWh
+		}
+	}
+	if wue == nil {
+		return nil, nil
+	}
+
+	water := math.Round(energyKWh*(*wue)*1e6) / 1e6
+	return &water, nil
+}
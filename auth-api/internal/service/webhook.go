@@ -0,0 +1,245 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/webhook"
+)
+
+// WebhookService handles webhook subscriptions and their deliveries
+type WebhookService struct {
+	db *gorm.DB
+}
+
+// NewWebhookService creates a new webhook service
+func NewWebhookService(database *gorm.DB) *WebhookService {
+	return &WebhookService{
+		db: database,
+	}
+}
+
+// WebhookCreateRequest represents the data needed to create a webhook subscription
+type WebhookCreateRequest struct {
+	URL    string   `json:"url" binding:"required,url"`
+	Events []string `json:"events" binding:"required,min=1"`
+	// Secret used to sign deliveries; generated when omitted
+	Secret string `json:"secret,omitempty"`
+	// Format of the payloads: ecoci (default), cloudevents-structured or cloudevents-binary
+	Format string `json:"format,omitempty"`
+}
+
+// WebhookTarget identifies the repository or organization a webhook belongs to
+type WebhookTarget struct {
+	RepositoryID   *uuid.UUID
+	OrganizationID *uuid.UUID
+}
+
+// RepositoryWebhooks targets the webhooks of a repository
+func RepositoryWebhooks(repoID uuid.UUID) WebhookTarget {
+	return WebhookTarget{RepositoryID: &repoID}
+}
+
+// OrganizationWebhooks targets the webhooks of an organization
+func OrganizationWebhooks(orgID uuid.UUID) WebhookTarget {
+	return WebhookTarget{OrganizationID: &orgID}
+}
+
+// scope restricts a webhook query to the target
+func (t WebhookTarget) scope(query *gorm.DB) *gorm.DB {
+	if t.RepositoryID != nil {
+		return query.Where("repository_id = ?", *t.RepositoryID)
+	}
+	return query.Where("organization_id = ?", *t.OrganizationID)
+}
+
+// CreateWebhook subscribes a URL to events of the target. The returned webhook carries
+// the signing secret, which is not exposed again afterwards.
+func (s *WebhookService) CreateWebhook(target WebhookTarget, createdByID uuid.UUID, req *WebhookCreateRequest) (*db.Webhook, error) {
+	events := make(db.StringList, 0, len(req.Events))
+	seen := make(map[string]bool)
+	for _, event := range req.Events {
+		if !webhook.IsValidEvent(event) {
+			return nil, fmt.Errorf("unsupported event: %s", event)
+		}
+		if !seen[event] {
+			seen[event] = true
+			events = append(events, event)
+		}
+	}
+
+	format := req.Format
+	if format == "" {
+		format = webhook.FormatEcoCI
+	}
+	if !webhook.IsValidFormat(format) {
+		return nil, fmt.Errorf("unsupported format: %s", format)
+	}
+
+	secret := req.Secret
+	if secret == "" {
+		generated, err := generateWebhookSecret()
+		if err != nil {
+			return nil, err
+		}
+		secret = generated
+	}
+
+	hook := db.Webhook{
+		RepositoryID:   target.RepositoryID,
+		OrganizationID: target.OrganizationID,
+		CreatedByID:    createdByID,
+		URL:            req.URL,
+		Secret:         secret,
+		Events:         events,
+		Format:         format,
+		Active:         true,
+	}
+	if err := s.db.Create(&hook).Error; err != nil {
+		return nil, fmt.Errorf("failed to create webhook: %w", err)
+	}
+
+	return &hook, nil
+}
+
+// generateWebhookSecret returns a random hex-encoded signing secret
+func generateWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// ListWebhooks retrieves the webhooks of the target
+func (s *WebhookService) ListWebhooks(target WebhookTarget) ([]db.Webhook, error) {
+	webhooks := []db.Webhook{}
+	if err := target.scope(s.db).Order("created_at ASC").Find(&webhooks).Error; err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+
+	return webhooks, nil
+}
+
+// GetWebhook retrieves a webhook by ID
+func (s *WebhookService) GetWebhook(webhookID uuid.UUID) (*db.Webhook, error) {
+	var hook db.Webhook
+	if err := s.db.First(&hook, "id = ?", webhookID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("webhook not found")
+		}
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
+	}
+
+	return &hook, nil
+}
+
+// DeleteWebhook removes a webhook and its deliveries
+func (s *WebhookService) DeleteWebhook(webhookID uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		deliveries := tx.Model(&db.WebhookDelivery{}).Select("id").Where("webhook_id = ?", webhookID)
+		if err := tx.Where("delivery_id IN (?)", deliveries).Delete(&db.WebhookDeliveryAttempt{}).Error; err != nil {
+			return fmt.Errorf("failed to delete webhook delivery attempts: %w", err)
+		}
+		if err := tx.Where("webhook_id = ?", webhookID).Delete(&db.WebhookDelivery{}).Error; err != nil {
+			return fmt.Errorf("failed to delete webhook deliveries: %w", err)
+		}
+		result := tx.Where("id = ?", webhookID).Delete(&db.Webhook{})
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete webhook: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("webhook not found")
+		}
+		return nil
+	})
+}
+
+// ListDeliveries retrieves the deliveries of a webhook, newest first, optionally filtered by status
+func (s *WebhookService) ListDeliveries(webhookID uuid.UUID, status string, limit, offset int) ([]db.WebhookDelivery, int64, error) {
+	query := s.db.Model(&db.WebhookDelivery{}).Where("webhook_id = ?", webhookID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count webhook deliveries: %w", err)
+	}
+
+	deliveries := []db.WebhookDelivery{}
+	if err := query.Order("created_at DESC").Limit(limit).Offset(offset).Find(&deliveries).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+
+	return deliveries, total, nil
+}
+
+// GetDelivery retrieves a delivery of a webhook
+func (s *WebhookService) GetDelivery(webhookID, deliveryID uuid.UUID) (*db.WebhookDelivery, error) {
+	var delivery db.WebhookDelivery
+	if err := s.db.First(&delivery, "id = ? AND webhook_id = ?", deliveryID, webhookID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("delivery not found")
+		}
+		return nil, fmt.Errorf("failed to get webhook delivery: %w", err)
+	}
+	return &delivery, nil
+}
+
+// ListDeliveryAttempts retrieves every attempt to send a delivery, oldest first
+func (s *WebhookService) ListDeliveryAttempts(deliveryID uuid.UUID) ([]db.WebhookDeliveryAttempt, error) {
+	attempts := []db.WebhookDeliveryAttempt{}
+	if err := s.db.Where("delivery_id = ?", deliveryID).Order("attempted_at ASC").Find(&attempts).Error; err != nil {
+		return nil, fmt.Errorf("failed to list webhook delivery attempts: %w", err)
+	}
+	return attempts, nil
+}
+
+// RedriveDead queues every dead-lettered delivery of a webhook, or those created since since
+// when it is set, for immediate redelivery with a fresh attempt budget and returns how many
+// were queued
+func (s *WebhookService) RedriveDead(webhookID uuid.UUID, since *time.Time) (int64, error) {
+	query := s.db.Model(&db.WebhookDelivery{}).Where("webhook_id = ? AND status = ?", webhookID, webhook.StatusDead)
+	if since != nil {
+		query = query.Where("created_at >= ?", *since)
+	}
+	result := query.Updates(map[string]interface{}{
+		"status":          webhook.StatusPending,
+		"attempts":        0,
+		"next_attempt_at": time.Now().UTC(),
+	})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to queue redeliveries: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// Redeliver queues a delivery of the webhook for immediate redelivery with a fresh attempt budget
+func (s *WebhookService) Redeliver(webhookID, deliveryID uuid.UUID) (*db.WebhookDelivery, error) {
+	result := s.db.Model(&db.WebhookDelivery{}).
+		Where("id = ? AND webhook_id = ?", deliveryID, webhookID).
+		Updates(map[string]interface{}{
+			"status":          webhook.StatusPending,
+			"attempts":        0,
+			"next_attempt_at": time.Now().UTC(),
+		})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to queue redelivery: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("delivery not found")
+	}
+
+	var delivery db.WebhookDelivery
+	if err := s.db.First(&delivery, "id = ?", deliveryID).Error; err != nil {
+		return nil, fmt.Errorf("failed to get webhook delivery: %w", err)
+	}
+	return &delivery, nil
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/ecoci/auth-api/internal/db"
+	"github.com/ecoci/auth-api/internal/filter"
+)
+
+// executionExpr identifies the workflow execution of a run: its workflow run group, or the
+// run itself when it was submitted without one
+const executionExpr = "COALESCE(runs.workflow_run_group, CAST(runs.id AS TEXT))"
+
+// WorkflowRunQuery describes a page of workflow executions
+type WorkflowRunQuery struct {
+	From   time.Time
+	To     time.Time
+	Limit  int
+	Offset int
+	// Filter restricts the runs collapsed into executions, all runs in scope when nil
+	Filter *filter.Expr
+}
+
+// WorkflowRun is one execution of a CI workflow with the totals of the runs submitted for it,
+// such as the jobs of a matrix build. Runs without a workflow run group are executions of their
+// own, with RunID set instead of WorkflowRunGroup.
+type WorkflowRun struct {
+	WorkflowRunGroup *string   `json:"workflow_run_group"`
+	RunID            *string   `json:"run_id"`
+	WorkflowName     *string   `json:"workflow_name"`
+	BranchName       *string   `json:"branch_name"`
+	GitCommitSHA     *string   `json:"git_commit_sha"`
+	RunCount         int64     `json:"run_count"`
+	TotalCO2Kg       float64   `json:"total_co2_kg"`
+	TotalEnergyKWh   float64   `json:"total_energy_kwh"`
+	TotalDurationS   float64   `json:"total_duration_s"`
+	MaxDurationS     float64   `json:"max_duration_s"`
+	FirstRunAt       time.Time `json:"first_run_at"`
+	LastRunAt        time.Time `json:"last_run_at"`
+}
+
+// WorkflowRuns collapses the runs in scope created between From and To into workflow
+// executions, most recent first, and returns a page of them with the number of executions
+func (s *StatsService) WorkflowRuns(scope RunScope, q WorkflowRunQuery) ([]WorkflowRun, int64, error) {
+	runs := func() *gorm.DB {
+		return s.db.Model(&db.Run{}).
+			Scopes(scope, RunsMatching(q.Filter)).
+			Where("runs.created_at >= ? AND runs.created_at <= ?", q.From, q.To)
+	}
+
+	var total int64
+	if err := runs().Select("COUNT(DISTINCT " + executionExpr + ")").Row().Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count workflow runs: %w", err)
+	}
+
+	rows, err := runs().
+		Select(executionExpr + ` as execution,
+			MAX(runs.workflow_run_group) as workflow_run_group,
+			MAX(runs.workflow_name) as workflow_name,
+			MAX(runs.branch_name) as branch_name,
+			MAX(runs.git_commit_sha) as git_commit_sha,
+			COUNT(runs.id) as run_count,
+			COALESCE(SUM(runs.co2_kg), 0) as total_co2_kg,
+			COALESCE(SUM(runs.energy_kwh), 0) as total_energy_kwh,
+			COALESCE(SUM(runs.duration_s), 0) as total_duration_s,
+			COALESCE(MAX(runs.duration_s), 0) as max_duration_s,
+			MIN(runs.created_at) as first_run_at,
+			MAX(runs.created_at) as last_run_at`).
+		Group(executionExpr).
+		Order("last_run_at DESC, execution DESC").
+		Limit(q.Limit).Offset(q.Offset).
+		Rows()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list workflow runs: %w", err)
+	}
+	defer rows.Close()
+
+	executions := []WorkflowRun{}
+	for rows.Next() {
+		var execution string
+		var run WorkflowRun
+		if err := rows.Scan(&execution, &run.WorkflowRunGroup, &run.WorkflowName, &run.BranchName, &run.GitCommitSHA,
+			&run.RunCount, &run.TotalCO2Kg, &run.TotalEnergyKWh, &run.TotalDurationS, &run.MaxDurationS,
+			db.ScanTime(&run.FirstRunAt), db.ScanTime(&run.LastRunAt)); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan workflow run: %w", err)
+		}
+		if run.WorkflowRunGroup == nil {
+			run.RunID = &execution
+		}
+		executions = append(executions, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read workflow runs: %w", err)
+	}
+
+	return executions, total, nil
+}
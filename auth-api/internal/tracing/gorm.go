@@ -0,0 +1,90 @@
+package tracing
+
+import (
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// spanKey stores the span of a statement between the before and after callbacks
+const spanKey = "tracing:span"
+
+// gormPlugin traces the statements GORM executes
+type gormPlugin struct{}
+
+// GORMPlugin returns a GORM plugin that records a span for every statement run with a
+// context holding a span (db.WithContext(ctx)). Statements without a traced context are
+// skipped rather than reported as traces of their own.
+func GORMPlugin() gorm.Plugin {
+	return gormPlugin{}
+}
+
+// Name implements gorm.Plugin
+func (gormPlugin) Name() string {
+	return "tracing"
+}
+
+// Initialize implements gorm.Plugin by registering callbacks around each kind of statement
+func (p gormPlugin) Initialize(database *gorm.DB) error {
+	callbacks := database.Callback()
+	hooks := []struct {
+		operation string
+		before    func(string, func(*gorm.DB)) error
+		after     func(string, func(*gorm.DB)) error
+	}{
+		{"create", callbacks.Create().Before("gorm:create").Register, callbacks.Create().After("gorm:create").Register},
+		{"query", callbacks.Query().Before("gorm:query").Register, callbacks.Query().After("gorm:query").Register},
+		{"update", callbacks.Update().Before("gorm:update").Register, callbacks.Update().After("gorm:update").Register},
+		{"delete", callbacks.Delete().Before("gorm:delete").Register, callbacks.Delete().After("gorm:delete").Register},
+		{"row", callbacks.Row().Before("gorm:row").Register, callbacks.Row().After("gorm:row").Register},
+		{"raw", callbacks.Raw().Before("gorm:raw").Register, callbacks.Raw().After("gorm:raw").Register},
+	}
+	for _, hook := range hooks {
+		if err := hook.before("tracing:before_"+hook.operation, p.before(hook.operation)); err != nil {
+			return err
+		}
+		if err := hook.after("tracing:after_"+hook.operation, p.after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// before starts the span of a statement
+func (gormPlugin) before(operation string) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		ctx := tx.Statement.Context
+		if ctx == nil || !trace.SpanContextFromContext(ctx).IsValid() {
+			return
+		}
+		_, span := Tracer().Start(ctx, "db."+operation, trace.WithSpanKind(trace.SpanKindClient))
+		tx.InstanceSet(spanKey, span)
+	}
+}
+
+// after ends the span of a statement with its SQL, table, affected rows and error
+func (gormPlugin) after(tx *gorm.DB) {
+	value, ok := tx.InstanceGet(spanKey)
+	if !ok {
+		return
+	}
+	span := value.(trace.Span)
+	defer span.End()
+
+	span.SetAttributes(
+		semconv.DBSystemKey.String(tx.Dialector.Name()),
+		semconv.DBStatement(strings.TrimSpace(tx.Statement.SQL.String())),
+		attribute.Int64("db.rows_affected", tx.Statement.RowsAffected),
+	)
+	if tx.Statement.Table != "" {
+		span.SetAttributes(attribute.String("db.sql.table", tx.Statement.Table))
+	}
+	if tx.Error != nil && tx.Error != gorm.ErrRecordNotFound {
+		span.RecordError(tx.Error)
+		span.SetStatus(codes.Error, tx.Error.Error())
+	}
+}
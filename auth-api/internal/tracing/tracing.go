@@ -0,0 +1,72 @@
+// Package tracing records OpenTelemetry spans of HTTP requests, database queries, GitHub API
+// calls and background jobs and exports them over OTLP. Until Setup installs an exporter, the
+// global tracer provider is a no-op and instrumented code pays next to nothing.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ecoci/auth-api/internal/config"
+)
+
+// instrumentationName identifies the spans created by the API itself
+const instrumentationName = "github.com/ecoci/auth-api"
+
+// Tracer returns the tracer of the API
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Setup installs a tracer provider exporting to the OTLP/HTTP endpoint of cfg and sampling the
+// configured ratio of new traces; traces started by a caller follow the caller's decision.
+// The returned function flushes pending spans and must be called on shutdown. Without an
+// endpoint, tracing stays disabled.
+func Setup(ctx context.Context, cfg *config.Config) (func(context.Context) error, error) {
+	if cfg.TracingEndpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.TracingEndpoint))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(cfg.TracingServiceName),
+		semconv.DeploymentEnvironment(cfg.Environment),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe service: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.TracingSampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider.Shutdown, nil
+}
+
+// Transport wraps base, or http.DefaultTransport when nil, so outgoing requests are traced as
+// children of the span in their context and carry the trace to the server
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return otelhttp.NewTransport(base)
+}
@@ -0,0 +1,55 @@
+// Package version describes the build of the running binary. Release builds set the
+// variables with -ldflags "-X github.com/ecoci/auth-api/internal/version.Commit=...";
+// otherwise the VCS information recorded by the Go toolchain is used.
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Set at build time
+var (
+	Version   = "1.0.0"
+	Commit    = ""
+	BuildTime = ""
+)
+
+// Info describes the build of the binary
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build information of the binary
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if info.Commit == "" {
+				info.Commit = setting.Value
+			}
+		case "vcs.time":
+			if info.BuildTime == "" {
+				info.BuildTime = setting.Value
+			}
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+	return info
+}
@@ -0,0 +1,382 @@
+// Package webhook queues carbon events for webhook subscriptions and delivers them as
+// HMAC-signed HTTP requests with retries.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/ecoci/auth-api/internal/cloudevents"
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+// Events that can be subscribed to
+const (
+	EventRunCreated         = "run.created"
+	EventRegressionDetected = "regression.detected"
+	EventBudgetExceeded     = "budget.exceeded"
+)
+
+// Events lists every supported event type
+var Events = []string{EventRunCreated, EventRegressionDetected, EventBudgetExceeded}
+
+// IsValidEvent reports whether event is a supported event type
+func IsValidEvent(event string) bool {
+	for _, supported := range Events {
+		if event == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// Payload formats of a webhook
+const (
+	// FormatEcoCI is the EcoCI JSON payload with id, event, created_at and data
+	FormatEcoCI = "ecoci"
+	// FormatCloudEventsStructured is a CloudEvent as one JSON document
+	FormatCloudEventsStructured = "cloudevents-structured"
+	// FormatCloudEventsBinary is a CloudEvent with its attributes as ce- headers and the event
+	// data as the body
+	FormatCloudEventsBinary = "cloudevents-binary"
+)
+
+// Formats lists every supported payload format
+var Formats = []string{FormatEcoCI, FormatCloudEventsStructured, FormatCloudEventsBinary}
+
+// IsValidFormat reports whether format is a supported payload format
+func IsValidFormat(format string) bool {
+	for _, supported := range Formats {
+		if format == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery statuses
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusDead      = "dead"
+)
+
+// Delivery tuning
+const (
+	// MaxAttempts is the number of attempts after which a delivery is dead-lettered
+	MaxAttempts = 8
+	// BatchSize is the maximum number of deliveries attempted per poll
+	BatchSize = 50
+	// PollInterval is how often the delivery job looks for due deliveries
+	PollInterval = 10 * time.Second
+	// Retention is how long delivered and dead-lettered deliveries are kept
+	Retention = 30 * 24 * time.Hour
+
+	// ResponseSnippetSize is how much of a response body is kept with each attempt to a
+	// public address
+	ResponseSnippetSize = 1024
+
+	initialBackoff = 30 * time.Second
+	maxBackoff     = 6 * time.Hour
+	requestTimeout = 10 * time.Second
+)
+
+// Request headers sent with every delivery
+const (
+	HeaderEvent     = "X-EcoCI-Event"
+	HeaderDelivery  = "X-EcoCI-Delivery"
+	HeaderSignature = "X-EcoCI-Signature-256"
+)
+
+// Event is a carbon event of a repository. It is delivered to the webhooks of the
+// repository and, if the repository belongs to one, of its organization.
+type Event struct {
+	Type           string
+	RepositoryID   uuid.UUID
+	OrganizationID *uuid.UUID
+	// Subject is the resource of the repository the event is about, such as runs/<id>; it is
+	// the subject of CloudEvents
+	Subject string
+	Data    interface{}
+}
+
+// payload is the JSON body of a delivery
+type payload struct {
+	ID        uuid.UUID   `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// Dispatcher queues events as deliveries and sends them
+type Dispatcher struct {
+	db     *gorm.DB
+	client *http.Client
+	// sourceURL is the base of the CloudEvents source of repositories
+	sourceURL string
+	// snippets keeps the start of response bodies. Deliveries to internal addresses would
+	// return their pages through the attempt history, so it is only set when they are refused.
+	snippets bool
+}
+
+// NewDispatcher creates a new webhook dispatcher. CloudEvents name the page of their
+// repository under sourceURL as their source. Deliveries to loopback, private and link-local
+// addresses fail unless allowPrivate is set, in which case response bodies are not kept.
+func NewDispatcher(database *gorm.DB, sourceURL string, allowPrivate bool) *Dispatcher {
+	return &Dispatcher{
+		db:        database,
+		client:    newClient(allowPrivate),
+		sourceURL: sourceURL,
+		snippets:  !allowPrivate,
+	}
+}
+
+// Sign returns the signature header value of body for secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff returns the delay before the next attempt after the given number of failed attempts
+func Backoff(attempts int) time.Duration {
+	delay := initialBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxBackoff {
+			return maxBackoff
+		}
+	}
+	return delay
+}
+
+// Publish queues a delivery of event for every active webhook subscribed to it. The
+// deliveries are sent asynchronously by DeliverDue.
+func (d *Dispatcher) Publish(event Event) error {
+	query := d.db.Where("active = ?", true)
+	if event.OrganizationID != nil {
+		query = query.Where("repository_id = ? OR organization_id = ?", event.RepositoryID, *event.OrganizationID)
+	} else {
+		query = query.Where("repository_id = ?", event.RepositoryID)
+	}
+
+	var webhooks []db.Webhook
+	if err := query.Find(&webhooks).Error; err != nil {
+		return fmt.Errorf("failed to find webhooks: %w", err)
+	}
+
+	now := time.Now().UTC()
+	for _, hook := range webhooks {
+		if !subscribed(hook, event.Type) {
+			continue
+		}
+
+		delivery := db.WebhookDelivery{
+			ID:            uuid.New(),
+			WebhookID:     hook.ID,
+			Event:         event.Type,
+			Status:        StatusPending,
+			NextAttemptAt: now,
+		}
+		body, err := d.encode(hook.Format, delivery.ID, event, now)
+		if err != nil {
+			return err
+		}
+		delivery.Payload = string(body)
+
+		if err := d.db.Create(&delivery).Error; err != nil {
+			return fmt.Errorf("failed to queue webhook delivery: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// encode returns the payload of a delivery in format. CloudEvents are stored structured in
+// both modes, so redeliveries send the same event.
+func (d *Dispatcher) encode(format string, id uuid.UUID, event Event, now time.Time) ([]byte, error) {
+	if format == FormatCloudEventsStructured || format == FormatCloudEventsBinary {
+		ce, err := cloudevents.New(id.String(), event.Type, cloudevents.Source(d.sourceURL, event.RepositoryID.String()), event.Subject, now, event.Data)
+		if err != nil {
+			return nil, err
+		}
+		return ce.Structured()
+	}
+
+	body, err := json.Marshal(payload{ID: id, Event: event.Type, CreatedAt: now, Data: event.Data})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+	return body, nil
+}
+
+// subscribed reports whether hook subscribes to event
+func subscribed(hook db.Webhook, event string) bool {
+	for _, subscribed := range hook.Events {
+		if subscribed == event {
+			return true
+		}
+	}
+	return false
+}
+
+// DeliverDue attempts up to BatchSize pending deliveries whose next attempt is due and
+// returns how many were attempted
+func (d *Dispatcher) DeliverDue(ctx context.Context) (int, error) {
+	var deliveries []db.WebhookDelivery
+	err := d.db.Where("status = ? AND next_attempt_at <= ?", StatusPending, time.Now().UTC()).
+		Order("next_attempt_at ASC").
+		Limit(BatchSize).
+		Find(&deliveries).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to find due deliveries: %w", err)
+	}
+
+	for i := range deliveries {
+		if err := d.attempt(ctx, &deliveries[i]); err != nil {
+			return i, err
+		}
+	}
+
+	return len(deliveries), nil
+}
+
+// attempt sends one delivery and records the outcome in the attempt history, scheduling a
+// retry or dead-lettering it on failure
+func (d *Dispatcher) attempt(ctx context.Context, delivery *db.WebhookDelivery) error {
+	var hook db.Webhook
+	if err := d.db.First(&hook, "id = ?", delivery.WebhookID).Error; err != nil {
+		return fmt.Errorf("failed to get webhook: %w", err)
+	}
+
+	started := time.Now()
+	status, snippet, sendErr := d.send(ctx, &hook, delivery)
+
+	now := time.Now().UTC()
+	delivery.Attempts++
+	delivery.ResponseStatus = status
+	record := db.WebhookDeliveryAttempt{
+		DeliveryID:     delivery.ID,
+		Attempt:        delivery.Attempts,
+		ResponseStatus: status,
+		LatencyMS:      now.Sub(started).Milliseconds(),
+		AttemptedAt:    now,
+	}
+	if snippet != "" && d.snippets {
+		record.ResponseSnippet = &snippet
+	}
+	if sendErr == nil {
+		delivery.Status = StatusDelivered
+		delivery.DeliveredAt = &now
+		delivery.LastError = nil
+	} else {
+		message := sendErr.Error()
+		delivery.LastError = &message
+		record.Error = &message
+		if delivery.Attempts >= MaxAttempts {
+			delivery.Status = StatusDead
+		} else {
+			delivery.NextAttemptAt = now.Add(Backoff(delivery.Attempts))
+		}
+	}
+
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(delivery).Error; err != nil {
+			return fmt.Errorf("failed to update webhook delivery: %w", err)
+		}
+		if err := tx.Create(&record).Error; err != nil {
+			return fmt.Errorf("failed to record webhook delivery attempt: %w", err)
+		}
+		return nil
+	})
+}
+
+// send posts the delivery payload to the webhook URL and returns the response status and the
+// first ResponseSnippetSize bytes of the response body. Any non-2xx response is a failure.
+func (d *Dispatcher) send(ctx context.Context, hook *db.Webhook, delivery *db.WebhookDelivery) (*int, string, error) {
+	body := []byte(delivery.Payload)
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	switch hook.Format {
+	case FormatCloudEventsStructured:
+		header.Set("Content-Type", cloudevents.ContentTypeStructured)
+	case FormatCloudEventsBinary:
+		event, err := cloudevents.Parse(body)
+		if err != nil {
+			return nil, "", err
+		}
+		var attributes map[string]string
+		attributes, body = event.Binary()
+		for name, value := range attributes {
+			header.Set(name, value)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header = header
+	req.Header.Set("User-Agent", "EcoCI-Webhook/1.0")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, delivery.ID.String())
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, ResponseSnippetSize))
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	status := resp.StatusCode
+	if status < 200 || status >= 300 {
+		return &status, responseSnippet(snippet), fmt.Errorf("unexpected response status %d", status)
+	}
+	return &status, responseSnippet(snippet), nil
+}
+
+// responseSnippet returns the start of a response body as text, dropping a rune cut off at
+// the end and replacing invalid UTF-8 so it can be stored and rendered as JSON
+func responseSnippet(body []byte) string {
+	for i := 0; i < utf8.UTFMax && len(body) > 0; i++ {
+		if r, size := utf8.DecodeLastRune(body); r != utf8.RuneError || size != 1 {
+			break
+		}
+		body = body[:len(body)-1]
+	}
+	return strings.ToValidUTF8(string(body), "\uFFFD")
+}
+
+// PruneDeliveries deletes the delivered and dead-lettered deliveries created before cutoff
+// and returns how many were deleted
+func (d *Dispatcher) PruneDeliveries(cutoff time.Time) (int64, error) {
+	result := d.db.Where("status <> ? AND created_at < ?", StatusPending, cutoff).Delete(&db.WebhookDelivery{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to prune webhook deliveries: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// QueueDepth returns how many deliveries are waiting to be sent, first attempts and retries
+func (d *Dispatcher) QueueDepth(ctx context.Context) (int64, error) {
+	var count int64
+	if err := d.db.WithContext(ctx).Model(&db.WebhookDelivery{}).Where("status = ?", StatusPending).Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("failed to count pending webhook deliveries: %w", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,67 @@
+package webhook
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/ecoci/auth-api/internal/db"
+)
+
+func TestDeliveryResponseSnippets(t *testing.T) {
+	database, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, database.AutoMigrate(&db.Webhook{}, &db.WebhookDelivery{}, &db.WebhookDeliveryAttempt{}))
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(strings.Repeat("upstream unavailable ", 100)))
+	}))
+	defer receiver.Close()
+
+	repoID := uuid.New()
+	hook := &db.Webhook{RepositoryID: &repoID, CreatedByID: uuid.New(), URL: receiver.URL, Secret: "s3cret",
+		Events: db.StringList{EventRunCreated}, Format: FormatEcoCI, Active: true}
+	require.NoError(t, database.Create(hook).Error)
+
+	// attempt delivers one event and returns the recorded attempt
+	attempt := func(t *testing.T, d *Dispatcher) db.WebhookDeliveryAttempt {
+		require.NoError(t, database.Where("1 = 1").Delete(&db.WebhookDeliveryAttempt{}).Error)
+		require.NoError(t, database.Where("1 = 1").Delete(&db.WebhookDelivery{}).Error)
+		require.NoError(t, d.Publish(Event{Type: EventRunCreated, RepositoryID: repoID}))
+		attempted, err := d.DeliverDue(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, 1, attempted)
+
+		var record db.WebhookDeliveryAttempt
+		require.NoError(t, database.First(&record).Error)
+		return record
+	}
+
+	t.Run("kept when private targets are refused", func(t *testing.T) {
+		// The receiver listens on loopback, so the client of a dispatcher allowing private
+		// targets stands in for one reaching a public address
+		d := NewDispatcher(database, "http://localhost:3000", true)
+		d.snippets = true
+
+		record := attempt(t, d)
+		require.NotNil(t, record.ResponseSnippet)
+		assert.Len(t, *record.ResponseSnippet, ResponseSnippetSize)
+		assert.True(t, strings.HasPrefix(*record.ResponseSnippet, "upstream unavailable"))
+	})
+
+	t.Run("dropped when private targets are allowed", func(t *testing.T) {
+		record := attempt(t, NewDispatcher(database, "http://localhost:3000", true))
+		require.NotNil(t, record.ResponseStatus)
+		assert.Equal(t, http.StatusBadGateway, *record.ResponseStatus)
+		assert.Nil(t, record.ResponseSnippet)
+	})
+}
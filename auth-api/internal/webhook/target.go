@@ -0,0 +1,81 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrTargetNotAllowed is returned for webhook URLs that are not http or https or whose host
+// resolves to a loopback, private, link-local or unspecified address
+var ErrTargetNotAllowed = errors.New("webhook target not allowed")
+
+// PublicIP reports whether ip may receive deliveries: anything but loopback, private,
+// link-local, multicast and unspecified addresses, which reach the server's own network
+func PublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
+
+// CheckTarget validates the URL of a webhook: it must be an absolute http or https URL and,
+// unless allowPrivate is set, every address of its host must be public. The address is
+// checked again when delivering, as DNS answers can change.
+func CheckTarget(ctx context.Context, rawURL string, allowPrivate bool) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Hostname() == "" {
+		return fmt.Errorf("%w: must be an absolute http or https URL", ErrTargetNotAllowed)
+	}
+	if allowPrivate {
+		return nil
+	}
+
+	host := parsed.Hostname()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("%w: failed to resolve %s", ErrTargetNotAllowed, host)
+	}
+	for _, addr := range addrs {
+		if !PublicIP(addr.IP) {
+			return fmt.Errorf("%w: %s resolves to the non-public address %s", ErrTargetNotAllowed, host, addr.IP)
+		}
+	}
+	return nil
+}
+
+// newClient returns the HTTP client deliveries are sent with. Unless allowPrivate is set it
+// refuses to connect to non-public addresses, whatever the host resolves to at dial time.
+// Redirects are not followed, so a receiver cannot bounce deliveries to another address, and
+// proxies from the environment are ignored, as they would hide the address dialed.
+func newClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: requestTimeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !PublicIP(ip) {
+				return fmt.Errorf("%w: %s is not a public address", ErrTargetNotAllowed, host)
+			}
+			return nil
+		}
+	}
+
+	return &http.Client{
+		Timeout: requestTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: requestTimeout,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
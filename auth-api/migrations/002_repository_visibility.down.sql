@@ -0,0 +1,10 @@
+-- Migration rollback: Repository visibility scoping
+
+DROP TRIGGER IF EXISTS update_organizations_updated_at ON organizations;
+
+DROP INDEX IF EXISTS idx_repositories_organization_id;
+ALTER TABLE repositories DROP COLUMN IF EXISTS organization_id;
+
+DROP TABLE IF EXISTS repository_collaborators;
+DROP TABLE IF EXISTS organization_members;
+DROP TABLE IF EXISTS organizations;
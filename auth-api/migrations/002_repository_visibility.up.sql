@@ -0,0 +1,40 @@
+-- Migration: Repository visibility scoping
+-- Adds GitHub organizations, organization membership, and repository collaborators
+
+CREATE TABLE organizations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    github_id BIGINT NOT NULL UNIQUE,
+    github_login VARCHAR(255) NOT NULL UNIQUE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE organization_members (
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (organization_id, user_id)
+);
+
+CREATE INDEX idx_organization_members_user_id ON organization_members(user_id);
+
+CREATE TABLE repository_collaborators (
+    repository_id UUID NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (repository_id, user_id)
+);
+
+CREATE INDEX idx_repository_collaborators_user_id ON repository_collaborators(user_id);
+
+ALTER TABLE repositories ADD COLUMN organization_id UUID REFERENCES organizations(id) ON DELETE SET NULL;
+CREATE INDEX idx_repositories_organization_id ON repositories(organization_id);
+
+CREATE TRIGGER update_organizations_updated_at 
+    BEFORE UPDATE ON organizations 
+    FOR EACH ROW 
+    EXECUTE FUNCTION update_updated_at_column();
+
+COMMENT ON TABLE organizations IS 'GitHub organizations owning tracked repositories';
+COMMENT ON TABLE organization_members IS 'GitHub organization membership synced at login';
+COMMENT ON TABLE repository_collaborators IS 'Users granted access to repositories they do not own';
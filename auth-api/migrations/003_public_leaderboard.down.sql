@@ -0,0 +1,4 @@
+-- Migration rollback: Public opt-in leaderboard
+
+DROP INDEX IF EXISTS idx_repositories_public_stats;
+ALTER TABLE repositories DROP COLUMN IF EXISTS public_stats;
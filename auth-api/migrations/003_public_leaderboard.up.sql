@@ -0,0 +1,6 @@
+-- Migration: Public opt-in leaderboard
+-- Repository owners can opt into publishing aggregated statistics on the public leaderboard
+
+ALTER TABLE repositories ADD COLUMN public_stats BOOLEAN NOT NULL DEFAULT false;
+
+CREATE INDEX idx_repositories_public_stats ON repositories(public_stats) WHERE public_stats;
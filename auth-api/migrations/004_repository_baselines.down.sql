@@ -0,0 +1,4 @@
+-- Migration rollback: Repository baselines
+
+DROP TRIGGER IF EXISTS update_repository_baselines_updated_at ON repository_baselines;
+DROP TABLE IF EXISTS repository_baselines;
@@ -0,0 +1,21 @@
+-- Migration: Repository baselines
+-- Frozen per-run emission rates of a reference period, used to report savings
+
+CREATE TABLE repository_baselines (
+    repository_id UUID PRIMARY KEY REFERENCES repositories(id) ON DELETE CASCADE,
+    period_from TIMESTAMP WITH TIME ZONE NOT NULL,
+    period_to TIMESTAMP WITH TIME ZONE NOT NULL,
+    run_count BIGINT NOT NULL CHECK (run_count > 0),
+    co2_kg_per_run DECIMAL(12,6) NOT NULL CHECK (co2_kg_per_run >= 0),
+    energy_kwh_per_run DECIMAL(12,6) NOT NULL CHECK (energy_kwh_per_run >= 0),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CHECK (period_from < period_to)
+);
+
+CREATE TRIGGER update_repository_baselines_updated_at 
+    BEFORE UPDATE ON repository_baselines 
+    FOR EACH ROW 
+    EXECUTE FUNCTION update_updated_at_column();
+
+COMMENT ON TABLE repository_baselines IS 'Frozen baseline emission rates per repository for savings reports';
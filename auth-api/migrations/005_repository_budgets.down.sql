@@ -0,0 +1,4 @@
+-- Migration rollback: Repository carbon budgets
+
+DROP TRIGGER IF EXISTS update_repository_budgets_updated_at ON repository_budgets;
+DROP TABLE IF EXISTS repository_budgets;
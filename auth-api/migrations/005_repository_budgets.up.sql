@@ -0,0 +1,18 @@
+-- Migration: Repository carbon budgets
+-- CO2 limits per repository and budget period (calendar month or quarter, UTC)
+
+CREATE TABLE repository_budgets (
+    repository_id UUID NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+    period VARCHAR(16) NOT NULL CHECK (period IN ('month', 'quarter')),
+    co2_kg_limit DECIMAL(12,6) NOT NULL CHECK (co2_kg_limit > 0),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (repository_id, period)
+);
+
+CREATE TRIGGER update_repository_budgets_updated_at 
+    BEFORE UPDATE ON repository_budgets 
+    FOR EACH ROW 
+    EXECUTE FUNCTION update_updated_at_column();
+
+COMMENT ON TABLE repository_budgets IS 'CO2 budgets per repository and calendar period';
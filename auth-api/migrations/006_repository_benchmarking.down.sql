@@ -0,0 +1,6 @@
+-- Migration rollback: Peer benchmarking
+
+DROP INDEX IF EXISTS idx_repositories_benchmark_opt_in;
+ALTER TABLE repositories DROP COLUMN IF EXISTS benchmark_opt_in;
+ALTER TABLE repositories DROP COLUMN IF EXISTS size_kb;
+ALTER TABLE repositories DROP COLUMN IF EXISTS language;
@@ -0,0 +1,8 @@
+-- Migration: Peer benchmarking
+-- Repository language and size for peer cohorts, and the benchmarking opt-in
+
+ALTER TABLE repositories ADD COLUMN language VARCHAR(64);
+ALTER TABLE repositories ADD COLUMN size_kb BIGINT CHECK (size_kb >= 0);
+ALTER TABLE repositories ADD COLUMN benchmark_opt_in BOOLEAN NOT NULL DEFAULT false;
+
+CREATE INDEX idx_repositories_benchmark_opt_in ON repositories(benchmark_opt_in) WHERE benchmark_opt_in;
@@ -0,0 +1,6 @@
+-- Migration rollback: Outbound webhooks
+
+DROP TRIGGER IF EXISTS update_webhook_deliveries_updated_at ON webhook_deliveries;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TRIGGER IF EXISTS update_webhooks_updated_at ON webhooks;
+DROP TABLE IF EXISTS webhooks;
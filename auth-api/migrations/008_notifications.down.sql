@@ -0,0 +1,6 @@
+-- Migration rollback: Chat notifications
+
+DROP TRIGGER IF EXISTS update_repository_notification_routes_updated_at ON repository_notification_routes;
+DROP TABLE IF EXISTS repository_notification_routes;
+DROP TRIGGER IF EXISTS update_organization_integrations_updated_at ON organization_integrations;
+DROP TABLE IF EXISTS organization_integrations;
@@ -0,0 +1,37 @@
+-- Migration: Chat notifications
+-- Organization chat integrations and per-repository notification routing
+
+CREATE TABLE organization_integrations (
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    provider VARCHAR(32) NOT NULL,
+    webhook_url TEXT,
+    bot_token TEXT,
+    default_channel VARCHAR(255),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (organization_id, provider),
+    CHECK (webhook_url IS NOT NULL OR bot_token IS NOT NULL)
+);
+
+CREATE TRIGGER update_organization_integrations_updated_at 
+    BEFORE UPDATE ON organization_integrations 
+    FOR EACH ROW 
+    EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TABLE repository_notification_routes (
+    repository_id UUID NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+    provider VARCHAR(32) NOT NULL,
+    channel VARCHAR(255),
+    events TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (repository_id, provider)
+);
+
+CREATE TRIGGER update_repository_notification_routes_updated_at 
+    BEFORE UPDATE ON repository_notification_routes 
+    FOR EACH ROW 
+    EXECUTE FUNCTION update_updated_at_column();
+
+COMMENT ON TABLE organization_integrations IS 'Chat integration credentials per organization';
+COMMENT ON TABLE repository_notification_routes IS 'Notification events and channel per repository and integration';
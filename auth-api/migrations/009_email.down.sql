@@ -0,0 +1,3 @@
+-- Migration rollback: Email notifications
+
+ALTER TABLE users DROP COLUMN IF EXISTS email_opt_out;
@@ -0,0 +1,6 @@
+-- Migration: Email notifications
+-- Per-user opt-out of email categories
+
+ALTER TABLE users ADD COLUMN email_opt_out TEXT NOT NULL DEFAULT '';
+
+COMMENT ON COLUMN users.email_opt_out IS 'Comma-separated email categories the user opted out of';
@@ -0,0 +1,3 @@
+-- Migration rollback: GitHub commit statuses
+
+ALTER TABLE repositories DROP COLUMN IF EXISTS commit_status;
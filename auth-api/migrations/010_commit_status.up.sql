@@ -0,0 +1,4 @@
+-- Migration: GitHub commit statuses
+-- Per-repository opt-in to the carbon budget commit status
+
+ALTER TABLE repositories ADD COLUMN commit_status BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,4 @@
+-- Migration rollback: Alert rules
+
+DROP TRIGGER IF EXISTS update_alert_rules_updated_at ON alert_rules;
+DROP TABLE IF EXISTS alert_rules;
@@ -0,0 +1,41 @@
+-- Migration: Alert rules
+-- User-defined thresholds on aggregated metrics, evaluated by a background job
+
+CREATE TABLE alert_rules (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    scope VARCHAR(16) NOT NULL CHECK (scope IN ('repository', 'organization', 'user')),
+    repository_id UUID REFERENCES repositories(id) ON DELETE CASCADE,
+    organization_id UUID REFERENCES organizations(id) ON DELETE CASCADE,
+    metric VARCHAR(32) NOT NULL,
+    aggregation VARCHAR(16) NOT NULL,
+    comparison VARCHAR(32) NOT NULL,
+    threshold DECIMAL(12,6) NOT NULL CHECK (threshold >= 0),
+    time_window VARCHAR(16) NOT NULL,
+    channel VARCHAR(16) NOT NULL,
+    destination VARCHAR(255),
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    last_value DECIMAL(18,6),
+    last_evaluated_at TIMESTAMP WITH TIME ZONE,
+    last_triggered_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CHECK (
+        (scope = 'repository' AND repository_id IS NOT NULL AND organization_id IS NULL) OR
+        (scope = 'organization' AND organization_id IS NOT NULL AND repository_id IS NULL) OR
+        (scope = 'user' AND repository_id IS NULL AND organization_id IS NULL)
+    )
+);
+
+CREATE INDEX idx_alert_rules_user_id ON alert_rules(user_id);
+CREATE INDEX idx_alert_rules_repository_id ON alert_rules(repository_id);
+CREATE INDEX idx_alert_rules_organization_id ON alert_rules(organization_id);
+CREATE INDEX idx_alert_rules_enabled ON alert_rules(enabled) WHERE enabled;
+
+CREATE TRIGGER update_alert_rules_updated_at 
+    BEFORE UPDATE ON alert_rules 
+    FOR EACH ROW 
+    EXECUTE FUNCTION update_updated_at_column();
+
+COMMENT ON TABLE alert_rules IS 'User-defined metric thresholds delivered through email or chat integrations';
@@ -0,0 +1,3 @@
+-- Migration rollback: Repository rollups
+
+DROP TABLE IF EXISTS repository_daily_rollups;
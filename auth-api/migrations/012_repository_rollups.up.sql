@@ -0,0 +1,32 @@
+-- Migration: Repository rollups
+-- Daily per-repository run totals maintained on ingest, so repository statistics do not
+-- aggregate the runs table on every request
+
+CREATE TABLE repository_daily_rollups (
+    repository_id UUID NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    run_count BIGINT NOT NULL CHECK (run_count >= 0),
+    total_co2_kg DECIMAL(18,6) NOT NULL,
+    total_energy_kwh DECIMAL(18,6) NOT NULL,
+    total_duration_s DECIMAL(18,3) NOT NULL,
+    last_run_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (repository_id, day)
+);
+
+CREATE INDEX idx_repository_daily_rollups_day ON repository_daily_rollups(day);
+
+-- Populate the rollups from the existing runs; runs ingested while older instances are
+-- still serving are reconciled by the rollup backfill at startup
+INSERT INTO repository_daily_rollups (repository_id, day, run_count, total_co2_kg, total_energy_kwh, total_duration_s, last_run_at)
+SELECT repository_id,
+       (created_at AT TIME ZONE 'UTC')::date,
+       COUNT(*),
+       SUM(co2_kg),
+       SUM(energy_kwh),
+       SUM(duration_s),
+       MAX(created_at)
+FROM runs
+GROUP BY repository_id, (created_at AT TIME ZONE 'UTC')::date;
+
+COMMENT ON TABLE repository_daily_rollups IS 'Run totals per repository and UTC day, maintained on ingest';
@@ -0,0 +1,5 @@
+-- Migration rollback: Background jobs
+
+DROP TABLE IF EXISTS job_runs;
+DROP TRIGGER IF EXISTS update_jobs_updated_at ON jobs;
+DROP TABLE IF EXISTS jobs;
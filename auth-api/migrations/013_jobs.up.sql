@@ -0,0 +1,42 @@
+-- Migration: Background jobs
+-- Definitions, schedules and run history of the background job scheduler
+
+CREATE TABLE jobs (
+    name VARCHAR(64) PRIMARY KEY,
+    description TEXT NOT NULL,
+    schedule VARCHAR(64) NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    next_run_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_run_at TIMESTAMP WITH TIME ZONE,
+    last_status VARCHAR(16),
+    last_error TEXT,
+    last_duration_ms BIGINT,
+    locked_by VARCHAR(255),
+    locked_until TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_jobs_next_run_at ON jobs(next_run_at);
+
+CREATE TABLE job_runs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    job_name VARCHAR(64) NOT NULL REFERENCES jobs(name) ON DELETE CASCADE,
+    trigger VARCHAR(16) NOT NULL CHECK (trigger IN ('schedule', 'manual')),
+    status VARCHAR(16) NOT NULL CHECK (status IN ('running', 'succeeded', 'failed')),
+    result TEXT,
+    error TEXT,
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    finished_at TIMESTAMP WITH TIME ZONE,
+    duration_ms BIGINT
+);
+
+CREATE INDEX idx_job_runs_job_started ON job_runs(job_name, started_at DESC);
+
+CREATE TRIGGER update_jobs_updated_at 
+    BEFORE UPDATE ON jobs 
+    FOR EACH ROW 
+    EXECUTE FUNCTION update_updated_at_column();
+
+COMMENT ON TABLE jobs IS 'Background job definitions; schedules are cron expressions evaluated in UTC';
+COMMENT ON TABLE job_runs IS 'Run history of background jobs, pruned by the retention job';
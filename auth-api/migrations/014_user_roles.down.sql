@@ -0,0 +1,5 @@
+-- Migration rollback: User roles and suspension
+
+DROP INDEX IF EXISTS idx_users_role;
+ALTER TABLE users DROP COLUMN IF EXISTS suspended_at;
+ALTER TABLE users DROP COLUMN IF EXISTS role;
@@ -0,0 +1,14 @@
+-- Migration: User roles and suspension
+-- Replaces the hard-coded admin usernames with a role stored per user
+
+ALTER TABLE users ADD COLUMN role VARCHAR(16) NOT NULL DEFAULT 'user'
+    CHECK (role IN ('user', 'admin'));
+ALTER TABLE users ADD COLUMN suspended_at TIMESTAMP WITH TIME ZONE;
+
+-- Keep the accounts that were administrators under the username list
+UPDATE users SET role = 'admin' WHERE LOWER(github_username) IN ('admin', 'ecoci-admin');
+
+CREATE INDEX idx_users_role ON users(role) WHERE role <> 'user';
+
+COMMENT ON COLUMN users.role IS 'Platform role: user or admin';
+COMMENT ON COLUMN users.suspended_at IS 'When an administrator suspended the account; suspended users cannot sign in';
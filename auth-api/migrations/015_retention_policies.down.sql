@@ -0,0 +1,5 @@
+-- Migration rollback: Data retention policies
+
+ALTER TABLE repositories DROP COLUMN IF EXISTS runs_purged_before;
+DROP TABLE IF EXISTS retention_reports;
+DROP TABLE IF EXISTS retention_policies;
@@ -0,0 +1,37 @@
+-- Migration: Data retention policies
+-- Per-organization retention of raw runs and daily rollups, with reports of each purge
+
+CREATE TABLE retention_policies (
+    organization_id UUID PRIMARY KEY REFERENCES organizations(id) ON DELETE CASCADE,
+    run_retention_days INTEGER CHECK (run_retention_days > 0),
+    rollup_retention_days INTEGER CHECK (rollup_retention_days > 0),
+    dry_run BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CHECK (rollup_retention_days IS NULL OR (run_retention_days IS NOT NULL AND rollup_retention_days >= run_retention_days))
+);
+
+CREATE TABLE retention_reports (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    dry_run BOOLEAN NOT NULL,
+    run_cutoff TIMESTAMP WITH TIME ZONE,
+    rollup_cutoff TIMESTAMP WITH TIME ZONE,
+    repositories INTEGER NOT NULL,
+    runs_deleted BIGINT NOT NULL,
+    rollups_deleted BIGINT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_retention_reports_org_created ON retention_reports(organization_id, created_at DESC);
+
+ALTER TABLE repositories ADD COLUMN runs_purged_before DATE;
+
+CREATE TRIGGER update_retention_policies_updated_at 
+    BEFORE UPDATE ON retention_policies 
+    FOR EACH ROW 
+    EXECUTE FUNCTION update_updated_at_column();
+
+COMMENT ON TABLE retention_policies IS 'How long runs and rollups of the repositories of an organization are kept; NULL keeps them forever';
+COMMENT ON TABLE retention_reports IS 'What each application of a retention policy deleted or, in dry-run mode, would delete';
+COMMENT ON COLUMN repositories.runs_purged_before IS 'Day before which runs were purged; rollups of earlier days are no longer rebuilt from runs';
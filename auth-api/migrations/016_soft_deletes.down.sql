@@ -0,0 +1,9 @@
+-- Migration rollback: Soft deletes
+
+DELETE FROM runs WHERE deleted_at IS NOT NULL;
+DELETE FROM repositories WHERE deleted_at IS NOT NULL;
+DELETE FROM users WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE runs DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE repositories DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
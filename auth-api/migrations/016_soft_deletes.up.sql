@@ -0,0 +1,14 @@
+-- Migration: Soft deletes
+-- Deleted users, repositories and runs are kept until the restore window has passed
+
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE repositories ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE runs ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_users_deleted_at ON users(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_repositories_deleted_at ON repositories(deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_runs_deleted_at ON runs(deleted_at) WHERE deleted_at IS NOT NULL;
+
+COMMENT ON COLUMN users.deleted_at IS 'When the account was deleted; it can be restored until the rows are purged';
+COMMENT ON COLUMN repositories.deleted_at IS 'When the repository was deleted; it can be restored until the rows are purged';
+COMMENT ON COLUMN runs.deleted_at IS 'When the run was deleted; deleted runs are excluded from all statistics';
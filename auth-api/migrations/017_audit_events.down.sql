@@ -0,0 +1,3 @@
+-- Migration rollback: Audit events
+
+DROP TABLE IF EXISTS audit_events;
@@ -0,0 +1,26 @@
+-- Migration: Audit events
+-- Mutations made through the API, kept for compliance reviews
+
+CREATE TABLE audit_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    -- No foreign keys: events outlive the users and records they describe
+    actor_id UUID,
+    actor_username VARCHAR(255) NOT NULL DEFAULT '',
+    action VARCHAR(64) NOT NULL,
+    resource_type VARCHAR(32) NOT NULL,
+    resource_id VARCHAR(64) NOT NULL,
+    organization_id UUID,
+    changes JSONB,
+    request_id VARCHAR(128) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_audit_events_created_at ON audit_events(created_at DESC);
+CREATE INDEX idx_audit_events_actor_id ON audit_events(actor_id);
+CREATE INDEX idx_audit_events_action ON audit_events(action);
+CREATE INDEX idx_audit_events_resource ON audit_events(resource_type, resource_id);
+CREATE INDEX idx_audit_events_organization_id ON audit_events(organization_id) WHERE organization_id IS NOT NULL;
+
+COMMENT ON TABLE audit_events IS 'Who changed what through the API, and when; rows are never updated';
+COMMENT ON COLUMN audit_events.changes IS 'Changed fields mapped to their from and to values';
+COMMENT ON COLUMN audit_events.request_id IS 'X-Request-ID of the request that made the change';
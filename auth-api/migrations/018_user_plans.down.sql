@@ -0,0 +1,3 @@
+-- Migration rollback: User plans
+
+ALTER TABLE users DROP COLUMN IF EXISTS plan;
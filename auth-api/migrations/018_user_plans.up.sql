@@ -0,0 +1,6 @@
+-- Migration: User plans
+-- The plan of a user selects their per-user and per-token rate limits
+
+ALTER TABLE users ADD COLUMN plan VARCHAR(32);
+
+COMMENT ON COLUMN users.plan IS 'Rate limit plan configured in RATE_LIMIT_PLANS; NULL uses RATE_LIMIT_DEFAULT_PLAN';
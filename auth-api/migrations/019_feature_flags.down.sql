@@ -0,0 +1,4 @@
+-- Migration rollback: Feature flags
+
+DROP TRIGGER IF EXISTS update_feature_flags_updated_at ON feature_flags;
+DROP TABLE IF EXISTS feature_flags;
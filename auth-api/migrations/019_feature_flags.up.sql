@@ -0,0 +1,23 @@
+-- Migration: Feature flags
+-- Flags are defined in code; these rows override their defaults to roll features out gradually
+
+CREATE TABLE feature_flags (
+    name VARCHAR(64) PRIMARY KEY,
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    rollout_percentage INTEGER NOT NULL DEFAULT 0 CHECK (rollout_percentage BETWEEN 0 AND 100),
+    user_ids TEXT NOT NULL DEFAULT '',
+    organization_ids TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE TRIGGER update_feature_flags_updated_at
+    BEFORE UPDATE ON feature_flags
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+COMMENT ON TABLE feature_flags IS 'Runtime state of the feature flags defined in code; flags without a row use their default';
+COMMENT ON COLUMN feature_flags.enabled IS 'Master switch; a disabled flag is off for everybody';
+COMMENT ON COLUMN feature_flags.rollout_percentage IS 'Share of the remaining users the enabled flag is on for, bucketed by user ID';
+COMMENT ON COLUMN feature_flags.user_ids IS 'Comma-separated IDs of users the enabled flag is always on for';
+COMMENT ON COLUMN feature_flags.organization_ids IS 'Comma-separated IDs of organizations whose members the enabled flag is always on for';
@@ -0,0 +1,5 @@
+-- Migration rollback: Organization plans
+
+ALTER TABLE organizations DROP COLUMN IF EXISTS plan;
+
+COMMENT ON COLUMN users.plan IS 'Rate limit plan configured in RATE_LIMIT_PLANS; NULL uses RATE_LIMIT_DEFAULT_PLAN';
@@ -0,0 +1,8 @@
+-- Migration: Organization plans
+-- The plan of an organization selects the quotas of its repositories; users keep their own
+-- plan for their personal repositories and rate limits
+
+ALTER TABLE organizations ADD COLUMN plan VARCHAR(32);
+
+COMMENT ON COLUMN organizations.plan IS 'Plan configured in RATE_LIMIT_PLANS and PLAN_QUOTAS; NULL uses RATE_LIMIT_DEFAULT_PLAN';
+COMMENT ON COLUMN users.plan IS 'Plan configured in RATE_LIMIT_PLANS and PLAN_QUOTAS; NULL uses RATE_LIMIT_DEFAULT_PLAN';
@@ -0,0 +1,3 @@
+-- Migration rollback: Webhook delivery attempts
+
+DROP TABLE IF EXISTS webhook_delivery_attempts;
@@ -0,0 +1,19 @@
+-- Migration: Webhook delivery attempts
+-- Every attempt of a delivery is kept with its outcome, so failing endpoints can be debugged
+
+CREATE TABLE webhook_delivery_attempts (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    delivery_id UUID NOT NULL REFERENCES webhook_deliveries(id) ON DELETE CASCADE,
+    attempt INTEGER NOT NULL,
+    response_status INTEGER,
+    latency_ms INTEGER NOT NULL,
+    response_snippet TEXT,
+    error TEXT,
+    attempted_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_webhook_delivery_attempts_delivery_id ON webhook_delivery_attempts(delivery_id, attempted_at);
+
+COMMENT ON TABLE webhook_delivery_attempts IS 'Outcome of every attempt to send a webhook delivery';
+COMMENT ON COLUMN webhook_delivery_attempts.attempt IS 'Attempt within the retry budget of the delivery; restarts at 1 after a redelivery';
+COMMENT ON COLUMN webhook_delivery_attempts.response_snippet IS 'Start of the response body, at most 1 KiB';
@@ -0,0 +1,4 @@
+-- Migration rollback: BigQuery export
+
+DROP TABLE IF EXISTS bigquery_export_cursors;
+DROP TABLE IF EXISTS bigquery_export_queue;
@@ -0,0 +1,20 @@
+-- Migration: BigQuery export
+-- New runs are queued in the transaction that creates them until the export job streams them
+-- to BigQuery; cursors record how far the nightly exports have got
+
+CREATE TABLE bigquery_export_queue (
+    run_id UUID PRIMARY KEY,
+    queued_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_bigquery_export_queue_queued_at ON bigquery_export_queue(queued_at);
+
+CREATE TABLE bigquery_export_cursors (
+    stream VARCHAR(32) PRIMARY KEY,
+    position TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+COMMENT ON TABLE bigquery_export_queue IS 'Runs created while the BigQuery export is enabled that have not been exported yet';
+COMMENT ON TABLE bigquery_export_cursors IS 'Progress of the exports to BigQuery that are not queued, such as the nightly rollups';
+COMMENT ON COLUMN bigquery_export_cursors.position IS 'Time of the last export; rows changed since then are exported next';
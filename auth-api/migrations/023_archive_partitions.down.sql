@@ -0,0 +1,3 @@
+-- Migration rollback: Parquet archive
+
+DROP TABLE IF EXISTS archive_partitions;
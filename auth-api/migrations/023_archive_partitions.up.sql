@@ -0,0 +1,18 @@
+-- Migration: Parquet archive
+-- Each row is a Parquet file in the archive bucket with the runs of a repository on one UTC
+-- day; files are written again when the rollup of their day changes after their export
+
+CREATE TABLE archive_partitions (
+    repository_id UUID NOT NULL,
+    day DATE NOT NULL,
+    key TEXT NOT NULL,
+    run_count BIGINT NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    exported_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (repository_id, day)
+);
+
+CREATE INDEX idx_archive_partitions_day ON archive_partitions(day);
+
+COMMENT ON TABLE archive_partitions IS 'Parquet files of runs written to the archive bucket, listed by the archive manifest';
+COMMENT ON COLUMN archive_partitions.key IS 'Object key of the file in the archive bucket';
@@ -0,0 +1,3 @@
+-- Migration rollback: Webhook payload formats
+
+ALTER TABLE webhooks DROP COLUMN IF EXISTS format;
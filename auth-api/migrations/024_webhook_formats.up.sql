@@ -0,0 +1,6 @@
+-- Migration: Webhook payload formats
+-- Webhooks receive the EcoCI payload or CloudEvents 1.0 in structured or binary mode
+
+ALTER TABLE webhooks ADD COLUMN format VARCHAR(32) NOT NULL DEFAULT 'ecoci';
+
+COMMENT ON COLUMN webhooks.format IS 'Payload format: ecoci, cloudevents-structured or cloudevents-binary';
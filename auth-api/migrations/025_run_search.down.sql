@@ -0,0 +1,3 @@
+-- Migration rollback: Run search
+
+DROP INDEX IF EXISTS idx_runs_search;
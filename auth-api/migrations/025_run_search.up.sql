@@ -0,0 +1,9 @@
+-- Migration: Run search
+-- Runs are searched by their workflow, branch and commit and by the string and number values
+-- of their metadata, such as tags and commit messages. The index is on the same expression
+-- the search queries, so PostgreSQL matches them without reading every run.
+
+CREATE INDEX idx_runs_search ON runs USING GIN ((
+    to_tsvector('simple', coalesce(workflow_name, '') || ' ' || coalesce(branch_name, '') || ' ' || coalesce(git_commit_sha, ''))
+    || jsonb_to_tsvector('simple', coalesce(run_metadata, '{}'::jsonb), '["string", "numeric"]')
+));
@@ -0,0 +1,11 @@
+-- Migration rollback: Run sort indexes
+
+DROP INDEX IF EXISTS idx_runs_repo_co2_kg_sort;
+DROP INDEX IF EXISTS idx_runs_repo_energy_kwh_sort;
+DROP INDEX IF EXISTS idx_runs_repo_duration_s_sort;
+DROP INDEX IF EXISTS idx_runs_repo_created_at_sort;
+
+DROP INDEX IF EXISTS idx_runs_user_co2_kg_sort;
+DROP INDEX IF EXISTS idx_runs_user_energy_kwh_sort;
+DROP INDEX IF EXISTS idx_runs_user_duration_s_sort;
+DROP INDEX IF EXISTS idx_runs_user_created_at_sort;
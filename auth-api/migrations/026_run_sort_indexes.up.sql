@@ -0,0 +1,14 @@
+-- Migration: Run sort indexes
+-- Run listings of a repository or user can be sorted by creation time, CO2, energy or
+-- duration, with the ID breaking ties. Each index serves both directions of its sort and
+-- covers only the runs that are not deleted, which are the ones listed.
+
+CREATE INDEX idx_runs_repo_co2_kg_sort ON runs(repository_id, co2_kg, id) WHERE deleted_at IS NULL;
+CREATE INDEX idx_runs_repo_energy_kwh_sort ON runs(repository_id, energy_kwh, id) WHERE deleted_at IS NULL;
+CREATE INDEX idx_runs_repo_duration_s_sort ON runs(repository_id, duration_s, id) WHERE deleted_at IS NULL;
+CREATE INDEX idx_runs_repo_created_at_sort ON runs(repository_id, created_at, id) WHERE deleted_at IS NULL;
+
+CREATE INDEX idx_runs_user_co2_kg_sort ON runs(user_id, co2_kg, id) WHERE deleted_at IS NULL;
+CREATE INDEX idx_runs_user_energy_kwh_sort ON runs(user_id, energy_kwh, id) WHERE deleted_at IS NULL;
+CREATE INDEX idx_runs_user_duration_s_sort ON runs(user_id, duration_s, id) WHERE deleted_at IS NULL;
+CREATE INDEX idx_runs_user_created_at_sort ON runs(user_id, created_at, id) WHERE deleted_at IS NULL;
@@ -0,0 +1,5 @@
+-- Migration rollback: Workflow run groups
+
+DROP INDEX IF EXISTS idx_runs_repo_workflow_run_group;
+
+ALTER TABLE runs DROP COLUMN IF EXISTS workflow_run_group;
@@ -0,0 +1,9 @@
+-- Migration: Workflow run groups
+-- The runs submitted for one execution of a CI workflow, such as the jobs of a matrix build,
+-- share a group, so listings and statistics can report executions instead of single jobs.
+
+ALTER TABLE runs ADD COLUMN workflow_run_group VARCHAR(255);
+
+CREATE INDEX idx_runs_repo_workflow_run_group ON runs(repository_id, workflow_run_group) WHERE deleted_at IS NULL AND workflow_run_group IS NOT NULL;
+
+COMMENT ON COLUMN runs.workflow_run_group IS 'Execution of the CI workflow the run was submitted for; runs of the same execution share it';
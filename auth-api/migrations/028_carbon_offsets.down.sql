@@ -0,0 +1,3 @@
+-- Migration rollback: Carbon offsets
+
+DROP TABLE IF EXISTS carbon_offsets;
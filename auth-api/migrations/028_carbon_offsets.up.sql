@@ -0,0 +1,31 @@
+-- Migration: Carbon offsets
+-- Offsets and renewable-matched energy purchased by organizations, for market-based and net emissions
+
+CREATE TABLE carbon_offsets (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    kind VARCHAR(16) NOT NULL CHECK (kind IN ('offset', 'renewable')),
+    co2_kg DOUBLE PRECISION CHECK (co2_kg > 0),
+    energy_kwh DOUBLE PRECISION CHECK (energy_kwh > 0),
+    vendor VARCHAR(255) NOT NULL,
+    certificate_url VARCHAR(2048),
+    period_start DATE NOT NULL,
+    period_end DATE NOT NULL,
+    created_by_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CHECK (period_end >= period_start),
+    CHECK ((kind = 'offset' AND co2_kg IS NOT NULL AND energy_kwh IS NULL) OR
+           (kind = 'renewable' AND energy_kwh IS NOT NULL AND co2_kg IS NULL))
+);
+
+CREATE INDEX idx_carbon_offsets_org_period ON carbon_offsets(organization_id, period_start);
+
+CREATE TRIGGER update_carbon_offsets_updated_at 
+    BEFORE UPDATE ON carbon_offsets 
+    FOR EACH ROW 
+    EXECUTE FUNCTION update_updated_at_column();
+
+COMMENT ON TABLE carbon_offsets IS 'Carbon offsets and renewable energy purchased by an organization for a period';
+COMMENT ON COLUMN carbon_offsets.co2_kg IS 'CO2 offset, set for kind offset';
+COMMENT ON COLUMN carbon_offsets.energy_kwh IS 'Renewable energy matched, set for kind renewable';
@@ -0,0 +1,3 @@
+-- Migration rollback: Emission factors
+
+DROP TABLE IF EXISTS emission_factors;
@@ -0,0 +1,28 @@
+-- Migration: Emission factors
+-- Grid carbon intensity per region and effective period, with the provenance of each number
+
+CREATE TABLE emission_factors (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    region VARCHAR(64) NOT NULL,
+    grams_co2e_per_kwh DOUBLE PRECISION NOT NULL CHECK (grams_co2e_per_kwh >= 0),
+    source VARCHAR(255) NOT NULL,
+    source_url VARCHAR(2048),
+    methodology TEXT NOT NULL,
+    effective_from DATE NOT NULL,
+    effective_to DATE,
+    created_by_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    updated_by_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CHECK (effective_to IS NULL OR effective_to > effective_from)
+);
+
+CREATE INDEX idx_emission_factors_region_from ON emission_factors(region, effective_from);
+
+CREATE TRIGGER update_emission_factors_updated_at 
+    BEFORE UPDATE ON emission_factors 
+    FOR EACH ROW 
+    EXECUTE FUNCTION update_updated_at_column();
+
+COMMENT ON TABLE emission_factors IS 'Grid carbon intensity of a region over its effective period, with its source and methodology';
+COMMENT ON COLUMN emission_factors.effective_to IS 'Exclusive end of the effective period; NULL while the factor is current';
@@ -0,0 +1,13 @@
+-- Migration rollback: Emission factor versions and recalculation
+
+DROP INDEX IF EXISTS idx_runs_recalculation_pending;
+
+ALTER TABLE runs DROP COLUMN IF EXISTS recalculated_at;
+ALTER TABLE runs DROP COLUMN IF EXISTS emission_factor_version;
+ALTER TABLE runs DROP COLUMN IF EXISTS emission_factor_id;
+ALTER TABLE runs DROP COLUMN IF EXISTS current_co2_kg;
+
+DROP TABLE IF EXISTS recalculation_reports;
+DROP TABLE IF EXISTS emission_factor_versions;
+
+ALTER TABLE emission_factors DROP COLUMN IF EXISTS version;
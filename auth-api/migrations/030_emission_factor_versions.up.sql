@@ -0,0 +1,57 @@
+-- Migration: Emission factor versions and recalculation
+-- Every version of an emission factor is kept, and runs get their CO2 recomputed with the
+-- factors currently in effect next to the CO2 as reported
+
+ALTER TABLE emission_factors ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+CREATE TABLE emission_factor_versions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    factor_id UUID NOT NULL,
+    version INTEGER NOT NULL,
+    change VARCHAR(16) NOT NULL CHECK (change IN ('create', 'update', 'delete')),
+    region VARCHAR(64) NOT NULL,
+    grams_co2e_per_kwh DOUBLE PRECISION NOT NULL,
+    source VARCHAR(255) NOT NULL,
+    source_url VARCHAR(2048),
+    methodology TEXT NOT NULL,
+    effective_from DATE NOT NULL,
+    effective_to DATE,
+    changed_by_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_emission_factor_versions_factor_version ON emission_factor_versions(factor_id, version);
+CREATE INDEX idx_emission_factor_versions_created_at ON emission_factor_versions(created_at);
+
+-- Factors created before versioning start at their first version
+INSERT INTO emission_factor_versions (factor_id, version, change, region, grams_co2e_per_kwh, source, source_url,
+    methodology, effective_from, effective_to, changed_by_id, created_at)
+SELECT id, 1, 'create', region, grams_co2e_per_kwh, source, source_url,
+    methodology, effective_from, effective_to, updated_by_id, updated_at
+FROM emission_factors;
+
+CREATE TABLE recalculation_reports (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    full_scan BOOLEAN NOT NULL,
+    runs_scanned BIGINT NOT NULL,
+    runs_changed BIGINT NOT NULL,
+    previous_co2_kg DOUBLE PRECISION NOT NULL,
+    current_co2_kg DOUBLE PRECISION NOT NULL,
+    regions JSONB,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_recalculation_reports_created_at ON recalculation_reports(created_at DESC);
+
+ALTER TABLE runs ADD COLUMN current_co2_kg DECIMAL(12,6) CHECK (current_co2_kg >= 0);
+ALTER TABLE runs ADD COLUMN emission_factor_id UUID;
+ALTER TABLE runs ADD COLUMN emission_factor_version INTEGER;
+ALTER TABLE runs ADD COLUMN recalculated_at TIMESTAMP WITH TIME ZONE;
+
+-- Runs the recalculation job has not computed yet
+CREATE INDEX idx_runs_recalculation_pending ON runs(id) WHERE recalculated_at IS NULL;
+
+COMMENT ON TABLE emission_factor_versions IS 'State of an emission factor after each change; never updated and kept after the factor is deleted';
+COMMENT ON TABLE recalculation_reports IS 'What each recalculation of the current-methodology CO2 of runs changed';
+COMMENT ON COLUMN runs.current_co2_kg IS 'CO2 recomputed with the emission factor currently in effect for the region and day of the run; co2_kg stays as reported';
+COMMENT ON COLUMN runs.emission_factor_version IS 'Version of emission_factor_id current_co2_kg was computed with; NULL for the built-in factors';
@@ -0,0 +1,3 @@
+-- Migration rollback: User display units
+
+ALTER TABLE users DROP COLUMN IF EXISTS display_units;
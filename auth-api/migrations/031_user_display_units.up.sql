@@ -0,0 +1,6 @@
+-- Migration: User display units
+-- The units API responses report CO2 and energy in for a user
+
+ALTER TABLE users ADD COLUMN display_units VARCHAR(32);
+
+COMMENT ON COLUMN users.display_units IS 'Units responses report CO2 and energy in, such as g,Wh; NULL reports kg and kWh';
@@ -0,0 +1,5 @@
+-- Migration rollback: Water usage
+
+ALTER TABLE runs DROP COLUMN IF EXISTS water_l;
+ALTER TABLE organizations DROP COLUMN IF EXISTS wue_l_per_kwh;
+ALTER TABLE repositories DROP COLUMN IF EXISTS wue_l_per_kwh;
@@ -0,0 +1,10 @@
+-- Migration: Water usage
+-- Water usage effectiveness (WUE) of repositories and organizations, and the water of runs
+
+ALTER TABLE repositories ADD COLUMN wue_l_per_kwh DOUBLE PRECISION CHECK (wue_l_per_kwh >= 0);
+ALTER TABLE organizations ADD COLUMN wue_l_per_kwh DOUBLE PRECISION CHECK (wue_l_per_kwh >= 0);
+ALTER TABLE runs ADD COLUMN water_l DECIMAL(14,6) CHECK (water_l >= 0);
+
+COMMENT ON COLUMN repositories.wue_l_per_kwh IS 'Water usage effectiveness in liters per kWh, overriding that of the organization';
+COMMENT ON COLUMN organizations.wue_l_per_kwh IS 'Water usage effectiveness in liters per kWh of the repositories of the organization';
+COMMENT ON COLUMN runs.water_l IS 'Water consumed for the energy of the run, computed at ingest; NULL when no WUE is known';
@@ -0,0 +1,3 @@
+-- Migration rollback: Measurements
+
+DROP TABLE IF EXISTS measurements;
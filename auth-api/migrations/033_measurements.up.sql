@@ -0,0 +1,16 @@
+-- Migration: Measurements
+-- Metrics of runs beyond their energy, CO2 and duration, such as GPU energy or network
+-- transfer, one row per metric so new ones need no migration
+
+CREATE TABLE measurements (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    run_id UUID NOT NULL REFERENCES runs(id) ON DELETE CASCADE,
+    type VARCHAR(64) NOT NULL,
+    value DOUBLE PRECISION NOT NULL CHECK (value >= 0),
+    unit VARCHAR(16) NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_measurements_run_type ON measurements(run_id, type);
+CREATE INDEX idx_measurements_type ON measurements(type);
+
+COMMENT ON TABLE measurements IS 'Metrics of runs beyond energy, CO2 and duration; energy in kWh, data in bytes';
@@ -0,0 +1,6 @@
+-- Migration rollback: GPU energy
+
+DROP TABLE IF EXISTS run_gpus;
+ALTER TABLE runs DROP COLUMN IF EXISTS gpu_count;
+ALTER TABLE runs DROP COLUMN IF EXISTS gpu_model;
+ALTER TABLE runs DROP COLUMN IF EXISTS gpu_energy_kwh;
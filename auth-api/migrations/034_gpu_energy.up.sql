@@ -0,0 +1,21 @@
+-- Migration: GPU energy
+-- The part of the energy of runs consumed by GPUs, with their model and count, and the energy
+-- of each GPU where it was measured per device
+
+ALTER TABLE runs ADD COLUMN gpu_energy_kwh DECIMAL(12,6) CHECK (gpu_energy_kwh >= 0);
+ALTER TABLE runs ADD COLUMN gpu_model VARCHAR(128);
+ALTER TABLE runs ADD COLUMN gpu_count INTEGER CHECK (gpu_count > 0);
+
+CREATE TABLE run_gpus (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    run_id UUID NOT NULL REFERENCES runs(id) ON DELETE CASCADE,
+    device_index INTEGER NOT NULL CHECK (device_index >= 0),
+    model VARCHAR(128) NOT NULL,
+    energy_kwh DECIMAL(12,6) NOT NULL CHECK (energy_kwh >= 0)
+);
+
+CREATE UNIQUE INDEX idx_run_gpus_run_device ON run_gpus(run_id, device_index);
+
+COMMENT ON COLUMN runs.gpu_energy_kwh IS 'Part of energy_kwh consumed by GPUs; NULL for runs without GPUs';
+COMMENT ON COLUMN runs.gpu_model IS 'Model of the GPUs of the run; NULL for mixed devices';
+COMMENT ON TABLE run_gpus IS 'Energy of each GPU of runs measured per device';
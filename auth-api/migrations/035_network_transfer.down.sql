@@ -0,0 +1,5 @@
+-- Migration rollback: Network transfer
+
+ALTER TABLE runs DROP COLUMN IF EXISTS network_co2_kg;
+ALTER TABLE runs DROP COLUMN IF EXISTS network_energy_kwh;
+ALTER TABLE runs DROP COLUMN IF EXISTS network_bytes;
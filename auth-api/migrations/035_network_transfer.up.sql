@@ -0,0 +1,11 @@
+-- Migration: Network transfer
+-- The data runs transferred, such as artifact uploads and image pulls, with its energy and
+-- CO2 computed at ingest
+
+ALTER TABLE runs ADD COLUMN network_bytes BIGINT CHECK (network_bytes >= 0);
+ALTER TABLE runs ADD COLUMN network_energy_kwh DECIMAL(12,6) CHECK (network_energy_kwh >= 0);
+ALTER TABLE runs ADD COLUMN network_co2_kg DECIMAL(12,6) CHECK (network_co2_kg >= 0);
+
+COMMENT ON COLUMN runs.network_bytes IS 'Data transferred by the run; NULL when not reported';
+COMMENT ON COLUMN runs.network_energy_kwh IS 'Energy of the network transfer at NETWORK_KWH_PER_GB, not part of energy_kwh';
+COMMENT ON COLUMN runs.network_co2_kg IS 'CO2 of the network transfer, not part of co2_kg';
@@ -0,0 +1,4 @@
+-- Migration rollback: Storage emissions
+
+DROP TABLE IF EXISTS repository_storage_days;
+DROP TABLE IF EXISTS storage_reports;
@@ -0,0 +1,25 @@
+-- Migration: Storage emissions
+-- Artifact and cache storage reported by repositories, and its energy and CO2 accrued per day
+
+CREATE TABLE storage_reports (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    repository_id UUID NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+    artifact_bytes BIGINT NOT NULL CHECK (artifact_bytes >= 0),
+    cache_bytes BIGINT NOT NULL CHECK (cache_bytes >= 0),
+    reported_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX idx_storage_reports_repository_reported ON storage_reports(repository_id, reported_at);
+
+CREATE TABLE repository_storage_days (
+    repository_id UUID NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    artifact_bytes BIGINT NOT NULL,
+    cache_bytes BIGINT NOT NULL,
+    energy_kwh DECIMAL(18,9) NOT NULL,
+    co2_kg DECIMAL(18,9) NOT NULL,
+    PRIMARY KEY (repository_id, day)
+);
+
+COMMENT ON TABLE storage_reports IS 'Artifact and cache storage of repositories as reported';
+COMMENT ON TABLE repository_storage_days IS 'Energy and CO2 of the storage of repositories per UTC day, at STORAGE_KWH_PER_TB_MONTH and STORAGE_CARBON_INTENSITY';
@@ -0,0 +1,3 @@
+-- Migration rollback: Run test suites
+
+DROP TABLE IF EXISTS run_test_suites;
@@ -0,0 +1,20 @@
+-- Migration: Run test suites
+-- The test suites of the JUnit reports of runs, with the energy and CO2 of each run
+-- apportioned across them by duration
+
+CREATE TABLE run_test_suites (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    run_id UUID NOT NULL REFERENCES runs(id) ON DELETE CASCADE,
+    name VARCHAR(512) NOT NULL,
+    tests INTEGER NOT NULL CHECK (tests >= 0),
+    failures INTEGER NOT NULL CHECK (failures >= 0),
+    errors INTEGER NOT NULL CHECK (errors >= 0),
+    skipped INTEGER NOT NULL CHECK (skipped >= 0),
+    duration_s DECIMAL(12,3) NOT NULL CHECK (duration_s >= 0),
+    energy_kwh DECIMAL(18,9) NOT NULL,
+    co2_kg DECIMAL(18,9) NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_run_test_suites_run_name ON run_test_suites(run_id, name);
+
+COMMENT ON TABLE run_test_suites IS 'Test suites of the JUnit reports of runs with their share of the energy and CO2 of the run';
@@ -0,0 +1,5 @@
+-- Migration rollback: Repository languages
+
+DROP TABLE IF EXISTS repository_languages;
+DROP INDEX IF EXISTS idx_repositories_languages_synced_at;
+ALTER TABLE repositories DROP COLUMN IF EXISTS languages_synced_at;
@@ -0,0 +1,16 @@
+-- Migration: Repository languages
+-- The languages of repositories as detected by GitHub, synced by the language-sync job
+
+ALTER TABLE repositories ADD COLUMN languages_synced_at TIMESTAMP WITH TIME ZONE;
+
+CREATE TABLE repository_languages (
+    repository_id UUID NOT NULL REFERENCES repositories(id) ON DELETE CASCADE,
+    language VARCHAR(64) NOT NULL,
+    bytes BIGINT NOT NULL CHECK (bytes >= 0),
+    PRIMARY KEY (repository_id, language)
+);
+
+CREATE INDEX idx_repositories_languages_synced_at ON repositories(languages_synced_at);
+
+COMMENT ON COLUMN repositories.languages_synced_at IS 'When the languages of the repository were last read from GitHub';
+COMMENT ON TABLE repository_languages IS 'Bytes of code of repositories in each language as detected by GitHub';
@@ -0,0 +1,3 @@
+-- Migration rollback: Image builds
+
+DROP TABLE IF EXISTS run_image_builds;
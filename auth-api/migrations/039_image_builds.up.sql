@@ -0,0 +1,14 @@
+-- Migration: Image builds
+-- The container image image-build runs built: layers built and cached, image size and the
+-- bytes pushed to the registry
+
+CREATE TABLE run_image_builds (
+    run_id UUID PRIMARY KEY REFERENCES runs(id) ON DELETE CASCADE,
+    image VARCHAR(255),
+    layers_built INTEGER NOT NULL CHECK (layers_built >= 0),
+    layers_cached INTEGER NOT NULL CHECK (layers_cached >= 0),
+    image_size_bytes BIGINT CHECK (image_size_bytes >= 0),
+    push_bytes BIGINT CHECK (push_bytes >= 0)
+);
+
+COMMENT ON TABLE run_image_builds IS 'Container images built by image-build runs';
@@ -0,0 +1,5 @@
+-- Migration rollback: Release tags
+
+DROP INDEX IF EXISTS idx_runs_repo_git_tag;
+
+ALTER TABLE runs DROP COLUMN IF EXISTS git_tag;
@@ -0,0 +1,9 @@
+-- Migration: Release tags
+-- Runs submitted for a git tag or release carry it, so the CI between two tags can be
+-- attributed to the release it produced.
+
+ALTER TABLE runs ADD COLUMN git_tag VARCHAR(255);
+
+CREATE INDEX idx_runs_repo_git_tag ON runs(repository_id, git_tag) WHERE deleted_at IS NULL AND git_tag IS NOT NULL;
+
+COMMENT ON COLUMN runs.git_tag IS 'Git tag or release the run was submitted for';
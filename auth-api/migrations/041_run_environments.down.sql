@@ -0,0 +1,7 @@
+-- Migration rollback: Run environments
+
+DROP INDEX IF EXISTS idx_runs_repo_environment;
+
+ALTER TABLE runs DROP CONSTRAINT IF EXISTS runs_environment_check;
+
+ALTER TABLE runs DROP COLUMN IF EXISTS environment;
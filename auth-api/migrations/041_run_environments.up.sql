@@ -0,0 +1,11 @@
+-- Migration: Run environments
+-- Runs are submitted for an environment, so deployment pipelines can be reported apart from
+-- test pipelines. Existing runs were CI runs.
+
+ALTER TABLE runs ADD COLUMN environment VARCHAR(32) NOT NULL DEFAULT 'ci';
+
+ALTER TABLE runs ADD CONSTRAINT runs_environment_check CHECK (environment IN ('ci', 'staging', 'production-deploy'));
+
+CREATE INDEX idx_runs_repo_environment ON runs(repository_id, environment) WHERE deleted_at IS NULL;
+
+COMMENT ON COLUMN runs.environment IS 'Environment of the run: ci, staging or production-deploy';
@@ -0,0 +1,3 @@
+-- Migration rollback: Run comments
+
+DROP TABLE IF EXISTS run_comments;
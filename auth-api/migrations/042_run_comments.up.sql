@@ -0,0 +1,19 @@
+-- Migration: Run comments
+-- Threaded comments on runs, so teams can annotate spikes and regressions next to the data.
+-- Replies reference a top-level comment of the same run and are deleted with it.
+
+CREATE TABLE run_comments (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    run_id UUID NOT NULL REFERENCES runs(id) ON DELETE CASCADE,
+    parent_id UUID REFERENCES run_comments(id) ON DELETE CASCADE,
+    author_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    body TEXT NOT NULL CHECK (char_length(body) BETWEEN 1 AND 5000),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_run_comments_run_created ON run_comments(run_id, created_at);
+CREATE INDEX idx_run_comments_parent ON run_comments(parent_id) WHERE parent_id IS NOT NULL;
+
+COMMENT ON TABLE run_comments IS 'Threaded comments on runs';
+COMMENT ON COLUMN run_comments.parent_id IS 'Top-level comment this comment replies to; NULL for top-level comments';
@@ -0,0 +1,3 @@
+-- Migration rollback: Saved views
+
+DROP TABLE IF EXISTS saved_views;
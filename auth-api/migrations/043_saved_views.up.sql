@@ -0,0 +1,24 @@
+-- Migration: Saved views
+-- Per-user bookmarks of recurring run queries: a filter expression, sort, grouping and a
+-- date range relative to now, optionally of one repository.
+
+CREATE TABLE saved_views (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    repository_id UUID REFERENCES repositories(id) ON DELETE CASCADE,
+    filter TEXT,
+    sort VARCHAR(32),
+    sort_order VARCHAR(4) CHECK (sort_order IN ('asc', 'desc')),
+    group_by VARCHAR(128),
+    range_days INTEGER CHECK (range_days BETWEEN 1 AND 3650),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_saved_views_user_name ON saved_views(user_id, name);
+CREATE INDEX idx_saved_views_repository_id ON saved_views(repository_id);
+
+COMMENT ON TABLE saved_views IS 'Saved run queries of users';
+COMMENT ON COLUMN saved_views.filter IS 'Run filter expression, such as branch=main AND tag=nightly';
+COMMENT ON COLUMN saved_views.range_days IS 'Number of days up to now the view covers; NULL for all time';
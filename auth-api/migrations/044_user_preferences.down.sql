@@ -0,0 +1,3 @@
+-- Migration rollback: User preferences
+
+DROP TABLE IF EXISTS user_preferences;
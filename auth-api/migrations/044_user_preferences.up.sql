@@ -0,0 +1,16 @@
+-- Migration: User preferences
+-- Settings of users beyond the display units and email opt-outs kept on users. Users without
+-- a row use the defaults.
+
+CREATE TABLE user_preferences (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC',
+    locale VARCHAR(35) NOT NULL DEFAULT 'en',
+    default_range_days INTEGER NOT NULL DEFAULT 30 CHECK (default_range_days BETWEEN 1 AND 365),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+COMMENT ON COLUMN user_preferences.timezone IS 'IANA time zone reports are rendered in';
+COMMENT ON COLUMN user_preferences.locale IS 'BCP 47 language tag numbers and dates are formatted for';
+COMMENT ON COLUMN user_preferences.default_range_days IS 'Date range dashboards show when none is chosen';
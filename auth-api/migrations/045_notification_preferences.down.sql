@@ -0,0 +1,4 @@
+-- Migration rollback: Notification preferences
+
+DROP TABLE IF EXISTS notification_preferences;
+ALTER TABLE user_preferences DROP COLUMN IF EXISTS slack_user_id;
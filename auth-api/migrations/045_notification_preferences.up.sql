@@ -0,0 +1,32 @@
+-- Migration: Notification preferences
+-- The channel users receive each notification event on, for all their notifications or only
+-- those of a repository or organization, and the Slack member ID direct messages go to.
+
+ALTER TABLE user_preferences ADD COLUMN slack_user_id VARCHAR(32);
+
+COMMENT ON COLUMN user_preferences.slack_user_id IS 'Slack member ID notifications are sent to as direct messages';
+
+CREATE TABLE notification_preferences (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    repository_id UUID REFERENCES repositories(id) ON DELETE CASCADE,
+    organization_id UUID REFERENCES organizations(id) ON DELETE CASCADE,
+    event VARCHAR(32) NOT NULL CHECK (event IN ('regression.detected', 'budget.exceeded', 'weekly.digest', 'org.announcement')),
+    channel VARCHAR(16) NOT NULL CHECK (channel IN ('email', 'slack_dm', 'none')),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CHECK (repository_id IS NULL OR organization_id IS NULL)
+);
+
+-- One preference per event and scope; COALESCE lets the unscoped preferences collide too
+CREATE UNIQUE INDEX idx_notification_preferences_scope ON notification_preferences (
+    user_id,
+    event,
+    COALESCE(repository_id, '00000000-0000-0000-0000-000000000000'),
+    COALESCE(organization_id, '00000000-0000-0000-0000-000000000000')
+);
+CREATE INDEX idx_notification_preferences_repository_id ON notification_preferences(repository_id);
+CREATE INDEX idx_notification_preferences_organization_id ON notification_preferences(organization_id);
+
+COMMENT ON TABLE notification_preferences IS 'Channel users receive notification events on, per repository, organization or for all';
+COMMENT ON COLUMN notification_preferences.channel IS 'email, slack_dm or none';
@@ -0,0 +1,3 @@
+-- Migration rollback: GitHub credentials
+
+DROP TABLE IF EXISTS github_credentials;
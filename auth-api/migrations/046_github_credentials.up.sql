@@ -0,0 +1,12 @@
+-- Migration: GitHub credentials
+-- The GitHub OAuth token of every user's last sign-in, used to refresh their profile and
+-- repositories on demand. Tokens GitHub rejects are removed.
+
+CREATE TABLE github_credentials (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    access_token TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+COMMENT ON TABLE github_credentials IS 'GitHub OAuth token of the last sign-in of each user';
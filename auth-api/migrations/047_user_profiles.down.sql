@@ -0,0 +1,4 @@
+-- Migration rollback: User profiles
+
+ALTER TABLE user_preferences DROP COLUMN IF EXISTS profile_stats;
+ALTER TABLE user_preferences DROP COLUMN IF EXISTS profile_visibility;
@@ -0,0 +1,10 @@
+-- Migration: User profiles
+-- Who may see the profile of a user and whether it shows their aggregate statistics. Profiles
+-- are private until their user chooses otherwise.
+
+ALTER TABLE user_preferences
+    ADD COLUMN profile_visibility VARCHAR(16) NOT NULL DEFAULT 'private' CHECK (profile_visibility IN ('private', 'organization', 'public')),
+    ADD COLUMN profile_stats BOOLEAN NOT NULL DEFAULT FALSE;
+
+COMMENT ON COLUMN user_preferences.profile_visibility IS 'private, organization (members of a shared organization) or public';
+COMMENT ON COLUMN user_preferences.profile_stats IS 'Whether the profile shows the aggregate statistics of the user';
@@ -0,0 +1,3 @@
+-- Migration rollback: API tokens
+
+DROP TABLE IF EXISTS api_tokens;
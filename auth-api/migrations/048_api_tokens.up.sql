@@ -0,0 +1,20 @@
+-- Migration: API tokens
+-- Named tokens users create for API clients, with an optional expiry and the time and source
+-- IP of their last use to spot stale or leaked tokens.
+
+CREATE TABLE api_tokens (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    last_used_ip VARCHAR(45),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_api_tokens_user_id ON api_tokens(user_id);
+
+COMMENT ON TABLE api_tokens IS 'Long-lived API tokens of users; the ID is the ID of the JWT';
+COMMENT ON COLUMN api_tokens.expires_at IS 'NULL for tokens that never expire';
+COMMENT ON COLUMN api_tokens.last_used_ip IS 'Client IP of the last authenticated request';
@@ -0,0 +1,4 @@
+-- Migration rollback: Signed run submissions
+
+ALTER TABLE repositories DROP COLUMN IF EXISTS run_signing_secret;
+ALTER TABLE repositories DROP COLUMN IF EXISTS signed_runs;
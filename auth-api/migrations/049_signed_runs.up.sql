@@ -0,0 +1,9 @@
+-- Migration: Signed run submissions
+-- Repositories can require runs to carry an HMAC signature made with a per-repository secret,
+-- so runs from semi-trusted CI environments are authenticated and checked for tampering.
+
+ALTER TABLE repositories ADD COLUMN signed_runs BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE repositories ADD COLUMN run_signing_secret VARCHAR(64);
+
+COMMENT ON COLUMN repositories.signed_runs IS 'Whether submitted runs must be signed with run_signing_secret';
+COMMENT ON COLUMN repositories.run_signing_secret IS 'Hex-encoded HMAC-SHA256 secret of run signatures';
@@ -0,0 +1,3 @@
+-- Migration rollback: Organization member roles
+
+ALTER TABLE organization_members DROP COLUMN IF EXISTS role;
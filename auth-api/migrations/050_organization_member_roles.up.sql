@@ -0,0 +1,7 @@
+-- Migration: Organization member roles
+-- Records the role of each member in their GitHub organization, so destructive organization
+-- settings such as the data retention policy can be limited to admins.
+
+ALTER TABLE organization_members ADD COLUMN role VARCHAR(16) NOT NULL DEFAULT 'member';
+
+COMMENT ON COLUMN organization_members.role IS 'member or admin, the role on GitHub synced at login';